@@ -0,0 +1,59 @@
+// Command bench measures the ingest throughput of this machine: it builds
+// the server as configured, without opening its ports, feeds a corpus of
+// device sessions through the pipeline and prints the report as JSON.
+// Positions go to the configured storage, or to memory with -memory.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+
+	"tracking/internal/app"
+	"tracking/internal/cache"
+	"tracking/internal/config"
+	"tracking/internal/core/model"
+)
+
+func main() {
+	rounds := flag.Int("rounds", 10, "times every session is replayed")
+	corpus := flag.String("corpus", "", "JSON file of sessions to replay instead of the built-in corpus")
+	memory := flag.Bool("memory", false, "store positions in memory instead of the configured storage")
+	flag.Parse()
+
+	var sessions []model.BenchmarkSession
+	if *corpus != "" {
+		data, err := os.ReadFile(*corpus)
+		if err != nil {
+			log.Fatalf("Failed to read corpus: %v", err)
+		}
+		if err := json.Unmarshal(data, &sessions); err != nil {
+			log.Fatalf("Failed to parse corpus: %v", err)
+		}
+	}
+
+	cfg := config.LoadConfig()
+	var opts []app.Option
+	if *memory {
+		opts = append(opts, app.WithRepositories(app.NewInMemoryRepositories()))
+	} else {
+		cache.Initialize(cfg.RedisURL)
+		defer cache.Close()
+	}
+	application, err := app.New(cfg, opts...)
+	if err != nil {
+		log.Fatalf("Failed to initialize application: %v", err)
+	}
+
+	report, err := application.Services.Benchmark.Run(sessions, *rounds)
+	if err != nil {
+		log.Fatalf("Benchmark failed: %v", err)
+	}
+	log.Printf("Sustained %.0f frames and %.0f positions per second; %s took the most time",
+		report.FramesPerSecond, report.PositionsPerSecond, report.Bottleneck)
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(report)
+}
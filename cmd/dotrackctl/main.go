@@ -0,0 +1,222 @@
+// Command dotrackctl operates a running server through its REST API, so
+// that scripts need not make HTTP calls by hand:
+//
+//	dotrackctl login -email admin@example.com -password secret
+//	dotrackctl devices list
+//	dotrackctl devices create -name Truck -unique-id 359586015829802
+//	dotrackctl command -device ID -type setInterval -interval 30
+//	dotrackctl tail [-device ID]... [-organization ID]...
+//	dotrackctl export [-o bundle.json]
+//
+// The server is taken from -server or DOTRACK_URL. login keeps the access
+// token in the user's configuration directory; DOTRACK_TOKEN overrides it.
+// Results are printed as JSON, tailed updates one per line.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+
+	"tracking/internal/client"
+	"tracking/internal/core/model"
+)
+
+const usage = `usage: dotrackctl [-server URL] <command> [flags]
+
+commands:
+  login            sign in and keep the access token
+  devices list     list your devices
+  devices create   register a device
+  command          queue a command for a device
+  tail             print live positions, events and status changes
+  export           download the configuration bundle (admin)
+`
+
+// listFlag collects a flag given several times
+type listFlag []string
+
+func (l *listFlag) String() string     { return strings.Join(*l, ",") }
+func (l *listFlag) Set(v string) error { *l = append(*l, v); return nil }
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("dotrackctl: ")
+	flag.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	defaultServer := os.Getenv("DOTRACK_URL")
+	if defaultServer == "" {
+		defaultServer = "http://localhost:8000"
+	}
+	server := flag.String("server", defaultServer, "URL of the server")
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	c := client.New(*server, loadToken())
+	args := flag.Args()
+	var err error
+	switch args[0] {
+	case "login":
+		err = login(c, args[1:])
+	case "devices":
+		err = devices(c, args[1:])
+	case "command":
+		err = command(c, args[1:])
+	case "tail":
+		err = tail(c, args[1:])
+	case "export":
+		err = export(c, args[1:])
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func login(c *client.Client, args []string) error {
+	flags := flag.NewFlagSet("login", flag.ExitOnError)
+	email := flags.String("email", "", "email of the user")
+	password := flags.String("password", "", "password of the user")
+	flags.Parse(args)
+	if *email == "" {
+		return errors.New("login needs -email")
+	}
+
+	token, err := c.Login(*email, *password)
+	if err != nil {
+		return err
+	}
+	path, err := tokenPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, []byte(token), 0o600); err != nil {
+		return err
+	}
+	log.Printf("Logged in as %s", *email)
+	return nil
+}
+
+func devices(c *client.Client, args []string) error {
+	if len(args) == 0 {
+		return errors.New("devices needs list or create")
+	}
+	switch args[0] {
+	case "list":
+		list, err := c.Devices()
+		if err != nil {
+			return err
+		}
+		return printJSON(list)
+	case "create":
+		flags := flag.NewFlagSet("devices create", flag.ExitOnError)
+		name := flags.String("name", "", "name of the device")
+		uniqueID := flags.String("unique-id", "", "IMEI or other ID the device reports")
+		organizationID := flags.String("organization", "", "organization to register the device in")
+		flags.Parse(args[1:])
+		if *name == "" || *uniqueID == "" {
+			return errors.New("devices create needs -name and -unique-id")
+		}
+		device, err := c.CreateDevice(*name, *uniqueID, *organizationID)
+		if err != nil {
+			return err
+		}
+		return printJSON(device)
+	default:
+		return fmt.Errorf("unknown devices command %q", args[0])
+	}
+}
+
+func command(c *client.Client, args []string) error {
+	flags := flag.NewFlagSet("command", flag.ExitOnError)
+	deviceID := flags.String("device", "", "ID of the device")
+	commandType := flags.String("type", "", "command type: "+strings.Join(model.CommandTypes, ", "))
+	interval := flags.Int("interval", 0, "seconds, for setInterval")
+	angle := flags.Int("angle", 0, "degrees, for setCornerReporting")
+	flags.Parse(args)
+	if *deviceID == "" || *commandType == "" {
+		return errors.New("command needs -device and -type")
+	}
+
+	queued, err := c.SendCommand(*deviceID, *commandType, *interval, *angle)
+	if err != nil {
+		return err
+	}
+	return printJSON(queued)
+}
+
+func tail(c *client.Client, args []string) error {
+	flags := flag.NewFlagSet("tail", flag.ExitOnError)
+	var deviceIDs, organizationIDs listFlag
+	flags.Var(&deviceIDs, "device", "ID of a device to follow; may be repeated")
+	flags.Var(&organizationIDs, "organization", "ID of an organization to follow; may be repeated")
+	flags.Parse(args)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	encoder := json.NewEncoder(os.Stdout)
+	return c.Tail(ctx, deviceIDs, organizationIDs, func(update *model.LiveUpdate) error {
+		return encoder.Encode(update)
+	})
+}
+
+func export(c *client.Client, args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	output := flags.String("o", "", "file to write the bundle to; standard output when empty")
+	flags.Parse(args)
+
+	if *output == "" {
+		return c.Export(os.Stdout)
+	}
+	file, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	if err := c.Export(file); err != nil {
+		file.Close()
+		os.Remove(*output)
+		return err
+	}
+	return file.Close()
+}
+
+// loadToken returns the token in DOTRACK_TOKEN, or the one login kept
+func loadToken() string {
+	if token := os.Getenv("DOTRACK_TOKEN"); token != "" {
+		return token
+	}
+	path, err := tokenPath()
+	if err != nil {
+		return ""
+	}
+	token, _ := os.ReadFile(path)
+	return strings.TrimSpace(string(token))
+}
+
+func tokenPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "dotrackctl", "token"), nil
+}
+
+func printJSON(v interface{}) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
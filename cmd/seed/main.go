@@ -0,0 +1,49 @@
+// Command seed fills the MongoDB database named by MONGODB_URI and
+// MONGODB_DATABASE with demo organizations, users, devices and tracks.
+// With -dry-run it seeds in-memory storage instead and only reports counts.
+package main
+
+import (
+	"flag"
+	"log"
+	"time"
+
+	"tracking/internal/app"
+	"tracking/internal/config"
+	"tracking/internal/seed"
+)
+
+func main() {
+	opts := seed.DefaultOptions()
+	flag.IntVar(&opts.Organizations, "orgs", opts.Organizations, "number of organizations")
+	flag.IntVar(&opts.UsersPerOrganization, "users", opts.UsersPerOrganization, "users per organization")
+	flag.IntVar(&opts.DevicesPerOrganization, "devices", opts.DevicesPerOrganization, "devices per organization")
+	flag.IntVar(&opts.Days, "days", opts.Days, "days of history per device")
+	flag.IntVar(&opts.TripsPerDay, "trips", opts.TripsPerDay, "trips per device and day")
+	flag.DurationVar(&opts.Interval, "interval", opts.Interval, "time between positions while driving")
+	flag.Int64Var(&opts.Seed, "seed", opts.Seed, "random seed; the same seed gives the same data")
+	dryRun := flag.Bool("dry-run", false, "seed in-memory storage and only report what would be created")
+	flag.Parse()
+
+	var repos app.Repositories
+	if *dryRun {
+		repos = app.NewInMemoryRepositories()
+	} else {
+		db, err := config.ConnectMongoDB(config.NewMongoConfig())
+		if err != nil {
+			log.Fatalf("Failed to connect to MongoDB: %v", err)
+		}
+		repos = app.NewMongoRepositories(db)
+	}
+
+	started := time.Now()
+	summary, err := seed.Run(repos, opts)
+	if summary != nil {
+		log.Printf("Created %d organizations, %d users, %d devices and %d positions in %v",
+			summary.Organizations, summary.Users, summary.Devices, summary.Positions, time.Since(started).Round(time.Millisecond))
+	}
+	if err != nil {
+		log.Fatalf("Seeding failed: %v", err)
+	}
+	log.Printf("Seeded users sign in with password %q", seed.DemoPassword)
+}
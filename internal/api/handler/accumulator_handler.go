@@ -0,0 +1,134 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+	"tracking/internal/api/util"
+	"tracking/internal/core/model"
+	"tracking/internal/core/service"
+)
+
+// AccumulatorHandler reads and sets the odometer and engine hours of devices
+type AccumulatorHandler struct {
+	accumulatorService service.AccumulatorService
+}
+
+func NewAccumulatorHandler(accumulatorService service.AccumulatorService) *AccumulatorHandler {
+	return &AccumulatorHandler{
+		accumulatorService: accumulatorService,
+	}
+}
+
+// Get returns the totals of the device given by deviceId
+func (h *AccumulatorHandler) Get(w http.ResponseWriter, r *http.Request) {
+	deviceID := r.URL.Query().Get("deviceId")
+	if deviceID == "" {
+		http.Error(w, "Device ID required", http.StatusBadRequest)
+		return
+	}
+	claims, err := util.GetUserClaims(r)
+	if err != nil {
+		http.Error(w, "Invalid authorization token", http.StatusUnauthorized)
+		return
+	}
+
+	accumulators, err := h.accumulatorService.GetAccumulators(deviceID, claims.UserID)
+	if err != nil {
+		writeAccumulatorError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(accumulators)
+}
+
+// Set stores the baseline in the body and returns the recounted totals
+func (h *AccumulatorHandler) Set(w http.ResponseWriter, r *http.Request) {
+	claims, err := util.GetUserClaims(r)
+	if err != nil {
+		http.Error(w, "Invalid authorization token", http.StatusUnauthorized)
+		return
+	}
+	var req model.AccumulatorBaseline
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	accumulators, err := h.accumulatorService.SetAccumulators(claims.UserID, &req)
+	if err != nil {
+		writeAccumulatorError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(accumulators)
+}
+
+// Baselines lists the baselines set on the device given by deviceId
+func (h *AccumulatorHandler) Baselines(w http.ResponseWriter, r *http.Request) {
+	deviceID := r.URL.Query().Get("deviceId")
+	if deviceID == "" {
+		http.Error(w, "Device ID required", http.StatusBadRequest)
+		return
+	}
+	claims, err := util.GetUserClaims(r)
+	if err != nil {
+		http.Error(w, "Invalid authorization token", http.StatusUnauthorized)
+		return
+	}
+
+	baselines, err := h.accumulatorService.GetBaselines(deviceID, claims.UserID)
+	if err != nil {
+		writeAccumulatorError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(baselines)
+}
+
+// Utilization reports the use of the device given by deviceId between the
+// RFC 3339 times from and to
+func (h *AccumulatorHandler) Utilization(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	deviceID := params.Get("deviceId")
+	if deviceID == "" {
+		http.Error(w, "Device ID required", http.StatusBadRequest)
+		return
+	}
+	claims, err := util.GetUserClaims(r)
+	if err != nil {
+		http.Error(w, "Invalid authorization token", http.StatusUnauthorized)
+		return
+	}
+	var from, to time.Time
+	for name, instant := range map[string]*time.Time{"from": &from, "to": &to} {
+		if *instant, err = time.Parse(time.RFC3339, params.Get(name)); err != nil {
+			http.Error(w, "Invalid "+name+" parameter, expected RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+	}
+
+	utilization, err := h.accumulatorService.GetUtilization(deviceID, claims.UserID, from, to)
+	if err != nil {
+		writeAccumulatorError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(utilization)
+}
+
+func writeAccumulatorError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrDeviceNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, service.ErrInvalidAccumulators):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
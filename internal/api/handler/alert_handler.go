@@ -0,0 +1,148 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+	"tracking/internal/api/util"
+	"tracking/internal/core/service"
+)
+
+// AlertHandler acknowledges events and snoozes device alerts
+type AlertHandler struct {
+	alertService  service.AlertService
+	deviceService service.DeviceService
+}
+
+func NewAlertHandler(alertService service.AlertService, deviceService service.DeviceService) *AlertHandler {
+	return &AlertHandler{
+		alertService:  alertService,
+		deviceService: deviceService,
+	}
+}
+
+// Acknowledge marks the event given by id as seen to by the user
+func (h *AlertHandler) Acknowledge(w http.ResponseWriter, r *http.Request) {
+	eventID := r.URL.Query().Get("id")
+	if eventID == "" {
+		http.Error(w, "Event ID required", http.StatusBadRequest)
+		return
+	}
+	claims, err := util.GetUserClaims(r)
+	if err != nil {
+		http.Error(w, "Invalid authorization token", http.StatusUnauthorized)
+		return
+	}
+
+	event, err := h.alertService.Acknowledge(eventID, claims.UserID)
+	if errors.Is(err, service.ErrEventNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(event)
+}
+
+type snoozeRequest struct {
+	EventType string    `json:"eventType"` // Empty to snooze every alert
+	Until     time.Time `json:"until"`
+	Reason    string    `json:"reason"`
+}
+
+// Snooze silences alerts of the device given by deviceId until the time in
+// the body
+func (h *AlertHandler) Snooze(w http.ResponseWriter, r *http.Request) {
+	deviceID, userID, ok := h.authorizeDevice(w, r)
+	if !ok {
+		return
+	}
+
+	var req snoozeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	snooze, err := h.alertService.Snooze(deviceID, userID, req.EventType, req.Until, req.Reason)
+	if errors.Is(err, service.ErrInvalidSnooze) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(snooze)
+}
+
+// GetSnoozes lists the snoozes of the device given by deviceId
+func (h *AlertHandler) GetSnoozes(w http.ResponseWriter, r *http.Request) {
+	deviceID, _, ok := h.authorizeDevice(w, r)
+	if !ok {
+		return
+	}
+
+	snoozes, err := h.alertService.GetSnoozes(deviceID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(snoozes)
+}
+
+// CancelSnooze ends the snooze given by id
+func (h *AlertHandler) CancelSnooze(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, "Snooze ID required", http.StatusBadRequest)
+		return
+	}
+	claims, err := util.GetUserClaims(r)
+	if err != nil {
+		http.Error(w, "Invalid authorization token", http.StatusUnauthorized)
+		return
+	}
+
+	snooze, err := h.alertService.CancelSnooze(id, claims.UserID)
+	if errors.Is(err, service.ErrSnoozeNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(snooze)
+}
+
+// authorizeDevice reads the deviceId parameter and checks the user may
+// access the device, writing the error response when not
+func (h *AlertHandler) authorizeDevice(w http.ResponseWriter, r *http.Request) (string, string, bool) {
+	deviceID := r.URL.Query().Get("deviceId")
+	if deviceID == "" {
+		http.Error(w, "Device ID required", http.StatusBadRequest)
+		return "", "", false
+	}
+	claims, err := util.GetUserClaims(r)
+	if err != nil {
+		http.Error(w, "Invalid authorization token", http.StatusUnauthorized)
+		return "", "", false
+	}
+	if err := h.deviceService.ValidateDeviceAccess(deviceID, claims.UserID); err != nil {
+		http.Error(w, "Unauthorized access to device", http.StatusForbidden)
+		return "", "", false
+	}
+	return deviceID, claims.UserID, true
+}
@@ -7,14 +7,16 @@ import (
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"tracking/internal/core/util"
 )
 
 type AuthHandler struct {
 	accessSecret  string
 	refreshSecret string
+	clock         util.Clock
 }
 
-func NewAuthHandler() *AuthHandler {
+func NewAuthHandler(clock util.Clock) *AuthHandler {
 	accessSecret := os.Getenv("JWT_ACCESS_SECRET")
 	if accessSecret == "" {
 		accessSecret = "test_jwt_secret_key_123" // Default secret for development
@@ -28,6 +30,7 @@ func NewAuthHandler() *AuthHandler {
 	return &AuthHandler{
 		accessSecret:  accessSecret,
 		refreshSecret: refreshSecret,
+		clock:         clock,
 	}
 }
 
@@ -77,7 +80,7 @@ func (h *AuthHandler) TestLogin(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *AuthHandler) generateAccessToken(email string) (string, error) {
-	now := time.Now()
+	now := h.clock.Now()
 	claims := jwt.MapClaims{
 		"sub":   "test-user-id",
 		"email": email,
@@ -92,7 +95,7 @@ func (h *AuthHandler) generateAccessToken(email string) (string, error) {
 }
 
 func (h *AuthHandler) generateRefreshToken(email string) (string, error) {
-	now := time.Now()
+	now := h.clock.Now()
 	claims := jwt.MapClaims{
 		"sub":   "test-user-id",
 		"email": email,
@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"tracking/internal/core/model"
+	"tracking/internal/core/service"
+)
+
+// BenchmarkHandler lets admins measure the ingest throughput of the server
+type BenchmarkHandler struct {
+	benchmarkService service.BenchmarkService
+}
+
+func NewBenchmarkHandler(benchmarkService service.BenchmarkService) *BenchmarkHandler {
+	return &BenchmarkHandler{
+		benchmarkService: benchmarkService,
+	}
+}
+
+// Run replays the sessions in the body, or the built-in corpus when the
+// body is empty, and returns the throughput and stage timings. It holds
+// the request until the run ends.
+func (h *BenchmarkHandler) Run(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	var req struct {
+		Sessions []model.BenchmarkSession `json:"sessions"`
+		Rounds   int                      `json:"rounds"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	report, err := h.benchmarkService.Run(req.Sessions, req.Rounds)
+	if errors.Is(err, service.ErrInvalidBenchmark) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, service.ErrBenchmarkRunning) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
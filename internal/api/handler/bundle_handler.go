@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"tracking/internal/core/model"
+	"tracking/internal/core/service"
+)
+
+// BundleHandler exports and imports the server configuration; both
+// endpoints require an admin
+type BundleHandler struct {
+	bundleService service.BundleService
+}
+
+func NewBundleHandler(bundleService service.BundleService) *BundleHandler {
+	return &BundleHandler{
+		bundleService: bundleService,
+	}
+}
+
+// Export returns the bundle as a JSON download. It holds device API
+// secrets and must be kept as safe as the database.
+func (h *BundleHandler) Export(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	bundle, err := h.bundleService.Export()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"tracking-%s.json\"", bundle.ExportedAt.UTC().Format("20060102-150405")))
+	json.NewEncoder(w).Encode(bundle)
+}
+
+func (h *BundleHandler) Import(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	var bundle model.Bundle
+	if err := json.NewDecoder(r.Body).Decode(&bundle); err != nil {
+		http.Error(w, "Invalid bundle", http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.bundleService.Import(&bundle)
+	if err != nil && result == nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		// Entities created before the failure stay; the result lists them
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{"error": err.Error(), "imported": result})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
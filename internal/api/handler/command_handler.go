@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"tracking/internal/api/util"
+	"tracking/internal/core/service"
+)
+
+// CommandHandler queues commands for devices and reports their delivery
+type CommandHandler struct {
+	commandService service.CommandService
+	deviceService  service.DeviceService
+}
+
+func NewCommandHandler(commandService service.CommandService, deviceService service.DeviceService) *CommandHandler {
+	return &CommandHandler{
+		commandService: commandService,
+		deviceService:  deviceService,
+	}
+}
+
+type queueCommandRequest struct {
+	Type     string `json:"type"`
+	Interval int    `json:"interval"` // Seconds, for setInterval
+	Angle    int    `json:"angle"`    // Degrees, for setCornerReporting
+}
+
+// Queue queues the command in the body for the device given by deviceId.
+// It is sent at once when the device is connected and otherwise when it
+// next connects.
+func (h *CommandHandler) Queue(w http.ResponseWriter, r *http.Request) {
+	deviceID, userID, ok := h.authorizeDevice(w, r)
+	if !ok {
+		return
+	}
+
+	var req queueCommandRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	command, err := h.commandService.QueueCommand(deviceID, userID, req.Type, req.Interval, req.Angle)
+	if errors.Is(err, service.ErrInvalidCommand) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(command)
+}
+
+// List returns the commands of the device given by deviceId, oldest first
+func (h *CommandHandler) List(w http.ResponseWriter, r *http.Request) {
+	deviceID, _, ok := h.authorizeDevice(w, r)
+	if !ok {
+		return
+	}
+
+	commands, err := h.commandService.GetCommands(deviceID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(commands)
+}
+
+// Cancel withdraws the command given by id before it is sent
+func (h *CommandHandler) Cancel(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, "Command ID required", http.StatusBadRequest)
+		return
+	}
+	claims, err := util.GetUserClaims(r)
+	if err != nil {
+		http.Error(w, "Invalid authorization token", http.StatusUnauthorized)
+		return
+	}
+
+	command, err := h.commandService.CancelCommand(id, claims.UserID)
+	if errors.Is(err, service.ErrCommandNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, service.ErrInvalidCommand) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(command)
+}
+
+// authorizeDevice reads the deviceId parameter and checks the user may
+// access the device, writing the error response when not
+func (h *CommandHandler) authorizeDevice(w http.ResponseWriter, r *http.Request) (string, string, bool) {
+	deviceID := r.URL.Query().Get("deviceId")
+	if deviceID == "" {
+		http.Error(w, "Device ID required", http.StatusBadRequest)
+		return "", "", false
+	}
+	claims, err := util.GetUserClaims(r)
+	if err != nil {
+		http.Error(w, "Invalid authorization token", http.StatusUnauthorized)
+		return "", "", false
+	}
+	if err := h.deviceService.ValidateDeviceAccess(deviceID, claims.UserID); err != nil {
+		http.Error(w, "Unauthorized access to device", http.StatusForbidden)
+		return "", "", false
+	}
+	return deviceID, claims.UserID, true
+}
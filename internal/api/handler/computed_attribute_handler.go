@@ -0,0 +1,157 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"tracking/internal/api/util"
+	"tracking/internal/core/model"
+	"tracking/internal/core/service"
+)
+
+// ComputedAttributeHandler manages the computed attributes of devices
+type ComputedAttributeHandler struct {
+	attributeService service.ComputedAttributeService
+}
+
+func NewComputedAttributeHandler(attributeService service.ComputedAttributeService) *ComputedAttributeHandler {
+	return &ComputedAttributeHandler{
+		attributeService: attributeService,
+	}
+}
+
+type testExpressionRequest struct {
+	DeviceID   string `json:"deviceId"`
+	Expression string `json:"expression"`
+}
+
+// List returns the attributes of the device given by deviceId
+func (h *ComputedAttributeHandler) List(w http.ResponseWriter, r *http.Request) {
+	deviceID := r.URL.Query().Get("deviceId")
+	if deviceID == "" {
+		http.Error(w, "Device ID required", http.StatusBadRequest)
+		return
+	}
+	claims, err := util.GetUserClaims(r)
+	if err != nil {
+		http.Error(w, "Invalid authorization token", http.StatusUnauthorized)
+		return
+	}
+
+	attributes, err := h.attributeService.GetAttributes(deviceID, claims.UserID)
+	if err != nil {
+		writeComputedAttributeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(attributes)
+}
+
+// Create defines the attribute in the body on its device
+func (h *ComputedAttributeHandler) Create(w http.ResponseWriter, r *http.Request) {
+	claims, err := util.GetUserClaims(r)
+	if err != nil {
+		http.Error(w, "Invalid authorization token", http.StatusUnauthorized)
+		return
+	}
+	var req model.ComputedAttribute
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	attribute, err := h.attributeService.CreateAttribute(claims.UserID, &req)
+	if err != nil {
+		writeComputedAttributeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(attribute)
+}
+
+// Update replaces the attribute given by id
+func (h *ComputedAttributeHandler) Update(w http.ResponseWriter, r *http.Request) {
+	attributeID := r.URL.Query().Get("id")
+	if attributeID == "" {
+		http.Error(w, "Attribute ID required", http.StatusBadRequest)
+		return
+	}
+	claims, err := util.GetUserClaims(r)
+	if err != nil {
+		http.Error(w, "Invalid authorization token", http.StatusUnauthorized)
+		return
+	}
+	var req model.ComputedAttribute
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	attribute, err := h.attributeService.UpdateAttribute(attributeID, claims.UserID, &req)
+	if err != nil {
+		writeComputedAttributeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(attribute)
+}
+
+// Delete removes the attribute given by id
+func (h *ComputedAttributeHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	attributeID := r.URL.Query().Get("id")
+	if attributeID == "" {
+		http.Error(w, "Attribute ID required", http.StatusBadRequest)
+		return
+	}
+	claims, err := util.GetUserClaims(r)
+	if err != nil {
+		http.Error(w, "Invalid authorization token", http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.attributeService.DeleteAttribute(attributeID, claims.UserID); err != nil {
+		writeComputedAttributeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "deleted"})
+}
+
+// Test validates an expression and returns its value for the latest
+// position of the device, null when it has none
+func (h *ComputedAttributeHandler) Test(w http.ResponseWriter, r *http.Request) {
+	claims, err := util.GetUserClaims(r)
+	if err != nil {
+		http.Error(w, "Invalid authorization token", http.StatusUnauthorized)
+		return
+	}
+	var req testExpressionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	value, err := h.attributeService.TestExpression(req.DeviceID, claims.UserID, req.Expression)
+	if err != nil {
+		writeComputedAttributeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"value": value})
+}
+
+func writeComputedAttributeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrComputedAttributeNotFound), errors.Is(err, service.ErrDeviceNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, service.ErrInvalidComputedAttribute):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+	"tracking/internal/api/util"
+	"tracking/internal/core/model"
+	"tracking/internal/core/service"
+)
+
+// DashboardHandler serves the chart series of dashboard widgets. Every
+// widget takes from and to as RFC 3339 times and the device filters of the
+// device listing.
+type DashboardHandler struct {
+	dashboardService service.DashboardService
+	filterService    service.FilterService
+}
+
+func NewDashboardHandler(dashboardService service.DashboardService, filterService service.FilterService) *DashboardHandler {
+	return &DashboardHandler{
+		dashboardService: dashboardService,
+		filterService:    filterService,
+	}
+}
+
+// TopSpeeders ranks the limit devices with the highest speeds
+func (h *DashboardHandler) TopSpeeders(w http.ResponseWriter, r *http.Request) {
+	h.serve(w, r, h.dashboardService.TopSpeeders)
+}
+
+// MostDistance ranks the limit devices that covered the most kilometers
+func (h *DashboardHandler) MostDistance(w http.ResponseWriter, r *http.Request) {
+	h.serve(w, r, h.dashboardService.MostDistance)
+}
+
+// AlarmsByType counts alarms by day, one series per alarm type
+func (h *DashboardHandler) AlarmsByType(w http.ResponseWriter, r *http.Request) {
+	h.serve(w, r, h.dashboardService.AlarmsByType)
+}
+
+// OnlineRatio gives the share of devices online in each hour, or each day
+// when interval is day
+func (h *DashboardHandler) OnlineRatio(w http.ResponseWriter, r *http.Request) {
+	h.serve(w, r, h.dashboardService.OnlineRatio)
+}
+
+func (h *DashboardHandler) serve(w http.ResponseWriter, r *http.Request, widget func(userID string, query service.WidgetQuery) (*model.Chart, error)) {
+	claims, err := util.GetUserClaims(r)
+	if err != nil {
+		http.Error(w, "Invalid authorization token", http.StatusUnauthorized)
+		return
+	}
+
+	params := r.URL.Query()
+	query := service.WidgetQuery{Interval: params.Get("interval")}
+	devices, ok := deviceFilterParams(w, r, h.filterService, claims.UserID)
+	if !ok {
+		return
+	}
+	query.Devices = devices
+	for name, instant := range map[string]*time.Time{"from": &query.From, "to": &query.To} {
+		value := params.Get(name)
+		if value == "" {
+			continue
+		}
+		if *instant, err = time.Parse(time.RFC3339, value); err != nil {
+			http.Error(w, "Invalid "+name+" parameter, expected RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+	}
+	if value := params.Get("limit"); value != "" {
+		if query.Limit, err = strconv.Atoi(value); err != nil || query.Limit <= 0 {
+			http.Error(w, "Invalid limit parameter", http.StatusBadRequest)
+			return
+		}
+	}
+
+	chart, err := widget(claims.UserID, query)
+	if errors.Is(err, service.ErrInvalidWidgetQuery) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(chart)
+}
@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"tracking/internal/api/util"
+	"tracking/internal/core/model"
+	"tracking/internal/core/service"
+)
+
+// DataModeHandler sets the reporting devices are asked for and estimates
+// their data usage
+type DataModeHandler struct {
+	dataModeService service.DataModeService
+}
+
+func NewDataModeHandler(dataModeService service.DataModeService) *DataModeHandler {
+	return &DataModeHandler{
+		dataModeService: dataModeService,
+	}
+}
+
+// Get returns the mode of the device given by deviceId
+func (h *DataModeHandler) Get(w http.ResponseWriter, r *http.Request) {
+	deviceID := r.URL.Query().Get("deviceId")
+	if deviceID == "" {
+		http.Error(w, "Device ID required", http.StatusBadRequest)
+		return
+	}
+	claims, err := util.GetUserClaims(r)
+	if err != nil {
+		http.Error(w, "Invalid authorization token", http.StatusUnauthorized)
+		return
+	}
+
+	mode, err := h.dataModeService.GetDataMode(deviceID, claims.UserID)
+	if err != nil {
+		writeDataModeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(mode)
+}
+
+// Set asks the device for the mode in the body and returns it with the
+// commands queued
+func (h *DataModeHandler) Set(w http.ResponseWriter, r *http.Request) {
+	claims, err := util.GetUserClaims(r)
+	if err != nil {
+		http.Error(w, "Invalid authorization token", http.StatusUnauthorized)
+		return
+	}
+	var req model.DataMode
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	mode, err := h.dataModeService.SetDataMode(claims.UserID, &req)
+	if err != nil {
+		writeDataModeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(mode)
+}
+
+// Usage estimates the monthly data usage of the device given by deviceId
+func (h *DataModeHandler) Usage(w http.ResponseWriter, r *http.Request) {
+	deviceID := r.URL.Query().Get("deviceId")
+	if deviceID == "" {
+		http.Error(w, "Device ID required", http.StatusBadRequest)
+		return
+	}
+	claims, err := util.GetUserClaims(r)
+	if err != nil {
+		http.Error(w, "Invalid authorization token", http.StatusUnauthorized)
+		return
+	}
+
+	usage, err := h.dataModeService.EstimateUsage(deviceID, claims.UserID)
+	if err != nil {
+		writeDataModeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(usage)
+}
+
+func writeDataModeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrDeviceNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, service.ErrInvalidDataMode), errors.Is(err, service.ErrInvalidCommand):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"tracking/internal/api/util"
+	"tracking/internal/core/model"
+	"tracking/internal/core/service"
+)
+
+// DeviceCertificateHandler lets admins issue and revoke the client
+// certificates devices connect over mutual TLS with
+type DeviceCertificateHandler struct {
+	certificateService service.DeviceCertificateService
+}
+
+func NewDeviceCertificateHandler(certificateService service.DeviceCertificateService) *DeviceCertificateHandler {
+	return &DeviceCertificateHandler{
+		certificateService: certificateService,
+	}
+}
+
+// List returns the certificates of the device given by deviceId, or of
+// every device without it
+func (h *DeviceCertificateHandler) List(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	certificates, err := h.certificateService.List(r.URL.Query().Get("deviceId"))
+	if err != nil {
+		writeDeviceCertificateError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(certificates)
+}
+
+// Issue signs a certificate for the device in the body and returns it
+// with its private key, which is not kept
+func (h *DeviceCertificateHandler) Issue(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	claims, err := util.GetUserClaims(r)
+	if err != nil {
+		http.Error(w, "Invalid authorization token", http.StatusUnauthorized)
+		return
+	}
+
+	var req model.DeviceCertificateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	issued, err := h.certificateService.Issue(claims.UserID, &req)
+	if err != nil {
+		writeDeviceCertificateError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(issued)
+}
+
+// Revoke refuses the certificate given by id in the body from then on;
+// devices connected with it stay connected until they reconnect
+func (h *DeviceCertificateHandler) Revoke(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	var req struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ID == "" {
+		http.Error(w, "Certificate ID required", http.StatusBadRequest)
+		return
+	}
+
+	certificate, err := h.certificateService.Revoke(req.ID)
+	if err != nil {
+		writeDeviceCertificateError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(certificate)
+}
+
+func writeDeviceCertificateError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrDeviceNotFound), errors.Is(err, service.ErrCertificateNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, service.ErrInvalidCertificate):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
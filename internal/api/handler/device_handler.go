@@ -2,18 +2,24 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"tracking/internal/api/util"
+	"tracking/internal/core/model"
 	"tracking/internal/core/service"
 )
 
 type DeviceHandler struct {
-	deviceService service.DeviceService
+	deviceService       service.DeviceService
+	organizationService service.OrganizationService
+	filterService       service.FilterService // Nil without saved filters
 }
 
-func NewDeviceHandler(deviceService service.DeviceService) *DeviceHandler {
+func NewDeviceHandler(deviceService service.DeviceService, organizationService service.OrganizationService, filterService service.FilterService) *DeviceHandler {
 	return &DeviceHandler{
-		deviceService: deviceService,
+		deviceService:       deviceService,
+		organizationService: organizationService,
+		filterService:       filterService,
 	}
 }
 
@@ -38,11 +44,8 @@ func (h *DeviceHandler) Create(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check organization access if creating for an organization
-	if req.OrganizationID != "" {
-		if !util.CanAccessOrganization(claims.Role, claims.OrganizationID, req.OrganizationID) {
-			http.Error(w, "Unauthorized access to organization", http.StatusForbidden)
-			return
-		}
+	if req.OrganizationID != "" && !h.authorizeOrganization(w, claims, req.OrganizationID) {
+		return
 	}
 
 	device, err := h.deviceService.CreateDevice(req.Name, req.UniqueID, claims.UserID, req.OrganizationID)
@@ -62,21 +65,41 @@ func (h *DeviceHandler) GetDevices(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	filter, ok := deviceFilterParams(w, r, h.filterService, claims.UserID)
+	if !ok {
+		return
+	}
+
+	// Without a parameter the organization context, if any, is listed
 	orgID := r.URL.Query().Get("organizationId")
+	if orgID == "" {
+		orgID = claims.OrganizationID
+	}
 
 	// If requesting organization devices, verify access
 	if orgID != "" {
-		if !util.CanAccessOrganization(claims.Role, claims.OrganizationID, orgID) {
-			http.Error(w, "Unauthorized access to organization", http.StatusForbidden)
+		if !h.authorizeOrganization(w, claims, orgID) {
 			return
 		}
-		devices, err := h.deviceService.GetOrganizationDevices(orgID)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+		// A parent organization may list the devices of those below it too
+		orgIDs := []string{orgID}
+		if r.URL.Query().Get("includeChildren") == "true" {
+			if orgIDs, err = h.organizationService.GetSubtree(orgID); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+		devices := []*model.Device{}
+		for _, id := range orgIDs {
+			orgDevices, err := h.deviceService.GetOrganizationDevices(id)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			devices = append(devices, orgDevices...)
 		}
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(devices)
+		json.NewEncoder(w).Encode(filterDevices(h.deviceService.WithConnectionStatus(devices), filter))
 		return
 	}
 
@@ -88,7 +111,7 @@ func (h *DeviceHandler) GetDevices(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(devices)
+	json.NewEncoder(w).Encode(filterDevices(h.deviceService.WithConnectionStatus(devices), filter))
 }
 
 func (h *DeviceHandler) GetDevice(w http.ResponseWriter, r *http.Request) {
@@ -121,6 +144,271 @@ func (h *DeviceHandler) GetDevice(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.deviceService.WithConnectionStatus([]*model.Device{device})[0])
+}
+
+// GetSessions lists the online devices the user can access with where and
+// since when they are connected
+func (h *DeviceHandler) GetSessions(w http.ResponseWriter, r *http.Request) {
+	claims, err := util.GetUserClaims(r)
+	if err != nil {
+		http.Error(w, "Invalid authorization token", http.StatusUnauthorized)
+		return
+	}
+
+	sessions, err := h.deviceService.GetSessions(claims.UserID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sessions)
+}
+
+type assignModelRequest struct {
+	Model string `json:"model"`
+}
+
+// AssignModel sets a device's hardware model from the catalog
+func (h *DeviceHandler) AssignModel(w http.ResponseWriter, r *http.Request) {
+	deviceID := r.URL.Query().Get("id")
+	if deviceID == "" {
+		http.Error(w, "Device ID required", http.StatusBadRequest)
+		return
+	}
+
+	var req assignModelRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	claims, err := util.GetUserClaims(r)
+	if err != nil {
+		http.Error(w, "Invalid authorization token", http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.deviceService.ValidateDeviceAccess(deviceID, claims.UserID); err != nil {
+		http.Error(w, "Unauthorized access to device", http.StatusForbidden)
+		return
+	}
+
+	device, err := h.deviceService.AssignModel(deviceID, claims.UserID, req.Model)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(device)
-}
\ No newline at end of file
+}
+
+type speedLimitRequest struct {
+	SpeedLimit float64 `json:"speedLimit"`
+}
+
+// SetSpeedLimit sets the speed limit applied where the road limit is unknown
+func (h *DeviceHandler) SetSpeedLimit(w http.ResponseWriter, r *http.Request) {
+	deviceID := r.URL.Query().Get("id")
+	if deviceID == "" {
+		http.Error(w, "Device ID required", http.StatusBadRequest)
+		return
+	}
+
+	var req speedLimitRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	claims, err := util.GetUserClaims(r)
+	if err != nil {
+		http.Error(w, "Invalid authorization token", http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.deviceService.ValidateDeviceAccess(deviceID, claims.UserID); err != nil {
+		http.Error(w, "Unauthorized access to device", http.StatusForbidden)
+		return
+	}
+
+	device, err := h.deviceService.SetSpeedLimit(deviceID, claims.UserID, req.SpeedLimit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(device)
+}
+
+type phoneRequest struct {
+	Phone string `json:"phone"`
+}
+
+// SetPhone sets the number of the device's SIM
+func (h *DeviceHandler) SetPhone(w http.ResponseWriter, r *http.Request) {
+	deviceID := r.URL.Query().Get("id")
+	if deviceID == "" {
+		http.Error(w, "Device ID required", http.StatusBadRequest)
+		return
+	}
+
+	var req phoneRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	claims, err := util.GetUserClaims(r)
+	if err != nil {
+		http.Error(w, "Invalid authorization token", http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.deviceService.ValidateDeviceAccess(deviceID, claims.UserID); err != nil {
+		http.Error(w, "Unauthorized access to device", http.StatusForbidden)
+		return
+	}
+
+	device, err := h.deviceService.SetPhone(deviceID, claims.UserID, req.Phone)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(device)
+}
+
+type tagsRequest struct {
+	Tags []string `json:"tags"`
+}
+
+// SetTags replaces the tags of the device
+func (h *DeviceHandler) SetTags(w http.ResponseWriter, r *http.Request) {
+	deviceID := r.URL.Query().Get("id")
+	if deviceID == "" {
+		http.Error(w, "Device ID required", http.StatusBadRequest)
+		return
+	}
+
+	var req tagsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	claims, err := util.GetUserClaims(r)
+	if err != nil {
+		http.Error(w, "Invalid authorization token", http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.deviceService.ValidateDeviceAccess(deviceID, claims.UserID); err != nil {
+		http.Error(w, "Unauthorized access to device", http.StatusForbidden)
+		return
+	}
+
+	device, err := h.deviceService.SetTags(deviceID, claims.UserID, req.Tags)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(device)
+}
+
+type externalIDsRequest struct {
+	ExternalIDs map[string]string `json:"externalIds"`
+}
+
+// SetExternalIDs replaces the IDs the device has in other systems
+func (h *DeviceHandler) SetExternalIDs(w http.ResponseWriter, r *http.Request) {
+	deviceID := r.URL.Query().Get("id")
+	if deviceID == "" {
+		http.Error(w, "Device ID required", http.StatusBadRequest)
+		return
+	}
+
+	var req externalIDsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	claims, err := util.GetUserClaims(r)
+	if err != nil {
+		http.Error(w, "Invalid authorization token", http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.deviceService.ValidateDeviceAccess(deviceID, claims.UserID); err != nil {
+		http.Error(w, "Unauthorized access to device", http.StatusForbidden)
+		return
+	}
+
+	device, err := h.deviceService.SetExternalIDs(deviceID, claims.UserID, req.ExternalIDs)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(device)
+}
+
+// FindByExternalID returns the device with the ID given by externalId in
+// the system given by system
+func (h *DeviceHandler) FindByExternalID(w http.ResponseWriter, r *http.Request) {
+	system := r.URL.Query().Get("system")
+	externalID := r.URL.Query().Get("externalId")
+	if system == "" || externalID == "" {
+		http.Error(w, "System and external ID required", http.StatusBadRequest)
+		return
+	}
+
+	claims, err := util.GetUserClaims(r)
+	if err != nil {
+		http.Error(w, "Invalid authorization token", http.StatusUnauthorized)
+		return
+	}
+
+	device, err := h.deviceService.FindByExternalID(claims.UserID, system, externalID)
+	if errors.Is(err, service.ErrDeviceNotFound) {
+		http.Error(w, "Device not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.deviceService.WithConnectionStatus([]*model.Device{device})[0])
+}
+
+// GetDeviceModels lists the device model catalog
+func (h *DeviceHandler) GetDeviceModels(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.deviceService.GetDeviceModels())
+}
+
+// authorizeOrganization checks the user's membership of an organization,
+// writing the error response when they may not access it
+func (h *DeviceHandler) authorizeOrganization(w http.ResponseWriter, claims *util.UserClaims, orgID string) bool {
+	member, err := h.organizationService.GetMembership(claims.UserID, orgID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	if !util.CanAccessOrganization(claims.Role, member) {
+		http.Error(w, "Unauthorized access to organization", http.StatusForbidden)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,35 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"tracking/internal/core/encryption"
+)
+
+// EncryptionHandler lets admins rotate the master key of encryption at rest
+type EncryptionHandler struct {
+	devices *encryption.Devices
+}
+
+func NewEncryptionHandler(devices *encryption.Devices) *EncryptionHandler {
+	return &EncryptionHandler{
+		devices: devices,
+	}
+}
+
+// Rotate rewraps every data key with the current master key, so the older
+// keys can be retired, and seals devices still stored in plaintext
+func (h *EncryptionHandler) Rotate(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	rotation, err := h.devices.Rotate()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rotation)
+}
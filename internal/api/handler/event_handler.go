@@ -0,0 +1,137 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"tracking/internal/api/util"
+	"tracking/internal/core/service"
+)
+
+// EventHandler lists and counts the events raised for devices
+type EventHandler struct {
+	eventService  service.EventService
+	deviceService service.DeviceService
+	filterService service.FilterService // Nil without saved filters
+}
+
+func NewEventHandler(eventService service.EventService, deviceService service.DeviceService, filterService service.FilterService) *EventHandler {
+	return &EventHandler{
+		eventService:  eventService,
+		deviceService: deviceService,
+		filterService: filterService,
+	}
+}
+
+// List returns a page of events, newest first. They are filtered by the
+// optional deviceId, type and severity parameters, the last two taking
+// comma-separated lists, by the device filters of the device listing, and by the RFC 3339 instants from (inclusive) and
+// to (exclusive). The cursor parameter takes the nextCursor of the previous
+// page and limit sets the page size.
+func (h *EventHandler) List(w http.ResponseWriter, r *http.Request) {
+	query, userID, ok := h.parseQuery(w, r)
+	if !ok {
+		return
+	}
+	query.Cursor = r.URL.Query().Get("cursor")
+	if value := r.URL.Query().Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			http.Error(w, "Invalid limit parameter", http.StatusBadRequest)
+			return
+		}
+		query.Limit = limit
+	}
+
+	page, err := h.eventService.ListEvents(userID, query)
+	if errors.Is(err, service.ErrInvalidEventCursor) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+// Counts returns the number of events per UTC day and type, taking the
+// filters of List
+func (h *EventHandler) Counts(w http.ResponseWriter, r *http.Request) {
+	query, userID, ok := h.parseQuery(w, r)
+	if !ok {
+		return
+	}
+
+	counts, err := h.eventService.CountEvents(userID, query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(counts)
+}
+
+// parseQuery reads the filters shared by List and Counts, writing the
+// error response when they are invalid
+func (h *EventHandler) parseQuery(w http.ResponseWriter, r *http.Request) (service.EventQuery, string, bool) {
+	claims, err := util.GetUserClaims(r)
+	if err != nil {
+		http.Error(w, "Invalid authorization token", http.StatusUnauthorized)
+		return service.EventQuery{}, "", false
+	}
+
+	params := r.URL.Query()
+	query := service.EventQuery{
+		DeviceID:   params.Get("deviceId"),
+		Types:      listParam(params, "type"),
+		Severities: listParam(params, "severity"),
+	}
+	devices, ok := deviceFilterParams(w, r, h.filterService, claims.UserID)
+	if !ok {
+		return query, "", false
+	}
+	query.Devices = devices
+	if query.DeviceID != "" {
+		if err := h.deviceService.ValidateDeviceAccess(query.DeviceID, claims.UserID); err != nil {
+			http.Error(w, "Unauthorized access to device", http.StatusForbidden)
+			return query, "", false
+		}
+	}
+	for name, instant := range map[string]*time.Time{"from": &query.From, "to": &query.To} {
+		value := params.Get(name)
+		if value == "" {
+			continue
+		}
+		if *instant, err = time.Parse(time.RFC3339, value); err != nil {
+			http.Error(w, "Invalid "+name+" parameter, expected RFC 3339 time", http.StatusBadRequest)
+			return query, "", false
+		}
+	}
+	if !query.From.IsZero() && !query.To.IsZero() && !query.From.Before(query.To) {
+		http.Error(w, "The from parameter must be before to", http.StatusBadRequest)
+		return query, "", false
+	}
+	return query, claims.UserID, true
+}
+
+// listParam collects the values of a parameter given repeatedly or as a
+// comma-separated list
+func listParam(params url.Values, name string) []string {
+	var values []string
+	for _, param := range params[name] {
+		for _, value := range strings.Split(param, ",") {
+			if value = strings.TrimSpace(value); value != "" {
+				values = append(values, value)
+			}
+		}
+	}
+	return values
+}
@@ -0,0 +1,176 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"tracking/internal/api/util"
+	"tracking/internal/core/model"
+	"tracking/internal/core/service"
+)
+
+// FilterHandler manages the device filters users save
+type FilterHandler struct {
+	filterService service.FilterService
+}
+
+func NewFilterHandler(filterService service.FilterService) *FilterHandler {
+	return &FilterHandler{
+		filterService: filterService,
+	}
+}
+
+type savedFilterRequest struct {
+	Name   string             `json:"name"`
+	Filter model.DeviceFilter `json:"filter"`
+}
+
+// List returns the user's saved filters, by name
+func (h *FilterHandler) List(w http.ResponseWriter, r *http.Request) {
+	claims, err := util.GetUserClaims(r)
+	if err != nil {
+		http.Error(w, "Invalid authorization token", http.StatusUnauthorized)
+		return
+	}
+
+	filters, err := h.filterService.GetFilters(claims.UserID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(filters)
+}
+
+// Create saves the filter in the body under its name
+func (h *FilterHandler) Create(w http.ResponseWriter, r *http.Request) {
+	claims, err := util.GetUserClaims(r)
+	if err != nil {
+		http.Error(w, "Invalid authorization token", http.StatusUnauthorized)
+		return
+	}
+	var req savedFilterRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	saved, err := h.filterService.CreateFilter(claims.UserID, req.Name, req.Filter)
+	writeFilterResult(w, saved, err)
+}
+
+// Update replaces the name and criteria of the filter given by id
+func (h *FilterHandler) Update(w http.ResponseWriter, r *http.Request) {
+	filterID := r.URL.Query().Get("id")
+	if filterID == "" {
+		http.Error(w, "Filter ID required", http.StatusBadRequest)
+		return
+	}
+	claims, err := util.GetUserClaims(r)
+	if err != nil {
+		http.Error(w, "Invalid authorization token", http.StatusUnauthorized)
+		return
+	}
+	var req savedFilterRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	saved, err := h.filterService.UpdateFilter(filterID, claims.UserID, req.Name, req.Filter)
+	writeFilterResult(w, saved, err)
+}
+
+// Delete removes the filter given by id
+func (h *FilterHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	filterID := r.URL.Query().Get("id")
+	if filterID == "" {
+		http.Error(w, "Filter ID required", http.StatusBadRequest)
+		return
+	}
+	claims, err := util.GetUserClaims(r)
+	if err != nil {
+		http.Error(w, "Invalid authorization token", http.StatusUnauthorized)
+		return
+	}
+
+	err = h.filterService.DeleteFilter(filterID, claims.UserID)
+	if errors.Is(err, service.ErrFilterNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "deleted"})
+}
+
+func writeFilterResult(w http.ResponseWriter, saved *model.SavedFilter, err error) {
+	if errors.Is(err, service.ErrFilterNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, service.ErrInvalidFilter) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(saved)
+}
+
+// deviceFilterParams reads the devices a listing or report is narrowed to:
+// the saved filter given by filter, if any, further narrowed by the tags
+// (comma-separated, all required), status, protocol and q parameters. It
+// writes the error response when the saved filter cannot be used.
+func deviceFilterParams(w http.ResponseWriter, r *http.Request, filterService service.FilterService, userID string) (model.DeviceFilter, bool) {
+	params := r.URL.Query()
+	var filter model.DeviceFilter
+	if filterID := params.Get("filter"); filterID != "" {
+		if filterService == nil {
+			http.Error(w, "Saved filters are not available", http.StatusBadRequest)
+			return filter, false
+		}
+		saved, err := filterService.GetFilter(filterID, userID)
+		if errors.Is(err, service.ErrFilterNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return filter, false
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return filter, false
+		}
+		filter = saved.Filter
+	}
+
+	filter.Tags = model.NormalizeTags(append(append([]string(nil), filter.Tags...), listParam(params, "tags")...))
+	for name, field := range map[string]*string{"status": &filter.Status, "protocol": &filter.Protocol, "q": &filter.Search} {
+		if value := strings.TrimSpace(params.Get(name)); value != "" {
+			*field = value
+		}
+	}
+	return filter, true
+}
+
+// filterDevices keeps the devices the filter selects
+func filterDevices(devices []*model.Device, filter model.DeviceFilter) []*model.Device {
+	if filter.IsEmpty() {
+		return devices
+	}
+	selected := []*model.Device{}
+	for _, device := range devices {
+		if filter.Matches(device) {
+			selected = append(selected, device)
+		}
+	}
+	return selected
+}
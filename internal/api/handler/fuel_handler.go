@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+	"tracking/internal/api/util"
+	"tracking/internal/core/service"
+)
+
+// FuelHandler serves the fuel level series of devices
+type FuelHandler struct {
+	fuelService service.FuelService
+}
+
+func NewFuelHandler(fuelService service.FuelService) *FuelHandler {
+	return &FuelHandler{
+		fuelService: fuelService,
+	}
+}
+
+// Readings returns the fuel levels of the device given by deviceId between
+// the RFC 3339 times from and to
+func (h *FuelHandler) Readings(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	deviceID := params.Get("deviceId")
+	if deviceID == "" {
+		http.Error(w, "Device ID required", http.StatusBadRequest)
+		return
+	}
+	claims, err := util.GetUserClaims(r)
+	if err != nil {
+		http.Error(w, "Invalid authorization token", http.StatusUnauthorized)
+		return
+	}
+	var from, to time.Time
+	for name, instant := range map[string]*time.Time{"from": &from, "to": &to} {
+		if *instant, err = time.Parse(time.RFC3339, params.Get(name)); err != nil {
+			http.Error(w, "Invalid "+name+" parameter, expected RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+	}
+
+	readings, err := h.fuelService.GetReadings(deviceID, claims.UserID, from, to)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrDeviceNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, service.ErrInvalidFuelQuery):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(readings)
+}
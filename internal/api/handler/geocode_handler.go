@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"tracking/internal/api/util"
+	"tracking/internal/core/geocode"
+)
+
+// GeocodeHandler searches addresses for the frontend, which never sees the
+// provider's key
+type GeocodeHandler struct {
+	geocoder *geocode.Geocoder
+}
+
+func NewGeocodeHandler(geocoder *geocode.Geocoder) *GeocodeHandler {
+	return &GeocodeHandler{
+		geocoder: geocoder,
+	}
+}
+
+// Search returns the places matching the q parameter, best match first,
+// at most limit of them. The X-Geocode-Remaining header tells how many
+// lookups the user has left today.
+func (h *GeocodeHandler) Search(w http.ResponseWriter, r *http.Request) {
+	claims, err := util.GetUserClaims(r)
+	if err != nil {
+		http.Error(w, "Invalid authorization token", http.StatusUnauthorized)
+		return
+	}
+	limit := 0
+	if value := r.URL.Query().Get("limit"); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil || limit <= 0 {
+			http.Error(w, "Invalid limit parameter", http.StatusBadRequest)
+			return
+		}
+	}
+
+	results, err := h.geocoder.Search(r.Context(), claims.UserID, r.URL.Query().Get("q"), limit)
+	if remaining := h.geocoder.Remaining(claims.UserID); remaining >= 0 {
+		w.Header().Set("X-Geocode-Remaining", strconv.Itoa(remaining))
+	}
+	if errors.Is(err, geocode.ErrInvalidQuery) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, geocode.ErrQuotaExceeded) {
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	}
+	if err != nil {
+		log.Printf("Geocoding failed: %v", err)
+		http.Error(w, "Geocoding provider unavailable", http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
+
+// ReverseGeocodeHandler looks up street addresses for the frontend through
+// the provider that fills in the addresses of positions
+type ReverseGeocodeHandler struct {
+	geocoder *geocode.ReverseGeocoder
+}
+
+func NewReverseGeocodeHandler(geocoder *geocode.ReverseGeocoder) *ReverseGeocodeHandler {
+	return &ReverseGeocodeHandler{
+		geocoder: geocoder,
+	}
+}
+
+type reverseGeocodeRequest struct {
+	Latitude  *float64 `json:"latitude"`
+	Longitude *float64 `json:"longitude"`
+}
+
+// Reverse returns the street address at the latitude and longitude of the
+// request body, an empty one when the provider knows none there
+func (h *ReverseGeocodeHandler) Reverse(w http.ResponseWriter, r *http.Request) {
+	var req reverseGeocodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Latitude == nil || req.Longitude == nil {
+		http.Error(w, "latitude and longitude are required", http.StatusBadRequest)
+		return
+	}
+
+	address, err := h.geocoder.Reverse(r.Context(), *req.Latitude, *req.Longitude)
+	if errors.Is(err, geocode.ErrInvalidQuery) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, geocode.ErrRateLimited) {
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	}
+	if err != nil {
+		log.Printf("Reverse geocoding failed: %v", err)
+		http.Error(w, "Geocoding provider unavailable", http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&geocode.Result{
+		Address:   address,
+		Latitude:  *req.Latitude,
+		Longitude: *req.Longitude,
+	})
+}
@@ -0,0 +1,124 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"tracking/internal/api/util"
+	"tracking/internal/core/model"
+	"tracking/internal/core/service"
+)
+
+// GeofenceHandler manages geofences in the organization context of the
+// request, or the user's personal fences outside any organization
+type GeofenceHandler struct {
+	geofenceService service.GeofenceService
+}
+
+func NewGeofenceHandler(geofenceService service.GeofenceService) *GeofenceHandler {
+	return &GeofenceHandler{
+		geofenceService: geofenceService,
+	}
+}
+
+// List returns the fences in reach, by name
+func (h *GeofenceHandler) List(w http.ResponseWriter, r *http.Request) {
+	claims, err := util.GetUserClaims(r)
+	if err != nil {
+		http.Error(w, "Invalid authorization token", http.StatusUnauthorized)
+		return
+	}
+
+	geofences, err := h.geofenceService.GetGeofences(claims.UserID, claims.OrganizationID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(geofences)
+}
+
+// Create draws the circle or polygon in the body
+func (h *GeofenceHandler) Create(w http.ResponseWriter, r *http.Request) {
+	claims, err := util.GetUserClaims(r)
+	if err != nil {
+		http.Error(w, "Invalid authorization token", http.StatusUnauthorized)
+		return
+	}
+	var req model.Geofence
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	geofence, err := h.geofenceService.CreateGeofence(claims.UserID, claims.OrganizationID, &req)
+	writeGeofenceResult(w, geofence, err)
+}
+
+// Update replaces the name and shape of the fence given by id
+func (h *GeofenceHandler) Update(w http.ResponseWriter, r *http.Request) {
+	geofenceID := r.URL.Query().Get("id")
+	if geofenceID == "" {
+		http.Error(w, "Geofence ID required", http.StatusBadRequest)
+		return
+	}
+	claims, err := util.GetUserClaims(r)
+	if err != nil {
+		http.Error(w, "Invalid authorization token", http.StatusUnauthorized)
+		return
+	}
+	var req model.Geofence
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	geofence, err := h.geofenceService.UpdateGeofence(geofenceID, claims.UserID, claims.OrganizationID, &req)
+	writeGeofenceResult(w, geofence, err)
+}
+
+// Delete removes the fence given by id
+func (h *GeofenceHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	geofenceID := r.URL.Query().Get("id")
+	if geofenceID == "" {
+		http.Error(w, "Geofence ID required", http.StatusBadRequest)
+		return
+	}
+	claims, err := util.GetUserClaims(r)
+	if err != nil {
+		http.Error(w, "Invalid authorization token", http.StatusUnauthorized)
+		return
+	}
+
+	err = h.geofenceService.DeleteGeofence(geofenceID, claims.UserID, claims.OrganizationID)
+	if errors.Is(err, service.ErrGeofenceNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "deleted"})
+}
+
+func writeGeofenceResult(w http.ResponseWriter, geofence *model.Geofence, err error) {
+	if errors.Is(err, service.ErrGeofenceNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, service.ErrInvalidGeofence) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(geofence)
+}
@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+	"tracking/internal/api/util"
+	"tracking/internal/core/service"
+)
+
+// HistoryHandler serves past device state from the device event log
+type HistoryHandler struct {
+	historyService service.HistoryService
+}
+
+func NewHistoryHandler(historyService service.HistoryService) *HistoryHandler {
+	return &HistoryHandler{
+		historyService: historyService,
+	}
+}
+
+// GetDeviceHistory returns every recorded change of a device
+func (h *HistoryHandler) GetDeviceHistory(w http.ResponseWriter, r *http.Request) {
+	deviceID := r.URL.Query().Get("deviceId")
+	if deviceID == "" {
+		http.Error(w, "Device ID required", http.StatusBadRequest)
+		return
+	}
+
+	claims, err := util.GetUserClaims(r)
+	if err != nil {
+		http.Error(w, "Invalid authorization token", http.StatusUnauthorized)
+		return
+	}
+
+	events, err := h.historyService.GetDeviceHistory(deviceID, claims.UserID)
+	if errors.Is(err, service.ErrNoDeviceHistory) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(events)
+}
+
+// GetFleet returns the user's devices as they stood at the RFC 3339 instant
+// given by the at parameter
+func (h *HistoryHandler) GetFleet(w http.ResponseWriter, r *http.Request) {
+	at, err := time.Parse(time.RFC3339, r.URL.Query().Get("at"))
+	if err != nil {
+		http.Error(w, "Invalid at parameter, expected RFC 3339 time", http.StatusBadRequest)
+		return
+	}
+
+	claims, err := util.GetUserClaims(r)
+	if err != nil {
+		http.Error(w, "Invalid authorization token", http.StatusUnauthorized)
+		return
+	}
+
+	fleet, err := h.historyService.GetFleetAt(claims.UserID, at)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(fleet)
+}
@@ -0,0 +1,213 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+	"tracking/internal/api/util"
+	"tracking/internal/api/websocket"
+	"tracking/internal/core/model"
+	"tracking/internal/core/service"
+)
+
+// liveKeepalive is how often an idle stream sends a comment, so proxies do
+// not close it
+const liveKeepalive = 30 * time.Second
+
+// Replies to WebSocket clients changing what they follow
+const (
+	liveSubscribed = "subscribed"
+	liveFailed     = "error"
+)
+
+// liveControl replaces the filters of a WebSocket client; none follows
+// every device the user can access
+type liveControl struct {
+	Filters []model.LiveFilter `json:"filters"`
+}
+
+// liveReply answers a WebSocket client with the filters in effect or why
+// its filters were refused
+type liveReply struct {
+	Type    string             `json:"type"`
+	Filters []model.LiveFilter `json:"filters"`
+	Error   string             `json:"error,omitempty"`
+}
+
+// LiveHandler streams positions and events to dashboards
+type LiveHandler struct {
+	liveService service.LiveService
+}
+
+func NewLiveHandler(liveService service.LiveService) *LiveHandler {
+	return &LiveHandler{
+		liveService: liveService,
+	}
+}
+
+// Stream sends the positions and events of the device named by deviceId,
+// of the organization named by organizationId, or of every device the
+// user can access, as Server-Sent Events until the client goes away. Each
+// event is named after the update type and carries it as JSON.
+func (h *LiveHandler) Stream(w http.ResponseWriter, r *http.Request) {
+	claims, err := util.GetUserClaims(r)
+	if err != nil {
+		http.Error(w, "Invalid authorization token", http.StatusUnauthorized)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	var filters []model.LiveFilter
+	filter := model.LiveFilter{
+		DeviceID:       r.URL.Query().Get("deviceId"),
+		OrganizationID: r.URL.Query().Get("organizationId"),
+	}
+	if filter != (model.LiveFilter{}) {
+		filters = append(filters, filter)
+	}
+	subscription, ok := h.subscribe(w, claims.UserID, filters)
+	if !ok {
+		return
+	}
+	defer subscription.Cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // Keeps nginx from holding events back
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepalive := time.NewTicker(liveKeepalive)
+	defer keepalive.Stop()
+	for {
+		select {
+		case update, ok := <-subscription.Updates():
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(update)
+			if err != nil {
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", update.Type, data); err != nil {
+				return
+			}
+		case <-keepalive.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// subscribe follows the devices the filters select, replying with an error
+// when they cannot be followed
+func (h *LiveHandler) subscribe(w http.ResponseWriter, userID string, filters []model.LiveFilter) (*service.LiveSubscription, bool) {
+	subscription, err := h.liveService.Subscribe(userID, filters)
+	if err != nil {
+		message, status := liveError(err)
+		http.Error(w, message, status)
+		return nil, false
+	}
+	return subscription, true
+}
+
+// liveError maps an error following devices to a message and status
+func liveError(err error) (string, int) {
+	switch {
+	case errors.Is(err, service.ErrInvalidLiveFilter):
+		return "Follow either a device or an organization", http.StatusBadRequest
+	case errors.Is(err, service.ErrDeviceNotFound):
+		return "Device not found", http.StatusNotFound
+	case errors.Is(err, service.ErrOrganizationNotFound):
+		return "Organization not found", http.StatusNotFound
+	default:
+		return err.Error(), http.StatusInternalServerError
+	}
+}
+
+// Socket upgrades to a WebSocket pushing the positions, events and status
+// changes of the devices named by deviceId and organizationId, which may
+// be repeated, or of every device the user can access, as JSON frames.
+// The client changes what it follows by sending a liveControl; each is
+// answered with a liveReply, as is the upgrade.
+func (h *LiveHandler) Socket(w http.ResponseWriter, r *http.Request) {
+	claims, err := util.GetUserClaims(r)
+	if err != nil {
+		http.Error(w, "Invalid authorization token", http.StatusUnauthorized)
+		return
+	}
+
+	filters := []model.LiveFilter{}
+	for _, deviceID := range r.URL.Query()["deviceId"] {
+		filters = append(filters, model.LiveFilter{DeviceID: deviceID})
+	}
+	for _, organizationID := range r.URL.Query()["organizationId"] {
+		filters = append(filters, model.LiveFilter{OrganizationID: organizationID})
+	}
+	subscription, ok := h.subscribe(w, claims.UserID, filters)
+	if !ok {
+		return
+	}
+	defer subscription.Cancel()
+
+	conn, err := websocket.Upgrade(w, r)
+	if err != nil {
+		log.Printf("WebSocket upgrade failed: %v", err)
+		return
+	}
+	defer conn.Close()
+	if err := conn.WriteJSON(&liveReply{Type: liveSubscribed, Filters: filters}); err != nil {
+		return
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			var control liveControl
+			if err := json.Unmarshal(data, &control); err != nil {
+				conn.WriteJSON(&liveReply{Type: liveFailed, Filters: filters, Error: "Invalid message"})
+				continue
+			}
+			if err := subscription.Filter(control.Filters); err != nil {
+				message, _ := liveError(err)
+				conn.WriteJSON(&liveReply{Type: liveFailed, Filters: filters, Error: message})
+				continue
+			}
+			filters = control.Filters
+			if filters == nil {
+				filters = []model.LiveFilter{}
+			}
+			conn.WriteJSON(&liveReply{Type: liveSubscribed, Filters: filters})
+		}
+	}()
+
+	for {
+		select {
+		case update, ok := <-subscription.Updates():
+			if !ok {
+				return
+			}
+			if err := conn.WriteJSON(update); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
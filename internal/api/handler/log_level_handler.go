@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+	"tracking/internal/core/logging"
+	"tracking/internal/core/model"
+)
+
+// LogLevelHandler lets admins turn on debug logging for a module or a
+// device without restarting the server
+type LogLevelHandler struct {
+	levels *logging.Levels
+}
+
+func NewLogLevelHandler(levels *logging.Levels) *LogLevelHandler {
+	return &LogLevelHandler{
+		levels: levels,
+	}
+}
+
+// List returns the base level and the overrides in effect
+func (h *LogLevelHandler) List(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.levels.Snapshot())
+}
+
+// Set overrides the level of the module or the device in the body for
+// duration seconds, fifteen minutes when left out, after which it reverts
+func (h *LogLevelHandler) Set(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	var req model.LogOverride
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	override, err := h.levels.Set(req.Module, req.DeviceID, req.Level, time.Duration(req.Duration)*time.Second)
+	if errors.Is(err, logging.ErrInvalidOverride) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(override)
+}
+
+// Reset drops the override of the module or the device in the body ahead
+// of its expiry
+func (h *LogLevelHandler) Reset(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	var req model.LogOverride
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if (req.Module == "") == (req.DeviceID == "") {
+		http.Error(w, "Name either a module or a device", http.StatusBadRequest)
+		return
+	}
+
+	if !h.levels.Reset(req.Module, req.DeviceID) {
+		http.Error(w, "Override not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,128 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"tracking/internal/api/util"
+	"tracking/internal/core/model"
+	"tracking/internal/core/service"
+)
+
+// MaintenanceHandler manages the maintenance schedules of devices
+type MaintenanceHandler struct {
+	maintenanceService service.MaintenanceService
+}
+
+func NewMaintenanceHandler(maintenanceService service.MaintenanceService) *MaintenanceHandler {
+	return &MaintenanceHandler{
+		maintenanceService: maintenanceService,
+	}
+}
+
+// List returns the maintenances of the device given by deviceId
+func (h *MaintenanceHandler) List(w http.ResponseWriter, r *http.Request) {
+	deviceID := r.URL.Query().Get("deviceId")
+	if deviceID == "" {
+		http.Error(w, "Device ID required", http.StatusBadRequest)
+		return
+	}
+	claims, err := util.GetUserClaims(r)
+	if err != nil {
+		http.Error(w, "Invalid authorization token", http.StatusUnauthorized)
+		return
+	}
+
+	maintenances, err := h.maintenanceService.GetMaintenances(deviceID, claims.UserID)
+	if err != nil {
+		writeMaintenanceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(maintenances)
+}
+
+// Create schedules the maintenance in the body on its device
+func (h *MaintenanceHandler) Create(w http.ResponseWriter, r *http.Request) {
+	claims, err := util.GetUserClaims(r)
+	if err != nil {
+		http.Error(w, "Invalid authorization token", http.StatusUnauthorized)
+		return
+	}
+	var req model.Maintenance
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	maintenance, err := h.maintenanceService.CreateMaintenance(claims.UserID, &req)
+	if err != nil {
+		writeMaintenanceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(maintenance)
+}
+
+// Update replaces the maintenance given by id
+func (h *MaintenanceHandler) Update(w http.ResponseWriter, r *http.Request) {
+	maintenanceID := r.URL.Query().Get("id")
+	if maintenanceID == "" {
+		http.Error(w, "Maintenance ID required", http.StatusBadRequest)
+		return
+	}
+	claims, err := util.GetUserClaims(r)
+	if err != nil {
+		http.Error(w, "Invalid authorization token", http.StatusUnauthorized)
+		return
+	}
+	var req model.Maintenance
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	maintenance, err := h.maintenanceService.UpdateMaintenance(maintenanceID, claims.UserID, &req)
+	if err != nil {
+		writeMaintenanceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(maintenance)
+}
+
+// Delete removes the maintenance given by id
+func (h *MaintenanceHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	maintenanceID := r.URL.Query().Get("id")
+	if maintenanceID == "" {
+		http.Error(w, "Maintenance ID required", http.StatusBadRequest)
+		return
+	}
+	claims, err := util.GetUserClaims(r)
+	if err != nil {
+		http.Error(w, "Invalid authorization token", http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.maintenanceService.DeleteMaintenance(maintenanceID, claims.UserID); err != nil {
+		writeMaintenanceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "deleted"})
+}
+
+func writeMaintenanceError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrMaintenanceNotFound), errors.Is(err, service.ErrDeviceNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, service.ErrInvalidMaintenance):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
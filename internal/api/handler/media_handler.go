@@ -0,0 +1,176 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"tracking/internal/api/util"
+	"tracking/internal/core/media"
+	"tracking/internal/core/model"
+	"tracking/internal/core/service"
+	"tracking/internal/protocol/jt808"
+)
+
+// jt808ContentType marks an upload body as a stream of JT808 frames
+const jt808ContentType = "application/x-jt808"
+
+// MediaHandler takes images and clips from devices and serves them to users
+type MediaHandler struct {
+	mediaService  service.MediaService
+	deviceService service.DeviceService
+}
+
+func NewMediaHandler(mediaService service.MediaService, deviceService service.DeviceService) *MediaHandler {
+	return &MediaHandler{
+		mediaService:  mediaService,
+		deviceService: deviceService,
+	}
+}
+
+type jt808UploadResponse struct {
+	Media []*model.Media `json:"media"`
+	Reply []byte         `json:"reply"` // 0x8800 frames to relay to the terminal
+}
+
+// Upload stores content posted by an authenticated device. A body of JT808
+// frames is unpacked into its multimedia uploads; any other body is stored
+// as a file of its content type, described by the optional trigger,
+// eventId and channel parameters.
+func (h *MediaHandler) Upload(w http.ResponseWriter, r *http.Request) {
+	device, err := util.GetDevice(r)
+	if err != nil {
+		http.Error(w, "Device authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r.Body, service.MaxMediaSize+1))
+	if err != nil {
+		http.Error(w, "Failed to read upload", http.StatusBadRequest)
+		return
+	}
+
+	contentType := r.Header.Get("Content-Type")
+	if strings.HasPrefix(contentType, jt808ContentType) || (jt808.IsFrame(data) && !strings.HasPrefix(contentType, "image/")) {
+		stored, reply, err := h.mediaService.UploadJT808(device.ID, data)
+		if !writeMediaError(w, err) {
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(jt808UploadResponse{Media: stored, Reply: reply})
+		return
+	}
+
+	query := r.URL.Query()
+	upload := &service.MediaUpload{
+		ContentType: contentType,
+		Trigger:     query.Get("trigger"),
+		EventID:     query.Get("eventId"),
+		Data:        data,
+	}
+	if channel := query.Get("channel"); channel != "" {
+		if upload.Channel, err = strconv.Atoi(channel); err != nil {
+			http.Error(w, "Invalid channel", http.StatusBadRequest)
+			return
+		}
+	}
+
+	stored, err := h.mediaService.UploadMedia(device.ID, upload)
+	if !writeMediaError(w, err) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(stored)
+}
+
+// List returns the media of a device the user may access, newest first
+func (h *MediaHandler) List(w http.ResponseWriter, r *http.Request) {
+	deviceID := r.URL.Query().Get("deviceId")
+	if deviceID == "" {
+		http.Error(w, "Device ID required", http.StatusBadRequest)
+		return
+	}
+	if !h.validateAccess(w, r, deviceID) {
+		return
+	}
+
+	records, err := h.mediaService.GetDeviceMedia(deviceID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(records)
+}
+
+// Get returns one media record with a fresh link to its content
+func (h *MediaHandler) Get(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, "Media ID required", http.StatusBadRequest)
+		return
+	}
+
+	record, err := h.mediaService.GetMedia(id)
+	if !writeMediaError(w, err) {
+		return
+	}
+	if !h.validateAccess(w, r, record.DeviceID) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(record)
+}
+
+// Content serves the content a signed link grants access to. The link is
+// the authorization, so it can be embedded in pages and messages.
+func (h *MediaHandler) Content(w http.ResponseWriter, r *http.Request) {
+	data, contentType, err := h.mediaService.OpenContent(r.URL.Query())
+	if errors.Is(err, media.ErrInvalidSignature) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if !writeMediaError(w, err) {
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Header().Set("Cache-Control", "private, max-age=300")
+	w.Write(data)
+}
+
+func (h *MediaHandler) validateAccess(w http.ResponseWriter, r *http.Request, deviceID string) bool {
+	claims, err := util.GetUserClaims(r)
+	if err != nil {
+		http.Error(w, "Invalid authorization token", http.StatusUnauthorized)
+		return false
+	}
+	if err := h.deviceService.ValidateDeviceAccess(deviceID, claims.UserID); err != nil {
+		http.Error(w, "Unauthorized access to device", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// writeMediaError replies with the status matching err and reports whether
+// there was none
+func writeMediaError(w http.ResponseWriter, err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, service.ErrInvalidMedia):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, service.ErrMediaNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+	return false
+}
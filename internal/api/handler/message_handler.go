@@ -0,0 +1,169 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"tracking/internal/api/util"
+	"tracking/internal/api/websocket"
+	"tracking/internal/core/service"
+)
+
+// MessageHandler exchanges text with the drivers of devices
+type MessageHandler struct {
+	messageService service.MessageService
+	deviceService  service.DeviceService
+}
+
+func NewMessageHandler(messageService service.MessageService, deviceService service.DeviceService) *MessageHandler {
+	return &MessageHandler{
+		messageService: messageService,
+		deviceService:  deviceService,
+	}
+}
+
+type messageRequest struct {
+	Text string `json:"text"`
+}
+
+// deviceAccess returns the device ID of a request when the user may access
+// the device, replying with an error otherwise
+func (h *MessageHandler) deviceAccess(w http.ResponseWriter, r *http.Request) (string, bool) {
+	deviceID := r.URL.Query().Get("deviceId")
+	if deviceID == "" {
+		http.Error(w, "Device ID required", http.StatusBadRequest)
+		return "", false
+	}
+
+	claims, err := util.GetUserClaims(r)
+	if err != nil {
+		http.Error(w, "Invalid authorization token", http.StatusUnauthorized)
+		return "", false
+	}
+
+	if err := h.deviceService.ValidateDeviceAccess(deviceID, claims.UserID); err != nil {
+		http.Error(w, "Unauthorized access to device", http.StatusForbidden)
+		return "", false
+	}
+	return deviceID, true
+}
+
+// Send delivers a text to the driver display. The message is returned with
+// status failed when the device could not take it.
+func (h *MessageHandler) Send(w http.ResponseWriter, r *http.Request) {
+	deviceID, ok := h.deviceAccess(w, r)
+	if !ok {
+		return
+	}
+
+	var req messageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	claims, _ := util.GetUserClaims(r)
+	message, err := h.messageService.SendMessage(deviceID, claims.UserID, req.Text)
+	if errors.Is(err, service.ErrInvalidMessage) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(message)
+}
+
+// GetThread returns the conversation with the driver of a device
+func (h *MessageHandler) GetThread(w http.ResponseWriter, r *http.Request) {
+	deviceID, ok := h.deviceAccess(w, r)
+	if !ok {
+		return
+	}
+
+	messages, err := h.messageService.GetThread(deviceID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(messages)
+}
+
+// Stream upgrades to a WebSocket pushing every new or updated message of the
+// device as JSON, until the client goes away
+func (h *MessageHandler) Stream(w http.ResponseWriter, r *http.Request) {
+	deviceID, ok := h.deviceAccess(w, r)
+	if !ok {
+		return
+	}
+
+	conn, err := websocket.Upgrade(w, r)
+	if err != nil {
+		log.Printf("WebSocket upgrade failed: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	messages, cancel := h.messageService.Subscribe(deviceID)
+	defer cancel()
+
+	// Clients send nothing but control frames; reading notices them leave
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case message, ok := <-messages:
+			if !ok {
+				return
+			}
+			if err := conn.WriteJSON(message); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
+
+// ReceiveFromDevice stores a message from the driver, posted by a device
+// that authenticated with its API credentials
+func (h *MessageHandler) ReceiveFromDevice(w http.ResponseWriter, r *http.Request) {
+	device, err := util.GetDevice(r)
+	if err != nil {
+		http.Error(w, "Device authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	var req messageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	message, err := h.messageService.ReceiveMessage(device.ID, req.Text)
+	if errors.Is(err, service.ErrInvalidMessage) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(message)
+}
@@ -0,0 +1,130 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"tracking/internal/api/util"
+	"tracking/internal/core/model"
+	"tracking/internal/core/service"
+)
+
+// NoteHandler manages the notes users attach to device tracks
+type NoteHandler struct {
+	noteService service.NoteService
+}
+
+func NewNoteHandler(noteService service.NoteService) *NoteHandler {
+	return &NoteHandler{
+		noteService: noteService,
+	}
+}
+
+// List returns the notes on the track of the device given by deviceId
+func (h *NoteHandler) List(w http.ResponseWriter, r *http.Request) {
+	deviceID := r.URL.Query().Get("deviceId")
+	if deviceID == "" {
+		http.Error(w, "Device ID required", http.StatusBadRequest)
+		return
+	}
+	claims, err := util.GetUserClaims(r)
+	if err != nil {
+		http.Error(w, "Invalid authorization token", http.StatusUnauthorized)
+		return
+	}
+
+	notes, err := h.noteService.GetNotes(deviceID, claims.UserID)
+	if errors.Is(err, service.ErrDeviceNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(notes)
+}
+
+// Create attaches the note in the body to a position or time range
+func (h *NoteHandler) Create(w http.ResponseWriter, r *http.Request) {
+	claims, err := util.GetUserClaims(r)
+	if err != nil {
+		http.Error(w, "Invalid authorization token", http.StatusUnauthorized)
+		return
+	}
+	var req model.Note
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	note, err := h.noteService.CreateNote(claims.UserID, &req)
+	writeNoteResult(w, note, err)
+}
+
+// Update replaces the text and range of the note given by id
+func (h *NoteHandler) Update(w http.ResponseWriter, r *http.Request) {
+	noteID := r.URL.Query().Get("id")
+	if noteID == "" {
+		http.Error(w, "Note ID required", http.StatusBadRequest)
+		return
+	}
+	claims, err := util.GetUserClaims(r)
+	if err != nil {
+		http.Error(w, "Invalid authorization token", http.StatusUnauthorized)
+		return
+	}
+	var req model.Note
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	note, err := h.noteService.UpdateNote(noteID, claims.UserID, &req)
+	writeNoteResult(w, note, err)
+}
+
+// Delete removes the note given by id
+func (h *NoteHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	noteID := r.URL.Query().Get("id")
+	if noteID == "" {
+		http.Error(w, "Note ID required", http.StatusBadRequest)
+		return
+	}
+	claims, err := util.GetUserClaims(r)
+	if err != nil {
+		http.Error(w, "Invalid authorization token", http.StatusUnauthorized)
+		return
+	}
+
+	err = h.noteService.DeleteNote(noteID, claims.UserID)
+	if err != nil {
+		writeNoteResult(w, nil, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "deleted"})
+}
+
+func writeNoteResult(w http.ResponseWriter, note *model.Note, err error) {
+	switch {
+	case errors.Is(err, service.ErrNoteNotFound), errors.Is(err, service.ErrDeviceNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, service.ErrNoteNotAuthor):
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	case errors.Is(err, service.ErrInvalidNote):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(note)
+}
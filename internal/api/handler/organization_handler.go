@@ -0,0 +1,141 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"tracking/internal/api/util"
+	"tracking/internal/core/service"
+)
+
+// OrganizationHandler lists the organizations a user can switch between
+// and manages the organizations below them
+type OrganizationHandler struct {
+	organizationService service.OrganizationService
+}
+
+func NewOrganizationHandler(organizationService service.OrganizationService) *OrganizationHandler {
+	return &OrganizationHandler{
+		organizationService: organizationService,
+	}
+}
+
+// GetMemberships returns the user's organizations with their role in each
+func (h *OrganizationHandler) GetMemberships(w http.ResponseWriter, r *http.Request) {
+	claims, err := util.GetUserClaims(r)
+	if err != nil {
+		http.Error(w, "Invalid authorization token", http.StatusUnauthorized)
+		return
+	}
+
+	memberships, err := h.organizationService.GetMemberships(claims.UserID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(memberships)
+}
+
+type createOrganizationRequest struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	ParentID    string   `json:"parentId"` // Empty for a top-level organization
+	Features    []string `json:"features"` // Empty to allow all the parent allows
+}
+
+// Create adds an organization. Admins of the parent organization may add
+// organizations below it; only admins add top-level ones.
+func (h *OrganizationHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var req createOrganizationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.ParentID == "" {
+		if !requireAdmin(w, r) {
+			return
+		}
+	} else if _, ok := h.authorizeOrganization(w, r, req.ParentID, true); !ok {
+		return
+	}
+
+	org, err := h.organizationService.CreateOrganization(req.Name, req.Description, req.ParentID, req.Features)
+	if errors.Is(err, service.ErrOrganizationNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(org)
+}
+
+// GetChildren lists the organizations directly below the one given by id
+func (h *OrganizationHandler) GetChildren(w http.ResponseWriter, r *http.Request) {
+	orgID, ok := h.authorizeOrganization(w, r, r.URL.Query().Get("id"), false)
+	if !ok {
+		return
+	}
+
+	children, err := h.organizationService.GetChildren(orgID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(children)
+}
+
+// GetRollup counts the devices of the organization given by id and of
+// every organization below it
+func (h *OrganizationHandler) GetRollup(w http.ResponseWriter, r *http.Request) {
+	orgID, ok := h.authorizeOrganization(w, r, r.URL.Query().Get("id"), false)
+	if !ok {
+		return
+	}
+
+	rollup, err := h.organizationService.GetRollup(orgID)
+	if errors.Is(err, service.ErrOrganizationNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rollup)
+}
+
+// authorizeOrganization checks the user belongs to the organization, here
+// or through one above it, and is an admin of it when manage is set. It
+// writes the error response when not.
+func (h *OrganizationHandler) authorizeOrganization(w http.ResponseWriter, r *http.Request, orgID string, manage bool) (string, bool) {
+	if orgID == "" {
+		http.Error(w, "Organization ID required", http.StatusBadRequest)
+		return "", false
+	}
+	claims, err := util.GetUserClaims(r)
+	if err != nil {
+		http.Error(w, "Invalid authorization token", http.StatusUnauthorized)
+		return "", false
+	}
+
+	member, err := h.organizationService.GetMembership(claims.UserID, orgID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return "", false
+	}
+	if !util.CanAccessOrganization(claims.Role, member) || (manage && !util.IsAdmin(claims.Role) && member.Role != "admin") {
+		http.Error(w, "Unauthorized access to organization", http.StatusForbidden)
+		return "", false
+	}
+	return orgID, true
+}
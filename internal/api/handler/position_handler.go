@@ -3,22 +3,33 @@ package handler
 import (
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 	"tracking/internal/api/util"
+	"tracking/internal/core/model"
 	"tracking/internal/core/service"
 )
 
 type PositionHandler struct {
 	positionService service.PositionService
+	noteService     service.NoteService // Nil without notes
 }
 
-func NewPositionHandler(positionService service.PositionService) *PositionHandler {
+func NewPositionHandler(positionService service.PositionService, noteService service.NoteService) *PositionHandler {
 	return &PositionHandler{
 		positionService: positionService,
+		noteService:     noteService,
 	}
 }
 
+// maxOsmAndBody bounds the JSON body of one OsmAnd report
+const maxOsmAndBody = 64 * 1024
+
 type addPositionRequest struct {
 	DeviceID  string  `json:"deviceId"`
 	Latitude  float64 `json:"latitude"`
@@ -53,8 +64,14 @@ func (h *PositionHandler) AddPosition(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(position)
 }
 
+// GetPositions lists a page of the positions of a device, oldest first,
+// between the RFC 3339 instants from (inclusive) and to (exclusive) when
+// given. limit sets the page size; the X-Next-Cursor header of a page
+// that is not the last goes in the cursor parameter for the next one.
+// With notes=true each position carries the notes covering it.
 func (h *PositionHandler) GetPositions(w http.ResponseWriter, r *http.Request) {
-	deviceID := r.URL.Query().Get("deviceId")
+	params := r.URL.Query()
+	deviceID := params.Get("deviceId")
 	if deviceID == "" {
 		http.Error(w, "Device ID required", http.StatusBadRequest)
 		return
@@ -66,11 +83,59 @@ func (h *PositionHandler) GetPositions(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	positions, err := h.positionService.GetDevicePositions(deviceID, claims.UserID)
+	query := service.PositionQuery{Cursor: params.Get("cursor")}
+	for name, instant := range map[string]*time.Time{"from": &query.From, "to": &query.To} {
+		value := params.Get(name)
+		if value == "" {
+			continue
+		}
+		if *instant, err = time.Parse(time.RFC3339, value); err != nil {
+			http.Error(w, "Invalid "+name+" parameter, expected RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+	}
+	if !query.From.IsZero() && !query.To.IsZero() && !query.From.Before(query.To) {
+		http.Error(w, "The from parameter must be before to", http.StatusBadRequest)
+		return
+	}
+	if value := params.Get("limit"); value != "" {
+		if query.Limit, err = strconv.Atoi(value); err != nil || query.Limit <= 0 {
+			http.Error(w, "Invalid limit parameter", http.StatusBadRequest)
+			return
+		}
+	}
+
+	positions, next, err := h.positionService.GetDevicePositions(deviceID, claims.UserID, query)
+	if errors.Is(err, service.ErrInvalidPositionCursor) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	if next != "" {
+		w.Header().Set("X-Next-Cursor", next)
+	}
+
+	if r.URL.Query().Get("notes") == "true" {
+		if h.noteService == nil {
+			http.Error(w, "Notes are not available", http.StatusBadRequest)
+			return
+		}
+		// The device may have been named by its unique ID
+		if len(positions) > 0 {
+			deviceID = positions[0].DeviceID
+		}
+		notes, err := h.noteService.GetNotes(deviceID, claims.UserID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(model.Annotate(positions, notes))
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(positions)
@@ -104,6 +169,37 @@ func (h *PositionHandler) GetLatestPosition(w http.ResponseWriter, r *http.Reque
 	json.NewEncoder(w).Encode(position)
 }
 
+// ProcessDeviceRawData ingests raw data posted by a device that
+// authenticated with its API credentials rather than a user token
+func (h *PositionHandler) ProcessDeviceRawData(w http.ResponseWriter, r *http.Request) {
+	var req rawDataRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	device, err := util.GetDevice(r)
+	if err != nil {
+		http.Error(w, "Device authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	rawData, err := base64.StdEncoding.DecodeString(req.RawData)
+	if err != nil {
+		http.Error(w, "Invalid raw data format", http.StatusBadRequest)
+		return
+	}
+
+	positions, err := h.positionService.ProcessRawData(device.ID, rawData, device.UserID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newestPosition(positions))
+}
+
 func (h *PositionHandler) ProcessRawData(w http.ResponseWriter, r *http.Request) {
 	// Add debug logging
 	fmt.Printf("Received raw data request: %s %s\n", r.Method, r.URL.Path)
@@ -131,7 +227,7 @@ func (h *PositionHandler) ProcessRawData(w http.ResponseWriter, r *http.Request)
 	}
 
 	fmt.Printf("Processing raw data for device: %s, data length: %d bytes\n", req.DeviceID, len(rawData))
-	position, err := h.positionService.ProcessRawData(req.DeviceID, rawData, claims.UserID)
+	positions, err := h.positionService.ProcessRawData(req.DeviceID, rawData, claims.UserID)
 	if err != nil {
 		fmt.Printf("Error processing raw data: %v\n", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -139,5 +235,79 @@ func (h *PositionHandler) ProcessRawData(w http.ResponseWriter, r *http.Request)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(position)
-}
\ No newline at end of file
+	json.NewEncoder(w).Encode(newestPosition(positions))
+}
+
+// newestPosition picks the position a raw data request responds with when
+// the frame carried a batch
+func newestPosition(positions []*model.Position) *model.Position {
+	var newest *model.Position
+	for _, position := range positions {
+		if newest == nil || position.Timestamp.After(newest.Timestamp) {
+			newest = position
+		}
+	}
+	return newest
+}
+
+// ProcessOsmAnd accepts OsmAnd reports from phone trackers, sent as query or
+// form parameters or, by Traccar Client, as a JSON body; the apps only look
+// at the status code
+func (h *PositionHandler) ProcessOsmAnd(w http.ResponseWriter, r *http.Request) {
+	var err error
+	if r.Method == http.MethodPost && strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		body, readErr := io.ReadAll(io.LimitReader(r.Body, maxOsmAndBody))
+		if readErr != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		_, err = h.positionService.ProcessOsmAndJSON(r.URL.Query(), body)
+	} else {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Invalid parameters", http.StatusBadRequest)
+			return
+		}
+		_, err = h.positionService.ProcessOsmAnd(r.Form)
+	}
+
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidDeviceCredentials) {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// ProcessOwnTracks accepts payloads from the OwnTracks app in HTTP mode.
+// The device signs in with its unique ID as the username, unless the app
+// names it in X-Limit-D, and its API key as the password.
+func (h *PositionHandler) ProcessOwnTracks(w http.ResponseWriter, r *http.Request) {
+	username, key, _ := r.BasicAuth()
+	uniqueID := r.Header.Get("X-Limit-D")
+	if uniqueID == "" {
+		uniqueID = username
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxOsmAndBody))
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := h.positionService.ProcessOwnTracks(uniqueID, key, body); err != nil {
+		if errors.Is(err, service.ErrInvalidDeviceCredentials) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="owntracks"`)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// The app reads the reply as a list of messages for the user
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte("[]"))
+}
@@ -0,0 +1,173 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"tracking/internal/api/util"
+	"tracking/internal/core/model"
+	"tracking/internal/core/service"
+)
+
+// RegistrationHandler serves the self-registration flow of phone trackers:
+// the phone requests and polls without an account, the owner reviews the
+// request from the dashboard
+type RegistrationHandler struct {
+	registrationService service.RegistrationService
+	baseURL             string // Public URL for ingest links; the request host when empty
+}
+
+func NewRegistrationHandler(registrationService service.RegistrationService, baseURL string) *RegistrationHandler {
+	return &RegistrationHandler{
+		registrationService: registrationService,
+		baseURL:             strings.TrimSuffix(baseURL, "/"),
+	}
+}
+
+type registrationRequest struct {
+	Name  string `json:"name"`
+	Email string `json:"email"` // Account the phone asks to join
+}
+
+type registrationResponse struct {
+	ID        string `json:"id"`
+	Status    string `json:"status"`
+	Token     string `json:"token,omitempty"` // Only returned when the request is made
+	UniqueID  string `json:"uniqueId,omitempty"`
+	ApiKey    string `json:"apiKey,omitempty"`
+	IngestURL string `json:"ingestUrl,omitempty"`
+}
+
+// Request is called by the phone app and returns the token it polls with
+func (h *RegistrationHandler) Request(w http.ResponseWriter, r *http.Request) {
+	var req registrationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	registration, err := h.registrationService.RequestRegistration(req.Name, req.Email)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(registrationResponse{
+		ID:     registration.ID,
+		Status: registration.Status,
+		Token:  registration.Token,
+	})
+}
+
+// Status is polled by the phone app; once approved it carries the device
+// credentials and the URL to report positions to
+func (h *RegistrationHandler) Status(w http.ResponseWriter, r *http.Request) {
+	registrationID := r.URL.Query().Get("id")
+	token := r.URL.Query().Get("token")
+	if registrationID == "" || token == "" {
+		http.Error(w, "Registration ID and token required", http.StatusBadRequest)
+		return
+	}
+
+	registration, device, err := h.registrationService.GetRegistration(registrationID, token)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if registration == nil {
+		http.Error(w, "Registration not found", http.StatusNotFound)
+		return
+	}
+
+	resp := registrationResponse{ID: registration.ID, Status: registration.Status}
+	if device != nil {
+		resp.UniqueID = device.UniqueID
+		resp.ApiKey = device.ApiKey
+		resp.IngestURL = h.ingestURL(r, device)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// ListPending returns the registrations waiting for the caller's approval
+func (h *RegistrationHandler) ListPending(w http.ResponseWriter, r *http.Request) {
+	claims, err := util.GetUserClaims(r)
+	if err != nil {
+		http.Error(w, "Invalid authorization token", http.StatusUnauthorized)
+		return
+	}
+
+	registrations, err := h.registrationService.ListPendingRegistrations(claims.Email)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(registrations)
+}
+
+func (h *RegistrationHandler) Approve(w http.ResponseWriter, r *http.Request) {
+	claims, err := util.GetUserClaims(r)
+	if err != nil {
+		http.Error(w, "Invalid authorization token", http.StatusUnauthorized)
+		return
+	}
+
+	registrationID := r.URL.Query().Get("id")
+	if registrationID == "" {
+		http.Error(w, "Registration ID required", http.StatusBadRequest)
+		return
+	}
+
+	device, err := h.registrationService.ApproveRegistration(registrationID, claims.UserID, claims.Email)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(device)
+}
+
+func (h *RegistrationHandler) Reject(w http.ResponseWriter, r *http.Request) {
+	claims, err := util.GetUserClaims(r)
+	if err != nil {
+		http.Error(w, "Invalid authorization token", http.StatusUnauthorized)
+		return
+	}
+
+	registrationID := r.URL.Query().Get("id")
+	if registrationID == "" {
+		http.Error(w, "Registration ID required", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.registrationService.RejectRegistration(registrationID, claims.Email); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ingestURL is the OsmAnd endpoint with the device's credentials, ready to
+// paste into the phone app's server URL
+func (h *RegistrationHandler) ingestURL(r *http.Request, device *model.Device) string {
+	base := h.baseURL
+	if base == "" {
+		scheme := "http"
+		if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+			scheme = "https"
+		}
+		base = scheme + "://" + r.Host
+	}
+
+	params := url.Values{}
+	params.Set("id", device.UniqueID)
+	params.Set("key", device.ApiKey)
+	return base + "/api/osmand?" + params.Encode()
+}
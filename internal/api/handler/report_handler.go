@@ -0,0 +1,142 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+	"tracking/internal/api/util"
+	"tracking/internal/core/service"
+)
+
+// ReportHandler serves reports computed over the positions of devices
+type ReportHandler struct {
+	reportService service.ReportService
+}
+
+func NewReportHandler(reportService service.ReportService) *ReportHandler {
+	return &ReportHandler{
+		reportService: reportService,
+	}
+}
+
+// Stops lists where the device given by deviceId stayed between the RFC 3339
+// times from and to, for at least minDuration minutes when given
+func (h *ReportHandler) Stops(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	deviceID := params.Get("deviceId")
+	if deviceID == "" {
+		http.Error(w, "Device ID required", http.StatusBadRequest)
+		return
+	}
+	claims, err := util.GetUserClaims(r)
+	if err != nil {
+		http.Error(w, "Invalid authorization token", http.StatusUnauthorized)
+		return
+	}
+	from, to, ok := reportRange(w, r)
+	if !ok {
+		return
+	}
+	var minDuration time.Duration
+	if value := params.Get("minDuration"); value != "" {
+		minutes, err := strconv.Atoi(value)
+		if err != nil || minutes <= 0 {
+			http.Error(w, "Invalid minDuration parameter, expected minutes", http.StatusBadRequest)
+			return
+		}
+		minDuration = time.Duration(minutes) * time.Minute
+	}
+
+	report, err := h.reportService.GetStops(deviceID, claims.UserID, from, to, minDuration)
+	if err != nil {
+		writeReportError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// Mileage lists the distance the device given by deviceId covered between
+// the RFC 3339 times from and to, by day or by week as period asks
+func (h *ReportHandler) Mileage(w http.ResponseWriter, r *http.Request) {
+	deviceID := r.URL.Query().Get("deviceId")
+	if deviceID == "" {
+		http.Error(w, "Device ID required", http.StatusBadRequest)
+		return
+	}
+	claims, err := util.GetUserClaims(r)
+	if err != nil {
+		http.Error(w, "Invalid authorization token", http.StatusUnauthorized)
+		return
+	}
+	from, to, ok := reportRange(w, r)
+	if !ok {
+		return
+	}
+
+	report, err := h.reportService.GetMileage(deviceID, claims.UserID, from, to, r.URL.Query().Get("period"))
+	if err != nil {
+		writeReportError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// EngineHours lists the time the engine of the device given by deviceId
+// ran between the RFC 3339 times from and to, by day or by week as period
+// asks
+func (h *ReportHandler) EngineHours(w http.ResponseWriter, r *http.Request) {
+	deviceID := r.URL.Query().Get("deviceId")
+	if deviceID == "" {
+		http.Error(w, "Device ID required", http.StatusBadRequest)
+		return
+	}
+	claims, err := util.GetUserClaims(r)
+	if err != nil {
+		http.Error(w, "Invalid authorization token", http.StatusUnauthorized)
+		return
+	}
+	from, to, ok := reportRange(w, r)
+	if !ok {
+		return
+	}
+
+	report, err := h.reportService.GetEngineHours(deviceID, claims.UserID, from, to, r.URL.Query().Get("period"))
+	if err != nil {
+		writeReportError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// reportRange parses the RFC 3339 times from and to, answering the request
+// when either is invalid
+func reportRange(w http.ResponseWriter, r *http.Request) (from, to time.Time, ok bool) {
+	params := r.URL.Query()
+	for name, instant := range map[string]*time.Time{"from": &from, "to": &to} {
+		var err error
+		if *instant, err = time.Parse(time.RFC3339, params.Get(name)); err != nil {
+			http.Error(w, "Invalid "+name+" parameter, expected RFC 3339 time", http.StatusBadRequest)
+			return from, to, false
+		}
+	}
+	return from, to, true
+}
+
+func writeReportError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrDeviceNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, service.ErrInvalidReport):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
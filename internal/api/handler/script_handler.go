@@ -0,0 +1,163 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"tracking/internal/api/util"
+	"tracking/internal/core/locale"
+	"tracking/internal/core/service"
+)
+
+// ScriptHandler manages attribute scripts; every endpoint requires an admin
+type ScriptHandler struct {
+	scriptService service.ScriptService
+}
+
+func NewScriptHandler(scriptService service.ScriptService) *ScriptHandler {
+	return &ScriptHandler{
+		scriptService: scriptService,
+	}
+}
+
+type scriptRequest struct {
+	Name        string `json:"name"`
+	DeviceModel string `json:"deviceModel"`
+	Source      string `json:"source"`
+	Enabled     *bool  `json:"enabled,omitempty"` // Defaults to true on create, unchanged on update
+}
+
+// requireAdmin writes an error and returns false unless the caller is an admin
+func requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	claims, err := util.GetUserClaims(r)
+	if err != nil {
+		util.Error(w, r, locale.MsgInvalidAuthToken, http.StatusUnauthorized)
+		return false
+	}
+	if !util.IsAdmin(claims.Role) {
+		util.Error(w, r, locale.MsgAdminRequired, http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+func (h *ScriptHandler) Create(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	var req scriptRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	enabled := req.Enabled == nil || *req.Enabled
+	script, err := h.scriptService.CreateScript(req.Name, req.DeviceModel, req.Source, enabled)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(script)
+}
+
+func (h *ScriptHandler) List(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	scripts, err := h.scriptService.ListScripts()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(scripts)
+}
+
+func (h *ScriptHandler) Get(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	scriptID := r.URL.Query().Get("id")
+	if scriptID == "" {
+		http.Error(w, "Script ID required", http.StatusBadRequest)
+		return
+	}
+
+	script, err := h.scriptService.GetScript(scriptID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if script == nil {
+		http.Error(w, "Script not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(script)
+}
+
+func (h *ScriptHandler) Update(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	scriptID := r.URL.Query().Get("id")
+	if scriptID == "" {
+		http.Error(w, "Script ID required", http.StatusBadRequest)
+		return
+	}
+
+	var req scriptRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	existing, err := h.scriptService.GetScript(scriptID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if existing == nil {
+		http.Error(w, "Script not found", http.StatusNotFound)
+		return
+	}
+
+	enabled := existing.Enabled
+	if req.Enabled != nil {
+		enabled = *req.Enabled
+	}
+
+	script, err := h.scriptService.UpdateScript(scriptID, req.Name, req.DeviceModel, req.Source, enabled)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(script)
+}
+
+func (h *ScriptHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	scriptID := r.URL.Query().Get("id")
+	if scriptID == "" {
+		http.Error(w, "Script ID required", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.scriptService.DeleteScript(scriptID); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
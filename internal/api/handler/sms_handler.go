@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"tracking/internal/core/service"
+)
+
+// emptyTwiML answers an inbound message without replying to the sender
+const emptyTwiML = `<?xml version="1.0" encoding="UTF-8"?><Response></Response>`
+
+type SMSHandler struct {
+	positionService service.PositionService
+	authToken       string
+	baseURL         string
+}
+
+// NewSMSHandler accepts messages signed with the gateway's auth token.
+// baseURL is the public URL the gateway was given, needed to check
+// signatures behind a proxy; the request host is used when empty.
+func NewSMSHandler(positionService service.PositionService, authToken, baseURL string) *SMSHandler {
+	return &SMSHandler{
+		positionService: positionService,
+		authToken:       authToken,
+		baseURL:         strings.TrimSuffix(baseURL, "/"),
+	}
+}
+
+// Receive accepts Twilio-style inbound SMS webhooks, form posts with the
+// sender in From and the text in Body. Messages are acknowledged even when
+// they carry no position or come from an unknown number, so the gateway
+// does not report failures for stray texts.
+func (h *SMSHandler) Receive(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid parameters", http.StatusBadRequest)
+		return
+	}
+	if !h.validSignature(r) {
+		http.Error(w, "Invalid signature", http.StatusForbidden)
+		return
+	}
+
+	from := r.PostForm.Get("From")
+	if _, err := h.positionService.ProcessSMS(from, r.PostForm.Get("Body")); err != nil {
+		if !errors.Is(err, service.ErrUnknownSender) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("Ignoring SMS: %v", err)
+	}
+
+	w.Header().Set("Content-Type", "text/xml")
+	w.Write([]byte(emptyTwiML))
+}
+
+// validSignature checks X-Twilio-Signature, the base64 HMAC-SHA1 under the
+// auth token of the request URL followed by every posted name and value,
+// sorted by name
+func (h *SMSHandler) validSignature(r *http.Request) bool {
+	signature, err := base64.StdEncoding.DecodeString(r.Header.Get("X-Twilio-Signature"))
+	if err != nil || len(signature) == 0 {
+		return false
+	}
+
+	base := h.baseURL
+	if base == "" {
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+		base = scheme + "://" + r.Host
+	}
+
+	names := make([]string, 0, len(r.PostForm))
+	for name := range r.PostForm {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	mac := hmac.New(sha1.New, []byte(h.authToken))
+	mac.Write([]byte(base + r.URL.RequestURI()))
+	for _, name := range names {
+		for _, value := range r.PostForm[name] {
+			mac.Write([]byte(name + value))
+		}
+	}
+	return hmac.Equal(mac.Sum(nil), signature)
+}
@@ -0,0 +1,30 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"tracking/internal/core/metrics"
+)
+
+// StatusHandler serves the public status page data
+type StatusHandler struct {
+	recorder *metrics.Recorder
+}
+
+func NewStatusHandler(recorder *metrics.Recorder) *StatusHandler {
+	return &StatusHandler{recorder: recorder}
+}
+
+// GetStatus returns anonymized operational metrics. It needs no
+// authentication, so it reports aggregates only.
+func (h *StatusHandler) GetStatus(w http.ResponseWriter, r *http.Request) {
+	status := h.recorder.Snapshot()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if status.Status != "ok" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(status)
+}
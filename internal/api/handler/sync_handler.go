@@ -0,0 +1,53 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"tracking/internal/api/util"
+	"tracking/internal/core/service"
+)
+
+// SyncHandler serves incremental sync to mobile apps
+type SyncHandler struct {
+	syncService service.SyncService
+}
+
+func NewSyncHandler(syncService service.SyncService) *SyncHandler {
+	return &SyncHandler{
+		syncService: syncService,
+	}
+}
+
+// Sync returns what changed since the cursor in the since parameter, or a
+// snapshot to start from without one. The optional limit parameter bounds
+// the changes read per call; hasMore in the reply asks for another.
+func (h *SyncHandler) Sync(w http.ResponseWriter, r *http.Request) {
+	claims, err := util.GetUserClaims(r)
+	if err != nil {
+		http.Error(w, "Invalid authorization token", http.StatusUnauthorized)
+		return
+	}
+
+	limit := 0
+	if value := r.URL.Query().Get("limit"); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil || limit <= 0 {
+			http.Error(w, "Invalid limit parameter", http.StatusBadRequest)
+			return
+		}
+	}
+
+	result, err := h.syncService.Sync(claims.UserID, r.URL.Query().Get("since"), limit)
+	if errors.Is(err, service.ErrInvalidCursor) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"tracking/internal/api/util"
+	"tracking/internal/core/tiles"
+)
+
+// TileHandler serves map tiles for the frontend, which never sees the
+// provider's key
+type TileHandler struct {
+	proxy *tiles.Proxy
+}
+
+func NewTileHandler(proxy *tiles.Proxy) *TileHandler {
+	return &TileHandler{
+		proxy: proxy,
+	}
+}
+
+// Get returns the tile given by the z, x and y parameters. Fetches count
+// against the organization the request works in, or the user outside any;
+// the X-Tile-Remaining header tells how many are left today.
+func (h *TileHandler) Get(w http.ResponseWriter, r *http.Request) {
+	claims, err := util.GetUserClaims(r)
+	if err != nil {
+		http.Error(w, "Invalid authorization token", http.StatusUnauthorized)
+		return
+	}
+	var coords [3]int
+	for i, name := range []string{"z", "x", "y"} {
+		if coords[i], err = strconv.Atoi(r.URL.Query().Get(name)); err != nil {
+			http.Error(w, "Invalid "+name+" parameter", http.StatusBadRequest)
+			return
+		}
+	}
+	quotaKey := claims.OrganizationID
+	if quotaKey == "" {
+		quotaKey = "user:" + claims.UserID
+	}
+
+	tile, err := h.proxy.Tile(r.Context(), quotaKey, coords[0], coords[1], coords[2])
+	if remaining := h.proxy.Remaining(quotaKey); remaining >= 0 {
+		w.Header().Set("X-Tile-Remaining", strconv.Itoa(remaining))
+	}
+	switch {
+	case errors.Is(err, tiles.ErrInvalidTile):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, tiles.ErrTileNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, tiles.ErrQuotaExceeded):
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	case err != nil:
+		log.Printf("Tile fetch failed: %v", err)
+		http.Error(w, "Tile provider unavailable", http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", tile.ContentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(tile.Data)))
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	w.Write(tile.Data)
+}
@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"tracking/internal/api/util"
+	"tracking/internal/core/service"
+)
+
+// TrackImportHandler takes log files exported from devices and reports the
+// progress of their import
+type TrackImportHandler struct {
+	importService service.TrackImportService
+	deviceService service.DeviceService
+}
+
+func NewTrackImportHandler(importService service.TrackImportService, deviceService service.DeviceService) *TrackImportHandler {
+	return &TrackImportHandler{
+		importService: importService,
+		deviceService: deviceService,
+	}
+}
+
+// Import starts importing the log file in the body for the device given by
+// id. The format parameter, nmea or teltonika, is detected when omitted.
+// The reply is the job to poll.
+func (h *TrackImportHandler) Import(w http.ResponseWriter, r *http.Request) {
+	deviceID := r.URL.Query().Get("id")
+	if deviceID == "" {
+		http.Error(w, "Device ID required", http.StatusBadRequest)
+		return
+	}
+	claims, err := util.GetUserClaims(r)
+	if err != nil {
+		http.Error(w, "Invalid authorization token", http.StatusUnauthorized)
+		return
+	}
+	if err := h.deviceService.ValidateDeviceAccess(deviceID, claims.UserID); err != nil {
+		http.Error(w, "Unauthorized access to device", http.StatusForbidden)
+		return
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r.Body, service.MaxTrackImportSize+1))
+	if err != nil {
+		http.Error(w, "Failed to read upload", http.StatusBadRequest)
+		return
+	}
+
+	job, err := h.importService.ImportTrack(deviceID, claims.UserID, r.URL.Query().Get("format"), data)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidTrack) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+// GetJob returns the progress of an import the user started
+func (h *TrackImportHandler) GetJob(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, "Job ID required", http.StatusBadRequest)
+		return
+	}
+	claims, err := util.GetUserClaims(r)
+	if err != nil {
+		http.Error(w, "Invalid authorization token", http.StatusUnauthorized)
+		return
+	}
+
+	job, err := h.importService.GetJob(id)
+	if err != nil || (job.UserID != claims.UserID && !util.IsAdmin(claims.Role)) {
+		http.Error(w, service.ErrJobNotFound.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"tracking/internal/api/util"
+	"tracking/internal/core/service"
+)
+
+// TrafficHandler reports the data devices used by SIM
+type TrafficHandler struct {
+	trafficService service.TrafficService
+}
+
+func NewTrafficHandler(trafficService service.TrafficService) *TrafficHandler {
+	return &TrafficHandler{
+		trafficService: trafficService,
+	}
+}
+
+// SIMUsage reports the traffic of the user's devices by SIM in the month
+// given as 2006-01, the current one when absent
+func (h *TrafficHandler) SIMUsage(w http.ResponseWriter, r *http.Request) {
+	claims, err := util.GetUserClaims(r)
+	if err != nil {
+		http.Error(w, "Invalid authorization token", http.StatusUnauthorized)
+		return
+	}
+
+	usages, err := h.trafficService.SIMUsage(claims.UserID, r.URL.Query().Get("month"))
+	if errors.Is(err, service.ErrInvalidMonth) {
+		http.Error(w, "Month must be formatted as 2006-01", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(usages)
+}
@@ -3,6 +3,8 @@ package handler
 import (
 	"encoding/json"
 	"net/http"
+	"tracking/internal/api/util"
+	"tracking/internal/core/locale"
 	"tracking/internal/core/service"
 )
 
@@ -37,4 +39,35 @@ func (h *UserHandler) Register(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(user)
-}
\ No newline at end of file
+}
+
+type localeRequest struct {
+	Locale string `json:"locale"` // Empty to follow Accept-Language again
+}
+
+// SetLocale sets the signed in user's preferred locale
+func (h *UserHandler) SetLocale(w http.ResponseWriter, r *http.Request) {
+	claims, err := util.GetUserClaims(r)
+	if err != nil {
+		util.Error(w, r, locale.MsgInvalidAuthToken, http.StatusUnauthorized)
+		return
+	}
+
+	var req localeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Locale != "" && !locale.IsSupported(req.Locale) {
+		util.Error(w, r, locale.MsgUnsupportedLocale, http.StatusBadRequest)
+		return
+	}
+
+	if err := h.userService.SetLocale(claims.UserID, req.Locale); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"locale": req.Locale, "supported": locale.Supported})
+}
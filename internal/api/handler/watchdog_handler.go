@@ -0,0 +1,29 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"tracking/internal/core/watchdog"
+)
+
+// WatchdogHandler exposes the ingest reconciliation to admins
+type WatchdogHandler struct {
+	watchdog *watchdog.Watchdog
+}
+
+func NewWatchdogHandler(watchdog *watchdog.Watchdog) *WatchdogHandler {
+	return &WatchdogHandler{
+		watchdog: watchdog,
+	}
+}
+
+// GetReport returns the positions received and stored over the last window,
+// with the devices missing positions
+func (h *WatchdogHandler) GetReport(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.watchdog.Report())
+}
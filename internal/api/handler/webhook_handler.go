@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"tracking/internal/api/util"
+	"tracking/internal/core/model"
+	"tracking/internal/core/service"
+)
+
+// WebhookHandler manages webhooks in the organization context of the
+// request, or the user's personal webhooks outside any organization
+type WebhookHandler struct {
+	webhookService service.WebhookService
+}
+
+func NewWebhookHandler(webhookService service.WebhookService) *WebhookHandler {
+	return &WebhookHandler{
+		webhookService: webhookService,
+	}
+}
+
+// List returns the webhooks in reach, by URL
+func (h *WebhookHandler) List(w http.ResponseWriter, r *http.Request) {
+	claims, err := util.GetUserClaims(r)
+	if err != nil {
+		http.Error(w, "Invalid authorization token", http.StatusUnauthorized)
+		return
+	}
+
+	webhooks, err := h.webhookService.GetWebhooks(claims.UserID, claims.OrganizationID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(webhooks)
+}
+
+// Create sets the webhook in the body
+func (h *WebhookHandler) Create(w http.ResponseWriter, r *http.Request) {
+	claims, err := util.GetUserClaims(r)
+	if err != nil {
+		http.Error(w, "Invalid authorization token", http.StatusUnauthorized)
+		return
+	}
+	var req model.Webhook
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	webhook, err := h.webhookService.CreateWebhook(claims.UserID, claims.OrganizationID, &req)
+	writeWebhookResult(w, webhook, err)
+}
+
+// Update replaces the URL, secret and event types of the webhook given
+// by id
+func (h *WebhookHandler) Update(w http.ResponseWriter, r *http.Request) {
+	webhookID := r.URL.Query().Get("id")
+	if webhookID == "" {
+		http.Error(w, "Webhook ID required", http.StatusBadRequest)
+		return
+	}
+	claims, err := util.GetUserClaims(r)
+	if err != nil {
+		http.Error(w, "Invalid authorization token", http.StatusUnauthorized)
+		return
+	}
+	var req model.Webhook
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	webhook, err := h.webhookService.UpdateWebhook(webhookID, claims.UserID, claims.OrganizationID, &req)
+	writeWebhookResult(w, webhook, err)
+}
+
+// Delete removes the webhook given by id
+func (h *WebhookHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	webhookID := r.URL.Query().Get("id")
+	if webhookID == "" {
+		http.Error(w, "Webhook ID required", http.StatusBadRequest)
+		return
+	}
+	claims, err := util.GetUserClaims(r)
+	if err != nil {
+		http.Error(w, "Invalid authorization token", http.StatusUnauthorized)
+		return
+	}
+
+	err = h.webhookService.DeleteWebhook(webhookID, claims.UserID, claims.OrganizationID)
+	if errors.Is(err, service.ErrWebhookNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "deleted"})
+}
+
+func writeWebhookResult(w http.ResponseWriter, webhook *model.Webhook, err error) {
+	if errors.Is(err, service.ErrWebhookNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, service.ErrInvalidWebhook) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(webhook)
+}
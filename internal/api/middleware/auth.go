@@ -6,23 +6,27 @@ import (
 	"net/http"
 	"os"
 	"strings"
-	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"tracking/internal/api/util"
+	"tracking/internal/api/websocket"
+	"tracking/internal/core/locale"
+	coreutil "tracking/internal/core/util"
 )
 
 type Claims struct {
 	jwt.RegisteredClaims
 	Email string `json:"email"`
 	Role  string `json:"role"`
+	OrganizationID string `json:"organization_id,omitempty"` // Default organization context
 }
 
 type AuthMiddleware struct {
 	accessSecret string
+	clock        coreutil.Clock
 }
 
-func NewAuthMiddleware() *AuthMiddleware {
+func NewAuthMiddleware(clock coreutil.Clock) *AuthMiddleware {
 	secret := os.Getenv("JWT_ACCESS_SECRET")
 	if secret == "" {
 		secret = "test_jwt_secret_key_123" // Default secret for development
@@ -31,20 +35,26 @@ func NewAuthMiddleware() *AuthMiddleware {
 
 	return &AuthMiddleware{
 		accessSecret: secret,
+		clock:        clock,
 	}
 }
 
 func (m *AuthMiddleware) Authenticate(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		authHeader := r.Header.Get("Authorization")
+		// Browsers cannot set headers on WebSockets or event streams, which
+		// pass the token as a parameter instead
+		if token := r.URL.Query().Get("token"); authHeader == "" && token != "" && (websocket.IsUpgrade(r) || isEventStream(r)) {
+			authHeader = "Bearer " + token
+		}
 		if authHeader == "" {
-			http.Error(w, "Authorization header is required", http.StatusUnauthorized)
+			util.Error(w, r, locale.MsgAuthorizationRequired, http.StatusUnauthorized)
 			return
 		}
 
 		parts := strings.Split(authHeader, " ")
 		if len(parts) != 2 || parts[0] != "Bearer" {
-			http.Error(w, "Invalid authorization header format", http.StatusUnauthorized)
+			util.Error(w, r, locale.MsgInvalidAuthorization, http.StatusUnauthorized)
 			return
 		}
 
@@ -57,24 +67,24 @@ func (m *AuthMiddleware) Authenticate(next http.Handler) http.Handler {
 				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 			}
 			return []byte(m.accessSecret), nil
-		})
+		}, jwt.WithTimeFunc(m.clock.Now))
 
 		if err != nil {
 			log.Printf("Token validation error: %v", err)
-			http.Error(w, "Invalid token", http.StatusUnauthorized)
+			util.Error(w, r, locale.MsgInvalidToken, http.StatusUnauthorized)
 			return
 		}
 
 		if !token.Valid {
 			log.Printf("Token is not valid")
-			http.Error(w, "Invalid token", http.StatusUnauthorized)
+			util.Error(w, r, locale.MsgInvalidToken, http.StatusUnauthorized)
 			return
 		}
 
 		// Verify expiration
-		if claims.ExpiresAt != nil && time.Now().After(claims.ExpiresAt.Time) {
+		if claims.ExpiresAt != nil && m.clock.Now().After(claims.ExpiresAt.Time) {
 			log.Printf("Token expired at: %v", claims.ExpiresAt.Time)
-			http.Error(w, "Token has expired", http.StatusUnauthorized)
+			util.Error(w, r, locale.MsgTokenExpired, http.StatusUnauthorized)
 			return
 		}
 
@@ -85,6 +95,7 @@ func (m *AuthMiddleware) Authenticate(next http.Handler) http.Handler {
 			UserID: claims.Subject,
 			Email:  claims.Email,
 			Role:   claims.Role,
+			OrganizationID: claims.OrganizationID,
 		}
 
 		// Add claims to request context
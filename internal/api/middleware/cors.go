@@ -16,8 +16,10 @@ func CORSMiddleware(next http.Handler) http.Handler {
 		}
 
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, Authorization")
+		w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, Authorization, "+OrganizationHeader)
 		w.Header().Set("Access-Control-Allow-Credentials", "true")
+		// Pages of positions name the next one in a header
+		w.Header().Set("Access-Control-Expose-Headers", "X-Next-Cursor")
 
 		// Handle preflight requests
 		if r.Method == "OPTIONS" {
@@ -1,8 +1,8 @@
 package middleware
 
 import (
-	"context"
 	"net/http"
+	"tracking/internal/api/util"
 	"tracking/internal/core/service"
 )
 
@@ -55,7 +55,7 @@ func (m *DeviceAuthMiddleware) Authenticate(next http.Handler) http.Handler {
 		}
 
 		// Add device to context
-		ctx := context.WithValue(r.Context(), "device", device)
+		ctx := util.WithDevice(r.Context(), device)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"net/http"
+	"tracking/internal/api/util"
+	"tracking/internal/core/locale"
+	"tracking/internal/core/service"
+)
+
+// LocaleMiddleware resolves the response locale and adds it to the request
+// context. A signed in user's profile locale wins over Accept-Language.
+type LocaleMiddleware struct {
+	userService service.UserService
+}
+
+func NewLocaleMiddleware(userService service.UserService) *LocaleMiddleware {
+	return &LocaleMiddleware{
+		userService: userService,
+	}
+}
+
+// Resolve runs after authentication, so the user's claims are available
+func (m *LocaleMiddleware) Resolve(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tag := ""
+		if claims, err := util.GetUserClaims(r); err == nil && m.userService != nil {
+			if user, err := m.userService.GetUser(claims.UserID); err == nil && user != nil && locale.IsSupported(user.Locale) {
+				tag = user.Locale
+			}
+		}
+		if tag == "" {
+			tag = locale.Negotiate(r.Header.Get("Accept-Language"))
+		}
+
+		w.Header().Set("Content-Language", tag)
+		w.Header().Add("Vary", "Accept-Language")
+		next.ServeHTTP(w, r.WithContext(locale.NewContext(r.Context(), tag)))
+	})
+}
@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"tracking/internal/api/websocket"
+	"tracking/internal/core/metrics"
+)
+
+// MetricsMiddleware records the latency of API requests for the status page.
+// WebSockets and event streams are left out, as they last as long as the
+// client stays.
+func MetricsMiddleware(recorder *metrics.Recorder, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/api/") || websocket.IsUpgrade(r) || isEventStream(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		start := time.Now()
+		next.ServeHTTP(w, r)
+		recorder.ObserveRequest(time.Since(start))
+	})
+}
+
+// isEventStream reports whether a request asks for Server-Sent Events, as
+// browsers' EventSource does
+func isEventStream(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+}
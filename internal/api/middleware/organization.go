@@ -0,0 +1,135 @@
+package middleware
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"tracking/internal/api/util"
+	"tracking/internal/core/locale"
+	"tracking/internal/core/service"
+)
+
+// OrganizationHeader switches the organization a request works in,
+// overriding the organization_id claim of the token
+const OrganizationHeader = "X-Organization-ID"
+
+// OrganizationMiddleware resolves the organization context of a request.
+// Users may belong to several organizations; the context must be one of
+// them, checked against the user's memberships rather than trusted.
+type OrganizationMiddleware struct {
+	organizationService service.OrganizationService
+	deviceService       service.DeviceService
+}
+
+func NewOrganizationMiddleware(organizationService service.OrganizationService, deviceService service.DeviceService) *OrganizationMiddleware {
+	return &OrganizationMiddleware{
+		organizationService: organizationService,
+		deviceService:       deviceService,
+	}
+}
+
+// Resolve runs after authentication, so the user's claims are available
+func (m *OrganizationMiddleware) Resolve(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, err := util.GetUserClaims(r)
+		if err != nil || m.organizationService == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		orgID := r.Header.Get(OrganizationHeader)
+		if orgID == "" {
+			orgID = claims.OrganizationID
+		}
+		if orgID == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		member, err := m.organizationService.GetMembership(claims.UserID, orgID)
+		if err != nil {
+			log.Printf("Failed to look up membership of %s in %s: %v", claims.UserID, orgID, err)
+			http.Error(w, "Failed to resolve organization", http.StatusInternalServerError)
+			return
+		}
+		if !util.CanAccessOrganization(claims.Role, member) {
+			util.Error(w, r, locale.MsgNotOrganizationMember, http.StatusForbidden)
+			return
+		}
+
+		scoped := *claims
+		scoped.OrganizationID = orgID
+		scoped.OrganizationRole = ""
+		if member != nil {
+			scoped.OrganizationRole = member.Role
+		}
+		next.ServeHTTP(w, r.WithContext(util.WithUserClaims(r.Context(), &scoped)))
+	})
+}
+
+// RequireFeature refuses requests for a feature the organization they
+// concern does not allow. A request naming a device with deviceId concerns
+// the device's organization, whichever organization it is made in; other
+// requests concern the organization they are made in. Devices outside any
+// organization are not restricted, but members of an organization must make
+// other requests in one.
+func (m *OrganizationMiddleware) RequireFeature(feature string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if m.organizationService == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		claims, err := util.GetUserClaims(r)
+		if err != nil {
+			http.Error(w, "Invalid authorization token", http.StatusUnauthorized)
+			return
+		}
+
+		orgID := claims.OrganizationID
+		if deviceID := r.URL.Query().Get("deviceId"); deviceID != "" {
+			device, err := m.deviceService.GetDevice(deviceID)
+			if err != nil {
+				log.Printf("Failed to look up device %s: %v", deviceID, err)
+				http.Error(w, "Failed to resolve organization", http.StatusInternalServerError)
+				return
+			}
+			// Unknown devices are refused by the handler
+			if device == nil || device.OrganizationID == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			orgID = device.OrganizationID
+		}
+
+		if orgID == "" {
+			memberships, err := m.organizationService.GetMemberships(claims.UserID)
+			if err != nil {
+				log.Printf("Failed to look up memberships of %s: %v", claims.UserID, err)
+				http.Error(w, "Failed to resolve organization", http.StatusInternalServerError)
+				return
+			}
+			if len(memberships) > 0 {
+				util.Error(w, r, locale.MsgFeatureNotAllowed, http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		features, err := m.organizationService.GetFeatures(orgID)
+		if errors.Is(err, service.ErrOrganizationNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to look up features of %s: %v", orgID, err)
+			http.Error(w, "Failed to resolve organization", http.StatusInternalServerError)
+			return
+		}
+		if !slices.Contains(features, feature) {
+			util.Error(w, r, locale.MsgFeatureNotAllowed, http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -6,20 +6,77 @@ import (
 	"net/http"
 	"tracking/internal/api/handler"
 	"tracking/internal/api/middleware"
+	"tracking/internal/core/encryption"
+	"tracking/internal/core/geocode"
+	"tracking/internal/core/logging"
+	"tracking/internal/core/metrics"
+	"tracking/internal/core/model"
 	"tracking/internal/core/service"
+	"tracking/internal/core/tiles"
+	"tracking/internal/core/util"
+	"tracking/internal/core/watchdog"
 )
 
-func NewRouter(
-	deviceService service.DeviceService,
-	positionService service.PositionService,
-) http.Handler {
+// Dependencies holds the services the HTTP API is built from
+type Dependencies struct {
+	DeviceService       service.DeviceService
+	OrganizationService service.OrganizationService
+	PositionService     service.PositionService
+	UserService         service.UserService
+	ScriptService       service.ScriptService // Optional; nil leaves out the script admin API
+	RegistrationService service.RegistrationService
+	BundleService       service.BundleService            // Optional; nil leaves out export and import
+	BenchmarkService    service.BenchmarkService         // Optional; nil leaves out ingest benchmarks
+	MessageService      service.MessageService           // Optional; nil leaves out driver messaging
+	HistoryService      service.HistoryService           // Optional; nil leaves out device history
+	MediaService        service.MediaService             // Optional; nil leaves out media upload
+	TrackImportService  service.TrackImportService       // Optional; nil leaves out track imports
+	SyncService         service.SyncService              // Optional; nil leaves out incremental sync
+	EventService        service.EventService             // Optional; nil leaves out the event listing
+	AlertService        service.AlertService             // Optional; nil leaves out acknowledgment and snoozing
+	FilterService       service.FilterService            // Optional; nil leaves out saved device filters
+	CommandService      service.CommandService           // Optional; nil leaves out the command queue
+	DashboardService    service.DashboardService         // Optional; nil leaves out dashboard widgets
+	GeofenceService     service.GeofenceService          // Optional; nil leaves out geofences
+	NoteService         service.NoteService              // Optional; nil leaves out position notes
+	AttributeService    service.ComputedAttributeService // Optional; nil leaves out computed attributes
+	AccumulatorService  service.AccumulatorService       // Optional; nil leaves out odometer and engine hours
+	MaintenanceService  service.MaintenanceService       // Optional; nil leaves out maintenance schedules
+	FuelService         service.FuelService              // Optional; nil leaves out fuel level series
+	DataModeService     service.DataModeService          // Optional; nil leaves out low-data mode and usage estimates
+	TrafficService      service.TrafficService           // Optional; nil leaves out the SIM data usage report
+	WebhookService      service.WebhookService           // Optional; nil leaves out user webhooks
+	NotificationService service.NotificationService      // Optional; nil leaves out email notification preferences
+	PushService         service.PushService              // Optional; nil leaves out push token registration
+	LiveService         service.LiveService              // Optional; nil leaves out live streams
+	ReportService       service.ReportService            // Optional; nil leaves out reports
+	CertificateService  service.DeviceCertificateService // Optional; nil leaves out device certificates
+	Geocoder            *geocode.Geocoder                // Optional; nil leaves out address search
+	ReverseGeocoder     *geocode.ReverseGeocoder         // Optional; nil leaves out the reverse geocoding passthrough
+	TileProxy           *tiles.Proxy                     // Optional; nil leaves out map tiles
+	Encryption          *encryption.Devices              // Optional; nil leaves out master key rotation
+	BaseURL             string                           // Public URL used in links handed to devices; the request host when empty
+	Clock               util.Clock
+	Metrics             *metrics.Recorder  // Optional; nil leaves out the public status page
+	Watchdog            *watchdog.Watchdog // Optional; nil leaves out the ingest report
+	LogLevels           *logging.Levels    // Optional; nil leaves out runtime log levels
+	SMSAuthToken        string             // Signs inbound SMS webhooks; empty leaves out the endpoint
+}
+
+func NewRouter(deps Dependencies) http.Handler {
 	// Initialize handlers
-	deviceHandler := handler.NewDeviceHandler(deviceService)
-	positionHandler := handler.NewPositionHandler(positionService)
-	authHandler := handler.NewAuthHandler()
+	deviceHandler := handler.NewDeviceHandler(deps.DeviceService, deps.OrganizationService, deps.FilterService)
+	organizationHandler := handler.NewOrganizationHandler(deps.OrganizationService)
+	positionHandler := handler.NewPositionHandler(deps.PositionService, deps.NoteService)
+	userHandler := handler.NewUserHandler(deps.UserService)
+	authHandler := handler.NewAuthHandler(deps.Clock)
+	registrationHandler := handler.NewRegistrationHandler(deps.RegistrationService, deps.BaseURL)
 
 	// Initialize middleware
-	authMiddleware := middleware.NewAuthMiddleware()
+	authMiddleware := middleware.NewAuthMiddleware(deps.Clock)
+	localeMiddleware := middleware.NewLocaleMiddleware(deps.UserService)
+	organizationMiddleware := middleware.NewOrganizationMiddleware(deps.OrganizationService, deps.DeviceService)
+	deviceAuthMiddleware := middleware.NewDeviceAuthMiddleware(deps.DeviceService)
 
 	// Create router
 	mux := http.NewServeMux()
@@ -31,13 +88,18 @@ func NewRouter(
 				fmt.Printf("Request received: %s %s\n", r.Method, r.URL.Path)
 				middleware.LoggingMiddleware(
 					authMiddleware.Authenticate(
-						handler,
+						localeMiddleware.Resolve(organizationMiddleware.Resolve(handler)),
 					),
 				).ServeHTTP(w, r)
 			}),
 		)
 	}
 
+	// Like withMiddleware, for features an organization may be restricted from
+	withFeature := func(feature string, handler http.Handler) http.Handler {
+		return withMiddleware(organizationMiddleware.RequireFeature(feature, handler))
+	}
+
 	// Health check endpoint (no auth required)
 	mux.Handle("/health", middleware.CORSMiddleware(
 		middleware.LoggingMiddleware(
@@ -51,6 +113,22 @@ func NewRouter(
 		),
 	))
 
+	// Public status page data (no auth required)
+	if deps.Metrics != nil {
+		statusHandler := handler.NewStatusHandler(deps.Metrics)
+		mux.Handle("/status", middleware.CORSMiddleware(
+			middleware.LoggingMiddleware(
+				http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					if r.Method != http.MethodGet {
+						http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+						return
+					}
+					statusHandler.GetStatus(w, r)
+				}),
+			),
+		))
+	}
+
 	// Test login endpoint (unprotected)
 	mux.Handle("/api/auth/test-login", middleware.CORSMiddleware(
 		middleware.LoggingMiddleware(
@@ -58,6 +136,151 @@ func NewRouter(
 		),
 	))
 
+	// User registration endpoint (unprotected)
+	mux.Handle("/api/users/register", middleware.CORSMiddleware(
+		middleware.LoggingMiddleware(
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.Method {
+				case http.MethodPost:
+					userHandler.Register(w, r)
+				case http.MethodOptions:
+					w.WriteHeader(http.StatusOK)
+				default:
+					http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				}
+			}),
+		),
+	))
+
+	// Preferred response language of the signed in user
+	mux.Handle("/api/users/locale", withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		userHandler.SetLocale(w, r)
+	})))
+
+	// Email notifications the signed in user receives
+	if deps.NotificationService != nil {
+		notificationHandler := handler.NewNotificationHandler(deps.NotificationService)
+
+		mux.Handle("/api/users/notifications", withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet:
+				notificationHandler.Get(w, r)
+			case http.MethodPut:
+				notificationHandler.Set(w, r)
+			default:
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+		})))
+	}
+
+	// Apps of the signed in user that alarm and geofence events are pushed to
+	if deps.PushService != nil {
+		pushTokenHandler := handler.NewPushTokenHandler(deps.PushService)
+
+		mux.Handle("/api/users/push-tokens", withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			pushTokenHandler.Register(w, r)
+		})))
+		mux.Handle("/api/users/push-tokens/delete", withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			pushTokenHandler.Unregister(w, r)
+		})))
+	}
+
+	// Device-authenticated ingest, for devices posting with their API credentials
+	mux.Handle("/api/device/positions/raw", middleware.CORSMiddleware(
+		middleware.LoggingMiddleware(
+			deviceAuthMiddleware.Authenticate(
+				http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					if r.Method != http.MethodPost {
+						http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+						return
+					}
+					positionHandler.ProcessDeviceRawData(w, r)
+				}),
+			),
+		),
+	))
+
+	// OsmAnd ingest for phone trackers, authenticated by the id and key
+	// parameters. /osmand is the path phone apps are usually pointed at.
+	osmandHandler := middleware.CORSMiddleware(
+		middleware.LoggingMiddleware(
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodGet && r.Method != http.MethodPost {
+					http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+					return
+				}
+				positionHandler.ProcessOsmAnd(w, r)
+			}),
+		),
+	)
+	mux.Handle("/api/osmand", osmandHandler)
+	mux.Handle("/osmand", osmandHandler)
+
+	// OwnTracks app in HTTP mode, authenticated with Basic auth
+	mux.Handle("/owntracks", middleware.CORSMiddleware(
+		middleware.LoggingMiddleware(
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodPost {
+					http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+					return
+				}
+				positionHandler.ProcessOwnTracks(w, r)
+			}),
+		),
+	))
+
+	// Inbound SMS from an SMS gateway, authenticated by its signature
+	if deps.SMSAuthToken != "" {
+		smsHandler := handler.NewSMSHandler(deps.PositionService, deps.SMSAuthToken, deps.BaseURL)
+		mux.Handle("/api/sms/inbound", middleware.LoggingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			smsHandler.Receive(w, r)
+		})))
+	}
+
+	// Phone tracker self-registration: requesting and polling need no account
+	mux.Handle("/api/device-registrations", middleware.CORSMiddleware(
+		middleware.LoggingMiddleware(
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.Method {
+				case http.MethodPost:
+					registrationHandler.Request(w, r)
+				case http.MethodOptions:
+					w.WriteHeader(http.StatusOK)
+				default:
+					http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				}
+			}),
+		),
+	))
+
+	mux.Handle("/api/device-registrations/status", middleware.CORSMiddleware(
+		middleware.LoggingMiddleware(
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodGet {
+					http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+					return
+				}
+				registrationHandler.Status(w, r)
+			}),
+		),
+	))
+
 	// Protected routes
 	mux.Handle("/api/devices", withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
@@ -70,6 +293,40 @@ func NewRouter(
 		}
 	})))
 
+	// Organizations the user belongs to, for switching organization context
+	mux.Handle("/api/organizations/memberships", withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		organizationHandler.GetMemberships(w, r)
+	})))
+
+	// Organizations nest below resellers, whose admins add and oversee them
+	mux.Handle("/api/organizations", withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		organizationHandler.Create(w, r)
+	})))
+
+	mux.Handle("/api/organizations/children", withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		organizationHandler.GetChildren(w, r)
+	})))
+
+	mux.Handle("/api/organizations/rollup", withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		organizationHandler.GetRollup(w, r)
+	})))
+
 	mux.Handle("/api/devices/list", withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -86,6 +343,94 @@ func NewRouter(
 		deviceHandler.GetDevice(w, r)
 	})))
 
+	mux.Handle("/api/devices/model", withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		deviceHandler.AssignModel(w, r)
+	})))
+
+	mux.Handle("/api/devices/speed-limit", withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		deviceHandler.SetSpeedLimit(w, r)
+	})))
+
+	mux.Handle("/api/devices/phone", withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		deviceHandler.SetPhone(w, r)
+	})))
+
+	mux.Handle("/api/devices/sessions", withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		deviceHandler.GetSessions(w, r)
+	})))
+
+	mux.Handle("/api/devices/tags", withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		deviceHandler.SetTags(w, r)
+	})))
+
+	mux.Handle("/api/devices/external-ids", withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		deviceHandler.SetExternalIDs(w, r)
+	})))
+
+	mux.Handle("/api/devices/by-external-id", withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		deviceHandler.FindByExternalID(w, r)
+	})))
+
+	mux.Handle("/api/device-models/list", withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		deviceHandler.GetDeviceModels(w, r)
+	})))
+
+	mux.Handle("/api/device-registrations/list", withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		registrationHandler.ListPending(w, r)
+	})))
+
+	mux.Handle("/api/device-registrations/approve", withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		registrationHandler.Approve(w, r)
+	})))
+
+	mux.Handle("/api/device-registrations/reject", withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		registrationHandler.Reject(w, r)
+	})))
+
 	// Position routes with authentication
 	mux.Handle("/api/positions", withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
@@ -126,5 +471,758 @@ func NewRouter(
 		}
 	})))
 
+	// Live positions, events and status changes as Server-Sent Events or
+	// over a WebSocket
+	if deps.LiveService != nil {
+		liveHandler := handler.NewLiveHandler(deps.LiveService)
+
+		mux.Handle("/api/positions/stream", withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			liveHandler.Stream(w, r)
+		})))
+
+		mux.Handle("/api/ws", withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			liveHandler.Socket(w, r)
+		})))
+	}
+
+	// Driver messaging: send, list and stream over a WebSocket, and replies
+	// posted by devices with their API credentials
+	if deps.MessageService != nil {
+		messageHandler := handler.NewMessageHandler(deps.MessageService, deps.DeviceService)
+
+		mux.Handle("/api/messages", withFeature(model.FeatureMessages, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			messageHandler.Send(w, r)
+		})))
+
+		mux.Handle("/api/messages/list", withFeature(model.FeatureMessages, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			messageHandler.GetThread(w, r)
+		})))
+
+		mux.Handle("/api/messages/stream", withFeature(model.FeatureMessages, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			messageHandler.Stream(w, r)
+		})))
+
+		mux.Handle("/api/device/messages", middleware.CORSMiddleware(
+			middleware.LoggingMiddleware(
+				deviceAuthMiddleware.Authenticate(
+					http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+						if r.Method != http.MethodPost {
+							http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+							return
+						}
+						messageHandler.ReceiveFromDevice(w, r)
+					}),
+				),
+			),
+		))
+	}
+
+	// Device history and point-in-time fleet, when event sourcing is enabled
+	if deps.HistoryService != nil {
+		historyHandler := handler.NewHistoryHandler(deps.HistoryService)
+
+		mux.Handle("/api/devices/history", withFeature(model.FeatureHistory, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			historyHandler.GetDeviceHistory(w, r)
+		})))
+
+		mux.Handle("/api/devices/fleet", withFeature(model.FeatureHistory, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			historyHandler.GetFleet(w, r)
+		})))
+	}
+
+	// Media uploaded by devices with their API credentials, listed for users
+	// and served through signed links
+	if deps.MediaService != nil {
+		mediaHandler := handler.NewMediaHandler(deps.MediaService, deps.DeviceService)
+
+		mux.Handle("/api/device/media", middleware.CORSMiddleware(
+			middleware.LoggingMiddleware(
+				deviceAuthMiddleware.Authenticate(
+					http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+						if r.Method != http.MethodPost {
+							http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+							return
+						}
+						mediaHandler.Upload(w, r)
+					}),
+				),
+			),
+		))
+
+		mux.Handle("/api/media/list", withFeature(model.FeatureMedia, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			mediaHandler.List(w, r)
+		})))
+
+		mux.Handle("/api/media/get", withFeature(model.FeatureMedia, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			mediaHandler.Get(w, r)
+		})))
+
+		mux.Handle("/media/content", middleware.LoggingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			mediaHandler.Content(w, r)
+		})))
+	}
+
+	// Backfilling positions from device logs, run as jobs
+	if deps.TrackImportService != nil {
+		importHandler := handler.NewTrackImportHandler(deps.TrackImportService, deps.DeviceService)
+
+		mux.Handle("/api/devices/import", withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			importHandler.Import(w, r)
+		})))
+
+		mux.Handle("/api/jobs/get", withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			importHandler.GetJob(w, r)
+		})))
+	}
+
+	// Incremental sync for mobile apps, from the change journal
+	if deps.SyncService != nil {
+		syncHandler := handler.NewSyncHandler(deps.SyncService)
+
+		mux.Handle("/api/sync", withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			syncHandler.Sync(w, r)
+		})))
+	}
+
+	// Stored events, paged and filtered, and their daily counts for charts
+	if deps.EventService != nil {
+		eventHandler := handler.NewEventHandler(deps.EventService, deps.DeviceService, deps.FilterService)
+
+		mux.Handle("/api/events", withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			eventHandler.List(w, r)
+		})))
+
+		mux.Handle("/api/events/counts", withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			eventHandler.Counts(w, r)
+		})))
+	}
+
+	// Acknowledging events and snoozing alerts
+	if deps.AlertService != nil {
+		alertHandler := handler.NewAlertHandler(deps.AlertService, deps.DeviceService)
+
+		mux.Handle("/api/events/acknowledge", withFeature(model.FeatureAlerts, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			alertHandler.Acknowledge(w, r)
+		})))
+
+		mux.Handle("/api/devices/snoozes", withFeature(model.FeatureAlerts, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet:
+				alertHandler.GetSnoozes(w, r)
+			case http.MethodPost:
+				alertHandler.Snooze(w, r)
+			default:
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+		})))
+
+		mux.Handle("/api/devices/snoozes/cancel", withFeature(model.FeatureAlerts, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			alertHandler.CancelSnooze(w, r)
+		})))
+	}
+
+	// Chart series for dashboard widgets, computed from daily aggregates
+	if deps.DashboardService != nil {
+		dashboardHandler := handler.NewDashboardHandler(deps.DashboardService, deps.FilterService)
+
+		mux.Handle("/api/dashboard/top-speeders", withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			dashboardHandler.TopSpeeders(w, r)
+		})))
+
+		mux.Handle("/api/dashboard/most-distance", withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			dashboardHandler.MostDistance(w, r)
+		})))
+
+		mux.Handle("/api/dashboard/alarms", withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			dashboardHandler.AlarmsByType(w, r)
+		})))
+
+		mux.Handle("/api/dashboard/online-ratio", withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			dashboardHandler.OnlineRatio(w, r)
+		})))
+	}
+
+	// Commands queued for devices until they next connect
+	if deps.CommandService != nil {
+		commandHandler := handler.NewCommandHandler(deps.CommandService, deps.DeviceService)
+
+		mux.Handle("/api/devices/commands", withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet:
+				commandHandler.List(w, r)
+			case http.MethodPost:
+				commandHandler.Queue(w, r)
+			default:
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+		})))
+
+		mux.Handle("/api/devices/commands/cancel", withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			commandHandler.Cancel(w, r)
+		})))
+	}
+
+	// Address search, for placing geofences without a provider key in the
+	// browser
+	if deps.Geocoder != nil {
+		geocodeHandler := handler.NewGeocodeHandler(deps.Geocoder)
+
+		mux.Handle("/api/geocode", withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			geocodeHandler.Search(w, r)
+		})))
+	}
+
+	// Street addresses at a point, from the provider that fills in the
+	// addresses of positions
+	if deps.ReverseGeocoder != nil {
+		reverseHandler := handler.NewReverseGeocodeHandler(deps.ReverseGeocoder)
+
+		mux.Handle("/api/geocode/reverse", withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			reverseHandler.Reverse(w, r)
+		})))
+	}
+
+	// Map tiles, served through the server so the provider key stays here
+	if deps.TileProxy != nil {
+		tileHandler := handler.NewTileHandler(deps.TileProxy)
+
+		mux.Handle("/api/tiles", withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			tileHandler.Get(w, r)
+		})))
+	}
+
+	// Device filters users save to list and report on named slices of a fleet
+	if deps.FilterService != nil {
+		filterHandler := handler.NewFilterHandler(deps.FilterService)
+
+		mux.Handle("/api/filters", withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet:
+				filterHandler.List(w, r)
+			case http.MethodPost:
+				filterHandler.Create(w, r)
+			case http.MethodPut:
+				filterHandler.Update(w, r)
+			default:
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+		})))
+
+		mux.Handle("/api/filters/delete", withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			filterHandler.Delete(w, r)
+		})))
+	}
+
+	// Geofences whose crossing raises geofenceEnter and geofenceExit events
+	if deps.GeofenceService != nil {
+		geofenceHandler := handler.NewGeofenceHandler(deps.GeofenceService)
+
+		mux.Handle("/api/geofences", withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet:
+				geofenceHandler.List(w, r)
+			case http.MethodPost:
+				geofenceHandler.Create(w, r)
+			case http.MethodPut:
+				geofenceHandler.Update(w, r)
+			default:
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+		})))
+
+		mux.Handle("/api/geofences/delete", withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			geofenceHandler.Delete(w, r)
+		})))
+	}
+
+	// URLs the events of devices are posted to
+	if deps.WebhookService != nil {
+		webhookHandler := handler.NewWebhookHandler(deps.WebhookService)
+
+		mux.Handle("/api/webhooks", withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet:
+				webhookHandler.List(w, r)
+			case http.MethodPost:
+				webhookHandler.Create(w, r)
+			case http.MethodPut:
+				webhookHandler.Update(w, r)
+			default:
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+		})))
+
+		mux.Handle("/api/webhooks/delete", withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			webhookHandler.Delete(w, r)
+		})))
+	}
+
+	// Notes on positions and time ranges of device tracks
+	if deps.NoteService != nil {
+		noteHandler := handler.NewNoteHandler(deps.NoteService)
+
+		mux.Handle("/api/notes", withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet:
+				noteHandler.List(w, r)
+			case http.MethodPost:
+				noteHandler.Create(w, r)
+			case http.MethodPut:
+				noteHandler.Update(w, r)
+			default:
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+		})))
+
+		mux.Handle("/api/notes/delete", withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			noteHandler.Delete(w, r)
+		})))
+	}
+
+	// Computed attributes of devices, with an expression check
+	if deps.AttributeService != nil {
+		attributeHandler := handler.NewComputedAttributeHandler(deps.AttributeService)
+
+		mux.Handle("/api/attributes/computed", withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet:
+				attributeHandler.List(w, r)
+			case http.MethodPost:
+				attributeHandler.Create(w, r)
+			case http.MethodPut:
+				attributeHandler.Update(w, r)
+			default:
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+		})))
+
+		mux.Handle("/api/attributes/computed/delete", withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			attributeHandler.Delete(w, r)
+		})))
+
+		mux.Handle("/api/attributes/computed/test", withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			attributeHandler.Test(w, r)
+		})))
+	}
+
+	// Odometer and engine hours of devices, and the baselines they were set to
+	if deps.AccumulatorService != nil {
+		accumulatorHandler := handler.NewAccumulatorHandler(deps.AccumulatorService)
+
+		mux.Handle("/api/devices/accumulators", withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet:
+				accumulatorHandler.Get(w, r)
+			case http.MethodPut:
+				accumulatorHandler.Set(w, r)
+			default:
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+		})))
+
+		mux.Handle("/api/devices/accumulators/baselines", withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			accumulatorHandler.Baselines(w, r)
+		})))
+
+		mux.Handle("/api/devices/accumulators/utilization", withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			accumulatorHandler.Utilization(w, r)
+		})))
+	}
+
+	// Reports over the positions of a device within a time range
+	if deps.ReportService != nil {
+		reportHandler := handler.NewReportHandler(deps.ReportService)
+
+		mux.Handle("/api/reports/stops", withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			reportHandler.Stops(w, r)
+		})))
+
+		mux.Handle("/api/reports/mileage", withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			reportHandler.Mileage(w, r)
+		})))
+		mux.Handle("/api/reports/engine-hours", withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			reportHandler.EngineHours(w, r)
+		})))
+	}
+
+	// Low-data mode of devices and their estimated data usage
+	if deps.DataModeService != nil {
+		dataModeHandler := handler.NewDataModeHandler(deps.DataModeService)
+
+		mux.Handle("/api/devices/data-mode", withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet:
+				dataModeHandler.Get(w, r)
+			case http.MethodPut:
+				dataModeHandler.Set(w, r)
+			default:
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+		})))
+
+		mux.Handle("/api/devices/data-usage", withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			dataModeHandler.Usage(w, r)
+		})))
+	}
+
+	// Measured traffic of devices by SIM
+	if deps.TrafficService != nil {
+		trafficHandler := handler.NewTrafficHandler(deps.TrafficService)
+
+		mux.Handle("/api/devices/data-traffic", withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			trafficHandler.SIMUsage(w, r)
+		})))
+	}
+
+	// Fuel level series of devices
+	if deps.FuelService != nil {
+		fuelHandler := handler.NewFuelHandler(deps.FuelService)
+
+		mux.Handle("/api/devices/fuel", withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			fuelHandler.Readings(w, r)
+		})))
+	}
+
+	// Maintenance schedules of devices
+	if deps.MaintenanceService != nil {
+		maintenanceHandler := handler.NewMaintenanceHandler(deps.MaintenanceService)
+
+		mux.Handle("/api/maintenance", withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet:
+				maintenanceHandler.List(w, r)
+			case http.MethodPost:
+				maintenanceHandler.Create(w, r)
+			case http.MethodPut:
+				maintenanceHandler.Update(w, r)
+			default:
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+		})))
+
+		mux.Handle("/api/maintenance/delete", withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			maintenanceHandler.Delete(w, r)
+		})))
+	}
+
+	// Attribute script administration, when scripting is enabled
+	if deps.ScriptService != nil {
+		scriptHandler := handler.NewScriptHandler(deps.ScriptService)
+
+		mux.Handle("/api/admin/scripts", withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodPost:
+				scriptHandler.Create(w, r)
+			case http.MethodOptions:
+				w.WriteHeader(http.StatusOK)
+			default:
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+		})))
+
+		mux.Handle("/api/admin/scripts/list", withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			scriptHandler.List(w, r)
+		})))
+
+		mux.Handle("/api/admin/scripts/get", withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			scriptHandler.Get(w, r)
+		})))
+
+		mux.Handle("/api/admin/scripts/update", withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPut {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			scriptHandler.Update(w, r)
+		})))
+
+		mux.Handle("/api/admin/scripts/delete", withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodDelete {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			scriptHandler.Delete(w, r)
+		})))
+	}
+
+	// Configuration export and import for migrations between instances
+	if deps.BundleService != nil {
+		bundleHandler := handler.NewBundleHandler(deps.BundleService)
+
+		mux.Handle("/api/admin/export", withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			bundleHandler.Export(w, r)
+		})))
+
+		mux.Handle("/api/admin/import", withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			bundleHandler.Import(w, r)
+		})))
+	}
+
+	// Ingest throughput benchmarks
+	if deps.BenchmarkService != nil {
+		benchmarkHandler := handler.NewBenchmarkHandler(deps.BenchmarkService)
+
+		mux.Handle("/api/admin/benchmark", withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			benchmarkHandler.Run(w, r)
+		})))
+	}
+
+	// Reconciliation of received and stored positions
+	if deps.Watchdog != nil {
+		watchdogHandler := handler.NewWatchdogHandler(deps.Watchdog)
+
+		mux.Handle("/api/admin/watchdog", withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			watchdogHandler.GetReport(w, r)
+		})))
+	}
+
+	// Rotation of the master key sensitive device fields are sealed under
+	if deps.Encryption != nil {
+		encryptionHandler := handler.NewEncryptionHandler(deps.Encryption)
+
+		mux.Handle("/api/admin/encryption/rotate", withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			encryptionHandler.Rotate(w, r)
+		})))
+	}
+
+	// Runtime log levels, overridden per module or device for a while
+	if deps.LogLevels != nil {
+		logLevelHandler := handler.NewLogLevelHandler(deps.LogLevels)
+
+		mux.Handle("/api/admin/log-levels", withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet:
+				logLevelHandler.List(w, r)
+			case http.MethodPost:
+				logLevelHandler.Set(w, r)
+			default:
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+		})))
+
+		mux.Handle("/api/admin/log-levels/reset", withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			logLevelHandler.Reset(w, r)
+		})))
+	}
+
+	// Client certificates devices connect over mutual TLS with
+	if deps.CertificateService != nil {
+		certificateHandler := handler.NewDeviceCertificateHandler(deps.CertificateService)
+
+		mux.Handle("/api/admin/device-certificates", withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet:
+				certificateHandler.List(w, r)
+			case http.MethodPost:
+				certificateHandler.Issue(w, r)
+			default:
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+		})))
+
+		mux.Handle("/api/admin/device-certificates/revoke", withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			certificateHandler.Revoke(w, r)
+		})))
+	}
+
+	if deps.Metrics != nil {
+		return middleware.MetricsMiddleware(deps.Metrics, mux)
+	}
 	return mux
-}
\ No newline at end of file
+}
@@ -4,18 +4,24 @@ import (
 	"context"
 	"errors"
 	"net/http"
+	"tracking/internal/core/locale"
+	"tracking/internal/core/model"
 )
 
 type UserClaims struct {
-	UserID         string `json:"sub"`
-	Email          string `json:"email"`
-	Role           string `json:"role"`
-	OrganizationID string `json:"organization_id,omitempty"`
+	UserID           string `json:"sub"`
+	Email            string `json:"email"`
+	Role             string `json:"role"`
+	OrganizationID   string `json:"organization_id,omitempty"`   // The organization the user is working in, if any
+	OrganizationRole string `json:"organization_role,omitempty"` // The user's role in that organization
 }
 
 type contextKey string
 
-const userClaimsKey contextKey = "userClaims"
+const (
+	userClaimsKey contextKey = "userClaims"
+	deviceKey     contextKey = "device"
+)
 
 // WithUserClaims adds UserClaims to the context
 func WithUserClaims(ctx context.Context, claims *UserClaims) context.Context {
@@ -31,6 +37,20 @@ func GetUserClaims(r *http.Request) (*UserClaims, error) {
 	return claims, nil
 }
 
+// WithDevice adds the authenticated device to the context
+func WithDevice(ctx context.Context, device *model.Device) context.Context {
+	return context.WithValue(ctx, deviceKey, device)
+}
+
+// GetDevice extracts the authenticated device from the context
+func GetDevice(r *http.Request) (*model.Device, error) {
+	device, ok := r.Context().Value(deviceKey).(*model.Device)
+	if !ok {
+		return nil, errors.New("no device found in context")
+	}
+	return device, nil
+}
+
 // IsAdmin checks if the user has admin role
 func IsAdmin(role string) bool {
 	return role == "admin"
@@ -41,16 +61,19 @@ func IsOrganizationAdmin(role string) bool {
 	return role == "organization_admin"
 }
 
-// CanAccessOrganization checks if user has access to an organization
-func CanAccessOrganization(userRole string, userOrgID, targetOrgID string) bool {
-	if IsAdmin(userRole) {
-		return true
-	}
+// CanAccessOrganization checks if a user may act on an organization, given
+// their membership of it (nil when they are not a member)
+func CanAccessOrganization(userRole string, member *model.OrganizationMember) bool {
+	return IsAdmin(userRole) || member != nil
+}
 
-	if userOrgID == "" || targetOrgID == "" {
-		return false
+// Error replies with a message translated to the request's locale: the one
+// resolved by the locale middleware, or else the Accept-Language header
+func Error(w http.ResponseWriter, r *http.Request, key string, code int) {
+	tag, ok := locale.Lookup(r.Context())
+	if !ok {
+		tag = locale.Negotiate(r.Header.Get("Accept-Language"))
 	}
-
-	return userOrgID == targetOrgID &&
-		(IsOrganizationAdmin(userRole) || userRole == "organization_member")
-}
\ No newline at end of file
+	w.Header().Set("Content-Language", tag)
+	http.Error(w, locale.Message(tag, key), code)
+}
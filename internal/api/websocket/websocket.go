@@ -0,0 +1,312 @@
+// Package websocket implements the server side of RFC 6455, enough to push
+// JSON to browsers: text frames out, control frames and closing in. Dial
+// opens the client side, for command-line tools following the server.
+package websocket
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// handshakeGUID is appended to the client key to derive the accept key
+const handshakeGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// Frame opcodes
+const (
+	opText  = 0x1
+	opClose = 0x8
+	opPing  = 0x9
+	opPong  = 0xA
+)
+
+// maxFrameSize bounds frames read from clients, which only send control
+// frames and short messages
+const maxFrameSize = 64 * 1024
+
+// writeTimeout bounds how long a slow client may hold a write
+const writeTimeout = 10 * time.Second
+
+// dialTimeout bounds connecting and the handshake of Dial
+const dialTimeout = 10 * time.Second
+
+// ErrClosed is returned by ReadMessage once the client closed the connection
+var ErrClosed = errors.New("websocket closed")
+
+// IsUpgrade reports whether a request asks for a WebSocket
+func IsUpgrade(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get("Upgrade"), "websocket") &&
+		headerContains(r.Header, "Connection", "upgrade")
+}
+
+func headerContains(header http.Header, name, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Conn is an upgraded connection. Writes may come from several goroutines;
+// reads from one.
+type Conn struct {
+	conn       net.Conn
+	reader     *bufio.Reader
+	client     bool // Dialed rather than upgraded, so frames sent are masked
+	writeMutex sync.Mutex
+}
+
+// Upgrade answers the handshake and takes over the connection. On failure
+// it has already replied with an error.
+func Upgrade(w http.ResponseWriter, r *http.Request) (*Conn, error) {
+	if r.Method != http.MethodGet || !IsUpgrade(r) {
+		http.Error(w, "WebSocket upgrade required", http.StatusUpgradeRequired)
+		return nil, errors.New("not a websocket upgrade")
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" || r.Header.Get("Sec-WebSocket-Version") != "13" {
+		http.Error(w, "Unsupported WebSocket version", http.StatusBadRequest)
+		return nil, errors.New("missing key or unsupported version")
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "WebSocket not supported", http.StatusInternalServerError)
+		return nil, errors.New("response does not support hijacking")
+	}
+
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	response := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + acceptKey(key) + "\r\n\r\n"
+	if _, err := conn.Write([]byte(response)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &Conn{conn: conn, reader: rw.Reader}, nil
+}
+
+// Dial opens a WebSocket to a ws or wss URL, sending header with the
+// handshake
+func Dial(rawURL string, header http.Header) (*Conn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	dialer := &net.Dialer{Timeout: dialTimeout}
+	var conn net.Conn
+	switch u.Scheme {
+	case "ws":
+		conn, err = dialer.Dial("tcp", hostPort(u, "80"))
+	case "wss":
+		conn, err = tls.DialWithDialer(dialer, "tcp", hostPort(u, "443"), &tls.Config{ServerName: u.Hostname()})
+	default:
+		return nil, fmt.Errorf("unsupported websocket scheme %q", u.Scheme)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+	key := base64.StdEncoding.EncodeToString(nonce)
+	req, err := http.NewRequest(http.MethodGet, "http://"+u.Host+u.RequestURI(), nil)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	req.Header.Set("Sec-WebSocket-Version", "13")
+
+	conn.SetDeadline(time.Now().Add(dialTimeout))
+	reader := bufio.NewReader(conn)
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		conn.Close()
+		return nil, fmt.Errorf("websocket handshake refused: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	if resp.Header.Get("Sec-WebSocket-Accept") != acceptKey(key) {
+		conn.Close()
+		return nil, errors.New("websocket handshake answered with the wrong key")
+	}
+	conn.SetDeadline(time.Time{})
+	return &Conn{conn: conn, reader: reader, client: true}, nil
+}
+
+func hostPort(u *url.URL, defaultPort string) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+	return net.JoinHostPort(u.Hostname(), defaultPort)
+}
+
+// acceptKey derives the key a server answers the handshake key with
+func acceptKey(key string) string {
+	digest := sha1.Sum([]byte(key + handshakeGUID))
+	return base64.StdEncoding.EncodeToString(digest[:])
+}
+
+// WriteJSON sends v as a text frame
+func (c *Conn) WriteJSON(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.writeFrame(opText, data)
+}
+
+// writeFrame sends one unfragmented frame, unmasked as servers must and
+// masked as clients must
+func (c *Conn) writeFrame(opcode byte, payload []byte) error {
+	var masked byte
+	if c.client {
+		masked = 0x80
+	}
+	header := []byte{0x80 | opcode}
+	switch n := len(payload); {
+	case n < 126:
+		header = append(header, masked|byte(n))
+	case n <= 0xFFFF:
+		header = append(header, masked|126)
+		header = binary.BigEndian.AppendUint16(header, uint16(n))
+	default:
+		header = append(header, masked|127)
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+	if c.client {
+		mask := make([]byte, 4)
+		rand.Read(mask)
+		header = append(header, mask...)
+		masked := make([]byte, len(payload))
+		for i, b := range payload {
+			masked[i] = b ^ mask[i%4]
+		}
+		payload = masked
+	}
+
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if _, err := c.conn.Write(append(header, payload...)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ReadMessage returns the next text or binary message, answering pings on
+// the way. It returns ErrClosed once the other side closed the connection.
+func (c *Conn) ReadMessage() ([]byte, error) {
+	for {
+		opcode, payload, err := c.readFrame()
+		if err != nil {
+			return nil, err
+		}
+		switch opcode {
+		case opClose:
+			c.writeFrame(opClose, nil)
+			return nil, ErrClosed
+		case opPing:
+			if err := c.writeFrame(opPong, payload); err != nil {
+				return nil, err
+			}
+		case opPong:
+		default:
+			return payload, nil
+		}
+	}
+}
+
+// readFrame reads one frame. Fragmented messages are not supported as
+// nothing sent to the server needs them.
+func (c *Conn) readFrame() (byte, []byte, error) {
+	var head [2]byte
+	if _, err := io.ReadFull(c.reader, head[:]); err != nil {
+		return 0, nil, err
+	}
+	if head[0]&0x80 == 0 {
+		return 0, nil, errors.New("fragmented frames are not supported")
+	}
+	masked := head[1]&0x80 != 0
+	if !masked && !c.client {
+		return 0, nil, errors.New("client frame is not masked")
+	}
+	if masked && c.client {
+		return 0, nil, errors.New("server frame is masked")
+	}
+	opcode := head[0] & 0x0F
+
+	length := uint64(head[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.reader, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.reader, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if length > maxFrameSize {
+		return 0, nil, fmt.Errorf("frame of %d bytes exceeds %d", length, maxFrameSize)
+	}
+
+	var mask [4]byte
+	if masked {
+		if _, err := io.ReadFull(c.reader, mask[:]); err != nil {
+			return 0, nil, err
+		}
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		return 0, nil, err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return opcode, payload, nil
+}
+
+// Close sends a close frame and closes the connection
+func (c *Conn) Close() error {
+	c.writeFrame(opClose, nil)
+	return c.conn.Close()
+}
@@ -0,0 +1,987 @@
+// Package app wires every subsystem of the tracking server together
+package app
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"tracking/internal/api/router"
+	"tracking/internal/config"
+	"tracking/internal/core/alarm"
+	"tracking/internal/core/changelog"
+	"tracking/internal/core/dedup"
+	"tracking/internal/core/devicecert"
+	"tracking/internal/core/email"
+	"tracking/internal/core/encryption"
+	"tracking/internal/core/fuel"
+	"tracking/internal/core/gateway"
+	"tracking/internal/core/geocode"
+	"tracking/internal/core/hierarchy"
+	"tracking/internal/core/history"
+	"tracking/internal/core/hook"
+	"tracking/internal/core/job"
+	"tracking/internal/core/lifecycle"
+	"tracking/internal/core/logging"
+	"tracking/internal/core/media"
+	"tracking/internal/core/metrics"
+	"tracking/internal/core/model"
+	"tracking/internal/core/profile"
+	"tracking/internal/core/projection"
+	"tracking/internal/core/push"
+	"tracking/internal/core/repository"
+	"tracking/internal/core/sanity"
+	"tracking/internal/core/service"
+	"tracking/internal/core/speedlimit"
+	"tracking/internal/core/tiles"
+	"tracking/internal/core/util"
+	"tracking/internal/core/watchdog"
+	"tracking/internal/core/weather"
+	"tracking/internal/core/webhook"
+	"tracking/internal/protocol/gt06"
+	"tracking/internal/protocol/owntracks"
+	"tracking/internal/protocol/registry"
+	"tracking/internal/protocol/server"
+)
+
+// Repositories groups the storage backends shared by the services
+type Repositories struct {
+	Devices             repository.DeviceRepository
+	Positions           repository.PositionRepository
+	Users               repository.UserRepository
+	Organizations       repository.OrganizationRepository
+	OrganizationMembers repository.OrganizationMemberRepository
+	Scripts             repository.ScriptRepository
+	Registrations       repository.DeviceRegistrationRepository
+	Messages            repository.MessageRepository
+	DeviceEvents        repository.DeviceEventRepository
+	Media               repository.MediaRepository
+	Events              repository.EventRepository             // Optional; nil leaves events unstored
+	Changes             repository.ChangeRepository            // Optional; nil leaves out sync
+	Snoozes             repository.SnoozeRepository            // Optional; nil leaves out alert snoozing
+	SavedFilters        repository.SavedFilterRepository       // Optional; nil leaves out saved device filters
+	Commands            repository.CommandRepository           // Optional; nil leaves out the command queue
+	DeviceStats         repository.DeviceStatsRepository       // Optional; nil leaves out dashboard widgets
+	Geofences           repository.GeofenceRepository          // Optional; nil leaves out geofences
+	Notes               repository.NoteRepository              // Optional; nil leaves out position notes
+	ComputedAttributes  repository.ComputedAttributeRepository // Optional; nil leaves out computed attributes
+	Accumulators        repository.AccumulatorRepository       // Optional; nil leaves out odometer and engine hours
+	Maintenances        repository.MaintenanceRepository       // Optional; nil leaves out maintenance schedules
+	Fuel                repository.FuelRepository              // Optional; nil leaves out fuel level series
+	DataModes           repository.DataModeRepository          // Optional; nil leaves out low-data mode
+	DataTraffic         repository.DataTrafficRepository       // Optional; nil leaves out traffic accounting
+	Webhooks            repository.WebhookRepository           // Optional; nil leaves out user webhooks
+	Notifications       repository.NotificationRepository      // Optional; nil leaves out email notifications
+	PushTokens          repository.PushTokenRepository         // Optional; nil leaves out push notifications
+	DeviceCertificates  repository.DeviceCertificateRepository // Optional; nil leaves out device TLS
+	DataKeys            repository.DataKeyRepository           // Optional; nil leaves out encryption at rest
+}
+
+// Services groups the business services exposed over HTTP and TCP
+type Services struct {
+	Devices       service.DeviceService
+	Organizations service.OrganizationService
+	Positions     service.PositionService
+	Users         service.UserService
+	Scripts       service.ScriptService // Nil unless scripting is enabled
+	Registrations service.RegistrationService
+	Bundles       service.BundleService
+	Messages      service.MessageService
+	History       service.HistoryService // Nil unless event sourcing is enabled
+	Media         service.MediaService   // Nil without a media repository
+	TrackImports  service.TrackImportService
+	Sync          service.SyncService              // Nil without a change repository
+	Events        service.EventService             // Nil without an event repository
+	Alerts        service.AlertService             // Nil without event and snooze repositories
+	Filters       service.FilterService            // Nil without a saved filter repository
+	Commands      service.CommandService           // Nil without a command repository
+	Dashboard     service.DashboardService         // Nil without a device stats repository
+	Geofences     service.GeofenceService          // Nil without a geofence repository
+	Notes         service.NoteService              // Nil without a note repository
+	Attributes    service.ComputedAttributeService // Nil without a computed attribute repository
+	Accumulators  service.AccumulatorService       // Nil without an accumulator repository
+	Maintenances  service.MaintenanceService       // Nil without maintenance and accumulator repositories
+	Fuel          service.FuelService              // Nil without a fuel repository
+	DataModes     service.DataModeService          // Nil without data mode and command repositories
+	Traffic       service.TrafficService           // Nil without a data traffic repository
+	Webhooks      service.WebhookService           // Nil without a webhook repository
+	Notifications service.NotificationService      // Nil without a notification repository
+	Push          service.PushService              // Nil without a push token repository
+	Benchmark     service.BenchmarkService
+	Live          service.LiveService
+	Reports       service.ReportService
+	Certificates  service.DeviceCertificateService // Nil unless device TLS is enabled
+}
+
+// Module is a subsystem started after, and stopped before, the core servers
+type Module interface {
+	Start(app *App) error
+	Stop()
+}
+
+// Option customises how an App is assembled
+type Option func(*App)
+
+// WithClock replaces the system clock, mainly for tests
+func WithClock(clock util.Clock) Option {
+	return func(a *App) {
+		a.Clock = clock
+	}
+}
+
+// WithRepositories supplies repositories instead of choosing them from config
+func WithRepositories(repos Repositories) Option {
+	return func(a *App) {
+		a.Repositories = repos
+	}
+}
+
+// WithCatalog replaces the built-in device model catalog
+func WithCatalog(catalog *profile.Catalog) Option {
+	return func(a *App) {
+		a.Catalog = catalog
+	}
+}
+
+// WithSpeedLimitProvider supplies the road speed limit source instead of
+// the Overpass endpoint from config
+func WithSpeedLimitProvider(provider speedlimit.Provider) Option {
+	return func(a *App) {
+		a.speedLimitProvider = provider
+	}
+}
+
+// WithMediaStore supplies the media content store instead of the one
+// from config
+func WithMediaStore(store media.Store) Option {
+	return func(a *App) {
+		a.mediaStore = store
+	}
+}
+
+// WithModule registers an additional subsystem
+func WithModule(module Module) Option {
+	return func(a *App) {
+		a.modules = append(a.modules, module)
+	}
+}
+
+// App owns the constructed object graph and its lifecycle
+type App struct {
+	Config          *config.Config
+	Clock           util.Clock
+	Hooks           *hook.Registry
+	Metrics         *metrics.Recorder
+	Watchdog        *watchdog.Watchdog
+	LogLevels       *logging.Levels
+	Catalog         *profile.Catalog
+	Jobs            *job.Manager
+	Repositories    Repositories
+	Services        Services
+	Handler         http.Handler
+	Sessions        *server.SessionManager
+	TCPServer       *server.TCPServer
+	UDPServer       *server.UDPServer        // Nil when the UDP listener is disabled
+	OwnTracks       *owntracks.Subscriber    // Nil unless an MQTT broker is configured
+	Webhooks        *webhook.Sender          // Nil without lifecycle webhook URLs
+	Notifier        *webhook.Dispatcher      // Nil without a webhook repository
+	Mailer          *email.Notifier          // Nil without an SMTP server or notification repository
+	Pusher          *push.Notifier           // Nil without FCM credentials or a push token repository
+	Encryption      *encryption.Devices      // Nil unless encryption at rest is configured
+	ReverseGeocoder *geocode.ReverseGeocoder // Nil unless a reverse geocoding provider is configured
+
+	speedLimitProvider speedlimit.Provider
+	mediaStore         media.Store
+
+	httpServer *http.Server
+	listener   net.Listener
+	serving    atomic.Bool // Whether the HTTP server is accepting requests
+	modules    []Module
+	started    []Module
+}
+
+// New constructs every subsystem without starting any listeners
+func New(cfg *config.Config, opts ...Option) (*App, error) {
+	a := &App{
+		Config:  cfg,
+		Clock:   util.SystemClock,
+		Hooks:   hook.NewRegistry(),
+		Catalog: profile.Default(),
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	// Plugins register their protocols before the servers pick them up
+	if cfg.PluginDir != "" {
+		opened, err := registry.LoadDir(cfg.PluginDir)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Loaded %d protocol plugins from %s", opened, cfg.PluginDir)
+	}
+
+	if a.Repositories.Devices == nil {
+		repos, err := newRepositories(cfg)
+		if err != nil {
+			return nil, err
+		}
+		a.Repositories = repos
+	}
+	if err := a.Repositories.validate(); err != nil {
+		return nil, err
+	}
+	// Sensitive fields are sealed beneath every other layer, so nothing
+	// stores them in plaintext
+	if cfg.EncryptionKeys != "" {
+		if a.Repositories.DataKeys == nil {
+			return nil, errors.New("encryption at rest needs a data key repository")
+		}
+		provider, err := encryption.ParseKeys(cfg.EncryptionKeys)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Encryption at rest enabled - sealing device secrets with master key %s", provider.CurrentKeyID())
+		a.Encryption = encryption.NewDevices(a.Repositories.Devices, encryption.NewKeyring(provider, a.Repositories.DataKeys, a.Clock))
+		a.Repositories.Devices = a.Encryption
+	}
+	// A gateway forwards what devices send and keeps nothing, so it runs
+	// on the required repositories alone
+	if cfg.GatewayURL != "" {
+		a.newGateway()
+	}
+	// Every component stores devices through the recorder, so no change
+	// escapes the history
+	if cfg.EventSourcing {
+		if a.Repositories.DeviceEvents == nil {
+			return nil, errors.New("event sourcing needs a device event repository")
+		}
+		log.Println("Event sourcing enabled - recording device history")
+		a.Repositories.Devices = history.NewRecorder(a.Repositories.Devices, a.Repositories.DeviceEvents, a.Clock)
+	}
+
+	// Likewise every write reaches the change journal that apps sync from
+	if a.Repositories.Changes != nil {
+		journal := changelog.NewJournal(a.Repositories.Changes, a.Clock)
+		a.Repositories.Devices = journal.Devices(a.Repositories.Devices)
+		a.Repositories.Positions = journal.Positions(a.Repositories.Positions)
+		if a.Repositories.Events != nil {
+			a.Repositories.Events = journal.Events(a.Repositories.Events)
+		}
+	}
+
+	// And every device created, deleted or transferred raises its event
+	if cfg.LifecycleEvents {
+		a.Repositories.Devices = lifecycle.NewDevices(a.Repositories.Devices, a.Hooks, a.Clock)
+	}
+
+	// Members of an organization reach every organization below it
+	a.Repositories.OrganizationMembers = hierarchy.NewMembers(a.Repositories.OrganizationMembers, a.Repositories.Organizations)
+
+	repos := a.Repositories
+	a.Jobs = job.NewManager(a.Clock)
+	a.Sessions = server.NewSessionManager(a.Clock, cfg.DeviceOnlineTimeout)
+	a.Services = Services{
+		Devices:       service.NewDeviceService(repos.Devices, repos.OrganizationMembers, a.Catalog, a.Sessions, a.Clock),
+		Organizations: service.NewOrganizationService(repos.Organizations, repos.OrganizationMembers, repos.Devices, a.Clock),
+		Users:         service.NewUserService(repos.Users),
+		Registrations: service.NewRegistrationService(repos.Registrations, repos.Devices, a.Clock),
+		Bundles:       service.NewBundleService(repos.Organizations, repos.OrganizationMembers, repos.Devices, repos.Scripts, a.Clock),
+		TrackImports:  service.NewTrackImportService(repos.Positions, repos.Devices, a.Jobs, a.Clock, a.Hooks),
+		Live:          service.NewLiveService(repos.Devices, repos.OrganizationMembers, a.Hooks),
+		Reports:       service.NewReportService(repos.Positions, repos.Devices, repos.OrganizationMembers),
+	}
+	// Events carry the IDs other systems know their device by
+	a.Hooks.RegisterEventHook(a.Services.Devices.StampExternalIDs)
+	if repos.Events != nil {
+		a.Services.Events = service.NewEventService(repos.Events, repos.Devices, repos.OrganizationMembers)
+	}
+	if repos.Events != nil && repos.Snoozes != nil {
+		a.Services.Alerts = service.NewAlertService(repos.Events, repos.Snoozes, repos.Devices, repos.OrganizationMembers, a.Clock)
+		a.Hooks.RegisterEventHook(a.Services.Alerts.MarkSnoozed)
+	}
+	if repos.SavedFilters != nil {
+		a.Services.Filters = service.NewFilterService(repos.SavedFilters, a.Clock)
+	}
+	if repos.Notes != nil {
+		a.Services.Notes = service.NewNoteService(repos.Notes, repos.Devices, repos.Positions, repos.OrganizationMembers, a.Clock)
+	}
+	if repos.DeviceStats != nil {
+		a.Services.Dashboard = service.NewDashboardService(repos.DeviceStats, repos.Devices, repos.OrganizationMembers, a.Clock)
+		a.Hooks.RegisterPositionHook(hook.StageStored, a.Services.Dashboard.RecordPosition)
+	}
+	if repos.DataTraffic != nil {
+		a.Services.Traffic = service.NewTrafficService(repos.DataTraffic, repos.Devices, repos.OrganizationMembers, a.Clock)
+	}
+	if repos.Changes != nil {
+		a.Services.Sync = service.NewSyncService(repos.Changes, repos.Devices, repos.Positions, repos.Events, repos.OrganizationMembers)
+	}
+	if cfg.EventSourcing {
+		a.Services.History = service.NewHistoryService(repos.DeviceEvents, repos.OrganizationMembers)
+	}
+	// Resent positions are dropped before any other hook sees them
+	if cfg.DedupCacheSize > 0 {
+		var store dedup.Store = dedup.NewLRU(cfg.DedupCacheSize)
+		if cfg.RedisActive && cfg.RedisURL != "" {
+			store = dedup.NewRedisStore(cfg.DedupTTL)
+		}
+		filter := dedup.NewFilter(store)
+		a.Hooks.RegisterPositionHook(hook.StageDecoded, filter.Check)
+		a.Hooks.RegisterPositionHook(hook.StageStored, filter.Remember)
+	}
+	// Profile defaults run first so scripts see the standard attribute names
+	a.Hooks.RegisterPositionHook(hook.StageDecoded, a.Catalog.PositionHook(repos.Devices))
+	// Implausible fixes are caught before anything reacts to them
+	if cfg.PositionFilterMode != "" {
+		filter, err := sanity.NewFilter(cfg.PositionFilterMode, sanity.Limits{
+			MaxSpeed:      cfg.PositionFilterMaxSpeed,
+			MinSatellites: cfg.PositionFilterMinSatellites,
+			MaxHDOP:       cfg.PositionFilterMaxHDOP,
+		}, repos.Positions)
+		if err != nil {
+			return nil, err
+		}
+		a.Hooks.RegisterPositionHook(hook.StageDecoded, filter.Check)
+		a.Hooks.RegisterPositionHook(hook.StageStored, filter.Record)
+	}
+	if cfg.ScriptingEnabled {
+		a.Services.Scripts = service.NewScriptService(repos.Scripts, repos.Devices, a.Clock)
+		a.Hooks.RegisterPositionHook(hook.StageDecoded, a.Services.Scripts.ApplyScripts)
+	}
+	// Computed attributes build on what the scripts derived
+	if repos.ComputedAttributes != nil {
+		a.Services.Attributes = service.NewComputedAttributeService(repos.ComputedAttributes, repos.Devices, repos.Positions, repos.OrganizationMembers, a.Clock)
+		a.Hooks.RegisterPositionHook(hook.StageDecoded, a.Services.Attributes.ApplyAttributes)
+	}
+	// Engine time is counted from the ignition state they settle on
+	if repos.Accumulators != nil {
+		a.Services.Accumulators = service.NewAccumulatorService(repos.Accumulators, repos.Devices, repos.Positions, repos.OrganizationMembers, a.Clock)
+		a.Hooks.RegisterPositionHook(hook.StageDecoded, a.Services.Accumulators.StampPosition)
+		a.Hooks.RegisterPositionHook(hook.StageStored, a.Services.Accumulators.RecordPosition)
+	}
+	// Services are due on the totals the accumulators stamp
+	if repos.Maintenances != nil && a.Services.Accumulators != nil {
+		a.Services.Maintenances = service.NewMaintenanceService(repos.Maintenances, repos.Devices, repos.Positions, repos.OrganizationMembers, a.Hooks, a.Clock)
+		a.Hooks.RegisterPositionHook(hook.StageDecoded, a.Services.Maintenances.LoadTotals)
+		a.Hooks.RegisterPositionHook(hook.StageStored, a.Services.Maintenances.CheckServices)
+	}
+	if repos.Geofences != nil {
+		a.Services.Geofences = service.NewGeofenceService(repos.Geofences, repos.Devices, repos.Positions, a.Hooks, a.Clock)
+		a.Hooks.RegisterPositionHook(hook.StageDecoded, a.Services.Geofences.LocatePosition)
+		a.Hooks.RegisterPositionHook(hook.StageStored, a.Services.Geofences.CheckTransitions)
+	}
+	// Fuel levels are taken from sensors after calibration scripts and
+	// computed attributes had their say
+	a.Hooks.RegisterPositionHook(hook.StageDecoded, fuel.NewNormalizer(cfg.FuelLLSFullScale, cfg.FuelAnalogFullScale).Normalize)
+	if repos.Fuel != nil {
+		a.Services.Fuel = service.NewFuelService(repos.Fuel, repos.Devices, repos.OrganizationMembers, a.Hooks, cfg.FuelDropThreshold)
+		a.Hooks.RegisterPositionHook(hook.StageStored, a.Services.Fuel.RecordPosition)
+	}
+	a.registerOverspeedDetector()
+	a.Hooks.RegisterPositionHook(hook.StageStored, alarm.NewDetector(a.Hooks, cfg.LowBatteryThreshold).Check)
+	if cfg.WeatherURL != "" {
+		enricher := weather.NewEnricher(weather.NewOpenMeteoProvider(cfg.WeatherURL), repos.Positions, a.Clock)
+		a.Hooks.RegisterPositionHook(hook.StageDecoded, enricher.EnrichPosition)
+		a.Hooks.RegisterEventHook(enricher.EnrichEvent)
+	}
+	if cfg.ReverseGeocoder != "" {
+		provider, err := geocode.NewReverseProvider(cfg.ReverseGeocoder, cfg.ReverseGeocodeURL, cfg.ReverseGeocodeKey)
+		if err != nil {
+			return nil, err
+		}
+		rate := cfg.ReverseGeocodeRate
+		if rate <= 0 {
+			rate = geocode.DefaultReverseRate(cfg.ReverseGeocoder)
+		}
+		a.ReverseGeocoder = geocode.NewReverseGeocoder(provider, a.newAddressCache(), repos.Positions, rate)
+		a.Hooks.RegisterPositionHook(hook.StageStored, a.ReverseGeocoder.Resolve)
+	}
+	// SIMs are learned from the ICCID devices report before the projection
+	// may drop it
+	if a.Services.Traffic != nil {
+		a.Hooks.RegisterPositionHook(hook.StageDecoded, a.Services.Traffic.LearnSIM)
+	}
+	// The projection runs last so it sees every attribute added above
+	if p := projection.New(cfg.PositionAttributes, cfg.DroppedPositionAttributes); p.Enabled() {
+		log.Printf("Position attribute projection enabled: keep %v, drop %v", cfg.PositionAttributes, cfg.DroppedPositionAttributes)
+		a.Hooks.RegisterPositionHook(hook.StageDecoded, p.Apply)
+	}
+
+	a.Metrics = metrics.NewRecorder(a.Clock)
+	a.Hooks.OnPosition(func(position *model.Position) {
+		a.Metrics.RecordPositions(1)
+		for _, warning := range position.Warnings {
+			a.Metrics.RecordWarnings(warning.Code)
+		}
+		if !position.ReceivedAt.IsZero() {
+			a.Metrics.ObserveIngest(time.Since(position.ReceivedAt))
+		}
+	})
+	if repos.Events != nil {
+		a.Hooks.OnEvent(func(event *model.Event) {
+			if err := repos.Events.Create(event); err != nil {
+				log.Printf("Failed to store %s event for device %s: %v", event.Type, event.DeviceID, err)
+			}
+		})
+	}
+	if len(cfg.LifecycleWebhookURLs) > 0 {
+		a.Webhooks = webhook.NewSender(cfg.LifecycleWebhookURLs, cfg.LifecycleWebhookSecret, lifecycle.Events)
+		a.Hooks.OnEvent(a.Webhooks.Handle)
+	}
+	if repos.Webhooks != nil {
+		a.Services.Webhooks = service.NewWebhookService(repos.Webhooks, repos.Devices, a.Clock)
+		a.Notifier = webhook.NewDispatcher(a.Services.Webhooks.Targets)
+		a.Hooks.OnEvent(a.Notifier.Handle)
+	}
+	if repos.Notifications != nil {
+		a.Services.Notifications = service.NewNotificationService(repos.Notifications, repos.Users, repos.Devices, repos.OrganizationMembers, a.Clock)
+		if cfg.SMTPHost != "" {
+			templates, err := email.LoadTemplates(cfg.EmailTemplateDir)
+			if err != nil {
+				return nil, err
+			}
+			window := cfg.EmailBatchWindow
+			if window <= 0 {
+				window = time.Minute
+			}
+			mailer := email.NewSMTPMailer(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.SMTPFrom)
+			a.Mailer = email.NewNotifier(a.Services.Notifications.Recipients, mailer, templates, window)
+			a.Hooks.OnEvent(a.Mailer.Handle)
+		}
+	}
+	if repos.PushTokens != nil {
+		a.Services.Push = service.NewPushService(repos.PushTokens, repos.Devices, repos.OrganizationMembers, a.Clock)
+		if cfg.FCMCredentialsFile != "" {
+			sender, err := push.NewFCMSender(cfg.FCMCredentialsFile, cfg.FCMURL, a.Clock)
+			if err != nil {
+				return nil, err
+			}
+			a.Pusher = push.NewNotifier(a.Services.Push.Recipients, a.Services.Push.ForgetToken, sender)
+			a.Hooks.OnEvent(a.Pusher.Handle)
+		}
+	}
+	a.Watchdog = watchdog.New(a.Clock, a.Hooks, watchdog.DefaultWindow, cfg.WatchdogThreshold)
+	if cfg.IngestLatencySLA > 0 {
+		a.Watchdog.SetLatencySLA(cfg.IngestLatencySLA, a.Metrics.IngestLatency)
+	}
+	level := logging.Info
+	if cfg.LogLevel != "" {
+		parsed, err := logging.ParseLevel(cfg.LogLevel)
+		if err != nil {
+			log.Printf("Logging at %s: %v", level, err)
+		}
+		level = parsed
+	}
+	a.LogLevels = logging.New(level, a.Clock)
+
+	a.TCPServer = server.NewTCPServer(cfg.TCPPort, repos.Devices, repos.Positions)
+	a.TCPServer.SetClock(a.Clock)
+	a.TCPServer.SetLogLevels(a.LogLevels)
+	a.TCPServer.SetHooks(a.Hooks)
+	a.TCPServer.SetCatalog(a.Catalog)
+	a.TCPServer.SetSessions(a.Sessions)
+	a.TCPServer.SetTimeouts(cfg.TCPIdleTimeout, cfg.TCPWriteTimeout)
+	a.TCPServer.SetLimits(cfg.TCPMaxConnections, cfg.TCPConnectionsPerMinute, cfg.TCPPacketsPerMinute)
+	if a.Services.Traffic != nil {
+		a.TCPServer.SetTrafficRecorder(a.Services.Traffic)
+	}
+	if cfg.IngestWorkers > 0 {
+		log.Printf("Storing positions on %d ingest workers", cfg.IngestWorkers)
+		a.TCPServer.SetIngestWorkers(cfg.IngestWorkers, cfg.IngestQueueSize, cfg.IngestBatchSize)
+	}
+	a.Services.Positions = service.NewPositionService(repos.Positions, repos.Devices, repos.OrganizationMembers, a.TCPServer, a.Clock, a.Hooks)
+	a.Services.Benchmark = service.NewBenchmarkService(a.TCPServer, repos.Devices)
+	a.Metrics.AddProbe("tcp", a.TCPServer.Listening)
+	if cfg.DeviceTLS && repos.DeviceCertificates != nil {
+		if err := a.newDeviceTLS(); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.UDPPort >= 0 {
+		a.UDPServer = server.NewUDPServer(cfg.UDPPort, repos.Devices, repos.Positions)
+		a.UDPServer.SetClock(a.Clock)
+		a.UDPServer.SetLogLevels(a.LogLevels)
+		a.UDPServer.SetHooks(a.Hooks)
+		a.UDPServer.SetSessions(a.Sessions)
+		a.Metrics.AddProbe("udp", a.UDPServer.Listening)
+	}
+	a.Metrics.AddProbe("http", a.serving.Load)
+	if cfg.GT06XORChecksum {
+		log.Println("GT06 XOR checksum compatibility mode enabled")
+		a.TCPServer.SetGT06ChecksumMode(gt06.ChecksumXOR)
+	}
+
+	// Messages reach drivers, and queued commands devices, through the
+	// device connections
+	a.Services.Messages = service.NewMessageService(repos.Messages, a.TCPServer, a.Clock, a.Hooks)
+	if repos.Commands != nil {
+		a.Services.Commands = service.NewCommandService(repos.Commands, repos.Devices, repos.OrganizationMembers, a.TCPServer, a.Clock, a.Hooks)
+		a.TCPServer.SetCommandQueue(a.Services.Commands)
+	}
+	// Low-data mode reaches devices as configuration commands
+	if repos.DataModes != nil && a.Services.Commands != nil {
+		a.Services.DataModes = service.NewDataModeService(repos.DataModes, repos.Devices, repos.Positions, repos.OrganizationMembers, a.Services.Commands, a.Clock)
+	}
+	if repos.Media != nil {
+		if err := a.newMediaService(); err != nil {
+			return nil, err
+		}
+	}
+
+	var geocoder *geocode.Geocoder
+	if cfg.GeocodeURL != "" {
+		geocoder = geocode.NewGeocoder(geocode.NewNominatimProvider(cfg.GeocodeURL, cfg.GeocodeKey), a.Clock, cfg.GeocodeDailyQuota)
+	}
+	var tileProxy *tiles.Proxy
+	if cfg.TileURL != "" {
+		cache, err := a.newTileCache()
+		if err != nil {
+			return nil, err
+		}
+		tileProxy = tiles.NewProxy(cfg.TileURL, cfg.TileKey, cache, a.Clock, cfg.TileDailyQuota)
+	}
+
+	a.Handler = router.NewRouter(router.Dependencies{
+		DeviceService:       a.Services.Devices,
+		OrganizationService: a.Services.Organizations,
+		PositionService:     a.Services.Positions,
+		UserService:         a.Services.Users,
+		ScriptService:       a.Services.Scripts,
+		RegistrationService: a.Services.Registrations,
+		BundleService:       a.Services.Bundles,
+		BenchmarkService:    a.Services.Benchmark,
+		MessageService:      a.Services.Messages,
+		HistoryService:      a.Services.History,
+		MediaService:        a.Services.Media,
+		TrackImportService:  a.Services.TrackImports,
+		SyncService:         a.Services.Sync,
+		EventService:        a.Services.Events,
+		AlertService:        a.Services.Alerts,
+		FilterService:       a.Services.Filters,
+		CommandService:      a.Services.Commands,
+		DashboardService:    a.Services.Dashboard,
+		GeofenceService:     a.Services.Geofences,
+		NoteService:         a.Services.Notes,
+		AttributeService:    a.Services.Attributes,
+		AccumulatorService:  a.Services.Accumulators,
+		MaintenanceService:  a.Services.Maintenances,
+		FuelService:         a.Services.Fuel,
+		DataModeService:     a.Services.DataModes,
+		TrafficService:      a.Services.Traffic,
+		WebhookService:      a.Services.Webhooks,
+		NotificationService: a.Services.Notifications,
+		PushService:         a.Services.Push,
+		LiveService:         a.Services.Live,
+		ReportService:       a.Services.Reports,
+		CertificateService:  a.Services.Certificates,
+		Geocoder:            geocoder,
+		ReverseGeocoder:     a.ReverseGeocoder,
+		TileProxy:           tileProxy,
+		Encryption:          a.Encryption,
+		BaseURL:             cfg.BaseURL,
+		Clock:               a.Clock,
+		Metrics:             a.Metrics,
+		Watchdog:            a.Watchdog,
+		LogLevels:           a.LogLevels,
+		SMSAuthToken:        cfg.SMSAuthToken,
+	})
+
+	if cfg.OwnTracksMQTTURL != "" {
+		subscriber, err := owntracks.NewSubscriber(cfg.OwnTracksMQTTURL, cfg.OwnTracksMQTTTopic, a.Services.Positions.ProcessOwnTracksMessage)
+		if err != nil {
+			return nil, err
+		}
+		a.OwnTracks = subscriber
+	}
+
+	a.httpServer = &http.Server{
+		Addr:    fmt.Sprintf("%s:%s", cfg.Host, cfg.Port),
+		Handler: a.Handler,
+	}
+
+	return a, nil
+}
+
+// registerOverspeedDetector judges speed against road limits when a
+// provider is available and against device limits otherwise. It runs after
+// scripts so they can correct the decoded speed.
+func (a *App) registerOverspeedDetector() {
+	if a.speedLimitProvider == nil && a.Config.SpeedLimitURL != "" {
+		a.speedLimitProvider = speedlimit.NewOverpassProvider(a.Config.SpeedLimitURL)
+	}
+	var resolver *speedlimit.Resolver
+	if a.speedLimitProvider != nil {
+		resolver = speedlimit.NewResolver(a.speedLimitProvider, a.Clock)
+	}
+
+	detector := speedlimit.NewDetector(resolver, a.Repositories.Devices, a.Hooks, a.Config.OverspeedTolerance)
+	a.Hooks.RegisterPositionHook(hook.StageDecoded, detector.Annotate)
+	a.Hooks.RegisterPositionHook(hook.StageStored, detector.Check)
+}
+
+// newMediaService keeps media in the configured S3 bucket, or in memory
+// when there is none
+func (a *App) newMediaService() error {
+	cfg := a.Config
+	if a.mediaStore == nil && cfg.MediaS3Endpoint != "" {
+		store, err := media.NewS3Store(media.S3Config{
+			Endpoint:  cfg.MediaS3Endpoint,
+			Bucket:    cfg.MediaS3Bucket,
+			Region:    cfg.MediaS3Region,
+			AccessKey: cfg.MediaS3AccessKey,
+			SecretKey: cfg.MediaS3SecretKey,
+			PathStyle: cfg.MediaS3PathStyle,
+		}, a.Clock)
+		if err != nil {
+			return err
+		}
+		log.Printf("Storing media in bucket %s at %s", cfg.MediaS3Bucket, cfg.MediaS3Endpoint)
+		a.mediaStore = store
+	}
+	if a.mediaStore == nil {
+		a.mediaStore = media.NewMemoryStore()
+	}
+
+	key := []byte(cfg.MediaSigningKey)
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return fmt.Errorf("failed to generate media signing key: %v", err)
+		}
+	}
+	ttl := cfg.MediaURLTTL
+	if ttl <= 0 {
+		ttl = time.Hour
+	}
+
+	a.Services.Media = service.NewMediaService(a.Repositories.Media, a.mediaStore, media.NewURLSigner(key), cfg.BaseURL, ttl, a.Clock, a.Hooks)
+	return nil
+}
+
+// newDeviceTLS loads the authority device certificates are issued from,
+// or generates one, and has the TCP server listen for devices presenting
+// them with a server certificate of the same authority
+func (a *App) newDeviceTLS() error {
+	cfg := a.Config
+	var authority *devicecert.Authority
+	if cfg.DeviceCAFile != "" {
+		certPEM, err := os.ReadFile(cfg.DeviceCAFile)
+		if err != nil {
+			return fmt.Errorf("failed to read device CA: %v", err)
+		}
+		keyPEM, err := os.ReadFile(cfg.DeviceCAKeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to read device CA key: %v", err)
+		}
+		if authority, err = devicecert.NewAuthority(certPEM, keyPEM, a.Clock); err != nil {
+			return err
+		}
+	} else {
+		log.Println("Generating a device certificate authority; certificates issued last until a restart")
+		var err error
+		if authority, err = devicecert.GenerateAuthority(a.Clock); err != nil {
+			return fmt.Errorf("failed to generate device CA: %v", err)
+		}
+	}
+
+	hosts := append([]string(nil), cfg.DeviceTLSHosts...)
+	if len(hosts) == 0 {
+		hosts = []string{"localhost", "127.0.0.1"}
+	}
+	if base, err := url.Parse(cfg.BaseURL); err == nil && base.Hostname() != "" {
+		hosts = append(hosts, base.Hostname())
+	}
+	issued, err := authority.IssueServer(hosts)
+	if err != nil {
+		return fmt.Errorf("failed to issue device TLS certificate: %v", err)
+	}
+	serverCert, err := tls.X509KeyPair(issued.CertificatePEM, issued.PrivateKeyPEM)
+	if err != nil {
+		return err
+	}
+
+	a.Services.Certificates = service.NewDeviceCertificateService(a.Repositories.DeviceCertificates, a.Repositories.Devices, authority, a.Clock)
+	a.TCPServer.SetTLS(cfg.DeviceTLSPort, authority.ServerConfig(serverCert, a.Services.Certificates.Revoked))
+	return nil
+}
+
+// newAddressCache keeps reverse geocoded addresses in Redis when it is
+// active, or in memory
+func (a *App) newAddressCache() geocode.AddressCache {
+	if a.Config.RedisActive && a.Config.RedisURL != "" {
+		return geocode.NewRedisAddressCache(geocode.AddressCacheTTL)
+	}
+	return geocode.NewMemoryAddressCache(geocode.AddressCacheTTL, a.Clock)
+}
+
+// newTileCache keeps tiles in the configured directory, or in Redis when
+// it is active, or in memory
+func (a *App) newTileCache() (tiles.Cache, error) {
+	cfg := a.Config
+	ttl := cfg.TileCacheTTL
+	if ttl <= 0 {
+		ttl = 7 * 24 * time.Hour
+	}
+	switch {
+	case cfg.TileCacheDir != "":
+		log.Printf("Caching map tiles in %s", cfg.TileCacheDir)
+		return tiles.NewDiskCache(cfg.TileCacheDir, ttl, a.Clock)
+	case cfg.RedisActive && cfg.RedisURL != "":
+		return tiles.NewRedisCache(ttl), nil
+	default:
+		return tiles.NewMemoryCache(ttl, a.Clock), nil
+	}
+}
+
+// newGateway forwards positions to the configured sink instead of storing
+// them and accepts devices that are not registered. Optional repositories
+// are left out, with the features that would store data locally.
+func (a *App) newGateway() {
+	cfg := a.Config
+	var sink gateway.Sink = gateway.NewWebhookSink(cfg.GatewayURL, cfg.GatewaySecret)
+	if cfg.GatewayKafkaTopic != "" {
+		sink = gateway.NewKafkaSink(cfg.GatewayURL, cfg.GatewayKafkaTopic)
+		log.Printf("Running as a protocol gateway - producing positions to topic %s through %s", cfg.GatewayKafkaTopic, cfg.GatewayURL)
+	} else {
+		log.Printf("Running as a protocol gateway - posting positions to %s", cfg.GatewayURL)
+	}
+
+	repos := a.Repositories
+	devices := gateway.NewDevices(repos.Devices, a.Clock)
+	a.Repositories = Repositories{
+		Devices:             devices,
+		Positions:           gateway.NewPositions(sink, devices),
+		Users:               repos.Users,
+		Organizations:       repos.Organizations,
+		OrganizationMembers: repos.OrganizationMembers,
+		Scripts:             repos.Scripts,
+		Registrations:       repos.Registrations,
+		Messages:            repos.Messages,
+	}
+}
+
+// newRepositories picks in-memory storage in test mode, for a gateway or
+// when MongoDB is unreachable, and MongoDB otherwise
+func newRepositories(cfg *config.Config) (Repositories, error) {
+	if cfg.TestMode {
+		log.Println("Running in test mode - using in-memory repositories")
+		return NewInMemoryRepositories(), nil
+	}
+	if cfg.GatewayURL != "" {
+		return NewInMemoryRepositories(), nil
+	}
+
+	mongoConfig := config.NewMongoConfig()
+	log.Printf("Connecting to MongoDB at: %s", mongoConfig.URI)
+
+	db, err := config.ConnectMongoDB(mongoConfig)
+	if err != nil {
+		log.Printf("Failed to connect to MongoDB: %v - falling back to in-memory storage", err)
+		return NewInMemoryRepositories(), nil
+	}
+
+	log.Printf("Successfully connected to MongoDB database: %s", mongoConfig.Database)
+	return NewMongoRepositories(db), nil
+}
+
+// NewInMemoryRepositories returns a fresh set of in-memory repositories
+func NewInMemoryRepositories() Repositories {
+	return Repositories{
+		Devices:             repository.NewInMemoryDeviceRepository(),
+		Positions:           repository.NewInMemoryPositionRepository(),
+		Users:               repository.NewInMemoryUserRepository(),
+		Organizations:       repository.NewInMemoryOrganizationRepository(),
+		OrganizationMembers: repository.NewInMemoryOrganizationMemberRepository(),
+		Scripts:             repository.NewInMemoryScriptRepository(),
+		Registrations:       repository.NewInMemoryDeviceRegistrationRepository(),
+		Messages:            repository.NewInMemoryMessageRepository(),
+		DeviceEvents:        repository.NewInMemoryDeviceEventRepository(),
+		Media:               repository.NewInMemoryMediaRepository(),
+		Events:              repository.NewInMemoryEventRepository(),
+		Changes:             repository.NewInMemoryChangeRepository(),
+		Snoozes:             repository.NewInMemorySnoozeRepository(),
+		SavedFilters:        repository.NewInMemorySavedFilterRepository(),
+		Commands:            repository.NewInMemoryCommandRepository(),
+		DeviceStats:         repository.NewInMemoryDeviceStatsRepository(),
+		Geofences:           repository.NewInMemoryGeofenceRepository(),
+		Notes:               repository.NewInMemoryNoteRepository(),
+		ComputedAttributes:  repository.NewInMemoryComputedAttributeRepository(),
+		Accumulators:        repository.NewInMemoryAccumulatorRepository(),
+		Maintenances:        repository.NewInMemoryMaintenanceRepository(),
+		Fuel:                repository.NewInMemoryFuelRepository(),
+		DataModes:           repository.NewInMemoryDataModeRepository(),
+		DataTraffic:         repository.NewInMemoryDataTrafficRepository(),
+		Webhooks:            repository.NewInMemoryWebhookRepository(),
+		Notifications:       repository.NewInMemoryNotificationRepository(),
+		PushTokens:          repository.NewInMemoryPushTokenRepository(),
+		DeviceCertificates:  repository.NewInMemoryDeviceCertificateRepository(),
+		DataKeys:            repository.NewInMemoryDataKeyRepository(),
+	}
+}
+
+// NewMongoRepositories returns repositories backed by the given database
+func NewMongoRepositories(db *mongo.Database) Repositories {
+	return Repositories{
+		Devices:             repository.NewMongoDeviceRepository(db),
+		Positions:           repository.NewMongoPositionRepository(db),
+		Users:               repository.NewMongoUserRepository(db),
+		Organizations:       repository.NewMongoOrganizationRepository(db),
+		OrganizationMembers: repository.NewMongoOrganizationMemberRepository(db),
+		Scripts:             repository.NewMongoScriptRepository(db),
+		Registrations:       repository.NewMongoDeviceRegistrationRepository(db),
+		Messages:            repository.NewMongoMessageRepository(db),
+		DeviceEvents:        repository.NewMongoDeviceEventRepository(db),
+		Media:               repository.NewMongoMediaRepository(db),
+		Events:              repository.NewMongoEventRepository(db),
+		Changes:             repository.NewMongoChangeRepository(db),
+		Snoozes:             repository.NewMongoSnoozeRepository(db),
+		SavedFilters:        repository.NewMongoSavedFilterRepository(db),
+		Commands:            repository.NewMongoCommandRepository(db),
+		DeviceStats:         repository.NewMongoDeviceStatsRepository(db),
+		Geofences:           repository.NewMongoGeofenceRepository(db),
+		Notes:               repository.NewMongoNoteRepository(db),
+		ComputedAttributes:  repository.NewMongoComputedAttributeRepository(db),
+		Accumulators:        repository.NewMongoAccumulatorRepository(db),
+		Maintenances:        repository.NewMongoMaintenanceRepository(db),
+		Fuel:                repository.NewMongoFuelRepository(db),
+		DataModes:           repository.NewMongoDataModeRepository(db),
+		DataTraffic:         repository.NewMongoDataTrafficRepository(db),
+		Webhooks:            repository.NewMongoWebhookRepository(db),
+		Notifications:       repository.NewMongoNotificationRepository(db),
+		PushTokens:          repository.NewMongoPushTokenRepository(db),
+		DeviceCertificates:  repository.NewMongoDeviceCertificateRepository(db),
+		DataKeys:            repository.NewMongoDataKeyRepository(db),
+	}
+}
+
+func (r Repositories) validate() error {
+	if r.Devices == nil || r.Positions == nil || r.Users == nil ||
+		r.Organizations == nil || r.OrganizationMembers == nil || r.Scripts == nil ||
+		r.Registrations == nil || r.Messages == nil {
+		return errors.New("incomplete repository set")
+	}
+	return nil
+}
+
+// Start opens the TCP, UDP and HTTP listeners, starts the ingest watchdog,
+// the OwnTracks subscriber, the webhook senders, the mailer and the
+// reverse geocoder, and then every module
+func (a *App) Start() error {
+	if err := a.TCPServer.Start(); err != nil {
+		return err
+	}
+	if a.UDPServer != nil {
+		if err := a.UDPServer.Start(); err != nil {
+			a.TCPServer.Stop()
+			return err
+		}
+	}
+
+	listener, err := net.Listen("tcp", a.httpServer.Addr)
+	if err != nil {
+		a.TCPServer.Stop()
+		if a.UDPServer != nil {
+			a.UDPServer.Stop()
+		}
+		return fmt.Errorf("failed to start HTTP server: %v", err)
+	}
+	a.listener = listener
+
+	a.serving.Store(true)
+	go func() {
+		defer a.serving.Store(false)
+		log.Printf("HTTP server listening on %s", listener.Addr())
+		if err := a.httpServer.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.Printf("HTTP server error: %v", err)
+		}
+	}()
+
+	if a.Config.WatchdogInterval > 0 {
+		a.Watchdog.Start(a.Config.WatchdogInterval)
+	}
+	if a.OwnTracks != nil {
+		a.OwnTracks.Start()
+	}
+	if a.Webhooks != nil {
+		a.Webhooks.Start()
+	}
+	if a.Notifier != nil {
+		a.Notifier.Start()
+	}
+	if a.Mailer != nil {
+		a.Mailer.Start()
+	}
+	if a.Pusher != nil {
+		a.Pusher.Start()
+	}
+	if a.ReverseGeocoder != nil {
+		a.ReverseGeocoder.Start()
+	}
+
+	for _, module := range a.modules {
+		if err := module.Start(a); err != nil {
+			a.Shutdown(context.Background())
+			return err
+		}
+		a.started = append(a.started, module)
+	}
+
+	return nil
+}
+
+// HTTPAddr returns the address the HTTP server is listening on, or nil before Start
+func (a *App) HTTPAddr() net.Addr {
+	if a.listener == nil {
+		return nil
+	}
+	return a.listener.Addr()
+}
+
+// Shutdown stops modules in reverse order, then the OwnTracks subscriber,
+// the webhook senders, the mailer and pusher, the reverse geocoder, the
+// watchdog and the HTTP, TCP and UDP servers
+func (a *App) Shutdown(ctx context.Context) error {
+	for i := len(a.started) - 1; i >= 0; i-- {
+		a.started[i].Stop()
+	}
+	a.started = nil
+	if a.OwnTracks != nil {
+		a.OwnTracks.Stop()
+	}
+	if a.Webhooks != nil {
+		a.Webhooks.Stop()
+	}
+	if a.Notifier != nil {
+		a.Notifier.Stop()
+	}
+	if a.Mailer != nil {
+		a.Mailer.Stop()
+	}
+	if a.Pusher != nil {
+		a.Pusher.Stop()
+	}
+	if a.ReverseGeocoder != nil {
+		a.ReverseGeocoder.Stop()
+	}
+	a.Watchdog.Stop()
+
+	var err error
+	if a.listener != nil {
+		err = a.httpServer.Shutdown(ctx)
+	}
+	a.TCPServer.Stop()
+	if a.UDPServer != nil {
+		a.UDPServer.Stop()
+	}
+	return err
+}
@@ -0,0 +1,6 @@
+//go:build !no_xexun
+
+package app
+
+// The Xexun protocol is compiled in unless built with -tags no_xexun
+import _ "tracking/internal/protocol/xexun"
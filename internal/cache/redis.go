@@ -14,8 +14,21 @@ import (
 var (
 	redisClient *redis.Client
 	enabled     bool
+	debug       func() bool // Nil leaves hits, misses and writes unlogged
 )
 
+// SetDebugSwitch has hits, misses and writes logged whenever the switch is
+// on, so cache behaviour can be watched without a restart
+func SetDebugSwitch(enabled func() bool) {
+	debug = enabled
+}
+
+func logDebug(format string, v ...interface{}) {
+	if debug != nil && debug() {
+		log.Printf("[Cache] "+format, v...)
+	}
+}
+
 // Initialize sets up Redis connection if REDIS_URL is provided
 func Initialize(redisURL string) {
 	// Check if Redis is enabled via environment variable
@@ -80,6 +93,7 @@ func Set(ctx context.Context, key string, value interface{}, expiration time.Dur
 		log.Printf("Error setting cache key %s: %v", key, err)
 		return err
 	}
+	logDebug("Set %s for %s", key, expiration)
 
 	return nil
 }
@@ -94,6 +108,8 @@ func Get(ctx context.Context, key string, dest interface{}) error {
 	if err != nil {
 		if err != redis.Nil {
 			log.Printf("Error getting cache key %s: %v", key, err)
+		} else {
+			logDebug("Miss %s", key)
 		}
 		return err
 	}
@@ -102,6 +118,7 @@ func Get(ctx context.Context, key string, dest interface{}) error {
 		log.Printf("Error unmarshaling data from cache key %s: %v", key, err)
 		return err
 	}
+	logDebug("Hit %s", key)
 
 	return nil
 }
@@ -116,6 +133,7 @@ func Delete(ctx context.Context, key string) error {
 		log.Printf("Error deleting cache key %s: %v", key, err)
 		return err
 	}
+	logDebug("Deleted %s", key)
 
 	return nil
 }
@@ -130,6 +148,7 @@ func BatchDelete(ctx context.Context, keys ...string) error {
 		log.Printf("Error batch deleting cache keys: %v", err)
 		return err
 	}
+	logDebug("Deleted %s", strings.Join(keys, ", "))
 
 	return nil
 }
\ No newline at end of file
@@ -0,0 +1,210 @@
+// Package client calls the REST API of a running server, for dotrackctl and
+// other scripts operating it
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"tracking/internal/api/websocket"
+	"tracking/internal/core/model"
+)
+
+const requestTimeout = 30 * time.Second
+
+// APIError is a request the server refused, with the message it gave
+type APIError struct {
+	Status  int
+	Message string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("server returned %d: %s", e.Status, e.Message)
+}
+
+// Client calls one server with the token of a logged in user
+type Client struct {
+	baseURL string
+	token   string
+	http    *http.Client
+}
+
+// New calls the server at baseURL, such as http://localhost:8000, with the
+// token; an empty token only allows Login
+func New(baseURL, token string) *Client {
+	return &Client{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		token:   token,
+		http:    &http.Client{Timeout: requestTimeout},
+	}
+}
+
+// Token returns the access token requests are sent with
+func (c *Client) Token() string {
+	return c.token
+}
+
+type loginResponse struct {
+	AccessToken string `json:"access_token"`
+}
+
+// Login signs in and sends later requests with the access token it
+// returns
+func (c *Client) Login(email, password string) (string, error) {
+	var resp loginResponse
+	body := map[string]string{"email": email, "password": password}
+	if err := c.do(http.MethodPost, "/api/auth/test-login", nil, body, &resp); err != nil {
+		return "", err
+	}
+	c.token = resp.AccessToken
+	return c.token, nil
+}
+
+// Devices lists the devices of the user
+func (c *Client) Devices() ([]*model.Device, error) {
+	var devices []*model.Device
+	if err := c.do(http.MethodGet, "/api/devices/list", nil, nil, &devices); err != nil {
+		return nil, err
+	}
+	return devices, nil
+}
+
+// CreateDevice registers a device, in the organization when one is given
+func (c *Client) CreateDevice(name, uniqueID, organizationID string) (*model.Device, error) {
+	body := map[string]string{"name": name, "uniqueId": uniqueID, "organizationId": organizationID}
+	var device model.Device
+	if err := c.do(http.MethodPost, "/api/devices", nil, body, &device); err != nil {
+		return nil, err
+	}
+	return &device, nil
+}
+
+// SendCommand queues a command for a device; interval is for setInterval
+// and angle for setCornerReporting
+func (c *Client) SendCommand(deviceID, commandType string, interval, angle int) (*model.Command, error) {
+	body := map[string]interface{}{"type": commandType, "interval": interval, "angle": angle}
+	var command model.Command
+	if err := c.do(http.MethodPost, "/api/devices/commands", url.Values{"deviceId": {deviceID}}, body, &command); err != nil {
+		return nil, err
+	}
+	return &command, nil
+}
+
+// Export writes the configuration bundle of the server to w; it takes an
+// admin
+func (c *Client) Export(w io.Writer) error {
+	resp, err := c.send(http.MethodGet, "/api/admin/export", nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+// liveFrame is an update pushed over the live socket, or the reply to
+// following devices
+type liveFrame struct {
+	model.LiveUpdate
+	Error string `json:"error"`
+}
+
+// Tail follows the positions, events and status changes of the devices and
+// organizations given, or of every device the user can access when none
+// are, handing each update to handle until ctx is done or handle fails
+func (c *Client) Tail(ctx context.Context, deviceIDs, organizationIDs []string, handle func(*model.LiveUpdate) error) error {
+	query := url.Values{"deviceId": deviceIDs, "organizationId": organizationIDs}
+	socketURL := "ws" + strings.TrimPrefix(c.baseURL, "http") + "/api/ws?" + query.Encode()
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+c.token)
+	conn, err := websocket.Dial(socketURL, header)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	for {
+		data, err := conn.ReadMessage()
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var frame liveFrame
+		if err := json.Unmarshal(data, &frame); err != nil {
+			return fmt.Errorf("invalid live update: %v", err)
+		}
+		switch frame.Type {
+		case "subscribed":
+			continue
+		case "error":
+			return fmt.Errorf("following devices failed: %s", frame.Error)
+		}
+		if err := handle(&frame.LiveUpdate); err != nil {
+			return err
+		}
+	}
+}
+
+// do sends in as JSON and decodes the response into out, when given
+func (c *Client) do(method, path string, query url.Values, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	resp, err := c.send(method, path, query, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("invalid response from %s: %v", path, err)
+	}
+	return nil
+}
+
+// send makes a request, returning an *APIError for any status but 2xx
+func (c *Client) send(method, path string, query url.Values, body io.Reader) (*http.Response, error) {
+	target := c.baseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, &APIError{Status: resp.StatusCode, Message: strings.TrimSpace(string(message))}
+	}
+	return resp, nil
+}
@@ -0,0 +1,106 @@
+// Package alarm turns the alarms decoders report and falling battery
+// levels into events.
+package alarm
+
+import (
+	"context"
+	"sync"
+
+	"tracking/internal/core/hook"
+	"tracking/internal/core/model"
+)
+
+// Position attributes the detector reads
+const (
+	AttributeAlarm        = "alarm"        // Alarm name set by decoders, e.g. sos
+	AttributeBatteryLevel = "batteryLevel" // Percent
+	AttributeLowBattery   = "lowBattery"   // Flag set by decoders
+)
+
+// Detector raises an alarm event when a device reports an alarm and a
+// lowBattery event when its battery runs low. Devices repeat an alarm on
+// every position while it lasts, so each is raised once until a position
+// without it arrives; the battery warning likewise rearms once the level
+// recovers. Positions are judged in arrival order.
+type Detector struct {
+	hooks     *hook.Registry
+	threshold float64 // Battery percent below which it is low; zero for decoder flags only
+
+	mutex   sync.Mutex
+	devices map[string]*deviceState // By device ID
+}
+
+type deviceState struct {
+	alarm      string
+	lowBattery bool
+}
+
+func NewDetector(hooks *hook.Registry, threshold float64) *Detector {
+	return &Detector{
+		hooks:     hooks,
+		threshold: threshold,
+		devices:   make(map[string]*deviceState),
+	}
+}
+
+// Check is a StageStored hook raising the events of a position
+func (d *Detector) Check(ctx context.Context, position *model.Position) error {
+	alarm, _ := position.Status[AttributeAlarm].(string)
+	low := d.lowBattery(position, alarm)
+
+	d.mutex.Lock()
+	state := d.devices[position.DeviceID]
+	if state == nil {
+		state = &deviceState{}
+		d.devices[position.DeviceID] = state
+	}
+	raiseAlarm := alarm != "" && alarm != state.alarm
+	raiseLow := low && !state.lowBattery
+	state.alarm = alarm
+	state.lowBattery = low
+	if alarm == "" && !low {
+		delete(d.devices, position.DeviceID)
+	}
+	d.mutex.Unlock()
+
+	if raiseAlarm {
+		event := model.NewEvent(model.EventAlarm, position.DeviceID, position.Timestamp)
+		event.PositionID = position.ID
+		event.Attributes[AttributeAlarm] = alarm
+		d.hooks.Event(event)
+	}
+	if raiseLow {
+		event := model.NewEvent(model.EventLowBattery, position.DeviceID, position.Timestamp)
+		event.PositionID = position.ID
+		if level, ok := batteryLevel(position); ok {
+			event.Attributes[AttributeBatteryLevel] = level
+		}
+		d.hooks.Event(event)
+	}
+	return nil
+}
+
+// lowBattery reports whether the position says the battery is low, by
+// alarm, flag or level
+func (d *Detector) lowBattery(position *model.Position, alarm string) bool {
+	if alarm == model.EventLowBattery {
+		return true
+	}
+	if flag, _ := position.Status[AttributeLowBattery].(bool); flag {
+		return true
+	}
+	level, ok := batteryLevel(position)
+	return ok && d.threshold > 0 && level < d.threshold
+}
+
+// batteryLevel reads the battery percentage, whichever number type the
+// decoder stored it as
+func batteryLevel(position *model.Position) (float64, bool) {
+	switch level := position.Status[AttributeBatteryLevel].(type) {
+	case float64:
+		return level, true
+	case int:
+		return float64(level), true
+	}
+	return 0, false
+}
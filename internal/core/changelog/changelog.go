@@ -0,0 +1,153 @@
+// Package changelog notes every write to devices, positions and events in
+// the change journal, so clients can sync what changed since they last
+// asked instead of downloading everything again
+package changelog
+
+import (
+	"log"
+	"tracking/internal/core/model"
+	"tracking/internal/core/repository"
+	"tracking/internal/core/util"
+)
+
+// Journal appends the changes made through the repositories it wraps
+type Journal struct {
+	changes repository.ChangeRepository
+	clock   util.Clock
+}
+
+func NewJournal(changes repository.ChangeRepository, clock util.Clock) *Journal {
+	return &Journal{
+		changes: changes,
+		clock:   clock,
+	}
+}
+
+// Devices returns a DeviceRepository that journals every change to devices
+func (j *Journal) Devices(devices repository.DeviceRepository) repository.DeviceRepository {
+	return &deviceJournal{DeviceRepository: devices, journal: j}
+}
+
+// Positions returns a PositionRepository that journals stored positions
+func (j *Journal) Positions(positions repository.PositionRepository) repository.PositionRepository {
+	return &positionJournal{PositionRepository: positions, journal: j}
+}
+
+// Events returns an EventRepository that journals stored and updated events
+func (j *Journal) Events(events repository.EventRepository) repository.EventRepository {
+	return &eventJournal{EventRepository: events, journal: j}
+}
+
+func (j *Journal) append(change *model.Change) error {
+	change.Timestamp = j.clock.Now()
+	if err := j.changes.Append(change); err != nil {
+		log.Printf("[Changelog] failed to journal %s %s: %v", change.Kind, change.EntityID, err)
+		return err
+	}
+	return nil
+}
+
+type deviceJournal struct {
+	repository.DeviceRepository
+	journal *Journal
+}
+
+func (d *deviceJournal) Create(device *model.Device) error {
+	if err := d.DeviceRepository.Create(device); err != nil {
+		return err
+	}
+	return d.journal.append(deviceChange(device))
+}
+
+func (d *deviceJournal) Update(device *model.Device) error {
+	if err := d.DeviceRepository.Update(device); err != nil {
+		return err
+	}
+	return d.journal.append(deviceChange(device))
+}
+
+func (d *deviceJournal) Delete(id string) error {
+	device, err := d.DeviceRepository.FindByID(id)
+	if err != nil {
+		return err
+	}
+	if err := d.DeviceRepository.Delete(id); err != nil {
+		return err
+	}
+	if device == nil {
+		return nil
+	}
+	change := deviceChange(device)
+	change.Deleted = true
+	return d.journal.append(change)
+}
+
+func deviceChange(device *model.Device) *model.Change {
+	return &model.Change{
+		Kind:           model.ChangeDevice,
+		EntityID:       device.ID,
+		DeviceID:       device.ID,
+		UserID:         device.UserID,
+		OrganizationID: device.OrganizationID,
+	}
+}
+
+type positionJournal struct {
+	repository.PositionRepository
+	journal *Journal
+}
+
+func (p *positionJournal) Create(position *model.Position) error {
+	if err := p.PositionRepository.Create(position); err != nil {
+		return err
+	}
+	return p.journal.append(positionChange(position))
+}
+
+// CreateBatch journals the positions stored, also when the batch failed
+// partway
+func (p *positionJournal) CreateBatch(positions []*model.Position) error {
+	err := p.PositionRepository.CreateBatch(positions)
+	stored := repository.BatchStored(positions, err)
+	for i, position := range positions[:stored] {
+		if journalErr := p.journal.append(positionChange(position)); journalErr != nil {
+			return &repository.BatchError{Stored: i, Err: journalErr}
+		}
+	}
+	return err
+}
+
+func positionChange(position *model.Position) *model.Change {
+	return &model.Change{
+		Kind:     model.ChangePosition,
+		EntityID: position.ID,
+		DeviceID: position.DeviceID,
+	}
+}
+
+type eventJournal struct {
+	repository.EventRepository
+	journal *Journal
+}
+
+func (e *eventJournal) Create(event *model.Event) error {
+	if err := e.EventRepository.Create(event); err != nil {
+		return err
+	}
+	return e.journal.append(eventChange(event))
+}
+
+func (e *eventJournal) Update(event *model.Event) error {
+	if err := e.EventRepository.Update(event); err != nil {
+		return err
+	}
+	return e.journal.append(eventChange(event))
+}
+
+func eventChange(event *model.Event) *model.Change {
+	return &model.Change{
+		Kind:     model.ChangeEvent,
+		EntityID: event.ID,
+		DeviceID: event.DeviceID,
+	}
+}
@@ -0,0 +1,151 @@
+// Package dedup drops positions a device sends again, as devices do when
+// the acknowledgment of a frame is lost, so they are stored once and
+// reports such as mileage count them once
+package dedup
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"tracking/internal/cache"
+	"tracking/internal/core/model"
+)
+
+// ErrDuplicate rejects a position already stored. Sources acknowledge it
+// like a stored one so the device stops resending.
+var ErrDuplicate = errors.New("duplicate position")
+
+// Store remembers the keys of the positions stored
+type Store interface {
+	Contains(ctx context.Context, key string) (bool, error)
+	Add(ctx context.Context, key string) error
+}
+
+// Filter rejects positions matching one already stored: same device,
+// time, coordinates and decoded status, as a resent frame decodes to.
+// Positions are checked when decoded and remembered once stored, so a
+// position whose write failed is taken when resent.
+type Filter struct {
+	store Store
+
+	mutex sync.Mutex
+	// Keys taken when positions were checked, before later hooks added to
+	// their status
+	pending map[*model.Position]string
+}
+
+// maxPending bounds the keys of positions checked and never stored
+const maxPending = 10000
+
+func NewFilter(store Store) *Filter {
+	return &Filter{
+		store:   store,
+		pending: make(map[*model.Position]string),
+	}
+}
+
+// Check is a StageDecoded hook rejecting duplicates with ErrDuplicate. It
+// runs before hooks that change positions. Positions are let through when
+// the store cannot be reached.
+func (f *Filter) Check(ctx context.Context, position *model.Position) error {
+	key := Key(position)
+	if seen, err := f.store.Contains(ctx, key); err == nil && seen {
+		return ErrDuplicate
+	}
+
+	f.mutex.Lock()
+	if len(f.pending) >= maxPending {
+		f.pending = make(map[*model.Position]string)
+	}
+	f.pending[position] = key
+	f.mutex.Unlock()
+	return nil
+}
+
+// Remember is a StageStored hook recording a stored position
+func (f *Filter) Remember(ctx context.Context, position *model.Position) error {
+	f.mutex.Lock()
+	key, ok := f.pending[position]
+	delete(f.pending, position)
+	f.mutex.Unlock()
+	if !ok {
+		key = Key(position)
+	}
+	return f.store.Add(ctx, key)
+}
+
+// Key identifies a position by its device, time, coordinates and status
+func Key(position *model.Position) string {
+	status := fnv.New64a()
+	// Map keys are marshalled in order, so equal status hashes equally
+	json.NewEncoder(status).Encode(position.Status)
+	return fmt.Sprintf("%s/%d/%.7f/%.7f/%x", position.DeviceID, position.Timestamp.UnixNano(), position.Latitude, position.Longitude, status.Sum64())
+}
+
+// LRU remembers the most recent keys in memory, forgetting the least
+// recently seen beyond its capacity
+type LRU struct {
+	capacity int
+	mutex    sync.Mutex
+	order    *list.List // Of keys, most recent first
+	keys     map[string]*list.Element
+}
+
+func NewLRU(capacity int) *LRU {
+	return &LRU{
+		capacity: capacity,
+		order:    list.New(),
+		keys:     make(map[string]*list.Element),
+	}
+}
+
+func (l *LRU) Contains(ctx context.Context, key string) (bool, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	element, ok := l.keys[key]
+	if ok {
+		l.order.MoveToFront(element)
+	}
+	return ok, nil
+}
+
+func (l *LRU) Add(ctx context.Context, key string) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if element, ok := l.keys[key]; ok {
+		l.order.MoveToFront(element)
+		return nil
+	}
+	l.keys[key] = l.order.PushFront(key)
+	for l.order.Len() > l.capacity {
+		oldest := l.order.Back()
+		l.order.Remove(oldest)
+		delete(l.keys, oldest.Value.(string))
+	}
+	return nil
+}
+
+// RedisStore remembers keys in the shared Redis cache for a while, so
+// every server instance sees the positions the others stored
+type RedisStore struct {
+	ttl time.Duration
+}
+
+func NewRedisStore(ttl time.Duration) *RedisStore {
+	return &RedisStore{ttl: ttl}
+}
+
+func (s *RedisStore) Contains(ctx context.Context, key string) (bool, error) {
+	var seen bool
+	return cache.Get(ctx, "dedup:"+key, &seen) == nil, nil
+}
+
+func (s *RedisStore) Add(ctx context.Context, key string) error {
+	return cache.Set(ctx, "dedup:"+key, true, s.ttl)
+}
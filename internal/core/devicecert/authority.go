@@ -0,0 +1,243 @@
+// Package devicecert issues the client certificates devices authenticate
+// with over mutual TLS, and the server certificate they connect to, from a
+// certificate authority of the server's own
+package devicecert
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"strings"
+	"time"
+	"tracking/internal/core/util"
+)
+
+// Validity of the certificates an authority signs
+const (
+	AuthorityValidity = 10 * 365 * 24 * time.Hour
+	ServerValidity    = 2 * 365 * 24 * time.Hour
+	// clockSkew backdates certificates, so devices whose clock is a little
+	// behind accept them at once
+	clockSkew = 5 * time.Minute
+)
+
+// ErrInvalidAuthority is returned for an authority certificate or key that
+// cannot be read, or that do not belong together
+var ErrInvalidAuthority = errors.New("invalid device certificate authority")
+
+// ErrRevoked rejects a client certificate that was revoked
+var ErrRevoked = errors.New("device certificate revoked")
+
+// Authority signs device and server certificates
+type Authority struct {
+	cert    *x509.Certificate
+	key     crypto.Signer
+	certPEM []byte
+	clock   util.Clock
+}
+
+// Issued is a certificate with the private key that goes with it
+type Issued struct {
+	Serial         string
+	NotBefore      time.Time
+	NotAfter       time.Time
+	CertificatePEM []byte
+	PrivateKeyPEM  []byte
+}
+
+// NewAuthority loads an authority from its PEM certificate and its PKCS #8,
+// EC or PKCS #1 private key
+func NewAuthority(certPEM, keyPEM []byte, clock util.Clock) (*Authority, error) {
+	certBlock, _ := pem.Decode(certPEM)
+	if certBlock == nil {
+		return nil, fmt.Errorf("%w: no PEM certificate", ErrInvalidAuthority)
+	}
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAuthority, err)
+	}
+	if !cert.IsCA {
+		return nil, fmt.Errorf("%w: certificate is not a CA", ErrInvalidAuthority)
+	}
+	key, err := parseKey(keyPEM)
+	if err != nil {
+		return nil, err
+	}
+	if !publicKeysEqual(cert.PublicKey, key.Public()) {
+		return nil, fmt.Errorf("%w: key does not match the certificate", ErrInvalidAuthority)
+	}
+	return &Authority{cert: cert, key: key, certPEM: certPEM, clock: clock}, nil
+}
+
+// GenerateAuthority creates an authority of its own. The certificates it
+// signs are trusted only as long as it is kept, so a server generating one
+// at every start has its devices' certificates reissued after a restart.
+func GenerateAuthority(clock util.Clock) (*Authority, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	now := clock.Now()
+	template := &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "Device CA"},
+		NotBefore:             now.Add(-clockSkew),
+		NotAfter:              now.Add(AuthorityValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	if template.SerialNumber, err = newSerial(); err != nil {
+		return nil, err
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return &Authority{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		clock:   clock,
+	}, nil
+}
+
+// CertificatePEM returns the certificate of the authority, which devices
+// trust the server's certificate with
+func (a *Authority) CertificatePEM() []byte {
+	return a.certPEM
+}
+
+// IssueDevice signs a client certificate naming the device by its unique
+// ID as common name
+func (a *Authority) IssueDevice(uniqueID string, validity time.Duration) (*Issued, error) {
+	return a.issue(&x509.Certificate{
+		Subject:     pkix.Name{CommonName: uniqueID},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, validity)
+}
+
+// IssueServer signs a server certificate for the given host names and IP
+// addresses
+func (a *Authority) IssueServer(hosts []string) (*Issued, error) {
+	template := &x509.Certificate{
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else if host != "" {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+	if len(hosts) > 0 {
+		template.Subject.CommonName = hosts[0]
+	}
+	return a.issue(template, ServerValidity)
+}
+
+func (a *Authority) issue(template *x509.Certificate, validity time.Duration) (*Issued, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	now := a.clock.Now()
+	template.NotBefore = now.Add(-clockSkew)
+	template.NotAfter = now.Add(validity)
+	template.KeyUsage = x509.KeyUsageDigitalSignature
+	if template.SerialNumber, err = newSerial(); err != nil {
+		return nil, err
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, a.cert, key.Public(), a.key)
+	if err != nil {
+		return nil, err
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return &Issued{
+		Serial:         Serial(template.SerialNumber),
+		NotBefore:      template.NotBefore,
+		NotAfter:       template.NotAfter,
+		CertificatePEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		PrivateKeyPEM:  pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}),
+	}, nil
+}
+
+// ServerConfig returns TLS settings presenting the server certificate and
+// requiring client certificates signed by the authority, refusing those
+// revoked reports by serial. Validity is judged by the authority's clock.
+func (a *Authority) ServerConfig(server tls.Certificate, revoked func(serial string) bool) *tls.Config {
+	pool := x509.NewCertPool()
+	pool.AddCert(a.cert)
+	return &tls.Config{
+		Certificates: []tls.Certificate{server},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+		MinVersion:   tls.VersionTLS12,
+		Time:         a.clock.Now,
+		VerifyPeerCertificate: func(_ [][]byte, chains [][]*x509.Certificate) error {
+			if len(chains) > 0 && len(chains[0]) > 0 && revoked(Serial(chains[0][0].SerialNumber)) {
+				return ErrRevoked
+			}
+			return nil
+		},
+	}
+}
+
+// Identities returns the names a client certificate may give its device
+// by, the common name first and then the DNS names of its SANs
+func Identities(cert *x509.Certificate) []string {
+	var names []string
+	if cert.Subject.CommonName != "" {
+		names = append(names, cert.Subject.CommonName)
+	}
+	return append(names, cert.DNSNames...)
+}
+
+// Serial formats a certificate serial number as it is stored: upper case
+// hexadecimal
+func Serial(serial *big.Int) string {
+	return strings.ToUpper(serial.Text(16))
+}
+
+func newSerial() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
+
+func parseKey(keyPEM []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, fmt.Errorf("%w: no PEM private key", ErrInvalidAuthority)
+	}
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		if signer, ok := key.(crypto.Signer); ok {
+			return signer, nil
+		}
+	}
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("%w: unsupported private key", ErrInvalidAuthority)
+}
+
+func publicKeysEqual(a, b crypto.PublicKey) bool {
+	key, ok := a.(interface{ Equal(crypto.PublicKey) bool })
+	return ok && key.Equal(b)
+}
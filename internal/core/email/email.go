@@ -0,0 +1,51 @@
+// Package email mails notifications about device events to the users who
+// chose them, gathering those to one address into digests
+package email
+
+import (
+	"fmt"
+	"mime"
+	"net/smtp"
+	"strings"
+)
+
+// Mailer sends a plain text message
+type Mailer interface {
+	Send(to, subject, body string) error
+}
+
+// SMTPMailer sends through a mail server, upgrading to TLS when the
+// server offers it
+type SMTPMailer struct {
+	addr string
+	auth smtp.Auth // Nil sends without authenticating
+	from string
+}
+
+func NewSMTPMailer(host string, port int, username, password, from string) *SMTPMailer {
+	mailer := &SMTPMailer{
+		addr: fmt.Sprintf("%s:%d", host, port),
+		from: from,
+	}
+	if username != "" {
+		mailer.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return mailer
+}
+
+func (m *SMTPMailer) Send(to, subject, body string) error {
+	var message strings.Builder
+	fmt.Fprintf(&message, "From: %s\r\n", m.from)
+	fmt.Fprintf(&message, "To: %s\r\n", to)
+	fmt.Fprintf(&message, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", headerSafe(subject)))
+	message.WriteString("MIME-Version: 1.0\r\n")
+	message.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	message.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	return smtp.SendMail(m.addr, m.auth, m.from, []string{to}, []byte(message.String()))
+}
+
+// headerSafe folds line breaks, which device names may carry, so they
+// cannot start headers of their own
+func headerSafe(value string) string {
+	return strings.Join(strings.Fields(value), " ")
+}
@@ -0,0 +1,134 @@
+package email
+
+import (
+	"log"
+	"time"
+
+	"tracking/internal/core/model"
+)
+
+const queueSize = 1000
+
+// Recipients returns the device an event is about and the addresses that
+// chose its notification
+type Recipients func(event *model.Event, notification string) (*model.Device, []string, error)
+
+// Notifier mails the notifications of events. Notifications to an
+// address are gathered for a window and sent together, as a digest when
+// there are several, so a burst of events makes one mail. Events are
+// handled in the background; one raised while the queue is full, or a
+// mail the server refuses, is logged and dropped.
+type Notifier struct {
+	recipients Recipients
+	mailer     Mailer
+	templates  *Templates
+	window     time.Duration
+	queue      chan *model.Event
+
+	pending map[string][]Message // By address, in the order raised
+	order   []string             // Addresses by first notification
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func NewNotifier(recipients Recipients, mailer Mailer, templates *Templates, window time.Duration) *Notifier {
+	return &Notifier{
+		recipients: recipients,
+		mailer:     mailer,
+		templates:  templates,
+		window:     window,
+		queue:      make(chan *model.Event, queueSize),
+		pending:    make(map[string][]Message),
+	}
+}
+
+// Handle queues an event that has a notification; it is an event handler
+func (n *Notifier) Handle(event *model.Event) {
+	if model.EventNotification(event) == "" {
+		return
+	}
+	select {
+	case n.queue <- event:
+	default:
+		log.Printf("[Email] queue full, dropping %s event of device %s", event.Type, event.DeviceID)
+	}
+}
+
+// Start mails queued events until Stop
+func (n *Notifier) Start() {
+	n.stop = make(chan struct{})
+	n.done = make(chan struct{})
+	go func() {
+		defer close(n.done)
+		ticker := time.NewTicker(n.window)
+		defer ticker.Stop()
+		for {
+			select {
+			case event := <-n.queue:
+				n.gather(event)
+			case <-ticker.C:
+				n.flush()
+			case <-n.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop ends delivery; notifications not yet sent are dropped
+func (n *Notifier) Stop() {
+	if n.stop == nil {
+		return
+	}
+	close(n.stop)
+	<-n.done
+	n.stop = nil
+}
+
+// gather renders the notification of an event for every address that
+// chose it
+func (n *Notifier) gather(event *model.Event) {
+	notification := model.EventNotification(event)
+	device, addresses, err := n.recipients(event, notification)
+	if err != nil {
+		log.Printf("[Email] failed to find recipients of %s event of device %s: %v", event.Type, event.DeviceID, err)
+		return
+	}
+	if device == nil || len(addresses) == 0 {
+		return
+	}
+
+	message, err := n.templates.Event(notification, device, event)
+	if err != nil {
+		log.Printf("[Email] failed to render %s notification: %v", notification, err)
+		return
+	}
+	for _, address := range addresses {
+		if _, ok := n.pending[address]; !ok {
+			n.order = append(n.order, address)
+		}
+		n.pending[address] = append(n.pending[address], message)
+	}
+}
+
+// flush sends what was gathered, one mail per address
+func (n *Notifier) flush() {
+	for _, address := range n.order {
+		messages := n.pending[address]
+		message := messages[0]
+		if len(messages) > 1 {
+			digest, err := n.templates.Digest(messages)
+			if err != nil {
+				log.Printf("[Email] failed to render digest: %v", err)
+				continue
+			}
+			message = digest
+		}
+		if err := n.mailer.Send(address, message.Subject, message.Body); err != nil {
+			log.Printf("[Email] failed to mail %s: %v", address, err)
+		}
+	}
+	n.pending = make(map[string][]Message)
+	n.order = nil
+}
@@ -0,0 +1,119 @@
+package email
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"tracking/internal/core/model"
+)
+
+// Template names, one per notification and one for digests. A template
+// renders a "Subject:" line, a blank line and the body.
+const (
+	TemplateSOS        = model.NotifySOS
+	TemplateLowBattery = model.NotifyLowBattery
+	TemplateGeofence   = model.NotifyGeofence
+	TemplateDigest     = "digest"
+)
+
+var defaultTemplates = map[string]string{
+	TemplateSOS: `Subject: SOS from {{.Device.Name}}
+
+{{.Device.Name}} ({{.Device.UniqueID}}) raised an SOS alarm at {{.Time}}.
+`,
+	TemplateLowBattery: `Subject: Low battery on {{.Device.Name}}
+
+The battery of {{.Device.Name}} ({{.Device.UniqueID}}) ran low{{with .Event.Attributes.batteryLevel}} at {{.}}%{{end}} at {{.Time}}.
+`,
+	TemplateGeofence: `Subject: {{.Device.Name}} {{if eq .Event.Type "geofenceEnter"}}entered{{else}}left{{end}} {{.Event.Attributes.geofenceName}}
+
+{{.Device.Name}} ({{.Device.UniqueID}}) {{if eq .Event.Type "geofenceEnter"}}entered{{else}}left{{end}} the geofence {{.Event.Attributes.geofenceName}} at {{.Time}}.
+`,
+	TemplateDigest: `Subject: {{len .Messages}} tracking notifications
+
+{{range .Messages}}{{.Subject}}
+{{.Body}}
+{{end}}`,
+}
+
+// Message is a rendered notification
+type Message struct {
+	Subject string
+	Body    string
+}
+
+// eventData is what notification templates render
+type eventData struct {
+	Device *model.Device
+	Event  *model.Event
+	Time   string // Of the event, in UTC
+}
+
+// digestData is what the digest template renders
+type digestData struct {
+	Messages []Message
+}
+
+// Templates render notifications
+type Templates struct {
+	templates map[string]*template.Template
+}
+
+// LoadTemplates parses the built-in templates, replacing those with a
+// file named after them, such as sos.tmpl, in dir. An empty dir keeps the
+// built-in ones.
+func LoadTemplates(dir string) (*Templates, error) {
+	t := &Templates{templates: make(map[string]*template.Template)}
+	for name, text := range defaultTemplates {
+		if dir != "" {
+			content, err := os.ReadFile(filepath.Join(dir, name+".tmpl"))
+			if err == nil {
+				text = string(content)
+			} else if !errors.Is(err, os.ErrNotExist) {
+				return nil, err
+			}
+		}
+		parsed, err := template.New(name).Option("missingkey=zero").Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("email template %s: %v", name, err)
+		}
+		t.templates[name] = parsed
+	}
+	return t, nil
+}
+
+// Event renders the notification of an event about the device
+func (t *Templates) Event(notification string, device *model.Device, event *model.Event) (Message, error) {
+	return t.render(notification, eventData{
+		Device: device,
+		Event:  event,
+		Time:   event.Timestamp.UTC().Format("2006-01-02 15:04 UTC"),
+	})
+}
+
+// Digest renders several notifications as one
+func (t *Templates) Digest(messages []Message) (Message, error) {
+	return t.render(TemplateDigest, digestData{Messages: messages})
+}
+
+func (t *Templates) render(name string, data interface{}) (Message, error) {
+	tmpl, ok := t.templates[name]
+	if !ok {
+		return Message{}, fmt.Errorf("no email template %s", name)
+	}
+	var rendered strings.Builder
+	if err := tmpl.Execute(&rendered, data); err != nil {
+		return Message{}, err
+	}
+
+	head, body, _ := strings.Cut(rendered.String(), "\n\n")
+	subject, ok := strings.CutPrefix(head, "Subject:")
+	if !ok {
+		return Message{}, fmt.Errorf("email template %s renders no Subject line", name)
+	}
+	return Message{Subject: strings.TrimSpace(subject), Body: body}, nil
+}
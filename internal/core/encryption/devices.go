@@ -0,0 +1,245 @@
+package encryption
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"tracking/internal/core/model"
+	"tracking/internal/core/repository"
+)
+
+// Keys of model.Device.Sealed
+const (
+	sealedScope     = "scope"
+	sealedApiSecret = "apiSecret"
+	sealedPhone     = "phone"
+)
+
+// indexScope names the data key phone numbers are indexed with. It is one
+// for all scopes, as SMS senders are looked up before their owner is known.
+const indexScope = "index"
+
+// Devices seals the API secret and SIM phone number of every device it
+// stores, under the data key of the device's organization, or of its user
+// when it has no organization. In place of the phone number it stores a
+// keyed hash, so devices can still be found by the sender of an SMS.
+//
+// Devices stored before encryption was enabled are read as they are, and
+// sealed on their next update or by Rotate.
+type Devices struct {
+	repository.DeviceRepository
+	keyring *Keyring
+}
+
+// Rotation reports what Devices.Rotate changed
+type Rotation struct {
+	KeyID     string `json:"keyId"`     // Master key every data key is now wrapped with
+	Rewrapped int    `json:"rewrapped"` // Data keys moved from an older master key
+	Sealed    int    `json:"sealed"`    // Devices found in plaintext and sealed
+}
+
+func NewDevices(devices repository.DeviceRepository, keyring *Keyring) *Devices {
+	return &Devices{DeviceRepository: devices, keyring: keyring}
+}
+
+func (d *Devices) Create(device *model.Device) error {
+	sealed, err := d.seal(device)
+	if err != nil {
+		return err
+	}
+	return d.DeviceRepository.Create(sealed)
+}
+
+func (d *Devices) Update(device *model.Device) error {
+	sealed, err := d.seal(device)
+	if err != nil {
+		return err
+	}
+	return d.DeviceRepository.Update(sealed)
+}
+
+func (d *Devices) FindByID(id string) (*model.Device, error) {
+	return d.openOne(d.DeviceRepository.FindByID(id))
+}
+
+func (d *Devices) FindByUniqueID(uniqueID string) (*model.Device, error) {
+	return d.openOne(d.DeviceRepository.FindByUniqueID(uniqueID))
+}
+
+func (d *Devices) FindByExternalID(system, id string) (*model.Device, error) {
+	return d.openOne(d.DeviceRepository.FindByExternalID(system, id))
+}
+
+func (d *Devices) FindAll() ([]*model.Device, error) {
+	return d.openAll(d.DeviceRepository.FindAll())
+}
+
+func (d *Devices) FindByUserID(userID string) ([]*model.Device, error) {
+	return d.openAll(d.DeviceRepository.FindByUserID(userID))
+}
+
+func (d *Devices) FindByPhone(phone string) (*model.Device, error) {
+	if phone == "" {
+		return nil, nil
+	}
+	index, err := d.index(phone)
+	if err != nil {
+		return nil, err
+	}
+	device, err := d.openOne(d.DeviceRepository.FindByPhone(index))
+	if device != nil || err != nil {
+		return device, err
+	}
+	// Not sealed yet
+	device, err = d.DeviceRepository.FindByPhone(phone)
+	if device == nil || err != nil || device.Sealed != nil {
+		return nil, err
+	}
+	return device, nil
+}
+
+// Rotate rewraps every data key with the current master key, and seals
+// the devices still stored in plaintext
+func (d *Devices) Rotate() (*Rotation, error) {
+	rewrapped, err := d.keyring.Rotate()
+	if err != nil {
+		return nil, err
+	}
+	devices, err := d.DeviceRepository.FindAll()
+	if err != nil {
+		return nil, err
+	}
+	rotation := &Rotation{KeyID: d.keyring.provider.CurrentKeyID(), Rewrapped: rewrapped}
+	for _, device := range devices {
+		if device.Sealed != nil {
+			continue
+		}
+		if err := d.Update(device); err != nil {
+			return nil, err
+		}
+		rotation.Sealed++
+	}
+	return rotation, nil
+}
+
+// seal returns a copy of the device as stored, its sensitive fields
+// sealed. The device given keeps them in plaintext.
+func (d *Devices) seal(device *model.Device) (*model.Device, error) {
+	if device.Sealed != nil {
+		return device, nil
+	}
+	scope := scopeOf(device)
+	key, err := d.keyring.DataKey(scope)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	sealed := *device
+	sealed.Sealed = map[string]string{sealedScope: scope}
+	for field, value := range map[string]*string{sealedApiSecret: &sealed.ApiSecret, sealedPhone: &sealed.Phone} {
+		if *value == "" {
+			continue
+		}
+		ciphertext, err := seal(aead, []byte(*value), fieldContext(device.ID, field))
+		if err != nil {
+			return nil, err
+		}
+		sealed.Sealed[field] = base64.StdEncoding.EncodeToString(ciphertext)
+		*value = ""
+	}
+	if device.Phone != "" {
+		if sealed.Phone, err = d.index(device.Phone); err != nil {
+			return nil, err
+		}
+	}
+	return &sealed, nil
+}
+
+// open returns a copy of the device as stored, its sensitive fields in
+// plaintext
+func (d *Devices) open(device *model.Device) (*model.Device, error) {
+	if device.Sealed == nil {
+		return device, nil
+	}
+	key, err := d.keyring.DataKey(device.Sealed[sealedScope])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	opened := *device
+	opened.Sealed = nil
+	opened.Phone = ""
+	for field, value := range map[string]*string{sealedApiSecret: &opened.ApiSecret, sealedPhone: &opened.Phone} {
+		encoded, ok := device.Sealed[field]
+		if !ok {
+			continue
+		}
+		ciphertext, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, err
+		}
+		plaintext, err := open(aead, ciphertext, fieldContext(device.ID, field))
+		if err != nil {
+			return nil, err
+		}
+		*value = string(plaintext)
+	}
+	return &opened, nil
+}
+
+func (d *Devices) openOne(device *model.Device, err error) (*model.Device, error) {
+	if device == nil || err != nil {
+		return device, err
+	}
+	return d.open(device)
+}
+
+func (d *Devices) openAll(devices []*model.Device, err error) ([]*model.Device, error) {
+	if err != nil {
+		return nil, err
+	}
+	opened := make([]*model.Device, len(devices))
+	for i, device := range devices {
+		if opened[i], err = d.open(device); err != nil {
+			return nil, err
+		}
+	}
+	return opened, nil
+}
+
+// index is the keyed hash a phone number is stored and looked up as
+func (d *Devices) index(phone string) (string, error) {
+	key, err := d.keyring.DataKey(indexScope)
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(phone))
+	return "hmac:" + hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// scopeOf names the data key a device is sealed with
+func scopeOf(device *model.Device) string {
+	switch {
+	case device.OrganizationID != "":
+		return "organization:" + device.OrganizationID
+	case device.UserID != "":
+		return "user:" + device.UserID
+	}
+	return "unowned"
+}
+
+// fieldContext binds a sealed value to its device and field, so it cannot
+// be moved to another
+func fieldContext(deviceID, field string) []byte {
+	return []byte(deviceID + "/" + field)
+}
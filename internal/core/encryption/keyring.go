@@ -0,0 +1,110 @@
+package encryption
+
+import (
+	"crypto/rand"
+	"fmt"
+	"sync"
+	"tracking/internal/core/model"
+	"tracking/internal/core/repository"
+	"tracking/internal/core/util"
+)
+
+// dataKeySize makes data keys AES-256 keys
+const dataKeySize = 32
+
+// Keyring hands out the data key of each scope, creating it on first use.
+// Data keys are unwrapped once and kept in memory.
+type Keyring struct {
+	provider KeyProvider
+	keys     repository.DataKeyRepository
+	clock    util.Clock
+
+	mutex sync.Mutex
+	plain map[string][]byte // Unwrapped data keys by scope
+}
+
+func NewKeyring(provider KeyProvider, keys repository.DataKeyRepository, clock util.Clock) *Keyring {
+	return &Keyring{
+		provider: provider,
+		keys:     keys,
+		clock:    clock,
+		plain:    make(map[string][]byte),
+	}
+}
+
+// DataKey returns the data key of a scope
+func (k *Keyring) DataKey(scope string) ([]byte, error) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	if key, ok := k.plain[scope]; ok {
+		return key, nil
+	}
+	stored, err := k.keys.FindByScope(scope)
+	if err != nil {
+		return nil, err
+	}
+	if stored == nil {
+		if stored, err = k.create(scope); err != nil {
+			return nil, err
+		}
+	}
+	key, err := k.provider.Unwrap(stored.KeyID, stored.WrappedKey, []byte(scope))
+	if err != nil {
+		return nil, fmt.Errorf("unwrapping data key of %s: %w", scope, err)
+	}
+	k.plain[scope] = key
+	return key, nil
+}
+
+func (k *Keyring) create(scope string) (*model.DataKey, error) {
+	key := make([]byte, dataKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	keyID := k.provider.CurrentKeyID()
+	wrapped, err := k.provider.Wrap(keyID, key, []byte(scope))
+	if err != nil {
+		return nil, err
+	}
+	return k.keys.CreateIfAbsent(&model.DataKey{
+		Scope:      scope,
+		KeyID:      keyID,
+		WrappedKey: wrapped,
+		CreatedAt:  k.clock.Now(),
+	})
+}
+
+// Rotate rewraps every data key not wrapped with the current master key,
+// returning how many it rewrapped. The data keys themselves, and so the
+// data they seal, stay the same.
+func (k *Keyring) Rotate() (int, error) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	stored, err := k.keys.FindAll()
+	if err != nil {
+		return 0, err
+	}
+	current := k.provider.CurrentKeyID()
+	rewrapped := 0
+	for _, key := range stored {
+		if key.KeyID == current {
+			continue
+		}
+		plain, err := k.provider.Unwrap(key.KeyID, key.WrappedKey, []byte(key.Scope))
+		if err != nil {
+			return rewrapped, fmt.Errorf("unwrapping data key of %s: %w", key.Scope, err)
+		}
+		if key.WrappedKey, err = k.provider.Wrap(current, plain, []byte(key.Scope)); err != nil {
+			return rewrapped, err
+		}
+		key.KeyID = current
+		key.RotatedAt = k.clock.Now()
+		if err := k.keys.Update(key); err != nil {
+			return rewrapped, err
+		}
+		rewrapped++
+	}
+	return rewrapped, nil
+}
@@ -0,0 +1,113 @@
+// Package encryption seals the sensitive fields of devices at rest with
+// envelope encryption: each organization has a data key of its own, which
+// is stored only wrapped by a master key held by a KeyProvider. Rotating
+// the master key rewraps the data keys without touching the data.
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrUnknownKey is returned for data wrapped with a master key the
+// provider does not hold
+var ErrUnknownKey = errors.New("unknown master key")
+
+// KeyProvider wraps and unwraps data keys with master keys it never hands
+// out, in the manner of a cloud KMS. Master keys are named, so data keys
+// wrapped with a retired key can be unwrapped until they are rotated.
+type KeyProvider interface {
+	// CurrentKeyID names the master key new and rotated data keys are
+	// wrapped with
+	CurrentKeyID() string
+	// Wrap encrypts a data key with a master key, bound to context
+	Wrap(keyID string, dataKey, context []byte) ([]byte, error)
+	// Unwrap decrypts a data key wrapped with a master key and context
+	Unwrap(keyID string, wrapped, context []byte) ([]byte, error)
+}
+
+// LocalProvider holds AES-256 master keys in memory, for servers without
+// a KMS
+type LocalProvider struct {
+	current string
+	keys    map[string]cipher.AEAD
+}
+
+// ParseKeys reads master keys given as comma separated id:key pairs, each
+// key 32 bytes in base64. The first is the current key; the others are
+// kept to unwrap data keys not yet rotated.
+func ParseKeys(spec string) (*LocalProvider, error) {
+	provider := &LocalProvider{keys: make(map[string]cipher.AEAD)}
+	for _, entry := range strings.Split(spec, ",") {
+		id, encoded, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		if !ok || id == "" {
+			return nil, fmt.Errorf("invalid master key %q: want id:base64", entry)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("invalid master key %s: want 32 bytes in base64", id)
+		}
+		if _, ok := provider.keys[id]; ok {
+			return nil, fmt.Errorf("duplicate master key %s", id)
+		}
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, err
+		}
+		provider.keys[id] = aead
+		if provider.current == "" {
+			provider.current = id
+		}
+	}
+	return provider, nil
+}
+
+func (p *LocalProvider) CurrentKeyID() string {
+	return p.current
+}
+
+func (p *LocalProvider) Wrap(keyID string, dataKey, context []byte) ([]byte, error) {
+	aead, ok := p.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, keyID)
+	}
+	return seal(aead, dataKey, context)
+}
+
+func (p *LocalProvider) Unwrap(keyID string, wrapped, context []byte) ([]byte, error) {
+	aead, ok := p.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, keyID)
+	}
+	return open(aead, wrapped, context)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts plaintext behind a random nonce
+func seal(aead cipher.AEAD, plaintext, context []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, context), nil
+}
+
+func open(aead cipher.AEAD, sealed, context []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("sealed value too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, context)
+}
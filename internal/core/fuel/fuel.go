@@ -0,0 +1,87 @@
+// Package fuel turns the fuel readings decoders report, in whatever unit
+// the sensor uses, into one fuel level in percent of the tank.
+package fuel
+
+import (
+	"context"
+	"math"
+
+	"tracking/internal/core/model"
+)
+
+// AttributeLevel is the normalized fuel level, in percent of the tank
+const AttributeLevel = "fuelLevel"
+
+// Raw readings a level is taken from, after any set by a script
+const (
+	AttributeCobanLevel = "fuel1"        // Percent, from Coban trackers
+	AttributeLLSLevel   = "llsFuel1"     // Raw level of an LLS probe, from Teltonika
+	AttributeAnalog     = "analogInput1" // Volts of a sensor on an analog input, from Teltonika
+)
+
+// DefaultLLSFullScale is the level an LLS probe reads at the top of its
+// range when not calibrated to the tank
+const DefaultLLSFullScale = 4095
+
+// Normalizer stamps positions with AttributeLevel. A level already set,
+// by a decoder reading the CAN bus or by a calibration script, is kept;
+// otherwise the first raw reading found is scaled to its full scale.
+type Normalizer struct {
+	llsFullScale    float64
+	analogFullScale float64 // Volts of a full tank; zero leaves analog inputs alone
+}
+
+// NewNormalizer scales LLS levels by llsFullScale and analog inputs by
+// analogFullScale volts. Analog inputs often carry other sensors, so they
+// are only read when analogFullScale is set.
+func NewNormalizer(llsFullScale, analogFullScale float64) *Normalizer {
+	if llsFullScale <= 0 {
+		llsFullScale = DefaultLLSFullScale
+	}
+	return &Normalizer{llsFullScale: llsFullScale, analogFullScale: analogFullScale}
+}
+
+// Normalize is a StageDecoded hook setting the fuel level of the position
+func (n *Normalizer) Normalize(ctx context.Context, position *model.Position) error {
+	level, ok := n.level(position.Status)
+	if !ok {
+		return nil
+	}
+	position.Status[AttributeLevel] = math.Round(math.Max(0, math.Min(100, level))*10) / 10
+	return nil
+}
+
+func (n *Normalizer) level(status map[string]interface{}) (float64, bool) {
+	if level, ok := number(status[AttributeLevel]); ok {
+		return level, true
+	}
+	if level, ok := number(status[AttributeCobanLevel]); ok {
+		return level, true
+	}
+	if raw, ok := number(status[AttributeLLSLevel]); ok {
+		return raw / n.llsFullScale * 100, true
+	}
+	if volts, ok := number(status[AttributeAnalog]); ok && n.analogFullScale > 0 {
+		return volts / n.analogFullScale * 100, true
+	}
+	return 0, false
+}
+
+// number reads a reading whichever number type the decoder or script
+// stored it as
+func number(value interface{}) (float64, bool) {
+	var f float64
+	switch v := value.(type) {
+	case float64:
+		f = v
+	case int:
+		f = float64(v)
+	case int64:
+		f = float64(v)
+	case uint64:
+		f = float64(v)
+	default:
+		return 0, false
+	}
+	return f, !math.IsNaN(f) && !math.IsInf(f, 0)
+}
@@ -0,0 +1,162 @@
+// Package gateway runs the server as a protocol normalizer in front of
+// another platform: positions decoded from devices are forwarded as JSON
+// to a sink instead of being stored, and devices need not be registered
+package gateway
+
+import (
+	"sync"
+
+	"tracking/internal/core/model"
+	"tracking/internal/core/repository"
+	"tracking/internal/core/util"
+)
+
+// Devices is a DeviceRepository that adds any device it is asked for by
+// unique ID, so every device that connects is accepted
+type Devices struct {
+	repository.DeviceRepository
+	clock util.Clock
+	mutex sync.Mutex // Keeps two connections of a device from adding it twice
+}
+
+func NewDevices(devices repository.DeviceRepository, clock util.Clock) *Devices {
+	return &Devices{DeviceRepository: devices, clock: clock}
+}
+
+func (d *Devices) FindByUniqueID(uniqueID string) (*model.Device, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	device, err := d.DeviceRepository.FindByUniqueID(uniqueID)
+	if err != nil || device != nil || uniqueID == "" {
+		return device, err
+	}
+	device = model.NewDevice(uniqueID, uniqueID)
+	device.Protocol = ""
+	device.CreatedAt = d.clock.Now()
+	device.LastUpdate = device.CreatedAt
+	if err := d.DeviceRepository.Create(device); err != nil {
+		return nil, err
+	}
+	return device, nil
+}
+
+// Positions is a PositionRepository forwarding positions to a sink rather
+// than storing them. Only the latest position of each device is kept, for
+// the filters and decoders that compare a position with the one before.
+type Positions struct {
+	sink    Sink
+	devices repository.DeviceRepository
+
+	mutex  sync.RWMutex
+	latest map[string]*model.Position // By device ID
+}
+
+func NewPositions(sink Sink, devices repository.DeviceRepository) *Positions {
+	return &Positions{
+		sink:    sink,
+		devices: devices,
+		latest:  make(map[string]*model.Position),
+	}
+}
+
+func (p *Positions) Create(position *model.Position) error {
+	return p.CreateBatch([]*model.Position{position})
+}
+
+// CreateBatch sends the positions in one go, so a batch is forwarded
+// whole or not at all
+func (p *Positions) CreateBatch(positions []*model.Position) error {
+	if len(positions) == 0 {
+		return nil
+	}
+	messages := make([]*Message, len(positions))
+	devices := make(map[string]*Message) // Device fields by device ID
+	for i, position := range positions {
+		if position.ID == "" {
+			position.ID = util.GenerateID()
+		}
+		device, known := devices[position.DeviceID]
+		if !known {
+			device = p.device(position.DeviceID)
+			devices[position.DeviceID] = device
+		}
+		messages[i] = &Message{UniqueID: device.UniqueID, ExternalIDs: device.ExternalIDs, Position: position}
+	}
+	if err := p.sink.Send(messages); err != nil {
+		return &repository.BatchError{Stored: 0, Err: err}
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for _, position := range positions {
+		if latest := p.latest[position.DeviceID]; latest == nil || !position.Timestamp.Before(latest.Timestamp) {
+			p.latest[position.DeviceID] = position
+		}
+	}
+	return nil
+}
+
+// device returns the fields of a message naming the device, its ID
+// standing in for the unique ID of one that is not known
+func (p *Positions) device(deviceID string) *Message {
+	device, err := p.devices.FindByID(deviceID)
+	if err != nil || device == nil {
+		return &Message{UniqueID: deviceID}
+	}
+	return &Message{UniqueID: device.UniqueID, ExternalIDs: device.ExternalIDs}
+}
+
+// FindByID finds only the latest position of a device
+func (p *Positions) FindByID(id string) (*model.Position, error) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	for _, position := range p.latest {
+		if position.ID == id {
+			return position, nil
+		}
+	}
+	return nil, nil
+}
+
+// FindByDeviceID returns no more than the latest position
+func (p *Positions) FindByDeviceID(deviceID string) ([]*model.Position, error) {
+	latest, _ := p.FindLatestByDeviceID(deviceID)
+	if latest == nil {
+		return []*model.Position{}, nil
+	}
+	return []*model.Position{latest}, nil
+}
+
+func (p *Positions) FindLatestByDeviceID(deviceID string) (*model.Position, error) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return p.latest[deviceID], nil
+}
+
+// SetAddress updates the latest position kept; addresses looked up after
+// a position was forwarded are not sent
+func (p *Positions) SetAddress(id, address string) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for deviceID, position := range p.latest {
+		if position.ID == id {
+			updated := *position
+			updated.Address = address
+			p.latest[deviceID] = &updated
+		}
+	}
+	return nil
+}
+
+// FindInRange returns no more than the latest position
+func (p *Positions) FindInRange(positionRange repository.PositionRange, after *repository.PositionCursor, limit int) ([]*model.Position, error) {
+	latest, _ := p.FindLatestByDeviceID(positionRange.DeviceID)
+	if latest == nil || !positionRange.Contains(latest.Timestamp) || limit <= 0 {
+		return []*model.Position{}, nil
+	}
+	if after != nil && (latest.Timestamp.Before(after.Timestamp) || latest.Timestamp.Equal(after.Timestamp) && latest.ID <= after.ID) {
+		return []*model.Position{}, nil
+	}
+	return []*model.Position{latest}, nil
+}
@@ -0,0 +1,122 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"tracking/internal/core/model"
+	"tracking/internal/core/webhook"
+)
+
+// EventPositions is the X-Webhook-Event of position batches posted to a
+// webhook sink
+const EventPositions = "positions"
+
+// KafkaContentType is the Kafka REST Proxy v2 type of JSON records
+const KafkaContentType = "application/vnd.kafka.json.v2+json"
+
+const sinkTimeout = 10 * time.Second
+
+// Message is a position as forwarded: its fields with the unique ID of the
+// device, which the platform receiving it knows the device by, and the IDs
+// set for the device in other systems
+type Message struct {
+	UniqueID    string            `json:"uniqueId"`
+	ExternalIDs map[string]string `json:"externalIds,omitempty"`
+	*model.Position
+}
+
+// Sink takes the positions of a frame, in order. An error leaves every one
+// of them unsent, so the device is not acknowledged and sends them again.
+type Sink interface {
+	Send(messages []*Message) error
+}
+
+// WebhookSink posts each batch as a JSON array to a URL, signed like the
+// lifecycle webhooks
+type WebhookSink struct {
+	url    string
+	secret []byte // Empty sends no signature
+	client *http.Client
+}
+
+func NewWebhookSink(url, secret string) *WebhookSink {
+	return &WebhookSink{
+		url:    url,
+		secret: []byte(secret),
+		client: &http.Client{Timeout: sinkTimeout},
+	}
+}
+
+func (s *WebhookSink) Send(messages []*Message) error {
+	body, err := json.Marshal(messages)
+	if err != nil {
+		return err
+	}
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	header.Set(webhook.EventHeader, EventPositions)
+	if len(s.secret) > 0 {
+		header.Set(webhook.SignatureHeader, webhook.Sign(s.secret, body))
+	}
+	return post(s.client, s.url, header, body)
+}
+
+// KafkaSink produces each position as a record to a topic through a Kafka
+// REST Proxy, keyed by the unique ID of the device so its positions stay
+// in order on one partition
+type KafkaSink struct {
+	url    string
+	client *http.Client
+}
+
+// NewKafkaSink produces to topic through the REST Proxy at proxyURL
+func NewKafkaSink(proxyURL, topic string) *KafkaSink {
+	return &KafkaSink{
+		url:    strings.TrimSuffix(proxyURL, "/") + "/topics/" + url.PathEscape(topic),
+		client: &http.Client{Timeout: sinkTimeout},
+	}
+}
+
+type kafkaRecord struct {
+	Key   string   `json:"key"`
+	Value *Message `json:"value"`
+}
+
+func (s *KafkaSink) Send(messages []*Message) error {
+	records := make([]kafkaRecord, len(messages))
+	for i, message := range messages {
+		records[i] = kafkaRecord{Key: message.UniqueID, Value: message}
+	}
+	body, err := json.Marshal(map[string][]kafkaRecord{"records": records})
+	if err != nil {
+		return err
+	}
+	header := http.Header{}
+	header.Set("Content-Type", KafkaContentType)
+	return post(s.client, s.url, header, body)
+}
+
+func post(client *http.Client, url string, header http.Header, body []byte) error {
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header = header
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("sink returned status %d", resp.StatusCode)
+	}
+	return nil
+}
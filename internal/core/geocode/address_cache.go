@@ -0,0 +1,88 @@
+package geocode
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"tracking/internal/cache"
+	"tracking/internal/core/util"
+)
+
+// AddressCacheTTL is how long a looked up address is kept; streets are
+// rarely renamed
+const AddressCacheTTL = 30 * 24 * time.Hour
+
+// AddressCache keeps the street addresses reverse lookups found, by
+// rounded coordinates. An empty address is kept too, so that places the
+// provider knows nothing about are not asked about again.
+type AddressCache interface {
+	Get(ctx context.Context, key string) (address string, ok bool)
+	Put(ctx context.Context, key, address string) error
+}
+
+// RedisAddressCache keeps addresses in the shared Redis cache, so every
+// instance benefits from a lookup. Nothing is kept while Redis is
+// disabled.
+type RedisAddressCache struct {
+	ttl time.Duration
+}
+
+func NewRedisAddressCache(ttl time.Duration) *RedisAddressCache {
+	return &RedisAddressCache{ttl: ttl}
+}
+
+func (c *RedisAddressCache) Get(ctx context.Context, key string) (string, bool) {
+	var address string
+	if err := cache.Get(ctx, "geocode:"+key, &address); err != nil {
+		return "", false
+	}
+	return address, true
+}
+
+func (c *RedisAddressCache) Put(ctx context.Context, key, address string) error {
+	return cache.Set(ctx, "geocode:"+key, address, c.ttl)
+}
+
+// MemoryAddressCache keeps addresses in memory, for tests and deployments
+// without Redis
+type MemoryAddressCache struct {
+	ttl   time.Duration
+	clock util.Clock
+
+	mutex     sync.Mutex
+	addresses map[string]memoryAddress
+}
+
+type memoryAddress struct {
+	address   string
+	expiresAt time.Time
+}
+
+func NewMemoryAddressCache(ttl time.Duration, clock util.Clock) *MemoryAddressCache {
+	return &MemoryAddressCache{
+		ttl:       ttl,
+		clock:     clock,
+		addresses: make(map[string]memoryAddress),
+	}
+}
+
+func (c *MemoryAddressCache) Get(ctx context.Context, key string) (string, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	entry, ok := c.addresses[key]
+	if !ok || !c.clock.Now().Before(entry.expiresAt) {
+		return "", false
+	}
+	return entry.address, true
+}
+
+func (c *MemoryAddressCache) Put(ctx context.Context, key, address string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if len(c.addresses) >= maxEntries {
+		c.addresses = make(map[string]memoryAddress)
+	}
+	c.addresses[key] = memoryAddress{address: address, expiresAt: c.clock.Now().Add(c.ttl)}
+	return nil
+}
@@ -0,0 +1,145 @@
+// Package geocode turns addresses typed into a search box into
+// coordinates, and positions into street addresses, through providers
+// whose keys stay on the server
+package geocode
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"tracking/internal/core/util"
+)
+
+// Bounds on the results returned per search
+const (
+	DefaultLimit = 5
+	MaxLimit     = 20
+)
+
+const (
+	cacheTTL      = 24 * time.Hour
+	failureTTL    = time.Minute
+	maxEntries    = 10000
+	lookupTimeout = 5 * time.Second
+	maxQueryRunes = 200
+)
+
+// Common geocoding errors
+var (
+	ErrInvalidQuery  = errors.New("invalid geocoding query")
+	ErrQuotaExceeded = errors.New("geocoding quota exceeded")
+)
+
+// Result is a place matching a search
+type Result struct {
+	Address   string  `json:"address"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Type      string  `json:"type,omitempty"` // Kind of place, such as "house" or "city"
+}
+
+// Provider looks up the places matching an address, best match first
+type Provider interface {
+	Search(ctx context.Context, query string, limit int) ([]*Result, error)
+}
+
+// Geocoder searches through a provider, caching results by query and
+// limiting each user to a number of provider lookups a day. Answers from
+// the cache do not count against the quota.
+type Geocoder struct {
+	provider Provider
+	clock    util.Clock
+	quota    int // Lookups per user and UTC day; zero leaves them unlimited
+
+	mutex sync.Mutex
+	cache map[cacheKey]cacheEntry
+	usage map[string]int // Lookups per user on day
+	day   string
+}
+
+type cacheKey struct {
+	query string
+	limit int
+}
+
+type cacheEntry struct {
+	results   []*Result // Nil after a failed lookup
+	err       error
+	expiresAt time.Time
+}
+
+func NewGeocoder(provider Provider, clock util.Clock, quota int) *Geocoder {
+	return &Geocoder{
+		provider: provider,
+		clock:    clock,
+		quota:    quota,
+		cache:    make(map[cacheKey]cacheEntry),
+		usage:    make(map[string]int),
+	}
+}
+
+// Search returns the places matching the query for the user. A limit of
+// zero returns DefaultLimit results.
+func (g *Geocoder) Search(ctx context.Context, userID, query string, limit int) ([]*Result, error) {
+	query = strings.Join(strings.Fields(query), " ")
+	if query == "" || len([]rune(query)) > maxQueryRunes {
+		return nil, ErrInvalidQuery
+	}
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+	limit = min(limit, MaxLimit)
+	key := cacheKey{query: strings.ToLower(query), limit: limit}
+	now := g.clock.Now()
+
+	g.mutex.Lock()
+	if entry, ok := g.cache[key]; ok && now.Before(entry.expiresAt) {
+		g.mutex.Unlock()
+		return entry.results, entry.err
+	}
+	if day := now.UTC().Format("2006-01-02"); day != g.day {
+		g.day = day
+		g.usage = make(map[string]int)
+	}
+	if g.quota > 0 && g.usage[userID] >= g.quota {
+		g.mutex.Unlock()
+		return nil, ErrQuotaExceeded
+	}
+	g.usage[userID]++
+	g.mutex.Unlock()
+
+	lookupCtx, cancel := context.WithTimeout(ctx, lookupTimeout)
+	defer cancel()
+	results, err := g.provider.Search(lookupCtx, query, limit)
+	entry := cacheEntry{results: results, expiresAt: now.Add(cacheTTL)}
+	if err != nil {
+		entry = cacheEntry{err: err, expiresAt: now.Add(failureTTL)}
+	} else if entry.results == nil {
+		entry.results = []*Result{}
+	}
+
+	g.mutex.Lock()
+	if len(g.cache) >= maxEntries {
+		g.cache = make(map[cacheKey]cacheEntry)
+	}
+	g.cache[key] = entry
+	g.mutex.Unlock()
+	return entry.results, entry.err
+}
+
+// Remaining returns how many lookups the user has left today, or -1 when
+// they are unlimited
+func (g *Geocoder) Remaining(userID string) int {
+	if g.quota <= 0 {
+		return -1
+	}
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if g.day != g.clock.Now().UTC().Format("2006-01-02") {
+		return g.quota
+	}
+	return max(g.quota-g.usage[userID], 0)
+}
@@ -0,0 +1,68 @@
+package geocode
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// GoogleReverseProvider looks up addresses with the Google Geocoding API,
+// https://maps.googleapis.com/maps/api/geocode/json, which needs a key
+type GoogleReverseProvider struct {
+	url    string
+	key    string
+	client *http.Client
+}
+
+func NewGoogleReverseProvider(endpoint, key string) *GoogleReverseProvider {
+	return &GoogleReverseProvider{
+		url:    endpoint,
+		key:    key,
+		client: &http.Client{},
+	}
+}
+
+type googleResponse struct {
+	Status       string `json:"status"`
+	ErrorMessage string `json:"error_message"`
+	Results      []struct {
+		FormattedAddress string `json:"formatted_address"`
+	} `json:"results"`
+}
+
+func (p *GoogleReverseProvider) Reverse(ctx context.Context, lat, lon float64) (string, error) {
+	params := url.Values{
+		"latlng": {strconv.FormatFloat(lat, 'f', -1, 64) + "," + strconv.FormatFloat(lon, 'f', -1, 64)},
+		"key":    {p.key},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.url+"?"+params.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("google returned status %d", resp.StatusCode)
+	}
+
+	var body googleResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("invalid google response: %v", err)
+	}
+	switch {
+	case body.Status == "ZERO_RESULTS":
+		return "", nil
+	case body.Status != "OK":
+		return "", fmt.Errorf("google returned %s: %s", body.Status, body.ErrorMessage)
+	case len(body.Results) == 0:
+		return "", nil
+	}
+	return body.Results[0].FormattedAddress, nil
+}
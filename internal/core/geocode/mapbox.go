@@ -0,0 +1,64 @@
+package geocode
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// MapboxReverseProvider looks up addresses with the Mapbox Geocoding API,
+// https://api.mapbox.com/geocoding/v5/mapbox.places, which needs an access
+// token
+type MapboxReverseProvider struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+func NewMapboxReverseProvider(endpoint, token string) *MapboxReverseProvider {
+	return &MapboxReverseProvider{
+		url:    endpoint,
+		token:  token,
+		client: &http.Client{},
+	}
+}
+
+type mapboxResponse struct {
+	Features []struct {
+		PlaceName string `json:"place_name"`
+	} `json:"features"`
+}
+
+func (p *MapboxReverseProvider) Reverse(ctx context.Context, lat, lon float64) (string, error) {
+	// Mapbox takes the longitude first, in the path
+	point := strconv.FormatFloat(lon, 'f', -1, 64) + "," + strconv.FormatFloat(lat, 'f', -1, 64)
+	params := url.Values{
+		"access_token": {p.token},
+		"limit":        {"1"},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.url+"/"+point+".json?"+params.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("mapbox returned status %d", resp.StatusCode)
+	}
+
+	var body mapboxResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("invalid mapbox response: %v", err)
+	}
+	if len(body.Features) == 0 {
+		return "", nil
+	}
+	return body.Features[0].PlaceName, nil
+}
@@ -0,0 +1,130 @@
+package geocode
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// NominatimProvider searches a Nominatim endpoint, such as
+// https://nominatim.openstreetmap.org/search, or a hosted service speaking
+// the same API that takes a key, such as LocationIQ
+type NominatimProvider struct {
+	url    string
+	key    string // Sent as the key parameter; empty for open endpoints
+	client *http.Client
+}
+
+func NewNominatimProvider(endpoint, key string) *NominatimProvider {
+	return &NominatimProvider{
+		url:    endpoint,
+		key:    key,
+		client: &http.Client{},
+	}
+}
+
+type nominatimPlace struct {
+	DisplayName string `json:"display_name"`
+	Lat         string `json:"lat"`
+	Lon         string `json:"lon"`
+	Type        string `json:"type"`
+}
+
+func (p *NominatimProvider) Search(ctx context.Context, query string, limit int) ([]*Result, error) {
+	params := url.Values{
+		"q":      {query},
+		"format": {"jsonv2"},
+		"limit":  {strconv.Itoa(limit)},
+	}
+	if p.key != "" {
+		params.Set("key", p.key)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.url+"?"+params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	// Nominatim's usage policy asks clients to identify themselves
+	req.Header.Set("User-Agent", "DoTrack")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("nominatim returned status %d", resp.StatusCode)
+	}
+
+	var places []nominatimPlace
+	if err := json.NewDecoder(resp.Body).Decode(&places); err != nil {
+		return nil, fmt.Errorf("invalid nominatim response: %v", err)
+	}
+
+	results := make([]*Result, 0, len(places))
+	for _, place := range places {
+		lat, latErr := strconv.ParseFloat(place.Lat, 64)
+		lon, lonErr := strconv.ParseFloat(place.Lon, 64)
+		if latErr != nil || lonErr != nil {
+			continue
+		}
+		results = append(results, &Result{
+			Address:   place.DisplayName,
+			Latitude:  lat,
+			Longitude: lon,
+			Type:      place.Type,
+		})
+	}
+	return results, nil
+}
+
+// NominatimReverseProvider looks up addresses at a Nominatim reverse
+// endpoint, such as https://nominatim.openstreetmap.org/reverse, whose
+// usage policy allows one request a second
+type NominatimReverseProvider struct {
+	url    string
+	key    string // Sent as the key parameter; empty for open endpoints
+	client *http.Client
+}
+
+func NewNominatimReverseProvider(endpoint, key string) *NominatimReverseProvider {
+	return &NominatimReverseProvider{
+		url:    endpoint,
+		key:    key,
+		client: &http.Client{},
+	}
+}
+
+func (p *NominatimReverseProvider) Reverse(ctx context.Context, lat, lon float64) (string, error) {
+	params := url.Values{
+		"lat":    {strconv.FormatFloat(lat, 'f', -1, 64)},
+		"lon":    {strconv.FormatFloat(lon, 'f', -1, 64)},
+		"format": {"jsonv2"},
+	}
+	if p.key != "" {
+		params.Set("key", p.key)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.url+"?"+params.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", "DoTrack")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("nominatim returned status %d", resp.StatusCode)
+	}
+
+	// Places without an address come back with an error field instead
+	var place nominatimPlace
+	if err := json.NewDecoder(resp.Body).Decode(&place); err != nil {
+		return "", fmt.Errorf("invalid nominatim response: %v", err)
+	}
+	return place.DisplayName, nil
+}
@@ -0,0 +1,250 @@
+package geocode
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"tracking/internal/core/model"
+	"tracking/internal/core/repository"
+)
+
+// ErrRateLimited is returned when the provider's rate limit leaves no
+// slot for a lookup before its deadline
+var ErrRateLimited = errors.New("geocoding rate limit reached")
+
+const (
+	reverseQueueSize = 1000
+	// Coordinates are rounded to four decimals, about 11 m, for caching;
+	// positions that close share a street address
+	reversePrecision = 4
+)
+
+// ReverseProvider looks up the street address at a point. An empty address
+// means the provider knows none there.
+type ReverseProvider interface {
+	Reverse(ctx context.Context, lat, lon float64) (string, error)
+}
+
+// Reverse geocoding providers, with the endpoint used when none is
+// configured and the lookups a second their terms allow
+var reverseProviders = map[string]struct {
+	endpoint string
+	rate     float64
+	keyed    bool
+}{
+	"nominatim": {"https://nominatim.openstreetmap.org/reverse", 1, false},
+	"google":    {"https://maps.googleapis.com/maps/api/geocode/json", 50, true},
+	"mapbox":    {"https://api.mapbox.com/geocoding/v5/mapbox.places", 10, true},
+}
+
+// NewReverseProvider returns the named provider, nominatim, google or
+// mapbox, at its public endpoint unless another is given
+func NewReverseProvider(name, endpoint, key string) (ReverseProvider, error) {
+	provider, ok := reverseProviders[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown reverse geocoding provider %q", name)
+	}
+	if provider.keyed && key == "" {
+		return nil, fmt.Errorf("reverse geocoding provider %s needs a key", name)
+	}
+	if endpoint == "" {
+		endpoint = provider.endpoint
+	}
+	switch name {
+	case "google":
+		return NewGoogleReverseProvider(endpoint, key), nil
+	case "mapbox":
+		return NewMapboxReverseProvider(endpoint, key), nil
+	default:
+		return NewNominatimReverseProvider(endpoint, key), nil
+	}
+}
+
+// DefaultReverseRate returns the lookups a second the named provider
+// allows
+func DefaultReverseRate(name string) float64 {
+	return reverseProviders[name].rate
+}
+
+// ReverseGeocoder fills in the Address of stored positions in the
+// background, and answers lookups passed through from clients. Addresses
+// are cached by rounded coordinates, and provider lookups are spaced to
+// stay within the provider's rate limit. Positions stored while the queue
+// is full are left without an address.
+type ReverseGeocoder struct {
+	provider  ReverseProvider
+	cache     AddressCache
+	positions repository.PositionRepository
+	limiter   *limiter
+	queue     chan *model.Position
+
+	stop   chan struct{}
+	done   chan struct{}
+	cancel context.CancelFunc
+}
+
+// NewReverseGeocoder looks up at most rate addresses a second through the
+// provider
+func NewReverseGeocoder(provider ReverseProvider, cache AddressCache, positions repository.PositionRepository, rate float64) *ReverseGeocoder {
+	return &ReverseGeocoder{
+		provider:  provider,
+		cache:     cache,
+		positions: positions,
+		limiter:   newLimiter(rate),
+		queue:     make(chan *model.Position, reverseQueueSize),
+	}
+}
+
+// Resolve is a StageStored hook queueing positions without an address
+// for a lookup
+func (g *ReverseGeocoder) Resolve(ctx context.Context, position *model.Position) error {
+	if position.Address != "" || (position.Latitude == 0 && position.Longitude == 0) {
+		return nil
+	}
+	select {
+	case g.queue <- position:
+	default:
+		log.Printf("[Geocode] queue full, leaving position %s of device %s without an address", position.ID, position.DeviceID)
+	}
+	return nil
+}
+
+// Start looks up the addresses of queued positions until Stop
+func (g *ReverseGeocoder) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	g.cancel = cancel
+	g.stop = make(chan struct{})
+	g.done = make(chan struct{})
+	go func() {
+		defer close(g.done)
+		for {
+			select {
+			case position := <-g.queue:
+				g.resolve(ctx, position)
+			case <-g.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop ends the lookups; positions still queued keep no address
+func (g *ReverseGeocoder) Stop() {
+	if g.stop == nil {
+		return
+	}
+	close(g.stop)
+	g.cancel()
+	<-g.done
+	g.stop = nil
+}
+
+func (g *ReverseGeocoder) resolve(ctx context.Context, position *model.Position) {
+	address, ok := g.cache.Get(ctx, addressKey(position.Latitude, position.Longitude))
+	if !ok {
+		// Queued positions wait for a slot as long as it takes
+		if err := g.limiter.wait(ctx); err != nil {
+			return
+		}
+		var err error
+		if address, err = g.lookup(ctx, position.Latitude, position.Longitude); err != nil {
+			log.Printf("[Geocode] lookup for position %s of device %s failed: %v", position.ID, position.DeviceID, err)
+			return
+		}
+	}
+	if address == "" {
+		return
+	}
+	if err := g.positions.SetAddress(position.ID, address); err != nil {
+		log.Printf("[Geocode] failed to store the address of position %s: %v", position.ID, err)
+	}
+}
+
+// Reverse returns the street address at a point, empty when the provider
+// knows none. A lookup waits for the rate limit no longer than the lookup
+// timeout, and fails with ErrRateLimited beyond it.
+func (g *ReverseGeocoder) Reverse(ctx context.Context, lat, lon float64) (string, error) {
+	if math.IsNaN(lat) || math.IsNaN(lon) || lat < -90 || lat > 90 || lon < -180 || lon > 180 {
+		return "", ErrInvalidQuery
+	}
+	if address, ok := g.cache.Get(ctx, addressKey(lat, lon)); ok {
+		return address, nil
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, lookupTimeout)
+	err := g.limiter.wait(waitCtx)
+	cancel()
+	if err != nil {
+		return "", err
+	}
+	return g.lookup(ctx, lat, lon)
+}
+
+// lookup asks the provider and caches its answer, an empty one included
+func (g *ReverseGeocoder) lookup(ctx context.Context, lat, lon float64) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, lookupTimeout)
+	defer cancel()
+	address, err := g.provider.Reverse(ctx, lat, lon)
+	if err != nil {
+		return "", err
+	}
+	if err := g.cache.Put(ctx, addressKey(lat, lon), address); err != nil {
+		log.Printf("[Geocode] failed to cache an address: %v", err)
+	}
+	return address, nil
+}
+
+func addressKey(lat, lon float64) string {
+	return fmt.Sprintf("%.*f,%.*f", reversePrecision, lat, reversePrecision, lon)
+}
+
+// limiter spaces provider lookups evenly, in wall clock time as the
+// provider counts it
+type limiter struct {
+	interval time.Duration
+
+	mutex sync.Mutex
+	next  time.Time // Earliest start of the next lookup
+}
+
+// newLimiter allows rate lookups a second; zero or less allows any number
+func newLimiter(rate float64) *limiter {
+	if rate <= 0 {
+		return &limiter{}
+	}
+	return &limiter{interval: time.Duration(float64(time.Second) / rate)}
+}
+
+// wait takes the next free slot and sleeps until it. A slot past the
+// context's deadline is not taken, and ErrRateLimited is returned.
+func (l *limiter) wait(ctx context.Context) error {
+	l.mutex.Lock()
+	now := time.Now()
+	slot := now
+	if l.next.After(now) {
+		slot = l.next
+	}
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(slot) {
+		l.mutex.Unlock()
+		return ErrRateLimited
+	}
+	l.next = slot.Add(l.interval)
+	l.mutex.Unlock()
+
+	if !slot.After(now) {
+		return nil
+	}
+	timer := time.NewTimer(slot.Sub(now))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,87 @@
+// Package hierarchy lets organizations sit below one another, as the
+// customers of a reseller do, with the members of a parent organization
+// reaching every organization below it
+package hierarchy
+
+import (
+	"slices"
+	"tracking/internal/core/model"
+	"tracking/internal/core/repository"
+)
+
+// MaxDepth bounds how many levels an organization may sit below the top,
+// and how far lookups climb
+const MaxDepth = 5
+
+// Members is an OrganizationMemberRepository resolving membership through
+// the hierarchy: a user belongs to an organization when they belong to it
+// or to any organization above it. Every access check goes through
+// FindByUserAndOrg, so wrapping the repository extends them all.
+type Members struct {
+	repository.OrganizationMemberRepository
+	orgs repository.OrganizationRepository
+}
+
+func NewMembers(members repository.OrganizationMemberRepository, orgs repository.OrganizationRepository) *Members {
+	return &Members{
+		OrganizationMemberRepository: members,
+		orgs:                         orgs,
+	}
+}
+
+// FindByUserAndOrg returns the user's membership of the organization, or
+// else of the closest organization above it
+func (m *Members) FindByUserAndOrg(userID, orgID string) (*model.OrganizationMember, error) {
+	seen := make(map[string]bool)
+	for depth := 0; depth <= MaxDepth && orgID != "" && !seen[orgID]; depth++ {
+		member, err := m.OrganizationMemberRepository.FindByUserAndOrg(userID, orgID)
+		if err != nil || member != nil {
+			return member, err
+		}
+		seen[orgID] = true
+
+		org, err := m.orgs.FindByID(orgID)
+		if err != nil || org == nil {
+			return nil, err
+		}
+		orgID = org.ParentID
+	}
+	return nil, nil
+}
+
+// Chain returns an organization followed by those above it, closest first,
+// or nothing when the organization does not exist. Missing parents end the
+// chain.
+func Chain(orgs repository.OrganizationRepository, orgID string) ([]*model.Organization, error) {
+	var chain []*model.Organization
+	seen := make(map[string]bool)
+	for len(chain) <= MaxDepth && orgID != "" && !seen[orgID] {
+		org, err := orgs.FindByID(orgID)
+		if err != nil {
+			return nil, err
+		}
+		if org == nil {
+			break
+		}
+		seen[orgID] = true
+		chain = append(chain, org)
+		orgID = org.ParentID
+	}
+	return chain, nil
+}
+
+// Features returns the features allowed at the bottom of a chain: those
+// every organization on it allows, an organization without a list
+// allowing everything
+func Features(chain []*model.Organization) []string {
+	allowed := append([]string(nil), model.AllFeatures...)
+	for _, org := range chain {
+		if len(org.Features) == 0 {
+			continue
+		}
+		allowed = slices.DeleteFunc(allowed, func(feature string) bool {
+			return !slices.Contains(org.Features, feature)
+		})
+	}
+	return allowed
+}
@@ -0,0 +1,152 @@
+// Package history keeps device state as an append-only log of events, so
+// the fleet can be reconstructed as it stood at any past instant
+package history
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+	"tracking/internal/core/model"
+	"tracking/internal/core/repository"
+	"tracking/internal/core/util"
+)
+
+// Recorder is a DeviceRepository that appends a device event for every
+// change to the state of a device it stores. Updates touching only
+// bookkeeping, such as the last position, are not recorded.
+type Recorder struct {
+	repository.DeviceRepository
+	events  repository.DeviceEventRepository
+	clock   util.Clock
+	devices sync.Map // Device ID to *deviceHistory
+}
+
+// deviceHistory keeps the state last recorded for a device, so that the
+// bookkeeping updates made for every position are skipped without taking a
+// lock or reading the history
+type deviceHistory struct {
+	mutex sync.Mutex // Keeps the device's sequence gapless under concurrent writes
+	state atomic.Pointer[model.DeviceState]
+}
+
+func NewRecorder(devices repository.DeviceRepository, events repository.DeviceEventRepository, clock util.Clock) *Recorder {
+	return &Recorder{
+		DeviceRepository: devices,
+		events:           events,
+		clock:            clock,
+	}
+}
+
+func (r *Recorder) Create(device *model.Device) error {
+	if err := r.DeviceRepository.Create(device); err != nil {
+		return err
+	}
+	return r.record(model.DeviceCreated, device)
+}
+
+func (r *Recorder) Update(device *model.Device) error {
+	if err := r.DeviceRepository.Update(device); err != nil {
+		return err
+	}
+	if state := r.history(device.ID).state.Load(); state != nil && *state == model.NewDeviceState(device) {
+		return nil
+	}
+	return r.record(model.DeviceUpdated, device)
+}
+
+func (r *Recorder) Delete(id string) error {
+	device, err := r.DeviceRepository.FindByID(id)
+	if err != nil {
+		return err
+	}
+	if err := r.DeviceRepository.Delete(id); err != nil {
+		return err
+	}
+	if device == nil {
+		return nil
+	}
+	err = r.record(model.DeviceDeleted, device)
+	r.devices.Delete(id)
+	return err
+}
+
+func (r *Recorder) history(deviceID string) *deviceHistory {
+	if history, ok := r.devices.Load(deviceID); ok {
+		return history.(*deviceHistory)
+	}
+	history, _ := r.devices.LoadOrStore(deviceID, &deviceHistory{})
+	return history.(*deviceHistory)
+}
+
+// record appends an event unless an update left the recorded state as it
+// was. A device stored before recording started gets its first event, with
+// the full state and no changes, on its first update.
+func (r *Recorder) record(eventType string, device *model.Device) error {
+	history := r.history(device.ID)
+	history.mutex.Lock()
+	defer history.mutex.Unlock()
+
+	latest, err := r.events.FindLatest(device.ID)
+	if err != nil {
+		log.Printf("[History] failed to read history of device %s: %v", device.ID, err)
+		return err
+	}
+
+	event := model.NewDeviceEvent(eventType, device, r.clock.Now())
+	if latest != nil {
+		event.Sequence = latest.Sequence + 1
+		if eventType == model.DeviceUpdated {
+			event.Changes = event.State.Changes(latest.State)
+			if len(event.Changes) == 0 {
+				history.state.Store(&latest.State)
+				return nil
+			}
+		}
+	} else {
+		event.Sequence = 1
+	}
+
+	if err := r.events.Append(event); err != nil {
+		log.Printf("[History] failed to record %s of device %s: %v", eventType, device.ID, err)
+		return err
+	}
+	history.state.Store(&event.State)
+	return nil
+}
+
+// Fleet replays events, oldest first, into the state of every device that
+// existed after the last of them, ordered by device ID
+func Fleet(events []*model.DeviceEvent) []*model.FleetDevice {
+	devices := make(map[string]*model.FleetDevice)
+	for _, event := range events {
+		if event.Type == model.DeviceDeleted {
+			delete(devices, event.DeviceID)
+			continue
+		}
+		devices[event.DeviceID] = &model.FleetDevice{
+			DeviceID:    event.DeviceID,
+			DeviceState: event.State,
+			Since:       event.Timestamp,
+		}
+	}
+
+	fleet := make([]*model.FleetDevice, 0, len(devices))
+	for _, device := range devices {
+		fleet = append(fleet, device)
+	}
+	sort.Slice(fleet, func(i, j int) bool {
+		return fleet[i].DeviceID < fleet[j].DeviceID
+	})
+	return fleet
+}
+
+// FleetAt reconstructs the fleet as it stood at the given instant
+func FleetAt(events repository.DeviceEventRepository, at time.Time) ([]*model.FleetDevice, error) {
+	until, err := events.FindUntil(at)
+	if err != nil {
+		return nil, err
+	}
+	return Fleet(until), nil
+}
@@ -0,0 +1,228 @@
+// Package hook lets other components observe, enrich or reject positions
+// and events as the server ingests them
+package hook
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+	"tracking/internal/core/model"
+)
+
+// PositionHandler is called after a position has been stored
+type PositionHandler func(position *model.Position)
+
+// EventHandler is called when the server raises an event
+type EventHandler func(event *model.Event)
+
+// Ingest sources reported to ReceivedHandlers
+const (
+	SourceTCP  = "tcp"
+	SourceUDP  = "udp"
+	SourceHTTP = "http"
+	SourceSMS  = "sms"
+)
+
+// ReceivedHandler is called for every position an ingest source hands to
+// the pipeline, before any hook runs
+type ReceivedHandler func(source string, position *model.Position)
+
+// RejectedHandler is called for every position a StageDecoded hook rejects
+type RejectedHandler func(position *model.Position, err error)
+
+// Stage identifies the point of the ingest pipeline a PositionHook runs at
+type Stage int
+
+const (
+	// StageDecoded runs after a position is decoded and before it is
+	// stored. Hooks may modify the position; an error rejects it.
+	StageDecoded Stage = iota
+	// StageStored runs after a position is stored. Errors are logged and
+	// do not stop the remaining hooks.
+	StageStored
+)
+
+// PositionHook enriches or vets a position at a pipeline stage
+type PositionHook func(ctx context.Context, position *model.Position) error
+
+// EventHook enriches an event before it reaches the event handlers. Errors
+// are logged and the event is still delivered.
+type EventHook func(ctx context.Context, event *model.Event) error
+
+// Registry holds the registered handlers. A nil Registry is valid and
+// dispatches to nobody.
+type Registry struct {
+	positionHandlers []PositionHandler
+	eventHandlers    []EventHandler
+	receivedHandlers []ReceivedHandler
+	rejectedHandlers []RejectedHandler
+	positionHooks    map[Stage][]PositionHook
+	eventHooks       []EventHook
+	mutex            sync.RWMutex
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// OnPosition registers a handler for stored positions
+func (r *Registry) OnPosition(handler PositionHandler) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.positionHandlers = append(r.positionHandlers, handler)
+}
+
+// OnEvent registers a handler for events
+func (r *Registry) OnEvent(handler EventHandler) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.eventHandlers = append(r.eventHandlers, handler)
+}
+
+// OnReceived registers a handler for positions entering the pipeline
+func (r *Registry) OnReceived(handler ReceivedHandler) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.receivedHandlers = append(r.receivedHandlers, handler)
+}
+
+// OnRejected registers a handler for positions rejected by a hook
+func (r *Registry) OnRejected(handler RejectedHandler) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.rejectedHandlers = append(r.rejectedHandlers, handler)
+}
+
+// RegisterPositionHook adds a hook run at the given stage, in registration order
+func (r *Registry) RegisterPositionHook(stage Stage, positionHook PositionHook) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.positionHooks == nil {
+		r.positionHooks = make(map[Stage][]PositionHook)
+	}
+	r.positionHooks[stage] = append(r.positionHooks[stage], positionHook)
+}
+
+// RegisterEventHook adds a hook run on every event, in registration order
+func (r *Registry) RegisterEventHook(eventHook EventHook) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.eventHooks = append(r.eventHooks, eventHook)
+}
+
+// RunPositionHooks runs the hooks of a stage. At StageDecoded it stops at
+// the first error and returns it; at StageStored every hook runs and
+// errors are only logged.
+func (r *Registry) RunPositionHooks(ctx context.Context, stage Stage, position *model.Position) error {
+	if r == nil {
+		return nil
+	}
+
+	r.mutex.RLock()
+	hooks := r.positionHooks[stage]
+	r.mutex.RUnlock()
+
+	for _, positionHook := range hooks {
+		err := callHook(ctx, positionHook, position)
+		if err == nil {
+			continue
+		}
+		if stage == StageStored {
+			log.Printf("[Hook] position hook failed for device %s: %v", position.DeviceID, err)
+			continue
+		}
+		r.rejected(position, err)
+		return err
+	}
+	return nil
+}
+
+// Received tells the received handlers a source handed a position to the
+// pipeline, which is when it was received unless the source said otherwise
+func (r *Registry) Received(source string, position *model.Position) {
+	if r == nil {
+		return
+	}
+	if position.ReceivedAt.IsZero() {
+		position.ReceivedAt = time.Now()
+	}
+
+	r.mutex.RLock()
+	handlers := r.receivedHandlers
+	r.mutex.RUnlock()
+
+	for _, handler := range handlers {
+		safeCall(func() { handler(source, position) })
+	}
+}
+
+func (r *Registry) rejected(position *model.Position, err error) {
+	r.mutex.RLock()
+	handlers := r.rejectedHandlers
+	r.mutex.RUnlock()
+
+	for _, handler := range handlers {
+		safeCall(func() { handler(position, err) })
+	}
+}
+
+// Position passes a stored position to every position handler
+func (r *Registry) Position(position *model.Position) {
+	if r == nil {
+		return
+	}
+
+	r.mutex.RLock()
+	handlers := r.positionHandlers
+	r.mutex.RUnlock()
+
+	for _, handler := range handlers {
+		safeCall(func() { handler(position) })
+	}
+}
+
+// Event runs the event hooks and then passes the event to every event handler
+func (r *Registry) Event(event *model.Event) {
+	if r == nil {
+		return
+	}
+
+	r.mutex.RLock()
+	hooks := r.eventHooks
+	handlers := r.eventHandlers
+	r.mutex.RUnlock()
+
+	for _, eventHook := range hooks {
+		safeCall(func() {
+			if err := eventHook(context.Background(), event); err != nil {
+				log.Printf("[Hook] event hook failed for device %s: %v", event.DeviceID, err)
+			}
+		})
+	}
+
+	for _, handler := range handlers {
+		safeCall(func() { handler(event) })
+	}
+}
+
+// callHook turns a panicking hook into an error
+func callHook(ctx context.Context, positionHook PositionHook, position *model.Position) (err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = fmt.Errorf("position hook panicked: %v", rec)
+		}
+	}()
+	return positionHook(ctx, position)
+}
+
+// safeCall keeps a panicking handler from taking down the ingest path
+func safeCall(fn func()) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			log.Printf("[Hook] handler panicked: %v", rec)
+		}
+	}()
+	fn()
+}
@@ -0,0 +1,137 @@
+// Package job runs long tasks in the background and keeps their progress
+// for clients to poll
+package job
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+	"tracking/internal/core/model"
+	"tracking/internal/core/util"
+)
+
+// DefaultRetention is how long finished jobs stay available
+const DefaultRetention = 24 * time.Hour
+
+// Manager tracks the jobs it started. Jobs live in memory only, so a
+// restart forgets them along with any work in progress.
+type Manager struct {
+	jobs      map[string]*model.Job
+	mutex     sync.RWMutex
+	clock     util.Clock
+	retention time.Duration
+	wg        sync.WaitGroup
+}
+
+func NewManager(clock util.Clock) *Manager {
+	return &Manager{
+		jobs:      make(map[string]*model.Job),
+		clock:     clock,
+		retention: DefaultRetention,
+	}
+}
+
+// Progress lets a running job report how far it got
+type Progress struct {
+	manager *Manager
+	id      string
+}
+
+// SetTotal sets how many items the job will process
+func (p *Progress) SetTotal(total int) {
+	p.update(func(job *model.Job) { job.Total = total })
+}
+
+// Processed counts n items done
+func (p *Progress) Processed(n int) {
+	p.update(func(job *model.Job) { job.Processed += n })
+}
+
+// Skipped counts n items passed over
+func (p *Progress) Skipped(n int) {
+	p.update(func(job *model.Job) { job.Skipped += n })
+}
+
+func (p *Progress) update(fn func(job *model.Job)) {
+	p.manager.mutex.Lock()
+	defer p.manager.mutex.Unlock()
+	fn(p.manager.jobs[p.id])
+}
+
+// Start runs fn in the background as a job of the given type on behalf of
+// a user and device, and returns a snapshot of the job. An error or panic
+// from fn fails the job.
+func (m *Manager) Start(jobType, userID, deviceID string, fn func(progress *Progress) error) *model.Job {
+	m.prune()
+
+	job := &model.Job{
+		ID:        util.GenerateID(),
+		Type:      jobType,
+		UserID:    userID,
+		DeviceID:  deviceID,
+		Status:    model.JobRunning,
+		CreatedAt: m.clock.Now(),
+	}
+	m.mutex.Lock()
+	m.jobs[job.ID] = job
+	snapshot := *job
+	m.mutex.Unlock()
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		err := run(fn, &Progress{manager: m, id: job.ID})
+
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+		finished := m.clock.Now()
+		job.FinishedAt = &finished
+		job.Status = model.JobCompleted
+		if err != nil {
+			log.Printf("Job %s (%s) failed: %v", job.ID, job.Type, err)
+			job.Status = model.JobFailed
+			job.Error = err.Error()
+		}
+	}()
+	return &snapshot
+}
+
+// run calls fn, turning a panic into an error
+func run(fn func(progress *Progress) error, progress *Progress) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+	return fn(progress)
+}
+
+// Get returns a snapshot of the job, or nil when unknown or forgotten
+func (m *Manager) Get(id string) *model.Job {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	job, ok := m.jobs[id]
+	if !ok {
+		return nil
+	}
+	snapshot := *job
+	return &snapshot
+}
+
+// Wait blocks until every job started so far has finished
+func (m *Manager) Wait() {
+	m.wg.Wait()
+}
+
+// prune forgets jobs finished longer ago than the retention
+func (m *Manager) prune() {
+	cutoff := m.clock.Now().Add(-m.retention)
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for id, job := range m.jobs {
+		if job.FinishedAt != nil && job.FinishedAt.Before(cutoff) {
+			delete(m.jobs, id)
+		}
+	}
+}
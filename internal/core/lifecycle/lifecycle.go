@@ -0,0 +1,132 @@
+// Package lifecycle raises events as devices are created, deleted and
+// passed to another owner, alongside the online and offline events of the
+// servers, so systems outside the server can mirror the fleet
+package lifecycle
+
+import (
+	"log"
+	"sync"
+	"tracking/internal/core/hook"
+	"tracking/internal/core/model"
+	"tracking/internal/core/repository"
+	"tracking/internal/core/util"
+)
+
+// Events are the event types of the lifecycle of a device
+var Events = []string{
+	model.EventDeviceCreated,
+	model.EventDeviceDeleted,
+	model.EventDeviceTransferred,
+	model.EventDeviceOnline,
+	model.EventDeviceOffline,
+}
+
+type owner struct {
+	userID         string
+	organizationID string
+}
+
+// Devices is a DeviceRepository raising an event for every device created,
+// deleted or transferred through it
+type Devices struct {
+	repository.DeviceRepository
+	hooks *hook.Registry
+	clock util.Clock
+
+	mutex sync.Mutex
+	// Owners as last stored, by device ID. The memory repository hands out
+	// the device it stores, so an update cannot be compared with what the
+	// repository holds.
+	owners map[string]owner
+}
+
+func NewDevices(devices repository.DeviceRepository, hooks *hook.Registry, clock util.Clock) *Devices {
+	return &Devices{
+		DeviceRepository: devices,
+		hooks:            hooks,
+		clock:            clock,
+		owners:           make(map[string]owner),
+	}
+}
+
+func (d *Devices) Create(device *model.Device) error {
+	if err := d.DeviceRepository.Create(device); err != nil {
+		return err
+	}
+	d.remember(device)
+
+	event := d.event(model.EventDeviceCreated, device)
+	event.Attributes["userId"] = device.UserID
+	event.Attributes["organizationId"] = device.OrganizationID
+	d.hooks.Event(event)
+	return nil
+}
+
+func (d *Devices) Update(device *model.Device) error {
+	d.mutex.Lock()
+	previous, known := d.owners[device.ID]
+	d.mutex.Unlock()
+	if !known {
+		stored, err := d.DeviceRepository.FindByID(device.ID)
+		if err != nil {
+			log.Printf("[Lifecycle] failed to read device %s before update: %v", device.ID, err)
+		}
+		if stored != nil {
+			previous = owner{stored.UserID, stored.OrganizationID}
+		}
+	}
+
+	if err := d.DeviceRepository.Update(device); err != nil {
+		return err
+	}
+	current := d.remember(device)
+	if current == previous {
+		return nil
+	}
+
+	event := d.event(model.EventDeviceTransferred, device)
+	event.Attributes["previousUserId"] = previous.userID
+	event.Attributes["previousOrganizationId"] = previous.organizationID
+	event.Attributes["userId"] = current.userID
+	event.Attributes["organizationId"] = current.organizationID
+	d.hooks.Event(event)
+	return nil
+}
+
+func (d *Devices) Delete(id string) error {
+	device, err := d.DeviceRepository.FindByID(id)
+	if err != nil {
+		return err
+	}
+	if err := d.DeviceRepository.Delete(id); err != nil {
+		return err
+	}
+	d.mutex.Lock()
+	delete(d.owners, id)
+	d.mutex.Unlock()
+	if device == nil {
+		return nil
+	}
+
+	d.hooks.Event(d.event(model.EventDeviceDeleted, device))
+	return nil
+}
+
+func (d *Devices) remember(device *model.Device) owner {
+	current := owner{device.UserID, device.OrganizationID}
+	d.mutex.Lock()
+	d.owners[device.ID] = current
+	d.mutex.Unlock()
+	return current
+}
+
+// event returns an event naming the device, which outlives it once deleted
+func (d *Devices) event(eventType string, device *model.Device) *model.Event {
+	event := model.NewEvent(eventType, device.ID, d.clock.Now())
+	event.Attributes["name"] = device.Name
+	event.Attributes["uniqueId"] = device.UniqueID
+	if len(device.ExternalIDs) > 0 {
+		event.Attributes[model.AttributeExternalIDs] = device.ExternalIDs
+	}
+	return event
+}
@@ -0,0 +1,88 @@
+// Package locale picks the language responses are rendered in and holds
+// the translated messages
+package locale
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Default is used when neither the user nor the request names a supported
+// locale
+const Default = "en"
+
+// Supported lists the locales messages are translated to
+var Supported = []string{"en", "fr", "ar"}
+
+type contextKey struct{}
+
+// IsSupported reports whether messages are translated to tag
+func IsSupported(tag string) bool {
+	for _, supported := range Supported {
+		if tag == supported {
+			return true
+		}
+	}
+	return false
+}
+
+// Negotiate returns the supported locale best matching an Accept-Language
+// header. Tags are tried by decreasing quality; a regional tag such as
+// fr-CA falls back to its language.
+func Negotiate(acceptLanguage string) string {
+	type candidate struct {
+		tag     string
+		quality float64
+	}
+
+	var candidates []candidate
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		quality := 1.0
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(q, 64)
+			if err != nil {
+				continue
+			}
+			quality = parsed
+		}
+		if tag = strings.ToLower(strings.TrimSpace(tag)); tag != "" && quality > 0 {
+			candidates = append(candidates, candidate{tag, quality})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].quality > candidates[j].quality })
+
+	for _, c := range candidates {
+		if c.tag == "*" {
+			return Default
+		}
+		if IsSupported(c.tag) {
+			return c.tag
+		}
+		if base, _, ok := strings.Cut(c.tag, "-"); ok && IsSupported(base) {
+			return base
+		}
+	}
+	return Default
+}
+
+// NewContext returns a context carrying the response locale
+func NewContext(ctx context.Context, tag string) context.Context {
+	return context.WithValue(ctx, contextKey{}, tag)
+}
+
+// Lookup returns the response locale of a context and whether one was set
+func Lookup(ctx context.Context) (string, bool) {
+	tag, ok := ctx.Value(contextKey{}).(string)
+	return tag, ok
+}
+
+// FromContext returns the response locale of a context, or Default
+func FromContext(ctx context.Context) string {
+	if tag, ok := Lookup(ctx); ok {
+		return tag
+	}
+	return Default
+}
@@ -0,0 +1,49 @@
+package locale
+
+// Message keys. The key is the English text, so an untranslated message
+// still reads correctly.
+const (
+	MsgAuthorizationRequired = "Authorization header is required"
+	MsgInvalidAuthorization  = "Invalid authorization header format"
+	MsgInvalidToken          = "Invalid token"
+	MsgTokenExpired          = "Token has expired"
+	MsgInvalidAuthToken      = "Invalid authorization token"
+	MsgAdminRequired         = "Admin access required"
+	MsgUnsupportedLocale     = "Unsupported locale"
+	MsgNotOrganizationMember = "Not a member of the organization"
+	MsgFeatureNotAllowed     = "Feature not available to the organization"
+)
+
+var translations = map[string]map[string]string{
+	"fr": {
+		MsgAuthorizationRequired: "L'en-tête Authorization est requis",
+		MsgInvalidAuthorization:  "Format de l'en-tête Authorization invalide",
+		MsgInvalidToken:          "Jeton invalide",
+		MsgTokenExpired:          "Le jeton a expiré",
+		MsgInvalidAuthToken:      "Jeton d'autorisation invalide",
+		MsgAdminRequired:         "Accès administrateur requis",
+		MsgUnsupportedLocale:     "Langue non prise en charge",
+		MsgNotOrganizationMember: "Vous n'êtes pas membre de l'organisation",
+		MsgFeatureNotAllowed:     "Fonctionnalité non disponible pour l'organisation",
+	},
+	"ar": {
+		MsgAuthorizationRequired: "ترويسة التفويض مطلوبة",
+		MsgInvalidAuthorization:  "صيغة ترويسة التفويض غير صالحة",
+		MsgInvalidToken:          "رمز غير صالح",
+		MsgTokenExpired:          "انتهت صلاحية الرمز",
+		MsgInvalidAuthToken:      "رمز التفويض غير صالح",
+		MsgAdminRequired:         "يلزم وصول المسؤول",
+		MsgUnsupportedLocale:     "اللغة غير مدعومة",
+		MsgNotOrganizationMember: "لست عضوًا في المنظمة",
+		MsgFeatureNotAllowed:     "الميزة غير متاحة للمنظمة",
+	},
+}
+
+// Message returns the text of a message key in a locale, falling back to
+// the English key
+func Message(tag, key string) string {
+	if text, ok := translations[tag][key]; ok {
+		return text
+	}
+	return key
+}
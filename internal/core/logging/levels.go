@@ -0,0 +1,238 @@
+// Package logging decides at runtime which log lines are written, so an
+// operator can turn on debug output for one module or one device while
+// chasing a problem and have it turn itself off again
+package logging
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"tracking/internal/core/model"
+	"tracking/internal/core/util"
+)
+
+// Level orders log lines by severity
+type Level int
+
+const (
+	Debug Level = iota
+	Info
+	Warn
+	Error
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+func (l Level) String() string {
+	if l < Debug || l > Error {
+		return fmt.Sprintf("level(%d)", int(l))
+	}
+	return levelNames[l]
+}
+
+// ParseLevel reads a level name such as LOG_LEVEL holds
+func ParseLevel(name string) (Level, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "warning" {
+		name = "warn"
+	}
+	for i, levelName := range levelNames {
+		if name == levelName {
+			return Level(i), nil
+		}
+	}
+	return Info, fmt.Errorf("%w: unknown level %q", ErrInvalidOverride, name)
+}
+
+// Modules whose logging can be overridden
+const (
+	ModuleTCPServer = "tcp_server"
+	ModuleUDPServer = "udp_server"
+	ModuleGT06      = "gt06"
+	ModuleCache     = "cache"
+)
+
+// Modules lists the modules that take overrides
+var Modules = []string{ModuleCache, ModuleGT06, ModuleTCPServer, ModuleUDPServer}
+
+const (
+	// DefaultOverrideDuration is how long an override lasts when the
+	// request does not say
+	DefaultOverrideDuration = 15 * time.Minute
+	// MaxOverrideDuration keeps a forgotten override from flooding the
+	// logs for days
+	MaxOverrideDuration = 24 * time.Hour
+)
+
+// ErrInvalidOverride rejects an override of an unknown module or level, of
+// both a module and a device, or of neither
+var ErrInvalidOverride = errors.New("invalid log override")
+
+// override is a level in effect until it expires
+type override struct {
+	level     Level
+	expiresAt time.Time
+}
+
+// Levels holds the level logs are written at and the overrides raising or
+// lowering it. Overrides revert on their own: one past its expiry is
+// ignored and dropped the next time it is looked at. A nil Levels writes
+// every line, as the servers did before it existed.
+type Levels struct {
+	base  Level
+	clock util.Clock
+
+	mutex   sync.RWMutex
+	modules map[string]override
+	devices map[string]override
+}
+
+// New returns levels writing lines at base and above
+func New(base Level, clock util.Clock) *Levels {
+	return &Levels{
+		base:    base,
+		clock:   clock,
+		modules: make(map[string]override),
+		devices: make(map[string]override),
+	}
+}
+
+// Enabled reports whether the module writes lines at the level
+func (l *Levels) Enabled(module string, level Level) bool {
+	if l == nil {
+		return true
+	}
+	return level >= l.effective(l.modules, module)
+}
+
+// DeviceEnabled reports whether lines at the level are written about the
+// device. Without an override of its own a device follows the base level.
+func (l *Levels) DeviceEnabled(deviceID string, level Level) bool {
+	if l == nil {
+		return true
+	}
+	return level >= l.effective(l.devices, deviceID)
+}
+
+// effective returns the level of an override, or the base level when the
+// key has none in effect
+func (l *Levels) effective(overrides map[string]override, key string) Level {
+	now := l.clock.Now()
+	l.mutex.RLock()
+	o, ok := overrides[key]
+	l.mutex.RUnlock()
+	if !ok {
+		return l.base
+	}
+	if !now.Before(o.expiresAt) {
+		l.mutex.Lock()
+		if current, ok := overrides[key]; ok && !now.Before(current.expiresAt) {
+			delete(overrides, key)
+			log.Printf("Log level override of %s expired", key)
+		}
+		l.mutex.Unlock()
+		return l.base
+	}
+	return o.level
+}
+
+// Set overrides the level of a module or a device for a while, replacing
+// any override it had. A zero duration lasts DefaultOverrideDuration.
+func (l *Levels) Set(module, deviceID, levelName string, duration time.Duration) (*model.LogOverride, error) {
+	if (module == "") == (deviceID == "") {
+		return nil, fmt.Errorf("%w: name either a module or a device", ErrInvalidOverride)
+	}
+	if module != "" && !knownModule(module) {
+		return nil, fmt.Errorf("%w: unknown module %q", ErrInvalidOverride, module)
+	}
+	level, err := ParseLevel(levelName)
+	if err != nil {
+		return nil, err
+	}
+	if duration == 0 {
+		duration = DefaultOverrideDuration
+	}
+	if duration < 0 || duration > MaxOverrideDuration {
+		return nil, fmt.Errorf("%w: duration must be positive and at most %s", ErrInvalidOverride, MaxOverrideDuration)
+	}
+
+	o := override{level: level, expiresAt: l.clock.Now().Add(duration)}
+	l.mutex.Lock()
+	if module != "" {
+		l.modules[module] = o
+		log.Printf("Logging module %s at %s until %s", module, level, o.expiresAt.Format(time.RFC3339))
+	} else {
+		l.devices[deviceID] = o
+		log.Printf("Logging device %s at %s until %s", deviceID, level, o.expiresAt.Format(time.RFC3339))
+	}
+	l.mutex.Unlock()
+
+	return &model.LogOverride{
+		Module:    module,
+		DeviceID:  deviceID,
+		Level:     level.String(),
+		ExpiresAt: o.expiresAt,
+	}, nil
+}
+
+// Reset drops the override of a module or a device ahead of its expiry,
+// reporting whether there was one
+func (l *Levels) Reset(module, deviceID string) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	overrides, key := l.modules, module
+	if module == "" {
+		overrides, key = l.devices, deviceID
+	}
+	if _, ok := overrides[key]; !ok {
+		return false
+	}
+	delete(overrides, key)
+	log.Printf("Log level override of %s reset", key)
+	return true
+}
+
+// Snapshot returns the base level and the overrides still in effect,
+// those of modules first
+func (l *Levels) Snapshot() *model.LogLevels {
+	now := l.clock.Now()
+	snapshot := &model.LogLevels{
+		Level:     l.base.String(),
+		Modules:   Modules,
+		Overrides: []*model.LogOverride{},
+	}
+
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	for module, o := range l.modules {
+		if now.Before(o.expiresAt) {
+			snapshot.Overrides = append(snapshot.Overrides, &model.LogOverride{Module: module, Level: o.level.String(), ExpiresAt: o.expiresAt})
+		}
+	}
+	for deviceID, o := range l.devices {
+		if now.Before(o.expiresAt) {
+			snapshot.Overrides = append(snapshot.Overrides, &model.LogOverride{DeviceID: deviceID, Level: o.level.String(), ExpiresAt: o.expiresAt})
+		}
+	}
+	sort.Slice(snapshot.Overrides, func(i, j int) bool {
+		a, b := snapshot.Overrides[i], snapshot.Overrides[j]
+		if (a.Module == "") != (b.Module == "") {
+			return a.Module != ""
+		}
+		return a.Module+a.DeviceID < b.Module+b.DeviceID
+	})
+	return snapshot
+}
+
+func knownModule(module string) bool {
+	for _, known := range Modules {
+		if module == known {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,221 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"tracking/internal/core/util"
+)
+
+const (
+	s3Algorithm      = "AWS4-HMAC-SHA256"
+	s3DateLayout     = "20060102T150405Z"
+	s3UnsignedBody   = "UNSIGNED-PAYLOAD"
+	s3MaxPresignTime = 7 * 24 * time.Hour
+)
+
+// S3Config locates a bucket of an S3-compatible object store
+type S3Config struct {
+	Endpoint  string // Such as https://s3.eu-west-1.amazonaws.com or http://minio:9000
+	Bucket    string
+	Region    string
+	AccessKey string
+	SecretKey string
+	// PathStyle addresses the bucket in the path rather than the host name,
+	// as MinIO and most self-hosted stores expect
+	PathStyle bool
+}
+
+// S3Store keeps content in an S3-compatible bucket, signing requests with
+// AWS Signature Version 4
+type S3Store struct {
+	config   S3Config
+	endpoint *url.URL
+	client   *http.Client
+	clock    util.Clock
+}
+
+func NewS3Store(config S3Config, clock util.Clock) (*S3Store, error) {
+	endpoint, err := url.Parse(config.Endpoint)
+	if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid S3 endpoint %q", config.Endpoint)
+	}
+	if config.Bucket == "" || config.AccessKey == "" || config.SecretKey == "" {
+		return nil, errors.New("S3 storage needs a bucket and credentials")
+	}
+	if config.Region == "" {
+		config.Region = "us-east-1"
+	}
+
+	return &S3Store{
+		config:   config,
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: 60 * time.Second},
+		clock:    clock,
+	}, nil
+}
+
+func (s *S3Store) Put(ctx context.Context, key, contentType string, data []byte) error {
+	host, path := s.location(key)
+	sum := sha256.Sum256(data)
+	payloadHash := hex.EncodeToString(sum[:])
+	now := s.clock.Now().UTC()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, s.endpoint.Scheme+"://"+host+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	req.Header.Set("X-Amz-Date", now.Format(s3DateLayout))
+
+	headers := map[string]string{
+		"content-type":         contentType,
+		"host":                 host,
+		"x-amz-content-sha256": payloadHash,
+		"x-amz-date":           now.Format(s3DateLayout),
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonical := strings.Join([]string{http.MethodPut, path, "", canonicalHeaders.String(), signedHeaders, payloadHash}, "\n")
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3Algorithm, s.config.AccessKey, s.scope(now), signedHeaders, s.sign(now, canonical)))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to store %s: %v", key, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("failed to store %s: status %d: %s", key, resp.StatusCode, bytes.TrimSpace(body))
+	}
+	return nil
+}
+
+func (s *S3Store) Get(ctx context.Context, key string) ([]byte, string, error) {
+	link, err := s.PresignGet(key, time.Minute)
+	if err != nil {
+		return nil, "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return nil, "", err
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to fetch %s: %v", key, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, "", ErrNotFound
+	}
+	if resp.StatusCode/100 != 2 {
+		return nil, "", fmt.Errorf("failed to fetch %s: status %d", key, resp.StatusCode)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", err
+	}
+	return data, resp.Header.Get("Content-Type"), nil
+}
+
+// PresignGet returns a URL fetching the content under key from the store
+// directly until it expires, at most a week from now
+func (s *S3Store) PresignGet(key string, expires time.Duration) (string, error) {
+	if expires <= 0 || expires > s3MaxPresignTime {
+		return "", fmt.Errorf("presigned URLs last between 1s and %s, not %s", s3MaxPresignTime, expires)
+	}
+	host, path := s.location(key)
+	now := s.clock.Now().UTC()
+
+	query := map[string]string{
+		"X-Amz-Algorithm":     s3Algorithm,
+		"X-Amz-Credential":    s.config.AccessKey + "/" + s.scope(now),
+		"X-Amz-Date":          now.Format(s3DateLayout),
+		"X-Amz-Expires":       strconv.Itoa(int(expires / time.Second)),
+		"X-Amz-SignedHeaders": "host",
+	}
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = s3Escape(name, true) + "=" + s3Escape(query[name], true)
+	}
+	canonicalQuery := strings.Join(pairs, "&")
+
+	canonical := strings.Join([]string{http.MethodGet, path, canonicalQuery, "host:" + host + "\n", "host", s3UnsignedBody}, "\n")
+	return fmt.Sprintf("%s://%s%s?%s&X-Amz-Signature=%s", s.endpoint.Scheme, host, path, canonicalQuery, s.sign(now, canonical)), nil
+}
+
+// location returns the host and escaped path of the object under key
+func (s *S3Store) location(key string) (string, string) {
+	base := strings.TrimSuffix(s.endpoint.EscapedPath(), "/")
+	if s.config.PathStyle {
+		return s.endpoint.Host, base + "/" + s3Escape(s.config.Bucket, true) + "/" + s3Escape(key, false)
+	}
+	return s.config.Bucket + "." + s.endpoint.Host, base + "/" + s3Escape(key, false)
+}
+
+func (s *S3Store) scope(now time.Time) string {
+	return now.Format("20060102") + "/" + s.config.Region + "/s3/aws4_request"
+}
+
+// sign derives the day's signing key and signs a canonical request
+func (s *S3Store) sign(now time.Time, canonical string) string {
+	hash := sha256.Sum256([]byte(canonical))
+	stringToSign := strings.Join([]string{s3Algorithm, now.Format(s3DateLayout), s.scope(now), hex.EncodeToString(hash[:])}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.config.SecretKey), now.Format("20060102"))
+	key = hmacSHA256(key, s.config.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// s3Escape percent-encodes all but the unreserved characters, and slashes
+// too unless they separate path segments
+func s3Escape(s string, escapeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '.', c == '_', c == '~', c == '/' && !escapeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
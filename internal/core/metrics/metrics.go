@@ -0,0 +1,270 @@
+// Package metrics keeps the aggregate operational figures published on the
+// public status page. Nothing in it identifies a device, user or request.
+package metrics
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"tracking/internal/core/util"
+)
+
+const (
+	// Ingest is counted in one-second buckets over this window
+	ingestWindow = 5 * time.Minute
+	// Percentiles are taken over the most recent requests
+	latencySamples = 1024
+)
+
+// Probe reports whether a listener is accepting connections
+type Probe func() bool
+
+// Recorder collects ingest counts, API latencies and listener health
+type Recorder struct {
+	clock   util.Clock
+	started time.Time
+
+	mutex      sync.Mutex
+	buckets    []int64 // Positions per second, indexed by Unix second modulo the window
+	stamps     []int64 // Unix second each bucket was last written for
+	total      int64
+	warnings   map[string]int64 // Decode warnings of stored positions, by code
+	latencies  []time.Duration  // Ring of recent request durations
+	next       int              // Ring write position
+	requests   int64
+	ingest     []ingestSample // Ring of recent receipt-to-storage latencies
+	nextIngest int
+	probes     map[string]Probe
+}
+
+type ingestSample struct {
+	at      time.Time
+	latency time.Duration
+}
+
+func NewRecorder(clock util.Clock) *Recorder {
+	seconds := int(ingestWindow / time.Second)
+	return &Recorder{
+		clock:     clock,
+		started:   clock.Now(),
+		buckets:   make([]int64, seconds),
+		stamps:    make([]int64, seconds),
+		warnings:  make(map[string]int64),
+		latencies: make([]time.Duration, 0, latencySamples),
+		ingest:    make([]ingestSample, 0, latencySamples),
+		probes:    make(map[string]Probe),
+	}
+}
+
+// AddProbe registers a listener health check under a public name
+func (r *Recorder) AddProbe(name string, probe Probe) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.probes[name] = probe
+}
+
+// RecordPositions counts stored positions
+func (r *Recorder) RecordPositions(n int) {
+	second := r.clock.Now().Unix()
+	i := int(second % int64(len(r.buckets)))
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.stamps[i] != second {
+		r.stamps[i] = second
+		r.buckets[i] = 0
+	}
+	r.buckets[i] += int64(n)
+	r.total += int64(n)
+}
+
+// RecordWarnings counts the decode warnings of a stored position by code
+func (r *Recorder) RecordWarnings(codes ...string) {
+	if len(codes) == 0 {
+		return
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, code := range codes {
+		r.warnings[code]++
+	}
+}
+
+// ObserveRequest records how long an API request took
+func (r *Recorder) ObserveRequest(duration time.Duration) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if len(r.latencies) < latencySamples {
+		r.latencies = append(r.latencies, duration)
+	} else {
+		r.latencies[r.next] = duration
+	}
+	r.next = (r.next + 1) % latencySamples
+	r.requests++
+}
+
+// ObserveIngest records how long a position took from the server getting
+// its frame to being stored
+func (r *Recorder) ObserveIngest(latency time.Duration) {
+	sample := ingestSample{at: r.clock.Now(), latency: latency}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if len(r.ingest) < latencySamples {
+		r.ingest = append(r.ingest, sample)
+	} else {
+		r.ingest[r.nextIngest] = sample
+	}
+	r.nextIngest = (r.nextIngest + 1) % latencySamples
+}
+
+// IngestLatency returns the 95th percentile of the recent ingest latencies
+// and how many it was taken over
+func (r *Recorder) IngestLatency() (time.Duration, int) {
+	latencies := r.recentIngest()
+	if len(latencies) == 0 {
+		return 0, 0
+	}
+	return latencies[rank(len(latencies), 0.95)], len(latencies)
+}
+
+// recentIngest returns the ingest latencies of the window, sorted
+func (r *Recorder) recentIngest() []time.Duration {
+	since := r.clock.Now().Add(-ingestWindow)
+
+	r.mutex.Lock()
+	latencies := make([]time.Duration, 0, len(r.ingest))
+	for _, sample := range r.ingest {
+		if sample.at.After(since) {
+			latencies = append(latencies, sample.latency)
+		}
+	}
+	r.mutex.Unlock()
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	return latencies
+}
+
+// Status is the public snapshot served by the status endpoint
+type Status struct {
+	Status        string            `json:"status"` // "ok", or "degraded" when a listener is down
+	StartedAt     time.Time         `json:"startedAt"`
+	UptimeSeconds int64             `json:"uptimeSeconds"`
+	Ingest        IngestStatus      `json:"ingest"`
+	API           APIStatus         `json:"api"`
+	Listeners     map[string]string `json:"listeners"` // "up" or "down" by listener
+}
+
+// IngestStatus describes the rate positions are being stored at
+type IngestStatus struct {
+	LastMinute        int64   `json:"lastMinute"`
+	LastFiveMinutes   int64   `json:"lastFiveMinutes"`
+	PerSecond         float64 `json:"perSecond"` // Averaged over the last minute
+	TotalSinceStartup int64   `json:"totalSinceStartup"`
+	// Decode warnings of the positions stored since startup, by code
+	Warnings map[string]int64 `json:"warnings"`
+	Latency  LatencyStatus    `json:"latency"`
+}
+
+// LatencyStatus summarises how long recent positions took from the server
+// getting their frame to being served as the latest, in milliseconds
+type LatencyStatus struct {
+	Samples int     `json:"samples"` // Positions stored in the last five minutes, up to 1024
+	P50     float64 `json:"p50Ms"`
+	P95     float64 `json:"p95Ms"`
+	P99     float64 `json:"p99Ms"`
+}
+
+// APIStatus summarises recent request latencies in milliseconds
+type APIStatus struct {
+	Requests int64   `json:"requests"`
+	P50      float64 `json:"p50Ms"`
+	P95      float64 `json:"p95Ms"`
+	P99      float64 `json:"p99Ms"`
+}
+
+// Snapshot returns the current figures
+func (r *Recorder) Snapshot() Status {
+	now := r.clock.Now()
+	second := now.Unix()
+
+	r.mutex.Lock()
+	var lastMinute, lastFive int64
+	for i, stamp := range r.stamps {
+		age := second - stamp
+		if age < 0 || age >= int64(len(r.buckets)) {
+			continue
+		}
+		lastFive += r.buckets[i]
+		if age < 60 {
+			lastMinute += r.buckets[i]
+		}
+	}
+	latencies := append([]time.Duration(nil), r.latencies...)
+	status := Status{
+		Status:        "ok",
+		StartedAt:     r.started,
+		UptimeSeconds: int64(now.Sub(r.started) / time.Second),
+		Ingest: IngestStatus{
+			LastMinute:        lastMinute,
+			LastFiveMinutes:   lastFive,
+			PerSecond:         float64(lastMinute) / 60,
+			TotalSinceStartup: r.total,
+			Warnings:          make(map[string]int64, len(r.warnings)),
+		},
+		API:       APIStatus{Requests: r.requests},
+		Listeners: make(map[string]string, len(r.probes)),
+	}
+	for code, n := range r.warnings {
+		status.Ingest.Warnings[code] = n
+	}
+	probes := make(map[string]Probe, len(r.probes))
+	for name, probe := range r.probes {
+		probes[name] = probe
+	}
+	r.mutex.Unlock()
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	status.API.P50 = percentile(latencies, 0.50)
+	status.API.P95 = percentile(latencies, 0.95)
+	status.API.P99 = percentile(latencies, 0.99)
+
+	ingest := r.recentIngest()
+	status.Ingest.Latency = LatencyStatus{
+		Samples: len(ingest),
+		P50:     percentile(ingest, 0.50),
+		P95:     percentile(ingest, 0.95),
+		P99:     percentile(ingest, 0.99),
+	}
+
+	for name, probe := range probes {
+		status.Listeners[name] = "up"
+		if !probe() {
+			status.Listeners[name] = "down"
+			status.Status = "degraded"
+		}
+	}
+	return status
+}
+
+// percentile returns the nearest-rank percentile of sorted durations in ms
+func percentile(sorted []time.Duration, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	return float64(sorted[rank(len(sorted), p)]) / float64(time.Millisecond)
+}
+
+// rank returns the index of the nearest-rank percentile among n sorted values
+func rank(n int, p float64) int {
+	i := int(math.Ceil(p*float64(n))) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= n {
+		i = n - 1
+	}
+	return i
+}
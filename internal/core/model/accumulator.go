@@ -0,0 +1,159 @@
+package model
+
+import (
+	"time"
+	"tracking/internal/core/util"
+)
+
+// Position attributes stamped with the totals of the device
+const (
+	AttributeTotalDistance = "totalDistance" // m
+	AttributeEngineHours   = "engineHours"   // h
+)
+
+// AttributeHourMeter is the engine hour meter a device reports, in hours.
+// Profiles and computed attributes name a decoder's own reading this.
+const AttributeHourMeter = "hourMeter"
+
+// MaxEngineGap bounds the time between two positions counted as engine
+// time; a device silent for longer may have been switched off meanwhile
+const MaxEngineGap = time.Hour
+
+// MaxFixSpeed is the speed in m/s above which the move between two fixes
+// is taken for a jump of the receiver rather than travel, counting no
+// distance. 360 km/h leaves room for fast vehicles reporting rarely.
+const MaxFixSpeed = 100.0
+
+// Accumulators are the running totals of a device: the distance it has
+// covered and the time its engine has run. Positions are stamped with the
+// totals as of their time.
+type Accumulators struct {
+	DeviceID      string    `json:"deviceId"`
+	TotalDistance float64   `json:"totalDistance"` // m
+	EngineHours   float64   `json:"engineHours"`   // h
+	Timestamp     time.Time `json:"timestamp"`     // Of the latest position counted
+	Ignition      bool      `json:"ignition"`      // As of that position
+	// Latest valid fix, which the next one is measured from
+	HasFix    bool      `json:"-"`
+	Latitude  float64   `json:"-"`
+	Longitude float64   `json:"-"`
+	FixTime   time.Time `json:"-"`
+	// Latest hour meter reading, which the next one is counted from
+	HasHourMeter bool    `json:"-"`
+	HourMeter    float64 `json:"-"`
+}
+
+// Advance counts a position newer than the latest one: the distance from
+// the previous valid fix unless it jumped there, and the time since the
+// previous position when the engine was on. A device reporting an hour
+// meter has its engine time counted from the meter instead; a meter that
+// went back, having been reset or replaced, is followed from its new
+// reading. Advance reports false, counting nothing, for a position older
+// than the latest.
+func (a *Accumulators) Advance(position *Position) bool {
+	if !a.Timestamp.IsZero() && position.Timestamp.Before(a.Timestamp) {
+		return false
+	}
+
+	if meter, ok := position.Status[AttributeHourMeter].(float64); ok && meter >= 0 {
+		if a.HasHourMeter && meter >= a.HourMeter {
+			a.EngineHours += meter - a.HourMeter
+		}
+		a.HasHourMeter, a.HourMeter = true, meter
+	} else if a.Ignition && !a.Timestamp.IsZero() {
+		if elapsed := position.Timestamp.Sub(a.Timestamp); elapsed <= MaxEngineGap {
+			a.EngineHours += elapsed.Hours()
+		}
+	}
+	if position.Valid {
+		if a.HasFix {
+			distance := util.Distance(a.Latitude, a.Longitude, position.Latitude, position.Longitude)
+			if !IsJump(distance, position.Timestamp.Sub(a.FixTime)) {
+				a.TotalDistance += distance
+			}
+		}
+		// A jump is measured from too, so a receiver jumping back also
+		// counts nothing and one that really moved carries on from there
+		a.HasFix, a.Latitude, a.Longitude, a.FixTime = true, position.Latitude, position.Longitude, position.Timestamp
+	}
+	a.Timestamp = position.Timestamp
+	if on, ok := Ignition(position); ok {
+		a.Ignition = on
+	}
+	return true
+}
+
+// IsJump reports whether covering distance meters in elapsed time would
+// take more than MaxFixSpeed
+func IsJump(distance float64, elapsed time.Duration) bool {
+	if elapsed <= 0 {
+		return distance > 0
+	}
+	return distance/elapsed.Seconds() > MaxFixSpeed
+}
+
+// Reset sets the totals the baseline gives. Distance is measured again
+// from the next fix and engine time counted from the effective time.
+func (a *Accumulators) Reset(baseline *AccumulatorBaseline) {
+	if baseline.TotalDistance != nil {
+		a.TotalDistance = *baseline.TotalDistance
+		a.HasFix = false
+	}
+	if baseline.EngineHours != nil {
+		a.EngineHours = *baseline.EngineHours
+		if a.Timestamp.Before(baseline.EffectiveAt) {
+			a.Timestamp = baseline.EffectiveAt
+		}
+	}
+}
+
+// Stamp records the totals in the status of the position
+func (a *Accumulators) Stamp(position *Position) {
+	if position.Status == nil {
+		position.Status = make(map[string]interface{})
+	}
+	position.Status[AttributeTotalDistance] = a.TotalDistance
+	position.Status[AttributeEngineHours] = a.EngineHours
+}
+
+// Accumulate replays positions sorted by time from zero, applying each
+// baseline once the positions reach its effective time, and returns the
+// totals after the last one
+func Accumulate(deviceID string, positions []*Position, baselines []*AccumulatorBaseline) *Accumulators {
+	accumulators := &Accumulators{DeviceID: deviceID}
+	next := 0
+	for _, position := range positions {
+		for ; next < len(baselines) && !baselines[next].EffectiveAt.After(position.Timestamp); next++ {
+			accumulators.Reset(baselines[next])
+		}
+		accumulators.Advance(position)
+	}
+	for ; next < len(baselines); next++ {
+		accumulators.Reset(baselines[next])
+	}
+	return accumulators
+}
+
+// Ignition reads whether the engine is on, from whichever attribute the
+// decoder reports it as
+func Ignition(position *Position) (bool, bool) {
+	for _, name := range []string{"ignition", "acc", "engineOn"} {
+		if on, ok := position.Status[name].(bool); ok {
+			return on, true
+		}
+	}
+	return false, false
+}
+
+// AccumulatorBaseline sets the totals of a device as read, for example,
+// from the vehicle's own odometer and hour meter at a given time. Unset
+// totals keep counting from where they were.
+type AccumulatorBaseline struct {
+	ID            string    `json:"id"`
+	DeviceID      string    `json:"deviceId"`
+	TotalDistance *float64  `json:"totalDistance,omitempty"` // m
+	EngineHours   *float64  `json:"engineHours,omitempty"`   // h
+	EffectiveAt   time.Time `json:"effectiveAt"`
+	UserID        string    `json:"userId"` // Who set the baseline
+	CreatedAt     time.Time `json:"createdAt"`
+}
@@ -0,0 +1,34 @@
+package model
+
+// BenchmarkSession is a device connection replayed by a benchmark: the
+// frames a device sends, hex encoded, in order. The first frame identifies
+// the device, as it would on a real connection.
+type BenchmarkSession struct {
+	Name   string   `json:"name"`
+	Frames []string `json:"frames"`
+}
+
+// StageTiming is the time a benchmark spent in one stage of the pipeline,
+// summed across the connections replayed at once
+type StageTiming struct {
+	Name      string  `json:"name"`
+	Count     int64   `json:"count"`     // Reads, positions, batches or replies the stage handled
+	TotalMs   float64 `json:"totalMs"`   // Milliseconds
+	AverageMs float64 `json:"averageMs"` // Milliseconds per count
+	Share     float64 `json:"share"`     // Fraction of the time spent in every stage
+}
+
+// BenchmarkReport is the throughput a benchmark sustained on the server's
+// hardware, with the stages the time went to
+type BenchmarkReport struct {
+	Sessions           int           `json:"sessions"` // Replayed at once in each round
+	Rounds             int           `json:"rounds"`
+	Frames             int64         `json:"frames"`
+	Positions          int64         `json:"positions"` // Decoded, including those hooks rejected
+	Stored             int64         `json:"stored"`
+	Seconds            float64       `json:"seconds"`
+	FramesPerSecond    float64       `json:"framesPerSecond"`
+	PositionsPerSecond float64       `json:"positionsPerSecond"` // Stored
+	Stages             []StageTiming `json:"stages"`
+	Bottleneck         string        `json:"bottleneck"` // The stage taking the most time
+}
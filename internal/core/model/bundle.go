@@ -0,0 +1,39 @@
+package model
+
+import (
+	"time"
+)
+
+// BundleVersion is the format version written to exported bundles
+const BundleVersion = 1
+
+// Bundle is the full configuration of a server, exported to move it to
+// another instance. Users are referenced by ID and not exported; positions
+// stay behind.
+type Bundle struct {
+	Version             int                   `json:"version"`
+	ExportedAt          time.Time             `json:"exportedAt"`
+	Organizations       []*Organization       `json:"organizations"`
+	OrganizationMembers []*OrganizationMember `json:"organizationMembers"`
+	Devices             []*BundleDevice       `json:"devices"`
+	Scripts             []*Script             `json:"scripts"`
+}
+
+// BundleDevice is a device with its API secret, so devices authenticating
+// with their key and secret keep working after a migration
+type BundleDevice struct {
+	*Device
+	ApiSecret string `json:"apiSecret,omitempty"`
+}
+
+// BundleImport reports what an import created. IDs maps each imported
+// entity's ID in the bundle to its new ID, by kind; entities left out are
+// listed in Skipped with the reason.
+type BundleImport struct {
+	Organizations       int                          `json:"organizations"`
+	OrganizationMembers int                          `json:"organizationMembers"`
+	Devices             int                          `json:"devices"`
+	Scripts             int                          `json:"scripts"`
+	IDs                 map[string]map[string]string `json:"ids"`
+	Skipped             []string                     `json:"skipped,omitempty"`
+}
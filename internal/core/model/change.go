@@ -0,0 +1,45 @@
+package model
+
+import "time"
+
+// Kinds of stored entity a change refers to
+const (
+	ChangeDevice   = "device"
+	ChangePosition = "position"
+	ChangeEvent    = "event"
+)
+
+// Change is an entry of the change journal, noting that an entity was
+// stored or deleted. Sequences grow with every entry, so clients can ask
+// for whatever changed after the last one they saw.
+type Change struct {
+	Sequence int64  `json:"sequence"`
+	Kind     string `json:"kind"`
+	EntityID string `json:"entityId"`
+	DeviceID string `json:"deviceId"`
+	// The device's assignment when the change was made, which decides who
+	// learns of its deletion
+	UserID         string    `json:"userId,omitempty"`
+	OrganizationID string    `json:"organizationId,omitempty"`
+	Deleted        bool      `json:"deleted,omitempty"`
+	Timestamp      time.Time `json:"timestamp"`
+}
+
+// Tombstone tells a syncing client to drop an entity it holds
+type Tombstone struct {
+	Kind      string    `json:"kind"`
+	ID        string    `json:"id"`
+	DeletedAt time.Time `json:"deletedAt"`
+}
+
+// SyncResult is what changed for a user since a cursor. Devices are given
+// in their current state and positions and events as stored; clients
+// replace what they hold by ID, so seeing an entity twice is harmless.
+type SyncResult struct {
+	Cursor     string       `json:"cursor"`  // Pass as since to continue from here
+	HasMore    bool         `json:"hasMore"` // More changes wait past the cursor
+	Devices    []*Device    `json:"devices"`
+	Positions  []*Position  `json:"positions"`
+	Events     []*Event     `json:"events"`
+	Tombstones []*Tombstone `json:"tombstones"`
+}
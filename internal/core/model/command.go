@@ -0,0 +1,61 @@
+package model
+
+import "time"
+
+// Command types users may queue for a device
+const (
+	CommandEngineStop   = "engineStop"
+	CommandEngineResume = "engineResume"
+	CommandLocate       = "locate"
+	CommandReboot       = "reboot"
+	CommandSetInterval  = "setInterval" // Takes the Interval in seconds
+	// Takes the Angle in degrees the heading turns by to report a corner;
+	// zero turns corner reports off
+	CommandSetCornerReporting = "setCornerReporting"
+)
+
+// CommandTypes lists every command type
+var CommandTypes = []string{CommandEngineStop, CommandEngineResume, CommandLocate, CommandReboot, CommandSetInterval, CommandSetCornerReporting}
+
+// Command statuses. Commands wait pending until the device is connected,
+// are sent, and end acknowledged once the device replies. Commands that
+// could not be written after several attempts end failed; pending ones
+// may be cancelled.
+const (
+	CommandPending      = "pending"
+	CommandSent         = "sent"
+	CommandAcknowledged = "acknowledged"
+	CommandFailed       = "failed"
+	CommandCancelled    = "cancelled"
+)
+
+// Command is a remote-control action queued for a device, delivered when
+// it is next connected
+type Command struct {
+	ID             string     `json:"id"`
+	DeviceID       string     `json:"deviceId"`
+	UserID         string     `json:"userId"` // Who queued it
+	Type           string     `json:"type"`
+	Interval       int        `json:"interval,omitempty"` // Seconds, for setInterval
+	Angle          int        `json:"angle,omitempty"`    // Degrees, for setCornerReporting
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	Result         string     `json:"result,omitempty"` // The device's reply
+	Error          string     `json:"error,omitempty"`  // Why the last attempt failed
+	CreatedAt      time.Time  `json:"createdAt"`
+	UpdatedAt      time.Time  `json:"updatedAt"`
+	SentAt         *time.Time `json:"sentAt,omitempty"`
+	AcknowledgedAt *time.Time `json:"acknowledgedAt,omitempty"`
+}
+
+func NewCommand(deviceID, userID, commandType string, now time.Time) *Command {
+	return &Command{
+		ID:        GenerateID(),
+		DeviceID:  deviceID,
+		UserID:    userID,
+		Type:      commandType,
+		Status:    CommandPending,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
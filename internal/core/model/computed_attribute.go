@@ -0,0 +1,28 @@
+package model
+
+import "time"
+
+// Result types of computed attributes
+const (
+	AttributeTypeNumber  = "number"
+	AttributeTypeString  = "string"
+	AttributeTypeBoolean = "boolean"
+)
+
+// ComputedAttribute derives a position attribute of one device from its
+// raw attributes, e.g. fuelUsed = fuelCounter * 0.1. The expression uses
+// the script language and its result is stored with the position. The
+// attributes of a device are computed by priority, then in the order they
+// were defined, and see the results of those before them.
+type ComputedAttribute struct {
+	ID          string    `json:"id"`
+	DeviceID    string    `json:"deviceId"`
+	Attribute   string    `json:"attribute"`  // Name the result is stored under
+	Expression  string    `json:"expression"` // Right-hand side of a script assignment
+	Type        string    `json:"type"`       // AttributeTypeNumber, AttributeTypeString or AttributeTypeBoolean
+	Priority    int       `json:"priority"`   // Lower priorities are computed first
+	Description string    `json:"description,omitempty"`
+	UserID      string    `json:"userId"` // Who defined the attribute
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
@@ -0,0 +1,47 @@
+package model
+
+import "time"
+
+// DeviceDayStats aggregates the positions a device reported on one UTC day,
+// kept up to date as they are stored so dashboards need not read positions
+type DeviceDayStats struct {
+	DeviceID  string         `json:"deviceId"`
+	Day       string         `json:"day"` // As 2006-01-02
+	Positions int            `json:"positions"`
+	Distance  float64        `json:"distance"` // Kilometers between consecutive valid fixes
+	MaxSpeed  float64        `json:"maxSpeed"`
+	Alarms    map[string]int `json:"alarms,omitempty"` // Positions by alarm type
+	// Bit h is set when the device reported in UTC hour h
+	ActiveHours uint32 `json:"activeHours"`
+	// The last valid fix, which the distance to the next one is taken from
+	LastLatitude  float64   `json:"lastLatitude"`
+	LastLongitude float64   `json:"lastLongitude"`
+	LastFix       time.Time `json:"lastFix"`
+	UpdatedAt     time.Time `json:"updatedAt"`
+}
+
+func NewDeviceDayStats(deviceID, day string) *DeviceDayStats {
+	return &DeviceDayStats{
+		DeviceID: deviceID,
+		Day:      day,
+		Alarms:   make(map[string]int),
+	}
+}
+
+// Chart is a widget's data, ready to hand to a charting library: one label
+// per point and one or more series of values, each as long as Labels
+type Chart struct {
+	Widget string         `json:"widget"`
+	From   time.Time      `json:"from"`
+	To     time.Time      `json:"to"`
+	Labels []string       `json:"labels"`
+	Series []*ChartSeries `json:"series"`
+	// Device IDs matching Labels, for widgets ranking devices
+	DeviceIDs []string `json:"deviceIds,omitempty"`
+}
+
+// ChartSeries is one named line or set of bars of a chart
+type ChartSeries struct {
+	Name string    `json:"name"`
+	Data []float64 `json:"data"`
+}
@@ -0,0 +1,14 @@
+package model
+
+import "time"
+
+// DataKey is the key the sensitive fields of one scope, such as an
+// organization, are encrypted with. It is only ever stored wrapped by a
+// master key, which stays with the key provider.
+type DataKey struct {
+	Scope      string    `json:"scope"`
+	KeyID      string    `json:"keyId"` // Master key the data key is wrapped with
+	WrappedKey []byte    `json:"-"`
+	CreatedAt  time.Time `json:"createdAt"`
+	RotatedAt  time.Time `json:"rotatedAt,omitempty"`
+}
@@ -0,0 +1,39 @@
+package model
+
+import "time"
+
+// Reporting a device is asked for outside low-data mode, and the turn
+// reported as a corner when none is chosen
+const (
+	DefaultReportInterval = 30 // s
+	DefaultCornerAngle    = 30 // Degrees
+)
+
+// DataMode is the reporting a device is asked for, to save the data of
+// SIMs on small plans. In low-data mode the device reports every Interval,
+// and with CornerOnly it also reports at corners so routes keep their
+// shape between the sparse timed reports. Setting the mode queues the
+// configuration commands of the device's protocol.
+type DataMode struct {
+	DeviceID    string `json:"deviceId"`
+	LowData     bool   `json:"lowData"`
+	Interval    int    `json:"interval,omitempty"`    // Seconds between reports in low-data mode
+	CornerOnly  bool   `json:"cornerOnly,omitempty"`  // Report corners, otherwise only every Interval
+	CornerAngle int    `json:"cornerAngle,omitempty"` // Degrees the heading turns by at a corner
+	// Commands queued to apply the mode, whose status tells whether the
+	// device took it
+	CommandIDs []string  `json:"commandIds"`
+	UserID     string    `json:"userId"` // Who set the mode
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
+
+// DataUsage estimates the data a device uses in a month at the rate it
+// reported over a recent window
+type DataUsage struct {
+	DeviceID       string    `json:"deviceId"`
+	Since          time.Time `json:"since"`          // Start of the window observed
+	Reports        int       `json:"reports"`        // Positions received in the window
+	ReportsPerDay  float64   `json:"reportsPerDay"`  // Averaged over the window
+	BytesPerReport int       `json:"bytesPerReport"` // Typical for the protocol, with TCP/IP overhead
+	MonthlyBytes   int64     `json:"monthlyBytes"`   // Over 30 days
+}
@@ -0,0 +1,36 @@
+package model
+
+import "time"
+
+// TrafficMonthLayout formats the calendar months traffic is counted by
+const TrafficMonthLayout = "2006-01"
+
+// TrafficMonth returns the month, in UTC, traffic at t is counted in
+func TrafficMonth(t time.Time) string {
+	return t.UTC().Format(TrafficMonthLayout)
+}
+
+// DataTraffic is the measured TCP traffic of a device in a month, on the
+// SIM it held. A device whose SIM is swapped mid-month has a record for
+// each SIM.
+type DataTraffic struct {
+	DeviceID  string    `json:"deviceId"`
+	ICCID     string    `json:"iccid,omitempty"` // Empty until the device reports its SIM
+	Month     string    `json:"month"`           // As TrafficMonthLayout
+	BytesIn   int64     `json:"bytesIn"`         // Received from the device
+	BytesOut  int64     `json:"bytesOut"`        // Sent to the device
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// SIMUsage is the traffic of one SIM in a month, across the devices that
+// held it. Traffic of a device before it reported its SIM is counted
+// under the device alone, with its phone number when set.
+type SIMUsage struct {
+	ICCID     string   `json:"iccid,omitempty"`
+	Phone     string   `json:"phone,omitempty"`
+	DeviceIDs []string `json:"deviceIds"`
+	Month     string   `json:"month"`
+	BytesIn   int64    `json:"bytesIn"`
+	BytesOut  int64    `json:"bytesOut"`
+	Bytes     int64    `json:"bytes"` // In and out, as carriers bill
+}
@@ -0,0 +1,46 @@
+package model
+
+import (
+	"fmt"
+	"time"
+)
+
+// Decode warning codes: data a decoder filled in or corrected rather than
+// reject the frame
+const (
+	WarningTimestampMissing = "timestampMissing" // Server time used
+	WarningTimestampClamped = "timestampClamped" // Ahead of the server clock, set to it
+	WarningCourseMissing    = "courseMissing"    // Defaulted to 0
+)
+
+// MaxClockSkew is how far ahead of the server clock a decoded time may be
+// before it is clamped, leaving room for clocks slightly off
+const MaxClockSkew = 10 * time.Minute
+
+// DecodeWarning is a problem with a frame that did not stop it from being
+// decoded, kept with the position so data quality can be judged later
+type DecodeWarning struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Warn records a decode warning on the position
+func (p *Position) Warn(code, format string, v ...interface{}) {
+	p.Warnings = append(p.Warnings, DecodeWarning{Code: code, Message: fmt.Sprintf(format, v...)})
+}
+
+// SetDecodedTime sets the time a frame carried. A frame without one gets
+// now, and one further ahead than MaxClockSkew is clamped to now, with a
+// warning either way.
+func (p *Position) SetDecodedTime(decoded, now time.Time) {
+	switch {
+	case decoded.IsZero():
+		p.Timestamp = now
+		p.Warn(WarningTimestampMissing, "timestamp missing, server time used")
+	case decoded.Sub(now) > MaxClockSkew:
+		p.Timestamp = now
+		p.Warn(WarningTimestampClamped, "timestamp %s ahead of server time, clamped", decoded.Sub(now).Round(time.Second))
+	default:
+		p.Timestamp = decoded
+	}
+}
@@ -3,6 +3,7 @@ package model
 import (
 	"crypto/rand"
 	"encoding/hex"
+	"slices"
 	"strings"
 	"time"
 	"tracking/internal/core/util"
@@ -17,10 +18,24 @@ type Device struct {
 	PositionID     string    `json:"positionId,omitempty"`
 	CreatedAt      time.Time `json:"createdAt"`
 	Protocol       string    `json:"protocol"`
+	Model          string    `json:"model,omitempty"`      // Hardware model, selects attribute scripts
+	SpeedLimit     float64   `json:"speedLimit,omitempty"` // km/h, applied where the road limit is unknown
+	Phone          string    `json:"phone,omitempty"`      // SIM number, matching the sender of SMS reports
+	ICCID          string    `json:"iccid,omitempty"`      // SIM card, as last reported by the device
+	Tags           []string  `json:"tags,omitempty"`       // Free-form labels grouping devices, such as "north" or "reefer"
+	Odometer       float64   `json:"odometer,omitempty"`   // m, kept from the device's accumulated distance
 	ApiKey         string    `json:"apiKey,omitempty"`
 	ApiSecret      string    `json:"-"` // Not included in JSON responses
 	OrganizationID string    `json:"organizationId,omitempty"`
 	UserID         string    `json:"userId,omitempty"`
+
+	// IDs the device has in other systems by system name, such as its ERP
+	// asset ID, so their records can be joined with the device's own
+	ExternalIDs map[string]string `json:"externalIds,omitempty"`
+
+	// Sensitive fields encrypted at rest by field name, beside the scope
+	// whose data key seals them; nil while stored in plaintext
+	Sealed map[string]string `json:"-"`
 }
 
 func NewDevice(name, uniqueID string) *Device {
@@ -66,6 +81,87 @@ func generateRandomKey(length int) (string, error) {
 	return hex.EncodeToString(bytes), nil
 }
 
+// NormalizePhone reduces a phone number to its digits, keeping a leading
+// plus, so "+1 (555) 010-0199" and "+15550100199" compare equal
+func NormalizePhone(phone string) string {
+	var normalized strings.Builder
+	for i, r := range strings.TrimSpace(phone) {
+		if (r >= '0' && r <= '9') || (r == '+' && i == 0) {
+			normalized.WriteRune(r)
+		}
+	}
+	return normalized.String()
+}
+
+// MaxTags and MaxTagLength bound the tags a device carries
+const (
+	MaxTags      = 32
+	MaxTagLength = 64
+)
+
+// NormalizeTags trims and lowercases tags, dropping empty ones and
+// duplicates, so "North " and "north" are the same tag
+func NormalizeTags(tags []string) []string {
+	normalized := []string{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag != "" && !slices.Contains(normalized, tag) {
+			normalized = append(normalized, tag)
+		}
+	}
+	return normalized
+}
+
+// HasTags reports whether the device carries every one of the tags
+func (d *Device) HasTags(tags []string) bool {
+	for _, tag := range tags {
+		if !slices.Contains(d.Tags, tag) {
+			return false
+		}
+	}
+	return true
+}
+
+// Systems devices are commonly known to by another ID; ExternalIDs may
+// name others as well
+const (
+	ExternalERPAsset = "erpAssetId"     // Asset ID in the ERP
+	ExternalContract = "contractNumber" // Telematics contract number
+)
+
+// MaxExternalIDs and MaxExternalIDLength bound the external IDs of a device
+const (
+	MaxExternalIDs      = 16
+	MaxExternalIDLength = 128
+)
+
+// NormalizeExternalIDs trims system names and IDs, dropping systems
+// without an ID
+func NormalizeExternalIDs(ids map[string]string) map[string]string {
+	normalized := make(map[string]string)
+	for system, id := range ids {
+		system, id = strings.TrimSpace(system), strings.TrimSpace(id)
+		if system != "" && id != "" {
+			normalized[system] = id
+		}
+	}
+	return normalized
+}
+
+// ValidExternalSystem reports whether a system name is letters, digits,
+// '_' and '-', so it can name a stored field
+func ValidExternalSystem(system string) bool {
+	if system == "" || len(system) > MaxExternalIDLength {
+		return false
+	}
+	for _, r := range system {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-') {
+			return false
+		}
+	}
+	return true
+}
+
 func (d *Device) ValidateCredentials(apiKey, apiSecret string) bool {
 	return d.ApiKey == apiKey && d.ApiSecret == apiSecret
 }
@@ -0,0 +1,39 @@
+package model
+
+import "time"
+
+// DeviceCertificate is a client certificate issued to a device, which it
+// connects over mutual TLS with instead of logging in. It is kept so it can
+// be listed and revoked; the private key is handed out once and not kept.
+type DeviceCertificate struct {
+	ID        string     `json:"id"`
+	DeviceID  string     `json:"deviceId"`
+	UniqueID  string     `json:"uniqueId"` // Common name of the certificate
+	Serial    string     `json:"serial"`   // Upper case hexadecimal
+	NotBefore time.Time  `json:"notBefore"`
+	NotAfter  time.Time  `json:"notAfter"`
+	CreatedBy string     `json:"createdBy"` // Admin who issued it
+	CreatedAt time.Time  `json:"createdAt"`
+	RevokedAt *time.Time `json:"revokedAt,omitempty"`
+}
+
+// Revoked reports whether the certificate was revoked
+func (c *DeviceCertificate) Revoked() bool {
+	return c.RevokedAt != nil
+}
+
+// IssuedDeviceCertificate is a certificate as issued: with its private key
+// and the authority the device verifies the server with, all PEM encoded
+type IssuedDeviceCertificate struct {
+	*DeviceCertificate
+	Certificate   string `json:"certificate"`
+	PrivateKey    string `json:"privateKey"`
+	CACertificate string `json:"caCertificate"`
+}
+
+// DeviceCertificateRequest asks for a certificate for a device, valid for
+// validityDays, a year when left out
+type DeviceCertificateRequest struct {
+	DeviceID     string `json:"deviceId"`
+	ValidityDays int    `json:"validityDays,omitempty"`
+}
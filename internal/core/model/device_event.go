@@ -0,0 +1,88 @@
+package model
+
+import (
+	"time"
+)
+
+// Device history event types
+const (
+	DeviceCreated = "deviceCreated"
+	DeviceUpdated = "deviceUpdated"
+	DeviceDeleted = "deviceDeleted"
+)
+
+// DeviceState is the part of a device its history keeps: status,
+// assignment to a user or organization, and configuration. Bookkeeping such
+// as the last position is left out.
+type DeviceState struct {
+	Name           string  `json:"name"`
+	UniqueID       string  `json:"uniqueId"`
+	Status         string  `json:"status"`
+	Protocol       string  `json:"protocol"`
+	Model          string  `json:"model,omitempty"`
+	SpeedLimit     float64 `json:"speedLimit,omitempty"`
+	OrganizationID string  `json:"organizationId,omitempty"`
+	UserID         string  `json:"userId,omitempty"`
+}
+
+func NewDeviceState(device *Device) DeviceState {
+	return DeviceState{
+		Name:           device.Name,
+		UniqueID:       device.UniqueID,
+		Status:         device.Status,
+		Protocol:       device.Protocol,
+		Model:          device.Model,
+		SpeedLimit:     device.SpeedLimit,
+		OrganizationID: device.OrganizationID,
+		UserID:         device.UserID,
+	}
+}
+
+// Changes lists the JSON names of the fields that differ from other
+func (s DeviceState) Changes(other DeviceState) []string {
+	var changes []string
+	add := func(name string, changed bool) {
+		if changed {
+			changes = append(changes, name)
+		}
+	}
+	add("name", s.Name != other.Name)
+	add("uniqueId", s.UniqueID != other.UniqueID)
+	add("status", s.Status != other.Status)
+	add("protocol", s.Protocol != other.Protocol)
+	add("model", s.Model != other.Model)
+	add("speedLimit", s.SpeedLimit != other.SpeedLimit)
+	add("organizationId", s.OrganizationID != other.OrganizationID)
+	add("userId", s.UserID != other.UserID)
+	return changes
+}
+
+// DeviceEvent is one immutable entry of a device's history. It carries the
+// whole state after the change, so the state at any instant is that of the
+// device's last event up to it.
+type DeviceEvent struct {
+	ID        string      `json:"id"`
+	DeviceID  string      `json:"deviceId"`
+	Sequence  int64       `json:"sequence"` // Position in the device's history, from 1
+	Type      string      `json:"type"`
+	Changes   []string    `json:"changes,omitempty"` // Fields changed by an update
+	State     DeviceState `json:"state"`
+	Timestamp time.Time   `json:"timestamp"`
+}
+
+func NewDeviceEvent(eventType string, device *Device, timestamp time.Time) *DeviceEvent {
+	return &DeviceEvent{
+		ID:        GenerateID(),
+		DeviceID:  device.ID,
+		Type:      eventType,
+		State:     NewDeviceState(device),
+		Timestamp: timestamp,
+	}
+}
+
+// FleetDevice is a device as it stood at a past instant
+type FleetDevice struct {
+	DeviceID string `json:"deviceId"`
+	DeviceState
+	Since time.Time `json:"since"` // When the device entered this state
+}
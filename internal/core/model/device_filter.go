@@ -0,0 +1,61 @@
+package model
+
+import (
+	"strings"
+	"time"
+)
+
+// DeviceFilter selects a slice of a fleet. Empty fields match every device.
+type DeviceFilter struct {
+	Tags     []string `json:"tags,omitempty"` // The device must carry every one
+	Status   string   `json:"status,omitempty"`
+	Protocol string   `json:"protocol,omitempty"`
+	Search   string   `json:"search,omitempty"` // Part of the name or unique ID, any case
+}
+
+// IsEmpty reports whether the filter matches every device
+func (f DeviceFilter) IsEmpty() bool {
+	return len(f.Tags) == 0 && f.Status == "" && f.Protocol == "" && f.Search == ""
+}
+
+// Matches reports whether the device is in the slice the filter selects
+func (f DeviceFilter) Matches(device *Device) bool {
+	if !device.HasTags(f.Tags) {
+		return false
+	}
+	if f.Status != "" && device.Status != f.Status {
+		return false
+	}
+	if f.Protocol != "" && device.Protocol != f.Protocol {
+		return false
+	}
+	if f.Search != "" {
+		search := strings.ToLower(f.Search)
+		if !strings.Contains(strings.ToLower(device.Name), search) && !strings.Contains(strings.ToLower(device.UniqueID), search) {
+			return false
+		}
+	}
+	return true
+}
+
+// SavedFilter is a device filter a user named to come back to, such as
+// the reefer trucks of the northern depot
+type SavedFilter struct {
+	ID        string       `json:"id"`
+	UserID    string       `json:"userId"`
+	Name      string       `json:"name"`
+	Filter    DeviceFilter `json:"filter"`
+	CreatedAt time.Time    `json:"createdAt"`
+	UpdatedAt time.Time    `json:"updatedAt"`
+}
+
+func NewSavedFilter(userID, name string, filter DeviceFilter, now time.Time) *SavedFilter {
+	return &SavedFilter{
+		ID:        GenerateID(),
+		UserID:    userID,
+		Name:      name,
+		Filter:    filter,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
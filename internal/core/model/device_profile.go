@@ -0,0 +1,39 @@
+package model
+
+// DeviceProfile describes a known hardware model so other subsystems can
+// adapt to it
+type DeviceProfile struct {
+	Model        string `json:"model"`
+	Manufacturer string `json:"manufacturer"`
+	Protocol     string `json:"protocol"`
+	Quirks       Quirks `json:"quirks"`
+	// Commands lists the remote commands the firmware understands
+	Commands []string `json:"commands"`
+	// AttributeMappings renames decoder attributes to standard names
+	AttributeMappings map[string]string  `json:"attributeMappings,omitempty"`
+	Battery           *BatteryThresholds `json:"battery,omitempty"`
+}
+
+// Quirks are deviations from the protocol specification
+type Quirks struct {
+	// XORChecksum marks GT06 clones that use XOR instead of CRC-ITU
+	XORChecksum bool `json:"xorChecksum,omitempty"`
+}
+
+// BatteryThresholds classify the battery attribute; values at or below a
+// threshold fall into that band
+type BatteryThresholds struct {
+	Attribute string  `json:"attribute"`
+	Low       float64 `json:"low"`
+	Critical  float64 `json:"critical"`
+}
+
+// SupportsCommand reports whether the model accepts the given command
+func (p *DeviceProfile) SupportsCommand(command string) bool {
+	for _, c := range p.Commands {
+		if c == command {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,39 @@
+package model
+
+import (
+	"time"
+)
+
+// Registration statuses
+const (
+	RegistrationPending  = "pending"
+	RegistrationApproved = "approved"
+	RegistrationRejected = "rejected"
+	RegistrationExpired  = "expired"
+)
+
+// DeviceRegistration is a request from a phone tracker to become a device
+// of an account, waiting for the account owner to approve it
+type DeviceRegistration struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	OwnerEmail string    `json:"ownerEmail"`
+	Status     string    `json:"status"`
+	Token      string    `json:"-"` // Lets the phone poll for its credentials
+	DeviceID   string    `json:"deviceId,omitempty"`
+	CreatedAt  time.Time `json:"createdAt"`
+	ReviewedAt time.Time `json:"reviewedAt,omitempty"`
+}
+
+func NewDeviceRegistration(name, ownerEmail string) *DeviceRegistration {
+	token, _ := generateRandomKey(32)
+
+	return &DeviceRegistration{
+		ID:         GenerateID(),
+		Name:       name,
+		OwnerEmail: ownerEmail,
+		Status:     RegistrationPending,
+		Token:      token,
+		CreatedAt:  time.Now(),
+	}
+}
@@ -0,0 +1,27 @@
+package model
+
+import "time"
+
+// Connection states of a device, computed from its session rather than
+// stored
+const (
+	DeviceOnline  = "online"
+	DeviceOffline = "offline"
+)
+
+// DeviceSession describes a device's link to the server: the TCP
+// connection it holds, or for datagram protocols the address it last
+// reported from
+type DeviceSession struct {
+	DeviceID    string    `json:"deviceId"`
+	UniqueID    string    `json:"uniqueId"`
+	Protocol    string    `json:"protocol"`
+	Transport   string    `json:"transport"` // "tcp" or "udp"
+	RemoteAddr  string    `json:"remoteAddr"`
+	ConnectedAt time.Time `json:"connectedAt"`
+	LastSeen    time.Time `json:"lastSeen"` // Last packet received
+	// Bytes received from and sent to the device over the connection;
+	// zero for datagram devices
+	BytesIn  int64 `json:"bytesIn"`
+	BytesOut int64 `json:"bytesOut"`
+}
@@ -0,0 +1,127 @@
+package model
+
+import (
+	"time"
+)
+
+// Event types
+const (
+	EventDeviceOnline  = "deviceOnline"
+	EventDeviceOffline = "deviceOffline"
+	EventDeviceCreated = "deviceCreated"
+	EventDeviceDeleted = "deviceDeleted"
+	// The device passed to another user or organization
+	EventDeviceTransferred = "deviceTransferred"
+	EventCommandResult     = "commandResult"
+	EventOverspeed         = "overspeed"
+	EventAlarm             = "alarm"      // The device reported an alarm, named in the alarm attribute
+	EventLowBattery        = "lowBattery" // The device's battery ran low
+	EventGeofenceEnter     = "geofenceEnter"
+	EventGeofenceExit      = "geofenceExit"
+	EventTextDelivered     = "textDelivered" // The device confirmed a text message was shown
+	EventMedia             = "media"         // The device uploaded an image or clip
+	EventMaintenance       = "maintenance"   // A total of the device reached a scheduled service
+	EventFuelDrop          = "fuelDrop"      // The fuel level fell suddenly, for the reason in the cause attribute
+	// Raised by the ingest watchdog for a device whose positions went
+	// missing between receipt and storage
+	EventIngestDiscrepancy = "ingestDiscrepancy"
+	// Raised by the ingest watchdog, for no device, when positions take
+	// longer than the SLA to be stored
+	EventIngestLatency = "ingestLatency"
+)
+
+// EventTypes lists every event type, for settings choosing among them
+var EventTypes = []string{
+	EventDeviceOnline,
+	EventDeviceOffline,
+	EventDeviceCreated,
+	EventDeviceDeleted,
+	EventDeviceTransferred,
+	EventCommandResult,
+	EventOverspeed,
+	EventAlarm,
+	EventLowBattery,
+	EventGeofenceEnter,
+	EventGeofenceExit,
+	EventTextDelivered,
+	EventMedia,
+	EventMaintenance,
+	EventFuelDrop,
+	EventIngestDiscrepancy,
+	EventIngestLatency,
+}
+
+// Event severities, from least to most pressing
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+// eventSeverities ranks the event types above info
+var eventSeverities = map[string]string{
+	EventDeviceOffline:     SeverityWarning,
+	EventOverspeed:         SeverityWarning,
+	EventAlarm:             SeverityCritical,
+	EventLowBattery:        SeverityWarning,
+	EventMaintenance:       SeverityWarning,
+	EventFuelDrop:          SeverityCritical,
+	EventIngestDiscrepancy: SeverityCritical,
+	EventIngestLatency:     SeverityWarning,
+}
+
+// EventSeverity returns the severity events of the type are raised with
+func EventSeverity(eventType string) string {
+	if severity, ok := eventSeverities[eventType]; ok {
+		return severity
+	}
+	return SeverityInfo
+}
+
+// AttributeExternalIDs holds the external IDs of the device, by system, in
+// the attributes of its events
+const AttributeExternalIDs = "externalIds"
+
+type Event struct {
+	ID         string                 `json:"id"`
+	Type       string                 `json:"type"`
+	Severity   string                 `json:"severity"`
+	DeviceID   string                 `json:"deviceId"`
+	PositionID string                 `json:"positionId,omitempty"`
+	Timestamp  time.Time              `json:"timestamp"`
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+	// Snoozed events are kept but raise no alerts
+	Snoozed bool `json:"snoozed,omitempty"`
+	// Set once a user has seen to the event, which stops its escalation
+	AcknowledgedBy string     `json:"acknowledgedBy,omitempty"`
+	AcknowledgedAt *time.Time `json:"acknowledgedAt,omitempty"`
+}
+
+func NewEvent(eventType, deviceID string, timestamp time.Time) *Event {
+	return &Event{
+		ID:         GenerateID(),
+		Type:       eventType,
+		Severity:   EventSeverity(eventType),
+		DeviceID:   deviceID,
+		Timestamp:  timestamp,
+		Attributes: make(map[string]interface{}),
+	}
+}
+
+// Acknowledged reports whether a user has seen to the event
+func (e *Event) Acknowledged() bool {
+	return e.AcknowledgedAt != nil
+}
+
+// EventCount is the number of events of a type raised on a UTC day
+type EventCount struct {
+	Day   string `json:"day"` // As 2006-01-02
+	Type  string `json:"type"`
+	Count int    `json:"count"`
+}
+
+// EventPage is one page of an event listing, newest first
+type EventPage struct {
+	Events     []*Event `json:"events"`
+	NextCursor string   `json:"nextCursor,omitempty"` // Empty on the last page
+}
@@ -0,0 +1,19 @@
+package model
+
+import "time"
+
+// FuelReading is the fuel level of a device at one of its positions
+type FuelReading struct {
+	DeviceID   string    `json:"deviceId"`
+	PositionID string    `json:"positionId"`
+	Timestamp  time.Time `json:"timestamp"`
+	Level      float64   `json:"level"` // Percent of the tank
+}
+
+// Causes of a fuelDrop event, given in its cause attribute. A level that
+// falls to nothing, or while the vehicle moves, points at the sensor; one
+// that falls while it stands still, at fuel being drained.
+const (
+	FuelDropTheft       = "theft"
+	FuelDropSensorFault = "sensorFault"
+)
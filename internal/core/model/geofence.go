@@ -0,0 +1,58 @@
+package model
+
+import (
+	"time"
+	"tracking/internal/core/util"
+)
+
+// Geofence shapes
+const (
+	GeofenceCircle  = "circle"
+	GeofencePolygon = "polygon"
+)
+
+// GeoPoint is a vertex of a polygon geofence
+type GeoPoint struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// Geofence is an area whose crossing by a device raises an event. The
+// fences of an organization watch its devices; fences drawn outside any
+// organization watch the devices of the user who drew them.
+type Geofence struct {
+	ID             string `json:"id"`
+	Name           string `json:"name"`
+	Type           string `json:"type"` // GeofenceCircle or GeofencePolygon
+	OrganizationID string `json:"organizationId,omitempty"`
+	UserID         string `json:"userId"` // Who drew the fence
+	// Center and radius in meters of a circle
+	Latitude  float64 `json:"latitude,omitempty"`
+	Longitude float64 `json:"longitude,omitempty"`
+	Radius    float64 `json:"radius,omitempty"`
+	// Vertices of a polygon, in order; the last joins the first
+	Points    []GeoPoint `json:"points,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+	UpdatedAt time.Time  `json:"updatedAt"`
+}
+
+// Contains reports whether a point lies within the fence. Polygons are
+// taken as drawn on a flat map, which holds for fences of city scale.
+func (g *Geofence) Contains(latitude, longitude float64) bool {
+	switch g.Type {
+	case GeofenceCircle:
+		return util.Distance(g.Latitude, g.Longitude, latitude, longitude) <= g.Radius
+	case GeofencePolygon:
+		inside := false
+		for i, j := 0, len(g.Points)-1; i < len(g.Points); j, i = i, i+1 {
+			a, b := g.Points[i], g.Points[j]
+			// Count the edges a ray running east from the point crosses
+			if (a.Latitude > latitude) != (b.Latitude > latitude) &&
+				longitude < (b.Longitude-a.Longitude)*(latitude-a.Latitude)/(b.Latitude-a.Latitude)+a.Longitude {
+				inside = !inside
+			}
+		}
+		return inside
+	}
+	return false
+}
@@ -0,0 +1,31 @@
+package model
+
+import "time"
+
+// Job states
+const (
+	JobRunning   = "running"
+	JobCompleted = "completed"
+	JobFailed    = "failed"
+)
+
+// Job is a task run in the background, such as a track import, with its
+// progress for clients to poll
+type Job struct {
+	ID         string     `json:"id"`
+	Type       string     `json:"type"`
+	UserID     string     `json:"userId,omitempty"`
+	DeviceID   string     `json:"deviceId,omitempty"`
+	Status     string     `json:"status"`
+	Total      int        `json:"total"`     // Items to process, once known
+	Processed  int        `json:"processed"` // Items done
+	Skipped    int        `json:"skipped"`   // Items passed over, such as duplicates
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+}
+
+// Done reports whether the job has finished, successfully or not
+func (j *Job) Done() bool {
+	return j.Status == JobCompleted || j.Status == JobFailed
+}
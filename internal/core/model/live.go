@@ -0,0 +1,27 @@
+package model
+
+// Live update types
+const (
+	LivePosition = "position"
+	LiveEvent    = "event"
+	LiveStatus   = "status"
+)
+
+// LiveUpdate is a position stored, an event raised or a device coming
+// online or going offline, pushed to clients following devices live.
+// Position, Event or Status is set according to the type.
+type LiveUpdate struct {
+	Type     string    `json:"type"`
+	DeviceID string    `json:"deviceId"`
+	Position *Position `json:"position,omitempty"`
+	Event    *Event    `json:"event,omitempty"`
+	Status   string    `json:"status,omitempty"` // DeviceOnline or DeviceOffline
+}
+
+// LiveFilter selects the devices a live stream follows: one device or the
+// devices of one organization. A stream follows the devices matching any
+// of its filters, or every device the user can access when it has none.
+type LiveFilter struct {
+	DeviceID       string `json:"deviceId,omitempty"`
+	OrganizationID string `json:"organizationId,omitempty"`
+}
@@ -0,0 +1,20 @@
+package model
+
+import "time"
+
+// LogOverride raises or lowers the log level of one module or one device
+// until it expires. Exactly one of Module and DeviceID is set.
+type LogOverride struct {
+	Module    string    `json:"module,omitempty"`
+	DeviceID  string    `json:"deviceId,omitempty"`
+	Level     string    `json:"level"`
+	Duration  int64     `json:"duration,omitempty"` // Seconds, on requests only
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// LogLevels is the level logs are written at and the overrides in effect
+type LogLevels struct {
+	Level     string         `json:"level"`
+	Modules   []string       `json:"modules"` // Modules that take overrides
+	Overrides []*LogOverride `json:"overrides"`
+}
@@ -0,0 +1,47 @@
+package model
+
+import (
+	"math"
+	"time"
+)
+
+// Maintenance schedules a service of one device on one of its totals:
+// first at Start, then every Period, e.g. an oil change at 250 engine
+// hours and every 500 after. A maintenance event is raised as the total
+// reaches each service.
+type Maintenance struct {
+	ID       string  `json:"id"`
+	DeviceID string  `json:"deviceId"`
+	Name     string  `json:"name"`
+	Type     string  `json:"type"`   // AttributeEngineHours or AttributeTotalDistance
+	Start    float64 `json:"start"`  // Total of the first service, in h or m
+	Period   float64 `json:"period"` // Between services; zero for a single one
+	// Who scheduled the maintenance
+	UserID    string    `json:"userId"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// Due returns the total of the first service after previous, and whether
+// the total reached it by current
+func (m *Maintenance) Due(previous, current float64) (float64, bool) {
+	due := m.Start
+	if previous >= m.Start {
+		if m.Period <= 0 {
+			return 0, false
+		}
+		due = m.Start + (math.Floor((previous-m.Start)/m.Period)+1)*m.Period
+	}
+	return due, current >= due
+}
+
+// Utilization is how much a device was used over a time range
+type Utilization struct {
+	DeviceID    string    `json:"deviceId"`
+	From        time.Time `json:"from"`
+	To          time.Time `json:"to"`
+	EngineHours float64   `json:"engineHours"` // h
+	Distance    float64   `json:"distance"`    // m
+	// Share of the range the engine ran, from 0 to 1
+	Utilization float64 `json:"utilization"`
+}
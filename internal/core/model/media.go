@@ -0,0 +1,42 @@
+package model
+
+import (
+	"time"
+)
+
+// Media types
+const (
+	MediaImage = "image"
+	MediaAudio = "audio"
+	MediaVideo = "video"
+)
+
+// Media describes an image, audio or video clip uploaded by a device. The
+// content lives in the media store under Key.
+type Media struct {
+	ID          string    `json:"id"`
+	DeviceID    string    `json:"deviceId"`
+	Type        string    `json:"type"`
+	ContentType string    `json:"contentType"`
+	Size        int64     `json:"size"`
+	Key         string    `json:"-"`
+	Trigger     string    `json:"trigger,omitempty"` // What made the device capture it, such as an alarm
+	EventID     string    `json:"eventId,omitempty"` // Event the media documents
+	Channel     int       `json:"channel,omitempty"` // Camera of devices with several
+	Latitude    float64   `json:"latitude,omitempty"`
+	Longitude   float64   `json:"longitude,omitempty"`
+	CapturedAt  time.Time `json:"capturedAt"`
+	CreatedAt   time.Time `json:"createdAt"`
+	URL         string    `json:"url,omitempty" bson:"-"` // Expiring link to the content, set when served
+}
+
+func NewMedia(deviceID, mediaType, contentType string, timestamp time.Time) *Media {
+	return &Media{
+		ID:          GenerateID(),
+		DeviceID:    deviceID,
+		Type:        mediaType,
+		ContentType: contentType,
+		CapturedAt:  timestamp,
+		CreatedAt:   timestamp,
+	}
+}
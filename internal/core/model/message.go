@@ -0,0 +1,52 @@
+package model
+
+import (
+	"time"
+)
+
+// Message directions
+const (
+	MessageOutgoing = "outgoing" // From a user to the driver display
+	MessageIncoming = "incoming" // From the driver
+)
+
+// Message statuses. Outgoing messages start pending and end sent, failed
+// or, on devices that confirm them, delivered; incoming ones are received.
+const (
+	MessagePending   = "pending"
+	MessageSent      = "sent"
+	MessageDelivered = "delivered"
+	MessageFailed    = "failed"
+	MessageReceived  = "received"
+)
+
+// Message is one text exchanged with the driver of a device. A device's
+// messages in time order form its conversation thread.
+type Message struct {
+	ID        string    `json:"id"`
+	DeviceID  string    `json:"deviceId"`
+	Direction string    `json:"direction"`
+	Text      string    `json:"text"`
+	Status    string    `json:"status"`
+	UserID    string    `json:"userId,omitempty"` // Sender of an outgoing message
+	Error     string    `json:"error,omitempty"`  // Why a message failed
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+func NewMessage(deviceID, direction, text string, timestamp time.Time) *Message {
+	status := MessagePending
+	if direction == MessageIncoming {
+		status = MessageReceived
+	}
+
+	return &Message{
+		ID:        GenerateID(),
+		DeviceID:  deviceID,
+		Direction: direction,
+		Text:      text,
+		Status:    status,
+		CreatedAt: timestamp,
+		UpdatedAt: timestamp,
+	}
+}
@@ -0,0 +1,33 @@
+package model
+
+// Network holds the radio observations a device reported, so a
+// geolocation provider can resolve a position when there is no GPS fix.
+// Field names follow the common geolocation request format.
+type Network struct {
+	RadioType        string            `json:"radioType,omitempty"`
+	CellTowers       []CellTower       `json:"cellTowers,omitempty"`
+	WifiAccessPoints []WifiAccessPoint `json:"wifiAccessPoints,omitempty"`
+}
+
+type CellTower struct {
+	MobileCountryCode int `json:"mobileCountryCode"`
+	MobileNetworkCode int `json:"mobileNetworkCode"`
+	LocationAreaCode  int `json:"locationAreaCode"`
+	CellID            int `json:"cellId"`
+	SignalStrength    int `json:"signalStrength,omitempty"`
+}
+
+type WifiAccessPoint struct {
+	MacAddress     string `json:"macAddress"`
+	SignalStrength int    `json:"signalStrength,omitempty"`
+}
+
+// AddCellTower appends a cell observation
+func (n *Network) AddCellTower(tower CellTower) {
+	n.CellTowers = append(n.CellTowers, tower)
+}
+
+// AddWifiAccessPoint appends a WiFi observation
+func (n *Network) AddWifiAccessPoint(accessPoint WifiAccessPoint) {
+	n.WifiAccessPoints = append(n.WifiAccessPoints, accessPoint)
+}
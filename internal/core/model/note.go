@@ -0,0 +1,47 @@
+package model
+
+import "time"
+
+// Note is a remark a user attaches to the track of a device, such as
+// "delivery at customer X". It names either a single position or a time
+// range, and is kept apart from the positions it annotates.
+type Note struct {
+	ID         string    `json:"id"`
+	DeviceID   string    `json:"deviceId"`
+	PositionID string    `json:"positionId,omitempty"` // Set for a note on one position
+	From       time.Time `json:"from"`                 // Range covered; both equal the position time for a position note
+	To         time.Time `json:"to"`
+	Text       string    `json:"text"`
+	UserID     string    `json:"userId"` // Who wrote the note
+	CreatedAt  time.Time `json:"createdAt"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
+
+// Covers reports whether the note applies to the position
+func (n *Note) Covers(position *Position) bool {
+	if n.PositionID != "" {
+		return n.PositionID == position.ID
+	}
+	return !position.Timestamp.Before(n.From) && !position.Timestamp.After(n.To)
+}
+
+// AnnotatedPosition is a position listed together with the notes on it
+type AnnotatedPosition struct {
+	*Position
+	Notes []*Note `json:"notes,omitempty"`
+}
+
+// Annotate pairs each position with the notes covering it
+func Annotate(positions []*Position, notes []*Note) []*AnnotatedPosition {
+	annotated := make([]*AnnotatedPosition, 0, len(positions))
+	for _, position := range positions {
+		entry := &AnnotatedPosition{Position: position}
+		for _, note := range notes {
+			if note.Covers(position) {
+				entry.Notes = append(entry.Notes, note)
+			}
+		}
+		annotated = append(annotated, entry)
+	}
+	return annotated
+}
@@ -0,0 +1,39 @@
+package model
+
+import "time"
+
+// Notifications a user can choose to receive by email
+const (
+	NotifySOS        = "sos"        // A device raised an SOS alarm
+	NotifyLowBattery = "lowBattery" // A device's battery ran low
+	NotifyGeofence   = "geofence"   // A device entered or left a geofence
+)
+
+// Notifications lists every notification a user can choose
+var Notifications = []string{NotifySOS, NotifyLowBattery, NotifyGeofence}
+
+// NotificationPreferences are the notifications a user receives by email.
+// They are sent about the user's own devices and those of the
+// organizations the user belongs to.
+type NotificationPreferences struct {
+	UserID        string    `json:"userId"`
+	Email         string    `json:"email,omitempty"` // Address mailed; the account's when empty
+	Notifications []string  `json:"notifications"`   // Chosen among Notifications
+	UpdatedAt     time.Time `json:"updatedAt"`
+}
+
+// EventNotification returns the notification an event is sent as, or
+// empty for events not notified
+func EventNotification(event *Event) string {
+	switch event.Type {
+	case EventAlarm:
+		if event.Attributes["alarm"] == NotifySOS {
+			return NotifySOS
+		}
+	case EventLowBattery:
+		return NotifyLowBattery
+	case EventGeofenceEnter, EventGeofenceExit:
+		return NotifyGeofence
+	}
+	return ""
+}
@@ -4,10 +4,25 @@ import (
 	"time"
 )
 
+// Features an organization may be restricted from. Each level of the
+// hierarchy can only narrow what its parent allows.
+const (
+	FeatureMessages = "messages"
+	FeatureHistory  = "history"
+	FeatureMedia    = "media"
+	FeatureAlerts   = "alerts"
+)
+
+// AllFeatures lists every feature, as allowed to an unrestricted top-level
+// organization
+var AllFeatures = []string{FeatureMessages, FeatureHistory, FeatureMedia, FeatureAlerts}
+
 type Organization struct {
 	ID          string    `json:"id"`
 	Name        string    `json:"name"`
 	Description string    `json:"description,omitempty"`
+	ParentID    string    `json:"parentId,omitempty"` // The reseller or dealer above, if any
+	Features    []string  `json:"features,omitempty"` // Empty to allow all the parent allows
 	CreatedAt   time.Time `json:"createdAt"`
 	UpdatedAt   time.Time `json:"updatedAt"`
 }
@@ -21,3 +36,14 @@ func NewOrganization(name string, description string) *Organization {
 		UpdatedAt:   time.Now(),
 	}
 }
+
+// OrganizationRollup sums up the devices of an organization and of the
+// organizations below it
+type OrganizationRollup struct {
+	Organization       *Organization         `json:"organization"`
+	Devices            int                   `json:"devices"` // Directly in the organization
+	ActiveDevices      int                   `json:"activeDevices"`
+	TotalDevices       int                   `json:"totalDevices"` // Including every descendant
+	TotalActiveDevices int                   `json:"totalActiveDevices"`
+	Children           []*OrganizationRollup `json:"children"`
+}
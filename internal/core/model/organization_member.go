@@ -23,3 +23,9 @@ func NewOrganizationMember(organizationID, userID string, role string) *Organiza
 		UpdatedAt:      time.Now(),
 	}
 }
+
+// Membership is an organization a user belongs to, with their role in it
+type Membership struct {
+	Organization *Organization `json:"organization"`
+	Role         string        `json:"role"`
+}
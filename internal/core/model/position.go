@@ -19,6 +19,11 @@ type Position struct {
 	Valid      bool                  `json:"valid"`       // GPS fix validity
 	Satellites uint8                 `json:"satellites"`  // Number of satellites used for fix
 	Status     map[string]interface{} `json:"status,omitempty"` // Additional status information
+	Network    *Network               `json:"network,omitempty"`   // Cell and WiFi observations for fixless positioning
+	Warnings   []DecodeWarning        `json:"warnings,omitempty"`  // Data the decoder filled in or corrected
+	// When the server got the frame, timing how long the position took to
+	// become available; not stored
+	ReceivedAt time.Time `json:"-" bson:"-"`
 }
 
 func NewPosition(deviceID string, lat, lon float64) *Position {
@@ -35,6 +40,5 @@ func NewPosition(deviceID string, lat, lon float64) *Position {
 }
 
 func GenerateID() string {
-	//Implementation for GenerateID() would go here.  This is assumed to exist in the original file.
-	return "" //Placeholder - Replace with actual implementation.
+	return util.GenerateID()
 }
\ No newline at end of file
@@ -0,0 +1,21 @@
+package model
+
+import "time"
+
+// Platforms a push token is registered from
+const (
+	PlatformAndroid = "android"
+	PlatformIOS     = "ios"
+	PlatformWeb     = "web"
+)
+
+// PushToken is the Firebase Cloud Messaging registration token of one
+// installation of the mobile or web app, which alarm and geofence events
+// are pushed to
+type PushToken struct {
+	Token     string    `json:"token"`
+	UserID    string    `json:"userId"`
+	Platform  string    `json:"platform,omitempty"` // PlatformAndroid, PlatformIOS or PlatformWeb
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"` // When the app last registered it
+}
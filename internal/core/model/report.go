@@ -0,0 +1,70 @@
+package model
+
+import "time"
+
+// Stop is a place a device stayed at. It spans the positions reported
+// there, so a device reporting rarely while parked shows a shorter dwell
+// than it had.
+type Stop struct {
+	StartTime time.Time `json:"startTime"`
+	EndTime   time.Time `json:"endTime"`
+	Duration  int64     `json:"duration"` // Seconds
+	Latitude  float64   `json:"latitude"`
+	Longitude float64   `json:"longitude"`
+	Address   string    `json:"address,omitempty"` // When a position there carries one
+	Positions int       `json:"positions"`
+}
+
+// StopReport lists the stops of a device within a time range
+type StopReport struct {
+	DeviceID      string    `json:"deviceId"`
+	From          time.Time `json:"from"`
+	To            time.Time `json:"to"`
+	MinDuration   int64     `json:"minDuration"`   // Seconds a stay lasts to count
+	TotalDuration int64     `json:"totalDuration"` // Seconds, over every stop
+	Stops         []*Stop   `json:"stops"`
+}
+
+// Periods mileage and engine hours are reported by
+const (
+	ReportDaily  = "day"
+	ReportWeekly = "week" // From Monday
+)
+
+// MileagePeriod is the distance a device covered in one day or week, cut
+// to the range of the report
+type MileagePeriod struct {
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	Distance float64   `json:"distance"` // m
+}
+
+// MileageReport lists the distance of a device by day or week within a
+// time range, with periods it did not move in at zero
+type MileageReport struct {
+	DeviceID string           `json:"deviceId"`
+	From     time.Time        `json:"from"`
+	To       time.Time        `json:"to"`
+	Period   string           `json:"period"`
+	Distance float64          `json:"distance"` // m, over every period
+	Periods  []*MileagePeriod `json:"periods"`
+}
+
+// EngineHoursPeriod is the time the engine of a device ran in one day or
+// week, cut to the range of the report
+type EngineHoursPeriod struct {
+	Start       time.Time `json:"start"`
+	End         time.Time `json:"end"`
+	EngineHours float64   `json:"engineHours"` // h
+}
+
+// EngineHoursReport lists the engine time of a device by day or week
+// within a time range, for planning maintenance due by hours
+type EngineHoursReport struct {
+	DeviceID    string               `json:"deviceId"`
+	From        time.Time            `json:"from"`
+	To          time.Time            `json:"to"`
+	Period      string               `json:"period"`
+	EngineHours float64              `json:"engineHours"` // h, over every period
+	Periods     []*EngineHoursPeriod `json:"periods"`
+}
@@ -0,0 +1,28 @@
+package model
+
+import (
+	"time"
+)
+
+// Script computes derived attributes for positions of one device model
+type Script struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	DeviceModel string    `json:"deviceModel"`
+	Source      string    `json:"source"`
+	Enabled     bool      `json:"enabled"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+func NewScript(name, deviceModel, source string) *Script {
+	return &Script{
+		ID:          GenerateID(),
+		Name:        name,
+		DeviceModel: deviceModel,
+		Source:      source,
+		Enabled:     true,
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
+	}
+}
@@ -0,0 +1,38 @@
+package model
+
+import "time"
+
+// Snooze silences the alerts of a device for a while, such as its geofence
+// alerts while the vehicle is in the shop. Events are still stored, marked
+// as snoozed.
+type Snooze struct {
+	ID          string     `json:"id"`
+	DeviceID    string     `json:"deviceId"`
+	EventType   string     `json:"eventType,omitempty"` // Empty to silence every type
+	Until       time.Time  `json:"until"`
+	Reason      string     `json:"reason,omitempty"`
+	CreatedBy   string     `json:"createdBy"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	CancelledBy string     `json:"cancelledBy,omitempty"`
+	CancelledAt *time.Time `json:"cancelledAt,omitempty"`
+}
+
+func NewSnooze(deviceID, eventType string, until time.Time, createdBy string, now time.Time) *Snooze {
+	return &Snooze{
+		ID:        GenerateID(),
+		DeviceID:  deviceID,
+		EventType: eventType,
+		Until:     until,
+		CreatedBy: createdBy,
+		CreatedAt: now,
+	}
+}
+
+// Covers reports whether the snooze silences an event of the type raised
+// at the given instant
+func (s *Snooze) Covers(eventType string, at time.Time) bool {
+	if s.CancelledAt != nil || !at.Before(s.Until) {
+		return false
+	}
+	return s.EventType == "" || s.EventType == eventType
+}
@@ -10,6 +10,7 @@ type User struct {
     Password  string    `json:"-"` // Password is not included in JSON
     Name      string    `json:"name"`
     Admin     bool      `json:"admin"`
+    Locale    string    `json:"locale,omitempty"` // Preferred response language; the request's when empty
     CreatedAt time.Time `json:"createdAt"`
 }
 
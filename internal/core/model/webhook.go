@@ -0,0 +1,25 @@
+package model
+
+import (
+	"slices"
+	"time"
+)
+
+// Webhook is a URL the events of devices are posted to. The webhooks of
+// an organization hear of its devices; webhooks set outside any
+// organization hear of the devices of the user who set them.
+type Webhook struct {
+	ID             string    `json:"id"`
+	URL            string    `json:"url"`
+	Secret         string    `json:"secret,omitempty"`     // Signs bodies; empty sends no signature
+	EventTypes     []string  `json:"eventTypes,omitempty"` // Types posted; empty for every type
+	OrganizationID string    `json:"organizationId,omitempty"`
+	UserID         string    `json:"userId"` // Who set the webhook
+	CreatedAt      time.Time `json:"createdAt"`
+	UpdatedAt      time.Time `json:"updatedAt"`
+}
+
+// Accepts reports whether events of the type are posted to the webhook
+func (w *Webhook) Accepts(eventType string) bool {
+	return len(w.EventTypes) == 0 || slices.Contains(w.EventTypes, eventType)
+}
@@ -0,0 +1,256 @@
+// Package profile holds the catalog of known device models and applies a
+// model's defaults to the positions its devices report
+package profile
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"tracking/internal/core/hook"
+	"tracking/internal/core/model"
+	"tracking/internal/core/repository"
+	"tracking/internal/protocol/gt06"
+	"tracking/internal/protocol/h02"
+	"tracking/internal/protocol/watch"
+)
+
+// Standard attribute names produced by the built-in mappings
+const (
+	AttributeBatteryLevel = "batteryLevel"
+	AttributeBatteryState = "batteryState"
+	AttributeRSSI         = "rssi"
+)
+
+// Battery states written to AttributeBatteryState
+const (
+	BatteryOK       = "ok"
+	BatteryLow      = "low"
+	BatteryCritical = "critical"
+)
+
+var gt06Commands = []string{
+	string(gt06.CommandEngineStop),
+	string(gt06.CommandEngineResume),
+	string(gt06.CommandLocate),
+	string(gt06.CommandReboot),
+	string(gt06.CommandSetInterval),
+	string(gt06.CommandSetCornerReporting),
+}
+
+var h02Commands = []string{
+	string(h02.CommandEngineStop),
+	string(h02.CommandEngineResume),
+	string(h02.CommandLocate),
+	string(h02.CommandReboot),
+	string(h02.CommandSetInterval),
+}
+
+// builtinProfiles are the models known out of the box. GT06 reports battery
+// as a 0-6 level, H02, Queclink and watches as a percentage.
+var builtinProfiles = []*model.DeviceProfile{
+	{
+		Model:        "GT06N",
+		Manufacturer: "Concox",
+		Protocol:     "gt06",
+		Commands:     gt06Commands,
+		AttributeMappings: map[string]string{
+			"powerLevel": AttributeBatteryLevel,
+			"gsmSignal":  AttributeRSSI,
+		},
+		Battery: &model.BatteryThresholds{Attribute: AttributeBatteryLevel, Low: 2, Critical: 1},
+	},
+	{
+		Model:        "JM-VL03",
+		Manufacturer: "Jimi",
+		Protocol:     "gt06",
+		Commands:     gt06Commands,
+		AttributeMappings: map[string]string{
+			"powerLevel": AttributeBatteryLevel,
+			"gsmSignal":  AttributeRSSI,
+		},
+	},
+	{
+		Model:        "GT06-Clone",
+		Manufacturer: "Generic",
+		Protocol:     "gt06",
+		Quirks:       model.Quirks{XORChecksum: true},
+		Commands:     []string{string(gt06.CommandEngineStop), string(gt06.CommandEngineResume)},
+		AttributeMappings: map[string]string{
+			"powerLevel": AttributeBatteryLevel,
+			"gsmSignal":  AttributeRSSI,
+		},
+		Battery: &model.BatteryThresholds{Attribute: AttributeBatteryLevel, Low: 2, Critical: 1},
+	},
+	{
+		Model:        "ST-901",
+		Manufacturer: "SinoTrack",
+		Protocol:     "h02",
+		Commands:     h02Commands,
+		AttributeMappings: map[string]string{
+			"powerLevel": AttributeBatteryLevel,
+			"gsmSignal":  AttributeRSSI,
+		},
+		Battery: &model.BatteryThresholds{Attribute: AttributeBatteryLevel, Low: 20, Critical: 10},
+	},
+	{
+		Model:        "GL200",
+		Manufacturer: "Queclink",
+		Protocol:     "queclink",
+		Commands:     []string{},
+		AttributeMappings: map[string]string{
+			"battery": AttributeBatteryLevel,
+		},
+		Battery: &model.BatteryThresholds{Attribute: AttributeBatteryLevel, Low: 20, Critical: 10},
+	},
+	{
+		Model:        "GV500",
+		Manufacturer: "Queclink",
+		Protocol:     "queclink",
+		Commands:     []string{},
+	},
+	{
+		Model:        "TK303",
+		Manufacturer: "Coban",
+		Protocol:     "coban",
+		Commands:     []string{},
+	},
+	{
+		Model:        "TK5000",
+		Manufacturer: "Coban",
+		Protocol:     "coban",
+		Commands:     []string{},
+	},
+	{
+		Model:        "Q50",
+		Manufacturer: "Generic",
+		Protocol:     "watch",
+		Commands:     []string{watch.CommandText},
+		AttributeMappings: map[string]string{
+			"battery":   AttributeBatteryLevel,
+			"gsmSignal": AttributeRSSI,
+		},
+		Battery: &model.BatteryThresholds{Attribute: AttributeBatteryLevel, Low: 20, Critical: 10},
+	},
+	{
+		Model:        "FMB920",
+		Manufacturer: "Teltonika",
+		Protocol:     "teltonika",
+		Commands:     []string{},
+	},
+}
+
+// Catalog is a read-only set of device profiles keyed by model name
+type Catalog struct {
+	profiles map[string]*model.DeviceProfile
+}
+
+// NewCatalog builds a catalog from the given profiles
+func NewCatalog(profiles ...*model.DeviceProfile) *Catalog {
+	c := &Catalog{profiles: make(map[string]*model.DeviceProfile, len(profiles))}
+	for _, p := range profiles {
+		c.profiles[strings.ToLower(p.Model)] = p
+	}
+	return c
+}
+
+// Default returns a catalog of the built-in profiles
+func Default() *Catalog {
+	return NewCatalog(builtinProfiles...)
+}
+
+// Find returns the profile for a model name, ignoring case, or nil
+func (c *Catalog) Find(modelName string) *model.DeviceProfile {
+	if c == nil || modelName == "" {
+		return nil
+	}
+	return c.profiles[strings.ToLower(modelName)]
+}
+
+// ForDevice returns the profile of the device's model, or nil
+func (c *Catalog) ForDevice(device *model.Device) *model.DeviceProfile {
+	if device == nil {
+		return nil
+	}
+	return c.Find(device.Model)
+}
+
+// All returns every profile ordered by model name
+func (c *Catalog) All() []*model.DeviceProfile {
+	if c == nil {
+		return nil
+	}
+	profiles := make([]*model.DeviceProfile, 0, len(c.profiles))
+	for _, p := range c.profiles {
+		profiles = append(profiles, p)
+	}
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].Model < profiles[j].Model })
+	return profiles
+}
+
+// PositionHook returns a StageDecoded hook applying each device's profile
+func (c *Catalog) PositionHook(deviceRepo repository.DeviceRepository) hook.PositionHook {
+	return func(ctx context.Context, position *model.Position) error {
+		device, err := deviceRepo.FindByID(position.DeviceID)
+		if err != nil {
+			return nil
+		}
+		if p := c.ForDevice(device); p != nil {
+			Apply(p, position)
+		}
+		return nil
+	}
+}
+
+// Apply renames mapped attributes and classifies the battery level
+func Apply(p *model.DeviceProfile, position *model.Position) {
+	if position.Status == nil {
+		position.Status = make(map[string]interface{})
+	}
+
+	for from, to := range p.AttributeMappings {
+		value, ok := position.Status[from]
+		if !ok {
+			continue
+		}
+		if _, taken := position.Status[to]; !taken {
+			position.Status[to] = value
+		}
+		delete(position.Status, from)
+	}
+
+	if p.Battery == nil {
+		return
+	}
+	level, ok := number(position.Status[p.Battery.Attribute])
+	if !ok {
+		return
+	}
+	switch {
+	case level <= p.Battery.Critical:
+		position.Status[AttributeBatteryState] = BatteryCritical
+	case level <= p.Battery.Low:
+		position.Status[AttributeBatteryState] = BatteryLow
+	default:
+		position.Status[AttributeBatteryState] = BatteryOK
+	}
+}
+
+func number(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint8:
+		return float64(v), true
+	case uint16:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	}
+	return 0, false
+}
@@ -0,0 +1,110 @@
+// Package projection decides which position attributes are persisted, so
+// operators can keep the attributes they use and stop storing the rest
+package projection
+
+import (
+	"context"
+	"strings"
+	"tracking/internal/core/model"
+)
+
+// Tokens accepted in an attribute list besides attribute names
+const (
+	// All keeps every attribute; it is the behaviour without a projection
+	All = "all"
+	// Default expands to DefaultAttributes
+	Default = "default"
+)
+
+// DefaultAttributes is the set kept by the "default" token: alarms and
+// vehicle states, the standard battery and signal attributes written by
+// device profiles, and the attributes added by geofencing, overspeed
+// detection, weather enrichment, the odometer and engine hours and the
+// normalized fuel level. Raw
+// decoder fields that profiles map to standard names (powerLevel,
+// gsmSignal, battery) and Teltonika IO elements (io<id>) are not in it.
+var DefaultAttributes = []string{
+	"alarm",
+	"event",
+	"ignition",
+	"acc",
+	"door",
+	"armed",
+	"charging",
+	"fuelCut",
+	"fuel1",
+	"fuel2",
+	"fuelLevel",
+	"geofence",
+	"geofenceId",
+	"geofenceIds",
+	"batteryLevel",
+	"batteryState",
+	"rssi",
+	"speedLimit",
+	"speedLimitSource",
+	"roadId",
+	"overspeed",
+	"weather",
+	"totalDistance",
+	"engineHours",
+}
+
+// Projection filters the status attributes of positions before storage
+type Projection struct {
+	keep map[string]bool // Nil keeps every attribute not dropped
+	drop map[string]bool
+}
+
+// New builds a projection keeping the attributes listed in keep and then
+// removing those listed in drop. Keep entries may use the "all" and
+// "default" tokens; an empty keep list keeps everything.
+func New(keep, drop []string) *Projection {
+	p := &Projection{drop: make(map[string]bool, len(drop))}
+	for _, name := range drop {
+		if name = strings.TrimSpace(name); name != "" {
+			p.drop[name] = true
+		}
+	}
+
+	for _, name := range keep {
+		switch name = strings.TrimSpace(name); name {
+		case "":
+		case All:
+			p.keep = nil
+			return p
+		case Default:
+			p.addKeep(DefaultAttributes...)
+		default:
+			p.addKeep(name)
+		}
+	}
+	return p
+}
+
+func (p *Projection) addKeep(names ...string) {
+	if p.keep == nil {
+		p.keep = make(map[string]bool, len(names))
+	}
+	for _, name := range names {
+		p.keep[name] = true
+	}
+}
+
+// Enabled reports whether the projection removes any attribute
+func (p *Projection) Enabled() bool {
+	return p != nil && (p.keep != nil || len(p.drop) > 0)
+}
+
+// Apply removes the attributes the projection does not keep. It is a
+// StageDecoded hook registered after every enriching hook; stored-stage
+// hooks see the projected position, so dropping overspeed also stops
+// overspeed events.
+func (p *Projection) Apply(ctx context.Context, position *model.Position) error {
+	for name := range position.Status {
+		if p.drop[name] || (p.keep != nil && !p.keep[name]) {
+			delete(position.Status, name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+// Package push sends alarm and geofence notifications to the mobile and
+// web apps of the users who can reach a device, through Firebase Cloud
+// Messaging
+package push
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"tracking/internal/core/util"
+)
+
+// DefaultFCMURL is the Firebase Cloud Messaging API
+const DefaultFCMURL = "https://fcm.googleapis.com"
+
+// messagingScope is the OAuth scope sending messages takes
+const messagingScope = "https://www.googleapis.com/auth/firebase.messaging"
+
+// ErrUnregistered reports a token the app no longer holds, such as one of
+// an uninstalled app, which should be forgotten
+var ErrUnregistered = errors.New("push token unregistered")
+
+// Message is a notification shown by the app, with data the app reads to
+// open what it is about
+type Message struct {
+	Title string
+	Body  string
+	Data  map[string]string
+}
+
+// Sender delivers a message to one app installation
+type Sender interface {
+	Send(token string, message Message) error
+}
+
+// serviceAccount holds the fields of a Firebase service account key, as
+// downloaded from the console, that sending takes
+type serviceAccount struct {
+	ProjectID   string `json:"project_id"`
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenURI    string `json:"token_uri"`
+}
+
+// FCMSender sends through the FCM HTTP v1 API, authenticating as a service
+// account. Access tokens are fetched as needed and reused until shortly
+// before they expire.
+type FCMSender struct {
+	client  *http.Client
+	sendURL string
+	account serviceAccount
+	key     *rsa.PrivateKey
+	clock   util.Clock
+
+	mutex       sync.Mutex
+	accessToken string
+	expiry      time.Time
+}
+
+// NewFCMSender reads the service account key from credentialsFile and
+// sends to the API at baseURL, DefaultFCMURL when empty
+func NewFCMSender(credentialsFile, baseURL string, clock util.Clock) (*FCMSender, error) {
+	content, err := os.ReadFile(credentialsFile)
+	if err != nil {
+		return nil, fmt.Errorf("read FCM credentials: %w", err)
+	}
+	var account serviceAccount
+	if err := json.Unmarshal(content, &account); err != nil {
+		return nil, fmt.Errorf("parse FCM credentials: %w", err)
+	}
+	if account.ProjectID == "" || account.ClientEmail == "" || account.TokenURI == "" {
+		return nil, errors.New("FCM credentials lack project_id, client_email or token_uri")
+	}
+	key, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(account.PrivateKey))
+	if err != nil {
+		return nil, fmt.Errorf("parse FCM private key: %w", err)
+	}
+
+	if baseURL == "" {
+		baseURL = DefaultFCMURL
+	}
+	return &FCMSender{
+		client:  &http.Client{Timeout: 10 * time.Second},
+		sendURL: strings.TrimSuffix(baseURL, "/") + "/v1/projects/" + url.PathEscape(account.ProjectID) + "/messages:send",
+		account: account,
+		key:     key,
+		clock:   clock,
+	}, nil
+}
+
+type fcmNotification struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+}
+
+type fcmMessage struct {
+	Token        string            `json:"token"`
+	Notification fcmNotification   `json:"notification"`
+	Data         map[string]string `json:"data,omitempty"`
+}
+
+func (s *FCMSender) Send(token string, message Message) error {
+	accessToken, err := s.token()
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(map[string]fcmMessage{"message": {
+		Token:        token,
+		Notification: fcmNotification{Title: message.Title, Body: message.Body},
+		Data:         message.Data,
+	}})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, s.sendURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	reply, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode == http.StatusUnauthorized {
+		s.mutex.Lock()
+		s.accessToken = ""
+		s.mutex.Unlock()
+	}
+	if resp.StatusCode == http.StatusNotFound || bytes.Contains(reply, []byte("UNREGISTERED")) {
+		return ErrUnregistered
+	}
+	return fmt.Errorf("FCM returned status %d: %s", resp.StatusCode, bytes.TrimSpace(reply))
+}
+
+// token returns an access token, exchanging a signed assertion for a new
+// one when the last is about to expire
+func (s *FCMSender) token() (string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := s.clock.Now()
+	if s.accessToken != "" && now.Add(time.Minute).Before(s.expiry) {
+		return s.accessToken, nil
+	}
+
+	assertion, err := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":   s.account.ClientEmail,
+		"scope": messagingScope,
+		"aud":   s.account.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	}).SignedString(s.key)
+	if err != nil {
+		return "", err
+	}
+	resp, err := s.client.PostForm(s.account.TokenURI, url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("FCM token exchange returned status %d", resp.StatusCode)
+	}
+
+	var granted struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"` // Seconds
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&granted); err != nil {
+		return "", err
+	}
+	if granted.AccessToken == "" {
+		return "", errors.New("FCM token exchange granted no access token")
+	}
+	s.accessToken = granted.AccessToken
+	s.expiry = now.Add(time.Duration(granted.ExpiresIn) * time.Second)
+	return s.accessToken, nil
+}
@@ -0,0 +1,142 @@
+package push
+
+import (
+	"errors"
+	"log"
+
+	"tracking/internal/core/model"
+)
+
+const queueSize = 1000
+
+// Recipients returns the device an event is about and the push tokens of
+// the users who can reach it
+type Recipients func(event *model.Event) (*model.Device, []string, error)
+
+// Forget removes a token the app no longer holds
+type Forget func(token string) error
+
+// Notifier pushes alarm and geofence events to the apps of the users who
+// can reach the device. Events are handled in the background; one raised
+// while the queue is full, or a push FCM refuses, is logged and dropped.
+// Tokens FCM reports unregistered are forgotten.
+type Notifier struct {
+	recipients Recipients
+	forget     Forget
+	sender     Sender
+	queue      chan *model.Event
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func NewNotifier(recipients Recipients, forget Forget, sender Sender) *Notifier {
+	return &Notifier{
+		recipients: recipients,
+		forget:     forget,
+		sender:     sender,
+		queue:      make(chan *model.Event, queueSize),
+	}
+}
+
+// Handle queues an alarm or geofence event; it is an event handler
+func (n *Notifier) Handle(event *model.Event) {
+	switch event.Type {
+	case model.EventAlarm, model.EventGeofenceEnter, model.EventGeofenceExit:
+	default:
+		return
+	}
+	select {
+	case n.queue <- event:
+	default:
+		log.Printf("[Push] queue full, dropping %s event of device %s", event.Type, event.DeviceID)
+	}
+}
+
+// Start pushes queued events until Stop
+func (n *Notifier) Start() {
+	n.stop = make(chan struct{})
+	n.done = make(chan struct{})
+	go func() {
+		defer close(n.done)
+		for {
+			select {
+			case event := <-n.queue:
+				n.push(event)
+			case <-n.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop ends delivery; events not yet pushed are dropped
+func (n *Notifier) Stop() {
+	if n.stop == nil {
+		return
+	}
+	close(n.stop)
+	<-n.done
+	n.stop = nil
+}
+
+// push sends an event to every token of the users who can reach its device
+func (n *Notifier) push(event *model.Event) {
+	device, tokens, err := n.recipients(event)
+	if err != nil {
+		log.Printf("[Push] failed to find recipients of %s event of device %s: %v", event.Type, event.DeviceID, err)
+		return
+	}
+	if device == nil || len(tokens) == 0 {
+		return
+	}
+
+	message := eventMessage(device, event)
+	for _, token := range tokens {
+		err := n.sender.Send(token, message)
+		if errors.Is(err, ErrUnregistered) {
+			if err := n.forget(token); err != nil {
+				log.Printf("[Push] failed to forget unregistered token: %v", err)
+			}
+			continue
+		}
+		if err != nil {
+			log.Printf("[Push] failed to push %s event of device %s: %v", event.Type, event.DeviceID, err)
+		}
+	}
+}
+
+// eventMessage describes an event, with the IDs the app opens it by
+func eventMessage(device *model.Device, event *model.Event) Message {
+	at := event.Timestamp.UTC().Format("2006-01-02 15:04 UTC")
+	message := Message{Data: map[string]string{
+		"eventId":   event.ID,
+		"eventType": event.Type,
+		"deviceId":  device.ID,
+	}}
+
+	switch event.Type {
+	case model.EventAlarm:
+		alarm, _ := event.Attributes["alarm"].(string)
+		if alarm == model.NotifySOS {
+			message.Title = "SOS from " + device.Name
+			message.Body = device.Name + " raised an SOS alarm at " + at + "."
+		} else {
+			message.Title = "Alarm on " + device.Name
+			message.Body = device.Name + " raised a " + alarm + " alarm at " + at + "."
+		}
+		message.Data["alarm"] = alarm
+	case model.EventGeofenceEnter, model.EventGeofenceExit:
+		geofence, _ := event.Attributes["geofenceName"].(string)
+		verb := "left"
+		if event.Type == model.EventGeofenceEnter {
+			verb = "entered"
+		}
+		message.Title = device.Name + " " + verb + " " + geofence
+		message.Body = device.Name + " " + verb + " the geofence " + geofence + " at " + at + "."
+		if id, ok := event.Attributes["geofenceId"].(string); ok {
+			message.Data["geofenceId"] = id
+		}
+	}
+	return message
+}
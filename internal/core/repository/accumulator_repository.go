@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"context"
+	"time"
+	"tracking/internal/core/model"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// AccumulatorRepository keeps the running totals of devices and the
+// baselines users set them to
+type AccumulatorRepository interface {
+	// Save stores the totals of a device, replacing any before
+	Save(accumulators *model.Accumulators) error
+	// Find returns the totals of a device, or nil
+	Find(deviceID string) (*model.Accumulators, error)
+	CreateBaseline(baseline *model.AccumulatorBaseline) error
+	// FindBaselines returns the baselines of a device by effective time,
+	// the order they apply in
+	FindBaselines(deviceID string) ([]*model.AccumulatorBaseline, error)
+}
+
+type MongoAccumulatorRepository struct {
+	collection *mongo.Collection
+	baselines  *mongo.Collection
+}
+
+func NewMongoAccumulatorRepository(db *mongo.Database) *MongoAccumulatorRepository {
+	return &MongoAccumulatorRepository{
+		collection: db.Collection("accumulators"),
+		baselines:  db.Collection("accumulator_baselines"),
+	}
+}
+
+func (r *MongoAccumulatorRepository) Save(accumulators *model.Accumulators) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"deviceid": accumulators.DeviceID}
+	_, err := r.collection.ReplaceOne(ctx, filter, accumulators, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (r *MongoAccumulatorRepository) Find(deviceID string) (*model.Accumulators, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var accumulators model.Accumulators
+	err := r.collection.FindOne(ctx, bson.M{"deviceid": deviceID}).Decode(&accumulators)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	return &accumulators, err
+}
+
+func (r *MongoAccumulatorRepository) CreateBaseline(baseline *model.AccumulatorBaseline) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.baselines.InsertOne(ctx, baseline)
+	return err
+}
+
+func (r *MongoAccumulatorRepository) FindBaselines(deviceID string) ([]*model.AccumulatorBaseline, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "effectiveat", Value: 1}, {Key: "createdat", Value: 1}})
+	cursor, err := r.baselines.Find(ctx, bson.M{"deviceid": deviceID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var baselines []*model.AccumulatorBaseline
+	if err = cursor.All(ctx, &baselines); err != nil {
+		return nil, err
+	}
+	return baselines, nil
+}
@@ -0,0 +1,99 @@
+package repository
+
+import (
+	"context"
+	"time"
+	"tracking/internal/core/model"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ChangeRepository is the append-only change journal clients sync from
+type ChangeRepository interface {
+	// Append numbers the change with the next sequence and stores it
+	Append(change *model.Change) error
+	// FindAfter returns up to limit changes following the sequence, oldest
+	// first
+	FindAfter(sequence int64, limit int) ([]*model.Change, error)
+	// LatestSequence returns the sequence of the last change, or 0 when
+	// there is none
+	LatestSequence() (int64, error)
+}
+
+// changeSettleTime is how long a gap in the journal is waited on before
+// the missing sequence is taken to belong to a failed append
+const changeSettleTime = 5 * time.Second
+
+type MongoChangeRepository struct {
+	collection *mongo.Collection
+	counters   *mongo.Collection
+}
+
+func NewMongoChangeRepository(db *mongo.Database) *MongoChangeRepository {
+	return &MongoChangeRepository{
+		collection: db.Collection("changes"),
+		counters:   db.Collection("counters"),
+	}
+}
+
+func (r *MongoChangeRepository) Append(change *model.Change) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var counter struct {
+		Sequence int64 `bson:"sequence"`
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	err := r.counters.FindOneAndUpdate(ctx, bson.M{"_id": "changes"}, bson.M{"$inc": bson.M{"sequence": 1}}, opts).Decode(&counter)
+	if err != nil {
+		return err
+	}
+
+	change.Sequence = counter.Sequence
+	_, err = r.collection.InsertOne(ctx, change)
+	return err
+}
+
+// FindAfter stops short of a gap younger than changeSettleTime. Sequences
+// are taken before the insert, so a concurrent append may still land behind
+// one already visible, and a client must not move its cursor past it.
+func (r *MongoChangeRepository) FindAfter(sequence int64, limit int) ([]*model.Change, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.M{"sequence": 1}).SetLimit(int64(limit))
+	cursor, err := r.collection.Find(ctx, bson.M{"sequence": bson.M{"$gt": sequence}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var changes []*model.Change
+	if err = cursor.All(ctx, &changes); err != nil {
+		return nil, err
+	}
+
+	settled := time.Now().Add(-changeSettleTime)
+	for i, change := range changes {
+		if change.Sequence != sequence+1 && change.Timestamp.After(settled) {
+			return changes[:i], nil
+		}
+		sequence = change.Sequence
+	}
+	return changes, nil
+}
+
+func (r *MongoChangeRepository) LatestSequence() (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var change model.Change
+	opts := options.FindOne().SetSort(bson.M{"sequence": -1})
+	err := r.collection.FindOne(ctx, bson.M{}, opts).Decode(&change)
+	if err == mongo.ErrNoDocuments {
+		return 0, nil
+	}
+	return change.Sequence, err
+}
@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"context"
+	"time"
+	"tracking/internal/core/model"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type CommandRepository interface {
+	Create(command *model.Command) error
+	Update(command *model.Command) error
+	FindByID(id string) (*model.Command, error)
+	// FindByDeviceID returns the commands of a device, oldest first
+	FindByDeviceID(deviceID string) ([]*model.Command, error)
+	// FindByStatus returns the commands of a device in a status, oldest first
+	FindByStatus(deviceID, status string) ([]*model.Command, error)
+}
+
+type MongoCommandRepository struct {
+	collection *mongo.Collection
+}
+
+func NewMongoCommandRepository(db *mongo.Database) *MongoCommandRepository {
+	return &MongoCommandRepository{
+		collection: db.Collection("commands"),
+	}
+}
+
+func (r *MongoCommandRepository) Create(command *model.Command) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.collection.InsertOne(ctx, command)
+	return err
+}
+
+func (r *MongoCommandRepository) Update(command *model.Command) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.collection.ReplaceOne(ctx, bson.M{"id": command.ID}, command)
+	return err
+}
+
+func (r *MongoCommandRepository) FindByID(id string) (*model.Command, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var command model.Command
+	err := r.collection.FindOne(ctx, bson.M{"id": id}).Decode(&command)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	return &command, err
+}
+
+func (r *MongoCommandRepository) FindByDeviceID(deviceID string) ([]*model.Command, error) {
+	return r.find(bson.M{"deviceid": deviceID})
+}
+
+func (r *MongoCommandRepository) FindByStatus(deviceID, status string) ([]*model.Command, error) {
+	return r.find(bson.M{"deviceid": deviceID, "status": status})
+}
+
+func (r *MongoCommandRepository) find(filter bson.M) ([]*model.Command, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Object IDs increase as commands are queued, breaking ties in time
+	opts := options.Find().SetSort(bson.D{{Key: "createdat", Value: 1}, {Key: "_id", Value: 1}})
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var commands []*model.Command
+	if err = cursor.All(ctx, &commands); err != nil {
+		return nil, err
+	}
+	return commands, nil
+}
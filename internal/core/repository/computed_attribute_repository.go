@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"context"
+	"time"
+	"tracking/internal/core/model"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type ComputedAttributeRepository interface {
+	Create(attribute *model.ComputedAttribute) error
+	Update(attribute *model.ComputedAttribute) error
+	Delete(id string) error
+	FindByID(id string) (*model.ComputedAttribute, error)
+	// FindByDeviceID returns the attributes of a device in the order they
+	// are computed in
+	FindByDeviceID(deviceID string) ([]*model.ComputedAttribute, error)
+}
+
+type MongoComputedAttributeRepository struct {
+	collection *mongo.Collection
+}
+
+func NewMongoComputedAttributeRepository(db *mongo.Database) *MongoComputedAttributeRepository {
+	return &MongoComputedAttributeRepository{
+		collection: db.Collection("computed_attributes"),
+	}
+}
+
+func (r *MongoComputedAttributeRepository) Create(attribute *model.ComputedAttribute) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.collection.InsertOne(ctx, attribute)
+	return err
+}
+
+func (r *MongoComputedAttributeRepository) Update(attribute *model.ComputedAttribute) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.collection.ReplaceOne(ctx, bson.M{"id": attribute.ID}, attribute)
+	return err
+}
+
+func (r *MongoComputedAttributeRepository) Delete(id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.collection.DeleteOne(ctx, bson.M{"id": id})
+	return err
+}
+
+func (r *MongoComputedAttributeRepository) FindByID(id string) (*model.ComputedAttribute, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var attribute model.ComputedAttribute
+	err := r.collection.FindOne(ctx, bson.M{"id": id}).Decode(&attribute)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	return &attribute, err
+}
+
+func (r *MongoComputedAttributeRepository) FindByDeviceID(deviceID string) ([]*model.ComputedAttribute, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "priority", Value: 1}, {Key: "createdat", Value: 1}, {Key: "id", Value: 1}})
+	cursor, err := r.collection.Find(ctx, bson.M{"deviceid": deviceID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var attributes []*model.ComputedAttribute
+	if err = cursor.All(ctx, &attributes); err != nil {
+		return nil, err
+	}
+	return attributes, nil
+}
@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"context"
+	"time"
+	"tracking/internal/core/model"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// DataKeyRepository keeps the wrapped data keys sensitive fields are
+// encrypted with, one per scope
+type DataKeyRepository interface {
+	// CreateIfAbsent stores the key unless its scope has one, and returns
+	// the key the scope ends up with, so servers racing to create one
+	// agree on it
+	CreateIfAbsent(key *model.DataKey) (*model.DataKey, error)
+	// Update replaces the key of a scope, as when it is rewrapped
+	Update(key *model.DataKey) error
+	// FindByScope returns the key of a scope, or nil
+	FindByScope(scope string) (*model.DataKey, error)
+	FindAll() ([]*model.DataKey, error)
+}
+
+type MongoDataKeyRepository struct {
+	collection *mongo.Collection
+}
+
+func NewMongoDataKeyRepository(db *mongo.Database) *MongoDataKeyRepository {
+	return &MongoDataKeyRepository{
+		collection: db.Collection("data_keys"),
+	}
+}
+
+func (r *MongoDataKeyRepository) CreateIfAbsent(key *model.DataKey) (*model.DataKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"scope": key.Scope}
+	update := bson.M{"$setOnInsert": key}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	var stored model.DataKey
+	if err := r.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&stored); err != nil {
+		return nil, err
+	}
+	return &stored, nil
+}
+
+func (r *MongoDataKeyRepository) Update(key *model.DataKey) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.collection.ReplaceOne(ctx, bson.M{"scope": key.Scope}, key)
+	return err
+}
+
+func (r *MongoDataKeyRepository) FindByScope(scope string) (*model.DataKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var key model.DataKey
+	err := r.collection.FindOne(ctx, bson.M{"scope": scope}).Decode(&key)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	return &key, err
+}
+
+func (r *MongoDataKeyRepository) FindAll() ([]*model.DataKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := r.collection.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var keys []*model.DataKey
+	if err = cursor.All(ctx, &keys); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"context"
+	"time"
+	"tracking/internal/core/model"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// DataModeRepository keeps the reporting modes devices are asked for
+type DataModeRepository interface {
+	// Save stores the mode of a device, replacing any before
+	Save(mode *model.DataMode) error
+	// Find returns the mode of a device, or nil
+	Find(deviceID string) (*model.DataMode, error)
+}
+
+type MongoDataModeRepository struct {
+	collection *mongo.Collection
+}
+
+func NewMongoDataModeRepository(db *mongo.Database) *MongoDataModeRepository {
+	return &MongoDataModeRepository{
+		collection: db.Collection("data_modes"),
+	}
+}
+
+func (r *MongoDataModeRepository) Save(mode *model.DataMode) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"deviceid": mode.DeviceID}
+	_, err := r.collection.ReplaceOne(ctx, filter, mode, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (r *MongoDataModeRepository) Find(deviceID string) (*model.DataMode, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var mode model.DataMode
+	err := r.collection.FindOne(ctx, bson.M{"deviceid": deviceID}).Decode(&mode)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	return &mode, err
+}
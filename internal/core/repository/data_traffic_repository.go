@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"context"
+	"time"
+	"tracking/internal/core/model"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// DataTrafficRepository keeps the monthly traffic of devices by SIM
+type DataTrafficRepository interface {
+	// Add counts traffic on the record of the device, SIM and month,
+	// creating it when missing
+	Add(deviceID, iccid, month string, bytesIn, bytesOut int64, at time.Time) error
+	// FindMonth returns the records of the devices in a month, ordered by
+	// device and then SIM
+	FindMonth(deviceIDs []string, month string) ([]*model.DataTraffic, error)
+}
+
+type MongoDataTrafficRepository struct {
+	collection *mongo.Collection
+}
+
+func NewMongoDataTrafficRepository(db *mongo.Database) *MongoDataTrafficRepository {
+	return &MongoDataTrafficRepository{
+		collection: db.Collection("data_traffic"),
+	}
+}
+
+func (r *MongoDataTrafficRepository) Add(deviceID, iccid, month string, bytesIn, bytesOut int64, at time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Increments are atomic, so connections of a device flushing at once
+	// do not lose each other's counts
+	filter := bson.M{"deviceid": deviceID, "iccid": iccid, "month": month}
+	update := bson.M{
+		"$inc": bson.M{"bytesin": bytesIn, "bytesout": bytesOut},
+		"$set": bson.M{"updatedat": at},
+	}
+	_, err := r.collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	return err
+}
+
+func (r *MongoDataTrafficRepository) FindMonth(deviceIDs []string, month string) ([]*model.DataTraffic, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"deviceid": bson.M{"$in": deviceIDs}, "month": month}
+	opts := options.Find().SetSort(bson.D{{Key: "deviceid", Value: 1}, {Key: "iccid", Value: 1}})
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var traffic []*model.DataTraffic
+	if err = cursor.All(ctx, &traffic); err != nil {
+		return nil, err
+	}
+	return traffic, nil
+}
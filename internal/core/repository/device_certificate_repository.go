@@ -0,0 +1,91 @@
+package repository
+
+import (
+	"context"
+	"time"
+	"tracking/internal/core/model"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// DeviceCertificateRepository keeps the client certificates issued to
+// devices, without their private keys
+type DeviceCertificateRepository interface {
+	Create(certificate *model.DeviceCertificate) error
+	Update(certificate *model.DeviceCertificate) error
+	FindByID(id string) (*model.DeviceCertificate, error)
+	FindBySerial(serial string) (*model.DeviceCertificate, error)
+	// FindByDeviceID returns the certificates of a device, or of every
+	// device when deviceID is empty, newest first
+	FindByDeviceID(deviceID string) ([]*model.DeviceCertificate, error)
+}
+
+type MongoDeviceCertificateRepository struct {
+	collection *mongo.Collection
+}
+
+func NewMongoDeviceCertificateRepository(db *mongo.Database) *MongoDeviceCertificateRepository {
+	return &MongoDeviceCertificateRepository{
+		collection: db.Collection("device_certificates"),
+	}
+}
+
+func (r *MongoDeviceCertificateRepository) Create(certificate *model.DeviceCertificate) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.collection.InsertOne(ctx, certificate)
+	return err
+}
+
+func (r *MongoDeviceCertificateRepository) Update(certificate *model.DeviceCertificate) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.collection.ReplaceOne(ctx, bson.M{"id": certificate.ID}, certificate)
+	return err
+}
+
+func (r *MongoDeviceCertificateRepository) FindByID(id string) (*model.DeviceCertificate, error) {
+	return r.findOne(bson.M{"id": id})
+}
+
+func (r *MongoDeviceCertificateRepository) FindBySerial(serial string) (*model.DeviceCertificate, error) {
+	return r.findOne(bson.M{"serial": serial})
+}
+
+func (r *MongoDeviceCertificateRepository) FindByDeviceID(deviceID string) ([]*model.DeviceCertificate, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{}
+	if deviceID != "" {
+		filter["deviceid"] = deviceID
+	}
+	opts := options.Find().SetSort(bson.M{"createdat": -1})
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var certificates []*model.DeviceCertificate
+	if err = cursor.All(ctx, &certificates); err != nil {
+		return nil, err
+	}
+	return certificates, nil
+}
+
+func (r *MongoDeviceCertificateRepository) findOne(filter bson.M) (*model.DeviceCertificate, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var certificate model.DeviceCertificate
+	err := r.collection.FindOne(ctx, filter).Decode(&certificate)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	return &certificate, err
+}
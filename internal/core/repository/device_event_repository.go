@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"context"
+	"time"
+	"tracking/internal/core/model"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// DeviceEventRepository is an append-only store of device history
+type DeviceEventRepository interface {
+	Append(event *model.DeviceEvent) error
+	// FindByDeviceID returns the history of a device, oldest first
+	FindByDeviceID(deviceID string) ([]*model.DeviceEvent, error)
+	// FindLatest returns the last event of a device, or nil without history
+	FindLatest(deviceID string) (*model.DeviceEvent, error)
+	// FindUntil returns every event up to and including the given instant,
+	// oldest first
+	FindUntil(until time.Time) ([]*model.DeviceEvent, error)
+}
+
+type MongoDeviceEventRepository struct {
+	collection *mongo.Collection
+}
+
+func NewMongoDeviceEventRepository(db *mongo.Database) *MongoDeviceEventRepository {
+	return &MongoDeviceEventRepository{
+		collection: db.Collection("device_events"),
+	}
+}
+
+func (r *MongoDeviceEventRepository) Append(event *model.DeviceEvent) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.collection.InsertOne(ctx, event)
+	return err
+}
+
+func (r *MongoDeviceEventRepository) FindByDeviceID(deviceID string) ([]*model.DeviceEvent, error) {
+	opts := options.Find().SetSort(bson.M{"sequence": 1})
+	return r.find(bson.M{"deviceid": deviceID}, opts)
+}
+
+func (r *MongoDeviceEventRepository) FindLatest(deviceID string) (*model.DeviceEvent, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var event model.DeviceEvent
+	opts := options.FindOne().SetSort(bson.M{"sequence": -1})
+	err := r.collection.FindOne(ctx, bson.M{"deviceid": deviceID}, opts).Decode(&event)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	return &event, err
+}
+
+func (r *MongoDeviceEventRepository) FindUntil(until time.Time) ([]*model.DeviceEvent, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "timestamp", Value: 1}, {Key: "sequence", Value: 1}})
+	return r.find(bson.M{"timestamp": bson.M{"$lte": until}}, opts)
+}
+
+func (r *MongoDeviceEventRepository) find(filter bson.M, opts *options.FindOptions) ([]*model.DeviceEvent, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var events []*model.DeviceEvent
+	if err = cursor.All(ctx, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
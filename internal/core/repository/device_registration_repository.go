@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"context"
+	"time"
+	"tracking/internal/core/model"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type DeviceRegistrationRepository interface {
+	Create(registration *model.DeviceRegistration) error
+	Update(registration *model.DeviceRegistration) error
+	Delete(id string) error
+	FindByID(id string) (*model.DeviceRegistration, error)
+	FindByOwnerEmail(ownerEmail string) ([]*model.DeviceRegistration, error)
+}
+
+type MongoDeviceRegistrationRepository struct {
+	collection *mongo.Collection
+}
+
+func NewMongoDeviceRegistrationRepository(db *mongo.Database) *MongoDeviceRegistrationRepository {
+	return &MongoDeviceRegistrationRepository{
+		collection: db.Collection("device_registrations"),
+	}
+}
+
+func (r *MongoDeviceRegistrationRepository) Create(registration *model.DeviceRegistration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.collection.InsertOne(ctx, registration)
+	return err
+}
+
+func (r *MongoDeviceRegistrationRepository) Update(registration *model.DeviceRegistration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.collection.ReplaceOne(ctx, bson.M{"id": registration.ID}, registration)
+	return err
+}
+
+func (r *MongoDeviceRegistrationRepository) Delete(id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.collection.DeleteOne(ctx, bson.M{"id": id})
+	return err
+}
+
+func (r *MongoDeviceRegistrationRepository) FindByID(id string) (*model.DeviceRegistration, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var registration model.DeviceRegistration
+	err := r.collection.FindOne(ctx, bson.M{"id": id}).Decode(&registration)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	return &registration, err
+}
+
+func (r *MongoDeviceRegistrationRepository) FindByOwnerEmail(ownerEmail string) ([]*model.DeviceRegistration, error) {
+	return r.find(bson.M{"owneremail": ownerEmail})
+}
+
+func (r *MongoDeviceRegistrationRepository) find(filter bson.M) ([]*model.DeviceRegistration, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := r.collection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var registrations []*model.DeviceRegistration
+	if err = cursor.All(ctx, &registrations); err != nil {
+		return nil, err
+	}
+	return registrations, nil
+}
@@ -17,6 +17,11 @@ type DeviceRepository interface {
 	FindAll() ([]*model.Device, error)
 	FindByUserID(userID string) ([]*model.Device, error)
 	FindByUniqueID(uniqueID string) (*model.Device, error) // Added method
+	// FindByPhone returns the device whose SIM has the normalized number
+	FindByPhone(phone string) (*model.Device, error)
+	// FindByExternalID returns the device with the ID in the external
+	// system
+	FindByExternalID(system, id string) (*model.Device, error)
 }
 
 type MongoDeviceRepository struct {
@@ -110,4 +115,27 @@ func (r *MongoDeviceRepository) FindByUniqueID(uniqueID string) (*model.Device,
 		return nil, nil
 	}
 	return &device, err
-}
\ No newline at end of file
+}
+func (r *MongoDeviceRepository) FindByPhone(phone string) (*model.Device, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var device model.Device
+	err := r.collection.FindOne(ctx, bson.M{"phone": phone}).Decode(&device)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	return &device, err
+}
+
+func (r *MongoDeviceRepository) FindByExternalID(system, id string) (*model.Device, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var device model.Device
+	err := r.collection.FindOne(ctx, bson.M{"externalids." + system: id}).Decode(&device)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	return &device, err
+}
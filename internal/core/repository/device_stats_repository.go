@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"context"
+	"time"
+	"tracking/internal/core/model"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// DeviceStatsRepository keeps the daily aggregates of device positions
+type DeviceStatsRepository interface {
+	// Save stores the aggregate of a device and day, replacing any before
+	Save(stats *model.DeviceDayStats) error
+	// Find returns the aggregate of a device and day, or nil
+	Find(deviceID, day string) (*model.DeviceDayStats, error)
+	// FindRange returns the aggregates of the devices for the days from
+	// first to last inclusive, ordered by day and then device
+	FindRange(deviceIDs []string, first, last string) ([]*model.DeviceDayStats, error)
+}
+
+type MongoDeviceStatsRepository struct {
+	collection *mongo.Collection
+}
+
+func NewMongoDeviceStatsRepository(db *mongo.Database) *MongoDeviceStatsRepository {
+	return &MongoDeviceStatsRepository{
+		collection: db.Collection("device_stats"),
+	}
+}
+
+func (r *MongoDeviceStatsRepository) Save(stats *model.DeviceDayStats) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"deviceid": stats.DeviceID, "day": stats.Day}
+	_, err := r.collection.ReplaceOne(ctx, filter, stats, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (r *MongoDeviceStatsRepository) Find(deviceID, day string) (*model.DeviceDayStats, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var stats model.DeviceDayStats
+	err := r.collection.FindOne(ctx, bson.M{"deviceid": deviceID, "day": day}).Decode(&stats)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	return &stats, err
+}
+
+func (r *MongoDeviceStatsRepository) FindRange(deviceIDs []string, first, last string) ([]*model.DeviceDayStats, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{
+		"deviceid": bson.M{"$in": deviceIDs},
+		"day":      bson.M{"$gte": first, "$lte": last},
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "day", Value: 1}, {Key: "deviceid", Value: 1}})
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var stats []*model.DeviceDayStats
+	if err = cursor.All(ctx, &stats); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
@@ -0,0 +1,168 @@
+package repository
+
+import (
+	"context"
+	"time"
+	"tracking/internal/core/model"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// EventFilter narrows a listing of events. Empty fields match every event;
+// DeviceIDs is the exception, as an empty list matches none, so that a user
+// without devices sees nothing.
+type EventFilter struct {
+	DeviceIDs  []string
+	Types      []string
+	Severities []string
+	From       time.Time // Inclusive
+	To         time.Time // Exclusive
+}
+
+// EventCursor marks the last event of a page; the next page starts with
+// the event listed after it
+type EventCursor struct {
+	Timestamp time.Time
+	ID        string
+}
+
+// EventRepository keeps the events raised for devices
+type EventRepository interface {
+	Create(event *model.Event) error
+	Update(event *model.Event) error
+	FindByID(id string) (*model.Event, error)
+	// Find returns up to limit matching events, newest first and by ID
+	// within an instant, starting after the cursor when one is given
+	Find(filter EventFilter, after *EventCursor, limit int) ([]*model.Event, error)
+	// CountByDay counts matching events by UTC day and type, ordered by day
+	// and then type
+	CountByDay(filter EventFilter) ([]*model.EventCount, error)
+}
+
+type MongoEventRepository struct {
+	collection *mongo.Collection
+}
+
+func NewMongoEventRepository(db *mongo.Database) *MongoEventRepository {
+	return &MongoEventRepository{
+		collection: db.Collection("events"),
+	}
+}
+
+func (r *MongoEventRepository) Create(event *model.Event) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.collection.InsertOne(ctx, event)
+	return err
+}
+
+func (r *MongoEventRepository) Update(event *model.Event) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.collection.ReplaceOne(ctx, bson.M{"id": event.ID}, event)
+	return err
+}
+
+func (r *MongoEventRepository) FindByID(id string) (*model.Event, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var event model.Event
+	err := r.collection.FindOne(ctx, bson.M{"id": id}).Decode(&event)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	return &event, err
+}
+
+func (r *MongoEventRepository) Find(filter EventFilter, after *EventCursor, limit int) ([]*model.Event, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	query := eventQuery(filter)
+	if after != nil {
+		query["$or"] = bson.A{
+			bson.M{"timestamp": bson.M{"$lt": after.Timestamp}},
+			bson.M{"timestamp": after.Timestamp, "id": bson.M{"$lt": after.ID}},
+		}
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "timestamp", Value: -1}, {Key: "id", Value: -1}}).
+		SetLimit(int64(limit))
+
+	cursor, err := r.collection.Find(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var events []*model.Event
+	if err = cursor.All(ctx, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+func (r *MongoEventRepository) CountByDay(filter EventFilter) ([]*model.EventCount, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: eventQuery(filter)}},
+		{{Key: "$group", Value: bson.M{
+			"_id": bson.M{
+				"day":  bson.M{"$dateToString": bson.M{"format": "%Y-%m-%d", "date": "$timestamp"}},
+				"type": "$type",
+			},
+			"count": bson.M{"$sum": 1},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "_id.day", Value: 1}, {Key: "_id.type", Value: 1}}}},
+	}
+	cursor, err := r.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var groups []struct {
+		ID struct {
+			Day  string `bson:"day"`
+			Type string `bson:"type"`
+		} `bson:"_id"`
+		Count int `bson:"count"`
+	}
+	if err = cursor.All(ctx, &groups); err != nil {
+		return nil, err
+	}
+
+	counts := make([]*model.EventCount, len(groups))
+	for i, group := range groups {
+		counts[i] = &model.EventCount{Day: group.ID.Day, Type: group.ID.Type, Count: group.Count}
+	}
+	return counts, nil
+}
+
+func eventQuery(filter EventFilter) bson.M {
+	query := bson.M{"deviceid": bson.M{"$in": filter.DeviceIDs}}
+	if len(filter.Types) > 0 {
+		query["type"] = bson.M{"$in": filter.Types}
+	}
+	if len(filter.Severities) > 0 {
+		query["severity"] = bson.M{"$in": filter.Severities}
+	}
+	timestamp := bson.M{}
+	if !filter.From.IsZero() {
+		timestamp["$gte"] = filter.From
+	}
+	if !filter.To.IsZero() {
+		timestamp["$lt"] = filter.To
+	}
+	if len(timestamp) > 0 {
+		query["timestamp"] = timestamp
+	}
+	return query
+}
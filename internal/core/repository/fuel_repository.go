@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"context"
+	"time"
+	"tracking/internal/core/model"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// FuelRepository keeps the fuel level series of devices
+type FuelRepository interface {
+	Create(reading *model.FuelReading) error
+	// FindByDeviceID returns the readings of a device in [from, to),
+	// oldest first
+	FindByDeviceID(deviceID string, from, to time.Time) ([]*model.FuelReading, error)
+	// FindLatest returns the newest reading of a device, or nil without
+	// readings
+	FindLatest(deviceID string) (*model.FuelReading, error)
+}
+
+type MongoFuelRepository struct {
+	collection *mongo.Collection
+}
+
+func NewMongoFuelRepository(db *mongo.Database) *MongoFuelRepository {
+	return &MongoFuelRepository{
+		collection: db.Collection("fuel_readings"),
+	}
+}
+
+func (r *MongoFuelRepository) Create(reading *model.FuelReading) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.collection.InsertOne(ctx, reading)
+	return err
+}
+
+func (r *MongoFuelRepository) FindByDeviceID(deviceID string, from, to time.Time) ([]*model.FuelReading, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"deviceid": deviceID, "timestamp": bson.M{"$gte": from, "$lt": to}}
+	opts := options.Find().SetSort(bson.M{"timestamp": 1})
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var readings []*model.FuelReading
+	if err = cursor.All(ctx, &readings); err != nil {
+		return nil, err
+	}
+	return readings, nil
+}
+
+func (r *MongoFuelRepository) FindLatest(deviceID string) (*model.FuelReading, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var reading model.FuelReading
+	opts := options.FindOne().SetSort(bson.M{"timestamp": -1})
+	err := r.collection.FindOne(ctx, bson.M{"deviceid": deviceID}, opts).Decode(&reading)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	return &reading, err
+}
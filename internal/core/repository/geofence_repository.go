@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"context"
+	"time"
+	"tracking/internal/core/model"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type GeofenceRepository interface {
+	Create(geofence *model.Geofence) error
+	Update(geofence *model.Geofence) error
+	Delete(id string) error
+	FindByID(id string) (*model.Geofence, error)
+	// FindByOrganizationID returns the fences of an organization, by name
+	FindByOrganizationID(organizationID string) ([]*model.Geofence, error)
+	// FindPersonal returns the fences a user drew outside any
+	// organization, by name
+	FindPersonal(userID string) ([]*model.Geofence, error)
+}
+
+type MongoGeofenceRepository struct {
+	collection *mongo.Collection
+}
+
+func NewMongoGeofenceRepository(db *mongo.Database) *MongoGeofenceRepository {
+	return &MongoGeofenceRepository{
+		collection: db.Collection("geofences"),
+	}
+}
+
+func (r *MongoGeofenceRepository) Create(geofence *model.Geofence) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.collection.InsertOne(ctx, geofence)
+	return err
+}
+
+func (r *MongoGeofenceRepository) Update(geofence *model.Geofence) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.collection.ReplaceOne(ctx, bson.M{"id": geofence.ID}, geofence)
+	return err
+}
+
+func (r *MongoGeofenceRepository) Delete(id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.collection.DeleteOne(ctx, bson.M{"id": id})
+	return err
+}
+
+func (r *MongoGeofenceRepository) FindByID(id string) (*model.Geofence, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var geofence model.Geofence
+	err := r.collection.FindOne(ctx, bson.M{"id": id}).Decode(&geofence)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	return &geofence, err
+}
+
+func (r *MongoGeofenceRepository) FindByOrganizationID(organizationID string) ([]*model.Geofence, error) {
+	return r.find(bson.M{"organizationid": organizationID})
+}
+
+func (r *MongoGeofenceRepository) FindPersonal(userID string) ([]*model.Geofence, error) {
+	return r.find(bson.M{"userid": userID, "organizationid": ""})
+}
+
+func (r *MongoGeofenceRepository) find(filter bson.M) ([]*model.Geofence, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.M{"name": 1})
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var geofences []*model.Geofence
+	if err = cursor.All(ctx, &geofences); err != nil {
+		return nil, err
+	}
+	return geofences, nil
+}
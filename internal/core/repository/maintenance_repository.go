@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"context"
+	"time"
+	"tracking/internal/core/model"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type MaintenanceRepository interface {
+	Create(maintenance *model.Maintenance) error
+	Update(maintenance *model.Maintenance) error
+	Delete(id string) error
+	FindByID(id string) (*model.Maintenance, error)
+	// FindByDeviceID returns the maintenances of a device by name
+	FindByDeviceID(deviceID string) ([]*model.Maintenance, error)
+}
+
+type MongoMaintenanceRepository struct {
+	collection *mongo.Collection
+}
+
+func NewMongoMaintenanceRepository(db *mongo.Database) *MongoMaintenanceRepository {
+	return &MongoMaintenanceRepository{
+		collection: db.Collection("maintenances"),
+	}
+}
+
+func (r *MongoMaintenanceRepository) Create(maintenance *model.Maintenance) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.collection.InsertOne(ctx, maintenance)
+	return err
+}
+
+func (r *MongoMaintenanceRepository) Update(maintenance *model.Maintenance) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.collection.ReplaceOne(ctx, bson.M{"id": maintenance.ID}, maintenance)
+	return err
+}
+
+func (r *MongoMaintenanceRepository) Delete(id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.collection.DeleteOne(ctx, bson.M{"id": id})
+	return err
+}
+
+func (r *MongoMaintenanceRepository) FindByID(id string) (*model.Maintenance, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var maintenance model.Maintenance
+	err := r.collection.FindOne(ctx, bson.M{"id": id}).Decode(&maintenance)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	return &maintenance, err
+}
+
+func (r *MongoMaintenanceRepository) FindByDeviceID(deviceID string) ([]*model.Maintenance, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "name", Value: 1}, {Key: "id", Value: 1}})
+	cursor, err := r.collection.Find(ctx, bson.M{"deviceid": deviceID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var maintenances []*model.Maintenance
+	if err = cursor.All(ctx, &maintenances); err != nil {
+		return nil, err
+	}
+	return maintenances, nil
+}
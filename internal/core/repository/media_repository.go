@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"context"
+	"time"
+	"tracking/internal/core/model"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type MediaRepository interface {
+	Create(media *model.Media) error
+	FindByID(id string) (*model.Media, error)
+	// FindByDeviceID returns the media of a device, newest first
+	FindByDeviceID(deviceID string) ([]*model.Media, error)
+}
+
+type MongoMediaRepository struct {
+	collection *mongo.Collection
+}
+
+func NewMongoMediaRepository(db *mongo.Database) *MongoMediaRepository {
+	return &MongoMediaRepository{
+		collection: db.Collection("media"),
+	}
+}
+
+func (r *MongoMediaRepository) Create(media *model.Media) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.collection.InsertOne(ctx, media)
+	return err
+}
+
+func (r *MongoMediaRepository) FindByID(id string) (*model.Media, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var media model.Media
+	err := r.collection.FindOne(ctx, bson.M{"id": id}).Decode(&media)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	return &media, err
+}
+
+func (r *MongoMediaRepository) FindByDeviceID(deviceID string) ([]*model.Media, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.M{"capturedat": -1})
+	cursor, err := r.collection.Find(ctx, bson.M{"deviceid": deviceID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var media []*model.Media
+	if err = cursor.All(ctx, &media); err != nil {
+		return nil, err
+	}
+	return media, nil
+}
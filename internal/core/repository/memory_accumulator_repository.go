@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"sort"
+	"sync"
+	"tracking/internal/core/model"
+)
+
+type inMemoryAccumulatorRepository struct {
+	accumulators map[string]*model.Accumulators // By device ID
+	baselines    map[string][]*model.AccumulatorBaseline
+	mutex        sync.RWMutex
+}
+
+func NewInMemoryAccumulatorRepository() AccumulatorRepository {
+	return &inMemoryAccumulatorRepository{
+		accumulators: make(map[string]*model.Accumulators),
+		baselines:    make(map[string][]*model.AccumulatorBaseline),
+	}
+}
+
+func (r *inMemoryAccumulatorRepository) Save(accumulators *model.Accumulators) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	stored := *accumulators
+	r.accumulators[accumulators.DeviceID] = &stored
+	return nil
+}
+
+func (r *inMemoryAccumulatorRepository) Find(deviceID string) (*model.Accumulators, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	if stored, exists := r.accumulators[deviceID]; exists {
+		accumulators := *stored
+		return &accumulators, nil
+	}
+	return nil, nil
+}
+
+func (r *inMemoryAccumulatorRepository) CreateBaseline(baseline *model.AccumulatorBaseline) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.baselines[baseline.DeviceID] = append(r.baselines[baseline.DeviceID], baseline)
+	return nil
+}
+
+func (r *inMemoryAccumulatorRepository) FindBaselines(deviceID string) ([]*model.AccumulatorBaseline, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	baselines := append([]*model.AccumulatorBaseline(nil), r.baselines[deviceID]...)
+	sort.SliceStable(baselines, func(i, j int) bool {
+		return baselines[i].EffectiveAt.Before(baselines[j].EffectiveAt)
+	})
+	return baselines, nil
+}
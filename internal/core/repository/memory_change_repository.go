@@ -0,0 +1,43 @@
+package repository
+
+import (
+	"sort"
+	"sync"
+	"tracking/internal/core/model"
+)
+
+type inMemoryChangeRepository struct {
+	changes []*model.Change // By sequence
+	mutex   sync.RWMutex
+}
+
+func NewInMemoryChangeRepository() ChangeRepository {
+	return &inMemoryChangeRepository{}
+}
+
+func (r *inMemoryChangeRepository) Append(change *model.Change) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	change.Sequence = int64(len(r.changes)) + 1
+	r.changes = append(r.changes, change)
+	return nil
+}
+
+func (r *inMemoryChangeRepository) FindAfter(sequence int64, limit int) ([]*model.Change, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	start := sort.Search(len(r.changes), func(i int) bool {
+		return r.changes[i].Sequence > sequence
+	})
+	end := min(len(r.changes), start+limit)
+	return append([]*model.Change(nil), r.changes[start:end]...), nil
+}
+
+func (r *inMemoryChangeRepository) LatestSequence() (int64, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return int64(len(r.changes)), nil
+}
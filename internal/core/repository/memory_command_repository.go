@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"tracking/internal/core/model"
+)
+
+type inMemoryCommandRepository struct {
+	commands map[string]*model.Command
+	order    []string // IDs as queued, which breaks ties in creation time
+	mutex    sync.RWMutex
+}
+
+func NewInMemoryCommandRepository() CommandRepository {
+	return &inMemoryCommandRepository{
+		commands: make(map[string]*model.Command),
+	}
+}
+
+func (r *inMemoryCommandRepository) Create(command *model.Command) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, exists := r.commands[command.ID]; exists {
+		return fmt.Errorf("command with ID %s already exists", command.ID)
+	}
+
+	r.commands[command.ID] = command
+	r.order = append(r.order, command.ID)
+	return nil
+}
+
+func (r *inMemoryCommandRepository) Update(command *model.Command) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, exists := r.commands[command.ID]; !exists {
+		return fmt.Errorf("command with ID %s not found", command.ID)
+	}
+
+	r.commands[command.ID] = command
+	return nil
+}
+
+func (r *inMemoryCommandRepository) FindByID(id string) (*model.Command, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	if command, exists := r.commands[id]; exists {
+		return command, nil
+	}
+	return nil, nil
+}
+
+func (r *inMemoryCommandRepository) FindByDeviceID(deviceID string) ([]*model.Command, error) {
+	return r.find(func(command *model.Command) bool {
+		return command.DeviceID == deviceID
+	})
+}
+
+func (r *inMemoryCommandRepository) FindByStatus(deviceID, status string) ([]*model.Command, error) {
+	return r.find(func(command *model.Command) bool {
+		return command.DeviceID == deviceID && command.Status == status
+	})
+}
+
+func (r *inMemoryCommandRepository) find(match func(*model.Command) bool) ([]*model.Command, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	var commands []*model.Command
+	for _, id := range r.order {
+		if command := r.commands[id]; match(command) {
+			commands = append(commands, command)
+		}
+	}
+	sort.SliceStable(commands, func(i, j int) bool {
+		return commands[i].CreatedAt.Before(commands[j].CreatedAt)
+	})
+	return commands, nil
+}
@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"tracking/internal/core/model"
+)
+
+type inMemoryComputedAttributeRepository struct {
+	attributes map[string]*model.ComputedAttribute
+	mutex      sync.RWMutex
+}
+
+func NewInMemoryComputedAttributeRepository() ComputedAttributeRepository {
+	return &inMemoryComputedAttributeRepository{
+		attributes: make(map[string]*model.ComputedAttribute),
+	}
+}
+
+func (r *inMemoryComputedAttributeRepository) Create(attribute *model.ComputedAttribute) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, exists := r.attributes[attribute.ID]; exists {
+		return fmt.Errorf("computed attribute with ID %s already exists", attribute.ID)
+	}
+
+	r.attributes[attribute.ID] = attribute
+	return nil
+}
+
+func (r *inMemoryComputedAttributeRepository) Update(attribute *model.ComputedAttribute) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, exists := r.attributes[attribute.ID]; !exists {
+		return fmt.Errorf("computed attribute with ID %s not found", attribute.ID)
+	}
+
+	r.attributes[attribute.ID] = attribute
+	return nil
+}
+
+func (r *inMemoryComputedAttributeRepository) Delete(id string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	delete(r.attributes, id)
+	return nil
+}
+
+func (r *inMemoryComputedAttributeRepository) FindByID(id string) (*model.ComputedAttribute, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	if attribute, exists := r.attributes[id]; exists {
+		return attribute, nil
+	}
+	return nil, nil
+}
+
+func (r *inMemoryComputedAttributeRepository) FindByDeviceID(deviceID string) ([]*model.ComputedAttribute, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	var attributes []*model.ComputedAttribute
+	for _, attribute := range r.attributes {
+		if attribute.DeviceID == deviceID {
+			attributes = append(attributes, attribute)
+		}
+	}
+	sort.Slice(attributes, func(i, j int) bool {
+		if attributes[i].Priority != attributes[j].Priority {
+			return attributes[i].Priority < attributes[j].Priority
+		}
+		if !attributes[i].CreatedAt.Equal(attributes[j].CreatedAt) {
+			return attributes[i].CreatedAt.Before(attributes[j].CreatedAt)
+		}
+		return attributes[i].ID < attributes[j].ID
+	})
+	return attributes, nil
+}
@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"sync"
+	"tracking/internal/core/model"
+)
+
+type inMemoryDataKeyRepository struct {
+	keys  map[string]*model.DataKey // By scope
+	mutex sync.RWMutex
+}
+
+func NewInMemoryDataKeyRepository() DataKeyRepository {
+	return &inMemoryDataKeyRepository{
+		keys: make(map[string]*model.DataKey),
+	}
+}
+
+func (r *inMemoryDataKeyRepository) CreateIfAbsent(key *model.DataKey) (*model.DataKey, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if stored, ok := r.keys[key.Scope]; ok {
+		copied := *stored
+		return &copied, nil
+	}
+	stored := *key
+	r.keys[key.Scope] = &stored
+	return key, nil
+}
+
+func (r *inMemoryDataKeyRepository) Update(key *model.DataKey) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	stored := *key
+	r.keys[key.Scope] = &stored
+	return nil
+}
+
+func (r *inMemoryDataKeyRepository) FindByScope(scope string) (*model.DataKey, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	stored, ok := r.keys[scope]
+	if !ok {
+		return nil, nil
+	}
+	copied := *stored
+	return &copied, nil
+}
+
+func (r *inMemoryDataKeyRepository) FindAll() ([]*model.DataKey, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	keys := make([]*model.DataKey, 0, len(r.keys))
+	for _, stored := range r.keys {
+		copied := *stored
+		keys = append(keys, &copied)
+	}
+	return keys, nil
+}
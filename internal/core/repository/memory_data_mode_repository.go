@@ -0,0 +1,32 @@
+package repository
+
+import (
+	"sync"
+	"tracking/internal/core/model"
+)
+
+type inMemoryDataModeRepository struct {
+	modes map[string]*model.DataMode // By device ID
+	mutex sync.RWMutex
+}
+
+func NewInMemoryDataModeRepository() DataModeRepository {
+	return &inMemoryDataModeRepository{
+		modes: make(map[string]*model.DataMode),
+	}
+}
+
+func (r *inMemoryDataModeRepository) Save(mode *model.DataMode) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.modes[mode.DeviceID] = mode
+	return nil
+}
+
+func (r *inMemoryDataModeRepository) Find(deviceID string) (*model.DataMode, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return r.modes[deviceID], nil
+}
@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"slices"
+	"sort"
+	"sync"
+	"time"
+	"tracking/internal/core/model"
+)
+
+type deviceSIMMonth struct {
+	deviceID string
+	iccid    string
+	month    string
+}
+
+type inMemoryDataTrafficRepository struct {
+	traffic map[deviceSIMMonth]*model.DataTraffic
+	mutex   sync.RWMutex
+}
+
+func NewInMemoryDataTrafficRepository() DataTrafficRepository {
+	return &inMemoryDataTrafficRepository{
+		traffic: make(map[deviceSIMMonth]*model.DataTraffic),
+	}
+}
+
+func (r *inMemoryDataTrafficRepository) Add(deviceID, iccid, month string, bytesIn, bytesOut int64, at time.Time) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	key := deviceSIMMonth{deviceID, iccid, month}
+	traffic, ok := r.traffic[key]
+	if !ok {
+		traffic = &model.DataTraffic{DeviceID: deviceID, ICCID: iccid, Month: month}
+		r.traffic[key] = traffic
+	}
+	traffic.BytesIn += bytesIn
+	traffic.BytesOut += bytesOut
+	traffic.UpdatedAt = at
+	return nil
+}
+
+func (r *inMemoryDataTrafficRepository) FindMonth(deviceIDs []string, month string) ([]*model.DataTraffic, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	var found []*model.DataTraffic
+	for key, traffic := range r.traffic {
+		if key.month == month && slices.Contains(deviceIDs, key.deviceID) {
+			copied := *traffic
+			found = append(found, &copied)
+		}
+	}
+	sort.Slice(found, func(i, j int) bool {
+		if found[i].DeviceID != found[j].DeviceID {
+			return found[i].DeviceID < found[j].DeviceID
+		}
+		return found[i].ICCID < found[j].ICCID
+	})
+	return found, nil
+}
@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"tracking/internal/core/model"
+)
+
+type inMemoryDeviceCertificateRepository struct {
+	certificates map[string]*model.DeviceCertificate
+	mutex        sync.RWMutex
+}
+
+func NewInMemoryDeviceCertificateRepository() DeviceCertificateRepository {
+	return &inMemoryDeviceCertificateRepository{
+		certificates: make(map[string]*model.DeviceCertificate),
+	}
+}
+
+func (r *inMemoryDeviceCertificateRepository) Create(certificate *model.DeviceCertificate) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, exists := r.certificates[certificate.ID]; exists {
+		return fmt.Errorf("device certificate with ID %s already exists", certificate.ID)
+	}
+
+	stored := *certificate
+	r.certificates[certificate.ID] = &stored
+	return nil
+}
+
+func (r *inMemoryDeviceCertificateRepository) Update(certificate *model.DeviceCertificate) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, exists := r.certificates[certificate.ID]; !exists {
+		return fmt.Errorf("device certificate with ID %s not found", certificate.ID)
+	}
+
+	stored := *certificate
+	r.certificates[certificate.ID] = &stored
+	return nil
+}
+
+func (r *inMemoryDeviceCertificateRepository) FindByID(id string) (*model.DeviceCertificate, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	if certificate, exists := r.certificates[id]; exists {
+		found := *certificate
+		return &found, nil
+	}
+	return nil, nil
+}
+
+func (r *inMemoryDeviceCertificateRepository) FindBySerial(serial string) (*model.DeviceCertificate, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	for _, certificate := range r.certificates {
+		if certificate.Serial == serial {
+			found := *certificate
+			return &found, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *inMemoryDeviceCertificateRepository) FindByDeviceID(deviceID string) ([]*model.DeviceCertificate, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	var certificates []*model.DeviceCertificate
+	for _, certificate := range r.certificates {
+		if deviceID == "" || certificate.DeviceID == deviceID {
+			found := *certificate
+			certificates = append(certificates, &found)
+		}
+	}
+	sort.Slice(certificates, func(i, j int) bool {
+		return certificates[i].CreatedAt.After(certificates[j].CreatedAt)
+	})
+	return certificates, nil
+}
@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+	"tracking/internal/core/model"
+)
+
+type inMemoryDeviceEventRepository struct {
+	events []*model.DeviceEvent // As appended
+	ids    map[string]bool
+	mutex  sync.RWMutex
+}
+
+func NewInMemoryDeviceEventRepository() DeviceEventRepository {
+	return &inMemoryDeviceEventRepository{
+		ids: make(map[string]bool),
+	}
+}
+
+func (r *inMemoryDeviceEventRepository) Append(event *model.DeviceEvent) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.ids[event.ID] {
+		return fmt.Errorf("device event with ID %s already exists", event.ID)
+	}
+
+	r.ids[event.ID] = true
+	r.events = append(r.events, event)
+	return nil
+}
+
+func (r *inMemoryDeviceEventRepository) FindByDeviceID(deviceID string) ([]*model.DeviceEvent, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	var events []*model.DeviceEvent
+	for _, event := range r.events {
+		if event.DeviceID == deviceID {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+func (r *inMemoryDeviceEventRepository) FindLatest(deviceID string) (*model.DeviceEvent, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	for i := len(r.events) - 1; i >= 0; i-- {
+		if r.events[i].DeviceID == deviceID {
+			return r.events[i], nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *inMemoryDeviceEventRepository) FindUntil(until time.Time) ([]*model.DeviceEvent, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	var events []*model.DeviceEvent
+	for _, event := range r.events {
+		if !event.Timestamp.After(until) {
+			events = append(events, event)
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Timestamp.Before(events[j].Timestamp)
+	})
+	return events, nil
+}
@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"fmt"
+	"sync"
+	"tracking/internal/core/model"
+)
+
+type inMemoryDeviceRegistrationRepository struct {
+	registrations map[string]*model.DeviceRegistration
+	mutex         sync.RWMutex
+}
+
+func NewInMemoryDeviceRegistrationRepository() DeviceRegistrationRepository {
+	return &inMemoryDeviceRegistrationRepository{
+		registrations: make(map[string]*model.DeviceRegistration),
+	}
+}
+
+func (r *inMemoryDeviceRegistrationRepository) Create(registration *model.DeviceRegistration) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, exists := r.registrations[registration.ID]; exists {
+		return fmt.Errorf("device registration with ID %s already exists", registration.ID)
+	}
+
+	r.registrations[registration.ID] = registration
+	return nil
+}
+
+func (r *inMemoryDeviceRegistrationRepository) Update(registration *model.DeviceRegistration) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, exists := r.registrations[registration.ID]; !exists {
+		return fmt.Errorf("device registration with ID %s not found", registration.ID)
+	}
+
+	r.registrations[registration.ID] = registration
+	return nil
+}
+
+func (r *inMemoryDeviceRegistrationRepository) Delete(id string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, exists := r.registrations[id]; !exists {
+		return fmt.Errorf("device registration with ID %s not found", id)
+	}
+
+	delete(r.registrations, id)
+	return nil
+}
+
+func (r *inMemoryDeviceRegistrationRepository) FindByID(id string) (*model.DeviceRegistration, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	if registration, exists := r.registrations[id]; exists {
+		return registration, nil
+	}
+	return nil, nil
+}
+
+func (r *inMemoryDeviceRegistrationRepository) FindByOwnerEmail(ownerEmail string) ([]*model.DeviceRegistration, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	var registrations []*model.DeviceRegistration
+	for _, registration := range r.registrations {
+		if registration.OwnerEmail == ownerEmail {
+			registrations = append(registrations, registration)
+		}
+	}
+	return registrations, nil
+}
@@ -75,6 +75,30 @@ func (r *inMemoryDeviceRepository) FindByUniqueID(uniqueID string) (*model.Devic
 	return nil, nil
 }
 
+func (r *inMemoryDeviceRepository) FindByPhone(phone string) (*model.Device, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	for _, device := range r.devices {
+		if device.Phone != "" && device.Phone == phone {
+			return device, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *inMemoryDeviceRepository) FindByExternalID(system, id string) (*model.Device, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	for _, device := range r.devices {
+		if id != "" && device.ExternalIDs[system] == id {
+			return device, nil
+		}
+	}
+	return nil, nil
+}
+
 func (r *inMemoryDeviceRepository) FindByUser(userID string) ([]*model.Device, error) {
 	r.mutex.RLock()
 	defer r.mutex.RUnlock()
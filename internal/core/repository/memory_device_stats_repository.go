@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"slices"
+	"sort"
+	"sync"
+	"tracking/internal/core/model"
+)
+
+type deviceDay struct {
+	deviceID string
+	day      string
+}
+
+type inMemoryDeviceStatsRepository struct {
+	stats map[deviceDay]*model.DeviceDayStats
+	mutex sync.RWMutex
+}
+
+func NewInMemoryDeviceStatsRepository() DeviceStatsRepository {
+	return &inMemoryDeviceStatsRepository{
+		stats: make(map[deviceDay]*model.DeviceDayStats),
+	}
+}
+
+func (r *inMemoryDeviceStatsRepository) Save(stats *model.DeviceDayStats) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.stats[deviceDay{stats.DeviceID, stats.Day}] = stats
+	return nil
+}
+
+func (r *inMemoryDeviceStatsRepository) Find(deviceID, day string) (*model.DeviceDayStats, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return r.stats[deviceDay{deviceID, day}], nil
+}
+
+func (r *inMemoryDeviceStatsRepository) FindRange(deviceIDs []string, first, last string) ([]*model.DeviceDayStats, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	var found []*model.DeviceDayStats
+	for key, stats := range r.stats {
+		if key.day >= first && key.day <= last && slices.Contains(deviceIDs, key.deviceID) {
+			found = append(found, stats)
+		}
+	}
+	sort.Slice(found, func(i, j int) bool {
+		if found[i].Day != found[j].Day {
+			return found[i].Day < found[j].Day
+		}
+		return found[i].DeviceID < found[j].DeviceID
+	})
+	return found, nil
+}
@@ -0,0 +1,127 @@
+package repository
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"tracking/internal/core/model"
+)
+
+type inMemoryEventRepository struct {
+	events map[string]*model.Event
+	mutex  sync.RWMutex
+}
+
+func NewInMemoryEventRepository() EventRepository {
+	return &inMemoryEventRepository{
+		events: make(map[string]*model.Event),
+	}
+}
+
+func (r *inMemoryEventRepository) Create(event *model.Event) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, exists := r.events[event.ID]; exists {
+		return fmt.Errorf("event with ID %s already exists", event.ID)
+	}
+
+	r.events[event.ID] = event
+	return nil
+}
+
+func (r *inMemoryEventRepository) Update(event *model.Event) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, exists := r.events[event.ID]; !exists {
+		return fmt.Errorf("event with ID %s not found", event.ID)
+	}
+
+	r.events[event.ID] = event
+	return nil
+}
+
+func (r *inMemoryEventRepository) FindByID(id string) (*model.Event, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	if event, exists := r.events[id]; exists {
+		return event, nil
+	}
+	return nil, nil
+}
+
+func (r *inMemoryEventRepository) Find(filter EventFilter, after *EventCursor, limit int) ([]*model.Event, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	var events []*model.Event
+	for _, event := range r.events {
+		if !matchesEvent(filter, event) {
+			continue
+		}
+		if after != nil && !eventBefore(event, after.Timestamp.UnixNano(), after.ID) {
+			continue
+		}
+		events = append(events, event)
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return eventBefore(events[j], events[i].Timestamp.UnixNano(), events[i].ID)
+	})
+	if len(events) > limit {
+		events = events[:limit]
+	}
+	return events, nil
+}
+
+func (r *inMemoryEventRepository) CountByDay(filter EventFilter) ([]*model.EventCount, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	type key struct{ day, eventType string }
+	groups := make(map[key]int)
+	for _, event := range r.events {
+		if matchesEvent(filter, event) {
+			groups[key{event.Timestamp.UTC().Format("2006-01-02"), event.Type}]++
+		}
+	}
+
+	counts := make([]*model.EventCount, 0, len(groups))
+	for group, count := range groups {
+		counts = append(counts, &model.EventCount{Day: group.day, Type: group.eventType, Count: count})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Day != counts[j].Day {
+			return counts[i].Day < counts[j].Day
+		}
+		return counts[i].Type < counts[j].Type
+	})
+	return counts, nil
+}
+
+func matchesEvent(filter EventFilter, event *model.Event) bool {
+	if !slices.Contains(filter.DeviceIDs, event.DeviceID) {
+		return false
+	}
+	if len(filter.Types) > 0 && !slices.Contains(filter.Types, event.Type) {
+		return false
+	}
+	if len(filter.Severities) > 0 && !slices.Contains(filter.Severities, event.Severity) {
+		return false
+	}
+	if !filter.From.IsZero() && event.Timestamp.Before(filter.From) {
+		return false
+	}
+	return filter.To.IsZero() || event.Timestamp.Before(filter.To)
+}
+
+// eventBefore reports whether the event is listed after the one with the
+// given timestamp and ID
+func eventBefore(event *model.Event, timestamp int64, id string) bool {
+	if t := event.Timestamp.UnixNano(); t != timestamp {
+		return t < timestamp
+	}
+	return event.ID < id
+}
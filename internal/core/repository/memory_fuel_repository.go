@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"sort"
+	"sync"
+	"time"
+	"tracking/internal/core/model"
+)
+
+type inMemoryFuelRepository struct {
+	readings map[string][]*model.FuelReading // By device ID, oldest first
+	mutex    sync.RWMutex
+}
+
+func NewInMemoryFuelRepository() FuelRepository {
+	return &inMemoryFuelRepository{
+		readings: make(map[string][]*model.FuelReading),
+	}
+}
+
+func (r *inMemoryFuelRepository) Create(reading *model.FuelReading) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	stored := *reading
+	readings := append(r.readings[reading.DeviceID], &stored)
+	// Buffered positions may arrive after newer ones
+	sort.SliceStable(readings, func(i, j int) bool { return readings[i].Timestamp.Before(readings[j].Timestamp) })
+	r.readings[reading.DeviceID] = readings
+	return nil
+}
+
+func (r *inMemoryFuelRepository) FindByDeviceID(deviceID string, from, to time.Time) ([]*model.FuelReading, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	found := []*model.FuelReading{}
+	for _, reading := range r.readings[deviceID] {
+		if !reading.Timestamp.Before(from) && reading.Timestamp.Before(to) {
+			copied := *reading
+			found = append(found, &copied)
+		}
+	}
+	return found, nil
+}
+
+func (r *inMemoryFuelRepository) FindLatest(deviceID string) (*model.FuelReading, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	readings := r.readings[deviceID]
+	if len(readings) == 0 {
+		return nil, nil
+	}
+	latest := *readings[len(readings)-1]
+	return &latest, nil
+}
@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"tracking/internal/core/model"
+)
+
+type inMemoryGeofenceRepository struct {
+	geofences map[string]*model.Geofence
+	mutex     sync.RWMutex
+}
+
+func NewInMemoryGeofenceRepository() GeofenceRepository {
+	return &inMemoryGeofenceRepository{
+		geofences: make(map[string]*model.Geofence),
+	}
+}
+
+func (r *inMemoryGeofenceRepository) Create(geofence *model.Geofence) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, exists := r.geofences[geofence.ID]; exists {
+		return fmt.Errorf("geofence with ID %s already exists", geofence.ID)
+	}
+
+	r.geofences[geofence.ID] = geofence
+	return nil
+}
+
+func (r *inMemoryGeofenceRepository) Update(geofence *model.Geofence) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, exists := r.geofences[geofence.ID]; !exists {
+		return fmt.Errorf("geofence with ID %s not found", geofence.ID)
+	}
+
+	r.geofences[geofence.ID] = geofence
+	return nil
+}
+
+func (r *inMemoryGeofenceRepository) Delete(id string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	delete(r.geofences, id)
+	return nil
+}
+
+func (r *inMemoryGeofenceRepository) FindByID(id string) (*model.Geofence, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	if geofence, exists := r.geofences[id]; exists {
+		return geofence, nil
+	}
+	return nil, nil
+}
+
+func (r *inMemoryGeofenceRepository) FindByOrganizationID(organizationID string) ([]*model.Geofence, error) {
+	return r.find(func(geofence *model.Geofence) bool {
+		return geofence.OrganizationID == organizationID
+	}), nil
+}
+
+func (r *inMemoryGeofenceRepository) FindPersonal(userID string) ([]*model.Geofence, error) {
+	return r.find(func(geofence *model.Geofence) bool {
+		return geofence.UserID == userID && geofence.OrganizationID == ""
+	}), nil
+}
+
+func (r *inMemoryGeofenceRepository) find(match func(*model.Geofence) bool) []*model.Geofence {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	var geofences []*model.Geofence
+	for _, geofence := range r.geofences {
+		if match(geofence) {
+			geofences = append(geofences, geofence)
+		}
+	}
+	sort.Slice(geofences, func(i, j int) bool {
+		return geofences[i].Name < geofences[j].Name
+	})
+	return geofences
+}
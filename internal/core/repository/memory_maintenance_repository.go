@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"tracking/internal/core/model"
+)
+
+type inMemoryMaintenanceRepository struct {
+	maintenances map[string]*model.Maintenance
+	mutex        sync.RWMutex
+}
+
+func NewInMemoryMaintenanceRepository() MaintenanceRepository {
+	return &inMemoryMaintenanceRepository{
+		maintenances: make(map[string]*model.Maintenance),
+	}
+}
+
+func (r *inMemoryMaintenanceRepository) Create(maintenance *model.Maintenance) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, exists := r.maintenances[maintenance.ID]; exists {
+		return fmt.Errorf("maintenance with ID %s already exists", maintenance.ID)
+	}
+
+	r.maintenances[maintenance.ID] = maintenance
+	return nil
+}
+
+func (r *inMemoryMaintenanceRepository) Update(maintenance *model.Maintenance) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, exists := r.maintenances[maintenance.ID]; !exists {
+		return fmt.Errorf("maintenance with ID %s not found", maintenance.ID)
+	}
+
+	r.maintenances[maintenance.ID] = maintenance
+	return nil
+}
+
+func (r *inMemoryMaintenanceRepository) Delete(id string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	delete(r.maintenances, id)
+	return nil
+}
+
+func (r *inMemoryMaintenanceRepository) FindByID(id string) (*model.Maintenance, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	if maintenance, exists := r.maintenances[id]; exists {
+		return maintenance, nil
+	}
+	return nil, nil
+}
+
+func (r *inMemoryMaintenanceRepository) FindByDeviceID(deviceID string) ([]*model.Maintenance, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	var maintenances []*model.Maintenance
+	for _, maintenance := range r.maintenances {
+		if maintenance.DeviceID == deviceID {
+			maintenances = append(maintenances, maintenance)
+		}
+	}
+	sort.Slice(maintenances, func(i, j int) bool {
+		if maintenances[i].Name != maintenances[j].Name {
+			return maintenances[i].Name < maintenances[j].Name
+		}
+		return maintenances[i].ID < maintenances[j].ID
+	})
+	return maintenances, nil
+}
@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"tracking/internal/core/model"
+)
+
+type inMemoryMediaRepository struct {
+	media map[string]*model.Media
+	mutex sync.RWMutex
+}
+
+func NewInMemoryMediaRepository() MediaRepository {
+	return &inMemoryMediaRepository{
+		media: make(map[string]*model.Media),
+	}
+}
+
+func (r *inMemoryMediaRepository) Create(media *model.Media) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, exists := r.media[media.ID]; exists {
+		return fmt.Errorf("media with ID %s already exists", media.ID)
+	}
+
+	r.media[media.ID] = media
+	return nil
+}
+
+func (r *inMemoryMediaRepository) FindByID(id string) (*model.Media, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	if media, exists := r.media[id]; exists {
+		return media, nil
+	}
+	return nil, nil
+}
+
+func (r *inMemoryMediaRepository) FindByDeviceID(deviceID string) ([]*model.Media, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	var result []*model.Media
+	for _, media := range r.media {
+		if media.DeviceID == deviceID {
+			result = append(result, media)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].CapturedAt.After(result[j].CapturedAt)
+	})
+	return result, nil
+}
@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"tracking/internal/core/model"
+)
+
+type inMemoryMessageRepository struct {
+	messages map[string]*model.Message
+	order    []string // IDs as created, so messages of the same instant keep their order
+	mutex    sync.RWMutex
+}
+
+func NewInMemoryMessageRepository() MessageRepository {
+	return &inMemoryMessageRepository{
+		messages: make(map[string]*model.Message),
+	}
+}
+
+func (r *inMemoryMessageRepository) Create(message *model.Message) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, exists := r.messages[message.ID]; exists {
+		return fmt.Errorf("message with ID %s already exists", message.ID)
+	}
+
+	r.messages[message.ID] = message
+	r.order = append(r.order, message.ID)
+	return nil
+}
+
+func (r *inMemoryMessageRepository) Update(message *model.Message) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, exists := r.messages[message.ID]; !exists {
+		return fmt.Errorf("message with ID %s not found", message.ID)
+	}
+
+	r.messages[message.ID] = message
+	return nil
+}
+
+func (r *inMemoryMessageRepository) FindByID(id string) (*model.Message, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	if message, exists := r.messages[id]; exists {
+		return message, nil
+	}
+	return nil, nil
+}
+
+func (r *inMemoryMessageRepository) FindByDeviceID(deviceID string) ([]*model.Message, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	var messages []*model.Message
+	for _, id := range r.order {
+		if message := r.messages[id]; message.DeviceID == deviceID {
+			messages = append(messages, message)
+		}
+	}
+	sort.SliceStable(messages, func(i, j int) bool {
+		return messages[i].CreatedAt.Before(messages[j].CreatedAt)
+	})
+	return messages, nil
+}
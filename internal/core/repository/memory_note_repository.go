@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"tracking/internal/core/model"
+)
+
+type inMemoryNoteRepository struct {
+	notes map[string]*model.Note
+	mutex sync.RWMutex
+}
+
+func NewInMemoryNoteRepository() NoteRepository {
+	return &inMemoryNoteRepository{
+		notes: make(map[string]*model.Note),
+	}
+}
+
+func (r *inMemoryNoteRepository) Create(note *model.Note) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, exists := r.notes[note.ID]; exists {
+		return fmt.Errorf("note with ID %s already exists", note.ID)
+	}
+
+	r.notes[note.ID] = note
+	return nil
+}
+
+func (r *inMemoryNoteRepository) Update(note *model.Note) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, exists := r.notes[note.ID]; !exists {
+		return fmt.Errorf("note with ID %s not found", note.ID)
+	}
+
+	r.notes[note.ID] = note
+	return nil
+}
+
+func (r *inMemoryNoteRepository) Delete(id string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	delete(r.notes, id)
+	return nil
+}
+
+func (r *inMemoryNoteRepository) FindByID(id string) (*model.Note, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	if note, exists := r.notes[id]; exists {
+		return note, nil
+	}
+	return nil, nil
+}
+
+func (r *inMemoryNoteRepository) FindByDeviceID(deviceID string) ([]*model.Note, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	var notes []*model.Note
+	for _, note := range r.notes {
+		if note.DeviceID == deviceID {
+			notes = append(notes, note)
+		}
+	}
+	sort.Slice(notes, func(i, j int) bool {
+		if !notes[i].From.Equal(notes[j].From) {
+			return notes[i].From.Before(notes[j].From)
+		}
+		return notes[i].CreatedAt.Before(notes[j].CreatedAt)
+	})
+	return notes, nil
+}
@@ -0,0 +1,32 @@
+package repository
+
+import (
+	"sync"
+	"tracking/internal/core/model"
+)
+
+type inMemoryNotificationRepository struct {
+	preferences map[string]*model.NotificationPreferences // By user ID
+	mutex       sync.RWMutex
+}
+
+func NewInMemoryNotificationRepository() NotificationRepository {
+	return &inMemoryNotificationRepository{
+		preferences: make(map[string]*model.NotificationPreferences),
+	}
+}
+
+func (r *inMemoryNotificationRepository) Save(preferences *model.NotificationPreferences) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.preferences[preferences.UserID] = preferences
+	return nil
+}
+
+func (r *inMemoryNotificationRepository) Find(userID string) (*model.NotificationPreferences, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return r.preferences[userID], nil
+}
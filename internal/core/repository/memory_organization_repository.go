@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"fmt"
+	"sync"
+	"tracking/internal/core/model"
+)
+
+type inMemoryOrganizationRepository struct {
+	organizations map[string]*model.Organization
+	mutex         sync.RWMutex
+}
+
+func NewInMemoryOrganizationRepository() OrganizationRepository {
+	return &inMemoryOrganizationRepository{
+		organizations: make(map[string]*model.Organization),
+	}
+}
+
+func (r *inMemoryOrganizationRepository) Create(org *model.Organization) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, exists := r.organizations[org.ID]; exists {
+		return fmt.Errorf("organization with ID %s already exists", org.ID)
+	}
+
+	r.organizations[org.ID] = org
+	return nil
+}
+
+func (r *inMemoryOrganizationRepository) Update(org *model.Organization) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, exists := r.organizations[org.ID]; !exists {
+		return fmt.Errorf("organization with ID %s not found", org.ID)
+	}
+
+	r.organizations[org.ID] = org
+	return nil
+}
+
+func (r *inMemoryOrganizationRepository) Delete(id string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, exists := r.organizations[id]; !exists {
+		return fmt.Errorf("organization with ID %s not found", id)
+	}
+
+	delete(r.organizations, id)
+	return nil
+}
+
+func (r *inMemoryOrganizationRepository) FindByID(id string) (*model.Organization, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	if org, exists := r.organizations[id]; exists {
+		return org, nil
+	}
+	return nil, nil
+}
+
+func (r *inMemoryOrganizationRepository) FindAll() ([]*model.Organization, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	orgs := make([]*model.Organization, 0, len(r.organizations))
+	for _, org := range r.organizations {
+		orgs = append(orgs, org)
+	}
+	return orgs, nil
+}
@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"sort"
 	"sync"
 	"time"
 	"tracking/internal/core/model"
@@ -24,6 +25,15 @@ func (r *inMemoryPositionRepository) Create(position *model.Position) error {
 	return nil
 }
 
+func (r *inMemoryPositionRepository) CreateBatch(positions []*model.Position) error {
+	for i, position := range positions {
+		if err := r.Create(position); err != nil {
+			return &BatchError{Stored: i, Err: err}
+		}
+	}
+	return nil
+}
+
 func (r *inMemoryPositionRepository) FindByID(id string) (*model.Position, error) {
 	r.mutex.RLock()
 	defer r.mutex.RUnlock()
@@ -63,3 +73,47 @@ func (r *inMemoryPositionRepository) FindLatestByDeviceID(deviceID string) (*mod
 	}
 	return latest, nil
 }
+
+// SetAddress stores a copy of the position, as readers may hold the
+// stored one
+func (r *inMemoryPositionRepository) SetAddress(id, address string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if position, exists := r.positions[id]; exists {
+		updated := *position
+		updated.Address = address
+		r.positions[id] = &updated
+	}
+	return nil
+}
+
+func (r *inMemoryPositionRepository) FindInRange(positionRange PositionRange, after *PositionCursor, limit int) ([]*model.Position, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	var positions []*model.Position
+	for _, position := range r.positions {
+		if position.DeviceID != positionRange.DeviceID || !positionRange.Contains(position.Timestamp) {
+			continue
+		}
+		if after != nil && !positionAfter(position, after.Timestamp.UnixNano(), after.ID) {
+			continue
+		}
+		positions = append(positions, position)
+	}
+	sort.Slice(positions, func(i, j int) bool {
+		return positionAfter(positions[j], positions[i].Timestamp.UnixNano(), positions[i].ID)
+	})
+	if len(positions) > limit {
+		positions = positions[:limit]
+	}
+	return positions, nil
+}
+
+// positionAfter orders positions by timestamp, then ID
+func positionAfter(position *model.Position, timestamp int64, id string) bool {
+	if t := position.Timestamp.UnixNano(); t != timestamp {
+		return t > timestamp
+	}
+	return position.ID > id
+}
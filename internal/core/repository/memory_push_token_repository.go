@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"sort"
+	"sync"
+	"tracking/internal/core/model"
+)
+
+type inMemoryPushTokenRepository struct {
+	tokens map[string]*model.PushToken // By token
+	mutex  sync.RWMutex
+}
+
+func NewInMemoryPushTokenRepository() PushTokenRepository {
+	return &inMemoryPushTokenRepository{
+		tokens: make(map[string]*model.PushToken),
+	}
+}
+
+func (r *inMemoryPushTokenRepository) Save(token *model.PushToken) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.tokens[token.Token] = token
+	return nil
+}
+
+func (r *inMemoryPushTokenRepository) Delete(token string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	delete(r.tokens, token)
+	return nil
+}
+
+func (r *inMemoryPushTokenRepository) FindByUserID(userID string) ([]*model.PushToken, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	var tokens []*model.PushToken
+	for _, token := range r.tokens {
+		if token.UserID == userID {
+			tokens = append(tokens, token)
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool {
+		if !tokens[i].CreatedAt.Equal(tokens[j].CreatedAt) {
+			return tokens[i].CreatedAt.Before(tokens[j].CreatedAt)
+		}
+		return tokens[i].Token < tokens[j].Token
+	})
+	return tokens, nil
+}
@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"tracking/internal/core/model"
+)
+
+type inMemorySavedFilterRepository struct {
+	filters map[string]*model.SavedFilter
+	mutex   sync.RWMutex
+}
+
+func NewInMemorySavedFilterRepository() SavedFilterRepository {
+	return &inMemorySavedFilterRepository{
+		filters: make(map[string]*model.SavedFilter),
+	}
+}
+
+func (r *inMemorySavedFilterRepository) Create(filter *model.SavedFilter) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, exists := r.filters[filter.ID]; exists {
+		return fmt.Errorf("saved filter with ID %s already exists", filter.ID)
+	}
+
+	r.filters[filter.ID] = filter
+	return nil
+}
+
+func (r *inMemorySavedFilterRepository) Update(filter *model.SavedFilter) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, exists := r.filters[filter.ID]; !exists {
+		return fmt.Errorf("saved filter with ID %s not found", filter.ID)
+	}
+
+	r.filters[filter.ID] = filter
+	return nil
+}
+
+func (r *inMemorySavedFilterRepository) Delete(id string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	delete(r.filters, id)
+	return nil
+}
+
+func (r *inMemorySavedFilterRepository) FindByID(id string) (*model.SavedFilter, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	if filter, exists := r.filters[id]; exists {
+		return filter, nil
+	}
+	return nil, nil
+}
+
+func (r *inMemorySavedFilterRepository) FindByUserID(userID string) ([]*model.SavedFilter, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	var filters []*model.SavedFilter
+	for _, filter := range r.filters {
+		if filter.UserID == userID {
+			filters = append(filters, filter)
+		}
+	}
+	sort.Slice(filters, func(i, j int) bool {
+		return filters[i].Name < filters[j].Name
+	})
+	return filters, nil
+}
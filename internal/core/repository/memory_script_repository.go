@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"fmt"
+	"sync"
+	"tracking/internal/core/model"
+)
+
+type inMemoryScriptRepository struct {
+	scripts map[string]*model.Script
+	mutex   sync.RWMutex
+}
+
+func NewInMemoryScriptRepository() ScriptRepository {
+	return &inMemoryScriptRepository{
+		scripts: make(map[string]*model.Script),
+	}
+}
+
+func (r *inMemoryScriptRepository) Create(script *model.Script) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, exists := r.scripts[script.ID]; exists {
+		return fmt.Errorf("script with ID %s already exists", script.ID)
+	}
+
+	r.scripts[script.ID] = script
+	return nil
+}
+
+func (r *inMemoryScriptRepository) Update(script *model.Script) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, exists := r.scripts[script.ID]; !exists {
+		return fmt.Errorf("script with ID %s not found", script.ID)
+	}
+
+	r.scripts[script.ID] = script
+	return nil
+}
+
+func (r *inMemoryScriptRepository) Delete(id string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, exists := r.scripts[id]; !exists {
+		return fmt.Errorf("script with ID %s not found", id)
+	}
+
+	delete(r.scripts, id)
+	return nil
+}
+
+func (r *inMemoryScriptRepository) FindByID(id string) (*model.Script, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	if script, exists := r.scripts[id]; exists {
+		return script, nil
+	}
+	return nil, nil
+}
+
+func (r *inMemoryScriptRepository) FindAll() ([]*model.Script, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	scripts := make([]*model.Script, 0, len(r.scripts))
+	for _, script := range r.scripts {
+		scripts = append(scripts, script)
+	}
+	return scripts, nil
+}
+
+func (r *inMemoryScriptRepository) FindByDeviceModel(deviceModel string) ([]*model.Script, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	var scripts []*model.Script
+	for _, script := range r.scripts {
+		if script.DeviceModel == deviceModel {
+			scripts = append(scripts, script)
+		}
+	}
+	return scripts, nil
+}
@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"tracking/internal/core/model"
+)
+
+type inMemorySnoozeRepository struct {
+	snoozes map[string]*model.Snooze
+	mutex   sync.RWMutex
+}
+
+func NewInMemorySnoozeRepository() SnoozeRepository {
+	return &inMemorySnoozeRepository{
+		snoozes: make(map[string]*model.Snooze),
+	}
+}
+
+func (r *inMemorySnoozeRepository) Create(snooze *model.Snooze) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, exists := r.snoozes[snooze.ID]; exists {
+		return fmt.Errorf("snooze with ID %s already exists", snooze.ID)
+	}
+
+	r.snoozes[snooze.ID] = snooze
+	return nil
+}
+
+func (r *inMemorySnoozeRepository) Update(snooze *model.Snooze) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, exists := r.snoozes[snooze.ID]; !exists {
+		return fmt.Errorf("snooze with ID %s not found", snooze.ID)
+	}
+
+	r.snoozes[snooze.ID] = snooze
+	return nil
+}
+
+func (r *inMemorySnoozeRepository) FindByID(id string) (*model.Snooze, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	if snooze, exists := r.snoozes[id]; exists {
+		return snooze, nil
+	}
+	return nil, nil
+}
+
+func (r *inMemorySnoozeRepository) FindByDeviceID(deviceID string) ([]*model.Snooze, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	var snoozes []*model.Snooze
+	for _, snooze := range r.snoozes {
+		if snooze.DeviceID == deviceID {
+			snoozes = append(snoozes, snooze)
+		}
+	}
+	sort.Slice(snoozes, func(i, j int) bool {
+		return snoozes[i].CreatedAt.After(snoozes[j].CreatedAt)
+	})
+	return snoozes, nil
+}
@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"tracking/internal/core/model"
+)
+
+type inMemoryWebhookRepository struct {
+	webhooks map[string]*model.Webhook
+	mutex    sync.RWMutex
+}
+
+func NewInMemoryWebhookRepository() WebhookRepository {
+	return &inMemoryWebhookRepository{
+		webhooks: make(map[string]*model.Webhook),
+	}
+}
+
+func (r *inMemoryWebhookRepository) Create(webhook *model.Webhook) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, exists := r.webhooks[webhook.ID]; exists {
+		return fmt.Errorf("webhook with ID %s already exists", webhook.ID)
+	}
+
+	r.webhooks[webhook.ID] = webhook
+	return nil
+}
+
+func (r *inMemoryWebhookRepository) Update(webhook *model.Webhook) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, exists := r.webhooks[webhook.ID]; !exists {
+		return fmt.Errorf("webhook with ID %s not found", webhook.ID)
+	}
+
+	r.webhooks[webhook.ID] = webhook
+	return nil
+}
+
+func (r *inMemoryWebhookRepository) Delete(id string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	delete(r.webhooks, id)
+	return nil
+}
+
+func (r *inMemoryWebhookRepository) FindByID(id string) (*model.Webhook, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	if webhook, exists := r.webhooks[id]; exists {
+		return webhook, nil
+	}
+	return nil, nil
+}
+
+func (r *inMemoryWebhookRepository) FindByOrganizationID(organizationID string) ([]*model.Webhook, error) {
+	return r.find(func(webhook *model.Webhook) bool {
+		return webhook.OrganizationID == organizationID
+	}), nil
+}
+
+func (r *inMemoryWebhookRepository) FindPersonal(userID string) ([]*model.Webhook, error) {
+	return r.find(func(webhook *model.Webhook) bool {
+		return webhook.UserID == userID && webhook.OrganizationID == ""
+	}), nil
+}
+
+func (r *inMemoryWebhookRepository) find(match func(*model.Webhook) bool) []*model.Webhook {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	var webhooks []*model.Webhook
+	for _, webhook := range r.webhooks {
+		if match(webhook) {
+			webhooks = append(webhooks, webhook)
+		}
+	}
+	sort.Slice(webhooks, func(i, j int) bool {
+		return webhooks[i].URL < webhooks[j].URL
+	})
+	return webhooks
+}
@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"context"
+	"time"
+	"tracking/internal/core/model"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type MessageRepository interface {
+	Create(message *model.Message) error
+	Update(message *model.Message) error
+	FindByID(id string) (*model.Message, error)
+	// FindByDeviceID returns the thread of a device, oldest first
+	FindByDeviceID(deviceID string) ([]*model.Message, error)
+}
+
+type MongoMessageRepository struct {
+	collection *mongo.Collection
+}
+
+func NewMongoMessageRepository(db *mongo.Database) *MongoMessageRepository {
+	return &MongoMessageRepository{
+		collection: db.Collection("messages"),
+	}
+}
+
+func (r *MongoMessageRepository) Create(message *model.Message) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.collection.InsertOne(ctx, message)
+	return err
+}
+
+func (r *MongoMessageRepository) Update(message *model.Message) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.collection.ReplaceOne(ctx, bson.M{"id": message.ID}, message)
+	return err
+}
+
+func (r *MongoMessageRepository) FindByID(id string) (*model.Message, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var message model.Message
+	err := r.collection.FindOne(ctx, bson.M{"id": id}).Decode(&message)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	return &message, err
+}
+
+func (r *MongoMessageRepository) FindByDeviceID(deviceID string) ([]*model.Message, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.M{"createdat": 1})
+	cursor, err := r.collection.Find(ctx, bson.M{"deviceid": deviceID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var messages []*model.Message
+	if err = cursor.All(ctx, &messages); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
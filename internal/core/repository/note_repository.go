@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"context"
+	"time"
+	"tracking/internal/core/model"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type NoteRepository interface {
+	Create(note *model.Note) error
+	Update(note *model.Note) error
+	Delete(id string) error
+	FindByID(id string) (*model.Note, error)
+	// FindByDeviceID returns the notes on a device's track, oldest range first
+	FindByDeviceID(deviceID string) ([]*model.Note, error)
+}
+
+type MongoNoteRepository struct {
+	collection *mongo.Collection
+}
+
+func NewMongoNoteRepository(db *mongo.Database) *MongoNoteRepository {
+	return &MongoNoteRepository{
+		collection: db.Collection("notes"),
+	}
+}
+
+func (r *MongoNoteRepository) Create(note *model.Note) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.collection.InsertOne(ctx, note)
+	return err
+}
+
+func (r *MongoNoteRepository) Update(note *model.Note) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.collection.ReplaceOne(ctx, bson.M{"id": note.ID}, note)
+	return err
+}
+
+func (r *MongoNoteRepository) Delete(id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.collection.DeleteOne(ctx, bson.M{"id": id})
+	return err
+}
+
+func (r *MongoNoteRepository) FindByID(id string) (*model.Note, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var note model.Note
+	err := r.collection.FindOne(ctx, bson.M{"id": id}).Decode(&note)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	return &note, err
+}
+
+func (r *MongoNoteRepository) FindByDeviceID(deviceID string) ([]*model.Note, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "from", Value: 1}, {Key: "createdat", Value: 1}})
+	cursor, err := r.collection.Find(ctx, bson.M{"deviceid": deviceID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var notes []*model.Note
+	if err = cursor.All(ctx, &notes); err != nil {
+		return nil, err
+	}
+	return notes, nil
+}
@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"context"
+	"time"
+	"tracking/internal/core/model"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// NotificationRepository keeps the notification preferences of users
+type NotificationRepository interface {
+	// Save stores the preferences of a user, replacing any before
+	Save(preferences *model.NotificationPreferences) error
+	// Find returns the preferences of a user, or nil
+	Find(userID string) (*model.NotificationPreferences, error)
+}
+
+type MongoNotificationRepository struct {
+	collection *mongo.Collection
+}
+
+func NewMongoNotificationRepository(db *mongo.Database) *MongoNotificationRepository {
+	return &MongoNotificationRepository{
+		collection: db.Collection("notification_preferences"),
+	}
+}
+
+func (r *MongoNotificationRepository) Save(preferences *model.NotificationPreferences) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"userid": preferences.UserID}
+	_, err := r.collection.ReplaceOne(ctx, filter, preferences, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (r *MongoNotificationRepository) Find(userID string) (*model.NotificationPreferences, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var preferences model.NotificationPreferences
+	err := r.collection.FindOne(ctx, bson.M{"userid": userID}).Decode(&preferences)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	return &preferences, err
+}
@@ -16,6 +16,7 @@ type OrganizationMemberRepository interface {
 	FindByID(id string) (*model.OrganizationMember, error)
 	FindByUserAndOrg(userID, orgID string) (*model.OrganizationMember, error)
 	FindByOrganization(orgID string) ([]*model.OrganizationMember, error)
+	FindByUser(userID string) ([]*model.OrganizationMember, error)
 }
 
 type MongoOrganizationMemberRepository struct {
@@ -95,3 +96,20 @@ func (r *MongoOrganizationMemberRepository) FindByOrganization(orgID string) ([]
 	}
 	return members, nil
 }
+
+func (r *MongoOrganizationMemberRepository) FindByUser(userID string) ([]*model.OrganizationMember, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := r.collection.Find(ctx, bson.M{"userid": userID})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var members []*model.OrganizationMember
+	if err = cursor.All(ctx, &members); err != nil {
+		return nil, err
+	}
+	return members, nil
+}
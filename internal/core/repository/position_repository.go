@@ -2,6 +2,9 @@ package repository
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"log"
 	"time"
 	"tracking/internal/core/model"
 
@@ -12,8 +15,66 @@ import (
 
 type PositionRepository interface {
 	Create(position *model.Position) error
+	// CreateBatch stores positions in order, stopping at the first failure,
+	// which it reports as a *BatchError
+	CreateBatch(positions []*model.Position) error
+	FindByID(id string) (*model.Position, error)
 	FindByDeviceID(deviceID string) ([]*model.Position, error)
 	FindLatestByDeviceID(deviceID string) (*model.Position, error)
+	// FindInRange returns the positions of a device in the range, oldest
+	// first, starting after the cursor when one is given and stopping at
+	// limit
+	FindInRange(positionRange PositionRange, after *PositionCursor, limit int) ([]*model.Position, error)
+	// SetAddress records the street address of a stored position, looked
+	// up after it was stored
+	SetAddress(id, address string) error
+}
+
+// PositionRange selects the positions of a device by time; a zero bound
+// leaves that end open
+type PositionRange struct {
+	DeviceID string
+	From     time.Time // Inclusive
+	To       time.Time // Exclusive
+}
+
+// Contains reports whether a timestamp falls in the range
+func (r PositionRange) Contains(timestamp time.Time) bool {
+	return (r.From.IsZero() || !timestamp.Before(r.From)) && (r.To.IsZero() || timestamp.Before(r.To))
+}
+
+// PositionCursor marks the last position of a page; the next page starts
+// with the position listed after it
+type PositionCursor struct {
+	Timestamp time.Time
+	ID        string
+}
+
+// BatchError reports a batch write that failed partway; the positions
+// before the Stored index were written
+type BatchError struct {
+	Stored int
+	Err    error
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("batch write failed after %d positions: %v", e.Stored, e.Err)
+}
+
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
+// BatchStored returns how many positions a CreateBatch call wrote
+func BatchStored(positions []*model.Position, err error) int {
+	if err == nil {
+		return len(positions)
+	}
+	var batchErr *BatchError
+	if errors.As(err, &batchErr) {
+		return batchErr.Stored
+	}
+	return 0
 }
 
 type MongoPositionRepository struct {
@@ -21,9 +82,23 @@ type MongoPositionRepository struct {
 }
 
 func NewMongoPositionRepository(db *mongo.Database) *MongoPositionRepository {
-	return &MongoPositionRepository{
+	r := &MongoPositionRepository{
 		collection: db.Collection("positions"),
 	}
+	r.createIndexes()
+	return r
+}
+
+// createIndexes adds the index time range queries of a device need, unless
+// it exists. A failure is logged, as queries still work without it.
+func (r *MongoPositionRepository) createIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	index := mongo.IndexModel{Keys: bson.D{{Key: "deviceid", Value: 1}, {Key: "timestamp", Value: 1}}}
+	if _, err := r.collection.Indexes().CreateOne(ctx, index); err != nil {
+		log.Printf("Failed to create the positions index on device and timestamp: %v", err)
+	}
 }
 
 func (r *MongoPositionRepository) Create(position *model.Position) error {
@@ -34,6 +109,42 @@ func (r *MongoPositionRepository) Create(position *model.Position) error {
 	return err
 }
 
+func (r *MongoPositionRepository) CreateBatch(positions []*model.Position) error {
+	if len(positions) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	documents := make([]interface{}, len(positions))
+	for i, position := range positions {
+		documents[i] = position
+	}
+	_, err := r.collection.InsertMany(ctx, documents, options.InsertMany().SetOrdered(true))
+	if err == nil {
+		return nil
+	}
+	// An ordered insert stops at its first failed document
+	stored := 0
+	var bulkErr mongo.BulkWriteException
+	if errors.As(err, &bulkErr) && len(bulkErr.WriteErrors) > 0 {
+		stored = bulkErr.WriteErrors[0].Index
+	}
+	return &BatchError{Stored: stored, Err: err}
+}
+
+func (r *MongoPositionRepository) FindByID(id string) (*model.Position, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var position model.Position
+	err := r.collection.FindOne(ctx, bson.M{"id": id}).Decode(&position)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	return &position, err
+}
+
 func (r *MongoPositionRepository) FindByDeviceID(deviceID string) ([]*model.Position, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -62,4 +173,50 @@ func (r *MongoPositionRepository) FindLatestByDeviceID(deviceID string) (*model.
 		return nil, nil
 	}
 	return &position, err
+}
+
+func (r *MongoPositionRepository) SetAddress(id, address string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.collection.UpdateOne(ctx, bson.M{"id": id}, bson.M{"$set": bson.M{"address": address}})
+	return err
+}
+
+func (r *MongoPositionRepository) FindInRange(positionRange PositionRange, after *PositionCursor, limit int) ([]*model.Position, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	query := bson.M{"deviceid": positionRange.DeviceID}
+	timestamp := bson.M{}
+	if !positionRange.From.IsZero() {
+		timestamp["$gte"] = positionRange.From
+	}
+	if !positionRange.To.IsZero() {
+		timestamp["$lt"] = positionRange.To
+	}
+	if len(timestamp) > 0 {
+		query["timestamp"] = timestamp
+	}
+	if after != nil {
+		query["$or"] = bson.A{
+			bson.M{"timestamp": bson.M{"$gt": after.Timestamp}},
+			bson.M{"timestamp": after.Timestamp, "id": bson.M{"$gt": after.ID}},
+		}
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "timestamp", Value: 1}, {Key: "id", Value: 1}}).
+		SetLimit(int64(limit))
+
+	cursor, err := r.collection.Find(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var positions []*model.Position
+	if err = cursor.All(ctx, &positions); err != nil {
+		return nil, err
+	}
+	return positions, nil
 }
\ No newline at end of file
@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"context"
+	"time"
+	"tracking/internal/core/model"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// PushTokenRepository keeps the push tokens of users
+type PushTokenRepository interface {
+	// Save stores a token, moving it to its user when another had it
+	Save(token *model.PushToken) error
+	Delete(token string) error
+	// FindByUserID returns the tokens of a user, oldest first
+	FindByUserID(userID string) ([]*model.PushToken, error)
+}
+
+type MongoPushTokenRepository struct {
+	collection *mongo.Collection
+}
+
+func NewMongoPushTokenRepository(db *mongo.Database) *MongoPushTokenRepository {
+	return &MongoPushTokenRepository{
+		collection: db.Collection("push_tokens"),
+	}
+}
+
+func (r *MongoPushTokenRepository) Save(token *model.PushToken) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"token": token.Token}
+	_, err := r.collection.ReplaceOne(ctx, filter, token, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (r *MongoPushTokenRepository) Delete(token string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.collection.DeleteOne(ctx, bson.M{"token": token})
+	return err
+}
+
+func (r *MongoPushTokenRepository) FindByUserID(userID string) ([]*model.PushToken, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "createdat", Value: 1}, {Key: "token", Value: 1}})
+	cursor, err := r.collection.Find(ctx, bson.M{"userid": userID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var tokens []*model.PushToken
+	if err = cursor.All(ctx, &tokens); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
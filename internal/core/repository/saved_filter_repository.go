@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"context"
+	"time"
+	"tracking/internal/core/model"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type SavedFilterRepository interface {
+	Create(filter *model.SavedFilter) error
+	Update(filter *model.SavedFilter) error
+	Delete(id string) error
+	FindByID(id string) (*model.SavedFilter, error)
+	// FindByUserID returns the filters a user saved, by name
+	FindByUserID(userID string) ([]*model.SavedFilter, error)
+}
+
+type MongoSavedFilterRepository struct {
+	collection *mongo.Collection
+}
+
+func NewMongoSavedFilterRepository(db *mongo.Database) *MongoSavedFilterRepository {
+	return &MongoSavedFilterRepository{
+		collection: db.Collection("saved_filters"),
+	}
+}
+
+func (r *MongoSavedFilterRepository) Create(filter *model.SavedFilter) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.collection.InsertOne(ctx, filter)
+	return err
+}
+
+func (r *MongoSavedFilterRepository) Update(filter *model.SavedFilter) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.collection.ReplaceOne(ctx, bson.M{"id": filter.ID}, filter)
+	return err
+}
+
+func (r *MongoSavedFilterRepository) Delete(id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.collection.DeleteOne(ctx, bson.M{"id": id})
+	return err
+}
+
+func (r *MongoSavedFilterRepository) FindByID(id string) (*model.SavedFilter, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var filter model.SavedFilter
+	err := r.collection.FindOne(ctx, bson.M{"id": id}).Decode(&filter)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	return &filter, err
+}
+
+func (r *MongoSavedFilterRepository) FindByUserID(userID string) ([]*model.SavedFilter, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.M{"name": 1})
+	cursor, err := r.collection.Find(ctx, bson.M{"userid": userID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var filters []*model.SavedFilter
+	if err = cursor.All(ctx, &filters); err != nil {
+		return nil, err
+	}
+	return filters, nil
+}
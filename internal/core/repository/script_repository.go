@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"context"
+	"time"
+	"tracking/internal/core/model"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type ScriptRepository interface {
+	Create(script *model.Script) error
+	Update(script *model.Script) error
+	Delete(id string) error
+	FindByID(id string) (*model.Script, error)
+	FindAll() ([]*model.Script, error)
+	FindByDeviceModel(deviceModel string) ([]*model.Script, error)
+}
+
+type MongoScriptRepository struct {
+	collection *mongo.Collection
+}
+
+func NewMongoScriptRepository(db *mongo.Database) *MongoScriptRepository {
+	return &MongoScriptRepository{
+		collection: db.Collection("scripts"),
+	}
+}
+
+func (r *MongoScriptRepository) Create(script *model.Script) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.collection.InsertOne(ctx, script)
+	return err
+}
+
+func (r *MongoScriptRepository) Update(script *model.Script) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.collection.ReplaceOne(ctx, bson.M{"id": script.ID}, script)
+	return err
+}
+
+func (r *MongoScriptRepository) Delete(id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.collection.DeleteOne(ctx, bson.M{"id": id})
+	return err
+}
+
+func (r *MongoScriptRepository) FindByID(id string) (*model.Script, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var script model.Script
+	err := r.collection.FindOne(ctx, bson.M{"id": id}).Decode(&script)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	return &script, err
+}
+
+func (r *MongoScriptRepository) FindAll() ([]*model.Script, error) {
+	return r.find(bson.M{})
+}
+
+func (r *MongoScriptRepository) FindByDeviceModel(deviceModel string) ([]*model.Script, error) {
+	return r.find(bson.M{"devicemodel": deviceModel})
+}
+
+func (r *MongoScriptRepository) find(filter bson.M) ([]*model.Script, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := r.collection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var scripts []*model.Script
+	if err = cursor.All(ctx, &scripts); err != nil {
+		return nil, err
+	}
+	return scripts, nil
+}
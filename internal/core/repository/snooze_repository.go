@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"context"
+	"time"
+	"tracking/internal/core/model"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type SnoozeRepository interface {
+	Create(snooze *model.Snooze) error
+	Update(snooze *model.Snooze) error
+	FindByID(id string) (*model.Snooze, error)
+	// FindByDeviceID returns the snoozes of a device, newest first
+	FindByDeviceID(deviceID string) ([]*model.Snooze, error)
+}
+
+type MongoSnoozeRepository struct {
+	collection *mongo.Collection
+}
+
+func NewMongoSnoozeRepository(db *mongo.Database) *MongoSnoozeRepository {
+	return &MongoSnoozeRepository{
+		collection: db.Collection("snoozes"),
+	}
+}
+
+func (r *MongoSnoozeRepository) Create(snooze *model.Snooze) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.collection.InsertOne(ctx, snooze)
+	return err
+}
+
+func (r *MongoSnoozeRepository) Update(snooze *model.Snooze) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.collection.ReplaceOne(ctx, bson.M{"id": snooze.ID}, snooze)
+	return err
+}
+
+func (r *MongoSnoozeRepository) FindByID(id string) (*model.Snooze, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var snooze model.Snooze
+	err := r.collection.FindOne(ctx, bson.M{"id": id}).Decode(&snooze)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	return &snooze, err
+}
+
+func (r *MongoSnoozeRepository) FindByDeviceID(deviceID string) ([]*model.Snooze, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.M{"createdat": -1})
+	cursor, err := r.collection.Find(ctx, bson.M{"deviceid": deviceID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var snoozes []*model.Snooze
+	if err = cursor.All(ctx, &snoozes); err != nil {
+		return nil, err
+	}
+	return snoozes, nil
+}
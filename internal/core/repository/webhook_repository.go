@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"context"
+	"time"
+	"tracking/internal/core/model"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type WebhookRepository interface {
+	Create(webhook *model.Webhook) error
+	Update(webhook *model.Webhook) error
+	Delete(id string) error
+	FindByID(id string) (*model.Webhook, error)
+	// FindByOrganizationID returns the webhooks of an organization, by URL
+	FindByOrganizationID(organizationID string) ([]*model.Webhook, error)
+	// FindPersonal returns the webhooks a user set outside any
+	// organization, by URL
+	FindPersonal(userID string) ([]*model.Webhook, error)
+}
+
+type MongoWebhookRepository struct {
+	collection *mongo.Collection
+}
+
+func NewMongoWebhookRepository(db *mongo.Database) *MongoWebhookRepository {
+	return &MongoWebhookRepository{
+		collection: db.Collection("webhooks"),
+	}
+}
+
+func (r *MongoWebhookRepository) Create(webhook *model.Webhook) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.collection.InsertOne(ctx, webhook)
+	return err
+}
+
+func (r *MongoWebhookRepository) Update(webhook *model.Webhook) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.collection.ReplaceOne(ctx, bson.M{"id": webhook.ID}, webhook)
+	return err
+}
+
+func (r *MongoWebhookRepository) Delete(id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.collection.DeleteOne(ctx, bson.M{"id": id})
+	return err
+}
+
+func (r *MongoWebhookRepository) FindByID(id string) (*model.Webhook, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var webhook model.Webhook
+	err := r.collection.FindOne(ctx, bson.M{"id": id}).Decode(&webhook)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	return &webhook, err
+}
+
+func (r *MongoWebhookRepository) FindByOrganizationID(organizationID string) ([]*model.Webhook, error) {
+	return r.find(bson.M{"organizationid": organizationID})
+}
+
+func (r *MongoWebhookRepository) FindPersonal(userID string) ([]*model.Webhook, error) {
+	return r.find(bson.M{"userid": userID, "organizationid": ""})
+}
+
+func (r *MongoWebhookRepository) find(filter bson.M) ([]*model.Webhook, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.M{"url": 1})
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var webhooks []*model.Webhook
+	if err = cursor.All(ctx, &webhooks); err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
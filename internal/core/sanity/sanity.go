@@ -0,0 +1,178 @@
+// Package sanity keeps implausible fixes out of tracks and reports: fixes
+// at 0,0, fixes too imprecise to trust, and fixes implying a device moved
+// faster than it can between consecutive points
+package sanity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"tracking/internal/core/model"
+	"tracking/internal/core/repository"
+	"tracking/internal/core/util"
+)
+
+// What the filter does with an implausible fix
+const (
+	ModeReject = "reject" // Drop it; sources acknowledge it like a stored one
+	ModeFlag   = "flag"   // Store it marked invalid, with the reason
+)
+
+// Reasons a fix fails the filter
+const (
+	ReasonZero       = "zero"       // At 0,0, as devices without a fix report
+	ReasonAccuracy   = "accuracy"   // Too few satellites or too high an HDOP
+	ReasonImpossible = "impossible" // Implies a speed over the maximum
+)
+
+// AttributeFiltered holds the reason a flagged fix failed the filter
+const AttributeFiltered = "filtered"
+
+// ErrImplausible rejects a fix in ModeReject
+var ErrImplausible = errors.New("implausible position")
+
+// Limits are the thresholds of the filter; zero turns a check off
+type Limits struct {
+	MaxSpeed      float64 // km/h implied between consecutive fixes
+	MinSatellites int     // Positions reporting no satellites pass
+	MaxHDOP       float64 // Positions without an hdop attribute pass
+}
+
+// Filter vets valid fixes before they are stored. Only fixes that passed
+// become the reference of the speed check, so a single jump is caught
+// without rejecting the fixes after it; when two fixes in a row agree with
+// each other but not with the reference, the device did move and the
+// second is taken.
+type Filter struct {
+	mode         string
+	limits       Limits
+	positionRepo repository.PositionRepository
+
+	mutex   sync.Mutex
+	last    map[string]*fix // Latest fix that passed, by device ID
+	suspect map[string]*fix // Latest fix failing the speed check, by device ID
+}
+
+type fix struct {
+	latitude, longitude float64
+	at                  time.Time
+}
+
+func NewFilter(mode string, limits Limits, positionRepo repository.PositionRepository) (*Filter, error) {
+	if mode != ModeReject && mode != ModeFlag {
+		return nil, fmt.Errorf("unknown position filter mode %q, expected %s or %s", mode, ModeReject, ModeFlag)
+	}
+	return &Filter{
+		mode:         mode,
+		limits:       limits,
+		positionRepo: positionRepo,
+		last:         make(map[string]*fix),
+		suspect:      make(map[string]*fix),
+	}, nil
+}
+
+// Check is a StageDecoded hook rejecting or flagging implausible fixes.
+// Positions without a valid fix are left to the decoders' own judgment.
+func (f *Filter) Check(ctx context.Context, position *model.Position) error {
+	if !position.Valid {
+		return nil
+	}
+
+	reason := f.reason(position)
+	if reason == "" {
+		return nil
+	}
+	if f.mode == ModeReject {
+		return fmt.Errorf("%w: %s", ErrImplausible, reason)
+	}
+	position.Valid = false
+	if position.Status == nil {
+		position.Status = make(map[string]interface{})
+	}
+	position.Status[AttributeFiltered] = reason
+	return nil
+}
+
+// Record is a StageStored hook making a stored fix the reference of the
+// next speed check
+func (f *Filter) Record(ctx context.Context, position *model.Position) error {
+	if !position.Valid {
+		return nil
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if last := f.last[position.DeviceID]; last == nil || position.Timestamp.After(last.at) {
+		f.last[position.DeviceID] = &fix{position.Latitude, position.Longitude, position.Timestamp}
+	}
+	delete(f.suspect, position.DeviceID)
+	return nil
+}
+
+func (f *Filter) reason(position *model.Position) string {
+	if position.Latitude == 0 && position.Longitude == 0 {
+		return ReasonZero
+	}
+	if f.limits.MinSatellites > 0 && position.Satellites > 0 && int(position.Satellites) < f.limits.MinSatellites {
+		return ReasonAccuracy
+	}
+	if hdop, ok := position.Status["hdop"].(float64); ok && f.limits.MaxHDOP > 0 && hdop > f.limits.MaxHDOP {
+		return ReasonAccuracy
+	}
+	if f.limits.MaxSpeed > 0 && f.impossible(position) {
+		return ReasonImpossible
+	}
+	return ""
+}
+
+// impossible tells whether reaching the position from the device's
+// reference fix takes more than the maximum speed
+func (f *Filter) impossible(position *model.Position) bool {
+	current := &fix{position.Latitude, position.Longitude, position.Timestamp}
+	last := f.reference(position.DeviceID)
+	if last == nil || f.plausible(last, current) {
+		return false
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	suspect := f.suspect[position.DeviceID]
+	f.suspect[position.DeviceID] = current
+	return suspect == nil || !f.plausible(suspect, current)
+}
+
+func (f *Filter) plausible(from, to *fix) bool {
+	elapsed := to.at.Sub(from.at).Abs()
+	// Fixes share a timestamp at the resolution of most devices
+	elapsed = max(elapsed, time.Second)
+	meters := util.Distance(from.latitude, from.longitude, to.latitude, to.longitude)
+	return meters/elapsed.Seconds()*3.6 <= f.limits.MaxSpeed
+}
+
+// reference returns the device's latest fix that passed, loading its
+// latest stored position after a restart
+func (f *Filter) reference(deviceID string) *fix {
+	f.mutex.Lock()
+	last, known := f.last[deviceID]
+	f.mutex.Unlock()
+	if known {
+		return last
+	}
+
+	position, err := f.positionRepo.FindLatestByDeviceID(deviceID)
+	if err != nil {
+		return nil
+	}
+	if position != nil && position.Valid {
+		last = &fix{position.Latitude, position.Longitude, position.Timestamp}
+	}
+	f.mutex.Lock()
+	if _, known := f.last[deviceID]; !known {
+		f.last[deviceID] = last
+	}
+	f.mutex.Unlock()
+	return last
+}
@@ -0,0 +1,137 @@
+package script
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+type function func(m *machine, args []interface{}) (interface{}, error)
+
+// functions available to scripts, besides the lazy if(condition, then, else)
+var functions = map[string]function{
+	"abs":         numeric1(math.Abs),
+	"floor":       numeric1(math.Floor),
+	"ceil":        numeric1(math.Ceil),
+	"sqrt":        numeric1(math.Sqrt),
+	"min":         extreme(math.Min),
+	"max":         extreme(math.Max),
+	"pow":         pow,
+	"round":       round,
+	"interpolate": interpolate,
+	"attr":        attr,
+}
+
+func numbers(args []interface{}) ([]float64, error) {
+	values := make([]float64, len(args))
+	for i, arg := range args {
+		value, ok := arg.(float64)
+		if !ok {
+			return nil, fmt.Errorf("argument %d is %v, not a number", i+1, arg)
+		}
+		values[i] = value
+	}
+	return values, nil
+}
+
+func numeric1(fn func(float64) float64) function {
+	return func(m *machine, args []interface{}) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("takes 1 argument, got %d", len(args))
+		}
+		values, err := numbers(args)
+		if err != nil {
+			return nil, err
+		}
+		return fn(values[0]), nil
+	}
+}
+
+func extreme(pick func(a, b float64) float64) function {
+	return func(m *machine, args []interface{}) (interface{}, error) {
+		if len(args) == 0 {
+			return nil, errors.New("needs at least 1 argument")
+		}
+		values, err := numbers(args)
+		if err != nil {
+			return nil, err
+		}
+		result := values[0]
+		for _, value := range values[1:] {
+			result = pick(result, value)
+		}
+		return result, nil
+	}
+}
+
+func pow(m *machine, args []interface{}) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("takes 2 arguments, got %d", len(args))
+	}
+	values, err := numbers(args)
+	if err != nil {
+		return nil, err
+	}
+	return math.Pow(values[0], values[1]), nil
+}
+
+// round(x) rounds to an integer, round(x, digits) to that many decimals
+func round(m *machine, args []interface{}) (interface{}, error) {
+	if len(args) != 1 && len(args) != 2 {
+		return nil, fmt.Errorf("takes 1 or 2 arguments, got %d", len(args))
+	}
+	values, err := numbers(args)
+	if err != nil {
+		return nil, err
+	}
+	if len(values) == 1 {
+		return math.Round(values[0]), nil
+	}
+	scale := math.Pow(10, values[1])
+	return math.Round(values[0]*scale) / scale, nil
+}
+
+// interpolate(x, x1, y1, x2, y2, ...) maps x through a piecewise linear
+// curve given by points in ascending x order, clamping outside the curve
+func interpolate(m *machine, args []interface{}) (interface{}, error) {
+	if len(args) < 5 || len(args)%2 == 0 {
+		return nil, errors.New("needs x followed by at least two x, y points")
+	}
+	values, err := numbers(args)
+	if err != nil {
+		return nil, err
+	}
+
+	x, points := values[0], values[1:]
+	for i := 2; i < len(points); i += 2 {
+		if points[i] <= points[i-2] {
+			return nil, errors.New("points must be in ascending x order")
+		}
+	}
+
+	if x <= points[0] {
+		return points[1], nil
+	}
+	for i := 2; i < len(points); i += 2 {
+		x1, y1, x2, y2 := points[i-2], points[i-1], points[i], points[i+1]
+		if x <= x2 {
+			return y1 + (x-x1)*(y2-y1)/(x2-x1), nil
+		}
+	}
+	return points[len(points)-1], nil
+}
+
+// attr(name, fallback) reads a variable that may be absent from the position
+func attr(m *machine, args []interface{}) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("takes 2 arguments, got %d", len(args))
+	}
+	name, ok := args[0].(string)
+	if !ok {
+		return nil, fmt.Errorf("name must be a string, got %v", args[0])
+	}
+	if value, ok := m.lookup(name); ok && value != nil {
+		return value, nil
+	}
+	return args[1], nil
+}
@@ -0,0 +1,99 @@
+package script
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenNumber
+	tokenString
+	tokenIdent
+	tokenOperator
+	tokenSeparator // Newline or semicolon
+)
+
+type token struct {
+	kind   tokenKind
+	text   string
+	number float64
+	line   int
+}
+
+// operators lists multi-character operators before their prefixes
+var operators = []string{
+	"==", "!=", "<=", ">=", "&&", "||",
+	"+", "-", "*", "/", "%", "<", ">", "!", "=", "(", ")", ",",
+}
+
+func tokenize(source string) ([]token, error) {
+	var tokens []token
+	line := 1
+
+	for i := 0; i < len(source); {
+		c := source[i]
+		switch {
+		case c == '\n' || c == ';':
+			tokens = append(tokens, token{kind: tokenSeparator, text: string(c), line: line})
+			if c == '\n' {
+				line++
+			}
+			i++
+
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+
+		case c == '#':
+			for i < len(source) && source[i] != '\n' {
+				i++
+			}
+
+		case c >= '0' && c <= '9' || c == '.':
+			start := i
+			for i < len(source) && (source[i] >= '0' && source[i] <= '9' || source[i] == '.') {
+				i++
+			}
+			number, err := strconv.ParseFloat(source[start:i], 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid number %q", line, source[start:i])
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: source[start:i], number: number, line: line})
+
+		case c == '"':
+			end := strings.IndexAny(source[i+1:], "\"\n")
+			if end < 0 || source[i+1+end] != '"' {
+				return nil, fmt.Errorf("line %d: unterminated string", line)
+			}
+			tokens = append(tokens, token{kind: tokenString, text: source[i+1 : i+1+end], line: line})
+			i += end + 2
+
+		case c == '_' || unicode.IsLetter(rune(c)):
+			start := i
+			for i < len(source) && (source[i] == '_' || unicode.IsLetter(rune(source[i])) || unicode.IsDigit(rune(source[i]))) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: source[start:i], line: line})
+
+		default:
+			var matched string
+			for _, op := range operators {
+				if strings.HasPrefix(source[i:], op) {
+					matched = op
+					break
+				}
+			}
+			if matched == "" {
+				return nil, fmt.Errorf("line %d: unexpected character %q", line, c)
+			}
+			tokens = append(tokens, token{kind: tokenOperator, text: matched, line: line})
+			i += len(matched)
+		}
+	}
+
+	return append(tokens, token{kind: tokenEOF, line: line}), nil
+}
@@ -0,0 +1,240 @@
+package script
+
+import (
+	"fmt"
+)
+
+// node is an expression in a compiled script
+type node interface {
+	eval(m *machine) (interface{}, error)
+}
+
+type literal struct {
+	value interface{}
+}
+
+type variable struct {
+	name string
+	line int
+}
+
+type unary struct {
+	op      string
+	operand node
+	line    int
+}
+
+type binary struct {
+	op          string
+	left, right node
+	line        int
+}
+
+type call struct {
+	name string
+	args []node
+	line int
+}
+
+// assignment is a single statement: name = expression
+type assignment struct {
+	name  string
+	value node
+}
+
+// binaryPrecedence orders the binary operators, loosest first
+var binaryPrecedence = map[string]int{
+	"||": 1,
+	"&&": 2,
+	"==": 3, "!=": 3,
+	"<": 4, "<=": 4, ">": 4, ">=": 4,
+	"+": 5, "-": 5,
+	"*": 6, "/": 6, "%": 6,
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func parse(tokens []token) ([]assignment, error) {
+	p := &parser{tokens: tokens}
+	var statements []assignment
+
+	for {
+		for p.peek().kind == tokenSeparator {
+			p.pos++
+		}
+		if p.peek().kind == tokenEOF {
+			return statements, nil
+		}
+
+		statement, err := p.parseAssignment()
+		if err != nil {
+			return nil, err
+		}
+		statements = append(statements, statement)
+
+		if next := p.peek(); next.kind != tokenSeparator && next.kind != tokenEOF {
+			return nil, fmt.Errorf("line %d: unexpected %q after statement", next.line, next.text)
+		}
+	}
+}
+
+// parseSingle parses a lone expression, with nothing around it but
+// separators
+func parseSingle(tokens []token) (node, error) {
+	p := &parser{tokens: tokens}
+	for p.peek().kind == tokenSeparator {
+		p.pos++
+	}
+	value, err := p.parseExpression(1)
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokenSeparator {
+		p.pos++
+	}
+	if next := p.peek(); next.kind != tokenEOF {
+		return nil, fmt.Errorf("line %d: unexpected %q after expression", next.line, next.text)
+	}
+	return value, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) expect(op string) error {
+	t := p.next()
+	if t.kind != tokenOperator || t.text != op {
+		return fmt.Errorf("line %d: expected %q, got %q", t.line, op, t.text)
+	}
+	return nil
+}
+
+func (p *parser) parseAssignment() (assignment, error) {
+	name := p.next()
+	if name.kind != tokenIdent {
+		return assignment{}, fmt.Errorf("line %d: expected attribute name, got %q", name.line, name.text)
+	}
+	if err := p.expect("="); err != nil {
+		return assignment{}, err
+	}
+
+	value, err := p.parseExpression(1)
+	if err != nil {
+		return assignment{}, err
+	}
+	return assignment{name: name.text, value: value}, nil
+}
+
+// parseExpression parses operators binding at least as tightly as minPrecedence
+func (p *parser) parseExpression(minPrecedence int) (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		t := p.peek()
+		precedence, ok := binaryPrecedence[t.text]
+		if t.kind != tokenOperator || !ok || precedence < minPrecedence {
+			return left, nil
+		}
+		p.pos++
+
+		right, err := p.parseExpression(precedence + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = &binary{op: t.text, left: left, right: right, line: t.line}
+	}
+}
+
+func (p *parser) parseUnary() (node, error) {
+	t := p.peek()
+	if t.kind == tokenOperator && (t.text == "-" || t.text == "!") {
+		p.pos++
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &unary{op: t.text, operand: operand, line: t.line}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenNumber:
+		return &literal{value: t.number}, nil
+	case tokenString:
+		return &literal{value: t.text}, nil
+	case tokenIdent:
+		switch t.text {
+		case "true":
+			return &literal{value: true}, nil
+		case "false":
+			return &literal{value: false}, nil
+		case "nil":
+			return &literal{value: nil}, nil
+		}
+		if next := p.peek(); next.kind == tokenOperator && next.text == "(" {
+			return p.parseCall(t)
+		}
+		return &variable{name: t.text, line: t.line}, nil
+	case tokenOperator:
+		if t.text == "(" {
+			inner, err := p.parseExpression(1)
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			return inner, nil
+		}
+	}
+	if t.kind == tokenEOF || t.kind == tokenSeparator {
+		return nil, fmt.Errorf("line %d: unexpected end of expression", t.line)
+	}
+	return nil, fmt.Errorf("line %d: unexpected %q", t.line, t.text)
+}
+
+func (p *parser) parseCall(name token) (node, error) {
+	if _, ok := functions[name.text]; !ok && name.text != "if" {
+		return nil, fmt.Errorf("line %d: unknown function %s", name.line, name.text)
+	}
+	p.pos++ // Opening parenthesis
+
+	c := &call{name: name.text, line: name.line}
+	if next := p.peek(); next.kind == tokenOperator && next.text == ")" {
+		p.pos++
+		return c, nil
+	}
+	for {
+		arg, err := p.parseExpression(1)
+		if err != nil {
+			return nil, err
+		}
+		c.args = append(c.args, arg)
+
+		t := p.next()
+		if t.kind == tokenOperator && t.text == ")" {
+			return c, nil
+		}
+		if t.kind != tokenOperator || t.text != "," {
+			return nil, fmt.Errorf("line %d: expected \",\" or \")\" in call to %s", t.line, name.text)
+		}
+	}
+}
@@ -0,0 +1,375 @@
+// Package script runs small user-supplied programs that compute derived
+// position attributes.
+//
+// A script is a list of assignments, one per line or separated by ';':
+//
+//	# Fuel tank calibration: sensor millivolts to litres
+//	fuel = interpolate(fuelSensor, 0, 0, 1200, 40, 2600, 95)
+//	lowFuel = fuel < 10 && speed > 0
+//	_tmp = speed * 1.852   # names starting with _ are not stored
+//
+// Expressions support numbers, strings, booleans, nil, arithmetic,
+// comparisons, && || ! and the functions listed in functions. Scripts cannot
+// loop, allocate without bound or reach anything outside their inputs, and
+// every run is capped by a step budget and the caller's context.
+package script
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+const (
+	// MaxSourceLength bounds the size of a script
+	MaxSourceLength = 8192
+	// MaxSteps bounds the expression evaluations of a single run
+	MaxSteps = 10000
+	// MaxValueLength bounds the strings a run builds, so that concatenation
+	// cannot double its way past any memory limit within the step budget
+	MaxValueLength = 4096
+)
+
+var (
+	ErrSyntax         = errors.New("script syntax error")
+	ErrRuntime        = errors.New("script runtime error")
+	ErrStepLimit      = errors.New("script exceeded its step budget")
+	ErrSourceTooLarge = errors.New("script source too large")
+)
+
+// Program is a compiled script, safe for concurrent use
+type Program struct {
+	statements []assignment
+}
+
+// Compile parses a script
+func Compile(source string) (*Program, error) {
+	if len(source) > MaxSourceLength {
+		return nil, fmt.Errorf("%w: %d bytes, limit %d", ErrSourceTooLarge, len(source), MaxSourceLength)
+	}
+
+	tokens, err := tokenize(source)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSyntax, err)
+	}
+	statements, err := parse(tokens)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSyntax, err)
+	}
+	return &Program{statements: statements}, nil
+}
+
+// Run executes the program against the input variables and returns the
+// attributes it assigned. Inputs are never modified.
+func (p *Program) Run(ctx context.Context, inputs map[string]interface{}) (map[string]interface{}, error) {
+	m := &machine{
+		ctx:    ctx,
+		inputs: inputs,
+		locals: make(map[string]interface{}),
+	}
+
+	outputs := make(map[string]interface{})
+	for _, statement := range p.statements {
+		value, err := statement.value.eval(m)
+		if err != nil {
+			return nil, err
+		}
+		if number, ok := value.(float64); ok && (math.IsNaN(number) || math.IsInf(number, 0)) {
+			return nil, fmt.Errorf("%w: %s is not a finite number", ErrRuntime, statement.name)
+		}
+		m.locals[statement.name] = value
+		if !strings.HasPrefix(statement.name, "_") {
+			outputs[statement.name] = value
+		}
+	}
+	return outputs, nil
+}
+
+// Expression is a compiled lone expression, safe for concurrent use
+type Expression struct {
+	value node
+}
+
+// CompileExpression parses an expression such as fuelCounter * 0.1, as
+// found on the right of a script assignment
+func CompileExpression(source string) (*Expression, error) {
+	if len(source) > MaxSourceLength {
+		return nil, fmt.Errorf("%w: %d bytes, limit %d", ErrSourceTooLarge, len(source), MaxSourceLength)
+	}
+
+	tokens, err := tokenize(source)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSyntax, err)
+	}
+	value, err := parseSingle(tokens)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSyntax, err)
+	}
+	return &Expression{value: value}, nil
+}
+
+// Eval computes the expression from the input variables, under the same
+// budget as a script run
+func (e *Expression) Eval(ctx context.Context, inputs map[string]interface{}) (interface{}, error) {
+	m := &machine{
+		ctx:    ctx,
+		inputs: inputs,
+		locals: make(map[string]interface{}),
+	}
+	value, err := e.value.eval(m)
+	if err != nil {
+		return nil, err
+	}
+	if number, ok := value.(float64); ok && (math.IsNaN(number) || math.IsInf(number, 0)) {
+		return nil, fmt.Errorf("%w: result is not a finite number", ErrRuntime)
+	}
+	return value, nil
+}
+
+// machine holds the state of one run
+type machine struct {
+	ctx    context.Context
+	inputs map[string]interface{}
+	locals map[string]interface{}
+	steps  int
+}
+
+// step charges one evaluation against the budget
+func (m *machine) step() error {
+	m.steps++
+	if m.steps > MaxSteps {
+		return ErrStepLimit
+	}
+	if m.steps%64 == 0 {
+		if err := m.ctx.Err(); err != nil {
+			return fmt.Errorf("%w: %v", ErrRuntime, err)
+		}
+	}
+	return nil
+}
+
+func (m *machine) lookup(name string) (interface{}, bool) {
+	if value, ok := m.locals[name]; ok {
+		return value, true
+	}
+	value, ok := m.inputs[name]
+	return normalize(value), ok
+}
+
+func runtimeError(line int, format string, v ...interface{}) error {
+	return fmt.Errorf("%w: line %d: %s", ErrRuntime, line, fmt.Sprintf(format, v...))
+}
+
+func (n *literal) eval(m *machine) (interface{}, error) {
+	return n.value, m.step()
+}
+
+func (n *variable) eval(m *machine) (interface{}, error) {
+	if err := m.step(); err != nil {
+		return nil, err
+	}
+	value, ok := m.lookup(n.name)
+	if !ok {
+		return nil, runtimeError(n.line, "undefined variable %s", n.name)
+	}
+	return value, nil
+}
+
+func (n *unary) eval(m *machine) (interface{}, error) {
+	if err := m.step(); err != nil {
+		return nil, err
+	}
+	operand, err := n.operand.eval(m)
+	if err != nil {
+		return nil, err
+	}
+
+	if n.op == "!" {
+		return !truthy(operand), nil
+	}
+	number, ok := operand.(float64)
+	if !ok {
+		return nil, runtimeError(n.line, "cannot negate %v", operand)
+	}
+	return -number, nil
+}
+
+func (n *binary) eval(m *machine) (interface{}, error) {
+	if err := m.step(); err != nil {
+		return nil, err
+	}
+	left, err := n.left.eval(m)
+	if err != nil {
+		return nil, err
+	}
+
+	// Logical operators short-circuit
+	switch n.op {
+	case "&&":
+		if !truthy(left) {
+			return false, nil
+		}
+		right, err := n.right.eval(m)
+		return truthy(right), err
+	case "||":
+		if truthy(left) {
+			return true, nil
+		}
+		right, err := n.right.eval(m)
+		return truthy(right), err
+	}
+
+	right, err := n.right.eval(m)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "==":
+		return left == right, nil
+	case "!=":
+		return left != right, nil
+	}
+
+	if n.op == "+" {
+		if l, ok := left.(string); ok {
+			r := fmt.Sprint(right)
+			if len(l)+len(r) > MaxValueLength {
+				return nil, runtimeError(n.line, "string of %d bytes exceeds %d", len(l)+len(r), MaxValueLength)
+			}
+			return l + r, nil
+		}
+	}
+	if l, ok := left.(string); ok {
+		if r, ok := right.(string); ok {
+			switch n.op {
+			case "<":
+				return l < r, nil
+			case "<=":
+				return l <= r, nil
+			case ">":
+				return l > r, nil
+			case ">=":
+				return l >= r, nil
+			}
+		}
+	}
+
+	l, lok := left.(float64)
+	r, rok := right.(float64)
+	if !lok || !rok {
+		return nil, runtimeError(n.line, "operator %s needs numbers, got %v and %v", n.op, left, right)
+	}
+
+	switch n.op {
+	case "+":
+		return l + r, nil
+	case "-":
+		return l - r, nil
+	case "*":
+		return l * r, nil
+	case "/":
+		if r == 0 {
+			return nil, runtimeError(n.line, "division by zero")
+		}
+		return l / r, nil
+	case "%":
+		if r == 0 {
+			return nil, runtimeError(n.line, "division by zero")
+		}
+		return math.Mod(l, r), nil
+	case "<":
+		return l < r, nil
+	case "<=":
+		return l <= r, nil
+	case ">":
+		return l > r, nil
+	case ">=":
+		return l >= r, nil
+	}
+	return nil, runtimeError(n.line, "unknown operator %s", n.op)
+}
+
+func (n *call) eval(m *machine) (interface{}, error) {
+	if err := m.step(); err != nil {
+		return nil, err
+	}
+
+	// if evaluates only the branch it takes
+	if n.name == "if" {
+		if len(n.args) != 3 {
+			return nil, runtimeError(n.line, "if takes 3 arguments, got %d", len(n.args))
+		}
+		condition, err := n.args[0].eval(m)
+		if err != nil {
+			return nil, err
+		}
+		if truthy(condition) {
+			return n.args[1].eval(m)
+		}
+		return n.args[2].eval(m)
+	}
+
+	args := make([]interface{}, len(n.args))
+	for i, arg := range n.args {
+		value, err := arg.eval(m)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = value
+	}
+
+	result, err := functions[n.name](m, args)
+	if err != nil {
+		return nil, runtimeError(n.line, "%s: %v", n.name, err)
+	}
+	return result, nil
+}
+
+// truthy treats false, nil, 0 and "" as false
+func truthy(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case float64:
+		return v != 0
+	case string:
+		return v != ""
+	}
+	return true
+}
+
+// normalize converts input values to the script's number, string and bool types
+func normalize(value interface{}) interface{} {
+	switch v := value.(type) {
+	case float64, string, bool, nil:
+		return v
+	case float32:
+		return float64(v)
+	case int:
+		return float64(v)
+	case int8:
+		return float64(v)
+	case int16:
+		return float64(v)
+	case int32:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case uint:
+		return float64(v)
+	case uint8:
+		return float64(v)
+	case uint16:
+		return float64(v)
+	case uint32:
+		return float64(v)
+	case uint64:
+		return float64(v)
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,299 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"sync"
+	"time"
+	"tracking/internal/core/model"
+	"tracking/internal/core/repository"
+	"tracking/internal/core/util"
+)
+
+// ErrInvalidAccumulators rejects a baseline without totals, with negative
+// ones or taking effect in the future, and an empty utilization range
+var ErrInvalidAccumulators = errors.New("invalid accumulators")
+
+// OdometerStep is how far in meters the distance of a device moves before
+// its odometer is stored again, sparing a device write per position
+const OdometerStep = 100.0
+
+// AccumulatorService keeps the odometer and engine hours of devices,
+// counted from their positions and set by users to the readings of the
+// vehicle. Everyone who can reach a device sets its totals. The distance
+// is also kept as the odometer of the device.
+type AccumulatorService interface {
+	// GetAccumulators returns the current totals of a device
+	GetAccumulators(deviceID, userID string) (*model.Accumulators, error)
+	// SetAccumulators stores a baseline and recounts the totals of its
+	// device from the positions since, so later positions continue from it
+	SetAccumulators(userID string, baseline *model.AccumulatorBaseline) (*model.Accumulators, error)
+	// GetBaselines returns the baselines of a device by effective time
+	GetBaselines(deviceID, userID string) ([]*model.AccumulatorBaseline, error)
+	// GetUtilization counts the engine time and distance of a device
+	// between its positions in [from, to)
+	GetUtilization(deviceID, userID string, from, to time.Time) (*model.Utilization, error)
+	// StampPosition is a StageDecoded hook counting the position into the
+	// totals of its device and stamping it with them. Positions older than
+	// the latest counted are left unstamped.
+	StampPosition(ctx context.Context, position *model.Position) error
+	// RecordPosition is a StageStored hook saving the totals, and the
+	// odometer of the device every OdometerStep
+	RecordPosition(ctx context.Context, position *model.Position) error
+}
+
+type accumulatorService struct {
+	accumulatorRepo repository.AccumulatorRepository
+	deviceRepo      repository.DeviceRepository
+	positionRepo    repository.PositionRepository
+	orgMemberRepo   repository.OrganizationMemberRepository
+	clock           util.Clock
+
+	mutex   sync.Mutex
+	devices map[string]*model.Accumulators // By device ID, loaded on first use
+
+	odometerMutex sync.Mutex
+	odometers     map[string]float64 // Stored on devices, by device ID
+}
+
+func NewAccumulatorService(accumulatorRepo repository.AccumulatorRepository, deviceRepo repository.DeviceRepository, positionRepo repository.PositionRepository, orgMemberRepo repository.OrganizationMemberRepository, clock util.Clock) AccumulatorService {
+	return &accumulatorService{
+		accumulatorRepo: accumulatorRepo,
+		deviceRepo:      deviceRepo,
+		positionRepo:    positionRepo,
+		orgMemberRepo:   orgMemberRepo,
+		clock:           clock,
+		devices:         make(map[string]*model.Accumulators),
+		odometers:       make(map[string]float64),
+	}
+}
+
+func (s *accumulatorService) GetAccumulators(deviceID, userID string) (*model.Accumulators, error) {
+	device, err := s.device(deviceID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	accumulators, err := s.load(device.ID)
+	if err != nil {
+		return nil, err
+	}
+	current := *accumulators
+	return &current, nil
+}
+
+func (s *accumulatorService) SetAccumulators(userID string, baseline *model.AccumulatorBaseline) (*model.Accumulators, error) {
+	device, err := s.device(baseline.DeviceID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.clock.Now()
+	created := *baseline
+	if created.EffectiveAt.IsZero() {
+		created.EffectiveAt = now
+	}
+	if err := validateBaseline(&created, now); err != nil {
+		return nil, err
+	}
+	created.ID = model.GenerateID()
+	created.DeviceID = device.ID
+	created.UserID = userID
+	created.CreatedAt = now
+
+	// Positions arriving meanwhile wait, so none is counted twice or lost
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err := s.accumulatorRepo.CreateBaseline(&created); err != nil {
+		return nil, err
+	}
+	baselines, err := s.accumulatorRepo.FindBaselines(device.ID)
+	if err != nil {
+		return nil, err
+	}
+	positions, err := s.positionRepo.FindByDeviceID(device.ID)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(positions, func(i, j int) bool {
+		return positions[i].Timestamp.Before(positions[j].Timestamp)
+	})
+
+	accumulators := model.Accumulate(device.ID, positions, baselines)
+	if err := s.accumulatorRepo.Save(accumulators); err != nil {
+		return nil, err
+	}
+	s.devices[device.ID] = accumulators
+	s.storeOdometer(device.ID, accumulators.TotalDistance, true)
+	current := *accumulators
+	return &current, nil
+}
+
+func (s *accumulatorService) GetBaselines(deviceID, userID string) ([]*model.AccumulatorBaseline, error) {
+	device, err := s.device(deviceID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	baselines, err := s.accumulatorRepo.FindBaselines(device.ID)
+	if err != nil {
+		return nil, err
+	}
+	if baselines == nil {
+		baselines = []*model.AccumulatorBaseline{}
+	}
+	return baselines, nil
+}
+
+func (s *accumulatorService) GetUtilization(deviceID, userID string, from, to time.Time) (*model.Utilization, error) {
+	device, err := s.device(deviceID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if from.IsZero() || to.IsZero() || !to.After(from) {
+		return nil, fmt.Errorf("%w: from and to required, to after from", ErrInvalidAccumulators)
+	}
+
+	positions, err := s.positionRepo.FindByDeviceID(device.ID)
+	if err != nil {
+		return nil, err
+	}
+	var inRange []*model.Position
+	for _, position := range positions {
+		if !position.Timestamp.Before(from) && position.Timestamp.Before(to) {
+			inRange = append(inRange, position)
+		}
+	}
+	sort.SliceStable(inRange, func(i, j int) bool {
+		return inRange[i].Timestamp.Before(inRange[j].Timestamp)
+	})
+
+	// Counted from zero, so baselines set meanwhile do not show as use
+	totals := model.Accumulate(device.ID, inRange, nil)
+	return &model.Utilization{
+		DeviceID:    device.ID,
+		From:        from,
+		To:          to,
+		EngineHours: totals.EngineHours,
+		Distance:    totals.TotalDistance,
+		Utilization: totals.EngineHours / to.Sub(from).Hours(),
+	}, nil
+}
+
+// StampPosition never rejects a position: one whose device totals cannot
+// be loaded is stored unstamped
+func (s *accumulatorService) StampPosition(ctx context.Context, position *model.Position) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	accumulators, err := s.load(position.DeviceID)
+	if err != nil {
+		log.Printf("[Accumulators] Error loading totals for device %s: %v", position.DeviceID, err)
+		return nil
+	}
+	if accumulators.Advance(position) {
+		accumulators.Stamp(position)
+	}
+	return nil
+}
+
+func (s *accumulatorService) RecordPosition(ctx context.Context, position *model.Position) error {
+	s.mutex.Lock()
+	accumulators, ok := s.devices[position.DeviceID]
+	var saved model.Accumulators
+	if ok {
+		saved = *accumulators
+	}
+	s.mutex.Unlock()
+
+	if !ok {
+		return nil
+	}
+	if err := s.accumulatorRepo.Save(&saved); err != nil {
+		return err
+	}
+	s.storeOdometer(saved.DeviceID, saved.TotalDistance, false)
+	return nil
+}
+
+// storeOdometer sets the odometer of a device to its distance once that
+// moved OdometerStep from the one stored, or at once when forced, as after
+// a baseline
+func (s *accumulatorService) storeOdometer(deviceID string, distance float64, force bool) {
+	s.odometerMutex.Lock()
+	defer s.odometerMutex.Unlock()
+
+	stored, known := s.odometers[deviceID]
+	if known && !force && math.Abs(distance-stored) < OdometerStep {
+		return
+	}
+	device, err := s.deviceRepo.FindByID(deviceID)
+	if err != nil || device == nil {
+		return
+	}
+	if !force && math.Abs(distance-device.Odometer) < OdometerStep {
+		s.odometers[deviceID] = device.Odometer
+		return
+	}
+
+	device.Odometer = distance
+	if err := s.deviceRepo.Update(device); err != nil {
+		log.Printf("[Accumulators] Error storing the odometer of device %s: %v", deviceID, err)
+		return
+	}
+	s.odometers[deviceID] = distance
+}
+
+// load returns the cached totals of a device, reading them from the
+// repository on first use. The caller holds the mutex.
+func (s *accumulatorService) load(deviceID string) (*model.Accumulators, error) {
+	if accumulators, ok := s.devices[deviceID]; ok {
+		return accumulators, nil
+	}
+
+	accumulators, err := s.accumulatorRepo.Find(deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if accumulators == nil {
+		accumulators = &model.Accumulators{DeviceID: deviceID}
+	}
+	s.devices[deviceID] = accumulators
+	return accumulators, nil
+}
+
+// device returns the device when the user can reach it
+func (s *accumulatorService) device(deviceID, userID string) (*model.Device, error) {
+	if deviceID == "" || userID == "" {
+		return nil, ErrDeviceNotFound
+	}
+	device, err := newDeviceAccess(userID, s.orgMemberRepo).device(s.deviceRepo, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if device == nil {
+		return nil, ErrDeviceNotFound
+	}
+	return device, nil
+}
+
+func validateBaseline(baseline *model.AccumulatorBaseline, now time.Time) error {
+	if baseline.TotalDistance == nil && baseline.EngineHours == nil {
+		return fmt.Errorf("%w: totalDistance or engineHours required", ErrInvalidAccumulators)
+	}
+	for _, total := range []*float64{baseline.TotalDistance, baseline.EngineHours} {
+		if total != nil && (*total < 0 || math.IsNaN(*total) || math.IsInf(*total, 0)) {
+			return fmt.Errorf("%w: totals must be non-negative", ErrInvalidAccumulators)
+		}
+	}
+	if baseline.EffectiveAt.After(now) {
+		return fmt.Errorf("%w: effectiveAt is in the future", ErrInvalidAccumulators)
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"tracking/internal/core/model"
+	"tracking/internal/core/repository"
+	"tracking/internal/core/util"
+)
+
+// MaxSnoozeDuration bounds how far ahead a snooze may run
+const MaxSnoozeDuration = 90 * 24 * time.Hour
+
+// Common alert errors
+var (
+	ErrEventNotFound  = errors.New("event not found")
+	ErrSnoozeNotFound = errors.New("snooze not found")
+	ErrInvalidSnooze  = errors.New("invalid snooze")
+)
+
+// AlertService lets users acknowledge events and snooze the alerts of a
+// device, recording who did so and when
+type AlertService interface {
+	// Acknowledge marks an event of a device the user can access as seen
+	// to. Acknowledging it again keeps the first acknowledgment.
+	Acknowledge(eventID, userID string) (*model.Event, error)
+	// Snooze silences events of the type, or of every type when eventType
+	// is empty, for the device until the given instant
+	Snooze(deviceID, userID, eventType string, until time.Time, reason string) (*model.Snooze, error)
+	// CancelSnooze ends a snooze early
+	CancelSnooze(id, userID string) (*model.Snooze, error)
+	// GetSnoozes returns the snoozes of a device, newest first
+	GetSnoozes(deviceID string) ([]*model.Snooze, error)
+	// MarkSnoozed is an event hook flagging events raised while their
+	// device's alerts are snoozed
+	MarkSnoozed(ctx context.Context, event *model.Event) error
+}
+
+type alertService struct {
+	eventRepo     repository.EventRepository
+	snoozeRepo    repository.SnoozeRepository
+	deviceRepo    repository.DeviceRepository
+	orgMemberRepo repository.OrganizationMemberRepository
+	clock         util.Clock
+}
+
+func NewAlertService(eventRepo repository.EventRepository, snoozeRepo repository.SnoozeRepository, deviceRepo repository.DeviceRepository, orgMemberRepo repository.OrganizationMemberRepository, clock util.Clock) AlertService {
+	return &alertService{
+		eventRepo:     eventRepo,
+		snoozeRepo:    snoozeRepo,
+		deviceRepo:    deviceRepo,
+		orgMemberRepo: orgMemberRepo,
+		clock:         clock,
+	}
+}
+
+func (s *alertService) Acknowledge(eventID, userID string) (*model.Event, error) {
+	if eventID == "" || userID == "" {
+		return nil, errors.New("invalid event or user ID")
+	}
+
+	event, err := s.eventRepo.FindByID(eventID)
+	if err != nil {
+		return nil, err
+	}
+	if event == nil {
+		return nil, ErrEventNotFound
+	}
+	// Events of devices out of reach are reported as missing
+	device, err := newDeviceAccess(userID, s.orgMemberRepo).device(s.deviceRepo, event.DeviceID)
+	if err != nil {
+		return nil, err
+	}
+	if device == nil {
+		return nil, ErrEventNotFound
+	}
+
+	if event.Acknowledged() {
+		return event, nil
+	}
+	now := s.clock.Now()
+	event.AcknowledgedBy = userID
+	event.AcknowledgedAt = &now
+	if err := s.eventRepo.Update(event); err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+func (s *alertService) Snooze(deviceID, userID, eventType string, until time.Time, reason string) (*model.Snooze, error) {
+	if deviceID == "" || userID == "" {
+		return nil, errors.New("invalid device or user ID")
+	}
+	now := s.clock.Now()
+	if !until.After(now) || until.Sub(now) > MaxSnoozeDuration {
+		return nil, fmt.Errorf("%w: must end within %v from now", ErrInvalidSnooze, MaxSnoozeDuration)
+	}
+
+	snooze := model.NewSnooze(deviceID, strings.TrimSpace(eventType), until, userID, now)
+	snooze.Reason = strings.TrimSpace(reason)
+	if err := s.snoozeRepo.Create(snooze); err != nil {
+		return nil, err
+	}
+	return snooze, nil
+}
+
+func (s *alertService) CancelSnooze(id, userID string) (*model.Snooze, error) {
+	if id == "" || userID == "" {
+		return nil, errors.New("invalid snooze or user ID")
+	}
+
+	snooze, err := s.snoozeRepo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if snooze == nil {
+		return nil, ErrSnoozeNotFound
+	}
+	device, err := newDeviceAccess(userID, s.orgMemberRepo).device(s.deviceRepo, snooze.DeviceID)
+	if err != nil {
+		return nil, err
+	}
+	if device == nil {
+		return nil, ErrSnoozeNotFound
+	}
+
+	now := s.clock.Now()
+	if snooze.CancelledAt != nil || !now.Before(snooze.Until) {
+		return snooze, nil
+	}
+	snooze.CancelledBy = userID
+	snooze.CancelledAt = &now
+	if err := s.snoozeRepo.Update(snooze); err != nil {
+		return nil, err
+	}
+	return snooze, nil
+}
+
+func (s *alertService) GetSnoozes(deviceID string) ([]*model.Snooze, error) {
+	if deviceID == "" {
+		return nil, errors.New("invalid device ID")
+	}
+	return s.snoozeRepo.FindByDeviceID(deviceID)
+}
+
+func (s *alertService) MarkSnoozed(ctx context.Context, event *model.Event) error {
+	snoozes, err := s.snoozeRepo.FindByDeviceID(event.DeviceID)
+	if err != nil {
+		return err
+	}
+	now := s.clock.Now()
+	for _, snooze := range snoozes {
+		if snooze.Covers(event.Type, now) {
+			event.Snoozed = true
+			return nil
+		}
+	}
+	return nil
+}
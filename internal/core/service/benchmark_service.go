@@ -0,0 +1,110 @@
+package service
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"tracking/internal/core/model"
+	"tracking/internal/core/repository"
+)
+
+// MaxBenchmarkRounds bounds the rounds of one benchmark run
+const MaxBenchmarkRounds = 1000
+
+var (
+	// ErrInvalidBenchmark rejects a corpus or number of rounds the server
+	// cannot replay
+	ErrInvalidBenchmark = errors.New("invalid benchmark")
+	// ErrBenchmarkRunning rejects a benchmark started while another runs
+	ErrBenchmarkRunning = errors.New("a benchmark is already running")
+)
+
+// FrameReplayer feeds recorded device sessions through the ingest
+// pipeline; the TCP server is one
+type FrameReplayer interface {
+	// IdentifyFrame returns the protocol and device identifier of the first
+	// frame of a session
+	IdentifyFrame(frame []byte) (string, string, error)
+	// Benchmark replays the sessions, or a built-in corpus when nil
+	Benchmark(sessions []model.BenchmarkSession, rounds int) (*model.BenchmarkReport, error)
+}
+
+// BenchmarkService measures the throughput the server sustains on its
+// hardware, to size deployments. Replayed positions are stored as any
+// others, so benchmarks belong on servers set up for capacity tests.
+type BenchmarkService interface {
+	// Run replays the sessions, or the built-in corpus when none are given,
+	// the number of rounds, at least one
+	Run(sessions []model.BenchmarkSession, rounds int) (*model.BenchmarkReport, error)
+}
+
+type benchmarkService struct {
+	replayer   FrameReplayer
+	deviceRepo repository.DeviceRepository
+	running    sync.Mutex
+}
+
+func NewBenchmarkService(replayer FrameReplayer, deviceRepo repository.DeviceRepository) BenchmarkService {
+	return &benchmarkService{
+		replayer:   replayer,
+		deviceRepo: deviceRepo,
+	}
+}
+
+func (s *benchmarkService) Run(sessions []model.BenchmarkSession, rounds int) (*model.BenchmarkReport, error) {
+	if rounds < 0 || rounds > MaxBenchmarkRounds {
+		return nil, fmt.Errorf("%w: rounds must be between 1 and %d", ErrInvalidBenchmark, MaxBenchmarkRounds)
+	}
+	if len(sessions) == 0 {
+		sessions = nil
+	}
+	if err := s.validate(sessions); err != nil {
+		return nil, err
+	}
+
+	// Runs at once would measure each other
+	if !s.running.TryLock() {
+		return nil, ErrBenchmarkRunning
+	}
+	defer s.running.Unlock()
+	return s.replayer.Benchmark(sessions, rounds)
+}
+
+// validate checks that each session opens with a frame identifying a
+// device not registered, as replays run as temporary devices
+func (s *benchmarkService) validate(sessions []model.BenchmarkSession) error {
+	seen := make(map[string]bool)
+	for _, session := range sessions {
+		if len(session.Frames) == 0 {
+			return fmt.Errorf("%w: session %s has no frames", ErrInvalidBenchmark, session.Name)
+		}
+		var first []byte
+		for i, frame := range session.Frames {
+			data, err := hex.DecodeString(frame)
+			if err != nil || len(data) == 0 {
+				return fmt.Errorf("%w: frame %d of session %s is not hex encoded", ErrInvalidBenchmark, i, session.Name)
+			}
+			if i == 0 {
+				first = data
+			}
+		}
+
+		_, uniqueID, err := s.replayer.IdentifyFrame(first)
+		if err != nil {
+			return fmt.Errorf("%w: session %s does not identify a device: %v", ErrInvalidBenchmark, session.Name, err)
+		}
+		if seen[uniqueID] {
+			return fmt.Errorf("%w: sessions share device %s", ErrInvalidBenchmark, uniqueID)
+		}
+		seen[uniqueID] = true
+		device, err := s.deviceRepo.FindByUniqueID(uniqueID)
+		if err != nil {
+			return err
+		}
+		if device != nil {
+			return fmt.Errorf("%w: device %s of session %s is registered", ErrInvalidBenchmark, uniqueID, session.Name)
+		}
+	}
+	return nil
+}
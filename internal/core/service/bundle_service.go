@@ -0,0 +1,227 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"tracking/internal/core/model"
+	"tracking/internal/core/repository"
+	"tracking/internal/core/script"
+	"tracking/internal/core/util"
+)
+
+// Entity kinds keying BundleImport.IDs
+const (
+	bundleOrganizations       = "organizations"
+	bundleOrganizationMembers = "organizationMembers"
+	bundleDevices             = "devices"
+	bundleScripts             = "scripts"
+)
+
+// BundleService exports the configuration of this server as one bundle and
+// imports bundles exported elsewhere
+type BundleService interface {
+	Export() (*model.Bundle, error)
+	// Import creates every entity of a bundle under a new ID and rewrites
+	// the references between them. Devices whose unique ID is already
+	// registered and scripts already defined for a model are skipped.
+	Import(bundle *model.Bundle) (*model.BundleImport, error)
+}
+
+type bundleService struct {
+	orgRepo       repository.OrganizationRepository
+	orgMemberRepo repository.OrganizationMemberRepository
+	deviceRepo    repository.DeviceRepository
+	scriptRepo    repository.ScriptRepository
+	clock         util.Clock
+}
+
+func NewBundleService(orgRepo repository.OrganizationRepository, orgMemberRepo repository.OrganizationMemberRepository, deviceRepo repository.DeviceRepository, scriptRepo repository.ScriptRepository, clock util.Clock) BundleService {
+	return &bundleService{
+		orgRepo:       orgRepo,
+		orgMemberRepo: orgMemberRepo,
+		deviceRepo:    deviceRepo,
+		scriptRepo:    scriptRepo,
+		clock:         clock,
+	}
+}
+
+func (s *bundleService) Export() (*model.Bundle, error) {
+	bundle := &model.Bundle{
+		Version:             model.BundleVersion,
+		ExportedAt:          s.clock.Now(),
+		Organizations:       []*model.Organization{},
+		OrganizationMembers: []*model.OrganizationMember{},
+		Devices:             []*model.BundleDevice{},
+		Scripts:             []*model.Script{},
+	}
+
+	orgs, err := s.orgRepo.FindAll()
+	if err != nil {
+		return nil, err
+	}
+	for _, org := range orgs {
+		members, err := s.orgMemberRepo.FindByOrganization(org.ID)
+		if err != nil {
+			return nil, err
+		}
+		bundle.Organizations = append(bundle.Organizations, org)
+		bundle.OrganizationMembers = append(bundle.OrganizationMembers, members...)
+	}
+
+	devices, err := s.deviceRepo.FindAll()
+	if err != nil {
+		return nil, err
+	}
+	for _, device := range devices {
+		bundle.Devices = append(bundle.Devices, &model.BundleDevice{Device: device, ApiSecret: device.ApiSecret})
+	}
+
+	scripts, err := s.scriptRepo.FindAll()
+	if err != nil {
+		return nil, err
+	}
+	bundle.Scripts = append(bundle.Scripts, scripts...)
+	return bundle, nil
+}
+
+func (s *bundleService) Import(bundle *model.Bundle) (*model.BundleImport, error) {
+	if bundle == nil {
+		return nil, errors.New("bundle is required")
+	}
+	if bundle.Version != model.BundleVersion {
+		return nil, fmt.Errorf("unsupported bundle version %d, want %d", bundle.Version, model.BundleVersion)
+	}
+
+	result := &model.BundleImport{
+		IDs: map[string]map[string]string{
+			bundleOrganizations:       {},
+			bundleOrganizationMembers: {},
+			bundleDevices:             {},
+			bundleScripts:             {},
+		},
+	}
+	now := s.clock.Now()
+
+	// IDs are given out first so children can point at parents listed after
+	// them. A parent missing from the bundle leaves its child at the top.
+	orgIDs := result.IDs[bundleOrganizations]
+	newOrgIDs := make(map[string]string)
+	var orgs []*model.Organization
+	for _, org := range bundle.Organizations {
+		if org == nil || org.Name == "" {
+			result.Skipped = append(result.Skipped, "organization without a name")
+			continue
+		}
+		newOrgIDs[org.ID] = model.GenerateID()
+		orgs = append(orgs, org)
+	}
+	for _, org := range orgs {
+		imported := *org
+		imported.ID = newOrgIDs[org.ID]
+		imported.ParentID = newOrgIDs[org.ParentID]
+		imported.UpdatedAt = now
+		if err := s.orgRepo.Create(&imported); err != nil {
+			return result, fmt.Errorf("organization %s: %v", org.ID, err)
+		}
+		orgIDs[org.ID] = imported.ID
+		result.Organizations++
+	}
+
+	for _, member := range bundle.OrganizationMembers {
+		if member == nil {
+			continue
+		}
+		orgID, ok := orgIDs[member.OrganizationID]
+		if !ok {
+			result.Skipped = append(result.Skipped, fmt.Sprintf("member %s: organization %s not in bundle", member.ID, member.OrganizationID))
+			continue
+		}
+		imported := *member
+		imported.ID = model.GenerateID()
+		imported.OrganizationID = orgID
+		imported.UpdatedAt = now
+		if err := s.orgMemberRepo.Create(&imported); err != nil {
+			return result, fmt.Errorf("member %s: %v", member.ID, err)
+		}
+		result.IDs[bundleOrganizationMembers][member.ID] = imported.ID
+		result.OrganizationMembers++
+	}
+
+	for _, entry := range bundle.Devices {
+		if entry == nil || entry.Device == nil || entry.UniqueID == "" {
+			result.Skipped = append(result.Skipped, "device without a unique ID")
+			continue
+		}
+		existing, err := s.deviceRepo.FindByUniqueID(entry.UniqueID)
+		if err != nil {
+			return result, err
+		}
+		if existing != nil {
+			result.Skipped = append(result.Skipped, fmt.Sprintf("device %s: unique ID %s already registered", entry.ID, entry.UniqueID))
+			continue
+		}
+
+		imported := *entry.Device
+		imported.ID = util.GenerateID()
+		imported.ApiSecret = entry.ApiSecret
+		if imported.OrganizationID != "" {
+			orgID, ok := orgIDs[imported.OrganizationID]
+			if !ok {
+				result.Skipped = append(result.Skipped, fmt.Sprintf("device %s: organization %s not in bundle", entry.ID, imported.OrganizationID))
+				continue
+			}
+			imported.OrganizationID = orgID
+		}
+		// Positions are not migrated, so the device starts without one
+		imported.PositionID = ""
+		imported.Status = "inactive"
+		if imported.ApiKey == "" || imported.ApiSecret == "" {
+			fresh := model.NewDevice(imported.Name, imported.UniqueID)
+			imported.ApiKey, imported.ApiSecret = fresh.ApiKey, fresh.ApiSecret
+		}
+		if err := s.deviceRepo.Create(&imported); err != nil {
+			return result, fmt.Errorf("device %s: %v", entry.ID, err)
+		}
+		result.IDs[bundleDevices][entry.ID] = imported.ID
+		result.Devices++
+	}
+
+	for _, sc := range bundle.Scripts {
+		if sc == nil || sc.Name == "" || sc.DeviceModel == "" {
+			result.Skipped = append(result.Skipped, "script without a name or device model")
+			continue
+		}
+		if _, err := script.Compile(sc.Source); err != nil {
+			result.Skipped = append(result.Skipped, fmt.Sprintf("script %s: %v", sc.ID, err))
+			continue
+		}
+		defined, err := s.scriptRepo.FindByDeviceModel(sc.DeviceModel)
+		if err != nil {
+			return result, err
+		}
+		if hasScript(defined, sc.Name) {
+			result.Skipped = append(result.Skipped, fmt.Sprintf("script %s: %s already defined for %s", sc.ID, sc.Name, sc.DeviceModel))
+			continue
+		}
+
+		imported := *sc
+		imported.ID = model.GenerateID()
+		imported.UpdatedAt = now
+		if err := s.scriptRepo.Create(&imported); err != nil {
+			return result, fmt.Errorf("script %s: %v", sc.ID, err)
+		}
+		result.IDs[bundleScripts][sc.ID] = imported.ID
+		result.Scripts++
+	}
+
+	return result, nil
+}
+
+func hasScript(scripts []*model.Script, name string) bool {
+	for _, sc := range scripts {
+		if sc.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,230 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"tracking/internal/core/hook"
+	"tracking/internal/core/model"
+	"tracking/internal/core/repository"
+	"tracking/internal/core/util"
+)
+
+// MaxCommandAttempts is how many failed writes a command is given before
+// it is marked failed
+const MaxCommandAttempts = 3
+
+// Common command errors
+var (
+	ErrCommandNotFound = errors.New("command not found")
+	ErrInvalidCommand  = errors.New("invalid command")
+)
+
+// commandProtocols lists the command types each protocol can carry
+var commandProtocols = map[string][]string{
+	"gt06": model.CommandTypes,
+	"h02":  {model.CommandEngineStop, model.CommandEngineResume, model.CommandLocate, model.CommandReboot, model.CommandSetInterval},
+}
+
+// CommandSender hands commands to connected devices
+type CommandSender interface {
+	Connected(deviceID string) bool
+	SendDeviceCommand(deviceID string, command *model.Command) error
+}
+
+// CommandService queues commands for devices. Devices are often out of
+// coverage or asleep, so commands wait until the device next connects or
+// sends a heartbeat, and are acknowledged by its reply.
+type CommandService interface {
+	// QueueCommand queues a command for a device, sending it at once when
+	// the device is connected. Interval is taken by setInterval and angle
+	// by setCornerReporting.
+	QueueCommand(deviceID, userID, commandType string, interval, angle int) (*model.Command, error)
+	// CancelCommand withdraws a command not sent yet
+	CancelCommand(id, userID string) (*model.Command, error)
+	// GetCommands returns the commands of a device, oldest first
+	GetCommands(deviceID string) ([]*model.Command, error)
+	// DeliverPending sends a connected device the commands waiting for it,
+	// in the order they were queued
+	DeliverPending(deviceID string)
+}
+
+type commandService struct {
+	commandRepo   repository.CommandRepository
+	deviceRepo    repository.DeviceRepository
+	orgMemberRepo repository.OrganizationMemberRepository
+	sender        CommandSender
+	clock         util.Clock
+	mutex         sync.Mutex // Serialises deliveries and status transitions
+}
+
+// NewCommandService returns a service delivering commands through sender.
+// Command replies raise an EventCommandResult on hooks, which acknowledges
+// the device's oldest command sent.
+func NewCommandService(commandRepo repository.CommandRepository, deviceRepo repository.DeviceRepository, orgMemberRepo repository.OrganizationMemberRepository, sender CommandSender, clock util.Clock, hooks *hook.Registry) CommandService {
+	s := &commandService{
+		commandRepo:   commandRepo,
+		deviceRepo:    deviceRepo,
+		orgMemberRepo: orgMemberRepo,
+		sender:        sender,
+		clock:         clock,
+	}
+	hooks.OnEvent(func(event *model.Event) {
+		if event.Type == model.EventCommandResult {
+			result, _ := event.Attributes["result"].(string)
+			s.acknowledge(event.DeviceID, result)
+		}
+	})
+	return s
+}
+
+func (s *commandService) QueueCommand(deviceID, userID, commandType string, interval, angle int) (*model.Command, error) {
+	if !slices.Contains(model.CommandTypes, commandType) {
+		return nil, fmt.Errorf("%w: unknown type %q", ErrInvalidCommand, commandType)
+	}
+	if commandType == model.CommandSetInterval && interval <= 0 {
+		return nil, fmt.Errorf("%w: interval required", ErrInvalidCommand)
+	}
+	if commandType == model.CommandSetCornerReporting && (angle < 0 || angle > 180) {
+		return nil, fmt.Errorf("%w: angle must be from 0 to 180 degrees", ErrInvalidCommand)
+	}
+	if commandType != model.CommandSetInterval {
+		interval = 0
+	}
+	if commandType != model.CommandSetCornerReporting {
+		angle = 0
+	}
+
+	device, err := newDeviceAccess(userID, s.orgMemberRepo).device(s.deviceRepo, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if device == nil {
+		return nil, errors.New("device not found")
+	}
+	if !slices.Contains(commandProtocols[device.Protocol], commandType) {
+		return nil, fmt.Errorf("%w: %s devices do not take the %s command", ErrInvalidCommand, device.Protocol, commandType)
+	}
+
+	command := model.NewCommand(deviceID, userID, commandType, s.clock.Now())
+	command.Interval = interval
+	command.Angle = angle
+	if err := s.commandRepo.Create(command); err != nil {
+		return nil, err
+	}
+
+	s.DeliverPending(deviceID)
+	return s.commandRepo.FindByID(command.ID)
+}
+
+func (s *commandService) CancelCommand(id, userID string) (*model.Command, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	command, err := s.commandRepo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if command == nil {
+		return nil, ErrCommandNotFound
+	}
+	// Commands of devices out of reach are reported as missing
+	device, err := newDeviceAccess(userID, s.orgMemberRepo).device(s.deviceRepo, command.DeviceID)
+	if err != nil {
+		return nil, err
+	}
+	if device == nil {
+		return nil, ErrCommandNotFound
+	}
+	if command.Status != model.CommandPending {
+		return nil, fmt.Errorf("%w: a %s command cannot be cancelled", ErrInvalidCommand, command.Status)
+	}
+
+	return s.update(command, func(c *model.Command) {
+		c.Status = model.CommandCancelled
+	})
+}
+
+func (s *commandService) GetCommands(deviceID string) ([]*model.Command, error) {
+	commands, err := s.commandRepo.FindByDeviceID(deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if commands == nil {
+		commands = []*model.Command{}
+	}
+	return commands, nil
+}
+
+func (s *commandService) DeliverPending(deviceID string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.sender.Connected(deviceID) {
+		return
+	}
+	pending, err := s.commandRepo.FindByStatus(deviceID, model.CommandPending)
+	if err != nil {
+		log.Printf("Error loading pending commands of %s: %v", deviceID, err)
+		return
+	}
+
+	for _, command := range pending {
+		sendErr := s.sender.SendDeviceCommand(deviceID, command)
+		_, err := s.update(command, func(c *model.Command) {
+			c.Attempts++
+			if sendErr != nil {
+				c.Error = sendErr.Error()
+				if c.Attempts >= MaxCommandAttempts {
+					c.Status = model.CommandFailed
+				}
+				return
+			}
+			now := s.clock.Now()
+			c.Status = model.CommandSent
+			c.Error = ""
+			c.SentAt = &now
+		})
+		if err != nil {
+			log.Printf("Error updating command %s: %v", command.ID, err)
+		}
+	}
+}
+
+// acknowledge marks the oldest command sent to a device acknowledged with
+// the device's reply, as devices answer commands in the order they got them
+func (s *commandService) acknowledge(deviceID, result string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	sent, err := s.commandRepo.FindByStatus(deviceID, model.CommandSent)
+	if err != nil {
+		log.Printf("Error loading sent commands of %s: %v", deviceID, err)
+		return
+	}
+	if len(sent) == 0 {
+		return
+	}
+	if _, err := s.update(sent[0], func(c *model.Command) {
+		now := s.clock.Now()
+		c.Status = model.CommandAcknowledged
+		c.Result = result
+		c.AcknowledgedAt = &now
+	}); err != nil {
+		log.Printf("Error acknowledging command %s: %v", sent[0].ID, err)
+	}
+}
+
+// update applies change to a copy of the stored command and stores it.
+// Callers hold the mutex.
+func (s *commandService) update(stored *model.Command, change func(*model.Command)) (*model.Command, error) {
+	command := *stored
+	change(&command)
+	command.UpdatedAt = s.clock.Now()
+	if err := s.commandRepo.Update(&command); err != nil {
+		return nil, err
+	}
+	return &command, nil
+}
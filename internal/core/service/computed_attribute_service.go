@@ -0,0 +1,334 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"tracking/internal/core/model"
+	"tracking/internal/core/repository"
+	"tracking/internal/core/script"
+	"tracking/internal/core/util"
+)
+
+// MaxComputedAttributes bounds the attributes defined on one device
+const MaxComputedAttributes = 50
+
+// Common computed attribute errors
+var (
+	ErrComputedAttributeNotFound = errors.New("computed attribute not found")
+	ErrInvalidComputedAttribute  = errors.New("invalid computed attribute")
+)
+
+// ComputedAttributeService keeps the computed attributes of devices and
+// evaluates them as positions arrive. Everyone who can reach a device
+// manages its attributes.
+type ComputedAttributeService interface {
+	CreateAttribute(userID string, attribute *model.ComputedAttribute) (*model.ComputedAttribute, error)
+	// UpdateAttribute replaces the name, expression, type and priority of
+	// an attribute
+	UpdateAttribute(id, userID string, attribute *model.ComputedAttribute) (*model.ComputedAttribute, error)
+	DeleteAttribute(id, userID string) error
+	// GetAttributes returns the attributes of a device in evaluation order
+	GetAttributes(deviceID, userID string) ([]*model.ComputedAttribute, error)
+	// TestExpression checks an expression and evaluates it against the
+	// latest position of the device, if there is one
+	TestExpression(deviceID, userID, expression string) (interface{}, error)
+	// ApplyAttributes is a StageDecoded hook storing the attributes of the
+	// position's device in its status
+	ApplyAttributes(ctx context.Context, position *model.Position) error
+}
+
+type compiledExpression struct {
+	source     string
+	expression *script.Expression
+}
+
+type computedAttributeService struct {
+	attributeRepo repository.ComputedAttributeRepository
+	deviceRepo    repository.DeviceRepository
+	positionRepo  repository.PositionRepository
+	orgMemberRepo repository.OrganizationMemberRepository
+	clock         util.Clock
+	compiled      map[string]compiledExpression
+	mutex         sync.Mutex
+}
+
+func NewComputedAttributeService(attributeRepo repository.ComputedAttributeRepository, deviceRepo repository.DeviceRepository, positionRepo repository.PositionRepository, orgMemberRepo repository.OrganizationMemberRepository, clock util.Clock) ComputedAttributeService {
+	return &computedAttributeService{
+		attributeRepo: attributeRepo,
+		deviceRepo:    deviceRepo,
+		positionRepo:  positionRepo,
+		orgMemberRepo: orgMemberRepo,
+		clock:         clock,
+		compiled:      make(map[string]compiledExpression),
+	}
+}
+
+func (s *computedAttributeService) CreateAttribute(userID string, attribute *model.ComputedAttribute) (*model.ComputedAttribute, error) {
+	device, err := s.device(attribute.DeviceID, userID)
+	if err != nil {
+		return nil, err
+	}
+	existing, err := s.attributeRepo.FindByDeviceID(device.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(existing) >= MaxComputedAttributes {
+		return nil, fmt.Errorf("%w: a device has at most %d computed attributes", ErrInvalidComputedAttribute, MaxComputedAttributes)
+	}
+
+	created := *attribute
+	if err := validateComputedAttribute(&created); err != nil {
+		return nil, err
+	}
+	now := s.clock.Now()
+	created.ID = model.GenerateID()
+	created.DeviceID = device.ID
+	created.UserID = userID
+	created.CreatedAt = now
+	created.UpdatedAt = now
+	if err := s.attributeRepo.Create(&created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+func (s *computedAttributeService) UpdateAttribute(id, userID string, attribute *model.ComputedAttribute) (*model.ComputedAttribute, error) {
+	stored, err := s.reachable(id, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	updated := *attribute
+	if err := validateComputedAttribute(&updated); err != nil {
+		return nil, err
+	}
+	updated.ID = stored.ID
+	updated.DeviceID = stored.DeviceID
+	updated.UserID = stored.UserID
+	updated.CreatedAt = stored.CreatedAt
+	updated.UpdatedAt = s.clock.Now()
+	if err := s.attributeRepo.Update(&updated); err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+func (s *computedAttributeService) DeleteAttribute(id, userID string) error {
+	if _, err := s.reachable(id, userID); err != nil {
+		return err
+	}
+	if err := s.attributeRepo.Delete(id); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	delete(s.compiled, id)
+	s.mutex.Unlock()
+	return nil
+}
+
+func (s *computedAttributeService) GetAttributes(deviceID, userID string) ([]*model.ComputedAttribute, error) {
+	device, err := s.device(deviceID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	attributes, err := s.attributeRepo.FindByDeviceID(device.ID)
+	if err != nil {
+		return nil, err
+	}
+	if attributes == nil {
+		attributes = []*model.ComputedAttribute{}
+	}
+	return attributes, nil
+}
+
+func (s *computedAttributeService) TestExpression(deviceID, userID, expression string) (interface{}, error) {
+	device, err := s.device(deviceID, userID)
+	if err != nil {
+		return nil, err
+	}
+	compiled, err := script.CompileExpression(expression)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidComputedAttribute, err)
+	}
+
+	position, err := s.positionRepo.FindLatestByDeviceID(device.ID)
+	if err != nil {
+		return nil, err
+	}
+	if position == nil {
+		return nil, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), scriptTimeout)
+	defer cancel()
+	value, err := compiled.Eval(ctx, scriptInputs(position))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidComputedAttribute, err)
+	}
+	return value, nil
+}
+
+// ApplyAttributes never rejects a position: an attribute that fails or
+// yields a value of the wrong type is logged and left out
+func (s *computedAttributeService) ApplyAttributes(ctx context.Context, position *model.Position) error {
+	attributes, err := s.attributeRepo.FindByDeviceID(position.DeviceID)
+	if err != nil {
+		log.Printf("[Attributes] Error loading computed attributes for device %s: %v", position.DeviceID, err)
+		return nil
+	}
+	if len(attributes) == 0 {
+		return nil
+	}
+
+	inputs := scriptInputs(position)
+	for _, attribute := range attributes {
+		value, err := s.evaluate(ctx, attribute, inputs)
+		if err != nil {
+			log.Printf("[Attributes] %s (%s) failed for device %s: %v", attribute.Attribute, attribute.ID, position.DeviceID, err)
+			continue
+		}
+		if value == nil {
+			continue
+		}
+
+		if position.Status == nil {
+			position.Status = make(map[string]interface{})
+		}
+		position.Status[attribute.Attribute] = value
+		inputs[attribute.Attribute] = value
+	}
+	return nil
+}
+
+func (s *computedAttributeService) evaluate(ctx context.Context, attribute *model.ComputedAttribute, inputs map[string]interface{}) (interface{}, error) {
+	expression, err := s.expression(attribute)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, scriptTimeout)
+	defer cancel()
+	value, err := expression.Eval(ctx, inputs)
+	if err != nil || value == nil {
+		return nil, err
+	}
+
+	var ok bool
+	switch attribute.Type {
+	case model.AttributeTypeNumber:
+		_, ok = value.(float64)
+	case model.AttributeTypeString:
+		_, ok = value.(string)
+	case model.AttributeTypeBoolean:
+		_, ok = value.(bool)
+	}
+	if !ok {
+		return nil, fmt.Errorf("got %v, want a %s", value, attribute.Type)
+	}
+	return value, nil
+}
+
+// expression returns the compiled expression, recompiling when it changes
+func (s *computedAttributeService) expression(attribute *model.ComputedAttribute) (*script.Expression, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if cached, ok := s.compiled[attribute.ID]; ok && cached.source == attribute.Expression {
+		return cached.expression, nil
+	}
+
+	expression, err := script.CompileExpression(attribute.Expression)
+	if err != nil {
+		return nil, fmt.Errorf("compile: %w", err)
+	}
+	s.compiled[attribute.ID] = compiledExpression{source: attribute.Expression, expression: expression}
+	return expression, nil
+}
+
+// device returns the device when the user can reach it
+func (s *computedAttributeService) device(deviceID, userID string) (*model.Device, error) {
+	if deviceID == "" || userID == "" {
+		return nil, ErrDeviceNotFound
+	}
+	device, err := newDeviceAccess(userID, s.orgMemberRepo).device(s.deviceRepo, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if device == nil {
+		return nil, ErrDeviceNotFound
+	}
+	return device, nil
+}
+
+// reachable returns an attribute of a device the user can reach; the
+// others are reported as missing
+func (s *computedAttributeService) reachable(id, userID string) (*model.ComputedAttribute, error) {
+	if id == "" {
+		return nil, ErrComputedAttributeNotFound
+	}
+	attribute, err := s.attributeRepo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if attribute == nil {
+		return nil, ErrComputedAttributeNotFound
+	}
+	if _, err := s.device(attribute.DeviceID, userID); err != nil {
+		if errors.Is(err, ErrDeviceNotFound) {
+			return nil, ErrComputedAttributeNotFound
+		}
+		return nil, err
+	}
+	return attribute, nil
+}
+
+// validateComputedAttribute normalizes an attribute and compiles its
+// expression
+func validateComputedAttribute(attribute *model.ComputedAttribute) error {
+	attribute.Attribute = strings.TrimSpace(attribute.Attribute)
+	attribute.Expression = strings.TrimSpace(attribute.Expression)
+	attribute.Description = strings.TrimSpace(attribute.Description)
+	if !validAttributeName(attribute.Attribute) {
+		return fmt.Errorf("%w: attribute name must be a letter followed by letters, digits or _", ErrInvalidComputedAttribute)
+	}
+	switch attribute.Type {
+	case "":
+		attribute.Type = model.AttributeTypeNumber
+	case model.AttributeTypeNumber, model.AttributeTypeString, model.AttributeTypeBoolean:
+	default:
+		return fmt.Errorf("%w: type must be %s, %s or %s", ErrInvalidComputedAttribute,
+			model.AttributeTypeNumber, model.AttributeTypeString, model.AttributeTypeBoolean)
+	}
+	if _, err := script.CompileExpression(attribute.Expression); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidComputedAttribute, err)
+	}
+	return nil
+}
+
+// reservedAttributeNames are the position fields scripts read and the
+// literals of the language
+var reservedAttributeNames = map[string]bool{
+	"deviceId": true, "protocol": true, "latitude": true, "longitude": true, "altitude": true,
+	"speed": true, "course": true, "satellites": true, "valid": true,
+	"true": true, "false": true, "nil": true,
+}
+
+// validAttributeName accepts the names a script can refer to, apart from
+// the _ prefix scripts keep for temporaries and the reserved names
+func validAttributeName(name string) bool {
+	if name == "" || len(name) > 64 || reservedAttributeNames[name] {
+		return false
+	}
+	for i, c := range name {
+		letter := c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+		if !letter && (i == 0 || c != '_' && (c < '0' || c > '9')) {
+			return false
+		}
+	}
+	return true
+}
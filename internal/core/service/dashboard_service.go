@@ -0,0 +1,325 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+	"tracking/internal/core/model"
+	"tracking/internal/core/repository"
+	"tracking/internal/core/util"
+)
+
+// Dashboard widgets
+const (
+	WidgetTopSpeeders  = "topSpeeders"
+	WidgetMostDistance = "mostDistance"
+	WidgetAlarmsByType = "alarmsByType"
+	WidgetOnlineRatio  = "onlineRatio"
+)
+
+// Intervals of the online ratio series
+const (
+	IntervalHour = "hour"
+	IntervalDay  = "day"
+)
+
+// Bounds on widget queries
+const (
+	DefaultWidgetLimit = 10
+	MaxWidgetLimit     = 100
+	DefaultWidgetDays  = 7
+	MaxWidgetDays      = 92
+)
+
+// ErrInvalidWidgetQuery is returned for a widget query out of bounds
+var ErrInvalidWidgetQuery = errors.New("invalid widget query")
+
+// WidgetQuery selects the devices and days a widget covers. Aggregates are
+// kept by UTC day, so From and To select every day they touch.
+type WidgetQuery struct {
+	Devices  model.DeviceFilter
+	From     time.Time // Zero for DefaultWidgetDays before To
+	To       time.Time // Exclusive; zero for now
+	Limit    int       // Devices ranked; 0 for DefaultWidgetLimit
+	Interval string    // IntervalHour or IntervalDay, for the online ratio
+}
+
+// DashboardService keeps daily aggregates of the positions stored and
+// turns them into chart series, so dashboards need no analytics of their
+// own. Widgets cover the devices the user can access.
+type DashboardService interface {
+	// RecordPosition adds a stored position to its device's aggregate; it
+	// runs as a StageStored hook
+	RecordPosition(ctx context.Context, position *model.Position) error
+	// TopSpeeders ranks devices by their highest speed
+	TopSpeeders(userID string, query WidgetQuery) (*model.Chart, error)
+	// MostDistance ranks devices by the kilometers they covered
+	MostDistance(userID string, query WidgetQuery) (*model.Chart, error)
+	// AlarmsByType counts alarm positions by day, one series per alarm
+	AlarmsByType(userID string, query WidgetQuery) (*model.Chart, error)
+	// OnlineRatio gives the share of devices that reported in each hour
+	// or day
+	OnlineRatio(userID string, query WidgetQuery) (*model.Chart, error)
+}
+
+type dashboardService struct {
+	statsRepo     repository.DeviceStatsRepository
+	deviceRepo    repository.DeviceRepository
+	orgMemberRepo repository.OrganizationMemberRepository
+	clock         util.Clock
+	mutex         sync.Mutex // Serializes aggregate updates
+}
+
+func NewDashboardService(statsRepo repository.DeviceStatsRepository, deviceRepo repository.DeviceRepository, orgMemberRepo repository.OrganizationMemberRepository, clock util.Clock) DashboardService {
+	return &dashboardService{
+		statsRepo:     statsRepo,
+		deviceRepo:    deviceRepo,
+		orgMemberRepo: orgMemberRepo,
+		clock:         clock,
+	}
+}
+
+func (s *dashboardService) RecordPosition(ctx context.Context, position *model.Position) error {
+	at := position.Timestamp.UTC()
+	day := at.Format("2006-01-02")
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	stored, err := s.statsRepo.Find(position.DeviceID, day)
+	if err != nil {
+		return err
+	}
+	stats := model.NewDeviceDayStats(position.DeviceID, day)
+	if stored != nil {
+		*stats = *stored
+		stats.Alarms = make(map[string]int, len(stored.Alarms))
+		for alarm, count := range stored.Alarms {
+			stats.Alarms[alarm] = count
+		}
+	}
+
+	stats.Positions++
+	stats.ActiveHours |= 1 << at.Hour()
+	if alarm, _ := position.Status["alarm"].(string); alarm != "" {
+		stats.Alarms[alarm]++
+	}
+	// Fixes uploaded late, after newer ones, add no distance
+	if position.Valid {
+		stats.MaxSpeed = max(stats.MaxSpeed, position.Speed)
+		if stats.LastFix.IsZero() || at.After(stats.LastFix) {
+			if !stats.LastFix.IsZero() {
+				stats.Distance += util.Distance(stats.LastLatitude, stats.LastLongitude, position.Latitude, position.Longitude) / 1000
+			}
+			stats.LastLatitude, stats.LastLongitude, stats.LastFix = position.Latitude, position.Longitude, at
+		}
+	}
+	stats.UpdatedAt = s.clock.Now()
+	return s.statsRepo.Save(stats)
+}
+
+func (s *dashboardService) TopSpeeders(userID string, query WidgetQuery) (*model.Chart, error) {
+	return s.rank(userID, query, WidgetTopSpeeders, "maxSpeed", func(total, day *model.DeviceDayStats) {
+		total.MaxSpeed = max(total.MaxSpeed, day.MaxSpeed)
+	}, func(total *model.DeviceDayStats) float64 {
+		return total.MaxSpeed
+	})
+}
+
+func (s *dashboardService) MostDistance(userID string, query WidgetQuery) (*model.Chart, error) {
+	return s.rank(userID, query, WidgetMostDistance, "distance", func(total, day *model.DeviceDayStats) {
+		total.Distance += day.Distance
+	}, func(total *model.DeviceDayStats) float64 {
+		return math.Round(total.Distance*100) / 100
+	})
+}
+
+// rank totals the aggregates of each device with add and charts the
+// devices with the highest values, the highest first
+func (s *dashboardService) rank(userID string, query WidgetQuery, widget, series string, add func(total, day *model.DeviceDayStats), value func(*model.DeviceDayStats) float64) (*model.Chart, error) {
+	chart, devices, stats, err := s.load(userID, widget, &query)
+	if err != nil || len(devices) == 0 {
+		return chart, err
+	}
+
+	totals := make(map[string]*model.DeviceDayStats)
+	for _, day := range stats {
+		total, ok := totals[day.DeviceID]
+		if !ok {
+			total = model.NewDeviceDayStats(day.DeviceID, "")
+			totals[day.DeviceID] = total
+		}
+		add(total, day)
+	}
+	ranked := make([]*model.DeviceDayStats, 0, len(totals))
+	for _, total := range totals {
+		ranked = append(ranked, total)
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if vi, vj := value(ranked[i]), value(ranked[j]); vi != vj {
+			return vi > vj
+		}
+		return ranked[i].DeviceID < ranked[j].DeviceID
+	})
+	if len(ranked) > query.Limit {
+		ranked = ranked[:query.Limit]
+	}
+
+	data := &model.ChartSeries{Name: series, Data: []float64{}}
+	for _, total := range ranked {
+		chart.Labels = append(chart.Labels, devices[total.DeviceID].Name)
+		chart.DeviceIDs = append(chart.DeviceIDs, total.DeviceID)
+		data.Data = append(data.Data, value(total))
+	}
+	chart.Series = append(chart.Series, data)
+	return chart, nil
+}
+
+func (s *dashboardService) AlarmsByType(userID string, query WidgetQuery) (*model.Chart, error) {
+	chart, devices, stats, err := s.load(userID, WidgetAlarmsByType, &query)
+	if err != nil || len(devices) == 0 {
+		return chart, err
+	}
+
+	days := widgetDays(query)
+	index := make(map[string]int, len(days))
+	for i, day := range days {
+		index[day] = i
+	}
+	series := make(map[string]*model.ChartSeries)
+	for _, day := range stats {
+		for alarm, count := range day.Alarms {
+			if series[alarm] == nil {
+				series[alarm] = &model.ChartSeries{Name: alarm, Data: make([]float64, len(days))}
+			}
+			series[alarm].Data[index[day.Day]] += float64(count)
+		}
+	}
+
+	chart.Labels = days
+	for _, alarmSeries := range series {
+		chart.Series = append(chart.Series, alarmSeries)
+	}
+	sort.Slice(chart.Series, func(i, j int) bool { return chart.Series[i].Name < chart.Series[j].Name })
+	return chart, nil
+}
+
+func (s *dashboardService) OnlineRatio(userID string, query WidgetQuery) (*model.Chart, error) {
+	switch query.Interval {
+	case "":
+		query.Interval = IntervalHour
+	case IntervalHour, IntervalDay:
+	default:
+		return nil, fmt.Errorf("%w: interval must be %s or %s", ErrInvalidWidgetQuery, IntervalHour, IntervalDay)
+	}
+	chart, devices, stats, err := s.load(userID, WidgetOnlineRatio, &query)
+	if err != nil || len(devices) == 0 {
+		return chart, err
+	}
+
+	days := widgetDays(query)
+	index := make(map[string]int, len(days))
+	for i, day := range days {
+		index[day] = i
+	}
+	perDay := 1
+	if query.Interval == IntervalHour {
+		perDay = 24
+	}
+	online := make([]float64, len(days)*perDay)
+	for _, day := range stats {
+		if perDay == 1 {
+			if day.ActiveHours != 0 {
+				online[index[day.Day]]++
+			}
+			continue
+		}
+		for hour := 0; hour < 24; hour++ {
+			if day.ActiveHours&(1<<hour) != 0 {
+				online[index[day.Day]*24+hour]++
+			}
+		}
+	}
+
+	for i, day := range days {
+		for hour := 0; hour < perDay; hour++ {
+			if perDay == 1 {
+				chart.Labels = append(chart.Labels, day)
+			} else {
+				chart.Labels = append(chart.Labels, fmt.Sprintf("%sT%02d:00:00Z", day, hour))
+			}
+			j := i*perDay + hour
+			online[j] = math.Round(online[j]/float64(len(devices))*1000) / 1000
+		}
+	}
+	chart.Series = append(chart.Series, &model.ChartSeries{Name: "online", Data: online})
+	return chart, nil
+}
+
+// load checks the query, filling in its defaults, and returns an empty
+// chart with the devices the user can access and their aggregates
+func (s *dashboardService) load(userID, widget string, query *WidgetQuery) (*model.Chart, map[string]*model.Device, []*model.DeviceDayStats, error) {
+	if userID == "" {
+		return nil, nil, nil, errors.New("invalid user ID")
+	}
+	if query.To.IsZero() {
+		query.To = s.clock.Now()
+	}
+	if query.From.IsZero() {
+		query.From = query.To.AddDate(0, 0, -DefaultWidgetDays)
+	}
+	if !query.From.Before(query.To) {
+		return nil, nil, nil, fmt.Errorf("%w: from must be before to", ErrInvalidWidgetQuery)
+	}
+	if query.To.Sub(query.From) > MaxWidgetDays*24*time.Hour {
+		return nil, nil, nil, fmt.Errorf("%w: widgets cover at most %d days", ErrInvalidWidgetQuery, MaxWidgetDays)
+	}
+	if query.Limit <= 0 {
+		query.Limit = DefaultWidgetLimit
+	}
+	query.Limit = min(query.Limit, MaxWidgetLimit)
+
+	chart := &model.Chart{
+		Widget: widget,
+		From:   query.From,
+		To:     query.To,
+		Labels: []string{},
+		Series: []*model.ChartSeries{},
+	}
+	ids, err := newDeviceAccess(userID, s.orgMemberRepo).devices(s.deviceRepo, query.Devices)
+	if err != nil || len(ids) == 0 {
+		return chart, nil, nil, err
+	}
+	all, err := s.deviceRepo.FindAll()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	devices := make(map[string]*model.Device, len(ids))
+	for _, device := range all {
+		if slices.Contains(ids, device.ID) {
+			devices[device.ID] = device
+		}
+	}
+
+	days := widgetDays(*query)
+	stats, err := s.statsRepo.FindRange(ids, days[0], days[len(days)-1])
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return chart, devices, stats, nil
+}
+
+// widgetDays lists the UTC days a query touches, oldest first
+func widgetDays(query WidgetQuery) []string {
+	var days []string
+	last := query.To.Add(-time.Nanosecond).UTC()
+	for day := query.From.UTC().Truncate(24 * time.Hour); !day.After(last); day = day.AddDate(0, 0, 1) {
+		days = append(days, day.Format("2006-01-02"))
+	}
+	return days
+}
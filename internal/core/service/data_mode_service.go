@@ -0,0 +1,214 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+	"tracking/internal/core/model"
+	"tracking/internal/core/repository"
+	"tracking/internal/core/util"
+)
+
+// Bounds on low-data mode
+const (
+	MinLowDataInterval = 60    // s
+	MaxLowDataInterval = 18000 // s, the longest every protocol takes
+	MinCornerAngle     = 5     // Degrees
+	MaxCornerAngle     = 180   // Degrees
+)
+
+// usageWindow is how far back data usage is observed
+const usageWindow = 7 * 24 * time.Hour
+
+// reportBytes is the typical traffic of one report by protocol: the frame,
+// the server's acknowledgement and their TCP/IP headers
+var reportBytes = map[string]int{
+	"gt06":   126,
+	"h02":    190,
+	"osmand": 520,
+}
+
+// defaultReportBytes covers protocols without a typical size
+const defaultReportBytes = 200
+
+// ErrInvalidDataMode rejects settings out of bounds and those the device's
+// protocol cannot be configured for
+var ErrInvalidDataMode = errors.New("invalid data mode")
+
+// DataModeService asks devices for reduced reporting and estimates the
+// data they use. Everyone who can reach a device sets its mode.
+type DataModeService interface {
+	// GetDataMode returns the mode last set on a device
+	GetDataMode(deviceID, userID string) (*model.DataMode, error)
+	// SetDataMode stores the mode and queues the commands configuring the
+	// device for it, sent when the device next connects
+	SetDataMode(userID string, mode *model.DataMode) (*model.DataMode, error)
+	// EstimateUsage projects the traffic of a device over the past week
+	// to a month
+	EstimateUsage(deviceID, userID string) (*model.DataUsage, error)
+}
+
+type dataModeService struct {
+	dataModeRepo   repository.DataModeRepository
+	deviceRepo     repository.DeviceRepository
+	positionRepo   repository.PositionRepository
+	orgMemberRepo  repository.OrganizationMemberRepository
+	commandService CommandService
+	clock          util.Clock
+}
+
+func NewDataModeService(dataModeRepo repository.DataModeRepository, deviceRepo repository.DeviceRepository, positionRepo repository.PositionRepository, orgMemberRepo repository.OrganizationMemberRepository, commandService CommandService, clock util.Clock) DataModeService {
+	return &dataModeService{
+		dataModeRepo:   dataModeRepo,
+		deviceRepo:     deviceRepo,
+		positionRepo:   positionRepo,
+		orgMemberRepo:  orgMemberRepo,
+		commandService: commandService,
+		clock:          clock,
+	}
+}
+
+func (s *dataModeService) GetDataMode(deviceID, userID string) (*model.DataMode, error) {
+	device, err := s.device(deviceID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	mode, err := s.dataModeRepo.Find(device.ID)
+	if err != nil {
+		return nil, err
+	}
+	if mode == nil {
+		mode = &model.DataMode{DeviceID: device.ID, CommandIDs: []string{}}
+	}
+	return mode, nil
+}
+
+func (s *dataModeService) SetDataMode(userID string, mode *model.DataMode) (*model.DataMode, error) {
+	device, err := s.device(mode.DeviceID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	updated := *mode
+	if err := validateDataMode(&updated); err != nil {
+		return nil, err
+	}
+	commands, err := dataModeCommands(device.Protocol, &updated)
+	if err != nil {
+		return nil, err
+	}
+
+	updated.DeviceID = device.ID
+	updated.CommandIDs = []string{}
+	for _, command := range commands {
+		queued, err := s.commandService.QueueCommand(device.ID, userID, command.Type, command.Interval, command.Angle)
+		if err != nil {
+			return nil, err
+		}
+		updated.CommandIDs = append(updated.CommandIDs, queued.ID)
+	}
+	updated.UserID = userID
+	updated.UpdatedAt = s.clock.Now()
+	if err := s.dataModeRepo.Save(&updated); err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+func (s *dataModeService) EstimateUsage(deviceID, userID string) (*model.DataUsage, error) {
+	device, err := s.device(deviceID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// A device added during the window is observed since it was added
+	now := s.clock.Now()
+	since := now.Add(-usageWindow)
+	if device.CreatedAt.After(since) {
+		since = device.CreatedAt
+	}
+	observed := now.Sub(since)
+	if observed < time.Hour {
+		observed = time.Hour
+	}
+
+	positions, err := s.positionRepo.FindByDeviceID(device.ID)
+	if err != nil {
+		return nil, err
+	}
+	usage := &model.DataUsage{DeviceID: device.ID, Since: since, BytesPerReport: defaultReportBytes}
+	if bytes, ok := reportBytes[device.Protocol]; ok {
+		usage.BytesPerReport = bytes
+	}
+	for _, position := range positions {
+		if !position.Timestamp.Before(since) && !position.Timestamp.After(now) {
+			usage.Reports++
+		}
+	}
+	usage.ReportsPerDay = float64(usage.Reports) / observed.Hours() * 24
+	usage.MonthlyBytes = int64(usage.ReportsPerDay * 30 * float64(usage.BytesPerReport))
+	return usage, nil
+}
+
+// device returns the device when the user can reach it
+func (s *dataModeService) device(deviceID, userID string) (*model.Device, error) {
+	if deviceID == "" || userID == "" {
+		return nil, ErrDeviceNotFound
+	}
+	device, err := newDeviceAccess(userID, s.orgMemberRepo).device(s.deviceRepo, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if device == nil {
+		return nil, ErrDeviceNotFound
+	}
+	return device, nil
+}
+
+// validateDataMode checks the settings of low-data mode and fills in the
+// reporting asked for outside it
+func validateDataMode(mode *model.DataMode) error {
+	if !mode.LowData {
+		mode.Interval = model.DefaultReportInterval
+		mode.CornerOnly = false
+		mode.CornerAngle = 0
+		return nil
+	}
+
+	if mode.Interval < MinLowDataInterval || mode.Interval > MaxLowDataInterval {
+		return fmt.Errorf("%w: interval must be from %d to %d seconds", ErrInvalidDataMode, MinLowDataInterval, MaxLowDataInterval)
+	}
+	if !mode.CornerOnly {
+		mode.CornerAngle = 0
+		return nil
+	}
+	if mode.CornerAngle == 0 {
+		mode.CornerAngle = model.DefaultCornerAngle
+	}
+	if mode.CornerAngle < MinCornerAngle || mode.CornerAngle > MaxCornerAngle {
+		return fmt.Errorf("%w: corner angle must be from %d to %d degrees", ErrInvalidDataMode, MinCornerAngle, MaxCornerAngle)
+	}
+	return nil
+}
+
+// dataModeCommands translates a mode into the commands configuring a
+// device of the protocol. Devices reporting corners have them turned off
+// unless the mode asks for them.
+func dataModeCommands(protocol string, mode *model.DataMode) ([]*model.Command, error) {
+	supported := commandProtocols[protocol]
+	if !slices.Contains(supported, model.CommandSetInterval) {
+		return nil, fmt.Errorf("%w: %s devices cannot be configured remotely", ErrInvalidDataMode, protocol)
+	}
+	commands := []*model.Command{{Type: model.CommandSetInterval, Interval: mode.Interval}}
+
+	corners := slices.Contains(supported, model.CommandSetCornerReporting)
+	if mode.CornerOnly && !corners {
+		return nil, fmt.Errorf("%w: %s devices do not report corners", ErrInvalidDataMode, protocol)
+	}
+	if corners {
+		commands = append(commands, &model.Command{Type: model.CommandSetCornerReporting, Angle: mode.CornerAngle})
+	}
+	return commands, nil
+}
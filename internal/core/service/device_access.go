@@ -0,0 +1,107 @@
+package service
+
+import (
+	"errors"
+	"slices"
+	"tracking/internal/core/model"
+	"tracking/internal/core/repository"
+)
+
+// ErrDeviceNotFound is returned for a device that is missing or out of the
+// user's reach
+var ErrDeviceNotFound = errors.New("device not found")
+
+// deviceAccess applies the rules of DeviceService.ValidateDeviceAccess to
+// device assignments, remembering memberships for the length of a request
+type deviceAccess struct {
+	userID        string
+	orgMemberRepo repository.OrganizationMemberRepository
+	orgs          map[string]bool
+}
+
+func newDeviceAccess(userID string, orgMemberRepo repository.OrganizationMemberRepository) *deviceAccess {
+	return &deviceAccess{
+		userID:        userID,
+		orgMemberRepo: orgMemberRepo,
+		orgs:          make(map[string]bool),
+	}
+}
+
+func (a *deviceAccess) allowed(userID, organizationID string) (bool, error) {
+	if userID == a.userID {
+		return true, nil
+	}
+	if organizationID == "" {
+		return false, nil
+	}
+	if member, seen := a.orgs[organizationID]; seen {
+		return member, nil
+	}
+
+	member, err := a.orgMemberRepo.FindByUserAndOrg(a.userID, organizationID)
+	if err != nil {
+		return false, err
+	}
+	a.orgs[organizationID] = member != nil
+	return member != nil, nil
+}
+
+// devices returns the IDs of the devices the user can access among those
+// the filter selects
+func (a *deviceAccess) devices(deviceRepo repository.DeviceRepository, filter model.DeviceFilter) ([]string, error) {
+	devices, err := deviceRepo.FindAll()
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for _, device := range devices {
+		if !filter.Matches(device) {
+			continue
+		}
+		allowed, err := a.allowed(device.UserID, device.OrganizationID)
+		if err != nil {
+			return nil, err
+		}
+		if allowed {
+			ids = append(ids, device.ID)
+		}
+	}
+	return ids, nil
+}
+
+// device returns the device when the user can access it, and nil otherwise
+func (a *deviceAccess) device(deviceRepo repository.DeviceRepository, deviceID string) (*model.Device, error) {
+	device, err := deviceRepo.FindByID(deviceID)
+	if err != nil || device == nil {
+		return nil, err
+	}
+	allowed, err := a.allowed(device.UserID, device.OrganizationID)
+	if err != nil || !allowed {
+		return nil, err
+	}
+	return device, nil
+}
+
+// deviceUsers returns the IDs of the users who can access a device: its
+// owner and the members of its organization
+func deviceUsers(device *model.Device, orgMemberRepo repository.OrganizationMemberRepository) ([]string, error) {
+	var userIDs []string
+	if device.UserID != "" {
+		userIDs = append(userIDs, device.UserID)
+	}
+	if device.OrganizationID == "" {
+		return userIDs, nil
+	}
+
+	members, err := orgMemberRepo.FindByOrganization(device.OrganizationID)
+	if err != nil {
+		return nil, err
+	}
+	for _, member := range members {
+		if !slices.Contains(userIDs, member.UserID) {
+			userIDs = append(userIDs, member.UserID)
+		}
+	}
+	return userIDs, nil
+}
@@ -0,0 +1,144 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+	"tracking/internal/core/devicecert"
+	"tracking/internal/core/model"
+	"tracking/internal/core/repository"
+	"tracking/internal/core/util"
+)
+
+// Validity of device certificates, in days
+const (
+	DefaultCertificateDays = 365
+	MaxCertificateDays     = 5 * 365
+)
+
+// Common device certificate errors
+var (
+	ErrCertificateNotFound = errors.New("device certificate not found")
+	ErrInvalidCertificate  = errors.New("invalid device certificate request")
+)
+
+// DeviceCertificateService issues the client certificates devices connect
+// over mutual TLS with and revokes them. Admins manage certificates for
+// every device.
+type DeviceCertificateService interface {
+	// Issue signs a certificate naming the device by its unique ID. The
+	// private key is only in the result.
+	Issue(adminID string, req *model.DeviceCertificateRequest) (*model.IssuedDeviceCertificate, error)
+	// List returns the certificates of a device, or of every device when
+	// deviceID is empty, newest first
+	List(deviceID string) ([]*model.DeviceCertificate, error)
+	// Revoke stops the certificate from authenticating new connections
+	Revoke(id string) (*model.DeviceCertificate, error)
+	// Revoked reports whether the certificate with the serial was revoked.
+	// Certificates unknown to the repository pass, so those of a kept
+	// authority issued before it was recorded still connect.
+	Revoked(serial string) bool
+}
+
+type deviceCertificateService struct {
+	certificateRepo repository.DeviceCertificateRepository
+	deviceRepo      repository.DeviceRepository
+	authority       *devicecert.Authority
+	clock           util.Clock
+}
+
+func NewDeviceCertificateService(certificateRepo repository.DeviceCertificateRepository, deviceRepo repository.DeviceRepository, authority *devicecert.Authority, clock util.Clock) DeviceCertificateService {
+	return &deviceCertificateService{
+		certificateRepo: certificateRepo,
+		deviceRepo:      deviceRepo,
+		authority:       authority,
+		clock:           clock,
+	}
+}
+
+func (s *deviceCertificateService) Issue(adminID string, req *model.DeviceCertificateRequest) (*model.IssuedDeviceCertificate, error) {
+	days := req.ValidityDays
+	if days == 0 {
+		days = DefaultCertificateDays
+	}
+	if days < 0 || days > MaxCertificateDays {
+		return nil, fmt.Errorf("%w: validityDays must be between 1 and %d", ErrInvalidCertificate, MaxCertificateDays)
+	}
+	if req.DeviceID == "" {
+		return nil, fmt.Errorf("%w: deviceId required", ErrInvalidCertificate)
+	}
+	device, err := s.deviceRepo.FindByID(req.DeviceID)
+	if err != nil {
+		return nil, err
+	}
+	if device == nil {
+		return nil, ErrDeviceNotFound
+	}
+
+	issued, err := s.authority.IssueDevice(device.UniqueID, time.Duration(days)*24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+	certificate := &model.DeviceCertificate{
+		ID:        model.GenerateID(),
+		DeviceID:  device.ID,
+		UniqueID:  device.UniqueID,
+		Serial:    issued.Serial,
+		NotBefore: issued.NotBefore,
+		NotAfter:  issued.NotAfter,
+		CreatedBy: adminID,
+		CreatedAt: s.clock.Now(),
+	}
+	if err := s.certificateRepo.Create(certificate); err != nil {
+		return nil, err
+	}
+	return &model.IssuedDeviceCertificate{
+		DeviceCertificate: certificate,
+		Certificate:       string(issued.CertificatePEM),
+		PrivateKey:        string(issued.PrivateKeyPEM),
+		CACertificate:     string(s.authority.CertificatePEM()),
+	}, nil
+}
+
+func (s *deviceCertificateService) List(deviceID string) ([]*model.DeviceCertificate, error) {
+	certificates, err := s.certificateRepo.FindByDeviceID(deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if certificates == nil {
+		certificates = []*model.DeviceCertificate{}
+	}
+	return certificates, nil
+}
+
+func (s *deviceCertificateService) Revoke(id string) (*model.DeviceCertificate, error) {
+	certificate, err := s.certificateRepo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if certificate == nil {
+		return nil, ErrCertificateNotFound
+	}
+	if certificate.Revoked() {
+		return certificate, nil
+	}
+
+	now := s.clock.Now()
+	certificate.RevokedAt = &now
+	if err := s.certificateRepo.Update(certificate); err != nil {
+		return nil, err
+	}
+	return certificate, nil
+}
+
+// Revoked fails closed: a certificate whose state cannot be read is
+// refused
+func (s *deviceCertificateService) Revoked(serial string) bool {
+	certificate, err := s.certificateRepo.FindBySerial(serial)
+	if err != nil {
+		log.Printf("Failed to look up device certificate %s: %v", serial, err)
+		return true
+	}
+	return certificate != nil && certificate.Revoked()
+}
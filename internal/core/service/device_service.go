@@ -4,12 +4,23 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 	"tracking/internal/cache"
 	"tracking/internal/core/model"
+	"tracking/internal/core/profile"
 	"tracking/internal/core/repository"
+	"tracking/internal/core/util"
 )
 
+// Presence tells which devices are linked to the servers right now
+type Presence interface {
+	// Session returns the session of an online device, or nil
+	Session(deviceID string) *model.DeviceSession
+	// Sessions returns the sessions of every online device
+	Sessions() []*model.DeviceSession
+}
+
 type DeviceService interface {
 	CreateDevice(name, uniqueID string, userID, organizationID string) (*model.Device, error)
 	UpdateDevice(device *model.Device) error
@@ -19,11 +30,44 @@ type DeviceService interface {
 	GetUserDevices(userID string) ([]*model.Device, error)
 	GetOrganizationDevices(organizationID string) ([]*model.Device, error)
 	ValidateDeviceAccess(deviceID, userID string) error
+	// AssignModel sets the device's hardware model from the catalog, which
+	// also fixes its protocol; an empty name clears the assignment
+	AssignModel(deviceID, userID, modelName string) (*model.Device, error)
+	// SetSpeedLimit sets the km/h limit used for overspeed detection where
+	// the road limit is unknown; zero clears it
+	SetSpeedLimit(deviceID, userID string, limit float64) (*model.Device, error)
+	// SetPhone sets the number of the device's SIM, which SMS reports are
+	// matched by; an empty number clears it
+	SetPhone(deviceID, userID, phone string) (*model.Device, error)
+	// SetTags replaces the device's tags, which listings and reports can
+	// be filtered by; no tags clears them
+	SetTags(deviceID, userID string, tags []string) (*model.Device, error)
+	// SetExternalIDs replaces the IDs the device has in other systems, by
+	// system name; an ID is held by one device per system, and none clears
+	// them
+	SetExternalIDs(deviceID, userID string, ids map[string]string) (*model.Device, error)
+	// FindByExternalID returns the device the user can access with the ID
+	// in the external system, failing with ErrDeviceNotFound otherwise
+	FindByExternalID(userID, system, id string) (*model.Device, error)
+	// StampExternalIDs adds the external IDs of an event's device to its
+	// attributes, so webhooks and stored events carry them; it is an event
+	// hook
+	StampExternalIDs(ctx context.Context, event *model.Event) error
+	GetDeviceModels() []*model.DeviceProfile
+	// GetSessions returns the sessions of the online devices the user can
+	// access, most recently seen first
+	GetSessions(userID string) ([]*model.DeviceSession, error)
+	// WithConnectionStatus returns copies of the devices whose status says
+	// whether they are online now, rather than the stored status
+	WithConnectionStatus(devices []*model.Device) []*model.Device
 }
 
 type deviceService struct {
 	deviceRepo    repository.DeviceRepository
 	orgMemberRepo repository.OrganizationMemberRepository
+	catalog       *profile.Catalog
+	presence      Presence // Nil leaves the stored status in place
+	clock         util.Clock
 }
 
 const (
@@ -31,12 +75,17 @@ const (
 	deviceListCacheDuration  = 2 * time.Minute
 	deviceCacheKeyPrefix     = "device:"
 	deviceListCacheKeyPrefix = "devices:"
+	maxSpeedLimit            = 300 // km/h
+	minPhoneDigits           = 6
 )
 
-func NewDeviceService(deviceRepo repository.DeviceRepository, orgMemberRepo repository.OrganizationMemberRepository) DeviceService {
+func NewDeviceService(deviceRepo repository.DeviceRepository, orgMemberRepo repository.OrganizationMemberRepository, catalog *profile.Catalog, presence Presence, clock util.Clock) DeviceService {
 	return &deviceService{
 		deviceRepo:    deviceRepo,
 		orgMemberRepo: orgMemberRepo,
+		catalog:       catalog,
+		presence:      presence,
+		clock:         clock,
 	}
 }
 
@@ -58,6 +107,8 @@ func (s *deviceService) CreateDevice(name, uniqueID string, userID, organization
 
 	device := model.NewDevice(name, uniqueID)
 	device.SetOwnership(userID, organizationID)
+	device.CreatedAt = s.clock.Now()
+	device.LastUpdate = device.CreatedAt
 	err := s.deviceRepo.Create(device)
 	if err != nil {
 		return nil, err
@@ -195,4 +246,263 @@ func (s *deviceService) ValidateDeviceAccess(deviceID, userID string) error {
 	}
 
 	return errors.New("unauthorized access to device")
-}
\ No newline at end of file
+}
+
+func (s *deviceService) AssignModel(deviceID, userID, modelName string) (*model.Device, error) {
+	if err := s.ValidateDeviceAccess(deviceID, userID); err != nil {
+		return nil, err
+	}
+
+	var deviceProfile *model.DeviceProfile
+	if modelName != "" {
+		deviceProfile = s.catalog.Find(modelName)
+		if deviceProfile == nil {
+			return nil, errors.New("unknown device model")
+		}
+	}
+
+	device, err := s.deviceRepo.FindByID(deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if device == nil {
+		return nil, errors.New("device not found")
+	}
+
+	device.Model = ""
+	if deviceProfile != nil {
+		device.Model = deviceProfile.Model
+		device.Protocol = deviceProfile.Protocol
+	}
+	if err := s.deviceRepo.Update(device); err != nil {
+		return nil, err
+	}
+
+	invalidateDeviceCache(device)
+	return device, nil
+}
+
+func (s *deviceService) SetSpeedLimit(deviceID, userID string, limit float64) (*model.Device, error) {
+	if limit < 0 || limit > maxSpeedLimit {
+		return nil, errors.New("invalid speed limit")
+	}
+	if err := s.ValidateDeviceAccess(deviceID, userID); err != nil {
+		return nil, err
+	}
+
+	device, err := s.deviceRepo.FindByID(deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if device == nil {
+		return nil, errors.New("device not found")
+	}
+
+	device.SpeedLimit = limit
+	if err := s.deviceRepo.Update(device); err != nil {
+		return nil, err
+	}
+
+	invalidateDeviceCache(device)
+	return device, nil
+}
+
+func (s *deviceService) SetPhone(deviceID, userID, phone string) (*model.Device, error) {
+	phone = model.NormalizePhone(phone)
+	if phone != "" && len(strings.TrimPrefix(phone, "+")) < minPhoneDigits {
+		return nil, errors.New("invalid phone number")
+	}
+	if err := s.ValidateDeviceAccess(deviceID, userID); err != nil {
+		return nil, err
+	}
+
+	device, err := s.deviceRepo.FindByID(deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if device == nil {
+		return nil, errors.New("device not found")
+	}
+	if phone != "" {
+		other, err := s.deviceRepo.FindByPhone(phone)
+		if err != nil {
+			return nil, err
+		}
+		if other != nil && other.ID != device.ID {
+			return nil, errors.New("phone number already assigned to another device")
+		}
+	}
+
+	device.Phone = phone
+	if err := s.deviceRepo.Update(device); err != nil {
+		return nil, err
+	}
+
+	invalidateDeviceCache(device)
+	return device, nil
+}
+
+func (s *deviceService) SetTags(deviceID, userID string, tags []string) (*model.Device, error) {
+	tags = model.NormalizeTags(tags)
+	if len(tags) > model.MaxTags {
+		return nil, fmt.Errorf("a device carries at most %d tags", model.MaxTags)
+	}
+	for _, tag := range tags {
+		if len(tag) > model.MaxTagLength {
+			return nil, fmt.Errorf("tag %q is longer than %d characters", tag, model.MaxTagLength)
+		}
+	}
+	if err := s.ValidateDeviceAccess(deviceID, userID); err != nil {
+		return nil, err
+	}
+
+	device, err := s.deviceRepo.FindByID(deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if device == nil {
+		return nil, errors.New("device not found")
+	}
+
+	device.Tags = tags
+	if err := s.deviceRepo.Update(device); err != nil {
+		return nil, err
+	}
+
+	invalidateDeviceCache(device)
+	return device, nil
+}
+
+func (s *deviceService) SetExternalIDs(deviceID, userID string, ids map[string]string) (*model.Device, error) {
+	ids = model.NormalizeExternalIDs(ids)
+	if len(ids) > model.MaxExternalIDs {
+		return nil, fmt.Errorf("a device has at most %d external IDs", model.MaxExternalIDs)
+	}
+	for system, id := range ids {
+		if !model.ValidExternalSystem(system) {
+			return nil, fmt.Errorf("invalid external system %q", system)
+		}
+		if len(id) > model.MaxExternalIDLength {
+			return nil, fmt.Errorf("external ID of %s is longer than %d characters", system, model.MaxExternalIDLength)
+		}
+	}
+	if err := s.ValidateDeviceAccess(deviceID, userID); err != nil {
+		return nil, err
+	}
+
+	device, err := s.deviceRepo.FindByID(deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if device == nil {
+		return nil, errors.New("device not found")
+	}
+	for system, id := range ids {
+		other, err := s.deviceRepo.FindByExternalID(system, id)
+		if err != nil {
+			return nil, err
+		}
+		if other != nil && other.ID != device.ID {
+			return nil, fmt.Errorf("%s %s already assigned to another device", system, id)
+		}
+	}
+
+	device.ExternalIDs = ids
+	if len(ids) == 0 {
+		device.ExternalIDs = nil
+	}
+	if err := s.deviceRepo.Update(device); err != nil {
+		return nil, err
+	}
+
+	invalidateDeviceCache(device)
+	return device, nil
+}
+
+func (s *deviceService) FindByExternalID(userID, system, id string) (*model.Device, error) {
+	system, id = strings.TrimSpace(system), strings.TrimSpace(id)
+	if !model.ValidExternalSystem(system) || id == "" {
+		return nil, ErrDeviceNotFound
+	}
+	device, err := s.deviceRepo.FindByExternalID(system, id)
+	if err != nil {
+		return nil, err
+	}
+	// A device of another user is not found, so IDs cannot be probed
+	if device == nil || s.ValidateDeviceAccess(device.ID, userID) != nil {
+		return nil, ErrDeviceNotFound
+	}
+	return device, nil
+}
+
+// StampExternalIDs leaves events that name the IDs already alone, as those
+// of a deleted device do
+func (s *deviceService) StampExternalIDs(ctx context.Context, event *model.Event) error {
+	if _, stamped := event.Attributes[model.AttributeExternalIDs]; stamped || event.DeviceID == "" {
+		return nil
+	}
+	device, err := s.deviceRepo.FindByID(event.DeviceID)
+	if err != nil || device == nil || len(device.ExternalIDs) == 0 {
+		return err
+	}
+	if event.Attributes == nil {
+		event.Attributes = make(map[string]interface{})
+	}
+	// Shared safely, as SetExternalIDs replaces the map rather than
+	// changing it
+	event.Attributes[model.AttributeExternalIDs] = device.ExternalIDs
+	return nil
+}
+
+func (s *deviceService) GetSessions(userID string) ([]*model.DeviceSession, error) {
+	if userID == "" {
+		return nil, errors.New("invalid user ID")
+	}
+	sessions := []*model.DeviceSession{}
+	if s.presence == nil {
+		return sessions, nil
+	}
+
+	access := newDeviceAccess(userID, s.orgMemberRepo)
+	for _, session := range s.presence.Sessions() {
+		device, err := access.device(s.deviceRepo, session.DeviceID)
+		if err != nil {
+			return nil, err
+		}
+		if device != nil {
+			sessions = append(sessions, session)
+		}
+	}
+	return sessions, nil
+}
+
+func (s *deviceService) WithConnectionStatus(devices []*model.Device) []*model.Device {
+	if s.presence == nil {
+		return devices
+	}
+	// Copies, as in-memory repositories hand out the devices they store
+	withStatus := make([]*model.Device, len(devices))
+	for i, device := range devices {
+		copied := *device
+		copied.Status = model.DeviceOffline
+		if s.presence.Session(device.ID) != nil {
+			copied.Status = model.DeviceOnline
+		}
+		withStatus[i] = &copied
+	}
+	return withStatus
+}
+
+// invalidateDeviceCache drops the cached device and the lists it appears in
+func invalidateDeviceCache(device *model.Device) {
+	ctx := context.Background()
+	cache.Delete(ctx, fmt.Sprintf("%s%s", deviceCacheKeyPrefix, device.ID))
+	cache.Delete(ctx, fmt.Sprintf("%s%s", deviceListCacheKeyPrefix, device.UserID))
+	if device.OrganizationID != "" {
+		cache.Delete(ctx, fmt.Sprintf("%s%s", deviceListCacheKeyPrefix, device.OrganizationID))
+	}
+}
+
+func (s *deviceService) GetDeviceModels() []*model.DeviceProfile {
+	return s.catalog.All()
+}
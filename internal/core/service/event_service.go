@@ -0,0 +1,160 @@
+package service
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+	"tracking/internal/core/model"
+	"tracking/internal/core/repository"
+)
+
+// Bounds on the events listed per page
+const (
+	DefaultEventPageSize = 100
+	MaxEventPageSize     = 1000
+)
+
+// ErrInvalidEventCursor is returned for a cursor no listing handed out
+var ErrInvalidEventCursor = errors.New("invalid event cursor")
+
+// EventQuery selects the events to list or count
+type EventQuery struct {
+	DeviceID   string             // Empty for every device the user can access
+	Devices    model.DeviceFilter // Narrows the devices when DeviceID is empty
+	Types      []string           // Empty for every type
+	Severities []string           // Empty for every severity
+	From       time.Time
+	To         time.Time
+	Cursor     string // NextCursor of the previous page
+	Limit      int    // Page size; 0 for DefaultEventPageSize
+}
+
+// EventService lists the events raised for the devices a user can access
+type EventService interface {
+	// ListEvents returns a page of matching events, newest first
+	ListEvents(userID string, query EventQuery) (*model.EventPage, error)
+	// CountEvents counts matching events by UTC day and type, for charts
+	CountEvents(userID string, query EventQuery) ([]*model.EventCount, error)
+}
+
+type eventService struct {
+	eventRepo     repository.EventRepository
+	deviceRepo    repository.DeviceRepository
+	orgMemberRepo repository.OrganizationMemberRepository
+}
+
+func NewEventService(eventRepo repository.EventRepository, deviceRepo repository.DeviceRepository, orgMemberRepo repository.OrganizationMemberRepository) EventService {
+	return &eventService{
+		eventRepo:     eventRepo,
+		deviceRepo:    deviceRepo,
+		orgMemberRepo: orgMemberRepo,
+	}
+}
+
+func (s *eventService) ListEvents(userID string, query EventQuery) (*model.EventPage, error) {
+	filter, err := s.filter(userID, query)
+	if err != nil {
+		return nil, err
+	}
+
+	var after *repository.EventCursor
+	if query.Cursor != "" {
+		if after, err = decodeEventCursor(query.Cursor); err != nil {
+			return nil, err
+		}
+	}
+	limit := query.Limit
+	if limit <= 0 {
+		limit = DefaultEventPageSize
+	}
+	limit = min(limit, MaxEventPageSize)
+
+	page := &model.EventPage{Events: []*model.Event{}}
+	if len(filter.DeviceIDs) == 0 {
+		return page, nil
+	}
+	events, err := s.eventRepo.Find(filter, after, limit+1)
+	if err != nil {
+		return nil, err
+	}
+	if len(events) > limit {
+		events = events[:limit]
+		page.NextCursor = encodeEventCursor(events[limit-1])
+	}
+	page.Events = append(page.Events, events...)
+	return page, nil
+}
+
+func (s *eventService) CountEvents(userID string, query EventQuery) ([]*model.EventCount, error) {
+	filter, err := s.filter(userID, query)
+	if err != nil {
+		return nil, err
+	}
+	if len(filter.DeviceIDs) == 0 {
+		return []*model.EventCount{}, nil
+	}
+	return s.eventRepo.CountByDay(filter)
+}
+
+// filter narrows the query to the devices the user can access
+func (s *eventService) filter(userID string, query EventQuery) (repository.EventFilter, error) {
+	filter := repository.EventFilter{
+		Types:      query.Types,
+		Severities: query.Severities,
+		From:       query.From,
+		To:         query.To,
+	}
+	if userID == "" {
+		return filter, errors.New("invalid user ID")
+	}
+
+	access := newDeviceAccess(userID, s.orgMemberRepo)
+	if query.DeviceID == "" {
+		deviceIDs, err := access.devices(s.deviceRepo, query.Devices)
+		filter.DeviceIDs = deviceIDs
+		return filter, err
+	}
+	device, err := access.device(s.deviceRepo, query.DeviceID)
+	if device != nil {
+		filter.DeviceIDs = []string{device.ID}
+	}
+	return filter, err
+}
+
+// encodeEventCursor hands out the position after the event as an opaque token
+func encodeEventCursor(event *model.Event) string {
+	return encodeCursor(event.Timestamp, event.ID)
+}
+
+func decodeEventCursor(cursor string) (*repository.EventCursor, error) {
+	timestamp, id, ok := decodeCursor(cursor)
+	if !ok {
+		return nil, ErrInvalidEventCursor
+	}
+	return &repository.EventCursor{Timestamp: timestamp, ID: id}, nil
+}
+
+// encodeCursor joins the timestamp and ID of the last item of a page into
+// an opaque token
+func encodeCursor(timestamp time.Time, id string) string {
+	raw := strconv.FormatInt(timestamp.UnixNano(), 10) + ":" + id
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(cursor string) (time.Time, string, bool) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, "", false
+	}
+	nanos, id, found := strings.Cut(string(raw), ":")
+	if !found || id == "" {
+		return time.Time{}, "", false
+	}
+	timestamp, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return time.Time{}, "", false
+	}
+	return time.Unix(0, timestamp).UTC(), id, true
+}
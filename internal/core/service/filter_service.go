@@ -0,0 +1,147 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"tracking/internal/core/model"
+	"tracking/internal/core/repository"
+	"tracking/internal/core/util"
+)
+
+// MaxSavedFilters bounds the filters a user keeps
+const MaxSavedFilters = 100
+
+// Common saved filter errors
+var (
+	ErrFilterNotFound = errors.New("filter not found")
+	ErrInvalidFilter  = errors.New("invalid filter")
+)
+
+// FilterService keeps the device filters users save, so a dispatcher can
+// come back to a named slice of a large fleet. Filters are private to the
+// user who saved them.
+type FilterService interface {
+	// CreateFilter saves a filter under a name not yet used by the user
+	CreateFilter(userID, name string, filter model.DeviceFilter) (*model.SavedFilter, error)
+	// UpdateFilter renames a filter of the user and replaces its criteria
+	UpdateFilter(id, userID, name string, filter model.DeviceFilter) (*model.SavedFilter, error)
+	// DeleteFilter removes a filter of the user
+	DeleteFilter(id, userID string) error
+	// GetFilter returns a filter of the user
+	GetFilter(id, userID string) (*model.SavedFilter, error)
+	// GetFilters returns the filters of the user, by name
+	GetFilters(userID string) ([]*model.SavedFilter, error)
+}
+
+type filterService struct {
+	filterRepo repository.SavedFilterRepository
+	clock      util.Clock
+}
+
+func NewFilterService(filterRepo repository.SavedFilterRepository, clock util.Clock) FilterService {
+	return &filterService{
+		filterRepo: filterRepo,
+		clock:      clock,
+	}
+}
+
+func (s *filterService) CreateFilter(userID, name string, filter model.DeviceFilter) (*model.SavedFilter, error) {
+	name, filter, err := s.validate(userID, "", name, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	saved := model.NewSavedFilter(userID, name, filter, s.clock.Now())
+	if err := s.filterRepo.Create(saved); err != nil {
+		return nil, err
+	}
+	return saved, nil
+}
+
+func (s *filterService) UpdateFilter(id, userID, name string, filter model.DeviceFilter) (*model.SavedFilter, error) {
+	saved, err := s.GetFilter(id, userID)
+	if err != nil {
+		return nil, err
+	}
+	name, filter, err = s.validate(userID, id, name, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	saved.Name = name
+	saved.Filter = filter
+	saved.UpdatedAt = s.clock.Now()
+	if err := s.filterRepo.Update(saved); err != nil {
+		return nil, err
+	}
+	return saved, nil
+}
+
+func (s *filterService) DeleteFilter(id, userID string) error {
+	if _, err := s.GetFilter(id, userID); err != nil {
+		return err
+	}
+	return s.filterRepo.Delete(id)
+}
+
+func (s *filterService) GetFilter(id, userID string) (*model.SavedFilter, error) {
+	if id == "" || userID == "" {
+		return nil, ErrFilterNotFound
+	}
+
+	saved, err := s.filterRepo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	// Other users' filters are reported as missing
+	if saved == nil || saved.UserID != userID {
+		return nil, ErrFilterNotFound
+	}
+	return saved, nil
+}
+
+func (s *filterService) GetFilters(userID string) ([]*model.SavedFilter, error) {
+	if userID == "" {
+		return nil, errors.New("invalid user ID")
+	}
+
+	filters, err := s.filterRepo.FindByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if filters == nil {
+		filters = []*model.SavedFilter{}
+	}
+	return filters, nil
+}
+
+// validate normalizes a filter to save and checks its name is free among
+// the user's other filters
+func (s *filterService) validate(userID, id, name string, filter model.DeviceFilter) (string, model.DeviceFilter, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", filter, fmt.Errorf("%w: name required", ErrInvalidFilter)
+	}
+	filter.Tags = model.NormalizeTags(filter.Tags)
+	filter.Status = strings.TrimSpace(filter.Status)
+	filter.Protocol = strings.TrimSpace(filter.Protocol)
+	filter.Search = strings.TrimSpace(filter.Search)
+	if filter.IsEmpty() {
+		return "", filter, fmt.Errorf("%w: no criteria", ErrInvalidFilter)
+	}
+
+	filters, err := s.GetFilters(userID)
+	if err != nil {
+		return "", filter, err
+	}
+	for _, other := range filters {
+		if other.ID != id && strings.EqualFold(other.Name, name) {
+			return "", filter, fmt.Errorf("%w: a filter named %q already exists", ErrInvalidFilter, name)
+		}
+	}
+	if id == "" && len(filters) >= MaxSavedFilters {
+		return "", filter, fmt.Errorf("%w: at most %d filters may be saved", ErrInvalidFilter, MaxSavedFilters)
+	}
+	return name, filter, nil
+}
@@ -0,0 +1,158 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sync"
+	"time"
+	"tracking/internal/core/fuel"
+	"tracking/internal/core/hook"
+	"tracking/internal/core/model"
+	"tracking/internal/core/repository"
+)
+
+// ErrInvalidFuelQuery is returned for a fuel series query out of bounds
+var ErrInvalidFuelQuery = errors.New("invalid fuel query")
+
+const (
+	// MaxFuelDays bounds the range of a fuel series query
+	MaxFuelDays = 31
+	// FuelDropWindow is how close two readings must be for a fall in level
+	// between them to be sudden rather than fuel burnt
+	FuelDropWindow = 10 * time.Minute
+	// FuelStationarySpeed is the speed in km/h under which a vehicle is
+	// taken to stand still
+	FuelStationarySpeed = 5.0
+)
+
+// FuelService keeps the fuel level series of devices from the levels
+// stamped on their positions, and raises a fuelDrop event when a level
+// falls by the threshold or more within FuelDropWindow of the reading
+// before. Everyone who can reach a device reads its series.
+type FuelService interface {
+	// GetReadings returns the fuel levels of a device in [from, to),
+	// oldest first
+	GetReadings(deviceID, userID string, from, to time.Time) ([]*model.FuelReading, error)
+	// RecordPosition is a StageStored hook adding the level of the
+	// position to the series and judging it against the latest reading.
+	// Positions older than the latest reading are added but not judged.
+	RecordPosition(ctx context.Context, position *model.Position) error
+}
+
+type fuelService struct {
+	fuelRepo      repository.FuelRepository
+	deviceRepo    repository.DeviceRepository
+	orgMemberRepo repository.OrganizationMemberRepository
+	hooks         *hook.Registry
+	threshold     float64 // Percentage points; zero raises no events
+
+	mutex  sync.Mutex
+	latest map[string]*model.FuelReading // By device ID, loaded on first use
+}
+
+func NewFuelService(fuelRepo repository.FuelRepository, deviceRepo repository.DeviceRepository, orgMemberRepo repository.OrganizationMemberRepository, hooks *hook.Registry, threshold float64) FuelService {
+	return &fuelService{
+		fuelRepo:      fuelRepo,
+		deviceRepo:    deviceRepo,
+		orgMemberRepo: orgMemberRepo,
+		hooks:         hooks,
+		threshold:     threshold,
+		latest:        make(map[string]*model.FuelReading),
+	}
+}
+
+func (s *fuelService) GetReadings(deviceID, userID string, from, to time.Time) ([]*model.FuelReading, error) {
+	if from.IsZero() || to.IsZero() || !to.After(from) {
+		return nil, fmt.Errorf("%w: from and to required, to after from", ErrInvalidFuelQuery)
+	}
+	if to.Sub(from) > MaxFuelDays*24*time.Hour {
+		return nil, fmt.Errorf("%w: at most %d days", ErrInvalidFuelQuery, MaxFuelDays)
+	}
+	if deviceID == "" || userID == "" {
+		return nil, ErrDeviceNotFound
+	}
+	device, err := newDeviceAccess(userID, s.orgMemberRepo).device(s.deviceRepo, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if device == nil {
+		return nil, ErrDeviceNotFound
+	}
+
+	readings, err := s.fuelRepo.FindByDeviceID(device.ID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	if readings == nil {
+		readings = []*model.FuelReading{}
+	}
+	return readings, nil
+}
+
+func (s *fuelService) RecordPosition(ctx context.Context, position *model.Position) error {
+	level, ok := position.Status[fuel.AttributeLevel].(float64)
+	if !ok {
+		return nil
+	}
+	reading := &model.FuelReading{
+		DeviceID:   position.DeviceID,
+		PositionID: position.ID,
+		Timestamp:  position.Timestamp,
+		Level:      level,
+	}
+
+	// Readings of a device are judged one at a time, in arrival order
+	s.mutex.Lock()
+	previous, err := s.load(position.DeviceID)
+	if err == nil {
+		err = s.fuelRepo.Create(reading)
+	}
+	newer := err == nil && (previous == nil || reading.Timestamp.After(previous.Timestamp))
+	if newer {
+		s.latest[position.DeviceID] = reading
+	}
+	s.mutex.Unlock()
+	if err != nil {
+		log.Printf("Failed to record fuel level of device %s: %v", position.DeviceID, err)
+		return nil
+	}
+
+	if !newer || previous == nil || s.threshold <= 0 {
+		return nil
+	}
+	drop := math.Round((previous.Level-level)*10) / 10
+	if drop < s.threshold || reading.Timestamp.Sub(previous.Timestamp) > FuelDropWindow {
+		return nil
+	}
+	cause := model.FuelDropTheft
+	if level <= 0 || position.Speed > FuelStationarySpeed {
+		cause = model.FuelDropSensorFault
+	}
+
+	event := model.NewEvent(model.EventFuelDrop, position.DeviceID, position.Timestamp)
+	event.PositionID = position.ID
+	event.Attributes["cause"] = cause
+	event.Attributes["previousLevel"] = previous.Level
+	event.Attributes[fuel.AttributeLevel] = level
+	event.Attributes["drop"] = drop
+	event.Attributes["since"] = previous.Timestamp
+	s.hooks.Event(event)
+	return nil
+}
+
+// load returns the latest reading of a device, reading it from the
+// repository on first use. The caller holds the mutex.
+func (s *fuelService) load(deviceID string) (*model.FuelReading, error) {
+	if latest, ok := s.latest[deviceID]; ok {
+		return latest, nil
+	}
+	latest, err := s.fuelRepo.FindLatest(deviceID)
+	if err != nil {
+		return nil, err
+	}
+	s.latest[deviceID] = latest
+	return latest, nil
+}
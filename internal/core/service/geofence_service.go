@@ -0,0 +1,327 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"tracking/internal/core/hook"
+	"tracking/internal/core/model"
+	"tracking/internal/core/repository"
+	"tracking/internal/core/util"
+)
+
+// Bounds on geofences
+const (
+	MaxGeofenceRadius = 100000 // m
+	MaxGeofencePoints = 1000
+)
+
+// AttributeGeofenceIDs lists the fences a position lies in
+const AttributeGeofenceIDs = "geofenceIds"
+
+// Common geofence errors
+var (
+	ErrGeofenceNotFound = errors.New("geofence not found")
+	ErrInvalidGeofence  = errors.New("invalid geofence")
+)
+
+// GeofenceService keeps the areas whose crossing raises geofenceEnter and
+// geofenceExit events. Fences are managed in the organization context of
+// a request, where every member reaches them, or outside any organization
+// by the user who drew them.
+type GeofenceService interface {
+	// CreateGeofence draws a fence in the organization, or a personal
+	// fence of the user when organizationID is empty
+	CreateGeofence(userID, organizationID string, geofence *model.Geofence) (*model.Geofence, error)
+	// UpdateGeofence renames and reshapes a fence
+	UpdateGeofence(id, userID, organizationID string, geofence *model.Geofence) (*model.Geofence, error)
+	DeleteGeofence(id, userID, organizationID string) error
+	GetGeofence(id, userID, organizationID string) (*model.Geofence, error)
+	// GetGeofences returns the fences of the organization, or the user's
+	// personal fences when organizationID is empty, by name
+	GetGeofences(userID, organizationID string) ([]*model.Geofence, error)
+	// LocatePosition is a StageDecoded hook listing the fences a valid fix
+	// lies in under AttributeGeofenceIDs
+	LocatePosition(ctx context.Context, position *model.Position) error
+	// CheckTransitions is a StageStored hook raising an event for every
+	// fence the device entered or left since its previous fix
+	CheckTransitions(ctx context.Context, position *model.Position) error
+}
+
+type geofenceService struct {
+	geofenceRepo repository.GeofenceRepository
+	deviceRepo   repository.DeviceRepository
+	positionRepo repository.PositionRepository
+	hooks        *hook.Registry
+	clock        util.Clock
+
+	mutex  sync.Mutex
+	inside map[string]*deviceFences // By device ID
+}
+
+// deviceFences are the fences a device was in at its latest fix
+type deviceFences struct {
+	ids []string
+	at  time.Time
+}
+
+func NewGeofenceService(geofenceRepo repository.GeofenceRepository, deviceRepo repository.DeviceRepository, positionRepo repository.PositionRepository, hooks *hook.Registry, clock util.Clock) GeofenceService {
+	return &geofenceService{
+		geofenceRepo: geofenceRepo,
+		deviceRepo:   deviceRepo,
+		positionRepo: positionRepo,
+		hooks:        hooks,
+		clock:        clock,
+		inside:       make(map[string]*deviceFences),
+	}
+}
+
+func (s *geofenceService) CreateGeofence(userID, organizationID string, geofence *model.Geofence) (*model.Geofence, error) {
+	if userID == "" {
+		return nil, errors.New("invalid user ID")
+	}
+	if err := validateGeofence(geofence); err != nil {
+		return nil, err
+	}
+
+	now := s.clock.Now()
+	created := *geofence
+	created.ID = model.GenerateID()
+	created.UserID = userID
+	created.OrganizationID = organizationID
+	created.CreatedAt = now
+	created.UpdatedAt = now
+	if err := s.geofenceRepo.Create(&created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+func (s *geofenceService) UpdateGeofence(id, userID, organizationID string, geofence *model.Geofence) (*model.Geofence, error) {
+	stored, err := s.GetGeofence(id, userID, organizationID)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateGeofence(geofence); err != nil {
+		return nil, err
+	}
+
+	updated := *geofence
+	updated.ID = stored.ID
+	updated.UserID = stored.UserID
+	updated.OrganizationID = stored.OrganizationID
+	updated.CreatedAt = stored.CreatedAt
+	updated.UpdatedAt = s.clock.Now()
+	if err := s.geofenceRepo.Update(&updated); err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+func (s *geofenceService) DeleteGeofence(id, userID, organizationID string) error {
+	if _, err := s.GetGeofence(id, userID, organizationID); err != nil {
+		return err
+	}
+	return s.geofenceRepo.Delete(id)
+}
+
+func (s *geofenceService) GetGeofence(id, userID, organizationID string) (*model.Geofence, error) {
+	if id == "" || userID == "" {
+		return nil, ErrGeofenceNotFound
+	}
+
+	geofence, err := s.geofenceRepo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	// Fences out of the request's reach are reported as missing
+	if geofence == nil || geofence.OrganizationID != organizationID ||
+		(organizationID == "" && geofence.UserID != userID) {
+		return nil, ErrGeofenceNotFound
+	}
+	return geofence, nil
+}
+
+func (s *geofenceService) GetGeofences(userID, organizationID string) ([]*model.Geofence, error) {
+	if userID == "" {
+		return nil, errors.New("invalid user ID")
+	}
+
+	var geofences []*model.Geofence
+	var err error
+	if organizationID != "" {
+		geofences, err = s.geofenceRepo.FindByOrganizationID(organizationID)
+	} else {
+		geofences, err = s.geofenceRepo.FindPersonal(userID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if geofences == nil {
+		geofences = []*model.Geofence{}
+	}
+	return geofences, nil
+}
+
+func (s *geofenceService) LocatePosition(ctx context.Context, position *model.Position) error {
+	if !position.Valid {
+		return nil
+	}
+	device, err := s.deviceRepo.FindByID(position.DeviceID)
+	if err != nil || device == nil {
+		return err
+	}
+	geofences, err := s.watching(device)
+	if err != nil {
+		return err
+	}
+
+	ids := []string{}
+	for _, geofence := range geofences {
+		if geofence.Contains(position.Latitude, position.Longitude) {
+			ids = append(ids, geofence.ID)
+		}
+	}
+	if position.Status == nil {
+		position.Status = make(map[string]interface{})
+	}
+	position.Status[AttributeGeofenceIDs] = ids
+	s.loadPrevious(device.ID)
+	return nil
+}
+
+func (s *geofenceService) CheckTransitions(ctx context.Context, position *model.Position) error {
+	ids, ok := position.Status[AttributeGeofenceIDs].([]string)
+	if !ok {
+		return nil
+	}
+
+	s.mutex.Lock()
+	previous := s.inside[position.DeviceID]
+	// Fixes uploaded late, after newer ones, change nothing
+	if previous != nil && position.Timestamp.Before(previous.at) {
+		s.mutex.Unlock()
+		return nil
+	}
+	s.inside[position.DeviceID] = &deviceFences{ids: ids, at: position.Timestamp}
+	s.mutex.Unlock()
+
+	var was []string
+	if previous != nil {
+		was = previous.ids
+	}
+	for _, id := range ids {
+		if !slices.Contains(was, id) {
+			s.raise(model.EventGeofenceEnter, id, position)
+		}
+	}
+	for _, id := range was {
+		if !slices.Contains(ids, id) {
+			s.raise(model.EventGeofenceExit, id, position)
+		}
+	}
+	return nil
+}
+
+// watching returns the fences applying to a device
+func (s *geofenceService) watching(device *model.Device) ([]*model.Geofence, error) {
+	if device.OrganizationID != "" {
+		return s.geofenceRepo.FindByOrganizationID(device.OrganizationID)
+	}
+	if device.UserID == "" {
+		return nil, nil
+	}
+	return s.geofenceRepo.FindPersonal(device.UserID)
+}
+
+// loadPrevious takes the fences a device was in from its latest stored
+// position, when the service has seen no fix of it yet
+func (s *geofenceService) loadPrevious(deviceID string) {
+	s.mutex.Lock()
+	_, known := s.inside[deviceID]
+	s.mutex.Unlock()
+	if known {
+		return
+	}
+
+	latest, err := s.positionRepo.FindLatestByDeviceID(deviceID)
+	if err != nil {
+		log.Printf("Failed to load latest position of device %s: %v", deviceID, err)
+		return
+	}
+	if latest == nil {
+		return
+	}
+	var ids []string
+	switch stored := latest.Status[AttributeGeofenceIDs].(type) {
+	case []string:
+		ids = stored
+	case []interface{}: // As decoded from storage
+		for _, id := range stored {
+			if id, ok := id.(string); ok {
+				ids = append(ids, id)
+			}
+		}
+	default:
+		return
+	}
+
+	s.mutex.Lock()
+	if _, known := s.inside[deviceID]; !known {
+		s.inside[deviceID] = &deviceFences{ids: ids, at: latest.Timestamp}
+	}
+	s.mutex.Unlock()
+}
+
+// raise sends a transition event; fences deleted meanwhile raise none
+func (s *geofenceService) raise(eventType, geofenceID string, position *model.Position) {
+	geofence, err := s.geofenceRepo.FindByID(geofenceID)
+	if err != nil || geofence == nil {
+		return
+	}
+	event := model.NewEvent(eventType, position.DeviceID, position.Timestamp)
+	event.PositionID = position.ID
+	event.Attributes["geofenceId"] = geofence.ID
+	event.Attributes["geofenceName"] = geofence.Name
+	s.hooks.Event(event)
+}
+
+// validateGeofence normalizes a fence and checks its shape
+func validateGeofence(geofence *model.Geofence) error {
+	geofence.Name = strings.TrimSpace(geofence.Name)
+	if geofence.Name == "" {
+		return fmt.Errorf("%w: name required", ErrInvalidGeofence)
+	}
+	switch geofence.Type {
+	case model.GeofenceCircle:
+		if !validCoordinates(geofence.Latitude, geofence.Longitude) {
+			return fmt.Errorf("%w: center out of range", ErrInvalidGeofence)
+		}
+		if geofence.Radius <= 0 || geofence.Radius > MaxGeofenceRadius {
+			return fmt.Errorf("%w: radius must be between 0 and %d meters", ErrInvalidGeofence, MaxGeofenceRadius)
+		}
+		geofence.Points = nil
+	case model.GeofencePolygon:
+		if len(geofence.Points) < 3 || len(geofence.Points) > MaxGeofencePoints {
+			return fmt.Errorf("%w: a polygon has 3 to %d points", ErrInvalidGeofence, MaxGeofencePoints)
+		}
+		for _, point := range geofence.Points {
+			if !validCoordinates(point.Latitude, point.Longitude) {
+				return fmt.Errorf("%w: point out of range", ErrInvalidGeofence)
+			}
+		}
+		geofence.Latitude, geofence.Longitude, geofence.Radius = 0, 0, 0
+	default:
+		return fmt.Errorf("%w: type must be %s or %s", ErrInvalidGeofence, model.GeofenceCircle, model.GeofencePolygon)
+	}
+	return nil
+}
+
+func validCoordinates(latitude, longitude float64) bool {
+	return latitude >= -90 && latitude <= 90 && longitude >= -180 && longitude <= 180
+}
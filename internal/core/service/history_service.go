@@ -0,0 +1,100 @@
+package service
+
+import (
+	"errors"
+	"time"
+	"tracking/internal/core/history"
+	"tracking/internal/core/model"
+	"tracking/internal/core/repository"
+)
+
+// ErrNoDeviceHistory is returned for a device without recorded history, or
+// one the user may not access
+var ErrNoDeviceHistory = errors.New("no history for device")
+
+// HistoryService answers questions about past device state from the
+// device event log
+type HistoryService interface {
+	// GetDeviceHistory returns the events of a device, oldest first. Deleted
+	// devices keep their history.
+	GetDeviceHistory(deviceID, userID string) ([]*model.DeviceEvent, error)
+	// GetFleetAt returns the devices the user could access as they stood at
+	// the given instant
+	GetFleetAt(userID string, at time.Time) ([]*model.FleetDevice, error)
+}
+
+type historyService struct {
+	eventRepo     repository.DeviceEventRepository
+	orgMemberRepo repository.OrganizationMemberRepository
+}
+
+func NewHistoryService(eventRepo repository.DeviceEventRepository, orgMemberRepo repository.OrganizationMemberRepository) HistoryService {
+	return &historyService{
+		eventRepo:     eventRepo,
+		orgMemberRepo: orgMemberRepo,
+	}
+}
+
+func (s *historyService) GetDeviceHistory(deviceID, userID string) ([]*model.DeviceEvent, error) {
+	if deviceID == "" || userID == "" {
+		return nil, errors.New("invalid device or user ID")
+	}
+
+	events, err := s.eventRepo.FindByDeviceID(deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if len(events) == 0 {
+		return nil, ErrNoDeviceHistory
+	}
+
+	// Access follows the latest assignment, also for deleted devices
+	allowed, err := s.canAccess(events[len(events)-1].State, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !allowed {
+		return nil, ErrNoDeviceHistory
+	}
+	return events, nil
+}
+
+func (s *historyService) GetFleetAt(userID string, at time.Time) ([]*model.FleetDevice, error) {
+	if userID == "" {
+		return nil, errors.New("invalid user ID")
+	}
+
+	fleet, err := history.FleetAt(s.eventRepo, at)
+	if err != nil {
+		return nil, err
+	}
+
+	accessible := make([]*model.FleetDevice, 0, len(fleet))
+	for _, device := range fleet {
+		allowed, err := s.canAccess(device.DeviceState, userID)
+		if err != nil {
+			return nil, err
+		}
+		if allowed {
+			accessible = append(accessible, device)
+		}
+	}
+	return accessible, nil
+}
+
+// canAccess applies the rules of DeviceService.ValidateDeviceAccess to a
+// recorded state
+func (s *historyService) canAccess(state model.DeviceState, userID string) (bool, error) {
+	if state.UserID == userID {
+		return true, nil
+	}
+	if state.OrganizationID == "" {
+		return false, nil
+	}
+
+	member, err := s.orgMemberRepo.FindByUserAndOrg(userID, state.OrganizationID)
+	if err != nil {
+		return false, err
+	}
+	return member != nil, nil
+}
@@ -0,0 +1,203 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"tracking/internal/core/hook"
+	"tracking/internal/core/model"
+	"tracking/internal/core/repository"
+)
+
+// ErrInvalidLiveFilter rejects a live filter naming both a device and an
+// organization, or neither
+var ErrInvalidLiveFilter = errors.New("invalid live filter")
+
+// LiveService pushes positions as they are stored, events as they are
+// raised and devices coming online or going offline to clients following
+// devices, so maps move without polling
+type LiveService interface {
+	// Subscribe streams the updates of the devices the filters select
+	// among those the user can access, until the subscription is canceled
+	Subscribe(userID string, filters []model.LiveFilter) (*LiveSubscription, error)
+}
+
+// LiveSubscription is a client following devices
+type LiveSubscription struct {
+	service *liveService
+	access  *deviceAccess // Remembers the user's memberships for the stream
+	filters []model.LiveFilter
+	ch      chan *model.LiveUpdate
+	once    sync.Once
+}
+
+// Updates returns the updates of the devices followed, closed once the
+// subscription is canceled
+func (s *LiveSubscription) Updates() <-chan *model.LiveUpdate {
+	return s.ch
+}
+
+// Filter replaces the filters of the subscription. On error the
+// subscription keeps its filters.
+func (s *LiveSubscription) Filter(filters []model.LiveFilter) error {
+	if err := s.service.check(s.access, filters); err != nil {
+		return err
+	}
+	s.service.mutex.Lock()
+	defer s.service.mutex.Unlock()
+	s.filters = append([]model.LiveFilter(nil), filters...)
+	return nil
+}
+
+// Cancel stops the updates and closes their channel
+func (s *LiveSubscription) Cancel() {
+	s.once.Do(func() {
+		s.service.mutex.Lock()
+		defer s.service.mutex.Unlock()
+		delete(s.service.subscribers, s)
+		close(s.ch)
+	})
+}
+
+// follows reports whether the subscription follows the device, looking it
+// up through device only when a filter needs its owners
+func (s *LiveSubscription) follows(deviceID string, device func() *model.Device) bool {
+	if len(s.filters) == 0 {
+		d := device()
+		if d == nil {
+			return false
+		}
+		allowed, err := s.access.allowed(d.UserID, d.OrganizationID)
+		return err == nil && allowed
+	}
+	for _, filter := range s.filters {
+		// The user's access to a device followed by ID was checked when
+		// following it
+		if filter.DeviceID == deviceID {
+			return true
+		}
+		if filter.OrganizationID == "" {
+			continue
+		}
+		if d := device(); d != nil && d.OrganizationID == filter.OrganizationID {
+			if allowed, err := s.access.allowed(d.UserID, d.OrganizationID); err == nil && allowed {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type liveService struct {
+	deviceRepo    repository.DeviceRepository
+	orgMemberRepo repository.OrganizationMemberRepository
+
+	mutex       sync.Mutex
+	subscribers map[*LiveSubscription]struct{}
+}
+
+// NewLiveService returns a service following the positions and events
+// passed to hooks
+func NewLiveService(deviceRepo repository.DeviceRepository, orgMemberRepo repository.OrganizationMemberRepository, hooks *hook.Registry) LiveService {
+	s := &liveService{
+		deviceRepo:    deviceRepo,
+		orgMemberRepo: orgMemberRepo,
+		subscribers:   make(map[*LiveSubscription]struct{}),
+	}
+	// Copied, as the subscribers encode them while hooks carry on
+	hooks.OnPosition(func(position *model.Position) {
+		snapshot := *position
+		s.publish(&model.LiveUpdate{Type: model.LivePosition, DeviceID: position.DeviceID, Position: &snapshot})
+	})
+	hooks.OnEvent(func(event *model.Event) {
+		snapshot := *event
+		s.publish(&model.LiveUpdate{Type: model.LiveEvent, DeviceID: event.DeviceID, Event: &snapshot})
+		switch event.Type {
+		case model.EventDeviceOnline:
+			s.publish(&model.LiveUpdate{Type: model.LiveStatus, DeviceID: event.DeviceID, Status: model.DeviceOnline})
+		case model.EventDeviceOffline:
+			s.publish(&model.LiveUpdate{Type: model.LiveStatus, DeviceID: event.DeviceID, Status: model.DeviceOffline})
+		}
+	})
+	return s
+}
+
+func (s *liveService) Subscribe(userID string, filters []model.LiveFilter) (*LiveSubscription, error) {
+	access := newDeviceAccess(userID, s.orgMemberRepo)
+	if err := s.check(access, filters); err != nil {
+		return nil, err
+	}
+
+	subscription := &LiveSubscription{
+		service: s,
+		access:  access,
+		filters: append([]model.LiveFilter(nil), filters...),
+		ch:      make(chan *model.LiveUpdate, subscriptionBuffer),
+	}
+	s.mutex.Lock()
+	s.subscribers[subscription] = struct{}{}
+	s.mutex.Unlock()
+	return subscription, nil
+}
+
+// check verifies that every filter names either a device or an
+// organization the user can access
+func (s *liveService) check(access *deviceAccess, filters []model.LiveFilter) error {
+	for _, filter := range filters {
+		if (filter.DeviceID == "") == (filter.OrganizationID == "") {
+			return ErrInvalidLiveFilter
+		}
+		if filter.DeviceID != "" {
+			device, err := access.device(s.deviceRepo, filter.DeviceID)
+			if err != nil {
+				return err
+			}
+			if device == nil {
+				return ErrDeviceNotFound
+			}
+			continue
+		}
+		// As for a device of the organization the user does not own
+		member, err := access.allowed("", filter.OrganizationID)
+		if err != nil {
+			return err
+		}
+		if !member {
+			return ErrOrganizationNotFound
+		}
+	}
+	return nil
+}
+
+// publish hands an update to every subscriber following its device,
+// skipping those too far behind
+func (s *liveService) publish(update *model.LiveUpdate) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if len(s.subscribers) == 0 || update.DeviceID == "" {
+		return
+	}
+
+	// Looked up once, as most subscribers check the device's owners
+	var device *model.Device
+	looked := false
+	lookup := func() *model.Device {
+		if !looked {
+			looked = true
+			if found, err := s.deviceRepo.FindByID(update.DeviceID); err == nil {
+				device = found
+			}
+		}
+		return device
+	}
+	for subscriber := range s.subscribers {
+		if !subscriber.follows(update.DeviceID, lookup) {
+			continue
+		}
+		select {
+		case subscriber.ch <- update:
+		default:
+			log.Printf("Dropping %s update of device %s for a slow subscriber", update.Type, update.DeviceID)
+		}
+	}
+}
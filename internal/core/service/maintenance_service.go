@@ -0,0 +1,287 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"sync"
+	"time"
+	"tracking/internal/core/hook"
+	"tracking/internal/core/model"
+	"tracking/internal/core/repository"
+	"tracking/internal/core/util"
+)
+
+// MaxMaintenances bounds the maintenances scheduled on one device
+const MaxMaintenances = 50
+
+// Common maintenance errors
+var (
+	ErrMaintenanceNotFound = errors.New("maintenance not found")
+	ErrInvalidMaintenance  = errors.New("invalid maintenance")
+)
+
+// MaintenanceService keeps the service schedules of devices and raises a
+// maintenance event as the odometer or engine hours of a device reach
+// each service. Everyone who can reach a device manages its schedules.
+type MaintenanceService interface {
+	CreateMaintenance(userID string, maintenance *model.Maintenance) (*model.Maintenance, error)
+	// UpdateMaintenance replaces the name, total and schedule of a
+	// maintenance
+	UpdateMaintenance(id, userID string, maintenance *model.Maintenance) (*model.Maintenance, error)
+	DeleteMaintenance(id, userID string) error
+	// GetMaintenances returns the maintenances of a device by name
+	GetMaintenances(deviceID, userID string) ([]*model.Maintenance, error)
+	// LoadTotals is a StageDecoded hook taking the totals a device had
+	// from its latest stored position, so services reached while the
+	// server was down are still noticed
+	LoadTotals(ctx context.Context, position *model.Position) error
+	// CheckServices is a StageStored hook raising an event for every
+	// service the totals stamped on the position reached since the
+	// previous position
+	CheckServices(ctx context.Context, position *model.Position) error
+}
+
+type maintenanceService struct {
+	maintenanceRepo repository.MaintenanceRepository
+	deviceRepo      repository.DeviceRepository
+	positionRepo    repository.PositionRepository
+	orgMemberRepo   repository.OrganizationMemberRepository
+	hooks           *hook.Registry
+	clock           util.Clock
+
+	mutex  sync.Mutex
+	totals map[string]*deviceTotals // By device ID
+}
+
+// deviceTotals are the totals stamped on the latest position of a device
+type deviceTotals struct {
+	values map[string]float64 // By total
+	at     time.Time
+}
+
+func NewMaintenanceService(maintenanceRepo repository.MaintenanceRepository, deviceRepo repository.DeviceRepository, positionRepo repository.PositionRepository, orgMemberRepo repository.OrganizationMemberRepository, hooks *hook.Registry, clock util.Clock) MaintenanceService {
+	return &maintenanceService{
+		maintenanceRepo: maintenanceRepo,
+		deviceRepo:      deviceRepo,
+		positionRepo:    positionRepo,
+		orgMemberRepo:   orgMemberRepo,
+		hooks:           hooks,
+		clock:           clock,
+		totals:          make(map[string]*deviceTotals),
+	}
+}
+
+func (s *maintenanceService) CreateMaintenance(userID string, maintenance *model.Maintenance) (*model.Maintenance, error) {
+	device, err := s.device(maintenance.DeviceID, userID)
+	if err != nil {
+		return nil, err
+	}
+	existing, err := s.maintenanceRepo.FindByDeviceID(device.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(existing) >= MaxMaintenances {
+		return nil, fmt.Errorf("%w: a device has at most %d maintenances", ErrInvalidMaintenance, MaxMaintenances)
+	}
+
+	created := *maintenance
+	if err := validateMaintenance(&created); err != nil {
+		return nil, err
+	}
+	now := s.clock.Now()
+	created.ID = model.GenerateID()
+	created.DeviceID = device.ID
+	created.UserID = userID
+	created.CreatedAt = now
+	created.UpdatedAt = now
+	if err := s.maintenanceRepo.Create(&created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+func (s *maintenanceService) UpdateMaintenance(id, userID string, maintenance *model.Maintenance) (*model.Maintenance, error) {
+	stored, err := s.reachable(id, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	updated := *maintenance
+	if err := validateMaintenance(&updated); err != nil {
+		return nil, err
+	}
+	updated.ID = stored.ID
+	updated.DeviceID = stored.DeviceID
+	updated.UserID = stored.UserID
+	updated.CreatedAt = stored.CreatedAt
+	updated.UpdatedAt = s.clock.Now()
+	if err := s.maintenanceRepo.Update(&updated); err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+func (s *maintenanceService) DeleteMaintenance(id, userID string) error {
+	if _, err := s.reachable(id, userID); err != nil {
+		return err
+	}
+	return s.maintenanceRepo.Delete(id)
+}
+
+func (s *maintenanceService) GetMaintenances(deviceID, userID string) ([]*model.Maintenance, error) {
+	device, err := s.device(deviceID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	maintenances, err := s.maintenanceRepo.FindByDeviceID(device.ID)
+	if err != nil {
+		return nil, err
+	}
+	if maintenances == nil {
+		maintenances = []*model.Maintenance{}
+	}
+	return maintenances, nil
+}
+
+func (s *maintenanceService) LoadTotals(ctx context.Context, position *model.Position) error {
+	s.mutex.Lock()
+	_, known := s.totals[position.DeviceID]
+	s.mutex.Unlock()
+	if known {
+		return nil
+	}
+
+	latest, err := s.positionRepo.FindLatestByDeviceID(position.DeviceID)
+	if err != nil {
+		log.Printf("[Maintenance] Error loading latest position of device %s: %v", position.DeviceID, err)
+		return nil
+	}
+	if latest == nil {
+		return nil
+	}
+	values := stampedTotals(latest)
+	if len(values) == 0 {
+		return nil
+	}
+
+	s.mutex.Lock()
+	if _, known := s.totals[position.DeviceID]; !known {
+		s.totals[position.DeviceID] = &deviceTotals{values: values, at: latest.Timestamp}
+	}
+	s.mutex.Unlock()
+	return nil
+}
+
+func (s *maintenanceService) CheckServices(ctx context.Context, position *model.Position) error {
+	values := stampedTotals(position)
+	if len(values) == 0 {
+		return nil
+	}
+
+	s.mutex.Lock()
+	previous := s.totals[position.DeviceID]
+	// Positions uploaded late, after newer ones, change nothing
+	if previous != nil && position.Timestamp.Before(previous.at) {
+		s.mutex.Unlock()
+		return nil
+	}
+	s.totals[position.DeviceID] = &deviceTotals{values: values, at: position.Timestamp}
+	s.mutex.Unlock()
+
+	// The first totals of a device are where its schedules start from
+	if previous == nil {
+		return nil
+	}
+	maintenances, err := s.maintenanceRepo.FindByDeviceID(position.DeviceID)
+	if err != nil {
+		log.Printf("[Maintenance] Error loading maintenances of device %s: %v", position.DeviceID, err)
+		return nil
+	}
+	for _, maintenance := range maintenances {
+		was, ok := previous.values[maintenance.Type]
+		if !ok {
+			continue
+		}
+		if due, reached := maintenance.Due(was, values[maintenance.Type]); reached {
+			event := model.NewEvent(model.EventMaintenance, position.DeviceID, position.Timestamp)
+			event.PositionID = position.ID
+			event.Attributes["maintenanceId"] = maintenance.ID
+			event.Attributes["maintenanceName"] = maintenance.Name
+			event.Attributes["maintenanceType"] = maintenance.Type
+			event.Attributes["due"] = due
+			event.Attributes["value"] = values[maintenance.Type]
+			s.hooks.Event(event)
+		}
+	}
+	return nil
+}
+
+// stampedTotals reads the totals the accumulators stamped on a position
+func stampedTotals(position *model.Position) map[string]float64 {
+	values := make(map[string]float64)
+	for _, name := range []string{model.AttributeEngineHours, model.AttributeTotalDistance} {
+		if value, ok := position.Status[name].(float64); ok {
+			values[name] = value
+		}
+	}
+	return values
+}
+
+// device returns the device when the user can reach it
+func (s *maintenanceService) device(deviceID, userID string) (*model.Device, error) {
+	if deviceID == "" || userID == "" {
+		return nil, ErrDeviceNotFound
+	}
+	device, err := newDeviceAccess(userID, s.orgMemberRepo).device(s.deviceRepo, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if device == nil {
+		return nil, ErrDeviceNotFound
+	}
+	return device, nil
+}
+
+// reachable returns a maintenance of a device the user can reach; the
+// others are reported as missing
+func (s *maintenanceService) reachable(id, userID string) (*model.Maintenance, error) {
+	if id == "" {
+		return nil, ErrMaintenanceNotFound
+	}
+	maintenance, err := s.maintenanceRepo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if maintenance == nil {
+		return nil, ErrMaintenanceNotFound
+	}
+	if _, err := s.device(maintenance.DeviceID, userID); err != nil {
+		if errors.Is(err, ErrDeviceNotFound) {
+			return nil, ErrMaintenanceNotFound
+		}
+		return nil, err
+	}
+	return maintenance, nil
+}
+
+// validateMaintenance normalizes a maintenance and checks its schedule
+func validateMaintenance(maintenance *model.Maintenance) error {
+	maintenance.Name = strings.TrimSpace(maintenance.Name)
+	if maintenance.Name == "" {
+		return fmt.Errorf("%w: name required", ErrInvalidMaintenance)
+	}
+	if maintenance.Type != model.AttributeEngineHours && maintenance.Type != model.AttributeTotalDistance {
+		return fmt.Errorf("%w: type must be %s or %s", ErrInvalidMaintenance, model.AttributeEngineHours, model.AttributeTotalDistance)
+	}
+	for _, value := range []float64{maintenance.Start, maintenance.Period} {
+		if value < 0 || math.IsNaN(value) || math.IsInf(value, 0) {
+			return fmt.Errorf("%w: start and period must be non-negative", ErrInvalidMaintenance)
+		}
+	}
+	return nil
+}
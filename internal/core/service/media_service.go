@@ -0,0 +1,264 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net/url"
+	"strings"
+	"time"
+	"tracking/internal/core/hook"
+	"tracking/internal/core/media"
+	"tracking/internal/core/model"
+	"tracking/internal/core/repository"
+	"tracking/internal/core/util"
+	"tracking/internal/protocol/jt808"
+)
+
+// MaxMediaSize bounds a single upload
+const MaxMediaSize = 16 << 20
+
+// mediaExtensions names stored content of types mime lists several
+// extensions for
+var mediaExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/tiff": ".tiff",
+	"audio/mpeg": ".mp3",
+	"video/mp4":  ".mp4",
+}
+
+// Common media errors
+var (
+	ErrInvalidMedia  = errors.New("invalid media")
+	ErrMediaNotFound = errors.New("media not found")
+)
+
+// MediaUpload describes content uploaded as a plain file, as dashcam
+// integrations do
+type MediaUpload struct {
+	ContentType string
+	Trigger     string // What made the device capture it
+	EventID     string // Event the media documents, when known
+	Channel     int
+	Data        []byte
+}
+
+type MediaService interface {
+	// UploadMedia stores a file uploaded by a device
+	UploadMedia(deviceID string, upload *MediaUpload) (*model.Media, error)
+	// UploadJT808 stores the multimedia uploads (0x0801) in a stream of
+	// JT808 frames and returns them with the 0x8800 frames acknowledging
+	// them, ready to send back to the terminal
+	UploadJT808(deviceID string, data []byte) ([]*model.Media, []byte, error)
+	// GetDeviceMedia returns the media of a device, newest first, with
+	// expiring links to the content
+	GetDeviceMedia(deviceID string) ([]*model.Media, error)
+	// GetMedia returns a media record with an expiring link to the content
+	GetMedia(id string) (*model.Media, error)
+	// OpenContent returns the content and content type a signed link
+	// grants access to
+	OpenContent(params url.Values) ([]byte, string, error)
+}
+
+type mediaService struct {
+	mediaRepo repository.MediaRepository
+	store     media.Store
+	signer    *media.URLSigner
+	baseURL   string // Where links to server-signed content point
+	linkTTL   time.Duration
+	decoder   *jt808.Decoder
+	clock     util.Clock
+	hooks     *hook.Registry
+}
+
+// NewMediaService returns a service keeping content in store. Stores that
+// can presign links serve content themselves; links to other stores point
+// to baseURL and are signed with signer.
+func NewMediaService(mediaRepo repository.MediaRepository, store media.Store, signer *media.URLSigner, baseURL string, linkTTL time.Duration, clock util.Clock, hooks *hook.Registry) MediaService {
+	decoder := jt808.NewDecoder()
+	decoder.SetClock(clock)
+	return &mediaService{
+		mediaRepo: mediaRepo,
+		store:     store,
+		signer:    signer,
+		baseURL:   strings.TrimSuffix(baseURL, "/"),
+		linkTTL:   linkTTL,
+		decoder:   decoder,
+		clock:     clock,
+		hooks:     hooks,
+	}
+}
+
+func (s *mediaService) UploadMedia(deviceID string, upload *MediaUpload) (*model.Media, error) {
+	if len(upload.Data) == 0 {
+		return nil, fmt.Errorf("%w: no content", ErrInvalidMedia)
+	}
+	if len(upload.Data) > MaxMediaSize {
+		return nil, fmt.Errorf("%w: %d bytes exceeds %d", ErrInvalidMedia, len(upload.Data), MaxMediaSize)
+	}
+	mediaType, _, err := mime.ParseMediaType(upload.ContentType)
+	if err != nil {
+		return nil, fmt.Errorf("%w: content type %q", ErrInvalidMedia, upload.ContentType)
+	}
+
+	var kind string
+	switch {
+	case strings.HasPrefix(mediaType, "image/"):
+		kind = model.MediaImage
+	case strings.HasPrefix(mediaType, "audio/"):
+		kind = model.MediaAudio
+	case strings.HasPrefix(mediaType, "video/"):
+		kind = model.MediaVideo
+	default:
+		return nil, fmt.Errorf("%w: content type %q is not an image, audio or video", ErrInvalidMedia, mediaType)
+	}
+
+	record := model.NewMedia(deviceID, kind, mediaType, s.clock.Now())
+	record.Trigger = upload.Trigger
+	record.EventID = upload.EventID
+	record.Channel = upload.Channel
+	if err := s.save(record, upload.Data); err != nil {
+		return nil, err
+	}
+	return s.withURL(record), nil
+}
+
+func (s *mediaService) UploadJT808(deviceID string, data []byte) ([]*model.Media, []byte, error) {
+	uploads, err := s.decoder.DecodeMultimedia(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidMedia, err)
+	}
+	if len(uploads) == 0 {
+		return nil, nil, fmt.Errorf("%w: no multimedia upload in stream", ErrInvalidMedia)
+	}
+
+	var stored []*model.Media
+	var responses []byte
+	for i, upload := range uploads {
+		if len(upload.Data) == 0 || len(upload.Data) > MaxMediaSize {
+			return nil, nil, fmt.Errorf("%w: media %d has %d bytes", ErrInvalidMedia, upload.MediaID, len(upload.Data))
+		}
+
+		record := model.NewMedia(deviceID, upload.Type, upload.ContentType, upload.Location.Timestamp)
+		record.CreatedAt = s.clock.Now()
+		record.Trigger = upload.Event
+		record.Channel = int(upload.Channel)
+		if upload.Location.Valid {
+			record.Latitude = upload.Location.Latitude
+			record.Longitude = upload.Location.Longitude
+		}
+		if err := s.save(record, upload.Data); err != nil {
+			return nil, nil, err
+		}
+		stored = append(stored, s.withURL(record))
+
+		response, err := jt808.MultimediaResponse(upload, false, uint16(i+1))
+		if err != nil {
+			return nil, nil, err
+		}
+		responses = append(responses, response...)
+	}
+	return stored, responses, nil
+}
+
+// save stores the content and then its record, and tells hooks about it
+func (s *mediaService) save(record *model.Media, data []byte) error {
+	extension, ok := mediaExtensions[record.ContentType]
+	if extensions, _ := mime.ExtensionsByType(record.ContentType); !ok && len(extensions) > 0 {
+		extension = extensions[0]
+	}
+	record.Key = fmt.Sprintf("devices/%s/%s%s", record.DeviceID, record.ID, extension)
+	record.Size = int64(len(data))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := s.store.Put(ctx, record.Key, record.ContentType, data); err != nil {
+		return fmt.Errorf("failed to store media content: %v", err)
+	}
+	if err := s.mediaRepo.Create(record); err != nil {
+		return err
+	}
+
+	event := model.NewEvent(model.EventMedia, record.DeviceID, record.CreatedAt)
+	event.Attributes["mediaId"] = record.ID
+	event.Attributes["type"] = record.Type
+	if record.Trigger != "" {
+		event.Attributes["trigger"] = record.Trigger
+	}
+	if record.EventID != "" {
+		event.Attributes["eventId"] = record.EventID
+	}
+	s.hooks.Event(event)
+	return nil
+}
+
+func (s *mediaService) GetDeviceMedia(deviceID string) ([]*model.Media, error) {
+	records, err := s.mediaRepo.FindByDeviceID(deviceID)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*model.Media, len(records))
+	for i, record := range records {
+		result[i] = s.withURL(record)
+	}
+	return result, nil
+}
+
+func (s *mediaService) GetMedia(id string) (*model.Media, error) {
+	record, err := s.mediaRepo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if record == nil {
+		return nil, ErrMediaNotFound
+	}
+	return s.withURL(record), nil
+}
+
+func (s *mediaService) OpenContent(params url.Values) ([]byte, string, error) {
+	id, err := s.signer.Verify(params, s.clock.Now())
+	if err != nil {
+		return nil, "", err
+	}
+	record, err := s.mediaRepo.FindByID(id)
+	if err != nil {
+		return nil, "", err
+	}
+	if record == nil {
+		return nil, "", ErrMediaNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	data, contentType, err := s.store.Get(ctx, record.Key)
+	if errors.Is(err, media.ErrNotFound) {
+		return nil, "", ErrMediaNotFound
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	if contentType == "" {
+		contentType = record.ContentType
+	}
+	return data, contentType, nil
+}
+
+// withURL returns a copy of a record linking to its content, leaving the
+// stored record untouched
+func (s *mediaService) withURL(record *model.Media) *model.Media {
+	linked := *record
+	if presigner, ok := s.store.(media.Presigner); ok {
+		link, err := presigner.PresignGet(record.Key, s.linkTTL)
+		if err != nil {
+			log.Printf("Failed to presign media %s: %v", record.ID, err)
+			return &linked
+		}
+		linked.URL = link
+		return &linked
+	}
+	params := s.signer.Sign(record.ID, s.clock.Now().Add(s.linkTTL))
+	linked.URL = s.baseURL + "/media/content?" + params.Encode()
+	return &linked
+}
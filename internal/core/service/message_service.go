@@ -0,0 +1,215 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"tracking/internal/core/hook"
+	"tracking/internal/core/model"
+	"tracking/internal/core/repository"
+	"tracking/internal/core/util"
+)
+
+// maxMessageLength bounds message text; devices may accept less
+const maxMessageLength = 1000
+
+// subscriptionBuffer is how many messages a slow subscriber may fall behind
+// before it misses some
+const subscriptionBuffer = 16
+
+// ErrInvalidMessage is returned for empty or overlong message text
+var ErrInvalidMessage = errors.New("invalid message")
+
+// TextSender shows text on the display of a connected device
+type TextSender interface {
+	SendText(deviceID, text string) error
+}
+
+type MessageService interface {
+	// SendMessage stores a message to the driver of a device and hands it to
+	// the device. A message the device could not take is stored as failed.
+	SendMessage(deviceID, userID, text string) (*model.Message, error)
+	// ReceiveMessage stores a message from the driver of a device
+	ReceiveMessage(deviceID, text string) (*model.Message, error)
+	// GetThread returns the messages of a device, oldest first
+	GetThread(deviceID string) ([]*model.Message, error)
+	// Subscribe streams the new and updated messages of a device until
+	// cancel is called
+	Subscribe(deviceID string) (messages <-chan *model.Message, cancel func())
+}
+
+type messageService struct {
+	messageRepo repository.MessageRepository
+	sender      TextSender
+	clock       util.Clock
+	statusMutex sync.Mutex // Serialises status transitions
+
+	mutex       sync.Mutex
+	subscribers map[string]map[chan *model.Message]struct{} // By device ID
+}
+
+// NewMessageService returns a service delivering messages through sender.
+// Devices confirming a text raise an EventTextDelivered on hooks, which
+// marks their oldest message in flight delivered.
+func NewMessageService(messageRepo repository.MessageRepository, sender TextSender, clock util.Clock, hooks *hook.Registry) MessageService {
+	s := &messageService{
+		messageRepo: messageRepo,
+		sender:      sender,
+		clock:       clock,
+		subscribers: make(map[string]map[chan *model.Message]struct{}),
+	}
+	hooks.OnEvent(func(event *model.Event) {
+		if event.Type == model.EventTextDelivered {
+			s.markDelivered(event.DeviceID)
+		}
+	})
+	return s
+}
+
+func validateMessageText(text string) (string, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return "", fmt.Errorf("%w: text is required", ErrInvalidMessage)
+	}
+	if n := len([]rune(text)); n > maxMessageLength {
+		return "", fmt.Errorf("%w: %d characters exceeds %d", ErrInvalidMessage, n, maxMessageLength)
+	}
+	return text, nil
+}
+
+func (s *messageService) SendMessage(deviceID, userID, text string) (*model.Message, error) {
+	text, err := validateMessageText(text)
+	if err != nil {
+		return nil, err
+	}
+
+	message := model.NewMessage(deviceID, model.MessageOutgoing, text, s.clock.Now())
+	message.UserID = userID
+	if err := s.messageRepo.Create(message); err != nil {
+		return nil, err
+	}
+	s.publish(message)
+
+	sendErr := s.sender.SendText(deviceID, text)
+	return s.transition(message.ID, func(m *model.Message) bool {
+		// The device may have confirmed the text already
+		if m.Status != model.MessagePending {
+			return false
+		}
+		if sendErr != nil {
+			m.Status = model.MessageFailed
+			m.Error = sendErr.Error()
+		} else {
+			m.Status = model.MessageSent
+		}
+		return true
+	})
+}
+
+func (s *messageService) ReceiveMessage(deviceID, text string) (*model.Message, error) {
+	text, err := validateMessageText(text)
+	if err != nil {
+		return nil, err
+	}
+
+	message := model.NewMessage(deviceID, model.MessageIncoming, text, s.clock.Now())
+	if err := s.messageRepo.Create(message); err != nil {
+		return nil, err
+	}
+	s.publish(message)
+	return message, nil
+}
+
+func (s *messageService) GetThread(deviceID string) ([]*model.Message, error) {
+	return s.messageRepo.FindByDeviceID(deviceID)
+}
+
+// markDelivered marks the oldest message in flight to a device delivered,
+// as devices confirm texts in the order they got them
+func (s *messageService) markDelivered(deviceID string) {
+	messages, err := s.messageRepo.FindByDeviceID(deviceID)
+	if err != nil {
+		log.Printf("Error loading messages of %s: %v", deviceID, err)
+		return
+	}
+	for _, message := range messages {
+		if message.Direction != model.MessageOutgoing ||
+			(message.Status != model.MessagePending && message.Status != model.MessageSent) {
+			continue
+		}
+		if _, err := s.transition(message.ID, func(m *model.Message) bool {
+			m.Status = model.MessageDelivered
+			return true
+		}); err != nil {
+			log.Printf("Error marking message %s delivered: %v", message.ID, err)
+		}
+		return
+	}
+}
+
+// transition applies change to a copy of the stored message and stores it
+// when change reports a change. Transitions are serialised so the send
+// result and the device's confirmation never overwrite each other.
+func (s *messageService) transition(id string, change func(*model.Message) bool) (*model.Message, error) {
+	s.statusMutex.Lock()
+	defer s.statusMutex.Unlock()
+
+	stored, err := s.messageRepo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if stored == nil {
+		return nil, fmt.Errorf("message %s not found", id)
+	}
+	message := *stored
+	if !change(&message) {
+		return stored, nil
+	}
+	message.UpdatedAt = s.clock.Now()
+	if err := s.messageRepo.Update(&message); err != nil {
+		return nil, err
+	}
+	s.publish(&message)
+	return &message, nil
+}
+
+func (s *messageService) Subscribe(deviceID string) (<-chan *model.Message, func()) {
+	ch := make(chan *model.Message, subscriptionBuffer)
+
+	s.mutex.Lock()
+	if s.subscribers[deviceID] == nil {
+		s.subscribers[deviceID] = make(map[chan *model.Message]struct{})
+	}
+	s.subscribers[deviceID][ch] = struct{}{}
+	s.mutex.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			s.mutex.Lock()
+			defer s.mutex.Unlock()
+			delete(s.subscribers[deviceID], ch)
+			if len(s.subscribers[deviceID]) == 0 {
+				delete(s.subscribers, deviceID)
+			}
+			close(ch)
+		})
+	}
+}
+
+// publish hands a copy of the message to every subscriber of its device,
+// skipping those too far behind
+func (s *messageService) publish(message *model.Message) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for ch := range s.subscribers[message.DeviceID] {
+		snapshot := *message
+		select {
+		case ch <- &snapshot:
+		default:
+			log.Printf("Dropping message %s update for a slow subscriber", message.ID)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"tracking/internal/core/model"
+	"tracking/internal/core/repository"
+	"tracking/internal/core/util"
+)
+
+// MaxNoteLength bounds the text of a note, in characters
+const MaxNoteLength = 2000
+
+// Common note errors
+var (
+	ErrNoteNotFound  = errors.New("note not found")
+	ErrInvalidNote   = errors.New("invalid note")
+	ErrNoteNotAuthor = errors.New("only the author can change a note")
+)
+
+// NoteService keeps the notes users attach to positions or time ranges of
+// a device's track. Everyone who can see the device reads its notes; only
+// their author changes or removes them.
+type NoteService interface {
+	// CreateNote attaches a note to the position named by PositionID, or
+	// else to the range From to To, which defaults to the instant From
+	CreateNote(userID string, note *model.Note) (*model.Note, error)
+	// UpdateNote replaces the text and range of a note
+	UpdateNote(id, userID string, note *model.Note) (*model.Note, error)
+	DeleteNote(id, userID string) error
+	// GetNotes returns the notes on a device's track, oldest range first
+	GetNotes(deviceID, userID string) ([]*model.Note, error)
+}
+
+type noteService struct {
+	noteRepo      repository.NoteRepository
+	deviceRepo    repository.DeviceRepository
+	positionRepo  repository.PositionRepository
+	orgMemberRepo repository.OrganizationMemberRepository
+	clock         util.Clock
+}
+
+func NewNoteService(noteRepo repository.NoteRepository, deviceRepo repository.DeviceRepository, positionRepo repository.PositionRepository, orgMemberRepo repository.OrganizationMemberRepository, clock util.Clock) NoteService {
+	return &noteService{
+		noteRepo:      noteRepo,
+		deviceRepo:    deviceRepo,
+		positionRepo:  positionRepo,
+		orgMemberRepo: orgMemberRepo,
+		clock:         clock,
+	}
+}
+
+func (s *noteService) CreateNote(userID string, note *model.Note) (*model.Note, error) {
+	if userID == "" {
+		return nil, errors.New("invalid user ID")
+	}
+	device, err := newDeviceAccess(userID, s.orgMemberRepo).device(s.deviceRepo, note.DeviceID)
+	if err != nil {
+		return nil, err
+	}
+	if device == nil {
+		return nil, ErrDeviceNotFound
+	}
+
+	created := *note
+	if err := s.validate(&created); err != nil {
+		return nil, err
+	}
+	now := s.clock.Now()
+	created.ID = model.GenerateID()
+	created.UserID = userID
+	created.CreatedAt = now
+	created.UpdatedAt = now
+	if err := s.noteRepo.Create(&created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+func (s *noteService) UpdateNote(id, userID string, note *model.Note) (*model.Note, error) {
+	stored, err := s.authored(id, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	updated := *note
+	updated.ID = stored.ID
+	updated.DeviceID = stored.DeviceID
+	updated.UserID = stored.UserID
+	updated.CreatedAt = stored.CreatedAt
+	if err := s.validate(&updated); err != nil {
+		return nil, err
+	}
+	updated.UpdatedAt = s.clock.Now()
+	if err := s.noteRepo.Update(&updated); err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+func (s *noteService) DeleteNote(id, userID string) error {
+	if _, err := s.authored(id, userID); err != nil {
+		return err
+	}
+	return s.noteRepo.Delete(id)
+}
+
+func (s *noteService) GetNotes(deviceID, userID string) ([]*model.Note, error) {
+	device, err := newDeviceAccess(userID, s.orgMemberRepo).device(s.deviceRepo, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if device == nil {
+		return nil, ErrDeviceNotFound
+	}
+
+	notes, err := s.noteRepo.FindByDeviceID(device.ID)
+	if err != nil {
+		return nil, err
+	}
+	if notes == nil {
+		notes = []*model.Note{}
+	}
+	return notes, nil
+}
+
+// authored returns a note the user wrote on a device they still reach.
+// Notes on devices out of reach are reported as missing.
+func (s *noteService) authored(id, userID string) (*model.Note, error) {
+	if id == "" || userID == "" {
+		return nil, ErrNoteNotFound
+	}
+	note, err := s.noteRepo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if note == nil {
+		return nil, ErrNoteNotFound
+	}
+	device, err := newDeviceAccess(userID, s.orgMemberRepo).device(s.deviceRepo, note.DeviceID)
+	if err != nil {
+		return nil, err
+	}
+	if device == nil {
+		return nil, ErrNoteNotFound
+	}
+	if note.UserID != userID {
+		return nil, ErrNoteNotAuthor
+	}
+	return note, nil
+}
+
+// validate normalizes a note and pins a position note to the position's
+// time, so it also shows in range lookups
+func (s *noteService) validate(note *model.Note) error {
+	note.Text = strings.TrimSpace(note.Text)
+	if note.Text == "" {
+		return fmt.Errorf("%w: text required", ErrInvalidNote)
+	}
+	if len([]rune(note.Text)) > MaxNoteLength {
+		return fmt.Errorf("%w: text longer than %d characters", ErrInvalidNote, MaxNoteLength)
+	}
+
+	if note.PositionID != "" {
+		position, err := s.positionRepo.FindByID(note.PositionID)
+		if err != nil {
+			return err
+		}
+		if position == nil || position.DeviceID != note.DeviceID {
+			return fmt.Errorf("%w: position not found on the device", ErrInvalidNote)
+		}
+		note.From, note.To = position.Timestamp, position.Timestamp
+		return nil
+	}
+
+	if note.From.IsZero() {
+		return fmt.Errorf("%w: position or time range required", ErrInvalidNote)
+	}
+	if note.To.IsZero() {
+		note.To = note.From
+	}
+	if note.To.Before(note.From) {
+		return fmt.Errorf("%w: range ends before it starts", ErrInvalidNote)
+	}
+	return nil
+}
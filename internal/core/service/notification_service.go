@@ -0,0 +1,134 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"slices"
+	"strings"
+	"tracking/internal/core/model"
+	"tracking/internal/core/repository"
+	"tracking/internal/core/util"
+)
+
+// ErrInvalidPreferences rejects unknown notifications and malformed
+// addresses
+var ErrInvalidPreferences = errors.New("invalid notification preferences")
+
+// NotificationService keeps the notifications users choose to receive by
+// email and finds who receives each
+type NotificationService interface {
+	// GetPreferences returns the user's preferences; a user who chose
+	// none receives no notifications
+	GetPreferences(userID string) (*model.NotificationPreferences, error)
+	SetPreferences(userID string, preferences *model.NotificationPreferences) (*model.NotificationPreferences, error)
+	// Recipients returns the device an event is about and the addresses
+	// of the users reaching it who chose the notification
+	Recipients(event *model.Event, notification string) (*model.Device, []string, error)
+}
+
+type notificationService struct {
+	notificationRepo repository.NotificationRepository
+	userRepo         repository.UserRepository
+	deviceRepo       repository.DeviceRepository
+	orgMemberRepo    repository.OrganizationMemberRepository
+	clock            util.Clock
+}
+
+func NewNotificationService(notificationRepo repository.NotificationRepository, userRepo repository.UserRepository, deviceRepo repository.DeviceRepository, orgMemberRepo repository.OrganizationMemberRepository, clock util.Clock) NotificationService {
+	return &notificationService{
+		notificationRepo: notificationRepo,
+		userRepo:         userRepo,
+		deviceRepo:       deviceRepo,
+		orgMemberRepo:    orgMemberRepo,
+		clock:            clock,
+	}
+}
+
+func (s *notificationService) GetPreferences(userID string) (*model.NotificationPreferences, error) {
+	if userID == "" {
+		return nil, errors.New("invalid user ID")
+	}
+	preferences, err := s.notificationRepo.Find(userID)
+	if err != nil {
+		return nil, err
+	}
+	if preferences == nil {
+		preferences = &model.NotificationPreferences{UserID: userID, Notifications: []string{}}
+	}
+	return preferences, nil
+}
+
+func (s *notificationService) SetPreferences(userID string, preferences *model.NotificationPreferences) (*model.NotificationPreferences, error) {
+	if userID == "" {
+		return nil, errors.New("invalid user ID")
+	}
+
+	updated := &model.NotificationPreferences{
+		UserID:        userID,
+		Email:         strings.TrimSpace(preferences.Email),
+		Notifications: []string{},
+		UpdatedAt:     s.clock.Now(),
+	}
+	if updated.Email != "" {
+		address, err := mail.ParseAddress(updated.Email)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidPreferences, err)
+		}
+		updated.Email = address.Address
+	}
+	for _, notification := range preferences.Notifications {
+		if !slices.Contains(model.Notifications, notification) {
+			return nil, fmt.Errorf("%w: unknown notification %q", ErrInvalidPreferences, notification)
+		}
+		if !slices.Contains(updated.Notifications, notification) {
+			updated.Notifications = append(updated.Notifications, notification)
+		}
+	}
+
+	if err := s.notificationRepo.Save(updated); err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+func (s *notificationService) Recipients(event *model.Event, notification string) (*model.Device, []string, error) {
+	device, err := s.deviceRepo.FindByID(event.DeviceID)
+	if err != nil || device == nil {
+		return nil, nil, err
+	}
+
+	userIDs, err := deviceUsers(device, s.orgMemberRepo)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var addresses []string
+	for _, userID := range userIDs {
+		address, err := s.address(userID, notification)
+		if err != nil {
+			return nil, nil, err
+		}
+		if address != "" && !slices.Contains(addresses, address) {
+			addresses = append(addresses, address)
+		}
+	}
+	return device, addresses, nil
+}
+
+// address returns where the user receives the notification, or empty
+// when the user did not choose it or has no address
+func (s *notificationService) address(userID, notification string) (string, error) {
+	preferences, err := s.notificationRepo.Find(userID)
+	if err != nil || preferences == nil || !slices.Contains(preferences.Notifications, notification) {
+		return "", err
+	}
+	if preferences.Email != "" {
+		return preferences.Email, nil
+	}
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil || user == nil {
+		return "", err
+	}
+	return user.Email, nil
+}
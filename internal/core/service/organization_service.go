@@ -0,0 +1,229 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"tracking/internal/core/hierarchy"
+	"tracking/internal/core/model"
+	"tracking/internal/core/repository"
+	"tracking/internal/core/util"
+)
+
+// Common organization errors
+var (
+	ErrOrganizationNotFound = errors.New("organization not found")
+	ErrInvalidOrganization  = errors.New("invalid organization")
+)
+
+// OrganizationService answers which organizations a user belongs to.
+// Authorization consults these memberships, so a user may work in several
+// organizations and switch between them. Organizations form a hierarchy,
+// members of a parent reaching the organizations below it.
+type OrganizationService interface {
+	// GetMemberships returns the organizations of a user with their role in
+	// each, oldest membership first
+	GetMemberships(userID string) ([]*model.Membership, error)
+	// GetMembership returns the user's membership of an organization, or
+	// nil when they do not belong to it
+	GetMembership(userID, orgID string) (*model.OrganizationMember, error)
+	// CreateOrganization adds an organization, below the parent when one is
+	// given. Its features must be among those the parent allows.
+	CreateOrganization(name, description, parentID string, features []string) (*model.Organization, error)
+	// GetChildren returns the organizations directly below one
+	GetChildren(orgID string) ([]*model.Organization, error)
+	// GetSubtree returns the IDs of an organization and of every
+	// organization below it
+	GetSubtree(orgID string) ([]string, error)
+	// GetFeatures returns the features an organization may use
+	GetFeatures(orgID string) ([]string, error)
+	// GetRollup counts the devices of an organization and those below it
+	GetRollup(orgID string) (*model.OrganizationRollup, error)
+}
+
+type organizationService struct {
+	orgRepo       repository.OrganizationRepository
+	orgMemberRepo repository.OrganizationMemberRepository
+	deviceRepo    repository.DeviceRepository
+	clock         util.Clock
+}
+
+func NewOrganizationService(orgRepo repository.OrganizationRepository, orgMemberRepo repository.OrganizationMemberRepository, deviceRepo repository.DeviceRepository, clock util.Clock) OrganizationService {
+	return &organizationService{
+		orgRepo:       orgRepo,
+		orgMemberRepo: orgMemberRepo,
+		deviceRepo:    deviceRepo,
+		clock:         clock,
+	}
+}
+
+func (s *organizationService) GetMemberships(userID string) ([]*model.Membership, error) {
+	if userID == "" {
+		return nil, errors.New("invalid user ID")
+	}
+
+	members, err := s.orgMemberRepo.FindByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if !members[i].CreatedAt.Equal(members[j].CreatedAt) {
+			return members[i].CreatedAt.Before(members[j].CreatedAt)
+		}
+		return members[i].OrganizationID < members[j].OrganizationID
+	})
+
+	memberships := []*model.Membership{}
+	for _, member := range members {
+		org, err := s.orgRepo.FindByID(member.OrganizationID)
+		if err != nil {
+			return nil, err
+		}
+		// Memberships outliving their organization are left out
+		if org == nil {
+			continue
+		}
+		memberships = append(memberships, &model.Membership{Organization: org, Role: member.Role})
+	}
+	return memberships, nil
+}
+
+func (s *organizationService) GetMembership(userID, orgID string) (*model.OrganizationMember, error) {
+	if userID == "" || orgID == "" {
+		return nil, nil
+	}
+	return s.orgMemberRepo.FindByUserAndOrg(userID, orgID)
+}
+
+func (s *organizationService) CreateOrganization(name, description, parentID string, features []string) (*model.Organization, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, fmt.Errorf("%w: name required", ErrInvalidOrganization)
+	}
+
+	allowed := model.AllFeatures
+	if parentID != "" {
+		chain, err := hierarchy.Chain(s.orgRepo, parentID)
+		if err != nil {
+			return nil, err
+		}
+		if len(chain) == 0 {
+			return nil, ErrOrganizationNotFound
+		}
+		if len(chain) > hierarchy.MaxDepth {
+			return nil, fmt.Errorf("%w: organizations nest at most %d levels deep", ErrInvalidOrganization, hierarchy.MaxDepth)
+		}
+		allowed = hierarchy.Features(chain)
+	}
+	for _, feature := range features {
+		if !slices.Contains(allowed, feature) {
+			return nil, fmt.Errorf("%w: feature %q is not allowed", ErrInvalidOrganization, feature)
+		}
+	}
+
+	now := s.clock.Now()
+	org := model.NewOrganization(name, strings.TrimSpace(description))
+	org.ParentID = parentID
+	org.Features = features
+	org.CreatedAt = now
+	org.UpdatedAt = now
+	if err := s.orgRepo.Create(org); err != nil {
+		return nil, err
+	}
+	return org, nil
+}
+
+func (s *organizationService) GetChildren(orgID string) ([]*model.Organization, error) {
+	children, err := s.children()
+	if err != nil {
+		return nil, err
+	}
+	return append([]*model.Organization{}, children[orgID]...), nil
+}
+
+func (s *organizationService) GetSubtree(orgID string) ([]string, error) {
+	children, err := s.children()
+	if err != nil {
+		return nil, err
+	}
+
+	ids := []string{orgID}
+	for i := 0; i < len(ids); i++ {
+		for _, child := range children[ids[i]] {
+			ids = append(ids, child.ID)
+		}
+	}
+	return ids, nil
+}
+
+func (s *organizationService) GetFeatures(orgID string) ([]string, error) {
+	chain, err := hierarchy.Chain(s.orgRepo, orgID)
+	if err != nil {
+		return nil, err
+	}
+	if len(chain) == 0 {
+		return nil, ErrOrganizationNotFound
+	}
+	return hierarchy.Features(chain), nil
+}
+
+func (s *organizationService) GetRollup(orgID string) (*model.OrganizationRollup, error) {
+	org, err := s.orgRepo.FindByID(orgID)
+	if err != nil {
+		return nil, err
+	}
+	if org == nil {
+		return nil, ErrOrganizationNotFound
+	}
+	children, err := s.children()
+	if err != nil {
+		return nil, err
+	}
+	devices, err := s.deviceRepo.FindAll()
+	if err != nil {
+		return nil, err
+	}
+
+	var rollup func(org *model.Organization, depth int) *model.OrganizationRollup
+	rollup = func(org *model.Organization, depth int) *model.OrganizationRollup {
+		r := &model.OrganizationRollup{Organization: org, Children: []*model.OrganizationRollup{}}
+		for _, device := range devices {
+			if device.OrganizationID == org.ID {
+				r.Devices++
+				if device.Status == "active" {
+					r.ActiveDevices++
+				}
+			}
+		}
+		r.TotalDevices, r.TotalActiveDevices = r.Devices, r.ActiveDevices
+		if depth < hierarchy.MaxDepth {
+			for _, child := range children[org.ID] {
+				c := rollup(child, depth+1)
+				r.TotalDevices += c.TotalDevices
+				r.TotalActiveDevices += c.TotalActiveDevices
+				r.Children = append(r.Children, c)
+			}
+		}
+		return r
+	}
+	return rollup(org, 0), nil
+}
+
+// children maps every organization to those directly below it, by name
+func (s *organizationService) children() (map[string][]*model.Organization, error) {
+	orgs, err := s.orgRepo.FindAll()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(orgs, func(i, j int) bool { return orgs[i].Name < orgs[j].Name })
+
+	children := make(map[string][]*model.Organization)
+	for _, org := range orgs {
+		if org.ParentID != "" && org.ParentID != org.ID {
+			children[org.ParentID] = append(children[org.ParentID], org)
+		}
+	}
+	return children, nil
+}
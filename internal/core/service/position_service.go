@@ -1,45 +1,118 @@
 package service
 
 import (
-	"bytes"
+	"context"
+	"crypto/subtle"
 	"errors"
+	"fmt"
+	"net/url"
 	"os"
 	"strings"
+	"time"
+	"tracking/internal/core/dedup"
+	"tracking/internal/core/hook"
 	"tracking/internal/core/model"
 	"tracking/internal/core/repository"
-	"tracking/internal/protocol/gt06"
-	"tracking/internal/protocol/h02"
-	"tracking/internal/protocol/teltonika"
+	"tracking/internal/core/sanity"
+	"tracking/internal/core/util"
+	"tracking/internal/protocol/osmand"
+	"tracking/internal/protocol/owntracks"
+	"tracking/internal/protocol/sms"
 )
 
+// ErrInvalidDeviceCredentials is returned when a device's ID and key do not match
+var ErrInvalidDeviceCredentials = errors.New("invalid device credentials")
+
+// ErrUnknownSender is returned for an SMS from a number no device has
+var ErrUnknownSender = errors.New("unknown SMS sender")
+
+// ErrInvalidPositionCursor is returned for a cursor no listing handed out
+var ErrInvalidPositionCursor = errors.New("invalid position cursor")
+
+// Bounds on the positions listed per page
+const (
+	DefaultPositionPageSize = 1000
+	MaxPositionPageSize     = 10000
+)
+
+// PositionQuery selects a page of the positions of a device
+type PositionQuery struct {
+	From   time.Time // Inclusive; zero from the first position
+	To     time.Time // Exclusive; zero up to the latest
+	Cursor string    // Next cursor of the previous page
+	Limit  int       // Page size; 0 for DefaultPositionPageSize
+}
+
+// FrameIngester decodes the frames devices send and stores their
+// positions; the TCP server is one
+type FrameIngester interface {
+	// IngestFrames handles frames the device relayed by other means than
+	// its connection and returns the positions stored
+	IngestFrames(device *model.Device, data []byte) ([]*model.Position, error)
+}
+
 type PositionService interface {
 	AddPosition(deviceID string, latitude, longitude float64, userID string) (*model.Position, error)
-	GetDevicePositions(deviceID string, userID string) ([]*model.Position, error)
+	// GetDevicePositions returns a page of the positions of a device,
+	// oldest first, and the cursor of the next page, empty on the last
+	GetDevicePositions(deviceID string, userID string, query PositionQuery) ([]*model.Position, string, error)
 	GetLatestPosition(deviceID string, userID string) (*model.Position, error)
-	ProcessRawData(deviceID string, data []byte, userID string) (*model.Position, error)
+	// ProcessRawData handles frames as the device's connection would and
+	// returns the positions stored, oldest first as sent
+	ProcessRawData(deviceID string, data []byte, userID string) ([]*model.Position, error)
+	// ProcessOsmAnd stores an OsmAnd report; the device authenticates with
+	// its unique ID and API key passed as the id and key parameters
+	ProcessOsmAnd(params url.Values) (*model.Position, error)
+	// ProcessOsmAndJSON stores a report posted as JSON by Traccar Client,
+	// which names the device in the body; the key is still a parameter
+	ProcessOsmAndJSON(params url.Values, body []byte) (*model.Position, error)
+	// ProcessOwnTracks stores an OwnTracks payload posted over HTTP by the
+	// device with the given unique ID and API key. Payloads other than
+	// locations are accepted and return no position.
+	ProcessOwnTracks(uniqueID, key string, body []byte) (*model.Position, error)
+	// ProcessOwnTracksMessage stores an OwnTracks payload received from the
+	// MQTT broker, which has authenticated the device; the topic names it
+	ProcessOwnTracksMessage(topic string, payload []byte) (*model.Position, error)
+	// ProcessSMS stores the position in a text message sent by the device
+	// whose SIM has the sender's number. Messages without a position are
+	// accepted and return no position.
+	ProcessSMS(from, text string) (*model.Position, error)
 }
 
 type positionService struct {
 	positionRepo     repository.PositionRepository
 	deviceRepo       repository.DeviceRepository
 	orgMemberRepo    repository.OrganizationMemberRepository
-	teltonikaDecoder *teltonika.Decoder
-	gt06Decoder      *gt06.Decoder
-	h02Decoder       *h02.Decoder
+	frames           FrameIngester
+	osmandDecoder    *osmand.Decoder
+	ownTracksDecoder *owntracks.Decoder
+	smsDecoder       *sms.Decoder
+	clock            util.Clock
+	hooks            *hook.Registry
 	testMode         bool
 }
 
-func NewPositionService(positionRepo repository.PositionRepository, deviceRepo repository.DeviceRepository, orgMemberRepo repository.OrganizationMemberRepository) PositionService {
+func NewPositionService(positionRepo repository.PositionRepository, deviceRepo repository.DeviceRepository, orgMemberRepo repository.OrganizationMemberRepository, frames FrameIngester, clock util.Clock, hooks *hook.Registry) PositionService {
 	// Check if test mode is enabled via environment variable
 	testMode := strings.ToLower(os.Getenv("TEST_MODE")) == "true"
 
+	osmandDecoder := osmand.NewDecoder()
+	osmandDecoder.SetClock(clock)
+	ownTracksDecoder := owntracks.NewDecoder()
+	ownTracksDecoder.SetClock(clock)
+	smsDecoder := sms.NewDecoder()
+	smsDecoder.SetClock(clock)
+
 	return &positionService{
 		positionRepo:     positionRepo,
 		deviceRepo:       deviceRepo,
 		orgMemberRepo:    orgMemberRepo,
-		teltonikaDecoder: teltonika.NewDecoder(),
-		gt06Decoder:      gt06.NewDecoder(),
-		h02Decoder:       h02.NewDecoder(),
+		frames:           frames,
+		osmandDecoder:    osmandDecoder,
+		ownTracksDecoder: ownTracksDecoder,
+		smsDecoder:       smsDecoder,
+		clock:            clock,
+		hooks:            hooks,
 		testMode:         testMode,
 	}
 }
@@ -99,80 +172,217 @@ func (s *positionService) validateDeviceAccess(deviceID, userID string) (*model.
 }
 
 func (s *positionService) AddPosition(deviceID string, latitude, longitude float64, userID string) (*model.Position, error) {
-	_, err := s.validateDeviceAccess(deviceID, userID)
+	device, err := s.validateDeviceAccess(deviceID, userID)
 	if err != nil {
 		return nil, err
 	}
 
-	position := model.NewPosition(deviceID, latitude, longitude)
-	err = s.positionRepo.Create(position)
+	position := model.NewPosition(device.ID, latitude, longitude)
+	position.Timestamp = s.clock.Now()
+	err = s.storePosition(hook.SourceHTTP, position)
 	if err != nil {
 		return nil, err
 	}
 	return position, nil
 }
 
-func (s *positionService) GetDevicePositions(deviceID string, userID string) ([]*model.Position, error) {
-	_, err := s.validateDeviceAccess(deviceID, userID)
+func (s *positionService) GetDevicePositions(deviceID string, userID string, query PositionQuery) ([]*model.Position, string, error) {
+	device, err := s.validateDeviceAccess(deviceID, userID)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
-	return s.positionRepo.FindByDeviceID(deviceID)
+
+	var after *repository.PositionCursor
+	if query.Cursor != "" {
+		timestamp, id, ok := decodeCursor(query.Cursor)
+		if !ok {
+			return nil, "", ErrInvalidPositionCursor
+		}
+		after = &repository.PositionCursor{Timestamp: timestamp, ID: id}
+	}
+	limit := query.Limit
+	if limit <= 0 {
+		limit = DefaultPositionPageSize
+	}
+	limit = min(limit, MaxPositionPageSize)
+
+	positionRange := repository.PositionRange{DeviceID: device.ID, From: query.From, To: query.To}
+	positions, err := s.positionRepo.FindInRange(positionRange, after, limit+1)
+	if err != nil {
+		return nil, "", err
+	}
+	next := ""
+	if len(positions) > limit {
+		positions = positions[:limit]
+		next = encodeCursor(positions[limit-1].Timestamp, positions[limit-1].ID)
+	}
+	if positions == nil {
+		positions = []*model.Position{}
+	}
+	return positions, next, nil
 }
 
 func (s *positionService) GetLatestPosition(deviceID string, userID string) (*model.Position, error) {
-	_, err := s.validateDeviceAccess(deviceID, userID)
+	device, err := s.validateDeviceAccess(deviceID, userID)
 	if err != nil {
 		return nil, err
 	}
-	return s.positionRepo.FindLatestByDeviceID(deviceID)
+	return s.positionRepo.FindLatestByDeviceID(device.ID)
 }
 
-func (s *positionService) ProcessRawData(deviceID string, data []byte, userID string) (*model.Position, error) {
+func (s *positionService) ProcessRawData(deviceID string, data []byte, userID string) ([]*model.Position, error) {
 	device, err := s.validateDeviceAccess(deviceID, userID)
 	if err != nil {
 		return nil, err
 	}
 
-	var position *model.Position
+	// Decoded and stored as the device's connection would, so frames
+	// without a fix and rejected positions are handled alike
+	positions, err := s.frames.IngestFrames(device, data)
+	if err != nil {
+		return nil, err
+	}
+	if positions == nil {
+		positions = []*model.Position{}
+	}
+	return positions, nil
+}
 
-	// Detect protocol and use appropriate decoder
-	if bytes.HasPrefix(data, []byte{0x78, 0x78}) {
-		// GT06 protocol
-		decodedData, err := s.gt06Decoder.Decode(data)
-		if err != nil {
-			return nil, err
-		}
-		position = s.gt06Decoder.ToPosition(deviceID, decodedData)
-	} else if bytes.HasPrefix(data, []byte("*HQ")) {
-		// H02 protocol
-		decodedData, err := s.h02Decoder.Decode(data)
-		if err != nil {
-			return nil, err
-		}
-		position = s.h02Decoder.ToPosition(deviceID, decodedData)
-	} else {
-		// Default to Teltonika protocol
-		decodedData, err := s.teltonikaDecoder.Decode(data)
-		if err != nil {
-			return nil, err
-		}
-		position = s.teltonikaDecoder.ToPosition(deviceID, decodedData)
+func (s *positionService) ProcessOsmAnd(params url.Values) (*model.Position, error) {
+	data, err := s.osmandDecoder.Decode(params)
+	if err != nil {
+		return nil, err
 	}
+	return s.storeOsmAnd(data, params.Get("key"))
+}
 
-	err = s.positionRepo.Create(position)
+func (s *positionService) ProcessOsmAndJSON(params url.Values, body []byte) (*model.Position, error) {
+	data, err := s.osmandDecoder.DecodeJSON(body)
 	if err != nil {
 		return nil, err
 	}
+	return s.storeOsmAnd(data, params.Get("key"))
+}
 
-	// Update device's last position and status
-	device.PositionID = position.ID
-	device.LastUpdate = position.Timestamp
-	device.Status = "active"
-	err = s.deviceRepo.Update(device)
+// storeOsmAnd stores a report from a phone once its unique ID and key match
+func (s *positionService) storeOsmAnd(data *osmand.OsmAndData, key string) (*model.Position, error) {
+	device, err := s.deviceRepo.FindByUniqueID(data.DeviceID)
 	if err != nil {
 		return nil, err
 	}
+	if device == nil || key == "" || subtle.ConstantTimeCompare([]byte(device.ApiKey), []byte(key)) != 1 {
+		return nil, ErrInvalidDeviceCredentials
+	}
+	return s.storePhonePosition(hook.SourceHTTP, device, s.osmandDecoder.ToPosition(device.ID, data))
+}
 
+func (s *positionService) ProcessOwnTracks(uniqueID, key string, body []byte) (*model.Position, error) {
+	device, err := s.deviceRepo.FindByUniqueID(uniqueID)
+	if err != nil {
+		return nil, err
+	}
+	if device == nil || key == "" || subtle.ConstantTimeCompare([]byte(device.ApiKey), []byte(key)) != 1 {
+		return nil, ErrInvalidDeviceCredentials
+	}
+	return s.storeOwnTracks(device, body)
+}
+
+func (s *positionService) ProcessOwnTracksMessage(topic string, payload []byte) (*model.Position, error) {
+	uniqueID, err := owntracks.DeviceFromTopic(topic)
+	if err != nil {
+		return nil, err
+	}
+	device, err := s.deviceRepo.FindByUniqueID(uniqueID)
+	if err != nil {
+		return nil, err
+	}
+	if device == nil {
+		return nil, fmt.Errorf("unknown OwnTracks device %q", uniqueID)
+	}
+	return s.storeOwnTracks(device, payload)
+}
+
+// storeOwnTracks stores the location in an OwnTracks payload
+func (s *positionService) storeOwnTracks(device *model.Device, payload []byte) (*model.Position, error) {
+	data, err := s.ownTracksDecoder.Decode(payload)
+	if err != nil {
+		return nil, err
+	}
+	if !data.HasFix() {
+		return nil, nil
+	}
+	return s.storePhonePosition(hook.SourceHTTP, device, s.ownTracksDecoder.ToPosition(device.ID, data))
+}
+
+func (s *positionService) ProcessSMS(from, text string) (*model.Position, error) {
+	phone := model.NormalizePhone(from)
+	if phone == "" {
+		return nil, ErrUnknownSender
+	}
+	device, err := s.deviceRepo.FindByPhone(phone)
+	if err != nil {
+		return nil, err
+	}
+	if device == nil {
+		return nil, fmt.Errorf("%w %s", ErrUnknownSender, phone)
+	}
+
+	data, err := s.smsDecoder.Decode(text)
+	if err != nil {
+		return nil, err
+	}
+	if !data.HasFix() {
+		return nil, nil
+	}
+	return s.storePhonePosition(hook.SourceSMS, device, s.smsDecoder.ToPosition(device.ID, data))
+}
+
+// storePhonePosition stores a position from a phone app or an SMS. Both
+// may arrive late, so it may be older than the latest.
+func (s *positionService) storePhonePosition(source string, device *model.Device, position *model.Position) (*model.Position, error) {
+	previous, err := s.positionRepo.FindLatestByDeviceID(device.ID)
+	if err != nil {
+		return nil, err
+	}
+	err = s.storePosition(source, position)
+	// Apps resend reports whose answer they missed, and would resend an
+	// implausible fix if told it failed; nothing more is stored
+	if errors.Is(err, dedup.ErrDuplicate) || errors.Is(err, sanity.ErrImplausible) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := s.updateLatestPosition(device, position, previous); err != nil {
+		return nil, err
+	}
 	return position, nil
-}
\ No newline at end of file
+}
+
+// updateLatestPosition marks the device active and points it at newest,
+// unless the position it had before is more recent
+func (s *positionService) updateLatestPosition(device *model.Device, newest, previous *model.Position) error {
+	if previous == nil || !previous.Timestamp.After(newest.Timestamp) {
+		device.PositionID = newest.ID
+		device.LastUpdate = newest.Timestamp
+	}
+	device.Status = "active"
+	return s.deviceRepo.Update(device)
+}
+
+// storePosition runs the position hooks around storing a position received
+// from source. A StageDecoded hook error rejects the position before it is
+// stored.
+func (s *positionService) storePosition(source string, position *model.Position) error {
+	ctx := context.Background()
+	s.hooks.Received(source, position)
+	if err := s.hooks.RunPositionHooks(ctx, hook.StageDecoded, position); err != nil {
+		return err
+	}
+	if err := s.positionRepo.Create(position); err != nil {
+		return err
+	}
+	s.hooks.RunPositionHooks(ctx, hook.StageStored, position)
+	s.hooks.Position(position)
+	return nil
+}
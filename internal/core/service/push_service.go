@@ -0,0 +1,143 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"tracking/internal/core/model"
+	"tracking/internal/core/repository"
+	"tracking/internal/core/util"
+)
+
+// MaxPushTokens bounds the app installations a user receives pushes on;
+// registering another forgets the oldest
+const MaxPushTokens = 10
+
+// maxPushTokenLength bounds tokens, which FCM issues at about 160 characters
+const maxPushTokenLength = 4096
+
+var pushPlatforms = []string{model.PlatformAndroid, model.PlatformIOS, model.PlatformWeb}
+
+// ErrInvalidPushToken rejects empty or oversized tokens and unknown
+// platforms
+var ErrInvalidPushToken = errors.New("invalid push token")
+
+// PushService keeps the push tokens of users' apps and finds the tokens
+// each event is pushed to
+type PushService interface {
+	// RegisterToken stores a token of the user's app, moving it from
+	// another user who signed in on the same installation before
+	RegisterToken(userID string, token *model.PushToken) (*model.PushToken, error)
+	// UnregisterToken forgets a token of the user, such as on sign out
+	UnregisterToken(userID, token string) error
+	// ForgetToken removes a token FCM no longer delivers to
+	ForgetToken(token string) error
+	// Recipients returns the device an event is about and the tokens of
+	// the users reaching it
+	Recipients(event *model.Event) (*model.Device, []string, error)
+}
+
+type pushService struct {
+	pushTokenRepo repository.PushTokenRepository
+	deviceRepo    repository.DeviceRepository
+	orgMemberRepo repository.OrganizationMemberRepository
+	clock         util.Clock
+}
+
+func NewPushService(pushTokenRepo repository.PushTokenRepository, deviceRepo repository.DeviceRepository, orgMemberRepo repository.OrganizationMemberRepository, clock util.Clock) PushService {
+	return &pushService{
+		pushTokenRepo: pushTokenRepo,
+		deviceRepo:    deviceRepo,
+		orgMemberRepo: orgMemberRepo,
+		clock:         clock,
+	}
+}
+
+func (s *pushService) RegisterToken(userID string, token *model.PushToken) (*model.PushToken, error) {
+	if userID == "" {
+		return nil, errors.New("invalid user ID")
+	}
+	if token.Token == "" || len(token.Token) > maxPushTokenLength {
+		return nil, fmt.Errorf("%w: token must be 1 to %d characters", ErrInvalidPushToken, maxPushTokenLength)
+	}
+	if token.Platform != "" && !slices.Contains(pushPlatforms, token.Platform) {
+		return nil, fmt.Errorf("%w: platform must be one of %v", ErrInvalidPushToken, pushPlatforms)
+	}
+
+	existing, err := s.pushTokenRepo.FindByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+	now := s.clock.Now()
+	registered := &model.PushToken{
+		Token:     token.Token,
+		UserID:    userID,
+		Platform:  token.Platform,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	others := existing[:0:0]
+	for _, t := range existing {
+		if t.Token == token.Token {
+			registered.CreatedAt = t.CreatedAt
+		} else {
+			others = append(others, t)
+		}
+	}
+
+	// The oldest installations are most likely gone
+	for len(others) >= MaxPushTokens {
+		if err := s.pushTokenRepo.Delete(others[0].Token); err != nil {
+			return nil, err
+		}
+		others = others[1:]
+	}
+	if err := s.pushTokenRepo.Save(registered); err != nil {
+		return nil, err
+	}
+	return registered, nil
+}
+
+func (s *pushService) UnregisterToken(userID, token string) error {
+	if userID == "" {
+		return errors.New("invalid user ID")
+	}
+	tokens, err := s.pushTokenRepo.FindByUserID(userID)
+	if err != nil {
+		return err
+	}
+	for _, t := range tokens {
+		if t.Token == token {
+			return s.pushTokenRepo.Delete(token)
+		}
+	}
+	return nil
+}
+
+func (s *pushService) ForgetToken(token string) error {
+	return s.pushTokenRepo.Delete(token)
+}
+
+func (s *pushService) Recipients(event *model.Event) (*model.Device, []string, error) {
+	device, err := s.deviceRepo.FindByID(event.DeviceID)
+	if err != nil || device == nil {
+		return nil, nil, err
+	}
+
+	userIDs, err := deviceUsers(device, s.orgMemberRepo)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var tokens []string
+	for _, userID := range userIDs {
+		registered, err := s.pushTokenRepo.FindByUserID(userID)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, t := range registered {
+			tokens = append(tokens, t.Token)
+		}
+	}
+	return device, tokens, nil
+}
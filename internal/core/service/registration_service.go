@@ -0,0 +1,210 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+	"tracking/internal/cache"
+	"tracking/internal/core/model"
+	"tracking/internal/core/repository"
+	"tracking/internal/core/util"
+)
+
+const (
+	// registrationTTL is how long a registration waits for approval
+	registrationTTL = 24 * time.Hour
+	// maxPendingRegistrations bounds the requests queued for one account
+	maxPendingRegistrations = 20
+	// registeredProtocol is the protocol phone trackers report with
+	registeredProtocol = "osmand"
+)
+
+// RegistrationService lets phone trackers register themselves as devices.
+// The phone names the account it belongs to; the account owner approves the
+// request in the dashboard, and the phone then collects its credentials.
+type RegistrationService interface {
+	RequestRegistration(name, ownerEmail string) (*model.DeviceRegistration, error)
+	// GetRegistration returns the registration to the phone holding its
+	// token, with the device once approved; a wrong token finds nothing
+	GetRegistration(id, token string) (*model.DeviceRegistration, *model.Device, error)
+	ListPendingRegistrations(ownerEmail string) ([]*model.DeviceRegistration, error)
+	ApproveRegistration(id, userID, ownerEmail string) (*model.Device, error)
+	RejectRegistration(id, ownerEmail string) error
+}
+
+type registrationService struct {
+	registrationRepo repository.DeviceRegistrationRepository
+	deviceRepo       repository.DeviceRepository
+	clock            util.Clock
+}
+
+func NewRegistrationService(registrationRepo repository.DeviceRegistrationRepository, deviceRepo repository.DeviceRepository, clock util.Clock) RegistrationService {
+	return &registrationService{
+		registrationRepo: registrationRepo,
+		deviceRepo:       deviceRepo,
+		clock:            clock,
+	}
+}
+
+func (s *registrationService) RequestRegistration(name, ownerEmail string) (*model.DeviceRegistration, error) {
+	name = strings.TrimSpace(name)
+	ownerEmail = normalizeEmail(ownerEmail)
+	if name == "" || !strings.Contains(ownerEmail, "@") {
+		return nil, errors.New("device name and account email are required")
+	}
+
+	pending, err := s.ListPendingRegistrations(ownerEmail)
+	if err != nil {
+		return nil, err
+	}
+	if len(pending) >= maxPendingRegistrations {
+		return nil, errors.New("too many pending registrations for this account")
+	}
+
+	registration := model.NewDeviceRegistration(name, ownerEmail)
+	registration.CreatedAt = s.clock.Now()
+	if err := s.registrationRepo.Create(registration); err != nil {
+		return nil, err
+	}
+	return registration, nil
+}
+
+func (s *registrationService) GetRegistration(id, token string) (*model.DeviceRegistration, *model.Device, error) {
+	registration, err := s.find(id)
+	if err != nil || registration == nil {
+		return nil, nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(registration.Token), []byte(token)) != 1 {
+		return nil, nil, nil
+	}
+	if registration.Status != model.RegistrationApproved {
+		return registration, nil, nil
+	}
+
+	device, err := s.deviceRepo.FindByID(registration.DeviceID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return registration, device, nil
+}
+
+func (s *registrationService) ListPendingRegistrations(ownerEmail string) ([]*model.DeviceRegistration, error) {
+	registrations, err := s.registrationRepo.FindByOwnerEmail(normalizeEmail(ownerEmail))
+	if err != nil {
+		return nil, err
+	}
+
+	pending := make([]*model.DeviceRegistration, 0, len(registrations))
+	for _, registration := range registrations {
+		if s.expire(registration) == nil && registration.Status == model.RegistrationPending {
+			pending = append(pending, registration)
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool { return pending[i].CreatedAt.Before(pending[j].CreatedAt) })
+	return pending, nil
+}
+
+func (s *registrationService) ApproveRegistration(id, userID, ownerEmail string) (*model.Device, error) {
+	registration, err := s.findPending(id, ownerEmail)
+	if err != nil {
+		return nil, err
+	}
+
+	uniqueID, err := s.generateUniqueID()
+	if err != nil {
+		return nil, err
+	}
+
+	device := model.NewDevice(registration.Name, uniqueID)
+	device.Protocol = registeredProtocol
+	device.SetOwnership(userID, "")
+	device.CreatedAt = s.clock.Now()
+	device.LastUpdate = device.CreatedAt
+	if err := s.deviceRepo.Create(device); err != nil {
+		return nil, err
+	}
+	cache.Delete(context.Background(), fmt.Sprintf("%s%s", deviceListCacheKeyPrefix, userID))
+
+	registration.Status = model.RegistrationApproved
+	registration.DeviceID = device.ID
+	registration.ReviewedAt = s.clock.Now()
+	if err := s.registrationRepo.Update(registration); err != nil {
+		return nil, err
+	}
+	return device, nil
+}
+
+func (s *registrationService) RejectRegistration(id, ownerEmail string) error {
+	registration, err := s.findPending(id, ownerEmail)
+	if err != nil {
+		return err
+	}
+
+	registration.Status = model.RegistrationRejected
+	registration.ReviewedAt = s.clock.Now()
+	return s.registrationRepo.Update(registration)
+}
+
+func (s *registrationService) find(id string) (*model.DeviceRegistration, error) {
+	registration, err := s.registrationRepo.FindByID(id)
+	if err != nil || registration == nil {
+		return nil, err
+	}
+	return registration, s.expire(registration)
+}
+
+// findPending returns a registration the owner can still review. Other
+// accounts' registrations are reported as missing.
+func (s *registrationService) findPending(id, ownerEmail string) (*model.DeviceRegistration, error) {
+	registration, err := s.find(id)
+	if err != nil {
+		return nil, err
+	}
+	if registration == nil || registration.OwnerEmail != normalizeEmail(ownerEmail) {
+		return nil, errors.New("registration not found")
+	}
+	if registration.Status != model.RegistrationPending {
+		return nil, fmt.Errorf("registration is %s", registration.Status)
+	}
+	return registration, nil
+}
+
+// expire marks a pending registration expired once it outlives its TTL
+func (s *registrationService) expire(registration *model.DeviceRegistration) error {
+	if registration.Status != model.RegistrationPending || s.clock.Now().Sub(registration.CreatedAt) < registrationTTL {
+		return nil
+	}
+	registration.Status = model.RegistrationExpired
+	return s.registrationRepo.Update(registration)
+}
+
+// generateUniqueID picks an unused 12 digit identifier, the form phone
+// tracker apps expect
+func (s *registrationService) generateUniqueID() (string, error) {
+	for attempt := 0; attempt < 5; attempt++ {
+		n, err := rand.Int(rand.Reader, big.NewInt(1e12))
+		if err != nil {
+			return "", err
+		}
+		uniqueID := fmt.Sprintf("%012d", n)
+
+		existing, err := s.deviceRepo.FindByUniqueID(uniqueID)
+		if err != nil {
+			return "", err
+		}
+		if existing == nil {
+			return uniqueID, nil
+		}
+	}
+	return "", errors.New("could not generate a unique device ID")
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
@@ -0,0 +1,278 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+	"tracking/internal/core/model"
+	"tracking/internal/core/repository"
+	"tracking/internal/core/util"
+)
+
+// Bounds on reports
+const (
+	DefaultStopDuration = 5 * time.Minute
+	// StopRadius is how far in meters a device may drift from where it
+	// stopped, as fixes wander while it stands still
+	StopRadius    = 50
+	MaxReportDays = 31
+	// MaxMileageDays is longer, as mileage and engine hours are wanted by
+	// the week
+	MaxMileageDays = 366
+)
+
+// ErrInvalidReport is returned for a report query out of bounds
+var ErrInvalidReport = errors.New("invalid report query")
+
+// ReportService computes reports over the positions of a device
+type ReportService interface {
+	// GetStops returns the places the device stayed within StopRadius of
+	// for at least minDuration, DefaultStopDuration when zero, between its
+	// positions in [from, to)
+	GetStops(deviceID, userID string, from, to time.Time, minDuration time.Duration) (*model.StopReport, error)
+	// GetMileage returns the distance the device covered in each UTC day
+	// or week of [from, to), counted as its odometer is, jumps left out.
+	// The move to the first position in the range is not counted.
+	GetMileage(deviceID, userID string, from, to time.Time, period string) (*model.MileageReport, error)
+	// GetEngineHours returns the hours the engine of the device ran in
+	// each UTC day or week of [from, to), counted as its engine hours are
+	// from ignition or its hour meter
+	GetEngineHours(deviceID, userID string, from, to time.Time, period string) (*model.EngineHoursReport, error)
+}
+
+type reportService struct {
+	positionRepo  repository.PositionRepository
+	deviceRepo    repository.DeviceRepository
+	orgMemberRepo repository.OrganizationMemberRepository
+}
+
+func NewReportService(positionRepo repository.PositionRepository, deviceRepo repository.DeviceRepository, orgMemberRepo repository.OrganizationMemberRepository) ReportService {
+	return &reportService{
+		positionRepo:  positionRepo,
+		deviceRepo:    deviceRepo,
+		orgMemberRepo: orgMemberRepo,
+	}
+}
+
+func (s *reportService) GetStops(deviceID, userID string, from, to time.Time, minDuration time.Duration) (*model.StopReport, error) {
+	if minDuration == 0 {
+		minDuration = DefaultStopDuration
+	}
+	if minDuration < 0 {
+		return nil, fmt.Errorf("%w: minimum duration must be positive", ErrInvalidReport)
+	}
+	positions, err := s.positions(deviceID, userID, from, to, MaxReportDays)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &model.StopReport{
+		DeviceID:    deviceID,
+		From:        from,
+		To:          to,
+		MinDuration: int64(minDuration / time.Second),
+		Stops:       []*model.Stop{},
+	}
+	// A stay runs from the first fix of a place to the last one within
+	// StopRadius of it; fixes without a fix repeat an old place and are
+	// left out
+	var stay []*model.Position
+	flush := func() {
+		if len(stay) == 0 {
+			return
+		}
+		first, last := stay[0], stay[len(stay)-1]
+		if dwell := last.Timestamp.Sub(first.Timestamp); dwell >= minDuration {
+			stop := &model.Stop{
+				StartTime: first.Timestamp,
+				EndTime:   last.Timestamp,
+				Duration:  int64(dwell / time.Second),
+				Latitude:  first.Latitude,
+				Longitude: first.Longitude,
+				Positions: len(stay),
+			}
+			for _, position := range stay {
+				if position.Address != "" {
+					stop.Address = position.Address
+					break
+				}
+			}
+			report.Stops = append(report.Stops, stop)
+			report.TotalDuration += stop.Duration
+		}
+		stay = stay[:0]
+	}
+	for _, position := range positions {
+		if !position.Valid {
+			continue
+		}
+		if len(stay) > 0 && util.Distance(stay[0].Latitude, stay[0].Longitude, position.Latitude, position.Longitude) > StopRadius {
+			flush()
+		}
+		stay = append(stay, position)
+	}
+	flush()
+	return report, nil
+}
+
+func (s *reportService) GetMileage(deviceID, userID string, from, to time.Time, period string) (*model.MileageReport, error) {
+	period, err := reportPeriod(period)
+	if err != nil {
+		return nil, err
+	}
+	from, to = from.UTC(), to.UTC()
+	positions, err := s.positions(deviceID, userID, from, to, MaxMileageDays)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &model.MileageReport{
+		DeviceID: deviceID,
+		From:     from,
+		To:       to,
+		Period:   period,
+		Periods:  []*model.MileagePeriod{},
+	}
+	for _, bounds := range splitPeriods(from, to, period) {
+		report.Periods = append(report.Periods, &model.MileagePeriod{Start: bounds[0], End: bounds[1]})
+	}
+	// Each leg counts in the period of the position ending it
+	accumulators := &model.Accumulators{DeviceID: deviceID}
+	current := 0
+	for _, position := range positions {
+		before := accumulators.TotalDistance
+		accumulators.Advance(position)
+		for !position.Timestamp.Before(report.Periods[current].End) {
+			current++
+		}
+		report.Periods[current].Distance += accumulators.TotalDistance - before
+	}
+	report.Distance = accumulators.TotalDistance
+	return report, nil
+}
+
+func (s *reportService) GetEngineHours(deviceID, userID string, from, to time.Time, period string) (*model.EngineHoursReport, error) {
+	period, err := reportPeriod(period)
+	if err != nil {
+		return nil, err
+	}
+	from, to = from.UTC(), to.UTC()
+	positions, err := s.positions(deviceID, userID, from, to, MaxMileageDays)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &model.EngineHoursReport{
+		DeviceID: deviceID,
+		From:     from,
+		To:       to,
+		Period:   period,
+		Periods:  []*model.EngineHoursPeriod{},
+	}
+	for _, bounds := range splitPeriods(from, to, period) {
+		report.Periods = append(report.Periods, &model.EngineHoursPeriod{Start: bounds[0], End: bounds[1]})
+	}
+	// The time counted between two positions is shared among the periods
+	// it spans, so a shift running past midnight counts on both days
+	accumulators := &model.Accumulators{DeviceID: deviceID}
+	current := 0
+	for _, position := range positions {
+		before, since := accumulators.EngineHours, accumulators.Timestamp
+		accumulators.Advance(position)
+		hours := accumulators.EngineHours - before
+		for !position.Timestamp.Before(report.Periods[current].End) {
+			current++
+		}
+		elapsed := position.Timestamp.Sub(since)
+		if hours <= 0 || since.IsZero() || elapsed <= 0 {
+			report.Periods[current].EngineHours += hours
+			continue
+		}
+		for i := current; i >= 0 && report.Periods[i].End.After(since); i-- {
+			overlap := minTime(position.Timestamp, report.Periods[i].End).Sub(maxTime(since, report.Periods[i].Start))
+			report.Periods[i].EngineHours += hours * float64(overlap) / float64(elapsed)
+		}
+	}
+	report.EngineHours = accumulators.EngineHours
+	return report, nil
+}
+
+// reportPeriod checks the period of a report, a day when left out
+func reportPeriod(period string) (string, error) {
+	switch period {
+	case "":
+		return model.ReportDaily, nil
+	case model.ReportDaily, model.ReportWeekly:
+		return period, nil
+	}
+	return "", fmt.Errorf("%w: period must be %s or %s", ErrInvalidReport, model.ReportDaily, model.ReportWeekly)
+}
+
+// splitPeriods cuts [from, to) into the UTC days or weeks it overlaps,
+// the first and last cut to the range
+func splitPeriods(from, to time.Time, period string) [][2]time.Time {
+	start := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+	days := 1
+	if period == model.ReportWeekly {
+		start = start.AddDate(0, 0, -(int(start.Weekday())+6)%7)
+		days = 7
+	}
+	var periods [][2]time.Time
+	for start.Before(to) {
+		end := start.AddDate(0, 0, days)
+		periods = append(periods, [2]time.Time{maxTime(start, from), minTime(end, to)})
+		start = end
+	}
+	return periods
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+// positions returns the positions of a device the user can access in
+// [from, to), oldest first, for a range of at most maxDays
+func (s *reportService) positions(deviceID, userID string, from, to time.Time, maxDays int) ([]*model.Position, error) {
+	if from.IsZero() || to.IsZero() || !to.After(from) {
+		return nil, fmt.Errorf("%w: from and to required, to after from", ErrInvalidReport)
+	}
+	if to.Sub(from) > time.Duration(maxDays)*24*time.Hour {
+		return nil, fmt.Errorf("%w: at most %d days", ErrInvalidReport, maxDays)
+	}
+	if deviceID == "" || userID == "" {
+		return nil, ErrDeviceNotFound
+	}
+	device, err := newDeviceAccess(userID, s.orgMemberRepo).device(s.deviceRepo, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if device == nil {
+		return nil, ErrDeviceNotFound
+	}
+
+	positions, err := s.positionRepo.FindByDeviceID(device.ID)
+	if err != nil {
+		return nil, err
+	}
+	var inRange []*model.Position
+	for _, position := range positions {
+		if !position.Timestamp.Before(from) && position.Timestamp.Before(to) {
+			inRange = append(inRange, position)
+		}
+	}
+	sort.SliceStable(inRange, func(i, j int) bool {
+		return inRange[i].Timestamp.Before(inRange[j].Timestamp)
+	})
+	return inRange, nil
+}
@@ -0,0 +1,215 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+	"tracking/internal/core/model"
+	"tracking/internal/core/repository"
+	"tracking/internal/core/script"
+	"tracking/internal/core/util"
+)
+
+// scriptTimeout caps the time one script may spend on a position
+const scriptTimeout = 50 * time.Millisecond
+
+type ScriptService interface {
+	CreateScript(name, deviceModel, source string, enabled bool) (*model.Script, error)
+	UpdateScript(id, name, deviceModel, source string, enabled bool) (*model.Script, error)
+	DeleteScript(id string) error
+	GetScript(id string) (*model.Script, error)
+	ListScripts() ([]*model.Script, error)
+	// ApplyScripts runs the scripts for the position's device model and
+	// stores their results in the position status. It is a position hook.
+	ApplyScripts(ctx context.Context, position *model.Position) error
+}
+
+type compiledScript struct {
+	source  string
+	program *script.Program
+}
+
+type scriptService struct {
+	scriptRepo repository.ScriptRepository
+	deviceRepo repository.DeviceRepository
+	clock      util.Clock
+	compiled   map[string]compiledScript
+	mutex      sync.Mutex
+}
+
+func NewScriptService(scriptRepo repository.ScriptRepository, deviceRepo repository.DeviceRepository, clock util.Clock) ScriptService {
+	return &scriptService{
+		scriptRepo: scriptRepo,
+		deviceRepo: deviceRepo,
+		clock:      clock,
+		compiled:   make(map[string]compiledScript),
+	}
+}
+
+func (s *scriptService) CreateScript(name, deviceModel, source string, enabled bool) (*model.Script, error) {
+	if name == "" || deviceModel == "" {
+		return nil, errors.New("script name and device model are required")
+	}
+	if _, err := script.Compile(source); err != nil {
+		return nil, err
+	}
+
+	sc := model.NewScript(name, deviceModel, source)
+	sc.Enabled = enabled
+	sc.CreatedAt = s.clock.Now()
+	sc.UpdatedAt = sc.CreatedAt
+	if err := s.scriptRepo.Create(sc); err != nil {
+		return nil, err
+	}
+	return sc, nil
+}
+
+func (s *scriptService) UpdateScript(id, name, deviceModel, source string, enabled bool) (*model.Script, error) {
+	if name == "" || deviceModel == "" {
+		return nil, errors.New("script name and device model are required")
+	}
+	sc, err := s.scriptRepo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if sc == nil {
+		return nil, errors.New("script not found")
+	}
+	if _, err := script.Compile(source); err != nil {
+		return nil, err
+	}
+
+	sc.Name = name
+	sc.DeviceModel = deviceModel
+	sc.Source = source
+	sc.Enabled = enabled
+	sc.UpdatedAt = s.clock.Now()
+	if err := s.scriptRepo.Update(sc); err != nil {
+		return nil, err
+	}
+	return sc, nil
+}
+
+func (s *scriptService) DeleteScript(id string) error {
+	sc, err := s.scriptRepo.FindByID(id)
+	if err != nil {
+		return err
+	}
+	if sc == nil {
+		return errors.New("script not found")
+	}
+	if err := s.scriptRepo.Delete(id); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	delete(s.compiled, id)
+	s.mutex.Unlock()
+	return nil
+}
+
+func (s *scriptService) GetScript(id string) (*model.Script, error) {
+	return s.scriptRepo.FindByID(id)
+}
+
+func (s *scriptService) ListScripts() ([]*model.Script, error) {
+	return s.scriptRepo.FindAll()
+}
+
+// ApplyScripts never rejects a position: a failing script is logged and
+// the remaining scripts still run
+func (s *scriptService) ApplyScripts(ctx context.Context, position *model.Position) error {
+	device, err := s.deviceRepo.FindByID(position.DeviceID)
+	if err != nil || device == nil || device.Model == "" {
+		return nil
+	}
+
+	scripts, err := s.scriptRepo.FindByDeviceModel(device.Model)
+	if err != nil {
+		log.Printf("[Scripts] Error loading scripts for model %s: %v", device.Model, err)
+		return nil
+	}
+	if len(scripts) == 0 {
+		return nil
+	}
+
+	// Run in creation order so later scripts can build on earlier results
+	sort.Slice(scripts, func(i, j int) bool {
+		if !scripts[i].CreatedAt.Equal(scripts[j].CreatedAt) {
+			return scripts[i].CreatedAt.Before(scripts[j].CreatedAt)
+		}
+		return scripts[i].ID < scripts[j].ID
+	})
+
+	inputs := scriptInputs(position)
+	for _, sc := range scripts {
+		if !sc.Enabled {
+			continue
+		}
+
+		outputs, err := s.run(ctx, sc, inputs)
+		if err != nil {
+			log.Printf("[Scripts] Script %s (%s) failed for device %s: %v", sc.Name, sc.ID, position.DeviceID, err)
+			continue
+		}
+
+		if position.Status == nil {
+			position.Status = make(map[string]interface{})
+		}
+		for name, value := range outputs {
+			position.Status[name] = value
+			inputs[name] = value
+		}
+	}
+	return nil
+}
+
+func (s *scriptService) run(ctx context.Context, sc *model.Script, inputs map[string]interface{}) (map[string]interface{}, error) {
+	program, err := s.program(sc)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, scriptTimeout)
+	defer cancel()
+	return program.Run(ctx, inputs)
+}
+
+// program returns the compiled script, recompiling when its source changes
+func (s *scriptService) program(sc *model.Script) (*script.Program, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if cached, ok := s.compiled[sc.ID]; ok && cached.source == sc.Source {
+		return cached.program, nil
+	}
+
+	program, err := script.Compile(sc.Source)
+	if err != nil {
+		return nil, fmt.Errorf("compile: %w", err)
+	}
+	s.compiled[sc.ID] = compiledScript{source: sc.Source, program: program}
+	return program, nil
+}
+
+// scriptInputs exposes the position fields and its status attributes to scripts
+func scriptInputs(position *model.Position) map[string]interface{} {
+	inputs := make(map[string]interface{}, len(position.Status)+9)
+	for name, value := range position.Status {
+		inputs[name] = value
+	}
+	inputs["deviceId"] = position.DeviceID
+	inputs["protocol"] = position.Protocol
+	inputs["latitude"] = position.Latitude
+	inputs["longitude"] = position.Longitude
+	inputs["altitude"] = position.Altitude
+	inputs["speed"] = position.Speed
+	inputs["course"] = position.Course
+	inputs["satellites"] = position.Satellites
+	inputs["valid"] = position.Valid
+	return inputs
+}
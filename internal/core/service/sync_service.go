@@ -0,0 +1,194 @@
+package service
+
+import (
+	"errors"
+	"strconv"
+	"tracking/internal/core/model"
+	"tracking/internal/core/repository"
+)
+
+// Bounds on the journal entries read by one sync
+const (
+	DefaultSyncLimit = 500
+	MaxSyncLimit     = 1000
+)
+
+// ErrInvalidCursor is returned for a cursor no sync handed out
+var ErrInvalidCursor = errors.New("invalid sync cursor")
+
+// SyncService lets mobile apps keep a local copy of their devices current
+// by fetching only what changed since they last synced
+type SyncService interface {
+	// Sync returns what changed for the devices the user can access after
+	// the cursor, reading at most limit journal entries, or DefaultSyncLimit
+	// when limit is 0. An empty cursor gives a snapshot of those devices
+	// with their latest positions instead. Deleted devices come back as
+	// tombstones.
+	Sync(userID, cursor string, limit int) (*model.SyncResult, error)
+}
+
+type syncService struct {
+	changeRepo    repository.ChangeRepository
+	deviceRepo    repository.DeviceRepository
+	positionRepo  repository.PositionRepository
+	eventRepo     repository.EventRepository // Nil when events are not stored
+	orgMemberRepo repository.OrganizationMemberRepository
+}
+
+func NewSyncService(changeRepo repository.ChangeRepository, deviceRepo repository.DeviceRepository, positionRepo repository.PositionRepository, eventRepo repository.EventRepository, orgMemberRepo repository.OrganizationMemberRepository) SyncService {
+	return &syncService{
+		changeRepo:    changeRepo,
+		deviceRepo:    deviceRepo,
+		positionRepo:  positionRepo,
+		eventRepo:     eventRepo,
+		orgMemberRepo: orgMemberRepo,
+	}
+}
+
+func (s *syncService) Sync(userID, cursor string, limit int) (*model.SyncResult, error) {
+	if userID == "" {
+		return nil, errors.New("invalid user ID")
+	}
+	if limit <= 0 {
+		limit = DefaultSyncLimit
+	}
+	limit = min(limit, MaxSyncLimit)
+
+	access := newDeviceAccess(userID, s.orgMemberRepo)
+	if cursor == "" {
+		return s.snapshot(access)
+	}
+
+	since, err := strconv.ParseInt(cursor, 10, 64)
+	if err != nil || since < 0 {
+		return nil, ErrInvalidCursor
+	}
+	changes, err := s.changeRepo.FindAfter(since, limit+1)
+	if err != nil {
+		return nil, err
+	}
+
+	result := newSyncResult(since)
+	if len(changes) > limit {
+		result.HasMore = true
+		changes = changes[:limit]
+	}
+
+	// Devices as they are now, nil when gone or not the user's
+	devices := make(map[string]*model.Device)
+	visible := func(deviceID string) (*model.Device, error) {
+		if device, seen := devices[deviceID]; seen {
+			return device, nil
+		}
+		device, err := access.device(s.deviceRepo, deviceID)
+		if err != nil {
+			return nil, err
+		}
+		devices[deviceID] = device
+		return device, nil
+	}
+
+	sent := make(map[string]bool)
+	for _, change := range changes {
+		result.Cursor = strconv.FormatInt(change.Sequence, 10)
+
+		if change.Kind == model.ChangeDevice && change.Deleted {
+			allowed, err := access.allowed(change.UserID, change.OrganizationID)
+			if err != nil {
+				return nil, err
+			}
+			if allowed {
+				result.Tombstones = append(result.Tombstones, &model.Tombstone{
+					Kind:      model.ChangeDevice,
+					ID:        change.DeviceID,
+					DeletedAt: change.Timestamp,
+				})
+			}
+			continue
+		}
+
+		device, err := visible(change.DeviceID)
+		if err != nil {
+			return nil, err
+		}
+		if device == nil {
+			continue
+		}
+
+		switch change.Kind {
+		case model.ChangeDevice:
+			if !sent[device.ID] {
+				sent[device.ID] = true
+				result.Devices = append(result.Devices, device)
+			}
+		case model.ChangePosition:
+			position, err := s.positionRepo.FindByID(change.EntityID)
+			if err != nil {
+				return nil, err
+			}
+			if position != nil {
+				result.Positions = append(result.Positions, position)
+			}
+		case model.ChangeEvent:
+			if s.eventRepo == nil {
+				continue
+			}
+			event, err := s.eventRepo.FindByID(change.EntityID)
+			if err != nil {
+				return nil, err
+			}
+			if event != nil {
+				result.Events = append(result.Events, event)
+			}
+		}
+	}
+	return result, nil
+}
+
+// snapshot returns every device the user can access with its latest
+// position. The cursor is read first, so changes made meanwhile come again
+// on the next sync rather than going missing.
+func (s *syncService) snapshot(access *deviceAccess) (*model.SyncResult, error) {
+	head, err := s.changeRepo.LatestSequence()
+	if err != nil {
+		return nil, err
+	}
+	devices, err := s.deviceRepo.FindAll()
+	if err != nil {
+		return nil, err
+	}
+
+	result := newSyncResult(head)
+	for _, device := range devices {
+		allowed, err := access.allowed(device.UserID, device.OrganizationID)
+		if err != nil {
+			return nil, err
+		}
+		if !allowed {
+			continue
+		}
+		result.Devices = append(result.Devices, device)
+
+		if device.PositionID == "" {
+			continue
+		}
+		position, err := s.positionRepo.FindByID(device.PositionID)
+		if err != nil {
+			return nil, err
+		}
+		if position != nil {
+			result.Positions = append(result.Positions, position)
+		}
+	}
+	return result, nil
+}
+
+func newSyncResult(sequence int64) *model.SyncResult {
+	return &model.SyncResult{
+		Cursor:     strconv.FormatInt(sequence, 10),
+		Devices:    []*model.Device{},
+		Positions:  []*model.Position{},
+		Events:     []*model.Event{},
+		Tombstones: []*model.Tombstone{},
+	}
+}
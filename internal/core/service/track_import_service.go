@@ -0,0 +1,231 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"tracking/internal/core/hook"
+	"tracking/internal/core/job"
+	"tracking/internal/core/model"
+	"tracking/internal/core/repository"
+	"tracking/internal/core/util"
+	"tracking/internal/protocol/nmea"
+	"tracking/internal/protocol/teltonika"
+)
+
+// MaxTrackImportSize bounds an uploaded log file
+const MaxTrackImportSize = 64 << 20
+
+// Log formats accepted by ImportTrack
+const (
+	TrackFormatNMEA      = "nmea"      // NMEA 0183 sentences, one per line
+	TrackFormatTeltonika = "teltonika" // Codec 8, 8E or 16 AVL packets back to back
+)
+
+// JobTypeTrackImport marks the jobs of track imports
+const JobTypeTrackImport = "trackImport"
+
+// Common track import errors
+var (
+	ErrInvalidTrack = errors.New("invalid track file")
+	ErrJobNotFound  = errors.New("job not found")
+)
+
+// TrackImportService backfills positions from logs kept on a device or its
+// SD card while it was out of coverage
+type TrackImportService interface {
+	// ImportTrack decodes a log, detecting its format when format is empty,
+	// and stores its positions for the device in a background job. Invalid
+	// fixes and positions already stored for the same instant are skipped.
+	// Imported positions run through the StageDecoded hooks but raise no
+	// events, being history.
+	ImportTrack(deviceID, userID, format string, data []byte) (*model.Job, error)
+	// GetJob returns the progress of an import
+	GetJob(id string) (*model.Job, error)
+}
+
+type trackImportService struct {
+	positionRepo     repository.PositionRepository
+	deviceRepo       repository.DeviceRepository
+	jobs             *job.Manager
+	nmeaDecoder      *nmea.Decoder
+	teltonikaDecoder *teltonika.Decoder
+	hooks            *hook.Registry
+}
+
+func NewTrackImportService(positionRepo repository.PositionRepository, deviceRepo repository.DeviceRepository, jobs *job.Manager, clock util.Clock, hooks *hook.Registry) TrackImportService {
+	nmeaDecoder := nmea.NewDecoder()
+	nmeaDecoder.SetClock(clock)
+	teltonikaDecoder := teltonika.NewDecoder()
+	teltonikaDecoder.SetClock(clock)
+
+	return &trackImportService{
+		positionRepo:     positionRepo,
+		deviceRepo:       deviceRepo,
+		jobs:             jobs,
+		nmeaDecoder:      nmeaDecoder,
+		teltonikaDecoder: teltonikaDecoder,
+		hooks:            hooks,
+	}
+}
+
+func (s *trackImportService) ImportTrack(deviceID, userID, format string, data []byte) (*model.Job, error) {
+	if len(data) == 0 || len(data) > MaxTrackImportSize {
+		return nil, fmt.Errorf("%w: %d bytes, expected 1 to %d", ErrInvalidTrack, len(data), MaxTrackImportSize)
+	}
+	device, err := s.deviceRepo.FindByID(deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if device == nil {
+		return nil, errors.New("device not found")
+	}
+
+	if format == "" {
+		format = detectTrackFormat(data)
+	}
+	var positions []*model.Position
+	switch format {
+	case TrackFormatNMEA:
+		positions, err = s.decodeNMEA(device.ID, data)
+	case TrackFormatTeltonika:
+		positions, err = s.decodeTeltonika(device.ID, data)
+	default:
+		return nil, fmt.Errorf("%w: unknown format %q", ErrInvalidTrack, format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(positions) == 0 {
+		return nil, fmt.Errorf("%w: no positions found", ErrInvalidTrack)
+	}
+	sort.SliceStable(positions, func(i, j int) bool {
+		return positions[i].Timestamp.Before(positions[j].Timestamp)
+	})
+
+	return s.jobs.Start(JobTypeTrackImport, userID, device.ID, func(progress *job.Progress) error {
+		return s.store(device.ID, positions, progress)
+	}), nil
+}
+
+func (s *trackImportService) GetJob(id string) (*model.Job, error) {
+	job := s.jobs.Get(id)
+	if job == nil || job.Type != JobTypeTrackImport {
+		return nil, ErrJobNotFound
+	}
+	return job, nil
+}
+
+// detectTrackFormat tells binary AVL dumps from NMEA text
+func detectTrackFormat(data []byte) string {
+	if teltonika.IsAVLPacket(data) || skipIMEIPacket(data) != nil {
+		return TrackFormatTeltonika
+	}
+	return TrackFormatNMEA
+}
+
+// skipIMEIPacket returns what follows the IMEI packet a dump opens with,
+// as the device sends it when connecting, or nil when there is none
+func skipIMEIPacket(data []byte) []byte {
+	if len(data) < 2 {
+		return nil
+	}
+	size := 2 + int(data[0])<<8 + int(data[1])
+	if len(data) < size || !teltonika.IsIMEIPacket(data[:size]) {
+		return nil
+	}
+	return data[size:]
+}
+
+func (s *trackImportService) decodeNMEA(deviceID string, data []byte) ([]*model.Position, error) {
+	fixes, err := s.nmeaDecoder.Decode(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidTrack, err)
+	}
+	positions := make([]*model.Position, len(fixes))
+	for i, fix := range fixes {
+		positions[i] = s.nmeaDecoder.ToPosition(deviceID, fix)
+	}
+	return positions, nil
+}
+
+func (s *trackImportService) decodeTeltonika(deviceID string, data []byte) ([]*model.Position, error) {
+	if rest := skipIMEIPacket(data); rest != nil {
+		data = rest
+	}
+
+	var positions []*model.Position
+	for offset := 0; offset < len(data); {
+		size, err := teltonika.AVLPacketSize(data[offset:])
+		if err != nil {
+			return nil, fmt.Errorf("%w: at byte %d: %v", ErrInvalidTrack, offset, err)
+		}
+		if offset+size > len(data) {
+			return nil, fmt.Errorf("%w: packet at byte %d is truncated", ErrInvalidTrack, offset)
+		}
+		records, err := s.teltonikaDecoder.DecodeAVL(data[offset : offset+size])
+		if err != nil {
+			return nil, fmt.Errorf("%w: at byte %d: %v", ErrInvalidTrack, offset, err)
+		}
+		positions = append(positions, s.teltonikaDecoder.ToPositions(deviceID, records)...)
+		offset += size
+	}
+	return positions, nil
+}
+
+// store saves the positions, oldest first, and points the device at the
+// newest one stored when it is more recent than the device's latest
+func (s *trackImportService) store(deviceID string, positions []*model.Position, progress *job.Progress) error {
+	progress.SetTotal(len(positions))
+
+	existing, err := s.positionRepo.FindByDeviceID(deviceID)
+	if err != nil {
+		return err
+	}
+	stored := make(map[int64]bool, len(existing))
+	for _, position := range existing {
+		stored[position.Timestamp.UnixNano()] = true
+	}
+
+	ctx := context.Background()
+	var newest *model.Position
+	for _, position := range positions {
+		instant := position.Timestamp.UnixNano()
+		if !position.Valid || stored[instant] {
+			progress.Skipped(1)
+			continue
+		}
+		position.Status["source"] = "import"
+		if err := s.hooks.RunPositionHooks(ctx, hook.StageDecoded, position); err != nil {
+			progress.Skipped(1)
+			continue
+		}
+		if err := s.positionRepo.Create(position); err != nil {
+			return err
+		}
+		stored[instant] = true
+		newest = position
+		progress.Processed(1)
+	}
+	if newest == nil {
+		return nil
+	}
+
+	device, err := s.deviceRepo.FindByID(deviceID)
+	if err != nil || device == nil {
+		return err
+	}
+	if device.PositionID != "" {
+		current, err := s.positionRepo.FindByID(device.PositionID)
+		if err != nil {
+			return err
+		}
+		if current != nil && !newest.Timestamp.After(current.Timestamp) {
+			return nil
+		}
+	}
+	device.PositionID = newest.ID
+	device.LastUpdate = newest.Timestamp
+	return s.deviceRepo.Update(device)
+}
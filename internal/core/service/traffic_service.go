@@ -0,0 +1,123 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"time"
+	"tracking/internal/core/model"
+	"tracking/internal/core/repository"
+	"tracking/internal/core/util"
+)
+
+// ErrInvalidMonth rejects a month not formatted as 2006-01
+var ErrInvalidMonth = errors.New("invalid month")
+
+// TrafficService counts the bytes devices exchange with the server by SIM
+// and month, so fleets can match them against their SIM plans
+type TrafficService interface {
+	// RecordTraffic counts traffic of a device in the current month on
+	// the SIM it last reported
+	RecordTraffic(deviceID string, bytesIn, bytesOut int64)
+	// LearnSIM is a position hook keeping the ICCID devices report
+	LearnSIM(ctx context.Context, position *model.Position) error
+	// SIMUsage reports the traffic of the devices the user can access in a
+	// month, the current one when empty, by SIM with the heaviest first
+	SIMUsage(userID, month string) ([]*model.SIMUsage, error)
+}
+
+type trafficService struct {
+	trafficRepo   repository.DataTrafficRepository
+	deviceRepo    repository.DeviceRepository
+	orgMemberRepo repository.OrganizationMemberRepository
+	clock         util.Clock
+}
+
+func NewTrafficService(trafficRepo repository.DataTrafficRepository, deviceRepo repository.DeviceRepository, orgMemberRepo repository.OrganizationMemberRepository, clock util.Clock) TrafficService {
+	return &trafficService{
+		trafficRepo:   trafficRepo,
+		deviceRepo:    deviceRepo,
+		orgMemberRepo: orgMemberRepo,
+		clock:         clock,
+	}
+}
+
+func (s *trafficService) RecordTraffic(deviceID string, bytesIn, bytesOut int64) {
+	device, err := s.deviceRepo.FindByID(deviceID)
+	if err != nil || device == nil {
+		return
+	}
+	now := s.clock.Now()
+	if err := s.trafficRepo.Add(device.ID, device.ICCID, model.TrafficMonth(now), bytesIn, bytesOut, now); err != nil {
+		log.Printf("Failed to record traffic of device %s: %v", deviceID, err)
+	}
+}
+
+func (s *trafficService) LearnSIM(ctx context.Context, position *model.Position) error {
+	iccid, _ := position.Status["iccid"].(string)
+	if iccid == "" {
+		return nil
+	}
+	device, err := s.deviceRepo.FindByID(position.DeviceID)
+	if err != nil || device == nil || device.ICCID == iccid {
+		return nil
+	}
+
+	device.ICCID = iccid
+	if err := s.deviceRepo.Update(device); err != nil {
+		log.Printf("Failed to store the ICCID of device %s: %v", device.ID, err)
+	}
+	return nil
+}
+
+func (s *trafficService) SIMUsage(userID, month string) ([]*model.SIMUsage, error) {
+	if month == "" {
+		month = model.TrafficMonth(s.clock.Now())
+	} else if _, err := time.Parse(model.TrafficMonthLayout, month); err != nil {
+		return nil, ErrInvalidMonth
+	}
+
+	deviceIDs, err := newDeviceAccess(userID, s.orgMemberRepo).devices(s.deviceRepo, model.DeviceFilter{})
+	if err != nil {
+		return nil, err
+	}
+	if len(deviceIDs) == 0 {
+		return []*model.SIMUsage{}, nil
+	}
+	records, err := s.trafficRepo.FindMonth(deviceIDs, month)
+	if err != nil {
+		return nil, err
+	}
+
+	// Traffic on a SIM is counted together across devices; traffic before
+	// a device reported its SIM stays with the device
+	usages := []*model.SIMUsage{}
+	bySIM := make(map[string]*model.SIMUsage)
+	for _, record := range records {
+		key := "iccid:" + record.ICCID
+		if record.ICCID == "" {
+			key = "device:" + record.DeviceID
+		}
+		usage, ok := bySIM[key]
+		if !ok {
+			usage = &model.SIMUsage{ICCID: record.ICCID, DeviceIDs: []string{}, Month: month}
+			if record.ICCID == "" {
+				if device, err := s.deviceRepo.FindByID(record.DeviceID); err == nil && device != nil {
+					usage.Phone = device.Phone
+				}
+			}
+			bySIM[key] = usage
+			usages = append(usages, usage)
+		}
+		usage.DeviceIDs = append(usage.DeviceIDs, record.DeviceID)
+		usage.BytesIn += record.BytesIn
+		usage.BytesOut += record.BytesOut
+		usage.Bytes += record.BytesIn + record.BytesOut
+	}
+
+	sort.SliceStable(usages, func(i, j int) bool {
+		return usages[i].Bytes > usages[j].Bytes
+	})
+	return usages, nil
+}
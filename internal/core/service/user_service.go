@@ -2,6 +2,7 @@ package service
 
 import (
     "errors"
+    "tracking/internal/core/locale"
     "tracking/internal/core/model"
     "tracking/internal/core/repository"
 )
@@ -12,6 +13,8 @@ type UserService interface {
     DeleteUser(id string) error
     GetUser(id string) (*model.User, error)
     AuthenticateUser(email, password string) (*model.User, error)
+    // SetLocale sets the user's preferred locale; empty clears it
+    SetLocale(id, tag string) error
 }
 
 type userService struct {
@@ -83,3 +86,18 @@ func (s *userService) AuthenticateUser(email, password string) (*model.User, err
 
     return user, nil
 }
+
+func (s *userService) SetLocale(id, tag string) error {
+    if tag != "" && !locale.IsSupported(tag) {
+        return errors.New("unsupported locale")
+    }
+    user, err := s.userRepo.FindByID(id)
+    if err != nil {
+        return err
+    }
+    if user == nil {
+        return errors.New("user not found")
+    }
+    user.Locale = tag
+    return s.userRepo.Update(user)
+}
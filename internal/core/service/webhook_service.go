@@ -0,0 +1,186 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"tracking/internal/core/model"
+	"tracking/internal/core/repository"
+	"tracking/internal/core/util"
+)
+
+// MaxWebhooks bounds the webhooks of one organization or user
+const MaxWebhooks = 20
+
+// Common webhook errors
+var (
+	ErrWebhookNotFound = errors.New("webhook not found")
+	ErrInvalidWebhook  = errors.New("invalid webhook")
+)
+
+// WebhookService keeps the URLs events are posted to. Webhooks are managed
+// in the organization context of a request, where every member reaches
+// them, or outside any organization by the user who set them.
+type WebhookService interface {
+	// CreateWebhook sets a webhook of the organization, or a personal
+	// webhook of the user when organizationID is empty
+	CreateWebhook(userID, organizationID string, webhook *model.Webhook) (*model.Webhook, error)
+	// UpdateWebhook replaces the URL, secret and event types of a webhook
+	UpdateWebhook(id, userID, organizationID string, webhook *model.Webhook) (*model.Webhook, error)
+	DeleteWebhook(id, userID, organizationID string) error
+	GetWebhook(id, userID, organizationID string) (*model.Webhook, error)
+	// GetWebhooks returns the webhooks of the organization, or the user's
+	// personal webhooks when organizationID is empty, by URL
+	GetWebhooks(userID, organizationID string) ([]*model.Webhook, error)
+	// Targets returns the webhooks hearing of the event's device that
+	// accept its type
+	Targets(event *model.Event) ([]*model.Webhook, error)
+}
+
+type webhookService struct {
+	webhookRepo repository.WebhookRepository
+	deviceRepo  repository.DeviceRepository
+	clock       util.Clock
+}
+
+func NewWebhookService(webhookRepo repository.WebhookRepository, deviceRepo repository.DeviceRepository, clock util.Clock) WebhookService {
+	return &webhookService{
+		webhookRepo: webhookRepo,
+		deviceRepo:  deviceRepo,
+		clock:       clock,
+	}
+}
+
+func (s *webhookService) CreateWebhook(userID, organizationID string, webhook *model.Webhook) (*model.Webhook, error) {
+	existing, err := s.GetWebhooks(userID, organizationID)
+	if err != nil {
+		return nil, err
+	}
+	if len(existing) >= MaxWebhooks {
+		return nil, fmt.Errorf("%w: at most %d webhooks", ErrInvalidWebhook, MaxWebhooks)
+	}
+
+	created := *webhook
+	if err := validateWebhook(&created); err != nil {
+		return nil, err
+	}
+	now := s.clock.Now()
+	created.ID = model.GenerateID()
+	created.UserID = userID
+	created.OrganizationID = organizationID
+	created.CreatedAt = now
+	created.UpdatedAt = now
+	if err := s.webhookRepo.Create(&created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+func (s *webhookService) UpdateWebhook(id, userID, organizationID string, webhook *model.Webhook) (*model.Webhook, error) {
+	stored, err := s.GetWebhook(id, userID, organizationID)
+	if err != nil {
+		return nil, err
+	}
+
+	updated := *webhook
+	if err := validateWebhook(&updated); err != nil {
+		return nil, err
+	}
+	updated.ID = stored.ID
+	updated.UserID = stored.UserID
+	updated.OrganizationID = stored.OrganizationID
+	updated.CreatedAt = stored.CreatedAt
+	updated.UpdatedAt = s.clock.Now()
+	if err := s.webhookRepo.Update(&updated); err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+func (s *webhookService) DeleteWebhook(id, userID, organizationID string) error {
+	if _, err := s.GetWebhook(id, userID, organizationID); err != nil {
+		return err
+	}
+	return s.webhookRepo.Delete(id)
+}
+
+func (s *webhookService) GetWebhook(id, userID, organizationID string) (*model.Webhook, error) {
+	if id == "" || userID == "" {
+		return nil, ErrWebhookNotFound
+	}
+
+	webhook, err := s.webhookRepo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	// Webhooks out of the request's reach are reported as missing
+	if webhook == nil || webhook.OrganizationID != organizationID ||
+		(organizationID == "" && webhook.UserID != userID) {
+		return nil, ErrWebhookNotFound
+	}
+	return webhook, nil
+}
+
+func (s *webhookService) GetWebhooks(userID, organizationID string) ([]*model.Webhook, error) {
+	if userID == "" {
+		return nil, errors.New("invalid user ID")
+	}
+
+	var webhooks []*model.Webhook
+	var err error
+	if organizationID != "" {
+		webhooks, err = s.webhookRepo.FindByOrganizationID(organizationID)
+	} else {
+		webhooks, err = s.webhookRepo.FindPersonal(userID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if webhooks == nil {
+		webhooks = []*model.Webhook{}
+	}
+	return webhooks, nil
+}
+
+func (s *webhookService) Targets(event *model.Event) ([]*model.Webhook, error) {
+	device, err := s.deviceRepo.FindByID(event.DeviceID)
+	if err != nil || device == nil {
+		return nil, err
+	}
+
+	var webhooks []*model.Webhook
+	switch {
+	case device.OrganizationID != "":
+		webhooks, err = s.webhookRepo.FindByOrganizationID(device.OrganizationID)
+	case device.UserID != "":
+		webhooks, err = s.webhookRepo.FindPersonal(device.UserID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var targets []*model.Webhook
+	for _, webhook := range webhooks {
+		if webhook.Accepts(event.Type) {
+			targets = append(targets, webhook)
+		}
+	}
+	return targets, nil
+}
+
+// validateWebhook normalizes a webhook and checks its URL and event types
+func validateWebhook(webhook *model.Webhook) error {
+	webhook.URL = strings.TrimSpace(webhook.URL)
+	target, err := url.Parse(webhook.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return fmt.Errorf("%w: an http or https URL is required", ErrInvalidWebhook)
+	}
+	for _, eventType := range webhook.EventTypes {
+		if !slices.Contains(model.EventTypes, eventType) {
+			return fmt.Errorf("%w: unknown event type %q", ErrInvalidWebhook, eventType)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package speedlimit
+
+import (
+	"context"
+	"sync"
+
+	"tracking/internal/core/hook"
+	"tracking/internal/core/model"
+	"tracking/internal/core/repository"
+)
+
+// Position attributes set by the detector
+const (
+	AttributeSpeedLimit       = "speedLimit"       // km/h
+	AttributeSpeedLimitSource = "speedLimitSource" // SourceRoad or SourceDevice
+	AttributeRoadID           = "roadId"
+	AttributeOverspeed        = "overspeed"
+)
+
+// Where a speed limit came from
+const (
+	SourceRoad   = "road"
+	SourceDevice = "device"
+)
+
+// Detector annotates positions with the speed limit in force and raises
+// an overspeed event when a device goes over it. The limit of the matched
+// road wins; where the road or its limit is unknown, the device's own
+// SpeedLimit applies.
+type Detector struct {
+	resolver   *Resolver // Nil when no road data is configured
+	deviceRepo repository.DeviceRepository
+	hooks      *hook.Registry
+	tolerance  float64 // km/h allowed over the limit
+
+	mutex        sync.Mutex
+	overspeeding map[string]bool // By device ID
+}
+
+func NewDetector(resolver *Resolver, deviceRepo repository.DeviceRepository, hooks *hook.Registry, tolerance float64) *Detector {
+	return &Detector{
+		resolver:     resolver,
+		deviceRepo:   deviceRepo,
+		hooks:        hooks,
+		tolerance:    tolerance,
+		overspeeding: make(map[string]bool),
+	}
+}
+
+// Annotate is a StageDecoded hook recording the limit for the position
+func (d *Detector) Annotate(ctx context.Context, position *model.Position) error {
+	if !position.Valid {
+		return nil
+	}
+
+	limit, source, roadID := d.limit(ctx, position)
+	if limit <= 0 {
+		return nil
+	}
+
+	if position.Status == nil {
+		position.Status = make(map[string]interface{})
+	}
+	position.Status[AttributeSpeedLimit] = limit
+	position.Status[AttributeSpeedLimitSource] = source
+	if roadID != "" {
+		position.Status[AttributeRoadID] = roadID
+	}
+	position.Status[AttributeOverspeed] = position.Speed > limit+d.tolerance
+	return nil
+}
+
+// Check is a StageStored hook raising EventOverspeed when a device that
+// was within the limit exceeds it. Positions are judged in arrival order.
+func (d *Detector) Check(ctx context.Context, position *model.Position) error {
+	over, known := position.Status[AttributeOverspeed].(bool)
+	if !known {
+		return nil
+	}
+
+	d.mutex.Lock()
+	was := d.overspeeding[position.DeviceID]
+	if over {
+		d.overspeeding[position.DeviceID] = true
+	} else {
+		delete(d.overspeeding, position.DeviceID)
+	}
+	d.mutex.Unlock()
+
+	if !over || was {
+		return nil
+	}
+
+	event := model.NewEvent(model.EventOverspeed, position.DeviceID, position.Timestamp)
+	event.PositionID = position.ID
+	event.Attributes["speed"] = position.Speed
+	event.Attributes[AttributeSpeedLimit] = position.Status[AttributeSpeedLimit]
+	event.Attributes[AttributeSpeedLimitSource] = position.Status[AttributeSpeedLimitSource]
+	if roadID, ok := position.Status[AttributeRoadID]; ok {
+		event.Attributes[AttributeRoadID] = roadID
+	}
+	d.hooks.Event(event)
+	return nil
+}
+
+// limit picks the road limit, falling back to the device limit
+func (d *Detector) limit(ctx context.Context, position *model.Position) (float64, string, string) {
+	if d.resolver != nil {
+		match := d.resolver.Resolve(ctx, position.Latitude, position.Longitude, position.Speed, position.Course)
+		if match != nil && match.Limit > 0 {
+			return match.Limit, SourceRoad, match.RoadID
+		}
+	}
+
+	device, err := d.deviceRepo.FindByID(position.DeviceID)
+	if err != nil || device == nil || device.SpeedLimit <= 0 {
+		return 0, "", ""
+	}
+	return device.SpeedLimit, SourceDevice, ""
+}
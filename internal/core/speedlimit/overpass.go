@@ -0,0 +1,100 @@
+package speedlimit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Drivable OpenStreetMap highway classes; footways and the like are left
+// out so they cannot capture a vehicle driving alongside them
+const drivableHighways = "^(motorway|trunk|primary|secondary|tertiary|unclassified|residential|living_street|service)(_link)?$"
+
+const mphToKmh = 1.609344
+
+// OverpassProvider reads roads and their maxspeed tags from an Overpass
+// API endpoint, such as https://overpass-api.de/api/interpreter
+type OverpassProvider struct {
+	url    string
+	client *http.Client
+}
+
+func NewOverpassProvider(endpoint string) *OverpassProvider {
+	return &OverpassProvider{
+		url:    endpoint,
+		client: &http.Client{},
+	}
+}
+
+type overpassResponse struct {
+	Elements []struct {
+		Type     string            `json:"type"`
+		ID       int64             `json:"id"`
+		Tags     map[string]string `json:"tags"`
+		Geometry []Point           `json:"geometry"`
+	} `json:"elements"`
+}
+
+// Roads returns the drivable ways inside bounds, tagged or not, so that a
+// position on a road without a limit is not matched to a neighbouring one
+func (p *OverpassProvider) Roads(ctx context.Context, bounds Bounds) ([]Road, error) {
+	query := fmt.Sprintf(`[out:json][timeout:10];way["highway"~"%s"](%f,%f,%f,%f);out tags geom;`,
+		drivableHighways, bounds.South, bounds.West, bounds.North, bounds.East)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url,
+		strings.NewReader(url.Values{"data": {query}}.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("overpass returned status %d", resp.StatusCode)
+	}
+
+	var body overpassResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("invalid overpass response: %v", err)
+	}
+
+	roads := make([]Road, 0, len(body.Elements))
+	for _, element := range body.Elements {
+		if element.Type != "way" || len(element.Geometry) < 2 {
+			continue
+		}
+		limit, _ := ParseMaxSpeed(element.Tags["maxspeed"])
+		roads = append(roads, Road{
+			ID:    strconv.FormatInt(element.ID, 10),
+			Name:  element.Tags["name"],
+			Limit: limit,
+			Path:  element.Geometry,
+		})
+	}
+	return roads, nil
+}
+
+// ParseMaxSpeed converts an OpenStreetMap maxspeed value to km/h. Plain
+// numbers are km/h and "mph" suffixes are converted; values such as
+// "none", "walk" or zone codes like "DE:urban" are not numeric limits.
+func ParseMaxSpeed(value string) (float64, bool) {
+	value = strings.TrimSpace(value)
+	factor := 1.0
+	if number, ok := strings.CutSuffix(value, "mph"); ok {
+		value, factor = strings.TrimSpace(number), mphToKmh
+	}
+
+	limit, err := strconv.ParseFloat(value, 64)
+	if err != nil || limit <= 0 {
+		return 0, false
+	}
+	return limit * factor, true
+}
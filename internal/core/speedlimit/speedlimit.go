@@ -0,0 +1,252 @@
+// Package speedlimit resolves the legal speed limit of the road a position
+// is on, so overspeed can be judged against the road instead of a single
+// per-device threshold
+package speedlimit
+
+import (
+	"context"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"tracking/internal/core/util"
+)
+
+// Point is a WGS84 coordinate
+type Point struct {
+	Latitude  float64 `json:"lat"`
+	Longitude float64 `json:"lon"`
+}
+
+// Bounds is a latitude/longitude box
+type Bounds struct {
+	South, West, North, East float64
+}
+
+// Road is a way with its geometry and posted limit
+type Road struct {
+	ID    string
+	Name  string
+	Limit float64 // km/h, zero when the road has no numeric limit
+	Path  []Point
+}
+
+// Provider fetches the roads inside an area, such as from OpenStreetMap
+type Provider interface {
+	Roads(ctx context.Context, bounds Bounds) ([]Road, error)
+}
+
+// Match is the road a position was matched to
+type Match struct {
+	RoadID   string
+	RoadName string
+	Limit    float64 // km/h, zero when unknown
+	Distance float64 // Metres from the position to the road
+}
+
+const (
+	earthRadius = 6371000.0 // Metres
+
+	// Roads are fetched and cached in tiles of this many degrees, with a
+	// margin so positions near an edge still see the roads beyond it
+	tileSize   = 0.01
+	tileMargin = 0.001
+
+	defaultMatchDistance = 25.0 // Metres, about the error of a consumer fix
+	// Each degree between the course and a road adds this many metres to
+	// its distance, so a position at a junction matches the road it follows
+	headingWeight = 0.3
+	// Below this speed the course is noise and is not used for matching
+	minHeadingSpeed = 5.0 // km/h
+
+	defaultCacheTTL = 24 * time.Hour
+	failureTTL      = time.Minute
+	maxTiles        = 4096
+	fetchTimeout    = 5 * time.Second
+)
+
+// Resolver matches positions to roads. Roads are fetched once per tile
+// and kept for the cache lifetime, so consecutive positions on the same
+// road segments are matched without asking the provider again. A failed
+// fetch is remembered briefly and reported as an unknown limit rather
+// than retried for every position.
+type Resolver struct {
+	provider      Provider
+	clock         util.Clock
+	matchDistance float64
+	cacheTTL      time.Duration
+
+	mutex sync.Mutex
+	tiles map[tileKey]*tile
+}
+
+type tileKey struct {
+	lat, lon int
+}
+
+type tile struct {
+	roads   []Road
+	expires time.Time
+	ready   chan struct{} // Closed once roads are loaded
+}
+
+func NewResolver(provider Provider, clock util.Clock) *Resolver {
+	return &Resolver{
+		provider:      provider,
+		clock:         clock,
+		matchDistance: defaultMatchDistance,
+		cacheTTL:      defaultCacheTTL,
+		tiles:         make(map[tileKey]*tile),
+	}
+}
+
+// SetCacheTTL changes how long fetched roads are kept
+func (r *Resolver) SetCacheTTL(ttl time.Duration) {
+	r.cacheTTL = ttl
+}
+
+// Resolve returns the road nearest to the position, or nil when there is
+// none within the match distance or the roads could not be fetched.
+// course is in degrees and is only used above minHeadingSpeed.
+func (r *Resolver) Resolve(ctx context.Context, lat, lon, speed, course float64) *Match {
+	roads := r.roads(ctx, lat, lon)
+
+	useHeading := speed >= minHeadingSpeed
+	var best *Match
+	bestCost := math.Inf(1)
+	for i := range roads {
+		road := &roads[i]
+		for j := 1; j < len(road.Path); j++ {
+			distance, bearing := projectOnSegment(lat, lon, road.Path[j-1], road.Path[j])
+			if distance > r.matchDistance {
+				continue
+			}
+			cost := distance
+			if useHeading {
+				cost += headingWeight * headingDifference(course, bearing)
+			}
+			if cost < bestCost {
+				bestCost = cost
+				best = &Match{RoadID: road.ID, RoadName: road.Name, Limit: road.Limit, Distance: distance}
+			}
+		}
+	}
+	return best
+}
+
+// roads returns the cached roads of the position's tile, fetching them on
+// a miss. Concurrent misses for one tile share a single fetch.
+func (r *Resolver) roads(ctx context.Context, lat, lon float64) []Road {
+	key := tileKey{lat: int(math.Floor(lat / tileSize)), lon: int(math.Floor(lon / tileSize))}
+	now := r.clock.Now()
+
+	r.mutex.Lock()
+	t, ok := r.tiles[key]
+	if ok {
+		select {
+		case <-t.ready:
+			if now.After(t.expires) {
+				ok = false
+			}
+		default:
+		}
+	}
+	if !ok {
+		r.evictExpired(now)
+		t = &tile{ready: make(chan struct{})}
+		r.tiles[key] = t
+		r.mutex.Unlock()
+		r.load(ctx, key, t)
+		return t.roads
+	}
+	r.mutex.Unlock()
+
+	select {
+	case <-t.ready:
+		return t.roads
+	case <-ctx.Done():
+		return nil
+	}
+}
+
+func (r *Resolver) load(ctx context.Context, key tileKey, t *tile) {
+	south := float64(key.lat) * tileSize
+	west := float64(key.lon) * tileSize
+	bounds := Bounds{
+		South: south - tileMargin,
+		West:  west - tileMargin,
+		North: south + tileSize + tileMargin,
+		East:  west + tileSize + tileMargin,
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, fetchTimeout)
+	defer cancel()
+
+	roads, err := r.provider.Roads(ctx, bounds)
+	ttl := r.cacheTTL
+	if err != nil {
+		log.Printf("[SpeedLimit] failed to fetch roads for %.3f,%.3f: %v", south, west, err)
+		roads, ttl = nil, failureTTL
+	}
+	t.roads = roads
+	t.expires = r.clock.Now().Add(ttl)
+	close(t.ready)
+}
+
+// evictExpired keeps the cache bounded; it must be called with the mutex held
+func (r *Resolver) evictExpired(now time.Time) {
+	if len(r.tiles) < maxTiles {
+		return
+	}
+	for key, t := range r.tiles {
+		select {
+		case <-t.ready:
+			if now.After(t.expires) {
+				delete(r.tiles, key)
+			}
+		default:
+		}
+	}
+	if len(r.tiles) >= maxTiles {
+		for key, t := range r.tiles {
+			select {
+			case <-t.ready:
+				delete(r.tiles, key)
+			default:
+			}
+		}
+	}
+}
+
+// projectOnSegment returns the distance in metres from a point to the
+// segment a-b and the segment's bearing in degrees. Distances are small,
+// so a flat projection around the point is accurate enough.
+func projectOnSegment(lat, lon float64, a, b Point) (float64, float64) {
+	scale := math.Cos(lat * math.Pi / 180)
+	toMetres := func(p Point) (float64, float64) {
+		x := (p.Longitude - lon) * math.Pi / 180 * earthRadius * scale
+		y := (p.Latitude - lat) * math.Pi / 180 * earthRadius
+		return x, y
+	}
+	ax, ay := toMetres(a)
+	bx, by := toMetres(b)
+
+	dx, dy := bx-ax, by-ay
+	bearing := math.Mod(math.Atan2(dx, dy)*180/math.Pi+360, 360)
+
+	length := dx*dx + dy*dy
+	if length == 0 {
+		return math.Hypot(ax, ay), bearing
+	}
+	// The point is the origin, so project it onto the segment by -a
+	t := math.Max(0, math.Min(1, -(ax*dx+ay*dy)/length))
+	return math.Hypot(ax+t*dx, ay+t*dy), bearing
+}
+
+// headingDifference is the angle between a course and a road, which may be
+// driven in either direction
+func headingDifference(course, bearing float64) float64 {
+	diff := math.Mod(math.Abs(course-bearing), 180)
+	return math.Min(diff, 180-diff)
+}
@@ -0,0 +1,155 @@
+package tiles
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"tracking/internal/cache"
+	"tracking/internal/core/util"
+)
+
+// DiskCache keeps tiles as files below a directory, one per tile, so they
+// survive restarts. Each file starts with a line giving its expiry and
+// content type.
+type DiskCache struct {
+	dir   string
+	ttl   time.Duration
+	clock util.Clock
+}
+
+func NewDiskCache(dir string, ttl time.Duration, clock util.Clock) (*DiskCache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("tile cache directory: %w", err)
+	}
+	return &DiskCache{dir: dir, ttl: ttl, clock: clock}, nil
+}
+
+func (c *DiskCache) Get(ctx context.Context, key string) (*Tile, error) {
+	data, err := os.ReadFile(c.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	header, data, ok := bytes.Cut(data, []byte("\n"))
+	if !ok {
+		return nil, nil
+	}
+	expires, contentType, ok := bytes.Cut(header, []byte("\t"))
+	if !ok {
+		return nil, nil
+	}
+	until, err := strconv.ParseInt(string(expires), 10, 64)
+	if err != nil || c.clock.Now().Unix() >= until {
+		return nil, nil
+	}
+	return &Tile{ContentType: string(contentType), Data: data}, nil
+}
+
+func (c *DiskCache) Put(ctx context.Context, key string, tile *Tile) error {
+	path := c.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	var buffer bytes.Buffer
+	fmt.Fprintf(&buffer, "%d\t%s\n", c.clock.Now().Add(c.ttl).Unix(), tile.ContentType)
+	buffer.Write(tile.Data)
+
+	// Readers see the old tile or the new one, never part of it
+	temp, err := os.CreateTemp(filepath.Dir(path), ".tile-*")
+	if err != nil {
+		return err
+	}
+	if _, err := temp.Write(buffer.Bytes()); err != nil {
+		temp.Close()
+		os.Remove(temp.Name())
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		os.Remove(temp.Name())
+		return err
+	}
+	return os.Rename(temp.Name(), path)
+}
+
+func (c *DiskCache) path(key string) string {
+	return filepath.Join(c.dir, filepath.FromSlash(key)+".tile")
+}
+
+// RedisCache keeps tiles in the shared Redis cache. Nothing is kept while
+// Redis is disabled.
+type RedisCache struct {
+	ttl time.Duration
+}
+
+func NewRedisCache(ttl time.Duration) *RedisCache {
+	return &RedisCache{ttl: ttl}
+}
+
+func (c *RedisCache) Get(ctx context.Context, key string) (*Tile, error) {
+	var tile Tile
+	if err := cache.Get(ctx, "tile:"+key, &tile); err != nil {
+		return nil, nil
+	}
+	return &tile, nil
+}
+
+func (c *RedisCache) Put(ctx context.Context, key string, tile *Tile) error {
+	return cache.Set(ctx, "tile:"+key, tile, c.ttl)
+}
+
+// maxMemoryTiles bounds the tiles a MemoryCache holds
+const maxMemoryTiles = 10000
+
+// MemoryCache keeps tiles in memory, for tests and deployments with
+// neither a cache directory nor Redis. Tiles are lost on restart.
+type MemoryCache struct {
+	ttl   time.Duration
+	clock util.Clock
+
+	mutex sync.Mutex
+	tiles map[string]memoryTile
+}
+
+type memoryTile struct {
+	tile      *Tile
+	expiresAt time.Time
+}
+
+func NewMemoryCache(ttl time.Duration, clock util.Clock) *MemoryCache {
+	return &MemoryCache{
+		ttl:   ttl,
+		clock: clock,
+		tiles: make(map[string]memoryTile),
+	}
+}
+
+func (c *MemoryCache) Get(ctx context.Context, key string) (*Tile, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	entry, ok := c.tiles[key]
+	if !ok || !c.clock.Now().Before(entry.expiresAt) {
+		return nil, nil
+	}
+	return entry.tile, nil
+}
+
+func (c *MemoryCache) Put(ctx context.Context, key string, tile *Tile) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if len(c.tiles) >= maxMemoryTiles {
+		c.tiles = make(map[string]memoryTile)
+	}
+	c.tiles[key] = memoryTile{tile: tile, expiresAt: c.clock.Now().Add(c.ttl)}
+	return nil
+}
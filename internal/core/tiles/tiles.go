@@ -0,0 +1,173 @@
+// Package tiles serves map tiles from a provider through the server, which
+// adds the provider's key and caches what it fetched, so clients never see
+// the key and each tile is fetched once
+package tiles
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"tracking/internal/core/util"
+)
+
+// MaxZoom is the deepest zoom level served
+const MaxZoom = 22
+
+const (
+	fetchTimeout = 10 * time.Second
+	maxTileSize  = 2 << 20
+)
+
+// Common tile errors
+var (
+	ErrInvalidTile   = errors.New("invalid tile coordinates")
+	ErrTileNotFound  = errors.New("tile not found")
+	ErrQuotaExceeded = errors.New("tile quota exceeded")
+)
+
+// Tile is the image of one map square
+type Tile struct {
+	ContentType string `json:"contentType"`
+	Data        []byte `json:"data"`
+}
+
+// Cache keeps fetched tiles by key
+type Cache interface {
+	// Get returns the tile stored under key, or nil when there is none or
+	// it expired
+	Get(ctx context.Context, key string) (*Tile, error)
+	Put(ctx context.Context, key string, tile *Tile) error
+}
+
+// Proxy fetches tiles from a provider URL template such as
+// https://tiles.example.com/{z}/{x}/{y}.png?key={key}. The key is put in
+// place of {key}, or sent as the key parameter when the template has no
+// place for it. Each organization may fetch a number of tiles a day from
+// the provider; tiles from the cache do not count against it.
+type Proxy struct {
+	template string
+	key      string
+	cache    Cache
+	client   *http.Client
+	clock    util.Clock
+	quota    int // Fetches per organization and UTC day; zero leaves them unlimited
+
+	mutex sync.Mutex
+	usage map[string]int // Fetches per organization on day
+	day   string
+}
+
+func NewProxy(template, key string, cache Cache, clock util.Clock, quota int) *Proxy {
+	return &Proxy{
+		template: template,
+		key:      key,
+		cache:    cache,
+		client:   &http.Client{Timeout: fetchTimeout},
+		clock:    clock,
+		quota:    quota,
+		usage:    make(map[string]int),
+	}
+}
+
+// Tile returns the tile at zoom z, column x and row y for the
+// organization, from the cache when it holds it
+func (p *Proxy) Tile(ctx context.Context, orgID string, z, x, y int) (*Tile, error) {
+	if z < 0 || z > MaxZoom || x < 0 || y < 0 || x >= 1<<z || y >= 1<<z {
+		return nil, ErrInvalidTile
+	}
+	key := fmt.Sprintf("%d/%d/%d", z, x, y)
+
+	if tile, err := p.cache.Get(ctx, key); err == nil && tile != nil {
+		return tile, nil
+	}
+
+	p.mutex.Lock()
+	if day := p.clock.Now().UTC().Format("2006-01-02"); day != p.day {
+		p.day = day
+		p.usage = make(map[string]int)
+	}
+	if p.quota > 0 && p.usage[orgID] >= p.quota {
+		p.mutex.Unlock()
+		return nil, ErrQuotaExceeded
+	}
+	p.usage[orgID]++
+	p.mutex.Unlock()
+
+	tile, err := p.fetch(ctx, z, x, y)
+	if err != nil {
+		return nil, err
+	}
+	// A tile that could not be cached is still served
+	_ = p.cache.Put(ctx, key, tile)
+	return tile, nil
+}
+
+// Remaining returns how many fetches the organization has left today, or
+// -1 when they are unlimited
+func (p *Proxy) Remaining(orgID string) int {
+	if p.quota <= 0 {
+		return -1
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.day != p.clock.Now().UTC().Format("2006-01-02") {
+		return p.quota
+	}
+	return max(p.quota-p.usage[orgID], 0)
+}
+
+func (p *Proxy) fetch(ctx context.Context, z, x, y int) (*Tile, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.tileURL(z, x, y), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrTileNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("tile provider returned %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxTileSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxTileSize {
+		return nil, fmt.Errorf("tile larger than %d bytes", maxTileSize)
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = http.DetectContentType(data)
+	}
+	return &Tile{ContentType: contentType, Data: data}, nil
+}
+
+func (p *Proxy) tileURL(z, x, y int) string {
+	tileURL := strings.NewReplacer(
+		"{z}", strconv.Itoa(z),
+		"{x}", strconv.Itoa(x),
+		"{y}", strconv.Itoa(y),
+		"{key}", url.QueryEscape(p.key),
+	).Replace(p.template)
+	if p.key == "" || strings.Contains(p.template, "{key}") {
+		return tileURL
+	}
+	if strings.Contains(tileURL, "?") {
+		return tileURL + "&key=" + url.QueryEscape(p.key)
+	}
+	return tileURL + "?key=" + url.QueryEscape(p.key)
+}
@@ -0,0 +1,51 @@
+package util
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock provides the current time so time-dependent logic can be tested
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// SystemClock is the Clock backed by the wall clock
+var SystemClock Clock = systemClock{}
+
+// FixedClock is a Clock that only moves when told to
+type FixedClock struct {
+	now   time.Time
+	mutex sync.RWMutex
+}
+
+// NewFixedClock creates a FixedClock set to the given time
+func NewFixedClock(now time.Time) *FixedClock {
+	return &FixedClock{now: now}
+}
+
+func (c *FixedClock) Now() time.Time {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.now
+}
+
+// Set moves the clock to the given time
+func (c *FixedClock) Set(now time.Time) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.now = now
+}
+
+// Advance moves the clock forward by d
+func (c *FixedClock) Advance(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.now = c.now.Add(d)
+}
@@ -0,0 +1,26 @@
+package util
+
+import "math"
+
+const earthRadius = 6371000.0 // Meters
+
+// CoordinatePrecision is how many decimal places coordinates are kept to,
+// about a centimetre and finer than any tracker reports
+const CoordinatePrecision = 7
+
+// RoundCoordinate rounds degrees to CoordinatePrecision decimal places, so
+// values converted from degrees and minutes are stored without float
+// artifacts such as 22.629189999999998
+func RoundCoordinate(degrees float64) float64 {
+	return math.Round(degrees*1e7) / 1e7
+}
+
+// Distance returns the haversine distance in meters between two points
+// given in degrees
+func Distance(lat1, lon1, lat2, lon2 float64) float64 {
+	rlat1, rlat2 := lat1*math.Pi/180, lat2*math.Pi/180
+	dLat := rlat2 - rlat1
+	dLon := (lon2 - lon1) * math.Pi / 180
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(rlat1)*math.Cos(rlat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(min(h, 1)))
+}
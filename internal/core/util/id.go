@@ -1,10 +1,18 @@
 package util
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
 	"time"
 )
 
-// GenerateID generates a time-based unique identifier
+// GenerateID generates a time-based unique identifier. It panics when the
+// system's random source fails, as no unique ID can be made without it.
 func GenerateID() string {
-	return time.Now().Format("20060102150405")
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		panic(fmt.Sprintf("util: reading random bytes for an ID: %v", err))
+	}
+	return time.Now().Format("20060102150405") + hex.EncodeToString(suffix)
 }
@@ -0,0 +1,279 @@
+// Package watchdog reconciles the positions the TCP and HTTP ingest paths
+// hand to the pipeline with the positions stored, to catch positions lost
+// without an error surfacing anywhere
+package watchdog
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"time"
+	"tracking/internal/core/hook"
+	"tracking/internal/core/model"
+	"tracking/internal/core/util"
+)
+
+const (
+	// DefaultWindow is how far back a check looks
+	DefaultWindow = time.Hour
+	// settle leaves out the latest minute, whose positions may still be in
+	// flight between receipt and storage
+	settle = time.Minute
+	// minLatencySamples keeps a few slow positions on a quiet server from
+	// breaching the SLA
+	minLatencySamples = 10
+)
+
+// LatencyFunc returns the 95th percentile of recent ingest latencies and
+// how many positions it was taken over
+type LatencyFunc func() (time.Duration, int)
+
+// counts are the tallies of one device within one minute
+type counts struct {
+	received map[string]int64 // By ingest source
+	rejected int64
+	stored   int64
+}
+
+// Discrepancy describes a device with positions unaccounted for
+type Discrepancy struct {
+	DeviceID string           `json:"deviceId"`
+	Received map[string]int64 `json:"received"` // By ingest source
+	Rejected int64            `json:"rejected"` // Turned away by a hook on purpose
+	Stored   int64            `json:"stored"`
+	Missing  int64            `json:"missing"` // Received, neither rejected nor stored
+}
+
+// Report sums the tallies of every device over a window
+type Report struct {
+	From          time.Time        `json:"from"`
+	To            time.Time        `json:"to"`
+	Received      map[string]int64 `json:"received"` // By ingest source
+	Rejected      int64            `json:"rejected"`
+	Stored        int64            `json:"stored"`
+	Discrepancies []Discrepancy    `json:"discrepancies"`
+}
+
+// Watchdog counts positions per device and minute from the hook registry.
+// A position is missing when it was received but neither rejected by a
+// hook nor stored; a failed write counts even when the device later
+// resends the frame.
+type Watchdog struct {
+	clock     util.Clock
+	hooks     *hook.Registry
+	window    time.Duration
+	threshold int64 // Missing positions a device may have before an alert
+
+	mutex   sync.Mutex
+	minutes map[int64]map[string]*counts // Unix minute, then device ID
+	alerted map[string]int64             // Missing count last alerted per device
+
+	sla      time.Duration // Zero leaves latency unchecked
+	latency  LatencyFunc
+	breached bool // Raised for the current breach, until back within the SLA
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// New returns a Watchdog counting the positions passing through hooks. A
+// device is reported once more than threshold of its positions are missing.
+func New(clock util.Clock, hooks *hook.Registry, window time.Duration, threshold int) *Watchdog {
+	if window <= 0 {
+		window = DefaultWindow
+	}
+	if threshold < 0 {
+		threshold = 0
+	}
+	w := &Watchdog{
+		clock:     clock,
+		hooks:     hooks,
+		window:    window,
+		threshold: int64(threshold),
+		minutes:   make(map[int64]map[string]*counts),
+		alerted:   make(map[string]int64),
+	}
+	hooks.OnReceived(func(source string, position *model.Position) {
+		w.add(position.DeviceID, func(c *counts) { c.received[source]++ })
+	})
+	hooks.OnRejected(func(position *model.Position, err error) {
+		w.add(position.DeviceID, func(c *counts) { c.rejected++ })
+	})
+	hooks.OnPosition(func(position *model.Position) {
+		w.add(position.DeviceID, func(c *counts) { c.stored++ })
+	})
+	return w
+}
+
+// SetLatencySLA has Check raise an ingestLatency event when the 95th
+// percentile from latency exceeds sla, once per breach
+func (w *Watchdog) SetLatencySLA(sla time.Duration, latency LatencyFunc) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.sla = sla
+	w.latency = latency
+}
+
+func (w *Watchdog) add(deviceID string, update func(*counts)) {
+	minute := w.clock.Now().Unix() / 60
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	devices, ok := w.minutes[minute]
+	if !ok {
+		devices = make(map[string]*counts)
+		w.minutes[minute] = devices
+	}
+	c, ok := devices[deviceID]
+	if !ok {
+		c = &counts{received: make(map[string]int64)}
+		devices[deviceID] = c
+	}
+	update(c)
+}
+
+// Report returns the tallies of the window ending a minute ago, listing
+// every device with more missing positions than the threshold
+func (w *Watchdog) Report() Report {
+	to := w.clock.Now().Add(-settle).Truncate(time.Minute)
+	from := to.Add(-w.window)
+	report := Report{From: from, To: to, Received: make(map[string]int64)}
+
+	w.mutex.Lock()
+	devices := make(map[string]*Discrepancy)
+	for minute, tallies := range w.minutes {
+		if minute < from.Unix()/60 || minute >= to.Unix()/60 {
+			continue
+		}
+		for deviceID, c := range tallies {
+			d, ok := devices[deviceID]
+			if !ok {
+				d = &Discrepancy{DeviceID: deviceID, Received: make(map[string]int64)}
+				devices[deviceID] = d
+			}
+			for source, n := range c.received {
+				d.Received[source] += n
+				report.Received[source] += n
+			}
+			d.Rejected += c.rejected
+			d.Stored += c.stored
+			report.Rejected += c.rejected
+			report.Stored += c.stored
+		}
+	}
+	w.mutex.Unlock()
+
+	for _, d := range devices {
+		var received int64
+		for _, n := range d.Received {
+			received += n
+		}
+		if d.Missing = received - d.Rejected - d.Stored; d.Missing > w.threshold {
+			report.Discrepancies = append(report.Discrepancies, *d)
+		}
+	}
+	sort.Slice(report.Discrepancies, func(i, j int) bool {
+		return report.Discrepancies[i].DeviceID < report.Discrepancies[j].DeviceID
+	})
+	return report
+}
+
+// Check reports the window and raises an ingestDiscrepancy event for every
+// device whose missing positions grew since it was last raised, and an
+// ingestLatency event when latency newly exceeds the SLA. Tallies older
+// than the window are dropped.
+func (w *Watchdog) Check() Report {
+	report := w.Report()
+
+	w.mutex.Lock()
+	for minute := range w.minutes {
+		if minute < report.From.Unix()/60 {
+			delete(w.minutes, minute)
+		}
+	}
+	var raise []Discrepancy
+	discrepant := make(map[string]bool, len(report.Discrepancies))
+	for _, d := range report.Discrepancies {
+		discrepant[d.DeviceID] = true
+		if d.Missing > w.alerted[d.DeviceID] {
+			w.alerted[d.DeviceID] = d.Missing
+			raise = append(raise, d)
+		}
+	}
+	for deviceID := range w.alerted {
+		if !discrepant[deviceID] {
+			delete(w.alerted, deviceID)
+		}
+	}
+	w.mutex.Unlock()
+
+	for _, d := range raise {
+		log.Printf("[Watchdog] device %s: %d of its positions missing since %s (received %v, rejected %d, stored %d)",
+			d.DeviceID, d.Missing, report.From.Format(time.RFC3339), d.Received, d.Rejected, d.Stored)
+		event := model.NewEvent(model.EventIngestDiscrepancy, d.DeviceID, report.To)
+		event.Attributes["received"] = d.Received
+		event.Attributes["rejected"] = d.Rejected
+		event.Attributes["stored"] = d.Stored
+		event.Attributes["missing"] = d.Missing
+		event.Attributes["from"] = report.From
+		w.hooks.Event(event)
+	}
+	w.checkLatency()
+	return report
+}
+
+// checkLatency raises an ingestLatency event when the 95th percentile of
+// recent ingest latencies crosses the SLA
+func (w *Watchdog) checkLatency() {
+	w.mutex.Lock()
+	sla, latency := w.sla, w.latency
+	w.mutex.Unlock()
+	if sla <= 0 || latency == nil {
+		return
+	}
+	p95, samples := latency()
+	breached := samples >= minLatencySamples && p95 > sla
+
+	w.mutex.Lock()
+	raise := breached && !w.breached
+	w.breached = breached
+	w.mutex.Unlock()
+	if !raise {
+		return
+	}
+	log.Printf("[Watchdog] ingest latency p95 %s over %d positions exceeds the %s SLA", p95, samples, sla)
+	event := model.NewEvent(model.EventIngestLatency, "", w.clock.Now())
+	event.Attributes["p95Ms"] = float64(p95) / float64(time.Millisecond)
+	event.Attributes["slaMs"] = float64(sla) / float64(time.Millisecond)
+	event.Attributes["samples"] = samples
+	w.hooks.Event(event)
+}
+
+// Start runs Check every interval until Stop
+func (w *Watchdog) Start(interval time.Duration) {
+	w.stop = make(chan struct{})
+	w.done = make(chan struct{})
+	go func() {
+		defer close(w.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				w.Check()
+			case <-w.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop ends the checks started by Start
+func (w *Watchdog) Stop() {
+	if w.stop == nil {
+		return
+	}
+	close(w.stop)
+	<-w.done
+	w.stop = nil
+}
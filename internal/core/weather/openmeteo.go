@@ -0,0 +1,81 @@
+package weather
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// OpenMeteoProvider reads hourly weather from an Open-Meteo endpoint, such
+// as https://api.open-meteo.com/v1/forecast, which also serves recent
+// past hours. The service needs no API key.
+type OpenMeteoProvider struct {
+	url    string
+	client *http.Client
+}
+
+func NewOpenMeteoProvider(endpoint string) *OpenMeteoProvider {
+	return &OpenMeteoProvider{
+		url:    endpoint,
+		client: &http.Client{},
+	}
+}
+
+type openMeteoResponse struct {
+	Hourly struct {
+		Time          []string  `json:"time"`
+		Temperature   []float64 `json:"temperature_2m"`
+		Precipitation []float64 `json:"precipitation"`
+		WindSpeed     []float64 `json:"wind_speed_10m"`
+		WeatherCode   []int     `json:"weather_code"`
+	} `json:"hourly"`
+}
+
+func (p *OpenMeteoProvider) Conditions(ctx context.Context, lat, lon float64, hour time.Time) (*Conditions, error) {
+	stamp := hour.UTC().Format("2006-01-02T15:04")
+	query := url.Values{
+		"latitude":   {strconv.FormatFloat(lat, 'f', 4, 64)},
+		"longitude":  {strconv.FormatFloat(lon, 'f', 4, 64)},
+		"hourly":     {"temperature_2m,precipitation,wind_speed_10m,weather_code"},
+		"start_hour": {stamp},
+		"end_hour":   {stamp},
+		"timezone":   {"GMT"},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.url+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("open-meteo returned status %d", resp.StatusCode)
+	}
+
+	var body openMeteoResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("invalid open-meteo response: %v", err)
+	}
+
+	hourly := body.Hourly
+	for i, t := range hourly.Time {
+		if t != stamp || i >= len(hourly.Temperature) || i >= len(hourly.Precipitation) ||
+			i >= len(hourly.WindSpeed) || i >= len(hourly.WeatherCode) {
+			continue
+		}
+		return &Conditions{
+			Temperature:   hourly.Temperature[i],
+			Precipitation: hourly.Precipitation[i],
+			WindSpeed:     hourly.WindSpeed[i],
+			Code:          hourly.WeatherCode[i],
+		}, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,209 @@
+// Package weather attaches the weather at the time and place of an
+// incident to alarm positions and events, for context in reports
+package weather
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"tracking/internal/core/model"
+	"tracking/internal/core/repository"
+	"tracking/internal/core/util"
+)
+
+// AttributeWeather is the position status and event attribute holding the
+// Conditions
+const AttributeWeather = "weather"
+
+// Conditions is the weather over one hour at one place
+type Conditions struct {
+	Temperature   float64 `json:"temperature"`   // °C
+	Precipitation float64 `json:"precipitation"` // mm over the hour
+	WindSpeed     float64 `json:"windSpeed"`     // km/h
+	Code          int     `json:"code"`          // WMO weather interpretation code
+	Summary       string  `json:"summary,omitempty"`
+}
+
+// Provider looks up the weather for the hour starting at hour
+type Provider interface {
+	Conditions(ctx context.Context, lat, lon float64, hour time.Time) (*Conditions, error)
+}
+
+const (
+	// Cells of about 5 km; weather does not differ meaningfully within one
+	geohashPrecision = 5
+	failureTTL       = time.Minute
+	maxEntries       = 10000
+	lookupTimeout    = 3 * time.Second
+)
+
+// Enricher looks up weather through a provider, caching conditions by
+// geohash cell and hour so that every incident in the same area and hour
+// costs one lookup
+type Enricher struct {
+	provider     Provider
+	positionRepo repository.PositionRepository
+	clock        util.Clock
+	eventTypes   map[string]bool
+
+	mutex sync.Mutex
+	cache map[cacheKey]cacheEntry
+}
+
+type cacheKey struct {
+	cell string
+	hour int64 // Unix hour
+}
+
+type cacheEntry struct {
+	conditions *Conditions // Nil after a failed lookup
+	retryAfter time.Time
+}
+
+// NewEnricher enriches positions carrying an alarm and events of the given
+// types, which default to overspeed events
+func NewEnricher(provider Provider, positionRepo repository.PositionRepository, clock util.Clock, eventTypes ...string) *Enricher {
+	if len(eventTypes) == 0 {
+		eventTypes = []string{model.EventOverspeed}
+	}
+	types := make(map[string]bool, len(eventTypes))
+	for _, eventType := range eventTypes {
+		types[eventType] = true
+	}
+
+	return &Enricher{
+		provider:     provider,
+		positionRepo: positionRepo,
+		clock:        clock,
+		eventTypes:   types,
+		cache:        make(map[cacheKey]cacheEntry),
+	}
+}
+
+// EnrichPosition is a StageDecoded hook adding the weather to positions
+// that report an alarm, such as a crash or overspeed alarm
+func (e *Enricher) EnrichPosition(ctx context.Context, position *model.Position) error {
+	if alarm, _ := position.Status["alarm"].(string); alarm == "" {
+		return nil
+	}
+	if conditions := e.Lookup(ctx, position.Latitude, position.Longitude, position.Timestamp); conditions != nil {
+		position.Status[AttributeWeather] = conditions
+	}
+	return nil
+}
+
+// EnrichEvent is an event hook adding the weather at the event's position.
+// A position enriched at decode time lends its conditions to the event.
+func (e *Enricher) EnrichEvent(ctx context.Context, event *model.Event) error {
+	if !e.eventTypes[event.Type] || event.PositionID == "" {
+		return nil
+	}
+
+	position, err := e.positionRepo.FindByID(event.PositionID)
+	if err != nil || position == nil {
+		return err
+	}
+
+	if conditions, ok := position.Status[AttributeWeather]; ok {
+		event.Attributes[AttributeWeather] = conditions
+		return nil
+	}
+	if conditions := e.Lookup(ctx, position.Latitude, position.Longitude, position.Timestamp); conditions != nil {
+		event.Attributes[AttributeWeather] = conditions
+	}
+	return nil
+}
+
+// Lookup returns the weather at a place and time, or nil when the
+// provider has none. Failed lookups are not retried for a minute.
+func (e *Enricher) Lookup(ctx context.Context, lat, lon float64, at time.Time) *Conditions {
+	hour := at.UTC().Truncate(time.Hour)
+	key := cacheKey{cell: Geohash(lat, lon, geohashPrecision), hour: hour.Unix() / 3600}
+	now := e.clock.Now()
+
+	e.mutex.Lock()
+	entry, ok := e.cache[key]
+	e.mutex.Unlock()
+	if ok && (entry.conditions != nil || now.Before(entry.retryAfter)) {
+		return entry.conditions
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, lookupTimeout)
+	defer cancel()
+
+	conditions, err := e.provider.Conditions(ctx, lat, lon, hour)
+	if err != nil {
+		log.Printf("[Weather] lookup for %s at %s failed: %v", key.cell, hour.Format(time.RFC3339), err)
+		conditions = nil
+	}
+	if conditions != nil && conditions.Summary == "" {
+		conditions.Summary = Summary(conditions.Code)
+	}
+
+	e.mutex.Lock()
+	if len(e.cache) >= maxEntries {
+		e.cache = make(map[cacheKey]cacheEntry)
+	}
+	e.cache[key] = cacheEntry{conditions: conditions, retryAfter: now.Add(failureTTL)}
+	e.mutex.Unlock()
+	return conditions
+}
+
+// Summary describes a WMO weather interpretation code
+func Summary(code int) string {
+	switch {
+	case code == 0:
+		return "clear"
+	case code <= 3:
+		return "cloudy"
+	case code == 45 || code == 48:
+		return "fog"
+	case code >= 51 && code <= 57:
+		return "drizzle"
+	case code >= 61 && code <= 67, code >= 80 && code <= 82:
+		return "rain"
+	case code >= 71 && code <= 77, code == 85 || code == 86:
+		return "snow"
+	case code >= 95 && code <= 99:
+		return "thunderstorm"
+	}
+	return ""
+}
+
+const geohashAlphabet = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// Geohash encodes a coordinate as a geohash of the given length
+func Geohash(lat, lon float64, precision int) string {
+	latRange := [2]float64{-90, 90}
+	lonRange := [2]float64{-180, 180}
+
+	hash := make([]byte, 0, precision)
+	bit, index, even := 0, 0, true
+	for len(hash) < precision {
+		var value float64
+		var bounds *[2]float64
+		if even {
+			value, bounds = lon, &lonRange
+		} else {
+			value, bounds = lat, &latRange
+		}
+
+		mid := (bounds[0] + bounds[1]) / 2
+		index <<= 1
+		if value >= mid {
+			index |= 1
+			bounds[0] = mid
+		} else {
+			bounds[1] = mid
+		}
+		even = !even
+
+		if bit++; bit == 5 {
+			hash = append(hash, geohashAlphabet[index])
+			bit, index = 0, 0
+		}
+	}
+	return string(hash)
+}
@@ -0,0 +1,102 @@
+package webhook
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+
+	"tracking/internal/core/model"
+)
+
+// dispatchWorkers deliver events in parallel, so a receiver that is slow
+// or down holds up the others only while every worker waits on it
+const dispatchWorkers = 4
+
+// Targets returns the webhooks an event is posted to
+type Targets func(event *model.Event) ([]*model.Webhook, error)
+
+// Dispatcher posts events to the webhooks users and organizations set,
+// each signed with the secret of its webhook. Like the Sender it queues
+// events and retries failed posts with backoff; an event raised while the
+// queue is full is logged and dropped.
+type Dispatcher struct {
+	targets Targets
+	client  *http.Client
+	queue   chan *model.Event
+
+	stop chan struct{}
+	done sync.WaitGroup
+}
+
+func NewDispatcher(targets Targets) *Dispatcher {
+	return &Dispatcher{
+		targets: targets,
+		client:  &http.Client{Timeout: timeout},
+		queue:   make(chan *model.Event, queueSize),
+	}
+}
+
+// Handle queues an event; it is an event handler
+func (d *Dispatcher) Handle(event *model.Event) {
+	select {
+	case d.queue <- event:
+	default:
+		log.Printf("[Webhook] dispatch queue full, dropping %s event of device %s", event.Type, event.DeviceID)
+	}
+}
+
+// Start delivers queued events until Stop
+func (d *Dispatcher) Start() {
+	d.stop = make(chan struct{})
+	for i := 0; i < dispatchWorkers; i++ {
+		d.done.Add(1)
+		go func() {
+			defer d.done.Done()
+			for {
+				select {
+				case event := <-d.queue:
+					d.dispatch(event)
+				case <-d.stop:
+					return
+				}
+			}
+		}()
+	}
+}
+
+// Stop ends delivery; events still queued are not sent
+func (d *Dispatcher) Stop() {
+	if d.stop == nil {
+		return
+	}
+	close(d.stop)
+	d.done.Wait()
+	d.stop = nil
+}
+
+func (d *Dispatcher) dispatch(event *model.Event) {
+	webhooks, err := d.targets(event)
+	if err != nil {
+		log.Printf("[Webhook] failed to find webhooks for %s event of device %s: %v", event.Type, event.DeviceID, err)
+		return
+	}
+	if len(webhooks) == 0 {
+		return
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("[Webhook] failed to encode %s event: %v", event.Type, err)
+		return
+	}
+
+	for _, webhook := range webhooks {
+		err := post(d.client, webhook.URL, []byte(webhook.Secret), event.Type, body, d.stop)
+		if err == errStopped {
+			return
+		}
+		if err != nil {
+			log.Printf("[Webhook] giving up on %s event of device %s for webhook %s: %v", event.Type, event.DeviceID, webhook.ID, err)
+		}
+	}
+}
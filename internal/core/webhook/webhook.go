@@ -0,0 +1,167 @@
+// Package webhook posts events as JSON to URLs outside the server
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"tracking/internal/core/model"
+)
+
+const (
+	// SignatureHeader carries "sha256=" and the hex HMAC-SHA256 of the body
+	// under the shared secret
+	SignatureHeader = "X-Webhook-Signature"
+	// EventHeader carries the event type, for routing without parsing
+	EventHeader = "X-Webhook-Event"
+)
+
+const (
+	queueSize = 1000
+	attempts  = 3
+	backoff   = time.Second // Doubled after each failed attempt
+	timeout   = 10 * time.Second
+)
+
+// Sender posts the events of chosen types to fixed URLs. Events are queued
+// and delivered in the background, in the order raised; an event a URL
+// keeps failing, or one raised while the queue is full, is logged and
+// dropped.
+type Sender struct {
+	urls   []string
+	secret []byte // Empty sends no signature
+	types  []string
+	client *http.Client
+	queue  chan *model.Event
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func NewSender(urls []string, secret string, eventTypes []string) *Sender {
+	return &Sender{
+		urls:   urls,
+		secret: []byte(secret),
+		types:  eventTypes,
+		client: &http.Client{Timeout: timeout},
+		queue:  make(chan *model.Event, queueSize),
+	}
+}
+
+// Handle queues an event of the chosen types; it is an event handler
+func (s *Sender) Handle(event *model.Event) {
+	if !slices.Contains(s.types, event.Type) {
+		return
+	}
+	select {
+	case s.queue <- event:
+	default:
+		log.Printf("[Webhook] queue full, dropping %s event of device %s", event.Type, event.DeviceID)
+	}
+}
+
+// Start delivers queued events until Stop
+func (s *Sender) Start() {
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+	go func() {
+		defer close(s.done)
+		for {
+			select {
+			case event := <-s.queue:
+				s.deliver(event)
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop ends delivery; events still queued are not sent
+func (s *Sender) Stop() {
+	if s.stop == nil {
+		return
+	}
+	close(s.stop)
+	<-s.done
+	s.stop = nil
+}
+
+func (s *Sender) deliver(event *model.Event) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("[Webhook] failed to encode %s event: %v", event.Type, err)
+		return
+	}
+
+	for _, url := range s.urls {
+		err := post(s.client, url, s.secret, event.Type, body, s.stop)
+		if err == errStopped {
+			return
+		}
+		if err != nil {
+			log.Printf("[Webhook] giving up on %s event of device %s for %s: %v", event.Type, event.DeviceID, url, err)
+		}
+	}
+}
+
+// errStopped ends the retries of a delivery when its sender stops
+var errStopped = errors.New("webhook delivery stopped")
+
+// post delivers a body, retrying with a doubling backoff until it is taken,
+// the attempts run out or stop is closed
+func post(client *http.Client, url string, secret []byte, eventType string, body []byte, stop <-chan struct{}) error {
+	wait := backoff
+	for attempt := 1; ; attempt++ {
+		err := postOnce(client, url, secret, eventType, body)
+		if err == nil || attempt == attempts {
+			return err
+		}
+		select {
+		case <-time.After(wait):
+			wait *= 2
+		case <-stop:
+			return errStopped
+		}
+	}
+}
+
+func postOnce(client *http.Client, url string, secret []byte, eventType string, body []byte) error {
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, eventType)
+	if len(secret) > 0 {
+		req.Header.Set(SignatureHeader, Sign(secret, body))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Sign returns the SignatureHeader value of a body, for receivers to
+// compare with the header they got
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
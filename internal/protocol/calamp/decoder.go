@@ -0,0 +1,313 @@
+// Package calamp implements the CalAmp LM Direct protocol spoken over UDP by
+// the LMU series of vehicle trackers
+package calamp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"tracking/internal/core/model"
+	"tracking/internal/core/util"
+)
+
+// Common CalAmp errors
+var (
+	ErrPacketTooShort  = errors.New("data too short for CalAmp protocol")
+	ErrMalformedPacket = errors.New("malformed CalAmp packet")
+	ErrNoMobileID      = errors.New("CalAmp packet without a mobile ID")
+)
+
+// Each datagram is one message: an options header, a message header and
+// the message body, all big-endian.
+//
+// The options header starts with a byte whose top bit is set and whose low
+// bits flag the fields that follow, each a length(1) and value: the mobile
+// ID (BCD padded with 0xF), the mobile ID type(1), an authentication word,
+// routing, forwarding, response redirection and an options extension.
+//
+// The message header is service type(1), message type(1) and sequence(2).
+// Event and locate reports share one body:
+//
+//	update time(4) time of fix(4) latitude(4) longitude(4) altitude(4)
+//	speed(4) heading(2) satellites(1) fix status(1) carrier(2) RSSI(2)
+//	comm state(1) HDOP(1) inputs(1) unit status(1) event index(1)
+//	event code(1) accumulator count(1) spare(1) accumulators(4 each)
+//
+// with times in seconds since 1970, coordinates in 1e-7 degrees, altitude
+// in cm and speed in cm/s. Messages sent as acknowledged requests are
+// answered with an ACK carrying their type and sequence, after which the
+// device drops them from its log.
+const (
+	optionsFlag    = 0x80
+	optionMobileID = 0x01
+	optionIDType   = 0x02
+	optionFields   = 7 // Length-prefixed fields the options byte can flag
+
+	headerSize      = 4
+	eventReportSize = 40 // Event report body without accumulators
+
+	fixInvalid    = 0x08
+	fixHistoric   = 0x20
+	commRoaming   = 0x20
+	inputIgnition = 0x01
+)
+
+// Service types of the message header
+const (
+	ServiceUnacknowledged = 0
+	ServiceAcknowledged   = 1
+	ServiceResponse       = 2
+)
+
+// MessageType identifies the body of a message
+type MessageType uint8
+
+const (
+	MessageNull         MessageType = 0
+	MessageAck          MessageType = 1
+	MessageEventReport  MessageType = 2
+	MessageIDReport     MessageType = 3
+	MessageUserData     MessageType = 4
+	MessageAppData      MessageType = 5
+	MessageLocateReport MessageType = 8
+)
+
+type Decoder struct {
+	debug bool
+	clock util.Clock
+}
+
+func NewDecoder() *Decoder {
+	return &Decoder{
+		debug: false,
+		clock: util.SystemClock,
+	}
+}
+
+func (d *Decoder) EnableDebug(enable bool) {
+	d.debug = enable
+}
+
+// SetClock sets the clock used for reports without a usable time
+func (d *Decoder) SetClock(clock util.Clock) {
+	d.clock = clock
+}
+
+func (d *Decoder) logDebug(format string, v ...interface{}) {
+	if d.debug {
+		log.Printf("[CalAmp] "+format, v...)
+	}
+}
+
+// Message is one decoded datagram
+type Message struct {
+	MobileID     string
+	MobileIDType uint8
+	rawMobileID  []byte // Echoed in the ACK
+	Service      uint8
+	Type         MessageType
+	Sequence     uint16
+	Record       *CalAmpData // Nil unless an event or locate report
+}
+
+// CalAmpData is the fix of an event or locate report
+type CalAmpData struct {
+	Latitude   float64
+	Longitude  float64
+	Altitude   float64
+	Speed      float64
+	Course     float64
+	Satellites int
+	Timestamp  time.Time
+	Valid      bool
+	Event      uint8
+	Status     map[string]interface{}
+}
+
+// IsFrame reports whether data starts with an options header carrying a
+// mobile ID
+func IsFrame(data []byte) bool {
+	return len(data) > 2 && data[0]&optionsFlag != 0 && data[0]&optionMobileID != 0
+}
+
+// DeviceID returns the mobile ID of a message
+func DeviceID(data []byte) (string, error) {
+	message, _, err := decodeOptions(data)
+	if err != nil {
+		return "", err
+	}
+	if message.MobileID == "" {
+		return "", ErrNoMobileID
+	}
+	return message.MobileID, nil
+}
+
+// decodeOptions reads the options header and returns the message with its
+// identity set and the bytes after the header
+func decodeOptions(data []byte) (*Message, []byte, error) {
+	if len(data) == 0 || data[0]&optionsFlag == 0 {
+		return nil, nil, ErrNoMobileID
+	}
+	options := data[0]
+	rest := data[1:]
+	message := &Message{}
+	for bit := 0; bit < optionFields; bit++ {
+		if options&(1<<bit) == 0 {
+			continue
+		}
+		if len(rest) < 1 || len(rest) < 1+int(rest[0]) {
+			return nil, nil, fmt.Errorf("%w: options header truncated", ErrPacketTooShort)
+		}
+		field := rest[1 : 1+int(rest[0])]
+		rest = rest[1+int(rest[0]):]
+
+		switch 1 << bit {
+		case optionMobileID:
+			message.rawMobileID = field
+			message.MobileID = bcdDigits(field)
+		case optionIDType:
+			if len(field) > 0 {
+				message.MobileIDType = field[0]
+			}
+		}
+	}
+	return message, rest, nil
+}
+
+// bcdDigits reads a BCD number padded with 0xF nibbles
+func bcdDigits(data []byte) string {
+	var digits strings.Builder
+	for _, b := range data {
+		for _, nibble := range []byte{b >> 4, b & 0x0F} {
+			if nibble > 9 {
+				return digits.String()
+			}
+			digits.WriteByte('0' + nibble)
+		}
+	}
+	return digits.String()
+}
+
+// Decode reads a message. Only event and locate reports carry a record;
+// other messages keep the device alive and may still need an ACK.
+func (d *Decoder) Decode(data []byte) (*Message, error) {
+	d.logDebug("Received % x", data)
+
+	message, rest, err := decodeOptions(data)
+	if err != nil {
+		return nil, err
+	}
+	if message.MobileID == "" {
+		return nil, ErrNoMobileID
+	}
+	if len(rest) < headerSize {
+		return nil, fmt.Errorf("%w: no message header", ErrPacketTooShort)
+	}
+	message.Service = rest[0]
+	message.Type = MessageType(rest[1])
+	message.Sequence = binary.BigEndian.Uint16(rest[2:])
+	if message.Service > ServiceResponse {
+		return nil, fmt.Errorf("%w: unknown service type %d", ErrMalformedPacket, message.Service)
+	}
+
+	switch message.Type {
+	case MessageEventReport, MessageLocateReport:
+		if message.Record, err = d.decodeReport(rest[headerSize:]); err != nil {
+			return nil, err
+		}
+	default:
+		d.logDebug("Message type %d from %s carries no position", message.Type, message.MobileID)
+	}
+	return message, nil
+}
+
+func (d *Decoder) decodeReport(body []byte) (*CalAmpData, error) {
+	if len(body) < eventReportSize {
+		return nil, fmt.Errorf("%w: report got %d bytes, need at least %d",
+			ErrPacketTooShort, len(body), eventReportSize)
+	}
+
+	fixTime := binary.BigEndian.Uint32(body[4:])
+	latitude := float64(int32(binary.BigEndian.Uint32(body[8:]))) / 1e7
+	longitude := float64(int32(binary.BigEndian.Uint32(body[12:]))) / 1e7
+	if latitude < -90 || latitude > 90 || longitude < -180 || longitude > 180 {
+		return nil, fmt.Errorf("%w: coordinates %.7f, %.7f", ErrMalformedPacket, latitude, longitude)
+	}
+
+	fixStatus := body[27]
+	record := &CalAmpData{
+		Latitude:   latitude,
+		Longitude:  longitude,
+		Altitude:   float64(int32(binary.BigEndian.Uint32(body[16:]))) / 100, // cm to m
+		Speed:      float64(binary.BigEndian.Uint32(body[20:])) * 0.036,      // cm/s to km/h
+		Course:     float64(binary.BigEndian.Uint16(body[24:])),
+		Satellites: int(body[26]),
+		Valid:      fixStatus&fixInvalid == 0,
+		Event:      body[37],
+		Status:     make(map[string]interface{}),
+	}
+	if fixTime != 0 {
+		record.Timestamp = time.Unix(int64(fixTime), 0).UTC()
+	}
+
+	commState := body[32]
+	inputs := body[34]
+	record.Status["event"] = record.Event
+	record.Status["eventIndex"] = body[36]
+	record.Status["rssi"] = int(int16(binary.BigEndian.Uint16(body[30:])))
+	record.Status["hdop"] = float64(body[33]) / 10
+	record.Status["input"] = inputs
+	record.Status["ignition"] = inputs&inputIgnition != 0
+	record.Status["unitStatus"] = body[35]
+	record.Status["roaming"] = commState&commRoaming != 0
+	if fixStatus&fixHistoric != 0 {
+		record.Status["buffered"] = true
+	}
+
+	count := int(body[38])
+	accumulators := body[eventReportSize:]
+	if len(accumulators) < count*4 {
+		return nil, fmt.Errorf("%w: %d accumulators do not fit in %d bytes",
+			ErrPacketTooShort, count, len(accumulators))
+	}
+	for i := 0; i < count; i++ {
+		record.Status[fmt.Sprintf("accumulator%d", i)] = binary.BigEndian.Uint32(accumulators[i*4:])
+	}
+	return record, nil
+}
+
+// Response is the ACK for a message sent as an acknowledged request, or nil
+// when the message needs none
+func (d *Decoder) Response(message *Message) []byte {
+	if message.Service != ServiceAcknowledged {
+		return nil
+	}
+
+	response := []byte{optionsFlag | optionMobileID | optionIDType, byte(len(message.rawMobileID))}
+	response = append(response, message.rawMobileID...)
+	response = append(response, 1, message.MobileIDType)
+	response = append(response, ServiceResponse, byte(MessageAck))
+	response = binary.BigEndian.AppendUint16(response, message.Sequence)
+	return append(response, byte(message.Type), 0, 0, 0, 0, 0) // ACK, spare and app version
+}
+
+// ToPosition converts the fix of a report
+func (d *Decoder) ToPosition(deviceID string, data *CalAmpData) *model.Position {
+	position := model.NewPosition(deviceID, data.Latitude, data.Longitude)
+	position.Altitude = data.Altitude
+	position.Speed = data.Speed
+	position.Course = data.Course
+	position.Valid = data.Valid
+	position.Satellites = uint8(data.Satellites)
+	position.SetDecodedTime(data.Timestamp, d.clock.Now())
+	position.Protocol = "calamp"
+
+	position.Status = make(map[string]interface{}, len(data.Status))
+	for k, v := range data.Status {
+		position.Status[k] = v
+	}
+	return position
+}
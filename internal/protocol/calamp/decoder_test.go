@@ -0,0 +1,140 @@
+package calamp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"testing"
+	"time"
+	"tracking/internal/core/util"
+)
+
+// mobileID is ESN 4634616396 as sent in the options header
+var mobileID = []byte{0x83, 0x05, 0x46, 0x34, 0x61, 0x63, 0x96, 0x01, 0x01}
+
+// eventReport builds an event report fixed at 2024-01-15 09:58:20 UTC in
+// Dallas, with the ignition on and two accumulators
+func eventReport(service uint8, sequence uint16) []byte {
+	buf := bytes.NewBuffer(append([]byte(nil), mobileID...))
+	buf.Write([]byte{service, byte(MessageEventReport)})
+	binary.Write(buf, binary.BigEndian, sequence)
+
+	fixTime := uint32(time.Date(2024, 1, 15, 9, 58, 20, 0, time.UTC).Unix())
+	binary.Write(buf, binary.BigEndian, fixTime+5) // Update time
+	binary.Write(buf, binary.BigEndian, fixTime)
+	binary.Write(buf, binary.BigEndian, int32(327766670))  // Latitude
+	binary.Write(buf, binary.BigEndian, int32(-967969870)) // Longitude
+	binary.Write(buf, binary.BigEndian, int32(13450))      // Altitude in cm
+	binary.Write(buf, binary.BigEndian, uint32(2500))      // Speed in cm/s
+	binary.Write(buf, binary.BigEndian, uint16(135))
+	buf.Write([]byte{9, 0x02})                             // Satellites, differentially corrected fix
+	binary.Write(buf, binary.BigEndian, uint16(310))       // Carrier
+	binary.Write(buf, binary.BigEndian, int16(-71))        // RSSI
+	buf.Write([]byte{0x0F, 12, 0x03, 0x00, 7, 20, 2, 0})   // Comm state, HDOP, inputs, unit status, event index and code, two accumulators
+	binary.Write(buf, binary.BigEndian, uint32(123456789)) // Odometer accumulator
+	binary.Write(buf, binary.BigEndian, uint32(3600))
+	return buf.Bytes()
+}
+
+func TestDecode(t *testing.T) {
+	decoder := NewDecoder()
+
+	message, err := decoder.Decode(eventReport(ServiceAcknowledged, 0x1234))
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if message.MobileID != "4634616396" || message.MobileIDType != 1 || message.Type != MessageEventReport ||
+		message.Sequence != 0x1234 || message.Record == nil {
+		t.Fatalf("Decode() = %+v", message)
+	}
+
+	record := message.Record
+	if !record.Valid || math.Abs(record.Latitude-32.776667) > 1e-6 || math.Abs(record.Longitude+96.796987) > 1e-6 ||
+		record.Altitude != 134.5 || math.Abs(record.Speed-90) > 1e-9 || record.Course != 135 || record.Satellites != 9 {
+		t.Errorf("Record = %+v", record)
+	}
+	if want := time.Date(2024, 1, 15, 9, 58, 20, 0, time.UTC); !record.Timestamp.Equal(want) {
+		t.Errorf("Timestamp = %v, want %v", record.Timestamp, want)
+	}
+	status := record.Status
+	if status["event"] != uint8(20) || status["ignition"] != true || status["rssi"] != -71 || status["hdop"] != 1.2 ||
+		status["accumulator0"] != uint32(123456789) || status["accumulator1"] != uint32(3600) || status["roaming"] != false {
+		t.Errorf("Status = %v", status)
+	}
+
+	// The ACK echoes the identity, the acknowledged type and the sequence
+	want := append(append([]byte(nil), mobileID...), ServiceResponse, byte(MessageAck), 0x12, 0x34, byte(MessageEventReport), 0, 0, 0, 0, 0)
+	if got := decoder.Response(message); !bytes.Equal(got, want) {
+		t.Errorf("Response() = % x, want % x", got, want)
+	}
+
+	position := decoder.ToPosition("device-1", record)
+	if position.Protocol != "calamp" || position.Satellites != 9 || position.Status["event"] != uint8(20) {
+		t.Errorf("ToPosition() = %+v", position)
+	}
+
+	// Unacknowledged messages are not answered
+	message, err = decoder.Decode(eventReport(ServiceUnacknowledged, 1))
+	if err != nil || decoder.Response(message) != nil {
+		t.Errorf("Unacknowledged report = %+v, %v", message, err)
+	}
+
+	// A null message only keeps the device alive
+	null := append(append([]byte(nil), mobileID...), ServiceAcknowledged, byte(MessageNull), 0, 9)
+	message, err = decoder.Decode(null)
+	if err != nil || message.Record != nil || decoder.Response(message) == nil {
+		t.Errorf("Null message = %+v, %v", message, err)
+	}
+}
+
+func TestDecodeInvalidFix(t *testing.T) {
+	decoder := NewDecoder()
+	decoder.SetClock(util.NewFixedClock(time.Date(2024, 1, 16, 8, 0, 0, 0, time.UTC)))
+
+	data := eventReport(ServiceUnacknowledged, 1)
+	body := len(mobileID) + 4
+	binary.BigEndian.PutUint32(data[body+4:], 0) // No time of fix
+	data[body+27] = 0x08 | 0x20                  // Invalid, historic
+
+	message, err := decoder.Decode(data)
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if message.Record.Valid || message.Record.Status["buffered"] != true {
+		t.Errorf("Record = %+v", message.Record)
+	}
+	if position := decoder.ToPosition("device-1", message.Record); !position.Timestamp.Equal(time.Date(2024, 1, 16, 8, 0, 0, 0, time.UTC)) {
+		t.Errorf("Timestamp = %v, want the clock", position.Timestamp)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	report := eventReport(ServiceAcknowledged, 1)
+	outOfRange := eventReport(ServiceAcknowledged, 1)
+	binary.BigEndian.PutUint32(outOfRange[len(mobileID)+12:], uint32(int32(95*1e7)))
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr error
+	}{
+		{"no options header", report[len(mobileID):], ErrNoMobileID},
+		{"truncated options", mobileID[:4], ErrPacketTooShort},
+		{"no message header", mobileID, ErrPacketTooShort},
+		{"truncated report", report[:len(report)-12], ErrPacketTooShort},
+		{"accumulators missing", report[:len(report)-4], ErrPacketTooShort},
+		{"latitude out of range", outOfRange, ErrMalformedPacket},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewDecoder().Decode(tt.data); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Decode() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if id, err := DeviceID(report); err != nil || id != "4634616396" {
+		t.Errorf("DeviceID() = %q, %v", id, err)
+	}
+}
@@ -0,0 +1,354 @@
+// Package coban implements the Coban variant of the GPS103 protocol spoken
+// by the TK103, TK303 and TK5000 trackers
+package coban
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+	"tracking/internal/core/model"
+	"tracking/internal/core/util"
+)
+
+// Common Coban errors
+var (
+	ErrInvalidHeader     = errors.New("invalid Coban frame header")
+	ErrInvalidFormat     = errors.New("invalid Coban data format")
+	ErrInvalidCoordinate = errors.New("invalid coordinate value")
+)
+
+// A session opens with a login the server answers with LOAD
+//
+//	##,imei:359586015829802,A;
+//
+// after which the device sends its bare IMEI as a heartbeat, answered with
+// ON, and position reports, which are not answered:
+//
+//	imei:359586015829802,tracker,1210221219,13554900601,F,041905.000,A,2237.7514,N,11408.6214,E,0.00,90.5;
+//
+// that is the IMEI, the report keyword, the local date and time YYMMDDhhmm,
+// the admin phone number, F with a GPS fix or L with only a cell, the UTC
+// time hhmmss.sss, validity, latitude and longitude in degrees and minutes,
+// speed in knots and course. TK303 and TK5000 firmware append altitude,
+// ACC and door states and fuel levels.
+const (
+	prefixLogin = "##,"
+	prefixIMEI  = "imei:"
+	frameEnd    = ";"
+
+	signalGPS = "F"
+
+	localLayout = "0601021504"
+	shortLayout = "060102"
+	minFields   = 13
+)
+
+// MessageType distinguishes the frames a session is made of
+type MessageType int
+
+const (
+	MessageLogin MessageType = iota
+	MessageHeartbeat
+	MessagePosition
+)
+
+// keywordAlarms maps report keywords to the alarm they raise
+var keywordAlarms = map[string]string{
+	"help me":      "sos",
+	"low battery":  "lowBattery",
+	"move":         "movement",
+	"speed":        "overspeed",
+	"stockade":     "geofence",
+	"ac alarm":     "powerCut",
+	"door alarm":   "door",
+	"sensor alarm": "vibration",
+}
+
+type Decoder struct {
+	debug bool
+	clock util.Clock
+}
+
+func NewDecoder() *Decoder {
+	return &Decoder{
+		debug: false,
+		clock: util.SystemClock,
+	}
+}
+
+func (d *Decoder) EnableDebug(enable bool) {
+	d.debug = enable
+}
+
+// SetClock sets the clock used for reports without a usable time
+func (d *Decoder) SetClock(clock util.Clock) {
+	d.clock = clock
+}
+
+func (d *Decoder) logDebug(format string, v ...interface{}) {
+	if d.debug {
+		log.Printf("[Coban] "+format, v...)
+	}
+}
+
+// Message is one decoded frame
+type Message struct {
+	Type   MessageType
+	IMEI   string
+	Record *CobanData // Nil unless a position report has a GPS fix
+}
+
+// CobanData is the fix of a position report
+type CobanData struct {
+	Latitude  float64
+	Longitude float64
+	Altitude  float64
+	Speed     float64
+	Course    float64
+	Timestamp time.Time
+	Valid     bool
+	Alarm     string
+	Status    map[string]interface{}
+}
+
+// IsFrame reports whether data is a Coban login, heartbeat or report
+func IsFrame(data []byte) bool {
+	s := strings.TrimSpace(string(data))
+	if strings.HasPrefix(s, prefixLogin) || strings.HasPrefix(s, prefixIMEI) {
+		return true
+	}
+	imei, ok := strings.CutSuffix(s, frameEnd)
+	return ok && isIMEI(imei)
+}
+
+// DeviceID returns the IMEI a frame reports with
+func DeviceID(data []byte) (string, error) {
+	_, imei, _, err := split(data)
+	return imei, err
+}
+
+// split returns the message type, IMEI and fields of a frame, the fields of
+// a report starting with its keyword
+func split(data []byte) (MessageType, string, []string, error) {
+	s := strings.TrimSpace(string(data))
+	if !IsFrame(data) {
+		return 0, "", nil, fmt.Errorf("%w: expected ##, imei: or a bare IMEI", ErrInvalidHeader)
+	}
+	s = strings.TrimSuffix(s, frameEnd)
+
+	messageType := MessagePosition
+	switch {
+	case strings.HasPrefix(s, prefixLogin):
+		messageType = MessageLogin
+		s = strings.TrimPrefix(s, prefixLogin)
+	case !strings.HasPrefix(s, prefixIMEI):
+		return MessageHeartbeat, s, nil, nil
+	}
+
+	fields := strings.Split(s, ",")
+	imei := strings.TrimPrefix(fields[0], prefixIMEI)
+	if !isIMEI(imei) {
+		return 0, "", nil, fmt.Errorf("%w: invalid IMEI %q", ErrInvalidFormat, imei)
+	}
+	return messageType, imei, fields[1:], nil
+}
+
+// Decode reads a frame. Reports sent with only a cell (L) decode without a
+// record so they still keep the device alive.
+func (d *Decoder) Decode(data []byte) (*Message, error) {
+	d.logDebug("Received %q", data)
+
+	messageType, imei, fields, err := split(data)
+	if err != nil {
+		return nil, err
+	}
+	message := &Message{Type: messageType, IMEI: imei}
+	if messageType != MessagePosition {
+		return message, nil
+	}
+
+	if len(fields) > 3 && fields[3] != signalGPS {
+		d.logDebug("Report from %s without a GPS fix", imei)
+		return message, nil
+	}
+	if len(fields) < minFields-1 {
+		return nil, fmt.Errorf("%w: got %d fields, need at least %d", ErrInvalidFormat, len(fields)+1, minFields)
+	}
+
+	record := &CobanData{Status: make(map[string]interface{})}
+	record.Valid = fields[5] == "A"
+
+	if record.Latitude, err = parseCoordinate(fields[6], fields[7]); err != nil {
+		return nil, fmt.Errorf("invalid latitude: %w", err)
+	}
+	if record.Longitude, err = parseCoordinate(fields[8], fields[9]); err != nil {
+		return nil, fmt.Errorf("invalid longitude: %w", err)
+	}
+
+	if speed, err := strconv.ParseFloat(fields[10], 64); err == nil {
+		record.Speed = speed * 1.852 // Convert knots to km/h
+	}
+	if course, err := strconv.ParseFloat(fields[11], 64); err == nil {
+		record.Course = course
+	}
+
+	if ts, err := parseTime(fields[1], fields[4]); err == nil {
+		record.Timestamp = ts
+	} else {
+		d.logDebug("Failed to parse timestamp: %v", err)
+	}
+
+	d.applyKeyword(fields[0], record)
+	d.decodeExtended(fields[12:], record)
+
+	message.Record = record
+	return message, nil
+}
+
+// applyKeyword sets the alarm or ignition state a report keyword carries
+func (d *Decoder) applyKeyword(keyword string, record *CobanData) {
+	switch keyword {
+	case "tracker":
+	case "acc on":
+		record.Status["ignition"] = true
+	case "acc off":
+		record.Status["ignition"] = false
+	default:
+		if alarm, ok := keywordAlarms[keyword]; ok {
+			record.Alarm = alarm
+			record.Status["alarm"] = alarm
+		} else {
+			record.Status["event"] = keyword
+		}
+	}
+}
+
+// decodeExtended reads the TK303 and TK5000 fields after the course:
+// altitude, ACC, door and two fuel levels in percent
+func (d *Decoder) decodeExtended(fields []string, record *CobanData) {
+	if len(fields) > 0 {
+		if altitude, err := strconv.ParseFloat(fields[0], 64); err == nil {
+			record.Altitude = altitude
+		}
+	}
+	if len(fields) > 1 && fields[1] != "" {
+		record.Status["acc"] = fields[1] == "1"
+	}
+	if len(fields) > 2 && fields[2] != "" {
+		record.Status["door"] = fields[2] == "1"
+	}
+	for i, key := range []string{"fuel1", "fuel2"} {
+		if len(fields) > 3+i {
+			if fuel, err := strconv.ParseFloat(strings.TrimSuffix(fields[3+i], "%"), 64); err == nil {
+				record.Status[key] = fuel
+			}
+		}
+	}
+}
+
+// parseCoordinate converts degrees and minutes to decimal degrees
+func parseCoordinate(coord, dir string) (float64, error) {
+	val, err := strconv.ParseFloat(coord, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: invalid format", ErrInvalidCoordinate)
+	}
+
+	degrees := float64(int(val / 100))
+	minutes := val - degrees*100
+	if minutes >= 60 {
+		return 0, fmt.Errorf("%w: invalid minutes value", ErrInvalidCoordinate)
+	}
+
+	result := degrees + minutes/60
+	switch dir {
+	case "N", "E":
+	case "S", "W":
+		result = -result
+	default:
+		return 0, fmt.Errorf("%w: invalid hemisphere %q", ErrInvalidCoordinate, dir)
+	}
+
+	if (dir == "N" || dir == "S") && (result < -90 || result > 90) {
+		return 0, fmt.Errorf("%w: latitude out of range", ErrInvalidCoordinate)
+	}
+	if (dir == "E" || dir == "W") && (result < -180 || result > 180) {
+		return 0, fmt.Errorf("%w: longitude out of range", ErrInvalidCoordinate)
+	}
+	return result, nil
+}
+
+// parseTime combines the date of the local time field with the UTC time of
+// day. The date is local, so it is moved by a day when the two readings are
+// more than twelve hours apart.
+func parseTime(local, utc string) (time.Time, error) {
+	if len(local) < len(shortLayout) || len(utc) < 6 {
+		return time.Time{}, fmt.Errorf("%w: time %q %q", ErrInvalidFormat, local, utc)
+	}
+	date, err := time.Parse(shortLayout, local[:len(shortLayout)])
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: date %v", ErrInvalidFormat, err)
+	}
+	clock, err := time.Parse("150405", utc[:6])
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: time %v", ErrInvalidFormat, err)
+	}
+	ts := date.Add(time.Duration(clock.Hour())*time.Hour +
+		time.Duration(clock.Minute())*time.Minute +
+		time.Duration(clock.Second())*time.Second)
+
+	if len(local) >= len(localLayout) {
+		if reading, err := time.Parse(localLayout, local[:len(localLayout)]); err == nil {
+			switch offset := reading.Sub(ts); {
+			case offset > 12*time.Hour:
+				ts = ts.AddDate(0, 0, 1)
+			case offset < -12*time.Hour:
+				ts = ts.AddDate(0, 0, -1)
+			}
+		}
+	}
+	return ts, nil
+}
+
+func isIMEI(s string) bool {
+	if len(s) < 10 || len(s) > 16 {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Response is the server reply to a frame: LOAD accepts a login and ON a
+// heartbeat. Position reports are not answered.
+func (d *Decoder) Response(message *Message) []byte {
+	switch message.Type {
+	case MessageLogin:
+		return []byte("LOAD")
+	case MessageHeartbeat:
+		return []byte("ON")
+	}
+	return nil
+}
+
+// ToPosition converts the fix of a position report
+func (d *Decoder) ToPosition(deviceID string, data *CobanData) *model.Position {
+	position := model.NewPosition(deviceID, data.Latitude, data.Longitude)
+	position.Altitude = data.Altitude
+	position.Speed = data.Speed
+	position.Course = data.Course
+	position.Valid = data.Valid
+	position.SetDecodedTime(data.Timestamp, d.clock.Now())
+	position.Protocol = "coban"
+
+	position.Status = make(map[string]interface{}, len(data.Status))
+	for k, v := range data.Status {
+		position.Status[k] = v
+	}
+	return position
+}
@@ -0,0 +1,204 @@
+package coban
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+	"tracking/internal/core/util"
+)
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		typ     MessageType
+		record  bool
+		check   func(t *testing.T, r *CobanData)
+		wantErr error
+	}{
+		{
+			name: "login",
+			data: "##,imei:359586015829802,A;",
+			typ:  MessageLogin,
+		},
+		{
+			name: "heartbeat",
+			data: "359586015829802;",
+			typ:  MessageHeartbeat,
+		},
+		{
+			name:   "TK103 position",
+			data:   "imei:359586015829802,tracker,1210221219,13554900601,F,041905.000,A,2237.7514,N,11408.6214,E,10.00,90.5;",
+			typ:    MessagePosition,
+			record: true,
+			check: func(t *testing.T, r *CobanData) {
+				if math.Abs(r.Latitude-22.629190) > 0.000001 || math.Abs(r.Longitude-114.143690) > 0.000001 {
+					t.Errorf("Coordinates = %f, %f", r.Latitude, r.Longitude)
+				}
+				if math.Abs(r.Speed-18.52) > 0.001 || r.Course != 90.5 || !r.Valid {
+					t.Errorf("Fix = %+v", r)
+				}
+				// 12:19 local is 04:19 UTC in UTC+8
+				if want := time.Date(2012, 10, 22, 4, 19, 5, 0, time.UTC); !r.Timestamp.Equal(want) {
+					t.Errorf("Timestamp = %v, want %v", r.Timestamp, want)
+				}
+				if r.Alarm != "" || len(r.Status) != 0 {
+					t.Errorf("Alarm = %q, status = %v", r.Alarm, r.Status)
+				}
+			},
+		},
+		{
+			name:   "local date ahead of UTC",
+			data:   "imei:359586015829802,tracker,1210230119,,F,171905.000,A,2237.7514,N,11408.6214,E,0.00,;",
+			typ:    MessagePosition,
+			record: true,
+			check: func(t *testing.T, r *CobanData) {
+				if want := time.Date(2012, 10, 22, 17, 19, 5, 0, time.UTC); !r.Timestamp.Equal(want) {
+					t.Errorf("Timestamp = %v, want %v", r.Timestamp, want)
+				}
+			},
+		},
+		{
+			name:   "TK303 SOS with extended fields",
+			data:   "imei:359586015829802,help me,1210221219,,F,041905.000,A,2237.7514,S,11408.6214,W,0.00,0,35.5,1,0,45.0%,,;",
+			typ:    MessagePosition,
+			record: true,
+			check: func(t *testing.T, r *CobanData) {
+				if r.Latitude >= 0 || r.Longitude >= 0 || r.Altitude != 35.5 {
+					t.Errorf("Fix = %+v", r)
+				}
+				if r.Alarm != "sos" || r.Status["alarm"] != "sos" {
+					t.Errorf("Alarm = %q", r.Alarm)
+				}
+				if r.Status["acc"] != true || r.Status["door"] != false || r.Status["fuel1"] != 45.0 {
+					t.Errorf("Status = %v", r.Status)
+				}
+				if _, ok := r.Status["fuel2"]; ok {
+					t.Errorf("Empty fuel2 decoded: %v", r.Status)
+				}
+			},
+		},
+		{
+			name:   "ignition off",
+			data:   "imei:359586015829802,acc off,1210221219,,F,041905.000,V,2237.7514,N,11408.6214,E,0.00,0;",
+			typ:    MessagePosition,
+			record: true,
+			check: func(t *testing.T, r *CobanData) {
+				if r.Valid || r.Status["ignition"] != false {
+					t.Errorf("Valid = %v, status = %v", r.Valid, r.Status)
+				}
+			},
+		},
+		{
+			name: "cell only report",
+			data: "imei:359586015829802,tracker,1210221219,,L,,,1D0E,,5A4B,,,;",
+			typ:  MessagePosition,
+		},
+		{
+			name:    "invalid header",
+			data:    "*HQ,4210051415,V1,121513,A#",
+			wantErr: ErrInvalidHeader,
+		},
+		{
+			name:    "invalid IMEI",
+			data:    "imei:35958601582980X,tracker;",
+			wantErr: ErrInvalidFormat,
+		},
+		{
+			name:    "too few fields",
+			data:    "imei:359586015829802,tracker,1210221219,,F,041905.000,A;",
+			wantErr: ErrInvalidFormat,
+		},
+		{
+			name:    "invalid hemisphere",
+			data:    "imei:359586015829802,tracker,1210221219,,F,041905.000,A,2237.7514,X,11408.6214,E,0.00,0;",
+			wantErr: ErrInvalidCoordinate,
+		},
+	}
+
+	decoder := NewDecoder()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message, err := decoder.Decode([]byte(tt.data))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Decode() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if message.Type != tt.typ || message.IMEI != "359586015829802" {
+				t.Errorf("Message = %+v", message)
+			}
+			if (message.Record != nil) != tt.record {
+				t.Fatalf("Record = %+v, want record %v", message.Record, tt.record)
+			}
+			if tt.check != nil {
+				tt.check(t, message.Record)
+			}
+		})
+	}
+}
+
+func TestIsFrame(t *testing.T) {
+	tests := []struct {
+		data string
+		want bool
+	}{
+		{"##,imei:359586015829802,A;", true},
+		{"359586015829802;", true},
+		{"imei:359586015829802,tracker,1210221219,,L,;", true},
+		{"359586015829802", false},
+		{"12;", false},
+		{"+ACK:GTHBD,02010B,135790246811220,,20090214093254,11F7$", false},
+		{"\x00\x0f359586015829802", false},
+	}
+	for _, tt := range tests {
+		if got := IsFrame([]byte(tt.data)); got != tt.want {
+			t.Errorf("IsFrame(%q) = %v, want %v", tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestResponse(t *testing.T) {
+	decoder := NewDecoder()
+	tests := []struct {
+		data string
+		want string
+	}{
+		{"##,imei:359586015829802,A;", "LOAD"},
+		{"359586015829802;", "ON"},
+		{"imei:359586015829802,tracker,1210221219,,F,041905.000,A,2237.7514,N,11408.6214,E,0.00,0;", ""},
+	}
+	for _, tt := range tests {
+		message, err := decoder.Decode([]byte(tt.data))
+		if err != nil {
+			t.Fatalf("Decode(%q) error = %v", tt.data, err)
+		}
+		if got := string(decoder.Response(message)); got != tt.want {
+			t.Errorf("Response(%q) = %q, want %q", tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestToPosition(t *testing.T) {
+	now := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	decoder := NewDecoder()
+	decoder.SetClock(util.NewFixedClock(now))
+
+	// The date is missing, so the position takes the clock's time
+	message, err := decoder.Decode([]byte("imei:359586015829802,help me,,,F,041905.000,A,2237.7514,N,11408.6214,E,0.00,0;"))
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	position := decoder.ToPosition("device-1", message.Record)
+	if position.Protocol != "coban" || position.DeviceID != "device-1" || !position.Timestamp.Equal(now) {
+		t.Errorf("Position = %+v", position)
+	}
+	if position.Status["alarm"] != "sos" {
+		t.Errorf("Status = %v", position.Status)
+	}
+}
@@ -0,0 +1,506 @@
+// Package egts implements the transport and service levels of EGTS (GOST R
+// 54619/33472), the telematics protocol required for vehicle tracking in
+// Russia and the CIS
+package egts
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+	"tracking/internal/core/model"
+	"tracking/internal/core/util"
+)
+
+// Common EGTS errors
+var (
+	ErrPacketTooShort  = errors.New("data too short for EGTS protocol")
+	ErrInvalidHeader   = errors.New("invalid EGTS transport header")
+	ErrInvalidChecksum = errors.New("invalid EGTS checksum")
+	ErrMalformedRecord = errors.New("malformed EGTS record")
+	ErrNoDeviceID      = errors.New("EGTS packet without a terminal or object ID")
+)
+
+// A transport packet is, little-endian:
+//
+//	version 0x01(1) security key ID(1) flags(1) header length(1)
+//	header encoding(1) frame data length(2) packet ID(2) packet type(1)
+//	[peer address(2) recipient address(2) TTL(1) when routed]
+//	header CRC-8(1) frame data... frame CRC-16(2)
+//
+// Application data packets carry service records: length(2) number(2)
+// flags(1), then object ID(4), event ID(4) and time(4) when flagged,
+// source and recipient service(1 each) and the subrecords, each type(1)
+// length(2) data. Terminals authenticate with a TERM_IDENTITY subrecord of
+// the auth service and report with POS_DATA and EXT_POS_DATA subrecords of
+// the teledata service. Each packet is answered with a response packet
+// confirming every record, and an identity additionally with RESULT_CODE.
+const (
+	protocolVersion  = 0x01
+	headerSize       = 11
+	routedHeaderSize = 16
+	flagRouted       = 0x20
+	crcSize          = 2
+
+	PacketResponse = 0
+	PacketAppData  = 1
+
+	ServiceAuth     = 1
+	ServiceTeledata = 2
+
+	recordObjectID = 0x01
+	recordEventID  = 0x02
+	recordTime     = 0x04
+
+	subrecordResponse    = 0
+	subrecordIdentity    = 1
+	subrecordResultCode  = 9
+	subrecordPosData     = 16
+	subrecordExtPosData  = 17
+	minPosData           = 21
+	identityIMEI         = 0x02
+	identityHomeDispatch = 0x01
+)
+
+// Flags of POS_DATA
+const (
+	posValid     = 0x01
+	posBlackBox  = 0x08
+	posMoving    = 0x10
+	posSouth     = 0x20
+	posWest      = 0x40
+	posAltitude  = 0x80
+	speedAltSign = 0x4000
+	speedDirHigh = 0x8000
+)
+
+// epoch is the origin of EGTS time fields
+var epoch = time.Date(2010, 1, 1, 0, 0, 0, 0, time.UTC)
+
+type Decoder struct {
+	debug bool
+	clock util.Clock
+}
+
+func NewDecoder() *Decoder {
+	return &Decoder{
+		debug: false,
+		clock: util.SystemClock,
+	}
+}
+
+func (d *Decoder) EnableDebug(enable bool) {
+	d.debug = enable
+}
+
+// SetClock sets the clock used for records without a usable time
+func (d *Decoder) SetClock(clock util.Clock) {
+	d.clock = clock
+}
+
+func (d *Decoder) logDebug(format string, v ...interface{}) {
+	if d.debug {
+		log.Printf("[EGTS] "+format, v...)
+	}
+}
+
+// Packet is one decoded transport packet
+type Packet struct {
+	ID         uint16
+	Type       uint8
+	Records    []Record
+	TerminalID uint32 // From TERM_IDENTITY, zero otherwise
+	IMEI       string // From TERM_IDENTITY when the terminal sends it
+	ObjectID   uint32 // From the first record naming its object
+	Positions  []*EGTSData
+}
+
+// Record identifies a service record so it can be confirmed
+type Record struct {
+	Number  uint16
+	Service uint8
+}
+
+// EGTSData is the fix of a POS_DATA subrecord
+type EGTSData struct {
+	Latitude   float64
+	Longitude  float64
+	Altitude   float64
+	Speed      float64
+	Course     float64
+	Satellites int
+	Timestamp  time.Time
+	Valid      bool
+	Status     map[string]interface{}
+}
+
+// IsFrame reports whether data starts with an EGTS transport header
+func IsFrame(data []byte) bool {
+	if len(data) < headerSize || data[0] != protocolVersion {
+		return false
+	}
+	size := int(data[3])
+	if size != headerSize && size != routedHeaderSize || len(data) < size {
+		return false
+	}
+	return crc8(data[:size-1]) == data[size-1]
+}
+
+// PacketSize returns the length of the packet data starts with, header and
+// checksums included
+func PacketSize(data []byte) (int, error) {
+	if !IsFrame(data) {
+		return 0, ErrInvalidHeader
+	}
+	size := int(data[3])
+	if length := int(binary.LittleEndian.Uint16(data[5:])); length > 0 {
+		size += length + crcSize
+	}
+	return size, nil
+}
+
+// DeviceID returns the identity a packet carries: the IMEI or terminal ID
+// of TERM_IDENTITY or else the object ID of its records
+func DeviceID(data []byte) (string, error) {
+	packet, err := NewDecoder().Decode(data)
+	if err != nil {
+		return "", err
+	}
+	return packet.DeviceID()
+}
+
+// DeviceID returns the identity of the packet's terminal
+func (p *Packet) DeviceID() (string, error) {
+	switch {
+	case p.IMEI != "":
+		return p.IMEI, nil
+	case p.TerminalID != 0:
+		return strconv.FormatUint(uint64(p.TerminalID), 10), nil
+	case p.ObjectID != 0:
+		return strconv.FormatUint(uint64(p.ObjectID), 10), nil
+	}
+	return "", ErrNoDeviceID
+}
+
+// Decode reads one transport packet and the service records it carries
+func (d *Decoder) Decode(data []byte) (*Packet, error) {
+	d.logDebug("Received % x", data)
+
+	size, err := PacketSize(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < size {
+		return nil, fmt.Errorf("%w: got %d bytes, packet needs %d", ErrPacketTooShort, len(data), size)
+	}
+
+	header := data[:data[3]]
+	packet := &Packet{
+		ID:   binary.LittleEndian.Uint16(header[7:]),
+		Type: header[9],
+	}
+	frame := data[len(header):size]
+	if len(frame) == 0 {
+		return packet, nil
+	}
+	body := frame[:len(frame)-crcSize]
+	if want, got := crc16(body), binary.LittleEndian.Uint16(frame[len(body):]); got != want {
+		return nil, fmt.Errorf("%w: frame CRC 0x%04x, want 0x%04x", ErrInvalidChecksum, got, want)
+	}
+
+	switch packet.Type {
+	case PacketAppData:
+	case PacketResponse:
+		// Confirmations of our packets: response packet ID and result code
+		if len(body) < 3 {
+			return nil, fmt.Errorf("%w: response without a result", ErrPacketTooShort)
+		}
+		body = body[3:]
+	default:
+		d.logDebug("Skipping packet type %d", packet.Type)
+		return packet, nil
+	}
+
+	for len(body) > 0 {
+		rest, err := d.decodeRecord(body, packet)
+		if err != nil {
+			return nil, err
+		}
+		body = rest
+	}
+	return packet, nil
+}
+
+// decodeRecord reads the service record body starts with and returns the
+// bytes after it
+func (d *Decoder) decodeRecord(body []byte, packet *Packet) ([]byte, error) {
+	if len(body) < 5 {
+		return nil, fmt.Errorf("%w: record header truncated", ErrPacketTooShort)
+	}
+	length := int(binary.LittleEndian.Uint16(body))
+	record := Record{Number: binary.LittleEndian.Uint16(body[2:])}
+	flags := body[4]
+	pos := 5
+
+	var objectID uint32
+	var sent time.Time
+	optional := []struct {
+		flag uint8
+		read func(uint32)
+	}{
+		{recordObjectID, func(v uint32) { objectID = v }},
+		{recordEventID, func(uint32) {}},
+		{recordTime, func(v uint32) { sent = epoch.Add(time.Duration(v) * time.Second) }},
+	}
+	for _, field := range optional {
+		if flags&field.flag == 0 {
+			continue
+		}
+		if len(body) < pos+4 {
+			return nil, fmt.Errorf("%w: record header truncated", ErrPacketTooShort)
+		}
+		field.read(binary.LittleEndian.Uint32(body[pos:]))
+		pos += 4
+	}
+	if len(body) < pos+2+length {
+		return nil, fmt.Errorf("%w: record %d needs %d bytes", ErrPacketTooShort, record.Number, length)
+	}
+	record.Service = body[pos]
+	data := body[pos+2 : pos+2+length]
+	packet.Records = append(packet.Records, record)
+	if objectID != 0 && packet.ObjectID == 0 {
+		packet.ObjectID = objectID
+	}
+
+	var last *EGTSData
+	for len(data) > 0 {
+		if len(data) < 3 {
+			return nil, fmt.Errorf("%w: subrecord header truncated in record %d", ErrMalformedRecord, record.Number)
+		}
+		kind := data[0]
+		size := int(binary.LittleEndian.Uint16(data[1:]))
+		if len(data) < 3+size {
+			return nil, fmt.Errorf("%w: subrecord %d needs %d bytes", ErrMalformedRecord, kind, size)
+		}
+		sub := data[3 : 3+size]
+		data = data[3+size:]
+
+		switch {
+		case record.Service == ServiceAuth && kind == subrecordIdentity:
+			if err := decodeIdentity(sub, packet); err != nil {
+				return nil, err
+			}
+		case record.Service == ServiceTeledata && kind == subrecordPosData:
+			fix, err := decodePosData(sub)
+			if err != nil {
+				return nil, err
+			}
+			if fix.Timestamp.IsZero() {
+				fix.Timestamp = sent
+			}
+			packet.Positions = append(packet.Positions, fix)
+			last = fix
+		case record.Service == ServiceTeledata && kind == subrecordExtPosData:
+			if last != nil {
+				decodeExtPosData(sub, last)
+			}
+		default:
+			d.logDebug("Skipping subrecord %d of service %d", kind, record.Service)
+		}
+	}
+	return body[pos+2+length:], nil
+}
+
+// decodeIdentity reads TERM_IDENTITY: terminal ID(4) flags(1) and the
+// fields the flags announce, of which only the IMEI is kept
+func decodeIdentity(sub []byte, packet *Packet) error {
+	if len(sub) < 5 {
+		return fmt.Errorf("%w: TERM_IDENTITY needs 5 bytes", ErrMalformedRecord)
+	}
+	packet.TerminalID = binary.LittleEndian.Uint32(sub)
+	flags := sub[4]
+	pos := 5
+	if flags&identityHomeDispatch != 0 {
+		pos += 2
+	}
+	if flags&identityIMEI != 0 {
+		if len(sub) < pos+15 {
+			return fmt.Errorf("%w: TERM_IDENTITY IMEI truncated", ErrMalformedRecord)
+		}
+		if imei := string(sub[pos : pos+15]); imei != "000000000000000" {
+			packet.IMEI = imei
+		}
+	}
+	return nil
+}
+
+// decodePosData reads POS_DATA: time(4) latitude(4) longitude(4) flags(1)
+// speed(2) direction(1) odometer(3) inputs(1) source(1) [altitude(3)]
+func decodePosData(sub []byte) (*EGTSData, error) {
+	if len(sub) < minPosData {
+		return nil, fmt.Errorf("%w: POS_DATA got %d bytes, need %d", ErrMalformedRecord, len(sub), minPosData)
+	}
+	flags := sub[12]
+	speed := binary.LittleEndian.Uint16(sub[13:])
+	fix := &EGTSData{
+		Latitude:  float64(binary.LittleEndian.Uint32(sub[4:])) * 90 / 0xFFFFFFFF,
+		Longitude: float64(binary.LittleEndian.Uint32(sub[8:])) * 180 / 0xFFFFFFFF,
+		Speed:     float64(speed&0x3FFF) / 10,
+		Course:    float64(sub[15]),
+		Valid:     flags&posValid != 0,
+		Status:    make(map[string]interface{}),
+	}
+	if seconds := binary.LittleEndian.Uint32(sub); seconds != 0 {
+		fix.Timestamp = epoch.Add(time.Duration(seconds) * time.Second)
+	}
+	if flags&posSouth != 0 {
+		fix.Latitude = -fix.Latitude
+	}
+	if flags&posWest != 0 {
+		fix.Longitude = -fix.Longitude
+	}
+	if speed&speedDirHigh != 0 {
+		fix.Course += 256
+	}
+
+	fix.Status["odometer"] = float64(uint24(sub[16:])) * 100 // 0.1 km to meters
+	fix.Status["input"] = sub[19]
+	fix.Status["event"] = sub[20]
+	fix.Status["motion"] = flags&posMoving != 0
+	if flags&posBlackBox != 0 {
+		fix.Status["buffered"] = true
+	}
+	if flags&posAltitude != 0 && len(sub) >= minPosData+3 {
+		fix.Altitude = float64(uint24(sub[minPosData:]))
+		if speed&speedAltSign != 0 {
+			fix.Altitude = -fix.Altitude
+		}
+	}
+	return fix, nil
+}
+
+// decodeExtPosData adds the dilutions and satellites of EXT_POS_DATA:
+// flags(1) then VDOP, HDOP, PDOP(2 each, in 0.01) and satellites(1) and
+// navigation systems(2) as flagged
+func decodeExtPosData(sub []byte, fix *EGTSData) {
+	if len(sub) < 1 {
+		return
+	}
+	flags := sub[0]
+	pos := 1
+	for i, key := range []string{"vdop", "hdop", "pdop"} {
+		if flags&(1<<i) == 0 {
+			continue
+		}
+		if len(sub) < pos+2 {
+			return
+		}
+		fix.Status[key] = float64(binary.LittleEndian.Uint16(sub[pos:])) / 100
+		pos += 2
+	}
+	if flags&0x08 != 0 && len(sub) > pos {
+		fix.Satellites = int(sub[pos])
+		fix.Status["satellites"] = fix.Satellites
+	}
+}
+
+// Response confirms every record of a packet, and answers a terminal
+// identity with a result code, numbering each packet and record it builds
+// from serial
+func (d *Decoder) Response(packet *Packet, serial *uint16) []byte {
+	next := func() uint16 {
+		*serial++
+		return *serial
+	}
+
+	body := binary.LittleEndian.AppendUint16(nil, packet.ID)
+	body = append(body, 0) // Processed
+	identified := false
+	for _, record := range packet.Records {
+		confirmation := binary.LittleEndian.AppendUint16([]byte{subrecordResponse, 3, 0}, record.Number)
+		body = appendRecord(body, next(), record.Service, append(confirmation, 0))
+		identified = identified || record.Service == ServiceAuth && packet.TerminalID != 0
+	}
+	response := encodePacket(PacketResponse, next(), body)
+
+	if identified {
+		result := appendRecord(nil, next(), ServiceAuth, []byte{subrecordResultCode, 1, 0, 0})
+		response = append(response, encodePacket(PacketAppData, next(), result)...)
+	}
+	return response
+}
+
+// appendRecord appends a service record without optional fields
+func appendRecord(body []byte, number uint16, service uint8, data []byte) []byte {
+	body = binary.LittleEndian.AppendUint16(body, uint16(len(data)))
+	body = binary.LittleEndian.AppendUint16(body, number)
+	body = append(body, 0, service, service)
+	return append(body, data...)
+}
+
+// encodePacket wraps frame data in an unrouted transport packet
+func encodePacket(packetType uint8, id uint16, body []byte) []byte {
+	packet := []byte{protocolVersion, 0, 0, headerSize, 0}
+	packet = binary.LittleEndian.AppendUint16(packet, uint16(len(body)))
+	packet = binary.LittleEndian.AppendUint16(packet, id)
+	packet = append(packet, packetType)
+	packet = append(packet, crc8(packet))
+	packet = append(packet, body...)
+	return binary.LittleEndian.AppendUint16(packet, crc16(body))
+}
+
+func uint24(b []byte) uint32 {
+	return uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16
+}
+
+// crc8 is the header checksum: polynomial 0x31, initial value 0xFF
+func crc8(data []byte) byte {
+	crc := byte(0xFF)
+	for _, b := range data {
+		crc ^= b
+		for i := 0; i < 8; i++ {
+			if crc&0x80 != 0 {
+				crc = crc<<1 ^ 0x31
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// crc16 is the frame checksum, CRC-16/CCITT-FALSE
+func crc16(data []byte) uint16 {
+	crc := uint16(0xFFFF)
+	for _, b := range data {
+		crc ^= uint16(b) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// ToPosition converts the fix of a POS_DATA subrecord
+func (d *Decoder) ToPosition(deviceID string, data *EGTSData) *model.Position {
+	position := model.NewPosition(deviceID, data.Latitude, data.Longitude)
+	position.Altitude = data.Altitude
+	position.Speed = data.Speed
+	position.Course = data.Course
+	position.Valid = data.Valid
+	position.Satellites = uint8(data.Satellites)
+	position.SetDecodedTime(data.Timestamp, d.clock.Now())
+	position.Protocol = "egts"
+
+	position.Status = make(map[string]interface{}, len(data.Status))
+	for k, v := range data.Status {
+		position.Status[k] = v
+	}
+	return position
+}
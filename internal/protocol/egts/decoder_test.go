@@ -0,0 +1,198 @@
+package egts
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"testing"
+	"time"
+	"tracking/internal/core/util"
+)
+
+var fixTime = time.Date(2024, 1, 15, 9, 58, 20, 0, time.UTC)
+
+// identityPacket builds the auth packet of terminal 1001 with its IMEI
+func identityPacket(id uint16) []byte {
+	identity := binary.LittleEndian.AppendUint32(nil, 1001)
+	identity = append(identity, identityIMEI)
+	identity = append(identity, "356307042441013"...)
+	subrecord := binary.LittleEndian.AppendUint16([]byte{subrecordIdentity}, uint16(len(identity)))
+	return encodePacket(PacketAppData, id, appendRecord(nil, 1, ServiceAuth, append(subrecord, identity...)))
+}
+
+// posData builds a POS_DATA subrecord fixed in Moscow at 60.5 km/h heading
+// 300 degrees, 150 m high
+func posData(flags uint8) []byte {
+	data := binary.LittleEndian.AppendUint32(nil, uint32(fixTime.Sub(epoch).Seconds()))
+	data = binary.LittleEndian.AppendUint32(data, uint32(math.Round(55.755833/90*0xFFFFFFFF)))
+	data = binary.LittleEndian.AppendUint32(data, uint32(math.Round(37.6175/180*0xFFFFFFFF)))
+	data = append(data, flags)
+	data = binary.LittleEndian.AppendUint16(data, 605|speedDirHigh)
+	data = append(data, 300-256)
+	data = append(data, 0x39, 0x30, 0x00) // 1234.5 km
+	data = append(data, 0x05, 0x10)       // Inputs, source
+	data = append(data, 150, 0, 0)
+	return append(binary.LittleEndian.AppendUint16([]byte{subrecordPosData}, uint16(len(data))), data...)
+}
+
+// teledataPacket builds a teledata packet of object 1001 with one record
+// per fix, the first followed by EXT_POS_DATA with HDOP 0.9 and 11
+// satellites
+func teledataPacket(id uint16, fixes ...[]byte) []byte {
+	var body []byte
+	for i, fix := range fixes {
+		data := append([]byte(nil), fix...)
+		if i == 0 {
+			data = append(data, subrecordExtPosData, 4, 0, 0x02|0x08, 90, 0, 11)
+		}
+		body = binary.LittleEndian.AppendUint16(body, uint16(len(data)))
+		body = binary.LittleEndian.AppendUint16(body, uint16(10+i))
+		body = append(body, recordObjectID)
+		body = binary.LittleEndian.AppendUint32(body, 1001)
+		body = append(body, ServiceTeledata, ServiceTeledata)
+		body = append(body, data...)
+	}
+	return encodePacket(PacketAppData, id, body)
+}
+
+func TestChecksums(t *testing.T) {
+	if got := crc8([]byte("123456789")); got != 0xF7 {
+		t.Errorf("crc8() = 0x%02x, want 0xf7", got)
+	}
+	if got := crc16([]byte("123456789")); got != 0x29B1 {
+		t.Errorf("crc16() = 0x%04x, want 0x29b1", got)
+	}
+}
+
+func TestDecodeIdentity(t *testing.T) {
+	decoder := NewDecoder()
+	data := identityPacket(7)
+
+	if !IsFrame(data) {
+		t.Fatal("IsFrame() = false")
+	}
+	if size, err := PacketSize(data); err != nil || size != len(data) {
+		t.Errorf("PacketSize() = %d, %v, want %d", size, err, len(data))
+	}
+	packet, err := decoder.Decode(data)
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if packet.ID != 7 || packet.TerminalID != 1001 || packet.IMEI != "356307042441013" || len(packet.Positions) != 0 {
+		t.Errorf("Decode() = %+v", packet)
+	}
+	if id, err := DeviceID(data); err != nil || id != "356307042441013" {
+		t.Errorf("DeviceID() = %q, %v", id, err)
+	}
+
+	// The record is confirmed and the terminal told it is authorised
+	serial := uint16(0)
+	response := decoder.Response(packet, &serial)
+	first, err := decoder.Decode(response)
+	if err != nil || first.Type != PacketResponse || len(first.Records) != 1 {
+		t.Fatalf("Response() = % x: %+v, %v", response, first, err)
+	}
+	if rpid := response[headerSize : headerSize+2]; !bytes.Equal(rpid, []byte{7, 0}) {
+		t.Errorf("Response confirms packet % x, want 07 00", rpid)
+	}
+	size, _ := PacketSize(response)
+	result, err := decoder.Decode(response[size:])
+	if err != nil || result.Type != PacketAppData || len(result.Records) != 1 || result.Records[0].Service != ServiceAuth {
+		t.Errorf("Result code packet = %+v, %v", result, err)
+	}
+	if serial != 4 {
+		t.Errorf("serial = %d, want 4 after two records and two packets", serial)
+	}
+}
+
+func TestDecodePositions(t *testing.T) {
+	decoder := NewDecoder()
+	data := teledataPacket(8, posData(posValid|posMoving|posAltitude), posData(posValid|posBlackBox|posSouth|posWest))
+
+	packet, err := decoder.Decode(data)
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if len(packet.Records) != 2 || len(packet.Positions) != 2 || packet.ObjectID != 1001 {
+		t.Fatalf("Decode() = %+v", packet)
+	}
+	if id, _ := packet.DeviceID(); id != "1001" {
+		t.Errorf("DeviceID() = %q, want the object ID", id)
+	}
+
+	fix := packet.Positions[0]
+	if !fix.Valid || math.Abs(fix.Latitude-55.755833) > 1e-6 || math.Abs(fix.Longitude-37.6175) > 1e-6 ||
+		fix.Speed != 60.5 || fix.Course != 300 || fix.Altitude != 150 || fix.Satellites != 11 || !fix.Timestamp.Equal(fixTime) {
+		t.Errorf("Positions[0] = %+v", fix)
+	}
+	if fix.Status["odometer"] != 1234500.0 || fix.Status["input"] != uint8(5) || fix.Status["event"] != uint8(0x10) ||
+		fix.Status["hdop"] != 0.9 || fix.Status["motion"] != true || fix.Status["buffered"] != nil {
+		t.Errorf("Status = %v", fix.Status)
+	}
+
+	// Hemispheres come from the flags; altitude only when flagged
+	fix = packet.Positions[1]
+	if fix.Latitude > 0 || fix.Longitude > 0 || fix.Altitude != 0 || fix.Status["buffered"] != true {
+		t.Errorf("Positions[1] = %+v", fix)
+	}
+
+	position := decoder.ToPosition("device-1", packet.Positions[0])
+	if position.Protocol != "egts" || position.Satellites != 11 || position.Status["odometer"] != 1234500.0 {
+		t.Errorf("ToPosition() = %+v", position)
+	}
+
+	// No result code follows a teledata confirmation
+	serial := uint16(100)
+	response := decoder.Response(packet, &serial)
+	if size, _ := PacketSize(response); size != len(response) {
+		t.Errorf("Response() = % x, want a single packet", response)
+	}
+}
+
+func TestDecodeWithoutTime(t *testing.T) {
+	decoder := NewDecoder()
+	decoder.SetClock(util.NewFixedClock(time.Date(2024, 1, 16, 8, 0, 0, 0, time.UTC)))
+
+	fix := posData(0)
+	copy(fix[3:], []byte{0, 0, 0, 0})
+	packet, err := decoder.Decode(teledataPacket(1, fix))
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	position := decoder.ToPosition("device-1", packet.Positions[0])
+	if position.Valid || !position.Timestamp.Equal(time.Date(2024, 1, 16, 8, 0, 0, 0, time.UTC)) {
+		t.Errorf("ToPosition() = %+v, want an invalid fix at the clock", position)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	valid := teledataPacket(1, posData(posValid))
+	badHeader := append([]byte(nil), valid...)
+	badHeader[headerSize-1] ^= 0xFF
+	badFrame := append([]byte(nil), valid...)
+	badFrame[len(badFrame)-1] ^= 0xFF
+	shortFix := teledataPacket(1, posData(posValid)[:10])
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr error
+	}{
+		{"header checksum", badHeader, ErrInvalidHeader},
+		{"frame checksum", badFrame, ErrInvalidChecksum},
+		{"truncated packet", valid[:len(valid)-4], ErrPacketTooShort},
+		{"truncated POS_DATA", shortFix, ErrMalformedRecord},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewDecoder().Decode(tt.data); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Decode() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if IsFrame([]byte("$MGV002,")) {
+		t.Error("IsFrame() accepted a text report")
+	}
+}
@@ -2,41 +2,68 @@
 package gt06
 
 import (
-	"bytes"
 	"fmt"
 	"log"
-	"time"
 	"tracking/internal/core/model"
+	"tracking/internal/core/util"
 )
 
 // Response types (only used in decoder.go)
 const (
-	LoginResp    = 0x01
-	LocationResp = 0x12
-	AlarmResp    = 0x16
+	LoginResp     = 0x01
+	LocationResp  = 0x12
+	HeartbeatResp = 0x13
+	AlarmResp     = 0x16
 )
 
 // Decoder implements the GT06 protocol decoder
 type Decoder struct {
-	debug bool
+	debug        bool
+	debugSwitch  func() bool // Read on every line in place of debug when set
+	clock        util.Clock
+	checksumMode ChecksumMode
 }
 
 func NewDecoder() *Decoder {
-	return &Decoder{debug: false}
+	return &Decoder{debug: false, clock: util.SystemClock, checksumMode: ChecksumCRCITU}
 }
 
 func (d *Decoder) EnableDebug(enable bool) {
 	d.debug = enable
 }
 
+// SetDebugSwitch has debug logging follow a switch instead, so it can be
+// turned on and off while devices are connected
+func (d *Decoder) SetDebugSwitch(enabled func() bool) {
+	d.debugSwitch = enabled
+}
+
+func (d *Decoder) debugging() bool {
+	if d.debugSwitch != nil {
+		return d.debugSwitch()
+	}
+	return d.debug
+}
+
+// SetChecksumMode selects the checksum algorithm used for incoming packets
+// and generated responses; clones that use XOR need ChecksumXOR
+func (d *Decoder) SetChecksumMode(mode ChecksumMode) {
+	d.checksumMode = mode
+}
+
+// SetClock sets the clock positions are marked as received by
+func (d *Decoder) SetClock(clock util.Clock) {
+	d.clock = clock
+}
+
 func (d *Decoder) logDebug(format string, v ...interface{}) {
-	if d.debug {
+	if d.debugging() {
 		log.Printf("[GT06] "+format, v...)
 	}
 }
 
 func (d *Decoder) logPacket(data []byte, prefix string) {
-	if !d.debug {
+	if !d.debugging() {
 		return
 	}
 
@@ -50,21 +77,22 @@ func (d *Decoder) logPacket(data []byte, prefix string) {
 	d.logDebug("%s Packet [%d bytes]:\n        %s", prefix, len(data), hexStr)
 }
 
-func (d *Decoder) Decode(data []byte) (*model.GT06Data, error) { // Changed to use model.GT06Data
+func (d *Decoder) Decode(data []byte) (*GT06Data, error) {
 	d.logDebug("Starting packet decode...")
 	d.logPacket(data, "Received")
 
-	if len(data) < MinPacketLength {
-		return nil, fmt.Errorf("%w: need at least %d bytes",
-			ErrPacketTooShort, MinPacketLength)
+	declaredLen, headerSize, err := ParseFrameHeader(data)
+	if err != nil {
+		return nil, err
 	}
 
-	if data[0] != StartByte1 || data[1] != StartByte2 {
-		return nil, fmt.Errorf("%w: expected 0x%02x%02x, got 0x%02x%02x",
-			ErrInvalidHeader, StartByte1, StartByte2, data[0], data[1])
+	expectedLen := len(data) - headerSize - 2 // subtract start, length and end(2)
+	if declaredLen != expectedLen {
+		return nil, fmt.Errorf("%w: declared=%d, actual=%d",
+			ErrInvalidLength, declaredLen, expectedLen)
 	}
 
-	protocolNumber := data[3]
+	protocolNumber := data[headerSize]
 	d.logDebug("Protocol number: 0x%02x", protocolNumber)
 
 	var minLength int
@@ -75,26 +103,41 @@ func (d *Decoder) Decode(data []byte) (*model.GT06Data, error) { // Changed to u
 		minLength = MinLocationLength
 	case StatusMsg:
 		minLength = MinStatusLength
+	case ReplyMsg:
+		minLength = MinReplyLength
 	case AlarmMsg:
 		minLength = MinAlarmLength
+	case GPSLBSMsg:
+		minLength = MinGPSLBSLength
+	case LBSMultiMsg:
+		minLength = MinLBSMultiLength
+	case WiFiMsg:
+		minLength = MinWiFiLength
+	case InfoMsg:
+		minLength = MinInfoLength
+	case ModuleMsg:
+		minLength = MinModuleLength
+	case GPS4GMsg:
+		minLength = MinGPS4GLength
+	case Alarm4GMsg:
+		minLength = MinAlarm4GLength
 	default:
-		return nil, fmt.Errorf("%w: 0x%02x", ErrInvalidMessageType, protocolNumber)
+		// Jimi models send large packets such as OBD data and photos in
+		// extended frames; these are accepted undecoded
+		if headerSize == 3 {
+			return nil, fmt.Errorf("%w: 0x%02x", ErrInvalidMessageType, protocolNumber)
+		}
+		minLength = MinOpaqueLength
 	}
+	minLength += headerSize - 3 // Minimums are for standard frames
 
 	if len(data) < minLength {
 		return nil, fmt.Errorf("%w: got %d bytes, need at least %d for protocol 0x%02x",
 			ErrPacketTooShort, len(data), minLength, protocolNumber)
 	}
 
-	declaredLen := int(data[2])
-	expectedLen := len(data) - 5 // subtract start(2), len(1), checksum(2)
-	if declaredLen != expectedLen {
-		return nil, fmt.Errorf("%w: declared=%d, actual=%d",
-			ErrInvalidLength, declaredLen, expectedLen)
-	}
-
 	checksumPos := len(data) - 4
-	calcChecksum := CalculateChecksum(data[2:checksumPos])
+	calcChecksum := d.checksumMode.Calculate(data[2:checksumPos])
 	recvChecksum := uint16(data[checksumPos])<<8 | uint16(data[checksumPos+1])
 
 	if calcChecksum != recvChecksum {
@@ -106,11 +149,10 @@ func (d *Decoder) Decode(data []byte) (*model.GT06Data, error) { // Changed to u
 		return nil, fmt.Errorf("%w: invalid end bytes", ErrMalformedPacket)
 	}
 
-	content := data[4:checksumPos]
+	content := data[headerSize+1 : checksumPos]
 	d.logDebug("Content length: %d bytes", len(content))
 
-	var result *model.GT06Data // Changed to use model.GT06Data
-	var err error
+	var result *GT06Data
 
 	switch protocolNumber {
 	case LoginMsg:
@@ -121,6 +163,23 @@ func (d *Decoder) Decode(data []byte) (*model.GT06Data, error) { // Changed to u
 		result, err = d.decodeStatusMessage(content)
 	case AlarmMsg:
 		result, err = d.decodeAlarmMessage(content)
+	case GPSLBSMsg:
+		result, err = d.decodeGPSLBSMessage(content)
+	case ReplyMsg:
+		result, err = ParseReply(content)
+	case LBSMultiMsg, WiFiMsg:
+		result, err = ParseNetworkMessage(protocolNumber, content)
+	case InfoMsg:
+		result, err = ParseInfoMessage(content)
+	case ModuleMsg:
+		result, err = ParseModuleMessage(content)
+	case GPS4GMsg:
+		result, err = d.decodeGPS4GMessage(content)
+	case Alarm4GMsg:
+		result, err = d.decodeAlarm4GMessage(content)
+	default:
+		d.logDebug("Accepting undecoded %s packet of %d bytes", GetMessageTypeName(protocolNumber), len(content))
+		result = &GT06Data{Opaque: true, Status: make(map[string]interface{})}
 	}
 
 	if err != nil {
@@ -128,15 +187,17 @@ func (d *Decoder) Decode(data []byte) (*model.GT06Data, error) { // Changed to u
 			GetMessageTypeName(protocolNumber), err)
 	}
 
+	result.Serial = ParseSerial(protocolNumber, content)
+	result.Protocol = protocolNumber
 	return result, nil
 }
 
-func (d *Decoder) decodeLocationMessage(data []byte) (*model.GT06Data, error) { // Changed to use model.GT06Data
+func (d *Decoder) decodeLocationMessage(data []byte) (*GT06Data, error) {
 	if len(data) < 10 {
 		return nil, fmt.Errorf("location message too short: got %d bytes, need 10", len(data))
 	}
 
-	result := &model.GT06Data{ // Changed to use model.GT06Data
+	result := &GT06Data{
 		Valid:  true,
 		Status: make(map[string]interface{}),
 	}
@@ -149,7 +210,7 @@ func (d *Decoder) decodeLocationMessage(data []byte) (*model.GT06Data, error) {
 	if result.Latitude, err = BcdToFloat(uint32(data[1])<<24 | uint32(data[2])<<16 | uint32(data[3])<<8 | uint32(data[4])); err != nil {
 		return nil, fmt.Errorf("invalid latitude: %w", err)
 	}
-	if result.Longitude, err = BcdToFloat(uint32(data[5])<<24 | uint32(data[6])<<16 | uint32(data[7])<<8 | uint32(data[8])); err != nil {
+	if result.Longitude, err = BcdToLongitude(uint32(data[5])<<24 | uint32(data[6])<<16 | uint32(data[7])<<8 | uint32(data[8])); err != nil {
 		return nil, fmt.Errorf("invalid longitude: %w", err)
 	}
 
@@ -163,7 +224,7 @@ func (d *Decoder) decodeLocationMessage(data []byte) (*model.GT06Data, error) {
 	}
 
 	if len(data) >= 16 {
-		if ts, err := ParseTimestamp(bytes.NewReader(data[12:18])); err == nil {
+		if ts, err := ParseTimestamp(data[12:18]); err == nil {
 			result.Timestamp = ts
 		}
 	}
@@ -171,23 +232,30 @@ func (d *Decoder) decodeLocationMessage(data []byte) (*model.GT06Data, error) {
 	return result, nil
 }
 
-func (d *Decoder) decodeStatusMessage(data []byte) (*model.GT06Data, error) { // Changed to use model.GT06Data
+func (d *Decoder) decodeStatusMessage(data []byte) (*GT06Data, error) {
 	if len(data) < 4 {
 		return nil, fmt.Errorf("%w: status message too short", ErrInvalidLength)
 	}
 
-	result := &model.GT06Data{ // Changed to use model.GT06Data
+	result := &GT06Data{
 		Valid:  true,
 		Status: make(map[string]interface{}),
 	}
 
+	if ok, err := ParseTerminalStatus(data, result); ok {
+		if err != nil {
+			return nil, err
+		}
+		return result, nil
+	}
+
 	statusByte := data[0]
 	result.PowerLevel = int((statusByte >> 4) & 0x0F)
 	result.GSMSignal = int(statusByte & 0x0F)
 
-	if result.PowerLevel > 15 {
-		return nil, fmt.Errorf("%w: power level %d exceeds maximum of 15",
-			ErrMalformedPacket, result.PowerLevel)
+	if result.PowerLevel > MaxPowerLevel {
+		return nil, fmt.Errorf("%w: power level %d exceeds maximum of %d",
+			ErrMalformedPacket, result.PowerLevel, MaxPowerLevel)
 	}
 
 	result.Status["powerLevel"] = result.PowerLevel
@@ -201,12 +269,12 @@ func (d *Decoder) decodeStatusMessage(data []byte) (*model.GT06Data, error) { //
 	return result, nil
 }
 
-func (d *Decoder) decodeLoginMessage(data []byte) (*model.GT06Data, error) { // Changed to use model.GT06Data
+func (d *Decoder) decodeLoginMessage(data []byte) (*GT06Data, error) {
 	if len(data) < 8 {
 		return nil, fmt.Errorf("login message too short")
 	}
 
-	result := &model.GT06Data{ // Changed to use model.GT06Data
+	result := &GT06Data{
 		Valid:  true,
 		Status: make(map[string]interface{}),
 	}
@@ -215,27 +283,68 @@ func (d *Decoder) decodeLoginMessage(data []byte) (*model.GT06Data, error) { //
 	return result, nil
 }
 
-func (d *Decoder) decodeAlarmMessage(data []byte) (*model.GT06Data, error) { // Changed to use model.GT06Data
-	locationData, err := d.decodeLocationMessage(data[:len(data)-1])
+func (d *Decoder) decodeAlarmMessage(data []byte) (*GT06Data, error) {
+	locationData, err := d.decodeLocationMessage(data[:GPSInfoLength])
 	if err != nil {
 		return nil, fmt.Errorf("failed to decode location part: %w", err)
 	}
 
-	alarmType := data[len(data)-1]
+	alarmType := data[GPSInfoLength]
 	locationData.Alarm = GetAlarmName(alarmType)
 	locationData.Status["alarm"] = locationData.Alarm
 
 	return locationData, nil
 }
 
-func (d *Decoder) ToPosition(deviceID string, data *model.GT06Data) *model.Position { // Changed to use model.GT06Data and model.Position
+func (d *Decoder) decodeGPSLBSMessage(data []byte) (*GT06Data, error) {
+	if len(data) < GPSInfoLength+LBSInfoLength {
+		return nil, fmt.Errorf("%w: GPS/LBS message too short: got %d bytes, need %d",
+			ErrInvalidLength, len(data), GPSInfoLength+LBSInfoLength)
+	}
+
+	result, err := d.decodeLocationMessage(data[:GPSInfoLength])
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode location part: %w", err)
+	}
+
+	if err := ParseLBSInfo(data[GPSInfoLength:], result.Status); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (d *Decoder) decodeGPS4GMessage(data []byte) (*GT06Data, error) {
+	result, err := d.decodeLocationMessage(data[:GPSInfoLength])
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode location part: %w", err)
+	}
+	if err := ParseGPS4GInfo(data[GPSInfoLength:], result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (d *Decoder) decodeAlarm4GMessage(data []byte) (*GT06Data, error) {
+	result, err := d.decodeLocationMessage(data[:GPSInfoLength])
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode location part: %w", err)
+	}
+	if err := ParseAlarm4GInfo(data[GPSInfoLength:], result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (d *Decoder) ToPosition(deviceID string, data *GT06Data) *model.Position {
 	position := model.NewPosition(deviceID, data.Latitude, data.Longitude)
 	position.Speed = data.Speed
 	position.Course = data.Course
 	position.Valid = data.GPSValid
 	position.Protocol = "gt06"
-	position.Satellites = data.Satellites
-	position.Timestamp = data.Timestamp
+	position.Satellites = uint8(data.Satellites)
+	position.Network = data.Network
+	position.SetDecodedTime(data.Timestamp, d.clock.Now())
 
 	position.Status = make(map[string]interface{})
 	if data.PowerLevel > 0 {
@@ -258,186 +367,43 @@ func (d *Decoder) ToPosition(deviceID string, data *model.GT06Data) *model.Posit
 	return position
 }
 
-func (d *Decoder) GenerateResponse(msgType uint8, deviceID string) []byte {
+// GenerateResponse builds the acknowledgement for a message, echoing the
+// serial number of the packet being acknowledged
+func (d *Decoder) GenerateResponse(msgType uint8, serial uint16) []byte {
 	switch msgType {
 	case LoginMsg:
-		return d.generateLoginResponse(deviceID)
+		return d.generateAck(LoginResp, serial)
 	case LocationMsg:
-		return d.generateLocationResponse()
+		return d.generateAck(LocationResp, serial)
+	case StatusMsg:
+		return d.GenerateHeartbeatResponse(serial)
 	case AlarmMsg:
-		return d.generateAlarmResponse()
+		return d.generateAck(AlarmResp, serial)
+	case InfoMsg:
+		return nil // Information packets are not acknowledged
 	default:
-		return d.generateLocationResponse() // Default to location response
+		return d.generateAck(msgType, serial) // Other packets echo their own protocol number
 	}
 }
 
-func (d *Decoder) generateLoginResponse(deviceID string) []byte {
-	respLen := len(deviceID) + 10 // Add length of fixed fields
-	resp := make([]byte, 0, respLen+5)
-
-	resp = append(resp, StartByte1, StartByte2)
-	resp = append(resp, byte(respLen))
-	resp = append(resp, LoginResp)
-	resp = append(resp, []byte(deviceID)...)
-
-	now := time.Now().UTC()
-	resp = append(resp, byte(now.Hour()), byte(now.Minute()))
-	resp = append(resp, 0x00, 0x01) // Serial number
-	resp = append(resp, 0x00, 0x00) // Error code (success)
-
-	crc := CalculateChecksum(resp[2:])
-	resp = append(resp, byte(crc>>8), byte(crc))
-	resp = append(resp, EndByte1, EndByte2)
-
-	return resp
-}
-
-func (d *Decoder) generateLocationResponse() []byte {
-	resp := []byte{
-		StartByte1, StartByte2,
-		0x05,          // Packet length
-		LocationResp,  // Protocol number
-		0x00, 0x01,   // Serial number
-		0x00, 0x01,   // CRC
-		EndByte1, EndByte2,
-	}
-	return resp
+// GenerateHeartbeatResponse acknowledges a heartbeat by echoing its serial
+// number; devices drop the connection when heartbeats go unanswered
+func (d *Decoder) GenerateHeartbeatResponse(serial uint16) []byte {
+	return d.generateAck(HeartbeatResp, serial)
 }
 
-func (d *Decoder) generateAlarmResponse() []byte {
+// generateAck builds a short acknowledgement for the given protocol
+func (d *Decoder) generateAck(protocol byte, serial uint16) []byte {
 	resp := []byte{
 		StartByte1, StartByte2,
-		0x05,         // Packet length
-		AlarmResp,    // Protocol number
-		0x00, 0x01,  // Serial number
-		0x00, 0x01,  // CRC
-		EndByte1, EndByte2,
-	}
-	return resp
-}
-
-func GetMessageTypeName(protocolNumber byte) string {
-	switch protocolNumber {
-	case LoginMsg:
-		return "login"
-	case LocationMsg:
-		return "location"
-	case StatusMsg:
-		return "status"
-	case AlarmMsg:
-		return "alarm"
-	default:
-		return fmt.Sprintf("unknown_0x%02x", protocolNumber)
-	}
-}
-
-func CalculateChecksum(data []byte) uint16 {
-	var sum uint16
-	for _, b := range data {
-		sum ^= uint16(b)
+		0x05,                            // Packet length
+		protocol,                        // Protocol number
+		byte(serial >> 8), byte(serial), // Serial number
 	}
-	return sum
-}
-
-func BcdToFloat(bcd uint32) (float64, error) {
-	degrees := float64(bcdToDec(byte(bcd>>24)))*10 +
-		float64(bcdToDec(byte((bcd>>16)&0xFF)))/60 +
-		float64(bcdToDec(byte((bcd>>8)&0xFF)))/3600
-	return degrees, nil
-}
-
-func bcdToDec(b byte) int {
-	return int(b>>4)*10 + int(b&0x0F)
-}
-
-func ParseTimestamp(reader *bytes.Reader) (time.Time, error) {
-	var timeBytes [6]byte
-	if _, err := reader.Read(timeBytes[:]); err != nil {
-		return time.Time{}, err
-	}
-
-	year := 2000 + ((int(timeBytes[0])>>4)*10 + int(timeBytes[0]&0x0F))
-	month := (int(timeBytes[1])>>4)*10 + int(timeBytes[1]&0x0F)
-	day := (int(timeBytes[2])>>4)*10 + int(timeBytes[2]&0x0F)
-	hour := (int(timeBytes[3])>>4)*10 + int(timeBytes[3]&0x0F)
-	minute := (int(timeBytes[4])>>4)*10 + int(timeBytes[4]&0x0F)
-	second := (int(timeBytes[5])>>4)*10 + int(timeBytes[5]&0x0F)
-
-	if month < 1 || month > 12 || day < 1 || day > 31 ||
-		hour > 23 || minute > 59 || second > 59 {
-		return time.Time{}, ErrInvalidTimestamp
-	}
-
-	return time.Date(year, time.Month(month), day, hour, minute, second, 0, time.UTC), nil
-}
 
-func ValidateCoordinates(latitude, longitude float64) error {
-	if latitude < -90 || latitude > 90 || longitude < -180 || longitude > 180 {
-		return ErrInvalidCoordinate
-	}
-	return nil
-}
+	crc := d.checksumMode.Calculate(resp[2:])
+	resp = append(resp, byte(crc>>8), byte(crc))
+	resp = append(resp, EndByte1, EndByte2)
 
-func GetAlarmName(alarmType byte) string {
-	switch alarmType {
-	case SosAlarm:
-		return "sos"
-	case PowerCutAlarm:
-		return "powerCut"
-	case VibrationAlarm:
-		return "vibration"
-	case FenceInAlarm:
-		return "geofenceEnter"
-	case FenceOutAlarm:
-		return "geofenceExit"
-	case LowBatteryAlarm:
-		return "lowBattery"
-	case OverspeedAlarm:
-		return "overspeed"
-	default:
-		return fmt.Sprintf("unknown_%02x", alarmType)
-	}
+	return resp
 }
-
-
-// Common GT06 errors
-var (
-	ErrInvalidHeader      = fmt.Errorf("invalid GT06 protocol header")
-	ErrPacketTooShort     = fmt.Errorf("data too short for GT06 protocol")
-	ErrInvalidChecksum    = fmt.Errorf("invalid checksum")
-	ErrInvalidCoordinate  = fmt.Errorf("invalid BCD coordinate value")
-	ErrInvalidTimestamp   = fmt.Errorf("invalid timestamp values")
-	ErrInvalidLength      = fmt.Errorf("packet length mismatch")
-	ErrInvalidMessageType = fmt.Errorf("unsupported message type")
-	ErrMalformedPacket    = fmt.Errorf("malformed packet structure")
-)
-
-// Protocol constants
-const (
-	// Packet markers
-	StartByte1 = 0x78
-	StartByte2 = 0x78
-	EndByte1   = 0x0D
-	EndByte2   = 0x0A
-
-	// Message types
-	LoginMsg    = 0x01
-	LocationMsg = 0x12
-	StatusMsg   = 0x13
-	AlarmMsg    = 0x16
-
-	// Alarm types
-	SosAlarm        = 0x01
-	PowerCutAlarm   = 0x02
-	VibrationAlarm  = 0x03
-	FenceInAlarm    = 0x04
-	FenceOutAlarm   = 0x05
-	LowBatteryAlarm = 0x06
-	OverspeedAlarm  = 0x07
-
-	MinPacketLength    = 7
-	MinLoginLength     = 15
-	MinLocationLength  = 26
-	MinStatusLength    = 13
-	MinAlarmLength     = 27
-)
\ No newline at end of file
@@ -2,21 +2,11 @@ package gt06
 
 import (
 	"fmt"
+	"reflect"
 	"testing"
 	"time"
 )
 
-const (
-	StartByte1 = 0x78
-	StartByte2 = 0x78
-	EndByte1   = 0x0D
-	EndByte2   = 0x0A
-	LocationMsg = 0x12
-	StatusMsg   = 0x13
-	AlarmMsg    = 0x16
-	SosAlarm    = 0x01
-)
-
 func TestCompareDecoders(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -27,7 +17,7 @@ func TestCompareDecoders(t *testing.T) {
 			name: "valid location packet",
 			data: []byte{
 				StartByte1, StartByte2, // Start bytes
-				0x11,                   // Packet length
+				0x15,                   // Packet length
 				LocationMsg,            // Protocol number (location)
 				0x0F,                   // GPS status
 				0x12, 0x34, 0x56, 0x78, // Latitude
@@ -36,7 +26,7 @@ func TestCompareDecoders(t *testing.T) {
 				0x01, 0x44,             // Course
 				0x23, 0x02, 0x14,       // Date
 				0x12, 0x15, 0x13,       // Time
-				0x00, 0x12,             // Checksum
+				0xF1, 0x03,             // Checksum
 				EndByte1, EndByte2,     // End bytes
 			},
 			wantErr: false,
@@ -45,12 +35,12 @@ func TestCompareDecoders(t *testing.T) {
 			name: "valid status message",
 			data: []byte{
 				StartByte1, StartByte2, // Start bytes
-				0x0A,                   // Packet length
+				0x08,                   // Packet length
 				StatusMsg,              // Protocol number (status)
 				0x45,                   // Status (Power=4, GSM=5)
 				0x00, 0x01,             // Serial number
 				0x00, 0x01,             // Error check
-				0x00, 0x46,             // Checksum
+				0xB0, 0x72,             // Checksum
 				EndByte1, EndByte2,     // End bytes
 			},
 			wantErr: false,
@@ -59,7 +49,7 @@ func TestCompareDecoders(t *testing.T) {
 			name: "valid alarm message",
 			data: []byte{
 				StartByte1, StartByte2, // Start bytes
-				0x11,                   // Packet length
+				0x16,                   // Packet length
 				AlarmMsg,               // Protocol number (alarm)
 				0x0F,                   // GPS status
 				0x12, 0x34, 0x56, 0x78, // Latitude
@@ -69,11 +59,36 @@ func TestCompareDecoders(t *testing.T) {
 				0x23, 0x02, 0x14,       // Date
 				0x12, 0x15, 0x13,       // Time
 				SosAlarm,               // Alarm type
-				0x00, 0x13,             // Checksum
+				0xEF, 0x44,             // Checksum
 				EndByte1, EndByte2,     // End bytes
 			},
 			wantErr: false,
 		},
+		{
+			name:    "valid GPS/LBS message",
+			data:    gpsLBSPacket,
+			wantErr: false,
+		},
+		{
+			name:    "valid LBS multi-cell message",
+			data:    buildPacket(LBSMultiMsg, append(cellBlock(), 0x00, 0x01, 0x00, 0x2A)...),
+			wantErr: false,
+		},
+		{
+			name:    "valid WiFi message",
+			data:    buildPacket(WiFiMsg, append(cellBlock(), 0x01, 0xF0, 0x9F, 0xC2, 0x12, 0x34, 0x56, 0x41, 0x00, 0x2B)...),
+			wantErr: false,
+		},
+		{
+			name:    "valid command reply",
+			data:    buildPacket(ReplyMsg, 0x06, 0x00, 0x00, 0x00, 0x01, 'O', 'K', 0x00, 0x2C),
+			wantErr: false,
+		},
+		{
+			name:    "valid extended information packet",
+			data:    buildExtendedPacket(InfoMsg, InfoExternalVoltage, 0x04, 0xD8, 0x00, 0x2D),
+			wantErr: false,
+		},
 	}
 
 	v1Decoder := NewDecoder()
@@ -103,13 +118,13 @@ func TestCompareDecoders(t *testing.T) {
 					return
 				}
 
-				compareGT06Data(t, v1Result, v2Result)
+				compareDecoderResults(t, v1Result, v2Result)
 			}
 		})
 	}
 }
 
-func compareGT06Data(t *testing.T, v1, v2 *GT06Data) {
+func compareDecoderResults(t *testing.T, v1, v2 *GT06Data) {
 	if v1.Valid != v2.Valid {
 		t.Errorf("Valid mismatch: v1=%v, v2=%v", v1.Valid, v2.Valid)
 	}
@@ -131,6 +146,15 @@ func compareGT06Data(t *testing.T, v1, v2 *GT06Data) {
 	if !almostEqual(v1.Course, v2.Course, 0.1) {
 		t.Errorf("Course mismatch: v1=%v, v2=%v", v1.Course, v2.Course)
 	}
+	if v1.Reply != v2.Reply {
+		t.Errorf("Reply mismatch: v1=%q, v2=%q", v1.Reply, v2.Reply)
+	}
+	if v1.Serial != v2.Serial {
+		t.Errorf("Serial mismatch: v1=%d, v2=%d", v1.Serial, v2.Serial)
+	}
+	if !reflect.DeepEqual(v1.Network, v2.Network) {
+		t.Errorf("Network mismatch: v1=%+v, v2=%+v", v1.Network, v2.Network)
+	}
 
 	// Compare non-zero timestamps
 	if !v1.Timestamp.IsZero() && !v2.Timestamp.IsZero() {
@@ -166,42 +190,3 @@ func compareStatusMaps(t *testing.T, v1, v2 map[string]interface{}) {
 		}
 	}
 }
-
-func almostEqual(a, b, tolerance float64) bool {
-	diff := a - b
-	if diff < 0 {
-		diff = -diff
-	}
-	return diff < tolerance
-}
-
-type GT06Data struct {
-	Valid       bool
-	GPSValid    bool
-	Satellites  int
-	Latitude    float64
-	Longitude   float64
-	Speed       float64
-	Course      float64
-	PowerLevel  int
-	GSMSignal   int
-	Alarm       string
-	Timestamp   time.Time
-	Status      map[string]interface{}
-}
-
-func NewDecoder() *Decoder { return &Decoder{} }
-func NewDecoderV2() *DecoderV2 { return &DecoderV2{} }
-type Decoder struct{}
-type DecoderV2 struct{}
-
-func (d *Decoder) Decode(data []byte) (*GT06Data, error) {
-	//Implement your decode logic here
-	return &GT06Data{}, nil
-}
-func (d *DecoderV2) Decode(data []byte) (*GT06Data, error) {
-	//Implement your decode logic here
-	return &GT06Data{}, nil
-}
-func (d *Decoder) EnableDebug(debug bool) {}
-func (d *DecoderV2) EnableDebug(debug bool) {}
\ No newline at end of file
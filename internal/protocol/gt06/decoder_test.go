@@ -2,9 +2,17 @@ package gt06
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
 	"strings"
 	"testing"
+	"testing/quick"
 	"time"
+	"tracking/internal/core/model"
+	"tracking/internal/core/util"
 )
 
 func TestGT06Decoder(t *testing.T) {
@@ -18,7 +26,7 @@ func TestGT06Decoder(t *testing.T) {
 			name: "valid location packet",
 			data: []byte{
 				0x78, 0x78, // Start bytes
-				0x11,       // Packet length
+				0x15,       // Packet length
 				0x12,       // Protocol number (location)
 				0x0F,       // GPS status
 				0x12, 0x34, 0x56, 0x78, // Latitude
@@ -27,7 +35,7 @@ func TestGT06Decoder(t *testing.T) {
 				0x01, 0x44,       // Course
 				0x23, 0x02, 0x14, // Date
 				0x12, 0x15, 0x13, // Time
-				0x00, 0x12,       // Checksum
+				0xF1, 0x03,       // Checksum
 				0x0D, 0x0A,       // End bytes
 			},
 			want: &GT06Data{
@@ -47,12 +55,12 @@ func TestGT06Decoder(t *testing.T) {
 			name: "valid status message",
 			data: []byte{
 				0x78, 0x78, // Start bytes
-				0x0A,       // Packet length
+				0x08,       // Packet length
 				0x13,       // Protocol number (status)
 				0x45,       // Status (Power=4, GSM=5)
 				0x00, 0x01, // Serial number
 				0x00, 0x01, // Error check
-				0x00, 0x46, // Checksum
+				0xB0, 0x72, // Checksum
 				0x0D, 0x0A, // End bytes
 			},
 			want: &GT06Data{
@@ -72,7 +80,7 @@ func TestGT06Decoder(t *testing.T) {
 			name: "valid alarm message",
 			data: []byte{
 				0x78, 0x78, // Start bytes
-				0x11,       // Packet length
+				0x16,       // Packet length
 				0x16,       // Protocol number (alarm)
 				0x0F,       // GPS status
 				0x12, 0x34, 0x56, 0x78, // Latitude
@@ -82,7 +90,7 @@ func TestGT06Decoder(t *testing.T) {
 				0x23, 0x02, 0x14, // Date
 				0x12, 0x15, 0x13, // Time
 				0x01,             // Alarm type (SOS)
-				0x00, 0x13,       // Checksum
+				0xEF, 0x44,       // Checksum
 				0x0D, 0x0A,       // End bytes
 			},
 			want: &GT06Data{
@@ -128,7 +136,7 @@ func TestGT06Decoder(t *testing.T) {
 			name: "invalid checksum",
 			data: []byte{
 				0x78, 0x78, // Start bytes
-				0x11,       // Packet length
+				0x15,       // Packet length
 				0x12,       // Protocol number
 				0x0F,       // GPS status
 				0x12, 0x34, 0x56, 0x78, // Latitude
@@ -147,7 +155,7 @@ func TestGT06Decoder(t *testing.T) {
 			name: "malformed end bytes",
 			data: []byte{
 				0x78, 0x78, // Start bytes
-				0x11,       // Length
+				0x15,       // Length
 				0x12,       // Protocol (location)
 				0x0F,       // GPS status
 				0x12, 0x34, 0x56, 0x78, // Latitude
@@ -156,7 +164,7 @@ func TestGT06Decoder(t *testing.T) {
 				0x01, 0x44,       // Course
 				0x23, 0x02, 0x14, // Date
 				0x12, 0x15, 0x13, // Time
-				0x00, 0x12,       // Checksum
+				0xF1, 0x03,       // Checksum
 				0x0D, 0x0C,       // Invalid end bytes
 			},
 			want:    nil,
@@ -179,12 +187,12 @@ func TestGT06Decoder(t *testing.T) {
 			name: "status message with invalid power level",
 			data: []byte{
 				0x78, 0x78, // Start bytes
-				0x0A,       // Length
+				0x08,       // Length
 				0x13,       // Protocol (status)
 				0xF5,       // Invalid status (power=15, GSM=5)
 				0x00, 0x01, // Serial
 				0x00, 0x01, // Error check
-				0x00, 0xF6, // Checksum
+				0xEE, 0xF6, // Checksum
 				0x0D, 0x0A, // End bytes
 			},
 			want:    nil,
@@ -194,7 +202,7 @@ func TestGT06Decoder(t *testing.T) {
 			name: "alarm message with unknown type",
 			data: []byte{
 				0x78, 0x78, // Start bytes
-				0x11,       // Length
+				0x16,       // Length
 				0x16,       // Protocol (alarm)
 				0x0F,       // GPS status
 				0x12, 0x34, 0x56, 0x78, // Latitude
@@ -204,7 +212,7 @@ func TestGT06Decoder(t *testing.T) {
 				0x23, 0x02, 0x14, // Date
 				0x12, 0x15, 0x13, // Time
 				0xFF,             // Unknown alarm type
-				0x00, 0x1C,       // Checksum
+				0xF1, 0xB5,       // Checksum
 				0x0D, 0x0A,       // End bytes
 			},
 			want: &GT06Data{
@@ -281,6 +289,297 @@ func compareGT06Data(t *testing.T, got, want *GT06Data) {
 	}
 }
 
+var gpsLBSPacket = []byte{
+	0x78, 0x78, // Start bytes
+	0x1D,       // Packet length
+	0x22,       // Protocol number (GPS + LBS)
+	0x0F,       // GPS status
+	0x12, 0x34, 0x56, 0x78, // Latitude
+	0x09, 0x10, 0x20, 0x30, // Longitude
+	0x28,             // Speed
+	0x01, 0x44,       // Course
+	0x23, 0x02, 0x14, // Date
+	0x12, 0x15, 0x13, // Time
+	0x01, 0xCC,       // MCC (460)
+	0x00,             // MNC
+	0x27, 0x95,       // LAC
+	0x00, 0x0E, 0x6F, // Cell ID
+	0xF4, 0xC4,       // Checksum
+	0x0D, 0x0A,       // End bytes
+}
+
+func TestGPSLBSMessage(t *testing.T) {
+	decoder := NewDecoder()
+
+	got, err := decoder.Decode(gpsLBSPacket)
+	if err != nil {
+		t.Fatalf("Decode() unexpected error: %v", err)
+	}
+
+	compareGT06Data(t, got, &GT06Data{
+		Valid:      true,
+		GPSValid:   true,
+		Satellites: 3,
+		Latitude:   12.5761333,
+		Longitude:  91.0338333,
+		Speed:      40.0,
+		Course:     324.0,
+		Timestamp:  time.Date(2023, 2, 14, 12, 15, 13, 0, time.UTC),
+	})
+
+	wantStatus := map[string]int{"mcc": 460, "mnc": 0, "lac": 0x2795, "cellId": 0x0E6F}
+	for key, want := range wantStatus {
+		if got.Status[key] != want {
+			t.Errorf("Status[%s] = %v, want %d", key, got.Status[key], want)
+		}
+	}
+
+	// The LBS block is mandatory for 0x22
+	truncated := append([]byte{}, gpsLBSPacket[:26]...)
+	truncated = append(truncated, gpsLBSPacket[len(gpsLBSPacket)-4:]...)
+	truncated[2] = byte(len(truncated) - 5)
+	if _, err := decoder.Decode(truncated); err == nil {
+		t.Error("Decode() expected error for GPS/LBS packet without LBS block")
+	}
+}
+
+func TestHeartbeatResponse(t *testing.T) {
+	decoder := NewDecoder()
+
+	heartbeat := []byte{
+		0x78, 0x78, // Start bytes
+		0x08,       // Packet length
+		0x13,       // Protocol number (status/heartbeat)
+		0x45,       // Status (Power=4, GSM=5)
+		0x00, 0x01, // Reserved
+		0x12, 0x34, // Serial number
+		0x70, 0x7D, // Checksum
+		0x0D, 0x0A, // End bytes
+	}
+
+	got, err := decoder.Decode(heartbeat)
+	if err != nil {
+		t.Fatalf("Decode() unexpected error: %v", err)
+	}
+	if got.Serial != 0x1234 {
+		t.Errorf("Serial = 0x%04x, want 0x1234", got.Serial)
+	}
+
+	want := []byte{0x78, 0x78, 0x05, 0x13, 0x12, 0x34, 0x29, 0xFE, 0x0D, 0x0A}
+	if resp := decoder.GenerateHeartbeatResponse(got.Serial); !bytes.Equal(resp, want) {
+		t.Errorf("GenerateHeartbeatResponse() = % x, want % x", resp, want)
+	}
+}
+
+// buildPacket frames content with a valid length, checksum and end bytes
+func buildPacket(protocol byte, content ...byte) []byte {
+	packet := []byte{StartByte1, StartByte2, byte(len(content) + 3), protocol}
+	packet = append(packet, content...)
+	crc := CalculateChecksum(packet[2:])
+	return append(packet, byte(crc>>8), byte(crc), EndByte1, EndByte2)
+}
+
+// buildExtendedPacket frames content in a 0x7979 packet with a two byte length
+func buildExtendedPacket(protocol byte, content ...byte) []byte {
+	length := len(content) + 3
+	packet := []byte{ExtStartByte1, ExtStartByte2, byte(length >> 8), byte(length), protocol}
+	packet = append(packet, content...)
+	crc := CalculateChecksum(packet[2:])
+	return append(packet, byte(crc>>8), byte(crc), EndByte1, EndByte2)
+}
+
+func TestResponsesEchoSerial(t *testing.T) {
+	gps := []byte{
+		0x0F, 0x12, 0x34, 0x56, 0x78, 0x09, 0x10, 0x20, 0x30,
+		0x28, 0x01, 0x44, 0x23, 0x02, 0x14, 0x12, 0x15, 0x13,
+	}
+	imei := []byte{0x03, 0x53, 0x41, 0x35, 0x32, 0x88, 0x13, 0x72}
+	gpsLBS := append(append([]byte{}, gps...), 0x01, 0xCC, 0x00, 0x27, 0x95, 0x00, 0x0E, 0x6F)
+	wifi := append(cellBlock(), 0x01, 0xF0, 0x9F, 0xC2, 0x12, 0x34, 0x56, 0x41)
+
+	tests := []struct {
+		name     string
+		protocol byte
+		content  []byte
+		serial   uint16
+	}{
+		{"login", LoginMsg, append(append([]byte{}, imei...), 0x00, 0x07), 0x0007},
+		{"location", LocationMsg, append(append([]byte{}, gps...), 0x01, 0x02), 0x0102},
+		{"alarm", AlarmMsg, append(append([]byte{}, gps...), SosAlarm, 0xAB, 0xCD), 0xABCD},
+		{"heartbeat", StatusMsg, []byte{0x45, 0x00, 0x01, 0x12, 0x34}, 0x1234},
+		{"gps lbs", GPSLBSMsg, append(gpsLBS, 0x00, 0x22), 0x0022},
+		{"lbs multi", LBSMultiMsg, append(cellBlock(), 0x00, 0x01, 0x00, 0x28), 0x0028},
+		{"wifi", WiFiMsg, append(wifi, 0x00, 0x2C), 0x002C},
+		{"location without serial", LocationMsg, gps, 0},
+	}
+
+	decoder := NewDecoder()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decoder.Decode(buildPacket(tt.protocol, tt.content...))
+			if err != nil {
+				t.Fatalf("Decode() unexpected error: %v", err)
+			}
+			if got.Serial != tt.serial {
+				t.Errorf("Serial = 0x%04x, want 0x%04x", got.Serial, tt.serial)
+			}
+			if tt.protocol == AlarmMsg && got.Alarm != "sos" {
+				t.Errorf("Alarm = %q, want sos", got.Alarm)
+			}
+
+			// Every response, the login one included, is the standard five
+			// byte acknowledgement: protocol, serial and checksum
+			resp := decoder.GenerateResponse(tt.protocol, got.Serial)
+			frames, rest, err := SplitFrames(resp)
+			if err != nil || len(frames) != 1 || len(rest) != 0 {
+				t.Fatalf("SplitFrames() = %d frames, rest % x, error %v (% x)", len(frames), rest, err, resp)
+			}
+			if len(resp) != 10 || resp[2] != 0x05 {
+				t.Fatalf("Response length byte = 0x%02x in %d bytes, want 0x05 in 10 (% x)", resp[2], len(resp), resp)
+			}
+			if crc := CalculateChecksum(resp[2:6]); uint16(resp[6])<<8|uint16(resp[7]) != crc {
+				t.Errorf("Response checksum = 0x%02x%02x, want 0x%04x (% x)", resp[6], resp[7], crc, resp)
+			}
+			serialPos := len(resp) - 6
+			if echoed := uint16(resp[serialPos])<<8 | uint16(resp[serialPos+1]); echoed != tt.serial {
+				t.Errorf("Response serial = 0x%04x, want 0x%04x (% x)", echoed, tt.serial, resp)
+			}
+			if resp[3] != tt.protocol {
+				t.Errorf("Response protocol = 0x%02x, want 0x%02x", resp[3], tt.protocol)
+			}
+		})
+	}
+}
+
+// cellBlock builds the datetime, MCC/MNC and seven-cell block shared by
+// 0x28 and 0x2C packets, with a serving cell and one neighbour
+func cellBlock() []byte {
+	block := []byte{
+		0x23, 0x02, 0x14, 0x12, 0x15, 0x13, // 2023-02-14 12:15:13
+		0x01, 0xCC, // MCC 460
+		0x00,                               // MNC 0
+		0x27, 0x95, 0x00, 0x0E, 0x6F, 0x3C, // Serving cell: LAC 0x2795, CI 0x0E6F, -60 dBm
+		0x27, 0x95, 0x00, 0x0E, 0x70, 0x46, // Neighbour: CI 0x0E70, -70 dBm
+	}
+	block = append(block, make([]byte, 5*6)...) // Empty neighbour slots
+	return append(block, 0xFF)                  // Timing advance
+}
+
+func TestNetworkMessages(t *testing.T) {
+	wantCells := []model.CellTower{
+		{MobileCountryCode: 460, MobileNetworkCode: 0, LocationAreaCode: 0x2795, CellID: 0x0E6F, SignalStrength: -60},
+		{MobileCountryCode: 460, MobileNetworkCode: 0, LocationAreaCode: 0x2795, CellID: 0x0E70, SignalStrength: -70},
+	}
+
+	lbs := append(cellBlock(), 0x00, 0x01) // Language
+	lbs = append(lbs, 0x00, 0x2A)          // Serial number
+
+	wifi := append(cellBlock(), 0x02) // Two access points
+	wifi = append(wifi, 0xF0, 0x9F, 0xC2, 0x12, 0x34, 0x56, 0x41)
+	wifi = append(wifi, 0xF0, 0x9F, 0xC2, 0xAB, 0xCD, 0xEF, 0x50)
+	wifi = append(wifi, 0x00, 0x2B) // Serial number
+
+	tests := []struct {
+		name      string
+		protocol  byte
+		content   []byte
+		serial    uint16
+		wantWifis []model.WifiAccessPoint
+	}{
+		{name: "lbs multi", protocol: LBSMultiMsg, content: lbs, serial: 0x2A},
+		{
+			name:     "wifi",
+			protocol: WiFiMsg,
+			content:  wifi,
+			serial:   0x2B,
+			wantWifis: []model.WifiAccessPoint{
+				{MacAddress: "f0:9f:c2:12:34:56", SignalStrength: -65},
+				{MacAddress: "f0:9f:c2:ab:cd:ef", SignalStrength: -80},
+			},
+		},
+	}
+
+	decoder := NewDecoder()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decoder.Decode(buildPacket(tt.protocol, tt.content...))
+			if err != nil {
+				t.Fatalf("Decode() unexpected error: %v", err)
+			}
+			if got.GPSValid {
+				t.Error("GPSValid = true for a packet without a GPS fix")
+			}
+			if got.Serial != tt.serial {
+				t.Errorf("Serial = 0x%04x, want 0x%04x", got.Serial, tt.serial)
+			}
+			if want := time.Date(2023, 2, 14, 12, 15, 13, 0, time.UTC); !got.Timestamp.Equal(want) {
+				t.Errorf("Timestamp = %v, want %v", got.Timestamp, want)
+			}
+			if got.Network == nil {
+				t.Fatal("Network = nil")
+			}
+			if !reflect.DeepEqual(got.Network.CellTowers, wantCells) {
+				t.Errorf("CellTowers = %+v, want %+v", got.Network.CellTowers, wantCells)
+			}
+			if !reflect.DeepEqual(got.Network.WifiAccessPoints, tt.wantWifis) {
+				t.Errorf("WifiAccessPoints = %+v, want %+v", got.Network.WifiAccessPoints, tt.wantWifis)
+			}
+
+			position := decoder.ToPosition("device-1", got)
+			if position.Network != got.Network || position.Valid {
+				t.Errorf("ToPosition() network = %v, valid = %v", position.Network, position.Valid)
+			}
+		})
+	}
+
+	// An access point count larger than the packet is rejected
+	truncated := append(cellBlock(), 0x03)
+	truncated = append(truncated, 0xF0, 0x9F, 0xC2, 0x12, 0x34, 0x56, 0x41)
+	if _, err := decoder.Decode(buildPacket(WiFiMsg, truncated...)); err == nil {
+		t.Error("Decode() expected error for truncated WiFi list")
+	}
+}
+
+func TestCalculateChecksum(t *testing.T) {
+	// Login packet from the GT06 protocol manual
+	login := []byte{0x0D, 0x01, 0x01, 0x23, 0x45, 0x67, 0x89, 0x01, 0x23, 0x45, 0x00, 0x01}
+	if got := CalculateChecksum(login); got != 0x8CDD {
+		t.Errorf("CalculateChecksum() = 0x%04x, want 0x8cdd", got)
+	}
+	if got := ChecksumXOR.Calculate(login); got != CalculateXORChecksum(login) {
+		t.Errorf("ChecksumXOR.Calculate() = 0x%04x, want 0x%04x", got, CalculateXORChecksum(login))
+	}
+}
+
+func TestXORChecksumMode(t *testing.T) {
+	// Status packet from a clone that sums with XOR instead of CRC-ITU
+	clonePacket := []byte{
+		0x78, 0x78, // Start bytes
+		0x08,       // Packet length
+		0x13,       // Protocol number (status)
+		0x45,       // Status (Power=4, GSM=5)
+		0x00, 0x01, // Reserved
+		0x00, 0x01, // Serial number
+		0x00, 0x5E, // XOR checksum
+		0x0D, 0x0A, // End bytes
+	}
+
+	decoder := NewDecoder()
+	if _, err := decoder.Decode(clonePacket); err == nil || !strings.Contains(err.Error(), ErrInvalidChecksum.Error()) {
+		t.Errorf("Decode() in CRC-ITU mode error = %v, want %v", err, ErrInvalidChecksum)
+	}
+
+	decoder.SetChecksumMode(ChecksumXOR)
+	if _, err := decoder.Decode(clonePacket); err != nil {
+		t.Errorf("Decode() in XOR mode unexpected error: %v", err)
+	}
+
+	want := []byte{0x78, 0x78, 0x05, 0x13, 0x00, 0x01, 0x00, 0x17, 0x0D, 0x0A}
+	if resp := decoder.GenerateHeartbeatResponse(1); !bytes.Equal(resp, want) {
+		t.Errorf("GenerateHeartbeatResponse() = % x, want % x", resp, want)
+	}
+}
+
 func TestBCDToFloat(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -291,9 +590,21 @@ func TestBCDToFloat(t *testing.T) {
 		{
 			name:    "valid coordinate",
 			bcd:     0x12345678, // 12°34.5678'
-			want:    12.5761333,
+			want:    12.57613,
 			wantErr: false,
 		},
+		{
+			name:    "last byte of fractional minutes",
+			bcd:     0x12345679, // 12°34.5679'
+			want:    12.5761317,
+			wantErr: false,
+		},
+		{
+			name:    "invalid BCD digit in last byte",
+			bcd:     0x1234567A,
+			want:    0,
+			wantErr: true,
+		},
 		{
 			name:    "invalid BCD digit",
 			bcd:     0xA2345678, // First digit is A (invalid BCD)
@@ -315,19 +626,31 @@ func TestBCDToFloat(t *testing.T) {
 		{
 			name:    "valid coordinate near limit",
 			bcd:     0x89595959, // 89°59.5959'
-			want:    89.9932639,
+			want:    89.9932650,
+			wantErr: false,
+		},
+		{
+			name:    "pole",
+			bcd:     0x90000000, // 90°00.0000'
+			want:    90,
 			wantErr: false,
 		},
+		{
+			name:    "past the pole",
+			bcd:     0x90000001, // 90°00.0001'
+			want:    0,
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := bcdToFloat(tt.bcd)
+			got, err := BcdToFloat(tt.bcd)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("bcdToFloat() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-			if !tt.wantErr && !almostEqual(got, tt.want, 0.0001) {
+			if !tt.wantErr && !almostEqual(got, tt.want, 1e-9) {
 				t.Errorf("bcdToFloat() = %v, want %v", got, tt.want)
 			}
 		})
@@ -370,11 +693,9 @@ func TestParseTimestamp(t *testing.T) {
 		},
 	}
 
-	decoder := NewDecoder()
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			reader := bytes.NewReader(tt.data)
-			got, err := decoder.parseTimestamp(reader)
+			got, err := ParseTimestamp(tt.data)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("parseTimestamp() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -384,4 +705,548 @@ func TestParseTimestamp(t *testing.T) {
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+
+func TestEncodeCommand(t *testing.T) {
+	tests := []struct {
+		command Command
+		text    string
+	}{
+		{CommandEngineStop, "RELAY,1#"},
+		{CommandEngineResume, "RELAY,0#"},
+		{CommandLocate, "WHERE#"},
+		{CommandReboot, "RESET#"},
+	}
+
+	for _, mode := range []ChecksumMode{ChecksumCRCITU, ChecksumXOR} {
+		decoder := NewDecoder()
+		decoder.SetChecksumMode(mode)
+
+		for _, tt := range tests {
+			t.Run(string(tt.command), func(t *testing.T) {
+				packet, err := decoder.EncodeCommand(tt.command, 0x01020304, 0x0A0B)
+				if err != nil {
+					t.Fatalf("EncodeCommand() unexpected error: %v", err)
+				}
+
+				if packet[0] != StartByte1 || packet[1] != StartByte2 || packet[3] != CommandMsg {
+					t.Fatalf("Invalid header: % x", packet)
+				}
+				if int(packet[2]) != len(packet)-5 {
+					t.Errorf("Length = %d, want %d", packet[2], len(packet)-5)
+				}
+				if int(packet[4]) != len(tt.text)+4 {
+					t.Errorf("Command length = %d, want %d", packet[4], len(tt.text)+4)
+				}
+				if !bytes.Equal(packet[5:9], []byte{0x01, 0x02, 0x03, 0x04}) {
+					t.Errorf("Server flag = % x", packet[5:9])
+				}
+				if got := string(packet[9 : 9+len(tt.text)]); got != tt.text {
+					t.Errorf("Command text = %q, want %q", got, tt.text)
+				}
+
+				checksumPos := len(packet) - 4
+				if serial := uint16(packet[checksumPos-2])<<8 | uint16(packet[checksumPos-1]); serial != 0x0A0B {
+					t.Errorf("Serial = 0x%04x, want 0x0a0b", serial)
+				}
+				want := mode.Calculate(packet[2:checksumPos])
+				if got := uint16(packet[checksumPos])<<8 | uint16(packet[checksumPos+1]); got != want {
+					t.Errorf("Checksum = 0x%04x, want 0x%04x", got, want)
+				}
+				if packet[len(packet)-2] != EndByte1 || packet[len(packet)-1] != EndByte2 {
+					t.Errorf("Invalid end bytes: % x", packet[len(packet)-2:])
+				}
+			})
+		}
+	}
+
+	decoder := NewDecoder()
+	if _, err := decoder.EncodeCommand("selfDestruct", 0, 0); !errors.Is(err, ErrUnsupportedCommand) {
+		t.Errorf("EncodeCommand(selfDestruct) error = %v, want ErrUnsupportedCommand", err)
+	}
+	if _, err := decoder.EncodeTextCommand(strings.Repeat("A", 246), 0, 0); !errors.Is(err, ErrUnsupportedCommand) {
+		t.Errorf("EncodeTextCommand(246 bytes) error = %v, want ErrUnsupportedCommand", err)
+	}
+}
+
+func TestEncodeReportSettings(t *testing.T) {
+	decoder := NewDecoder()
+	text := func(packet []byte) string {
+		return string(packet[9 : len(packet)-6])
+	}
+
+	packet, err := decoder.EncodeIntervalCommand(5*time.Minute, 1, 1)
+	if err != nil || text(packet) != "TIMER,300,300#" {
+		t.Errorf("EncodeIntervalCommand(5m) = %q, %v", packet, err)
+	}
+	for _, interval := range []time.Duration{time.Second, 12500 * time.Millisecond, 6 * time.Hour} {
+		if _, err := decoder.EncodeIntervalCommand(interval, 1, 1); !errors.Is(err, ErrUnsupportedCommand) {
+			t.Errorf("EncodeIntervalCommand(%v) error = %v, want ErrUnsupportedCommand", interval, err)
+		}
+	}
+
+	for angle, want := range map[int]string{30: "ANGLEREP,ON,30,3#", 0: "ANGLEREP,OFF#"} {
+		packet, err := decoder.EncodeCornerCommand(angle, 1, 1)
+		if err != nil || text(packet) != want {
+			t.Errorf("EncodeCornerCommand(%d) = %q, %v, want %s", angle, packet, err, want)
+		}
+	}
+	for _, angle := range []int{-30, 2, 200} {
+		if _, err := decoder.EncodeCornerCommand(angle, 1, 1); !errors.Is(err, ErrUnsupportedCommand) {
+			t.Errorf("EncodeCornerCommand(%d) error = %v, want ErrUnsupportedCommand", angle, err)
+		}
+	}
+}
+
+func TestDecodeReply(t *testing.T) {
+	reply := func(text string, trailer ...byte) []byte {
+		content := []byte{byte(len(text) + 4), 0x00, 0x00, 0x00, 0x01}
+		content = append(content, text...)
+		return buildPacket(ReplyMsg, append(content, trailer...)...)
+	}
+
+	tests := []struct {
+		name    string
+		data    []byte
+		reply   string
+		serial  uint16
+		wantErr error
+	}{
+		{"with serial", reply("Cut off the fuel supply: Success!", 0x00, 0x05), "Cut off the fuel supply: Success!", 0x0005, nil},
+		{"with language and serial", reply("OK", 0x00, 0x02, 0x12, 0x34), "OK", 0x1234, nil},
+		{"without serial", reply("OK"), "OK", 0, nil},
+		{"command length overruns content", buildPacket(ReplyMsg, 0x20, 0x00, 0x00, 0x00, 0x01), "", 0, ErrMalformedPacket},
+	}
+
+	decoder := NewDecoder()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decoder.Decode(tt.data)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Decode() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Decode() unexpected error: %v", err)
+			}
+			if got.Reply != tt.reply {
+				t.Errorf("Reply = %q, want %q", got.Reply, tt.reply)
+			}
+			if got.Serial != tt.serial {
+				t.Errorf("Serial = 0x%04x, want 0x%04x", got.Serial, tt.serial)
+			}
+		})
+	}
+}
+
+func TestInformationMessages(t *testing.T) {
+	identity := []byte{
+		InfoIdentity,
+		0x03, 0x53, 0x41, 0x35, 0x32, 0x88, 0x13, 0x72, // IMEI
+		0x04, 0x60, 0x01, 0x12, 0x34, 0x56, 0x78, 0x90, // IMSI
+		0x89, 0x86, 0x01, 0x12, 0x34, 0x56, 0x78, 0x90, 0x12, 0x3F, // ICCID
+		0x00, 0x09,
+	}
+	modules := []byte{
+		0x00, ModuleIMSI, 0x00, 0x08, 0x04, 0x60, 0x01, 0x12, 0x34, 0x56, 0x78, 0x90,
+		0x00, ModuleICCID, 0x00, 0x0A, 0x89, 0x86, 0x01, 0x12, 0x34, 0x56, 0x78, 0x90, 0x12, 0x3F,
+		0x00, ModuleChipID, 0x00, 0x02, 0xAB, 0xCD,
+		0x00, 0x0B,
+	}
+
+	tests := []struct {
+		name     string
+		data     []byte
+		protocol byte
+		status   map[string]interface{}
+		serial   uint16
+	}{
+		{
+			name:     "external voltage",
+			data:     buildExtendedPacket(InfoMsg, InfoExternalVoltage, 0x04, 0xD8, 0x00, 0x05),
+			protocol: InfoMsg,
+			status:   map[string]interface{}{"externalVoltage": 12.4},
+			serial:   0x0005,
+		},
+		{
+			name:     "self-check in a standard frame",
+			data:     buildPacket(InfoMsg, append(append([]byte{InfoSelfCheck}, "GPS:OK;GSM:OK"...), 0x00, 0x06)...),
+			protocol: InfoMsg,
+			status:   map[string]interface{}{"selfCheck": "GPS:OK;GSM:OK"},
+			serial:   0x0006,
+		},
+		{
+			name:     "door status",
+			data:     buildExtendedPacket(InfoMsg, InfoDoorStatus, 0x01, 0x00, 0x07),
+			protocol: InfoMsg,
+			status:   map[string]interface{}{"door": true},
+			serial:   0x0007,
+		},
+		{
+			name:     "identity",
+			data:     buildExtendedPacket(InfoMsg, identity...),
+			protocol: InfoMsg,
+			status:   map[string]interface{}{"imsi": "460011234567890", "iccid": "8986011234567890123"},
+			serial:   0x0009,
+		},
+		{
+			name:     "fuel sensor",
+			data:     buildExtendedPacket(InfoMsg, append(append([]byte{InfoFuel}, "!AIOAU,01,01,23,56.5"...), 0x00, 0x08)...),
+			protocol: InfoMsg,
+			status:   map[string]interface{}{"fuelTemperature": 23.0, "fuelLevel": 56.5},
+			serial:   0x0008,
+		},
+		{
+			name:     "unknown information type",
+			data:     buildExtendedPacket(InfoMsg, 0x7E, 0x01, 0x00, 0x0A),
+			protocol: InfoMsg,
+			status:   map[string]interface{}{"infoType": 0x7E},
+			serial:   0x000A,
+		},
+		{
+			name:     "module list",
+			data:     buildExtendedPacket(ModuleMsg, modules...),
+			protocol: ModuleMsg,
+			status:   map[string]interface{}{"imsi": "460011234567890", "iccid": "8986011234567890123", "chipId": "abcd"},
+			serial:   0x000B,
+		},
+	}
+
+	decoders := map[string]interface {
+		Decode([]byte) (*GT06Data, error)
+	}{"v1": NewDecoder(), "v2": NewDecoderV2()}
+	for version, decoder := range decoders {
+		for _, tt := range tests {
+			t.Run(version+"/"+tt.name, func(t *testing.T) {
+				got, err := decoder.Decode(tt.data)
+				if err != nil {
+					t.Fatalf("Decode() unexpected error: %v", err)
+				}
+				if got.Protocol != tt.protocol {
+					t.Errorf("Protocol = 0x%02x, want 0x%02x", got.Protocol, tt.protocol)
+				}
+				if got.Serial != tt.serial {
+					t.Errorf("Serial = 0x%04x, want 0x%04x", got.Serial, tt.serial)
+				}
+				if !reflect.DeepEqual(got.Status, tt.status) {
+					t.Errorf("Status = %v, want %v", got.Status, tt.status)
+				}
+			})
+		}
+	}
+
+	t.Run("truncated module", func(t *testing.T) {
+		truncated := buildExtendedPacket(ModuleMsg, 0x00, ModuleICCID, 0x00, 0x0A, 0x89, 0x86, 0x00, 0x0C)
+		if _, err := NewDecoder().Decode(truncated); !errors.Is(err, ErrMalformedPacket) {
+			t.Errorf("Decode() error = %v, want %v", err, ErrMalformedPacket)
+		}
+	})
+
+	t.Run("extended length mismatch", func(t *testing.T) {
+		packet := buildExtendedPacket(InfoMsg, InfoExternalVoltage, 0x04, 0xD8, 0x00, 0x05)
+		packet[3]++
+		if _, err := NewDecoder().Decode(packet); !errors.Is(err, ErrInvalidLength) {
+			t.Errorf("Decode() error = %v, want %v", err, ErrInvalidLength)
+		}
+	})
+
+	t.Run("responses", func(t *testing.T) {
+		decoder := NewDecoder()
+		if resp := decoder.GenerateResponse(InfoMsg, 0x0005); resp != nil {
+			t.Errorf("info response = % x, want none", resp)
+		}
+		resp := decoder.GenerateResponse(ModuleMsg, 0x000B)
+		if len(resp) != 10 || resp[3] != ModuleMsg || resp[4] != 0x00 || resp[5] != 0x0B {
+			t.Errorf("module response = % x, want an ack echoing serial 0x000b", resp)
+		}
+	})
+}
+
+func TestJimi4GPackets(t *testing.T) {
+	gps := []byte{
+		0x0F, 0x12, 0x34, 0x56, 0x78, 0x09, 0x10, 0x20, 0x30,
+		0x28, 0x01, 0x44, 0x23, 0x02, 0x14, 0x12, 0x15, 0x13,
+	}
+	cell := []byte{
+		0x01, 0xCC, // MCC 460
+		0x00,                   // MNC
+		0x00, 0x00, 0x27, 0x95, // LAC
+		0x00, 0x00, 0x00, 0x00, 0x0E, 0x36, 0xA1, 0xB2, // Cell ID
+	}
+	cellTwoByteMNC := []byte{
+		0x81, 0xCC, // MCC 460, two byte MNC
+		0x01, 0x04, // MNC 260
+		0x00, 0x00, 0x27, 0x95,
+		0x00, 0x00, 0x00, 0x00, 0x0E, 0x36, 0xA1, 0xB2,
+	}
+	join := func(parts ...[]byte) []byte {
+		var out []byte
+		for _, part := range parts {
+			out = append(out, part...)
+		}
+		return out
+	}
+
+	tests := []struct {
+		name     string
+		data     []byte
+		protocol byte
+		status   map[string]interface{}
+		serial   uint16
+	}{
+		{
+			name:     "4G location with mileage",
+			data:     buildPacket(GPS4GMsg, join(gps, cell, []byte{0x01, 0x00, 0x01, 0x00, 0x00, 0x27, 0x10, 0x00, 0x12})...),
+			protocol: GPS4GMsg,
+			status: map[string]interface{}{
+				"mcc": 460, "mnc": 0, "lac": 0x2795, "cellId": 0x0E36A1B2,
+				"ignition": true, "uploadMode": 0, "buffered": true, "odometer": 10000,
+			},
+			serial: 0x0012,
+		},
+		{
+			name:     "4G location in an extended frame",
+			data:     buildExtendedPacket(GPS4GMsg, join(gps, cellTwoByteMNC, []byte{0x00, 0x02, 0x00, 0x00, 0x14})...),
+			protocol: GPS4GMsg,
+			status: map[string]interface{}{
+				"mcc": 460, "mnc": 260, "lac": 0x2795, "cellId": 0x0E36A1B2,
+				"ignition": false, "uploadMode": 2,
+			},
+			serial: 0x0014,
+		},
+		{
+			name:     "4G alarm",
+			data:     buildPacket(Alarm4GMsg, join(gps, []byte{0x10}, cell, []byte{0x06, 0x04, 0x03, SosAlarm, 0x02, 0x00, 0x13})...),
+			protocol: Alarm4GMsg,
+			status: map[string]interface{}{
+				"mcc": 460, "mnc": 0, "lac": 0x2795, "cellId": 0x0E36A1B2,
+				"ignition": true, "charging": true, "alarm": "sos",
+			},
+			serial: 0x0013,
+		},
+		{
+			name:     "4G alarm without a cell",
+			data:     buildPacket(Alarm4GMsg, join(gps, []byte{0x00, 0x00, 0x04, 0x03, OverspeedAlarm, 0x02, 0x00, 0x15})...),
+			protocol: Alarm4GMsg,
+			status:   map[string]interface{}{"ignition": false, "charging": false, "alarm": "overspeed"},
+			serial:   0x0015,
+		},
+		{
+			name:     "undecoded OBD packet",
+			data:     buildExtendedPacket(0x8C, append(bytes.Repeat([]byte("0C=1A2B,"), 40), 0x00, 0x16)...),
+			protocol: 0x8C,
+			status:   map[string]interface{}{},
+		},
+	}
+
+	decoders := map[string]interface {
+		Decode([]byte) (*GT06Data, error)
+	}{"v1": NewDecoder(), "v2": NewDecoderV2()}
+	for version, decoder := range decoders {
+		for _, tt := range tests {
+			t.Run(version+"/"+tt.name, func(t *testing.T) {
+				got, err := decoder.Decode(tt.data)
+				if err != nil {
+					t.Fatalf("Decode() unexpected error: %v", err)
+				}
+				if got.Protocol != tt.protocol || got.Serial != tt.serial {
+					t.Errorf("Protocol = 0x%02x, serial = 0x%04x, want 0x%02x, 0x%04x", got.Protocol, got.Serial, tt.protocol, tt.serial)
+				}
+				if got.Opaque != (tt.protocol == 0x8C) {
+					t.Errorf("Opaque = %v", got.Opaque)
+				}
+				if !reflect.DeepEqual(got.Status, tt.status) {
+					t.Errorf("Status = %v, want %v", got.Status, tt.status)
+				}
+			})
+		}
+	}
+
+	t.Run("alarm fields", func(t *testing.T) {
+		got, err := NewDecoder().Decode(tests[2].data)
+		if err != nil {
+			t.Fatalf("Decode() unexpected error: %v", err)
+		}
+		if got.PowerLevel != 4 || got.GSMSignal != 3 || got.Alarm != "sos" || !got.GPSValid {
+			t.Errorf("Alarm = %+v", got)
+		}
+	})
+
+	t.Run("undecoded types need an extended frame", func(t *testing.T) {
+		if _, err := NewDecoder().Decode(buildPacket(0x8C, 0x00, 0x16)); !errors.Is(err, ErrInvalidMessageType) {
+			t.Errorf("Decode() error = %v, want %v", err, ErrInvalidMessageType)
+		}
+	})
+
+	t.Run("truncated 4G cell", func(t *testing.T) {
+		packet := buildPacket(GPS4GMsg, join(gps, cellTwoByteMNC[:15], []byte{0x00, 0x00, 0x00})...)
+		if _, err := NewDecoder().Decode(packet); !errors.Is(err, ErrMalformedPacket) {
+			t.Errorf("Decode() error = %v, want %v", err, ErrMalformedPacket)
+		}
+	})
+
+	t.Run("responses", func(t *testing.T) {
+		decoder := NewDecoder()
+		for _, protocol := range []byte{GPS4GMsg, Alarm4GMsg} {
+			resp := decoder.GenerateResponse(protocol, 0x0013)
+			if len(resp) != 10 || resp[3] != protocol || resp[4] != 0x00 || resp[5] != 0x13 {
+				t.Errorf("0x%02x response = % x, want an ack echoing serial 0x0013", protocol, resp)
+			}
+		}
+	})
+}
+
+func TestDeviceIDAndFrameSize(t *testing.T) {
+	imei := []byte{0x03, 0x53, 0x41, 0x35, 0x32, 0x88, 0x13, 0x72}
+	for name, packet := range map[string][]byte{
+		"standard": buildPacket(LoginMsg, append(append([]byte{}, imei...), 0x00, 0x01)...),
+		"extended": buildExtendedPacket(LoginMsg, append(append([]byte{}, imei...), 0x00, 0x01)...),
+	} {
+		id, err := DeviceID(packet)
+		if err != nil || id != "0353413532881372" {
+			t.Errorf("%s: DeviceID() = %q, %v", name, id, err)
+		}
+		size, err := FrameSize(packet[:8])
+		if err != nil || size != len(packet) {
+			t.Errorf("%s: FrameSize() = %d, %v, want %d", name, size, err, len(packet))
+		}
+	}
+
+	if _, err := DeviceID([]byte{0x79, 0x79, 0x00, 0x0D, 0x01, 0x03, 0x53}); !errors.Is(err, ErrPacketTooShort) {
+		t.Errorf("DeviceID() error = %v, want %v", err, ErrPacketTooShort)
+	}
+	if _, err := FrameSize([]byte("##,imei:1")); !errors.Is(err, ErrInvalidHeader) {
+		t.Errorf("FrameSize() error = %v, want %v", err, ErrInvalidHeader)
+	}
+}
+
+func TestSplitFrames(t *testing.T) {
+	login := buildPacket(LoginMsg, 0x03, 0x53, 0x41, 0x35, 0x32, 0x88, 0x13, 0x72, 0x00, 0x01)
+	heartbeat := buildPacket(StatusMsg, 0x45, 0x00, 0x01, 0x12, 0x34)
+	info := buildExtendedPacket(InfoMsg, 0x00, 0x04, 0xD8, 0x00, 0x05)
+	data := append(append(append(append([]byte{}, login...), info...), heartbeat...), heartbeat[:5]...)
+
+	frames, rest, err := SplitFrames(data)
+	if err != nil {
+		t.Fatalf("SplitFrames() unexpected error: %v", err)
+	}
+	if len(frames) != 3 || !bytes.Equal(frames[0], login) || !bytes.Equal(frames[1], info) || !bytes.Equal(frames[2], heartbeat) {
+		t.Errorf("SplitFrames() frames = % x", frames)
+	}
+	if !bytes.Equal(rest, heartbeat[:5]) {
+		t.Errorf("SplitFrames() rest = % x, want the cut off frame", rest)
+	}
+
+	frames, _, err = SplitFrames(append(append([]byte{}, heartbeat...), "\r\nGARBAGE"...))
+	if len(frames) != 1 || !errors.Is(err, ErrInvalidHeader) {
+		t.Errorf("SplitFrames() with trailing garbage = %d frames, %v", len(frames), err)
+	}
+}
+
+func TestTerminalStatus(t *testing.T) {
+	tests := []struct {
+		name   string
+		info   byte
+		status map[string]interface{}
+	}{
+		{
+			name: "ACC on while charging",
+			info: TerminalACC | TerminalCharging | TerminalGPSTracking,
+			status: map[string]interface{}{
+				"powerLevel": 4, "gsmSignal": 3, "ignition": true, "armed": false,
+				"charging": true, "gpsTracking": true, "fuelCut": false,
+			},
+		},
+		{
+			name: "armed with fuel cut and SOS",
+			info: TerminalArmed | TerminalFuelCut | 4<<3,
+			status: map[string]interface{}{
+				"powerLevel": 4, "gsmSignal": 3, "ignition": false, "armed": true,
+				"charging": false, "gpsTracking": false, "fuelCut": true, "alarm": "sos",
+			},
+		},
+	}
+
+	decoders := map[string]interface {
+		Decode([]byte) (*GT06Data, error)
+	}{"v1": NewDecoder(), "v2": NewDecoderV2()}
+	for version, decoder := range decoders {
+		for _, tt := range tests {
+			t.Run(version+"/"+tt.name, func(t *testing.T) {
+				got, err := decoder.Decode(buildPacket(StatusMsg, tt.info, 0x04, 0x03, 0x00, 0x02, 0x00, 0x21))
+				if err != nil {
+					t.Fatalf("Decode() unexpected error: %v", err)
+				}
+				if got.Serial != 0x0021 || got.PowerLevel != 4 || got.GSMSignal != 3 {
+					t.Errorf("Decode() = %+v", got)
+				}
+				if !reflect.DeepEqual(got.Status, tt.status) {
+					t.Errorf("Status = %v, want %v", got.Status, tt.status)
+				}
+			})
+		}
+	}
+
+	if _, err := NewDecoder().Decode(buildPacket(StatusMsg, TerminalACC, 0x09, 0x03, 0x00, 0x02, 0x00, 0x21)); !errors.Is(err, ErrMalformedPacket) {
+		t.Errorf("Decode() error = %v, want %v for voltage level 9", err, ErrMalformedPacket)
+	}
+}
+
+func BenchmarkDecode(b *testing.B) {
+	decoder := NewDecoder()
+	b.SetBytes(int64(len(gpsLBSPacket)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := decoder.Decode(gpsLBSPacket); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// decimals counts the decimal places a coordinate prints with
+func decimals(value float64) int {
+	_, fraction, _ := strings.Cut(strconv.FormatFloat(value, 'f', -1, 64), ".")
+	return len(fraction)
+}
+
+// TestBcdRoundTrip encodes random coordinates in the device's BCD layout and
+// checks that decoding keeps every minute digit and no float artifacts, by
+// encoding the result again
+func TestBcdRoundTrip(t *testing.T) {
+	encode := func(degrees, minutes, width int) uint32 {
+		digits := fmt.Sprintf("%0*d", 8, degrees*int(math.Pow10(width))+minutes)
+		var bcd uint32
+		for _, digit := range digits {
+			bcd = bcd<<4 | uint32(digit-'0')
+		}
+		return bcd
+	}
+	layouts := []struct {
+		name   string
+		decode func(uint32) (float64, error)
+		max    int // Degrees
+		width  int // Digits of minutes, counted in units of the last
+	}{
+		{"latitude", BcdToFloat, 89, 6},
+		{"longitude", BcdToLongitude, 179, 5},
+	}
+	for _, layout := range layouts {
+		units := 60 * int(math.Pow10(layout.width-2)) // Per degree
+		property := func(d, m uint32) bool {
+			degrees, minutes := int(d)%(layout.max+1), int(m)%units
+			value, err := layout.decode(encode(degrees, minutes, layout.width))
+			if err != nil {
+				t.Logf("%d° %d units: %v", degrees, minutes, err)
+				return false
+			}
+			whole := int(value)
+			again := int(math.Round((value - float64(whole)) * float64(units)))
+			return whole == degrees && again == minutes && decimals(value) <= util.CoordinatePrecision
+		}
+		if err := quick.Check(property, &quick.Config{MaxCount: 5000}); err != nil {
+			t.Errorf("%s: %v", layout.name, err)
+		}
+	}
+}
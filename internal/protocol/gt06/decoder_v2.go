@@ -2,26 +2,30 @@
 package gt06
 
 import (
-	"bytes"
 	"fmt"
 	"log"
-	"time"
 	"tracking/internal/core/model"
 )
 
 // DecoderV2 represents an alternate implementation of the GT06 protocol decoder
 type DecoderV2 struct {
-	debug bool
+	debug        bool
+	checksumMode ChecksumMode
 }
 
 func NewDecoderV2() *DecoderV2 {
-	return &DecoderV2{debug: false}
+	return &DecoderV2{debug: false, checksumMode: ChecksumCRCITU}
 }
 
 func (d *DecoderV2) EnableDebug(enable bool) {
 	d.debug = enable
 }
 
+// SetChecksumMode selects the checksum algorithm packets are validated with
+func (d *DecoderV2) SetChecksumMode(mode ChecksumMode) {
+	d.checksumMode = mode
+}
+
 func (d *DecoderV2) logDebug(format string, v ...interface{}) {
 	if d.debug {
 		log.Printf("[GT06v2] "+format, v...)
@@ -52,11 +56,32 @@ func (d *DecoderV2) validatePacket(header *PacketHeader, data []byte) error {
 		minLength = MinLocationLength
 	case StatusMsg:
 		minLength = MinStatusLength
+	case ReplyMsg:
+		minLength = MinReplyLength
 	case AlarmMsg:
 		minLength = MinAlarmLength
+	case GPSLBSMsg:
+		minLength = MinGPSLBSLength
+	case LBSMultiMsg:
+		minLength = MinLBSMultiLength
+	case WiFiMsg:
+		minLength = MinWiFiLength
+	case InfoMsg:
+		minLength = MinInfoLength
+	case ModuleMsg:
+		minLength = MinModuleLength
+	case GPS4GMsg:
+		minLength = MinGPS4GLength
+	case Alarm4GMsg:
+		minLength = MinAlarm4GLength
 	default:
-		return fmt.Errorf("%w: 0x%02x", ErrInvalidMessageType, header.Protocol)
+		// Types unknown in extended frames are accepted undecoded
+		if header.HeaderSize == 3 {
+			return fmt.Errorf("%w: 0x%02x", ErrInvalidMessageType, header.Protocol)
+		}
+		minLength = MinOpaqueLength
 	}
+	minLength += header.HeaderSize - 3 // Minimums are for standard frames
 
 	if len(data) < minLength {
 		return fmt.Errorf("%w: got %d bytes, need at least %d",
@@ -64,7 +89,7 @@ func (d *DecoderV2) validatePacket(header *PacketHeader, data []byte) error {
 	}
 
 	checksumPos := len(data) - 4
-	calcChecksum := CalculateChecksum(data[2:checksumPos])
+	calcChecksum := d.checksumMode.Calculate(data[2:checksumPos])
 	recvChecksum := uint16(data[checksumPos])<<8 | uint16(data[checksumPos+1])
 
 	if calcChecksum != recvChecksum {
@@ -82,27 +107,23 @@ func (d *DecoderV2) validatePacket(header *PacketHeader, data []byte) error {
 func (d *DecoderV2) Decode(data []byte) (*GT06Data, error) {
 	d.logDebug("Starting packet decode (v2)...")
 
-	if len(data) < MinPacketLength {
-		return nil, fmt.Errorf("%w: need at least %d bytes",
-			ErrPacketTooShort, MinPacketLength)
-	}
-
-	if data[0] != StartByte1 || data[1] != StartByte2 {
-		return nil, fmt.Errorf("%w: expected 0x%02x%02x, got 0x%02x%02x",
-			ErrInvalidHeader, StartByte1, StartByte2, data[0], data[1])
+	length, headerSize, err := ParseFrameHeader(data)
+	if err != nil {
+		return nil, err
 	}
 
 	header := &PacketHeader{
-		Length:    data[2],
-		Protocol:  data[3],
-		TotalSize: 2 + 1 + int(data[2]) + 2 + 2, // start(2) + len(1) + content(length) + checksum(2) + end(2)
+		Length:     length,
+		Protocol:   data[headerSize],
+		HeaderSize: headerSize,
+		TotalSize:  headerSize + length + 2, // start(2) + len + content(length) + end(2)
 	}
 
 	if err := d.validatePacket(header, data); err != nil {
 		return nil, fmt.Errorf("packet validation failed: %w", err)
 	}
 
-	payloadStart := 4
+	payloadStart := header.HeaderSize + 1
 	payloadEnd := len(data) - 4
 	payload := data[payloadStart:payloadEnd]
 
@@ -110,7 +131,6 @@ func (d *DecoderV2) Decode(data []byte) (*GT06Data, error) {
 		len(payload), header.Protocol)
 
 	var result *GT06Data
-	var err error
 
 	switch header.Protocol {
 	case LoginMsg:
@@ -121,8 +141,27 @@ func (d *DecoderV2) Decode(data []byte) (*GT06Data, error) {
 		result, err = d.decodeStatusMessage(payload)
 	case AlarmMsg:
 		result, err = d.decodeAlarmMessage(payload)
+	case GPSLBSMsg:
+		result, err = d.decodeGPSLBSMessage(payload)
+	case ReplyMsg:
+		result, err = ParseReply(payload)
+	case LBSMultiMsg, WiFiMsg:
+		result, err = ParseNetworkMessage(header.Protocol, payload)
+	case InfoMsg:
+		result, err = ParseInfoMessage(payload)
+	case ModuleMsg:
+		result, err = ParseModuleMessage(payload)
+	case GPS4GMsg, Alarm4GMsg:
+		if result, err = d.decodeLocationMessage(payload[:GPSInfoLength]); err != nil {
+			break
+		}
+		if header.Protocol == GPS4GMsg {
+			err = ParseGPS4GInfo(payload[GPSInfoLength:], result)
+		} else {
+			err = ParseAlarm4GInfo(payload[GPSInfoLength:], result)
+		}
 	default:
-		return nil, fmt.Errorf("unsupported protocol: 0x%02x", header.Protocol)
+		result = &GT06Data{Opaque: true, Status: make(map[string]interface{})}
 	}
 
 	if err != nil {
@@ -130,6 +169,8 @@ func (d *DecoderV2) Decode(data []byte) (*GT06Data, error) {
 			GetMessageTypeName(header.Protocol), err)
 	}
 
+	result.Serial = ParseSerial(header.Protocol, payload)
+	result.Protocol = header.Protocol
 	return result, nil
 }
 
@@ -151,7 +192,7 @@ func (d *DecoderV2) decodeLocationMessage(data []byte) (*GT06Data, error) {
 	if result.Latitude, err = BcdToFloat(uint32(data[1])<<24 | uint32(data[2])<<16 | uint32(data[3])<<8 | uint32(data[4])); err != nil {
 		return nil, fmt.Errorf("invalid latitude: %w", err)
 	}
-	if result.Longitude, err = BcdToFloat(uint32(data[5])<<24 | uint32(data[6])<<16 | uint32(data[7])<<8 | uint32(data[8])); err != nil {
+	if result.Longitude, err = BcdToLongitude(uint32(data[5])<<24 | uint32(data[6])<<16 | uint32(data[7])<<8 | uint32(data[8])); err != nil {
 		return nil, fmt.Errorf("invalid longitude: %w", err)
 	}
 
@@ -165,7 +206,7 @@ func (d *DecoderV2) decodeLocationMessage(data []byte) (*GT06Data, error) {
 	}
 
 	if len(data) >= 16 {
-		if ts, err := ParseTimestamp(bytes.NewReader(data[12:18])); err == nil {
+		if ts, err := ParseTimestamp(data[12:18]); err == nil {
 			result.Timestamp = ts
 		}
 	}
@@ -183,11 +224,18 @@ func (d *DecoderV2) decodeStatusMessage(data []byte) (*GT06Data, error) {
 		Status: make(map[string]interface{}),
 	}
 
+	if ok, err := ParseTerminalStatus(data, result); ok {
+		if err != nil {
+			return nil, err
+		}
+		return result, nil
+	}
+
 	statusByte := data[0]
 	result.PowerLevel = int((statusByte >> 4) & 0x0F)
 	result.GSMSignal = int(statusByte & 0x0F)
 
-	if result.PowerLevel > 15 {
+	if result.PowerLevel > MaxPowerLevel {
 		return nil, fmt.Errorf("invalid power level: %d", result.PowerLevel)
 	}
 
@@ -217,25 +265,44 @@ func (d *DecoderV2) decodeLoginMessage(data []byte) (*GT06Data, error) {
 }
 
 func (d *DecoderV2) decodeAlarmMessage(data []byte) (*GT06Data, error) {
-	locationData, err := d.decodeLocationMessage(data[:len(data)-1])
+	locationData, err := d.decodeLocationMessage(data[:GPSInfoLength])
 	if err != nil {
 		return nil, fmt.Errorf("failed to decode location part: %w", err)
 	}
 
-	alarmType := data[len(data)-1]
+	alarmType := data[GPSInfoLength]
 	locationData.Alarm = GetAlarmName(alarmType)
 	locationData.Status["alarm"] = locationData.Alarm
 
 	return locationData, nil
 }
 
+func (d *DecoderV2) decodeGPSLBSMessage(data []byte) (*GT06Data, error) {
+	if len(data) < GPSInfoLength+LBSInfoLength {
+		return nil, fmt.Errorf("%w: GPS/LBS message too short: got %d bytes, need %d",
+			ErrInvalidLength, len(data), GPSInfoLength+LBSInfoLength)
+	}
+
+	result, err := d.decodeLocationMessage(data[:GPSInfoLength])
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode location part: %w", err)
+	}
+
+	if err := ParseLBSInfo(data[GPSInfoLength:], result.Status); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
 func (d *DecoderV2) ToPosition(deviceID string, data *GT06Data) *model.Position {
 	position := model.NewPosition(deviceID, data.Latitude, data.Longitude)
 	position.Speed = data.Speed
 	position.Course = data.Course
 	position.Valid = data.GPSValid
 	position.Protocol = "gt06"
-	position.Satellites = data.Satellites
+	position.Satellites = uint8(data.Satellites)
+	position.Network = data.Network
 	position.Timestamp = data.Timestamp
 
 	position.Status = make(map[string]interface{})
@@ -0,0 +1,102 @@
+package gt06
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Command is a remote-control action the server can send to a device
+type Command string
+
+// Supported commands
+const (
+	CommandEngineStop         Command = "engineStop"
+	CommandEngineResume       Command = "engineResume"
+	CommandLocate             Command = "locate"
+	CommandReboot             Command = "reboot"
+	CommandSetInterval        Command = "setInterval"        // Sent with EncodeIntervalCommand
+	CommandSetCornerReporting Command = "setCornerReporting" // Sent with EncodeCornerCommand
+)
+
+// commandText maps each command to the instruction GT06 firmware expects
+var commandText = map[Command]string{
+	CommandEngineStop:   "RELAY,1#",
+	CommandEngineResume: "RELAY,0#",
+	CommandLocate:       "WHERE#",
+	CommandReboot:       "RESET#",
+}
+
+// Report settings accepted by TIMER and ANGLEREP
+const (
+	minReportInterval = 10 * time.Second
+	maxReportInterval = 18000 * time.Second
+	minCornerAngle    = 5
+	maxCornerAngle    = 180
+)
+
+// maxCommandText keeps the packet length within the single length byte:
+// proto(1) + command len(1) + server flag(4) + serial(2) + checksum(2)
+const maxCommandText = 0xFF - 10
+
+// ErrUnsupportedCommand is returned for commands without a GT06 encoding
+var ErrUnsupportedCommand = errors.New("unsupported command")
+
+// EncodeCommand builds a 0x80 packet carrying one of the supported commands
+func (d *Decoder) EncodeCommand(command Command, serverFlag uint32, serial uint16) ([]byte, error) {
+	text, ok := commandText[command]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedCommand, command)
+	}
+	return d.EncodeTextCommand(text, serverFlag, serial)
+}
+
+// EncodeTextCommand builds a 0x80 packet carrying a raw instruction such as
+// "WHERE#". The server flag is echoed back in the device's reply.
+func (d *Decoder) EncodeTextCommand(text string, serverFlag uint32, serial uint16) ([]byte, error) {
+	if text == "" || len(text) > maxCommandText {
+		return nil, fmt.Errorf("%w: command text must be 1 to %d bytes, got %d",
+			ErrUnsupportedCommand, maxCommandText, len(text))
+	}
+
+	packet := make([]byte, 0, len(text)+15)
+	packet = append(packet, StartByte1, StartByte2)
+	packet = append(packet, byte(len(text)+10)) // Packet length
+	packet = append(packet, CommandMsg)
+	packet = append(packet, byte(len(text)+4)) // Server flag + command
+	packet = append(packet, byte(serverFlag>>24), byte(serverFlag>>16), byte(serverFlag>>8), byte(serverFlag))
+	packet = append(packet, text...)
+	packet = append(packet, byte(serial>>8), byte(serial))
+
+	crc := d.checksumMode.Calculate(packet[2:])
+	packet = append(packet, byte(crc>>8), byte(crc))
+	packet = append(packet, EndByte1, EndByte2)
+
+	d.logPacket(packet, "Command")
+	return packet, nil
+}
+
+// EncodeIntervalCommand builds a TIMER instruction setting how often the
+// device reports its position, with the engine on and off alike
+func (d *Decoder) EncodeIntervalCommand(interval time.Duration, serverFlag uint32, serial uint16) ([]byte, error) {
+	if interval < minReportInterval || interval > maxReportInterval || interval%time.Second != 0 {
+		return nil, fmt.Errorf("%w: interval must be whole seconds from %v to %v, got %v",
+			ErrUnsupportedCommand, minReportInterval, maxReportInterval, interval)
+	}
+	seconds := int(interval / time.Second)
+	return d.EncodeTextCommand(fmt.Sprintf("TIMER,%d,%d#", seconds, seconds), serverFlag, serial)
+}
+
+// EncodeCornerCommand builds an ANGLEREP instruction making the device
+// report whenever its heading turns by the angle in degrees, so a route
+// keeps its shape between timed reports. Zero turns corner reports off.
+func (d *Decoder) EncodeCornerCommand(angle int, serverFlag uint32, serial uint16) ([]byte, error) {
+	if angle == 0 {
+		return d.EncodeTextCommand("ANGLEREP,OFF#", serverFlag, serial)
+	}
+	if angle < minCornerAngle || angle > maxCornerAngle {
+		return nil, fmt.Errorf("%w: corner angle must be from %d to %d degrees, got %d",
+			ErrUnsupportedCommand, minCornerAngle, maxCornerAngle, angle)
+	}
+	return d.EncodeTextCommand(fmt.Sprintf("ANGLEREP,ON,%d,3#", angle), serverFlag, serial)
+}
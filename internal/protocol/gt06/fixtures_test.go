@@ -0,0 +1,262 @@
+package gt06
+
+import (
+	"bufio"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"text/tabwriter"
+	"time"
+)
+
+// updateGolden records how the fixtures decode now, after a change meant to
+// alter it
+var updateGolden = flag.Bool("update", false, "rewrite testdata/fixtures.golden")
+
+const (
+	fixturesDir = "testdata/fixtures"
+	goldenFile  = "testdata/fixtures.golden"
+)
+
+// fixture is one read as a device would send it: a frame, or several back
+// to back
+type fixture struct {
+	line int
+	data []byte
+	note string
+}
+
+// TestSyntheticFixtures replays the frames in testdata/fixtures through the
+// decoder the server picks for each model, and compares what every frame
+// decodes to with testdata/fixtures.golden. The fixtures are synthetic:
+// hand-built in the layout this decoder reads, with invented IMEIs, not
+// captured from devices. They catch changes in how the decoder treats each
+// model's packet types, not incompatibilities with real firmware. A frame that decoded before and now fails, or decodes
+// differently, fails the model; frames that never decoded are counted as
+// known failures. Run with -v for the table, and with -update to record
+// intended changes.
+func TestSyntheticFixtures(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join(fixturesDir, "*.hex"))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("No fixtures in %s", fixturesDir)
+	}
+	golden := readGolden(t)
+	results := make(map[string]string)
+	ran := make(map[string]bool)
+
+	var matrix strings.Builder
+	table := tabwriter.NewWriter(&matrix, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(table, "model\tframes\tdecoded\tknown failures\tregressions\t")
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), ".hex")
+		t.Run(name, func(t *testing.T) {
+			ran[name] = true
+			fixtures, mode := readFixtures(t, file)
+			decoder := NewDecoder()
+			decoder.SetChecksumMode(mode)
+
+			var frames, decoded, known, regressions int
+			for _, c := range fixtures {
+				for _, frame := range splitFixture(c.data) {
+					frames++
+					key := name + " " + hex.EncodeToString(frame.data)
+					got := frame.summary
+					if got == "" {
+						got = summarize(decoder.Decode(frame.data))
+					}
+					results[key] = got
+					if !failed(got) {
+						decoded++
+					}
+					if *updateGolden {
+						continue
+					}
+
+					want, recorded := golden[key]
+					switch {
+					case !recorded:
+						t.Errorf("%s:%d (%s) has no recorded result; run with -update", file, c.line, c.note)
+					case got == want, failed(got) && failed(want):
+						if failed(got) {
+							known++
+						}
+					case failed(want):
+						t.Errorf("%s:%d (%s) decodes now; run with -update to record it:\n  %s", file, c.line, c.note, got)
+					default:
+						regressions++
+						t.Errorf("%s:%d (%s) regressed:\n  got  %s\n  want %s", file, c.line, c.note, got, want)
+					}
+				}
+			}
+			fmt.Fprintf(table, "%s\t%d\t%d\t%d\t%d\t\n", name, frames, decoded, known, regressions)
+		})
+	}
+	table.Flush()
+	t.Log("GT06 synthetic fixtures\n" + matrix.String())
+
+	if *updateGolden {
+		// Models left out by -run keep their recorded results
+		for key, summary := range golden {
+			if !ran[strings.SplitN(key, " ", 2)[0]] {
+				results[key] = summary
+			}
+		}
+		writeGolden(t, results)
+		return
+	}
+	for key := range golden {
+		if _, ok := results[key]; !ok && ran[strings.SplitN(key, " ", 2)[0]] {
+			t.Errorf("Recorded frame %s is no longer a fixture; run with -update", key)
+		}
+	}
+}
+
+// readFixtures reads a fixture file: hex encoded reads, one per line, each
+// optionally followed by a # note. Comment lines describe the model; a
+// "# checksum: xor" line marks clones checksumming with XOR.
+func readFixtures(t *testing.T, path string) ([]fixture, ChecksumMode) {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open fixtures: %v", err)
+	}
+	defer file.Close()
+
+	var fixtures []fixture
+	mode := ChecksumCRCITU
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1<<20)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		if strings.HasPrefix(text, "#") {
+			if strings.TrimSpace(strings.TrimPrefix(text, "#")) == "checksum: xor" {
+				mode = ChecksumXOR
+			}
+			continue
+		}
+		frame, note, _ := strings.Cut(text, "#")
+		data, err := hex.DecodeString(strings.TrimSpace(frame))
+		if err != nil {
+			t.Fatalf("%s:%d: invalid hex: %v", path, line, err)
+		}
+		fixtures = append(fixtures, fixture{line: line, data: data, note: strings.TrimSpace(note)})
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatalf("Failed to read fixtures: %v", err)
+	}
+	return fixtures, mode
+}
+
+// splitFrame is a frame of a fixture, or a read that does not split into
+// frames with the summary of why
+type splitFrame struct {
+	data    []byte
+	summary string
+}
+
+// splitFixture cuts a read into frames the way the server does
+func splitFixture(data []byte) []splitFrame {
+	frames, rest, err := SplitFrames(data)
+	if err == nil && len(rest) > 0 {
+		err = fmt.Errorf("%d bytes left after the last frame", len(rest))
+	}
+	if err != nil {
+		return []splitFrame{{data: data, summary: "fail split: " + err.Error()}}
+	}
+	split := make([]splitFrame, len(frames))
+	for i, frame := range frames {
+		split[i] = splitFrame{data: frame}
+	}
+	return split
+}
+
+// summarize renders what a frame decoded to on one line, every field that
+// reaches a position included
+func summarize(data *GT06Data, err error) string {
+	if err != nil {
+		return "fail " + err.Error()
+	}
+
+	fields := []string{fmt.Sprintf("protocol=0x%02x serial=%d", data.Protocol, data.Serial)}
+	if data.Latitude != 0 || data.Longitude != 0 {
+		fields = append(fields, fmt.Sprintf("fix=%t sats=%d lat=%.6f lon=%.6f speed=%g course=%g",
+			data.GPSValid, data.Satellites, data.Latitude, data.Longitude, data.Speed, data.Course))
+	}
+	if !data.Timestamp.IsZero() {
+		fields = append(fields, "time="+data.Timestamp.Format(time.RFC3339))
+	}
+	if data.Reply != "" {
+		fields = append(fields, fmt.Sprintf("reply=%q", data.Reply))
+	}
+	if data.Opaque {
+		fields = append(fields, "opaque")
+	}
+	if data.Network != nil {
+		fields = append(fields, fmt.Sprintf("cells=%d wifi=%d", len(data.Network.CellTowers), len(data.Network.WifiAccessPoints)))
+	}
+	keys := make([]string, 0, len(data.Status))
+	for key := range data.Status {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fields = append(fields, fmt.Sprintf("%s=%v", key, data.Status[key]))
+	}
+	return "ok " + strings.Join(fields, " ")
+}
+
+func failed(summary string) bool {
+	return strings.HasPrefix(summary, "fail")
+}
+
+// readGolden reads the recorded results: a model, a frame in hex and its
+// summary per line
+func readGolden(t *testing.T) map[string]string {
+	t.Helper()
+	golden := make(map[string]string)
+	content, err := os.ReadFile(goldenFile)
+	if os.IsNotExist(err) && *updateGolden {
+		return golden
+	}
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", goldenFile, err)
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.SplitN(line, " ", 3)
+		if len(fields) < 3 {
+			t.Fatalf("Malformed line in %s: %q", goldenFile, line)
+		}
+		golden[fields[0]+" "+fields[1]] = fields[2]
+	}
+	return golden
+}
+
+func writeGolden(t *testing.T, results map[string]string) {
+	t.Helper()
+	keys := make([]string, 0, len(results))
+	for key := range results {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var content strings.Builder
+	content.WriteString("# How the synthetic frames in testdata/fixtures decode, written by\n")
+	content.WriteString("# go test -run TestSyntheticFixtures -update\n")
+	for _, key := range keys {
+		content.WriteString(key + " " + results[key] + "\n")
+	}
+	if err := os.WriteFile(goldenFile, []byte(content.String()), 0o644); err != nil {
+		t.Fatalf("Failed to write %s: %v", goldenFile, err)
+	}
+}
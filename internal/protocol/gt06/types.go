@@ -2,10 +2,15 @@
 package gt06
 
 import (
-	"bytes"
+	"encoding/binary"
 	"errors"
+	"encoding/hex"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
+	"tracking/internal/core/model"
+	"tracking/internal/core/util"
 )
 
 // GT06Data represents the decoded data from a GT06 protocol packet
@@ -21,14 +26,20 @@ type GT06Data struct {
 	PowerLevel int
 	GSMSignal  int
 	Alarm      string
+	Reply      string // Text of a command reply
+	Serial     uint16 // Information serial number, echoed in acknowledgements
+	Protocol   byte   // Protocol number of the decoded packet
+	Opaque     bool   // Extended packet of a type not decoded, such as OBD data or photos
+	Network    *model.Network
 	Status     map[string]interface{}
 }
 
 // PacketHeader represents the common header structure for GT06 packets
 type PacketHeader struct {
-	Length    byte
-	Protocol  byte
-	TotalSize int
+	Length     int // Declared length: one byte, or two in extended frames
+	Protocol   byte
+	HeaderSize int // Bytes before the protocol number
+	TotalSize  int
 }
 
 // Protocol constants
@@ -39,11 +50,24 @@ const (
 	EndByte1   = 0x0D
 	EndByte2   = 0x0A
 
+	// Extended frames carry a two byte length, for packets that can outgrow one
+	ExtStartByte1 = 0x79
+	ExtStartByte2 = 0x79
+
 	// Message types
 	LoginMsg    = 0x01
 	LocationMsg = 0x12
 	StatusMsg   = 0x13
+	ReplyMsg    = 0x15 // Device reply to a server command
 	AlarmMsg    = 0x16
+	GPSLBSMsg   = 0x22
+	LBSMultiMsg = 0x28
+	WiFiMsg     = 0x2C
+	CommandMsg  = 0x80 // Server command to the device
+	InfoMsg     = 0x94 // Information transmission: one typed value
+	ModuleMsg   = 0x98 // Information transmission: a list of modules
+	GPS4GMsg    = 0xA0 // GPS and 4G cell, sent by Jimi 4G models such as the JM-VL03
+	Alarm4GMsg  = 0xA4 // Alarm with GPS and 4G cell
 
 	// Alarm types
 	SosAlarm        = 0x01
@@ -54,14 +78,79 @@ const (
 	LowBatteryAlarm = 0x06
 	OverspeedAlarm  = 0x07
 
+	// Information types of 0x94 packets
+	InfoExternalVoltage = 0x00
+	InfoStatusSync      = 0x04
+	InfoDoorStatus      = 0x05
+	InfoSelfCheck       = 0x08
+	InfoSatellites      = 0x09
+	InfoIdentity        = 0x0A // IMEI, IMSI and ICCID
+	InfoFuel            = 0x0D // Fuel sensor sentence, !AIOAU,<device>,<sensor>,<temperature>,<level %>
+
+	// Module numbers of 0x98 packets
+	ModuleIMEI   = 0x00
+	ModuleIMSI   = 0x01
+	ModuleICCID  = 0x02
+	ModuleChipID = 0x03
+
 	// Minimum packet sizes
 	MinPacketLength   = 7
 	MinLoginLength    = 15 // start(2) + len(1) + proto(1) + imei(8) + checksum(2) + end(2)
 	MinLocationLength = 26 // start(2) + len(1) + proto(1) + gps(18) + checksum(2) + end(2)
 	MinStatusLength   = 13 // start(2) + len(1) + proto(1) + status(4) + checksum(2) + end(2)
+	MinReplyLength    = 13 // start(2) + len(1) + proto(1) + command len(1) + server flag(4) + checksum(2) + end(2)
 	MinAlarmLength    = 27 // start(2) + len(1) + proto(1) + gps(18) + alarm(1) + checksum(2) + end(2)
+	MinGPSLBSLength   = 34 // start(2) + len(1) + proto(1) + gps(18) + lbs(8) + checksum(2) + end(2)
+	MinLBSMultiLength = 62 // start(2) + len(1) + proto(1) + lbs multi(54) + checksum(2) + end(2)
+	MinWiFiLength     = 61 // start(2) + len(1) + proto(1) + cells(52) + wifi count(1) + checksum(2) + end(2)
+	MinInfoLength     = 11 // start(2) + len(1) + proto(1) + info type(1) + serial(2) + checksum(2) + end(2)
+	MinModuleLength   = 10 // start(2) + len(1) + proto(1) + serial(2) + checksum(2) + end(2)
+	MinGPS4GLength    = 44 // start(2) + len(1) + proto(1) + gps(18) + lbs 4G(15) + acc, mode, re-upload(3) + checksum(2) + end(2)
+	MinAlarm4GLength  = 31 // start(2) + len(1) + proto(1) + gps(18) + lbs length(1) + terminal, voltage, GSM, alarm(4) + checksum(2) + end(2)
+	MinOpaqueLength   = 8  // start(2) + len(1) + proto(1) + checksum(2) + end(2), for types only accepted in extended frames
+
+	// Content block sizes
+	GPSInfoLength = 18 // status(1) + lat(4) + lon(4) + speed(1) + course(2) + date(3) + time(3)
+	LBSInfoLength = 8  // mcc(2) + mnc(1) + lac(2) + cellId(3)
+
+	// 4G cell block: mcc(2) + mnc(1) + lac(4) + cellId(8). The MNC takes two
+	// bytes when the top bit of the MCC is set.
+	LBS4GInfoLength = 15
+
+	// Multi-cell block: datetime(6) + mcc(2) + mnc(1) + seven cells of lac(2) + cellId(3) + rssi(1)
+	// + timing advance(1); LBS multi packets then carry language(2), WiFi packets the WiFi list
+	CellBlockLength     = 52
+	CellCount           = 7
+	LBSMultiBodyLength  = CellBlockLength + 2
+	WiFiAccessPointSize = 7 // mac(6) + rssi(1)
+
+	// Highest voltage level reported in status packets (0 = no power ... 6 = full)
+	MaxPowerLevel = 6
+
+	// Status packets of current firmware carry terminal information(1),
+	// voltage level(1), GSM signal(1) and alarm and language(2) before the
+	// serial; older ones a single byte of power and GSM nibbles
+	StatusBodyLength = 5
 )
 
+// Bits of the terminal information byte
+const (
+	TerminalArmed       = 0x01 // Defense activated
+	TerminalACC         = 0x02 // Ignition on
+	TerminalCharging    = 0x04
+	TerminalAlarmMask   = 0x38 // 001 shock, 010 power cut, 011 low battery, 100 SOS
+	TerminalGPSTracking = 0x40
+	TerminalFuelCut     = 0x80 // Oil and electricity disconnected
+)
+
+// terminalAlarms maps the alarm bits of the terminal information byte
+var terminalAlarms = map[byte]byte{
+	1: VibrationAlarm,
+	2: PowerCutAlarm,
+	3: LowBatteryAlarm,
+	4: SosAlarm,
+}
+
 // Common errors
 var (
 	ErrInvalidHeader      = errors.New("invalid GT06 protocol header")
@@ -74,11 +163,10 @@ var (
 	ErrMalformedPacket    = errors.New("malformed packet structure")
 )
 
-// ParseTimestamp parses BCD encoded timestamp from GT06 data
-func ParseTimestamp(reader *bytes.Reader) (time.Time, error) {
-	var timeBytes [6]byte
-	if _, err := reader.Read(timeBytes[:]); err != nil {
-		return time.Time{}, err
+// ParseTimestamp parses the BCD encoded timestamp at the start of data
+func ParseTimestamp(timeBytes []byte) (time.Time, error) {
+	if len(timeBytes) < 6 {
+		return time.Time{}, ErrInvalidTimestamp
 	}
 
 	year := 2000 + ((int(timeBytes[0])>>4)*10 + int(timeBytes[0]&0x0F))
@@ -96,12 +184,63 @@ func ParseTimestamp(reader *bytes.Reader) (time.Time, error) {
 	return time.Date(year, time.Month(month), day, hour, minute, second, 0, time.UTC), nil
 }
 
-// BcdToFloat converts BCD encoded coordinates to float64
+// BcdToFloat converts a BCD encoded latitude (DD MM.MMMM) to decimal degrees
+// over all eight digits. Nibbles above 9, more than 90 degrees or minutes
+// past 59 fail with ErrInvalidCoordinate.
 func BcdToFloat(bcd uint32) (float64, error) {
-	degrees := float64(BcdToDec(byte(bcd>>24)))*10 +
-		float64(BcdToDec(byte((bcd>>16)&0xFF)))/60 +
-		float64(BcdToDec(byte((bcd>>8)&0xFF)))/3600
-	return degrees, nil
+	digits, err := bcdDigits(bcd)
+	if err != nil {
+		return 0, err
+	}
+
+	degrees := digits[0]*10 + digits[1]
+	minutes := digits[2]*100000 + digits[3]*10000 + digits[4]*1000 + digits[5]*100 + digits[6]*10 + digits[7]
+	return degreesMinutesToFloat(degrees, minutes, 10000, 90)
+}
+
+// BcdToLongitude converts a BCD encoded longitude (DDD MM.MMM) to decimal degrees
+// with the same checks against 180 degrees.
+func BcdToLongitude(bcd uint32) (float64, error) {
+	digits, err := bcdDigits(bcd)
+	if err != nil {
+		return 0, err
+	}
+
+	degrees := digits[0]*100 + digits[1]*10 + digits[2]
+	minutes := digits[3]*10000 + digits[4]*1000 + digits[5]*100 + digits[6]*10 + digits[7]
+	return degreesMinutesToFloat(degrees, minutes, 1000, 180)
+}
+
+// bcdDigits splits a 4-byte BCD value into its eight decimal digits
+func bcdDigits(bcd uint32) ([8]int, error) {
+	var digits [8]int
+	for i := range digits {
+		digit := int(bcd>>(28-4*uint(i))) & 0x0F
+		if digit > 9 {
+			return digits, fmt.Errorf("%w: invalid BCD digit 0x%X in 0x%08X",
+				ErrInvalidCoordinate, digit, bcd)
+		}
+		digits[i] = digit
+	}
+	return digits, nil
+}
+
+// degreesMinutesToFloat converts whole degrees and minutes counted in
+// 1/scale of a minute to decimal degrees. The minutes stay integers until
+// the one division, so no float error builds up before rounding.
+func degreesMinutesToFloat(degrees, minutes, scale, maxDegrees int) (float64, error) {
+	if degrees > maxDegrees {
+		return 0, fmt.Errorf("%w: degrees %d exceed %d", ErrInvalidCoordinate, degrees, maxDegrees)
+	}
+	if minutes >= 60*scale {
+		return 0, fmt.Errorf("%w: minutes %.4f exceed 59", ErrInvalidCoordinate, float64(minutes)/float64(scale))
+	}
+
+	value := util.RoundCoordinate(float64(degrees) + float64(minutes)/float64(60*scale))
+	if value > float64(maxDegrees) {
+		return 0, fmt.Errorf("%w: %.6f exceeds %d degrees", ErrInvalidCoordinate, value, maxDegrees)
+	}
+	return value, nil
 }
 
 // BcdToDec converts a BCD byte to decimal
@@ -109,8 +248,99 @@ func BcdToDec(b byte) int {
 	return int(b>>4)*10 + int(b&0x0F)
 }
 
-// CalculateChecksum calculates the checksum for GT06 packets
+// ParseSerial returns the information serial number, the last field before
+// the checksum, or 0 when the content is too short to carry one after the
+// message body
+func ParseSerial(protocol byte, content []byte) uint16 {
+	var bodyLength int
+	switch protocol {
+	case LoginMsg:
+		bodyLength = 8 // IMEI
+	case LocationMsg:
+		bodyLength = GPSInfoLength
+	case StatusMsg:
+		bodyLength = 1 // Terminal information
+	case ReplyMsg:
+		if len(content) == 0 {
+			return 0
+		}
+		bodyLength = 1 + int(content[0]) // Command length + server flag and text
+	case AlarmMsg:
+		bodyLength = GPSInfoLength + 1 // GPS + alarm type
+	case GPSLBSMsg:
+		bodyLength = GPSInfoLength + LBSInfoLength
+	case LBSMultiMsg:
+		bodyLength = LBSMultiBodyLength
+	case WiFiMsg:
+		if len(content) <= CellBlockLength {
+			return 0
+		}
+		bodyLength = CellBlockLength + 1 + int(content[CellBlockLength])*WiFiAccessPointSize
+	case InfoMsg:
+		bodyLength = 1 // Information type; the value length varies
+	case ModuleMsg:
+		bodyLength = 0 // Modules are walked by ParseModuleMessage
+	case GPS4GMsg:
+		bodyLength = GPSInfoLength + LBS4GInfoLength + 3
+	case Alarm4GMsg:
+		bodyLength = GPSInfoLength + 1 + 4
+	default:
+		return 0
+	}
+
+	if len(content) < bodyLength+2 {
+		return 0
+	}
+	return uint16(content[len(content)-2])<<8 | uint16(content[len(content)-1])
+}
+
+// ChecksumMode selects the algorithm used for packet checksums
+type ChecksumMode int
+
+const (
+	// ChecksumCRCITU is the CRC-ITU (CRC-16/X25) used by genuine hardware
+	ChecksumCRCITU ChecksumMode = iota
+	// ChecksumXOR is the byte-wise XOR used by some clone devices
+	ChecksumXOR
+)
+
+// Calculate computes the checksum of data using the selected algorithm
+func (m ChecksumMode) Calculate(data []byte) uint16 {
+	if m == ChecksumXOR {
+		return CalculateXORChecksum(data)
+	}
+	return CalculateChecksum(data)
+}
+
+// crcITUTable holds the reflected CRC-ITU remainders for every byte value
+var crcITUTable = func() [256]uint16 {
+	var table [256]uint16
+	for i := range table {
+		crc := uint16(i)
+		for bit := 0; bit < 8; bit++ {
+			if crc&0x0001 != 0 {
+				crc = (crc >> 1) ^ 0x8408
+			} else {
+				crc >>= 1
+			}
+		}
+		table[i] = crc
+	}
+	return table
+}()
+
+// CalculateChecksum calculates the CRC-ITU (CRC-16/X25) checksum for GT06
+// packets, computed from the length byte through the serial number
 func CalculateChecksum(data []byte) uint16 {
+	crc := uint16(0xFFFF)
+	for _, b := range data {
+		crc = (crc >> 8) ^ crcITUTable[byte(crc)^b]
+	}
+	return ^crc
+}
+
+// CalculateXORChecksum calculates the simple checksum used by clone devices
+func CalculateXORChecksum(data []byte) uint16 {
 	var sum uint16
 	for _, b := range data {
 		sum ^= uint16(b)
@@ -127,6 +357,412 @@ func ValidateCoordinates(lat, lon float64) error {
 	return nil
 }
 
+// ParseLBSInfo decodes the cell tower block (MCC, MNC, LAC, CellID) into status
+func ParseLBSInfo(data []byte, status map[string]interface{}) error {
+	if len(data) < LBSInfoLength {
+		return fmt.Errorf("%w: LBS block too short: got %d bytes, need %d",
+			ErrMalformedPacket, len(data), LBSInfoLength)
+	}
+
+	status["mcc"] = int(data[0])<<8 | int(data[1])
+	status["mnc"] = int(data[2])
+	status["lac"] = int(data[3])<<8 | int(data[4])
+	status["cellId"] = int(data[5])<<16 | int(data[6])<<8 | int(data[7])
+	return nil
+}
+
+// ParseLBS4GInfo decodes a 4G cell block (MCC, MNC, LAC, CellID) into status
+// and returns its size
+func ParseLBS4GInfo(data []byte, status map[string]interface{}) (int, error) {
+	if len(data) < LBS4GInfoLength {
+		return 0, fmt.Errorf("%w: 4G LBS block too short: got %d bytes, need %d",
+			ErrMalformedPacket, len(data), LBS4GInfoLength)
+	}
+
+	mcc := binary.BigEndian.Uint16(data)
+	size, mnc := LBS4GInfoLength, int(data[2])
+	if mcc&0x8000 != 0 {
+		size++
+		if len(data) < size {
+			return 0, fmt.Errorf("%w: 4G LBS block with a two byte MNC needs %d bytes, got %d",
+				ErrMalformedPacket, size, len(data))
+		}
+		mnc = int(binary.BigEndian.Uint16(data[2:]))
+	}
+
+	cell := data[size-12:]
+	status["mcc"] = int(mcc & 0x7FFF)
+	status["mnc"] = mnc
+	status["lac"] = int(binary.BigEndian.Uint32(cell))
+	status["cellId"] = int(binary.BigEndian.Uint64(cell[4:]))
+	return size, nil
+}
+
+// ParseGPS4GInfo decodes what follows the GPS block of a 4G location (0xA0)
+// packet: the 4G cell, ACC, upload mode, real-time or re-upload flag and,
+// on firmware that reports it, the mileage in meters
+func ParseGPS4GInfo(data []byte, result *GT06Data) error {
+	n, err := ParseLBS4GInfo(data, result.Status)
+	if err != nil {
+		return err
+	}
+	rest := data[n:]
+	if len(rest) < 3 {
+		return fmt.Errorf("%w: 4G location needs ACC, upload mode and re-upload bytes", ErrMalformedPacket)
+	}
+
+	result.Status["ignition"] = rest[0] == 0x01
+	result.Status["uploadMode"] = int(rest[1])
+	if rest[2] == 0x01 {
+		result.Status["buffered"] = true
+	}
+	if len(rest) >= 3+4+2 { // Mileage before the serial number
+		result.Status["odometer"] = int(binary.BigEndian.Uint32(rest[3:]))
+	}
+	return nil
+}
+
+// ParseAlarm4GInfo decodes what follows the GPS block of a 4G alarm (0xA4)
+// packet: the LBS length, counting itself, and the 4G cell when there is
+// one, then terminal information, voltage level, GSM signal and alarm type
+func ParseAlarm4GInfo(data []byte, result *GT06Data) error {
+	if len(data) < 1 {
+		return fmt.Errorf("%w: 4G alarm has no LBS length", ErrMalformedPacket)
+	}
+
+	offset := 1
+	if lbsLength := int(data[0]); lbsLength > 1 {
+		if len(data) < lbsLength {
+			return fmt.Errorf("%w: LBS length %d exceeds %d bytes", ErrMalformedPacket, lbsLength, len(data))
+		}
+		if _, err := ParseLBS4GInfo(data[1:lbsLength], result.Status); err != nil {
+			return err
+		}
+		offset = lbsLength
+	}
+	if len(data) < offset+4 {
+		return fmt.Errorf("%w: 4G alarm needs terminal, voltage, GSM and alarm bytes", ErrMalformedPacket)
+	}
+
+	status := data[offset:]
+	result.Status["ignition"] = status[0]&0x02 != 0
+	result.Status["charging"] = status[0]&0x04 != 0
+	result.PowerLevel = int(status[1])
+	result.GSMSignal = int(status[2])
+	result.Alarm = GetAlarmName(status[3])
+	result.Status["alarm"] = result.Alarm
+	return nil
+}
+
+// ParseTerminalStatus decodes the content of a status packet in the current
+// layout into result, and reports false for the older single-byte layout
+func ParseTerminalStatus(data []byte, result *GT06Data) (bool, error) {
+	if len(data) < StatusBodyLength+2 {
+		return false, nil
+	}
+
+	info := data[0]
+	result.PowerLevel = int(data[1])
+	result.GSMSignal = int(data[2])
+	if result.PowerLevel > MaxPowerLevel {
+		return true, fmt.Errorf("%w: voltage level %d exceeds maximum of %d",
+			ErrMalformedPacket, result.PowerLevel, MaxPowerLevel)
+	}
+
+	result.Status["powerLevel"] = result.PowerLevel
+	result.Status["gsmSignal"] = result.GSMSignal
+	result.Status["ignition"] = info&TerminalACC != 0
+	result.Status["armed"] = info&TerminalArmed != 0
+	result.Status["charging"] = info&TerminalCharging != 0
+	result.Status["gpsTracking"] = info&TerminalGPSTracking != 0
+	result.Status["fuelCut"] = info&TerminalFuelCut != 0
+	if alarm, ok := terminalAlarms[(info&TerminalAlarmMask)>>3]; ok {
+		result.Alarm = GetAlarmName(alarm)
+		result.Status["alarm"] = result.Alarm
+	}
+	return true, nil
+}
+
+// ParseNetworkMessage decodes the content of an LBS multi-cell (0x28) or
+// WiFi (0x2C) packet. These carry no GPS fix, only cell towers and access
+// points for a geolocation provider to resolve.
+func ParseNetworkMessage(protocol byte, data []byte) (*GT06Data, error) {
+	minLength := LBSMultiBodyLength
+	if protocol == WiFiMsg {
+		minLength = CellBlockLength + 1
+	}
+	if len(data) < minLength {
+		return nil, fmt.Errorf("%w: %s message too short: got %d bytes, need %d",
+			ErrInvalidLength, GetMessageTypeName(protocol), len(data), minLength)
+	}
+
+	timestamp, err := ParseTimestamp(data[:6])
+	if err != nil {
+		return nil, err
+	}
+
+	result := &GT06Data{
+		Valid:     true,
+		Timestamp: timestamp,
+		Network:   &model.Network{RadioType: "gsm"},
+		Status:    make(map[string]interface{}),
+	}
+
+	mcc := int(data[6])<<8 | int(data[7])
+	mnc := int(data[8])
+	for i := 0; i < CellCount; i++ {
+		cell := data[9+i*6 : 15+i*6]
+		lac := int(cell[0])<<8 | int(cell[1])
+		cellID := int(cell[2])<<16 | int(cell[3])<<8 | int(cell[4])
+		if lac == 0 && cellID == 0 {
+			continue // Unused neighbour slot
+		}
+		result.Network.AddCellTower(model.CellTower{
+			MobileCountryCode: mcc,
+			MobileNetworkCode: mnc,
+			LocationAreaCode:  lac,
+			CellID:            cellID,
+			SignalStrength:    -int(cell[5]),
+		})
+	}
+
+	if protocol == WiFiMsg {
+		count := int(data[CellBlockLength])
+		end := CellBlockLength + 1 + count*WiFiAccessPointSize
+		if len(data) < end {
+			return nil, fmt.Errorf("%w: WiFi list truncated: %d access points need %d bytes, got %d",
+				ErrMalformedPacket, count, end, len(data))
+		}
+		for i := 0; i < count; i++ {
+			ap := data[CellBlockLength+1+i*WiFiAccessPointSize:]
+			result.Network.AddWifiAccessPoint(model.WifiAccessPoint{
+				MacAddress: fmt.Sprintf("%02x:%02x:%02x:%02x:%02x:%02x",
+					ap[0], ap[1], ap[2], ap[3], ap[4], ap[5]),
+				SignalStrength: -int(ap[6]),
+			})
+		}
+	}
+
+	return result, nil
+}
+
+// ParseReply decodes a command reply: command length, server flag and the
+// reply text, optionally followed by a language field and the serial number
+func ParseReply(data []byte) (*GT06Data, error) {
+	if len(data) < 5 {
+		return nil, fmt.Errorf("%w: reply needs 5 bytes, got %d", ErrPacketTooShort, len(data))
+	}
+
+	commandLength := int(data[0])
+	if commandLength < 4 || len(data) < 1+commandLength {
+		return nil, fmt.Errorf("%w: reply command length %d exceeds %d bytes",
+			ErrMalformedPacket, commandLength, len(data)-1)
+	}
+
+	return &GT06Data{
+		Reply:  string(data[5 : 1+commandLength]),
+		Status: make(map[string]interface{}),
+	}, nil
+}
+
+// ParseFrameHeader validates the start bytes and returns the declared length
+// and the number of bytes before the protocol number: 3 for standard frames,
+// 4 for extended frames with a two byte length
+func ParseFrameHeader(data []byte) (declaredLength, headerSize int, err error) {
+	if len(data) < 2 {
+		return 0, 0, fmt.Errorf("%w: need at least %d bytes", ErrPacketTooShort, MinPacketLength)
+	}
+
+	switch {
+	case data[0] == StartByte1 && data[1] == StartByte2:
+		headerSize = 3
+	case data[0] == ExtStartByte1 && data[1] == ExtStartByte2:
+		headerSize = 4
+	default:
+		return 0, 0, fmt.Errorf("%w: expected 0x%02x%02x or 0x%02x%02x, got 0x%02x%02x",
+			ErrInvalidHeader, StartByte1, StartByte2, ExtStartByte1, ExtStartByte2, data[0], data[1])
+	}
+
+	if len(data) < MinPacketLength+headerSize-3 {
+		return 0, 0, fmt.Errorf("%w: need at least %d bytes",
+			ErrPacketTooShort, MinPacketLength+headerSize-3)
+	}
+
+	declaredLength = int(data[2])
+	if headerSize == 4 {
+		declaredLength = int(data[2])<<8 | int(data[3])
+	}
+	return declaredLength, headerSize, nil
+}
+
+// FrameSize returns the size of the frame data starts with, from its
+// declared length, so a frame split across reads can be reassembled
+func FrameSize(data []byte) (int, error) {
+	declaredLength, headerSize, err := ParseFrameHeader(data)
+	if err != nil {
+		return 0, err
+	}
+	return headerSize + declaredLength + 2, nil
+}
+
+// SplitFrames cuts data into the frames it holds back to back, as devices
+// send them when uploading positions buffered while out of coverage. A
+// frame cut off at the end is returned as rest, to be completed by the
+// next read.
+func SplitFrames(data []byte) (frames [][]byte, rest []byte, err error) {
+	for len(data) > 0 {
+		size, err := FrameSize(data)
+		if errors.Is(err, ErrPacketTooShort) && (data[0] == StartByte1 || data[0] == ExtStartByte1) {
+			return frames, data, nil
+		}
+		if err != nil {
+			return frames, nil, err
+		}
+		if size > len(data) {
+			return frames, data, nil
+		}
+		frames = append(frames, data[:size])
+		data = data[size:]
+	}
+	return frames, nil, nil
+}
+
+// IsLogin reports whether a standard or extended frame is a login packet
+func IsLogin(data []byte) bool {
+	_, headerSize, err := ParseFrameHeader(data)
+	return err == nil && len(data) > headerSize && data[headerSize] == LoginMsg
+}
+
+// DeviceID returns the IMEI of a login packet in a standard or extended frame
+func DeviceID(data []byte) (string, error) {
+	_, headerSize, err := ParseFrameHeader(data)
+	if err != nil {
+		return "", err
+	}
+	if len(data) < headerSize+9 {
+		return "", fmt.Errorf("%w: login needs %d bytes, got %d", ErrPacketTooShort, headerSize+9, len(data))
+	}
+	return fmt.Sprintf("%X", data[headerSize+1:headerSize+9]), nil
+}
+
+// ParseInfoMessage decodes an information transmission (0x94) packet: an
+// information type, its value and the serial number. The values are device
+// health data stored in the position status.
+func ParseInfoMessage(data []byte) (*GT06Data, error) {
+	if len(data) < 3 {
+		return nil, fmt.Errorf("%w: info message needs 3 bytes, got %d", ErrPacketTooShort, len(data))
+	}
+
+	result := &GT06Data{Status: make(map[string]interface{})}
+	value := data[1 : len(data)-2]
+
+	switch data[0] {
+	case InfoExternalVoltage:
+		if len(value) < 2 {
+			return nil, fmt.Errorf("%w: external voltage needs 2 bytes, got %d", ErrMalformedPacket, len(value))
+		}
+		result.Status["externalVoltage"] = float64(uint16(value[0])<<8|uint16(value[1])) / 100
+	case InfoStatusSync:
+		result.Status["terminalStatus"] = string(value)
+	case InfoDoorStatus:
+		if len(value) < 1 {
+			return nil, fmt.Errorf("%w: door status needs 1 byte", ErrMalformedPacket)
+		}
+		result.Status["door"] = value[0]&0x01 == 0x01
+	case InfoSelfCheck:
+		result.Status["selfCheck"] = string(value)
+	case InfoSatellites:
+		if len(value) < 1 {
+			return nil, fmt.Errorf("%w: satellite count needs 1 byte", ErrMalformedPacket)
+		}
+		result.Status["satellitesVisible"] = int(value[0])
+	case InfoIdentity:
+		if len(value) < 26 {
+			return nil, fmt.Errorf("%w: identity needs 26 bytes, got %d", ErrMalformedPacket, len(value))
+		}
+		result.Status["imsi"] = bcdString(value[8:16])
+		result.Status["iccid"] = bcdString(value[16:26])
+	case InfoFuel:
+		if err := parseFuelSentence(string(value), result.Status); err != nil {
+			return nil, err
+		}
+	default:
+		// Unknown types still keep the device alive
+		result.Status["infoType"] = int(data[0])
+	}
+
+	return result, nil
+}
+
+// parseFuelSentence reads the temperature and level of the fuel sensor
+// sentence some models relay, which may follow a few bytes of sensor data
+func parseFuelSentence(value string, status map[string]interface{}) error {
+	start := strings.Index(value, "!AIOAU,")
+	if start < 0 {
+		return fmt.Errorf("%w: no fuel sentence", ErrMalformedPacket)
+	}
+	fields := strings.Split(strings.TrimRight(value[start:], "\x00\r\n"), ",")
+	if len(fields) < 5 {
+		return fmt.Errorf("%w: fuel sentence has %d fields, need 5", ErrMalformedPacket, len(fields))
+	}
+	temperature, err := strconv.ParseFloat(fields[3], 64)
+	if err != nil {
+		return fmt.Errorf("%w: invalid fuel temperature %q", ErrMalformedPacket, fields[3])
+	}
+	level, err := strconv.ParseFloat(fields[4], 64)
+	if err != nil {
+		return fmt.Errorf("%w: invalid fuel level %q", ErrMalformedPacket, fields[4])
+	}
+	status["fuelTemperature"] = temperature
+	status["fuelLevel"] = level
+	return nil
+}
+
+// ParseModuleMessage decodes an information transmission (0x98) packet: a
+// list of module number(2) + length(2) + value entries and the serial number
+func ParseModuleMessage(data []byte) (*GT06Data, error) {
+	if len(data) < 2 {
+		return nil, fmt.Errorf("%w: module message needs 2 bytes, got %d", ErrPacketTooShort, len(data))
+	}
+
+	result := &GT06Data{Status: make(map[string]interface{})}
+	modules := data[:len(data)-2]
+	for len(modules) > 0 {
+		if len(modules) < 4 {
+			return nil, fmt.Errorf("%w: truncated module header", ErrMalformedPacket)
+		}
+		number := uint16(modules[0])<<8 | uint16(modules[1])
+		length := int(modules[2])<<8 | int(modules[3])
+		if len(modules) < 4+length {
+			return nil, fmt.Errorf("%w: module 0x%02x needs %d bytes, got %d",
+				ErrMalformedPacket, number, length, len(modules)-4)
+		}
+		value := modules[4 : 4+length]
+		modules = modules[4+length:]
+
+		switch number {
+		case ModuleIMSI:
+			result.Status["imsi"] = bcdString(value)
+		case ModuleICCID:
+			result.Status["iccid"] = bcdString(value)
+		case ModuleChipID:
+			result.Status["chipId"] = hex.EncodeToString(value)
+		}
+	}
+
+	return result, nil
+}
+
+// bcdString unpacks BCD digits, dropping the leading zero and trailing 0xF
+// nibbles that pad odd-length numbers
+func bcdString(value []byte) string {
+	digits := strings.TrimRight(hex.EncodeToString(value), "f")
+	if len(digits) > 1 && digits[0] == '0' {
+		digits = digits[1:]
+	}
+	return digits
+}
+
 // GetMessageTypeName returns a human-readable name for message types
 func GetMessageTypeName(protocolNumber byte) string {
 	switch protocolNumber {
@@ -136,8 +772,24 @@ func GetMessageTypeName(protocolNumber byte) string {
 		return "location"
 	case StatusMsg:
 		return "status"
+	case ReplyMsg:
+		return "reply"
 	case AlarmMsg:
 		return "alarm"
+	case GPSLBSMsg:
+		return "gps_lbs"
+	case LBSMultiMsg:
+		return "lbs_multi"
+	case WiFiMsg:
+		return "wifi"
+	case InfoMsg:
+		return "info"
+	case ModuleMsg:
+		return "module_info"
+	case GPS4GMsg:
+		return "gps_4g"
+	case Alarm4GMsg:
+		return "alarm_4g"
 	default:
 		return fmt.Sprintf("unknown_0x%02x", protocolNumber)
 	}
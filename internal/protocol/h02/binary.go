@@ -0,0 +1,120 @@
+package h02
+
+import (
+	"fmt"
+)
+
+// Binary H02 frames start with '$' and pack the report in BCD, apart from
+// the raw power byte and status word:
+//
+//	'$'(1) id(5) time HHMMSS(3) date DDMMYY(3) latitude DDMMmmmm(4) power(1)
+//	longitude DDDMMmmmm + flags nibble(5) speed SSS + course CCC(3) status(4)
+//
+// Some firmware appends a record number or other fields, which are ignored.
+const (
+	binaryStart     = '$'
+	binaryLength    = 29
+	binaryIDLength  = 5
+	binaryFlagValid = 0x02
+	binaryFlagNorth = 0x04
+	binaryFlagEast  = 0x08
+)
+
+// IsBinary reports whether data is a binary H02 frame
+func IsBinary(data []byte) bool {
+	return len(data) > 0 && data[0] == binaryStart
+}
+
+// BinaryDeviceID returns the 10 digit identifier of a binary frame
+func BinaryDeviceID(data []byte) (string, error) {
+	if !IsBinary(data) || len(data) < 1+binaryIDLength {
+		return "", fmt.Errorf("%w: binary frame needs %d bytes for the device ID",
+			ErrPacketTooShort, 1+binaryIDLength)
+	}
+	return bcdDigits(data[1 : 1+binaryIDLength])
+}
+
+func (d *Decoder) decodeBinary(data []byte) (*H02Data, error) {
+	if len(data) < binaryLength {
+		return nil, fmt.Errorf("%w: binary frame got %d bytes, need at least %d",
+			ErrPacketTooShort, len(data), binaryLength)
+	}
+
+	// Time through course is BCD, except the raw power byte and the flags
+	// nibble, which are cleared before unpacking
+	packed := append([]byte{}, data[6:25]...)
+	packed[10] = 0
+	packed[15] &= 0xF0
+	digits, err := bcdDigits(packed)
+	if err != nil {
+		return nil, err
+	}
+	d.logDebug("Binary report digits: %s", digits)
+
+	result := &H02Data{
+		Status: make(map[string]interface{}),
+	}
+
+	timestamp, err := d.parseDateTime(digits[0:6], digits[6:12])
+	if err != nil {
+		return nil, err
+	}
+	result.Timestamp = timestamp
+
+	flags := data[21] & 0x0F
+	result.Valid = flags&binaryFlagValid != 0
+
+	latitudeDir, longitudeDir := "S", "W"
+	if flags&binaryFlagNorth != 0 {
+		latitudeDir = "N"
+	}
+	if flags&binaryFlagEast != 0 {
+		longitudeDir = "E"
+	}
+
+	// Coordinates reuse the ASCII DDMM.mmmm parser
+	if result.Latitude, err = d.parseCoordinate(digits[12:16]+"."+digits[16:20], latitudeDir); err != nil {
+		return nil, fmt.Errorf("invalid latitude: %w", err)
+	}
+	if result.Longitude, err = d.parseCoordinate(digits[22:27]+"."+digits[27:31], longitudeDir); err != nil {
+		return nil, fmt.Errorf("invalid longitude: %w", err)
+	}
+
+	result.PowerLevel = data[16]
+	if result.PowerLevel > 100 {
+		result.PowerLevel = 100
+	}
+	if result.PowerLevel > 0 {
+		result.Status["powerLevel"] = result.PowerLevel
+	}
+
+	speed, course := bcdValue(digits[32:35]), bcdValue(digits[35:38])
+	result.Speed = float64(speed) * 1.852 // Convert knots to km/h
+	result.Course = float64(course)
+
+	status := uint32(data[25])<<24 | uint32(data[26])<<16 | uint32(data[27])<<8 | uint32(data[28])
+	decodeStatusBits(status, result)
+
+	return result, nil
+}
+
+// bcdDigits unpacks BCD bytes into decimal digits
+func bcdDigits(data []byte) (string, error) {
+	digits := make([]byte, 0, len(data)*2)
+	for _, b := range data {
+		if b>>4 > 9 || b&0x0F > 9 {
+			return "", fmt.Errorf("%w: invalid BCD byte 0x%02x", ErrMalformedPacket, b)
+		}
+		digits = append(digits, '0'+b>>4, '0'+b&0x0F)
+	}
+	return string(digits), nil
+}
+
+// bcdValue parses a run of digits produced by bcdDigits
+func bcdValue(digits string) int {
+	value := 0
+	for _, c := range digits {
+		value = value*10 + int(c-'0')
+	}
+	return value
+}
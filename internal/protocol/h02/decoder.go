@@ -2,6 +2,7 @@
 package h02
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"log"
@@ -9,6 +10,7 @@ import (
 	"strings"
 	"time"
 	"tracking/internal/core/model"
+	"tracking/internal/core/util"
 )
 
 // Common H02 errors
@@ -30,6 +32,7 @@ const (
 	infoReport   = "V1"
 	alarmReport  = "V2"
 	statusReport = "V3"
+	commandReply = "V4"
 
 	// Alarm types
 	sosAlarm        = "0"
@@ -41,11 +44,13 @@ const (
 
 type Decoder struct {
 	debug bool
+	clock util.Clock
 }
 
 func NewDecoder() *Decoder {
 	return &Decoder{
 		debug: false,
+		clock: util.SystemClock,
 	}
 }
 
@@ -53,6 +58,11 @@ func (d *Decoder) EnableDebug(enable bool) {
 	d.debug = enable
 }
 
+// SetClock sets the clock used when a report carries no usable date
+func (d *Decoder) SetClock(clock util.Clock) {
+	d.clock = clock
+}
+
 func (d *Decoder) logDebug(format string, v ...interface{}) {
 	if d.debug {
 		log.Printf("[H02] "+format, v...)
@@ -74,10 +84,37 @@ func (d *Decoder) logPacket(data []byte, prefix string) {
 	d.logDebug("%s Packet [%d bytes]:\n        %s", prefix, len(data), hexStr)
 }
 
+// SplitFrames cuts text reports sent back to back, as devices upload the
+// reports buffered while out of coverage, into single frames. Binary
+// frames, whose length varies with the firmware, are left whole.
+func SplitFrames(data []byte) [][]byte {
+	if IsBinary(data) {
+		return [][]byte{data}
+	}
+
+	var frames [][]byte
+	for {
+		data = bytes.TrimLeft(data, " \r\n")
+		if len(data) == 0 {
+			return frames
+		}
+		end := bytes.IndexByte(data, '#')
+		if end < 0 {
+			return append(frames, data)
+		}
+		frames = append(frames, data[:end+1])
+		data = data[end+1:]
+	}
+}
+
 func (d *Decoder) Decode(data []byte) (*H02Data, error) {
 	d.logDebug("Starting packet decode...")
 	d.logPacket(data, "Received")
 
+	if IsBinary(data) {
+		return d.decodeBinary(data)
+	}
+
 	if len(data) < minLength {
 		return nil, fmt.Errorf("%w: got %d bytes, need at least %d",
 			ErrPacketTooShort, len(data), minLength)
@@ -97,6 +134,7 @@ func (d *Decoder) Decode(data []byte) (*H02Data, error) {
 	if len(parts) < 3 {
 		return nil, fmt.Errorf("%w: insufficient fields", ErrInvalidFormat)
 	}
+	parts = normalizeLayout(parts)
 
 	// Parse message type
 	msgType := parts[0]
@@ -109,14 +147,60 @@ func (d *Decoder) Decode(data []byte) (*H02Data, error) {
 		return d.decodeAlarmReport(parts[1:])
 	case statusReport:
 		return d.decodeStatusReport(parts[1:])
+	case commandReply:
+		return d.decodeCommandReply(parts[1:])
 	default:
 		return nil, fmt.Errorf("%w: %s", ErrInvalidMessageType, msgType)
 	}
 }
 
+// DeviceID returns the identifier a binary or ASCII frame reports with
+func DeviceID(data []byte) (string, error) {
+	if IsBinary(data) {
+		return BinaryDeviceID(data)
+	}
+
+	dataStr := strings.TrimSuffix(strings.TrimSpace(string(data)), "#")
+	if !strings.HasPrefix(dataStr, startSequence+",") {
+		return "", fmt.Errorf("%w: expected %s,", ErrInvalidHeader, startSequence)
+	}
+	parts := strings.Split(strings.TrimPrefix(dataStr, startSequence+","), ",")
+	if len(parts) < 2 {
+		return "", fmt.Errorf("%w: insufficient fields", ErrInvalidFormat)
+	}
+	return normalizeLayout(parts)[1], nil
+}
+
+// normalizeLayout orders the leading fields as message type, device ID.
+// Most firmware sends *HQ,<id>,V1,HHMMSS,... while older units put the type
+// first: *HQ,V1,<id>,....
+func normalizeLayout(parts []string) []string {
+	if len(parts) < 2 || isMessageType(parts[0]) || !isMessageType(parts[1]) {
+		return parts
+	}
+
+	return append([]string{parts[1], parts[0]}, parts[2:]...)
+}
+
+// isMessageType reports whether a field is a message type such as V1
+func isMessageType(field string) bool {
+	if len(field) < 2 || field[0] != 'V' {
+		return false
+	}
+	_, err := strconv.Atoi(field[1:])
+	return err == nil
+}
+
 func (d *Decoder) decodeInfoReport(parts []string) (*H02Data, error) {
-	if len(parts) < 10 {
-		return nil, fmt.Errorf("%w: info report requires at least 10 fields", ErrInvalidFormat)
+	// The time of day follows the device ID when the firmware sends it
+	var clock string
+	if len(parts) > 1 && isTimeField(parts[1]) {
+		clock = parts[1]
+		parts = append([]string{parts[0]}, parts[2:]...)
+	}
+
+	if len(parts) < 9 {
+		return nil, fmt.Errorf("%w: info report requires at least 9 fields", ErrInvalidFormat)
 	}
 
 	result := &H02Data{
@@ -147,21 +231,32 @@ func (d *Decoder) decodeInfoReport(parts []string) (*H02Data, error) {
 		result.Speed = speed * 1.852 // Convert knots to km/h
 	}
 
-	// Parse course
+	// Parse course, which some firmware leaves empty while standing
 	if course, err := strconv.ParseFloat(parts[7], 64); err == nil {
 		result.Course = course
+	} else {
+		result.Warnings = append(result.Warnings, model.DecodeWarning{Code: model.WarningCourseMissing, Message: fmt.Sprintf("course %q unreadable, defaulted to 0", parts[7])})
 	}
 
-	// Parse timestamp
-	if ts, err := d.parseTimestamp(parts[8]); err == nil {
+	// Parse timestamp, from the date alone when the time is missing
+	var ts time.Time
+	if clock != "" {
+		ts, err = d.parseDateTime(clock, parts[8])
+	} else {
+		ts, err = d.parseTimestamp(parts[8])
+	}
+	if err == nil {
 		result.Timestamp = ts
 	} else {
 		d.logDebug("Failed to parse timestamp: %v", err)
 	}
 
-	// Parse power level if available
+	// The date is followed by the vehicle status word, or by the power
+	// level on older firmware
 	if len(parts) > 9 {
-		if power, err := strconv.ParseUint(parts[9], 10, 8); err == nil {
+		if status, ok := parseStatusWord(parts[9]); ok {
+			decodeStatusBits(status, result)
+		} else if power, err := strconv.ParseUint(parts[9], 10, 8); err == nil {
 			result.PowerLevel = uint8(power)
 			result.Status["powerLevel"] = result.PowerLevel
 		}
@@ -204,6 +299,19 @@ func (d *Decoder) decodeStatusReport(parts []string) (*H02Data, error) {
 	return result, nil
 }
 
+// decodeCommandReply reads the device's answer to an instruction, which
+// echoes the instruction and its parameters after the device ID
+func (d *Decoder) decodeCommandReply(parts []string) (*H02Data, error) {
+	if len(parts) < 2 || parts[1] == "" {
+		return nil, fmt.Errorf("%w: command reply requires the instruction", ErrInvalidFormat)
+	}
+
+	return &H02Data{
+		Reply:  strings.Join(parts[1:], ","),
+		Status: make(map[string]interface{}),
+	}, nil
+}
+
 func (d *Decoder) decodeAlarmReport(parts []string) (*H02Data, error) {
 	// First parse location data
 	result, err := d.decodeInfoReport(parts)
@@ -211,9 +319,13 @@ func (d *Decoder) decodeAlarmReport(parts []string) (*H02Data, error) {
 		return nil, err
 	}
 
-	// Parse alarm type (last field)
+	// Parse alarm type (last field). Reports ending in the status word
+	// carry their alarm in its bits instead.
 	if len(parts) > 0 {
 		alarmCode := parts[len(parts)-1]
+		if _, ok := parseStatusWord(alarmCode); ok {
+			return result, nil
+		}
 		d.logDebug("Alarm code: %s", alarmCode)
 
 		switch alarmCode {
@@ -236,23 +348,35 @@ func (d *Decoder) decodeAlarmReport(parts []string) (*H02Data, error) {
 	return result, nil
 }
 
+// parseCoordinate converts DDMM.MMMM or DDDMM.MMMM to decimal degrees. The
+// digits are read as integers, since taking the degrees off a float leaves
+// minutes such as 37.751399999999 behind.
 func (d *Decoder) parseCoordinate(coord, dir string) (float64, error) {
-	val, err := strconv.ParseFloat(coord, 64)
+	whole, fraction, _ := strings.Cut(coord, ".")
+	if whole == "" || len(fraction) > 9 || !isDigits(whole) || !isDigits(fraction) {
+		return 0, fmt.Errorf("%w: invalid format", ErrInvalidCoordinate)
+	}
+	value, err := strconv.Atoi(whole)
 	if err != nil {
 		return 0, fmt.Errorf("%w: invalid format", ErrInvalidCoordinate)
 	}
 
-	// Extract degrees and minutes
-	degrees := float64(int(val / 100))
-	minutes := val - (degrees * 100)
+	// Minutes are counted in units of the last fraction digit
+	scale, part := 1, 0
+	for _, digit := range fraction {
+		scale *= 10
+		part = part*10 + int(digit-'0')
+	}
+	degrees := value / 100
+	minutes := value%100*scale + part
 
 	// Validate minutes
-	if minutes >= 60 {
+	if minutes >= 60*scale {
 		return 0, fmt.Errorf("%w: invalid minutes value", ErrInvalidCoordinate)
 	}
 
 	// Convert to decimal degrees
-	result := degrees + (minutes / 60.0)
+	result := util.RoundCoordinate(float64(degrees) + float64(minutes)/float64(60*scale))
 
 	// Apply direction and validate range
 	if dir == "S" || dir == "W" {
@@ -270,6 +394,39 @@ func (d *Decoder) parseCoordinate(coord, dir string) (float64, error) {
 	return result, nil
 }
 
+// parseDateTime combines HHMMSS and DDMMYY fields into a UTC timestamp
+func (d *Decoder) parseDateTime(clock, date string) (time.Time, error) {
+	day, err := d.parseTimestamp(date)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: %v", ErrInvalidFormat, err)
+	}
+	if !isTimeField(clock) {
+		return time.Time{}, fmt.Errorf("%w: invalid time %s", ErrInvalidFormat, clock)
+	}
+
+	hour, _ := strconv.Atoi(clock[0:2])
+	minute, _ := strconv.Atoi(clock[2:4])
+	second, _ := strconv.Atoi(clock[4:6])
+	if hour > 23 || minute > 59 || second > 59 {
+		return time.Time{}, fmt.Errorf("%w: invalid time %s", ErrInvalidFormat, clock)
+	}
+	return day.Add(time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute + time.Duration(second)*time.Second), nil
+}
+
+// isTimeField reports whether a field has the HHMMSS shape
+func isTimeField(field string) bool {
+	return len(field) == 6 && isDigits(field)
+}
+
+func isDigits(field string) bool {
+	for _, c := range field {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
 func (d *Decoder) parseTimestamp(date string) (time.Time, error) {
 	if len(date) != 6 {
 		return time.Time{}, fmt.Errorf("invalid date format: %s", date)
@@ -307,14 +464,17 @@ type H02Data struct {
 	PowerLevel uint8
 	GSMSignal  uint8
 	Alarm      string
+	Reply      string // Set for command replies, which carry no position
 	Status     map[string]interface{}
+	Warnings   []model.DecodeWarning // Fields filled in while parsing
 }
 
 func (d *Decoder) ToPosition(deviceID string, data *H02Data) *model.Position {
 	position := model.NewPosition(deviceID, data.Latitude, data.Longitude)
 	position.Speed = data.Speed
 	position.Course = data.Course
-	position.Timestamp = data.Timestamp
+	position.Warnings = append(position.Warnings, data.Warnings...)
+	position.SetDecodedTime(data.Timestamp, d.clock.Now())
 	position.Protocol = "h02"
 
 	// Add status information
@@ -1,9 +1,16 @@
 package h02
 
 import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
 	"strings"
 	"testing"
+	"testing/quick"
 	"time"
+	"tracking/internal/core/util"
 )
 
 func TestH02Decoder(t *testing.T) {
@@ -47,6 +54,56 @@ func TestH02Decoder(t *testing.T) {
 			},
 			wantErr: nil,
 		},
+		{
+			name: "info report with time of day",
+			data: []byte("*HQ,4210051415,V1,121513,A,2237.7514,N,11408.6214,E,6,2,151022,FFFFFBFF#"),
+			want: &H02Data{
+				Valid:     true,
+				Latitude:  22.62919,
+				Longitude: 114.14369,
+				Speed:     11.112,
+				Course:    2.0,
+				Timestamp: time.Date(2022, 10, 15, 12, 15, 13, 0, time.UTC),
+			},
+		},
+		{
+			name: "type first report with time of day",
+			data: []byte("*HQ,V1,123456789012345,235959,A,2237.7514,N,11408.6214,E,6,2,151022,10#"),
+			want: &H02Data{
+				Valid:      true,
+				Latitude:   22.62919,
+				Longitude:  114.14369,
+				Speed:      11.112,
+				Course:     2.0,
+				Timestamp:  time.Date(2022, 10, 15, 23, 59, 59, 0, time.UTC),
+				PowerLevel: 10,
+			},
+		},
+		{
+			name: "alarm report with time of day",
+			data: []byte("*HQ,4210051415,V2,080102,A,2237.7514,N,11408.6214,E,6,2,151022,0#"),
+			want: &H02Data{
+				Valid:     true,
+				Latitude:  22.62919,
+				Longitude: 114.14369,
+				Speed:     11.112,
+				Course:    2.0,
+				Timestamp: time.Date(2022, 10, 15, 8, 1, 2, 0, time.UTC),
+				Alarm:     "sos",
+			},
+		},
+		{
+			// Stamped on receipt rather than at midnight of the date
+			name: "invalid time of day",
+			data: []byte("*HQ,4210051415,V1,246000,A,2237.7514,N,11408.6214,E,6,2,151022,FFFFFBFF#"),
+			want: &H02Data{
+				Valid:     true,
+				Latitude:  22.62919,
+				Longitude: 114.14369,
+				Speed:     11.112,
+				Course:    2.0,
+			},
+		},
 		{
 			name: "valid status report",
 			data: []byte("*HQ,V3,123456789012345,45,5,CE#"),
@@ -173,3 +230,292 @@ func almostEqual(a, b, epsilon float64) bool {
 	}
 	return diff < epsilon
 }
+
+func TestBinaryFormat(t *testing.T) {
+	frame := func(flags byte, status ...byte) []byte {
+		return append([]byte{
+			'$',
+			0x42, 0x10, 0x05, 0x14, 0x15, // ID
+			0x12, 0x15, 0x13, // 12:15:13
+			0x15, 0x10, 0x22, // 15/10/22
+			0x22, 0x37, 0x75, 0x14, // 2237.7514
+			0x64,                                 // Power
+			0x11, 0x40, 0x86, 0x21, 0x40 | flags, // 11408.6214 + flags
+			0x00, 0x60, 0x02, // 6 knots, course 2
+		}, status...)
+	}
+
+	badDigit := frame(0x0E, 0xFF, 0xFF, 0xFB, 0xFF)
+	badDigit[7] = 0x1A // Minute digit out of range
+
+	tests := []struct {
+		name    string
+		data    []byte
+		want    *H02Data
+		status  map[string]interface{}
+		wantErr error
+	}{
+		{
+			name: "valid north-east report with ACC on",
+			data: frame(0x0E, 0xFF, 0xFF, 0xFB, 0xFF),
+			want: &H02Data{
+				Valid:      true,
+				Latitude:   22.62919,
+				Longitude:  114.14369,
+				Speed:      11.112,
+				Course:     2.0,
+				Timestamp:  time.Date(2022, 10, 15, 12, 15, 13, 0, time.UTC),
+				PowerLevel: 100,
+			},
+			status: map[string]interface{}{
+				"powerLevel": uint8(100), "acc": true, "armed": false, "door": false,
+				"fuelCut": false, "backupBattery": false,
+			},
+		},
+		{
+			name: "invalid south-west fix with SOS and fuel cut",
+			data: append(frame(0x00, 0xF7, 0xFB, 0xFF, 0xFF), 0x01), // Trailing record number
+			want: &H02Data{
+				Latitude:   -22.62919,
+				Longitude:  -114.14369,
+				Speed:      11.112,
+				Course:     2.0,
+				Timestamp:  time.Date(2022, 10, 15, 12, 15, 13, 0, time.UTC),
+				PowerLevel: 100,
+				Alarm:      "sos",
+			},
+			status: map[string]interface{}{
+				"powerLevel": uint8(100), "acc": false, "armed": false, "door": false,
+				"fuelCut": true, "backupBattery": false, "alarm": "sos",
+			},
+		},
+		{
+			name:    "truncated frame",
+			data:    frame(0x0E, 0xFF, 0xFF),
+			wantErr: ErrPacketTooShort,
+		},
+		{
+			name:    "invalid BCD digit",
+			data:    badDigit,
+			wantErr: ErrMalformedPacket,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewDecoder().Decode(tt.data)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Decode() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Decode() unexpected error: %v", err)
+			}
+
+			compareH02Data(t, got, tt.want)
+			if !reflect.DeepEqual(got.Status, tt.status) {
+				t.Errorf("Status = %v, want %v", got.Status, tt.status)
+			}
+		})
+	}
+
+	id, err := BinaryDeviceID(frame(0x0E, 0xFF, 0xFF, 0xFB, 0xFF))
+	if err != nil || id != "4210051415" {
+		t.Errorf("BinaryDeviceID() = %q, %v, want 4210051415", id, err)
+	}
+}
+
+func TestEncodeCommand(t *testing.T) {
+	decoder := NewDecoder()
+	decoder.SetClock(util.NewFixedClock(time.Date(2022, 10, 15, 13, 3, 5, 0, time.UTC)))
+
+	tests := []struct {
+		command Command
+		want    string
+	}{
+		{CommandEngineStop, "*HQ,4210051415,S20,130305,1,1#"},
+		{CommandEngineResume, "*HQ,4210051415,S20,130305,0,0#"},
+		{CommandLocate, "*HQ,4210051415,R1,130305#"},
+		{CommandReboot, "*HQ,4210051415,R7,130305#"},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.command), func(t *testing.T) {
+			packet, err := decoder.EncodeCommand("4210051415", tt.command)
+			if err != nil {
+				t.Fatalf("EncodeCommand() unexpected error: %v", err)
+			}
+			if string(packet) != tt.want {
+				t.Errorf("EncodeCommand() = %s, want %s", packet, tt.want)
+			}
+		})
+	}
+
+	if _, err := decoder.EncodeCommand("4210051415", CommandSetInterval); !errors.Is(err, ErrUnsupportedCommand) {
+		t.Errorf("EncodeCommand(setInterval) error = %v, want %v", err, ErrUnsupportedCommand)
+	}
+	if _, err := decoder.EncodeCommand("", CommandReboot); !errors.Is(err, ErrUnsupportedCommand) {
+		t.Errorf("EncodeCommand() without an ID error = %v, want %v", err, ErrUnsupportedCommand)
+	}
+
+	packet, err := decoder.EncodeIntervalCommand("4210051415", 30*time.Second)
+	if err != nil || string(packet) != "*HQ,4210051415,S71,130305,22,30#" {
+		t.Errorf("EncodeIntervalCommand(30s) = %s, %v", packet, err)
+	}
+	for _, interval := range []time.Duration{time.Second, 12500 * time.Millisecond, 24 * time.Hour} {
+		if _, err := decoder.EncodeIntervalCommand("4210051415", interval); !errors.Is(err, ErrUnsupportedCommand) {
+			t.Errorf("EncodeIntervalCommand(%v) error = %v, want %v", interval, err, ErrUnsupportedCommand)
+		}
+	}
+}
+
+func TestCommandReply(t *testing.T) {
+	got, err := NewDecoder().Decode([]byte("*HQ,V4,4210051415,S20,130305,1,1#"))
+	if err != nil {
+		t.Fatalf("Decode() unexpected error: %v", err)
+	}
+	if got.Reply != "S20,130305,1,1" {
+		t.Errorf("Reply = %q, want S20,130305,1,1", got.Reply)
+	}
+
+	if _, err := NewDecoder().Decode([]byte("*HQ,V4,123456789012345,#")); !errors.Is(err, ErrInvalidFormat) {
+		t.Errorf("Decode() of an empty reply error = %v, want %v", err, ErrInvalidFormat)
+	}
+}
+
+func TestSplitFrames(t *testing.T) {
+	first := "*HQ,4210051415,V1,121513,A,2237.7514,N,11408.6214,E,6,2,151022,FFFFFBFF#"
+	second := "*HQ,4210051415,V1,121613,A,2237.7514,N,11408.6214,E,6,2,151022,FFFFFBFF#"
+	frames := SplitFrames([]byte(first + "\r\n" + second + "*HQ,4210"))
+	if len(frames) != 3 || string(frames[0]) != first || string(frames[1]) != second || string(frames[2]) != "*HQ,4210" {
+		t.Errorf("SplitFrames() = %q", frames)
+	}
+
+	binary := []byte{'$', 0x42, 0x10, 0x05, 0x14, 0x15, '#'}
+	if frames := SplitFrames(binary); len(frames) != 1 || len(frames[0]) != len(binary) {
+		t.Errorf("SplitFrames() split a binary frame into %q", frames)
+	}
+}
+
+func TestDeviceID(t *testing.T) {
+	tests := []struct {
+		data string
+		want string
+	}{
+		{"*HQ,4210051415,V1,121513,A,2237.7514,N,11408.6214,E,6,2,151022,FFFFFBFF#", "4210051415"},
+		{"*HQ,V1,123456789012345,A,2237.7514,N,11408.6214,E,6,2,151022,10,1,6#", "123456789012345"},
+		{"*HQ,V4,4210051415,S20,130305,1,1#", "4210051415"},
+	}
+
+	for _, tt := range tests {
+		if got, err := DeviceID([]byte(tt.data)); err != nil || got != tt.want {
+			t.Errorf("DeviceID(%s) = %q, %v, want %s", tt.data, got, err, tt.want)
+		}
+	}
+	if _, err := DeviceID([]byte("*XX,4210051415,V1#")); !errors.Is(err, ErrInvalidHeader) {
+		t.Errorf("DeviceID() error = %v, want %v", err, ErrInvalidHeader)
+	}
+}
+
+func TestStatusWord(t *testing.T) {
+	states := func(acc, armed, door, fuelCut bool) map[string]interface{} {
+		return map[string]interface{}{
+			"acc":           acc,
+			"armed":         armed,
+			"door":          door,
+			"fuelCut":       fuelCut,
+			"backupBattery": false,
+		}
+	}
+
+	tests := []struct {
+		name   string
+		status string
+		want   map[string]interface{}
+		alarm  string
+	}{
+		{"ACC on", "FFFFFBFF", states(true, false, false, false), ""},
+		{"armed with fuel cut", "F7FFF9FF", states(true, true, false, true), ""},
+		{"door open", "FFFFFEFF", states(false, false, true, false), ""},
+		{"SOS", "FFFBFFFF", states(false, false, false, false), "sos"},
+		{"overspeed", "fffffffb", states(false, false, false, false), "overspeed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := "*HQ,4210051415,V1,121513,A,2237.7514,N,11408.6214,E,6,2,151022," + tt.status + "#"
+			got, err := NewDecoder().Decode([]byte(data))
+			if err != nil {
+				t.Fatalf("Decode() unexpected error: %v", err)
+			}
+
+			if tt.alarm != "" {
+				tt.want["alarm"] = tt.alarm
+			}
+			if !reflect.DeepEqual(got.Status, tt.want) {
+				t.Errorf("Status = %v, want %v", got.Status, tt.want)
+			}
+			if got.Alarm != tt.alarm {
+				t.Errorf("Alarm = %q, want %q", got.Alarm, tt.alarm)
+			}
+		})
+	}
+
+	// Older firmware sends the power level in the same place
+	got, err := NewDecoder().Decode([]byte("*HQ,V1,123456789012345,A,2237.7514,N,11408.6214,E,6,2,151022,10,1,6#"))
+	if err != nil {
+		t.Fatalf("Decode() unexpected error: %v", err)
+	}
+	if got.PowerLevel != 10 || got.Status["acc"] != nil {
+		t.Errorf("Legacy report power = %d, status = %v", got.PowerLevel, got.Status)
+	}
+}
+
+// TestCoordinateRoundTrip formats random coordinates the way devices do and
+// checks that parsing keeps every minute digit and no float artifacts, by
+// formatting the result again
+func TestCoordinateRoundTrip(t *testing.T) {
+	decoder := NewDecoder()
+	layouts := []struct {
+		format string
+		max    int // Degrees
+		dirs   [2]string
+	}{
+		{"%02d%02d.%04d", 89, [2]string{"N", "S"}},
+		{"%03d%02d.%04d", 179, [2]string{"E", "W"}},
+	}
+	for _, layout := range layouts {
+		property := func(d, m uint32, negative bool) bool {
+			degrees, minutes := int(d)%(layout.max+1), int(m)%600000
+			field := fmt.Sprintf(layout.format, degrees, minutes/10000, minutes%10000)
+			dir := layout.dirs[0]
+			if negative {
+				dir = layout.dirs[1]
+			}
+			value, err := decoder.parseCoordinate(field, dir)
+			if err != nil {
+				t.Logf("%s%s: %v", field, dir, err)
+				return false
+			}
+			if (value < 0) != (negative && value != 0) {
+				return false
+			}
+			value = math.Abs(value)
+			whole := int(value)
+			again := int(math.Round((value - float64(whole)) * 600000))
+			_, fraction, _ := strings.Cut(strconv.FormatFloat(value, 'f', -1, 64), ".")
+			return fmt.Sprintf(layout.format, whole, again/10000, again%10000) == field && len(fraction) <= util.CoordinatePrecision
+		}
+		if err := quick.Check(property, &quick.Config{MaxCount: 5000}); err != nil {
+			t.Errorf("%s: %v", layout.dirs, err)
+		}
+	}
+
+	for _, field := range []string{"", "22.37.75", "2237,7514", "-2237.7514", "2260.0000", "1e3"} {
+		if _, err := decoder.parseCoordinate(field, "N"); !errors.Is(err, ErrInvalidCoordinate) {
+			t.Errorf("parseCoordinate(%q) error = %v, want ErrInvalidCoordinate", field, err)
+		}
+	}
+}
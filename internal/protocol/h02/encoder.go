@@ -0,0 +1,74 @@
+package h02
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Command is a remote-control action the server can send to a device. The
+// names match the GT06 commands so device profiles list them the same way.
+type Command string
+
+// Supported commands
+const (
+	CommandEngineStop   Command = "engineStop"
+	CommandEngineResume Command = "engineResume"
+	CommandLocate       Command = "locate"
+	CommandReboot       Command = "reboot"
+	CommandSetInterval  Command = "setInterval" // Sent with EncodeIntervalCommand
+)
+
+// commandText maps each command to its H02 instruction and parameters. The
+// instruction time is inserted by the encoder.
+var commandText = map[Command]string{
+	CommandEngineStop:   "S20,%s,1,1", // Cut fuel and power
+	CommandEngineResume: "S20,%s,0,0",
+	CommandLocate:       "R1,%s",
+	CommandReboot:       "R7,%s",
+}
+
+// Report interval limits accepted by S71
+const (
+	minReportInterval = 10 * time.Second
+	maxReportInterval = 65535 * time.Second
+)
+
+// ErrUnsupportedCommand is returned for commands without an H02 encoding
+var ErrUnsupportedCommand = errors.New("unsupported command")
+
+// EncodeCommand builds the instruction for one of the supported commands,
+// such as *HQ,4210051415,S20,130305,1,1# to cut fuel. uniqueID is the
+// identifier the device reports with.
+func (d *Decoder) EncodeCommand(uniqueID string, command Command) ([]byte, error) {
+	text, ok := commandText[command]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedCommand, command)
+	}
+	return d.encode(uniqueID, fmt.Sprintf(text, d.instructionTime()))
+}
+
+// EncodeIntervalCommand builds an S71 instruction setting how often the
+// device reports its position while moving
+func (d *Decoder) EncodeIntervalCommand(uniqueID string, interval time.Duration) ([]byte, error) {
+	if interval < minReportInterval || interval > maxReportInterval || interval%time.Second != 0 {
+		return nil, fmt.Errorf("%w: interval must be whole seconds from %v to %v, got %v",
+			ErrUnsupportedCommand, minReportInterval, maxReportInterval, interval)
+	}
+	return d.encode(uniqueID, fmt.Sprintf("S71,%s,22,%d", d.instructionTime(), int(interval/time.Second)))
+}
+
+func (d *Decoder) encode(uniqueID, instruction string) ([]byte, error) {
+	if uniqueID == "" {
+		return nil, fmt.Errorf("%w: missing device identifier", ErrUnsupportedCommand)
+	}
+
+	packet := []byte(fmt.Sprintf("%s,%s,%s#", startSequence, uniqueID, instruction))
+	d.logPacket(packet, "Command")
+	return packet, nil
+}
+
+// instructionTime is the HHMMSS stamp devices expect on every instruction
+func (d *Decoder) instructionTime() string {
+	return d.clock.Now().UTC().Format("150405")
+}
@@ -0,0 +1,57 @@
+package h02
+
+import (
+	"strconv"
+)
+
+// Vehicle status bits. H02 status words are active low: a cleared bit means
+// the condition holds.
+const (
+	statusTheftAlarm     = 0
+	statusRobberyAlarm   = 1
+	statusOverspeedAlarm = 2
+	statusDoorOpen       = 8
+	statusArmed          = 9
+	statusACC            = 10
+	statusSOSAlarm       = 18
+	statusBackupBattery  = 19
+	statusFuelCut        = 27
+)
+
+// statusActive reports whether an active-low status bit is set
+func statusActive(status uint32, bit uint) bool {
+	return status&(1<<bit) == 0
+}
+
+// parseStatusWord reads the 8 hex digit status field of ASCII reports
+func parseStatusWord(field string) (uint32, bool) {
+	if len(field) != 8 {
+		return 0, false
+	}
+	status, err := strconv.ParseUint(field, 16, 32)
+	return uint32(status), err == nil
+}
+
+// decodeStatusBits stores the named vehicle states of a status word and
+// raises the most severe alarm it reports
+func decodeStatusBits(status uint32, result *H02Data) {
+	result.Status["acc"] = statusActive(status, statusACC)
+	result.Status["armed"] = statusActive(status, statusArmed)
+	result.Status["door"] = statusActive(status, statusDoorOpen)
+	result.Status["fuelCut"] = statusActive(status, statusFuelCut)
+	result.Status["backupBattery"] = statusActive(status, statusBackupBattery)
+
+	switch {
+	case statusActive(status, statusSOSAlarm):
+		result.Alarm = "sos"
+	case statusActive(status, statusRobberyAlarm):
+		result.Alarm = "robbery"
+	case statusActive(status, statusTheftAlarm):
+		result.Alarm = "theft"
+	case statusActive(status, statusOverspeedAlarm):
+		result.Alarm = "overspeed"
+	default:
+		return
+	}
+	result.Status["alarm"] = result.Alarm
+}
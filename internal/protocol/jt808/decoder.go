@@ -0,0 +1,390 @@
+// Package jt808 implements the parts of the JT/T 808 protocol used to
+// upload media: message framing, sub-packet reassembly and the multimedia
+// data upload (0x0801) with its response (0x8800).
+package jt808
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+	"tracking/internal/core/util"
+)
+
+// Common JT808 errors
+var (
+	ErrInvalidFrame    = errors.New("invalid JT808 frame")
+	ErrInvalidChecksum = errors.New("invalid JT808 checksum")
+	ErrInvalidBody     = errors.New("invalid JT808 message body")
+	ErrIncomplete      = errors.New("incomplete JT808 sub-packets")
+)
+
+// Messages are framed as
+//
+//	7E <header> <body> <checksum> 7E
+//
+// with 7E and 7D escaped inside as 7D 02 and 7D 01 and the checksum the XOR
+// of header and body. The header holds the message ID, a properties word
+// (body length in bits 0-9, sub-packets in bit 13, the 2019 layout in bit
+// 14), an optional version byte, the terminal phone number in BCD (6 bytes,
+// 10 in the 2019 layout) and a serial, followed for sub-packets by their
+// total and 1-based index.
+const (
+	frameFlag   = 0x7E
+	escapeFlag  = 0x7D
+	escapedFlag = 0x02 // 7D 02 stands for 7E
+	escapedSelf = 0x01 // 7D 01 stands for 7D
+
+	MsgMultimediaUpload   = 0x0801
+	MsgMultimediaResponse = 0x8800
+
+	propertyLengthMask = 0x03FF
+	propertySubpackets = 1 << 13
+	propertyVersion    = 1 << 14
+
+	multimediaHeaderLength = 8 + locationLength
+	locationLength         = 28
+)
+
+// Media types of a multimedia upload
+var mediaTypes = map[byte]string{
+	0: "image",
+	1: "audio",
+	2: "video",
+}
+
+// Media formats of a multimedia upload, as MIME types
+var mediaFormats = map[byte]string{
+	0: "image/jpeg",
+	1: "image/tiff",
+	2: "audio/mpeg",
+	3: "audio/wav",
+	4: "video/x-ms-wmv",
+}
+
+// What made the terminal capture the media
+var mediaEvents = map[byte]string{
+	0: "command",
+	1: "timer",
+	2: "robbery",
+	3: "collision",
+	4: "doorOpen",
+	5: "doorClose",
+	6: "doorSpeed",
+	7: "distance",
+}
+
+// Frame is one unescaped message
+type Frame struct {
+	MessageID uint16
+	Phone     string // Terminal phone number, which identifies the device
+	Serial    uint16
+	Total     uint16 // Sub-packet count, zero when the message is whole
+	Index     uint16 // 1-based sub-packet index
+	Version   bool   // Whether the 2019 header layout is used
+	Body      []byte
+}
+
+// Location is the basic location information embedded in reports and
+// media uploads
+type Location struct {
+	Alarm     uint32
+	Status    uint32
+	Latitude  float64
+	Longitude float64
+	Altitude  float64
+	Speed     float64 // km/h
+	Course    float64
+	Valid     bool
+	Timestamp time.Time
+}
+
+// Multimedia is an assembled multimedia data upload
+type Multimedia struct {
+	Phone       string
+	Serial      uint16 // Serial of the first packet
+	MediaID     uint32
+	Type        string // image, audio or video
+	ContentType string
+	Event       string // What triggered the capture
+	Channel     byte
+	Location    *Location
+	Data        []byte
+}
+
+type Decoder struct {
+	debug bool
+	clock util.Clock
+}
+
+func NewDecoder() *Decoder {
+	return &Decoder{
+		debug: false,
+		clock: util.SystemClock,
+	}
+}
+
+func (d *Decoder) EnableDebug(enable bool) {
+	d.debug = enable
+}
+
+// SetClock sets the clock used for locations without a usable time
+func (d *Decoder) SetClock(clock util.Clock) {
+	d.clock = clock
+}
+
+func (d *Decoder) logDebug(format string, v ...interface{}) {
+	if d.debug {
+		log.Printf("[JT808] "+format, v...)
+	}
+}
+
+// IsFrame reports whether data starts like a JT808 message
+func IsFrame(data []byte) bool {
+	return len(data) > 1 && data[0] == frameFlag && data[1] != frameFlag
+}
+
+// SplitFrames returns the frames delimited by 7E in data, still escaped
+func SplitFrames(data []byte) [][]byte {
+	var frames [][]byte
+	for {
+		start := bytes.IndexByte(data, frameFlag)
+		if start < 0 {
+			return frames
+		}
+		end := bytes.IndexByte(data[start+1:], frameFlag)
+		if end < 0 {
+			return frames
+		}
+		if end > 0 {
+			frames = append(frames, data[start:start+end+2])
+		}
+		data = data[start+end+2:]
+	}
+}
+
+// DecodeFrame unescapes one frame and checks its checksum and length
+func (d *Decoder) DecodeFrame(data []byte) (*Frame, error) {
+	if len(data) < 2 || data[0] != frameFlag || data[len(data)-1] != frameFlag {
+		return nil, fmt.Errorf("%w: missing 7E delimiters", ErrInvalidFrame)
+	}
+
+	content, err := unescape(data[1 : len(data)-1])
+	if err != nil {
+		return nil, err
+	}
+	if len(content) < 13 {
+		return nil, fmt.Errorf("%w: %d bytes", ErrInvalidFrame, len(content))
+	}
+
+	var checksum byte
+	for _, b := range content[:len(content)-1] {
+		checksum ^= b
+	}
+	if checksum != content[len(content)-1] {
+		return nil, fmt.Errorf("%w: got %02X, calculated %02X", ErrInvalidChecksum, content[len(content)-1], checksum)
+	}
+	content = content[:len(content)-1]
+
+	frame := &Frame{MessageID: binary.BigEndian.Uint16(content)}
+	properties := binary.BigEndian.Uint16(content[2:])
+	offset := 4
+	phoneLength := 6
+	if properties&propertyVersion != 0 {
+		frame.Version = true
+		offset++ // Protocol version
+		phoneLength = 10
+	}
+	headerLength := offset + phoneLength + 2
+	if properties&propertySubpackets != 0 {
+		headerLength += 4
+	}
+	if len(content) < headerLength {
+		return nil, fmt.Errorf("%w: truncated header", ErrInvalidFrame)
+	}
+
+	frame.Phone = trimBCD(content[offset : offset+phoneLength])
+	offset += phoneLength
+	frame.Serial = binary.BigEndian.Uint16(content[offset:])
+	offset += 2
+	if properties&propertySubpackets != 0 {
+		frame.Total = binary.BigEndian.Uint16(content[offset:])
+		frame.Index = binary.BigEndian.Uint16(content[offset+2:])
+		offset += 4
+		if frame.Total == 0 || frame.Index == 0 || frame.Index > frame.Total {
+			return nil, fmt.Errorf("%w: sub-packet %d of %d", ErrInvalidFrame, frame.Index, frame.Total)
+		}
+	}
+
+	frame.Body = content[offset:]
+	if length := int(properties & propertyLengthMask); length != len(frame.Body) {
+		return nil, fmt.Errorf("%w: body of %d bytes, header says %d", ErrInvalidFrame, len(frame.Body), length)
+	}
+
+	d.logDebug("Frame %04X from %s, serial %d, sub-packet %d/%d", frame.MessageID, frame.Phone, frame.Serial, frame.Index, frame.Total)
+	return frame, nil
+}
+
+// DecodeMultimedia decodes every frame in data and returns the multimedia
+// uploads they carry, joining sub-packets. Frames of other messages are
+// skipped; an upload missing sub-packets fails with ErrIncomplete.
+func (d *Decoder) DecodeMultimedia(data []byte) ([]*Multimedia, error) {
+	type upload struct {
+		first *Frame
+		parts map[uint16][]byte
+	}
+	var uploads []*upload
+	current := make(map[string]*upload) // By phone, while sub-packets arrive
+
+	for _, raw := range SplitFrames(data) {
+		frame, err := d.DecodeFrame(raw)
+		if err != nil {
+			return nil, err
+		}
+		if frame.MessageID != MsgMultimediaUpload {
+			d.logDebug("Skipping message %04X", frame.MessageID)
+			continue
+		}
+
+		if frame.Total == 0 {
+			uploads = append(uploads, &upload{first: frame, parts: map[uint16][]byte{1: frame.Body}})
+			delete(current, frame.Phone)
+			continue
+		}
+		u := current[frame.Phone]
+		if u == nil || frame.Index == 1 {
+			u = &upload{first: frame, parts: make(map[uint16][]byte)}
+			current[frame.Phone] = u
+			uploads = append(uploads, u)
+		}
+		u.parts[frame.Index] = frame.Body
+	}
+
+	result := make([]*Multimedia, 0, len(uploads))
+	for _, u := range uploads {
+		total := u.first.Total
+		if total == 0 {
+			total = 1
+		}
+		var body []byte
+		for i := uint16(1); i <= total; i++ {
+			part, ok := u.parts[i]
+			if !ok {
+				return nil, fmt.Errorf("%w: media from %s lacks packet %d of %d", ErrIncomplete, u.first.Phone, i, total)
+			}
+			body = append(body, part...)
+		}
+
+		media, err := d.decodeMultimediaBody(body)
+		if err != nil {
+			return nil, err
+		}
+		media.Phone = u.first.Phone
+		media.Serial = u.first.Serial
+		result = append(result, media)
+	}
+	return result, nil
+}
+
+// decodeMultimediaBody reads the media ID, type, format, event, channel
+// and location ahead of the media data
+func (d *Decoder) decodeMultimediaBody(body []byte) (*Multimedia, error) {
+	if len(body) < multimediaHeaderLength {
+		return nil, fmt.Errorf("%w: multimedia upload of %d bytes", ErrInvalidBody, len(body))
+	}
+
+	media := &Multimedia{
+		MediaID: binary.BigEndian.Uint32(body),
+		Type:    mediaTypes[body[4]],
+		Event:   mediaEvents[body[6]],
+		Channel: body[7],
+		Data:    body[multimediaHeaderLength:],
+	}
+	if media.Type == "" {
+		return nil, fmt.Errorf("%w: media type %d", ErrInvalidBody, body[4])
+	}
+	media.ContentType = mediaFormats[body[5]]
+	if media.ContentType == "" {
+		media.ContentType = "application/octet-stream"
+	}
+	if media.Event == "" {
+		media.Event = fmt.Sprintf("event%d", body[6])
+	}
+
+	location, err := d.decodeLocation(body[8:multimediaHeaderLength])
+	if err != nil {
+		return nil, err
+	}
+	media.Location = location
+	return media, nil
+}
+
+// decodeLocation reads the 28 byte basic location information
+func (d *Decoder) decodeLocation(data []byte) (*Location, error) {
+	location := &Location{
+		Alarm:    binary.BigEndian.Uint32(data),
+		Status:   binary.BigEndian.Uint32(data[4:]),
+		Altitude: float64(int16(binary.BigEndian.Uint16(data[16:]))),
+		Speed:    float64(binary.BigEndian.Uint16(data[18:])) / 10,
+		Course:   float64(binary.BigEndian.Uint16(data[20:])),
+	}
+	location.Valid = location.Status&0x02 != 0
+	location.Latitude = float64(binary.BigEndian.Uint32(data[8:])) / 1e6
+	if location.Status&0x04 != 0 {
+		location.Latitude = -location.Latitude
+	}
+	location.Longitude = float64(binary.BigEndian.Uint32(data[12:])) / 1e6
+	if location.Status&0x08 != 0 {
+		location.Longitude = -location.Longitude
+	}
+	if location.Latitude < -90 || location.Latitude > 90 || location.Longitude < -180 || location.Longitude > 180 {
+		return nil, fmt.Errorf("%w: coordinates %f, %f", ErrInvalidBody, location.Latitude, location.Longitude)
+	}
+
+	// BCD YYMMDDhhmmss in Beijing time
+	timestamp, err := time.ParseInLocation("060102150405", fmt.Sprintf("%X", data[22:28]), beijing)
+	if err != nil {
+		d.logDebug("Unusable location time % X, using the clock", data[22:28])
+		timestamp = d.clock.Now()
+	}
+	location.Timestamp = timestamp.UTC()
+	return location, nil
+}
+
+// beijing is the UTC+8 zone JT808 terminals report time in
+var beijing = time.FixedZone("UTC+8", 8*60*60)
+
+func unescape(data []byte) ([]byte, error) {
+	out := make([]byte, 0, len(data))
+	for i := 0; i < len(data); i++ {
+		if data[i] != escapeFlag {
+			out = append(out, data[i])
+			continue
+		}
+		if i+1 == len(data) {
+			return nil, fmt.Errorf("%w: dangling escape", ErrInvalidFrame)
+		}
+		i++
+		switch data[i] {
+		case escapedFlag:
+			out = append(out, frameFlag)
+		case escapedSelf:
+			out = append(out, escapeFlag)
+		default:
+			return nil, fmt.Errorf("%w: invalid escape 7D %02X", ErrInvalidFrame, data[i])
+		}
+	}
+	return out, nil
+}
+
+// trimBCD renders BCD bytes as digits without the leading zeros of phone
+// numbers padded to the field width
+func trimBCD(data []byte) string {
+	digits := fmt.Sprintf("%X", data)
+	for len(digits) > 1 && digits[0] == '0' {
+		digits = digits[1:]
+	}
+	return digits
+}
@@ -0,0 +1,147 @@
+package jt808
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+	"time"
+)
+
+// testLocation is a valid fix in Shenzhen at 2024-01-15 18:00:00 Beijing
+// time, 60.5 km/h heading east
+var testLocation = []byte{
+	0x00, 0x00, 0x00, 0x00, // Alarm
+	0x00, 0x00, 0x00, 0x02, // Status: valid fix
+	0x01, 0x57, 0xFA, 0xF8, // Latitude 22.543096
+	0x06, 0xCC, 0x75, 0x89, // Longitude 114.062729
+	0x00, 0x32, // Altitude 50 m
+	0x02, 0x5D, // Speed 60.5 km/h
+	0x00, 0x5A, // Course 90
+	0x24, 0x01, 0x15, 0x18, 0x00, 0x00,
+}
+
+func multimediaBody(id uint32, mediaType, format, event, channel byte, data []byte) []byte {
+	body := binary.BigEndian.AppendUint32(nil, id)
+	body = append(body, mediaType, format, event, channel)
+	body = append(body, testLocation...)
+	return append(body, data...)
+}
+
+func mustEncode(t *testing.T, frame *Frame) []byte {
+	t.Helper()
+	data, err := Encode(frame)
+	if err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+	return data
+}
+
+func TestDecodeFrame(t *testing.T) {
+	decoder := NewDecoder()
+
+	// Flag bytes in the body must survive escaping
+	body := []byte{0x7E, 0x01, 0x7D, 0x02}
+	data := mustEncode(t, &Frame{MessageID: 0x0200, Phone: "13800138000", Serial: 7, Body: body})
+	if bytes.Count(data, []byte{frameFlag}) != 2 {
+		t.Fatalf("Encode() = % X, want flags escaped", data)
+	}
+	frame, err := decoder.DecodeFrame(data)
+	if err != nil {
+		t.Fatalf("DecodeFrame() error = %v", err)
+	}
+	if frame.MessageID != 0x0200 || frame.Phone != "13800138000" || frame.Serial != 7 || frame.Version || !bytes.Equal(frame.Body, body) {
+		t.Errorf("DecodeFrame() = %+v", frame)
+	}
+
+	// The 2019 layout has a version byte and a 10 byte phone number
+	data = mustEncode(t, &Frame{MessageID: 0x0801, Phone: "13800138000", Serial: 8, Total: 3, Index: 2, Version: true, Body: body})
+	frame, err = decoder.DecodeFrame(data)
+	if err != nil {
+		t.Fatalf("DecodeFrame() error = %v", err)
+	}
+	if !frame.Version || frame.Phone != "13800138000" || frame.Total != 3 || frame.Index != 2 || !bytes.Equal(frame.Body, body) {
+		t.Errorf("DecodeFrame() = %+v", frame)
+	}
+
+	corrupt := append([]byte(nil), data...)
+	corrupt[len(corrupt)-2] ^= 0xFF
+	for _, tt := range []struct {
+		name    string
+		data    []byte
+		wantErr error
+	}{
+		{"bad checksum", corrupt, ErrInvalidChecksum},
+		{"no delimiters", data[1:], ErrInvalidFrame},
+		{"short", []byte{0x7E, 0x02, 0x00, 0x7E}, ErrInvalidFrame},
+		{"bad escape", []byte{0x7E, 0x7D, 0x05, 0x7E}, ErrInvalidFrame},
+	} {
+		if _, err := decoder.DecodeFrame(tt.data); !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: DecodeFrame() error = %v, want %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestDecodeMultimedia(t *testing.T) {
+	decoder := NewDecoder()
+	content := bytes.Repeat([]byte{0xFF, 0xD8, 0x7E, 0x7D}, 100)
+	body := multimediaBody(42, 0, 0, 3, 2, content)
+	half := len(body) / 2
+
+	var stream []byte
+	stream = append(stream, mustEncode(t, &Frame{MessageID: 0x0002, Phone: "13800138000", Serial: 1})...)
+	stream = append(stream, mustEncode(t, &Frame{MessageID: MsgMultimediaUpload, Phone: "13800138000", Serial: 2, Total: 2, Index: 1, Body: body[:half]})...)
+	stream = append(stream, mustEncode(t, &Frame{MessageID: MsgMultimediaUpload, Phone: "13800138000", Serial: 3, Total: 2, Index: 2, Body: body[half:]})...)
+	stream = append(stream, mustEncode(t, &Frame{MessageID: MsgMultimediaUpload, Phone: "13800138000", Serial: 4, Body: multimediaBody(43, 2, 4, 1, 1, []byte{1, 2, 3})})...)
+
+	uploads, err := decoder.DecodeMultimedia(stream)
+	if err != nil {
+		t.Fatalf("DecodeMultimedia() error = %v", err)
+	}
+	if len(uploads) != 2 {
+		t.Fatalf("DecodeMultimedia() returned %d uploads, want 2", len(uploads))
+	}
+
+	got := uploads[0]
+	if got.Phone != "13800138000" || got.Serial != 2 || got.MediaID != 42 || got.Type != "image" ||
+		got.ContentType != "image/jpeg" || got.Event != "collision" || got.Channel != 2 || !bytes.Equal(got.Data, content) {
+		t.Errorf("DecodeMultimedia() = %+v", got)
+	}
+	location := got.Location
+	if !location.Valid || location.Latitude != 22.543096 || location.Longitude != 114.062729 ||
+		location.Altitude != 50 || location.Speed != 60.5 || location.Course != 90 {
+		t.Errorf("Location = %+v", location)
+	}
+	if want := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC); !location.Timestamp.Equal(want) {
+		t.Errorf("Timestamp = %v, want %v", location.Timestamp, want)
+	}
+
+	if got := uploads[1]; got.MediaID != 43 || got.Type != "video" || got.ContentType != "video/x-ms-wmv" || got.Event != "timer" {
+		t.Errorf("DecodeMultimedia() = %+v", got)
+	}
+
+	// A missing sub-packet fails the whole stream
+	partial := mustEncode(t, &Frame{MessageID: MsgMultimediaUpload, Phone: "13800138000", Serial: 2, Total: 2, Index: 1, Body: body[:half]})
+	if _, err := decoder.DecodeMultimedia(partial); !errors.Is(err, ErrIncomplete) {
+		t.Errorf("DecodeMultimedia() error = %v, want %v", err, ErrIncomplete)
+	}
+	short := mustEncode(t, &Frame{MessageID: MsgMultimediaUpload, Phone: "13800138000", Serial: 5, Body: body[:10]})
+	if _, err := decoder.DecodeMultimedia(short); !errors.Is(err, ErrInvalidBody) {
+		t.Errorf("DecodeMultimedia() error = %v, want %v", err, ErrInvalidBody)
+	}
+}
+
+func TestMultimediaResponse(t *testing.T) {
+	data, err := MultimediaResponse(&Multimedia{Phone: "13800138000", MediaID: 42}, false, 9)
+	if err != nil {
+		t.Fatalf("MultimediaResponse() error = %v", err)
+	}
+	frame, err := NewDecoder().DecodeFrame(data)
+	if err != nil {
+		t.Fatalf("DecodeFrame() error = %v", err)
+	}
+	if frame.MessageID != MsgMultimediaResponse || frame.Phone != "13800138000" || frame.Serial != 9 ||
+		!bytes.Equal(frame.Body, []byte{0, 0, 0, 42, 0}) {
+		t.Errorf("MultimediaResponse() = %+v", frame)
+	}
+}
@@ -0,0 +1,93 @@
+package jt808
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// Encode frames a message, splitting nothing: Total and Index are written
+// when Total is set
+func Encode(frame *Frame) ([]byte, error) {
+	if len(frame.Body) > propertyLengthMask {
+		return nil, fmt.Errorf("%w: body of %d bytes needs sub-packets", ErrInvalidBody, len(frame.Body))
+	}
+
+	phoneLength := 6
+	properties := uint16(len(frame.Body))
+	if frame.Version {
+		phoneLength = 10
+		properties |= propertyVersion
+	}
+	if frame.Total > 0 {
+		properties |= propertySubpackets
+	}
+	phone, err := encodeBCD(frame.Phone, phoneLength)
+	if err != nil {
+		return nil, err
+	}
+
+	content := binary.BigEndian.AppendUint16(nil, frame.MessageID)
+	content = binary.BigEndian.AppendUint16(content, properties)
+	if frame.Version {
+		content = append(content, 1) // Protocol version of the 2019 layout
+	}
+	content = append(content, phone...)
+	content = binary.BigEndian.AppendUint16(content, frame.Serial)
+	if frame.Total > 0 {
+		content = binary.BigEndian.AppendUint16(content, frame.Total)
+		content = binary.BigEndian.AppendUint16(content, frame.Index)
+	}
+	content = append(content, frame.Body...)
+
+	var checksum byte
+	for _, b := range content {
+		checksum ^= b
+	}
+	content = append(content, checksum)
+
+	out := []byte{frameFlag}
+	for _, b := range content {
+		switch b {
+		case frameFlag:
+			out = append(out, escapeFlag, escapedFlag)
+		case escapeFlag:
+			out = append(out, escapeFlag, escapedSelf)
+		default:
+			out = append(out, b)
+		}
+	}
+	return append(out, frameFlag), nil
+}
+
+// MultimediaResponse acknowledges a complete multimedia upload, asking for
+// no packets again
+func MultimediaResponse(media *Multimedia, version bool, serial uint16) ([]byte, error) {
+	body := binary.BigEndian.AppendUint32(nil, media.MediaID)
+	body = append(body, 0) // No packets to retransmit
+	return Encode(&Frame{
+		MessageID: MsgMultimediaResponse,
+		Phone:     media.Phone,
+		Serial:    serial,
+		Version:   version,
+		Body:      body,
+	})
+}
+
+// encodeBCD left pads a phone number with zeros to fill length bytes
+func encodeBCD(digits string, length int) ([]byte, error) {
+	if len(digits) > length*2 {
+		return nil, fmt.Errorf("%w: phone number %q too long", ErrInvalidBody, digits)
+	}
+	digits = strings.Repeat("0", length*2-len(digits)) + digits
+
+	out := make([]byte, length)
+	for i := 0; i < length; i++ {
+		hi, lo := digits[2*i]-'0', digits[2*i+1]-'0'
+		if hi > 9 || lo > 9 {
+			return nil, fmt.Errorf("%w: phone number %q is not numeric", ErrInvalidBody, digits)
+		}
+		out[i] = hi<<4 | lo
+	}
+	return out, nil
+}
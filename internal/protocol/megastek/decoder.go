@@ -0,0 +1,343 @@
+// Package megastek implements the ASCII $MGV protocol of the Megastek
+// MT90, MT100 and GVT vehicle trackers
+package megastek
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+	"tracking/internal/core/model"
+	"tracking/internal/core/util"
+)
+
+// Common Megastek errors
+var (
+	ErrInvalidHeader     = errors.New("invalid Megastek frame header")
+	ErrInvalidFormat     = errors.New("invalid Megastek data format")
+	ErrInvalidCoordinate = errors.New("invalid coordinate value")
+)
+
+// Reports are not answered and look like
+//
+//	$MGV002,860719020193193,DeviceName,R,240214,104742,A,2238.20471,N,11401.97967,E,08,10,00,1.20,0.462,356.23,137.9,1.5,460,07,262C,0F54,25,0110,0001,512,0,780,28.5,-3.2,,,100,Timer;!
+//
+// that is the IMEI, the device name, R for a real time or S for a stored
+// report, the UTC date DDMMYY and time hhmmss, validity, latitude and
+// longitude in degrees and minutes, satellites in use and in view, a
+// reserved field, HDOP, speed in km/h, course, altitude, odometer in km,
+// MCC, MNC, LAC and cell ID (the last two in hex), GSM signal, the digital
+// inputs and outputs as binary digits with input 1 first, three analog
+// inputs, two temperature sensors in degrees Celsius (empty when not
+// fitted), the RFID tag, a reserved field, battery level in percent and
+// the alert that triggered the report.
+const (
+	prefix    = "$MGV"
+	frameEnd  = ";!"
+	stored    = "S"
+	layout    = "020106150405"
+	minFields = 34 // Fields up to the battery level
+)
+
+// Sensor channels exposed in the status
+const (
+	analogInputs = 3
+	tempSensors  = 2
+)
+
+// alertAlarms maps report alerts to the alarm they raise
+var alertAlarms = map[string]string{
+	"sos":             "sos",
+	"help me":         "sos",
+	"low battery":     "lowBattery",
+	"main power lost": "powerCut",
+	"speed":           "overspeed",
+	"over speed":      "overspeed",
+	"geo-fence in":    "geofence",
+	"geo-fence out":   "geofence",
+	"move":            "movement",
+	"tow":             "tow",
+	"vibration":       "vibration",
+	"high temp":       "temperature",
+	"low temp":        "temperature",
+}
+
+type Decoder struct {
+	debug bool
+	clock util.Clock
+}
+
+func NewDecoder() *Decoder {
+	return &Decoder{
+		debug: false,
+		clock: util.SystemClock,
+	}
+}
+
+func (d *Decoder) EnableDebug(enable bool) {
+	d.debug = enable
+}
+
+// SetClock sets the clock used for reports without a usable time
+func (d *Decoder) SetClock(clock util.Clock) {
+	d.clock = clock
+}
+
+func (d *Decoder) logDebug(format string, v ...interface{}) {
+	if d.debug {
+		log.Printf("[Megastek] "+format, v...)
+	}
+}
+
+// MegastekData is one decoded report
+type MegastekData struct {
+	IMEI       string
+	Name       string
+	Latitude   float64
+	Longitude  float64
+	Altitude   float64
+	Speed      float64
+	Course     float64
+	Satellites int
+	Timestamp  time.Time
+	Valid      bool
+	Alarm      string
+	Cell       *model.CellTower
+	Status     map[string]interface{}
+}
+
+// IsFrame reports whether data is a $MGV report
+func IsFrame(data []byte) bool {
+	s := strings.TrimSpace(string(data))
+	if !strings.HasPrefix(s, prefix) || len(s) < len(prefix)+4 || s[len(prefix)+3] != ',' {
+		return false
+	}
+	for _, c := range s[len(prefix) : len(prefix)+3] {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// DeviceID returns the IMEI a report carries
+func DeviceID(data []byte) (string, error) {
+	fields, err := split(data)
+	if err != nil {
+		return "", err
+	}
+	return fields[1], nil
+}
+
+// split returns the fields of a report, the first being the $MGV tag
+func split(data []byte) ([]string, error) {
+	if !IsFrame(data) {
+		return nil, fmt.Errorf("%w: expected %s", ErrInvalidHeader, prefix)
+	}
+	s := strings.TrimSpace(string(data))
+	s = strings.TrimSuffix(s, frameEnd)
+	fields := strings.Split(s, ",")
+	if len(fields) < 2 || !isIMEI(fields[1]) {
+		return nil, fmt.Errorf("%w: no IMEI", ErrInvalidFormat)
+	}
+	return fields, nil
+}
+
+// Decode reads a report
+func (d *Decoder) Decode(data []byte) (*MegastekData, error) {
+	d.logDebug("Received %q", data)
+
+	fields, err := split(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) < minFields {
+		return nil, fmt.Errorf("%w: got %d fields, need at least %d", ErrInvalidFormat, len(fields), minFields)
+	}
+
+	record := &MegastekData{
+		IMEI:   fields[1],
+		Name:   fields[2],
+		Valid:  fields[6] == "A",
+		Status: make(map[string]interface{}),
+	}
+	if fields[3] == stored {
+		record.Status["buffered"] = true
+	}
+
+	if record.Latitude, err = parseCoordinate(fields[7], fields[8]); err != nil {
+		return nil, fmt.Errorf("invalid latitude: %w", err)
+	}
+	if record.Longitude, err = parseCoordinate(fields[9], fields[10]); err != nil {
+		return nil, fmt.Errorf("invalid longitude: %w", err)
+	}
+
+	if ts, err := time.Parse(layout, fields[4]+fields[5]); err == nil {
+		record.Timestamp = ts
+	} else {
+		d.logDebug("Failed to parse timestamp: %v", err)
+	}
+
+	record.Satellites, _ = strconv.Atoi(fields[11])
+	if visible, err := strconv.Atoi(fields[12]); err == nil {
+		record.Status["satellitesVisible"] = visible
+	}
+	if hdop, err := strconv.ParseFloat(fields[14], 64); err == nil {
+		record.Status["hdop"] = hdop
+	}
+	record.Speed, _ = strconv.ParseFloat(fields[15], 64)
+	record.Course, _ = strconv.ParseFloat(fields[16], 64)
+	record.Altitude, _ = strconv.ParseFloat(fields[17], 64)
+	if odometer, err := strconv.ParseFloat(fields[18], 64); err == nil {
+		record.Status["odometer"] = odometer * 1000 // Convert km to meters
+	}
+
+	mcc, err1 := strconv.Atoi(fields[19])
+	mnc, err2 := strconv.Atoi(fields[20])
+	lac, err3 := strconv.ParseInt(fields[21], 16, 32)
+	cell, err4 := strconv.ParseInt(fields[22], 16, 32)
+	if err1 == nil && err2 == nil && err3 == nil && err4 == nil && cell != 0 {
+		record.Cell = &model.CellTower{
+			MobileCountryCode: mcc,
+			MobileNetworkCode: mnc,
+			LocationAreaCode:  int(lac),
+			CellID:            int(cell),
+		}
+	}
+	if signal, err := strconv.Atoi(fields[23]); err == nil {
+		record.Status["gsmSignal"] = signal
+	}
+
+	d.decodeSensors(fields[24:31], record)
+	if fields[31] != "" {
+		record.Status["rfid"] = fields[31]
+	}
+	if battery, err := strconv.Atoi(fields[33]); err == nil {
+		record.Status["batteryLevel"] = battery
+	}
+	if len(fields) > 34 {
+		d.applyAlert(fields[34], record)
+	}
+	return record, nil
+}
+
+// decodeSensors reads the inputs, outputs, analog inputs and temperature
+// sensors. Each input and output is exposed as in1, out1 and so on, the
+// analog inputs as adc1 to adc3 and fitted sensors as temp1 and temp2.
+// Input 1 is wired to the ignition.
+func (d *Decoder) decodeSensors(fields []string, record *MegastekData) {
+	for i, c := range fields[0] {
+		record.Status["in"+strconv.Itoa(i+1)] = c == '1'
+	}
+	for i, c := range fields[1] {
+		record.Status["out"+strconv.Itoa(i+1)] = c == '1'
+	}
+	if in1, ok := record.Status["in1"]; ok {
+		record.Status["ignition"] = in1
+	}
+
+	for i := 0; i < analogInputs; i++ {
+		if value, err := strconv.ParseFloat(fields[2+i], 64); err == nil {
+			record.Status["adc"+strconv.Itoa(i+1)] = value
+		}
+	}
+	for i := 0; i < tempSensors; i++ {
+		value := strings.TrimSpace(fields[2+analogInputs+i])
+		if value == "" {
+			continue
+		}
+		if temp, err := strconv.ParseFloat(value, 64); err == nil {
+			record.Status["temp"+strconv.Itoa(i+1)] = temp
+		} else {
+			d.logDebug("Skipping malformed temperature %q", value)
+		}
+	}
+}
+
+// applyAlert sets the alarm or event the report was triggered by
+func (d *Decoder) applyAlert(alert string, record *MegastekData) {
+	switch alert = strings.ToLower(strings.TrimSpace(alert)); alert {
+	case "", "timer", "distance", "angle":
+	case "ignition on", "acc on":
+		record.Status["ignition"] = true
+	case "ignition off", "acc off":
+		record.Status["ignition"] = false
+	default:
+		if alarm, ok := alertAlarms[alert]; ok {
+			record.Alarm = alarm
+			record.Status["alarm"] = alarm
+			if strings.HasPrefix(alert, "geo-fence") {
+				record.Status["geofence"] = strings.TrimPrefix(alert, "geo-fence ")
+			}
+		} else {
+			record.Status["event"] = alert
+		}
+	}
+}
+
+// parseCoordinate converts degrees and minutes to decimal degrees
+func parseCoordinate(coord, dir string) (float64, error) {
+	val, err := strconv.ParseFloat(coord, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: invalid format", ErrInvalidCoordinate)
+	}
+
+	degrees := float64(int(val / 100))
+	minutes := val - degrees*100
+	if minutes >= 60 {
+		return 0, fmt.Errorf("%w: invalid minutes value", ErrInvalidCoordinate)
+	}
+
+	result := degrees + minutes/60
+	switch dir {
+	case "N", "E":
+	case "S", "W":
+		result = -result
+	default:
+		return 0, fmt.Errorf("%w: invalid hemisphere %q", ErrInvalidCoordinate, dir)
+	}
+
+	if (dir == "N" || dir == "S") && (result < -90 || result > 90) {
+		return 0, fmt.Errorf("%w: latitude out of range", ErrInvalidCoordinate)
+	}
+	if (dir == "E" || dir == "W") && (result < -180 || result > 180) {
+		return 0, fmt.Errorf("%w: longitude out of range", ErrInvalidCoordinate)
+	}
+	return result, nil
+}
+
+func isIMEI(s string) bool {
+	if len(s) < 10 || len(s) > 16 {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// ToPosition converts a report
+func (d *Decoder) ToPosition(deviceID string, data *MegastekData) *model.Position {
+	position := model.NewPosition(deviceID, data.Latitude, data.Longitude)
+	position.Altitude = data.Altitude
+	position.Speed = data.Speed
+	position.Course = data.Course
+	position.Valid = data.Valid
+	position.Satellites = uint8(data.Satellites)
+	position.SetDecodedTime(data.Timestamp, d.clock.Now())
+	position.Protocol = "megastek"
+
+	position.Status = make(map[string]interface{}, len(data.Status))
+	for k, v := range data.Status {
+		position.Status[k] = v
+	}
+	if data.Cell != nil {
+		position.Network = &model.Network{RadioType: "gsm"}
+		position.Network.AddCellTower(*data.Cell)
+	}
+	return position
+}
@@ -0,0 +1,102 @@
+package megastek
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+const (
+	// Periodic report with both temperature sensors fitted, ignition on
+	timerReport = "$MGV002,860719020193193,DeviceName,R,240214,104742,A,2238.20471,N,11401.97967,E,08,10,00,1.20,0.462,356.23,137.9,1.5,460,07,262C,0F54,25,1000,0001,512,0,780,28.5,-3.2,,,100,Timer;!"
+	// Stored SOS report without temperature sensors, read from an RFID tag
+	sosReport = "$MGV002,860719020193193,Truck 7,S,010324,235959,V,3345.12340,S,15112.56780,E,03,07,00,2.50,0.000,0.00,-12.5,4021.3,505,02,1A2B,0000,12,0000,0000,0,0,0, , ,04A1B2C3,,15,SOS;!"
+)
+
+func TestDecode(t *testing.T) {
+	decoder := NewDecoder()
+
+	record, err := decoder.Decode([]byte(timerReport))
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if record.IMEI != "860719020193193" || record.Name != "DeviceName" || !record.Valid ||
+		math.Abs(record.Latitude-22.63674517) > 1e-6 || math.Abs(record.Longitude-114.03299450) > 1e-6 {
+		t.Errorf("Decode() = %+v", record)
+	}
+	if record.Speed != 0.462 || record.Course != 356.23 || record.Altitude != 137.9 || record.Satellites != 8 {
+		t.Errorf("Motion = %v km/h, %v, %v m, %d satellites", record.Speed, record.Course, record.Altitude, record.Satellites)
+	}
+	if want := time.Date(2014, 2, 24, 10, 47, 42, 0, time.UTC); !record.Timestamp.Equal(want) {
+		t.Errorf("Timestamp = %v, want %v", record.Timestamp, want)
+	}
+	status := record.Status
+	if status["adc1"] != 512.0 || status["adc2"] != 0.0 || status["adc3"] != 780.0 ||
+		status["temp1"] != 28.5 || status["temp2"] != -3.2 {
+		t.Errorf("Sensor channels = %v", status)
+	}
+	if status["in1"] != true || status["in2"] != false || status["out4"] != true || status["ignition"] != true ||
+		status["odometer"] != 1500.0 || status["batteryLevel"] != 100 || status["gsmSignal"] != 25 ||
+		status["hdop"] != 1.2 || status["satellitesVisible"] != 10 {
+		t.Errorf("Status = %v", status)
+	}
+	if _, ok := status["buffered"]; ok || record.Alarm != "" || status["rfid"] != nil {
+		t.Errorf("Timer report flagged as %v", status)
+	}
+	if cell := record.Cell; cell == nil || cell.MobileCountryCode != 460 || cell.MobileNetworkCode != 7 ||
+		cell.LocationAreaCode != 0x262C || cell.CellID != 0x0F54 {
+		t.Errorf("Cell = %+v", record.Cell)
+	}
+
+	position := decoder.ToPosition("device-1", record)
+	if position.Protocol != "megastek" || position.Satellites != 8 || position.Status["temp1"] != 28.5 ||
+		position.Network == nil || len(position.Network.CellTowers) != 1 {
+		t.Errorf("ToPosition() = %+v", position)
+	}
+
+	record, err = decoder.Decode([]byte(sosReport))
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	status = record.Status
+	if record.Valid || record.Alarm != "sos" || status["alarm"] != "sos" || status["buffered"] != true ||
+		status["rfid"] != "04A1B2C3" || status["ignition"] != false || record.Latitude > 0 || record.Altitude != -12.5 {
+		t.Errorf("SOS report = %+v", record)
+	}
+	if _, ok := status["temp1"]; ok {
+		t.Errorf("Unfitted sensor reported as %v", status["temp1"])
+	}
+	if record.Cell != nil {
+		t.Errorf("Cell without an ID decoded as %+v", record.Cell)
+	}
+
+	for _, tt := range []struct {
+		name    string
+		data    string
+		wantErr error
+	}{
+		{"not Megastek", "$GPRMC,123519,A,4807.038,N,01131.000,E,022.4,084.4,230394,003.1,W*6A", ErrInvalidHeader},
+		{"no IMEI", "$MGV002,,DeviceName,R,240214,104742,A;!", ErrInvalidFormat},
+		{"truncated", timerReport[:120], ErrInvalidFormat},
+		{"bad hemisphere", "$MGV002,860719020193193,,R,240214,104742,A,2238.20471,X,11401.97967,E,08,10,00,1.20,0.462,356.23,137.9,1.5,460,07,262C,0F54,25,1000,0001,512,0,780,,,,,100,Timer;!", ErrInvalidCoordinate},
+	} {
+		if _, err := decoder.Decode([]byte(tt.data)); !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: Decode() error = %v, want %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestIsFrame(t *testing.T) {
+	if !IsFrame([]byte(timerReport)) || !IsFrame([]byte("$MGV101,860719020193193,")) {
+		t.Error("IsFrame() rejected a $MGV report")
+	}
+	for _, data := range []string{"$MGVABC,860719020193193,", "$MG", "$GPGGA,123519,4807.038,N"} {
+		if IsFrame([]byte(data)) {
+			t.Errorf("IsFrame(%q) = true", data)
+		}
+	}
+	if imei, err := DeviceID([]byte(sosReport)); err != nil || imei != "860719020193193" {
+		t.Errorf("DeviceID() = %q, %v", imei, err)
+	}
+}
@@ -0,0 +1,308 @@
+// Package mqtt implements the subscribing side of MQTT 3.1.1, enough to
+// take device payloads from a broker. Messages are received at most at
+// QoS 1 and acknowledged as they are read.
+package mqtt
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// Common MQTT errors
+var (
+	ErrMalformedPacket = errors.New("malformed MQTT packet")
+	ErrRefused         = errors.New("MQTT connection refused")
+	ErrSubscribeFailed = errors.New("MQTT subscription refused")
+)
+
+// Control packet types
+const (
+	packetConnect    = 1
+	packetConnack    = 2
+	packetPublish    = 3
+	packetPuback     = 4
+	packetSubscribe  = 8
+	packetSuback     = 9
+	packetPingreq    = 12
+	packetPingresp   = 13
+	packetDisconnect = 14
+)
+
+// maxPacketSize bounds the packets accepted from the broker
+const maxPacketSize = 256 * 1024
+
+// DefaultKeepAlive is used when Options.KeepAlive is zero
+const DefaultKeepAlive = 60 * time.Second
+
+// Options configure a connection
+type Options struct {
+	ClientID  string
+	Username  string
+	Password  string
+	KeepAlive time.Duration
+}
+
+// Message is an application message received from the broker
+type Message struct {
+	Topic   string
+	Payload []byte
+}
+
+// Client is a connection to a broker. Receive must be called from a single
+// goroutine; Close may be called from any.
+type Client struct {
+	conn      net.Conn
+	reader    *bufio.Reader
+	keepAlive time.Duration
+
+	writeMutex sync.Mutex
+	nextID     uint16
+	pending    []*Message // Received while waiting for a SUBACK
+	done       chan struct{}
+	closeOnce  sync.Once
+}
+
+// Dial connects to the broker at address and starts the keep alive pings
+func Dial(address string, options Options) (*Client, error) {
+	conn, err := net.DialTimeout("tcp", address, 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	client, err := NewClient(conn, options)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return client, nil
+}
+
+// NewClient sends CONNECT over an established connection and waits for the
+// broker to accept it
+func NewClient(conn net.Conn, options Options) (*Client, error) {
+	if options.KeepAlive <= 0 {
+		options.KeepAlive = DefaultKeepAlive
+	}
+	c := &Client{
+		conn:      conn,
+		reader:    bufio.NewReader(conn),
+		keepAlive: options.KeepAlive,
+		done:      make(chan struct{}),
+	}
+
+	flags := byte(0x02) // Clean session
+	var payload []byte
+	payload = appendString(payload, options.ClientID)
+	if options.Username != "" {
+		flags |= 0x80
+		payload = appendString(payload, options.Username)
+		if options.Password != "" {
+			flags |= 0x40
+			payload = appendString(payload, options.Password)
+		}
+	}
+	header := appendString(nil, "MQTT")
+	header = append(header, 4, flags) // Protocol level 4 is 3.1.1
+	header = binary.BigEndian.AppendUint16(header, uint16(options.KeepAlive/time.Second))
+	if err := c.write(packetConnect<<4, append(header, payload...)); err != nil {
+		return nil, err
+	}
+
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	packetType, _, body, err := c.readPacket()
+	if err != nil {
+		return nil, err
+	}
+	if packetType != packetConnack || len(body) != 2 {
+		return nil, fmt.Errorf("%w: expected CONNACK, got type %d", ErrMalformedPacket, packetType)
+	}
+	if body[1] != 0 {
+		return nil, fmt.Errorf("%w: return code %d", ErrRefused, body[1])
+	}
+
+	go c.ping()
+	return c, nil
+}
+
+// Subscribe asks for the messages matching a topic filter
+func (c *Client) Subscribe(filter string) error {
+	c.nextID++
+	if c.nextID == 0 {
+		c.nextID = 1
+	}
+	id := c.nextID
+
+	body := binary.BigEndian.AppendUint16(nil, id)
+	body = appendString(body, filter)
+	body = append(body, 1) // Maximum QoS
+	if err := c.write(packetSubscribe<<4|0x02, body); err != nil {
+		return err
+	}
+
+	for {
+		c.conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+		packetType, flags, body, err := c.readPacket()
+		if err != nil {
+			return err
+		}
+		switch packetType {
+		case packetSuback:
+			if len(body) < 3 || binary.BigEndian.Uint16(body) != id {
+				return fmt.Errorf("%w: unexpected SUBACK", ErrMalformedPacket)
+			}
+			if body[2] == 0x80 {
+				return fmt.Errorf("%w: %s", ErrSubscribeFailed, filter)
+			}
+			return nil
+		case packetPublish:
+			message, err := c.handlePublish(flags, body)
+			if err != nil {
+				return err
+			}
+			c.pending = append(c.pending, message)
+		}
+	}
+}
+
+// Receive returns the next message, acknowledging it to the broker
+func (c *Client) Receive() (*Message, error) {
+	if len(c.pending) > 0 {
+		message := c.pending[0]
+		c.pending = c.pending[1:]
+		return message, nil
+	}
+
+	for {
+		// The broker answers pings, so silence past the keep alive means it is gone
+		c.conn.SetReadDeadline(time.Now().Add(c.keepAlive * 3 / 2))
+		packetType, flags, body, err := c.readPacket()
+		if err != nil {
+			return nil, err
+		}
+		if packetType == packetPublish {
+			return c.handlePublish(flags, body)
+		}
+	}
+}
+
+// Close disconnects from the broker
+func (c *Client) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.write(packetDisconnect<<4, nil)
+		err = c.conn.Close()
+	})
+	return err
+}
+
+// handlePublish parses a PUBLISH and acknowledges it when sent at QoS 1
+func (c *Client) handlePublish(flags byte, body []byte) (*Message, error) {
+	topic, rest, err := readString(body)
+	if err != nil {
+		return nil, err
+	}
+	if qos := flags >> 1 & 0x03; qos > 0 {
+		if len(rest) < 2 {
+			return nil, fmt.Errorf("%w: missing packet identifier", ErrMalformedPacket)
+		}
+		if err := c.write(packetPuback<<4, rest[:2]); err != nil {
+			return nil, err
+		}
+		rest = rest[2:]
+	}
+	return &Message{Topic: topic, Payload: rest}, nil
+}
+
+// ping keeps the connection alive until it is closed
+func (c *Client) ping() {
+	ticker := time.NewTicker(c.keepAlive / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := c.write(packetPingreq<<4, nil); err != nil {
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+func (c *Client) write(header byte, body []byte) error {
+	packet := []byte{header}
+	length := len(body)
+	for {
+		digit := byte(length % 128)
+		length /= 128
+		if length > 0 {
+			digit |= 0x80
+		}
+		packet = append(packet, digit)
+		if length == 0 {
+			break
+		}
+	}
+	packet = append(packet, body...)
+
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	_, err := c.conn.Write(packet)
+	return err
+}
+
+// readPacket returns the type, flags and body of the next packet
+func (c *Client) readPacket() (byte, byte, []byte, error) {
+	header, err := c.reader.ReadByte()
+	if err != nil {
+		return 0, 0, nil, err
+	}
+
+	length, multiplier := 0, 1
+	for i := 0; ; i++ {
+		digit, err := c.reader.ReadByte()
+		if err != nil {
+			return 0, 0, nil, err
+		}
+		length += int(digit&0x7F) * multiplier
+		if digit&0x80 == 0 {
+			break
+		}
+		if i == 3 {
+			return 0, 0, nil, fmt.Errorf("%w: remaining length too long", ErrMalformedPacket)
+		}
+		multiplier *= 128
+	}
+	if length > maxPacketSize {
+		return 0, 0, nil, fmt.Errorf("%w: %d byte packet", ErrMalformedPacket, length)
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(c.reader, body); err != nil {
+		return 0, 0, nil, err
+	}
+	return header >> 4, header & 0x0F, body, nil
+}
+
+func appendString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+func readString(b []byte) (string, []byte, error) {
+	if len(b) < 2 {
+		return "", nil, fmt.Errorf("%w: truncated string", ErrMalformedPacket)
+	}
+	length := int(binary.BigEndian.Uint16(b))
+	if len(b) < 2+length {
+		return "", nil, fmt.Errorf("%w: truncated string", ErrMalformedPacket)
+	}
+	return string(b[2 : 2+length]), b[2+length:], nil
+}
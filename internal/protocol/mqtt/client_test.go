@@ -0,0 +1,151 @@
+package mqtt
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// broker is the far end of a pipe, reading packets with the client's parser
+type broker struct {
+	t    *testing.T
+	conn net.Conn
+	peer *Client
+}
+
+func newBroker(t *testing.T) (*broker, net.Conn) {
+	server, client := net.Pipe()
+	t.Cleanup(func() { server.Close() })
+	return &broker{t: t, conn: server, peer: &Client{reader: bufio.NewReader(server)}}, client
+}
+
+func (b *broker) expect(packetType byte) []byte {
+	b.t.Helper()
+	b.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	got, _, body, err := b.peer.readPacket()
+	if err != nil {
+		b.t.Fatalf("Broker read failed: %v", err)
+	}
+	if got != packetType {
+		b.t.Fatalf("Broker got packet type %d, want %d", got, packetType)
+	}
+	return body
+}
+
+func (b *broker) send(packet []byte) {
+	b.t.Helper()
+	b.conn.SetWriteDeadline(time.Now().Add(2 * time.Second))
+	if _, err := b.conn.Write(packet); err != nil {
+		b.t.Fatalf("Broker write failed: %v", err)
+	}
+}
+
+// publish builds a PUBLISH packet, with packet identifier 7 above QoS 0
+func publish(topic, payload string, qos byte) []byte {
+	body := appendString(nil, topic)
+	if qos > 0 {
+		body = append(body, 0x00, 0x07)
+	}
+	body = append(body, payload...)
+	return append([]byte{packetPublish<<4 | qos<<1, byte(len(body))}, body...)
+}
+
+func TestClient(t *testing.T) {
+	b, conn := newBroker(t)
+
+	type result struct {
+		client *Client
+		err    error
+	}
+	connected := make(chan result, 1)
+	go func() {
+		client, err := NewClient(conn, Options{ClientID: "tracking", Username: "user", Password: "secret", KeepAlive: 30 * time.Second})
+		connected <- result{client, err}
+	}()
+
+	connect := b.expect(packetConnect)
+	want := []byte("\x00\x04MQTT\x04\xC2\x00\x1E\x00\x08tracking\x00\x04user\x00\x06secret")
+	if !bytes.Equal(connect, want) {
+		t.Fatalf("CONNECT = %q, want %q", connect, want)
+	}
+	b.send([]byte{0x20, 0x02, 0x00, 0x00})
+	r := <-connected
+	if r.err != nil {
+		t.Fatalf("NewClient() error = %v", r.err)
+	}
+	client := r.client
+	defer client.Close()
+
+	subscribed := make(chan error, 1)
+	go func() { subscribed <- client.Subscribe("owntracks/+/+") }()
+	subscribe := b.expect(packetSubscribe)
+	if want := []byte("\x00\x01\x00\x0Downtracks/+/+\x01"); !bytes.Equal(subscribe, want) {
+		t.Fatalf("SUBSCRIBE = %q, want %q", subscribe, want)
+	}
+
+	// A retained message may come ahead of the SUBACK
+	b.send(publish("owntracks/jane/phone", `{"_type":"lwt"}`, 0))
+	b.send([]byte{0x90, 0x03, 0x00, 0x01, 0x01})
+	if err := <-subscribed; err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+
+	received := make(chan *Message, 2)
+	go func() {
+		for i := 0; i < 2; i++ {
+			message, err := client.Receive()
+			if err != nil {
+				t.Errorf("Receive() error = %v", err)
+				return
+			}
+			received <- message
+		}
+	}()
+	if message := <-received; message.Topic != "owntracks/jane/phone" || string(message.Payload) != `{"_type":"lwt"}` {
+		t.Errorf("First message = %s %q", message.Topic, message.Payload)
+	}
+
+	// QoS 1 messages are acknowledged with their packet identifier
+	b.send(publish("owntracks/jane/phone", `{"_type":"location"}`, 1))
+	if ack := b.expect(packetPuback); !bytes.Equal(ack, []byte{0x00, 0x07}) {
+		t.Errorf("PUBACK = % x, want 00 07", ack)
+	}
+	if message := <-received; string(message.Payload) != `{"_type":"location"}` {
+		t.Errorf("Second message = %q", message.Payload)
+	}
+
+	go client.Close()
+	b.expect(packetDisconnect)
+}
+
+func TestClientRefused(t *testing.T) {
+	b, conn := newBroker(t)
+	go func() {
+		b.expect(packetConnect)
+		b.send([]byte{0x20, 0x02, 0x00, 0x05})
+	}()
+	if _, err := NewClient(conn, Options{ClientID: "tracking"}); !errors.Is(err, ErrRefused) {
+		t.Errorf("NewClient() error = %v, want %v", err, ErrRefused)
+	}
+}
+
+func TestSubscribeRefused(t *testing.T) {
+	b, conn := newBroker(t)
+	go func() {
+		b.expect(packetConnect)
+		b.send([]byte{0x20, 0x02, 0x00, 0x00})
+		b.expect(packetSubscribe)
+		b.send([]byte{0x90, 0x03, 0x00, 0x01, 0x80})
+	}()
+	client, err := NewClient(conn, Options{ClientID: "tracking"})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	defer conn.Close()
+	if err := client.Subscribe("#"); !errors.Is(err, ErrSubscribeFailed) {
+		t.Errorf("Subscribe() error = %v, want %v", err, ErrSubscribeFailed)
+	}
+}
@@ -0,0 +1,468 @@
+// Package nmea decodes raw NMEA 0183 sentences forwarded by serial-to-IP
+// gateways, pairing the RMC and GGA sentences of each fix into one position
+package nmea
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+	"tracking/internal/core/model"
+	"tracking/internal/core/util"
+)
+
+// Common NMEA errors
+var (
+	ErrInvalidSentence   = errors.New("invalid NMEA sentence")
+	ErrInvalidChecksum   = errors.New("invalid NMEA checksum")
+	ErrInvalidCoordinate = errors.New("invalid coordinate value")
+	ErrNoDeviceID        = errors.New("no NMEA registration line")
+)
+
+// Sentences look like
+//
+//	$GPRMC,123519.00,A,4807.038,N,01131.000,E,022.4,084.4,230394,003.1,W*6A
+//	$GPGGA,123519.00,4807.038,N,01131.000,E,1,08,0.9,545.4,M,46.9,M,,*47
+//
+// that is a talker (GP, GN, GL, ...), the sentence type and comma separated
+// fields, closed by * and the XOR of every character between $ and * in
+// hex. RMC carries the date, time, validity, position, speed in knots and
+// course; GGA the time of day, position, fix quality, satellites used,
+// HDOP and altitude above mean sea level.
+//
+// Gateways have no identity of their own in the stream, so most are set up
+// to open each connection with a registration line holding the IMEI or
+// serial of the unit, such as
+//
+//	865328021234567
+const (
+	sentenceStart = '$'
+	checksumMark  = '*'
+
+	typeRMC = "RMC"
+	typeGGA = "GGA"
+
+	rmcFields = 9  // Up to the date
+	ggaFields = 10 // Up to the altitude unit
+
+	maxPartial = 4096 // Longest unterminated tail kept between reads
+)
+
+// Fix is a position assembled from the sentences of one instant
+type Fix struct {
+	Timestamp  time.Time
+	Latitude   float64
+	Longitude  float64
+	Altitude   float64
+	Speed      float64 // km/h
+	Course     float64
+	Valid      bool
+	Satellites int
+	HDOP       float64
+	Quality    int  // GGA fix quality, 0 when no GGA was paired
+	HasGGA     bool // Whether altitude, satellites and HDOP are known
+}
+
+type Decoder struct {
+	debug bool
+	clock util.Clock
+}
+
+func NewDecoder() *Decoder {
+	return &Decoder{
+		debug: false,
+		clock: util.SystemClock,
+	}
+}
+
+func (d *Decoder) EnableDebug(enable bool) {
+	d.debug = enable
+}
+
+// SetClock sets the clock used to date GGA sentences received without an
+// RMC
+func (d *Decoder) SetClock(clock util.Clock) {
+	d.clock = clock
+}
+
+func (d *Decoder) logDebug(format string, v ...interface{}) {
+	if d.debug {
+		log.Printf("[NMEA] "+format, v...)
+	}
+}
+
+// IsFrame reports whether data starts with an RMC or GGA sentence or with
+// a registration line
+func IsFrame(data []byte) bool {
+	if len(data) > 6 && data[0] == sentenceStart {
+		kind := string(data[3:6])
+		return (kind == typeRMC || kind == typeGGA) && data[6] == ','
+	}
+	_, err := DeviceID(data)
+	return err == nil
+}
+
+// DeviceID returns the identifier on the registration line opening a
+// stream
+func DeviceID(data []byte) (string, error) {
+	line, _, found := bytes.Cut(data, []byte("\n"))
+	id := string(bytes.TrimSpace(line))
+	if !found || len(id) < 6 || len(id) > 20 {
+		return "", ErrNoDeviceID
+	}
+	for _, c := range id {
+		if c < '0' || c > '9' {
+			return "", ErrNoDeviceID
+		}
+	}
+	return id, nil
+}
+
+// sentence is one checked sentence split into fields, the first being
+// the talker and type
+type sentence struct {
+	kind   string
+	fields []string
+}
+
+// parseSentence checks the checksum of a sentence and splits it
+func parseSentence(line string) (*sentence, error) {
+	line = strings.TrimSpace(line)
+	if len(line) < 7 || line[0] != sentenceStart {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidSentence, line)
+	}
+	body, sum, found := strings.Cut(line[1:], string(checksumMark))
+	if !found || len(sum) != 2 {
+		return nil, fmt.Errorf("%w: missing in %q", ErrInvalidChecksum, line)
+	}
+	expected, err := strconv.ParseUint(sum, 16, 8)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q is not hex", ErrInvalidChecksum, sum)
+	}
+	var checksum byte
+	for i := 0; i < len(body); i++ {
+		checksum ^= body[i]
+	}
+	if checksum != byte(expected) {
+		return nil, fmt.Errorf("%w: got %02X, calculated %02X", ErrInvalidChecksum, expected, checksum)
+	}
+
+	fields := strings.Split(body, ",")
+	if len(fields[0]) != 5 {
+		return nil, fmt.Errorf("%w: address %q", ErrInvalidSentence, fields[0])
+	}
+	return &sentence{kind: fields[0][2:], fields: fields[1:]}, nil
+}
+
+// ParseRMC reads the fields of an RMC sentence after its address, which
+// other protocols embed too
+func ParseRMC(fields []string) (*Fix, error) {
+	if len(fields) < rmcFields {
+		return nil, fmt.Errorf("%w: RMC with %d fields, need %d", ErrInvalidSentence, len(fields), rmcFields)
+	}
+
+	fix := &Fix{Valid: fields[1] == "A"}
+	var err error
+	if fix.Latitude, err = parseCoordinate(fields[2], fields[3]); err != nil {
+		return nil, fmt.Errorf("invalid latitude: %w", err)
+	}
+	if fix.Longitude, err = parseCoordinate(fields[4], fields[5]); err != nil {
+		return nil, fmt.Errorf("invalid longitude: %w", err)
+	}
+	if speed, err := strconv.ParseFloat(fields[6], 64); err == nil {
+		fix.Speed = speed * 1.852 // Convert knots to km/h
+	}
+	if course, err := strconv.ParseFloat(fields[7], 64); err == nil {
+		fix.Course = course
+	}
+
+	date, err := time.Parse("020106", fields[8])
+	if err != nil {
+		return nil, fmt.Errorf("%w: date %q", ErrInvalidSentence, fields[8])
+	}
+	timeOfDay, err := parseTimeOfDay(fields[0])
+	if err != nil {
+		return nil, err
+	}
+	fix.Timestamp = date.Add(timeOfDay)
+	return fix, nil
+}
+
+// parseGGA reads the fields of a GGA sentence, leaving the date to the
+// RMC it is paired with
+func parseGGA(fields []string) (*Fix, time.Duration, error) {
+	if len(fields) < ggaFields {
+		return nil, 0, fmt.Errorf("%w: GGA with %d fields, need %d", ErrInvalidSentence, len(fields), ggaFields)
+	}
+	timeOfDay, err := parseTimeOfDay(fields[0])
+	if err != nil {
+		return nil, 0, err
+	}
+
+	fix := &Fix{HasGGA: true}
+	if fix.Latitude, err = parseCoordinate(fields[1], fields[2]); err != nil {
+		return nil, 0, fmt.Errorf("invalid latitude: %w", err)
+	}
+	if fix.Longitude, err = parseCoordinate(fields[3], fields[4]); err != nil {
+		return nil, 0, fmt.Errorf("invalid longitude: %w", err)
+	}
+	fix.Quality, _ = strconv.Atoi(fields[5])
+	fix.Valid = fix.Quality > 0
+	fix.Satellites, _ = strconv.Atoi(fields[6])
+	fix.HDOP, _ = strconv.ParseFloat(fields[7], 64)
+	fix.Altitude, _ = strconv.ParseFloat(fields[8], 64)
+	return fix, timeOfDay, nil
+}
+
+// parseTimeOfDay reads hhmmss with optional fractional seconds
+func parseTimeOfDay(value string) (time.Duration, error) {
+	if len(value) < 6 {
+		return 0, fmt.Errorf("%w: time %q", ErrInvalidSentence, value)
+	}
+	clock, err := time.Parse("150405", value[:6])
+	if err != nil {
+		return 0, fmt.Errorf("%w: time %q", ErrInvalidSentence, value)
+	}
+	timeOfDay := time.Duration(clock.Hour())*time.Hour +
+		time.Duration(clock.Minute())*time.Minute +
+		time.Duration(clock.Second())*time.Second
+	if len(value) > 7 && value[6] == '.' {
+		if fraction, err := strconv.ParseFloat("0"+value[6:], 64); err == nil {
+			timeOfDay += time.Duration(fraction * float64(time.Second)).Round(time.Millisecond)
+		}
+	}
+	return timeOfDay, nil
+}
+
+// parseCoordinate converts degrees and minutes to decimal degrees
+func parseCoordinate(coord, dir string) (float64, error) {
+	val, err := strconv.ParseFloat(coord, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: invalid format", ErrInvalidCoordinate)
+	}
+
+	degrees := float64(int(val / 100))
+	minutes := val - degrees*100
+	if minutes >= 60 {
+		return 0, fmt.Errorf("%w: invalid minutes value", ErrInvalidCoordinate)
+	}
+
+	result := degrees + minutes/60
+	switch dir {
+	case "N", "E":
+	case "S", "W":
+		result = -result
+	default:
+		return 0, fmt.Errorf("%w: invalid hemisphere %q", ErrInvalidCoordinate, dir)
+	}
+
+	if (dir == "N" || dir == "S") && (result < -90 || result > 90) {
+		return 0, fmt.Errorf("%w: latitude out of range", ErrInvalidCoordinate)
+	}
+	if (dir == "E" || dir == "W") && (result < -180 || result > 180) {
+		return 0, fmt.Errorf("%w: longitude out of range", ErrInvalidCoordinate)
+	}
+	return result, nil
+}
+
+// Stream pairs the sentences of one connection, which may split them
+// across reads. A sentence is held until its partner of the same instant
+// arrives, or until a sentence of another instant shows it has none.
+type Stream struct {
+	decoder *Decoder
+	partial []byte
+
+	rmc  *Fix          // RMC awaiting its GGA
+	gga  *Fix          // GGA awaiting its RMC
+	at   time.Duration // Time of day of the GGA
+	date time.Time     // Date of the last RMC, for GGA without one
+}
+
+// NewStream returns a stream assembling fixes from successive reads
+func (d *Decoder) NewStream() *Stream {
+	return &Stream{decoder: d}
+}
+
+// Write takes the next read of the stream and returns the fixes it
+// completes. Sentences failing their checksum are skipped; the error is
+// returned only when nothing else in the read could be used.
+func (s *Stream) Write(data []byte) ([]*Fix, error) {
+	data = append(s.partial, data...)
+	s.partial = nil
+
+	var fixes []*Fix
+	var firstErr error
+	used := false
+	for len(data) > 0 {
+		line, rest, found := bytes.Cut(data, []byte("\n"))
+		if !found {
+			// Gateways that strip line ends leave the checksum to close a
+			// sentence; anything else is completed by the next read
+			if i := bytes.LastIndexByte(line, checksumMark); i < 0 || len(line)-i < 3 {
+				if len(line) <= maxPartial {
+					s.partial = append([]byte(nil), line...)
+				}
+				break
+			}
+		}
+		data = rest
+
+		for _, text := range splitSentences(string(line)) {
+			fix, err := s.add(text)
+			if err != nil {
+				s.decoder.logDebug("Skipping %q: %v", text, err)
+				if firstErr == nil {
+					firstErr = err
+				}
+				continue
+			}
+			used = true
+			if fix != nil {
+				fixes = append(fixes, fix)
+			}
+		}
+	}
+
+	if !used && firstErr != nil {
+		return nil, firstErr
+	}
+	return fixes, nil
+}
+
+// Flush returns the sentence held for a partner that will not come
+func (s *Stream) Flush() []*Fix {
+	var fixes []*Fix
+	if s.rmc != nil {
+		fixes = append(fixes, s.rmc)
+	}
+	if s.gga != nil {
+		fixes = append(fixes, s.datedGGA())
+	}
+	s.rmc, s.gga = nil, nil
+	return fixes
+}
+
+// splitSentences separates sentences run together without line ends
+func splitSentences(line string) []string {
+	var sentences []string
+	parts := strings.Split(line, string(sentenceStart))
+	for _, part := range parts[1:] { // Text before the first $ is no sentence
+		if part = strings.TrimSpace(part); part != "" {
+			sentences = append(sentences, string(sentenceStart)+part)
+		}
+	}
+	return sentences
+}
+
+// add takes one sentence and returns the fix it completes, if any. At most
+// one of an RMC and a GGA is held at a time.
+func (s *Stream) add(text string) (*Fix, error) {
+	parsed, err := parseSentence(text)
+	if err != nil {
+		return nil, err
+	}
+
+	var done *Fix
+	switch parsed.kind {
+	case typeRMC:
+		rmc, err := ParseRMC(parsed.fields)
+		if err != nil {
+			return nil, err
+		}
+		s.date = rmc.Timestamp.Truncate(24 * time.Hour)
+		if s.gga != nil {
+			if s.at == timeOfDay(rmc.Timestamp) {
+				return s.merge(rmc, s.gga), nil
+			}
+			done = s.datedGGA()
+		}
+		if s.rmc != nil {
+			done = s.rmc
+		}
+		s.rmc = rmc
+
+	case typeGGA:
+		gga, at, err := parseGGA(parsed.fields)
+		if err != nil {
+			return nil, err
+		}
+		if s.rmc != nil {
+			if timeOfDay(s.rmc.Timestamp) == at {
+				return s.merge(s.rmc, gga), nil
+			}
+			done, s.rmc = s.rmc, nil
+		}
+		if s.gga != nil {
+			done = s.datedGGA()
+		}
+		s.gga, s.at = gga, at
+
+	default:
+		s.decoder.logDebug("Ignoring %s sentence", parsed.kind)
+	}
+	return done, nil
+}
+
+// merge completes an RMC with the GGA of the same instant
+func (s *Stream) merge(rmc, gga *Fix) *Fix {
+	rmc.Altitude = gga.Altitude
+	rmc.Satellites = gga.Satellites
+	rmc.HDOP = gga.HDOP
+	rmc.Quality = gga.Quality
+	rmc.HasGGA = true
+	s.rmc, s.gga = nil, nil
+	return rmc
+}
+
+// datedGGA releases the held GGA, dated by the last RMC or else by the
+// clock
+func (s *Stream) datedGGA() *Fix {
+	fix := s.gga
+	s.gga = nil
+	if !s.date.IsZero() {
+		fix.Timestamp = s.date.Add(s.at)
+		return fix
+	}
+	now := s.decoder.clock.Now().UTC()
+	fix.Timestamp = now.Truncate(24 * time.Hour).Add(s.at)
+	if fix.Timestamp.After(now.Add(time.Hour)) {
+		fix.Timestamp = fix.Timestamp.AddDate(0, 0, -1)
+	}
+	return fix
+}
+
+func timeOfDay(t time.Time) time.Duration {
+	return t.Sub(t.Truncate(24 * time.Hour))
+}
+
+// Decode assembles the fixes of a complete batch of sentences, such as one
+// posted over HTTP
+func (d *Decoder) Decode(data []byte) ([]*Fix, error) {
+	stream := d.NewStream()
+	fixes, err := stream.Write(append(append([]byte(nil), data...), '\n'))
+	if err != nil {
+		return nil, err
+	}
+	return append(fixes, stream.Flush()...), nil
+}
+
+// ToPosition converts a fix
+func (d *Decoder) ToPosition(deviceID string, fix *Fix) *model.Position {
+	position := model.NewPosition(deviceID, fix.Latitude, fix.Longitude)
+	position.Altitude = fix.Altitude
+	position.Speed = fix.Speed
+	position.Course = fix.Course
+	position.Valid = fix.Valid
+	position.Timestamp = fix.Timestamp
+	position.Protocol = "nmea"
+	if fix.HasGGA {
+		position.Satellites = uint8(fix.Satellites)
+		position.Status["satellites"] = fix.Satellites
+		position.Status["hdop"] = fix.HDOP
+		position.Status["fixQuality"] = fix.Quality
+	}
+	return position
+}
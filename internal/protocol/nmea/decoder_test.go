@@ -0,0 +1,161 @@
+package nmea
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+	"tracking/internal/core/util"
+)
+
+const (
+	rmcMunich = "$GPRMC,123519,A,4807.038,N,01131.000,E,022.4,084.4,230394,003.1,W*6A"
+	ggaMunich = "$GPGGA,123519,4807.038,N,01131.000,E,1,08,0.9,545.4,M,46.9,M,,*47"
+
+	rmcSydney     = "$GNRMC,093000.50,A,3345.1234,S,15112.5678,E,10.0,180.0,150124,,,A*66"
+	ggaSydney     = "$GNGGA,093000.50,3345.1234,S,15112.5678,E,2,11,0.7,35.2,M,20.1,M,,*5C"
+	ggaSydneyLone = "$GPGGA,093001.00,3345.1240,S,15112.5690,E,1,10,0.8,35.5,M,20.1,M,,*49"
+	rmcSydneyVoid = "$GPRMC,093002.00,V,3345.1250,S,15112.5700,E,0.0,0.0,150124,,,N*53"
+	gsv           = "$GPGSV,1,1,01,01,40,083,46*44"
+)
+
+func almostEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-6
+}
+
+func TestDecode(t *testing.T) {
+	decoder := NewDecoder()
+
+	fixes, err := decoder.Decode([]byte(rmcMunich + "\r\n" + ggaMunich + "\r\n"))
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if len(fixes) != 1 {
+		t.Fatalf("Decode() returned %d fixes, want 1", len(fixes))
+	}
+	fix := fixes[0]
+	if !fix.Valid || !almostEqual(fix.Latitude, 48.1173) || !almostEqual(fix.Longitude, 11.516666667) ||
+		!almostEqual(fix.Speed, 22.4*1.852) || fix.Course != 84.4 {
+		t.Errorf("Decode() = %+v", fix)
+	}
+	if want := time.Date(1994, 3, 23, 12, 35, 19, 0, time.UTC); !fix.Timestamp.Equal(want) {
+		t.Errorf("Timestamp = %v, want %v", fix.Timestamp, want)
+	}
+	if !fix.HasGGA || fix.Altitude != 545.4 || fix.Satellites != 8 || fix.HDOP != 0.9 || fix.Quality != 1 {
+		t.Errorf("GGA fields = %+v", fix)
+	}
+
+	position := decoder.ToPosition("device-1", fix)
+	if position.Protocol != "nmea" || position.Satellites != 8 || position.Altitude != 545.4 ||
+		position.Status["hdop"] != 0.9 || position.Status["fixQuality"] != 1 {
+		t.Errorf("ToPosition() = %+v", position)
+	}
+
+	// Gateways stripping line ends leave sentences run together
+	fixes, err = decoder.Decode([]byte(ggaMunich + rmcMunich))
+	if err != nil || len(fixes) != 1 || !fixes[0].HasGGA {
+		t.Errorf("Decode() of joined sentences = %+v, %v", fixes, err)
+	}
+
+	// An RMC alone is still a fix
+	fixes, err = decoder.Decode([]byte(rmcMunich))
+	if err != nil || len(fixes) != 1 || fixes[0].HasGGA {
+		t.Errorf("Decode() of a lone RMC = %+v, %v", fixes, err)
+	}
+
+	for _, tt := range []struct {
+		name    string
+		data    string
+		wantErr error
+	}{
+		{"bad checksum", rmcMunich[:len(rmcMunich)-1] + "B", ErrInvalidChecksum},
+		{"no checksum", rmcMunich[:len(rmcMunich)-3], ErrInvalidChecksum},
+		{"short RMC", "$GPRMC,123519,A*07", ErrInvalidSentence},
+		{"bad hemisphere", "$GPRMC,123519,A,4807.038,X,01131.000,E,022.4,084.4,230394,003.1,W*7C", ErrInvalidCoordinate},
+	} {
+		if _, err := decoder.Decode([]byte(tt.data)); !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: Decode() error = %v, want %v", tt.name, err, tt.wantErr)
+		}
+	}
+
+	// A corrupt sentence among good ones is skipped
+	fixes, err = decoder.Decode([]byte(rmcMunich[:len(rmcMunich)-1] + "B\n" + rmcSydney + "\n"))
+	if err != nil || len(fixes) != 1 || fixes[0].Latitude > 0 {
+		t.Errorf("Decode() with a corrupt sentence = %+v, %v", fixes, err)
+	}
+}
+
+func TestStream(t *testing.T) {
+	decoder := NewDecoder()
+	decoder.SetClock(util.NewFixedClock(time.Date(2024, 1, 16, 8, 0, 0, 0, time.UTC)))
+	stream := decoder.NewStream()
+
+	write := func(data string, want int) []*Fix {
+		t.Helper()
+		fixes, err := stream.Write([]byte(data))
+		if err != nil {
+			t.Fatalf("Write(%q) error = %v", data, err)
+		}
+		if len(fixes) != want {
+			t.Fatalf("Write(%q) returned %d fixes, want %d", data, len(fixes), want)
+		}
+		return fixes
+	}
+
+	// A sentence split across reads is completed by the next one, and the
+	// RMC waits for its GGA
+	write("865328021234567\r\n"+rmcSydney[:30], 0)
+	write(rmcSydney[30:]+"\r\n"+gsv+"\r\n", 0)
+	fix := write(ggaSydney+"\r\n", 1)[0]
+	if !fix.HasGGA || fix.Quality != 2 || fix.Satellites != 11 || !almostEqual(fix.Latitude, -33.75205667) ||
+		!almostEqual(fix.Speed, 18.52) || fix.Course != 180 {
+		t.Errorf("Fix = %+v", fix)
+	}
+	if want := time.Date(2024, 1, 15, 9, 30, 0, 500e6, time.UTC); !fix.Timestamp.Equal(want) {
+		t.Errorf("Timestamp = %v, want %v", fix.Timestamp, want)
+	}
+
+	// A GGA without an RMC takes the date of the last RMC once a later
+	// sentence shows its RMC is not coming
+	write(ggaSydneyLone+"\r\n", 0)
+	fix = write(rmcSydneyVoid+"\r\n", 1)[0]
+	if want := time.Date(2024, 1, 15, 9, 30, 1, 0, time.UTC); !fix.Timestamp.Equal(want) || !fix.Valid || fix.Altitude != 35.5 {
+		t.Errorf("Lone GGA = %+v, want a valid fix at %v", fix, want)
+	}
+
+	fixes := stream.Flush()
+	if len(fixes) != 1 || fixes[0].Valid || fixes[0].HasGGA {
+		t.Errorf("Flush() = %+v, want the void RMC", fixes)
+	}
+	if fixes := stream.Flush(); len(fixes) != 0 {
+		t.Errorf("Second Flush() = %+v", fixes)
+	}
+
+	// Without any RMC a GGA is dated by the clock
+	stream = decoder.NewStream()
+	write(ggaSydneyLone+"\r\n", 0)
+	fixes = stream.Flush()
+	if want := time.Date(2024, 1, 16, 9, 30, 1, 0, time.UTC).AddDate(0, 0, -1); len(fixes) != 1 || !fixes[0].Timestamp.Equal(want) {
+		t.Errorf("Flush() = %+v, want a fix at %v", fixes, want)
+	}
+}
+
+func TestIsFrame(t *testing.T) {
+	for _, data := range []string{rmcMunich, ggaSydney, "865328021234567\r\n", "865328021234567\n" + rmcMunich} {
+		if !IsFrame([]byte(data)) {
+			t.Errorf("IsFrame(%q) = false", data)
+		}
+	}
+	for _, data := range []string{gsv, "$MGV002,860719020212696,", "imei:359586015829802,tracker", "865328021234567", "12345\n"} {
+		if IsFrame([]byte(data)) {
+			t.Errorf("IsFrame(%q) = true", data)
+		}
+	}
+
+	if id, err := DeviceID([]byte("865328021234567\r\n" + rmcMunich)); err != nil || id != "865328021234567" {
+		t.Errorf("DeviceID() = %q, %v", id, err)
+	}
+	if _, err := DeviceID([]byte(rmcMunich + "\r\n")); !errors.Is(err, ErrNoDeviceID) {
+		t.Errorf("DeviceID() error = %v, want %v", err, ErrNoDeviceID)
+	}
+}
@@ -0,0 +1,202 @@
+// Package osmand implements the OsmAnd HTTP protocol used by phone trackers
+// such as OsmAnd and Traccar Client. Each request carries one position as
+// query or form parameters:
+//
+//	?id=123456&lat=52.52&lon=13.40&timestamp=1665836113&speed=12&bearing=90&batt=80
+package osmand
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"tracking/internal/core/model"
+	"tracking/internal/core/util"
+)
+
+// Common OsmAnd errors
+var (
+	ErrMissingDeviceID   = errors.New("missing OsmAnd device id")
+	ErrInvalidCoordinate = errors.New("invalid coordinate value")
+	ErrInvalidTimestamp  = errors.New("invalid timestamp value")
+	ErrInvalidValue      = errors.New("invalid parameter value")
+)
+
+// Timestamps above this are milliseconds rather than seconds
+const millisecondThreshold = 1e12
+
+type OsmAndData struct {
+	DeviceID  string
+	Latitude  float64
+	Longitude float64
+	Altitude  float64
+	Speed     float64 // km/h
+	Course    float64
+	Accuracy  float64
+	Timestamp time.Time
+	Valid     bool
+	Status    map[string]interface{}
+}
+
+type Decoder struct {
+	debug bool
+	clock util.Clock
+}
+
+func NewDecoder() *Decoder {
+	return &Decoder{
+		debug: false,
+		clock: util.SystemClock,
+	}
+}
+
+func (d *Decoder) EnableDebug(enable bool) {
+	d.debug = enable
+}
+
+// SetClock sets the clock used when a request carries no timestamp
+func (d *Decoder) SetClock(clock util.Clock) {
+	d.clock = clock
+}
+
+func (d *Decoder) logDebug(format string, v ...interface{}) {
+	if d.debug {
+		log.Printf("[OsmAnd] "+format, v...)
+	}
+}
+
+// Decode reads a position from request parameters. Speed is sent in knots.
+func (d *Decoder) Decode(values url.Values) (*OsmAndData, error) {
+	d.logDebug("Decoding parameters: %s", values.Encode())
+
+	result := &OsmAndData{
+		DeviceID: first(values, "id", "deviceid"),
+		Valid:    true,
+		Status:   make(map[string]interface{}),
+	}
+	if result.DeviceID == "" {
+		return nil, ErrMissingDeviceID
+	}
+
+	var err error
+	if result.Latitude, err = parseCoordinate(values.Get("lat"), 90); err != nil {
+		return nil, fmt.Errorf("invalid latitude: %w", err)
+	}
+	if result.Longitude, err = parseCoordinate(values.Get("lon"), 180); err != nil {
+		return nil, fmt.Errorf("invalid longitude: %w", err)
+	}
+
+	if result.Timestamp, err = d.parseTimestamp(values.Get("timestamp")); err != nil {
+		return nil, err
+	}
+
+	optional := []struct {
+		value  string
+		target *float64
+	}{
+		{first(values, "altitude"), &result.Altitude},
+		{first(values, "speed"), &result.Speed},
+		{first(values, "bearing", "heading"), &result.Course},
+		{first(values, "accuracy"), &result.Accuracy},
+	}
+	for _, field := range optional {
+		if field.value == "" {
+			continue
+		}
+		value, err := strconv.ParseFloat(field.value, 64)
+		if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidValue, field.value)
+		}
+		*field.target = value
+	}
+	result.Speed *= 1.852 // Convert knots to km/h
+
+	if valid := values.Get("valid"); valid != "" {
+		result.Valid, _ = strconv.ParseBool(valid)
+	}
+	if battery := first(values, "batt", "battery"); battery != "" {
+		if level, err := strconv.ParseFloat(battery, 64); err == nil && level >= 0 && level <= 100 {
+			result.Status["batteryLevel"] = level
+		}
+	}
+	if charge := values.Get("charge"); charge != "" {
+		result.Status["charge"], _ = strconv.ParseBool(charge)
+	}
+	if result.Accuracy > 0 {
+		result.Status["accuracy"] = result.Accuracy
+	}
+	// Vehicle trackers built on the protocol report the engine hour meter
+	if hours := values.Get("hours"); hours != "" {
+		if meter, err := strconv.ParseFloat(hours, 64); err == nil && meter >= 0 && !math.IsInf(meter, 0) {
+			result.Status[model.AttributeHourMeter] = meter
+		}
+	}
+
+	return result, nil
+}
+
+func (d *Decoder) ToPosition(deviceID string, data *OsmAndData) *model.Position {
+	position := model.NewPosition(deviceID, data.Latitude, data.Longitude)
+	position.Altitude = data.Altitude
+	position.Speed = data.Speed
+	position.Course = data.Course
+	position.Valid = data.Valid
+	position.Timestamp = data.Timestamp
+	position.Protocol = "osmand"
+
+	for k, v := range data.Status {
+		position.Status[k] = v
+	}
+	return position
+}
+
+// parseTimestamp accepts Unix seconds, Unix milliseconds or RFC 3339, and
+// uses the current time when the parameter is absent
+func (d *Decoder) parseTimestamp(value string) (time.Time, error) {
+	if value == "" {
+		return d.clock.Now(), nil
+	}
+
+	if number, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if number > millisecondThreshold {
+			return time.UnixMilli(number).UTC(), nil
+		}
+		return time.Unix(number, 0).UTC(), nil
+	}
+
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05"} {
+		if ts, err := time.Parse(layout, value); err == nil {
+			return ts.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%w: %s", ErrInvalidTimestamp, value)
+}
+
+func parseCoordinate(value string, limit float64) (float64, error) {
+	coordinate, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || math.IsNaN(coordinate) {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidCoordinate, value)
+	}
+	return checkCoordinate(coordinate, limit)
+}
+
+func checkCoordinate(coordinate, limit float64) (float64, error) {
+	if coordinate < -limit || coordinate > limit {
+		return 0, fmt.Errorf("%w: %f out of range", ErrInvalidCoordinate, coordinate)
+	}
+	return coordinate, nil
+}
+
+// first returns the first non-empty parameter among the given names
+func first(values url.Values, names ...string) string {
+	for _, name := range names {
+		if value := values.Get(name); value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,225 @@
+package osmand
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+	"tracking/internal/core/util"
+)
+
+func TestDecode(t *testing.T) {
+	now := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		query   string
+		want    *OsmAndData
+		wantErr error
+	}{
+		{
+			name:  "traccar client report",
+			query: "id=123456&lat=52.5200&lon=13.4050&timestamp=1665836113&altitude=34.5&speed=10&bearing=90&accuracy=4.2&batt=81&charge=true",
+			want: &OsmAndData{
+				DeviceID:  "123456",
+				Latitude:  52.52,
+				Longitude: 13.405,
+				Altitude:  34.5,
+				Speed:     18.52,
+				Course:    90,
+				Accuracy:  4.2,
+				Timestamp: time.Unix(1665836113, 0).UTC(),
+				Valid:     true,
+				Status:    map[string]interface{}{"batteryLevel": 81.0, "charge": true, "accuracy": 4.2},
+			},
+		},
+		{
+			name:  "millisecond timestamp and heading alias",
+			query: "deviceid=abc&lat=-33.86&lon=151.21&timestamp=1665836113250&heading=180&valid=false",
+			want: &OsmAndData{
+				DeviceID:  "abc",
+				Latitude:  -33.86,
+				Longitude: 151.21,
+				Course:    180,
+				Timestamp: time.UnixMilli(1665836113250).UTC(),
+				Status:    map[string]interface{}{},
+			},
+		},
+		{
+			name:  "engine hour meter",
+			query: "id=abc&lat=1&lon=2&timestamp=1665836113&hours=1234.5",
+			want: &OsmAndData{
+				DeviceID:  "abc",
+				Latitude:  1,
+				Longitude: 2,
+				Timestamp: time.Unix(1665836113, 0).UTC(),
+				Valid:     true,
+				Status:    map[string]interface{}{"hourMeter": 1234.5},
+			},
+		},
+		{
+			name:  "RFC 3339 timestamp",
+			query: "id=abc&lat=1&lon=2&timestamp=2022-10-15T12:15:13Z",
+			want: &OsmAndData{
+				DeviceID:  "abc",
+				Latitude:  1,
+				Longitude: 2,
+				Timestamp: time.Date(2022, 10, 15, 12, 15, 13, 0, time.UTC),
+				Valid:     true,
+				Status:    map[string]interface{}{},
+			},
+		},
+		{
+			name:  "missing timestamp uses the clock",
+			query: "id=abc&lat=1&lon=2",
+			want: &OsmAndData{
+				DeviceID:  "abc",
+				Latitude:  1,
+				Longitude: 2,
+				Timestamp: now,
+				Valid:     true,
+				Status:    map[string]interface{}{},
+			},
+		},
+		{name: "missing id", query: "lat=1&lon=2", wantErr: ErrMissingDeviceID},
+		{name: "latitude out of range", query: "id=abc&lat=91&lon=2", wantErr: ErrInvalidCoordinate},
+		{name: "missing longitude", query: "id=abc&lat=1", wantErr: ErrInvalidCoordinate},
+		{name: "NaN coordinate", query: "id=abc&lat=NaN&lon=2", wantErr: ErrInvalidCoordinate},
+		{name: "invalid timestamp", query: "id=abc&lat=1&lon=2&timestamp=yesterday", wantErr: ErrInvalidTimestamp},
+		{name: "invalid speed", query: "id=abc&lat=1&lon=2&speed=fast", wantErr: ErrInvalidValue},
+	}
+
+	decoder := NewDecoder()
+	decoder.SetClock(util.NewFixedClock(now))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatalf("ParseQuery() error: %v", err)
+			}
+
+			got, err := decoder.Decode(values)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Decode() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Decode() unexpected error: %v", err)
+			}
+
+			if got.DeviceID != tt.want.DeviceID || got.Valid != tt.want.Valid || !got.Timestamp.Equal(tt.want.Timestamp) {
+				t.Errorf("Decode() = %s valid=%v at %v, want %s valid=%v at %v",
+					got.DeviceID, got.Valid, got.Timestamp, tt.want.DeviceID, tt.want.Valid, tt.want.Timestamp)
+			}
+			for _, field := range []struct {
+				name      string
+				got, want float64
+			}{
+				{"Latitude", got.Latitude, tt.want.Latitude},
+				{"Longitude", got.Longitude, tt.want.Longitude},
+				{"Altitude", got.Altitude, tt.want.Altitude},
+				{"Speed", got.Speed, tt.want.Speed},
+				{"Course", got.Course, tt.want.Course},
+				{"Accuracy", got.Accuracy, tt.want.Accuracy},
+			} {
+				if diff := field.got - field.want; diff > 1e-6 || diff < -1e-6 {
+					t.Errorf("%s = %v, want %v", field.name, field.got, field.want)
+				}
+			}
+			if len(got.Status) != len(tt.want.Status) {
+				t.Errorf("Status = %v, want %v", got.Status, tt.want.Status)
+			}
+			for k, v := range tt.want.Status {
+				if got.Status[k] != v {
+					t.Errorf("Status[%s] = %v, want %v", k, got.Status[k], v)
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeJSON(t *testing.T) {
+	decoder := NewDecoder()
+	decoder.SetClock(util.NewFixedClock(time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)))
+
+	body := `{"device_id":"123456","location":{"timestamp":"2022-10-15T12:15:13.250Z",` +
+		`"coords":{"latitude":52.52,"longitude":13.405,"accuracy":4.2,"speed":5,"heading":450,"altitude":34.5},` +
+		`"is_moving":true,"odometer":1200,"event":"motionchange","battery":{"level":0.81,"is_charging":true},` +
+		`"activity":{"type":"in_vehicle"}}}`
+	got, err := decoder.DecodeJSON([]byte(body))
+	if err != nil {
+		t.Fatalf("DecodeJSON() unexpected error: %v", err)
+	}
+	if got.DeviceID != "123456" || got.Latitude != 52.52 || got.Longitude != 13.405 || got.Altitude != 34.5 {
+		t.Errorf("DecodeJSON() = %+v", got)
+	}
+	if want := time.Date(2022, 10, 15, 12, 15, 13, 250e6, time.UTC); !got.Timestamp.Equal(want) {
+		t.Errorf("Timestamp = %v, want %v", got.Timestamp, want)
+	}
+	if got.Speed != 18 || got.Course != 90 || got.Accuracy != 4.2 {
+		t.Errorf("Speed = %v, course = %v, accuracy = %v, want 18 km/h, 90, 4.2", got.Speed, got.Course, got.Accuracy)
+	}
+	want := map[string]interface{}{
+		"batteryLevel": 81.0, "charge": true, "accuracy": 4.2, "motion": true,
+		"odometer": 1200.0, "event": "motionchange", "activity": "in_vehicle",
+	}
+	if len(got.Status) != len(want) {
+		t.Errorf("Status = %v, want %v", got.Status, want)
+	}
+	for k, v := range want {
+		if got.Status[k] != v {
+			t.Errorf("Status[%s] = %v, want %v", k, got.Status[k], v)
+		}
+	}
+
+	// Unknown speed and heading are sent as -1
+	got, err = decoder.DecodeJSON([]byte(`{"device_id":"abc","location":{"coords":{"latitude":1,"longitude":2,"speed":-1,"heading":-1}}}`))
+	if err != nil {
+		t.Fatalf("DecodeJSON() unexpected error: %v", err)
+	}
+	if got.Speed != 0 || got.Course != 0 || !got.Timestamp.Equal(decoder.clock.Now()) {
+		t.Errorf("DecodeJSON() = %+v, want no speed or course at the clock's time", got)
+	}
+
+	for _, tt := range []struct {
+		name    string
+		body    string
+		wantErr error
+	}{
+		{"not JSON", "id=abc&lat=1&lon=2", ErrInvalidValue},
+		{"missing device", `{"location":{"coords":{"latitude":1,"longitude":2}}}`, ErrMissingDeviceID},
+		{"missing coordinates", `{"device_id":"abc","location":{"coords":{"latitude":1}}}`, ErrInvalidCoordinate},
+		{"latitude out of range", `{"device_id":"abc","location":{"coords":{"latitude":91,"longitude":2}}}`, ErrInvalidCoordinate},
+		{"invalid timestamp", `{"device_id":"abc","location":{"timestamp":"yesterday","coords":{"latitude":1,"longitude":2}}}`, ErrInvalidTimestamp},
+	} {
+		if _, err := decoder.DecodeJSON([]byte(tt.body)); !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: DecodeJSON() error = %v, want %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestToPosition(t *testing.T) {
+	data := &OsmAndData{
+		DeviceID:  "abc",
+		Latitude:  1,
+		Longitude: 2,
+		Speed:     18.52,
+		Timestamp: time.Date(2022, 10, 15, 12, 15, 13, 0, time.UTC),
+		Valid:     true,
+		Status:    map[string]interface{}{"batteryLevel": 81.0},
+	}
+
+	position := NewDecoder().ToPosition("device-1", data)
+	if position.DeviceID != "device-1" || position.Protocol != "osmand" {
+		t.Errorf("Position = %s/%s, want device-1/osmand", position.DeviceID, position.Protocol)
+	}
+	if !position.Timestamp.Equal(data.Timestamp) || position.Speed != data.Speed {
+		t.Errorf("Position = %v at %v, want %v at %v", position.Speed, position.Timestamp, data.Speed, data.Timestamp)
+	}
+	if position.Status["batteryLevel"] != 81.0 {
+		t.Errorf("batteryLevel = %v, want 81", position.Status["batteryLevel"])
+	}
+}
@@ -0,0 +1,107 @@
+package osmand
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// jsonReport is the body Traccar Client posts since version 8, with speed
+// in m/s and the battery level as a fraction:
+//
+//	{"device_id":"123456","location":{"timestamp":"2022-10-15T12:15:13.000Z",
+//	 "coords":{"latitude":52.52,"longitude":13.405,"speed":5,"heading":90},
+//	 "is_moving":true,"odometer":1200,"battery":{"level":0.81,"is_charging":true}}}
+type jsonReport struct {
+	DeviceID string `json:"device_id"`
+	Location struct {
+		Timestamp string `json:"timestamp"`
+		Coords    struct {
+			Latitude  *float64 `json:"latitude"`
+			Longitude *float64 `json:"longitude"`
+			Altitude  float64  `json:"altitude"`
+			Speed     float64  `json:"speed"`
+			Heading   float64  `json:"heading"`
+			Accuracy  float64  `json:"accuracy"`
+		} `json:"coords"`
+		IsMoving *bool    `json:"is_moving"`
+		Odometer *float64 `json:"odometer"`
+		Event    string   `json:"event"`
+		Battery  *struct {
+			Level      float64 `json:"level"`
+			IsCharging bool    `json:"is_charging"`
+		} `json:"battery"`
+		Activity *struct {
+			Type string `json:"type"`
+		} `json:"activity"`
+	} `json:"location"`
+}
+
+// DecodeJSON reads a position from a Traccar Client JSON body
+func (d *Decoder) DecodeJSON(body []byte) (*OsmAndData, error) {
+	d.logDebug("Decoding body: %s", body)
+
+	var report jsonReport
+	if err := json.Unmarshal(body, &report); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidValue, err)
+	}
+	result := &OsmAndData{
+		DeviceID: strings.TrimSpace(report.DeviceID),
+		Valid:    true,
+		Status:   make(map[string]interface{}),
+	}
+	if result.DeviceID == "" {
+		return nil, ErrMissingDeviceID
+	}
+
+	location := report.Location
+	coords := location.Coords
+	if coords.Latitude == nil || coords.Longitude == nil {
+		return nil, fmt.Errorf("%w: missing coordinates", ErrInvalidCoordinate)
+	}
+	var err error
+	if result.Latitude, err = checkCoordinate(*coords.Latitude, 90); err != nil {
+		return nil, fmt.Errorf("invalid latitude: %w", err)
+	}
+	if result.Longitude, err = checkCoordinate(*coords.Longitude, 180); err != nil {
+		return nil, fmt.Errorf("invalid longitude: %w", err)
+	}
+	if result.Timestamp, err = d.parseTimestamp(location.Timestamp); err != nil {
+		return nil, err
+	}
+
+	// Unknown values are sent as -1
+	if coords.Speed > 0 {
+		result.Speed = coords.Speed * 3.6 // Convert m/s to km/h
+	}
+	if coords.Heading >= 0 {
+		result.Course = math.Mod(coords.Heading, 360)
+	}
+	result.Altitude = coords.Altitude
+	if coords.Accuracy > 0 {
+		result.Accuracy = coords.Accuracy
+		result.Status["accuracy"] = coords.Accuracy
+	}
+
+	if location.IsMoving != nil {
+		result.Status["motion"] = *location.IsMoving
+	}
+	if location.Odometer != nil && *location.Odometer >= 0 {
+		result.Status["odometer"] = *location.Odometer
+	}
+	if location.Event != "" {
+		result.Status["event"] = location.Event
+	}
+	if battery := location.Battery; battery != nil {
+		if battery.Level >= 0 && battery.Level <= 1 {
+			result.Status["batteryLevel"] = math.Round(battery.Level * 100)
+		}
+		result.Status["charge"] = battery.IsCharging
+	}
+	if activity := location.Activity; activity != nil && activity.Type != "" {
+		result.Status["activity"] = activity.Type
+	}
+
+	return result, nil
+}
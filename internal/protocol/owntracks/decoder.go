@@ -0,0 +1,228 @@
+// Package owntracks implements the JSON payloads of the OwnTracks phone app,
+// published over MQTT or posted over HTTP. Locations look like
+//
+//	{"_type":"location","tid":"JD","lat":52.52,"lon":13.405,"tst":1665836113,
+//	 "acc":12,"alt":34,"vel":18,"cog":90,"batt":81,"bs":2,"conn":"m",
+//	 "t":"u","inregions":["home"]}
+//
+// with the speed in km/h. Other payload types (transitions, waypoints,
+// cards) carry no position and decode without a fix.
+package owntracks
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+	"tracking/internal/core/model"
+	"tracking/internal/core/util"
+)
+
+// Common OwnTracks errors
+var (
+	ErrInvalidPayload    = errors.New("invalid OwnTracks payload")
+	ErrInvalidCoordinate = errors.New("invalid coordinate value")
+	ErrInvalidTopic      = errors.New("invalid OwnTracks topic")
+)
+
+const typeLocation = "location"
+
+// Battery states reported in bs
+var batteryStates = map[int]string{
+	1: "unplugged",
+	2: "charging",
+	3: "full",
+}
+
+// Report triggers reported in t
+var triggers = map[string]string{
+	"p": "ping",
+	"c": "region",
+	"b": "beacon",
+	"r": "request",
+	"u": "manual",
+	"t": "timer",
+	"v": "frequent",
+}
+
+// Connectivity reported in conn
+var connections = map[string]string{
+	"w": "wifi",
+	"m": "mobile",
+	"o": "offline",
+}
+
+// payload holds the location fields read; other keys are ignored
+type payload struct {
+	Type         string   `json:"_type"`
+	TrackerID    string   `json:"tid"`
+	Latitude     *float64 `json:"lat"`
+	Longitude    *float64 `json:"lon"`
+	Timestamp    int64    `json:"tst"`
+	Accuracy     float64  `json:"acc"`
+	Altitude     float64  `json:"alt"`
+	Vertical     float64  `json:"vac"`
+	Velocity     float64  `json:"vel"`
+	Course       *float64 `json:"cog"`
+	Battery      *float64 `json:"batt"`
+	BatteryState int      `json:"bs"`
+	Pressure     float64  `json:"p"` // kPa
+	Trigger      string   `json:"t"`
+	Conn         string   `json:"conn"`
+	InRegions    []string `json:"inregions"`
+}
+
+type OwnTracksData struct {
+	Type      string // Payload type; only locations have a fix
+	TrackerID string // Two letter ID shown on maps
+	Latitude  float64
+	Longitude float64
+	Altitude  float64
+	Speed     float64 // km/h
+	Course    float64
+	Timestamp time.Time
+	Status    map[string]interface{}
+}
+
+// HasFix reports whether the payload is a location
+func (d *OwnTracksData) HasFix() bool {
+	return d.Type == typeLocation
+}
+
+type Decoder struct {
+	debug bool
+	clock util.Clock
+}
+
+func NewDecoder() *Decoder {
+	return &Decoder{
+		debug: false,
+		clock: util.SystemClock,
+	}
+}
+
+func (d *Decoder) EnableDebug(enable bool) {
+	d.debug = enable
+}
+
+// SetClock sets the clock used for locations without a timestamp
+func (d *Decoder) SetClock(clock util.Clock) {
+	d.clock = clock
+}
+
+func (d *Decoder) logDebug(format string, v ...interface{}) {
+	if d.debug {
+		log.Printf("[OwnTracks] "+format, v...)
+	}
+}
+
+// Decode reads one JSON payload
+func (d *Decoder) Decode(data []byte) (*OwnTracksData, error) {
+	d.logDebug("Decoding payload: %s", data)
+
+	var p payload
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPayload, err)
+	}
+	if p.Type == "" {
+		return nil, fmt.Errorf("%w: missing _type", ErrInvalidPayload)
+	}
+	result := &OwnTracksData{
+		Type:      p.Type,
+		TrackerID: p.TrackerID,
+		Status:    make(map[string]interface{}),
+	}
+	if !result.HasFix() {
+		d.logDebug("Ignoring %s payload", p.Type)
+		return result, nil
+	}
+
+	if p.Latitude == nil || p.Longitude == nil {
+		return nil, fmt.Errorf("%w: missing coordinates", ErrInvalidCoordinate)
+	}
+	var err error
+	if result.Latitude, err = checkCoordinate(*p.Latitude, 90); err != nil {
+		return nil, fmt.Errorf("invalid latitude: %w", err)
+	}
+	if result.Longitude, err = checkCoordinate(*p.Longitude, 180); err != nil {
+		return nil, fmt.Errorf("invalid longitude: %w", err)
+	}
+
+	result.Timestamp = d.clock.Now()
+	if p.Timestamp > 0 {
+		result.Timestamp = time.Unix(p.Timestamp, 0).UTC()
+	}
+	result.Altitude = p.Altitude
+	if p.Velocity > 0 {
+		result.Speed = p.Velocity
+	}
+	if p.Course != nil && *p.Course >= 0 {
+		result.Course = math.Mod(*p.Course, 360)
+	}
+
+	if p.Accuracy > 0 {
+		result.Status["accuracy"] = p.Accuracy
+	}
+	if p.Vertical > 0 {
+		result.Status["verticalAccuracy"] = p.Vertical
+	}
+	if p.Battery != nil && *p.Battery >= 0 && *p.Battery <= 100 {
+		result.Status["batteryLevel"] = *p.Battery
+	}
+	if state, ok := batteryStates[p.BatteryState]; ok {
+		result.Status["batteryState"] = state
+		result.Status["charge"] = p.BatteryState != 1
+	}
+	if p.Pressure > 0 {
+		result.Status["pressure"] = p.Pressure
+	}
+	if trigger, ok := triggers[p.Trigger]; ok {
+		result.Status["trigger"] = trigger
+	}
+	if conn, ok := connections[p.Conn]; ok {
+		result.Status["connection"] = conn
+	}
+	if len(p.InRegions) > 0 {
+		result.Status["regions"] = p.InRegions
+	}
+	if p.TrackerID != "" {
+		result.Status["trackerId"] = p.TrackerID
+	}
+
+	return result, nil
+}
+
+func (d *Decoder) ToPosition(deviceID string, data *OwnTracksData) *model.Position {
+	position := model.NewPosition(deviceID, data.Latitude, data.Longitude)
+	position.Altitude = data.Altitude
+	position.Speed = data.Speed
+	position.Course = data.Course
+	position.Valid = true
+	position.Timestamp = data.Timestamp
+	position.Protocol = "owntracks"
+
+	for k, v := range data.Status {
+		position.Status[k] = v
+	}
+	return position
+}
+
+// DeviceFromTopic returns the device name of an owntracks/<user>/<device>
+// topic, which is the unique ID the device is registered with
+func DeviceFromTopic(topic string) (string, error) {
+	parts := strings.Split(topic, "/")
+	if len(parts) != 3 || parts[1] == "" || parts[2] == "" {
+		return "", fmt.Errorf("%w: %q, expected owntracks/<user>/<device>", ErrInvalidTopic, topic)
+	}
+	return parts[2], nil
+}
+
+func checkCoordinate(coordinate, limit float64) (float64, error) {
+	if math.IsNaN(coordinate) || coordinate < -limit || coordinate > limit {
+		return 0, fmt.Errorf("%w: %f out of range", ErrInvalidCoordinate, coordinate)
+	}
+	return coordinate, nil
+}
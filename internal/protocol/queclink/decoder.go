@@ -0,0 +1,349 @@
+// Package queclink implements the Queclink @Track ASCII protocol spoken by
+// the GL200/GL300 personal trackers and the GV vehicle trackers
+package queclink
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+	"tracking/internal/core/model"
+	"tracking/internal/core/util"
+)
+
+// Common Queclink errors
+var (
+	ErrInvalidHeader      = errors.New("invalid Queclink frame header")
+	ErrInvalidFormat      = errors.New("invalid Queclink data format")
+	ErrInvalidCoordinate  = errors.New("invalid coordinate value")
+	ErrInvalidMessageType = errors.New("unsupported message type")
+)
+
+// Frames look like
+//
+//	+RESP:GTFRI,02010B,135790246811220,,0,0,1,1,4.3,92,70.0,121.354335,31.222073,20090214013254,0460,0000,18d8,6141,00,,20090214093254,11F0$
+//
+// that is the report name, protocol version, IMEI and device name, fields
+// that depend on the report and model, then one or more fixes of twelve
+// fields each: GPS accuracy, speed km/h, azimuth, altitude, longitude,
+// latitude, GPS time, MCC, MNC, LAC, cell ID and a reserved field. The frame
+// ends with the send time and a hex count number the server acknowledges.
+// Reports buffered while the device had no network start with +BUFF.
+const (
+	prefixReport   = "+RESP:GT"
+	prefixBuffered = "+BUFF:GT"
+	prefixAck      = "+ACK:GT"
+	frameEnd       = "$"
+
+	// Report types
+	reportFixed       = "FRI" // Scheduled report, possibly several fixes
+	reportGeofence    = "GEO"
+	reportSOS         = "SOS"
+	reportIgnitionOn  = "IGN"
+	reportIgnitionOff = "IGF"
+	reportHeartbeat   = "HBD"
+
+	fixFields  = 12
+	timeLayout = "20060102150405"
+	minFields  = 5 // Type, version, IMEI, send time, count
+)
+
+// multiFixReports carry a fix count before their fixes
+var multiFixReports = map[string]bool{
+	reportFixed:    true,
+	reportGeofence: true,
+	reportSOS:      true,
+}
+
+type Decoder struct {
+	debug bool
+	clock util.Clock
+}
+
+func NewDecoder() *Decoder {
+	return &Decoder{
+		debug: false,
+		clock: util.SystemClock,
+	}
+}
+
+func (d *Decoder) EnableDebug(enable bool) {
+	d.debug = enable
+}
+
+// SetClock sets the clock used for fixes without a usable GPS time
+func (d *Decoder) SetClock(clock util.Clock) {
+	d.clock = clock
+}
+
+func (d *Decoder) logDebug(format string, v ...interface{}) {
+	if d.debug {
+		log.Printf("[Queclink] "+format, v...)
+	}
+}
+
+// Report is one decoded frame
+type Report struct {
+	Type     string // Report name without the GT prefix, such as FRI
+	Version  string // Protocol version, echoed in heartbeat ACKs
+	IMEI     string
+	Count    string // Count number the acknowledgement repeats
+	Buffered bool   // Sent from memory after a loss of coverage
+	Records  []*QueclinkData
+}
+
+// QueclinkData is one fix of a report
+type QueclinkData struct {
+	Latitude  float64
+	Longitude float64
+	Altitude  float64
+	Speed     float64
+	Course    float64
+	Timestamp time.Time
+	Valid     bool
+	Accuracy  int // GPS accuracy level, 0 without a fix
+	Cell      *model.CellTower
+	Status    map[string]interface{}
+}
+
+// IsFrame reports whether data is a Queclink report or heartbeat
+func IsFrame(data []byte) bool {
+	s := string(data)
+	return strings.HasPrefix(s, prefixReport) || strings.HasPrefix(s, prefixBuffered) || strings.HasPrefix(s, prefixAck)
+}
+
+// DeviceID returns the IMEI a frame reports with
+func DeviceID(data []byte) (string, error) {
+	_, fields, err := split(data)
+	if err != nil {
+		return "", err
+	}
+	if fields[2] == "" {
+		return "", fmt.Errorf("%w: missing IMEI", ErrInvalidFormat)
+	}
+	return fields[2], nil
+}
+
+// split returns the frame prefix and its comma separated fields, the first
+// being the message name such as GTFRI
+func split(data []byte) (string, []string, error) {
+	s := strings.TrimSuffix(strings.TrimSpace(string(data)), frameEnd)
+	prefix, body, ok := strings.Cut(s, ":")
+	if !ok || !IsFrame(data) {
+		return "", nil, fmt.Errorf("%w: expected +RESP:GT, +BUFF:GT or +ACK:GT", ErrInvalidHeader)
+	}
+	fields := strings.Split(body, ",")
+	if len(fields) < minFields {
+		return "", nil, fmt.Errorf("%w: got %d fields, need at least %d", ErrInvalidFormat, len(fields), minFields)
+	}
+	return prefix, fields, nil
+}
+
+// Decode reads a frame. Reports whose fixes cannot be located, such as
+// those sent without a fix, decode with no records so they are still
+// acknowledged.
+func (d *Decoder) Decode(data []byte) (*Report, error) {
+	d.logDebug("Received %q", data)
+
+	prefix, fields, err := split(data)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{
+		Type:     strings.TrimPrefix(fields[0], "GT"),
+		Version:  fields[1],
+		IMEI:     fields[2],
+		Count:    fields[len(fields)-1],
+		Buffered: prefix == "+BUFF",
+	}
+
+	if prefix == "+ACK" {
+		if report.Type != reportHeartbeat {
+			return nil, fmt.Errorf("%w: +ACK:GT%s", ErrInvalidMessageType, report.Type)
+		}
+		return report, nil
+	}
+
+	switch report.Type {
+	case reportFixed, reportGeofence, reportSOS, reportIgnitionOn, reportIgnitionOff:
+	default:
+		return nil, fmt.Errorf("%w: GT%s", ErrInvalidMessageType, report.Type)
+	}
+
+	start := findFix(fields)
+	if start < 0 {
+		d.logDebug("No fix in GT%s report from %s", report.Type, report.IMEI)
+		return report, nil
+	}
+
+	count := 1
+	if multiFixReports[report.Type] {
+		if n, err := strconv.Atoi(fields[start-1]); err == nil && n > 1 {
+			count = n
+		}
+	}
+	if start+count*fixFields > len(fields)-2 {
+		return nil, fmt.Errorf("%w: %d fixes do not fit in %d fields", ErrInvalidFormat, count, len(fields))
+	}
+
+	for i := 0; i < count; i++ {
+		record, err := d.decodeFix(fields[start+i*fixFields : start+(i+1)*fixFields])
+		if err != nil {
+			return nil, fmt.Errorf("fix %d: %w", i, err)
+		}
+		d.applyReport(report, fields, start, record)
+		report.Records = append(report.Records, record)
+	}
+
+	// GL200 style reports end with the battery level, send time and count
+	if tail := fields[start+count*fixFields:]; len(tail) == 3 {
+		if battery, err := strconv.ParseUint(tail[0], 10, 8); err == nil && battery <= 100 {
+			for _, record := range report.Records {
+				record.Status["battery"] = uint8(battery)
+			}
+		}
+	}
+
+	d.logDebug("Decoded GT%s with %d fixes", report.Type, len(report.Records))
+	return report, nil
+}
+
+// findFix returns the index of the first fix, recognised by its longitude,
+// latitude and GPS time, or -1. The fields before it vary between models.
+func findFix(fields []string) int {
+	for i := 3; i+fixFields <= len(fields)-2; i++ {
+		if isDecimal(fields[i+4]) && isDecimal(fields[i+5]) && isTime(fields[i+6]) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (d *Decoder) decodeFix(fields []string) (*QueclinkData, error) {
+	record := &QueclinkData{Status: make(map[string]interface{})}
+
+	var err error
+	if record.Longitude, err = strconv.ParseFloat(fields[4], 64); err != nil || record.Longitude < -180 || record.Longitude > 180 {
+		return nil, fmt.Errorf("%w: longitude %s", ErrInvalidCoordinate, fields[4])
+	}
+	if record.Latitude, err = strconv.ParseFloat(fields[5], 64); err != nil || record.Latitude < -90 || record.Latitude > 90 {
+		return nil, fmt.Errorf("%w: latitude %s", ErrInvalidCoordinate, fields[5])
+	}
+
+	record.Accuracy, _ = strconv.Atoi(fields[0])
+	record.Valid = record.Accuracy > 0
+	record.Speed, _ = strconv.ParseFloat(fields[1], 64) // Already km/h
+	record.Course, _ = strconv.ParseFloat(fields[2], 64)
+	record.Altitude, _ = strconv.ParseFloat(fields[3], 64)
+
+	if ts, err := time.Parse(timeLayout, fields[6]); err == nil {
+		record.Timestamp = ts
+	} else {
+		d.logDebug("Failed to parse GPS time %s: %v", fields[6], err)
+	}
+
+	record.Cell = parseCell(fields[7:11])
+	return record, nil
+}
+
+// applyReport sets the attributes a report type adds to each of its fixes
+func (d *Decoder) applyReport(report *Report, fields []string, start int, record *QueclinkData) {
+	record.Status["report"] = report.Type
+	switch report.Type {
+	case reportSOS:
+		record.Status["alarm"] = "sos"
+	case reportGeofence:
+		// The geofence ID and whether it was entered precede the fix count
+		record.Status["alarm"] = "geofence"
+		if start >= 3 {
+			record.Status["geofenceId"] = fields[start-3]
+			if fields[start-2] == "1" {
+				record.Status["geofence"] = "enter"
+			} else {
+				record.Status["geofence"] = "exit"
+			}
+		}
+	case reportIgnitionOn:
+		record.Status["ignition"] = true
+	case reportIgnitionOff:
+		record.Status["ignition"] = false
+	}
+}
+
+// parseCell reads MCC and MNC in decimal and LAC and cell ID in hex
+func parseCell(fields []string) *model.CellTower {
+	mcc, err1 := strconv.Atoi(fields[0])
+	mnc, err2 := strconv.Atoi(fields[1])
+	lac, err3 := strconv.ParseInt(fields[2], 16, 32)
+	cid, err4 := strconv.ParseInt(fields[3], 16, 32)
+	if err1 != nil || err2 != nil || err3 != nil || err4 != nil || mcc == 0 {
+		return nil
+	}
+	return &model.CellTower{
+		MobileCountryCode: mcc,
+		MobileNetworkCode: mnc,
+		LocationAreaCode:  int(lac),
+		CellID:            int(cid),
+	}
+}
+
+func isDecimal(field string) bool {
+	if !strings.Contains(field, ".") {
+		return false
+	}
+	_, err := strconv.ParseFloat(field, 64)
+	return err == nil
+}
+
+func isTime(field string) bool {
+	if len(field) != len(timeLayout) {
+		return false
+	}
+	_, err := time.Parse(timeLayout, field)
+	return err == nil
+}
+
+// Response is the server acknowledgement of a frame. Heartbeats must be
+// answered for the device to keep its session; report acknowledgements
+// are only awaited by devices configured for SACK and ignored otherwise.
+func (d *Decoder) Response(report *Report) []byte {
+	if report.Type == reportHeartbeat {
+		return []byte(fmt.Sprintf("+SACK:GTHBD,%s,%s$", report.Version, report.Count))
+	}
+	return []byte(fmt.Sprintf("+SACK:%s$", report.Count))
+}
+
+// ToPosition converts one fix of a report
+func (d *Decoder) ToPosition(deviceID string, data *QueclinkData) *model.Position {
+	position := model.NewPosition(deviceID, data.Latitude, data.Longitude)
+	position.Altitude = data.Altitude
+	position.Speed = data.Speed
+	position.Course = data.Course
+	position.Valid = data.Valid
+	position.SetDecodedTime(data.Timestamp, d.clock.Now())
+	position.Protocol = "queclink"
+
+	position.Status = make(map[string]interface{}, len(data.Status)+1)
+	for k, v := range data.Status {
+		position.Status[k] = v
+	}
+	position.Status["accuracy"] = data.Accuracy
+
+	if data.Cell != nil {
+		position.Network = &model.Network{RadioType: "gsm"}
+		position.Network.AddCellTower(*data.Cell)
+	}
+	return position
+}
+
+// ToPositions converts every fix of a report, keeping their order
+func (d *Decoder) ToPositions(deviceID string, report *Report) []*model.Position {
+	positions := make([]*model.Position, 0, len(report.Records))
+	for _, record := range report.Records {
+		positions = append(positions, d.ToPosition(deviceID, record))
+	}
+	return positions
+}
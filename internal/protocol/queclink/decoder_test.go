@@ -0,0 +1,240 @@
+package queclink
+
+import (
+	"errors"
+	"testing"
+	"time"
+	"tracking/internal/core/model"
+	"tracking/internal/core/util"
+)
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		typ      string
+		buffered bool
+		count    string
+		records  int
+		check    func(t *testing.T, records []*QueclinkData)
+		wantErr  error
+	}{
+		{
+			name:    "GL200 fixed report",
+			data:    "+RESP:GTFRI,02010B,135790246811220,,0,0,1,1,4.3,92,70.0,121.354335,31.222073,20090214013254,0460,0000,18d8,6141,00,80,20090214093254,11F0$",
+			typ:     "FRI",
+			count:   "11F0",
+			records: 1,
+			check: func(t *testing.T, records []*QueclinkData) {
+				r := records[0]
+				if r.Latitude != 31.222073 || r.Longitude != 121.354335 || r.Speed != 4.3 || r.Course != 92 || r.Altitude != 70 {
+					t.Errorf("Fix = %+v", r)
+				}
+				if !r.Valid || !r.Timestamp.Equal(time.Date(2009, 2, 14, 1, 32, 54, 0, time.UTC)) {
+					t.Errorf("Valid = %v, timestamp = %v", r.Valid, r.Timestamp)
+				}
+				want := model.CellTower{MobileCountryCode: 460, MobileNetworkCode: 0, LocationAreaCode: 0x18d8, CellID: 0x6141}
+				if r.Cell == nil || *r.Cell != want {
+					t.Errorf("Cell = %+v, want %+v", r.Cell, want)
+				}
+				if r.Status["battery"] != uint8(80) || r.Status["report"] != "FRI" {
+					t.Errorf("Status = %v", r.Status)
+				}
+			},
+		},
+		{
+			name:    "GV500 fixed report with VIN",
+			data:    "+RESP:GTFRI,1F0101,135790246811220,1G1JC5444R7252367,,,10,1,1,0.0,0,115.8,117.129356,31.839248,20130403051845,0460,0000,5678,2079,00,0,4.4,,,,,,,,20130403051849,11F0$",
+			typ:     "FRI",
+			count:   "11F0",
+			records: 1,
+			check: func(t *testing.T, records []*QueclinkData) {
+				if r := records[0]; r.Latitude != 31.839248 || r.Longitude != 117.129356 || r.Altitude != 115.8 {
+					t.Errorf("Fix = %+v", r)
+				}
+			},
+		},
+		{
+			name:    "report with two fixes",
+			data:    "+RESP:GTFRI,02010B,135790246811220,,0,0,2,1,4.3,92,70.0,121.354335,31.222073,20090214013254,0460,0000,18d8,6141,00,1,12.0,180,71.0,121.354400,31.222000,20090214013324,0460,0000,18d8,6141,00,,20090214093254,11F1$",
+			typ:     "FRI",
+			count:   "11F1",
+			records: 2,
+			check: func(t *testing.T, records []*QueclinkData) {
+				if records[1].Speed != 12 || !records[1].Timestamp.After(records[0].Timestamp) {
+					t.Errorf("Second fix = %+v", records[1])
+				}
+			},
+		},
+		{
+			name:    "SOS report",
+			data:    "+RESP:GTSOS,02010B,135790246811220,,0,0,1,1,0.0,0,70.0,121.354335,31.222073,20090214013254,0460,0000,18d8,6141,00,,20090214093254,11F2$",
+			typ:     "SOS",
+			count:   "11F2",
+			records: 1,
+			check: func(t *testing.T, records []*QueclinkData) {
+				if records[0].Status["alarm"] != "sos" {
+					t.Errorf("Status = %v", records[0].Status)
+				}
+			},
+		},
+		{
+			name:    "geofence entry",
+			data:    "+RESP:GTGEO,02010B,135790246811220,,3,1,1,1,30.5,45,70.0,121.354335,31.222073,20090214013254,0460,0000,18d8,6141,00,,20090214093254,11F3$",
+			typ:     "GEO",
+			count:   "11F3",
+			records: 1,
+			check: func(t *testing.T, records []*QueclinkData) {
+				status := records[0].Status
+				if status["alarm"] != "geofence" || status["geofenceId"] != "3" || status["geofence"] != "enter" {
+					t.Errorf("Status = %v", status)
+				}
+			},
+		},
+		{
+			name:    "ignition on",
+			data:    "+RESP:GTIGN,1F0101,135790246811220,,,123:45:67,1,0.0,0,115.8,117.129356,31.839248,20130403051845,0460,0000,5678,2079,00,12345.6,20130403051849,11F4$",
+			typ:     "IGN",
+			count:   "11F4",
+			records: 1,
+			check: func(t *testing.T, records []*QueclinkData) {
+				if records[0].Status["ignition"] != true {
+					t.Errorf("Status = %v", records[0].Status)
+				}
+			},
+		},
+		{
+			name:     "buffered ignition off",
+			data:     "+BUFF:GTIGF,1F0101,135790246811220,,,600,1,0.0,0,115.8,117.129356,31.839248,20130403051845,0460,0000,5678,2079,00,12345.6,20130403051849,11F5$",
+			typ:      "IGF",
+			buffered: true,
+			count:    "11F5",
+			records:  1,
+			check: func(t *testing.T, records []*QueclinkData) {
+				if records[0].Status["ignition"] != false {
+					t.Errorf("Status = %v", records[0].Status)
+				}
+			},
+		},
+		{
+			name:    "report without fix",
+			data:    "+RESP:GTFRI,02010B,135790246811220,,0,0,1,0,,,,,,,0460,0000,18d8,6141,00,,20090214093254,11F6$",
+			typ:     "FRI",
+			count:   "11F6",
+			records: 0,
+		},
+		{
+			name:  "heartbeat",
+			data:  "+ACK:GTHBD,02010B,135790246811220,,20090214093254,11F7$",
+			typ:   "HBD",
+			count: "11F7",
+		},
+		{
+			name:    "unsupported report",
+			data:    "+RESP:GTXYZ,02010B,135790246811220,,20090214093254,11F8$",
+			wantErr: ErrInvalidMessageType,
+		},
+		{
+			name:    "invalid header",
+			data:    "*HQ,4210051415,V1,121513,A#",
+			wantErr: ErrInvalidHeader,
+		},
+		{
+			name:    "too few fields",
+			data:    "+RESP:GTFRI,02010B$",
+			wantErr: ErrInvalidFormat,
+		},
+		{
+			name:    "latitude out of range",
+			data:    "+RESP:GTFRI,02010B,135790246811220,,0,0,1,1,4.3,92,70.0,121.354335,91.222073,20090214013254,0460,0000,18d8,6141,00,,20090214093254,11F0$",
+			wantErr: ErrInvalidCoordinate,
+		},
+	}
+
+	decoder := NewDecoder()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report, err := decoder.Decode([]byte(tt.data))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Decode() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if report.Type != tt.typ || report.Count != tt.count || report.Buffered != tt.buffered || report.IMEI != "135790246811220" {
+				t.Errorf("Report = %+v", report)
+			}
+			if len(report.Records) != tt.records {
+				t.Fatalf("Got %d records, want %d", len(report.Records), tt.records)
+			}
+			if tt.check != nil {
+				tt.check(t, report.Records)
+			}
+		})
+	}
+}
+
+func TestDeviceID(t *testing.T) {
+	id, err := DeviceID([]byte("+ACK:GTHBD,02010B,135790246811220,,20090214093254,11F7$"))
+	if err != nil || id != "135790246811220" {
+		t.Errorf("DeviceID() = %q, %v", id, err)
+	}
+	if _, err := DeviceID([]byte("+RESP:GTFRI,02010B,,,20090214093254,11F0$")); !errors.Is(err, ErrInvalidFormat) {
+		t.Errorf("DeviceID() without IMEI error = %v", err)
+	}
+}
+
+func TestResponse(t *testing.T) {
+	decoder := NewDecoder()
+	tests := []struct {
+		data string
+		want string
+	}{
+		{"+ACK:GTHBD,02010B,135790246811220,,20090214093254,11F7$", "+SACK:GTHBD,02010B,11F7$"},
+		{"+RESP:GTSOS,02010B,135790246811220,,0,0,1,1,0.0,0,70.0,121.354335,31.222073,20090214013254,0460,0000,18d8,6141,00,,20090214093254,11F2$", "+SACK:11F2$"},
+	}
+	for _, tt := range tests {
+		report, err := decoder.Decode([]byte(tt.data))
+		if err != nil {
+			t.Fatalf("Decode() error = %v", err)
+		}
+		if got := string(decoder.Response(report)); got != tt.want {
+			t.Errorf("Response() = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestToPositions(t *testing.T) {
+	now := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	decoder := NewDecoder()
+	decoder.SetClock(util.NewFixedClock(now))
+
+	report, err := decoder.Decode([]byte("+RESP:GTFRI,02010B,135790246811220,,0,0,1,0,0.0,0,0.0,121.354335,31.222073,20091314013254,0460,0000,18d8,6141,00,,20090214093254,11F0$"))
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	// The GPS time has month 13, so the frame is not found by its time and
+	// carries no fix
+	if len(report.Records) != 0 {
+		t.Fatalf("Got %d records for an invalid GPS time, want 0", len(report.Records))
+	}
+
+	report, err = decoder.Decode([]byte("+RESP:GTFRI,02010B,135790246811220,,0,0,1,0,4.3,92,70.0,121.354335,31.222073,20090214013254,0460,0000,18d8,6141,00,,20090214093254,11F0$"))
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	positions := decoder.ToPositions("device-1", report)
+	if len(positions) != 1 {
+		t.Fatalf("Got %d positions, want 1", len(positions))
+	}
+	position := positions[0]
+	if position.Protocol != "queclink" || position.DeviceID != "device-1" || position.Valid {
+		t.Errorf("Position = %+v, want an invalid queclink fix for device-1", position)
+	}
+	if position.Network == nil || len(position.Network.CellTowers) != 1 || position.Network.CellTowers[0].CellID != 0x6141 {
+		t.Errorf("Network = %+v", position.Network)
+	}
+}
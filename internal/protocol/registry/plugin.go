@@ -0,0 +1,52 @@
+package registry
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"plugin"
+	"sort"
+)
+
+// loaded records the plugin files already opened; the runtime runs a
+// plugin's init functions only once
+var loaded = make(map[string]bool)
+
+// LoadDir opens every Go plugin (*.so) in dir not opened yet and returns
+// how many it opened. Plugins register their protocols from init functions
+// and must be built with the same Go version and module versions as the
+// server; the runtime supports them on Linux, FreeBSD and macOS with cgo.
+func LoadDir(dir string) (int, error) {
+	if _, err := os.Stat(dir); err != nil {
+		return 0, fmt.Errorf("plugin directory: %w", err)
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, "*.so"))
+	if err != nil {
+		return 0, err
+	}
+	sort.Strings(paths)
+
+	opened := 0
+	for _, path := range paths {
+		mutex.RLock()
+		done := loaded[path]
+		mutex.RUnlock()
+		if done {
+			continue
+		}
+
+		count := len(Protocols())
+		if _, err := plugin.Open(path); err != nil {
+			return opened, fmt.Errorf("failed to load plugin %s: %v", path, err)
+		}
+		if len(Protocols()) == count {
+			return opened, fmt.Errorf("plugin %s registered no protocol", path)
+		}
+
+		mutex.Lock()
+		loaded[path] = true
+		mutex.Unlock()
+		opened++
+	}
+	return opened, nil
+}
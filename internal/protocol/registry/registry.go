@@ -0,0 +1,129 @@
+// Package registry holds the optional protocol decoders: those compiled in
+// behind build tags and those loaded from Go plugins at startup. Built-in
+// protocols with connection state, such as GT06 and Teltonika, are wired
+// into the servers directly.
+package registry
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"tracking/internal/core/model"
+	"tracking/internal/core/util"
+)
+
+// Decoder decodes the frames of one protocol for one server
+type Decoder interface {
+	EnableDebug(enable bool)
+	SetClock(clock util.Clock)
+	// DecodePositions returns the positions a frame carries, none for
+	// heartbeats, and the reply to send, nil for none
+	DecodePositions(deviceID string, data []byte) ([]*model.Position, []byte, error)
+}
+
+// Protocol describes a protocol whose every frame can be recognised and
+// names its device, so the servers need no state beyond the connection
+type Protocol struct {
+	Name       string
+	IsFrame    func(data []byte) bool
+	DeviceID   func(data []byte) (string, error)
+	NewDecoder func() Decoder
+}
+
+var (
+	protocols = make(map[string]*Protocol)
+	mutex     sync.RWMutex
+)
+
+// Register adds a protocol, usually from the init function of its package.
+// It panics when the protocol is incomplete or its name is taken.
+func Register(protocol *Protocol) {
+	if protocol.Name == "" || protocol.IsFrame == nil || protocol.DeviceID == nil || protocol.NewDecoder == nil {
+		panic(fmt.Sprintf("registry: incomplete protocol %q", protocol.Name))
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if _, exists := protocols[protocol.Name]; exists {
+		panic(fmt.Sprintf("registry: protocol %q registered twice", protocol.Name))
+	}
+	protocols[protocol.Name] = protocol
+}
+
+// Protocols returns the registered protocols ordered by name
+func Protocols() []*Protocol {
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	list := make([]*Protocol, 0, len(protocols))
+	for _, protocol := range protocols {
+		list = append(list, protocol)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// Names returns the names of the registered protocols in order
+func Names() []string {
+	list := Protocols()
+	names := make([]string, len(list))
+	for i, protocol := range list {
+		names[i] = protocol.Name
+	}
+	return names
+}
+
+// Set is one server's decoders for the registered protocols
+type Set struct {
+	protocols []*Protocol
+	decoders  map[string]Decoder
+}
+
+// NewSet creates a decoder for every protocol registered so far
+func NewSet() *Set {
+	set := &Set{
+		protocols: Protocols(),
+		decoders:  make(map[string]Decoder),
+	}
+	for _, protocol := range set.protocols {
+		set.decoders[protocol.Name] = protocol.NewDecoder()
+	}
+	return set
+}
+
+// Match returns the first protocol, by name, recognising a frame, or nil
+func (s *Set) Match(data []byte) *Protocol {
+	for _, protocol := range s.protocols {
+		if protocol.IsFrame(data) {
+			return protocol
+		}
+	}
+	return nil
+}
+
+// Lookup returns a registered protocol by name, or nil
+func (s *Set) Lookup(name string) *Protocol {
+	for _, protocol := range s.protocols {
+		if protocol.Name == name {
+			return protocol
+		}
+	}
+	return nil
+}
+
+// Decoder returns the set's decoder for a protocol
+func (s *Set) Decoder(name string) Decoder {
+	return s.decoders[name]
+}
+
+func (s *Set) EnableDebug(enable bool) {
+	for _, decoder := range s.decoders {
+		decoder.EnableDebug(enable)
+	}
+}
+
+func (s *Set) SetClock(clock util.Clock) {
+	for _, decoder := range s.decoders {
+		decoder.SetClock(clock)
+	}
+}
@@ -0,0 +1,278 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"tracking/internal/core/model"
+)
+
+// The built-in benchmark corpus holds a session per file: hex encoded
+// frames of binary protocols in .hex files and text frames in .txt files,
+// one per line, with lines starting "# " as comments
+//
+//go:embed corpus/*
+var corpusFiles embed.FS
+
+// stage is a step of the pipeline a benchmark times
+type stage int
+
+const (
+	stageDecode       stage = iota // Protocol detection, login and decoding of a read
+	stageDecodedHooks              // Position hooks before storage, such as filters
+	stageLookup                    // Reading the latest position of the device
+	stageStore                     // Writing the batch
+	stageStoredHooks               // Position hooks and subscribers after storage
+	stageReply                     // Writing the reply to the device
+	stageCount
+)
+
+var stageNames = [stageCount]string{"decode", "decodedHooks", "lookup", "store", "storedHooks", "reply"}
+
+// stageTimer sums the time spent in each stage across the connections of a
+// benchmark. A nil timer records nothing.
+type stageTimer struct {
+	nanos  [stageCount]atomic.Int64
+	counts [stageCount]atomic.Int64
+}
+
+// record adds the time since started to a stage that handled n items
+func (t *stageTimer) record(stage stage, started time.Time, n int) {
+	if t == nil {
+		return
+	}
+	t.nanos[stage].Add(int64(time.Since(started)))
+	t.counts[stage].Add(int64(n))
+}
+
+// BenchmarkCorpus returns the sessions of the built-in corpus, a device
+// of each of the common protocols logging in and reporting
+func BenchmarkCorpus() ([]model.BenchmarkSession, error) {
+	files, err := corpusFiles.ReadDir("corpus")
+	if err != nil {
+		return nil, err
+	}
+
+	var sessions []model.BenchmarkSession
+	for _, file := range files {
+		data, err := corpusFiles.ReadFile(path.Join("corpus", file.Name()))
+		if err != nil {
+			return nil, err
+		}
+		ext := path.Ext(file.Name())
+		session := model.BenchmarkSession{Name: strings.TrimSuffix(file.Name(), ext)}
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "# ") {
+				continue
+			}
+			if ext == ".txt" {
+				line = hex.EncodeToString([]byte(line))
+			}
+			session.Frames = append(session.Frames, line)
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, nil
+}
+
+// IdentifyFrame returns the protocol of the first frame a device sends and
+// the identifier it reports, as the server would on a new connection
+func (s *TCPServer) IdentifyFrame(frame []byte) (string, string, error) {
+	protocol := s.detectProtocol(frame)
+	uniqueID, err := s.deviceIdentifier(frame, protocol)
+	if err != nil {
+		return "", "", err
+	}
+	return protocol, uniqueID, nil
+}
+
+// benchmarkReplay is a session ready to be replayed
+type benchmarkReplay struct {
+	name     string
+	protocol string
+	uniqueID string
+	frames   [][]byte
+}
+
+// Benchmark feeds sessions through the whole pipeline as fast as the server
+// takes them, without sockets, and reports the throughput and where the
+// time went. Nil sessions replay the built-in corpus. Each round replays
+// every session at once, each as a connection from a temporary device
+// removed afterwards, so sessions must identify devices that are not
+// registered. Positions are stored, and events raised, as for any device;
+// benchmarks belong on servers set up for capacity tests.
+func (s *TCPServer) Benchmark(sessions []model.BenchmarkSession, rounds int) (*model.BenchmarkReport, error) {
+	if sessions == nil {
+		corpus, err := BenchmarkCorpus()
+		if err != nil {
+			return nil, err
+		}
+		sessions = corpus
+	}
+	if rounds < 1 {
+		rounds = 1
+	}
+
+	replays := make([]benchmarkReplay, len(sessions))
+	seen := make(map[string]bool)
+	for i, session := range sessions {
+		replay := benchmarkReplay{name: session.Name}
+		for _, frame := range session.Frames {
+			data, err := hex.DecodeString(frame)
+			if err != nil || len(data) == 0 {
+				return nil, fmt.Errorf("session %s has a frame that is not hex encoded", session.Name)
+			}
+			replay.frames = append(replay.frames, data)
+		}
+		if len(replay.frames) == 0 {
+			return nil, fmt.Errorf("session %s has no frames", session.Name)
+		}
+
+		protocol, uniqueID, err := s.IdentifyFrame(replay.frames[0])
+		if err != nil {
+			return nil, fmt.Errorf("session %s does not identify a device: %v", session.Name, err)
+		}
+		if seen[uniqueID] {
+			return nil, fmt.Errorf("session %s identifies device %s as an earlier session does", session.Name, uniqueID)
+		}
+		seen[uniqueID] = true
+		if device, err := s.deviceRepo.FindByUniqueID(uniqueID); err != nil {
+			return nil, err
+		} else if device != nil {
+			return nil, fmt.Errorf("session %s identifies device %s, which is registered", session.Name, uniqueID)
+		}
+		replay.protocol, replay.uniqueID = protocol, uniqueID
+		replays[i] = replay
+	}
+
+	timer := &stageTimer{}
+	var frames atomic.Int64
+	started := time.Now()
+	for round := 0; round < rounds; round++ {
+		var wg sync.WaitGroup
+		errs := make([]error, len(replays))
+		for i := range replays {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				sent, err := s.replay(&replays[i], timer)
+				frames.Add(int64(sent))
+				errs[i] = err
+			}(i)
+		}
+		wg.Wait()
+		for _, err := range errs {
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	elapsed := time.Since(started)
+
+	report := &model.BenchmarkReport{
+		Sessions:  len(replays),
+		Rounds:    rounds,
+		Frames:    frames.Load(),
+		Positions: timer.counts[stageDecodedHooks].Load(),
+		Stored:    timer.counts[stageStoredHooks].Load(),
+		Seconds:   elapsed.Seconds(),
+		Stages:    make([]model.StageTiming, stageCount),
+	}
+	if elapsed > 0 {
+		report.FramesPerSecond = float64(report.Frames) / elapsed.Seconds()
+		report.PositionsPerSecond = float64(report.Stored) / elapsed.Seconds()
+	}
+
+	var total, slowest int64
+	for i := range timer.nanos {
+		total += timer.nanos[i].Load()
+	}
+	for i := range report.Stages {
+		nanos, count := timer.nanos[i].Load(), timer.counts[i].Load()
+		timing := model.StageTiming{
+			Name:    stageNames[i],
+			Count:   count,
+			TotalMs: float64(nanos) / float64(time.Millisecond),
+		}
+		if count > 0 {
+			timing.AverageMs = timing.TotalMs / float64(count)
+		}
+		if total > 0 {
+			timing.Share = float64(nanos) / float64(total)
+		}
+		if nanos > slowest {
+			slowest = nanos
+			report.Bottleneck = timing.Name
+		}
+		report.Stages[i] = timing
+	}
+	return report, nil
+}
+
+// replayConn is the server's end of a replayed connection. It signals each
+// read, so the next frame is sent once the server has handled the last.
+type replayConn struct {
+	net.Conn
+	reading chan struct{}
+}
+
+func (c *replayConn) Read(b []byte) (int, error) {
+	select {
+	case c.reading <- struct{}{}:
+	default:
+	}
+	return c.Conn.Read(b)
+}
+
+// replay sends the frames of a session over an in-memory connection from
+// a temporary device and returns how many the server read before the
+// connection closed
+func (s *TCPServer) replay(replay *benchmarkReplay, timer *stageTimer) (int, error) {
+	device := model.NewDevice("Benchmark "+replay.name, replay.uniqueID)
+	device.Protocol = replay.protocol
+	if err := s.deviceRepo.Create(device); err != nil {
+		return 0, fmt.Errorf("failed to create a device for session %s: %v", replay.name, err)
+	}
+	defer s.deviceRepo.Delete(device.ID)
+
+	serverConn, client := net.Pipe()
+	conn := &replayConn{Conn: serverConn, reading: make(chan struct{}, 1)}
+	done := make(chan struct{})
+	s.open.Add(1)
+	go func() {
+		defer close(done)
+		s.handleConnection(conn, timer)
+	}()
+	go io.Copy(io.Discard, client) // Replies are timed as written, not read
+
+	sent := 0
+	for _, frame := range replay.frames {
+		select {
+		case <-conn.reading:
+		case <-done: // Closed by the server, as on a failed login
+			return sent, nil
+		}
+		if _, err := client.Write(frame); err != nil {
+			break
+		}
+		sent++
+	}
+	select {
+	case <-conn.reading:
+	case <-done:
+	}
+	client.Close()
+	<-done
+	return sent, nil
+}
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// ipLimiter throttles connections and packets per remote IP with token
+// buckets holding a minute's allowance, so short bursts after a network
+// outage pass while a device or scanner in a reconnect loop is cut off.
+// A zero rate leaves that kind unlimited.
+type ipLimiter struct {
+	connectionsPerMinute int
+	packetsPerMinute     int
+	buckets              map[string]*ipBuckets
+	mutex                sync.Mutex
+}
+
+type ipBuckets struct {
+	connections tokenBucket
+	packets     tokenBucket
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+func newIPLimiter(connectionsPerMinute, packetsPerMinute int) *ipLimiter {
+	return &ipLimiter{
+		connectionsPerMinute: connectionsPerMinute,
+		packetsPerMinute:     packetsPerMinute,
+		buckets:              make(map[string]*ipBuckets),
+	}
+}
+
+// active reports whether any rate is limited
+func (l *ipLimiter) active() bool {
+	return l.connectionsPerMinute > 0 || l.packetsPerMinute > 0
+}
+
+// allowConnection takes a connection from the IP's allowance
+func (l *ipLimiter) allowConnection(addr net.Addr, now time.Time) bool {
+	if l.connectionsPerMinute <= 0 {
+		return true
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.bucketsFor(addr).connections.take(now, l.connectionsPerMinute)
+}
+
+// allowPacket takes a read from the IP's allowance
+func (l *ipLimiter) allowPacket(addr net.Addr, now time.Time) bool {
+	if l.packetsPerMinute <= 0 {
+		return true
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.bucketsFor(addr).packets.take(now, l.packetsPerMinute)
+}
+
+// prune forgets IPs whose allowances have refilled, which act as if unseen
+func (l *ipLimiter) prune(now time.Time) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	for ip, buckets := range l.buckets {
+		if now.Sub(buckets.connections.updated) >= time.Minute && now.Sub(buckets.packets.updated) >= time.Minute {
+			delete(l.buckets, ip)
+		}
+	}
+}
+
+func (l *ipLimiter) bucketsFor(addr net.Addr) *ipBuckets {
+	ip := addr.String()
+	if tcpAddr, ok := addr.(*net.TCPAddr); ok {
+		ip = tcpAddr.IP.String()
+	}
+	buckets, ok := l.buckets[ip]
+	if !ok {
+		buckets = &ipBuckets{}
+		l.buckets[ip] = buckets
+	}
+	return buckets
+}
+
+// take refills the bucket for the time passed and removes one token
+func (b *tokenBucket) take(now time.Time, perMinute int) bool {
+	capacity := float64(perMinute)
+	if b.updated.IsZero() {
+		b.tokens = capacity
+	} else if elapsed := now.Sub(b.updated); elapsed > 0 {
+		b.tokens = min(capacity, b.tokens+elapsed.Minutes()*capacity)
+	}
+	b.updated = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
@@ -0,0 +1,127 @@
+package server
+
+import (
+	"hash/fnv"
+	"sync"
+	"tracking/internal/core/model"
+)
+
+// ingestFrame holds the positions decoded from one frame of a device
+type ingestFrame struct {
+	deviceID  string
+	positions []*model.Position
+}
+
+// ingestPipeline stores positions on a pool of workers, so reading and
+// acknowledging frames does not wait on the database. Each device is
+// served by one worker, keeping its positions in order. A worker takes
+// every frame waiting in its queue, up to batchSize positions, at once.
+type ingestPipeline struct {
+	queues    []chan ingestFrame
+	batchSize int
+	store     func(deviceID string, positions []*model.Position)
+	stopped   bool
+	mutex     sync.RWMutex // Keeps enqueue from racing the final drain
+	stop      chan struct{}
+	done      sync.WaitGroup
+}
+
+func newIngestPipeline(workers, queueSize, batchSize int, store func(deviceID string, positions []*model.Position)) *ingestPipeline {
+	p := &ingestPipeline{
+		queues:    make([]chan ingestFrame, workers),
+		batchSize: max(batchSize, 1),
+		store:     store,
+		stop:      make(chan struct{}),
+	}
+	for i := range p.queues {
+		p.queues[i] = make(chan ingestFrame, max(queueSize/workers, 1))
+	}
+	return p
+}
+
+func (p *ingestPipeline) start() {
+	for _, queue := range p.queues {
+		p.done.Add(1)
+		go p.work(queue)
+	}
+}
+
+// enqueue hands the positions of a frame to the device's worker, failing
+// when its queue is full or the pipeline has stopped
+func (p *ingestPipeline) enqueue(deviceID string, positions []*model.Position) bool {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	if p.stopped {
+		return false
+	}
+
+	hash := fnv.New32a()
+	hash.Write([]byte(deviceID))
+	select {
+	case p.queues[hash.Sum32()%uint32(len(p.queues))] <- ingestFrame{deviceID, positions}:
+		return true
+	default:
+		return false
+	}
+}
+
+// shutdown stores every queued position and stops the workers
+func (p *ingestPipeline) shutdown() {
+	p.mutex.Lock()
+	if p.stopped {
+		p.mutex.Unlock()
+		return
+	}
+	p.stopped = true
+	p.mutex.Unlock()
+
+	close(p.stop)
+	p.done.Wait()
+}
+
+func (p *ingestPipeline) work(queue chan ingestFrame) {
+	defer p.done.Done()
+	for {
+		select {
+		case frame := <-queue:
+			p.process(p.collect(frame, queue))
+		case <-p.stop:
+			for len(queue) > 0 {
+				p.process(p.collect(<-queue, queue))
+			}
+			return
+		}
+	}
+}
+
+// collect adds the frames already waiting to the first, up to batchSize
+// positions
+func (p *ingestPipeline) collect(first ingestFrame, queue chan ingestFrame) []ingestFrame {
+	batch := []ingestFrame{first}
+	size := len(first.positions)
+	for size < p.batchSize {
+		select {
+		case frame := <-queue:
+			batch = append(batch, frame)
+			size += len(frame.positions)
+		default:
+			return batch
+		}
+	}
+	return batch
+}
+
+// process stores a batch one device at a time, in the order received
+func (p *ingestPipeline) process(batch []ingestFrame) {
+	var devices []string
+	positions := make(map[string][]*model.Position)
+	for _, frame := range batch {
+		if _, seen := positions[frame.deviceID]; !seen {
+			devices = append(devices, frame.deviceID)
+		}
+		positions[frame.deviceID] = append(positions[frame.deviceID], frame.positions...)
+	}
+	for _, deviceID := range devices {
+		p.store(deviceID, positions[deviceID])
+	}
+}
@@ -0,0 +1,163 @@
+package server
+
+import (
+	"sort"
+	"sync"
+	"time"
+	"tracking/internal/core/model"
+	"tracking/internal/core/util"
+)
+
+// DefaultOnlineTimeout is how long a datagram device stays online after
+// its last report
+const DefaultOnlineTimeout = 10 * time.Minute
+
+// Session is a device's entry in a SessionManager
+type Session struct {
+	info  model.DeviceSession
+	mutex sync.Mutex
+}
+
+// Touch records a packet received from the device
+func (s *Session) Touch(at time.Time) {
+	s.mutex.Lock()
+	s.info.LastSeen = at
+	s.mutex.Unlock()
+}
+
+// Count adds bytes received from and sent to the device
+func (s *Session) Count(bytesIn, bytesOut int64) {
+	s.mutex.Lock()
+	s.info.BytesIn += bytesIn
+	s.info.BytesOut += bytesOut
+	s.mutex.Unlock()
+}
+
+func (s *Session) snapshot() *model.DeviceSession {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	info := s.info
+	return &info
+}
+
+// SessionManager tracks the devices linked to the servers, one session per
+// device. A device is online while its TCP connection is open; datagram
+// devices hold no connection, so they are online until the timeout has
+// passed since their last report.
+type SessionManager struct {
+	sessions map[string]*Session
+	mutex    sync.RWMutex
+	clock    util.Clock
+	timeout  time.Duration
+}
+
+func NewSessionManager(clock util.Clock, timeout time.Duration) *SessionManager {
+	if timeout <= 0 {
+		timeout = DefaultOnlineTimeout
+	}
+	return &SessionManager{
+		sessions: make(map[string]*Session),
+		clock:    clock,
+		timeout:  timeout,
+	}
+}
+
+// Connect opens the session of a device that connected over TCP, replacing
+// any it held. The returned session is passed to Disconnect on close.
+func (m *SessionManager) Connect(deviceID, uniqueID, protocol, remoteAddr string) *Session {
+	now := m.clock.Now()
+	session := &Session{info: model.DeviceSession{
+		DeviceID:    deviceID,
+		UniqueID:    uniqueID,
+		Protocol:    protocol,
+		Transport:   "tcp",
+		RemoteAddr:  remoteAddr,
+		ConnectedAt: now,
+		LastSeen:    now,
+	}}
+
+	m.mutex.Lock()
+	m.sessions[deviceID] = session
+	m.mutex.Unlock()
+	return session
+}
+
+// Disconnect closes a TCP session. A device that reconnected before its old
+// connection closed keeps the new session.
+func (m *SessionManager) Disconnect(session *Session) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.sessions[session.info.DeviceID] == session {
+		delete(m.sessions, session.info.DeviceID)
+	}
+}
+
+// Datagram records a report from a datagram device, opening its session
+// when it had none or its last one timed out
+func (m *SessionManager) Datagram(deviceID, uniqueID, protocol, remoteAddr string) {
+	now := m.clock.Now()
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if session, ok := m.sessions[deviceID]; ok && m.online(session, now) {
+		session.mutex.Lock()
+		session.info.RemoteAddr = remoteAddr
+		session.info.LastSeen = now
+		session.mutex.Unlock()
+		return
+	}
+	m.sessions[deviceID] = &Session{info: model.DeviceSession{
+		DeviceID:    deviceID,
+		UniqueID:    uniqueID,
+		Protocol:    protocol,
+		Transport:   "udp",
+		RemoteAddr:  remoteAddr,
+		ConnectedAt: now,
+		LastSeen:    now,
+	}}
+}
+
+// Session returns the session of an online device, or nil
+func (m *SessionManager) Session(deviceID string) *model.DeviceSession {
+	m.mutex.RLock()
+	session, ok := m.sessions[deviceID]
+	m.mutex.RUnlock()
+	if !ok || !m.online(session, m.clock.Now()) {
+		return nil
+	}
+	return session.snapshot()
+}
+
+// Sessions returns the sessions of every online device, most recently
+// seen first. Timed out datagram sessions are dropped.
+func (m *SessionManager) Sessions() []*model.DeviceSession {
+	now := m.clock.Now()
+
+	m.mutex.Lock()
+	sessions := make([]*model.DeviceSession, 0, len(m.sessions))
+	for deviceID, session := range m.sessions {
+		if !m.online(session, now) {
+			delete(m.sessions, deviceID)
+			continue
+		}
+		sessions = append(sessions, session.snapshot())
+	}
+	m.mutex.Unlock()
+
+	sort.Slice(sessions, func(i, j int) bool {
+		if !sessions[i].LastSeen.Equal(sessions[j].LastSeen) {
+			return sessions[i].LastSeen.After(sessions[j].LastSeen)
+		}
+		return sessions[i].DeviceID < sessions[j].DeviceID
+	})
+	return sessions
+}
+
+func (m *SessionManager) online(session *Session, now time.Time) bool {
+	if session.info.Transport == "tcp" {
+		return true
+	}
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+	return now.Sub(session.info.LastSeen) < m.timeout
+}
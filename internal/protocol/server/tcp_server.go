@@ -2,54 +2,171 @@ package server
 
 import (
 	"bytes"
+	"context"
+	"crypto/tls"
 	"fmt"
 	"io"
 	"log"
 	"net"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 	"tracking/internal/core/model"
+	"tracking/internal/core/hook"
+	"tracking/internal/core/logging"
+	"tracking/internal/core/profile"
 	"tracking/internal/core/repository"
+	"tracking/internal/core/util"
+	"tracking/internal/protocol/coban"
+	"tracking/internal/protocol/egts"
 	"tracking/internal/protocol/gt06"
 	"tracking/internal/protocol/h02"
+	"tracking/internal/protocol/megastek"
+	"tracking/internal/protocol/nmea"
+	"tracking/internal/protocol/queclink"
+	"tracking/internal/protocol/registry"
 	"tracking/internal/protocol/teltonika"
+	"tracking/internal/protocol/watch"
 )
 
 type DeviceConnection struct {
 	conn          net.Conn
 	deviceID      string
+	uniqueID      string // Identifier the device reports with, used to address H02 commands
+	vendor        string // Watch vendor code, echoed in text commands
 	protocol      string
 	authenticated bool
-	lastSeen      int64
+	lastSeen      atomic.Int64  // Unix time of the last read, by the server clock
+	writeTimeout  time.Duration // Zero waits for writes indefinitely
+	gt06Decoder   *gt06.Decoder        // Chosen per device to honour model quirks
+	ignition      *bool                // Last ACC state reported by a GT06 status packet
+	nmeaStream    *nmea.Stream         // Pairs the sentences of an NMEA gateway
+	profile       *model.DeviceProfile // Nil when the device has no known model
+	commandSerial uint16
+	egtsSerial    uint16 // Numbers the EGTS packets and records sent to the device
+	writeMutex    sync.Mutex // Serialises replies and commands sent from other goroutines
+	session       *Session   // Nil until authenticated or without a session manager
+	timer         *stageTimer // Times the stages of a benchmark replay; nil otherwise
+
+	// Bytes read from and written to the connection, and the part of them
+	// handed to the traffic recorder
+	bytesIn    atomic.Int64
+	bytesOut   atomic.Int64
+	flushedIn  int64
+	flushedOut int64
+	flushedAt  time.Time
+
+	// unacknowledged holds the positions stored from a frame whose ACK was
+	// withheld, so a resent frame does not store them twice
+	unacknowledged map[string]bool
+}
+
+// write sends data to the device
+func (c *DeviceConnection) write(data []byte) error {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	if c.writeTimeout > 0 {
+		c.conn.SetWriteDeadline(time.Now().Add(c.writeTimeout))
+	}
+	n, err := c.conn.Write(data)
+	c.bytesOut.Add(int64(n))
+	if c.session != nil {
+		c.session.Count(0, int64(n))
+	}
+	return err
+}
+
+// nextCommandSerial numbers a command sent to a GT06 device
+func (c *DeviceConnection) nextCommandSerial() uint16 {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	c.commandSerial++
+	return c.commandSerial
+}
+
+// CommandQueue holds the commands waiting for devices to connect
+type CommandQueue interface {
+	DeliverPending(deviceID string)
+}
+
+// TrafficRecorder keeps the bytes devices exchange with the server
+type TrafficRecorder interface {
+	RecordTraffic(deviceID string, bytesIn, bytesOut int64)
 }
 
+// trafficFlushInterval is how often the traffic of an open connection is
+// handed to the recorder; the rest follows when it closes
+const trafficFlushInterval = time.Minute
+
 type TCPServer struct {
 	port             int
 	listener         net.Listener
 	deviceRepo       repository.DeviceRepository
 	positionRepo     repository.PositionRepository
 	gt06Decoder      *gt06.Decoder
+	gt06XORDecoder   *gt06.Decoder // For models whose profile marks XOR checksums
 	h02Decoder       *h02.Decoder
 	teltonikaDecoder *teltonika.Decoder
+	queclinkDecoder  *queclink.Decoder
+	cobanDecoder     *coban.Decoder
+	watchDecoder     *watch.Decoder
+	megastekDecoder  *megastek.Decoder
+	egtsDecoder      *egts.Decoder
+	nmeaDecoder      *nmea.Decoder
+	optional         *registry.Set // Protocols compiled in behind build tags or loaded from plugins
 	connections      map[string]*DeviceConnection
+	sessions         map[*DeviceConnection]bool // Every open connection, authenticated or not
 	mutex            sync.RWMutex
+	idleTimeout      time.Duration // Zero keeps silent connections open
+	writeTimeout     time.Duration
+	maxConnections   int // Zero leaves the number of open connections unlimited
+	open             atomic.Int64
+	limiter          *ipLimiter
+	pipeline         *ingestPipeline // Nil stores positions on the reading goroutine
+	reaperStop       chan struct{}
+	reaperDone       chan struct{}
 	debug            bool
+	levels           *logging.Levels // Decides debug logging in place of debug when set
+	clock            util.Clock
+	hooks            *hook.Registry
+	catalog          *profile.Catalog
+	sessionManager   *SessionManager // Nil leaves sessions untracked
+	commandQueue     CommandQueue    // Nil leaves queued commands undelivered
+	trafficRecorder  TrafficRecorder // Nil leaves traffic unrecorded
+	accepting        atomic.Bool // Whether the accept loop is running
+	tlsPort          int
+	tlsConfig        *tls.Config  // Nil leaves out the TLS listener
+	tlsListener      net.Listener
 }
 
 func NewTCPServer(port int, deviceRepo repository.DeviceRepository, positionRepo repository.PositionRepository) *TCPServer {
 	gt06Decoder := gt06.NewDecoder()
 	gt06Decoder.EnableDebug(true) // Enable debug logging for GT06
+	gt06XORDecoder := gt06.NewDecoder()
+	gt06XORDecoder.EnableDebug(true)
+	gt06XORDecoder.SetChecksumMode(gt06.ChecksumXOR)
 
 	return &TCPServer{
 		port:             port,
 		deviceRepo:       deviceRepo,
 		positionRepo:     positionRepo,
 		gt06Decoder:      gt06Decoder,
+		gt06XORDecoder:   gt06XORDecoder,
 		h02Decoder:       h02.NewDecoder(),
 		teltonikaDecoder: teltonika.NewDecoder(),
+		queclinkDecoder:  queclink.NewDecoder(),
+		cobanDecoder:     coban.NewDecoder(),
+		watchDecoder:     watch.NewDecoder(),
+		megastekDecoder:  megastek.NewDecoder(),
+		egtsDecoder:      egts.NewDecoder(),
+		nmeaDecoder:      nmea.NewDecoder(),
+		optional:         registry.NewSet(),
 		connections:      make(map[string]*DeviceConnection),
+		sessions:         make(map[*DeviceConnection]bool),
+		limiter:          newIPLimiter(0, 0),
 		debug:            true, // Enable debug logging by default
+		clock:            util.SystemClock,
 	}
 }
 
@@ -57,15 +174,125 @@ func NewTCPServer(port int, deviceRepo repository.DeviceRepository, positionRepo
 func (s *TCPServer) EnableDebug(enable bool) {
 	s.debug = enable
 	s.gt06Decoder.EnableDebug(enable)
+	s.gt06XORDecoder.EnableDebug(enable)
+	s.optional.EnableDebug(enable)
 	// Add similar debug toggles for other protocol decoders when implemented
 }
 
+// SetLogLevels has debug logging follow levels instead of EnableDebug, so
+// it can be raised for the server, the GT06 decoders or single devices
+// while they are connected
+func (s *TCPServer) SetLogLevels(levels *logging.Levels) {
+	s.levels = levels
+	gt06Debug := func() bool { return levels.Enabled(logging.ModuleGT06, logging.Debug) }
+	s.gt06Decoder.SetDebugSwitch(gt06Debug)
+	s.gt06XORDecoder.SetDebugSwitch(gt06Debug)
+}
+
+// SetClock sets the clock used for session bookkeeping and by the decoders
+func (s *TCPServer) SetClock(clock util.Clock) {
+	s.clock = clock
+	s.gt06Decoder.SetClock(clock)
+	s.gt06XORDecoder.SetClock(clock)
+	s.h02Decoder.SetClock(clock)
+	s.teltonikaDecoder.SetClock(clock)
+	s.queclinkDecoder.SetClock(clock)
+	s.cobanDecoder.SetClock(clock)
+	s.watchDecoder.SetClock(clock)
+	s.megastekDecoder.SetClock(clock)
+	s.egtsDecoder.SetClock(clock)
+	s.nmeaDecoder.SetClock(clock)
+	s.optional.SetClock(clock)
+}
+
+// SetHooks sets the registry notified of stored positions and session events
+func (s *TCPServer) SetHooks(hooks *hook.Registry) {
+	s.hooks = hooks
+}
+
+// SetSessions sets the manager tracking the sessions of connected devices
+func (s *TCPServer) SetSessions(sessions *SessionManager) {
+	s.sessionManager = sessions
+}
+
+// SetCommandQueue sets the queue whose commands are delivered when a device
+// logs in or sends a frame without positions, such as a heartbeat
+func (s *TCPServer) SetCommandQueue(queue CommandQueue) {
+	s.commandQueue = queue
+}
+
+// SetTrafficRecorder sets the recorder of the bytes read from and written
+// to authenticated devices, counted as TCP payload without headers
+func (s *TCPServer) SetTrafficRecorder(recorder TrafficRecorder) {
+	s.trafficRecorder = recorder
+}
+
+// SetCatalog sets the device model catalog used to adapt to model quirks and
+// to vet commands
+func (s *TCPServer) SetCatalog(catalog *profile.Catalog) {
+	s.catalog = catalog
+}
+
+// SetTimeouts sets how long a connection may stay silent before it is closed
+// and how long a write to a device may block; zero disables either. Dead
+// GPRS sessions otherwise hold their sockets open indefinitely.
+func (s *TCPServer) SetTimeouts(idle, write time.Duration) {
+	s.idleTimeout = idle
+	s.writeTimeout = write
+}
+
+// SetLimits caps the connections open at once and, per remote IP, the
+// connections accepted and reads handled per minute; zero leaves either
+// unlimited. Connections over a limit are closed. Devices behind a
+// carrier's NAT share an IP, so per-IP rates must allow for them.
+func (s *TCPServer) SetLimits(maxConnections, connectionsPerMinute, packetsPerMinute int) {
+	s.maxConnections = maxConnections
+	s.limiter = newIPLimiter(connectionsPerMinute, packetsPerMinute)
+}
+
+// SetIngestWorkers stores positions on a pool of workers fed from a queue
+// holding up to queueSize frames, each worker storing up to batchSize
+// positions at a time. Frames are acknowledged once queued, so slow writes
+// do not hold up devices; a full queue withholds the ACK and the device
+// resends. Zero workers store positions before acknowledging them.
+// Must be called before Start.
+func (s *TCPServer) SetIngestWorkers(workers, queueSize, batchSize int) {
+	if workers <= 0 {
+		s.pipeline = nil
+		return
+	}
+	s.pipeline = newIngestPipeline(workers, queueSize, batchSize, func(deviceID string, positions []*model.Position) {
+		s.ingest(context.Background(), hook.SourceTCP, deviceID, positions, nil)
+	})
+}
+
+// SetGT06ChecksumMode selects the checksum algorithm expected from GT06
+// devices whose model does not say otherwise
+func (s *TCPServer) SetGT06ChecksumMode(mode gt06.ChecksumMode) {
+	s.gt06Decoder.SetChecksumMode(mode)
+}
+
+func (s *TCPServer) debugging() bool {
+	if s.levels != nil {
+		return s.levels.Enabled(logging.ModuleTCPServer, logging.Debug)
+	}
+	return s.debug
+}
+
 func (s *TCPServer) logDebug(format string, v ...interface{}) {
-	if s.debug {
+	if s.debugging() {
 		log.Printf("[TCP Server] "+format, v...)
 	}
 }
 
+// logDevice writes the traffic of one device, when the server or that
+// device is logged at debug level
+func (s *TCPServer) logDevice(deviceID string, format string, v ...interface{}) {
+	if s.debugging() || (s.levels != nil && s.levels.DeviceEnabled(deviceID, logging.Debug)) {
+		log.Printf("[TCP Server] [%s] "+format, append([]interface{}{deviceID}, v...)...)
+	}
+}
+
 func (s *TCPServer) Start() error {
 	var err error
 	s.listener, err = net.Listen("tcp", fmt.Sprintf("0.0.0.0:%d", s.port))
@@ -74,29 +301,119 @@ func (s *TCPServer) Start() error {
 	}
 
 	s.logDebug("TCP server listening on port %d", s.port)
-	s.logDebug("Supported protocols: GT06, H02, Teltonika")
+	s.logDebug("Supported protocols: GT06, H02, Teltonika, Queclink, Coban, Watch")
+	if names := registry.Names(); len(names) > 0 {
+		s.logDebug("Optional protocols: %s", strings.Join(names, ", "))
+	}
 
-	go s.acceptConnections()
+	if s.pipeline != nil {
+		s.pipeline.start()
+	}
+	if err := s.listenTLS(); err != nil {
+		s.listener.Close()
+		return err
+	}
+	s.accepting.Store(true)
+	go func() {
+		defer s.accepting.Store(false)
+		s.acceptConnections(s.listener)
+	}()
+	if s.idleTimeout > 0 {
+		s.startReaper(min(s.idleTimeout, time.Minute))
+	} else if s.limiter.active() {
+		s.startReaper(time.Minute)
+	}
 	return nil
 }
 
+// Listening reports whether the server is accepting device connections
+func (s *TCPServer) Listening() bool {
+	return s.accepting.Load()
+}
+
+// Addr returns the address the server is listening on, or nil before Start
+func (s *TCPServer) Addr() net.Addr {
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Addr()
+}
+
 func (s *TCPServer) Stop() {
 	if s.listener != nil {
 		s.listener.Close()
 	}
+	if s.tlsListener != nil {
+		s.tlsListener.Close()
+	}
+	if s.reaperStop != nil {
+		close(s.reaperStop)
+		<-s.reaperDone
+		s.reaperStop = nil
+	}
 
-	// Close all active connections
+	// Close all open connections, authenticated or not
 	s.mutex.Lock()
-	for _, conn := range s.connections {
+	for conn := range s.sessions {
 		conn.conn.Close()
 	}
 	s.connections = make(map[string]*DeviceConnection)
 	s.mutex.Unlock()
+
+	if s.pipeline != nil {
+		s.pipeline.shutdown()
+	}
+}
+
+// startReaper runs ReapIdleConnections and forgets refilled per-IP
+// allowances every interval until Stop
+func (s *TCPServer) startReaper(interval time.Duration) {
+	s.reaperStop = make(chan struct{})
+	s.reaperDone = make(chan struct{})
+	go func() {
+		defer close(s.reaperDone)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.ReapIdleConnections()
+				s.limiter.prune(s.clock.Now())
+			case <-s.reaperStop:
+				return
+			}
+		}
+	}()
+}
+
+// ReapIdleConnections closes the connections that have sent nothing for
+// the idle timeout, by the server clock, and returns how many it closed.
+// Their handlers then clean up as for any disconnect.
+func (s *TCPServer) ReapIdleConnections() int {
+	if s.idleTimeout <= 0 {
+		return 0
+	}
+	cutoff := s.clock.Now().Add(-s.idleTimeout).Unix()
+
+	s.mutex.RLock()
+	var idle []*DeviceConnection
+	for deviceConn := range s.sessions {
+		if deviceConn.lastSeen.Load() < cutoff {
+			idle = append(idle, deviceConn)
+		}
+	}
+	s.mutex.RUnlock()
+
+	for _, deviceConn := range idle {
+		s.logDebug("Closing idle connection from %s (%s)", deviceConn.conn.RemoteAddr(), deviceConn.deviceID)
+		deviceConn.conn.Close()
+	}
+	return len(idle)
 }
 
-func (s *TCPServer) acceptConnections() {
+func (s *TCPServer) acceptConnections(listener net.Listener) {
 	for {
-		conn, err := s.listener.Accept()
+		conn, err := listener.Accept()
 		if err != nil {
 			if strings.Contains(err.Error(), "use of closed network connection") {
 				return
@@ -105,33 +422,134 @@ func (s *TCPServer) acceptConnections() {
 			continue
 		}
 
-		go s.handleConnection(conn)
+		if s.maxConnections > 0 && s.open.Load() >= int64(s.maxConnections) {
+			s.logDebug("Refusing connection from %s: %d connections open", conn.RemoteAddr(), s.maxConnections)
+			conn.Close()
+			continue
+		}
+		if !s.limiter.allowConnection(conn.RemoteAddr(), s.clock.Now()) {
+			s.logDebug("Refusing connection from %s: connection rate exceeded", conn.RemoteAddr())
+			conn.Close()
+			continue
+		}
+
+		s.open.Add(1)
+		go s.handleConnection(conn, nil)
 	}
 }
 
-func (s *TCPServer) authenticateDevice(data []byte, protocol string) (*model.Device, error) {
+// detectProtocol names the protocol of the first frame a device sends
+func (s *TCPServer) detectProtocol(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte{0x78, 0x78}) || bytes.HasPrefix(data, []byte{0x79, 0x79}):
+		return "gt06"
+	case egts.IsFrame(data):
+		return "egts"
+	case megastek.IsFrame(data):
+		return "megastek" // Before binary H02, which also starts with $
+	case bytes.HasPrefix(data, []byte("*HQ")) || h02.IsBinary(data):
+		return "h02"
+	case queclink.IsFrame(data):
+		return "queclink"
+	case coban.IsFrame(data):
+		return "coban"
+	case watch.IsFrame(data):
+		return "watch"
+	}
+	if optional := s.optional.Match(data); optional != nil {
+		return optional.Name
+	}
+	if nmea.IsFrame(data) {
+		return "nmea"
+	}
+	return "teltonika"
+}
+
+// deviceIdentifier extracts the identifier a device reports in a frame
+func (s *TCPServer) deviceIdentifier(data []byte, protocol string) (string, error) {
 	var deviceID string
 
 	// Extract device identifier based on protocol
 	switch protocol {
 	case "gt06":
-		if len(data) < 10 {
-			return nil, fmt.Errorf("data too short for GT06 protocol")
+		id, err := gt06.DeviceID(data)
+		if err != nil {
+			return "", err
 		}
-		deviceID = fmt.Sprintf("%X", data[4:10]) // IMEI in GT06
+		deviceID = id // IMEI in GT06, after a one or two byte length
 	case "h02":
-		parts := strings.Split(string(data), ",")
-		if len(parts) < 3 {
-			return nil, fmt.Errorf("invalid H02 protocol format")
+		id, err := h02.DeviceID(data)
+		if err != nil {
+			return "", err
+		}
+		deviceID = id // IMEI or 10 digit ID in H02
+	case "queclink":
+		id, err := queclink.DeviceID(data)
+		if err != nil {
+			return "", err
 		}
-		deviceID = parts[2] // IMEI in H02
+		deviceID = id // IMEI in Queclink
+	case "coban":
+		id, err := coban.DeviceID(data)
+		if err != nil {
+			return "", err
+		}
+		deviceID = id // IMEI in Coban
+	case "watch":
+		id, err := watch.DeviceID(data)
+		if err != nil {
+			return "", err
+		}
+		deviceID = id // Device ID between the vendor code and length
+	case "megastek":
+		id, err := megastek.DeviceID(data)
+		if err != nil {
+			return "", err
+		}
+		deviceID = id // IMEI after the $MGV tag
+	case "egts":
+		id, err := egts.DeviceID(data)
+		if err != nil {
+			return "", err
+		}
+		deviceID = id // IMEI or terminal ID of TERM_IDENTITY, else the object ID
+	case "nmea":
+		id, err := nmea.DeviceID(data)
+		if err != nil {
+			return "", err
+		}
+		deviceID = id // Registration line the gateway opens with
 	case "teltonika":
+		if teltonika.IsIMEIPacket(data) {
+			imei, err := teltonika.ParseIMEI(data)
+			if err != nil {
+				return "", err
+			}
+			deviceID = imei
+			break
+		}
 		if len(data) < 8 {
-			return nil, fmt.Errorf("data too short for Teltonika protocol")
+			return "", fmt.Errorf("data too short for Teltonika protocol")
 		}
 		deviceID = fmt.Sprintf("%X", data[0:8]) // IMEI in Teltonika
 	default:
-		return nil, fmt.Errorf("unknown protocol")
+		optional := s.optional.Lookup(protocol)
+		if optional == nil {
+			return "", fmt.Errorf("unknown protocol")
+		}
+		id, err := optional.DeviceID(data)
+		if err != nil {
+			return "", err
+		}
+		deviceID = id
+	}
+	return deviceID, nil
+}
+
+func (s *TCPServer) authenticateDevice(data []byte, protocol string) (*model.Device, error) {
+	deviceID, err := s.deviceIdentifier(data, protocol)
+	if err != nil {
+		return nil, err
 	}
 
 	// Check if it's a test device
@@ -143,8 +561,8 @@ func (s *TCPServer) authenticateDevice(data []byte, protocol string) (*model.Dev
 			UniqueID:   deviceID,
 			Status:     "active",
 			Protocol:   protocol,
-			CreatedAt:  time.Now(),
-			LastUpdate: time.Now(),
+			CreatedAt:  s.clock.Now(),
+			LastUpdate: s.clock.Now(),
 		}, nil
 	}
 
@@ -160,148 +578,893 @@ func (s *TCPServer) authenticateDevice(data []byte, protocol string) (*model.Dev
 	return device, nil
 }
 
-func (s *TCPServer) handleConnection(conn net.Conn) {
+// SendCommand delivers a command to a connected device. GT06 and H02
+// devices accept commands; the device's reply is raised as an
+// EventCommandResult.
+func (s *TCPServer) SendCommand(deviceID string, command gt06.Command) error {
+	deviceConn, err := s.commandConnection(deviceID, string(command))
+	if err != nil {
+		return err
+	}
+
+	var packet []byte
+	switch deviceConn.protocol {
+	case "gt06":
+		serial := deviceConn.nextCommandSerial()
+		packet, err = deviceConn.gt06Decoder.EncodeCommand(command, uint32(serial), serial)
+	case "h02":
+		packet, err = s.h02Decoder.EncodeCommand(deviceConn.uniqueID, h02.Command(command))
+	default:
+		err = fmt.Errorf("device %s uses %s, which does not support commands", deviceID, deviceConn.protocol)
+	}
+	if err != nil {
+		return err
+	}
+
+	return s.sendCommandPacket(deviceConn, string(command), packet)
+}
+
+// SendDeviceCommand delivers a queued command to a connected device
+func (s *TCPServer) SendDeviceCommand(deviceID string, command *model.Command) error {
+	switch command.Type {
+	case model.CommandSetInterval:
+		return s.SetReportInterval(deviceID, time.Duration(command.Interval)*time.Second)
+	case model.CommandSetCornerReporting:
+		return s.SetCornerReporting(deviceID, command.Angle)
+	}
+	return s.SendCommand(deviceID, gt06.Command(command.Type))
+}
+
+// Connected reports whether a device is connected and authenticated
+func (s *TCPServer) Connected(deviceID string) bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	_, ok := s.connections[deviceID]
+	return ok
+}
+
+// deliverCommands hands a device the commands queued while it was away
+func (s *TCPServer) deliverCommands(deviceConn *DeviceConnection) {
+	if s.commandQueue != nil {
+		s.commandQueue.DeliverPending(deviceConn.deviceID)
+	}
+}
+
+// SetReportInterval changes how often a connected GT06 or H02 device
+// reports its position
+func (s *TCPServer) SetReportInterval(deviceID string, interval time.Duration) error {
+	deviceConn, err := s.commandConnection(deviceID, string(h02.CommandSetInterval))
+	if err != nil {
+		return err
+	}
+
+	var packet []byte
+	switch deviceConn.protocol {
+	case "gt06":
+		serial := deviceConn.nextCommandSerial()
+		packet, err = deviceConn.gt06Decoder.EncodeIntervalCommand(interval, uint32(serial), serial)
+	case "h02":
+		packet, err = s.h02Decoder.EncodeIntervalCommand(deviceConn.uniqueID, interval)
+	default:
+		err = fmt.Errorf("device %s uses %s, which does not support report intervals", deviceID, deviceConn.protocol)
+	}
+	if err != nil {
+		return err
+	}
+	return s.sendCommandPacket(deviceConn, string(h02.CommandSetInterval), packet)
+}
+
+// SetCornerReporting makes a connected GT06 device report whenever its
+// heading turns by the angle in degrees; zero turns corner reports off
+func (s *TCPServer) SetCornerReporting(deviceID string, angle int) error {
+	deviceConn, err := s.commandConnection(deviceID, string(gt06.CommandSetCornerReporting))
+	if err != nil {
+		return err
+	}
+	if deviceConn.protocol != "gt06" {
+		return fmt.Errorf("device %s uses %s, which does not support corner reports", deviceID, deviceConn.protocol)
+	}
+
+	serial := deviceConn.nextCommandSerial()
+	packet, err := deviceConn.gt06Decoder.EncodeCornerCommand(angle, uint32(serial), serial)
+	if err != nil {
+		return err
+	}
+	return s.sendCommandPacket(deviceConn, string(gt06.CommandSetCornerReporting), packet)
+}
+
+// SendText shows a text message on the display of a connected device.
+// Watches take text and confirm it with an EventTextDelivered.
+func (s *TCPServer) SendText(deviceID, text string) error {
+	deviceConn, err := s.commandConnection(deviceID, watch.CommandText)
+	if err != nil {
+		return err
+	}
+	if deviceConn.protocol != "watch" {
+		return fmt.Errorf("device %s uses %s, which does not support text messages", deviceID, deviceConn.protocol)
+	}
+
+	packet, err := s.watchDecoder.EncodeText(deviceConn.vendor, deviceConn.uniqueID, text)
+	if err != nil {
+		return err
+	}
+	return s.sendCommandPacket(deviceConn, watch.CommandText, packet)
+}
+
+// commandConnection returns the connection of a device that can take the
+// command under its model's profile
+func (s *TCPServer) commandConnection(deviceID, command string) (*DeviceConnection, error) {
+	s.mutex.RLock()
+	deviceConn, ok := s.connections[deviceID]
+	s.mutex.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("device %s is not connected", deviceID)
+	}
+	if deviceConn.profile != nil && !deviceConn.profile.SupportsCommand(command) {
+		return nil, fmt.Errorf("device model %s does not support the %s command", deviceConn.profile.Model, command)
+	}
+	return deviceConn, nil
+}
+
+// flushTraffic hands the recorder the traffic of an authenticated
+// connection since the last flush, at most every trafficFlushInterval
+// unless final
+func (s *TCPServer) flushTraffic(deviceConn *DeviceConnection, final bool) {
+	if s.trafficRecorder == nil || deviceConn.deviceID == "" {
+		return
+	}
+	now := s.clock.Now()
+	if !final && now.Sub(deviceConn.flushedAt) < trafficFlushInterval {
+		return
+	}
+
+	in, out := deviceConn.bytesIn.Load(), deviceConn.bytesOut.Load()
+	if in > deviceConn.flushedIn || out > deviceConn.flushedOut {
+		s.trafficRecorder.RecordTraffic(deviceConn.deviceID, in-deviceConn.flushedIn, out-deviceConn.flushedOut)
+	}
+	deviceConn.flushedIn, deviceConn.flushedOut = in, out
+	deviceConn.flushedAt = now
+}
+
+func (s *TCPServer) sendCommandPacket(deviceConn *DeviceConnection, command string, packet []byte) error {
+	if err := deviceConn.write(packet); err != nil {
+		return fmt.Errorf("failed to send command to %s: %v", deviceConn.deviceID, err)
+	}
+
+	s.logDebug("Sent %s command to %s", command, deviceConn.deviceID)
+	return nil
+}
+
+// storePositions runs the pipeline for the positions of one frame and
+// returns how many were accepted. Positions rejected by a hook count as
+// accepted, so the device does not resend them; failed writes do not. With
+// ingest workers, queued positions count as accepted.
+func (s *TCPServer) storePositions(ctx context.Context, deviceConn *DeviceConnection, positions []*model.Position) int {
+	deviceID := deviceConn.deviceID
+	accepted := 0
+	var pending []*model.Position
+	var keys []string
+	for _, position := range positions {
+		// Keyed before hooks may change the position
+		key := positionKey(position)
+		if deviceConn.unacknowledged[key] {
+			s.logDebug("Position from %s already stored before its frame was resent", deviceID)
+			accepted++
+			continue
+		}
+		pending = append(pending, position)
+		keys = append(keys, key)
+	}
+
+	// Benchmark replays store on the connection, so each stage is timed
+	if s.pipeline != nil && deviceConn.timer == nil {
+		if len(pending) > 0 && !s.pipeline.enqueue(deviceID, pending) {
+			s.logDebug("Ingest queue full, deferring %d positions from %s", len(pending), deviceID)
+			return accepted
+		}
+		deviceConn.unacknowledged = nil
+		return len(positions)
+	}
+
+	var stored []string
+	results, _, _ := s.ingest(ctx, hook.SourceTCP, deviceID, pending, deviceConn.timer)
+	for i, ok := range results {
+		if ok {
+			accepted++
+			stored = append(stored, keys[i])
+		}
+	}
+
+	if accepted == len(positions) {
+		deviceConn.unacknowledged = nil
+	} else {
+		if deviceConn.unacknowledged == nil {
+			deviceConn.unacknowledged = make(map[string]bool)
+		}
+		for _, key := range stored {
+			deviceConn.unacknowledged[key] = true
+		}
+	}
+	return accepted
+}
+
+// IngestFrames decodes frames a device relayed by other means than its
+// connection, such as posted over HTTP, and stores their positions as its
+// connection would. It returns the positions stored; replies are dropped.
+func (s *TCPServer) IngestFrames(device *model.Device, data []byte) ([]*model.Position, error) {
+	protocol := s.detectProtocol(data)
+	deviceConn := &DeviceConnection{
+		deviceID:      device.ID,
+		uniqueID:      device.UniqueID,
+		protocol:      protocol,
+		authenticated: true,
+		profile:       s.catalog.ForDevice(device),
+	}
+	deviceConn.gt06Decoder = s.gt06DecoderFor(deviceConn.profile)
+	if protocol == "nmea" {
+		deviceConn.nmeaStream = s.nmeaDecoder.NewStream()
+	}
+
+	decoded, err := s.decodeRead(deviceConn, protocol, data)
+	if err != nil {
+		return nil, err
+	}
+	if len(decoded.pending) > 0 {
+		return nil, fmt.Errorf("%s frame incomplete after %d bytes", protocol, len(decoded.pending))
+	}
+	positions := decoded.positions
+	if deviceConn.nmeaStream != nil {
+		// No later read brings the partner of the last sentence
+		positions = append(positions, s.nmeaPositions(device.ID, deviceConn.nmeaStream.Flush())...)
+	}
+	if len(positions) == 0 {
+		return nil, nil
+	}
+
+	_, stored, err := s.ingest(context.Background(), hook.SourceHTTP, device.ID, positions, nil)
+	if err != nil {
+		return nil, err
+	}
+	return stored, nil
+}
+
+// ingest runs the hooks for positions a device sent over source, stores
+// them in one batch and points the device at the newest. It reports which
+// were accepted, the positions stored and the error of a failed write. A
+// timer, when given, times each stage.
+func (s *TCPServer) ingest(ctx context.Context, source, deviceID string, positions []*model.Position, timer *stageTimer) ([]bool, []*model.Position, error) {
+	started := time.Now()
+	previous, err := s.positionRepo.FindLatestByDeviceID(deviceID)
+	if err != nil {
+		s.logDebug("Error finding latest position of %s: %v", deviceID, err)
+	}
+
+	timer.record(stageLookup, started, 1)
+
+	started = time.Now()
+	accepted := make([]bool, len(positions))
+	var batch []*model.Position
+	var indices []int // Of the batched positions within positions
+	for i, position := range positions {
+		s.hooks.Received(source, position)
+		if err := s.hooks.RunPositionHooks(ctx, hook.StageDecoded, position); err != nil {
+			s.logDebug("Position from %s rejected by hook: %v", deviceID, err)
+			accepted[i] = true
+			continue
+		}
+		batch = append(batch, position)
+		indices = append(indices, i)
+	}
+
+	timer.record(stageDecodedHooks, started, len(positions))
+
+	// Written together, as Teltonika frames carry dozens of records
+	started = time.Now()
+	err = s.positionRepo.CreateBatch(batch)
+	if err != nil {
+		s.logDebug("Error storing positions for device %s: %v", deviceID, err)
+	}
+	timer.record(stageStore, started, len(batch))
+
+	started = time.Now()
+	stored := batch[:repository.BatchStored(batch, err)]
+	var newest *model.Position
+	for i, position := range stored {
+		s.hooks.RunPositionHooks(ctx, hook.StageStored, position)
+		s.hooks.Position(position)
+		accepted[indices[i]] = true
+
+		if newest == nil || !position.Timestamp.Before(newest.Timestamp) {
+			newest = position
+		}
+	}
+
+	if newest != nil {
+		s.updateLatestPosition(deviceID, newest, previous)
+	}
+	timer.record(stageStoredHooks, started, len(stored))
+	return accepted, stored, err
+}
+
+// positionKey identifies a decoded position within a resent frame
+func positionKey(position *model.Position) string {
+	return fmt.Sprintf("%d/%.7f/%.7f", position.Timestamp.UnixNano(), position.Latitude, position.Longitude)
+}
+
+// updateLatestPosition marks the device active and points it at newest,
+// unless the position it had before the frame is more recent: batches
+// replay history, which must not move the device back in time
+func (s *TCPServer) updateLatestPosition(deviceID string, newest, previous *model.Position) {
+	device, err := s.deviceRepo.FindByID(deviceID)
+	if err != nil || device == nil {
+		return
+	}
+
+	if previous == nil || !previous.Timestamp.After(newest.Timestamp) {
+		device.PositionID = newest.ID
+		device.LastUpdate = newest.Timestamp
+	}
+	device.Status = "active"
+	if err := s.deviceRepo.Update(device); err != nil {
+		s.logDebug("Error updating device status: %v", err)
+	}
+}
+
+// markDeviceSeen records activity from a device that sent no position
+func (s *TCPServer) markDeviceSeen(deviceID string) {
+	device, err := s.deviceRepo.FindByID(deviceID)
+	if err != nil || device == nil {
+		return
+	}
+
+	device.LastUpdate = s.clock.Now()
+	device.Status = "active"
+	if err := s.deviceRepo.Update(device); err != nil {
+		s.logDebug("Error updating device status: %v", err)
+	}
+}
+
+// gt06DecoderFor returns the GT06 decoder for a device model's checksum
+func (s *TCPServer) gt06DecoderFor(profile *model.DeviceProfile) *gt06.Decoder {
+	if profile != nil && profile.Quirks.XORChecksum {
+		return s.gt06XORDecoder
+	}
+	return s.gt06Decoder
+}
+
+// placeAtLastPosition puts a position without a fix where the device was
+// last seen, so health reports do not move it on the map
+func (s *TCPServer) placeAtLastPosition(position *model.Position) {
+	last, err := s.positionRepo.FindLatestByDeviceID(position.DeviceID)
+	if err != nil || last == nil {
+		return
+	}
+	position.Latitude = last.Latitude
+	position.Longitude = last.Longitude
+	position.Altitude = last.Altitude
+}
+
+func (s *TCPServer) nmeaPositions(deviceID string, fixes []*nmea.Fix) []*model.Position {
+	positions := make([]*model.Position, len(fixes))
+	for i, fix := range fixes {
+		positions[i] = s.nmeaDecoder.ToPosition(deviceID, fix)
+	}
+	return positions
+}
+
+// frameReply is the reply to one of several frames in a read, owed once the
+// positions of the read up to stored are stored
+type frameReply struct {
+	response []byte
+	stored   int
+}
+
+// decodeGT06 handles one GT06 frame, returning its positions and reply
+func (s *TCPServer) decodeGT06(deviceConn *DeviceConnection, data []byte) ([]*model.Position, []byte, error) {
+	decodedData, err := deviceConn.gt06Decoder.Decode(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	msgType := decodedData.Protocol
+	switch {
+	case decodedData.Opaque:
+		// Packets not decoded yet only keep the device alive
+		s.markDeviceSeen(deviceConn.deviceID)
+		return nil, nil, nil
+	case msgType == gt06.LoginMsg:
+		// A device logging in again, or a login relayed over HTTP, carries
+		// no position
+		s.markDeviceSeen(deviceConn.deviceID)
+		return nil, deviceConn.gt06Decoder.GenerateResponse(msgType, decodedData.Serial), nil
+	case msgType == gt06.StatusMsg:
+		// Heartbeats carry no fix; acknowledge them and keep the device
+		// alive. A change of ACC is stored at the last position, so trips
+		// and motion state follow the ignition.
+		var positions []*model.Position
+		if on, ok := decodedData.Status["ignition"].(bool); ok && (deviceConn.ignition == nil || *deviceConn.ignition != on) {
+			deviceConn.ignition = &on
+			position := deviceConn.gt06Decoder.ToPosition(deviceConn.deviceID, decodedData)
+			s.placeAtLastPosition(position)
+			positions = []*model.Position{position}
+		} else {
+			s.markDeviceSeen(deviceConn.deviceID)
+		}
+		return positions, deviceConn.gt06Decoder.GenerateResponse(msgType, decodedData.Serial), nil
+	case msgType == gt06.ReplyMsg:
+		// Command replies are reported as events and need no acknowledgement
+		s.markDeviceSeen(deviceConn.deviceID)
+		event := model.NewEvent(model.EventCommandResult, deviceConn.deviceID, s.clock.Now())
+		event.Attributes["result"] = decodedData.Reply
+		s.hooks.Event(event)
+		return nil, nil, nil
+	case msgType == gt06.InfoMsg, msgType == gt06.ModuleMsg:
+		// Health reports (voltage, ICCID, self-check) are stored in the
+		// status of a position without a fix
+		position := deviceConn.gt06Decoder.ToPosition(deviceConn.deviceID, decodedData)
+		s.placeAtLastPosition(position)
+		return []*model.Position{position}, deviceConn.gt06Decoder.GenerateResponse(msgType, decodedData.Serial), nil
+	case msgType == gt06.LBSMultiMsg, msgType == gt06.WiFiMsg:
+		// Cell and WiFi reports carry no fix; they keep the towers and
+		// access points heard, at the last position so the device does
+		// not jump to 0,0
+		position := deviceConn.gt06Decoder.ToPosition(deviceConn.deviceID, decodedData)
+		s.placeAtLastPosition(position)
+		return []*model.Position{position}, deviceConn.gt06Decoder.GenerateResponse(msgType, decodedData.Serial), nil
+	default:
+		// Plain location packets do not carry ACC; they take the state of
+		// the last status packet
+		position := deviceConn.gt06Decoder.ToPosition(deviceConn.deviceID, decodedData)
+		if _, ok := position.Status["ignition"]; !ok && deviceConn.ignition != nil {
+			position.Status["ignition"] = *deviceConn.ignition
+		}
+		return []*model.Position{position}, deviceConn.gt06Decoder.GenerateResponse(msgType, decodedData.Serial), nil
+	}
+}
+
+// decodeH02 handles one H02 frame, returning its positions and reply
+func (s *TCPServer) decodeH02(deviceConn *DeviceConnection, data []byte) ([]*model.Position, []byte, error) {
+	decodedData, err := s.h02Decoder.Decode(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	if decodedData.Reply != "" {
+		// Command replies are reported as events and need no acknowledgement
+		s.markDeviceSeen(deviceConn.deviceID)
+		event := model.NewEvent(model.EventCommandResult, deviceConn.deviceID, s.clock.Now())
+		event.Attributes["result"] = decodedData.Reply
+		s.hooks.Event(event)
+		return nil, nil, nil
+	}
+	return []*model.Position{s.h02Decoder.ToPosition(deviceConn.deviceID, decodedData)}, []byte("*HQ,OK#"), nil
+}
+
+// decodedRead is what a read from a device decoded to
+type decodedRead struct {
+	positions []*model.Position
+	response  []byte
+	replies   []frameReply // Replies to each of several frames in the read
+	recordAck bool         // Acknowledge with the number of accepted positions
+	pending   []byte       // Start of a frame that ends in a later read
+}
+
+// decodeRead decodes a read from a device in the given protocol. Frames
+// without positions raise their events and keep the device alive here.
+func (s *TCPServer) decodeRead(deviceConn *DeviceConnection, protocol string, data []byte) (*decodedRead, error) {
+	var response []byte
+	var processErr error
+	var pending []byte
+	var positions []*model.Position
+	var replies []frameReply
+	recordAck := false
+
+	// Process data based on protocol
+	switch protocol {
+	case "gt06":
+		// Devices upload positions buffered out of coverage as frames
+		// back to back, each acknowledged on its own
+		frames, rest, err := gt06.SplitFrames(data)
+		pending, processErr = rest, err
+		for _, frame := range frames {
+			framePositions, frameResponse, err := s.decodeGT06(deviceConn, frame)
+			if err != nil {
+				s.logDebug("Error processing frame from %s: %v", deviceConn.deviceID, err)
+				processErr = err
+				continue
+			}
+			positions = append(positions, framePositions...)
+			replies = append(replies, frameReply{frameResponse, len(positions)})
+		}
+		if replies != nil {
+			processErr = nil // The frames decoded are still stored
+		}
+
+	case "h02":
+		for _, frame := range h02.SplitFrames(data) {
+			framePositions, frameResponse, err := s.decodeH02(deviceConn, frame)
+			if err != nil {
+				s.logDebug("Error processing frame from %s: %v", deviceConn.deviceID, err)
+				processErr = err
+				continue
+			}
+			positions = append(positions, framePositions...)
+			replies = append(replies, frameReply{frameResponse, len(positions)})
+		}
+		if replies != nil {
+			processErr = nil
+		}
+
+	case "queclink":
+		report, err := s.queclinkDecoder.Decode(data)
+		if err == nil {
+			// Heartbeats and reports without a fix only keep the device alive
+			if len(report.Records) == 0 {
+				s.markDeviceSeen(deviceConn.deviceID)
+			}
+			positions = s.queclinkDecoder.ToPositions(deviceConn.deviceID, report)
+			response = s.queclinkDecoder.Response(report)
+		} else {
+			processErr = err
+		}
+
+	case "coban":
+		message, err := s.cobanDecoder.Decode(data)
+		if err == nil {
+			// Logins, heartbeats and reports without a fix only keep the
+			// device alive
+			if message.Record == nil {
+				s.markDeviceSeen(deviceConn.deviceID)
+			} else {
+				positions = []*model.Position{s.cobanDecoder.ToPosition(deviceConn.deviceID, message.Record)}
+			}
+			response = s.cobanDecoder.Response(message)
+		} else {
+			processErr = err
+		}
+
+	case "watch":
+		message, err := s.watchDecoder.Decode(data)
+		if err == nil {
+			// Heartbeats and other messages without a location only keep
+			// the device alive
+			if message.TextDelivered() {
+				s.markDeviceSeen(deviceConn.deviceID)
+				s.hooks.Event(model.NewEvent(model.EventTextDelivered, deviceConn.deviceID, s.clock.Now()))
+			} else if message.Record == nil {
+				s.markDeviceSeen(deviceConn.deviceID)
+			} else {
+				positions = []*model.Position{s.watchDecoder.ToPosition(deviceConn.deviceID, message.Record)}
+			}
+			response = s.watchDecoder.Response(message)
+		} else {
+			processErr = err
+		}
+
+	case "megastek":
+		// Reports are not answered
+		record, err := s.megastekDecoder.Decode(data)
+		if err == nil {
+			positions = []*model.Position{s.megastekDecoder.ToPosition(deviceConn.deviceID, record)}
+		} else {
+			processErr = err
+		}
+
+	case "egts":
+		// Terminals may send several packets back to back; each is
+		// confirmed, and a terminal identity answered with a result code
+		for len(data) > 0 && processErr == nil {
+			size, err := egts.PacketSize(data)
+			if err != nil {
+				processErr = err
+				break
+			}
+			if size > len(data) {
+				// The next packet ends in a later read
+				pending = append([]byte(nil), data...)
+				break
+			}
+			packet, err := s.egtsDecoder.Decode(data[:size])
+			if err != nil {
+				processErr = err
+				break
+			}
+			data = data[size:]
+			for _, fix := range packet.Positions {
+				positions = append(positions, s.egtsDecoder.ToPosition(deviceConn.deviceID, fix))
+			}
+			if packet.Type == egts.PacketAppData {
+				response = append(response, s.egtsDecoder.Response(packet, &deviceConn.egtsSerial)...)
+			}
+		}
+		if processErr == nil && len(positions) == 0 {
+			s.markDeviceSeen(deviceConn.deviceID)
+		}
+
+	case "nmea":
+		// Gateways expect no reply
+		fixes, err := deviceConn.nmeaStream.Write(data)
+		if err == nil {
+			positions = s.nmeaPositions(deviceConn.deviceID, fixes)
+			if len(positions) == 0 {
+				s.markDeviceSeen(deviceConn.deviceID)
+			}
+		} else {
+			processErr = err
+		}
+
+	case "teltonika":
+		if teltonika.IsAVLPacket(data) {
+			records, err := s.teltonikaDecoder.DecodeAVL(data)
+			if err == nil {
+				positions = s.teltonikaDecoder.ToPositions(deviceConn.deviceID, records)
+				recordAck = true
+			} else {
+				processErr = err
+			}
+			break
+		}
+		decodedData, err := s.teltonikaDecoder.Decode(data)
+		if err == nil {
+			positions = []*model.Position{s.teltonikaDecoder.ToPosition(deviceConn.deviceID, decodedData)}
+			response = []byte{0x01}
+		} else {
+			processErr = err
+		}
+
+	default: // Optional protocols; frames without positions keep the device alive
+		positions, response, processErr = s.optional.Decoder(protocol).DecodePositions(deviceConn.deviceID, data)
+		if processErr == nil && len(positions) == 0 {
+			s.markDeviceSeen(deviceConn.deviceID)
+		}
+	}
+
+	return &decodedRead{positions, response, replies, recordAck, pending}, processErr
+}
+
+// handleConnection serves a device until its connection closes. A timer,
+// when given, marks a benchmark replay: its stages are timed and it is
+// exempt from the per-IP packet limit.
+func (s *TCPServer) handleConnection(conn net.Conn, timer *stageTimer) {
+	defer s.open.Add(-1)
 	defer conn.Close()
 
+	// Position hooks see a context that ends with the connection
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
 	remoteAddr := conn.RemoteAddr().String()
 	s.logDebug("New connection from %s", remoteAddr)
 
 	deviceConn := &DeviceConnection{
 		conn:          conn,
 		authenticated: false,
+		writeTimeout:  s.writeTimeout,
+		timer:         timer,
+	}
+	deviceConn.lastSeen.Store(s.clock.Now().Unix())
+	s.mutex.Lock()
+	s.sessions[deviceConn] = true
+	s.mutex.Unlock()
+	defer func() {
+		s.mutex.Lock()
+		delete(s.sessions, deviceConn)
+		s.mutex.Unlock()
+	}()
+
+	// A client certificate names the device before it sends anything, in
+	// place of its login
+	var certified *model.Device
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		device, err := s.certifiedDevice(tlsConn)
+		if err != nil {
+			s.logDebug("TLS authentication failed for %s: %v", remoteAddr, err)
+			return
+		}
+		certified = device
 	}
 
 	buffer := make([]byte, 4096)
+	var pending []byte // Start of a GT06 or EGTS frame longer than one read
 	for {
+		// Sessions that die without a FIN never return from Read otherwise
+		if s.idleTimeout > 0 {
+			conn.SetReadDeadline(time.Now().Add(s.idleTimeout))
+		}
 		n, err := conn.Read(buffer)
 		if err != nil {
 			if err != io.EOF {
 				s.logDebug("Error reading from connection: %v", err)
 			}
+			if deviceConn.nmeaStream != nil {
+				// The last fix waited for a partner sentence that will not come
+				if fixes := deviceConn.nmeaStream.Flush(); len(fixes) > 0 {
+					s.storePositions(ctx, deviceConn, s.nmeaPositions(deviceConn.deviceID, fixes))
+				}
+			}
 			if deviceConn.deviceID != "" {
+				s.flushTraffic(deviceConn, true)
 				s.mutex.Lock()
 				delete(s.connections, deviceConn.deviceID)
 				s.mutex.Unlock()
+				if deviceConn.session != nil {
+					s.sessionManager.Disconnect(deviceConn.session)
+				}
 				s.logDebug("Device disconnected: %s", deviceConn.deviceID)
+				s.hooks.Event(model.NewEvent(model.EventDeviceOffline, deviceConn.deviceID, s.clock.Now()))
 			}
 			return
 		}
 
+		if timer == nil && !s.limiter.allowPacket(conn.RemoteAddr(), s.clock.Now()) {
+			s.logDebug("Closing connection from %s: packet rate exceeded", remoteAddr)
+			conn.Close()
+			continue // The next read fails and cleans up
+		}
+
+		started := time.Now()
 		data := buffer[:n]
+		deviceConn.lastSeen.Store(s.clock.Now().Unix())
+		deviceConn.bytesIn.Add(int64(n))
+		if deviceConn.session != nil {
+			deviceConn.session.Touch(s.clock.Now())
+			deviceConn.session.Count(int64(n), 0)
+		}
+		s.flushTraffic(deviceConn, false)
 		s.logDebug("Received %d bytes from %s", n, remoteAddr)
 
-		// Detect protocol and handle authentication
-		var protocol string
-		if bytes.HasPrefix(data, []byte{0x78, 0x78}) {
-			protocol = "gt06"
-		} else if bytes.HasPrefix(data, []byte("*HQ")) {
-			protocol = "h02"
-		} else {
-			protocol = "teltonika"
+		// Extended GT06 frames carrying OBD data or photos can outgrow the
+		// buffer; hold the start until the declared length has arrived
+		if pending != nil {
+			data, pending = append(pending, data...), nil
+		}
+		if bytes.HasPrefix(data, []byte{0x79, 0x79}) {
+			if size, err := gt06.FrameSize(data); err == nil && len(data) < size {
+				pending = append([]byte(nil), data...)
+				continue
+			}
+		}
+		if egts.IsFrame(data) {
+			if size, err := egts.PacketSize(data); err == nil && len(data) < size {
+				pending = append([]byte(nil), data...)
+				continue
+			}
+		}
+
+		// Detect protocol and handle authentication. NMEA gateways split
+		// sentences across reads, so only their first read identifies them.
+		protocol := "nmea"
+		if deviceConn.nmeaStream == nil {
+			protocol = s.detectProtocol(data)
 		}
 
+		loggedIn := false
 		if !deviceConn.authenticated {
-			device, err := s.authenticateDevice(data, protocol)
-			if err != nil {
-				s.logDebug("Authentication failed for %s: %v", remoteAddr, err)
-				return
+			loggedIn = true
+			device := certified
+			if device == nil {
+				var err error
+				if device, err = s.authenticateDevice(data, protocol); err != nil {
+					s.logDebug("Authentication failed for %s: %v", remoteAddr, err)
+					return
+				}
 			}
 
 			deviceConn.deviceID = device.ID
+			deviceConn.uniqueID = device.UniqueID
 			deviceConn.protocol = protocol
 			deviceConn.authenticated = true
+			deviceConn.profile = s.catalog.ForDevice(device)
+			if protocol == "watch" {
+				deviceConn.vendor, _ = watch.Vendor(data)
+			}
+			if protocol == "nmea" {
+				deviceConn.nmeaStream = s.nmeaDecoder.NewStream()
+			}
+			deviceConn.gt06Decoder = s.gt06DecoderFor(deviceConn.profile)
+
+			deviceConn.flushedAt = s.clock.Now()
+			if s.sessionManager != nil {
+				deviceConn.session = s.sessionManager.Connect(device.ID, device.UniqueID, protocol, remoteAddr)
+				deviceConn.session.Count(deviceConn.bytesIn.Load(), deviceConn.bytesOut.Load())
+			}
 
-			// Store connection
+			// Store connection, once its session is set for the commands
+			// other goroutines send through it
 			s.mutex.Lock()
 			s.connections[device.ID] = deviceConn
 			s.mutex.Unlock()
 
 			s.logDebug("Device authenticated: %s (%s)", device.ID, protocol)
+			s.hooks.Event(model.NewEvent(model.EventDeviceOnline, device.ID, s.clock.Now()))
 
-			// Send authentication response based on protocol
-			var response []byte
-			switch protocol {
-			case "gt06":
-				response = s.gt06Decoder.GenerateResponse(0x01, device.ID)
-			case "h02":
-				response = []byte("*HQ,OK#")
-			case "teltonika":
-				response = []byte{0x01}
+			// GT06 identifies itself with a dedicated login packet and Codec 8
+			// Teltonika devices with their IMEI; other H02 and Teltonika
+			// frames carry a position and are processed below
+			if protocol == "teltonika" && teltonika.IsIMEIPacket(data) {
+				if err := deviceConn.write([]byte{0x01}); err != nil {
+					s.logDebug("Error sending auth response to %s: %v", device.ID, err)
+					return
+				}
+				s.deliverCommands(deviceConn)
+				continue
 			}
-
-			if _, err := conn.Write(response); err != nil {
-				s.logDebug("Error sending auth response to %s: %v", device.ID, err)
-				return
+			if protocol == "gt06" && (certified == nil || gt06.IsLogin(data)) {
+				var serial uint16
+				if login, err := deviceConn.gt06Decoder.Decode(data); err == nil {
+					serial = login.Serial
+				}
+				response := deviceConn.gt06Decoder.GenerateResponse(gt06.LoginMsg, serial)
+				if err := deviceConn.write(response); err != nil {
+					s.logDebug("Error sending auth response to %s: %v", device.ID, err)
+					return
+				}
+				// Buffered positions may follow the login in the same read
+				size, err := gt06.FrameSize(data)
+				if err != nil || size >= len(data) {
+					s.deliverCommands(deviceConn)
+					continue
+				}
+				data = data[size:]
 			}
-
-			continue
 		}
 
-		// Handle protocol-specific data
-		var response []byte
-		var processErr error
-		var position *model.Position
-
-		// Process data based on protocol
-		switch protocol {
-		case "gt06":
-			decodedData, err := s.gt06Decoder.Decode(data)
-			if err == nil {
-				position = s.gt06Decoder.ToPosition(deviceConn.deviceID, decodedData)
-				msgType := data[3] // Protocol number in GT06 packet
-				response = s.gt06Decoder.GenerateResponse(msgType, deviceConn.deviceID)
-			} else {
-				processErr = err
-			}
-
-		case "h02":
-			decodedData, err := s.h02Decoder.Decode(data)
-			if err == nil {
-				position = s.h02Decoder.ToPosition(deviceConn.deviceID, decodedData)
-				response = []byte("*HQ,OK#")
-			} else {
-				processErr = err
-			}
-
-		default: // teltonika
-			decodedData, err := s.teltonikaDecoder.Decode(data)
-			if err == nil {
-				position = s.teltonikaDecoder.ToPosition(deviceConn.deviceID, decodedData)
-				response = []byte{0x01}
-			} else {
-				processErr = err
-			}
-		}
+		decoded, processErr := s.decodeRead(deviceConn, protocol, data)
+		pending = decoded.pending
+		positions, response := decoded.positions, decoded.response
 
+		timer.record(stageDecode, started, 1)
 		if processErr != nil {
 			s.logDebug("Error processing data from %s: %v", deviceConn.deviceID, processErr)
 			continue
 		}
+		s.logDevice(deviceConn.deviceID, "Decoded %d positions from %d bytes: % x", len(positions), len(data), data)
 
-		// Store position and update device status if position is valid
-		if position != nil {
-			if err := s.positionRepo.Create(position); err != nil {
-				s.logDebug("Error storing position for device %s: %v", deviceConn.deviceID, err)
-			} else {
-				// Update device's last position and status
-				device, err := s.deviceRepo.FindByID(deviceConn.deviceID)
-				if err == nil && device != nil {
-					device.PositionID = position.ID
-					device.LastUpdate = position.Timestamp
-					device.Status = "active"
-					if err := s.deviceRepo.Update(device); err != nil {
-						s.logDebug("Error updating device status: %v", err)
-					}
+		// Frames without positions (logins, heartbeats, command replies) are
+		// acknowledged at once. Position frames are acknowledged only once
+		// every position is stored: Teltonika with the accepted count, which
+		// makes the device resend a short batch, and GT06 and H02 not at all
+		// when a write failed, so the device resends the frame.
+		accepted := 0
+		if len(positions) > 0 {
+			// Latency is timed from the read, so queueing for ingest
+			// workers counts
+			for _, position := range positions {
+				position.ReceivedAt = started
+			}
+			accepted = s.storePositions(ctx, deviceConn, positions)
+		}
+		if accepted < len(positions) {
+			s.logDebug("Withholding ACK from %s: accepted %d of %d positions", deviceConn.deviceID, accepted, len(positions))
+		}
+		if decoded.recordAck {
+			response = teltonika.AVLResponse(accepted)
+		} else if decoded.replies != nil {
+			// Frames are answered up to the first with a position not stored
+			for _, reply := range decoded.replies {
+				if reply.stored > accepted {
+					break
 				}
+				response = append(response, reply.response...)
 			}
+		} else if accepted < len(positions) {
+			response = nil
 		}
 
 		// Send response to device
 		if response != nil {
-			if _, err := conn.Write(response); err != nil {
+			started = time.Now()
+			if err := deviceConn.write(response); err != nil {
 				s.logDebug("Error sending response to %s: %v", deviceConn.deviceID, err)
 				continue
 			}
+			timer.record(stageReply, started, 1)
+			s.logDevice(deviceConn.deviceID, "Replied %d bytes: % x", len(response), response)
+		}
+
+		// Commands queued while the device was away follow its login or
+		// its next heartbeat
+		if loggedIn || len(positions) == 0 {
+			s.deliverCommands(deviceConn)
 		}
 	}
 }
\ No newline at end of file
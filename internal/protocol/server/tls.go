@@ -0,0 +1,73 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+	"tracking/internal/core/devicecert"
+	"tracking/internal/core/model"
+)
+
+// tlsHandshakeTimeout bounds the handshake of a device connecting over TLS
+const tlsHandshakeTimeout = 30 * time.Second
+
+// SetTLS also listens on port for devices connecting over mutual TLS with
+// the given settings, which should require a client certificate. The
+// certificate names the device, so it is known before it sends anything
+// and needs no login. Must be called before Start.
+func (s *TCPServer) SetTLS(port int, config *tls.Config) {
+	s.tlsPort = port
+	s.tlsConfig = config
+}
+
+// TLSAddr returns the address the TLS listener is on, or nil without one
+func (s *TCPServer) TLSAddr() net.Addr {
+	if s.tlsListener == nil {
+		return nil
+	}
+	return s.tlsListener.Addr()
+}
+
+// listenTLS starts the TLS listener when one is set
+func (s *TCPServer) listenTLS() error {
+	if s.tlsConfig == nil {
+		return nil
+	}
+	listener, err := tls.Listen("tcp", fmt.Sprintf("0.0.0.0:%d", s.tlsPort), s.tlsConfig)
+	if err != nil {
+		return fmt.Errorf("failed to start TLS device listener: %v", err)
+	}
+	s.tlsListener = listener
+	s.logDebug("TLS device listener on port %d", s.tlsPort)
+	go s.acceptConnections(listener)
+	return nil
+}
+
+// certifiedDevice completes the handshake of a TLS connection and returns
+// the device its client certificate names, by common name or DNS SAN
+func (s *TCPServer) certifiedDevice(conn *tls.Conn) (*model.Device, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), tlsHandshakeTimeout)
+	defer cancel()
+	if err := conn.HandshakeContext(ctx); err != nil {
+		return nil, err
+	}
+
+	certificates := conn.ConnectionState().PeerCertificates
+	if len(certificates) == 0 {
+		return nil, errors.New("no client certificate")
+	}
+	names := devicecert.Identities(certificates[0])
+	for _, name := range names {
+		device, err := s.deviceRepo.FindByUniqueID(name)
+		if err != nil {
+			return nil, fmt.Errorf("error finding device: %v", err)
+		}
+		if device != nil {
+			return device, nil
+		}
+	}
+	return nil, fmt.Errorf("no device named by certificate %v", names)
+}
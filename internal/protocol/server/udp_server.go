@@ -0,0 +1,237 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync/atomic"
+	"tracking/internal/core/hook"
+	"tracking/internal/core/logging"
+	"tracking/internal/core/model"
+	"tracking/internal/core/repository"
+	"tracking/internal/core/util"
+	"tracking/internal/protocol/calamp"
+)
+
+// UDPServer receives datagram protocols, each datagram a whole message.
+// CalAmp LM Direct is the only one so far.
+type UDPServer struct {
+	port          int
+	conn          net.PacketConn
+	deviceRepo    repository.DeviceRepository
+	positionRepo  repository.PositionRepository
+	calampDecoder *calamp.Decoder
+	debug         bool
+	levels        *logging.Levels // Decides debug logging in place of debug when set
+	clock         util.Clock
+	hooks         *hook.Registry
+	sessions      *SessionManager // Nil leaves sessions untracked
+	receiving     atomic.Bool     // Whether the read loop is running
+}
+
+func NewUDPServer(port int, deviceRepo repository.DeviceRepository, positionRepo repository.PositionRepository) *UDPServer {
+	return &UDPServer{
+		port:          port,
+		deviceRepo:    deviceRepo,
+		positionRepo:  positionRepo,
+		calampDecoder: calamp.NewDecoder(),
+		debug:         true, // Enable debug logging by default
+		clock:         util.SystemClock,
+	}
+}
+
+// EnableDebug enables or disables debug logging
+func (s *UDPServer) EnableDebug(enable bool) {
+	s.debug = enable
+	s.calampDecoder.EnableDebug(enable)
+}
+
+// SetLogLevels has debug logging follow levels instead of EnableDebug, so
+// it can be raised for the server or single devices while they report
+func (s *UDPServer) SetLogLevels(levels *logging.Levels) {
+	s.levels = levels
+}
+
+// SetClock sets the clock used for device bookkeeping and by the decoders
+func (s *UDPServer) SetClock(clock util.Clock) {
+	s.clock = clock
+	s.calampDecoder.SetClock(clock)
+}
+
+// SetHooks sets the registry notified of stored positions
+func (s *UDPServer) SetHooks(hooks *hook.Registry) {
+	s.hooks = hooks
+}
+
+// SetSessions sets the manager tracking which devices are reporting
+func (s *UDPServer) SetSessions(sessions *SessionManager) {
+	s.sessions = sessions
+}
+
+func (s *UDPServer) debugging() bool {
+	if s.levels != nil {
+		return s.levels.Enabled(logging.ModuleUDPServer, logging.Debug)
+	}
+	return s.debug
+}
+
+func (s *UDPServer) logDebug(format string, v ...interface{}) {
+	if s.debugging() {
+		log.Printf("[UDP Server] "+format, v...)
+	}
+}
+
+// logDevice writes the traffic of one device, when the server or that
+// device is logged at debug level
+func (s *UDPServer) logDevice(deviceID string, format string, v ...interface{}) {
+	if s.debugging() || (s.levels != nil && s.levels.DeviceEnabled(deviceID, logging.Debug)) {
+		log.Printf("[UDP Server] [%s] "+format, append([]interface{}{deviceID}, v...)...)
+	}
+}
+
+func (s *UDPServer) Start() error {
+	var err error
+	s.conn, err = net.ListenPacket("udp", fmt.Sprintf("0.0.0.0:%d", s.port))
+	if err != nil {
+		return fmt.Errorf("failed to start UDP server: %v", err)
+	}
+
+	s.logDebug("UDP server listening on port %d", s.port)
+	s.logDebug("Supported protocols: CalAmp")
+
+	s.receiving.Store(true)
+	go s.readDatagrams()
+	return nil
+}
+
+// Listening reports whether the server is receiving datagrams
+func (s *UDPServer) Listening() bool {
+	return s.receiving.Load()
+}
+
+// Addr returns the address the server is listening on, or nil before Start
+func (s *UDPServer) Addr() net.Addr {
+	if s.conn == nil {
+		return nil
+	}
+	return s.conn.LocalAddr()
+}
+
+func (s *UDPServer) Stop() {
+	if s.conn != nil {
+		s.conn.Close()
+	}
+}
+
+func (s *UDPServer) readDatagrams() {
+	defer s.receiving.Store(false)
+	buffer := make([]byte, 65535)
+	for {
+		n, addr, err := s.conn.ReadFrom(buffer)
+		if err != nil {
+			if strings.Contains(err.Error(), "use of closed network connection") {
+				return
+			}
+			s.logDebug("Error reading datagram: %v", err)
+			continue
+		}
+
+		// Datagrams are handled in order, so a device's reports are stored
+		// in the order it sent them
+		data := append([]byte(nil), buffer[:n]...)
+		s.handleDatagram(data, addr)
+	}
+}
+
+func (s *UDPServer) handleDatagram(data []byte, addr net.Addr) {
+	s.logDebug("Received %d bytes from %s", len(data), addr)
+	if !calamp.IsFrame(data) {
+		s.logDebug("Dropping unknown datagram from %s", addr)
+		return
+	}
+
+	message, err := s.calampDecoder.Decode(data)
+	if err != nil {
+		s.logDebug("Error processing data from %s: %v", addr, err)
+		return
+	}
+	device, err := s.deviceRepo.FindByUniqueID(message.MobileID)
+	if err != nil || device == nil {
+		s.logDebug("Authentication failed for %s: unknown mobile ID %s", addr, message.MobileID)
+		return
+	}
+	if s.sessions != nil {
+		s.sessions.Datagram(device.ID, device.UniqueID, "calamp", addr.String())
+	}
+	s.logDevice(device.ID, "Decoded %d bytes from %s: % x", len(data), addr, data)
+
+	// Reports are acknowledged only once stored, so the device keeps them
+	// in its log and resends them otherwise
+	if message.Record != nil {
+		position := s.calampDecoder.ToPosition(device.ID, message.Record)
+		if !s.storePosition(context.Background(), position) {
+			s.logDebug("Withholding ACK from %s: position not stored", device.ID)
+			return
+		}
+	} else {
+		s.markDeviceSeen(device)
+	}
+
+	if response := s.calampDecoder.Response(message); response != nil {
+		if _, err := s.conn.WriteTo(response, addr); err != nil {
+			s.logDebug("Error sending response to %s: %v", device.ID, err)
+		} else {
+			s.logDevice(device.ID, "Replied %d bytes: % x", len(response), response)
+		}
+	}
+}
+
+// storePosition runs the pipeline for a position and reports whether it was
+// accepted. A position rejected by a hook counts as accepted, so the device
+// does not resend it; a failed write does not.
+func (s *UDPServer) storePosition(ctx context.Context, position *model.Position) bool {
+	deviceID := position.DeviceID
+	previous, err := s.positionRepo.FindLatestByDeviceID(deviceID)
+	if err != nil {
+		s.logDebug("Error finding latest position of %s: %v", deviceID, err)
+	}
+
+	s.hooks.Received(hook.SourceUDP, position)
+	if err := s.hooks.RunPositionHooks(ctx, hook.StageDecoded, position); err != nil {
+		s.logDebug("Position from %s rejected by hook: %v", deviceID, err)
+		return true
+	}
+	if err := s.positionRepo.Create(position); err != nil {
+		s.logDebug("Error storing position for device %s: %v", deviceID, err)
+		return false
+	}
+	s.hooks.RunPositionHooks(ctx, hook.StageStored, position)
+	s.hooks.Position(position)
+
+	// Logged reports replay history, which must not move the device back
+	// in time
+	device, err := s.deviceRepo.FindByID(deviceID)
+	if err != nil || device == nil {
+		return true
+	}
+	if previous == nil || !previous.Timestamp.After(position.Timestamp) {
+		device.PositionID = position.ID
+		device.LastUpdate = position.Timestamp
+	}
+	device.Status = "active"
+	if err := s.deviceRepo.Update(device); err != nil {
+		s.logDebug("Error updating device status: %v", err)
+	}
+	return true
+}
+
+// markDeviceSeen records activity from a device that sent no position
+func (s *UDPServer) markDeviceSeen(device *model.Device) {
+	device.LastUpdate = s.clock.Now()
+	device.Status = "active"
+	if err := s.deviceRepo.Update(device); err != nil {
+		s.logDebug("Error updating device status: %v", err)
+	}
+}
@@ -0,0 +1,207 @@
+// Package sms reads the position text messages trackers send to a phone
+// when GPRS data fails. The wording differs between firmwares, e.g.
+//
+//	Lat:N22.571285,Lon:E114.025630,Course:90.00,Speed:35.00km/h,DateTime:2024-01-15 10:00:00
+//	lat:22.571285 long:114.025630 speed:35.00 T:24/01/15 10:00 bat:80%
+//	http://maps.google.com/maps?q=N22.571285,E114.025630
+//
+// so fields are found by their labels, or the coordinates by a map link,
+// anywhere in the message. Dates are taken as UTC. Messages without
+// coordinates, such as command replies, decode without a fix.
+package sms
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"tracking/internal/core/model"
+	"tracking/internal/core/util"
+)
+
+// Common SMS errors
+var (
+	ErrEmptyMessage      = errors.New("empty SMS message")
+	ErrInvalidCoordinate = errors.New("invalid coordinate value")
+)
+
+const (
+	knotsToKmh = 1.852
+	mphToKmh   = 1.609344
+)
+
+var (
+	// Map links: maps?q=22.571285,114.025630 or q=N22.571285,E114.025630
+	mapLinkPattern = regexp.MustCompile(`(?i)[?&]q=(?:loc:)?([NS])?(-?\d+(?:\.\d+)?),\s*([EW])?(-?\d+(?:\.\d+)?)`)
+	latPattern     = regexp.MustCompile(`(?i)\blat(?:itude)?\s*[:=]\s*([NS])?\s*(-?\d+(?:\.\d+)?)\s*([NS]\b)?`)
+	lonPattern     = regexp.MustCompile(`(?i)\b(?:lon|lng|long|longitude)\s*[:=]\s*([EW])?\s*(-?\d+(?:\.\d+)?)\s*([EW]\b)?`)
+	speedPattern   = regexp.MustCompile(`(?i)\b(?:speed|spd)\s*[:=]\s*(\d+(?:\.\d+)?)\s*(km/h|kmh|kph|mph|knots|knot|kn)?`)
+	coursePattern  = regexp.MustCompile(`(?i)\b(?:course|dir|direction|heading)\s*[:=]\s*(\d+(?:\.\d+)?)`)
+	batteryPattern = regexp.MustCompile(`(?i)\b(?:bat|batt|battery)\s*[:=]\s*(\d+(?:\.\d+)?)\s*%?`)
+	timePattern    = regexp.MustCompile(`(?i)\b(?:datetime|date|time|t)\s*[:=]\s*(\d{2,4}[-/]\d{2}[-/]\d{2}\s+\d{2}:\d{2}(?::\d{2})?)`)
+)
+
+// Layouts of the dates in timePattern, after slashes become dashes
+var timeLayouts = []string{
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"06-01-02 15:04:05",
+	"06-01-02 15:04",
+}
+
+type SMSData struct {
+	Latitude  float64
+	Longitude float64
+	Speed     float64 // km/h
+	Course    float64
+	Timestamp time.Time
+	Fix       bool // Whether the message carried coordinates
+	Status    map[string]interface{}
+}
+
+// HasFix reports whether the message carried a position
+func (d *SMSData) HasFix() bool {
+	return d.Fix
+}
+
+type Decoder struct {
+	debug bool
+	clock util.Clock
+}
+
+func NewDecoder() *Decoder {
+	return &Decoder{
+		debug: false,
+		clock: util.SystemClock,
+	}
+}
+
+func (d *Decoder) EnableDebug(enable bool) {
+	d.debug = enable
+}
+
+// SetClock sets the clock used for messages without a date
+func (d *Decoder) SetClock(clock util.Clock) {
+	d.clock = clock
+}
+
+func (d *Decoder) logDebug(format string, v ...interface{}) {
+	if d.debug {
+		log.Printf("[SMS] "+format, v...)
+	}
+}
+
+// Decode reads the text of one message
+func (d *Decoder) Decode(text string) (*SMSData, error) {
+	d.logDebug("Decoding message: %q", text)
+
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil, ErrEmptyMessage
+	}
+	result := &SMSData{Status: make(map[string]interface{})}
+
+	var latitude, longitude float64
+	var err error
+	if match := mapLinkPattern.FindStringSubmatch(text); match != nil {
+		if latitude, err = parseCoordinate(match[1], match[2], "S", 90); err != nil {
+			return nil, fmt.Errorf("invalid latitude: %w", err)
+		}
+		if longitude, err = parseCoordinate(match[3], match[4], "W", 180); err != nil {
+			return nil, fmt.Errorf("invalid longitude: %w", err)
+		}
+		result.Fix = true
+	} else {
+		lat := latPattern.FindStringSubmatch(text)
+		lon := lonPattern.FindStringSubmatch(text)
+		if lat == nil || lon == nil {
+			d.logDebug("No coordinates in message")
+			return result, nil
+		}
+		if latitude, err = parseCoordinate(lat[1]+lat[3], lat[2], "S", 90); err != nil {
+			return nil, fmt.Errorf("invalid latitude: %w", err)
+		}
+		if longitude, err = parseCoordinate(lon[1]+lon[3], lon[2], "W", 180); err != nil {
+			return nil, fmt.Errorf("invalid longitude: %w", err)
+		}
+		result.Fix = true
+	}
+	result.Latitude = latitude
+	result.Longitude = longitude
+
+	if match := speedPattern.FindStringSubmatch(text); match != nil {
+		speed, _ := strconv.ParseFloat(match[1], 64)
+		switch strings.ToLower(match[2]) {
+		case "mph":
+			speed *= mphToKmh
+		case "knots", "knot", "kn":
+			speed *= knotsToKmh
+		}
+		result.Speed = speed
+	}
+	if match := coursePattern.FindStringSubmatch(text); match != nil {
+		course, _ := strconv.ParseFloat(match[1], 64)
+		result.Course = math.Mod(course, 360)
+	}
+	if match := batteryPattern.FindStringSubmatch(text); match != nil {
+		if level, _ := strconv.ParseFloat(match[1], 64); level <= 100 {
+			result.Status["batteryLevel"] = level
+		}
+	}
+
+	result.Timestamp = d.clock.Now()
+	if match := timePattern.FindStringSubmatch(text); match != nil {
+		if timestamp, ok := parseTime(match[1]); ok {
+			result.Timestamp = timestamp
+		} else {
+			d.logDebug("Ignoring unreadable date %q", match[1])
+		}
+	}
+
+	return result, nil
+}
+
+func (d *Decoder) ToPosition(deviceID string, data *SMSData) *model.Position {
+	position := model.NewPosition(deviceID, data.Latitude, data.Longitude)
+	position.Speed = data.Speed
+	position.Course = data.Course
+	position.Valid = true
+	position.Timestamp = data.Timestamp
+	position.Protocol = "sms"
+
+	for k, v := range data.Status {
+		position.Status[k] = v
+	}
+	position.Status["source"] = "sms"
+	return position
+}
+
+// parseCoordinate applies a hemisphere letter to a decimal coordinate;
+// negative is the letter of the southern or western hemisphere
+func parseCoordinate(hemisphere, value, negative string, limit float64) (float64, error) {
+	coordinate, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidCoordinate, value)
+	}
+	if strings.EqualFold(hemisphere, negative) {
+		coordinate = -math.Abs(coordinate)
+	}
+	if coordinate < -limit || coordinate > limit {
+		return 0, fmt.Errorf("%w: %f out of range", ErrInvalidCoordinate, coordinate)
+	}
+	return coordinate, nil
+}
+
+func parseTime(value string) (time.Time, bool) {
+	value = strings.Join(strings.Fields(strings.ReplaceAll(value, "/", "-")), " ")
+	for _, layout := range timeLayouts {
+		if timestamp, err := time.Parse(layout, value); err == nil {
+			return timestamp.UTC(), true
+		}
+	}
+	return time.Time{}, false
+}
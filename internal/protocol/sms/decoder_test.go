@@ -0,0 +1,119 @@
+package sms
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+	"tracking/internal/core/util"
+)
+
+func TestDecode(t *testing.T) {
+	now := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	decoder := NewDecoder()
+	decoder.SetClock(util.NewFixedClock(now))
+
+	tests := []struct {
+		name      string
+		text      string
+		latitude  float64
+		longitude float64
+		speed     float64
+		course    float64
+		timestamp time.Time
+	}{
+		{
+			name:      "labelled with hemispheres",
+			text:      "Lat:S22.571285,Lon:W114.025630,Course:90.00,Speed:35.00km/h,DateTime:2024-01-15 10:20:30",
+			latitude:  -22.571285,
+			longitude: -114.025630,
+			speed:     35,
+			course:    90,
+			timestamp: time.Date(2024, 1, 15, 10, 20, 30, 0, time.UTC),
+		},
+		{
+			name:      "labelled with short date",
+			text:      "lat:22.571285 long:114.025630 speed:10 mph T:24/01/15 10:20 bat:80%",
+			latitude:  22.571285,
+			longitude: 114.025630,
+			speed:     10 * mphToKmh,
+			timestamp: time.Date(2024, 1, 15, 10, 20, 0, 0, time.UTC),
+		},
+		{
+			name:      "map link",
+			text:      "Help me! http://maps.google.com/maps?f=q&q=N48.858400,E2.294500&z=16",
+			latitude:  48.8584,
+			longitude: 2.2945,
+			timestamp: now,
+		},
+		{
+			name:      "signed map link",
+			text:      "https://maps.google.com/maps?q=-33.8568,151.2153 Speed:12kn",
+			latitude:  -33.8568,
+			longitude: 151.2153,
+			speed:     12 * knotsToKmh,
+			timestamp: now,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decoder.Decode(tt.text)
+			if err != nil {
+				t.Fatalf("Decode() unexpected error: %v", err)
+			}
+			if !got.HasFix() || got.Latitude != tt.latitude || got.Longitude != tt.longitude {
+				t.Errorf("Decode() = %f,%f, want %f,%f", got.Latitude, got.Longitude, tt.latitude, tt.longitude)
+			}
+			if math.Abs(got.Speed-tt.speed) > 1e-9 || got.Course != tt.course {
+				t.Errorf("Speed = %v, course = %v, want %v and %v", got.Speed, got.Course, tt.speed, tt.course)
+			}
+			if !got.Timestamp.Equal(tt.timestamp) {
+				t.Errorf("Timestamp = %v, want %v", got.Timestamp, tt.timestamp)
+			}
+		})
+	}
+
+	got, err := decoder.Decode("lat:22.571285 long:114.025630 bat:80%")
+	if err != nil {
+		t.Fatalf("Decode() unexpected error: %v", err)
+	}
+	position := decoder.ToPosition("device-1", got)
+	if position.DeviceID != "device-1" || position.Protocol != "sms" || !position.Valid ||
+		position.Status["source"] != "sms" || position.Status["batteryLevel"] != 80.0 {
+		t.Errorf("ToPosition() = %+v", position)
+	}
+}
+
+func TestDecodeWithoutFix(t *testing.T) {
+	decoder := NewDecoder()
+
+	got, err := decoder.Decode("Set APN OK")
+	if err != nil {
+		t.Fatalf("Decode() unexpected error: %v", err)
+	}
+	if got.HasFix() {
+		t.Errorf("Decode() = %+v, want no fix", got)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	decoder := NewDecoder()
+
+	tests := []struct {
+		name string
+		text string
+		want error
+	}{
+		{"empty", "  ", ErrEmptyMessage},
+		{"latitude out of range", "Lat:N95.0,Lon:E10.0", ErrInvalidCoordinate},
+		{"longitude out of range", "maps?q=10.0,190.0", ErrInvalidCoordinate},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := decoder.Decode(tt.text); !errors.Is(err, tt.want) {
+				t.Errorf("Decode() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
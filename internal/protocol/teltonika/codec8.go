@@ -0,0 +1,388 @@
+package teltonika
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Codec 8 sessions open with the IMEI as a length-prefixed ASCII string,
+// answered with 0x01. The device then sends AVL data packets, each carrying
+// a batch of records:
+//
+//	preamble 0x00000000(4) data length(4) codec ID 0x08(1) record count(1)
+//	records... record count(1) CRC-16/IBM(4)
+//
+// A record is timestamp ms(8) priority(1) longitude(4) latitude(4)
+// altitude(2) angle(2) satellites(1) speed(2), followed by its IO elements:
+// event IO ID(1) element count(1), then groups of 1, 2, 4 and 8 byte values,
+// each group prefixed with its count(1) and each element with its IO ID(1).
+// The server acknowledges a packet with the number of records it accepted.
+//
+// Newer FMB and FMC firmware sends the same packet with codec 0x8E or 0x10.
+// Codec 8 Extended widens the event IO ID, element count, group counts and
+// IO IDs to 2 bytes and adds a last group of variable length elements, each
+// IO ID(2) length(2) value, carrying VINs, fault codes and BLE payloads.
+// Codec 16 widens only the event IO ID and IO IDs, and follows the event IO
+// ID with the generation type(1) of the record.
+const (
+	codec8         = 0x08
+	codec8E        = 0x8E
+	codec16        = 0x10
+	avlHeaderSize  = 8  // Preamble and data length
+	avlTrailerSize = 4  // CRC
+	minAVLLength   = 15 // Header, codec, two counts and CRC
+	minRecordSize  = 26 // GPS element, event ID and five counts
+	minIMEILength  = 15
+	maxIMEILength  = 17
+)
+
+// ioLayout is how a codec encodes the IO elements of a record
+type ioLayout struct {
+	wideIDs    bool // 2 byte event IO ID and IO IDs
+	wideCounts bool // 2 byte element and group counts
+	generation bool // Generation type after the event IO ID
+	variable   bool // Group of variable length elements
+}
+
+var ioLayouts = map[uint8]ioLayout{
+	codec8:  {},
+	codec8E: {wideIDs: true, wideCounts: true, variable: true},
+	codec16: {wideIDs: true, generation: true},
+}
+
+// Known IO elements, published under readable names. Fuel is reported as
+// a percentage read from the CAN bus, as the raw level of an LLS probe on
+// RS-232/RS-485, or as the voltage of a sensor on an analog input.
+var ioNames = map[uint16]string{
+	6:   "analogInput2",
+	9:   "analogInput1",
+	21:  "gsmSignal",
+	66:  "externalVoltage",
+	67:  "batteryVoltage",
+	89:  "fuelLevel",
+	201: "llsFuel1",
+	203: "llsFuel2",
+	239: "ignition",
+	240: "motion",
+	256: "vin",
+	281: "faultCodes",
+	385: "beacons",
+}
+
+// IsIMEIPacket reports whether data is the IMEI a device opens its session with
+func IsIMEIPacket(data []byte) bool {
+	if len(data) < 2 {
+		return false
+	}
+	length := int(binary.BigEndian.Uint16(data))
+	if length < minIMEILength || length > maxIMEILength || len(data) != 2+length {
+		return false
+	}
+	for _, c := range data[2:] {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseIMEI returns the IMEI of a session opening packet
+func ParseIMEI(data []byte) (string, error) {
+	if !IsIMEIPacket(data) {
+		return "", fmt.Errorf("%w: invalid IMEI packet", ErrMalformedPacket)
+	}
+	return string(data[2:]), nil
+}
+
+// IsAVLPacket reports whether data is a Codec 8, 8 Extended or 16 AVL data
+// packet
+func IsAVLPacket(data []byte) bool {
+	if len(data) < minAVLLength || binary.BigEndian.Uint32(data) != 0 {
+		return false
+	}
+	_, known := ioLayouts[data[avlHeaderSize]]
+	return known
+}
+
+// AVLPacketSize returns the length of the AVL packet data starts with, for
+// splitting packets stored back to back as in offline dumps
+func AVLPacketSize(data []byte) (int, error) {
+	if len(data) < avlHeaderSize {
+		return 0, fmt.Errorf("%w: %d bytes, need the %d byte header", ErrPacketTooShort, len(data), avlHeaderSize)
+	}
+	if binary.BigEndian.Uint32(data) != 0 {
+		return 0, fmt.Errorf("%w: missing AVL preamble", ErrMalformedPacket)
+	}
+	return avlHeaderSize + int(binary.BigEndian.Uint32(data[4:])) + avlTrailerSize, nil
+}
+
+// AVLResponse is the acknowledgement for a packet of which count records
+// were accepted; the device resends the packet when the count falls short
+func AVLResponse(count int) []byte {
+	response := make([]byte, 4)
+	binary.BigEndian.PutUint32(response, uint32(count))
+	return response
+}
+
+// DecodeAVL reads every record of an AVL packet, oldest first as sent
+func (d *Decoder) DecodeAVL(data []byte) ([]*TeltonikaData, error) {
+	d.logPacket(data, "Received AVL")
+
+	if !IsAVLPacket(data) {
+		return nil, fmt.Errorf("%w: not a Codec 8, 8E or 16 packet", ErrMalformedPacket)
+	}
+	length := int(binary.BigEndian.Uint32(data[4:]))
+	if len(data) != avlHeaderSize+length+avlTrailerSize {
+		return nil, fmt.Errorf("%w: data length %d does not match %d byte packet",
+			ErrMalformedPacket, length, len(data))
+	}
+
+	body := data[avlHeaderSize : avlHeaderSize+length]
+	if want, got := crc16IBM(body), binary.BigEndian.Uint32(data[avlHeaderSize+length:]); got != uint32(want) {
+		return nil, fmt.Errorf("%w: CRC 0x%04x, want 0x%04x", ErrMalformedPacket, got, want)
+	}
+
+	count := int(body[1])
+	if int(body[len(body)-1]) != count {
+		return nil, fmt.Errorf("%w: record counts %d and %d differ",
+			ErrMalformedPacket, count, body[len(body)-1])
+	}
+	if count*minRecordSize > len(body)-3 {
+		return nil, fmt.Errorf("%w: %d records do not fit in %d bytes",
+			ErrPacketTooShort, count, len(body))
+	}
+
+	layout := ioLayouts[body[0]]
+	r := &avlReader{data: body[2 : len(body)-1]}
+	records := make([]*TeltonikaData, 0, count)
+	for i := 0; i < count; i++ {
+		record, err := d.readRecord(r, layout)
+		if err != nil {
+			return nil, fmt.Errorf("record %d: %w", i, err)
+		}
+		records = append(records, record)
+	}
+	if len(r.data) != r.pos {
+		return nil, fmt.Errorf("%w: %d bytes after the last record", ErrMalformedPacket, len(r.data)-r.pos)
+	}
+
+	d.logDebug("Decoded %d AVL records with codec 0x%02x", len(records), body[0])
+	return records, nil
+}
+
+func (d *Decoder) readRecord(r *avlReader, layout ioLayout) (*TeltonikaData, error) {
+	timestamp := r.uint64()
+	priority := r.uint8()
+	longitude := float64(int32(r.uint32())) / 1e7
+	latitude := float64(int32(r.uint32())) / 1e7
+	altitude := int16(r.uint16())
+	angle := r.uint16()
+	satellites := r.uint8()
+	speed := r.uint16()
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	if !isValidCoordinate(latitude, longitude) {
+		return nil, fmt.Errorf("%w: lat=%.6f, lon=%.6f", ErrInvalidCoordinate, latitude, longitude)
+	}
+	if angle > 360 {
+		return nil, fmt.Errorf("%w: invalid course value %d", ErrInvalidValue, angle)
+	}
+
+	record := &TeltonikaData{
+		Latitude:  latitude,
+		Longitude: longitude,
+		Altitude:  float64(altitude),
+		Speed:     float64(speed), // Already km/h
+		Course:    float64(angle),
+		Timestamp: time.UnixMilli(int64(timestamp)).UTC(),
+		Valid:     satellites > 0,
+		Status: map[string]interface{}{
+			"priority":   priority,
+			"satellites": satellites,
+		},
+	}
+
+	if err := readIOElements(r, layout, record.Status); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// readIOElements stores the record's IO values in status, under their name
+// when known and as io<ID> otherwise
+func readIOElements(r *avlReader, layout ioLayout, status map[string]interface{}) error {
+	if layout.wideIDs {
+		if event := r.uint16(); event != 0 {
+			status["event"] = event
+		}
+	} else if event := r.uint8(); event != 0 {
+		status["event"] = event
+	}
+	if layout.generation {
+		status["generation"] = r.uint8()
+	}
+	r.count(layout) // Total element count, repeated by the group counts
+
+	for _, size := range []int{1, 2, 4, 8} {
+		count := r.count(layout)
+		for i := 0; i < count && r.err == nil; i++ {
+			id := r.ioID(layout)
+			var value uint64
+			switch size {
+			case 1:
+				value = uint64(r.uint8())
+			case 2:
+				value = uint64(r.uint16())
+			case 4:
+				value = uint64(r.uint32())
+			case 8:
+				value = r.uint64()
+			}
+			setIOElement(status, id, value)
+		}
+	}
+
+	if layout.variable {
+		count := r.count(layout)
+		for i := 0; i < count && r.err == nil; i++ {
+			id := r.ioID(layout)
+			value := r.next(int(r.uint16()))
+			if r.err == nil {
+				setVariableIOElement(status, id, value)
+			}
+		}
+	}
+	return r.err
+}
+
+func setIOElement(status map[string]interface{}, id uint16, value uint64) {
+	name, known := ioNames[id]
+	if !known {
+		status[fmt.Sprintf("io%d", id)] = value
+		return
+	}
+
+	switch id {
+	case 239, 240:
+		status[name] = value != 0
+	case 6, 9, 66, 67:
+		status[name] = float64(value) / 1000 // Millivolts to volts
+	case 89:
+		status[name] = float64(value) // Percent
+	default:
+		status[name] = value
+	}
+}
+
+// setVariableIOElement stores a variable length value as text when it is
+// printable, such as a VIN, and as hex otherwise, such as a BLE payload
+func setVariableIOElement(status map[string]interface{}, id uint16, value []byte) {
+	name, known := ioNames[id]
+	if !known {
+		name = fmt.Sprintf("io%d", id)
+	}
+	if isPrintable(value) {
+		status[name] = strings.TrimRight(string(value), "\x00")
+	} else {
+		status[name] = hex.EncodeToString(value)
+	}
+}
+
+func isPrintable(value []byte) bool {
+	value = bytes.TrimRight(value, "\x00")
+	if len(value) == 0 {
+		return false
+	}
+	for _, c := range value {
+		if c < 0x20 || c > 0x7E {
+			return false
+		}
+	}
+	return true
+}
+
+// avlReader reads big-endian values, recording the first overrun
+type avlReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (r *avlReader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if r.pos+n > len(r.data) {
+		r.err = fmt.Errorf("%w: record truncated at byte %d", ErrPacketTooShort, r.pos)
+		return nil
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
+
+// count reads an element or group count of the layout's width
+func (r *avlReader) count(layout ioLayout) int {
+	if layout.wideCounts {
+		return int(r.uint16())
+	}
+	return int(r.uint8())
+}
+
+// ioID reads an IO ID of the layout's width
+func (r *avlReader) ioID(layout ioLayout) uint16 {
+	if layout.wideIDs {
+		return r.uint16()
+	}
+	return uint16(r.uint8())
+}
+
+func (r *avlReader) uint8() uint8 {
+	if b := r.next(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *avlReader) uint16() uint16 {
+	if b := r.next(2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (r *avlReader) uint32() uint32 {
+	if b := r.next(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (r *avlReader) uint64() uint64 {
+	if b := r.next(8); b != nil {
+		return binary.BigEndian.Uint64(b)
+	}
+	return 0
+}
+
+// crc16IBM is the CRC-16/IBM checksum of AVL packets
+func crc16IBM(data []byte) uint16 {
+	var crc uint16
+	for _, b := range data {
+		crc ^= uint16(b)
+		for i := 0; i < 8; i++ {
+			if crc&1 != 0 {
+				crc = crc>>1 ^ 0xA001
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+	return crc
+}
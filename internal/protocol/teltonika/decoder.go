@@ -17,13 +17,14 @@
 package teltonika
 
 import (
-	"bytes"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"log"
+	"math"
 	"time"
 	"tracking/internal/core/model"
+	"tracking/internal/core/util"
 )
 
 // Common Teltonika errors
@@ -36,14 +37,21 @@ var (
 
 type Decoder struct {
 	debug bool
+	clock util.Clock
 }
 
 func NewDecoder() *Decoder {
 	return &Decoder{
 		debug: false,
+		clock: util.SystemClock,
 	}
 }
 
+// SetClock sets the clock used to timestamp records that carry no time
+func (d *Decoder) SetClock(clock util.Clock) {
+	d.clock = clock
+}
+
 // EnableDebug enables detailed logging for protocol parsing
 func (d *Decoder) EnableDebug(enable bool) {
 	d.debug = enable
@@ -92,22 +100,15 @@ func (d *Decoder) Decode(data []byte) (*TeltonikaData, error) {
 			ErrPacketTooShort, len(data))
 	}
 
-	reader := bytes.NewReader(data)
 	result := &TeltonikaData{
-		Timestamp: time.Now(),
+		Timestamp: d.clock.Now(),
 		Valid:     true,
 		Status:    make(map[string]interface{}),
 	}
 
-	// Read latitude (IEEE 754 double-precision)
-	if err := binary.Read(reader, binary.BigEndian, &result.Latitude); err != nil {
-		return nil, fmt.Errorf("failed to read latitude: %w", err)
-	}
-
-	// Read longitude (IEEE 754 double-precision)
-	if err := binary.Read(reader, binary.BigEndian, &result.Longitude); err != nil {
-		return nil, fmt.Errorf("failed to read longitude: %w", err)
-	}
+	// Coordinates are IEEE 754 doubles; the length check above covers both
+	result.Latitude = math.Float64frombits(binary.BigEndian.Uint64(data[0:8]))
+	result.Longitude = math.Float64frombits(binary.BigEndian.Uint64(data[8:16]))
 
 	// Validate coordinates
 	if !isValidCoordinate(result.Latitude, result.Longitude) {
@@ -116,29 +117,22 @@ func (d *Decoder) Decode(data []byte) (*TeltonikaData, error) {
 	}
 
 	// Read optional fields if available
-	if reader.Len() >= 4 {
-		var altitude float32
-		if err := binary.Read(reader, binary.BigEndian, &altitude); err != nil {
-			return nil, fmt.Errorf("failed to read altitude: %w", err)
-		}
-		result.Altitude = float64(altitude)
+	pos := 16
+	if len(data)-pos >= 4 {
+		result.Altitude = float64(math.Float32frombits(binary.BigEndian.Uint32(data[pos:])))
 		result.Status["altitude"] = result.Altitude
+		pos += 4
 	}
 
-	if reader.Len() >= 2 {
-		var speed uint16
-		if err := binary.Read(reader, binary.BigEndian, &speed); err != nil {
-			return nil, fmt.Errorf("failed to read speed: %w", err)
-		}
+	if len(data)-pos >= 2 {
+		speed := binary.BigEndian.Uint16(data[pos:])
 		result.Speed = float64(speed) / 10.0 // Convert to km/h
 		result.Status["speed"] = result.Speed
+		pos += 2
 	}
 
-	if reader.Len() >= 2 {
-		var course uint16
-		if err := binary.Read(reader, binary.BigEndian, &course); err != nil {
-			return nil, fmt.Errorf("failed to read course: %w", err)
-		}
+	if len(data)-pos >= 2 {
+		course := binary.BigEndian.Uint16(data[pos:])
 		if course > 360 {
 			return nil, fmt.Errorf("%w: invalid course value %d", ErrInvalidValue, course)
 		}
@@ -161,6 +155,7 @@ func (d *Decoder) ToPosition(deviceID string, data *TeltonikaData) *model.Positi
 	position.Altitude = data.Altitude
 	position.Protocol = "teltonika"
 	position.Timestamp = data.Timestamp
+	position.Valid = data.Valid
 
 	// Copy all status fields
 	position.Status = make(map[string]interface{})
@@ -169,4 +164,13 @@ func (d *Decoder) ToPosition(deviceID string, data *TeltonikaData) *model.Positi
 	}
 
 	return position
-}
\ No newline at end of file
+}
+
+// ToPositions converts the records of an AVL packet, keeping their order
+func (d *Decoder) ToPositions(deviceID string, records []*TeltonikaData) []*model.Position {
+	positions := make([]*model.Position, 0, len(records))
+	for _, record := range records {
+		positions = append(positions, d.ToPosition(deviceID, record))
+	}
+	return positions
+}
@@ -3,8 +3,12 @@ package teltonika
 import (
 	"bytes"
 	"encoding/binary"
+	"encoding/hex"
+	"errors"
 	"math"
 	"testing"
+	"time"
+	"tracking/internal/core/util"
 )
 
 func TestTeltonikaDecoder(t *testing.T) {
@@ -116,7 +120,7 @@ func TestTeltonikaDecoder(t *testing.T) {
 					t.Errorf("Decode() expected error %v, got nil", tt.wantErr)
 					return
 				}
-				if err.Error() != tt.wantErr.Error() {
+				if !errors.Is(err, tt.wantErr) {
 					t.Errorf("Decode() expected error %v, got %v", tt.wantErr, err)
 				}
 				return
@@ -131,6 +135,29 @@ func TestTeltonikaDecoder(t *testing.T) {
 	}
 }
 
+func TestDecodeUsesClockForTimestamp(t *testing.T) {
+	receivedAt := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	decoder := NewDecoder()
+	decoder.SetClock(util.NewFixedClock(receivedAt))
+
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.BigEndian, 37.7749)
+	binary.Write(buf, binary.BigEndian, -122.4194)
+
+	got, err := decoder.Decode(buf.Bytes())
+	if err != nil {
+		t.Fatalf("Decode() unexpected error: %v", err)
+	}
+	if !got.Timestamp.Equal(receivedAt) {
+		t.Errorf("Timestamp = %v, want %v", got.Timestamp, receivedAt)
+	}
+
+	position := decoder.ToPosition("device-1", got)
+	if !position.Timestamp.Equal(receivedAt) {
+		t.Errorf("Position timestamp = %v, want %v", position.Timestamp, receivedAt)
+	}
+}
+
 func compareTeltonikaData(t *testing.T, got, want *TeltonikaData) {
 	if got.Valid != want.Valid {
 		t.Errorf("Valid = %v, want %v", got.Valid, want.Valid)
@@ -177,4 +204,371 @@ func almostEqual(a, b, epsilon float64) bool {
 		diff = -diff
 	}
 	return diff < epsilon || (math.IsNaN(a) && math.IsNaN(b))
-}
\ No newline at end of file
+}
+
+// avlRecord builds a Codec 8 record with ignition and external voltage IO
+func avlRecord(timestamp time.Time, lat, lon float64, speed uint16) []byte {
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.BigEndian, uint64(timestamp.UnixMilli()))
+	buf.WriteByte(1) // Priority
+	binary.Write(buf, binary.BigEndian, int32(math.Round(lon*1e7)))
+	binary.Write(buf, binary.BigEndian, int32(math.Round(lat*1e7)))
+	binary.Write(buf, binary.BigEndian, int16(120)) // Altitude
+	binary.Write(buf, binary.BigEndian, uint16(90)) // Angle
+	buf.WriteByte(9)                                // Satellites
+	binary.Write(buf, binary.BigEndian, speed)
+	buf.Write([]byte{0xEF, 3})             // Event IO 239, three elements
+	buf.Write([]byte{2, 0xEF, 1, 0x01, 1}) // Ignition on, DIN1
+	buf.Write([]byte{1, 0x42, 0x30, 0x39}) // External voltage 12345 mV
+	buf.Write([]byte{0, 0})                // No 4 or 8 byte elements
+	return buf.Bytes()
+}
+
+// avlPacket wraps records in a Codec 8 packet with a valid CRC
+func avlPacket(records ...[]byte) []byte {
+	return codecPacket(codec8, records...)
+}
+
+// codecPacket wraps records in an AVL packet of the given codec
+func codecPacket(codec byte, records ...[]byte) []byte {
+	body := []byte{codec, byte(len(records))}
+	for _, record := range records {
+		body = append(body, record...)
+	}
+	body = append(body, byte(len(records)))
+
+	packet := make([]byte, 8, len(body)+12)
+	binary.BigEndian.PutUint32(packet[4:], uint32(len(body)))
+	packet = append(packet, body...)
+	return binary.BigEndian.AppendUint32(packet, uint32(crc16IBM(body)))
+}
+
+func TestDecodeAVL(t *testing.T) {
+	first := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	packet := avlPacket(
+		avlRecord(first, 54.6872, 25.2797, 40),
+		avlRecord(first.Add(30*time.Second), -33.8688, 151.2093, 0),
+	)
+
+	decoder := NewDecoder()
+	records, err := decoder.DecodeAVL(packet)
+	if err != nil {
+		t.Fatalf("DecodeAVL() unexpected error: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("Got %d records, want 2", len(records))
+	}
+
+	compareTeltonikaData(t, records[0], &TeltonikaData{
+		Valid: true, Latitude: 54.6872, Longitude: 25.2797, Altitude: 120, Speed: 40, Course: 90,
+	})
+	if !records[0].Timestamp.Equal(first) || !records[1].Timestamp.Equal(first.Add(30*time.Second)) {
+		t.Errorf("Timestamps = %v, %v", records[0].Timestamp, records[1].Timestamp)
+	}
+	if !almostEqual(records[1].Latitude, -33.8688, 0.0001) {
+		t.Errorf("Second latitude = %v, want -33.8688", records[1].Latitude)
+	}
+	status := records[0].Status
+	if status["ignition"] != true || status["externalVoltage"] != 12.345 || status["io1"] != uint64(1) ||
+		status["event"] != uint8(239) || status["satellites"] != uint8(9) {
+		t.Errorf("Status = %v", status)
+	}
+
+	positions := decoder.ToPositions("device-1", records)
+	if len(positions) != 2 || positions[1].Protocol != "teltonika" || !positions[1].Timestamp.Equal(records[1].Timestamp) {
+		t.Errorf("ToPositions() = %+v", positions)
+	}
+
+	if got := AVLResponse(len(records)); !bytes.Equal(got, []byte{0, 0, 0, 2}) {
+		t.Errorf("AVLResponse(2) = % x", got)
+	}
+}
+
+func TestDecodeAVLReferencePacket(t *testing.T) {
+	// One record from the Codec 8 documentation, with no fix
+	packet := []byte{
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x36, 0x08, 0x01,
+		0x00, 0x00, 0x01, 0x6B, 0x40, 0xD8, 0xEA, 0x30, 0x01,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x01, 0x05, 0x02, 0x15, 0x03, 0x01, 0x01, 0x01, 0x42, 0x5E, 0x0F,
+		0x01, 0xF1, 0x00, 0x00, 0x60, 0x1A, 0x01, 0x4E,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x01, 0x00, 0x00, 0xC7, 0xCF,
+	}
+
+	records, err := NewDecoder().DecodeAVL(packet)
+	if err != nil {
+		t.Fatalf("DecodeAVL() unexpected error: %v", err)
+	}
+	if len(records) != 1 || records[0].Valid {
+		t.Fatalf("Records = %+v, want one record without a fix", records)
+	}
+	if want := time.UnixMilli(1560161086000).UTC(); !records[0].Timestamp.Equal(want) {
+		t.Errorf("Timestamp = %v, want %v", records[0].Timestamp, want)
+	}
+	if status := records[0].Status; status["gsmSignal"] != uint64(3) || status["externalVoltage"] != 24.079 ||
+		status["io241"] != uint64(24602) || status["io78"] != uint64(0) {
+		t.Errorf("Status = %v", status)
+	}
+}
+
+func TestDecodeAVLFuel(t *testing.T) {
+	record := avlRecord(time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC), 54.6872, 25.2797, 0)
+	record = append(record[:24], // GPS element
+		0x00, 4, // No event IO, four elements
+		1, 89, 62, // CAN fuel level 62%
+		3, 9, 0x10, 0x68, 201, 0x08, 0x00, 203, 0x00, 0x00, // AIN1 4200 mV, LLS 1 2048, LLS 2 0
+		0, 0, // No 4 or 8 byte elements
+	)
+
+	records, err := NewDecoder().DecodeAVL(avlPacket(record))
+	if err != nil {
+		t.Fatalf("DecodeAVL() unexpected error: %v", err)
+	}
+	if status := records[0].Status; status["fuelLevel"] != 62.0 || status["analogInput1"] != 4.2 ||
+		status["llsFuel1"] != uint64(2048) || status["llsFuel2"] != uint64(0) {
+		t.Errorf("Status = %v", status)
+	}
+}
+
+func TestDecodeAVLErrors(t *testing.T) {
+	record := avlRecord(time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC), 54.6872, 25.2797, 40)
+	valid := avlPacket(record)
+
+	badCRC := append([]byte{}, valid...)
+	badCRC[len(badCRC)-1] ^= 0xFF
+
+	countMismatch := append([]byte{}, valid...)
+	countMismatch[len(countMismatch)-5] = 2
+
+	outOfRange := avlRecord(time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC), 0, 0, 0)
+	binary.BigEndian.PutUint32(outOfRange[13:], uint32(int32(95*1e7)))
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr error
+	}{
+		{"not an AVL packet", []byte{0x00, 0x0F, '3', '5'}, ErrMalformedPacket},
+		{"length mismatch", valid[:len(valid)-1], ErrMalformedPacket},
+		{"bad CRC", badCRC, ErrMalformedPacket},
+		{"record count mismatch", countMismatch, ErrMalformedPacket},
+		{"truncated record", avlPacket(record[:len(record)-1]), ErrPacketTooShort},
+		{"latitude out of range", avlPacket(outOfRange), ErrInvalidCoordinate},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewDecoder().DecodeAVL(tt.data); !errors.Is(err, tt.wantErr) {
+				t.Errorf("DecodeAVL() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// extendedRecord builds a Codec 8 Extended record with an IO ID above 255,
+// a VIN and a BLE beacon payload
+func extendedRecord(timestamp time.Time, lat, lon float64) []byte {
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.BigEndian, uint64(timestamp.UnixMilli()))
+	buf.WriteByte(0) // Priority
+	binary.Write(buf, binary.BigEndian, int32(math.Round(lon*1e7)))
+	binary.Write(buf, binary.BigEndian, int32(math.Round(lat*1e7)))
+	binary.Write(buf, binary.BigEndian, int16(85))   // Altitude
+	binary.Write(buf, binary.BigEndian, uint16(270)) // Angle
+	buf.WriteByte(12)                                // Satellites
+	binary.Write(buf, binary.BigEndian, uint16(62))
+	buf.Write([]byte{0x01, 0x80, 0x00, 0x05})                         // Event IO 384, five elements
+	buf.Write([]byte{0x00, 0x01, 0x00, 0xEF, 0x01})                   // Ignition on
+	buf.Write([]byte{0x00, 0x01, 0x00, 0x42, 0x36, 0xB0})             // External voltage 14000 mV
+	buf.Write([]byte{0x00, 0x01, 0x01, 0x80, 0x00, 0x01, 0xE2, 0x40}) // IO 384 = 123456
+	buf.Write([]byte{0x00, 0x00})                                     // No 8 byte elements
+	buf.Write([]byte{0x00, 0x02})
+	buf.Write([]byte{0x01, 0x00, 0x00, 0x11})
+	buf.WriteString("WVWZZZ1JZXW000001")
+	buf.Write([]byte{0x01, 0x81, 0x00, 0x06, 0x01, 0x21, 0xE2, 0x00, 0xFF, 0xC5})
+	return buf.Bytes()
+}
+
+func TestDecodeAVLCodec8Extended(t *testing.T) {
+	first := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	packet := codecPacket(codec8E, extendedRecord(first, 54.6872, 25.2797), extendedRecord(first.Add(time.Minute), 54.6880, 25.2810))
+	if !IsAVLPacket(packet) {
+		t.Fatal("IsAVLPacket() = false for a Codec 8E packet")
+	}
+
+	records, err := NewDecoder().DecodeAVL(packet)
+	if err != nil {
+		t.Fatalf("DecodeAVL() unexpected error: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("Got %d records, want 2", len(records))
+	}
+	compareTeltonikaData(t, records[0], &TeltonikaData{
+		Valid: true, Latitude: 54.6872, Longitude: 25.2797, Altitude: 85, Speed: 62, Course: 270,
+	})
+	status := records[0].Status
+	if status["event"] != uint16(384) || status["ignition"] != true || status["externalVoltage"] != 14.0 ||
+		status["io384"] != uint64(123456) {
+		t.Errorf("Status = %v", status)
+	}
+	if status["vin"] != "WVWZZZ1JZXW000001" || status["beacons"] != "0121e200ffc5" {
+		t.Errorf("Variable length elements = %q, %q", status["vin"], status["beacons"])
+	}
+
+	// A variable length element running past the record is caught
+	record := extendedRecord(first, 54.6872, 25.2797)
+	record[len(record)-7] = 0x20
+	if _, err := NewDecoder().DecodeAVL(codecPacket(codec8E, record)); !errors.Is(err, ErrPacketTooShort) {
+		t.Errorf("DecodeAVL() error = %v, want %v", err, ErrPacketTooShort)
+	}
+}
+
+func TestDecodeAVLReferencePackets(t *testing.T) {
+	// Codec 8 Extended and Codec 16 examples from the protocol documentation
+	codec8EPacket, _ := hex.DecodeString("000000000000004A8E010000016B412CEE000100000000000000000000000000000000010005000100010100010011001D00010010015E2C880002000B000000003544C87A000E000000001DD7E06A00000100002994")
+	codec16Packet, _ := hex.DecodeString("000000000000005F10020000016BDBC7833000000000000000000000000000000000000B05040200010000030002000B00270042563A00000000016BDBC7871800000000000000000000000000000000000B05040200010000030002000B00260042563A00000200005FB3")
+
+	records, err := NewDecoder().DecodeAVL(codec8EPacket)
+	if err != nil {
+		t.Fatalf("DecodeAVL() of Codec 8E unexpected error: %v", err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("Got %d Codec 8E records, want 1", len(records))
+	}
+	if status := records[0].Status; status["event"] != uint16(1) || status["io1"] != uint64(1) ||
+		status["io17"] != uint64(0x1D) || status["io16"] != uint64(0x015E2C88) || status["io11"] != uint64(0x3544C87A) {
+		t.Errorf("Codec 8E status = %v", status)
+	}
+
+	records, err = NewDecoder().DecodeAVL(codec16Packet)
+	if err != nil {
+		t.Fatalf("DecodeAVL() of Codec 16 unexpected error: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("Got %d Codec 16 records, want 2", len(records))
+	}
+	if want := time.UnixMilli(1562760414000).UTC(); !records[0].Timestamp.Equal(want) {
+		t.Errorf("Timestamp = %v, want %v", records[0].Timestamp, want)
+	}
+	if status := records[1].Status; status["event"] != uint16(11) || status["generation"] != uint8(5) ||
+		status["io11"] != uint64(0x26) || status["io66"] != nil || status["externalVoltage"] != 22.074 {
+		t.Errorf("Codec 16 status = %v", status)
+	}
+}
+
+func TestIMEIPacket(t *testing.T) {
+	packet := append([]byte{0x00, 0x0F}, "352093081452251"...)
+	if imei, err := ParseIMEI(packet); err != nil || imei != "352093081452251" {
+		t.Errorf("ParseIMEI() = %q, %v", imei, err)
+	}
+
+	for _, data := range [][]byte{
+		packet[:10],
+		append([]byte{0x00, 0x0F}, "35209308145225X"...),
+		avlPacket(),
+	} {
+		if IsIMEIPacket(data) {
+			t.Errorf("IsIMEIPacket(% x) = true", data)
+		}
+	}
+}
+
+// benchmarkPacket is a position packet with every optional field
+func benchmarkPacket() []byte {
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.BigEndian, 37.7749)
+	binary.Write(buf, binary.BigEndian, -122.4194)
+	binary.Write(buf, binary.BigEndian, float32(100.5))
+	binary.Write(buf, binary.BigEndian, uint16(455))
+	binary.Write(buf, binary.BigEndian, uint16(180))
+	return buf.Bytes()
+}
+
+// decodeWithBinaryRead is the former reflection-based field reader, kept
+// as the baseline for BenchmarkDecode
+func decodeWithBinaryRead(data []byte) (*TeltonikaData, error) {
+	reader := bytes.NewReader(data)
+	result := &TeltonikaData{Valid: true, Status: make(map[string]interface{})}
+	if err := binary.Read(reader, binary.BigEndian, &result.Latitude); err != nil {
+		return nil, err
+	}
+	if err := binary.Read(reader, binary.BigEndian, &result.Longitude); err != nil {
+		return nil, err
+	}
+	var altitude float32
+	if err := binary.Read(reader, binary.BigEndian, &altitude); err != nil {
+		return nil, err
+	}
+	result.Altitude = float64(altitude)
+	result.Status["altitude"] = result.Altitude
+	var speed, course uint16
+	if err := binary.Read(reader, binary.BigEndian, &speed); err != nil {
+		return nil, err
+	}
+	result.Speed = float64(speed) / 10.0
+	result.Status["speed"] = result.Speed
+	if err := binary.Read(reader, binary.BigEndian, &course); err != nil {
+		return nil, err
+	}
+	result.Course = float64(course)
+	result.Status["course"] = result.Course
+	return result, nil
+}
+
+func BenchmarkDecode(b *testing.B) {
+	packet := benchmarkPacket()
+
+	b.Run("indexed", func(b *testing.B) {
+		decoder := NewDecoder()
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := decoder.Decode(packet); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("binary.Read", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := decodeWithBinaryRead(packet); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkDecodeAVL(b *testing.B) {
+	first := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	records := make([][]byte, 0, 16)
+	for i := 0; i < cap(records); i++ {
+		records = append(records, avlRecord(first.Add(time.Duration(i)*time.Minute), 54.6872, 25.2797, 40))
+	}
+	packet := avlPacket(records...)
+
+	decoder := NewDecoder()
+	b.SetBytes(int64(len(packet)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := decoder.DecodeAVL(packet); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestAVLPacketSize(t *testing.T) {
+	first := avlPacket(avlRecord(time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC), 54.6872, 25.2797, 40))
+	dump := append(append([]byte{}, first...), avlPacket()...)
+
+	size, err := AVLPacketSize(dump)
+	if err != nil || size != len(first) {
+		t.Fatalf("AVLPacketSize() = %d, %v, want %d", size, err, len(first))
+	}
+	if _, err := AVLPacketSize(first[:6]); !errors.Is(err, ErrPacketTooShort) {
+		t.Errorf("AVLPacketSize(short) error = %v, want %v", err, ErrPacketTooShort)
+	}
+	if _, err := AVLPacketSize([]byte{0, 0, 0, 1, 0, 0, 0, 8}); !errors.Is(err, ErrMalformedPacket) {
+		t.Errorf("AVLPacketSize(no preamble) error = %v, want %v", err, ErrMalformedPacket)
+	}
+}
@@ -0,0 +1,354 @@
+// Package watch implements the protocol of 3G GPS watches and kids
+// trackers, framed as [3G*<id>*<length>*<content>]
+package watch
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+	"tracking/internal/core/model"
+	"tracking/internal/core/util"
+)
+
+// Common watch errors
+var (
+	ErrInvalidHeader     = errors.New("invalid watch frame header")
+	ErrInvalidFormat     = errors.New("invalid watch data format")
+	ErrInvalidLength     = errors.New("watch content length mismatch")
+	ErrInvalidCoordinate = errors.New("invalid coordinate value")
+)
+
+// Frames look like
+//
+//	[3G*8800000015*0009*LK,0,0,100]
+//
+// that is the vendor code, the device ID, the content length as four hex
+// digits and the content, whose first field names the message. Location
+// messages carry
+//
+//	UD,220414,134652,A,22.571707,N,113.8613968,E,0.1,0.0,100,7,60,90,1000,50,00000000,2,1,460,0,9360,4082,131,9360,4092,148
+//
+// date DDMMYY and time in UTC, validity, latitude and longitude in decimal
+// degrees, speed km/h, course, altitude, satellites, GSM signal and battery
+// in percent, steps, roll count, a hex status word, then the cell count,
+// a connection delay, MCC, MNC and LAC, cell ID and signal per cell.
+const (
+	frameStart = "["
+	frameEnd   = "]"
+
+	// Message types
+	messageHeartbeat  = "LK"
+	messageLocation   = "UD"
+	messageLocation2  = "UD2" // Sent from memory after a loss of coverage
+	messageAlarm      = "AL"
+	messageSyncQuery  = "TKQ"
+	messageSyncQuery2 = "TKQ2"
+	messageText       = "MESSAGE" // Text shown on the display, echoed bare once shown
+
+	locationFields = 17 // Type through the status word
+	timeLayout     = "020106150405"
+)
+
+// Status word bits raising alarms, most severe first
+var statusAlarms = []struct {
+	bit   uint
+	alarm string
+}{
+	{16, "sos"},
+	{21, "fallDown"},
+	{20, "removing"},
+	{0, "lowBattery"},
+	{17, "lowBattery"},
+	{1, "geofenceExit"},
+	{18, "geofenceExit"},
+	{2, "geofenceEnter"},
+	{19, "geofenceEnter"},
+	{3, "overspeed"},
+}
+
+type Decoder struct {
+	debug bool
+	clock util.Clock
+}
+
+func NewDecoder() *Decoder {
+	return &Decoder{
+		debug: false,
+		clock: util.SystemClock,
+	}
+}
+
+func (d *Decoder) EnableDebug(enable bool) {
+	d.debug = enable
+}
+
+// SetClock sets the clock used for locations without a usable time
+func (d *Decoder) SetClock(clock util.Clock) {
+	d.clock = clock
+}
+
+func (d *Decoder) logDebug(format string, v ...interface{}) {
+	if d.debug {
+		log.Printf("[Watch] "+format, v...)
+	}
+}
+
+// Message is one decoded frame
+type Message struct {
+	Vendor   string // Vendor code such as 3G, echoed in responses
+	DeviceID string
+	Type     string
+	Record   *WatchData // Nil unless the message is a location or alarm
+	Status   map[string]interface{}
+}
+
+// TextDelivered reports whether the message confirms a text sent with
+// EncodeText was shown
+func (m *Message) TextDelivered() bool {
+	return m.Type == messageText
+}
+
+// WatchData is the location carried by UD, UD2 and AL messages
+type WatchData struct {
+	Latitude   float64
+	Longitude  float64
+	Altitude   float64
+	Speed      float64
+	Course     float64
+	Timestamp  time.Time
+	Valid      bool
+	Satellites int
+	Alarm      string
+	Cells      []model.CellTower
+	Status     map[string]interface{}
+}
+
+// IsFrame reports whether data is a watch frame
+func IsFrame(data []byte) bool {
+	s := string(data)
+	if !strings.HasPrefix(s, frameStart) {
+		return false
+	}
+	parts := strings.SplitN(strings.TrimPrefix(s, frameStart), "*", 4)
+	return len(parts) == 4 && len(parts[0]) == 2 && len(parts[2]) == 4
+}
+
+// DeviceID returns the ID a frame reports with
+func DeviceID(data []byte) (string, error) {
+	_, id, _, err := split(data)
+	return id, err
+}
+
+// Vendor returns the vendor code of a frame, which commands to the device
+// must echo
+func Vendor(data []byte) (string, error) {
+	vendor, _, _, err := split(data)
+	return vendor, err
+}
+
+// split returns the vendor code, device ID and content of a frame
+func split(data []byte) (string, string, string, error) {
+	s := strings.TrimSpace(string(data))
+	if !IsFrame(data) || !strings.HasSuffix(s, frameEnd) {
+		return "", "", "", fmt.Errorf("%w: expected [vendor*id*length*content]", ErrInvalidHeader)
+	}
+	parts := strings.SplitN(s[1:len(s)-1], "*", 4)
+	vendor, id, hexLength, content := parts[0], parts[1], parts[2], parts[3]
+	if id == "" {
+		return "", "", "", fmt.Errorf("%w: missing device ID", ErrInvalidFormat)
+	}
+	length, err := strconv.ParseUint(hexLength, 16, 16)
+	if err != nil {
+		return "", "", "", fmt.Errorf("%w: length %q", ErrInvalidFormat, hexLength)
+	}
+	if int(length) != len(content) {
+		return "", "", "", fmt.Errorf("%w: header says %d bytes, got %d", ErrInvalidLength, length, len(content))
+	}
+	return vendor, id, content, nil
+}
+
+// Decode reads a frame. Messages other than locations and alarms decode
+// without a record; heartbeats keep the battery and step counts.
+func (d *Decoder) Decode(data []byte) (*Message, error) {
+	d.logDebug("Received %q", data)
+
+	vendor, id, content, err := split(data)
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.Split(content, ",")
+	message := &Message{
+		Vendor:   vendor,
+		DeviceID: id,
+		Type:     fields[0],
+		Status:   make(map[string]interface{}),
+	}
+
+	switch message.Type {
+	case messageHeartbeat:
+		// LK,steps,rolls,battery on firmware that reports them
+		if len(fields) >= 4 {
+			decodeCounters(fields[1], fields[2], fields[3], message.Status)
+		}
+	case messageLocation, messageLocation2, messageAlarm:
+		record, err := d.decodeLocation(fields)
+		if err != nil {
+			return nil, err
+		}
+		if message.Type == messageLocation2 {
+			record.Status["buffered"] = true
+		}
+		message.Record = record
+	case messageText:
+		// Confirms a text command; the watch sends no text of its own
+	default:
+		d.logDebug("Unhandled %s message from %s", message.Type, id)
+	}
+	return message, nil
+}
+
+func (d *Decoder) decodeLocation(fields []string) (*WatchData, error) {
+	if len(fields) < locationFields {
+		return nil, fmt.Errorf("%w: got %d location fields, need at least %d", ErrInvalidFormat, len(fields), locationFields)
+	}
+	record := &WatchData{Status: make(map[string]interface{})}
+
+	if ts, err := time.Parse(timeLayout, fields[1]+fields[2]); err == nil {
+		record.Timestamp = ts
+	} else {
+		d.logDebug("Failed to parse time %s %s: %v", fields[1], fields[2], err)
+	}
+	record.Valid = fields[3] == "A"
+
+	var err error
+	if record.Latitude, err = parseCoordinate(fields[4], fields[5], 90); err != nil {
+		return nil, fmt.Errorf("invalid latitude: %w", err)
+	}
+	if record.Longitude, err = parseCoordinate(fields[6], fields[7], 180); err != nil {
+		return nil, fmt.Errorf("invalid longitude: %w", err)
+	}
+
+	record.Speed, _ = strconv.ParseFloat(fields[8], 64) // Already km/h
+	record.Course, _ = strconv.ParseFloat(fields[9], 64)
+	record.Altitude, _ = strconv.ParseFloat(fields[10], 64)
+	record.Satellites, _ = strconv.Atoi(fields[11])
+	if signal, err := strconv.Atoi(fields[12]); err == nil {
+		record.Status["gsmSignal"] = signal
+	}
+	decodeCounters(fields[14], fields[15], fields[13], record.Status)
+
+	if status, err := strconv.ParseUint(fields[16], 16, 32); err == nil {
+		for _, sa := range statusAlarms {
+			if status&(1<<sa.bit) != 0 {
+				record.Alarm = sa.alarm
+				record.Status["alarm"] = sa.alarm
+				break
+			}
+		}
+	}
+
+	record.Cells = parseCells(fields[locationFields:])
+	return record, nil
+}
+
+// decodeCounters stores the step count, roll count and battery percentage
+func decodeCounters(steps, rolls, battery string, status map[string]interface{}) {
+	if n, err := strconv.Atoi(steps); err == nil {
+		status["steps"] = n
+	}
+	if n, err := strconv.Atoi(rolls); err == nil {
+		status["rolls"] = n
+	}
+	if n, err := strconv.ParseUint(battery, 10, 8); err == nil && n <= 100 {
+		status["battery"] = uint8(n)
+	}
+}
+
+// parseCells reads the cell count, connection delay, MCC and MNC, then LAC,
+// cell ID and signal per cell
+func parseCells(fields []string) []model.CellTower {
+	if len(fields) < 4 {
+		return nil
+	}
+	count, err1 := strconv.Atoi(fields[0])
+	mcc, err2 := strconv.Atoi(fields[2])
+	mnc, err3 := strconv.Atoi(fields[3])
+	if err1 != nil || err2 != nil || err3 != nil || mcc == 0 {
+		return nil
+	}
+
+	var cells []model.CellTower
+	for i := 0; i < count && 4+3*i+2 < len(fields); i++ {
+		cell := fields[4+3*i : 4+3*i+3]
+		lac, err1 := strconv.Atoi(cell[0])
+		cid, err2 := strconv.Atoi(cell[1])
+		if err1 != nil || err2 != nil {
+			break
+		}
+		tower := model.CellTower{
+			MobileCountryCode: mcc,
+			MobileNetworkCode: mnc,
+			LocationAreaCode:  lac,
+			CellID:            cid,
+		}
+		if signal, err := strconv.Atoi(cell[2]); err == nil {
+			tower.SignalStrength = signal
+		}
+		cells = append(cells, tower)
+	}
+	return cells
+}
+
+func parseCoordinate(value, hemisphere string, limit float64) (float64, error) {
+	coordinate, err := strconv.ParseFloat(value, 64)
+	if err != nil || coordinate > limit {
+		return 0, fmt.Errorf("%w: %s", ErrInvalidCoordinate, value)
+	}
+	switch hemisphere {
+	case "N", "E":
+	case "S", "W":
+		coordinate = -coordinate
+	default:
+		return 0, fmt.Errorf("%w: hemisphere %q", ErrInvalidCoordinate, hemisphere)
+	}
+	return coordinate, nil
+}
+
+// Response is the server reply to a message. Watches drop the connection
+// when heartbeats go unanswered; alarms and time sync queries are answered
+// too. Other messages get no reply.
+func (d *Decoder) Response(message *Message) []byte {
+	switch message.Type {
+	case messageHeartbeat, messageAlarm, messageSyncQuery, messageSyncQuery2:
+		return []byte(fmt.Sprintf("[%s*%s*%04X*%s]", message.Vendor, message.DeviceID, len(message.Type), message.Type))
+	}
+	return nil
+}
+
+// ToPosition converts the location of a message
+func (d *Decoder) ToPosition(deviceID string, data *WatchData) *model.Position {
+	position := model.NewPosition(deviceID, data.Latitude, data.Longitude)
+	position.Altitude = data.Altitude
+	position.Speed = data.Speed
+	position.Course = data.Course
+	position.Valid = data.Valid
+	position.SetDecodedTime(data.Timestamp, d.clock.Now())
+	position.Protocol = "watch"
+
+	position.Status = make(map[string]interface{}, len(data.Status)+1)
+	for k, v := range data.Status {
+		position.Status[k] = v
+	}
+	position.Status["satellites"] = data.Satellites
+
+	if len(data.Cells) > 0 {
+		position.Network = &model.Network{RadioType: "gsm"}
+		for _, cell := range data.Cells {
+			position.Network.AddCellTower(cell)
+		}
+	}
+	return position
+}
@@ -0,0 +1,272 @@
+package watch
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+	"tracking/internal/core/util"
+)
+
+const location = "220414,134652,A,22.571707,N,113.8613968,E,0.1,0.0,100,7,60,90,1000,50,00000000,2,1,460,0,9360,4082,131,9360,4092,148"
+
+// frame wraps content in a 3G header with its length
+func frame(content string) string {
+	return fmt.Sprintf("[3G*8800000015*%04X*%s]", len(content), content)
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		typ     string
+		record  bool
+		check   func(t *testing.T, m *Message)
+		wantErr error
+	}{
+		{
+			name: "bare heartbeat",
+			data: "[3G*8800000015*0002*LK]",
+			typ:  "LK",
+			check: func(t *testing.T, m *Message) {
+				if m.Vendor != "3G" || len(m.Status) != 0 {
+					t.Errorf("Message = %+v", m)
+				}
+			},
+		},
+		{
+			name: "heartbeat with counters",
+			data: "[3G*8800000015*000C*LK,2500,3,85]",
+			typ:  "LK",
+			check: func(t *testing.T, m *Message) {
+				if m.Status["steps"] != 2500 || m.Status["rolls"] != 3 || m.Status["battery"] != uint8(85) {
+					t.Errorf("Status = %v", m.Status)
+				}
+			},
+		},
+		{
+			name:   "location",
+			data:   frame("UD," + location),
+			typ:    "UD",
+			record: true,
+			check: func(t *testing.T, m *Message) {
+				r := m.Record
+				if r.Latitude != 22.571707 || r.Longitude != 113.8613968 || !r.Valid {
+					t.Errorf("Fix = %+v", r)
+				}
+				if r.Speed != 0.1 || r.Altitude != 100 || r.Satellites != 7 {
+					t.Errorf("Fix = %+v", r)
+				}
+				if want := time.Date(2014, 4, 22, 13, 46, 52, 0, time.UTC); !r.Timestamp.Equal(want) {
+					t.Errorf("Timestamp = %v, want %v", r.Timestamp, want)
+				}
+				if r.Status["gsmSignal"] != 60 || r.Status["battery"] != uint8(90) || r.Status["steps"] != 1000 || r.Status["rolls"] != 50 {
+					t.Errorf("Status = %v", r.Status)
+				}
+				if r.Alarm != "" || r.Status["buffered"] != nil {
+					t.Errorf("Alarm = %q, status = %v", r.Alarm, r.Status)
+				}
+				if len(r.Cells) != 2 || r.Cells[0].MobileCountryCode != 460 || r.Cells[0].LocationAreaCode != 9360 ||
+					r.Cells[1].CellID != 4092 || r.Cells[1].SignalStrength != 148 {
+					t.Errorf("Cells = %+v", r.Cells)
+				}
+			},
+		},
+		{
+			name:   "buffered location",
+			data:   frame("UD2," + location),
+			typ:    "UD2",
+			record: true,
+			check: func(t *testing.T, m *Message) {
+				if m.Record.Status["buffered"] != true {
+					t.Errorf("Status = %v", m.Record.Status)
+				}
+			},
+		},
+		{
+			name:   "SOS alarm",
+			data:   frame("AL,220414,134652,V,33.8688,S,151.2093,W,0.0,0.0,0,0,40,15,0,0,00010001,0,1,460,0"),
+			typ:    "AL",
+			record: true,
+			check: func(t *testing.T, m *Message) {
+				r := m.Record
+				if r.Valid || r.Latitude != -33.8688 || r.Longitude != -151.2093 {
+					t.Errorf("Fix = %+v", r)
+				}
+				// SOS outranks the low battery bit also set
+				if r.Alarm != "sos" || r.Status["alarm"] != "sos" {
+					t.Errorf("Alarm = %q", r.Alarm)
+				}
+				if len(r.Cells) != 0 {
+					t.Errorf("Cells = %+v", r.Cells)
+				}
+			},
+		},
+		{
+			name: "unhandled message",
+			data: frame("TKQ"),
+			typ:  "TKQ",
+		},
+		{
+			name:    "invalid header",
+			data:    "##,imei:359586015829802,A;",
+			wantErr: ErrInvalidHeader,
+		},
+		{
+			name:    "unterminated frame",
+			data:    "[3G*8800000015*0002*LK",
+			wantErr: ErrInvalidHeader,
+		},
+		{
+			name:    "length mismatch",
+			data:    "[3G*8800000015*0004*LK]",
+			wantErr: ErrInvalidLength,
+		},
+		{
+			name:    "too few location fields",
+			data:    frame("UD,220414,134652,A,22.571707,N"),
+			wantErr: ErrInvalidFormat,
+		},
+		{
+			name:    "invalid hemisphere",
+			data:    frame("UD,220414,134652,A,22.571707,X,113.8613968,E,0.1,0.0,100,7,60,90,1000,50,00000000"),
+			wantErr: ErrInvalidCoordinate,
+		},
+	}
+
+	decoder := NewDecoder()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message, err := decoder.Decode([]byte(tt.data))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Decode() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if message.Type != tt.typ || message.DeviceID != "8800000015" {
+				t.Errorf("Message = %+v", message)
+			}
+			if (message.Record != nil) != tt.record {
+				t.Fatalf("Record = %+v, want record %v", message.Record, tt.record)
+			}
+			if tt.check != nil {
+				tt.check(t, message)
+			}
+		})
+	}
+}
+
+func TestIsFrame(t *testing.T) {
+	tests := []struct {
+		data string
+		want bool
+	}{
+		{"[3G*8800000015*0002*LK]", true},
+		{"[SG*8800000015*0002*LK]", true},
+		{"[3G*8800000015*0002*LK", true}, // Truncated, rejected by Decode
+		{"[3G*8800000015*LK]", false},
+		{"[GPS*8800000015*0002*LK]", false},
+		{"##,imei:359586015829802,A;", false},
+		{"*HQ,4210051415,V1,121513,A#", false},
+	}
+	for _, tt := range tests {
+		if got := IsFrame([]byte(tt.data)); got != tt.want {
+			t.Errorf("IsFrame(%q) = %v, want %v", tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestResponse(t *testing.T) {
+	decoder := NewDecoder()
+	tests := []struct {
+		data string
+		want string
+	}{
+		{"[3G*8800000015*000C*LK,2500,3,85]", "[3G*8800000015*0002*LK]"},
+		{"[SG*8800000015*0002*LK]", "[SG*8800000015*0002*LK]"},
+		{frame("AL," + location), "[3G*8800000015*0002*AL]"},
+		{frame("TKQ"), "[3G*8800000015*0003*TKQ]"},
+		{frame("UD," + location), ""},
+	}
+	for _, tt := range tests {
+		message, err := decoder.Decode([]byte(tt.data))
+		if err != nil {
+			t.Fatalf("Decode(%q) error = %v", tt.data, err)
+		}
+		if got := string(decoder.Response(message)); got != tt.want {
+			t.Errorf("Response(%q) = %q, want %q", tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestToPosition(t *testing.T) {
+	now := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	decoder := NewDecoder()
+	decoder.SetClock(util.NewFixedClock(now))
+
+	// The date is missing, so the position takes the clock's time
+	message, err := decoder.Decode([]byte(frame("UD,,,A,22.571707,N,113.8613968,E,0.1,0.0,100,7,60,90,1000,50,00000000,2,1,460,0,9360,4082,131")))
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	position := decoder.ToPosition("device-1", message.Record)
+	if position.Protocol != "watch" || position.DeviceID != "device-1" || !position.Timestamp.Equal(now) {
+		t.Errorf("Position = %+v", position)
+	}
+	if position.Status["satellites"] != 7 || position.Status["battery"] != uint8(90) {
+		t.Errorf("Status = %v", position.Status)
+	}
+	if position.Network == nil || len(position.Network.CellTowers) != 1 || position.Network.CellTowers[0].CellID != 4082 {
+		t.Errorf("Network = %+v", position.Network)
+	}
+}
+
+func TestEncodeText(t *testing.T) {
+	decoder := NewDecoder()
+	tests := []struct {
+		name    string
+		text    string
+		want    string
+		wantErr bool
+	}{
+		{"ascii", "Hi", "[3G*8800000015*0010*MESSAGE,00480069]", false},
+		{"accented", "Arrêt", "[3G*8800000015*001C*MESSAGE,00410072007200EA0074]", false},
+		{"empty", "", "", true},
+		{"too long", strings.Repeat("a", maxTextLength+1), "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			packet, err := decoder.EncodeText("3G", "8800000015", tt.text)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidText) {
+					t.Fatalf("EncodeText() error = %v, want %v", err, ErrInvalidText)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("EncodeText() error = %v", err)
+			}
+			if string(packet) != tt.want {
+				t.Errorf("EncodeText() = %s, want %s", packet, tt.want)
+			}
+			// The encoded frame is itself a valid watch frame
+			if _, err := decoder.Decode(packet); err != nil {
+				t.Errorf("Decode(EncodeText()) error = %v", err)
+			}
+		})
+	}
+
+	// The watch confirms the text with a bare MESSAGE
+	ack, err := decoder.Decode([]byte(frame("MESSAGE")))
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if !ack.TextDelivered() || decoder.Response(ack) != nil {
+		t.Errorf("Acknowledgement = %+v, want a delivery without reply", ack)
+	}
+}
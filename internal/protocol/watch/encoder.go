@@ -0,0 +1,40 @@
+package watch
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+)
+
+// CommandText shows a text message on the watch display. It is listed in
+// device profiles like the GT06 and H02 commands.
+const CommandText = "text"
+
+// maxTextLength is how many UTF-16 units watch displays accept
+const maxTextLength = 100
+
+// ErrInvalidText is returned for text a watch cannot display
+var ErrInvalidText = errors.New("invalid text message")
+
+// EncodeText builds a MESSAGE command, which carries the text as UTF-16BE in
+// hex, such as [3G*8800000015*0010*MESSAGE,00480069] for "Hi". vendor is the
+// code the watch reports with. The watch confirms it with a bare MESSAGE.
+func (d *Decoder) EncodeText(vendor, deviceID, text string) ([]byte, error) {
+	units := utf16.Encode([]rune(text))
+	if len(units) == 0 || len(units) > maxTextLength {
+		return nil, fmt.Errorf("%w: need 1 to %d characters, got %d", ErrInvalidText, maxTextLength, len(units))
+	}
+	if vendor == "" || deviceID == "" {
+		return nil, fmt.Errorf("%w: missing vendor code or device ID", ErrInvalidText)
+	}
+
+	var hex strings.Builder
+	for _, unit := range units {
+		fmt.Fprintf(&hex, "%04X", unit)
+	}
+	content := messageText + "," + hex.String()
+	packet := []byte(fmt.Sprintf("[%s*%s*%04X*%s]", vendor, deviceID, len(content), content))
+	d.logDebug("Sending %q", packet)
+	return packet, nil
+}
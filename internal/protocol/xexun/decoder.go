@@ -0,0 +1,299 @@
+// Package xexun implements the ASCII protocol of the Xexun TK102 and
+// TK103-2 trackers, whose reports embed a GPRMC sentence
+package xexun
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+	"tracking/internal/core/model"
+	"tracking/internal/core/util"
+	"tracking/internal/protocol/nmea"
+)
+
+// Common Xexun errors
+var (
+	ErrInvalidHeader = errors.New("invalid Xexun frame header")
+	ErrInvalidFormat = errors.New("invalid Xexun data format")
+)
+
+// Reports are not answered and look like
+//
+//	090805215127,+22200000000,GPRMC,215127.083,A,4620.0044,N,01234.5678,E,0.00,,060805,,,A*4E,F,help me,imei:359587010124900,05,234.5,F:4.12V,1,139,2689,214,01,2AFD,0E3F
+//
+// that is a serial (the local time YYMMDDhhmmss), the admin phone number,
+// a GPRMC sentence, F or L for full or lost GPS signal, the message of
+// alarm reports (empty or "tracker" for periodic ones), the IMEI, the
+// satellites in use, altitude, battery voltage flagged F (full) or L
+// (low), whether the battery is charging and, on TK103-2 firmware, the
+// length and CRC of the report followed by MCC, MNC, LAC and cell ID with
+// the last two in hex.
+const (
+	rmcTag     = "GPRMC"
+	imeiPrefix = "imei:"
+	signalFull = "F"
+	minRMC     = 9 // RMC fields up to the date
+)
+
+// messageAlarms maps report messages to the alarm they raise
+var messageAlarms = map[string]string{
+	"help me":       "sos",
+	"low battery":   "lowBattery",
+	"move!":         "movement",
+	"speed!":        "overspeed",
+	"stockade!":     "geofence",
+	"ac alarm!":     "powerCut",
+	"door alarm!":   "door",
+	"sensor alarm!": "vibration",
+}
+
+type Decoder struct {
+	debug bool
+	clock util.Clock
+}
+
+func NewDecoder() *Decoder {
+	return &Decoder{
+		debug: false,
+		clock: util.SystemClock,
+	}
+}
+
+func (d *Decoder) EnableDebug(enable bool) {
+	d.debug = enable
+}
+
+// SetClock sets the clock used for reports without a usable time
+func (d *Decoder) SetClock(clock util.Clock) {
+	d.clock = clock
+}
+
+func (d *Decoder) logDebug(format string, v ...interface{}) {
+	if d.debug {
+		log.Printf("[Xexun] "+format, v...)
+	}
+}
+
+// XexunData is one decoded report
+type XexunData struct {
+	IMEI       string
+	Serial     string
+	Phone      string
+	Latitude   float64
+	Longitude  float64
+	Altitude   float64
+	Speed      float64
+	Course     float64
+	Satellites int
+	Timestamp  time.Time
+	Valid      bool
+	Alarm      string
+	Cell       *model.CellTower
+	Status     map[string]interface{}
+}
+
+// IsFrame reports whether data is a Xexun report
+func IsFrame(data []byte) bool {
+	s := string(data)
+	return strings.Contains(s, ","+rmcTag+",") && strings.Contains(s, imeiPrefix)
+}
+
+// DeviceID returns the IMEI a report carries
+func DeviceID(data []byte) (string, error) {
+	if !IsFrame(data) {
+		return "", fmt.Errorf("%w: expected a GPRMC report", ErrInvalidHeader)
+	}
+	fields := split(data)
+	for _, field := range fields {
+		if imei, ok := strings.CutPrefix(field, imeiPrefix); ok && isIMEI(imei) {
+			return imei, nil
+		}
+	}
+	return "", fmt.Errorf("%w: no IMEI", ErrInvalidFormat)
+}
+
+func split(data []byte) []string {
+	s := strings.TrimSpace(string(data))
+	s = strings.TrimSuffix(s, ";")
+	fields := strings.Split(s, ",")
+	for i := range fields {
+		fields[i] = strings.TrimSpace(fields[i])
+	}
+	return fields
+}
+
+// Decode reads a periodic or alarm report
+func (d *Decoder) Decode(data []byte) (*XexunData, error) {
+	d.logDebug("Received %q", data)
+	if !IsFrame(data) {
+		return nil, fmt.Errorf("%w: expected a GPRMC report", ErrInvalidHeader)
+	}
+
+	fields := split(data)
+	rmcStart := -1
+	for i, field := range fields {
+		if field == rmcTag {
+			rmcStart = i + 1
+			break
+		}
+	}
+	if rmcStart < 2 {
+		return nil, fmt.Errorf("%w: GPRMC must follow the serial and phone", ErrInvalidFormat)
+	}
+	// The sentence ends with the field carrying its checksum
+	rmcEnd := rmcStart
+	for rmcEnd < len(fields) && !strings.Contains(fields[rmcEnd], "*") {
+		rmcEnd++
+	}
+	if rmcEnd == len(fields) || rmcEnd-rmcStart+1 < minRMC {
+		return nil, fmt.Errorf("%w: truncated GPRMC", ErrInvalidFormat)
+	}
+
+	rmc := append([]string(nil), fields[rmcStart:rmcEnd+1]...)
+	rmc[len(rmc)-1], _, _ = strings.Cut(rmc[len(rmc)-1], "*")
+	fix, err := nmea.ParseRMC(rmc)
+	if err != nil {
+		return nil, err
+	}
+
+	record := &XexunData{
+		Serial:    fields[0],
+		Phone:     fields[1],
+		Latitude:  fix.Latitude,
+		Longitude: fix.Longitude,
+		Speed:     fix.Speed,
+		Course:    fix.Course,
+		Timestamp: fix.Timestamp,
+		Valid:     fix.Valid,
+		Status:    make(map[string]interface{}),
+	}
+
+	rest := fields[rmcEnd+1:]
+	imeiIndex := -1
+	for i, field := range rest {
+		if strings.HasPrefix(field, imeiPrefix) {
+			imeiIndex = i
+			break
+		}
+	}
+	if imeiIndex < 1 {
+		return nil, fmt.Errorf("%w: no signal flag and IMEI after GPRMC", ErrInvalidFormat)
+	}
+	record.IMEI = strings.TrimPrefix(rest[imeiIndex], imeiPrefix)
+	if !isIMEI(record.IMEI) {
+		return nil, fmt.Errorf("%w: invalid IMEI %q", ErrInvalidFormat, record.IMEI)
+	}
+
+	// A lost signal leaves the last fix in the sentence
+	if rest[0] != signalFull {
+		record.Valid = false
+	}
+	if imeiIndex > 1 {
+		d.applyMessage(strings.Join(rest[1:imeiIndex], ","), record)
+	}
+	d.decodeTrailer(rest[imeiIndex+1:], record)
+	return record, nil
+}
+
+// applyMessage sets the alarm or ignition state a report message carries
+func (d *Decoder) applyMessage(message string, record *XexunData) {
+	switch message = strings.ToLower(message); message {
+	case "", "tracker":
+	case "acc on":
+		record.Status["ignition"] = true
+	case "acc off":
+		record.Status["ignition"] = false
+	default:
+		if alarm, ok := messageAlarms[message]; ok {
+			record.Alarm = alarm
+			record.Status["alarm"] = alarm
+		} else {
+			record.Status["event"] = message
+		}
+	}
+}
+
+// decodeTrailer reads the fields after the IMEI: satellites, altitude,
+// battery, charging and, on TK103-2 firmware, length, CRC and the cell
+func (d *Decoder) decodeTrailer(fields []string, record *XexunData) {
+	if len(fields) > 0 {
+		record.Satellites, _ = strconv.Atoi(fields[0])
+	}
+	if len(fields) > 1 {
+		record.Altitude, _ = strconv.ParseFloat(fields[1], 64)
+	}
+	if len(fields) > 2 {
+		if state, voltage, ok := strings.Cut(fields[2], ":"); ok {
+			if volts, err := strconv.ParseFloat(strings.TrimSuffix(voltage, "V"), 64); err == nil {
+				record.Status["batteryVoltage"] = volts
+			}
+			record.Status["lowBattery"] = state == "L"
+		}
+	}
+	if len(fields) > 3 && fields[3] != "" {
+		record.Status["charging"] = fields[3] == "1"
+	}
+	if len(fields) > 9 {
+		mcc, err1 := strconv.Atoi(fields[6])
+		mnc, err2 := strconv.Atoi(fields[7])
+		lac, err3 := strconv.ParseInt(fields[8], 16, 32)
+		cell, err4 := strconv.ParseInt(fields[9], 16, 32)
+		if err1 == nil && err2 == nil && err3 == nil && err4 == nil {
+			record.Cell = &model.CellTower{
+				MobileCountryCode: mcc,
+				MobileNetworkCode: mnc,
+				LocationAreaCode:  int(lac),
+				CellID:            int(cell),
+			}
+		} else {
+			d.logDebug("Skipping malformed cell %v", fields[6:10])
+		}
+	}
+}
+
+func isIMEI(s string) bool {
+	if len(s) < 10 || len(s) > 16 {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// ToPosition converts a report
+func (d *Decoder) ToPosition(deviceID string, data *XexunData) *model.Position {
+	position := model.NewPosition(deviceID, data.Latitude, data.Longitude)
+	position.Altitude = data.Altitude
+	position.Speed = data.Speed
+	position.Course = data.Course
+	position.Valid = data.Valid
+	position.Satellites = uint8(data.Satellites)
+	position.SetDecodedTime(data.Timestamp, d.clock.Now())
+	position.Protocol = "xexun"
+
+	position.Status = make(map[string]interface{}, len(data.Status))
+	for k, v := range data.Status {
+		position.Status[k] = v
+	}
+	if data.Cell != nil {
+		position.Network = &model.Network{RadioType: "gsm"}
+		position.Network.AddCellTower(*data.Cell)
+	}
+	return position
+}
+
+// DecodePositions decodes a report for the protocol registry; reports are
+// not answered
+func (d *Decoder) DecodePositions(deviceID string, data []byte) ([]*model.Position, []byte, error) {
+	record, err := d.Decode(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	return []*model.Position{d.ToPosition(deviceID, record)}, nil, nil
+}
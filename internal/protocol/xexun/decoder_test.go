@@ -0,0 +1,92 @@
+package xexun
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+	"tracking/internal/protocol/nmea"
+)
+
+const (
+	// TK102 periodic report without the cell trailer
+	periodicReport = "090805215127,+22200000000,GPRMC,215127.083,A,4620.0044,N,01234.5678,E,10.00,90.0,060805,,,A*4E,F,,imei:359587010124900,05,234.5,F:4.12V,0,139,2689;"
+	// TK103-2 SOS alarm with the serving cell, sent while charging
+	alarmReport = "100518102522,+8613800000000,GPRMC,102522.000,A,2233.1245,N,11403.0023,E,0.00,,180510,,,A*7C,F,help me,imei:359587010124901,08,38.4,L:3.61V,1,128,38762,460,00,247C,0E3F"
+	// Report sent with the GPS signal lost, repeating the last fix
+	lostSignalReport = "100518103000,,GPRMC,103000.000,V,2233.1245,N,11403.0023,E,0.00,,180510,,,N*65,L,tracker,imei:359587010124901,00,0.0,F:4.05V,0"
+)
+
+func TestDecode(t *testing.T) {
+	decoder := NewDecoder()
+
+	record, err := decoder.Decode([]byte(periodicReport))
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if record.IMEI != "359587010124900" || record.Phone != "+22200000000" || !record.Valid ||
+		math.Abs(record.Latitude-46.33340667) > 1e-6 || math.Abs(record.Longitude-12.57613) > 1e-6 {
+		t.Errorf("Decode() = %+v", record)
+	}
+	if math.Abs(record.Speed-18.52) > 1e-9 || record.Course != 90 || record.Altitude != 234.5 || record.Satellites != 5 {
+		t.Errorf("Motion = %.2f km/h, %v, %v m, %d satellites", record.Speed, record.Course, record.Altitude, record.Satellites)
+	}
+	if want := time.Date(2005, 8, 6, 21, 51, 27, 83e6, time.UTC); !record.Timestamp.Equal(want) {
+		t.Errorf("Timestamp = %v, want %v", record.Timestamp, want)
+	}
+	if record.Alarm != "" || record.Status["batteryVoltage"] != 4.12 || record.Status["lowBattery"] != false ||
+		record.Status["charging"] != false || record.Cell != nil {
+		t.Errorf("Status = %v, cell %v", record.Status, record.Cell)
+	}
+
+	record, err = decoder.Decode([]byte(alarmReport))
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if record.Alarm != "sos" || record.Status["alarm"] != "sos" || record.Status["lowBattery"] != true ||
+		record.Status["charging"] != true || record.Status["batteryVoltage"] != 3.61 {
+		t.Errorf("Alarm status = %v", record.Status)
+	}
+	if cell := record.Cell; cell == nil || cell.MobileCountryCode != 460 || cell.MobileNetworkCode != 0 ||
+		cell.LocationAreaCode != 0x247C || cell.CellID != 0x0E3F {
+		t.Errorf("Cell = %+v", record.Cell)
+	}
+
+	position := decoder.ToPosition("device-1", record)
+	if position.Protocol != "xexun" || position.Satellites != 8 || position.Status["alarm"] != "sos" ||
+		position.Network == nil || len(position.Network.CellTowers) != 1 {
+		t.Errorf("ToPosition() = %+v", position)
+	}
+
+	record, err = decoder.Decode([]byte(lostSignalReport))
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if record.Valid || record.Phone != "" || record.Alarm != "" {
+		t.Errorf("Lost signal report = %+v", record)
+	}
+
+	for _, tt := range []struct {
+		name    string
+		data    string
+		wantErr error
+	}{
+		{"not Xexun", "imei:359586015829802,tracker,1210221219,,F,041905.000,A,2237.7514,N,11408.6214,E,0.00,0;", ErrInvalidHeader},
+		{"truncated GPRMC", "090805215127,+222,GPRMC,215127.083,A,4620.0044,N*4E,F,,imei:359587010124900,05", ErrInvalidFormat},
+		{"missing IMEI", "090805215127,+222,GPRMC,215127.083,A,4620.0044,N,01234.5678,E,0.00,,060805,,,A*4E,imei:", ErrInvalidFormat},
+		{"bad coordinate", "090805215127,+222,GPRMC,215127.083,A,4620.0044,X,01234.5678,E,0.00,,060805,,,A*4E,F,,imei:359587010124900", nmea.ErrInvalidCoordinate},
+	} {
+		if _, err := decoder.Decode([]byte(tt.data)); !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: Decode() error = %v, want %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestDeviceID(t *testing.T) {
+	if imei, err := DeviceID([]byte(alarmReport)); err != nil || imei != "359587010124901" {
+		t.Errorf("DeviceID() = %q, %v", imei, err)
+	}
+	if IsFrame([]byte("$GPRMC,123519,A,4807.038,N,01131.000,E,022.4,084.4,230394,003.1,W*6A")) {
+		t.Error("IsFrame() accepted a bare NMEA sentence")
+	}
+}
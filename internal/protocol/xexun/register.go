@@ -0,0 +1,12 @@
+package xexun
+
+import "tracking/internal/protocol/registry"
+
+func init() {
+	registry.Register(&registry.Protocol{
+		Name:       "xexun",
+		IsFrame:    IsFrame,
+		DeviceID:   DeviceID,
+		NewDecoder: func() registry.Decoder { return NewDecoder() },
+	})
+}
@@ -0,0 +1,150 @@
+package seed
+
+import (
+	"embed"
+	"fmt"
+	"math"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Routes are encoded polylines (precision 1e5) tracing real streets, one
+// per file under routes/
+//
+//go:embed routes/*.polyline
+var routeFiles embed.FS
+
+// Point is a coordinate in decimal degrees
+type Point struct {
+	Lat float64
+	Lon float64
+}
+
+// Route is a path vehicles are driven along, with the distance from its
+// start to each point
+type Route struct {
+	Name   string
+	Points []Point
+	cumul  []float64 // Meters from the first point
+}
+
+// Length returns the route length in meters
+func (r *Route) Length() float64 {
+	return r.cumul[len(r.cumul)-1]
+}
+
+// At returns the point the given distance along the route and the bearing
+// of the segment it lies on, in degrees from north
+func (r *Route) At(distance float64) (Point, float64) {
+	if distance <= 0 {
+		return r.Points[0], bearing(r.Points[0], r.Points[1])
+	}
+	i := sort.SearchFloat64s(r.cumul, distance)
+	if i >= len(r.cumul) {
+		last := len(r.Points) - 1
+		return r.Points[last], bearing(r.Points[last-1], r.Points[last])
+	}
+	if i == 0 {
+		i = 1
+	}
+	from, to := r.Points[i-1], r.Points[i]
+	f := (distance - r.cumul[i-1]) / (r.cumul[i] - r.cumul[i-1])
+	return Point{
+		Lat: from.Lat + (to.Lat-from.Lat)*f,
+		Lon: from.Lon + (to.Lon-from.Lon)*f,
+	}, bearing(from, to)
+}
+
+func newRoute(name string, points []Point) (*Route, error) {
+	if len(points) < 2 {
+		return nil, fmt.Errorf("route %s has %d points, need at least 2", name, len(points))
+	}
+	route := &Route{Name: name, Points: points, cumul: make([]float64, len(points))}
+	for i := 1; i < len(points); i++ {
+		route.cumul[i] = route.cumul[i-1] + distance(points[i-1], points[i])
+	}
+	return route, nil
+}
+
+// LoadRoutes returns the bundled routes sorted by name
+func LoadRoutes() ([]*Route, error) {
+	entries, err := routeFiles.ReadDir("routes")
+	if err != nil {
+		return nil, err
+	}
+
+	var routes []*Route
+	for _, entry := range entries {
+		data, err := routeFiles.ReadFile(path.Join("routes", entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		points, err := DecodePolyline(strings.TrimSpace(string(data)))
+		if err != nil {
+			return nil, fmt.Errorf("route %s: %v", entry.Name(), err)
+		}
+		route, err := newRoute(strings.TrimSuffix(entry.Name(), ".polyline"), points)
+		if err != nil {
+			return nil, err
+		}
+		routes = append(routes, route)
+	}
+	sort.Slice(routes, func(i, j int) bool { return routes[i].Name < routes[j].Name })
+	return routes, nil
+}
+
+// DecodePolyline decodes the encoded polyline format with five decimals
+func DecodePolyline(encoded string) ([]Point, error) {
+	var points []Point
+	var lat, lon int
+	for i := 0; i < len(encoded); {
+		var deltas [2]int
+		for k := range deltas {
+			var result, shift uint
+			for {
+				if i >= len(encoded) {
+					return nil, fmt.Errorf("truncated polyline at byte %d", i)
+				}
+				b := uint(encoded[i]) - 63
+				i++
+				if b > 0x3f {
+					return nil, fmt.Errorf("invalid polyline byte %q", encoded[i-1])
+				}
+				result |= (b & 0x1f) << shift
+				shift += 5
+				if b < 0x20 {
+					break
+				}
+			}
+			if result&1 != 0 {
+				deltas[k] = ^int(result >> 1)
+			} else {
+				deltas[k] = int(result >> 1)
+			}
+		}
+		lat += deltas[0]
+		lon += deltas[1]
+		points = append(points, Point{Lat: float64(lat) / 1e5, Lon: float64(lon) / 1e5})
+	}
+	return points, nil
+}
+
+// distance returns the haversine distance between two points in meters
+func distance(a, b Point) float64 {
+	const earthRadius = 6371000.0
+	lat1, lat2 := a.Lat*math.Pi/180, b.Lat*math.Pi/180
+	dLat := lat2 - lat1
+	dLon := (b.Lon - a.Lon) * math.Pi / 180
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(h))
+}
+
+// bearing returns the initial bearing from a to b in degrees from north
+func bearing(a, b Point) float64 {
+	lat1, lat2 := a.Lat*math.Pi/180, b.Lat*math.Pi/180
+	dLon := (b.Lon - a.Lon) * math.Pi / 180
+	y := math.Sin(dLon) * math.Cos(lat2)
+	x := math.Cos(lat1)*math.Sin(lat2) - math.Sin(lat1)*math.Cos(lat2)*math.Cos(dLon)
+	return math.Mod(math.Atan2(y, x)*180/math.Pi+360, 360)
+}
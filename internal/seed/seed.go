@@ -0,0 +1,228 @@
+// Package seed fills storage with demo organizations, users, devices and
+// historical tracks driven along the bundled routes
+package seed
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"time"
+	"tracking/internal/app"
+	"tracking/internal/core/model"
+	"tracking/internal/core/service"
+)
+
+// DemoPassword is the password of every seeded user
+const DemoPassword = "demo1234"
+
+// Options sizes the demo data. Tracks cover the Days before End.
+type Options struct {
+	Organizations          int
+	UsersPerOrganization   int
+	DevicesPerOrganization int
+	Days                   int
+	TripsPerDay            int
+	Interval               time.Duration // Time between positions while driving
+	End                    time.Time
+	Seed                   int64 // Same seed, same data
+}
+
+// DefaultOptions returns a small data set ending now
+func DefaultOptions() Options {
+	return Options{
+		Organizations:          2,
+		UsersPerOrganization:   3,
+		DevicesPerOrganization: 5,
+		Days:                   7,
+		TripsPerDay:            3,
+		Interval:               30 * time.Second,
+		End:                    time.Now().UTC().Truncate(time.Minute),
+		Seed:                   1,
+	}
+}
+
+// Summary counts what a run created
+type Summary struct {
+	Organizations int
+	Users         int
+	Devices       int
+	Positions     int
+}
+
+// demoModels are the device models seeded in turn, one per protocol
+var demoModels = []struct {
+	protocol string
+	model    string
+}{
+	{"gt06", "GT06N"},
+	{"h02", "ST-901"},
+	{"teltonika", "FMB920"},
+	{"queclink", "GL200"},
+	{"coban", "TK303"},
+}
+
+var organizationNames = []string{"Demo Logistics", "Demo Couriers", "Demo Rentals", "Demo Transit", "Demo Services"}
+
+func (o Options) validate() error {
+	if o.Organizations <= 0 || o.UsersPerOrganization <= 0 || o.DevicesPerOrganization < 0 {
+		return errors.New("at least one organization with one user is required")
+	}
+	if o.Days < 0 || o.TripsPerDay < 0 {
+		return errors.New("days and trips per day must not be negative")
+	}
+	if o.Interval < time.Second {
+		return errors.New("interval must be at least one second")
+	}
+	return nil
+}
+
+// Run creates the demo data in repos
+func Run(repos app.Repositories, opts Options) (*Summary, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	routes, err := LoadRoutes()
+	if err != nil {
+		return nil, err
+	}
+
+	rng := rand.New(rand.NewSource(opts.Seed))
+	users := service.NewUserService(repos.Users)
+	summary := &Summary{}
+
+	for o := 0; o < opts.Organizations; o++ {
+		name := organizationNames[o%len(organizationNames)]
+		if o >= len(organizationNames) {
+			name = fmt.Sprintf("%s %d", name, o/len(organizationNames)+1)
+		}
+		org := model.NewOrganization(name, "Seeded demo organization")
+		if err := repos.Organizations.Create(org); err != nil {
+			return summary, err
+		}
+		summary.Organizations++
+
+		var owners []*model.User
+		for u := 0; u < opts.UsersPerOrganization; u++ {
+			email := fmt.Sprintf("demo%d.user%d@example.com", o+1, u+1)
+			user, err := users.CreateUser(email, DemoPassword, fmt.Sprintf("%s User %d", name, u+1))
+			if err != nil {
+				return summary, fmt.Errorf("user %s: %v", email, err)
+			}
+			role := "member"
+			if u == 0 {
+				role = "admin"
+			}
+			if err := repos.OrganizationMembers.Create(model.NewOrganizationMember(org.ID, user.ID, role)); err != nil {
+				return summary, err
+			}
+			owners = append(owners, user)
+			summary.Users++
+		}
+
+		for d := 0; d < opts.DevicesPerOrganization; d++ {
+			demo := demoModels[(o+d)%len(demoModels)]
+			device := model.NewDevice(fmt.Sprintf("%s Vehicle %d", name, d+1), demoIMEI(rng))
+			device.Protocol = demo.protocol
+			device.Model = demo.model
+			device.SetOwnership(owners[d%len(owners)].ID, org.ID)
+			if err := repos.Devices.Create(device); err != nil {
+				return summary, err
+			}
+			summary.Devices++
+
+			route := routes[(o+d)%len(routes)]
+			latest, n, err := drive(repos, device, route, opts, rng)
+			summary.Positions += n
+			if err != nil {
+				return summary, err
+			}
+			if latest != nil {
+				device.PositionID = latest.ID
+				device.LastUpdate = latest.Timestamp
+				device.Status = "active"
+				if err := repos.Devices.Update(device); err != nil {
+					return summary, err
+				}
+			}
+		}
+		log.Printf("Seeded %s: %d users, %d devices", name, opts.UsersPerOrganization, opts.DevicesPerOrganization)
+	}
+	return summary, nil
+}
+
+// drive stores the device's trips for every day, parked between them, and
+// returns the latest position and the number stored
+func drive(repos app.Repositories, device *model.Device, route *Route, opts Options, rng *rand.Rand) (*model.Position, int, error) {
+	var latest *model.Position
+	stored := 0
+	store := func(position *model.Position) error {
+		if err := repos.Positions.Create(position); err != nil {
+			return err
+		}
+		latest = position
+		stored++
+		return nil
+	}
+
+	offset := rng.Float64() * route.Length()
+	direction := 1.0
+	start := opts.End.AddDate(0, 0, -opts.Days)
+	for day := 0; day < opts.Days; day++ {
+		// Trips are spread over the working hours, 07:00 to 19:00
+		dayStart := start.AddDate(0, 0, day).Truncate(24 * time.Hour).Add(7 * time.Hour)
+		slot := 12 * time.Hour / time.Duration(opts.TripsPerDay+1)
+		for trip := 0; trip < opts.TripsPerDay; trip++ {
+			at := dayStart.Add(slot*time.Duration(trip+1) + time.Duration(rng.Int63n(int64(slot/2))))
+			duration := time.Duration(15+rng.Intn(30)) * time.Minute
+			if at.Add(duration).After(opts.End) {
+				return latest, stored, nil
+			}
+
+			point, course := route.At(offset)
+			if err := store(demoPosition(device, point, at, 0, course, false)); err != nil {
+				return latest, stored, err
+			}
+
+			cruise := 25 + rng.Float64()*30 // km/h
+			for elapsed := opts.Interval; elapsed <= duration; elapsed += opts.Interval {
+				speed := math.Max(0, cruise+rng.NormFloat64()*8)
+				offset += direction * speed / 3.6 * opts.Interval.Seconds()
+				// Turn around at either end of the route
+				if offset >= route.Length() || offset <= 0 {
+					offset = math.Max(0, math.Min(offset, route.Length()))
+					direction = -direction
+				}
+				point, course = route.At(offset)
+				if direction < 0 {
+					course = math.Mod(course+180, 360)
+				}
+				if err := store(demoPosition(device, point, at.Add(elapsed), speed, course, true)); err != nil {
+					return latest, stored, err
+				}
+			}
+
+			if err := store(demoPosition(device, point, at.Add(duration+opts.Interval), 0, course, false)); err != nil {
+				return latest, stored, err
+			}
+		}
+	}
+	return latest, stored, nil
+}
+
+func demoPosition(device *model.Device, point Point, at time.Time, speed, course float64, ignition bool) *model.Position {
+	position := model.NewPosition(device.ID, point.Lat, point.Lon)
+	position.Timestamp = at
+	position.Speed = math.Round(speed*10) / 10
+	position.Course = math.Round(course)
+	position.Valid = true
+	position.Protocol = device.Protocol
+	position.Status = map[string]interface{}{"ignition": ignition}
+	return position
+}
+
+// demoIMEI returns a random 15 digit identifier under the 35 test prefix
+func demoIMEI(rng *rand.Rand) string {
+	return fmt.Sprintf("35%013d", rng.Int63n(1e13))
+}
@@ -0,0 +1,112 @@
+package test
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"testing"
+	"time"
+
+	"tracking/internal/core/model"
+	"tracking/internal/core/util"
+)
+
+// h02ACCFrame reports a fix with the ACC line on or off
+func h02ACCFrame(at, lat string, acc bool) []byte {
+	status := "FFFFFFFF"
+	if acc {
+		status = "FFFFFBFF"
+	}
+	return []byte(fmt.Sprintf("*HQ,4210051415,V1,%s,A,%s,N,11408.6214,E,0,0,151022,%s#", at, lat, status))
+}
+
+func TestAccumulators(t *testing.T) {
+	env := newTestEnv(t)
+	truck := env.registerDevice(t, "4210051415", "h02")
+	// One minute of latitude apart, at the precision coordinates are kept to
+	leg := util.Distance(util.RoundCoordinate(22+37.7514/60), util.RoundCoordinate(114+8.6214/60),
+		util.RoundCoordinate(22+38.7514/60), util.RoundCoordinate(114+8.6214/60))
+
+	conn := env.dialDevice(t)
+	send := func(at, lat string, acc bool) {
+		t.Helper()
+		exchange(t, conn, h02ACCFrame(at, lat, acc))
+	}
+	// The engine runs from 12:00 to 13:00 while the truck drives one leg
+	send("120000", "2237.7514", true)
+	send("123000", "2238.7514", true)
+	send("130000", "2238.7514", false)
+	send("133000", "2238.7514", false)
+
+	near := func(got, want float64) bool { return math.Abs(got-want) < 1e-6 }
+	stampAt := func(clock string) (float64, float64) {
+		t.Helper()
+		at, _ := time.Parse("2006-01-02 15:04", "2022-10-15 "+clock)
+		position := positionAt(env.positions(t, truck.ID), at)
+		if position == nil {
+			t.Fatalf("No position at %s", clock)
+		}
+		distance, _ := position.Status[model.AttributeTotalDistance].(float64)
+		hours, _ := position.Status[model.AttributeEngineHours].(float64)
+		return distance, hours
+	}
+	if distance, hours := stampAt("12:30"); !near(distance, leg) || !near(hours, 0.5) {
+		t.Errorf("Totals at 12:30 = %.1f m, %.2f h, want %.1f m, 0.5 h", distance, hours, leg)
+	}
+
+	var totals model.Accumulators
+	if status := env.do(t, http.MethodGet, "/api/devices/accumulators?deviceId="+truck.ID, nil, &totals); status != http.StatusOK {
+		t.Fatalf("Getting accumulators returned status %d", status)
+	}
+	if !near(totals.TotalDistance, leg) || !near(totals.EngineHours, 1) {
+		t.Errorf("Totals = %+v, want %.1f m and 1 h", totals, leg)
+	}
+
+	odometer, hourMeter := 100000.0, 500.0
+	negative := -1.0
+	future := testStart.Add(time.Hour)
+	for _, invalid := range []model.AccumulatorBaseline{
+		{DeviceID: truck.ID},
+		{DeviceID: truck.ID, TotalDistance: &negative},
+		{DeviceID: truck.ID, EngineHours: &hourMeter, EffectiveAt: future},
+	} {
+		if status := env.do(t, http.MethodPut, "/api/devices/accumulators", invalid, nil); status != http.StatusBadRequest {
+			t.Errorf("Setting %+v returned status %d, want 400", invalid, status)
+		}
+	}
+	if status := env.do(t, http.MethodPut, "/api/devices/accumulators", model.AccumulatorBaseline{
+		DeviceID: "unknown", TotalDistance: &odometer,
+	}, nil); status != http.StatusNotFound {
+		t.Errorf("Setting accumulators of an unknown device returned status %d, want 404", status)
+	}
+
+	// The readings taken at 12:45 replace the totals; the engine ran for
+	// another quarter of an hour after them
+	baseline := model.AccumulatorBaseline{
+		DeviceID:      truck.ID,
+		TotalDistance: &odometer,
+		EngineHours:   &hourMeter,
+		EffectiveAt:   time.Date(2022, 10, 15, 12, 45, 0, 0, time.UTC),
+	}
+	if status := env.do(t, http.MethodPut, "/api/devices/accumulators", baseline, &totals); status != http.StatusOK {
+		t.Fatalf("Setting accumulators returned status %d", status)
+	}
+	if !near(totals.TotalDistance, odometer) || !near(totals.EngineHours, 500.25) {
+		t.Errorf("Totals after the baseline = %+v, want %.0f m and 500.25 h", totals, odometer)
+	}
+
+	// Later positions continue from the baseline
+	send("140000", "2238.7514", true)
+	send("143000", "2237.7514", true)
+	if distance, hours := stampAt("14:30"); !near(distance, odometer+leg) || !near(hours, 500.75) {
+		t.Errorf("Totals at 14:30 = %.1f m, %.2f h, want %.1f m, 500.75 h", distance, hours, odometer+leg)
+	}
+
+	var baselines []*model.AccumulatorBaseline
+	if status := env.do(t, http.MethodGet, "/api/devices/accumulators/baselines?deviceId="+truck.ID, nil, &baselines); status != http.StatusOK {
+		t.Fatalf("Listing baselines returned status %d", status)
+	}
+	if len(baselines) != 1 || baselines[0].UserID != testUserID || *baselines[0].EngineHours != hourMeter {
+		t.Errorf("Baselines = %+v", baselines)
+	}
+}
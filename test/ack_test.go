@@ -0,0 +1,181 @@
+package test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"tracking/internal/app"
+	"tracking/internal/core/model"
+	"tracking/internal/core/repository"
+)
+
+// flakyPositionRepository fails the next writes it is told to
+type flakyPositionRepository struct {
+	repository.PositionRepository
+	mutex     sync.Mutex
+	successes int // Writes to let through before failing
+	failures  int
+}
+
+func (r *flakyPositionRepository) failNext(n int) {
+	r.failAfter(0, n)
+}
+
+// failAfter fails n writes once the given number have succeeded
+func (r *flakyPositionRepository) failAfter(successes, n int) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.successes = successes
+	r.failures = n
+}
+
+func (r *flakyPositionRepository) Create(position *model.Position) error {
+	r.mutex.Lock()
+	if r.successes > 0 {
+		r.successes--
+	} else if r.failures > 0 {
+		r.failures--
+		r.mutex.Unlock()
+		return errors.New("write failed")
+	}
+	r.mutex.Unlock()
+	return r.PositionRepository.Create(position)
+}
+
+func (r *flakyPositionRepository) CreateBatch(positions []*model.Position) error {
+	for i, position := range positions {
+		if err := r.Create(position); err != nil {
+			return &repository.BatchError{Stored: i, Err: err}
+		}
+	}
+	return nil
+}
+
+func newFlakyTestEnv(t *testing.T) (*testEnv, *flakyPositionRepository) {
+	t.Helper()
+
+	repos := app.NewInMemoryRepositories()
+	flaky := &flakyPositionRepository{PositionRepository: repos.Positions}
+	repos.Positions = flaky
+	return newTestEnvWithRepositories(t, repos), flaky
+}
+
+// expectNoResponse asserts the server stays silent after a frame
+func expectNoResponse(t *testing.T, conn net.Conn, frame []byte) {
+	t.Helper()
+
+	if _, err := conn.Write(frame); err != nil {
+		t.Fatalf("Failed to send frame: %v", err)
+	}
+	conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	if n, err := conn.Read(make([]byte, 64)); err == nil {
+		t.Fatalf("Frame was acknowledged with %d bytes after a failed write", n)
+	}
+}
+
+func TestH02AckWithheldUntilStored(t *testing.T) {
+	env, flaky := newFlakyTestEnv(t)
+	device := env.registerDevice(t, "123456789012345", "h02")
+	conn := env.dialDevice(t)
+
+	flaky.failNext(1)
+	expectNoResponse(t, conn, h02Frame)
+	if positions := env.positions(t, device.ID); len(positions) != 0 {
+		t.Fatalf("Got %d positions after a failed write, want 0", len(positions))
+	}
+
+	// The resent frame is stored and acknowledged
+	if response := exchange(t, conn, h02Frame); string(response) != "*HQ,OK#" {
+		t.Fatalf("Unexpected H02 response %q", response)
+	}
+	if positions := env.positions(t, device.ID); len(positions) != 1 {
+		t.Fatalf("Got %d positions, want 1", len(positions))
+	}
+}
+
+func TestGT06AckWithheldUntilStored(t *testing.T) {
+	env, flaky := newFlakyTestEnv(t)
+	device := env.registerDevice(t, "0353413532881372", "gt06")
+	conn := env.dialDevice(t)
+
+	exchange(t, conn, gt06LoginFrame)
+
+	flaky.failNext(1)
+	expectNoResponse(t, conn, gt06LocationFrame)
+	if response := exchange(t, conn, gt06LocationFrame); len(response) < 4 || response[0] != 0x78 || response[1] != 0x78 {
+		t.Fatalf("Invalid GT06 location response: % x", response)
+	}
+	if positions := env.positions(t, device.ID); len(positions) != 1 {
+		t.Fatalf("Got %d positions, want 1", len(positions))
+	}
+}
+
+func TestTeltonikaResentBatchIsIdempotent(t *testing.T) {
+	env, flaky := newFlakyTestEnv(t)
+	device := env.registerDevice(t, "352093081452251", "teltonika")
+	conn := env.dialDevice(t)
+	exchange(t, conn, teltonikaIMEIFrame)
+
+	batch := codec8Packet(
+		codec8Record(testStart.Add(-3*time.Minute), 54.6801, 25.2701),
+		codec8Record(testStart.Add(-2*time.Minute), 54.6802, 25.2702),
+		codec8Record(testStart.Add(-time.Minute), 54.6803, 25.2703),
+	)
+
+	// The second write fails, so the batch stops after the first record
+	flaky.failAfter(1, 1)
+	if response := exchange(t, conn, batch); !bytes.Equal(response, []byte{0, 0, 0, 1}) {
+		t.Fatalf("Batch ACK = % x, want 00 00 00 01", response)
+	}
+
+	// The device resends the whole batch; the stored records are not repeated
+	if response := exchange(t, conn, batch); !bytes.Equal(response, []byte{0, 0, 0, 3}) {
+		t.Fatalf("Resent batch ACK = % x, want 00 00 00 03", response)
+	}
+	positions := env.positions(t, device.ID)
+	if len(positions) != 3 {
+		t.Fatalf("Got %d positions, want 3", len(positions))
+	}
+	seen := make(map[time.Time]bool)
+	for _, position := range positions {
+		if seen[position.Timestamp] {
+			t.Errorf("Position at %v stored twice", position.Timestamp)
+		}
+		seen[position.Timestamp] = true
+	}
+}
+
+func TestTeltonikaPartialBatchOverHTTP(t *testing.T) {
+	env, flaky := newFlakyTestEnv(t)
+	device := env.registerDevice(t, "352093081452251", "teltonika")
+
+	batch := codec8Packet(
+		codec8Record(testStart.Add(-3*time.Minute), 54.6801, 25.2701),
+		codec8Record(testStart.Add(-2*time.Minute), 54.6802, 25.2702),
+		codec8Record(testStart.Add(-time.Minute), 54.6803, 25.2703),
+	)
+	request := map[string]string{
+		"deviceId": device.ID,
+		"rawData":  base64.StdEncoding.EncodeToString(batch),
+	}
+
+	// The write fails after the first record: the request fails, and the
+	// record written is kept and becomes the latest
+	flaky.failAfter(1, 1)
+	if status := env.do(t, http.MethodPost, "/api/positions/raw", request, nil); status != http.StatusInternalServerError {
+		t.Fatalf("Raw data with a failed write returned status %d, want 500", status)
+	}
+	positions := env.positions(t, device.ID)
+	if len(positions) != 1 || !positions[0].Timestamp.Equal(testStart.Add(-3*time.Minute)) {
+		t.Fatalf("Got %d positions, want the first record only", len(positions))
+	}
+	if stored, _ := env.deviceRepo.FindByID(device.ID); stored.PositionID != positions[0].ID {
+		t.Errorf("Device positionId = %s, want %s", stored.PositionID, positions[0].ID)
+	}
+}
@@ -0,0 +1,75 @@
+package test
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"tracking/internal/config"
+	"tracking/internal/core/model"
+)
+
+func TestAlarmAndLowBatteryEvents(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.LowBatteryThreshold = 20
+	})
+	truck := env.registerDevice(t, "4210051415", "h02")
+	phone := env.registerDevice(t, "123456", "osmand")
+
+	// The SOS flag stays set over consecutive positions and is raised once
+	// until it clears
+	sos := func(at string) []byte {
+		return []byte("*HQ,4210051415,V1," + at + ",A,2237.7514,N,11408.6214,E,0,0,151022,FFFBFFFF#")
+	}
+	conn := env.dialDevice(t)
+	for _, frame := range [][]byte{
+		sos("120000"),
+		sos("120100"),
+		h02SpeedFrame("120200", "2237.7514", 0, 0),
+		sos("120300"),
+	} {
+		exchange(t, conn, frame)
+	}
+
+	// The battery warning rearms once the level recovers
+	for i, level := range []string{"50", "15", "10", "30", "5"} {
+		env.osmandReport(t, phone, url.Values{
+			"lat": {"52.52"}, "lon": {"13.405"}, "batt": {level},
+			"timestamp": {fmt.Sprintf("2022-10-15T13:%02d:00Z", i)},
+		})
+	}
+
+	events := func(query url.Values) []*model.Event {
+		t.Helper()
+		var page model.EventPage
+		if status := env.do(t, http.MethodGet, "/api/events?"+query.Encode(), nil, &page); status != http.StatusOK {
+			t.Fatalf("Listing events returned status %d", status)
+		}
+		return page.Events
+	}
+
+	alarms := events(url.Values{"deviceId": {truck.ID}, "type": {model.EventAlarm}})
+	if len(alarms) != 2 {
+		t.Fatalf("Got %d alarm events, want 2: %+v", len(alarms), alarms)
+	}
+	for _, event := range alarms {
+		if event.Attributes["alarm"] != "sos" || event.Severity != model.SeverityCritical || event.PositionID == "" {
+			t.Errorf("Alarm event = %+v", event)
+		}
+	}
+	// Narrowed by time, only the second press remains
+	later := events(url.Values{"deviceId": {truck.ID}, "type": {model.EventAlarm}, "from": {"2022-10-15T12:02:00Z"}, "to": {"2022-10-15T13:00:00Z"}})
+	if len(later) != 1 || later[0].Timestamp.UTC().Format("15:04") != "12:03" {
+		t.Errorf("Alarm events after 12:02 = %+v", later)
+	}
+
+	low := events(url.Values{"deviceId": {phone.ID}, "type": {model.EventLowBattery}})
+	if len(low) != 2 {
+		t.Fatalf("Got %d lowBattery events, want 2: %+v", len(low), low)
+	}
+	// Newest first
+	if low[0].Attributes["batteryLevel"] != 5.0 || low[1].Attributes["batteryLevel"] != 15.0 {
+		t.Errorf("lowBattery events = %v, %v", low[0].Attributes, low[1].Attributes)
+	}
+}
@@ -0,0 +1,109 @@
+package test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"tracking/internal/core/model"
+)
+
+func TestAcknowledgeEvent(t *testing.T) {
+	env := newTestEnv(t)
+	device := env.registerDevice(t, "0353413532881372", "gt06")
+	event := model.NewEvent(model.EventOverspeed, device.ID, testStart)
+	env.app.Hooks.Event(event)
+
+	var acknowledged model.Event
+	if status := env.do(t, http.MethodPost, "/api/events/acknowledge?id="+event.ID, nil, &acknowledged); status != http.StatusOK {
+		t.Fatalf("Acknowledging returned status %d", status)
+	}
+	if acknowledged.AcknowledgedBy != testUserID || acknowledged.AcknowledgedAt == nil || !acknowledged.AcknowledgedAt.Equal(testStart) {
+		t.Errorf("Acknowledged event = %+v", acknowledged)
+	}
+
+	// The first acknowledgment stands
+	env.clock.Advance(time.Minute)
+	var again model.Event
+	env.do(t, http.MethodPost, "/api/events/acknowledge?id="+event.ID, nil, &again)
+	if again.AcknowledgedAt == nil || !again.AcknowledgedAt.Equal(testStart) {
+		t.Errorf("Acknowledging again moved the acknowledgment to %v", again.AcknowledgedAt)
+	}
+
+	stranger := model.NewDevice("Someone else's", "0353413532889999")
+	stranger.SetOwnership("other-user", "")
+	if err := env.deviceRepo.Create(stranger); err != nil {
+		t.Fatalf("Failed to create device: %v", err)
+	}
+	foreign := model.NewEvent(model.EventOverspeed, stranger.ID, testStart)
+	env.app.Hooks.Event(foreign)
+	for _, id := range []string{foreign.ID, "missing"} {
+		if status := env.do(t, http.MethodPost, "/api/events/acknowledge?id="+id, nil, nil); status != http.StatusNotFound {
+			t.Errorf("Acknowledging event %s returned status %d, want %d", id, status, http.StatusNotFound)
+		}
+	}
+}
+
+func TestSnoozeAlerts(t *testing.T) {
+	env := newTestEnv(t)
+	device := env.registerDevice(t, "0353413532881372", "gt06")
+
+	if status := env.do(t, http.MethodPost, "/api/devices/snoozes?deviceId="+device.ID, map[string]interface{}{
+		"eventType": model.EventOverspeed,
+		"until":     testStart.Add(5 * time.Minute),
+		"reason":    "In the shop",
+	}, nil); status != http.StatusOK {
+		t.Fatalf("Snoozing returned status %d", status)
+	}
+
+	snoozed := model.NewEvent(model.EventOverspeed, device.ID, testStart)
+	other := model.NewEvent(model.EventDeviceOffline, device.ID, testStart)
+	env.app.Hooks.Event(snoozed)
+	env.app.Hooks.Event(other)
+	if !snoozed.Snoozed || other.Snoozed {
+		t.Errorf("Snoozed flags = %v and %v, want only the overspeed event snoozed", snoozed.Snoozed, other.Snoozed)
+	}
+	if stored, _ := env.app.Repositories.Events.FindByID(snoozed.ID); stored == nil || !stored.Snoozed {
+		t.Errorf("Stored event = %+v, want it kept and marked snoozed", stored)
+	}
+
+	// Snoozes lapse, or can be cancelled early
+	env.clock.Advance(10 * time.Minute)
+	late := model.NewEvent(model.EventOverspeed, device.ID, env.clock.Now())
+	env.app.Hooks.Event(late)
+	if late.Snoozed {
+		t.Error("Event after the snooze ended was snoozed")
+	}
+
+	var silenced model.Snooze
+	env.do(t, http.MethodPost, "/api/devices/snoozes?deviceId="+device.ID, map[string]interface{}{
+		"until": env.clock.Now().Add(time.Hour),
+	}, &silenced)
+	var cancelled model.Snooze
+	if status := env.do(t, http.MethodPost, "/api/devices/snoozes/cancel?id="+silenced.ID, nil, &cancelled); status != http.StatusOK {
+		t.Fatalf("Cancelling returned status %d", status)
+	}
+	if cancelled.CancelledBy != testUserID || cancelled.CancelledAt == nil {
+		t.Errorf("Cancelled snooze = %+v", cancelled)
+	}
+	afterCancel := model.NewEvent(model.EventDeviceOffline, device.ID, env.clock.Now())
+	env.app.Hooks.Event(afterCancel)
+	if afterCancel.Snoozed {
+		t.Error("Event after cancelling was snoozed")
+	}
+
+	var snoozes []*model.Snooze
+	if status := env.do(t, http.MethodGet, "/api/devices/snoozes?deviceId="+device.ID, nil, &snoozes); status != http.StatusOK || len(snoozes) != 2 {
+		t.Fatalf("Listing snoozes returned status %d with %d snoozes", status, len(snoozes))
+	}
+	if snoozes[0].ID != silenced.ID || snoozes[1].Reason != "In the shop" || snoozes[1].CreatedBy != testUserID {
+		t.Errorf("Snoozes = %+v %+v, want newest first with who and why", snoozes[0], snoozes[1])
+	}
+
+	for _, until := range []time.Time{env.clock.Now().Add(-time.Minute), env.clock.Now().Add(365 * 24 * time.Hour)} {
+		if status := env.do(t, http.MethodPost, "/api/devices/snoozes?deviceId="+device.ID,
+			map[string]interface{}{"until": until}, nil); status != http.StatusBadRequest {
+			t.Errorf("Snoozing until %v returned status %d, want %d", until, status, http.StatusBadRequest)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"net/http"
+	"testing"
+	"time"
+
+	"tracking/internal/core/model"
+)
+
+var teltonikaIMEIFrame = append([]byte{0x00, 0x0F}, "352093081452251"...)
+
+// codec8Record builds a Teltonika AVL record without IO elements
+func codec8Record(timestamp time.Time, lat, lon float64) []byte {
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.BigEndian, uint64(timestamp.UnixMilli()))
+	buf.WriteByte(0) // Priority
+	binary.Write(buf, binary.BigEndian, int32(lon*1e7))
+	binary.Write(buf, binary.BigEndian, int32(lat*1e7))
+	binary.Write(buf, binary.BigEndian, int16(80))  // Altitude
+	binary.Write(buf, binary.BigEndian, uint16(45)) // Angle
+	buf.WriteByte(7)                                // Satellites
+	binary.Write(buf, binary.BigEndian, uint16(30)) // Speed
+	buf.Write([]byte{0, 0, 0, 0, 0, 0})             // Event, total and group counts
+	return buf.Bytes()
+}
+
+// codec8Packet wraps records in a Teltonika Codec 8 packet
+func codec8Packet(records ...[]byte) []byte {
+	body := []byte{0x08, byte(len(records))}
+	for _, record := range records {
+		body = append(body, record...)
+	}
+	body = append(body, byte(len(records)))
+
+	var crc uint16
+	for _, b := range body {
+		crc ^= uint16(b)
+		for i := 0; i < 8; i++ {
+			if crc&1 != 0 {
+				crc = crc>>1 ^ 0xA001
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+
+	packet := make([]byte, 8, len(body)+12)
+	binary.BigEndian.PutUint32(packet[4:], uint32(len(body)))
+	packet = append(packet, body...)
+	return binary.BigEndian.AppendUint32(packet, uint32(crc))
+}
+
+func TestTeltonikaBatchOverTCP(t *testing.T) {
+	env := newTestEnv(t)
+	device := env.registerDevice(t, "352093081452251", "teltonika")
+	conn := env.dialDevice(t)
+
+	if response := exchange(t, conn, teltonikaIMEIFrame); !bytes.Equal(response, []byte{0x01}) {
+		t.Fatalf("IMEI response = % x, want 01", response)
+	}
+
+	// Records replayed from the device's buffer arrive out of order
+	newest := testStart.Add(-time.Minute)
+	batch := codec8Packet(
+		codec8Record(testStart.Add(-3*time.Minute), 54.6801, 25.2701),
+		codec8Record(newest, 54.6803, 25.2703),
+		codec8Record(testStart.Add(-2*time.Minute), 54.6802, 25.2702),
+	)
+	if response := exchange(t, conn, batch); !bytes.Equal(response, []byte{0, 0, 0, 3}) {
+		t.Fatalf("Batch ACK = % x, want 00 00 00 03", response)
+	}
+
+	positions := env.positions(t, device.ID)
+	if len(positions) != 3 {
+		t.Fatalf("Got %d positions, want 3", len(positions))
+	}
+	stored, _ := env.deviceRepo.FindByID(device.ID)
+	latest := findPosition(positions, stored.PositionID)
+	if latest == nil || !latest.Timestamp.Equal(newest) || !almostEqual(latest.Latitude, 54.6803, 0.0001) {
+		t.Fatalf("Device points at %+v, want the position from %v", latest, newest)
+	}
+	if !stored.LastUpdate.Equal(newest) || stored.Status != "active" {
+		t.Errorf("Device lastUpdate = %v, status = %s", stored.LastUpdate, stored.Status)
+	}
+
+	// An older batch is stored but leaves the device where it is
+	older := codec8Packet(codec8Record(testStart.Add(-time.Hour), 54.6700, 25.2600))
+	if response := exchange(t, conn, older); !bytes.Equal(response, []byte{0, 0, 0, 1}) {
+		t.Fatalf("Older batch ACK = % x, want 00 00 00 01", response)
+	}
+	if positions := env.positions(t, device.ID); len(positions) != 4 {
+		t.Fatalf("Got %d positions, want 4", len(positions))
+	}
+	if after, _ := env.deviceRepo.FindByID(device.ID); after.PositionID != latest.ID {
+		t.Errorf("Device moved to %s after an older batch, want %s", after.PositionID, latest.ID)
+	}
+
+	// Corrupt packets are not acknowledged, so the device resends them
+	corrupt := append([]byte{}, batch...)
+	corrupt[len(corrupt)-1] ^= 0xFF
+	if _, err := conn.Write(corrupt); err != nil {
+		t.Fatalf("Failed to send corrupt packet: %v", err)
+	}
+	conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	if n, err := conn.Read(make([]byte, 16)); err == nil {
+		t.Fatalf("Corrupt packet was acknowledged with %d bytes", n)
+	}
+	if positions := env.positions(t, device.ID); len(positions) != 4 {
+		t.Errorf("Got %d positions after a corrupt packet, want 4", len(positions))
+	}
+}
+
+func TestTeltonikaBatchOverHTTP(t *testing.T) {
+	env := newTestEnv(t)
+	device := env.registerDevice(t, "352093081452251", "teltonika")
+
+	batch := codec8Packet(
+		codec8Record(testStart.Add(-time.Minute), 54.6802, 25.2702),
+		codec8Record(testStart.Add(-2*time.Minute), 54.6801, 25.2701),
+	)
+	request := map[string]string{
+		"deviceId": device.ID,
+		"rawData":  base64.StdEncoding.EncodeToString(batch),
+	}
+
+	// The response is the newest position of the batch
+	var created model.Position
+	if status := env.do(t, http.MethodPost, "/api/positions/raw", request, &created); status != http.StatusOK {
+		t.Fatalf("Raw data returned status %d", status)
+	}
+	if !created.Timestamp.Equal(testStart.Add(-time.Minute)) {
+		t.Errorf("Created position timestamp = %v, want %v", created.Timestamp, testStart.Add(-time.Minute))
+	}
+
+	if positions := env.positions(t, device.ID); len(positions) != 2 {
+		t.Fatalf("Got %d positions, want 2", len(positions))
+	}
+	if stored, _ := env.deviceRepo.FindByID(device.ID); stored.PositionID != created.ID {
+		t.Errorf("Device positionId = %s, want %s", stored.PositionID, created.ID)
+	}
+}
+
+func findPosition(positions []*model.Position, id string) *model.Position {
+	for _, position := range positions {
+		if position.ID == id {
+			return position
+		}
+	}
+	return nil
+}
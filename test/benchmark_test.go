@@ -0,0 +1,80 @@
+package test
+
+import (
+	"encoding/hex"
+	"net/http"
+	"testing"
+
+	"tracking/internal/core/model"
+)
+
+func TestIngestBenchmark(t *testing.T) {
+	env := newTestEnv(t)
+
+	var report model.BenchmarkReport
+	if status := env.do(t, http.MethodPost, "/api/admin/benchmark", map[string]int{"rounds": 2}, &report); status != http.StatusOK {
+		t.Fatalf("Running the built-in corpus returned status %d", status)
+	}
+	// Every position of the corpus is stored, in each round
+	if report.Rounds != 2 || report.Sessions < 4 || report.Frames == 0 || report.Stored == 0 ||
+		report.Stored != report.Positions || report.Stored%2 != 0 || report.PositionsPerSecond <= 0 {
+		t.Errorf("Report = %+v", report)
+	}
+	stages := make(map[string]model.StageTiming)
+	for _, stage := range report.Stages {
+		stages[stage.Name] = stage
+	}
+	for _, name := range []string{"decode", "decodedHooks", "lookup", "store", "storedHooks", "reply"} {
+		if stages[name].Count == 0 {
+			t.Errorf("Stage %s timed nothing: %+v", name, report.Stages)
+		}
+	}
+	// The store stage counts the positions written, not the batches
+	if stages["store"].Count != report.Stored {
+		t.Errorf("Store stage counted %d positions, want %d", stages["store"].Count, report.Stored)
+	}
+	for _, stage := range report.Stages {
+		if stage.TotalMs > stages[report.Bottleneck].TotalMs {
+			t.Errorf("Bottleneck %s took less time than %s", report.Bottleneck, stage.Name)
+		}
+	}
+
+	// The temporary devices are gone
+	devices, err := env.app.Repositories.Devices.FindAll()
+	if err != nil {
+		t.Fatalf("Failed to list devices: %v", err)
+	}
+	if len(devices) != 0 {
+		t.Errorf("Devices left after the benchmark: %d", len(devices))
+	}
+
+	// A session of its own, two H02 reports
+	session := model.BenchmarkSession{Name: "truck", Frames: []string{
+		hex.EncodeToString(h02ACCFrame("120000", "2237.7514", true)),
+		hex.EncodeToString(h02ACCFrame("120100", "2237.8514", true)),
+	}}
+	var custom model.BenchmarkReport
+	if status := env.do(t, http.MethodPost, "/api/admin/benchmark", map[string]interface{}{"sessions": []model.BenchmarkSession{session}}, &custom); status != http.StatusOK {
+		t.Fatalf("Running a session returned status %d", status)
+	}
+	if custom.Sessions != 1 || custom.Rounds != 1 || custom.Frames != 2 || custom.Stored != 2 {
+		t.Errorf("Session report = %+v", custom)
+	}
+
+	// Sessions of registered devices would mix with their data
+	env.registerDevice(t, "4210051415", "h02")
+	for name, body := range map[string]interface{}{
+		"a registered device": map[string]interface{}{"sessions": []model.BenchmarkSession{session}},
+		"a frame not in hex":  map[string]interface{}{"sessions": []model.BenchmarkSession{{Name: "bad", Frames: []string{"*HQ"}}}},
+		"too many rounds":     map[string]int{"rounds": 100000},
+	} {
+		if status := env.do(t, http.MethodPost, "/api/admin/benchmark", body, nil); status != http.StatusBadRequest {
+			t.Errorf("Running %s returned status %d, want 400", name, status)
+		}
+	}
+
+	member := env.memberToken(t, "member-user", "")
+	if status := env.doAs(t, member, "", http.MethodPost, "/api/admin/benchmark", nil, nil); status != http.StatusForbidden {
+		t.Errorf("A member got status %d, want 403", status)
+	}
+}
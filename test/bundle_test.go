@@ -0,0 +1,85 @@
+package test
+
+import (
+	"net/http"
+	"testing"
+
+	"tracking/internal/core/model"
+)
+
+func TestExportImportBundle(t *testing.T) {
+	source := newTestEnv(t)
+	org := model.NewOrganization("Fleet", "Delivery vans")
+	if err := source.app.Repositories.Organizations.Create(org); err != nil {
+		t.Fatal(err)
+	}
+	if err := source.app.Repositories.OrganizationMembers.Create(model.NewOrganizationMember(org.ID, testUserID, "admin")); err != nil {
+		t.Fatal(err)
+	}
+	device := model.NewDevice("Van 1", "359586015829802")
+	device.Protocol = "coban"
+	device.SetOwnership(testUserID, org.ID)
+	if err := source.deviceRepo.Create(device); err != nil {
+		t.Fatal(err)
+	}
+	if err := source.app.Repositories.Scripts.Create(model.NewScript("fuel", "TK303", "fuelLiters = fuel1 * 0.6")); err != nil {
+		t.Fatal(err)
+	}
+
+	var bundle model.Bundle
+	if status := source.do(t, http.MethodGet, "/api/admin/export", nil, &bundle); status != http.StatusOK {
+		t.Fatalf("Export returned status %d", status)
+	}
+	if len(bundle.Organizations) != 1 || len(bundle.OrganizationMembers) != 1 || len(bundle.Devices) != 1 || len(bundle.Scripts) != 1 {
+		t.Fatalf("Bundle = %+v", bundle)
+	}
+	if bundle.Devices[0].ApiSecret != device.ApiSecret {
+		t.Errorf("Exported device secret missing")
+	}
+
+	target := newTestEnv(t)
+	// Already registered on the target, so the bundle's copy is skipped
+	target.registerDevice(t, "4210051415", "h02")
+	bundle.Devices = append(bundle.Devices, &model.BundleDevice{Device: model.NewDevice("Car", "4210051415")})
+
+	var result model.BundleImport
+	if status := target.do(t, http.MethodPost, "/api/admin/import", &bundle, &result); status != http.StatusOK {
+		t.Fatalf("Import returned status %d", status)
+	}
+	if result.Organizations != 1 || result.OrganizationMembers != 1 || result.Devices != 1 || result.Scripts != 1 || len(result.Skipped) != 1 {
+		t.Errorf("Import result = %+v", result)
+	}
+
+	newOrgID := result.IDs["organizations"][org.ID]
+	if newOrgID == "" || newOrgID == org.ID {
+		t.Fatalf("Organization ID %s was not remapped: %v", org.ID, result.IDs)
+	}
+	imported, err := target.deviceRepo.FindByUniqueID("359586015829802")
+	if err != nil || imported == nil {
+		t.Fatalf("Imported device not found: %v", err)
+	}
+	if imported.ID != result.IDs["devices"][device.ID] || imported.ID == device.ID {
+		t.Errorf("Device ID = %s, mapping %v", imported.ID, result.IDs["devices"])
+	}
+	if imported.OrganizationID != newOrgID || imported.UserID != testUserID {
+		t.Errorf("Device ownership = %s/%s, want %s/%s", imported.UserID, imported.OrganizationID, testUserID, newOrgID)
+	}
+	if !imported.ValidateCredentials(device.ApiKey, device.ApiSecret) {
+		t.Errorf("Imported device does not accept its original credentials")
+	}
+	member, err := target.app.Repositories.OrganizationMembers.FindByUserAndOrg(testUserID, newOrgID)
+	if err != nil || member == nil {
+		t.Errorf("Member not imported into the new organization: %v", err)
+	}
+	scripts, err := target.app.Repositories.Scripts.FindByDeviceModel("TK303")
+	if err != nil || len(scripts) != 1 {
+		t.Errorf("Got %d TK303 scripts, want 1 (%v)", len(scripts), err)
+	}
+}
+
+func TestImportRejectsUnknownBundleVersion(t *testing.T) {
+	env := newTestEnv(t)
+	if status := env.do(t, http.MethodPost, "/api/admin/import", map[string]int{"version": 99}, nil); status != http.StatusBadRequest {
+		t.Errorf("Import of version 99 returned status %d, want 400", status)
+	}
+}
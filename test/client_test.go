@@ -0,0 +1,109 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"tracking/internal/client"
+	"tracking/internal/core/model"
+)
+
+func TestAdminClient(t *testing.T) {
+	env := newTestEnv(t)
+	c := client.New("http://"+env.app.HTTPAddr().String()+"/", "")
+
+	var apiErr *client.APIError
+	if _, err := c.Devices(); !errors.As(err, &apiErr) || apiErr.Status != http.StatusUnauthorized {
+		t.Fatalf("Listing devices before login = %v, want a 401", err)
+	}
+	if token, err := c.Login("admin@example.com", "secret"); err != nil || token == "" || c.Token() != token {
+		t.Fatalf("Login = %q, %v", token, err)
+	}
+
+	created, err := c.CreateDevice("Van", "359586015829802", "")
+	if err != nil {
+		t.Fatalf("Failed to create device: %v", err)
+	}
+	truck := env.registerDevice(t, "4210051415", "h02")
+	devices, err := c.Devices()
+	if err != nil {
+		t.Fatalf("Failed to list devices: %v", err)
+	}
+	listed := make(map[string]bool)
+	for _, device := range devices {
+		listed[device.ID] = true
+	}
+	if len(devices) != 2 || !listed[created.ID] || !listed[truck.ID] {
+		t.Errorf("Listed %d devices, want the van and the truck", len(devices))
+	}
+
+	command, err := c.SendCommand(truck.ID, model.CommandSetInterval, 30, 0)
+	if err != nil {
+		t.Fatalf("Failed to send command: %v", err)
+	}
+	if command.Type != model.CommandSetInterval || command.Interval != 30 || command.DeviceID != truck.ID {
+		t.Errorf("Queued command %+v, want setInterval of 30s", command)
+	}
+	// The server's reason for refusing is passed on
+	if _, err := c.SendCommand(truck.ID, "selfDestruct", 0, 0); !errors.As(err, &apiErr) || apiErr.Status != http.StatusBadRequest || apiErr.Message == "" {
+		t.Errorf("Unknown command = %v, want a 400 with the reason", err)
+	}
+
+	var bundle bytes.Buffer
+	if err := c.Export(&bundle); err != nil {
+		t.Fatalf("Failed to export: %v", err)
+	}
+	var exported model.Bundle
+	if err := json.Unmarshal(bundle.Bytes(), &exported); err != nil || len(exported.Devices) != 2 {
+		t.Errorf("Exported %d devices (%v), want 2", len(exported.Devices), err)
+	}
+
+	// Tailing follows the truck over a WebSocket until cancelled; positions
+	// are sent until the subscription is in place
+	ctx, cancel := context.WithCancel(context.Background())
+	updates := make(chan *model.LiveUpdate, 100)
+	tailed := make(chan error, 1)
+	go func() {
+		tailed <- c.Tail(ctx, []string{truck.ID}, nil, func(update *model.LiveUpdate) error {
+			updates <- update
+			return nil
+		})
+	}()
+	conn := env.dialDevice(t)
+	var position *model.Position
+	for i := 0; position == nil && i < 20; i++ {
+		exchange(t, conn, h02SpeedFrame(fmt.Sprintf("12%02d00", i), "2237.7514", 10, 90))
+		select {
+		case update := <-updates:
+			if update.DeviceID != truck.ID {
+				t.Fatalf("Tailed update %+v of another device", update)
+			}
+			position = update.Position
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+	if position == nil {
+		t.Fatal("No position tailed")
+	}
+	cancel()
+	select {
+	case err := <-tailed:
+		if err != nil {
+			t.Errorf("Tail ended with %v, want nil after cancelling", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Tail did not end after cancelling")
+	}
+
+	// Devices that cannot be followed are refused before the upgrade
+	if err := c.Tail(context.Background(), []string{"missing"}, nil, nil); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("Tailing an unknown device = %v, want a 404", err)
+	}
+}
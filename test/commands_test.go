@@ -0,0 +1,129 @@
+package test
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"tracking/internal/core/model"
+)
+
+// waitForCommand waits for a queued command to reach the status
+func (e *testEnv) waitForCommand(t *testing.T, deviceID, commandID, status string) *model.Command {
+	t.Helper()
+
+	for deadline := time.Now().Add(2 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		var commands []*model.Command
+		if code := e.do(t, http.MethodGet, "/api/devices/commands?deviceId="+deviceID, nil, &commands); code != http.StatusOK {
+			t.Fatalf("List commands returned %d", code)
+		}
+		for _, command := range commands {
+			if command.ID == commandID && command.Status == status {
+				return command
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Command %s never reached %s: %+v", commandID, status, commands)
+		}
+	}
+}
+
+// readUntil reads from a device connection until the received text
+// contains want
+func readUntil(t *testing.T, conn net.Conn, want string) string {
+	t.Helper()
+
+	var received []byte
+	buffer := make([]byte, 1024)
+	for !strings.Contains(string(received), want) {
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		n, err := conn.Read(buffer)
+		if err != nil {
+			t.Fatalf("Never received %q, got %q: %v", want, received, err)
+		}
+		received = append(received, buffer[:n]...)
+	}
+	return string(received)
+}
+
+func TestCommandQueue(t *testing.T) {
+	env := newTestEnv(t)
+	device := env.registerDevice(t, "4210051415", "h02")
+	tracker := env.registerDevice(t, "0353413532881372", "gt06")
+	path := "/api/devices/commands?deviceId=" + device.ID
+
+	// Unknown commands and those the protocol lacks are refused
+	for _, tc := range []struct {
+		deviceID string
+		body     map[string]interface{}
+	}{
+		{device.ID, map[string]interface{}{"type": "selfDestruct"}},
+		{device.ID, map[string]interface{}{"type": "setInterval"}},
+		{device.ID, map[string]interface{}{"type": "setCornerReporting", "angle": 30}},
+		{tracker.ID, map[string]interface{}{"type": "setCornerReporting", "angle": 270}},
+	} {
+		if code := env.do(t, http.MethodPost, "/api/devices/commands?deviceId="+tc.deviceID, tc.body, nil); code != http.StatusBadRequest {
+			t.Errorf("Queue %v returned %d, want 400", tc.body, code)
+		}
+	}
+
+	// Commands for an offline device wait for it
+	var stop, locate model.Command
+	if code := env.do(t, http.MethodPost, path, map[string]interface{}{"type": "engineStop"}, &stop); code != http.StatusOK {
+		t.Fatalf("Queue engineStop returned %d", code)
+	}
+	if stop.Status != model.CommandPending || stop.Attempts != 0 {
+		t.Fatalf("Queued command = %+v, want pending", stop)
+	}
+	if code := env.do(t, http.MethodPost, path, map[string]interface{}{"type": "locate"}, &locate); code != http.StatusOK {
+		t.Fatalf("Queue locate returned %d", code)
+	}
+
+	var cancelled model.Command
+	if code := env.do(t, http.MethodPost, "/api/devices/commands/cancel?id="+locate.ID, nil, &cancelled); code != http.StatusOK {
+		t.Fatalf("Cancel returned %d", code)
+	}
+	if cancelled.Status != model.CommandCancelled {
+		t.Errorf("Cancelled command status = %s", cancelled.Status)
+	}
+
+	// The pending command follows the device's login
+	conn := env.dialDevice(t)
+	if _, err := conn.Write(h02BinaryFrame); err != nil {
+		t.Fatalf("Failed to send frame: %v", err)
+	}
+	received := readUntil(t, conn, "S20,")
+	if !strings.Contains(received, "*HQ,4210051415,S20,") || strings.Contains(received, ",R1,") {
+		t.Fatalf("Unexpected commands %q", received)
+	}
+	sent := env.waitForCommand(t, device.ID, stop.ID, model.CommandSent)
+	if sent.Attempts != 1 || sent.SentAt == nil {
+		t.Errorf("Sent command = %+v", sent)
+	}
+	if code := env.do(t, http.MethodPost, "/api/devices/commands/cancel?id="+stop.ID, nil, nil); code != http.StatusConflict {
+		t.Errorf("Cancel of a sent command returned %d, want 409", code)
+	}
+
+	// The device's reply acknowledges it
+	if _, err := conn.Write([]byte("*HQ,V4,4210051415,S20,130305,1,1#")); err != nil {
+		t.Fatalf("Failed to send reply: %v", err)
+	}
+	acknowledged := env.waitForCommand(t, device.ID, stop.ID, model.CommandAcknowledged)
+	if acknowledged.Result != "S20,130305,1,1" || acknowledged.AcknowledgedAt == nil {
+		t.Errorf("Acknowledged command = %+v", acknowledged)
+	}
+
+	// Commands for a connected device are sent at once
+	var interval model.Command
+	if code := env.do(t, http.MethodPost, path, map[string]interface{}{"type": "setInterval", "interval": 60}, &interval); code != http.StatusOK {
+		t.Fatalf("Queue setInterval returned %d", code)
+	}
+	if interval.Status != model.CommandSent {
+		t.Errorf("Command for a connected device = %+v, want sent", interval)
+	}
+	if received := readUntil(t, conn, "S71,"); !strings.Contains(received, ",22,60#") {
+		t.Errorf("Unexpected interval command %q", received)
+	}
+}
@@ -0,0 +1,117 @@
+package test
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"tracking/internal/core/model"
+)
+
+func TestComputedAttributes(t *testing.T) {
+	env := newTestEnv(t)
+	phone := env.registerDevice(t, "123456", "osmand")
+	other := env.registerDevice(t, "654321", "osmand")
+
+	for _, invalid := range []model.ComputedAttribute{
+		{DeviceID: phone.ID, Attribute: "hours", Expression: "batteryLevel *"},
+		{DeviceID: phone.ID, Attribute: "hours", Expression: "exec(1)"},
+		{DeviceID: phone.ID, Attribute: "speed", Expression: "1"},
+		{DeviceID: phone.ID, Attribute: "_hidden", Expression: "1"},
+		{DeviceID: phone.ID, Attribute: "hours", Expression: "1", Type: "date"},
+	} {
+		if status := env.do(t, http.MethodPost, "/api/attributes/computed", invalid, nil); status != http.StatusBadRequest {
+			t.Errorf("Creating %+v returned status %d, want 400", invalid, status)
+		}
+	}
+	if status := env.do(t, http.MethodPost, "/api/attributes/computed", model.ComputedAttribute{
+		DeviceID: "unknown", Attribute: "hours", Expression: "1",
+	}, nil); status != http.StatusNotFound {
+		t.Errorf("Creating an attribute on an unknown device returned status %d, want 404", status)
+	}
+
+	// Attributes build on those of lower priority; a result of the wrong
+	// type is left out
+	var hours model.ComputedAttribute
+	for _, attribute := range []model.ComputedAttribute{
+		{DeviceID: phone.ID, Attribute: "rangeKm", Expression: "batteryHours * 30", Priority: 2},
+		{DeviceID: phone.ID, Attribute: "batteryHours", Expression: "batteryLevel * 0.2", Priority: 1},
+		{DeviceID: phone.ID, Attribute: "moving", Expression: "speed > 15", Type: model.AttributeTypeBoolean, Priority: 3},
+		{DeviceID: phone.ID, Attribute: "label", Expression: "batteryLevel", Type: model.AttributeTypeString, Priority: 3},
+	} {
+		var created model.ComputedAttribute
+		if status := env.do(t, http.MethodPost, "/api/attributes/computed", attribute, &created); status != http.StatusOK {
+			t.Fatalf("Creating %s returned status %d", attribute.Attribute, status)
+		}
+		if created.Attribute == "batteryHours" {
+			hours = created
+		}
+	}
+
+	env.osmandReport(t, phone, url.Values{"lat": {"52.52"}, "lon": {"13.405"}, "speed": {"10"}, "batt": {"80"}, "timestamp": {"2022-10-15T12:30:00Z"}})
+	env.osmandReport(t, other, url.Values{"lat": {"52.52"}, "lon": {"13.405"}, "batt": {"80"}, "timestamp": {"2022-10-15T12:30:00Z"}})
+	positions := env.positions(t, phone.ID)
+	if len(positions) != 1 {
+		t.Fatalf("Got %d positions, want 1", len(positions))
+	}
+	status := positions[0].Status
+	if status["batteryHours"] != 16.0 || status["rangeKm"] != 480.0 || status["moving"] != true {
+		t.Errorf("Computed attributes = %v", status)
+	}
+	if _, ok := status["label"]; ok {
+		t.Errorf("Attribute of the wrong type stored: %v", status["label"])
+	}
+	if _, ok := env.positions(t, other.ID)[0].Status["batteryHours"]; ok {
+		t.Error("Attribute of one device computed for another")
+	}
+
+	hours.Expression = "batteryLevel * 0.25"
+	if code := env.do(t, http.MethodPut, "/api/attributes/computed?id="+hours.ID, hours, &hours); code != http.StatusOK {
+		t.Fatalf("Updating batteryHours returned status %d", code)
+	}
+	env.osmandReport(t, phone, url.Values{"lat": {"52.52"}, "lon": {"13.405"}, "batt": {"40"}, "timestamp": {"2022-10-15T12:45:00Z"}})
+	var latest model.Position
+	env.do(t, http.MethodGet, "/api/positions/latest?deviceId="+phone.ID, nil, &latest)
+	if latest.Status["batteryHours"] != 10.0 || latest.Status["rangeKm"] != 300.0 {
+		t.Errorf("Attributes after the update = %v", latest.Status)
+	}
+
+	// The check evaluates against the latest position
+	test := func(deviceID, expression string) (int, interface{}) {
+		var result struct {
+			Value interface{} `json:"value"`
+		}
+		code := env.do(t, http.MethodPost, "/api/attributes/computed/test", map[string]string{
+			"deviceId": deviceID, "expression": expression,
+		}, &result)
+		return code, result.Value
+	}
+	if code, value := test(phone.ID, "batteryLevel / 4 + rangeKm"); code != http.StatusOK || value != 310.0 {
+		t.Errorf("Testing a valid expression returned %d, %v", code, value)
+	}
+	for _, broken := range []string{"(batteryLevel", "fuelCounter * 0.1", "batteryLevel / 0"} {
+		if code, _ := test(phone.ID, broken); code != http.StatusBadRequest {
+			t.Errorf("Testing %q returned status %d, want 400", broken, code)
+		}
+	}
+	silent := env.registerDevice(t, "999999", "osmand")
+	if code, value := test(silent.ID, "batteryLevel * 2"); code != http.StatusOK || value != nil {
+		t.Errorf("Testing against a device without positions returned %d, %v", code, value)
+	}
+
+	var attributes []*model.ComputedAttribute
+	if env.do(t, http.MethodGet, "/api/attributes/computed?deviceId="+phone.ID, nil, &attributes); len(attributes) != 4 || attributes[0].ID != hours.ID {
+		t.Fatalf("Attributes = %+v", attributes)
+	}
+	stranger := env.memberToken(t, "stranger", "")
+	if code := env.doAs(t, stranger, "", http.MethodPost, "/api/attributes/computed/delete?id="+hours.ID, nil, nil); code != http.StatusNotFound {
+		t.Errorf("Stranger deleting an attribute got status %d, want 404", code)
+	}
+	if code := env.do(t, http.MethodPost, "/api/attributes/computed/delete?id="+hours.ID, nil, nil); code != http.StatusOK {
+		t.Fatalf("Deleting batteryHours returned status %d", code)
+	}
+	env.do(t, http.MethodGet, "/api/attributes/computed?deviceId="+phone.ID, nil, &attributes)
+	if len(attributes) != 3 {
+		t.Errorf("Got %d attributes after deleting one, want 3", len(attributes))
+	}
+}
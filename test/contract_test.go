@@ -0,0 +1,249 @@
+package test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"tracking/internal/core/model"
+)
+
+// contractCase describes a frame that must produce the same position over
+// the TCP listener and the /api/positions/raw endpoint
+type contractCase struct {
+	name     string
+	protocol string
+	uniqueID string
+	login    []byte // sent over TCP before the frame, if the protocol needs it
+	frame    []byte
+}
+
+func teltonikaFrame() []byte {
+	frame := new(bytes.Buffer)
+	binary.Write(frame, binary.BigEndian, 37.7749)
+	binary.Write(frame, binary.BigEndian, -122.4194)
+	binary.Write(frame, binary.BigEndian, float32(100.5))
+	binary.Write(frame, binary.BigEndian, uint16(455))
+	binary.Write(frame, binary.BigEndian, uint16(180))
+	return frame.Bytes()
+}
+
+func contractCases() []contractCase {
+	teltonika := teltonikaFrame()
+
+	return []contractCase{
+		{
+			name:     "gt06 location",
+			protocol: "gt06",
+			uniqueID: "0353413532881372",
+			login:    gt06LoginFrame,
+			frame:    gt06LocationFrame,
+		},
+		{
+			name:     "h02 info report",
+			protocol: "h02",
+			uniqueID: "123456789012345",
+			frame:    h02Frame,
+		},
+		{
+			name:     "teltonika record",
+			protocol: "teltonika",
+			// The TCP server identifies Teltonika sessions by the first 8 bytes
+			uniqueID: fmt.Sprintf("%X", teltonika[0:8]),
+			frame:    teltonika,
+		},
+	}
+}
+
+func TestTCPAndHTTPIngestProduceSamePosition(t *testing.T) {
+	for _, tc := range contractCases() {
+		t.Run(tc.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			device := env.registerDevice(t, tc.uniqueID, tc.protocol)
+
+			tcpPosition := ingestOverTCP(t, env, device, tc)
+			assertDeviceUpdated(t, env, device.ID, tcpPosition)
+
+			httpPosition := ingestOverHTTP(t, env, device, tc)
+			assertDeviceUpdated(t, env, device.ID, httpPosition)
+
+			assertSamePosition(t, tcpPosition, httpPosition)
+		})
+	}
+}
+
+func ingestOverTCP(t *testing.T, env *testEnv, device *model.Device, tc contractCase) *model.Position {
+	t.Helper()
+
+	conn := env.dialDevice(t)
+	if tc.login != nil {
+		exchange(t, conn, tc.login)
+	}
+	exchange(t, conn, tc.frame)
+
+	positions := env.positions(t, device.ID)
+	if len(positions) != 1 {
+		t.Fatalf("TCP ingest stored %d positions, want 1", len(positions))
+	}
+	return positions[0]
+}
+
+// ingestOverHTTP posts the frame using the device's uniqueId, which the API
+// accepts interchangeably with the internal ID
+func ingestOverHTTP(t *testing.T, env *testEnv, device *model.Device, tc contractCase) *model.Position {
+	t.Helper()
+
+	request := map[string]string{
+		"deviceId": device.UniqueID,
+		"rawData":  base64.StdEncoding.EncodeToString(tc.frame),
+	}
+
+	var created model.Position
+	if status := env.do(t, http.MethodPost, "/api/positions/raw", request, &created); status != http.StatusOK {
+		t.Fatalf("HTTP ingest returned status %d", status)
+	}
+
+	for _, position := range env.positions(t, device.ID) {
+		if position.ID == created.ID {
+			return position
+		}
+	}
+	t.Fatalf("HTTP ingested position %s not listed for device %s", created.ID, device.ID)
+	return nil
+}
+
+func assertDeviceUpdated(t *testing.T, env *testEnv, deviceID string, position *model.Position) {
+	t.Helper()
+
+	device, err := env.deviceRepo.FindByID(deviceID)
+	if err != nil || device == nil {
+		t.Fatalf("Failed to load device %s: %v", deviceID, err)
+	}
+	if device.Status != "active" {
+		t.Errorf("Device status = %s, want active", device.Status)
+	}
+	if device.PositionID != position.ID {
+		t.Errorf("Device positionId = %s, want %s", device.PositionID, position.ID)
+	}
+	if !device.LastUpdate.Equal(position.Timestamp) {
+		t.Errorf("Device lastUpdate = %v, want %v", device.LastUpdate, position.Timestamp)
+	}
+}
+
+func assertSamePosition(t *testing.T, tcp, http *model.Position) {
+	t.Helper()
+
+	if tcp.ID == http.ID {
+		t.Errorf("Both paths produced position ID %s", tcp.ID)
+	}
+
+	if !tcp.Timestamp.Equal(http.Timestamp) {
+		t.Errorf("Timestamp: tcp=%v, http=%v", tcp.Timestamp, http.Timestamp)
+	}
+
+	// Compare everything except the generated ID and timestamp
+	normalize := func(p *model.Position) model.Position {
+		copied := *p
+		copied.ID = ""
+		copied.Timestamp = time.Time{}
+		return copied
+	}
+	if a, b := normalize(tcp), normalize(http); !reflect.DeepEqual(a, b) {
+		t.Errorf("Positions differ:\n tcp=%+v\nhttp=%+v", a, b)
+	}
+}
+
+// frameContractCase is a GT06 frame without a fix, sent after a login and
+// a location and followed by another login, that must leave the device in
+// the same state whether it arrives over the TCP listener or the
+// /api/positions/raw endpoint
+type frameContractCase struct {
+	name  string
+	frame []byte
+	acked bool // The server answers the frame over TCP
+}
+
+func frameContractCases() []frameContractCase {
+	return []frameContractCase{
+		{name: "heartbeat", frame: gt06HeartbeatFrame, acked: true},
+		{name: "information", frame: gt06VoltageFrame},
+		{name: "command reply", frame: gt06ReplyFrame},
+		{name: "lbs", frame: gt06LBSFrame(0x20), acked: true},
+	}
+}
+
+func TestTCPAndHTTPIngestHandleFramesWithoutFixAlike(t *testing.T) {
+	for _, tc := range frameContractCases() {
+		t.Run(tc.name, func(t *testing.T) {
+			overTCP := newTestEnv(t)
+			tcpDevice := overTCP.registerDevice(t, "0353413532881372", "gt06")
+			tcpResults := overTCP.captureEvents(model.EventCommandResult)
+			conn := overTCP.dialDevice(t)
+			exchange(t, conn, gt06LoginFrame)
+			exchange(t, conn, gt06LocationFrame)
+			if tc.acked {
+				exchange(t, conn, tc.frame)
+			} else if _, err := conn.Write(tc.frame); err != nil {
+				t.Fatalf("Failed to send frame: %v", err)
+			}
+			// Answered once the frame before it is handled
+			exchange(t, conn, gt06LoginFrame)
+
+			overHTTP := newTestEnv(t)
+			httpDevice := overHTTP.registerDevice(t, "0353413532881372", "gt06")
+			httpResults := overHTTP.captureEvents(model.EventCommandResult)
+			for _, frame := range [][]byte{gt06LoginFrame, gt06LocationFrame, tc.frame, gt06LoginFrame} {
+				postRawFrame(t, overHTTP, httpDevice, frame)
+			}
+
+			tcpPositions, httpPositions := overTCP.positions(t, tcpDevice.ID), overHTTP.positions(t, httpDevice.ID)
+			if len(tcpPositions) != len(httpPositions) {
+				t.Fatalf("TCP stored %d positions, HTTP %d", len(tcpPositions), len(httpPositions))
+			}
+			// Each environment registers its own device, pointed at the
+			// same position of the list
+			tcpStored, _ := overTCP.deviceRepo.FindByID(tcpDevice.ID)
+			httpStored, _ := overHTTP.deviceRepo.FindByID(httpDevice.ID)
+			for i := range tcpPositions {
+				httpPosition := *httpPositions[i]
+				httpPosition.DeviceID = tcpPositions[i].DeviceID
+				assertSamePosition(t, tcpPositions[i], &httpPosition)
+				if (tcpPositions[i].ID == tcpStored.PositionID) != (httpPositions[i].ID == httpStored.PositionID) {
+					t.Errorf("Position %d is the latest over only one of TCP and HTTP", i)
+				}
+			}
+			if httpStored.Status != tcpStored.Status || !httpStored.LastUpdate.Equal(tcpStored.LastUpdate) {
+				t.Errorf("Device status, lastUpdate: tcp=%s, %v, http=%s, %v",
+					tcpStored.Status, tcpStored.LastUpdate, httpStored.Status, httpStored.LastUpdate)
+			}
+
+			tcpEvents, httpEvents := tcpResults(), httpResults()
+			if len(tcpEvents) != len(httpEvents) {
+				t.Fatalf("TCP raised %d command results, HTTP %d", len(tcpEvents), len(httpEvents))
+			}
+			for i := range tcpEvents {
+				if !reflect.DeepEqual(tcpEvents[i].Attributes, httpEvents[i].Attributes) {
+					t.Errorf("Command result: tcp=%v, http=%v", tcpEvents[i].Attributes, httpEvents[i].Attributes)
+				}
+			}
+		})
+	}
+}
+
+// postRawFrame posts a frame to /api/positions/raw for the device
+func postRawFrame(t *testing.T, env *testEnv, device *model.Device, frame []byte) {
+	t.Helper()
+
+	request := map[string]string{
+		"deviceId": device.ID,
+		"rawData":  base64.StdEncoding.EncodeToString(frame),
+	}
+	if status := env.do(t, http.MethodPost, "/api/positions/raw", request, nil); status != http.StatusOK {
+		t.Fatalf("HTTP ingest returned status %d", status)
+	}
+}
@@ -0,0 +1,103 @@
+package test
+
+import (
+	"net/http"
+	"net/url"
+	"slices"
+	"testing"
+
+	"tracking/internal/core/model"
+)
+
+// osmandReport sends a position over the OsmAnd protocol
+func (e *testEnv) osmandReport(t *testing.T, device *model.Device, params url.Values) {
+	t.Helper()
+
+	params.Set("id", device.UniqueID)
+	params.Set("key", device.ApiKey)
+	resp, err := http.Get(e.baseURL + "/osmand?" + params.Encode())
+	if err != nil {
+		t.Fatalf("OsmAnd report failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("OsmAnd report returned status %d", resp.StatusCode)
+	}
+}
+
+func TestDashboardWidgets(t *testing.T) {
+	env := newTestEnv(t)
+	truck := env.registerDevice(t, "4210051415", "h02")
+	phone := env.registerDevice(t, "123456", "osmand")
+	env.registerDevice(t, "0353413532881372", "gt06") // Never reports
+
+	conn := env.dialDevice(t)
+	for _, frame := range [][]byte{
+		[]byte("*HQ,4210051415,V1,121000,A,2237.7514,N,11408.6214,E,0,0,151022,FFFBFFFF#"), // SOS
+		h02SpeedFrame("121500", "2237.7514", 40, 0),
+		h02SpeedFrame("130000", "2237.8514", 20, 0), // 185 m north
+		h02SpeedFrame("131500", "2237.9514", 20, 0), // 185 m further
+	} {
+		exchange(t, conn, frame)
+	}
+	env.osmandReport(t, phone, url.Values{"lat": {"52.52"}, "lon": {"13.405"}, "speed": {"10"}, "timestamp": {"2022-10-15T12:30:00Z"}})
+	env.osmandReport(t, phone, url.Values{"lat": {"52.53"}, "lon": {"13.405"}, "speed": {"5"}, "timestamp": {"2022-10-15T12:45:00Z"}})
+
+	const day = "from=2022-10-15T00:00:00Z&to=2022-10-16T00:00:00Z"
+	get := func(path string) *model.Chart {
+		t.Helper()
+		var chart model.Chart
+		if status := env.do(t, http.MethodGet, path, nil, &chart); status != http.StatusOK {
+			t.Fatalf("%s returned status %d", path, status)
+		}
+		return &chart
+	}
+
+	speeders := get("/api/dashboard/top-speeders?" + day)
+	if !slices.Equal(speeders.DeviceIDs, []string{truck.ID, phone.ID}) || len(speeders.Series) != 1 ||
+		!almostEqual(speeders.Series[0].Data[0], 74.08, 0.01) || !almostEqual(speeders.Series[0].Data[1], 18.52, 0.01) {
+		t.Errorf("Top speeders = %+v %+v", speeders, speeders.Series)
+	}
+	if speeders.Labels[0] != truck.Name {
+		t.Errorf("Labels = %v, want device names", speeders.Labels)
+	}
+
+	distance := get("/api/dashboard/most-distance?limit=1&" + day)
+	if !slices.Equal(distance.DeviceIDs, []string{phone.ID}) || !almostEqual(distance.Series[0].Data[0], 1.11, 0.01) {
+		t.Errorf("Most distance = %+v %+v", distance, distance.Series)
+	}
+	truckOnly := get("/api/dashboard/most-distance?protocol=h02&" + day)
+	if !slices.Equal(truckOnly.DeviceIDs, []string{truck.ID}) || !almostEqual(truckOnly.Series[0].Data[0], 0.37, 0.01) {
+		t.Errorf("Most distance of h02 devices = %+v %+v", truckOnly, truckOnly.Series)
+	}
+
+	alarms := get("/api/dashboard/alarms?from=2022-10-14T00:00:00Z&to=2022-10-16T00:00:00Z")
+	if !slices.Equal(alarms.Labels, []string{"2022-10-14", "2022-10-15"}) || len(alarms.Series) != 1 ||
+		alarms.Series[0].Name != "sos" || !slices.Equal(alarms.Series[0].Data, []float64{0, 1}) {
+		t.Errorf("Alarms = %+v %+v", alarms, alarms.Series)
+	}
+
+	// Two of the three devices reported at noon, one at one o'clock
+	hourly := get("/api/dashboard/online-ratio?" + day)
+	if len(hourly.Labels) != 24 || hourly.Labels[12] != "2022-10-15T12:00:00Z" {
+		t.Fatalf("Online ratio labels = %v", hourly.Labels)
+	}
+	if data := hourly.Series[0].Data; data[11] != 0 || data[12] != 0.667 || data[13] != 0.333 {
+		t.Errorf("Hourly online ratio = %v", data)
+	}
+	daily := get("/api/dashboard/online-ratio?interval=day&" + day)
+	if !slices.Equal(daily.Labels, []string{"2022-10-15"}) || !slices.Equal(daily.Series[0].Data, []float64{0.667}) {
+		t.Errorf("Daily online ratio = %+v %+v", daily, daily.Series)
+	}
+
+	for _, path := range []string{
+		"/api/dashboard/online-ratio?interval=week&" + day,
+		"/api/dashboard/top-speeders?from=2022-10-16T00:00:00Z&to=2022-10-15T00:00:00Z",
+		"/api/dashboard/alarms?from=2022-01-01T00:00:00Z&to=2022-10-15T00:00:00Z",
+		"/api/dashboard/top-speeders?limit=0",
+	} {
+		if status := env.do(t, http.MethodGet, path, nil, nil); status != http.StatusBadRequest {
+			t.Errorf("%s returned status %d, want 400", path, status)
+		}
+	}
+}
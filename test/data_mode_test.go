@@ -0,0 +1,110 @@
+package test
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"tracking/internal/core/model"
+)
+
+func TestLowDataMode(t *testing.T) {
+	env := newTestEnv(t)
+	tracker := env.registerDevice(t, "0353413532881372", "gt06")
+	truck := env.registerDevice(t, "4210051415", "h02")
+	phone := env.registerDevice(t, "123456", "osmand")
+
+	for _, invalid := range []model.DataMode{
+		{DeviceID: tracker.ID, LowData: true, Interval: 10},
+		{DeviceID: tracker.ID, LowData: true, Interval: 600, CornerOnly: true, CornerAngle: 270},
+		{DeviceID: truck.ID, LowData: true, Interval: 600, CornerOnly: true},
+		{DeviceID: phone.ID, LowData: true, Interval: 600},
+	} {
+		if status := env.do(t, http.MethodPut, "/api/devices/data-mode", invalid, nil); status != http.StatusBadRequest {
+			t.Errorf("Setting %+v returned status %d, want 400", invalid, status)
+		}
+	}
+
+	// The GT06 tracker is asked for a report every ten minutes and at
+	// corners, once it connects
+	var mode model.DataMode
+	if status := env.do(t, http.MethodPut, "/api/devices/data-mode", model.DataMode{
+		DeviceID: tracker.ID, LowData: true, Interval: 600, CornerOnly: true,
+	}, &mode); status != http.StatusOK {
+		t.Fatalf("Setting low-data mode returned status %d", status)
+	}
+	if mode.CornerAngle != model.DefaultCornerAngle || len(mode.CommandIDs) != 2 || mode.UserID != testUserID {
+		t.Errorf("Mode = %+v", mode)
+	}
+	env.waitForCommand(t, tracker.ID, mode.CommandIDs[0], model.CommandPending)
+
+	conn := env.dialDevice(t)
+	if _, err := conn.Write(gt06LoginFrame); err != nil {
+		t.Fatalf("Failed to send login: %v", err)
+	}
+	received := readUntil(t, conn, "ANGLEREP,ON,30,3#")
+	if !strings.Contains(received, "TIMER,600,600#") {
+		t.Errorf("Received %q, want the TIMER instruction", received)
+	}
+	env.waitForCommand(t, tracker.ID, mode.CommandIDs[1], model.CommandSent)
+
+	// The H02 truck only takes the interval, and returns to the default
+	// when low-data mode is turned off
+	var truckMode model.DataMode
+	if status := env.do(t, http.MethodPut, "/api/devices/data-mode", model.DataMode{DeviceID: truck.ID, Interval: 600}, &truckMode); status != http.StatusOK {
+		t.Fatalf("Turning low-data mode off returned status %d", status)
+	}
+	if truckMode.Interval != model.DefaultReportInterval || len(truckMode.CommandIDs) != 1 {
+		t.Errorf("Truck mode = %+v", truckMode)
+	}
+	var commands []*model.Command
+	env.do(t, http.MethodGet, "/api/devices/commands?deviceId="+truck.ID, nil, &commands)
+	if len(commands) != 1 || commands[0].Type != model.CommandSetInterval || commands[0].Interval != model.DefaultReportInterval {
+		t.Errorf("Truck commands = %+v", commands)
+	}
+
+	var stored model.DataMode
+	if status := env.do(t, http.MethodGet, "/api/devices/data-mode?deviceId="+tracker.ID, nil, &stored); status != http.StatusOK {
+		t.Fatalf("Getting the mode returned status %d", status)
+	}
+	if !stored.LowData || stored.Interval != 600 || !stored.CornerOnly {
+		t.Errorf("Stored mode = %+v", stored)
+	}
+	other := env.memberToken(t, "other-user", "")
+	if status := env.doAs(t, other, "", http.MethodGet, "/api/devices/data-mode?deviceId="+tracker.ID, nil, nil); status != http.StatusNotFound {
+		t.Errorf("Getting another user's device mode returned status %d, want 404", status)
+	}
+}
+
+func TestDataUsageEstimate(t *testing.T) {
+	env := newTestEnv(t)
+	phone := env.registerDevice(t, "123456", "osmand")
+
+	// Twelve reports over the half day since the phone was added
+	since := testStart.Add(-12 * time.Hour)
+	phone.CreatedAt = since
+	if err := env.app.Repositories.Devices.Update(phone); err != nil {
+		t.Fatalf("Failed to backdate the phone: %v", err)
+	}
+	for i := 0; i < 12; i++ {
+		env.osmandReport(t, phone, url.Values{
+			"lat":       {"52.52"},
+			"lon":       {"13.405"},
+			"timestamp": {fmt.Sprint(since.Add(time.Duration(i) * time.Hour).Unix())},
+		})
+	}
+
+	var usage model.DataUsage
+	if status := env.do(t, http.MethodGet, "/api/devices/data-usage?deviceId="+phone.ID, nil, &usage); status != http.StatusOK {
+		t.Fatalf("Estimating usage returned status %d", status)
+	}
+	if usage.Reports != 12 || usage.ReportsPerDay != 24 || usage.MonthlyBytes != int64(24*30*usage.BytesPerReport) {
+		t.Errorf("Usage = %+v, want 12 reports at 24 a day", usage)
+	}
+	if !usage.Since.Equal(since) {
+		t.Errorf("Observed since %v, want %v", usage.Since, since)
+	}
+}
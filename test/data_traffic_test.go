@@ -0,0 +1,110 @@
+package test
+
+import (
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"tracking/internal/core/model"
+	"tracking/internal/protocol/gt06"
+)
+
+// gt06IdentityFrame reports the IMEI, IMSI and ICCID 8986011234567890123
+var gt06IdentityFrame = extendedGT06Frame(gt06.InfoMsg,
+	gt06.InfoIdentity,
+	0x03, 0x53, 0x41, 0x35, 0x32, 0x88, 0x13, 0x72,
+	0x04, 0x60, 0x01, 0x12, 0x34, 0x56, 0x78, 0x90,
+	0x89, 0x86, 0x01, 0x12, 0x34, 0x56, 0x78, 0x90, 0x12, 0x3F,
+	0x00, 0x03,
+)
+
+func TestSIMDataTraffic(t *testing.T) {
+	env := newTestEnv(t)
+	tracker := env.registerDevice(t, "0353413532881372", "gt06")
+	truck := env.registerDevice(t, "4210051415", "h02")
+	truck.Phone = "+15550100199"
+	if err := env.app.Repositories.Devices.Update(truck); err != nil {
+		t.Fatalf("Failed to set the truck's phone: %v", err)
+	}
+
+	// Bytes each way, as the devices see them
+	var trackerIn, trackerOut, truckIn, truckOut int
+	send := func(conn net.Conn, frame []byte, in, out *int) {
+		t.Helper()
+		*in += len(frame)
+		*out += len(exchange(t, conn, frame))
+	}
+
+	trackerConn := env.dialDevice(t)
+	send(trackerConn, gt06LoginFrame, &trackerIn, &trackerOut)
+	if _, err := trackerConn.Write(gt06IdentityFrame); err != nil {
+		t.Fatalf("Failed to send identity: %v", err)
+	}
+	trackerIn += len(gt06IdentityFrame)
+	// Information packets are not acknowledged, so wait for the position
+	for deadline := time.Now().Add(2 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		var latest model.Position
+		env.do(t, http.MethodGet, "/api/positions/latest?deviceId="+tracker.ID, nil, &latest)
+		if latest.Status["iccid"] != nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("The tracker's identity was not stored")
+		}
+	}
+	send(trackerConn, gt06LocationFrame, &trackerIn, &trackerOut)
+
+	truckConn := env.dialDevice(t)
+	send(truckConn, h02ACCFrame("120000", "2237.7514", true), &truckIn, &truckOut)
+	send(truckConn, h02ACCFrame("120100", "2237.8514", true), &truckIn, &truckOut)
+
+	// Open connections show their traffic in their session
+	var sessions []*model.DeviceSession
+	env.do(t, http.MethodGet, "/api/devices/sessions", nil, &sessions)
+	for _, session := range sessions {
+		if session.DeviceID == truck.ID && (session.BytesIn != int64(truckIn) || session.BytesOut != int64(truckOut)) {
+			t.Errorf("Truck session = %d in, %d out, want %d, %d", session.BytesIn, session.BytesOut, truckIn, truckOut)
+		}
+	}
+
+	// Traffic is recorded when the connections close
+	trackerConn.Close()
+	truckConn.Close()
+	var usages []*model.SIMUsage
+	for deadline := time.Now().Add(2 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		if status := env.do(t, http.MethodGet, "/api/devices/data-traffic", nil, &usages); status != http.StatusOK {
+			t.Fatalf("Getting the report returned status %d", status)
+		}
+		if len(usages) == 2 || time.Now().After(deadline) {
+			break
+		}
+	}
+	if len(usages) != 2 {
+		t.Fatalf("Got %d SIMs, want 2: %+v", len(usages), usages)
+	}
+
+	// The truck used more, so it comes first
+	device, sim := usages[0], usages[1]
+	if sim.ICCID != "8986011234567890123" || len(sim.DeviceIDs) != 1 || sim.DeviceIDs[0] != tracker.ID ||
+		sim.BytesIn != int64(trackerIn) || sim.BytesOut != int64(trackerOut) || sim.Bytes != int64(trackerIn+trackerOut) {
+		t.Errorf("Tracker SIM = %+v, want %d in, %d out", sim, trackerIn, trackerOut)
+	}
+	if device.ICCID != "" || device.Phone != "+15550100199" || device.DeviceIDs[0] != truck.ID ||
+		device.BytesIn != int64(truckIn) || device.BytesOut != int64(truckOut) || device.Month != "2024-01" {
+		t.Errorf("Truck usage = %+v, want %d in, %d out", device, truckIn, truckOut)
+	}
+
+	var earlier []*model.SIMUsage
+	if status := env.do(t, http.MethodGet, "/api/devices/data-traffic?month=2023-12", nil, &earlier); status != http.StatusOK || len(earlier) != 0 {
+		t.Errorf("December returned status %d, %+v, want no traffic", status, earlier)
+	}
+	if status := env.do(t, http.MethodGet, "/api/devices/data-traffic?month=January", nil, nil); status != http.StatusBadRequest {
+		t.Errorf("A malformed month returned status %d, want 400", status)
+	}
+	other := env.memberToken(t, "other-user", "")
+	var others []*model.SIMUsage
+	if status := env.doAs(t, other, "", http.MethodGet, "/api/devices/data-traffic", nil, &others); status != http.StatusOK || len(others) != 0 {
+		t.Errorf("Another user got status %d, %+v, want no traffic", status, others)
+	}
+}
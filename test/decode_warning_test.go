@@ -0,0 +1,63 @@
+package test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"tracking/internal/core/model"
+)
+
+func TestDecodeWarnings(t *testing.T) {
+	env := newTestEnv(t)
+	device := env.registerDevice(t, "4210051415", "h02")
+	conn := env.dialDevice(t)
+
+	// Two hours ahead of the server and without a course, as a tracker set
+	// to local time reports while standing
+	ahead := []byte("*HQ,4210051415,V1,120000,A,2237.7514,N,11408.6214,E,0,,150124,FFFFFBFF#")
+	if response := exchange(t, conn, ahead); string(response) != "*HQ,OK#" {
+		t.Fatalf("Unexpected H02 response %q", response)
+	}
+	if response := exchange(t, conn, h02SpeedFrame("120000", "2237.7520", 10, 90)); string(response) != "*HQ,OK#" {
+		t.Fatalf("Unexpected H02 response %q", response)
+	}
+
+	positions := env.positions(t, device.ID)
+	if len(positions) != 2 {
+		t.Fatalf("Stored %d positions, want both", len(positions))
+	}
+	var warned, clean *model.Position
+	for _, position := range positions {
+		if position.Speed == 0 {
+			warned = position
+		} else {
+			clean = position
+		}
+	}
+	if warned == nil || clean == nil {
+		t.Fatalf("Positions = %+v, want one of each frame", positions)
+	}
+	if len(clean.Warnings) != 0 {
+		t.Errorf("Warnings = %+v, want none for a complete frame", clean.Warnings)
+	}
+	codes := map[string]bool{}
+	for _, warning := range warned.Warnings {
+		codes[warning.Code] = warning.Message != ""
+	}
+	if len(codes) != 2 || !codes[model.WarningCourseMissing] || !codes[model.WarningTimestampClamped] {
+		t.Errorf("Warnings = %+v, want the course defaulted and the time clamped", warned.Warnings)
+	}
+	if !warned.Timestamp.Equal(testStart) {
+		t.Errorf("Timestamp = %v, want the server time %v", warned.Timestamp, testStart)
+	}
+
+	env.clock.Advance(time.Minute)
+	code, status := getStatus(t, env)
+	if code != http.StatusOK {
+		t.Fatalf("Status returned %d", code)
+	}
+	if status.Ingest.Warnings[model.WarningCourseMissing] != 1 || status.Ingest.Warnings[model.WarningTimestampClamped] != 1 || len(status.Ingest.Warnings) != 2 {
+		t.Errorf("Warnings = %v, want one of each", status.Ingest.Warnings)
+	}
+}
@@ -0,0 +1,50 @@
+package test
+
+import (
+	"net/url"
+	"testing"
+
+	"tracking/internal/config"
+)
+
+func TestDuplicatePositionsDropped(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) { cfg.DedupCacheSize = 1000 })
+	tracker := env.registerDevice(t, "0353413532881372", "gt06")
+	phone := env.registerDevice(t, "123456", "osmand")
+
+	// The device missed the answer to its first report and sends it again;
+	// both are answered so it moves on
+	conn := env.dialDevice(t)
+	exchange(t, conn, gt06LoginFrame)
+	for i := 0; i < 2; i++ {
+		if _, err := conn.Write(gt06LocationFrame); err != nil {
+			t.Fatalf("Failed to send frame: %v", err)
+		}
+		if replies := readLocationReplies(t, conn, 1); replies != 1 {
+			t.Fatalf("Report %d got %d replies, want 1", i+1, replies)
+		}
+	}
+	if positions := env.positions(t, tracker.ID); len(positions) != 1 {
+		t.Errorf("Got %d positions, want the resent one dropped", len(positions))
+	}
+
+	report := url.Values{"lat": {"52.52"}, "lon": {"13.405"}, "timestamp": {"1665836113"}}
+	env.osmandReport(t, phone, report)
+	env.osmandReport(t, phone, report)
+	env.osmandReport(t, phone, url.Values{"lat": {"52.53"}, "lon": {"13.405"}, "timestamp": {"1665836113"}})
+	if positions := env.positions(t, phone.ID); len(positions) != 2 {
+		t.Errorf("Got %d positions, want 2 distinct ones", len(positions))
+	}
+}
+
+func TestDuplicateSuppressionDisabled(t *testing.T) {
+	env := newTestEnv(t) // DedupCacheSize left at zero
+	phone := env.registerDevice(t, "123456", "osmand")
+
+	report := url.Values{"lat": {"52.52"}, "lon": {"13.405"}, "timestamp": {"1665836113"}}
+	env.osmandReport(t, phone, report)
+	env.osmandReport(t, phone, report)
+	if positions := env.positions(t, phone.ID); len(positions) != 2 {
+		t.Errorf("Got %d positions, want both stored", len(positions))
+	}
+}
@@ -0,0 +1,107 @@
+package test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"tracking/internal/config"
+	"tracking/internal/core/model"
+)
+
+// dialTLS connects to the TLS device listener with the issued certificate,
+// trusting the server by the authority that came with it
+func (e *testEnv) dialTLS(t *testing.T, issued *model.IssuedDeviceCertificate) *tls.Conn {
+	t.Helper()
+
+	certificate, err := tls.X509KeyPair([]byte(issued.Certificate), []byte(issued.PrivateKey))
+	if err != nil {
+		t.Fatalf("Failed to load issued certificate: %v", err)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM([]byte(issued.CACertificate)) {
+		t.Fatalf("Failed to load the authority")
+	}
+	port := e.app.TCPServer.TLSAddr().(*net.TCPAddr).Port
+	conn, err := tls.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port), &tls.Config{
+		Certificates: []tls.Certificate{certificate},
+		RootCAs:      roots,
+		Time:         e.clock.Now, // Certificates are issued by the test clock
+	})
+	if err != nil {
+		t.Fatalf("Failed to connect over TLS: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestDeviceTLS(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) { cfg.DeviceTLS = true })
+	device := env.registerDevice(t, "0353413532881372", "gt06")
+
+	var issued model.IssuedDeviceCertificate
+	if status := env.do(t, http.MethodPost, "/api/admin/device-certificates", model.DeviceCertificateRequest{DeviceID: device.ID}, &issued); status != http.StatusOK {
+		t.Fatalf("Issuing a certificate returned status %d", status)
+	}
+	if issued.UniqueID != device.UniqueID || issued.PrivateKey == "" || !issued.NotAfter.Equal(testStart.Add(365*24*time.Hour)) {
+		t.Fatalf("Issued = %+v, want 365 days for %s with its key", issued.DeviceCertificate, device.UniqueID)
+	}
+
+	// The certificate names the device, so a position needs no login first
+	conn := env.dialTLS(t, &issued)
+	if response := exchange(t, conn, gt06LocationFrame); len(response) < 4 || response[0] != 0x78 || response[3] != 0x12 {
+		t.Fatalf("Invalid GT06 location response: % x", response)
+	}
+	if positions := env.positions(t, device.ID); len(positions) != 1 {
+		t.Fatalf("Got %d positions, want 1", len(positions))
+	}
+	// A login is still answered
+	if response := exchange(t, conn, gt06LoginFrame); len(response) < 4 || response[3] != 0x01 {
+		t.Errorf("Invalid GT06 login response: % x", response)
+	}
+
+	var listed []*model.DeviceCertificate
+	if status := env.do(t, http.MethodGet, "/api/admin/device-certificates?deviceId="+device.ID, nil, &listed); status != http.StatusOK {
+		t.Fatalf("Listing certificates returned status %d", status)
+	}
+	if len(listed) != 1 || listed[0].Serial != issued.Serial || listed[0].Revoked() {
+		t.Fatalf("Certificates = %+v, want the one issued", listed)
+	}
+
+	stored := len(env.positions(t, device.ID))
+	var revoked model.DeviceCertificate
+	if status := env.do(t, http.MethodPost, "/api/admin/device-certificates/revoke", map[string]string{"id": issued.ID}, &revoked); status != http.StatusOK || !revoked.Revoked() {
+		t.Fatalf("Revoking returned status %d and %+v", status, revoked)
+	}
+	// The server refuses the certificate once the client's handshake is
+	// done, so the refusal shows on the first read
+	conn = env.dialTLS(t, &issued)
+	conn.Write(gt06LocationFrame)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if n, err := conn.Read(make([]byte, 64)); err == nil {
+		t.Errorf("Revoked certificate was answered with %d bytes", n)
+	}
+	if positions := env.positions(t, device.ID); len(positions) != stored {
+		t.Errorf("Got %d positions after revoking, want %d", len(positions), stored)
+	}
+
+	for _, req := range []model.DeviceCertificateRequest{{}, {DeviceID: device.ID, ValidityDays: -1}} {
+		if status := env.do(t, http.MethodPost, "/api/admin/device-certificates", req, nil); status != http.StatusBadRequest {
+			t.Errorf("Issuing %+v returned status %d, want 400", req, status)
+		}
+	}
+	if status := env.do(t, http.MethodPost, "/api/admin/device-certificates", model.DeviceCertificateRequest{DeviceID: "unknown"}, nil); status != http.StatusNotFound {
+		t.Errorf("Issuing for an unknown device returned status %d, want 404", status)
+	}
+	if status := env.do(t, http.MethodPost, "/api/admin/device-certificates/revoke", map[string]string{"id": "unknown"}, nil); status != http.StatusNotFound {
+		t.Errorf("Revoking an unknown certificate returned status %d, want 404", status)
+	}
+	member := env.memberToken(t, "member-1", "")
+	if status := env.doAs(t, member, "", http.MethodGet, "/api/admin/device-certificates", nil, nil); status != http.StatusForbidden {
+		t.Errorf("Listing certificates as a member returned status %d, want 403", status)
+	}
+}
@@ -0,0 +1,1235 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"tracking/internal/app"
+	"tracking/internal/config"
+	"tracking/internal/core/hook"
+	"tracking/internal/core/model"
+	"tracking/internal/core/repository"
+	"tracking/internal/core/util"
+	"tracking/internal/protocol/gt06"
+	"tracking/internal/protocol/registry"
+)
+
+// testUserID is the subject issued by /api/auth/test-login
+const testUserID = "test-user-id"
+
+// testStart is the instant every test environment's clock starts at
+var testStart = time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+
+// Captured device frames replayed by the suite
+var (
+	// GT06 login carrying IMEI 0353413532881372, serial 0x0001
+	gt06LoginFrame = []byte{
+		0x78, 0x78, 0x0D, 0x01,
+		0x03, 0x53, 0x41, 0x35, 0x32, 0x88, 0x13, 0x72,
+		0x00, 0x01,
+		0x1B, 0xC8,
+		0x0D, 0x0A,
+	}
+
+	// GT06 location: 12°34.5678' / 091°02.030', 40 km/h, 2023-02-14 12:15:13 UTC
+	gt06LocationFrame = []byte{
+		0x78, 0x78, 0x15, 0x12,
+		0x0F,
+		0x12, 0x34, 0x56, 0x78,
+		0x09, 0x10, 0x20, 0x30,
+		0x28,
+		0x01, 0x44,
+		0x23, 0x02, 0x14,
+		0x12, 0x15, 0x13,
+		0xF1, 0x03,
+		0x0D, 0x0A,
+	}
+
+	// GT06 heartbeat: power 4, GSM 5, serial 0x1234
+	gt06HeartbeatFrame = []byte{
+		0x78, 0x78, 0x08, 0x13,
+		0x45,
+		0x00, 0x01,
+		0x12, 0x34,
+		0x70, 0x7D,
+		0x0D, 0x0A,
+	}
+
+	// Reply "OK" to a command sent with server flag 1
+	gt06ReplyFrame = []byte{
+		0x78, 0x78, 0x0C, 0x15,
+		0x06, 0x00, 0x00, 0x00, 0x01,
+		'O', 'K',
+		0x00, 0x01,
+		0x96, 0x8E,
+		0x0D, 0x0A,
+	}
+
+	// Extended frame reporting 12.40 V external power, serial 5
+	gt06VoltageFrame = []byte{
+		0x79, 0x79, 0x00, 0x08, 0x94,
+		0x00, 0x04, 0xD8,
+		0x00, 0x05,
+		0x66, 0xAD,
+		0x0D, 0x0A,
+	}
+
+	h02Frame = []byte("*HQ,V1,123456789012345,A,2237.7514,N,11408.6214,E,6,2,151022,10,1,6#")
+
+	// H02 report in the common ID-first layout, with the time of day and a
+	// status word reporting ACC on
+	h02TimedFrame = []byte("*HQ,4210051415,V1,121513,A,2237.7514,N,11408.6214,E,6,2,151022,FFFFFBFF#")
+
+	// Queclink GL200 heartbeat and scheduled report with one fix
+	queclinkHeartbeatFrame = []byte("+ACK:GTHBD,02010B,135790246811220,,20090214093254,11F0$")
+	queclinkReportFrame    = []byte("+RESP:GTFRI,02010B,135790246811220,,0,0,1,1,4.3,92,70.0,121.354335,31.222073,20090214013254,0460,0000,18d8,6141,00,80,20090214093254,11F1$")
+
+	// Coban TK103 login, heartbeat and report, sent at 12:19 local time
+	// (UTC+8) with a fix at 04:19:05 UTC
+	cobanLoginFrame     = []byte("##,imei:359586015829802,A;")
+	cobanHeartbeatFrame = []byte("359586015829802;")
+	cobanReportFrame    = []byte("imei:359586015829802,tracker,1210221219,13554900601,F,041905.000,A,2237.7514,N,11408.6214,E,10.00,90.5;")
+
+	// 3G watch heartbeat with battery, then an SOS alarm located in Shenzhen
+	// at 2014-04-22 13:46:52 UTC
+	watchHeartbeatFrame = []byte("[3G*8800000015*000C*LK,2500,3,85]")
+	watchAlarmFrame     = []byte("[3G*8800000015*0069*AL,220414,134652,A,22.571707,N,113.8613968,E,5.5,90.0,100,7,60,80,2600,3,00010000,1,1,460,0,9360,4082,131]")
+
+	// NMEA gateway registering as 865328021234567, then an RMC and GGA fix
+	// in Sydney at 2024-01-15 09:30:00.5 UTC and an RMC without its GGA
+	nmeaRegistration = "865328021234567\r\n"
+	nmeaRMC          = "$GNRMC,093000.50,A,3345.1234,S,15112.5678,E,10.0,180.0,150124,,,A*66\r\n"
+	nmeaGGA          = "$GNGGA,093000.50,3345.1234,S,15112.5678,E,2,11,0.7,35.2,M,20.1,M,,*5C\r\n"
+	nmeaLoneRMC      = "$GPRMC,093002.00,V,3345.1250,S,15112.5700,E,0.0,0.0,150124,,,N*53\r\n"
+
+	// Xexun TK103-2 SOS alarm from 359587010124901 in Shenzhen at
+	// 2010-05-18 10:25:22 UTC on low battery while charging
+	xexunAlarmFrame = []byte("100518102522,+8613800000000,GPRMC,102522.000,A,2233.1245,N,11403.0023,E,0.00,,180510,,,A*7C,F,help me,imei:359587010124901,08,38.4,L:3.61V,1,128,38762,460,00,247C,0E3F\r\n")
+
+	// Megastek report from 860719020193193 at 2014-02-24 10:47:42 UTC with
+	// three analog inputs and two temperature sensors
+	megastekFrame = []byte("$MGV002,860719020193193,DeviceName,R,240214,104742,A,2238.20471,N,11401.97967,E,08,10,00,1.20,0.462,356.23,137.9,1.5,460,07,262C,0F54,25,1000,0001,512,0,780,28.5,-3.2,,,100,Timer;!")
+
+	// EGTS identity of terminal 1001 with IMEI 356307042441013, packet 1
+	egtsIdentityPacket = append(append([]byte{
+		0x01, 0x00, 0x00, 0x0B, 0x00, 0x1E, 0x00, 0x01, 0x00, 0x01, 0xA9,
+		0x17, 0x00, 0x01, 0x00, 0x00, 0x01, 0x01,
+		0x01, 0x14, 0x00, 0xE9, 0x03, 0x00, 0x00, 0x02,
+	}, "356307042441013"...), 0x59, 0xDA)
+
+	// EGTS teledata packet 2 with one record 10: a fix in Moscow at
+	// 2024-01-15 09:58:20 UTC, 60.5 km/h heading 300, 150 m high, 11
+	// satellites and 1234.5 km on the odometer
+	egtsTeledataPacket = []byte{
+		0x01, 0x00, 0x00, 0x0B, 0x00, 0x2D, 0x00, 0x02, 0x00, 0x01, 0xA3,
+		0x22, 0x00, 0x0A, 0x00, 0x01, 0xE9, 0x03, 0x00, 0x00, 0x02, 0x02,
+		0x10, 0x18, 0x00,
+		0xBC, 0xC6, 0x67, 0x1A,
+		0x98, 0x28, 0x98, 0x9E,
+		0x20, 0x1D, 0x80, 0x35,
+		0x91, 0x5D, 0x82, 0x2C,
+		0x39, 0x30, 0x00, 0x05, 0x10,
+		0x96, 0x00, 0x00,
+		0x11, 0x04, 0x00, 0x0A, 0x5A, 0x00, 0x0B,
+		0x7D, 0xFD,
+	}
+
+	// Binary H02 report from device 4210051415 at 2022-10-15 12:15:13, ACC on
+	h02BinaryFrame = []byte{
+		'$', 0x42, 0x10, 0x05, 0x14, 0x15,
+		0x12, 0x15, 0x13, 0x15, 0x10, 0x22,
+		0x22, 0x37, 0x75, 0x14, 0x50,
+		0x11, 0x40, 0x86, 0x21, 0x4E,
+		0x00, 0x60, 0x02,
+		0xFF, 0xFF, 0xFB, 0xFF,
+	}
+)
+
+type testEnv struct {
+	app          *app.App
+	deviceRepo   repository.DeviceRepository
+	positionRepo repository.PositionRepository
+	baseURL      string
+	clock        *util.FixedClock
+	token        string
+}
+
+func newTestEnv(t *testing.T, configure ...func(*config.Config)) *testEnv {
+	t.Helper()
+	return newTestEnvWithRepositories(t, app.NewInMemoryRepositories(), configure...)
+}
+
+// newTestEnvWithRepositories starts the application on the given storage,
+// for tests that wrap a repository
+func newTestEnvWithRepositories(t *testing.T, repos app.Repositories, configure ...func(*config.Config)) *testEnv {
+	t.Helper()
+	t.Setenv("TEST_MODE", "true")
+
+	clock := util.NewFixedClock(testStart)
+	cfg := &config.Config{Host: "127.0.0.1", Port: "0", TCPPort: 0, TestMode: true}
+	for _, fn := range configure {
+		fn(cfg)
+	}
+
+	application, err := app.New(cfg, app.WithClock(clock), app.WithRepositories(repos))
+	if err != nil {
+		t.Fatalf("Failed to build application: %v", err)
+	}
+	application.TCPServer.EnableDebug(false)
+	application.UDPServer.EnableDebug(false)
+	if err := application.Start(); err != nil {
+		t.Fatalf("Failed to start application: %v", err)
+	}
+	t.Cleanup(func() { application.Shutdown(context.Background()) })
+
+	env := &testEnv{
+		app:          application,
+		deviceRepo:   application.Repositories.Devices,
+		positionRepo: application.Repositories.Positions,
+		baseURL:      "http://" + application.HTTPAddr().String(),
+		clock:        clock,
+	}
+	env.token = env.login(t)
+	return env
+}
+
+func (e *testEnv) login(t *testing.T) string {
+	t.Helper()
+
+	body, _ := json.Marshal(map[string]string{"email": "test@example.com", "password": "test123"})
+	resp, err := http.Post(e.baseURL+"/api/auth/test-login", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("Login request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Login returned status %d", resp.StatusCode)
+	}
+
+	var tokens struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokens); err != nil {
+		t.Fatalf("Failed to decode login response: %v", err)
+	}
+	return tokens.AccessToken
+}
+
+// registerDevice stores a device owned by the test user
+func (e *testEnv) registerDevice(t *testing.T, uniqueID, protocol string) *model.Device {
+	t.Helper()
+
+	device := model.NewDevice("E2E "+protocol, uniqueID)
+	device.Protocol = protocol
+	device.SetOwnership(testUserID, "")
+	if err := e.deviceRepo.Create(device); err != nil {
+		t.Fatalf("Failed to register device: %v", err)
+	}
+	return device
+}
+
+// do sends an authenticated API request and decodes the JSON response into out
+func (e *testEnv) do(t *testing.T, method, path string, in, out interface{}) int {
+	t.Helper()
+
+	var body bytes.Buffer
+	if in != nil {
+		if err := json.NewEncoder(&body).Encode(in); err != nil {
+			t.Fatalf("Failed to encode request: %v", err)
+		}
+	}
+
+	req, err := http.NewRequest(method, e.baseURL+path, &body)
+	if err != nil {
+		t.Fatalf("Failed to build request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+e.token)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s failed: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	if out != nil && resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("Failed to decode %s response: %v", path, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func (e *testEnv) positions(t *testing.T, deviceID string) []*model.Position {
+	t.Helper()
+
+	var positions []*model.Position
+	if status := e.do(t, http.MethodGet, "/api/positions/list?deviceId="+deviceID, nil, &positions); status != http.StatusOK {
+		t.Fatalf("Listing positions returned status %d", status)
+	}
+	return positions
+}
+
+// dialDevice opens a TCP session to the tracking server
+func (e *testEnv) dialDevice(t *testing.T) net.Conn {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", e.app.TCPServer.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to connect to TCP server: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// exchange writes one frame and waits for the server's reply
+func exchange(t *testing.T, conn net.Conn, frame []byte) []byte {
+	t.Helper()
+
+	if _, err := conn.Write(frame); err != nil {
+		t.Fatalf("Failed to send frame: %v", err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	response := make([]byte, 1024)
+	n, err := conn.Read(response)
+	if err != nil {
+		t.Fatalf("Failed to read response: %v", err)
+	}
+	return response[:n]
+}
+
+func almostEqual(a, b, epsilon float64) bool {
+	diff := a - b
+	if diff < 0 {
+		diff = -diff
+	}
+	return diff < epsilon
+}
+
+func TestHealth(t *testing.T) {
+	env := newTestEnv(t)
+
+	resp, err := http.Get(env.baseURL + "/health")
+	if err != nil {
+		t.Fatalf("Health request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Health returned status %d", resp.StatusCode)
+	}
+}
+
+func TestGT06OverTCP(t *testing.T) {
+	env := newTestEnv(t)
+	device := env.registerDevice(t, "0353413532881372", "gt06")
+	conn := env.dialDevice(t)
+
+	response := exchange(t, conn, gt06LoginFrame)
+	if len(response) < 4 || response[0] != 0x78 || response[1] != 0x78 || response[3] != 0x01 {
+		t.Fatalf("Invalid GT06 login response: % x", response)
+	}
+
+	response = exchange(t, conn, gt06LocationFrame)
+	if len(response) < 4 || response[0] != 0x78 || response[1] != 0x78 {
+		t.Fatalf("Invalid GT06 location response: % x", response)
+	}
+
+	positions := env.positions(t, device.ID)
+	if len(positions) != 1 {
+		t.Fatalf("Got %d positions, want 1", len(positions))
+	}
+
+	position := positions[0]
+	if position.Protocol != "gt06" {
+		t.Errorf("Protocol = %s, want gt06", position.Protocol)
+	}
+	if !almostEqual(position.Latitude, 12.5761333, 0.0001) || !almostEqual(position.Longitude, 91.0338333, 0.0001) {
+		t.Errorf("Position = %f,%f, want 12.576133,91.033833", position.Latitude, position.Longitude)
+	}
+	if !almostEqual(position.Speed, 40, 0.1) {
+		t.Errorf("Speed = %v, want 40", position.Speed)
+	}
+	if want := time.Date(2023, 2, 14, 12, 15, 13, 0, time.UTC); !position.Timestamp.Equal(want) {
+		t.Errorf("Timestamp = %v, want %v", position.Timestamp, want)
+	}
+
+	var latest model.Position
+	if status := env.do(t, http.MethodGet, "/api/positions/latest?deviceId="+device.ID, nil, &latest); status != http.StatusOK {
+		t.Fatalf("Latest position returned status %d", status)
+	}
+	if latest.ID != position.ID {
+		t.Errorf("Latest position = %s, want %s", latest.ID, position.ID)
+	}
+
+	stored, _ := env.deviceRepo.FindByID(device.ID)
+	if stored.Status != "active" || stored.PositionID != position.ID {
+		t.Errorf("Device status = %s, positionId = %s, want active, %s", stored.Status, stored.PositionID, position.ID)
+	}
+}
+
+func TestGT06HeartbeatOverTCP(t *testing.T) {
+	env := newTestEnv(t)
+	device := env.registerDevice(t, "0353413532881372", "gt06")
+	conn := env.dialDevice(t)
+
+	exchange(t, conn, gt06LoginFrame)
+
+	env.clock.Advance(time.Minute)
+	response := exchange(t, conn, gt06HeartbeatFrame)
+	want := []byte{0x78, 0x78, 0x05, 0x13, 0x12, 0x34, 0x29, 0xFE, 0x0D, 0x0A}
+	if !bytes.Equal(response, want) {
+		t.Fatalf("Heartbeat response = % x, want % x", response, want)
+	}
+
+	if positions := env.positions(t, device.ID); len(positions) != 0 {
+		t.Errorf("Got %d positions from a heartbeat, want 0", len(positions))
+	}
+
+	stored, _ := env.deviceRepo.FindByID(device.ID)
+	if want := testStart.Add(time.Minute); stored.Status != "active" || !stored.LastUpdate.Equal(want) {
+		t.Errorf("Device status = %s, lastUpdate = %v, want active, %v", stored.Status, stored.LastUpdate, want)
+	}
+}
+
+func TestGT06InformationOverTCP(t *testing.T) {
+	env := newTestEnv(t)
+	device := env.registerDevice(t, "0353413532881372", "gt06")
+	conn := env.dialDevice(t)
+
+	exchange(t, conn, gt06LoginFrame)
+	exchange(t, conn, gt06LocationFrame)
+
+	// Information packets are not acknowledged, so wait for the position
+	if _, err := conn.Write(gt06VoltageFrame); err != nil {
+		t.Fatalf("Failed to send information frame: %v", err)
+	}
+	var latest model.Position
+	for deadline := time.Now().Add(2 * time.Second); ; {
+		if status := env.do(t, http.MethodGet, "/api/positions/latest?deviceId="+device.ID, nil, &latest); status != http.StatusOK {
+			t.Fatalf("Latest position returned status %d", status)
+		}
+		if _, ok := latest.Status["externalVoltage"]; ok || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if voltage, _ := latest.Status["externalVoltage"].(float64); !almostEqual(voltage, 12.4, 0.001) {
+		t.Errorf("externalVoltage = %v, want 12.4", latest.Status["externalVoltage"])
+	}
+	if latest.Valid {
+		t.Error("Information position is marked valid")
+	}
+	if !almostEqual(latest.Latitude, 12.5761333, 0.0001) || !almostEqual(latest.Longitude, 91.0338333, 0.0001) {
+		t.Errorf("Position = %f,%f, want the last known 12.576133,91.033833", latest.Latitude, latest.Longitude)
+	}
+}
+
+// extendedGT06Frame frames content in a 0x7979 packet with a two byte length,
+// as sent by Jimi 4G models
+func extendedGT06Frame(protocol byte, content ...byte) []byte {
+	length := len(content) + 3
+	frame := []byte{0x79, 0x79, byte(length >> 8), byte(length), protocol}
+	frame = append(frame, content...)
+	crc := gt06.CalculateChecksum(frame[2:])
+	return append(frame, byte(crc>>8), byte(crc), 0x0D, 0x0A)
+}
+
+// gt06Heartbeat builds a status packet in the current layout with the given
+// terminal information byte
+func gt06Heartbeat(info byte, serial uint16) []byte {
+	frame := []byte{0x78, 0x78, 0x0A, gt06.StatusMsg, info, 0x04, 0x03, 0x00, 0x02, byte(serial >> 8), byte(serial)}
+	crc := gt06.CalculateChecksum(frame[2:])
+	return append(frame, byte(crc>>8), byte(crc), 0x0D, 0x0A)
+}
+
+// gt06LBSFrame builds a multi-cell LBS packet heard at 2023-02-14 12:20:00
+// UTC, with a serving cell only
+func gt06LBSFrame(serial uint16) []byte {
+	frame := []byte{0x78, 0x78, 0x00, gt06.LBSMultiMsg, 0x23, 0x02, 0x14, 0x12, 0x20, 0x00, 0x01, 0xCC, 0x00}
+	frame = append(frame, 0x27, 0x95, 0x00, 0x0E, 0x6F, 0x3C)
+	frame = append(frame, make([]byte, 6*6)...) // Empty neighbour slots
+	frame = append(frame, 0xFF, 0x00, 0x01, byte(serial>>8), byte(serial))
+	frame[2] = byte(len(frame) - 1) // Up to the serial, plus the checksum
+	crc := gt06.CalculateChecksum(frame[2:])
+	return append(frame, byte(crc>>8), byte(crc), 0x0D, 0x0A)
+}
+
+func TestGT06CellReportOverTCP(t *testing.T) {
+	env := newTestEnv(t)
+	device := env.registerDevice(t, "0353413532881372", "gt06")
+	conn := env.dialDevice(t)
+
+	exchange(t, conn, gt06LoginFrame)
+	exchange(t, conn, gt06LocationFrame)
+	if response := exchange(t, conn, gt06LBSFrame(0x20)); len(response) < 6 || response[3] != gt06.LBSMultiMsg || response[5] != 0x20 {
+		t.Fatalf("Invalid LBS response: % x", response)
+	}
+
+	// The cell report becomes the latest position without moving the
+	// device away from its last fix
+	var latest model.Position
+	if status := env.do(t, http.MethodGet, "/api/positions/latest?deviceId="+device.ID, nil, &latest); status != http.StatusOK {
+		t.Fatalf("Latest position returned status %d", status)
+	}
+	if latest.Valid || latest.Network == nil || len(latest.Network.CellTowers) != 1 {
+		t.Fatalf("Latest position valid = %v, network = %+v, want the cell report", latest.Valid, latest.Network)
+	}
+	if !almostEqual(latest.Latitude, 12.5761333, 0.0001) || !almostEqual(latest.Longitude, 91.0338333, 0.0001) {
+		t.Errorf("Position = %f,%f, want the last known 12.576133,91.033833", latest.Latitude, latest.Longitude)
+	}
+}
+
+func TestGT06IgnitionOverTCP(t *testing.T) {
+	env := newTestEnv(t)
+	device := env.registerDevice(t, "0353413532881372", "gt06")
+	conn := env.dialDevice(t)
+
+	exchange(t, conn, gt06LoginFrame)
+	exchange(t, conn, gt06LocationFrame)
+
+	// ACC on is stored at the last position; the same state again is not
+	on := gt06Heartbeat(gt06.TerminalACC|gt06.TerminalCharging|gt06.TerminalGPSTracking, 0x10)
+	if response := exchange(t, conn, on); len(response) < 4 || response[3] != gt06.StatusMsg {
+		t.Fatalf("Invalid heartbeat response: % x", response)
+	}
+	exchange(t, conn, on)
+	exchange(t, conn, gt06LocationFrame)
+	exchange(t, conn, gt06Heartbeat(gt06.TerminalGPSTracking, 0x11))
+
+	positions := env.positions(t, device.ID)
+	if len(positions) != 4 {
+		t.Fatalf("Got %d positions, want 4", len(positions))
+	}
+	// Status positions carry each change; the location before the first
+	// status packet has no ACC state and the one after takes it
+	counts := make(map[string]int)
+	for _, position := range positions {
+		counts[fmt.Sprintf("valid=%v ignition=%v", position.Valid, position.Status["ignition"])]++
+		if !almostEqual(position.Latitude, 12.5761333, 0.0001) {
+			t.Errorf("Position at %f, want the last known fix", position.Latitude)
+		}
+		if !position.Valid && position.Status["ignition"] == true &&
+			(position.Status["charging"] != true || position.Status["armed"] != false) {
+			t.Errorf("Status = %v", position.Status)
+		}
+	}
+	want := map[string]int{
+		"valid=true ignition=<nil>":  1,
+		"valid=true ignition=true":   1,
+		"valid=false ignition=true":  1,
+		"valid=false ignition=false": 1,
+	}
+	if !reflect.DeepEqual(counts, want) {
+		t.Errorf("Positions = %v, want %v", counts, want)
+	}
+}
+
+func TestJimiExtendedFramesOverTCP(t *testing.T) {
+	env := newTestEnv(t)
+	device := env.registerDevice(t, "0353413532881372", "gt06")
+	conn := env.dialDevice(t)
+
+	login := extendedGT06Frame(gt06.LoginMsg, 0x03, 0x53, 0x41, 0x35, 0x32, 0x88, 0x13, 0x72, 0x00, 0x01)
+	if response := exchange(t, conn, login); len(response) < 4 || response[3] != gt06.LoginMsg {
+		t.Fatalf("Invalid login response: % x", response)
+	}
+
+	// An OBD packet larger than one read arrives in two parts and is only
+	// kept as a sign of life
+	obd := extendedGT06Frame(0x8C, append(bytes.Repeat([]byte("0C=1A2B,"), 700), 0x00, 0x02)...)
+	expectNoResponse(t, conn, obd[:3000])
+	expectNoResponse(t, conn, obd[3000:])
+
+	location := extendedGT06Frame(gt06.GPS4GMsg,
+		0x0F, 0x12, 0x34, 0x56, 0x78, 0x09, 0x10, 0x20, 0x30, 0x28, 0x01, 0x44, 0x23, 0x02, 0x14, 0x12, 0x15, 0x13,
+		0x01, 0xCC, 0x00, 0x00, 0x00, 0x27, 0x95, 0x00, 0x00, 0x00, 0x00, 0x0E, 0x36, 0xA1, 0xB2,
+		0x01, 0x00, 0x00,
+		0x00, 0x03,
+	)
+	if response := exchange(t, conn, location); len(response) < 6 || response[3] != gt06.GPS4GMsg || response[5] != 0x03 {
+		t.Fatalf("Invalid location response: % x", response)
+	}
+
+	positions := env.positions(t, device.ID)
+	if len(positions) != 1 {
+		t.Fatalf("Got %d positions, want 1", len(positions))
+	}
+	position := positions[0]
+	if !almostEqual(position.Latitude, 12.5761333, 0.0001) || !almostEqual(position.Longitude, 91.0338333, 0.0001) {
+		t.Errorf("Position = %f,%f, want 12.576133,91.033833", position.Latitude, position.Longitude)
+	}
+	if position.Status["ignition"] != true || position.Status["mcc"] != float64(460) {
+		t.Errorf("Status = %v, want ignition and the 4G cell", position.Status)
+	}
+}
+
+func TestH02OverTCP(t *testing.T) {
+	env := newTestEnv(t)
+	device := env.registerDevice(t, "123456789012345", "h02")
+	conn := env.dialDevice(t)
+
+	// The first frame authenticates the session and is stored like the rest
+	for i := 0; i < 2; i++ {
+		if response := exchange(t, conn, h02Frame); string(response) != "*HQ,OK#" {
+			t.Fatalf("Frame %d: unexpected H02 response %q", i, response)
+		}
+	}
+
+	positions := env.positions(t, device.ID)
+	if len(positions) != 2 {
+		t.Fatalf("Got %d positions, want 2", len(positions))
+	}
+
+	position := positions[0]
+	if position.Protocol != "h02" {
+		t.Errorf("Protocol = %s, want h02", position.Protocol)
+	}
+	if !almostEqual(position.Latitude, 22.62919, 0.0001) || !almostEqual(position.Longitude, 114.14369, 0.0001) {
+		t.Errorf("Position = %f,%f, want 22.629190,114.143690", position.Latitude, position.Longitude)
+	}
+}
+
+func TestQueclinkOverTCP(t *testing.T) {
+	env := newTestEnv(t)
+	device := env.registerDevice(t, "135790246811220", "queclink")
+	conn := env.dialDevice(t)
+
+	if response := exchange(t, conn, queclinkHeartbeatFrame); string(response) != "+SACK:GTHBD,02010B,11F0$" {
+		t.Fatalf("Unexpected heartbeat response %q", response)
+	}
+	if response := exchange(t, conn, queclinkReportFrame); string(response) != "+SACK:11F1$" {
+		t.Fatalf("Unexpected report response %q", response)
+	}
+
+	positions := env.positions(t, device.ID)
+	if len(positions) != 1 {
+		t.Fatalf("Got %d positions, want 1", len(positions))
+	}
+	position := positions[0]
+	if position.Protocol != "queclink" || !almostEqual(position.Latitude, 31.222073, 0.000001) ||
+		!almostEqual(position.Longitude, 121.354335, 0.000001) || position.Speed != 4.3 {
+		t.Errorf("Position = %+v", position)
+	}
+	if want := time.Date(2009, 2, 14, 1, 32, 54, 0, time.UTC); !position.Timestamp.Equal(want) {
+		t.Errorf("Timestamp = %v, want %v", position.Timestamp, want)
+	}
+	if position.Network == nil || len(position.Network.CellTowers) != 1 || position.Network.CellTowers[0].MobileCountryCode != 460 {
+		t.Errorf("Network = %+v, want the serving cell", position.Network)
+	}
+}
+
+func TestCobanOverTCP(t *testing.T) {
+	env := newTestEnv(t)
+	device := env.registerDevice(t, "359586015829802", "coban")
+	conn := env.dialDevice(t)
+
+	if response := exchange(t, conn, cobanLoginFrame); string(response) != "LOAD" {
+		t.Fatalf("Unexpected login response %q", response)
+	}
+	// Reports are not answered; the heartbeat after it shows it was handled
+	expectNoResponse(t, conn, cobanReportFrame)
+	if response := exchange(t, conn, cobanHeartbeatFrame); string(response) != "ON" {
+		t.Fatalf("Unexpected heartbeat response %q", response)
+	}
+
+	positions := env.positions(t, device.ID)
+	if len(positions) != 1 {
+		t.Fatalf("Got %d positions, want 1", len(positions))
+	}
+	position := positions[0]
+	if position.Protocol != "coban" || !almostEqual(position.Latitude, 22.62919, 0.0001) ||
+		!almostEqual(position.Longitude, 114.14369, 0.0001) || !almostEqual(position.Speed, 18.52, 0.001) {
+		t.Errorf("Position = %+v", position)
+	}
+	if want := time.Date(2012, 10, 22, 4, 19, 5, 0, time.UTC); !position.Timestamp.Equal(want) {
+		t.Errorf("Timestamp = %v, want %v", position.Timestamp, want)
+	}
+}
+
+func TestWatchOverTCP(t *testing.T) {
+	env := newTestEnv(t)
+	device := env.registerDevice(t, "8800000015", "watch")
+	conn := env.dialDevice(t)
+
+	if response := exchange(t, conn, watchHeartbeatFrame); string(response) != "[3G*8800000015*0002*LK]" {
+		t.Fatalf("Unexpected heartbeat response %q", response)
+	}
+	if response := exchange(t, conn, watchAlarmFrame); string(response) != "[3G*8800000015*0002*AL]" {
+		t.Fatalf("Unexpected alarm response %q", response)
+	}
+
+	positions := env.positions(t, device.ID)
+	if len(positions) != 1 {
+		t.Fatalf("Got %d positions, want 1", len(positions))
+	}
+	position := positions[0]
+	if position.Protocol != "watch" || !almostEqual(position.Latitude, 22.571707, 0.000001) ||
+		!almostEqual(position.Longitude, 113.8613968, 0.000001) || position.Speed != 5.5 {
+		t.Errorf("Position = %+v", position)
+	}
+	if want := time.Date(2014, 4, 22, 13, 46, 52, 0, time.UTC); !position.Timestamp.Equal(want) {
+		t.Errorf("Timestamp = %v, want %v", position.Timestamp, want)
+	}
+	if position.Status["alarm"] != "sos" {
+		t.Errorf("Status = %v, want the SOS alarm", position.Status)
+	}
+}
+
+func TestNMEAOverTCP(t *testing.T) {
+	env := newTestEnv(t)
+	device := env.registerDevice(t, "865328021234567", "nmea")
+	conn := env.dialDevice(t)
+
+	// Sentences split across reads are reassembled, and nothing is answered
+	for _, data := range []string{nmeaRegistration + nmeaRMC[:30], nmeaRMC[30:] + nmeaGGA, nmeaLoneRMC} {
+		if _, err := conn.Write([]byte(data)); err != nil {
+			t.Fatalf("Failed to send sentences: %v", err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	// The last RMC waits for its GGA until the gateway disconnects
+	conn.Close()
+
+	var positions []*model.Position
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if positions, _ = env.positionRepo.FindByDeviceID(device.ID); len(positions) == 2 {
+			break
+		}
+	}
+	if len(positions) != 2 {
+		t.Fatalf("Got %d positions, want 2", len(positions))
+	}
+	sort.Slice(positions, func(i, j int) bool { return positions[i].Timestamp.Before(positions[j].Timestamp) })
+
+	position := positions[0]
+	if position.Protocol != "nmea" || !almostEqual(position.Latitude, -33.752057, 0.000001) ||
+		!almostEqual(position.Speed, 18.52, 0.001) || position.Altitude != 35.2 || position.Satellites != 11 {
+		t.Errorf("Position = %+v", position)
+	}
+	if want := time.Date(2024, 1, 15, 9, 30, 0, 500e6, time.UTC); !position.Timestamp.Equal(want) {
+		t.Errorf("Timestamp = %v, want %v", position.Timestamp, want)
+	}
+	if positions[1].Valid || positions[1].Satellites != 0 {
+		t.Errorf("Last position = %+v, want the void RMC alone", positions[1])
+	}
+}
+
+func TestXexunOverTCP(t *testing.T) {
+	if !slices.Contains(registry.Names(), "xexun") {
+		t.Skip("Built without the Xexun protocol")
+	}
+	env := newTestEnv(t)
+	device := env.registerDevice(t, "359587010124901", "xexun")
+	conn := env.dialDevice(t)
+
+	// Reports are not answered
+	if _, err := conn.Write(xexunAlarmFrame); err != nil {
+		t.Fatalf("Failed to send report: %v", err)
+	}
+
+	var positions []*model.Position
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if positions, _ = env.positionRepo.FindByDeviceID(device.ID); len(positions) == 1 {
+			break
+		}
+	}
+	if len(positions) != 1 {
+		t.Fatalf("Got %d positions, want 1", len(positions))
+	}
+	position := positions[0]
+	if position.Protocol != "xexun" || !almostEqual(position.Latitude, 22.552075, 0.000001) ||
+		!almostEqual(position.Longitude, 114.050038, 0.000001) || position.Satellites != 8 {
+		t.Errorf("Position = %+v", position)
+	}
+	if want := time.Date(2010, 5, 18, 10, 25, 22, 0, time.UTC); !position.Timestamp.Equal(want) {
+		t.Errorf("Timestamp = %v, want %v", position.Timestamp, want)
+	}
+	if status := position.Status; status["alarm"] != "sos" || status["lowBattery"] != true || status["charging"] != true {
+		t.Errorf("Status = %v, want an SOS on low battery while charging", status)
+	}
+	if position.Network == nil || len(position.Network.CellTowers) != 1 || position.Network.CellTowers[0].CellID != 0x0E3F {
+		t.Errorf("Network = %+v", position.Network)
+	}
+}
+
+func TestMegastekOverTCP(t *testing.T) {
+	env := newTestEnv(t)
+	device := env.registerDevice(t, "860719020193193", "megastek")
+	conn := env.dialDevice(t)
+
+	// Reports are not answered
+	if _, err := conn.Write(megastekFrame); err != nil {
+		t.Fatalf("Failed to send report: %v", err)
+	}
+
+	var positions []*model.Position
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if positions, _ = env.positionRepo.FindByDeviceID(device.ID); len(positions) == 1 {
+			break
+		}
+	}
+	if len(positions) != 1 {
+		t.Fatalf("Got %d positions, want 1", len(positions))
+	}
+	position := positions[0]
+	if position.Protocol != "megastek" || !almostEqual(position.Latitude, 22.636745, 0.000001) ||
+		!almostEqual(position.Longitude, 114.032995, 0.000001) || position.Satellites != 8 {
+		t.Errorf("Position = %+v", position)
+	}
+	if want := time.Date(2014, 2, 24, 10, 47, 42, 0, time.UTC); !position.Timestamp.Equal(want) {
+		t.Errorf("Timestamp = %v, want %v", position.Timestamp, want)
+	}
+
+	// Sensor channels survive the round trip through the API
+	positions = env.positions(t, device.ID)
+	if len(positions) != 1 {
+		t.Fatalf("Listed %d positions, want 1", len(positions))
+	}
+	status := positions[0].Status
+	if status["adc1"] != 512.0 || status["adc3"] != 780.0 || status["temp1"] != 28.5 || status["temp2"] != -3.2 {
+		t.Errorf("Status = %v, want both analog inputs and temperatures", status)
+	}
+}
+
+func TestEGTSOverTCP(t *testing.T) {
+	env := newTestEnv(t)
+	device := env.registerDevice(t, "356307042441013", "egts")
+	conn := env.dialDevice(t)
+
+	// The identity is confirmed and answered with a result code, sent
+	// together as two packets
+	response := exchange(t, conn, egtsIdentityPacket)
+	if len(response) < 16 || response[9] != 0 || !bytes.Equal(response[11:14], []byte{0x01, 0x00, 0x00}) {
+		t.Fatalf("Unexpected identity response % x", response)
+	}
+
+	// A packet split across reads is held until it is complete
+	if _, err := conn.Write(egtsTeledataPacket[:20]); err != nil {
+		t.Fatalf("Failed to send packet: %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	response = exchange(t, conn, egtsTeledataPacket[20:])
+	if len(response) < 14 || response[9] != 0 || !bytes.Equal(response[11:14], []byte{0x02, 0x00, 0x00}) {
+		t.Fatalf("Unexpected teledata response % x", response)
+	}
+
+	positions := env.positions(t, device.ID)
+	if len(positions) != 1 {
+		t.Fatalf("Got %d positions, want 1", len(positions))
+	}
+	position := positions[0]
+	if position.Protocol != "egts" || !almostEqual(position.Latitude, 55.755833, 0.000001) ||
+		!almostEqual(position.Longitude, 37.6175, 0.000001) || position.Speed != 60.5 || position.Course != 300 ||
+		position.Satellites != 11 || position.Status["odometer"] != 1234500.0 {
+		t.Errorf("Position = %+v", position)
+	}
+	if want := time.Date(2024, 1, 15, 9, 58, 20, 0, time.UTC); !position.Timestamp.Equal(want) {
+		t.Errorf("Timestamp = %v, want %v", position.Timestamp, want)
+	}
+}
+
+func TestH02TimestampOverTCP(t *testing.T) {
+	env := newTestEnv(t)
+	device := env.registerDevice(t, "4210051415", "h02")
+	conn := env.dialDevice(t)
+
+	if response := exchange(t, conn, h02TimedFrame); string(response) != "*HQ,OK#" {
+		t.Fatalf("Unexpected H02 response %q", response)
+	}
+
+	positions := env.positions(t, device.ID)
+	if len(positions) != 1 {
+		t.Fatalf("Got %d positions, want 1", len(positions))
+	}
+	if want := time.Date(2022, 10, 15, 12, 15, 13, 0, time.UTC); !positions[0].Timestamp.Equal(want) {
+		t.Errorf("Timestamp = %v, want %v", positions[0].Timestamp, want)
+	}
+	if status := positions[0].Status; status["acc"] != true || status["armed"] != false {
+		t.Errorf("Status = %v, want ACC on and disarmed", status)
+	}
+}
+
+func TestH02BinaryOverTCP(t *testing.T) {
+	env := newTestEnv(t)
+	device := env.registerDevice(t, "4210051415", "h02")
+	conn := env.dialDevice(t)
+
+	exchange(t, conn, h02BinaryFrame)
+
+	positions := env.positions(t, device.ID)
+	if len(positions) != 1 {
+		t.Fatalf("Got %d positions, want 1", len(positions))
+	}
+
+	position := positions[0]
+	if !almostEqual(position.Latitude, 22.62919, 0.0001) || !almostEqual(position.Longitude, 114.14369, 0.0001) {
+		t.Errorf("Position = %f,%f, want 22.629190,114.143690", position.Latitude, position.Longitude)
+	}
+	if want := time.Date(2022, 10, 15, 12, 15, 13, 0, time.UTC); !position.Timestamp.Equal(want) {
+		t.Errorf("Timestamp = %v, want %v", position.Timestamp, want)
+	}
+	if position.Status["acc"] != true {
+		t.Errorf("acc = %v, want true", position.Status["acc"])
+	}
+}
+
+func TestUnknownDeviceRejectedOverTCP(t *testing.T) {
+	env := newTestEnv(t)
+	conn := env.dialDevice(t)
+
+	if _, err := conn.Write(gt06LoginFrame); err != nil {
+		t.Fatalf("Failed to send frame: %v", err)
+	}
+
+	// The server closes the session without replying
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if n, err := conn.Read(make([]byte, 64)); err == nil {
+		t.Errorf("Expected connection to be closed, read %d bytes", n)
+	}
+}
+
+func TestRawDataOverHTTP(t *testing.T) {
+	env := newTestEnv(t)
+	device := env.registerDevice(t, "352093081452251", "teltonika")
+
+	frame := new(bytes.Buffer)
+	binary.Write(frame, binary.BigEndian, 37.7749)
+	binary.Write(frame, binary.BigEndian, -122.4194)
+	binary.Write(frame, binary.BigEndian, float32(100.5))
+	binary.Write(frame, binary.BigEndian, uint16(455))
+	binary.Write(frame, binary.BigEndian, uint16(180))
+
+	request := map[string]string{
+		"deviceId": device.ID,
+		"rawData":  base64.StdEncoding.EncodeToString(frame.Bytes()),
+	}
+
+	var created model.Position
+	if status := env.do(t, http.MethodPost, "/api/positions/raw", request, &created); status != http.StatusOK {
+		t.Fatalf("Raw data returned status %d", status)
+	}
+
+	var latest model.Position
+	if status := env.do(t, http.MethodGet, "/api/positions/latest?deviceId="+device.ID, nil, &latest); status != http.StatusOK {
+		t.Fatalf("Latest position returned status %d", status)
+	}
+
+	if latest.ID != created.ID {
+		t.Errorf("Latest position = %s, want %s", latest.ID, created.ID)
+	}
+	if latest.Protocol != "teltonika" || !almostEqual(latest.Speed, 45.5, 0.1) {
+		t.Errorf("Latest position = %+v", latest)
+	}
+	// Teltonika records carry no time, so they are stamped on receipt
+	if !latest.Timestamp.Equal(testStart) {
+		t.Errorf("Timestamp = %v, want %v", latest.Timestamp, testStart)
+	}
+}
+
+func TestPositionsRequireDeviceAccess(t *testing.T) {
+	env := newTestEnv(t)
+
+	device := model.NewDevice("Foreign", "foreign-device")
+	device.SetOwnership("another-user", "")
+	if err := env.deviceRepo.Create(device); err != nil {
+		t.Fatalf("Failed to register device: %v", err)
+	}
+
+	path := fmt.Sprintf("/api/positions/list?deviceId=%s", device.ID)
+	if status := env.do(t, http.MethodGet, path, nil, nil); status == http.StatusOK {
+		t.Errorf("Expected access to foreign device to be refused")
+	}
+}
+
+func TestAccessTokenExpires(t *testing.T) {
+	env := newTestEnv(t)
+
+	env.clock.Advance(14 * time.Minute)
+	if status := env.do(t, http.MethodGet, "/api/devices/list", nil, nil); status != http.StatusOK {
+		t.Fatalf("Expected token to be accepted before expiry, got %d", status)
+	}
+
+	env.clock.Advance(2 * time.Minute)
+	if status := env.do(t, http.MethodGet, "/api/devices/list", nil, nil); status != http.StatusUnauthorized {
+		t.Errorf("Expected expired token to be rejected, got %d", status)
+	}
+}
+
+func TestUserRegistration(t *testing.T) {
+	env := newTestEnv(t)
+
+	body, _ := json.Marshal(map[string]string{"email": "new@example.com", "password": "secret", "name": "New User"})
+	resp, err := http.Post(env.baseURL+"/api/users/register", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("Register request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Register returned status %d", resp.StatusCode)
+	}
+
+	user, _ := env.app.Repositories.Users.FindByEmail("new@example.com")
+	if user == nil || user.Name != "New User" {
+		t.Fatalf("Registered user = %+v", user)
+	}
+
+	// A second registration with the same email is refused
+	resp, err = http.Post(env.baseURL+"/api/users/register", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("Register request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Duplicate register returned status %d, want %d", resp.StatusCode, http.StatusBadRequest)
+	}
+}
+
+func TestRawDataWithDeviceCredentials(t *testing.T) {
+	env := newTestEnv(t)
+	device := env.registerDevice(t, "0353413532881372", "gt06")
+
+	post := func(apiKey, apiSecret string) int {
+		body, _ := json.Marshal(map[string]string{"rawData": base64.StdEncoding.EncodeToString(gt06LocationFrame)})
+		req, _ := http.NewRequest(http.MethodPost, env.baseURL+"/api/device/positions/raw?deviceId="+device.ID, bytes.NewReader(body))
+		req.Header.Set("X-Device-API-Key", apiKey)
+		req.Header.Set("X-Device-API-Secret", apiSecret)
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Device ingest failed: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if status := post(device.ApiKey, "wrong-secret"); status != http.StatusUnauthorized {
+		t.Errorf("Wrong secret returned status %d, want %d", status, http.StatusUnauthorized)
+	}
+	if status := post(device.ApiKey, device.ApiSecret); status != http.StatusOK {
+		t.Fatalf("Device ingest returned status %d", status)
+	}
+
+	if positions := env.positions(t, device.ID); len(positions) != 1 {
+		t.Errorf("Got %d positions, want 1", len(positions))
+	}
+}
+
+func TestOsmAndClientsOverHTTP(t *testing.T) {
+	env := newTestEnv(t)
+	device := env.registerDevice(t, "123456", "osmand")
+
+	// OsmAnd sends the report as parameters
+	params := url.Values{"id": {"123456"}, "key": {device.ApiKey}, "lat": {"52.52"}, "lon": {"13.405"}, "timestamp": {"1665836113"}}
+	resp, err := http.Get(env.baseURL + "/osmand?" + params.Encode())
+	if err != nil {
+		t.Fatalf("OsmAnd report failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("OsmAnd report returned status %d", resp.StatusCode)
+	}
+
+	// Traccar Client posts JSON, keeping the key in the server URL
+	post := func(key string) int {
+		body := `{"device_id":"123456","location":{"timestamp":"2022-10-15T12:16:13Z",` +
+			`"coords":{"latitude":52.53,"longitude":13.41,"speed":5,"heading":90},"battery":{"level":0.5,"is_charging":false}}}`
+		resp, err := http.Post(env.baseURL+"/osmand?key="+url.QueryEscape(key), "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("Traccar Client report failed: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if status := post("wrong-key"); status != http.StatusUnauthorized {
+		t.Errorf("Report with a wrong key returned status %d, want %d", status, http.StatusUnauthorized)
+	}
+	if status := post(device.ApiKey); status != http.StatusOK {
+		t.Fatalf("Traccar Client report returned status %d", status)
+	}
+
+	positions := env.positions(t, device.ID)
+	if len(positions) != 2 {
+		t.Fatalf("Got %d positions, want 2", len(positions))
+	}
+	latest, _ := env.positionRepo.FindLatestByDeviceID(device.ID)
+	if !almostEqual(latest.Latitude, 52.53, 0.0001) || !almostEqual(latest.Speed, 18, 0.0001) ||
+		latest.Status["batteryLevel"] != 50.0 || !latest.Timestamp.Equal(time.Unix(1665836173, 0)) {
+		t.Errorf("Latest position = %+v", latest)
+	}
+}
+
+func TestPositionHooksOverTCP(t *testing.T) {
+	env := newTestEnv(t)
+	device := env.registerDevice(t, "0353413532881372", "gt06")
+
+	stored := make(chan string, 1)
+	env.app.Hooks.RegisterPositionHook(hook.StageDecoded, func(ctx context.Context, p *model.Position) error {
+		p.Status["score"] = 7
+		return nil
+	})
+	env.app.Hooks.RegisterPositionHook(hook.StageStored, func(ctx context.Context, p *model.Position) error {
+		stored <- p.ID
+		return errors.New("ignored after storage")
+	})
+
+	conn := env.dialDevice(t)
+	exchange(t, conn, gt06LoginFrame)
+	exchange(t, conn, gt06LocationFrame)
+
+	positions := env.positions(t, device.ID)
+	if len(positions) != 1 {
+		t.Fatalf("Got %d positions, want 1", len(positions))
+	}
+	if score, ok := positions[0].Status["score"].(float64); !ok || score != 7 {
+		t.Errorf("Status = %v, want score 7 from the hook", positions[0].Status)
+	}
+
+	select {
+	case id := <-stored:
+		if id != positions[0].ID {
+			t.Errorf("Stored hook saw position %s, want %s", id, positions[0].ID)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("StageStored hook was not called")
+	}
+}
+
+func TestPositionHookRejectsPosition(t *testing.T) {
+	env := newTestEnv(t)
+	device := env.registerDevice(t, "0353413532881372", "gt06")
+
+	env.app.Hooks.RegisterPositionHook(hook.StageDecoded, func(ctx context.Context, p *model.Position) error {
+		return errors.New("outside service area")
+	})
+
+	// Rejected positions are still acknowledged so the device moves on
+	conn := env.dialDevice(t)
+	exchange(t, conn, gt06LoginFrame)
+	if response := exchange(t, conn, gt06LocationFrame); len(response) < 4 || response[0] != 0x78 {
+		t.Fatalf("Invalid GT06 location response: % x", response)
+	}
+
+	request := map[string]interface{}{"deviceId": device.ID, "latitude": 1.0, "longitude": 2.0}
+	if status := env.do(t, http.MethodPost, "/api/positions", request, nil); status != http.StatusInternalServerError {
+		t.Errorf("Rejected position returned status %d, want %d", status, http.StatusInternalServerError)
+	}
+
+	if positions := env.positions(t, device.ID); len(positions) != 0 {
+		t.Errorf("Got %d positions, want none stored", len(positions))
+	}
+}
+
+func TestGT06CommandOverTCP(t *testing.T) {
+	env := newTestEnv(t)
+	device := env.registerDevice(t, "0353413532881372", "gt06")
+
+	if err := env.app.TCPServer.SendCommand(device.ID, gt06.CommandEngineStop); err == nil {
+		t.Error("SendCommand() to a disconnected device succeeded")
+	}
+
+	events := make(chan *model.Event, 4)
+	env.app.Hooks.OnEvent(func(e *model.Event) {
+		if e.Type == model.EventCommandResult {
+			events <- e
+		}
+	})
+
+	conn := env.dialDevice(t)
+	exchange(t, conn, gt06LoginFrame)
+
+	if err := env.app.TCPServer.SendCommand(device.ID, gt06.CommandEngineStop); err != nil {
+		t.Fatalf("SendCommand() unexpected error: %v", err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	packet := make([]byte, 256)
+	n, err := conn.Read(packet)
+	if err != nil {
+		t.Fatalf("Failed to read command: %v", err)
+	}
+	packet = packet[:n]
+	if len(packet) < 17 || packet[3] != gt06.CommandMsg || !bytes.Contains(packet, []byte("RELAY,1#")) {
+		t.Fatalf("Invalid command packet: % x", packet)
+	}
+
+	if _, err := conn.Write(gt06ReplyFrame); err != nil {
+		t.Fatalf("Failed to send reply: %v", err)
+	}
+	select {
+	case event := <-events:
+		if event.DeviceID != device.ID || event.Attributes["result"] != "OK" {
+			t.Errorf("Command result event = %+v", event)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("No command result event")
+	}
+}
+
+func TestH02CommandOverTCP(t *testing.T) {
+	env := newTestEnv(t)
+	device := env.registerDevice(t, "4210051415", "h02")
+
+	events := make(chan *model.Event, 4)
+	env.app.Hooks.OnEvent(func(e *model.Event) {
+		if e.Type == model.EventCommandResult {
+			events <- e
+		}
+	})
+
+	conn := env.dialDevice(t)
+	exchange(t, conn, h02BinaryFrame)
+
+	readCommand := func() string {
+		t.Helper()
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		packet := make([]byte, 256)
+		n, err := conn.Read(packet)
+		if err != nil {
+			t.Fatalf("Failed to read command: %v", err)
+		}
+		return string(packet[:n])
+	}
+
+	if err := env.app.TCPServer.SendCommand(device.ID, gt06.CommandEngineStop); err != nil {
+		t.Fatalf("SendCommand() unexpected error: %v", err)
+	}
+	if command := readCommand(); !strings.HasPrefix(command, "*HQ,4210051415,S20,") || !strings.HasSuffix(command, ",1,1#") {
+		t.Fatalf("Invalid command: %s", command)
+	}
+
+	if err := env.app.TCPServer.SetReportInterval(device.ID, time.Minute); err != nil {
+		t.Fatalf("SetReportInterval() unexpected error: %v", err)
+	}
+	if command := readCommand(); !strings.HasPrefix(command, "*HQ,4210051415,S71,") || !strings.HasSuffix(command, ",22,60#") {
+		t.Fatalf("Invalid interval command: %s", command)
+	}
+
+	if _, err := conn.Write([]byte("*HQ,V4,4210051415,S20,130305,1,1#")); err != nil {
+		t.Fatalf("Failed to send reply: %v", err)
+	}
+	select {
+	case event := <-events:
+		if event.DeviceID != device.ID || event.Attributes["result"] != "S20,130305,1,1" {
+			t.Errorf("Command result event = %+v", event)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("No command result event")
+	}
+}
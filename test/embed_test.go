@@ -0,0 +1,149 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"tracking"
+	"tracking/internal/core/model"
+	"tracking/internal/core/util"
+)
+
+func TestEmbeddedServerHooks(t *testing.T) {
+	positions := make(chan *tracking.Position, 1)
+	events := make(chan *tracking.Event, 3)
+
+	server, err := tracking.New(
+		tracking.WithInMemoryStorage(),
+		tracking.WithTCPPort(0),
+		tracking.WithUDPPort(0),
+		tracking.WithHTTPAddr("127.0.0.1", "0"),
+		tracking.OnPosition(func(p *tracking.Position) { positions <- p }),
+		tracking.OnEvent(func(e *tracking.Event) { events <- e }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to build server: %v", err)
+	}
+	if err := server.Start(); err != nil {
+		t.Fatalf("Failed to start server: %v", err)
+	}
+	t.Cleanup(func() { server.Stop(context.Background()) })
+
+	device := tracking.NewDevice("Embedded", "0353413532881372", "gt06")
+	if err := server.RegisterDevice(device); err != nil {
+		t.Fatalf("Failed to register device: %v", err)
+	}
+
+	conn, err := net.Dial("tcp", server.TCPAddr().String())
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	exchange(t, conn, gt06LoginFrame)
+	exchange(t, conn, gt06LocationFrame)
+
+	select {
+	case position := <-positions:
+		if position.DeviceID != device.ID || position.Protocol != "gt06" {
+			t.Errorf("Hook position = %+v", position)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("OnPosition hook was not called")
+	}
+
+	conn.Close()
+	for _, want := range []string{tracking.EventDeviceCreated, tracking.EventDeviceOnline, tracking.EventDeviceOffline} {
+		select {
+		case event := <-events:
+			if event.Type != want || event.DeviceID != device.ID {
+				t.Errorf("Event = %s for %s, want %s for %s", event.Type, event.DeviceID, want, device.ID)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("No %s event", want)
+		}
+	}
+}
+
+// beaconDecoder decodes a line protocol of "BEACON,<id>" heartbeats and
+// "BEACON,<id>,<lat>,<lon>" fixes, each answered with "OK"
+type beaconDecoder struct {
+	clock util.Clock
+}
+
+func (d *beaconDecoder) EnableDebug(bool)              {}
+func (d *beaconDecoder) SetClock(clock tracking.Clock) { d.clock = clock }
+
+func (d *beaconDecoder) DecodePositions(deviceID string, data []byte) ([]*tracking.Position, []byte, error) {
+	fields := strings.Split(strings.TrimSpace(string(data)), ",")
+	if len(fields) < 4 {
+		return nil, []byte("OK"), nil
+	}
+	latitude, _ := strconv.ParseFloat(fields[2], 64)
+	longitude, _ := strconv.ParseFloat(fields[3], 64)
+	position := model.NewPosition(deviceID, latitude, longitude)
+	position.Timestamp = d.clock.Now()
+	position.Valid = true
+	position.Protocol = "beacon"
+	return []*tracking.Position{position}, []byte("OK"), nil
+}
+
+var registerBeacon sync.Once
+
+func TestEmbeddedRegisteredProtocol(t *testing.T) {
+	registerBeacon.Do(func() {
+		tracking.RegisterProtocol(&tracking.Protocol{
+			Name:    "beacon",
+			IsFrame: func(data []byte) bool { return bytes.HasPrefix(data, []byte("BEACON,")) },
+			DeviceID: func(data []byte) (string, error) {
+				return strings.Split(strings.TrimSpace(string(data)), ",")[1], nil
+			},
+			NewDecoder: func() tracking.ProtocolDecoder { return &beaconDecoder{clock: util.SystemClock} },
+		})
+	})
+
+	positions := make(chan *tracking.Position, 1)
+	server, err := tracking.New(
+		tracking.WithInMemoryStorage(),
+		tracking.WithTCPPort(0),
+		tracking.WithUDPPort(-1),
+		tracking.WithHTTPAddr("127.0.0.1", "0"),
+		tracking.OnPosition(func(p *tracking.Position) { positions <- p }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to build server: %v", err)
+	}
+	if err := server.Start(); err != nil {
+		t.Fatalf("Failed to start server: %v", err)
+	}
+	t.Cleanup(func() { server.Stop(context.Background()) })
+
+	device := tracking.NewDevice("Beacon", "B-1001", "beacon")
+	if err := server.RegisterDevice(device); err != nil {
+		t.Fatalf("Failed to register device: %v", err)
+	}
+	conn, err := net.Dial("tcp", server.TCPAddr().String())
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	if response := exchange(t, conn, []byte("BEACON,B-1001\n")); string(response) != "OK" {
+		t.Fatalf("Heartbeat response = %q", response)
+	}
+	if response := exchange(t, conn, []byte("BEACON,B-1001,48.8584,2.2945\n")); string(response) != "OK" {
+		t.Fatalf("Fix response = %q", response)
+	}
+	select {
+	case position := <-positions:
+		if position.DeviceID != device.ID || position.Protocol != "beacon" || position.Latitude != 48.8584 {
+			t.Errorf("Position = %+v", position)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("No position from the registered protocol")
+	}
+}
@@ -0,0 +1,100 @@
+package test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"testing"
+
+	"tracking/internal/app"
+	"tracking/internal/config"
+	"tracking/internal/core/encryption"
+	"tracking/internal/core/model"
+)
+
+func TestEncryptionAtRest(t *testing.T) {
+	older := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32))
+	newer := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{2}, 32))
+	repos := app.NewInMemoryRepositories()
+	withKeys := func(keys string) func(*config.Config) {
+		return func(cfg *config.Config) {
+			cfg.EncryptionKeys = keys
+			cfg.SMSAuthToken = smsAuthToken
+		}
+	}
+
+	env := newTestEnvWithRepositories(t, repos, withKeys("k1:"+older))
+	device := env.registerDevice(t, "0353413532881372", "gt06")
+	if status := env.do(t, http.MethodPut, "/api/devices/phone?id="+device.ID, map[string]string{"phone": "+1 (555) 010-0199"}, nil); status != http.StatusOK {
+		t.Fatalf("Setting the phone returned status %d", status)
+	}
+
+	// Storage holds neither the secret nor the phone number
+	stored, _ := repos.Devices.FindByID(device.ID)
+	if stored.ApiSecret != "" || strings.Contains(stored.Phone, "5550100199") || stored.Sealed["apiSecret"] == "" || stored.Sealed["phone"] == "" {
+		t.Fatalf("Stored device = %+v, want its secret and phone sealed", stored)
+	}
+	keys, _ := repos.DataKeys.FindAll()
+	for _, key := range keys {
+		if key.KeyID != "k1" || bytes.Contains(key.WrappedKey, []byte{1, 1, 1, 1}) {
+			t.Errorf("Data key = %+v, want it wrapped with k1", key)
+		}
+	}
+
+	// Everything reading through the application sees them as they were
+	opened, _ := env.deviceRepo.FindByID(device.ID)
+	if opened.ApiSecret != device.ApiSecret || opened.Phone != "+15550100199" || opened.Sealed != nil {
+		t.Fatalf("Read device = %+v, want its secret and phone", opened)
+	}
+	var listed model.Device
+	if status := env.do(t, http.MethodGet, "/api/devices/get?id="+device.ID, nil, &listed); status != http.StatusOK || listed.Phone != "+15550100199" {
+		t.Errorf("API returned status %d and phone %q", status, listed.Phone)
+	}
+	text := "Lat:N22.571285,Lon:E114.025630,Course:90.00,Speed:35.00km/h,DateTime:2024-01-15 09:58:00"
+	if status, _ := postSMS(t, env, smsAuthToken, "+15550100199", text); status != http.StatusOK {
+		t.Fatalf("SMS returned status %d", status)
+	}
+	if positions := env.positions(t, device.ID); len(positions) != 1 {
+		t.Fatalf("SMS stored %d positions, want 1 found by the sealed phone", len(positions))
+	}
+
+	// A device stored before encryption was enabled is read as it is
+	legacy := model.NewDevice("Legacy", "4210051415")
+	legacy.Phone = "+15550100200"
+	legacy.SetOwnership(testUserID, "")
+	repos.Devices.Create(legacy)
+	if found, _ := env.deviceRepo.FindByPhone("+15550100200"); found == nil || found.ID != legacy.ID {
+		t.Fatalf("Lookup of a plaintext phone found %+v", found)
+	}
+
+	// Rotating to a new master key rewraps the data keys and seals the
+	// plaintext device; only admins may rotate
+	rotated := newTestEnvWithRepositories(t, repos, withKeys("k2:"+newer+",k1:"+older))
+	member := rotated.memberToken(t, "member-1", "")
+	if status := rotated.doAs(t, member, "", http.MethodPost, "/api/admin/encryption/rotate", nil, nil); status != http.StatusForbidden {
+		t.Errorf("Rotation by a member returned status %d, want 403", status)
+	}
+	var rotation encryption.Rotation
+	if status := rotated.do(t, http.MethodPost, "/api/admin/encryption/rotate", nil, &rotation); status != http.StatusOK {
+		t.Fatalf("Rotation returned status %d", status)
+	}
+	if rotation.KeyID != "k2" || rotation.Rewrapped != len(keys) || rotation.Sealed != 1 {
+		t.Errorf("Rotation = %+v, want %d data keys rewrapped and 1 device sealed", rotation, len(keys))
+	}
+	if stored, _ := repos.Devices.FindByID(legacy.ID); stored.ApiSecret != "" || stored.Phone == legacy.Phone {
+		t.Errorf("Rotation left device %+v in plaintext", stored)
+	}
+
+	// The older master key can then be retired
+	retired := newTestEnvWithRepositories(t, repos, withKeys("k2:"+newer))
+	for _, expected := range []*model.Device{device, legacy} {
+		found, err := retired.deviceRepo.FindByUniqueID(expected.UniqueID)
+		if err != nil || found.ApiSecret != expected.ApiSecret {
+			t.Errorf("Device %s after rotation = %+v, %v", expected.UniqueID, found, err)
+		}
+	}
+	if found, _ := retired.deviceRepo.FindByPhone("+15550100200"); found == nil || found.ID != legacy.ID {
+		t.Errorf("Lookup of a sealed phone after rotation found %+v", found)
+	}
+}
@@ -0,0 +1,108 @@
+package test
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"tracking/internal/core/model"
+)
+
+func TestEventListing(t *testing.T) {
+	env := newTestEnv(t)
+	car := env.registerDevice(t, "0353413532881372", "gt06")
+	van := env.registerDevice(t, "0353413532881373", "gt06")
+	stranger := model.NewDevice("Someone else's", "0353413532889999")
+	stranger.SetOwnership("other-user", "")
+	if err := env.deviceRepo.Create(stranger); err != nil {
+		t.Fatalf("Failed to create device: %v", err)
+	}
+
+	raise := func(eventType, deviceID string, at time.Time) {
+		env.app.Hooks.Event(model.NewEvent(eventType, deviceID, at))
+	}
+	dayBefore := testStart.Add(-24 * time.Hour)
+	raise(model.EventOverspeed, car.ID, dayBefore)
+	raise(model.EventDeviceOnline, car.ID, dayBefore.Add(time.Minute))
+	raise(model.EventOverspeed, car.ID, testStart)
+	raise(model.EventOverspeed, van.ID, testStart) // Same instant, ordered by ID
+	raise(model.EventDeviceOffline, van.ID, testStart.Add(time.Minute))
+	raise(model.EventOverspeed, stranger.ID, testStart)
+
+	list := func(query url.Values) *model.EventPage {
+		t.Helper()
+		var page model.EventPage
+		if status := env.do(t, http.MethodGet, "/api/events?"+query.Encode(), nil, &page); status != http.StatusOK {
+			t.Fatalf("Listing events with %v returned status %d", query, status)
+		}
+		return &page
+	}
+
+	// Paging walks every event of the user's devices once, newest first
+	var listed []*model.Event
+	query := url.Values{"limit": {"2"}}
+	for pages := 0; ; pages++ {
+		if pages == 5 {
+			t.Fatal("Paging did not end")
+		}
+		page := list(query)
+		listed = append(listed, page.Events...)
+		if page.NextCursor == "" {
+			break
+		}
+		query.Set("cursor", page.NextCursor)
+	}
+	if len(listed) != 5 {
+		t.Fatalf("Listed %d events, want 5", len(listed))
+	}
+	for i, event := range listed {
+		if event.DeviceID == stranger.ID {
+			t.Errorf("Listed an event of another user's device")
+		}
+		if i > 0 && event.Timestamp.After(listed[i-1].Timestamp) {
+			t.Errorf("Event %d is newer than the one before", i)
+		}
+	}
+
+	// Filters combine
+	filtered := list(url.Values{
+		"deviceId": {car.ID},
+		"type":     {model.EventOverspeed + "," + model.EventDeviceOnline},
+		"from":     {dayBefore.Format(time.RFC3339)},
+		"to":       {testStart.Format(time.RFC3339)},
+	})
+	if len(filtered.Events) != 2 || filtered.Events[0].Type != model.EventDeviceOnline {
+		t.Errorf("Filtered events = %+v, want the car's events of the day before", filtered.Events)
+	}
+	if warnings := list(url.Values{"severity": {model.SeverityWarning}}); len(warnings.Events) != 4 {
+		t.Errorf("Got %d warnings, want 4", len(warnings.Events))
+	}
+
+	var counts []*model.EventCount
+	if status := env.do(t, http.MethodGet, "/api/events/counts?type="+model.EventOverspeed, nil, &counts); status != http.StatusOK {
+		t.Fatalf("Counting events returned status %d", status)
+	}
+	want := []model.EventCount{
+		{Day: "2024-01-14", Type: model.EventOverspeed, Count: 1},
+		{Day: "2024-01-15", Type: model.EventOverspeed, Count: 2},
+	}
+	if len(counts) != len(want) {
+		t.Fatalf("Counts = %+v, want %+v", counts, want)
+	}
+	for i := range want {
+		if *counts[i] != want[i] {
+			t.Errorf("Count %d = %+v, want %+v", i, *counts[i], want[i])
+		}
+	}
+
+	for _, query := range []string{"cursor=bogus", "from=yesterday", "limit=-1",
+		"from=" + testStart.Format(time.RFC3339) + "&to=" + dayBefore.Format(time.RFC3339)} {
+		if status := env.do(t, http.MethodGet, "/api/events?"+query, nil, nil); status != http.StatusBadRequest {
+			t.Errorf("Listing events with %s returned status %d, want %d", query, status, http.StatusBadRequest)
+		}
+	}
+	if status := env.do(t, http.MethodGet, "/api/events?deviceId="+stranger.ID, nil, nil); status != http.StatusForbidden {
+		t.Errorf("Listing another user's events returned status %d, want %d", status, http.StatusForbidden)
+	}
+}
@@ -0,0 +1,113 @@
+package test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"tracking/internal/config"
+	"tracking/internal/core/model"
+)
+
+func TestExternalIDs(t *testing.T) {
+	received := make(chan *model.Event, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event model.Event
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			t.Errorf("Failed to decode webhook body: %v", err)
+		}
+		received <- &event
+	}))
+	t.Cleanup(receiver.Close)
+
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.LifecycleEvents = true
+		cfg.LifecycleWebhookURLs = []string{receiver.URL}
+	})
+	next := func(want string) *model.Event {
+		t.Helper()
+		for {
+			select {
+			case event := <-received:
+				if event.Type == want {
+					return event
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("No %s webhook", want)
+				return nil
+			}
+		}
+	}
+
+	device := env.registerDevice(t, "0353413532881372", "gt06")
+	other := env.registerDevice(t, "4210051415", "h02")
+
+	ids := map[string]string{model.ExternalERPAsset: " A-1001 ", model.ExternalContract: "C-77", "fleetManager": ""}
+	var updated model.Device
+	if status := env.do(t, http.MethodPut, "/api/devices/external-ids?id="+device.ID, map[string]interface{}{"externalIds": ids}, &updated); status != http.StatusOK {
+		t.Fatalf("Setting external IDs returned status %d", status)
+	}
+	if len(updated.ExternalIDs) != 2 || updated.ExternalIDs[model.ExternalERPAsset] != "A-1001" || updated.ExternalIDs[model.ExternalContract] != "C-77" {
+		t.Fatalf("External IDs = %v, want the two trimmed", updated.ExternalIDs)
+	}
+
+	var found model.Device
+	if status := env.do(t, http.MethodGet, "/api/devices/by-external-id?system=erpAssetId&externalId=A-1001", nil, &found); status != http.StatusOK || found.ID != device.ID {
+		t.Fatalf("Lookup returned status %d and %+v, want %s", status, found, device.ID)
+	}
+	for _, query := range []string{"system=erpAssetId&externalId=A-1002", "system=contractNumber&externalId=A-1001"} {
+		if status := env.do(t, http.MethodGet, "/api/devices/by-external-id?"+query, nil, nil); status != http.StatusNotFound {
+			t.Errorf("Lookup of %s returned status %d, want 404", query, status)
+		}
+	}
+	// Other users cannot tell whether an ID is in use
+	member := env.memberToken(t, "member-1", "")
+	if status := env.doAs(t, member, "", http.MethodGet, "/api/devices/by-external-id?system=erpAssetId&externalId=A-1001", nil, nil); status != http.StatusNotFound {
+		t.Errorf("Lookup by another user returned status %d, want 404", status)
+	}
+
+	for _, invalid := range []map[string]string{
+		{model.ExternalERPAsset: "A-1001"}, // Held by the first device
+		{"erp.asset": "A-2002"},
+		{"$where": "A-2002"},
+	} {
+		if status := env.do(t, http.MethodPut, "/api/devices/external-ids?id="+other.ID, map[string]interface{}{"externalIds": invalid}, nil); status != http.StatusBadRequest {
+			t.Errorf("Setting %v returned status %d, want 400", invalid, status)
+		}
+	}
+
+	// Webhooks and exports carry the IDs, also once the device is gone
+	conn := env.dialDevice(t)
+	exchange(t, conn, gt06LoginFrame)
+	online := next(model.EventDeviceOnline)
+	if externalIDs, _ := online.Attributes[model.AttributeExternalIDs].(map[string]interface{}); externalIDs[model.ExternalERPAsset] != "A-1001" {
+		t.Errorf("Online event attributes = %v, want the external IDs", online.Attributes)
+	}
+	var bundle model.Bundle
+	if status := env.do(t, http.MethodGet, "/api/admin/export", nil, &bundle); status != http.StatusOK {
+		t.Fatalf("Export returned status %d", status)
+	}
+	for _, exported := range bundle.Devices {
+		if exported.ID == device.ID && exported.ExternalIDs[model.ExternalContract] != "C-77" {
+			t.Errorf("Exported external IDs = %v", exported.ExternalIDs)
+		}
+	}
+	if err := env.app.Services.Devices.DeleteDevice(device.ID); err != nil {
+		t.Fatalf("Failed to delete device: %v", err)
+	}
+	deleted := next(model.EventDeviceDeleted)
+	if externalIDs, _ := deleted.Attributes[model.AttributeExternalIDs].(map[string]interface{}); externalIDs[model.ExternalContract] != "C-77" {
+		t.Errorf("Deleted event attributes = %v, want the external IDs", deleted.Attributes)
+	}
+
+	// The deleted device freed its IDs, and an empty set clears them
+	if status := env.do(t, http.MethodPut, "/api/devices/external-ids?id="+other.ID, map[string]interface{}{"externalIds": map[string]string{model.ExternalERPAsset: "A-1001"}}, nil); status != http.StatusOK {
+		t.Errorf("Reusing a freed ID returned status %d", status)
+	}
+	var cleared model.Device
+	if status := env.do(t, http.MethodPut, "/api/devices/external-ids?id="+other.ID, map[string]interface{}{"externalIds": map[string]string{}}, &cleared); status != http.StatusOK || cleared.ExternalIDs != nil {
+		t.Errorf("Clearing returned status %d and %v", status, cleared.ExternalIDs)
+	}
+}
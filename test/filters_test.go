@@ -0,0 +1,93 @@
+package test
+
+import (
+	"net/http"
+	"testing"
+
+	"tracking/internal/core/model"
+)
+
+func TestDeviceTagsAndSavedFilters(t *testing.T) {
+	env := newTestEnv(t)
+	reefer := env.registerDevice(t, "0353413532881372", "gt06")
+	van := env.registerDevice(t, "0353413532881373", "gt06")
+	tracker := env.registerDevice(t, "4210051415", "h02")
+
+	tag := func(device *model.Device, tags ...string) *model.Device {
+		t.Helper()
+		var tagged model.Device
+		if status := env.do(t, http.MethodPut, "/api/devices/tags?id="+device.ID, map[string][]string{"tags": tags}, &tagged); status != http.StatusOK {
+			t.Fatalf("Tagging %s returned status %d", device.ID, status)
+		}
+		return &tagged
+	}
+	if tagged := tag(reefer, " North", "reefer", "north"); len(tagged.Tags) != 2 || tagged.Tags[0] != "north" || tagged.Tags[1] != "reefer" {
+		t.Fatalf("Tags %v, want [north reefer]", tagged.Tags)
+	}
+	tag(van, "north")
+	tag(tracker, "south", "reefer")
+
+	list := func(query string) []string {
+		t.Helper()
+		var devices []*model.Device
+		if status := env.do(t, http.MethodGet, "/api/devices/list?"+query, nil, &devices); status != http.StatusOK {
+			t.Fatalf("Listing devices with %q returned status %d", query, status)
+		}
+		var ids []string
+		for _, device := range devices {
+			ids = append(ids, device.ID)
+		}
+		return ids
+	}
+	if ids := list("tags=north"); len(ids) != 2 {
+		t.Errorf("Listed %d devices tagged north, want 2", len(ids))
+	}
+	if ids := list("tags=North,reefer"); len(ids) != 1 || ids[0] != reefer.ID {
+		t.Errorf("Listed %v for north and reefer, want only %s", ids, reefer.ID)
+	}
+
+	// A saved filter names the slice, and parameters narrow it further
+	var saved model.SavedFilter
+	filter := map[string]interface{}{"name": "Reefers", "filter": map[string]interface{}{"tags": []string{"Reefer"}}}
+	if status := env.do(t, http.MethodPost, "/api/filters", filter, &saved); status != http.StatusOK {
+		t.Fatalf("Saving filter returned status %d", status)
+	}
+	if status := env.do(t, http.MethodPost, "/api/filters", filter, nil); status != http.StatusBadRequest {
+		t.Errorf("Saving a second filter of the same name returned status %d, want 400", status)
+	}
+	if ids := list("filter=" + saved.ID); len(ids) != 2 {
+		t.Errorf("Listed %d devices with the saved filter, want 2", len(ids))
+	}
+	if ids := list("filter=" + saved.ID + "&protocol=h02"); len(ids) != 1 || ids[0] != tracker.ID {
+		t.Errorf("Listed %v with the saved filter and protocol, want only %s", ids, tracker.ID)
+	}
+
+	// Reports take the same filters
+	env.app.Hooks.Event(model.NewEvent(model.EventOverspeed, reefer.ID, testStart))
+	env.app.Hooks.Event(model.NewEvent(model.EventOverspeed, van.ID, testStart))
+	var page model.EventPage
+	if status := env.do(t, http.MethodGet, "/api/events?filter="+saved.ID, nil, &page); status != http.StatusOK {
+		t.Fatalf("Listing events with the saved filter returned status %d", status)
+	}
+	if len(page.Events) != 1 || page.Events[0].DeviceID != reefer.ID {
+		t.Errorf("Listed %d events with the saved filter, want only the reefer's", len(page.Events))
+	}
+
+	// Filters are private to the user who saved them
+	other := env.memberToken(t, "other-user", "")
+	if status := env.doAs(t, other, "", http.MethodGet, "/api/devices/list?filter="+saved.ID, nil, nil); status != http.StatusNotFound {
+		t.Errorf("Another user's filter returned status %d, want 404", status)
+	}
+
+	var filters []*model.SavedFilter
+	env.do(t, http.MethodGet, "/api/filters", nil, &filters)
+	if len(filters) != 1 || filters[0].Filter.Tags[0] != "reefer" {
+		t.Fatalf("Saved filters %v, want the reefer filter with its tag normalized", filters)
+	}
+	if status := env.do(t, http.MethodPost, "/api/filters/delete?id="+saved.ID, nil, nil); status != http.StatusOK {
+		t.Fatalf("Deleting filter returned status %d", status)
+	}
+	if status := env.do(t, http.MethodGet, "/api/devices/list?filter="+saved.ID, nil, nil); status != http.StatusNotFound {
+		t.Errorf("Deleted filter returned status %d, want 404", status)
+	}
+}
@@ -0,0 +1,120 @@
+package test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net/http"
+	"testing"
+	"time"
+
+	"tracking/internal/config"
+	"tracking/internal/core/model"
+)
+
+// codec8FuelRecord builds a Teltonika AVL record reporting the raw level of
+// an LLS fuel probe
+func codec8FuelRecord(timestamp time.Time, speed, lls uint16) []byte {
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.BigEndian, uint64(timestamp.UnixMilli()))
+	buf.WriteByte(0) // Priority
+	binary.Write(buf, binary.BigEndian, int32(25.2797*1e7))
+	binary.Write(buf, binary.BigEndian, int32(54.6872*1e7))
+	binary.Write(buf, binary.BigEndian, int16(80))  // Altitude
+	binary.Write(buf, binary.BigEndian, uint16(45)) // Angle
+	buf.WriteByte(7)                                // Satellites
+	binary.Write(buf, binary.BigEndian, speed)
+	buf.Write([]byte{0, 1, 0, 1, 201}) // One element, a 2 byte LLS 1 level
+	binary.Write(buf, binary.BigEndian, lls)
+	buf.Write([]byte{0, 0})
+	return buf.Bytes()
+}
+
+func TestFuelMonitoring(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.FuelDropThreshold = 10
+	})
+	events := make(chan *model.Event, 10)
+	env.app.Hooks.OnEvent(func(event *model.Event) {
+		if event.Type == model.EventFuelDrop {
+			events <- event
+		}
+	})
+	device := env.registerDevice(t, "352093081452251", "teltonika")
+	conn := env.dialDevice(t)
+	exchange(t, conn, teltonikaIMEIFrame)
+
+	start := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	exchange(t, conn, codec8Packet(
+		codec8FuelRecord(start, 40, 3276),                    // 80%
+		codec8FuelRecord(start.Add(5*time.Minute), 40, 3235), // 79%, burnt on the road
+		codec8FuelRecord(start.Add(8*time.Minute), 0, 1638),  // 40%, drained while parked
+		codec8FuelRecord(start.Add(9*time.Minute), 0, 1640),  // 40%
+		codec8FuelRecord(start.Add(10*time.Minute), 50, 0),   // Empty while driving
+		codec8FuelRecord(start.Add(40*time.Minute), 0, 2048), // 50%, refuelled
+	))
+
+	positions := env.positions(t, device.ID)
+	if first := positionAt(positions, start); len(positions) != 6 || first == nil || first.Status["fuelLevel"] != 80.0 {
+		t.Fatalf("Stored %d positions, want 6 from 80%% fuel", len(positions))
+	}
+
+	var readings []*model.FuelReading
+	query := "/api/devices/fuel?deviceId=" + device.ID + "&from=2024-01-15T10:00:00Z&to=2024-01-15T11:00:00Z"
+	if status := env.do(t, http.MethodGet, query, nil, &readings); status != http.StatusOK {
+		t.Fatalf("Fuel series returned status %d", status)
+	}
+	want := []struct {
+		minutes int
+		level   float64
+	}{{0, 80}, {5, 79}, {8, 40}, {9, 40}, {10, 0}, {40, 50}}
+	if len(readings) != len(want) {
+		t.Fatalf("Got %d readings, want %d", len(readings), len(want))
+	}
+	for i, reading := range readings {
+		at := start.Add(time.Duration(want[i].minutes) * time.Minute)
+		if reading.Level != want[i].level || !reading.Timestamp.Equal(at) || reading.PositionID != positionAt(positions, at).ID {
+			t.Errorf("Reading %d = %+v, want %v%% at %v", i, reading, want[i].level, at)
+		}
+	}
+
+	// The drain while parked and the sensor falling to empty are raised;
+	// fuel burnt and the refuel are not
+	for _, expected := range []struct {
+		cause         string
+		level, drop   float64
+		previousLevel float64
+	}{
+		{model.FuelDropTheft, 40, 39, 79},
+		{model.FuelDropSensorFault, 0, 40, 40},
+	} {
+		select {
+		case event := <-events:
+			if event.Attributes["cause"] != expected.cause || event.Attributes["fuelLevel"] != expected.level ||
+				event.Attributes["drop"] != expected.drop || event.Attributes["previousLevel"] != expected.previousLevel {
+				t.Errorf("Event attributes = %v, want a %s drop to %v%%", event.Attributes, expected.cause, expected.level)
+			}
+			if event.Severity != model.SeverityCritical || event.PositionID == "" {
+				t.Errorf("Event = %+v, want a critical event of the position", event)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("No %s event", expected.cause)
+		}
+	}
+	if len(events) > 0 {
+		t.Errorf("Raised %d more fuel drop events", len(events))
+	}
+
+	// The series is the device owner's, over a bounded range
+	member := env.memberToken(t, "member-1", "")
+	if status := env.doAs(t, member, "", http.MethodGet, query, nil, nil); status != http.StatusNotFound {
+		t.Errorf("Series for another user returned status %d, want 404", status)
+	}
+	for _, invalid := range []string{
+		"&from=2024-01-15T11:00:00Z&to=2024-01-15T10:00:00Z",
+		"&from=2024-01-01T00:00:00Z&to=2024-03-01T00:00:00Z",
+	} {
+		if status := env.do(t, http.MethodGet, "/api/devices/fuel?deviceId="+device.ID+invalid, nil, nil); status != http.StatusBadRequest {
+			t.Errorf("Series %s returned status %d, want 400", invalid, status)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"tracking/internal/config"
+	"tracking/internal/core/gateway"
+	"tracking/internal/core/webhook"
+)
+
+func TestGatewayWebhook(t *testing.T) {
+	const secret = "gateway-secret"
+	batches := make(chan []*gateway.Message, 10)
+	var failing atomic.Bool
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get(webhook.SignatureHeader) != webhook.Sign([]byte(secret), body) || r.Header.Get(webhook.EventHeader) != gateway.EventPositions {
+			t.Errorf("Bad headers %v", r.Header)
+		}
+		var messages []*gateway.Message
+		if err := json.Unmarshal(body, &messages); err != nil {
+			t.Errorf("Failed to decode gateway body: %v", err)
+		}
+		batches <- messages
+	}))
+	t.Cleanup(receiver.Close)
+
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.GatewayURL = receiver.URL
+		cfg.GatewaySecret = secret
+	})
+
+	// The device was never registered, and is accepted all the same
+	conn := env.dialDevice(t)
+	exchange(t, conn, h02ACCFrame("120000", "2237.7514", true))
+	var messages []*gateway.Message
+	select {
+	case messages = <-batches:
+	case <-time.After(2 * time.Second):
+		t.Fatal("No positions forwarded")
+	}
+	if len(messages) != 1 || messages[0].UniqueID != "4210051415" || messages[0].Protocol != "h02" ||
+		!almostEqual(messages[0].Latitude, 22+37.7514/60, 1e-6) || messages[0].Status["acc"] != true {
+		t.Fatalf("Forwarded %s %+v, want the H02 fix of 4210051415", messages[0].UniqueID, messages[0].Position)
+	}
+
+	// Nothing but the latest position is kept, and the events that would
+	// be stored are not
+	if env.app.Repositories.Events != nil || env.app.Services.Events != nil {
+		t.Errorf("Gateway keeps events")
+	}
+	exchange(t, conn, h02ACCFrame("120100", "2237.8514", true))
+	<-batches
+	if positions, _ := env.positionRepo.FindByDeviceID(messages[0].DeviceID); len(positions) != 1 || !positions[0].Timestamp.Equal(messages[0].Timestamp.Add(time.Minute)) {
+		t.Errorf("Kept %+v, want the latest position only", positions)
+	}
+
+	// A position the sink does not take is not acknowledged, so the device
+	// sends it again
+	gt06 := env.dialDevice(t)
+	exchange(t, gt06, gt06LoginFrame)
+	for len(batches) > 0 {
+		<-batches
+	}
+	failing.Store(true)
+	expectNoResponse(t, gt06, gt06LocationFrame)
+	failing.Store(false)
+	if response := exchange(t, gt06, gt06LocationFrame); len(response) < 4 || response[3] != 0x12 {
+		t.Fatalf("Invalid GT06 location response: % x", response)
+	}
+	if messages := <-batches; len(messages) != 1 || messages[0].UniqueID != "0353413532881372" {
+		t.Errorf("Forwarded %+v, want the GT06 fix", messages)
+	}
+}
+
+func TestGatewayKafka(t *testing.T) {
+	type request struct {
+		path, contentType string
+		records           []struct {
+			Key   string           `json:"key"`
+			Value *gateway.Message `json:"value"`
+		}
+	}
+	requests := make(chan *request, 10)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := &request{path: r.URL.Path, contentType: r.Header.Get("Content-Type")}
+		var body struct {
+			Records []struct {
+				Key   string           `json:"key"`
+				Value *gateway.Message `json:"value"`
+			} `json:"records"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("Failed to decode records: %v", err)
+		}
+		req.records = body.Records
+		requests <- req
+	}))
+	t.Cleanup(proxy.Close)
+
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.GatewayURL = proxy.URL + "/"
+		cfg.GatewayKafkaTopic = "fleet.positions"
+	})
+	conn := env.dialDevice(t)
+	exchange(t, conn, h02ACCFrame("120000", "2237.7514", false))
+
+	select {
+	case req := <-requests:
+		if req.path != "/topics/fleet.positions" || req.contentType != gateway.KafkaContentType {
+			t.Errorf("Produced to %s as %s", req.path, req.contentType)
+		}
+		if len(req.records) != 1 || req.records[0].Key != "4210051415" || req.records[0].Value.UniqueID != "4210051415" {
+			t.Errorf("Records = %+v, want the fix keyed by device", req.records)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("No records produced")
+	}
+}
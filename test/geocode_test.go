@@ -0,0 +1,210 @@
+package test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"tracking/internal/config"
+	"tracking/internal/core/geocode"
+	"tracking/internal/core/model"
+)
+
+// newNominatimServer answers searches with two places, counting the
+// searches it answers and refusing those without the key
+func newNominatimServer(t *testing.T, key string) (*httptest.Server, *int32) {
+	t.Helper()
+
+	var searches int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("key") != key {
+			http.Error(w, "invalid key", http.StatusUnauthorized)
+			return
+		}
+		atomic.AddInt32(&searches, 1)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `[
+			{"display_name": "%s, Casablanca, Morocco", "lat": "33.5731", "lon": "-7.5898", "type": "street"},
+			{"display_name": "%s, Rabat, Morocco", "lat": "34.0209", "lon": "bad", "type": "street"}
+		]`, r.URL.Query().Get("q"), r.URL.Query().Get("q"))
+	}))
+	t.Cleanup(server.Close)
+	return server, &searches
+}
+
+func TestGeocodeSearch(t *testing.T) {
+	nominatim, searches := newNominatimServer(t, "secret-key")
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.GeocodeURL = nominatim.URL
+		cfg.GeocodeKey = "secret-key"
+		cfg.GeocodeDailyQuota = 2
+	})
+
+	var results []*geocode.Result
+	if status := env.do(t, http.MethodGet, "/api/geocode?q=Boulevard+Anfa", nil, &results); status != http.StatusOK {
+		t.Fatalf("Geocoding returned status %d", status)
+	}
+	// Places the provider gives no usable coordinates for are left out
+	if len(results) != 1 {
+		t.Fatalf("Got %d results, want 1", len(results))
+	}
+	if r := results[0]; r.Address != "Boulevard Anfa, Casablanca, Morocco" || r.Latitude != 33.5731 || r.Longitude != -7.5898 {
+		t.Errorf("Unexpected result %+v", r)
+	}
+
+	// The same search, however typed, is answered from the cache
+	env.do(t, http.MethodGet, "/api/geocode?q=boulevard++ANFA", nil, &results)
+	if n := atomic.LoadInt32(searches); n != 1 {
+		t.Errorf("Provider searched %d times, want 1", n)
+	}
+
+	if status := env.do(t, http.MethodGet, "/api/geocode?q=Place+Mohammed+V", nil, &results); status != http.StatusOK {
+		t.Fatalf("Second lookup returned status %d", status)
+	}
+	if status := env.do(t, http.MethodGet, "/api/geocode?q=Avenue+Hassan+II", nil, nil); status != http.StatusTooManyRequests {
+		t.Errorf("Lookup over the quota returned status %d, want 429", status)
+	}
+	// Cached searches still work once the quota is spent
+	if status := env.do(t, http.MethodGet, "/api/geocode?q=Boulevard+Anfa", nil, &results); status != http.StatusOK {
+		t.Errorf("Cached search over the quota returned status %d", status)
+	}
+	if status := env.do(t, http.MethodGet, "/api/geocode?q=+", nil, nil); status != http.StatusBadRequest {
+		t.Errorf("Empty search returned status %d, want 400", status)
+	}
+}
+
+// newReverseServer answers reverse lookups in Nominatim's format, with an
+// address in the northern hemisphere and none in the southern one
+func newReverseServer(t *testing.T) (*httptest.Server, *int32) {
+	t.Helper()
+
+	var lookups int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&lookups, 1)
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path != "/reverse" || r.URL.Query().Get("format") != "jsonv2" {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		if strings.HasPrefix(r.URL.Query().Get("lat"), "-") {
+			fmt.Fprint(w, `{"error": "Unable to geocode"}`)
+			return
+		}
+		fmt.Fprintf(w, `{"display_name": "Shennan Road near %s,%s, Shenzhen, China"}`, r.URL.Query().Get("lat")[:5], r.URL.Query().Get("lon")[:6])
+	}))
+	t.Cleanup(server.Close)
+	return server, &lookups
+}
+
+func TestReverseGeocoding(t *testing.T) {
+	provider, lookups := newReverseServer(t)
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.ReverseGeocoder = "nominatim"
+		cfg.ReverseGeocodeURL = provider.URL + "/reverse"
+		cfg.ReverseGeocodeRate = 100
+	})
+	device := env.registerDevice(t, "4210051415", "h02")
+	conn := env.dialDevice(t)
+
+	// Positions are stored first and given their address in the background
+	exchange(t, conn, h02SpeedFrame("120000", "2237.7514", 10, 90))
+	const want = "Shennan Road near 22.62,114.14, Shenzhen, China"
+	waitForAddresses := func(n int) []*model.Position {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for {
+			positions := env.positions(t, device.ID)
+			addressed := 0
+			for _, position := range positions {
+				if position.Address != "" {
+					addressed++
+				}
+			}
+			if addressed >= n {
+				return positions
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("%d of %d positions have an address, want %d", addressed, len(positions), n)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	if positions := waitForAddresses(1); positions[0].Address != want {
+		t.Errorf("Address = %q, want %q", positions[0].Address, want)
+	}
+
+	// A position a few metres away is answered from the cache
+	exchange(t, conn, h02SpeedFrame("120100", "2237.7515", 10, 90))
+	for _, position := range waitForAddresses(2) {
+		if position.Address != want {
+			t.Errorf("Address of position at %v = %q, want %q", position.Timestamp, position.Address, want)
+		}
+	}
+	if n := atomic.LoadInt32(lookups); n != 1 {
+		t.Errorf("Provider looked up %d addresses, want 1", n)
+	}
+
+	// Clients look up addresses through the server too, and share the cache
+	var result geocode.Result
+	point := map[string]float64{"latitude": 22.62919, "longitude": 114.14369}
+	if status := env.do(t, http.MethodPost, "/api/geocode/reverse", point, &result); status != http.StatusOK {
+		t.Fatalf("Reverse geocoding returned status %d", status)
+	}
+	if result.Address != want || result.Latitude != 22.62919 || result.Longitude != 114.14369 {
+		t.Errorf("Unexpected result %+v", result)
+	}
+	if n := atomic.LoadInt32(lookups); n != 1 {
+		t.Errorf("Provider looked up %d addresses, want 1", n)
+	}
+
+	// A place without an address is not an error, and is cached as well
+	for i := 0; i < 2; i++ {
+		result = geocode.Result{Address: "unset"}
+		point := map[string]float64{"latitude": -33.9, "longitude": 18.4}
+		if status := env.do(t, http.MethodPost, "/api/geocode/reverse", point, &result); status != http.StatusOK || result.Address != "" {
+			t.Errorf("Reverse geocoding a place without an address returned status %d and %+v", status, result)
+		}
+	}
+	if n := atomic.LoadInt32(lookups); n != 2 {
+		t.Errorf("Provider looked up %d addresses, want 2", n)
+	}
+
+	for _, invalid := range []interface{}{
+		map[string]float64{"latitude": 91, "longitude": 0},
+		map[string]float64{"latitude": 10},
+	} {
+		if status := env.do(t, http.MethodPost, "/api/geocode/reverse", invalid, nil); status != http.StatusBadRequest {
+			t.Errorf("Reverse geocoding %v returned status %d, want 400", invalid, status)
+		}
+	}
+}
+
+func TestReverseGeocodingRateLimit(t *testing.T) {
+	provider, lookups := newReverseServer(t)
+	// One lookup every ten seconds, longer than a client is kept waiting
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.ReverseGeocoder = "nominatim"
+		cfg.ReverseGeocodeURL = provider.URL + "/reverse"
+		cfg.ReverseGeocodeRate = 0.1
+	})
+
+	first := map[string]float64{"latitude": 22.62919, "longitude": 114.14369}
+	if status := env.do(t, http.MethodPost, "/api/geocode/reverse", first, nil); status != http.StatusOK {
+		t.Fatalf("Reverse geocoding returned status %d", status)
+	}
+	second := map[string]float64{"latitude": 22.54, "longitude": 114.05}
+	if status := env.do(t, http.MethodPost, "/api/geocode/reverse", second, nil); status != http.StatusTooManyRequests {
+		t.Errorf("Lookup over the rate limit returned status %d, want 429", status)
+	}
+	// Cached addresses are not held back
+	if status := env.do(t, http.MethodPost, "/api/geocode/reverse", first, nil); status != http.StatusOK {
+		t.Errorf("Cached lookup returned status %d", status)
+	}
+	if n := atomic.LoadInt32(lookups); n != 1 {
+		t.Errorf("Provider looked up %d addresses, want 1", n)
+	}
+}
@@ -0,0 +1,105 @@
+package test
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"tracking/internal/core/model"
+	"tracking/internal/core/service"
+)
+
+func TestGeofenceTransitions(t *testing.T) {
+	env := newTestEnv(t)
+	truck := env.registerDevice(t, "4210051415", "h02")
+
+	for _, invalid := range []model.Geofence{
+		{Name: "No radius", Type: model.GeofenceCircle, Latitude: 22.64, Longitude: 114.14369},
+		{Name: "Line", Type: model.GeofencePolygon, Points: []model.GeoPoint{{Latitude: 22.6, Longitude: 114.1}, {Latitude: 22.7, Longitude: 114.2}}},
+		{Name: "Blob", Type: "blob"},
+		{Type: model.GeofenceCircle, Latitude: 22.64, Longitude: 114.14369, Radius: 500},
+	} {
+		if status := env.do(t, http.MethodPost, "/api/geofences", invalid, nil); status != http.StatusBadRequest {
+			t.Errorf("Creating %+v returned status %d, want 400", invalid, status)
+		}
+	}
+
+	// A depot around 22.64 N, 1.2 km north of where the truck starts, and
+	// a yard around the start that is deleted before the truck moves
+	var depot, yard model.Geofence
+	if status := env.do(t, http.MethodPost, "/api/geofences", model.Geofence{
+		Name: "Depot", Type: model.GeofenceCircle, Latitude: 22.64, Longitude: 114.14369, Radius: 500,
+	}, &depot); status != http.StatusOK {
+		t.Fatalf("Creating the depot returned status %d", status)
+	}
+	if status := env.do(t, http.MethodPost, "/api/geofences", model.Geofence{
+		Name: "Yard", Type: model.GeofencePolygon, Points: []model.GeoPoint{
+			{Latitude: 22.62, Longitude: 114.13}, {Latitude: 22.62, Longitude: 114.16},
+			{Latitude: 22.635, Longitude: 114.16}, {Latitude: 22.635, Longitude: 114.13},
+		},
+	}, &yard); status != http.StatusOK {
+		t.Fatalf("Creating the yard returned status %d", status)
+	}
+	depot.Name = "North depot"
+	if status := env.do(t, http.MethodPut, "/api/geofences?id="+depot.ID, depot, &depot); status != http.StatusOK || depot.Name != "North depot" {
+		t.Fatalf("Renaming the depot returned status %d, name %q", status, depot.Name)
+	}
+	var fences []*model.Geofence
+	if env.do(t, http.MethodGet, "/api/geofences", nil, &fences); len(fences) != 2 || fences[0].Name != "North depot" {
+		t.Fatalf("Geofences = %+v", fences)
+	}
+
+	conn := env.dialDevice(t)
+	exchange(t, conn, h02SpeedFrame("120000", "2237.7514", 20, 0)) // In the yard
+	if status := env.do(t, http.MethodPost, "/api/geofences/delete?id="+yard.ID, nil, nil); status != http.StatusOK {
+		t.Fatalf("Deleting the yard returned status %d", status)
+	}
+	if status := env.do(t, http.MethodPost, "/api/geofences/delete?id="+yard.ID, nil, nil); status != http.StatusNotFound {
+		t.Errorf("Deleting the yard again returned status %d, want 404", status)
+	}
+	exchange(t, conn, h02SpeedFrame("121000", "2238.4000", 20, 0)) // In the depot
+	exchange(t, conn, h02SpeedFrame("121500", "2238.4100", 20, 0)) // Still in it
+	exchange(t, conn, h02SpeedFrame("122000", "2237.7514", 20, 0)) // Out again
+
+	var page model.EventPage
+	query := url.Values{"deviceId": {truck.ID}, "type": {model.EventGeofenceEnter + "," + model.EventGeofenceExit}}
+	if status := env.do(t, http.MethodGet, "/api/events?"+query.Encode(), nil, &page); status != http.StatusOK {
+		t.Fatalf("Listing events returned status %d", status)
+	}
+	// Newest first: leaving the depot, entering it, entering the yard;
+	// leaving the deleted yard raises nothing
+	want := []string{model.EventGeofenceExit, model.EventGeofenceEnter, model.EventGeofenceEnter}
+	if len(page.Events) != len(want) {
+		t.Fatalf("Got %d geofence events, want %d: %+v", len(page.Events), len(want), page.Events)
+	}
+	for i, event := range page.Events {
+		fence := depot
+		if i == 2 {
+			fence = yard
+		}
+		if event.Type != want[i] || event.Attributes["geofenceId"] != fence.ID || event.PositionID == "" {
+			t.Errorf("Event %d = %s %v, want %s of %s", i, event.Type, event.Attributes, want[i], fence.Name)
+		}
+	}
+
+	depotFix := time.Date(2022, 10, 15, 12, 15, 0, 0, time.UTC)
+	found := false
+	for _, position := range env.positions(t, truck.ID) {
+		if !position.Timestamp.Equal(depotFix) {
+			continue
+		}
+		found = true
+		if ids, _ := position.Status[service.AttributeGeofenceIDs].([]interface{}); len(ids) != 1 || ids[0] != depot.ID {
+			t.Errorf("Position in the depot lies in %v", position.Status[service.AttributeGeofenceIDs])
+		}
+	}
+	if !found {
+		t.Errorf("No position stored at %s", depotFix)
+	}
+
+	// Fences of other users are out of reach
+	if status := env.doAs(t, env.memberToken(t, "other-user", ""), "", http.MethodPut, "/api/geofences?id="+depot.ID, depot, nil); status != http.StatusNotFound {
+		t.Errorf("Another user updating the depot got status %d, want 404", status)
+	}
+}
@@ -0,0 +1,165 @@
+package test
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"tracking/internal/app"
+	"tracking/internal/config"
+	"tracking/internal/core/model"
+	"tracking/internal/core/repository"
+)
+
+func withEventSourcing(cfg *config.Config) {
+	cfg.EventSourcing = true
+}
+
+func (e *testEnv) fleetAt(t *testing.T, at time.Time) map[string]*model.FleetDevice {
+	t.Helper()
+
+	var fleet []*model.FleetDevice
+	if status := e.do(t, http.MethodGet, "/api/devices/fleet?at="+at.Format(time.RFC3339), nil, &fleet); status != http.StatusOK {
+		t.Fatalf("Fleet at %s returned status %d", at, status)
+	}
+	devices := make(map[string]*model.FleetDevice, len(fleet))
+	for _, device := range fleet {
+		devices[device.DeviceID] = device
+	}
+	return devices
+}
+
+func TestDeviceHistoryReconstructsFleet(t *testing.T) {
+	env := newTestEnv(t, withEventSourcing)
+
+	var created model.Device
+	if status := env.do(t, http.MethodPost, "/api/devices", map[string]string{"name": "Van 1", "uniqueId": "862104025318764"}, &created); status != http.StatusOK {
+		t.Fatalf("Creating device returned status %d", status)
+	}
+	other := env.registerDevice(t, "123456789012345", "h02")
+	afterCreate := env.clock.Now()
+
+	env.clock.Advance(time.Minute)
+	if status := env.do(t, http.MethodPut, "/api/devices/speed-limit?id="+created.ID, map[string]float64{"speedLimit": 90}, nil); status != http.StatusOK {
+		t.Fatalf("Setting speed limit returned status %d", status)
+	}
+	if _, status := env.assignModel(t, created.ID, "gt06n"); status != http.StatusOK {
+		t.Fatalf("Assigning model returned status %d", status)
+	}
+	afterConfigure := env.clock.Now()
+
+	// A position only moves bookkeeping fields, which are not recorded
+	env.clock.Advance(time.Minute)
+	conn := env.dialDevice(t)
+	if response := exchange(t, conn, h02Frame); string(response) != "*HQ,OK#" {
+		t.Fatalf("Unexpected H02 response %q", response)
+	}
+	env.positions(t, other.ID)
+
+	env.clock.Advance(time.Minute)
+	if err := env.app.Repositories.Devices.Delete(other.ID); err != nil {
+		t.Fatalf("Failed to delete device: %v", err)
+	}
+
+	var events []*model.DeviceEvent
+	if status := env.do(t, http.MethodGet, "/api/devices/history?deviceId="+created.ID, nil, &events); status != http.StatusOK {
+		t.Fatalf("Device history returned status %d", status)
+	}
+	if len(events) != 3 {
+		t.Fatalf("History = %+v, want created and two updates", events)
+	}
+	if events[0].Type != model.DeviceCreated || events[0].Sequence != 1 {
+		t.Errorf("First event = %+v, want deviceCreated with sequence 1", events[0])
+	}
+	if e := events[1]; e.Type != model.DeviceUpdated || len(e.Changes) != 1 || e.Changes[0] != "speedLimit" || e.State.SpeedLimit != 90 {
+		t.Errorf("Second event = %+v, want the speed limit change", e)
+	}
+	if e := events[2]; len(e.Changes) != 2 || e.State.Model != "GT06N" || e.State.Protocol != "gt06" {
+		t.Errorf("Third event = %+v, want the model and protocol change", e)
+	}
+
+	// The stored position activated the device and nothing else
+	var otherEvents []*model.DeviceEvent
+	if status := env.do(t, http.MethodGet, "/api/devices/history?deviceId="+other.ID, nil, &otherEvents); status != http.StatusOK {
+		t.Fatalf("Deleted device history returned status %d", status)
+	}
+	if len(otherEvents) != 3 || otherEvents[1].Changes[0] != "status" || otherEvents[2].Type != model.DeviceDeleted {
+		t.Errorf("History = %+v, want created, activated and deleted", otherEvents)
+	}
+
+	fleet := env.fleetAt(t, afterCreate)
+	if len(fleet) != 2 || fleet[created.ID].SpeedLimit != 0 || fleet[created.ID].Model != "" {
+		t.Errorf("Fleet after creation = %+v, want both devices unconfigured", fleet)
+	}
+
+	fleet = env.fleetAt(t, afterConfigure)
+	if d := fleet[created.ID]; d == nil || d.SpeedLimit != 90 || d.Model != "GT06N" || !d.Since.Equal(afterConfigure) {
+		t.Errorf("Configured device = %+v, want speed limit 90 and model GT06N since %s", d, afterConfigure)
+	}
+	if d := fleet[other.ID]; d == nil || d.Status != "inactive" {
+		t.Errorf("Other device = %+v, want it still inactive", d)
+	}
+
+	fleet = env.fleetAt(t, env.clock.Now())
+	if len(fleet) != 1 || fleet[created.ID] == nil {
+		t.Errorf("Current fleet = %+v, want only %s", fleet, created.ID)
+	}
+
+	if fleet := env.fleetAt(t, testStart.Add(-time.Minute)); len(fleet) != 0 {
+		t.Errorf("Fleet before any device = %+v, want none", fleet)
+	}
+}
+
+func TestDeviceHistoryDisabledByDefault(t *testing.T) {
+	env := newTestEnv(t)
+
+	if status := env.do(t, http.MethodGet, "/api/devices/fleet?at="+testStart.Format(time.RFC3339), nil, nil); status != http.StatusNotFound {
+		t.Errorf("Fleet without event sourcing returned status %d, want %d", status, http.StatusNotFound)
+	}
+}
+
+// countingEvents counts the reads of the latest event of a device
+type countingEvents struct {
+	repository.DeviceEventRepository
+	latestReads atomic.Int32
+}
+
+func (c *countingEvents) FindLatest(deviceID string) (*model.DeviceEvent, error) {
+	c.latestReads.Add(1)
+	return c.DeviceEventRepository.FindLatest(deviceID)
+}
+
+func TestDeviceHistorySkipsBookkeeping(t *testing.T) {
+	repos := app.NewInMemoryRepositories()
+	events := &countingEvents{DeviceEventRepository: repos.DeviceEvents}
+	repos.DeviceEvents = events
+	env := newTestEnvWithRepositories(t, repos, withEventSourcing)
+	truck := env.registerDevice(t, "4210051415", "h02")
+
+	// The first position activates the device, which is recorded
+	conn := env.dialDevice(t)
+	exchange(t, conn, h02SpeedFrame("120000", "2237.7514", 10, 90))
+	env.positions(t, truck.ID)
+	reads := events.latestReads.Load()
+
+	// Later ones only move the last position, without reading the history
+	for i := 1; i <= 5; i++ {
+		exchange(t, conn, h02SpeedFrame(fmt.Sprintf("12%02d00", i), "2237.7514", 10, 90))
+	}
+	if positions := env.positions(t, truck.ID); len(positions) != 6 {
+		t.Fatalf("Stored %d positions, want 6", len(positions))
+	}
+	if got := events.latestReads.Load(); got != reads {
+		t.Errorf("History read %d times for bookkeeping updates, want none", got-reads)
+	}
+
+	var history []*model.DeviceEvent
+	if status := env.do(t, http.MethodGet, "/api/devices/history?deviceId="+truck.ID, nil, &history); status != http.StatusOK {
+		t.Fatalf("Device history returned status %d", status)
+	}
+	if len(history) != 2 || history[1].Changes[0] != "status" {
+		t.Errorf("History = %+v, want created and activated", history)
+	}
+}
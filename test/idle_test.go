@@ -0,0 +1,58 @@
+package test
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"tracking/internal/config"
+)
+
+func TestIdleConnectionsReaped(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) { cfg.TCPIdleTimeout = time.Minute })
+	env.registerDevice(t, "0353413532881372", "gt06")
+
+	conn := env.dialDevice(t)
+	exchange(t, conn, gt06LoginFrame)
+
+	env.clock.Advance(30 * time.Second)
+	if closed := env.app.TCPServer.ReapIdleConnections(); closed != 0 {
+		t.Fatalf("Reaped %d connections before the idle timeout", closed)
+	}
+	exchange(t, conn, gt06LocationFrame)
+
+	env.clock.Advance(45 * time.Second)
+	if closed := env.app.TCPServer.ReapIdleConnections(); closed != 0 {
+		t.Fatalf("Reaped %d connections that sent data recently", closed)
+	}
+
+	env.clock.Advance(time.Minute)
+	if closed := env.app.TCPServer.ReapIdleConnections(); closed != 1 {
+		t.Fatalf("Reaped %d connections, want 1", closed)
+	}
+	expectClosed(t, conn, 2*time.Second)
+}
+
+func TestIdleConnectionReadDeadline(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) { cfg.TCPIdleTimeout = 200 * time.Millisecond })
+
+	// A session that never identifies itself is closed as well
+	conn := env.dialDevice(t)
+	expectClosed(t, conn, 2*time.Second)
+}
+
+// expectClosed waits for the server to close the connection
+func expectClosed(t *testing.T, conn net.Conn, wait time.Duration) {
+	t.Helper()
+
+	conn.SetReadDeadline(time.Now().Add(wait))
+	buf := make([]byte, 64)
+	for {
+		if _, err := conn.Read(buf); err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				t.Fatal("Connection still open")
+			}
+			return
+		}
+	}
+}
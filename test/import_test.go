@@ -0,0 +1,136 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"tracking/internal/core/model"
+)
+
+// nmeaSentence appends the checksum and line end to a sentence
+func nmeaSentence(body string) string {
+	var sum byte
+	for i := 1; i < len(body); i++ {
+		sum ^= body[i]
+	}
+	return fmt.Sprintf("%s*%02X\r\n", body, sum)
+}
+
+// importTrack uploads a log file and returns its import job once finished
+func importTrack(t *testing.T, env *testEnv, deviceID, format string, data []byte) *model.Job {
+	t.Helper()
+
+	status, started := postTrack(t, env, deviceID, format, data)
+	if status != http.StatusAccepted {
+		t.Fatalf("Import returned status %d", status)
+	}
+	if started.Status != model.JobRunning || started.DeviceID != deviceID {
+		t.Errorf("Started job = %+v", started)
+	}
+
+	var job model.Job
+	for deadline := time.Now().Add(2 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		if status := env.do(t, http.MethodGet, "/api/jobs/get?id="+started.ID, nil, &job); status != http.StatusOK {
+			t.Fatalf("Job returned status %d", status)
+		}
+		if job.Done() {
+			return &job
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Job still %s: %+v", job.Status, job)
+		}
+	}
+}
+
+func postTrack(t *testing.T, env *testEnv, deviceID, format string, data []byte) (int, *model.Job) {
+	t.Helper()
+
+	path := "/api/devices/import?id=" + deviceID
+	if format != "" {
+		path += "&format=" + format
+	}
+	req, err := http.NewRequest(http.MethodPost, env.baseURL+path, bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Failed to build request: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+env.token)
+	req.Header.Set("Content-Type", "application/octet-stream")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Import request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var job model.Job
+	if resp.StatusCode == http.StatusAccepted {
+		if err := json.NewDecoder(resp.Body).Decode(&job); err != nil {
+			t.Fatalf("Failed to decode job: %v", err)
+		}
+	}
+	return resp.StatusCode, &job
+}
+
+func TestImportNMEALog(t *testing.T) {
+	env := newTestEnv(t)
+	device := env.registerDevice(t, "865328021234567", "nmea")
+
+	log := nmeaRMC + nmeaGGA + nmeaLoneRMC +
+		nmeaSentence("$GPRMC,093100.00,A,3345.2000,S,15112.6000,E,5.0,90.0,150124,,,A")
+	job := importTrack(t, env, device.ID, "", []byte(log))
+	if job.Status != model.JobCompleted || job.Total != 3 || job.Processed != 2 || job.Skipped != 1 {
+		t.Fatalf("Job = %+v, want 2 positions stored and the void fix skipped", job)
+	}
+
+	positions := env.positions(t, device.ID)
+	if len(positions) != 2 {
+		t.Fatalf("Got %d positions, want 2", len(positions))
+	}
+	for _, position := range positions {
+		if position.Status["source"] != "import" || position.Protocol != "nmea" {
+			t.Errorf("Position = %+v, want an imported NMEA fix", position)
+		}
+	}
+	updated, _ := env.deviceRepo.FindByID(device.ID)
+	if want := time.Date(2024, 1, 15, 9, 31, 0, 0, time.UTC); !updated.LastUpdate.Equal(want) {
+		t.Errorf("Device last update = %v, want the newest fix at %v", updated.LastUpdate, want)
+	}
+
+	// Importing the log again stores nothing twice
+	job = importTrack(t, env, device.ID, "nmea", []byte(log))
+	if job.Status != model.JobCompleted || job.Processed != 0 || job.Skipped != 3 {
+		t.Errorf("Repeated job = %+v, want everything skipped", job)
+	}
+}
+
+func TestImportTeltonikaDump(t *testing.T) {
+	env := newTestEnv(t)
+	device := env.registerDevice(t, "352093081452251", "teltonika")
+
+	// A dump opens with the IMEI and holds packets back to back
+	dump := append([]byte(nil), teltonikaIMEIFrame...)
+	dump = append(dump, codec8Packet(
+		codec8Record(testStart.Add(-3*time.Hour), 54.6801, 25.2701),
+		codec8Record(testStart.Add(-2*time.Hour), 54.6802, 25.2702),
+	)...)
+	dump = append(dump, codec8Packet(codec8Record(testStart.Add(-time.Hour), 54.6803, 25.2703))...)
+
+	job := importTrack(t, env, device.ID, "", dump)
+	if job.Status != model.JobCompleted || job.Total != 3 || job.Processed != 3 {
+		t.Fatalf("Job = %+v, want 3 positions stored", job)
+	}
+	if positions := env.positions(t, device.ID); len(positions) != 3 {
+		t.Fatalf("Got %d positions, want 3", len(positions))
+	}
+
+	// A truncated dump is refused before any job starts
+	if status, _ := postTrack(t, env, device.ID, "teltonika", dump[:len(dump)-3]); status != http.StatusBadRequest {
+		t.Errorf("Truncated dump returned status %d, want %d", status, http.StatusBadRequest)
+	}
+	if status, _ := postTrack(t, env, device.ID, "gpx", dump); status != http.StatusBadRequest {
+		t.Errorf("Unknown format returned status %d, want %d", status, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,85 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"tracking/internal/config"
+	"tracking/internal/core/hook"
+	"tracking/internal/core/model"
+)
+
+func TestIngestLatencySLA(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.IngestLatencySLA = 10 * time.Millisecond
+	})
+	events := make(chan *model.Event, 10)
+	env.app.Hooks.OnEvent(func(event *model.Event) {
+		if event.Type == model.EventIngestLatency {
+			events <- event
+		}
+	})
+	var delay atomic.Int64
+	env.app.Hooks.RegisterPositionHook(hook.StageDecoded, func(ctx context.Context, position *model.Position) error {
+		time.Sleep(time.Duration(delay.Load()))
+		return nil
+	})
+	device := env.registerDevice(t, "4210051415", "h02")
+	conn := env.dialDevice(t)
+	send := func(from, n int) {
+		t.Helper()
+		for i := from; i < from+n; i++ {
+			exchange(t, conn, h02SpeedFrame(fmt.Sprintf("12%02d00", i), "2237.7514", 10, 90))
+		}
+	}
+
+	// Too few positions to judge, and fast ones, raise nothing
+	send(0, 5)
+	env.app.Watchdog.Check()
+	delay.Store(int64(20 * time.Millisecond))
+	send(5, 10)
+	if positions := env.positions(t, device.ID); len(positions) != 15 {
+		t.Fatalf("Stored %d positions, want 15", len(positions))
+	}
+
+	_, status := getStatus(t, env)
+	latency := status.Ingest.Latency
+	if latency.Samples != 15 || latency.P95 < 20 || latency.P50 > latency.P95 || latency.P95 > latency.P99 {
+		t.Fatalf("Ingest latency = %+v, want 15 samples with p95 of 20ms or more", latency)
+	}
+
+	// A breach is raised once, as an event of no device
+	env.app.Watchdog.Check()
+	env.app.Watchdog.Check()
+	select {
+	case event := <-events:
+		if event.DeviceID != "" || event.Severity != model.SeverityWarning || event.Attributes["slaMs"] != float64(10) || event.Attributes["samples"] != 15 {
+			t.Errorf("Event = %+v, want a warning of the 10ms SLA over 15 samples", event)
+		}
+		if p95, _ := event.Attributes["p95Ms"].(float64); p95 < 20 {
+			t.Errorf("Event p95 = %vms, want 20ms or more", event.Attributes["p95Ms"])
+		}
+	case <-time.After(time.Second):
+		t.Fatal("No ingestLatency event")
+	}
+	if len(events) > 0 {
+		t.Errorf("Breach raised %d more events", len(events))
+	}
+
+	// Samples leave the window, and a new breach is raised again
+	env.clock.Advance(6 * time.Minute)
+	env.app.Watchdog.Check()
+	if _, status := getStatus(t, env); status.Ingest.Latency.Samples != 0 {
+		t.Errorf("Ingest latency = %+v, want no samples after five minutes", status.Ingest.Latency)
+	}
+	send(15, 10)
+	env.app.Watchdog.Check()
+	select {
+	case <-events:
+	case <-time.After(time.Second):
+		t.Error("No ingestLatency event for the second breach")
+	}
+}
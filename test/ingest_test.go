@@ -0,0 +1,187 @@
+package test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"tracking/internal/app"
+	"tracking/internal/config"
+	"tracking/internal/core/model"
+	"tracking/internal/core/repository"
+)
+
+// slowPositionRepository holds every write until released, like a
+// database under load
+type slowPositionRepository struct {
+	repository.PositionRepository
+	writing chan struct{} // Receives as each write starts
+	release chan struct{}
+}
+
+func (r *slowPositionRepository) CreateBatch(positions []*model.Position) error {
+	r.writing <- struct{}{}
+	<-r.release
+	return r.PositionRepository.CreateBatch(positions)
+}
+
+// batchRecordingRepository notes the size of every write
+type batchRecordingRepository struct {
+	repository.PositionRepository
+	mutex   sync.Mutex
+	batches []int
+}
+
+func (r *batchRecordingRepository) Create(position *model.Position) error {
+	return r.CreateBatch([]*model.Position{position})
+}
+
+func (r *batchRecordingRepository) CreateBatch(positions []*model.Position) error {
+	r.mutex.Lock()
+	r.batches = append(r.batches, len(positions))
+	r.mutex.Unlock()
+	return r.PositionRepository.CreateBatch(positions)
+}
+
+func TestTeltonikaRecordsStoredInOneBatch(t *testing.T) {
+	repos := app.NewInMemoryRepositories()
+	recording := &batchRecordingRepository{PositionRepository: repos.Positions}
+	repos.Positions = recording
+	env := newTestEnvWithRepositories(t, repos)
+	device := env.registerDevice(t, "352093081452251", "teltonika")
+	conn := env.dialDevice(t)
+	exchange(t, conn, teltonikaIMEIFrame)
+
+	var records [][]byte
+	for i := 0; i < 20; i++ {
+		records = append(records, codec8Record(testStart.Add(-time.Duration(i)*time.Minute), 54.68, 25.27))
+	}
+	if response := exchange(t, conn, codec8Packet(records...)); !bytes.Equal(response, []byte{0, 0, 0, 20}) {
+		t.Fatalf("ACK = % x, want 00 00 00 14", response)
+	}
+	if positions := env.positions(t, device.ID); len(positions) != 20 {
+		t.Fatalf("Got %d positions, want 20", len(positions))
+	}
+
+	recording.mutex.Lock()
+	defer recording.mutex.Unlock()
+	if len(recording.batches) != 1 || recording.batches[0] != 20 {
+		t.Errorf("Writes = %v, want one batch of 20", recording.batches)
+	}
+}
+
+func TestTeltonikaRecordsOverHTTPStoredInOneBatch(t *testing.T) {
+	repos := app.NewInMemoryRepositories()
+	recording := &batchRecordingRepository{PositionRepository: repos.Positions}
+	repos.Positions = recording
+	env := newTestEnvWithRepositories(t, repos)
+	device := env.registerDevice(t, "352093081452251", "teltonika")
+
+	var records [][]byte
+	for i := 0; i < 20; i++ {
+		records = append(records, codec8Record(testStart.Add(-time.Duration(i)*time.Minute), 54.68, 25.27))
+	}
+	request := map[string]string{
+		"deviceId": device.ID,
+		"rawData":  base64.StdEncoding.EncodeToString(codec8Packet(records...)),
+	}
+	if status := env.do(t, http.MethodPost, "/api/positions/raw", request, nil); status != http.StatusOK {
+		t.Fatalf("Raw data returned status %d", status)
+	}
+	if positions := env.positions(t, device.ID); len(positions) != 20 {
+		t.Fatalf("Got %d positions, want 20", len(positions))
+	}
+
+	recording.mutex.Lock()
+	defer recording.mutex.Unlock()
+	if len(recording.batches) != 1 || recording.batches[0] != 20 {
+		t.Errorf("Writes = %v, want one batch of 20", recording.batches)
+	}
+}
+
+func TestIngestWorkersAcknowledgeBeforeStoring(t *testing.T) {
+	repos := app.NewInMemoryRepositories()
+	slow := &slowPositionRepository{
+		PositionRepository: repos.Positions,
+		writing:            make(chan struct{}, 10),
+		release:            make(chan struct{}),
+	}
+	repos.Positions = slow
+	env := newTestEnvWithRepositories(t, repos, func(cfg *config.Config) {
+		cfg.IngestWorkers = 1
+		cfg.IngestQueueSize = 1
+		cfg.IngestBatchSize = 10
+	})
+	released := false
+	release := func() {
+		if !released {
+			released = true
+			close(slow.release)
+		}
+	}
+	t.Cleanup(release)
+
+	device := env.registerDevice(t, "352093081452251", "teltonika")
+	conn := env.dialDevice(t)
+	exchange(t, conn, teltonikaIMEIFrame)
+	frame := func(age time.Duration) []byte {
+		return codec8Packet(codec8Record(testStart.Add(-age), 54.68, 25.27))
+	}
+
+	// The first frame is acknowledged while its write is stuck
+	if response := exchange(t, conn, frame(3*time.Minute)); !bytes.Equal(response, []byte{0, 0, 0, 1}) {
+		t.Fatalf("ACK = % x, want 00 00 00 01", response)
+	}
+	select {
+	case <-slow.writing:
+	case <-time.After(2 * time.Second):
+		t.Fatal("The worker did not start writing")
+	}
+
+	// The next waits in the queue, and one more finds it full
+	if response := exchange(t, conn, frame(2*time.Minute)); !bytes.Equal(response, []byte{0, 0, 0, 1}) {
+		t.Fatalf("Queued frame ACK = % x, want 00 00 00 01", response)
+	}
+	if response := exchange(t, conn, frame(time.Minute)); !bytes.Equal(response, []byte{0, 0, 0, 0}) {
+		t.Fatalf("ACK with a full queue = % x, want 00 00 00 00", response)
+	}
+
+	release()
+	waitForPositions(t, env, device.ID, 2)
+
+	// The device resends what was refused
+	if response := exchange(t, conn, frame(time.Minute)); !bytes.Equal(response, []byte{0, 0, 0, 1}) {
+		t.Fatalf("Resent frame ACK = % x, want 00 00 00 01", response)
+	}
+	waitForPositions(t, env, device.ID, 3)
+
+	// The device moves to the newest position once its batch is stored
+	want := testStart.Add(-time.Minute)
+	for deadline := time.Now().Add(2 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		updated, _ := env.deviceRepo.FindByID(device.ID)
+		if updated.LastUpdate.Equal(want) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Device last update = %v, want the newest position at %v", updated.LastUpdate, want)
+		}
+	}
+}
+
+// waitForPositions waits for the ingest workers to store a device's positions
+func waitForPositions(t *testing.T, env *testEnv, deviceID string, want int) {
+	t.Helper()
+
+	for deadline := time.Now().Add(2 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		positions, _ := env.positionRepo.FindByDeviceID(deviceID)
+		if len(positions) == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Got %d positions, want %d", len(positions), want)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"tracking/internal/config"
+	"tracking/internal/core/model"
+	"tracking/internal/core/webhook"
+)
+
+func TestDeviceLifecycleWebhooks(t *testing.T) {
+	const secret = "lifecycle-secret"
+	received := make(chan *model.Event, 10)
+	var calls atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The first delivery fails and is retried
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get(webhook.SignatureHeader) != webhook.Sign([]byte(secret), body) {
+			t.Errorf("Bad signature %q", r.Header.Get(webhook.SignatureHeader))
+		}
+		var event model.Event
+		if err := json.Unmarshal(body, &event); err != nil {
+			t.Errorf("Failed to decode webhook body: %v", err)
+		}
+		if r.Header.Get(webhook.EventHeader) != event.Type {
+			t.Errorf("Event header %q for a %s event", r.Header.Get(webhook.EventHeader), event.Type)
+		}
+		received <- &event
+	}))
+	t.Cleanup(receiver.Close)
+
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.LifecycleEvents = true
+		cfg.LifecycleWebhookURLs = []string{receiver.URL}
+		cfg.LifecycleWebhookSecret = secret
+	})
+	next := func(want string) *model.Event {
+		t.Helper()
+		select {
+		case event := <-received:
+			if event.Type != want {
+				t.Fatalf("Got a %s webhook, want %s", event.Type, want)
+			}
+			return event
+		case <-time.After(5 * time.Second):
+			t.Fatalf("No %s webhook", want)
+		}
+		return nil
+	}
+
+	device := env.registerDevice(t, "0353413532881372", "gt06")
+	created := next(model.EventDeviceCreated)
+	if created.DeviceID != device.ID || created.Attributes["uniqueId"] != device.UniqueID || created.Attributes["userId"] != testUserID {
+		t.Errorf("Created event = %+v", created)
+	}
+
+	conn := env.dialDevice(t)
+	exchange(t, conn, gt06LoginFrame)
+	next(model.EventDeviceOnline)
+
+	// An update leaving the owner alone raises nothing; the next webhook
+	// is the transfer
+	if err := env.app.Services.Devices.UpdateDevice(device); err != nil {
+		t.Fatalf("Failed to update device: %v", err)
+	}
+	transferred := *device
+	transferred.SetOwnership(testUserID, "org-2")
+	if err := env.app.Services.Devices.UpdateDevice(&transferred); err != nil {
+		t.Fatalf("Failed to transfer device: %v", err)
+	}
+	event := next(model.EventDeviceTransferred)
+	if event.Attributes["previousOrganizationId"] != "" || event.Attributes["organizationId"] != "org-2" {
+		t.Errorf("Transferred event attributes = %v", event.Attributes)
+	}
+
+	conn.Close()
+	next(model.EventDeviceOffline)
+	if err := env.app.Services.Devices.DeleteDevice(device.ID); err != nil {
+		t.Fatalf("Failed to delete device: %v", err)
+	}
+	if deleted := next(model.EventDeviceDeleted); deleted.Attributes["name"] != device.Name {
+		t.Errorf("Deleted event = %+v", deleted)
+	}
+}
@@ -0,0 +1,63 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"tracking/internal/config"
+)
+
+func TestConnectionLimit(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) { cfg.TCPMaxConnections = 1 })
+	env.registerDevice(t, "0353413532881372", "gt06")
+
+	first := env.dialDevice(t)
+	exchange(t, first, gt06LoginFrame)
+	expectClosed(t, env.dialDevice(t), 2*time.Second)
+
+	// The slot frees once the first connection is gone
+	first.Close()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		conn := env.dialDevice(t)
+		conn.Write(gt06LoginFrame)
+		conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+		if _, err := conn.Read(make([]byte, 64)); err == nil {
+			conn.Close()
+			break
+		}
+		conn.Close()
+		if time.Now().After(deadline) {
+			t.Fatal("Connection refused after the first one closed")
+		}
+	}
+}
+
+func TestPerIPConnectionRate(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) { cfg.TCPConnectionsPerMinute = 2 })
+	env.registerDevice(t, "0353413532881372", "gt06")
+
+	for i := 0; i < 2; i++ {
+		exchange(t, env.dialDevice(t), gt06LoginFrame)
+	}
+	expectClosed(t, env.dialDevice(t), 2*time.Second)
+
+	// Half a minute earns one more connection
+	env.clock.Advance(30 * time.Second)
+	exchange(t, env.dialDevice(t), gt06LoginFrame)
+	expectClosed(t, env.dialDevice(t), 2*time.Second)
+}
+
+func TestPerIPPacketRate(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) { cfg.TCPPacketsPerMinute = 2 })
+	env.registerDevice(t, "0353413532881372", "gt06")
+
+	conn := env.dialDevice(t)
+	exchange(t, conn, gt06LoginFrame)
+	exchange(t, conn, gt06LocationFrame)
+
+	if _, err := conn.Write(gt06LocationFrame); err != nil {
+		t.Fatalf("Failed to send frame: %v", err)
+	}
+	expectClosed(t, conn, 2*time.Second)
+}
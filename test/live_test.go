@@ -0,0 +1,310 @@
+package test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"tracking/internal/core/model"
+)
+
+// liveStream is an open Server-Sent Events stream of live updates
+type liveStream struct {
+	updates chan *model.LiveUpdate
+}
+
+// openLiveStream follows devices with the token passed as a parameter, the
+// way browsers' EventSource must
+func (e *testEnv) openLiveStream(t *testing.T, token, query string) *liveStream {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, e.baseURL+"/api/positions/stream?token="+token+query, nil)
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to open stream: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		resp.Body.Close()
+		t.Fatalf("Stream returned status %d, %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	stream := &liveStream{updates: make(chan *model.LiveUpdate, 16)}
+	go func() {
+		defer resp.Body.Close()
+		var name string
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case strings.HasPrefix(line, "event: "):
+				name = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				var update model.LiveUpdate
+				if json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &update) == nil && update.Type == name {
+					stream.updates <- &update
+				}
+			}
+		}
+	}()
+	return stream
+}
+
+// nextPosition returns the next position streamed, skipping events
+func (s *liveStream) nextPosition(t *testing.T) *model.LiveUpdate {
+	t.Helper()
+
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case update := <-s.updates:
+			if update.Type == model.LivePosition {
+				return update
+			}
+		case <-timeout:
+			t.Fatal("No position streamed")
+		}
+	}
+}
+
+func TestLiveStream(t *testing.T) {
+	env := newTestEnv(t)
+	truck := env.registerDevice(t, "4210051415", "h02")
+
+	// The van belongs to a fleet the dispatcher works for
+	fleet := model.NewOrganization("Fleet", "Delivery vans")
+	if err := env.app.Repositories.Organizations.Create(fleet); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.app.Repositories.OrganizationMembers.Create(model.NewOrganizationMember(fleet.ID, "dispatcher", "member")); err != nil {
+		t.Fatal(err)
+	}
+	van := model.NewDevice("Van", "359586015829802")
+	van.Protocol = "coban"
+	van.SetOwnership("fleet-owner", fleet.ID)
+	if err := env.deviceRepo.Create(van); err != nil {
+		t.Fatal(err)
+	}
+	dispatcher := env.memberToken(t, "dispatcher", "")
+
+	for name, query := range map[string]string{
+		"another user's device":        "?deviceId=" + truck.ID,
+		"an organization of others":    "?organizationId=missing",
+		"a device and an organization": "?deviceId=" + van.ID + "&organizationId=" + fleet.ID,
+	} {
+		want := http.StatusNotFound
+		if strings.Contains(query, "&") {
+			want = http.StatusBadRequest
+		}
+		if status := env.doAs(t, dispatcher, "", http.MethodGet, "/api/positions/stream"+query, nil, nil); status != want {
+			t.Errorf("Following %s returned status %d, want %d", name, status, want)
+		}
+	}
+
+	everything := env.openLiveStream(t, env.token, "")
+	truckOnly := env.openLiveStream(t, env.token, "&deviceId="+truck.ID)
+	fleetOnly := env.openLiveStream(t, dispatcher, "&organizationId="+fleet.ID)
+
+	vanConn := env.dialDevice(t)
+	exchange(t, vanConn, cobanLoginFrame)
+	if _, err := vanConn.Write(cobanReportFrame); err != nil { // Reports are not answered
+		t.Fatalf("Failed to send the van's report: %v", err)
+	}
+	if update := fleetOnly.nextPosition(t); update.DeviceID != van.ID || update.Position.DeviceID != van.ID {
+		t.Errorf("Fleet stream got %+v, want the van", update)
+	}
+
+	truckConn := env.dialDevice(t)
+	exchange(t, truckConn, h02ACCFrame("120000", "2237.7514", true))
+	for name, stream := range map[string]*liveStream{"everything": everything, "truck": truckOnly} {
+		// The van is not the user's, so the truck comes first
+		update := stream.nextPosition(t)
+		if update.DeviceID != truck.ID || update.Position == nil || update.Position.Latitude == 0 {
+			t.Errorf("Stream of %s got %+v, want the truck's position", name, update)
+		}
+	}
+
+	// Events of the devices followed are streamed too
+	truckConn.Close()
+	timeout := time.After(2 * time.Second)
+	for offline := false; !offline; {
+		select {
+		case update := <-truckOnly.updates:
+			offline = update.Type == model.LiveEvent && update.Event.Type == model.EventDeviceOffline && update.DeviceID == truck.ID
+		case <-timeout:
+			t.Fatal("The truck going offline was not streamed")
+		}
+	}
+	select {
+	case update := <-fleetOnly.updates:
+		if update.DeviceID != van.ID {
+			t.Errorf("Fleet stream got %+v of another device", update)
+		}
+	default:
+	}
+}
+
+// liveSocket is a WebSocket client following devices
+type liveSocket struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// liveFrame is an update or a reply to the filters sent
+type liveFrame struct {
+	model.LiveUpdate
+	Filters []model.LiveFilter `json:"filters"`
+	Error   string             `json:"error"`
+}
+
+// openLiveSocket follows devices over a WebSocket, passing the token as a
+// parameter the way browsers must, and reads the reply to the upgrade
+func (e *testEnv) openLiveSocket(t *testing.T, token, query string) (*liveSocket, *liveFrame) {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", e.app.HTTPAddr().String())
+	if err != nil {
+		t.Fatalf("Failed to connect to HTTP server: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	fmt.Fprintf(conn, "GET /api/ws?token=%s%s HTTP/1.1\r\n"+
+		"Host: %s\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n",
+		token, query, e.app.HTTPAddr())
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatalf("Failed to read upgrade response: %v", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("Upgrade response = %d %v", resp.StatusCode, resp.Header)
+	}
+	socket := &liveSocket{conn: conn, reader: reader}
+	return socket, socket.next(t)
+}
+
+// next reads the next frame pushed
+func (s *liveSocket) next(t *testing.T) *liveFrame {
+	t.Helper()
+
+	payload := readTextFrame(t, s.conn, s.reader)
+	var frame liveFrame
+	if err := json.Unmarshal(payload, &frame); err != nil {
+		t.Fatalf("Invalid frame %s: %v", payload, err)
+	}
+	return &frame
+}
+
+// until reads frames up to the first matching
+func (s *liveSocket) until(t *testing.T, what string, match func(*liveFrame) bool) *liveFrame {
+	t.Helper()
+
+	for i := 0; i < 20; i++ {
+		if frame := s.next(t); match(frame) {
+			return frame
+		}
+	}
+	t.Fatalf("No %s pushed", what)
+	return nil
+}
+
+// send writes a masked text frame, as clients must
+func (s *liveSocket) send(t *testing.T, v interface{}) {
+	t.Helper()
+
+	payload, _ := json.Marshal(v)
+	if len(payload) >= 126 {
+		t.Fatalf("Frame of %d bytes too long for the test client", len(payload))
+	}
+	mask := []byte{0x1f, 0x2e, 0x3d, 0x4c}
+	frame := append([]byte{0x81, 0x80 | byte(len(payload))}, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	if _, err := s.conn.Write(frame); err != nil {
+		t.Fatalf("Failed to send frame: %v", err)
+	}
+}
+
+func TestLiveSocket(t *testing.T) {
+	env := newTestEnv(t)
+	truck := env.registerDevice(t, "4210051415", "h02")
+
+	fleet := model.NewOrganization("Fleet", "Delivery vans")
+	if err := env.app.Repositories.Organizations.Create(fleet); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.app.Repositories.OrganizationMembers.Create(model.NewOrganizationMember(fleet.ID, "dispatcher", "member")); err != nil {
+		t.Fatal(err)
+	}
+	van := model.NewDevice("Van", "359586015829802")
+	van.Protocol = "coban"
+	van.SetOwnership("fleet-owner", fleet.ID)
+	if err := env.deviceRepo.Create(van); err != nil {
+		t.Fatal(err)
+	}
+	dispatcher := env.memberToken(t, "dispatcher", "")
+
+	// Devices of others are refused before the upgrade
+	if status := env.doAs(t, dispatcher, "", http.MethodGet, "/api/ws?deviceId="+truck.ID, nil, nil); status != http.StatusNotFound {
+		t.Errorf("Following another user's device returned status %d, want 404", status)
+	}
+
+	truckOnly, reply := env.openLiveSocket(t, env.token, "&deviceId="+truck.ID)
+	if reply.Type != "subscribed" || len(reply.Filters) != 1 || reply.Filters[0].DeviceID != truck.ID {
+		t.Fatalf("Upgrade reply = %+v, want the truck followed", reply)
+	}
+	everything, reply := env.openLiveSocket(t, dispatcher, "")
+	if reply.Type != "subscribed" || len(reply.Filters) != 0 {
+		t.Fatalf("Upgrade reply = %+v, want every device followed", reply)
+	}
+
+	// The van coming online and reporting reaches the dispatcher
+	vanConn := env.dialDevice(t)
+	exchange(t, vanConn, cobanLoginFrame)
+	if _, err := vanConn.Write(cobanReportFrame); err != nil { // Reports are not answered
+		t.Fatalf("Failed to send the van's report: %v", err)
+	}
+	everything.until(t, "van status", func(f *liveFrame) bool {
+		return f.Type == model.LiveStatus && f.DeviceID == van.ID && f.Status == model.DeviceOnline
+	})
+	everything.until(t, "van position", func(f *liveFrame) bool {
+		return f.Type == model.LivePosition && f.DeviceID == van.ID && f.Position != nil
+	})
+
+	// Filters are replaced from the socket, and kept when refused
+	everything.send(t, map[string]interface{}{"filters": []model.LiveFilter{{DeviceID: truck.ID}}})
+	if reply := everything.until(t, "reply", func(f *liveFrame) bool { return f.Error != "" || f.Type == "subscribed" }); reply.Type != "error" || len(reply.Filters) != 0 {
+		t.Errorf("Reply = %+v, want the truck refused and every device still followed", reply)
+	}
+	everything.send(t, map[string]interface{}{"filters": []model.LiveFilter{{OrganizationID: fleet.ID}}})
+	if reply := everything.until(t, "reply", func(f *liveFrame) bool { return f.Error != "" || f.Type == "subscribed" }); reply.Type != "subscribed" || len(reply.Filters) != 1 || reply.Filters[0].OrganizationID != fleet.ID {
+		t.Errorf("Reply = %+v, want the fleet followed", reply)
+	}
+
+	truckConn := env.dialDevice(t)
+	exchange(t, truckConn, h02ACCFrame("120000", "2237.7514", true))
+	if update := truckOnly.until(t, "truck position", func(f *liveFrame) bool { return f.Type == model.LivePosition }); update.DeviceID != truck.ID || update.Position.Latitude == 0 {
+		t.Errorf("Truck socket got %+v, want the truck's position", update)
+	}
+	truckConn.Close()
+	truckOnly.until(t, "truck status", func(f *liveFrame) bool {
+		return f.Type == model.LiveStatus && f.DeviceID == truck.ID && f.Status == model.DeviceOffline
+	})
+
+	// The van leaving is the dispatcher's next status change
+	vanConn.Close()
+	if update := everything.until(t, "van status", func(f *liveFrame) bool { return f.Type == model.LiveStatus }); update.DeviceID != van.ID || update.Status != model.DeviceOffline {
+		t.Errorf("Dispatcher got %+v, want the van going offline", update)
+	}
+}
@@ -0,0 +1,66 @@
+package test
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"tracking/internal/core/model"
+)
+
+// getWithLanguage sends an authenticated GET, unless token is empty, and
+// returns the response status, Content-Language and body
+func (e *testEnv) getWithLanguage(t *testing.T, path, token, acceptLanguage string) (int, string, string) {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, e.baseURL+path, nil)
+	if err != nil {
+		t.Fatalf("Failed to build request: %v", err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	req.Header.Set("Accept-Language", acceptLanguage)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET %s failed: %v", path, err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, resp.Header.Get("Content-Language"), strings.TrimSpace(string(body))
+}
+
+func TestLocaleNegotiation(t *testing.T) {
+	env := newTestEnv(t)
+
+	status, language, body := env.getWithLanguage(t, "/api/devices/list", "", "de-DE, fr-CA;q=0.9, en;q=0.5")
+	if status != http.StatusUnauthorized || language != "fr" || body != "L'en-tête Authorization est requis" {
+		t.Errorf("Unauthenticated request = %d %q %q, want a French 401", status, language, body)
+	}
+
+	status, language, _ = env.getWithLanguage(t, "/api/devices/list", env.token, "ar;q=0.8, xx")
+	if status != http.StatusOK || language != "ar" {
+		t.Errorf("Request = %d %q, want 200 in ar", status, language)
+	}
+	if _, language, _ = env.getWithLanguage(t, "/api/devices/list", env.token, ""); language != "en" {
+		t.Errorf("Request without Accept-Language got %q, want en", language)
+	}
+
+	// The profile locale wins over the header
+	user := model.NewUser("test@example.com", "test123", "Test User")
+	user.ID = testUserID
+	if err := env.app.Repositories.Users.Create(user); err != nil {
+		t.Fatal(err)
+	}
+	if status := env.do(t, http.MethodPut, "/api/users/locale", map[string]string{"locale": "xx"}, nil); status != http.StatusBadRequest {
+		t.Errorf("Unsupported locale returned status %d, want 400", status)
+	}
+	if status := env.do(t, http.MethodPut, "/api/users/locale", map[string]string{"locale": "fr"}, nil); status != http.StatusOK {
+		t.Fatalf("Setting the locale returned status %d", status)
+	}
+	if _, language, _ = env.getWithLanguage(t, "/api/devices/list", env.token, "en"); language != "fr" {
+		t.Errorf("Request from a French profile got %q, want fr", language)
+	}
+}
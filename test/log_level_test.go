@@ -0,0 +1,114 @@
+package test
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"tracking/internal/core/model"
+)
+
+// logCapture collects what the standard logger writes during a test
+type logCapture struct {
+	mutex sync.Mutex
+	buf   bytes.Buffer
+}
+
+func (c *logCapture) Write(p []byte) (int, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.buf.Write(p)
+}
+
+func (c *logCapture) String() string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.buf.String()
+}
+
+func captureLogs(t *testing.T) *logCapture {
+	capture := &logCapture{}
+	log.SetOutput(capture)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	return capture
+}
+
+func TestLogLevels(t *testing.T) {
+	env := newTestEnv(t)
+	watched := env.registerDevice(t, "4210051415", "h02")
+	other := env.registerDevice(t, "123456789012345", "h02")
+	logs := captureLogs(t)
+
+	var levels model.LogLevels
+	if status := env.do(t, http.MethodGet, "/api/admin/log-levels", nil, &levels); status != http.StatusOK {
+		t.Fatalf("Listing levels returned status %d", status)
+	}
+	if levels.Level != "info" || len(levels.Overrides) != 0 {
+		t.Fatalf("Levels = %+v, want info without overrides", levels)
+	}
+
+	for name, in := range map[string]map[string]interface{}{
+		"an unknown module":       {"module": "ftp", "level": "debug"},
+		"an unknown level":        {"module": "gt06", "level": "verbose"},
+		"a module and a device":   {"module": "gt06", "deviceId": watched.ID, "level": "debug"},
+		"neither":                 {"level": "debug"},
+		"a duration beyond a day": {"module": "cache", "level": "debug", "duration": 2 * 24 * 3600},
+		"a negative duration":     {"module": "cache", "level": "debug", "duration": -1},
+	} {
+		if status := env.do(t, http.MethodPost, "/api/admin/log-levels", in, nil); status != http.StatusBadRequest {
+			t.Errorf("Overriding %s returned status %d, want 400", name, status)
+		}
+	}
+	member := env.memberToken(t, "member", "")
+	if status := env.doAs(t, member, "", http.MethodPost, "/api/admin/log-levels", map[string]interface{}{"module": "gt06", "level": "debug"}, nil); status != http.StatusForbidden {
+		t.Errorf("Overriding as a member returned status %d, want 403", status)
+	}
+
+	var override model.LogOverride
+	if status := env.do(t, http.MethodPost, "/api/admin/log-levels", map[string]interface{}{"deviceId": watched.ID, "level": "debug", "duration": 60}, &override); status != http.StatusOK {
+		t.Fatalf("Overriding the device returned status %d", status)
+	}
+	if !override.ExpiresAt.Equal(env.clock.Now().Add(time.Minute)) {
+		t.Errorf("Override expires at %s, want a minute from now", override.ExpiresAt)
+	}
+	if status := env.do(t, http.MethodPost, "/api/admin/log-levels", map[string]interface{}{"module": "tcp_server", "level": "warn"}, nil); status != http.StatusOK {
+		t.Fatalf("Overriding the server returned status %d", status)
+	}
+
+	// Only the watched device's traffic is written
+	exchange(t, env.dialDevice(t), h02ACCFrame("120000", "2237.7514", true))
+	exchange(t, env.dialDevice(t), h02Frame)
+	if got := logs.String(); !strings.Contains(got, "["+watched.ID+"] Decoded") || strings.Contains(got, "["+other.ID+"]") {
+		t.Errorf("Logs = %q, want the frames of %s only", got, watched.ID)
+	}
+
+	if status := env.do(t, http.MethodGet, "/api/admin/log-levels", nil, &levels); status != http.StatusOK {
+		t.Fatalf("Listing levels returned status %d", status)
+	}
+	if len(levels.Overrides) != 2 || levels.Overrides[0].Module != "tcp_server" || levels.Overrides[1].DeviceID != watched.ID {
+		t.Fatalf("Overrides = %+v, want the server's and the device's", levels.Overrides)
+	}
+
+	// The server's override is reset by hand, the device's reverts on its own
+	reset := map[string]interface{}{"module": "tcp_server"}
+	if status := env.do(t, http.MethodPost, "/api/admin/log-levels/reset", reset, nil); status != http.StatusNoContent {
+		t.Errorf("Resetting the server returned status %d", status)
+	}
+	if status := env.do(t, http.MethodPost, "/api/admin/log-levels/reset", reset, nil); status != http.StatusNotFound {
+		t.Errorf("Resetting the server again returned status %d, want 404", status)
+	}
+	env.clock.Advance(2 * time.Minute)
+	if status := env.do(t, http.MethodGet, "/api/admin/log-levels", nil, &levels); status != http.StatusOK || len(levels.Overrides) != 0 {
+		t.Errorf("Levels = %+v (status %d), want every override gone", levels, status)
+	}
+	before := len(logs.String())
+	exchange(t, env.dialDevice(t), h02ACCFrame("120500", "2237.7520", true))
+	if got := logs.String()[before:]; strings.Contains(got, "["+watched.ID+"] Decoded") {
+		t.Errorf("Logs = %q, want the device's traffic unlogged once its override expired", got)
+	}
+}
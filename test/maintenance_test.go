@@ -0,0 +1,135 @@
+package test
+
+import (
+	"math"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"tracking/internal/core/model"
+)
+
+func TestMaintenanceAndUtilization(t *testing.T) {
+	env := newTestEnv(t)
+	truck := env.registerDevice(t, "4210051415", "h02")
+	services := env.captureEvents(model.EventMaintenance)
+
+	for _, invalid := range []model.Maintenance{
+		{DeviceID: truck.ID, Type: model.AttributeEngineHours, Period: 250},
+		{DeviceID: truck.ID, Name: "Tyres", Type: "fuel", Period: 250},
+		{DeviceID: truck.ID, Name: "Oil change", Type: model.AttributeEngineHours, Period: -1},
+	} {
+		if status := env.do(t, http.MethodPost, "/api/maintenance", invalid, nil); status != http.StatusBadRequest {
+			t.Errorf("Creating %+v returned status %d, want 400", invalid, status)
+		}
+	}
+	if status := env.do(t, http.MethodPost, "/api/maintenance", model.Maintenance{
+		DeviceID: "unknown", Name: "Oil change", Type: model.AttributeEngineHours, Period: 250,
+	}, nil); status != http.StatusNotFound {
+		t.Errorf("Scheduling on an unknown device returned status %d, want 404", status)
+	}
+
+	var oil, tyres model.Maintenance
+	if status := env.do(t, http.MethodPost, "/api/maintenance", model.Maintenance{
+		DeviceID: truck.ID, Name: "Oil change", Type: model.AttributeEngineHours, Start: 0.5, Period: 1,
+	}, &oil); status != http.StatusOK {
+		t.Fatalf("Scheduling the oil change returned status %d", status)
+	}
+	if status := env.do(t, http.MethodPost, "/api/maintenance", model.Maintenance{
+		DeviceID: truck.ID, Name: "Tyres", Type: model.AttributeTotalDistance, Start: 40000000,
+	}, &tyres); status != http.StatusOK {
+		t.Fatalf("Scheduling the tyres returned status %d", status)
+	}
+
+	// The engine runs from 12:00 to 13:45, reaching the oil change at half
+	// an hour and again at an hour and a half
+	conn := env.dialDevice(t)
+	for _, frame := range [][]byte{
+		h02ACCFrame("120000", "2237.7514", true),
+		h02ACCFrame("123000", "2238.7514", true),
+		h02ACCFrame("130000", "2238.7514", true),
+		h02ACCFrame("134500", "2238.7514", false),
+	} {
+		exchange(t, conn, frame)
+	}
+
+	raised := services()
+	if len(raised) != 2 {
+		t.Fatalf("Got %d maintenance events, want 2: %+v", len(raised), raised)
+	}
+	for i, due := range []float64{0.5, 1.5} {
+		event := raised[i]
+		if event.DeviceID != truck.ID || event.Attributes["maintenanceId"] != oil.ID || event.Attributes["due"] != due {
+			t.Errorf("Maintenance event %d = %+v, want the oil change due at %.1f h", i, event, due)
+		}
+	}
+
+	// Utilization over two hours in which the engine ran for 1.75
+	var utilization model.Utilization
+	query := url.Values{"deviceId": {truck.ID}, "from": {"2022-10-15T12:00:00Z"}, "to": {"2022-10-15T14:00:00Z"}}
+	if status := env.do(t, http.MethodGet, "/api/devices/accumulators/utilization?"+query.Encode(), nil, &utilization); status != http.StatusOK {
+		t.Fatalf("Getting utilization returned status %d", status)
+	}
+	if math.Abs(utilization.EngineHours-1.75) > 1e-6 || math.Abs(utilization.Utilization-0.875) > 1e-6 || utilization.Distance <= 0 {
+		t.Errorf("Utilization = %+v, want 1.75 h, 0.875", utilization)
+	}
+	query.Set("to", "2022-10-15T11:00:00Z")
+	if status := env.do(t, http.MethodGet, "/api/devices/accumulators/utilization?"+query.Encode(), nil, nil); status != http.StatusBadRequest {
+		t.Errorf("Utilization over a reversed range returned status %d, want 400", status)
+	}
+
+	var listed []*model.Maintenance
+	if status := env.do(t, http.MethodGet, "/api/maintenance?deviceId="+truck.ID, nil, &listed); status != http.StatusOK {
+		t.Fatalf("Listing maintenances returned status %d", status)
+	}
+	if len(listed) != 2 || listed[0].ID != oil.ID || listed[1].ID != tyres.ID {
+		t.Errorf("Maintenances = %+v", listed)
+	}
+
+	// Maintenances of other users' devices are out of reach
+	other := env.memberToken(t, "other-user", "")
+	if status := env.doAs(t, other, "", http.MethodPut, "/api/maintenance?id="+oil.ID, oil, nil); status != http.StatusNotFound {
+		t.Errorf("Updating another user's maintenance returned status %d, want 404", status)
+	}
+	oil.Period = 250
+	var updated model.Maintenance
+	if status := env.do(t, http.MethodPut, "/api/maintenance?id="+oil.ID, oil, &updated); status != http.StatusOK {
+		t.Fatalf("Updating the oil change returned status %d", status)
+	}
+	if updated.Period != 250 || !updated.CreatedAt.Equal(oil.CreatedAt) {
+		t.Errorf("Updated maintenance = %+v", updated)
+	}
+	if status := env.do(t, http.MethodPost, "/api/maintenance/delete?id="+tyres.ID, nil, nil); status != http.StatusOK {
+		t.Fatalf("Deleting the tyres returned status %d", status)
+	}
+	listed = nil
+	env.do(t, http.MethodGet, "/api/maintenance?deviceId="+truck.ID, nil, &listed)
+	if len(listed) != 1 || listed[0].ID != oil.ID {
+		t.Errorf("Maintenances after the delete = %+v", listed)
+	}
+}
+
+func TestReportedHourMeter(t *testing.T) {
+	env := newTestEnv(t)
+	tractor := env.registerDevice(t, "123456", "osmand")
+
+	// Engine time follows the meter, not the ignition, from its first
+	// reading on
+	for _, report := range []url.Values{
+		{"timestamp": {"2022-10-15T12:00:00Z"}, "hours": {"1200"}},
+		{"timestamp": {"2022-10-15T12:10:00Z"}, "hours": {"1200.75"}},
+		{"timestamp": {"2022-10-15T12:20:00Z"}, "hours": {"1201"}},
+	} {
+		report.Set("lat", "52.52")
+		report.Set("lon", "13.405")
+		env.osmandReport(t, tractor, report)
+	}
+
+	var totals model.Accumulators
+	if status := env.do(t, http.MethodGet, "/api/devices/accumulators?deviceId="+tractor.ID, nil, &totals); status != http.StatusOK {
+		t.Fatalf("Getting accumulators returned status %d", status)
+	}
+	if math.Abs(totals.EngineHours-1) > 1e-6 {
+		t.Errorf("Engine hours = %.2f, want 1", totals.EngineHours)
+	}
+}
@@ -0,0 +1,178 @@
+package test
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"tracking/internal/core/model"
+)
+
+// messageStream is a WebSocket client reading the messages pushed to it
+type messageStream struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// openMessageStream subscribes to a device's messages, passing the token as
+// a parameter the way browsers must
+func (e *testEnv) openMessageStream(t *testing.T, deviceID string) *messageStream {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", e.app.HTTPAddr().String())
+	if err != nil {
+		t.Fatalf("Failed to connect to HTTP server: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	fmt.Fprintf(conn, "GET /api/messages/stream?deviceId=%s&token=%s HTTP/1.1\r\n"+
+		"Host: %s\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n",
+		deviceID, e.token, e.app.HTTPAddr())
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatalf("Failed to read upgrade response: %v", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("Upgrade response = %d %v", resp.StatusCode, resp.Header)
+	}
+	return &messageStream{conn: conn, reader: reader}
+}
+
+// readTextFrame reads the next text frame a server pushed
+func readTextFrame(t *testing.T, conn net.Conn, reader *bufio.Reader) []byte {
+	t.Helper()
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var head [2]byte
+	if _, err := io.ReadFull(reader, head[:]); err != nil {
+		t.Fatalf("Failed to read frame: %v", err)
+	}
+	if head[0] != 0x81 {
+		t.Fatalf("Frame header % x, want a final text frame", head)
+	}
+	length := int(head[1])
+	if length == 126 {
+		var ext [2]byte
+		io.ReadFull(reader, ext[:])
+		length = int(binary.BigEndian.Uint16(ext[:]))
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		t.Fatalf("Failed to read frame payload: %v", err)
+	}
+	return payload
+}
+
+// next reads the next pushed message
+func (s *messageStream) next(t *testing.T) *model.Message {
+	t.Helper()
+
+	payload := readTextFrame(t, s.conn, s.reader)
+	var message model.Message
+	if err := json.Unmarshal(payload, &message); err != nil {
+		t.Fatalf("Invalid message %s: %v", payload, err)
+	}
+	return &message
+}
+
+func TestDriverMessagingWithWatch(t *testing.T) {
+	env := newTestEnv(t)
+	device := env.registerDevice(t, "8800000015", "watch")
+	conn := env.dialDevice(t)
+	exchange(t, conn, watchHeartbeatFrame)
+
+	stream := env.openMessageStream(t, device.ID)
+
+	var sent model.Message
+	if status := env.do(t, http.MethodPost, "/api/messages?deviceId="+device.ID, map[string]string{"text": "Hi"}, &sent); status != http.StatusOK {
+		t.Fatalf("Sending a message returned status %d", status)
+	}
+	if sent.Direction != model.MessageOutgoing || sent.UserID != testUserID {
+		t.Errorf("Sent message = %+v", sent)
+	}
+
+	// The watch gets the text as UTF-16 and confirms it
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	command := make([]byte, 128)
+	n, err := conn.Read(command)
+	if err != nil {
+		t.Fatalf("Failed to read text command: %v", err)
+	}
+	if got := string(command[:n]); got != "[3G*8800000015*0010*MESSAGE,00480069]" {
+		t.Fatalf("Text command = %q", got)
+	}
+	expectNoResponse(t, conn, []byte("[3G*8800000015*0007*MESSAGE]"))
+
+	// Subscribers follow the message from pending to delivered
+	for _, status := range []string{model.MessagePending, model.MessageSent, model.MessageDelivered} {
+		if message := stream.next(t); message.ID != sent.ID || message.Status != status {
+			t.Fatalf("Pushed %+v, want %s %s", message, sent.ID, status)
+		}
+	}
+
+	// The driver answers from a phone app posting with the device credentials
+	body := strings.NewReader(`{"text":"On my way"}`)
+	req, _ := http.NewRequest(http.MethodPost, env.baseURL+"/api/device/messages?deviceId="+device.ID, body)
+	req.Header.Set("X-Device-API-Key", device.ApiKey)
+	req.Header.Set("X-Device-API-Secret", device.ApiSecret)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Device reply failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Device reply returned status %d", resp.StatusCode)
+	}
+	if message := stream.next(t); message.Direction != model.MessageIncoming || message.Text != "On my way" {
+		t.Errorf("Pushed %+v, want the driver's reply", message)
+	}
+
+	var thread []*model.Message
+	if status := env.do(t, http.MethodGet, "/api/messages/list?deviceId="+device.ID, nil, &thread); status != http.StatusOK {
+		t.Fatalf("Listing messages returned status %d", status)
+	}
+	if len(thread) != 2 || thread[0].Status != model.MessageDelivered || thread[1].Status != model.MessageReceived {
+		t.Errorf("Thread = %+v, want the delivered text then the reply", thread)
+	}
+}
+
+func TestDriverMessageFailures(t *testing.T) {
+	env := newTestEnv(t)
+	watchDevice := env.registerDevice(t, "8800000015", "watch")
+	h02Device := env.registerDevice(t, "123456789012345", "h02")
+	conn := env.dialDevice(t)
+	exchange(t, conn, h02Frame)
+
+	if status := env.do(t, http.MethodPost, "/api/messages?deviceId="+watchDevice.ID, map[string]string{"text": "  "}, nil); status != http.StatusBadRequest {
+		t.Errorf("Empty message returned status %d, want %d", status, http.StatusBadRequest)
+	}
+
+	// Messages the device cannot take are kept as failed
+	for _, device := range []*model.Device{watchDevice, h02Device} {
+		var message model.Message
+		if status := env.do(t, http.MethodPost, "/api/messages?deviceId="+device.ID, map[string]string{"text": "Hello"}, &message); status != http.StatusOK {
+			t.Fatalf("Sending to %s returned status %d", device.Protocol, status)
+		}
+		if message.Status != model.MessageFailed || message.Error == "" {
+			t.Errorf("Message to %s = %+v, want failed", device.Protocol, message)
+		}
+	}
+
+	// Other users' devices are off limits
+	other := model.NewDevice("Other", "8800000016")
+	other.SetOwnership("someone-else", "")
+	env.deviceRepo.Create(other)
+	if status := env.do(t, http.MethodGet, "/api/messages/list?deviceId="+other.ID, nil, nil); status != http.StatusForbidden {
+		t.Errorf("Listing another user's messages returned status %d, want %d", status, http.StatusForbidden)
+	}
+}
@@ -0,0 +1,126 @@
+package test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"tracking/internal/core/model"
+)
+
+func TestPositionNotes(t *testing.T) {
+	env := newTestEnv(t)
+	repos := env.app.Repositories
+	fleet := model.NewOrganization("Fleet", "")
+	if err := repos.Organizations.Create(fleet); err != nil {
+		t.Fatalf("Failed to create organization: %v", err)
+	}
+	if err := repos.OrganizationMembers.Create(model.NewOrganizationMember(fleet.ID, "dispatcher", "member")); err != nil {
+		t.Fatalf("Failed to add member: %v", err)
+	}
+	truck := model.NewDevice("Truck", "4210051415")
+	truck.Protocol = "h02"
+	truck.SetOwnership(testUserID, fleet.ID)
+	if err := repos.Devices.Create(truck); err != nil {
+		t.Fatalf("Failed to register device: %v", err)
+	}
+
+	conn := env.dialDevice(t)
+	exchange(t, conn, h02SpeedFrame("120000", "2237.7514", 20, 0))
+	exchange(t, conn, h02SpeedFrame("121000", "2238.4000", 0, 0))
+	exchange(t, conn, h02SpeedFrame("122000", "2238.9000", 20, 0))
+	positions := env.positions(t, truck.ID)
+	if len(positions) != 3 {
+		t.Fatalf("Got %d positions, want 3", len(positions))
+	}
+	at := func(hour, minute int) time.Time {
+		return time.Date(2022, 10, 15, hour, minute, 0, 0, time.UTC)
+	}
+	var stop *model.Position
+	for _, position := range positions {
+		if position.Timestamp.Equal(at(12, 10)) {
+			stop = position
+		}
+	}
+	if stop == nil {
+		t.Fatalf("No position at %s", at(12, 10))
+	}
+
+	for _, invalid := range []model.Note{
+		{DeviceID: truck.ID, PositionID: stop.ID},
+		{DeviceID: truck.ID, Text: "Somewhere"},
+		{DeviceID: truck.ID, Text: "Backwards", From: at(12, 30), To: at(12, 0)},
+		{DeviceID: truck.ID, Text: "Elsewhere", PositionID: "unknown"},
+	} {
+		if status := env.do(t, http.MethodPost, "/api/notes", invalid, nil); status != http.StatusBadRequest {
+			t.Errorf("Creating %+v returned status %d, want 400", invalid, status)
+		}
+	}
+
+	var delivery, leg model.Note
+	if status := env.do(t, http.MethodPost, "/api/notes", model.Note{
+		DeviceID: truck.ID, PositionID: stop.ID, Text: " Delivery at customer X ",
+	}, &delivery); status != http.StatusOK {
+		t.Fatalf("Creating the delivery note returned status %d", status)
+	}
+	if delivery.Text != "Delivery at customer X" || !delivery.From.Equal(at(12, 10)) || delivery.UserID != testUserID {
+		t.Errorf("Delivery note = %+v", delivery)
+	}
+	if status := env.do(t, http.MethodPost, "/api/notes", model.Note{
+		DeviceID: truck.ID, From: at(12, 5), To: at(12, 25), Text: "Second leg",
+	}, &leg); status != http.StatusOK {
+		t.Fatalf("Creating the leg note returned status %d", status)
+	}
+
+	// Merged into the position listing on request only
+	var annotated []struct {
+		Timestamp time.Time     `json:"timestamp"`
+		Notes     []*model.Note `json:"notes"`
+	}
+	if status := env.do(t, http.MethodGet, "/api/positions/list?notes=true&deviceId="+truck.UniqueID, nil, &annotated); status != http.StatusOK || len(annotated) != 3 {
+		t.Fatalf("Listing annotated positions returned status %d, %d positions", status, len(annotated))
+	}
+	want := map[time.Time]int{at(12, 0): 0, at(12, 10): 2, at(12, 20): 1}
+	for _, position := range annotated {
+		if len(position.Notes) != want[position.Timestamp.UTC()] {
+			t.Errorf("Position at %s has %d notes, want %d", position.Timestamp, len(position.Notes), want[position.Timestamp.UTC()])
+		}
+	}
+	var plain []map[string]interface{}
+	env.do(t, http.MethodGet, "/api/positions/list?deviceId="+truck.ID, nil, &plain)
+	for _, position := range plain {
+		if _, ok := position["notes"]; ok {
+			t.Errorf("Position listed without notes=true carries notes: %v", position)
+		}
+	}
+
+	// Members of the organization read the notes but only the author
+	// changes them; users out of reach of the device see none
+	dispatcher := env.memberToken(t, "dispatcher", "")
+	var notes []*model.Note
+	if status := env.doAs(t, dispatcher, "", http.MethodGet, "/api/notes?deviceId="+truck.ID, nil, &notes); status != http.StatusOK || len(notes) != 2 || notes[0].ID != leg.ID {
+		t.Fatalf("Dispatcher listing notes got status %d, %+v", status, notes)
+	}
+	if status := env.doAs(t, dispatcher, "", http.MethodPut, "/api/notes?id="+leg.ID, leg, nil); status != http.StatusForbidden {
+		t.Errorf("Dispatcher updating a note got status %d, want 403", status)
+	}
+	stranger := env.memberToken(t, "stranger", "")
+	if status := env.doAs(t, stranger, "", http.MethodGet, "/api/notes?deviceId="+truck.ID, nil, nil); status != http.StatusNotFound {
+		t.Errorf("Stranger listing notes got status %d, want 404", status)
+	}
+	if status := env.doAs(t, stranger, "", http.MethodPost, "/api/notes/delete?id="+leg.ID, nil, nil); status != http.StatusNotFound {
+		t.Errorf("Stranger deleting a note got status %d, want 404", status)
+	}
+
+	leg.Text = "Second leg, detour"
+	leg.To = at(12, 15)
+	if status := env.do(t, http.MethodPut, "/api/notes?id="+leg.ID, leg, &leg); status != http.StatusOK || !leg.To.Equal(at(12, 15)) {
+		t.Fatalf("Updating the leg note returned status %d, %+v", status, leg)
+	}
+	if status := env.do(t, http.MethodPost, "/api/notes/delete?id="+delivery.ID, nil, nil); status != http.StatusOK {
+		t.Fatalf("Deleting the delivery note returned status %d", status)
+	}
+	if env.do(t, http.MethodGet, "/api/notes?deviceId="+truck.ID, nil, &notes); len(notes) != 1 || notes[0].Text != "Second leg, detour" {
+		t.Errorf("Notes after the changes = %+v", notes)
+	}
+}
@@ -0,0 +1,160 @@
+package test
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+
+	"tracking/internal/config"
+	"tracking/internal/core/model"
+)
+
+// mailMessage is a message the fake mail server accepted
+type mailMessage struct {
+	to      string
+	subject string
+	body    string
+}
+
+// newMailServer accepts mail over SMTP without authentication and hands
+// over every message, returning the server's port
+func newMailServer(t *testing.T) (int, chan mailMessage) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	messages := make(chan mailMessage, 10)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveMail(conn, messages)
+		}
+	}()
+	return listener.Addr().(*net.TCPAddr).Port, messages
+}
+
+func serveMail(conn net.Conn, messages chan mailMessage) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+	reply("220 localhost ESMTP")
+	var to string
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		command := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(command, "RCPT TO:"):
+			to = strings.Trim(strings.TrimSpace(line)[len("RCPT TO:"):], "<>")
+			reply("250 OK")
+		case command == "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				line, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data.WriteString(line)
+			}
+			message, err := mail.ReadMessage(strings.NewReader(data.String()))
+			if err == nil {
+				var body strings.Builder
+				bufio.NewReader(message.Body).WriteTo(&body)
+				messages <- mailMessage{to: to, subject: message.Header.Get("Subject"), body: body.String()}
+			}
+			reply("250 OK")
+		case command == "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func TestEmailNotifications(t *testing.T) {
+	port, mails := newMailServer(t)
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.SMTPHost = "127.0.0.1"
+		cfg.SMTPPort = port
+		cfg.SMTPFrom = "tracking@example.com"
+		cfg.EmailBatchWindow = 200 * time.Millisecond
+	})
+	truck := env.registerDevice(t, "4210051415", "h02")
+
+	for _, invalid := range []model.NotificationPreferences{
+		{Notifications: []string{"sunrise"}},
+		{Email: "not an address", Notifications: []string{model.NotifySOS}},
+	} {
+		if status := env.do(t, http.MethodPut, "/api/users/notifications", invalid, nil); status != http.StatusBadRequest {
+			t.Errorf("Setting %+v returned status %d, want 400", invalid, status)
+		}
+	}
+	var preferences model.NotificationPreferences
+	if status := env.do(t, http.MethodPut, "/api/users/notifications", model.NotificationPreferences{
+		Email:         "Fleet Owner <owner@example.com>",
+		Notifications: []string{model.NotifySOS, model.NotifyGeofence, model.NotifySOS},
+	}, &preferences); status != http.StatusOK {
+		t.Fatalf("Setting preferences returned status %d", status)
+	}
+	if preferences.Email != "owner@example.com" || len(preferences.Notifications) != 2 {
+		t.Errorf("Preferences = %+v", preferences)
+	}
+
+	next := func() mailMessage {
+		t.Helper()
+		select {
+		case message := <-mails:
+			return message
+		case <-time.After(5 * time.Second):
+			t.Fatal("No mail")
+		}
+		return mailMessage{}
+	}
+
+	conn := env.dialDevice(t)
+	exchange(t, conn, []byte("*HQ,4210051415,V1,120000,A,2237.7514,N,11408.6214,E,0,0,151022,FFFBFFFF#"))
+	sos := next()
+	if sos.to != "owner@example.com" || sos.subject != "SOS from E2E h02" || !strings.Contains(sos.body, "2022-10-15 12:00 UTC") {
+		t.Errorf("SOS mail = %+v", sos)
+	}
+
+	// A burst makes one digest, without the notification not chosen
+	at := time.Date(2022, 10, 15, 12, 5, 0, 0, time.UTC)
+	for _, eventType := range []string{model.EventGeofenceEnter, model.EventLowBattery, model.EventGeofenceExit} {
+		event := model.NewEvent(eventType, truck.ID, at)
+		event.Attributes["geofenceName"] = "Depot"
+		env.app.Hooks.Event(event)
+	}
+	digest := next()
+	if digest.subject != "2 tracking notifications" ||
+		!strings.Contains(digest.body, "E2E h02 entered Depot") || !strings.Contains(digest.body, "E2E h02 left Depot") ||
+		strings.Contains(digest.body, "battery") {
+		t.Errorf("Digest = %+v", digest)
+	}
+
+	var stored model.NotificationPreferences
+	if status := env.do(t, http.MethodGet, "/api/users/notifications", nil, &stored); status != http.StatusOK {
+		t.Fatalf("Getting preferences returned status %d", status)
+	}
+	if stored.Email != "owner@example.com" || len(stored.Notifications) != 2 {
+		t.Errorf("Stored preferences = %+v", stored)
+	}
+}
@@ -0,0 +1,246 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"tracking/internal/core/model"
+)
+
+// memberToken signs an access token for a user without the admin role,
+// optionally naming their default organization
+func (e *testEnv) memberToken(t *testing.T, userID, orgID string) string {
+	t.Helper()
+
+	now := e.clock.Now()
+	claims := jwt.MapClaims{
+		"sub":  userID,
+		"role": "user",
+		"exp":  now.Add(15 * time.Minute).Unix(),
+		"iat":  now.Unix(),
+	}
+	if orgID != "" {
+		claims["organization_id"] = orgID
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("test_jwt_secret_key_123"))
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v", err)
+	}
+	return token
+}
+
+// doAs sends an API request with the token, switching to the organization
+// when one is given, and decodes the JSON response into out
+func (e *testEnv) doAs(t *testing.T, token, orgID, method, path string, in, out interface{}) int {
+	t.Helper()
+
+	var body bytes.Buffer
+	if in != nil {
+		if err := json.NewEncoder(&body).Encode(in); err != nil {
+			t.Fatalf("Failed to encode request: %v", err)
+		}
+	}
+	req, _ := http.NewRequest(method, e.baseURL+path, &body)
+	req.Header.Set("Authorization", "Bearer "+token)
+	if orgID != "" {
+		req.Header.Set("X-Organization-ID", orgID)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s failed: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	if out != nil && resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("Failed to decode %s response: %v", path, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestUserInSeveralOrganizations(t *testing.T) {
+	env := newTestEnv(t)
+	repos := env.app.Repositories
+	fleet := model.NewOrganization("Fleet", "")
+	depot := model.NewOrganization("Depot", "")
+	other := model.NewOrganization("Other", "")
+	for _, org := range []*model.Organization{fleet, depot, other} {
+		if err := repos.Organizations.Create(org); err != nil {
+			t.Fatalf("Failed to create organization: %v", err)
+		}
+	}
+	for _, member := range []*model.OrganizationMember{
+		model.NewOrganizationMember(fleet.ID, "dispatcher", "admin"),
+		model.NewOrganizationMember(depot.ID, "dispatcher", "member"),
+	} {
+		if err := repos.OrganizationMembers.Create(member); err != nil {
+			t.Fatalf("Failed to create membership: %v", err)
+		}
+	}
+	devices := map[string]*model.Device{}
+	for i, org := range []*model.Organization{fleet, depot, other} {
+		device := model.NewDevice(org.Name+" van", fmt.Sprintf("03534135328800%d", i))
+		device.SetOwnership("owner", org.ID)
+		if err := env.deviceRepo.Create(device); err != nil {
+			t.Fatalf("Failed to create device: %v", err)
+		}
+		devices[org.ID] = device
+	}
+
+	// The token names the default organization; the header switches it
+	token := env.memberToken(t, "dispatcher", fleet.ID)
+	for _, c := range []struct {
+		header, query string
+		want          *model.Device
+	}{
+		{"", "", devices[fleet.ID]},
+		{depot.ID, "", devices[depot.ID]},
+		{"", "?organizationId=" + depot.ID, devices[depot.ID]},
+	} {
+		var listed []*model.Device
+		status := env.doAs(t, token, c.header, http.MethodGet, "/api/devices/list"+c.query, nil, &listed)
+		if status != http.StatusOK || len(listed) != 1 || listed[0].ID != c.want.ID {
+			t.Errorf("Listing in %q%s returned status %d with %d devices, want %s", c.header, c.query, status, len(listed), c.want.Name)
+		}
+	}
+
+	// Organizations the user does not belong to stay closed
+	if status := env.doAs(t, token, other.ID, http.MethodGet, "/api/devices/list", nil, nil); status != http.StatusForbidden {
+		t.Errorf("Switching to another organization returned status %d, want %d", status, http.StatusForbidden)
+	}
+	if status := env.doAs(t, token, "", http.MethodGet, "/api/devices/list?organizationId="+other.ID, nil, nil); status != http.StatusForbidden {
+		t.Errorf("Listing another organization returned status %d, want %d", status, http.StatusForbidden)
+	}
+	if status := env.doAs(t, env.memberToken(t, "dispatcher", other.ID), "", http.MethodGet, "/api/devices/list", nil, nil); status != http.StatusForbidden {
+		t.Errorf("Token naming another organization returned status %d, want %d", status, http.StatusForbidden)
+	}
+
+	env.token = token
+	var memberships []*model.Membership
+	if status := env.do(t, http.MethodGet, "/api/organizations/memberships", nil, &memberships); status != http.StatusOK || len(memberships) != 2 {
+		t.Fatalf("Listing memberships returned status %d with %d memberships", status, len(memberships))
+	}
+	roles := map[string]string{}
+	for _, membership := range memberships {
+		roles[membership.Organization.Name] = membership.Role
+	}
+	if roles["Fleet"] != "admin" || roles["Depot"] != "member" {
+		t.Errorf("Memberships = %v, want admin of Fleet and member of Depot", roles)
+	}
+
+	if status := env.do(t, http.MethodPost, "/api/devices", map[string]string{
+		"name": "Stray", "uniqueId": "035341353288999", "organizationId": other.ID,
+	}, nil); status != http.StatusForbidden {
+		t.Errorf("Creating a device in another organization returned status %d, want %d", status, http.StatusForbidden)
+	}
+}
+
+func TestOrganizationHierarchy(t *testing.T) {
+	env := newTestEnv(t)
+	var reseller model.Organization
+	if status := env.do(t, http.MethodPost, "/api/organizations", map[string]interface{}{
+		"name":     "Reseller",
+		"features": []string{model.FeatureMessages, model.FeatureAlerts},
+	}, &reseller); status != http.StatusOK {
+		t.Fatalf("Creating the reseller returned status %d", status)
+	}
+	if err := env.app.Repositories.OrganizationMembers.Create(model.NewOrganizationMember(reseller.ID, "dealer", "admin")); err != nil {
+		t.Fatalf("Failed to create membership: %v", err)
+	}
+
+	// The reseller's admin adds customers, within the reseller's features
+	dealer := env.memberToken(t, "dealer", "")
+	if status := env.doAs(t, dealer, "", http.MethodPost, "/api/organizations",
+		map[string]interface{}{"name": "Top level"}, nil); status != http.StatusForbidden {
+		t.Errorf("Dealer creating a top-level organization returned status %d, want %d", status, http.StatusForbidden)
+	}
+	if status := env.doAs(t, dealer, "", http.MethodPost, "/api/organizations", map[string]interface{}{
+		"name": "Greedy", "parentId": reseller.ID, "features": []string{model.FeatureMedia},
+	}, nil); status != http.StatusBadRequest {
+		t.Errorf("Creating a customer with a feature the reseller lacks returned status %d, want %d", status, http.StatusBadRequest)
+	}
+	var customer model.Organization
+	if status := env.doAs(t, dealer, "", http.MethodPost, "/api/organizations", map[string]interface{}{
+		"name": "Customer", "parentId": reseller.ID, "features": []string{model.FeatureMessages},
+	}, &customer); status != http.StatusOK || customer.ParentID != reseller.ID {
+		t.Fatalf("Creating the customer returned status %d with %+v", status, customer)
+	}
+	if err := env.app.Repositories.OrganizationMembers.Create(model.NewOrganizationMember(customer.ID, "driver", "member")); err != nil {
+		t.Fatalf("Failed to create membership: %v", err)
+	}
+
+	own := model.NewDevice("Reseller demo", "035341353288001")
+	own.SetOwnership("owner", reseller.ID)
+	van := model.NewDevice("Customer van", "035341353288002")
+	van.SetOwnership("owner", customer.ID)
+	van.Status = "active"
+	for _, device := range []*model.Device{own, van} {
+		if err := env.deviceRepo.Create(device); err != nil {
+			t.Fatalf("Failed to create device: %v", err)
+		}
+	}
+
+	// The dealer reaches the customer's devices, alone or rolled up
+	var devices []*model.Device
+	if status := env.doAs(t, dealer, "", http.MethodGet, "/api/devices/list?organizationId="+customer.ID, nil, &devices); status != http.StatusOK || len(devices) != 1 {
+		t.Errorf("Dealer listing the customer returned status %d with %d devices", status, len(devices))
+	}
+	if status := env.doAs(t, dealer, reseller.ID, http.MethodGet, "/api/devices/list?includeChildren=true", nil, &devices); status != http.StatusOK || len(devices) != 2 {
+		t.Errorf("Dealer listing the reseller with children returned status %d with %d devices", status, len(devices))
+	}
+	if status := env.doAs(t, dealer, "", http.MethodGet, "/api/devices/get?id="+van.ID, nil, nil); status != http.StatusOK {
+		t.Errorf("Dealer getting the customer's device returned status %d", status)
+	}
+
+	var rollup model.OrganizationRollup
+	if status := env.doAs(t, dealer, "", http.MethodGet, "/api/organizations/rollup?id="+reseller.ID, nil, &rollup); status != http.StatusOK {
+		t.Fatalf("Rollup returned status %d", status)
+	}
+	if rollup.Devices != 1 || rollup.TotalDevices != 2 || rollup.TotalActiveDevices != 1 ||
+		len(rollup.Children) != 1 || rollup.Children[0].Organization.ID != customer.ID || rollup.Children[0].ActiveDevices != 1 {
+		t.Errorf("Rollup = %+v", rollup)
+	}
+
+	// Access does not climb: the customer's members stay below
+	driver := env.memberToken(t, "driver", customer.ID)
+	for _, path := range []string{
+		"/api/organizations/rollup?id=" + reseller.ID,
+		"/api/organizations/children?id=" + reseller.ID,
+		"/api/devices/list?organizationId=" + reseller.ID,
+	} {
+		if status := env.doAs(t, driver, "", http.MethodGet, path, nil, nil); status != http.StatusForbidden {
+			t.Errorf("Driver requesting %s returned status %d, want %d", path, status, http.StatusForbidden)
+		}
+	}
+	var children []*model.Organization
+	if status := env.doAs(t, driver, "", http.MethodGet, "/api/organizations/children?id="+customer.ID, nil, &children); status != http.StatusOK || len(children) != 0 {
+		t.Errorf("Driver listing the customer's children returned status %d with %d children", status, len(children))
+	}
+	if status := env.doAs(t, driver, "", http.MethodPost, "/api/organizations",
+		map[string]interface{}{"name": "Depot", "parentId": customer.ID}, nil); status != http.StatusForbidden {
+		t.Errorf("Member creating an organization returned status %d, want %d", status, http.StatusForbidden)
+	}
+
+	// Features narrow at each level: the customer has messages but not alerts
+	if status := env.doAs(t, driver, "", http.MethodGet, "/api/messages/list?deviceId="+van.ID, nil, nil); status != http.StatusOK {
+		t.Errorf("Listing messages in the customer returned status %d", status)
+	}
+	if status := env.doAs(t, driver, "", http.MethodGet, "/api/devices/snoozes?deviceId="+van.ID, nil, nil); status != http.StatusForbidden {
+		t.Errorf("Listing snoozes in the customer returned status %d, want %d", status, http.StatusForbidden)
+	}
+	// The device's organization decides, not the one the request is made in
+	if status := env.doAs(t, dealer, reseller.ID, http.MethodGet, "/api/devices/snoozes?deviceId="+van.ID, nil, nil); status != http.StatusForbidden {
+		t.Errorf("Listing snoozes of a customer device in the reseller returned status %d, want %d", status, http.StatusForbidden)
+	}
+	// Members must make requests naming no device in an organization
+	if status := env.doAs(t, dealer, "", http.MethodPost, "/api/devices/snoozes/cancel?id=missing", nil, nil); status != http.StatusForbidden {
+		t.Errorf("Cancelling a snooze outside any organization returned status %d, want %d", status, http.StatusForbidden)
+	}
+}
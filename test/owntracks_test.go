@@ -0,0 +1,187 @@
+package test
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"tracking/internal/config"
+	"tracking/internal/core/model"
+)
+
+// owntracksLocation is a location published by the OwnTracks app from
+// inside the "home" region
+const owntracksLocation = `{"_type":"location","tid":"JD","lat":52.52,"lon":13.405,"tst":1665836113,` +
+	`"acc":12,"vel":18,"cog":90,"batt":81,"bs":1,"inregions":["home"]}`
+
+func TestOwnTracksOverHTTP(t *testing.T) {
+	env := newTestEnv(t)
+	device := env.registerDevice(t, "jane-phone", "owntracks")
+
+	post := func(user, password, body string) (int, string) {
+		req, err := http.NewRequest(http.MethodPost, env.baseURL+"/owntracks", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("Failed to build request: %v", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.SetBasicAuth(user, password)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("OwnTracks report failed: %v", err)
+		}
+		defer resp.Body.Close()
+		reply, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(reply)
+	}
+
+	if status, _ := post("jane-phone", "wrong-key", owntracksLocation); status != http.StatusUnauthorized {
+		t.Errorf("Report with a wrong key returned status %d, want %d", status, http.StatusUnauthorized)
+	}
+	if status, reply := post("jane-phone", device.ApiKey, owntracksLocation); status != http.StatusOK || reply != "[]" {
+		t.Fatalf("OwnTracks report returned status %d with %q", status, reply)
+	}
+	// Transitions are accepted but store nothing
+	if status, _ := post("jane-phone", device.ApiKey, `{"_type":"transition","event":"leave","desc":"home"}`); status != http.StatusOK {
+		t.Errorf("Transition returned status %d", status)
+	}
+
+	positions, _ := env.positionRepo.FindByDeviceID(device.ID)
+	if len(positions) != 1 {
+		t.Fatalf("Got %d positions, want 1", len(positions))
+	}
+	checkOwnTracksPosition(t, positions[0])
+}
+
+func TestOwnTracksOverMQTT(t *testing.T) {
+	broker := newFakeBroker(t)
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.OwnTracksMQTTURL = "tcp://tracking:secret@" + broker.listener.Addr().String()
+		cfg.OwnTracksMQTTTopic = "owntracks/+/+"
+	})
+	device := env.registerDevice(t, "jane-phone", "owntracks")
+
+	conn := broker.accept()
+	broker.publish(conn, "owntracks/jane/unknown", owntracksLocation)
+	broker.publish(conn, "owntracks/jane/jane-phone", owntracksLocation)
+
+	var positions []*model.Position
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if positions, _ = env.positionRepo.FindByDeviceID(device.ID); len(positions) > 0 {
+			break
+		}
+	}
+	if len(positions) != 1 {
+		t.Fatalf("Got %d positions, want 1", len(positions))
+	}
+	checkOwnTracksPosition(t, positions[0])
+}
+
+func checkOwnTracksPosition(t *testing.T, position *model.Position) {
+	t.Helper()
+
+	if position.Protocol != "owntracks" || !almostEqual(position.Latitude, 52.52, 0.0001) ||
+		!almostEqual(position.Speed, 18, 0.0001) || !position.Timestamp.Equal(time.Unix(1665836113, 0)) {
+		t.Errorf("Position = %+v", position)
+	}
+	if position.Status["batteryLevel"] != 81.0 || position.Status["charge"] != false {
+		t.Errorf("Status = %v, want battery 81 and not charging", position.Status)
+	}
+	if regions, ok := position.Status["regions"].([]string); !ok || len(regions) != 1 || regions[0] != "home" {
+		t.Errorf("Regions = %v, want [home]", position.Status["regions"])
+	}
+}
+
+// fakeBroker accepts one MQTT subscriber and publishes to it at QoS 0
+type fakeBroker struct {
+	t        *testing.T
+	listener net.Listener
+}
+
+func newFakeBroker(t *testing.T) *fakeBroker {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to start broker: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	return &fakeBroker{t: t, listener: listener}
+}
+
+// accept takes the subscriber's connection and grants its CONNECT and
+// SUBSCRIBE
+func (b *fakeBroker) accept() net.Conn {
+	b.t.Helper()
+
+	conn, err := b.listener.Accept()
+	if err != nil {
+		b.t.Fatalf("Broker accept failed: %v", err)
+	}
+	b.t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+	reader := bufio.NewReader(conn)
+
+	if header, _ := b.readPacket(reader); header>>4 != 1 {
+		b.t.Fatalf("Broker got packet %#x, want CONNECT", header)
+	}
+	conn.Write([]byte{0x20, 0x02, 0x00, 0x00})
+
+	header, body := b.readPacket(reader)
+	if header>>4 != 8 || len(body) < 2 {
+		b.t.Fatalf("Broker got packet %#x, want SUBSCRIBE", header)
+	}
+	conn.Write([]byte{0x90, 0x03, body[0], body[1], 0x00})
+	return conn
+}
+
+func (b *fakeBroker) publish(conn net.Conn, topic, payload string) {
+	b.t.Helper()
+
+	body := binary.BigEndian.AppendUint16(nil, uint16(len(topic)))
+	body = append(append(body, topic...), payload...)
+	packet := []byte{0x30}
+	for length := len(body); ; {
+		digit := byte(length % 128)
+		if length /= 128; length > 0 {
+			digit |= 0x80
+		}
+		packet = append(packet, digit)
+		if length == 0 {
+			break
+		}
+	}
+	if _, err := conn.Write(append(packet, body...)); err != nil {
+		b.t.Fatalf("Broker publish failed: %v", err)
+	}
+}
+
+func (b *fakeBroker) readPacket(reader *bufio.Reader) (byte, []byte) {
+	b.t.Helper()
+
+	header, err := reader.ReadByte()
+	if err != nil {
+		b.t.Fatalf("Broker read failed: %v", err)
+	}
+	length, multiplier := 0, 1
+	for {
+		digit, err := reader.ReadByte()
+		if err != nil {
+			b.t.Fatalf("Broker read failed: %v", err)
+		}
+		length += int(digit&0x7F) * multiplier
+		if digit&0x80 == 0 {
+			break
+		}
+		multiplier *= 128
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(reader, body); err != nil {
+		b.t.Fatalf("Broker read failed: %v", err)
+	}
+	return header, body
+}
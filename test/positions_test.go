@@ -0,0 +1,114 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"tracking/internal/core/model"
+)
+
+// positionPage lists one page of positions, returning the cursor of the
+// next
+func (e *testEnv) positionPage(t *testing.T, query url.Values) ([]*model.Position, string) {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, e.baseURL+"/api/positions/list?"+query.Encode(), nil)
+	if err != nil {
+		t.Fatalf("Failed to build request: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+e.token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Listing positions failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Listing positions %v returned status %d", query, resp.StatusCode)
+	}
+
+	var positions []*model.Position
+	if err := json.NewDecoder(resp.Body).Decode(&positions); err != nil {
+		t.Fatalf("Failed to decode positions: %v", err)
+	}
+	return positions, resp.Header.Get("X-Next-Cursor")
+}
+
+func TestPositionPages(t *testing.T) {
+	env := newTestEnv(t)
+	device := env.registerDevice(t, "4210051415", "h02")
+	other := env.registerDevice(t, "4210051416", "h02")
+
+	// A position a minute for an hour, two of them sharing a timestamp,
+	// stored out of order
+	start := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	for i := 59; i >= 0; i-- {
+		position := model.NewPosition(device.ID, 22.6, 114.1)
+		position.ID = fmt.Sprintf("position-%02d", i)
+		position.Timestamp = start.Add(time.Duration(i) * time.Minute)
+		if i == 31 {
+			position.Timestamp = start.Add(30 * time.Minute)
+		}
+		if err := env.positionRepo.Create(position); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := env.positionRepo.Create(model.NewPosition(other.ID, 22.6, 114.1)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Pages of a range follow each other without gaps or repeats, oldest
+	// first, the last one without a cursor
+	query := url.Values{
+		"deviceId": {device.ID},
+		"from":     {"2024-01-15T10:10:00Z"},
+		"to":       {"2024-01-15T10:40:00Z"},
+		"limit":    {"8"},
+	}
+	var listed []*model.Position
+	for pages := 1; ; pages++ {
+		positions, next := env.positionPage(t, query)
+		listed = append(listed, positions...)
+		if next == "" {
+			if pages != 4 || len(positions) != 6 {
+				t.Errorf("Last page is page %d with %d positions, want page 4 with 6", pages, len(positions))
+			}
+			break
+		}
+		if len(positions) != 8 || pages > 4 {
+			t.Fatalf("Page %d has %d positions and a cursor", pages, len(positions))
+		}
+		query.Set("cursor", next)
+	}
+	if len(listed) != 30 {
+		t.Fatalf("Listed %d positions, want 30", len(listed))
+	}
+	for i, position := range listed {
+		want := fmt.Sprintf("position-%02d", i+10)
+		if position.ID != want {
+			t.Errorf("Position %d is %s at %v, want %s", i, position.ID, position.Timestamp, want)
+		}
+	}
+
+	// Without parameters the first page of every position is listed
+	if positions, next := env.positionPage(t, url.Values{"deviceId": {device.ID}}); len(positions) != 60 || next != "" {
+		t.Errorf("Listed %d positions and cursor %q, want all 60", len(positions), next)
+	}
+	if positions, _ := env.positionPage(t, url.Values{"deviceId": {device.ID}, "from": {"2024-01-15T12:00:00Z"}}); len(positions) != 0 {
+		t.Errorf("Listed %d positions after the last, want none", len(positions))
+	}
+
+	for _, invalid := range []string{
+		"&cursor=not-a-cursor",
+		"&limit=0",
+		"&from=yesterday",
+		"&from=2024-01-15T11:00:00Z&to=2024-01-15T10:00:00Z",
+	} {
+		if status := env.do(t, http.MethodGet, "/api/positions/list?deviceId="+device.ID+invalid, nil, nil); status != http.StatusBadRequest {
+			t.Errorf("Listing positions with %s returned status %d, want 400", invalid, status)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package test
+
+import (
+	"net/http"
+	"testing"
+
+	"tracking/internal/core/model"
+	"tracking/internal/core/profile"
+	"tracking/internal/protocol/gt06"
+)
+
+// withXORChecksum re-signs a GT06 frame the way clone firmware does
+func withXORChecksum(frame []byte) []byte {
+	out := append([]byte{}, frame...)
+	checksumPos := len(out) - 4
+	sum := gt06.CalculateXORChecksum(out[2:checksumPos])
+	out[checksumPos], out[checksumPos+1] = byte(sum>>8), byte(sum)
+	return out
+}
+
+func (e *testEnv) assignModel(t *testing.T, deviceID, modelName string) (*model.Device, int) {
+	t.Helper()
+
+	var device model.Device
+	status := e.do(t, http.MethodPut, "/api/devices/model?id="+deviceID, map[string]string{"model": modelName}, &device)
+	return &device, status
+}
+
+func TestDeviceModelCatalog(t *testing.T) {
+	env := newTestEnv(t)
+
+	var profiles []*model.DeviceProfile
+	if status := env.do(t, http.MethodGet, "/api/device-models/list", nil, &profiles); status != http.StatusOK {
+		t.Fatalf("Listing device models returned status %d", status)
+	}
+	var found bool
+	for _, p := range profiles {
+		if p.Model == "GT06N" && p.Protocol == "gt06" && p.Battery != nil {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Catalog %+v lacks the GT06N profile", profiles)
+	}
+
+	device := env.registerDevice(t, "0353413532881372", "teltonika")
+	if _, status := env.assignModel(t, device.ID, "NoSuchModel"); status != http.StatusBadRequest {
+		t.Errorf("Unknown model returned status %d, want %d", status, http.StatusBadRequest)
+	}
+
+	assigned, status := env.assignModel(t, device.ID, "gt06n")
+	if status != http.StatusOK {
+		t.Fatalf("Assigning model returned status %d", status)
+	}
+	if assigned.Model != "GT06N" || assigned.Protocol != "gt06" {
+		t.Errorf("Assigned device = model %q protocol %q, want GT06N gt06", assigned.Model, assigned.Protocol)
+	}
+
+	cleared, status := env.assignModel(t, device.ID, "")
+	if status != http.StatusOK || cleared.Model != "" {
+		t.Errorf("Clearing model returned status %d and model %q", status, cleared.Model)
+	}
+}
+
+func TestDeviceModelAttributeDefaults(t *testing.T) {
+	env := newTestEnv(t)
+	device := env.registerDevice(t, "123456789012345", "h02")
+	if _, status := env.assignModel(t, device.ID, "ST-901"); status != http.StatusOK {
+		t.Fatalf("Assigning model returned status %d", status)
+	}
+
+	conn := env.dialDevice(t)
+	exchange(t, conn, h02Frame)
+
+	positions := env.positions(t, device.ID)
+	if len(positions) != 1 {
+		t.Fatalf("Got %d positions, want 1", len(positions))
+	}
+	status := positions[0].Status
+	if _, ok := status["powerLevel"]; ok {
+		t.Errorf("powerLevel was not renamed: %v", status)
+	}
+	if status[profile.AttributeBatteryLevel] != 10.0 || status[profile.AttributeBatteryState] != profile.BatteryCritical {
+		t.Errorf("Status = %v, want batteryLevel 10 and batteryState critical", status)
+	}
+}
+
+func TestDeviceModelQuirksOverTCP(t *testing.T) {
+	env := newTestEnv(t)
+	device := env.registerDevice(t, "0353413532881372", "gt06")
+	if _, status := env.assignModel(t, device.ID, "GT06-Clone"); status != http.StatusOK {
+		t.Fatalf("Assigning model returned status %d", status)
+	}
+
+	conn := env.dialDevice(t)
+	response := exchange(t, conn, withXORChecksum(gt06LoginFrame))
+	if len(response) < 6 || response[3] != gt06.LoginMsg {
+		t.Fatalf("Invalid login response: % x", response)
+	}
+	checksumPos := len(response) - 4
+	if sum := gt06.CalculateXORChecksum(response[2:checksumPos]); uint16(response[checksumPos])<<8|uint16(response[checksumPos+1]) != sum {
+		t.Errorf("Login response is not XOR-signed: % x", response)
+	}
+
+	exchange(t, conn, withXORChecksum(gt06LocationFrame))
+	if positions := env.positions(t, device.ID); len(positions) != 1 {
+		t.Fatalf("Got %d positions from the XOR clone, want 1", len(positions))
+	}
+
+	// The clone profile only supports the relay commands
+	if err := env.app.TCPServer.SendCommand(device.ID, gt06.CommandReboot); err == nil {
+		t.Error("SendCommand(reboot) to GT06-Clone succeeded")
+	}
+	if err := env.app.TCPServer.SendCommand(device.ID, gt06.CommandEngineStop); err != nil {
+		t.Errorf("SendCommand(engineStop) unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,37 @@
+package test
+
+import (
+	"testing"
+
+	"tracking/internal/config"
+)
+
+func TestPositionAttributeProjection(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.PositionAttributes = []string{"default", "armed"}
+		cfg.DroppedPositionAttributes = []string{"door"}
+	})
+	device := env.registerDevice(t, "4210051415", "h02")
+	conn := env.dialDevice(t)
+
+	if response := exchange(t, conn, h02TimedFrame); string(response) != "*HQ,OK#" {
+		t.Fatalf("Unexpected H02 response %q", response)
+	}
+
+	positions := env.positions(t, device.ID)
+	if len(positions) != 1 {
+		t.Fatalf("Got %d positions, want 1", len(positions))
+	}
+	status := positions[0].Status
+	for _, name := range []string{"acc", "armed", "fuelCut"} {
+		if _, ok := status[name]; !ok {
+			t.Errorf("Kept attribute %s missing from %v", name, status)
+		}
+	}
+	// door is in the default set but dropped, backupBattery is not in it
+	for _, name := range []string{"door", "backupBattery"} {
+		if _, ok := status[name]; ok {
+			t.Errorf("Attribute %s stored: %v", name, status)
+		}
+	}
+}
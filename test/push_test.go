@@ -0,0 +1,172 @@
+package test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"tracking/internal/config"
+	"tracking/internal/core/model"
+)
+
+// fcmPush is a message the fake FCM server accepted
+type fcmPush struct {
+	Token        string `json:"token"`
+	Notification struct {
+		Title string `json:"title"`
+		Body  string `json:"body"`
+	} `json:"notification"`
+	Data map[string]string `json:"data"`
+}
+
+// newFCMServer grants access tokens for assertions signed with the key of
+// a service account it writes, and accepts messages to every token but
+// those listed as unregistered. It returns the server's URL, the
+// credentials file and the pushes accepted.
+func newFCMServer(t *testing.T, unregistered ...string) (string, string, chan fcmPush) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	pushes := make(chan fcmPush, 10)
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		assertion, err := jwt.Parse(r.FormValue("assertion"), func(*jwt.Token) (interface{}, error) {
+			return &key.PublicKey, nil
+		}, jwt.WithValidMethods([]string{"RS256"}), jwt.WithoutClaimsValidation())
+		if err != nil || r.FormValue("grant_type") != "urn:ietf:params:oauth:grant-type:jwt-bearer" {
+			http.Error(w, "invalid_grant", http.StatusBadRequest)
+			return
+		}
+		claims := assertion.Claims.(jwt.MapClaims)
+		if claims["iss"] != "push@tracking.iam.gserviceaccount.com" || !strings.Contains(claims["scope"].(string), "firebase.messaging") {
+			http.Error(w, "invalid_scope", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "access", "expires_in": 3600})
+	})
+	mux.HandleFunc("/v1/projects/tracking/messages:send", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer access" {
+			http.Error(w, "unauthenticated", http.StatusUnauthorized)
+			return
+		}
+		var req struct {
+			Message fcmPush `json:"message"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		for _, token := range unregistered {
+			if req.Message.Token == token {
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte(`{"error":{"status":"NOT_FOUND","details":[{"errorCode":"UNREGISTERED"}]}}`))
+				return
+			}
+		}
+		pushes <- req.Message
+		w.Write([]byte(`{"name":"projects/tracking/messages/1"}`))
+	})
+
+	credentials, _ := json.Marshal(map[string]string{
+		"type":         "service_account",
+		"project_id":   "tracking",
+		"client_email": "push@tracking.iam.gserviceaccount.com",
+		"private_key":  string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})),
+		"token_uri":    server.URL + "/token",
+	})
+	file := filepath.Join(t.TempDir(), "credentials.json")
+	if err := os.WriteFile(file, credentials, 0600); err != nil {
+		t.Fatalf("Failed to write credentials: %v", err)
+	}
+	return server.URL, file, pushes
+}
+
+func TestPushNotifications(t *testing.T) {
+	fcmURL, credentials, pushes := newFCMServer(t, "stale-token")
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.FCMCredentialsFile = credentials
+		cfg.FCMURL = fcmURL
+	})
+	truck := env.registerDevice(t, "4210051415", "h02")
+
+	for _, invalid := range []model.PushToken{
+		{Platform: model.PlatformAndroid},
+		{Token: "phone-token", Platform: "symbian"},
+	} {
+		if status := env.do(t, http.MethodPost, "/api/users/push-tokens", invalid, nil); status != http.StatusBadRequest {
+			t.Errorf("Registering %+v returned status %d, want 400", invalid, status)
+		}
+	}
+	var registered model.PushToken
+	for _, token := range []model.PushToken{
+		{Token: "stale-token", Platform: model.PlatformIOS},
+		{Token: "phone-token", Platform: model.PlatformAndroid},
+	} {
+		if status := env.do(t, http.MethodPost, "/api/users/push-tokens", token, &registered); status != http.StatusOK {
+			t.Fatalf("Registering %s returned status %d", token.Token, status)
+		}
+	}
+	if registered.UserID != testUserID || registered.Platform != model.PlatformAndroid {
+		t.Errorf("Registered token = %+v", registered)
+	}
+
+	// Another user's token receives nothing about the truck
+	other := env.memberToken(t, "other-user", "")
+	if status := env.doAs(t, other, "", http.MethodPost, "/api/users/push-tokens", model.PushToken{Token: "other-token"}, nil); status != http.StatusOK {
+		t.Fatalf("Registering the other user's token returned status %d", status)
+	}
+
+	conn := env.dialDevice(t)
+	exchange(t, conn, []byte("*HQ,4210051415,V1,120000,A,2237.7514,N,11408.6214,E,0,0,151022,FFFBFFFF#"))
+	select {
+	case push := <-pushes:
+		if push.Token != "phone-token" || push.Notification.Title != "SOS from E2E h02" ||
+			push.Data["deviceId"] != truck.ID || push.Data["eventType"] != model.EventAlarm || push.Data["eventId"] == "" {
+			t.Errorf("Push = %+v", push)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("No push")
+	}
+
+	// The token FCM reported unregistered is forgotten
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		tokens, err := env.app.Repositories.PushTokens.FindByUserID(testUserID)
+		if err != nil {
+			t.Fatalf("Failed to list tokens: %v", err)
+		}
+		if len(tokens) == 1 && tokens[0].Token == "phone-token" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Tokens = %+v, want only phone-token", tokens)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	select {
+	case push := <-pushes:
+		t.Errorf("Unexpected push %+v", push)
+	default:
+	}
+
+	if status := env.do(t, http.MethodPost, "/api/users/push-tokens/delete", model.PushToken{Token: "phone-token"}, nil); status != http.StatusOK {
+		t.Fatalf("Unregistering returned status %d", status)
+	}
+	if tokens, _ := env.app.Repositories.PushTokens.FindByUserID(testUserID); len(tokens) != 0 {
+		t.Errorf("Tokens after unregistering = %+v", tokens)
+	}
+}
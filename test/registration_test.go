@@ -0,0 +1,175 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"tracking/internal/core/model"
+)
+
+type registrationStatus struct {
+	ID        string `json:"id"`
+	Status    string `json:"status"`
+	Token     string `json:"token"`
+	UniqueID  string `json:"uniqueId"`
+	ApiKey    string `json:"apiKey"`
+	IngestURL string `json:"ingestUrl"`
+}
+
+// requestRegistration sends the phone's unauthenticated registration request
+func (e *testEnv) requestRegistration(t *testing.T, name, email string) registrationStatus {
+	t.Helper()
+
+	body, _ := json.Marshal(map[string]string{"name": name, "email": email})
+	resp, err := http.Post(e.baseURL+"/api/device-registrations", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("Registration request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("Registration request returned status %d", resp.StatusCode)
+	}
+	var reg registrationStatus
+	if err := json.NewDecoder(resp.Body).Decode(&reg); err != nil {
+		t.Fatalf("Failed to decode registration: %v", err)
+	}
+	return reg
+}
+
+// pollRegistration fetches the registration status the way the phone does
+func (e *testEnv) pollRegistration(t *testing.T, id, token string) (registrationStatus, int) {
+	t.Helper()
+
+	resp, err := http.Get(e.baseURL + "/api/device-registrations/status?id=" + id + "&token=" + token)
+	if err != nil {
+		t.Fatalf("Registration status request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var reg registrationStatus
+	if resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(&reg); err != nil {
+			t.Fatalf("Failed to decode registration status: %v", err)
+		}
+	}
+	return reg, resp.StatusCode
+}
+
+func TestPhoneSelfRegistration(t *testing.T) {
+	env := newTestEnv(t)
+
+	reg := env.requestRegistration(t, "Pixel 8", "Test@Example.com")
+	if reg.Status != model.RegistrationPending || reg.Token == "" {
+		t.Fatalf("Registration = %+v, want pending with a token", reg)
+	}
+
+	polled, status := env.pollRegistration(t, reg.ID, reg.Token)
+	if status != http.StatusOK || polled.Status != model.RegistrationPending || polled.ApiKey != "" {
+		t.Fatalf("Pending poll = %d %+v, want pending without credentials", status, polled)
+	}
+	if _, status := env.pollRegistration(t, reg.ID, "wrong"); status != http.StatusNotFound {
+		t.Errorf("Poll with a wrong token returned %d, want 404", status)
+	}
+
+	var pending []*model.DeviceRegistration
+	if status := env.do(t, http.MethodGet, "/api/device-registrations/list", nil, &pending); status != http.StatusOK {
+		t.Fatalf("Pending list returned status %d", status)
+	}
+	if len(pending) != 1 || pending[0].ID != reg.ID || pending[0].Name != "Pixel 8" {
+		t.Fatalf("Pending registrations = %+v, want the phone's request", pending)
+	}
+
+	var device model.Device
+	if status := env.do(t, http.MethodPut, "/api/device-registrations/approve?id="+reg.ID, nil, &device); status != http.StatusOK {
+		t.Fatalf("Approve returned status %d", status)
+	}
+	if device.Protocol != "osmand" || device.UserID != testUserID || len(device.UniqueID) != 12 {
+		t.Errorf("Approved device = %+v, want a 12 digit osmand device of the test user", device)
+	}
+
+	polled, _ = env.pollRegistration(t, reg.ID, reg.Token)
+	if polled.Status != model.RegistrationApproved || polled.UniqueID != device.UniqueID || polled.ApiKey == "" {
+		t.Fatalf("Approved poll = %+v, want the device credentials", polled)
+	}
+	if !strings.HasPrefix(polled.IngestURL, env.baseURL+"/api/osmand?") {
+		t.Fatalf("Ingest URL = %s, want the OsmAnd endpoint of %s", polled.IngestURL, env.baseURL)
+	}
+
+	// The phone app appends its report to the ingest URL
+	resp, err := http.Get(polled.IngestURL + "&lat=52.52&lon=13.405&timestamp=1665836113&speed=10&batt=81")
+	if err != nil {
+		t.Fatalf("OsmAnd report failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("OsmAnd report returned status %d", resp.StatusCode)
+	}
+
+	positions := env.positions(t, device.ID)
+	if len(positions) != 1 {
+		t.Fatalf("Got %d positions, want 1", len(positions))
+	}
+	if position := positions[0]; position.Protocol != "osmand" || !almostEqual(position.Latitude, 52.52, 0.0001) ||
+		!position.Timestamp.Equal(time.Unix(1665836113, 0)) {
+		t.Errorf("Position = %+v", position)
+	}
+	stored, _ := env.deviceRepo.FindByID(device.ID)
+	if stored.Status != "active" || stored.PositionID != positions[0].ID {
+		t.Errorf("Device status = %s, positionId = %s, want active, %s", stored.Status, stored.PositionID, positions[0].ID)
+	}
+
+	params := url.Values{"id": {device.UniqueID}, "key": {"not-the-key"}, "lat": {"1"}, "lon": {"2"}}
+	resp, err = http.Get(env.baseURL + "/api/osmand?" + params.Encode())
+	if err != nil {
+		t.Fatalf("OsmAnd report failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Report with a wrong key returned status %d, want 401", resp.StatusCode)
+	}
+
+	if status := env.do(t, http.MethodPut, "/api/device-registrations/approve?id="+reg.ID, nil, nil); status != http.StatusBadRequest {
+		t.Errorf("Second approval returned status %d, want 400", status)
+	}
+}
+
+func TestPhoneRegistrationRejectAndExpiry(t *testing.T) {
+	env := newTestEnv(t)
+
+	rejected := env.requestRegistration(t, "Old phone", "test@example.com")
+	if status := env.do(t, http.MethodPut, "/api/device-registrations/reject?id="+rejected.ID, nil, nil); status != http.StatusNoContent {
+		t.Fatalf("Reject returned status %d", status)
+	}
+	if polled, _ := env.pollRegistration(t, rejected.ID, rejected.Token); polled.Status != model.RegistrationRejected {
+		t.Errorf("Rejected poll = %+v, want rejected", polled)
+	}
+
+	// Registrations for other accounts are invisible to the test user
+	other := env.requestRegistration(t, "Someone else", "other@example.com")
+	if status := env.do(t, http.MethodPut, "/api/device-registrations/approve?id="+other.ID, nil, nil); status != http.StatusBadRequest {
+		t.Errorf("Approving another account's registration returned status %d, want 400", status)
+	}
+
+	stale := env.requestRegistration(t, "Slow phone", "test@example.com")
+	env.clock.Advance(25 * time.Hour)
+
+	var pending []*model.DeviceRegistration
+	env.do(t, http.MethodGet, "/api/device-registrations/list", nil, &pending)
+	if len(pending) != 0 {
+		t.Errorf("Got %d pending registrations after expiry, want 0", len(pending))
+	}
+	if polled, _ := env.pollRegistration(t, stale.ID, stale.Token); polled.Status != model.RegistrationExpired {
+		t.Errorf("Stale poll = %+v, want expired", polled)
+	}
+
+	devices, _ := env.deviceRepo.FindAll()
+	if len(devices) != 0 {
+		t.Errorf("Got %d devices, want none without an approval", len(devices))
+	}
+}
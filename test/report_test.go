@@ -0,0 +1,233 @@
+package test
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"testing"
+	"time"
+
+	"tracking/internal/core/model"
+	"tracking/internal/core/util"
+)
+
+// h02DatedFrame is a standing report from device 4210051415 on the given
+// day, at a latitude in minutes and 114°08.6214'E
+func h02DatedFrame(date, at, lat string) []byte {
+	return []byte(fmt.Sprintf("*HQ,4210051415,V1,%s,A,%s,N,11408.6214,E,0,0,%s,FFFFFBFF#", at, lat, date))
+}
+
+// h02DatedACCFrame is a fix of device 4210051415 at 22°37.7514'N on the
+// given day with the ACC line on or off
+func h02DatedACCFrame(date, at string, acc bool) []byte {
+	status := "FFFFFFFF"
+	if acc {
+		status = "FFFFFBFF"
+	}
+	return []byte(fmt.Sprintf("*HQ,4210051415,V1,%s,A,2237.7514,N,11408.6214,E,0,0,%s,%s#", at, date, status))
+}
+
+func TestStopReport(t *testing.T) {
+	env := newTestEnv(t)
+	truck := env.registerDevice(t, "4210051415", "h02")
+	conn := env.dialDevice(t)
+	send := func(at, lat string, knots int) {
+		t.Helper()
+		exchange(t, conn, h02SpeedFrame(at, lat, knots, 90))
+	}
+	// Parked for 20 minutes while the fix drifts a meter, past one place
+	// without stopping, held up for 3 minutes at another and parked again
+	send("120000", "2237.7514", 0)
+	send("121000", "2237.7520", 0)
+	send("122000", "2237.7514", 0)
+	send("122500", "2238.7514", 30)
+	send("123000", "2239.7514", 0)
+	send("123300", "2239.7514", 0)
+	send("124000", "2240.7514", 0)
+	send("130000", "2240.7514", 0)
+
+	day := "from=2022-10-15T00:00:00Z&to=2022-10-16T00:00:00Z"
+	var report model.StopReport
+	if status := env.do(t, http.MethodGet, "/api/reports/stops?deviceId="+truck.ID+"&"+day, nil, &report); status != http.StatusOK {
+		t.Fatalf("Stop report returned status %d", status)
+	}
+	if len(report.Stops) != 2 || report.MinDuration != 300 || report.TotalDuration != 2400 {
+		t.Fatalf("Report = %+v, want two stops of 20 minutes", report)
+	}
+	first, last := report.Stops[0], report.Stops[1]
+	if !first.StartTime.Equal(time.Date(2022, 10, 15, 12, 0, 0, 0, time.UTC)) || first.Duration != 1200 || first.Positions != 3 {
+		t.Errorf("First stop = %+v, want 12:00 for 20 minutes over 3 positions", first)
+	}
+	if !last.StartTime.Equal(time.Date(2022, 10, 15, 12, 40, 0, 0, time.UTC)) || !last.EndTime.Equal(time.Date(2022, 10, 15, 13, 0, 0, 0, time.UTC)) {
+		t.Errorf("Last stop = %+v, want 12:40 to 13:00", last)
+	}
+
+	// Shorter stays count when asked for
+	if status := env.do(t, http.MethodGet, "/api/reports/stops?deviceId="+truck.ID+"&minDuration=2&"+day, nil, &report); status != http.StatusOK {
+		t.Fatalf("Stop report returned status %d", status)
+	}
+	if len(report.Stops) != 3 || report.Stops[1].Duration != 180 {
+		t.Errorf("Stops of 2 minutes = %+v, want the 3 minute one too", report.Stops)
+	}
+
+	// The range cuts stays short
+	if status := env.do(t, http.MethodGet, "/api/reports/stops?deviceId="+truck.ID+"&from=2022-10-15T12:15:00Z&to=2022-10-15T12:45:00Z", nil, &report); status != http.StatusOK {
+		t.Fatalf("Stop report returned status %d", status)
+	}
+	if len(report.Stops) != 0 {
+		t.Errorf("Stops between 12:15 and 12:45 = %+v, want none", report.Stops)
+	}
+
+	for _, query := range []string{
+		"deviceId=" + truck.ID,
+		"deviceId=" + truck.ID + "&from=2022-10-16T00:00:00Z&to=2022-10-15T00:00:00Z",
+		"deviceId=" + truck.ID + "&from=2022-09-01T00:00:00Z&to=2022-10-15T00:00:00Z",
+		"deviceId=" + truck.ID + "&minDuration=soon&" + day,
+	} {
+		if status := env.do(t, http.MethodGet, "/api/reports/stops?"+query, nil, nil); status != http.StatusBadRequest {
+			t.Errorf("Stop report with %s returned status %d, want 400", query, status)
+		}
+	}
+	if status := env.do(t, http.MethodGet, "/api/reports/stops?deviceId=unknown&"+day, nil, nil); status != http.StatusNotFound {
+		t.Errorf("Stop report of an unknown device returned status %d, want 404", status)
+	}
+}
+
+func TestMileageReport(t *testing.T) {
+	env := newTestEnv(t)
+	truck := env.registerDevice(t, "4210051415", "h02")
+	// Between whole minutes of latitude, at the precision coordinates are
+	// kept to
+	leg := func(from, to int) float64 {
+		return util.Distance(util.RoundCoordinate(22+float64(from)/60), util.RoundCoordinate(114+8.6214/60),
+			util.RoundCoordinate(22+float64(to)/60), util.RoundCoordinate(114+8.6214/60))
+	}
+
+	conn := env.dialDevice(t)
+	send := func(date, at, lat string) {
+		t.Helper()
+		exchange(t, conn, h02DatedFrame(date, at, lat))
+	}
+	// A leg on Friday and one on Saturday, when the receiver jumps a degree
+	// away for a minute, none on Sunday and one on Monday
+	send("141022", "120000", "2237.0000")
+	send("141022", "123000", "2238.0000")
+	send("151022", "120000", "2239.0000")
+	send("151022", "120100", "2339.0000")
+	send("151022", "120200", "2239.0000")
+	send("171022", "120000", "2240.0000")
+
+	near := func(got, want float64) bool { return math.Abs(got-want) < 1e-6 }
+	week := "from=2022-10-14T00:00:00Z&to=2022-10-18T00:00:00Z"
+	var report model.MileageReport
+	if status := env.do(t, http.MethodGet, "/api/reports/mileage?deviceId="+truck.ID+"&"+week, nil, &report); status != http.StatusOK {
+		t.Fatalf("Mileage report returned status %d", status)
+	}
+	daily := []float64{leg(37, 38), leg(38, 39), 0, leg(39, 40)}
+	if len(report.Periods) != len(daily) || report.Period != model.ReportDaily {
+		t.Fatalf("Report = %+v, want %d days", report, len(daily))
+	}
+	for i, want := range daily {
+		period := report.Periods[i]
+		day := time.Date(2022, 10, 14+i, 0, 0, 0, 0, time.UTC)
+		if !period.Start.Equal(day) || !period.End.Equal(day.AddDate(0, 0, 1)) || !near(period.Distance, want) {
+			t.Errorf("Day %d = %+v, want %.1f m on %s", i, period, want, day.Format("2006-01-02"))
+		}
+	}
+	total := leg(37, 38) + leg(38, 39) + leg(39, 40)
+	if !near(report.Distance, total) {
+		t.Errorf("Distance = %.1f m, want %.1f m", report.Distance, total)
+	}
+
+	// Weeks start on Monday and are cut to the range
+	if status := env.do(t, http.MethodGet, "/api/reports/mileage?deviceId="+truck.ID+"&period=week&"+week, nil, &report); status != http.StatusOK {
+		t.Fatalf("Mileage report returned status %d", status)
+	}
+	if len(report.Periods) != 2 || !report.Periods[0].Start.Equal(time.Date(2022, 10, 14, 0, 0, 0, 0, time.UTC)) ||
+		!report.Periods[1].Start.Equal(time.Date(2022, 10, 17, 0, 0, 0, 0, time.UTC)) ||
+		!near(report.Periods[0].Distance, leg(37, 38)+leg(38, 39)) || !near(report.Periods[1].Distance, leg(39, 40)) {
+		t.Errorf("Weeks = %+v", report.Periods)
+	}
+
+	// The odometer of the device follows, jumps left out, and takes a
+	// baseline at once
+	stored, err := env.deviceRepo.FindByID(truck.ID)
+	if err != nil || stored == nil || !near(stored.Odometer, total) {
+		t.Fatalf("Odometer = %+v, want %.1f m", stored, total)
+	}
+	odometer := 250000.0
+	if status := env.do(t, http.MethodPut, "/api/devices/accumulators", model.AccumulatorBaseline{DeviceID: truck.ID, TotalDistance: &odometer}, nil); status != http.StatusOK {
+		t.Fatalf("Setting accumulators returned status %d", status)
+	}
+	if stored, _ = env.deviceRepo.FindByID(truck.ID); stored.Odometer != odometer {
+		t.Errorf("Odometer after the baseline = %.1f m, want %.0f m", stored.Odometer, odometer)
+	}
+
+	for _, query := range []string{
+		"deviceId=" + truck.ID + "&period=month&" + week,
+		"deviceId=" + truck.ID + "&from=2021-01-01T00:00:00Z&to=2022-10-15T00:00:00Z",
+	} {
+		if status := env.do(t, http.MethodGet, "/api/reports/mileage?"+query, nil, nil); status != http.StatusBadRequest {
+			t.Errorf("Mileage report with %s returned status %d, want 400", query, status)
+		}
+	}
+}
+
+func TestEngineHoursReport(t *testing.T) {
+	env := newTestEnv(t)
+	truck := env.registerDevice(t, "4210051415", "h02")
+	conn := env.dialDevice(t)
+	send := func(date, at string, acc bool) {
+		t.Helper()
+		exchange(t, conn, h02DatedACCFrame(date, at, acc))
+	}
+	// A night shift from 22:00 on Friday to 01:00 on Saturday, and half an
+	// hour on Saturday morning
+	send("141022", "220000", true)
+	send("141022", "230000", true)
+	send("141022", "234000", true)
+	send("151022", "002000", true)
+	send("151022", "010000", false)
+	send("151022", "100000", true)
+	send("151022", "103000", false)
+
+	near := func(got, want float64) bool { return math.Abs(got-want) < 1e-9 }
+	days := "from=2022-10-14T00:00:00Z&to=2022-10-17T00:00:00Z"
+	var report model.EngineHoursReport
+	if status := env.do(t, http.MethodGet, "/api/reports/engine-hours?deviceId="+truck.ID+"&"+days, nil, &report); status != http.StatusOK {
+		t.Fatalf("Engine hours report returned status %d", status)
+	}
+	daily := []float64{2, 1.5, 0}
+	if len(report.Periods) != len(daily) || report.Period != model.ReportDaily || !near(report.EngineHours, 3.5) {
+		t.Fatalf("Report = %+v, want 3.5 h over %d days", report, len(daily))
+	}
+	// The 40 minutes running past midnight is split between the days
+	for i, want := range daily {
+		if period := report.Periods[i]; !near(period.EngineHours, want) {
+			t.Errorf("Day %d = %+v, want %.1f h", i, period, want)
+		}
+	}
+
+	if status := env.do(t, http.MethodGet, "/api/reports/engine-hours?deviceId="+truck.ID+"&period=week&"+days, nil, &report); status != http.StatusOK {
+		t.Fatalf("Engine hours report returned status %d", status)
+	}
+	if len(report.Periods) != 1 || !report.Periods[0].End.Equal(time.Date(2022, 10, 17, 0, 0, 0, 0, time.UTC)) || !near(report.Periods[0].EngineHours, 3.5) {
+		t.Errorf("Weeks = %+v, want one of 3.5 h", report.Periods)
+	}
+
+	// Only the shift after 23:00 is in range
+	if status := env.do(t, http.MethodGet, "/api/reports/engine-hours?deviceId="+truck.ID+"&from=2022-10-14T23:00:00Z&to=2022-10-15T12:00:00Z", nil, &report); status != http.StatusOK {
+		t.Fatalf("Engine hours report returned status %d", status)
+	}
+	if len(report.Periods) != 2 || !near(report.Periods[0].EngineHours, 1) || !near(report.Periods[1].EngineHours, 1.5) {
+		t.Errorf("Days from 23:00 = %+v, want 1 h and 1.5 h", report.Periods)
+	}
+
+	if status := env.do(t, http.MethodGet, "/api/reports/engine-hours?deviceId="+truck.ID+"&period=month&"+days, nil, nil); status != http.StatusBadRequest {
+		t.Errorf("Engine hours by month returned status %d, want 400", status)
+	}
+	member := env.memberToken(t, "member-1", "")
+	if status := env.doAs(t, member, "", http.MethodGet, "/api/reports/engine-hours?deviceId="+truck.ID+"&"+days, nil, nil); status != http.StatusNotFound && status != http.StatusForbidden {
+		t.Errorf("Engine hours of another's device returned status %d", status)
+	}
+}
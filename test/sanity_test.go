@@ -0,0 +1,73 @@
+package test
+
+import (
+	"testing"
+
+	"tracking/internal/config"
+	"tracking/internal/core/sanity"
+)
+
+func TestImplausiblePositionsRejected(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.PositionFilterMode = sanity.ModeReject
+		cfg.PositionFilterMaxSpeed = 300
+	})
+	device := env.registerDevice(t, "4210051415", "h02")
+
+	// Every frame is answered so the device moves on, stored or not
+	conn := env.dialDevice(t)
+	for _, frame := range [][]byte{
+		h02SpeedFrame("120000", "2237.7514", 20, 0),
+		h02SpeedFrame("120010", "2337.7514", 20, 0), // 111 km north in 10 s
+		h02SpeedFrame("120020", "2237.7614", 20, 0),
+		[]byte("*HQ,4210051415,V1,120030,A,0000.0000,N,00000.0000,E,0,0,151022,FFFFFBFF#"),
+		// The device was carried away without reporting: the first fix
+		// there is dropped, the second agrees with it and is taken
+		h02SpeedFrame("120100", "2337.7514", 20, 0),
+		h02SpeedFrame("120110", "2337.7614", 20, 0),
+	} {
+		exchange(t, conn, frame)
+	}
+
+	positions := env.positions(t, device.ID)
+	if len(positions) != 3 {
+		t.Fatalf("Got %d positions, want 3", len(positions))
+	}
+	for _, position := range positions {
+		if position.Latitude == 0 || position.Timestamp.Format("150405") == "120010" || position.Timestamp.Format("150405") == "120100" {
+			t.Errorf("Implausible fix at %v stored: %.4f, %.4f", position.Timestamp, position.Latitude, position.Longitude)
+		}
+	}
+}
+
+func TestImplausiblePositionsFlagged(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.PositionFilterMode = sanity.ModeFlag
+		cfg.PositionFilterMaxSpeed = 300
+		cfg.PositionFilterMinSatellites = 20
+	})
+	tracker := env.registerDevice(t, "0353413532881372", "gt06")
+	truck := env.registerDevice(t, "4210051415", "h02")
+
+	conn := env.dialDevice(t)
+	exchange(t, conn, gt06LoginFrame)
+	exchange(t, conn, gt06LocationFrame)
+	positions := env.positions(t, tracker.ID)
+	if len(positions) != 1 || positions[0].Valid || positions[0].Status[sanity.AttributeFiltered] != sanity.ReasonAccuracy {
+		t.Fatalf("Positions = %+v, want one flagged for accuracy", positions)
+	}
+
+	conn = env.dialDevice(t)
+	exchange(t, conn, h02SpeedFrame("120000", "2237.7514", 20, 0))
+	exchange(t, conn, h02SpeedFrame("120010", "2337.7514", 20, 0))
+	positions = env.positions(t, truck.ID)
+	if len(positions) != 2 {
+		t.Fatalf("Got %d positions, want both stored", len(positions))
+	}
+	for _, position := range positions {
+		teleport := position.Latitude > 23
+		if position.Valid == teleport || (position.Status[sanity.AttributeFiltered] == sanity.ReasonImpossible) != teleport {
+			t.Errorf("Position at %.4f: valid %v, status %v", position.Latitude, position.Valid, position.Status)
+		}
+	}
+}
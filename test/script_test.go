@@ -0,0 +1,195 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"tracking/internal/config"
+	"tracking/internal/core/model"
+	"tracking/internal/core/script"
+)
+
+func TestScriptLanguage(t *testing.T) {
+	inputs := map[string]interface{}{
+		"speed":      40.0,
+		"fuelSensor": uint16(1900),
+		"protocol":   "gt06",
+	}
+
+	tests := []struct {
+		name    string
+		source  string
+		want    map[string]interface{}
+		wantErr error
+	}{
+		{"arithmetic and precedence", "x = 1 + 2 * 3 - (4 - 2) / 2", map[string]interface{}{"x": 6.0}, nil},
+		{"calibration curve", "fuel = interpolate(fuelSensor, 0, 0, 1200, 40, 2600, 95)", map[string]interface{}{"fuel": 67.5}, nil},
+		{"curve clamps", "low = interpolate(-5, 0, 1, 10, 2); high = interpolate(99, 0, 1, 10, 2)", map[string]interface{}{"low": 1.0, "high": 2.0}, nil},
+		{"locals and hidden names", "_kmh = speed * 1.852\nfast = _kmh > 60", map[string]interface{}{"fast": true}, nil},
+		{"strings and logic", `label = protocol + "-" + round(speed / 3, 1); gt = protocol == "gt06" && !false`, map[string]interface{}{"label": "gt06-13.3", "gt": true}, nil},
+		{"lazy if and attr", `x = if(speed > 100, 1 / 0, attr("missing", 7))`, map[string]interface{}{"x": 7.0}, nil},
+		{"functions", "a = min(3, 1, 2) + max(4, 5) + abs(-1) + floor(1.7) + ceil(1.2) + sqrt(16) + pow(2, 3)", map[string]interface{}{"a": 22.0}, nil},
+		{"comments", "# header\ny = 2 # trailing", map[string]interface{}{"y": 2.0}, nil},
+		{"syntax error", "x = (1 + 2", nil, script.ErrSyntax},
+		{"unknown function", "x = exec(1)", nil, script.ErrSyntax},
+		{"bare expression", "1 + 2", nil, script.ErrSyntax},
+		{"undefined variable", "x = nope + 1", nil, script.ErrRuntime},
+		{"division by zero", "x = speed / 0", nil, script.ErrRuntime},
+		{"type mismatch", "x = speed - protocol", nil, script.ErrRuntime},
+		{"not finite", "x = sqrt(-1)", nil, script.ErrRuntime},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			program, err := script.Compile(tt.source)
+			var got map[string]interface{}
+			if err == nil {
+				got, err = program.Run(context.Background(), inputs)
+			}
+
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("outputs = %v, want %v", got, tt.want)
+			}
+			for name, want := range tt.want {
+				if f, ok := want.(float64); ok {
+					if g, ok := got[name].(float64); !ok || !almostEqual(g, f, 1e-9) {
+						t.Errorf("%s = %v, want %v", name, got[name], want)
+					}
+				} else if got[name] != want {
+					t.Errorf("%s = %v, want %v", name, got[name], want)
+				}
+			}
+		})
+	}
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	long := "x = 0"
+	for i := 0; i < 100; i++ {
+		long += " + 1"
+	}
+	program, err := script.Compile(long)
+	if err != nil {
+		t.Fatalf("Compile() unexpected error: %v", err)
+	}
+	if _, err := program.Run(canceled, nil); !errors.Is(err, script.ErrRuntime) {
+		t.Errorf("Run() with canceled context error = %v, want ErrRuntime", err)
+	}
+
+	// Doubling a string every line would reach gigabytes well within the
+	// step budget
+	doubling := `a = "xxxxxxxx"`
+	for i := 0; i < 30; i++ {
+		doubling += "\na = a + a"
+	}
+	program, err = script.Compile(doubling)
+	if err != nil {
+		t.Fatalf("Compile() unexpected error: %v", err)
+	}
+	if _, err := program.Run(context.Background(), nil); !errors.Is(err, script.ErrRuntime) {
+		t.Errorf("Run() doubling a string error = %v, want ErrRuntime", err)
+	}
+}
+
+func TestAttributeScripts(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) { cfg.ScriptingEnabled = true })
+	device := env.registerDevice(t, "0353413532881372", "gt06")
+	device.Model = "GT06N"
+	if err := env.deviceRepo.Update(device); err != nil {
+		t.Fatalf("Failed to set device model: %v", err)
+	}
+
+	invalid := map[string]string{"name": "broken", "deviceModel": "GT06N", "source": "x = (1"}
+	if status := env.do(t, http.MethodPost, "/api/admin/scripts", invalid, nil); status != http.StatusBadRequest {
+		t.Errorf("Invalid script returned status %d, want %d", status, http.StatusBadRequest)
+	}
+
+	var created model.Script
+	request := map[string]string{
+		"name":        "fuel",
+		"deviceModel": "GT06N",
+		"source":      "fuel = interpolate(speed, 0, 0, 100, 50)\nmoving = speed > 5",
+	}
+	if status := env.do(t, http.MethodPost, "/api/admin/scripts", request, &created); status != http.StatusOK {
+		t.Fatalf("Creating script returned status %d", status)
+	}
+	if !created.Enabled || created.ID == "" {
+		t.Errorf("Created script = %+v", created)
+	}
+
+	// A failing script is skipped without losing the position
+	failing := map[string]string{"name": "failing", "deviceModel": "GT06N", "source": "x = missing * 2"}
+	if status := env.do(t, http.MethodPost, "/api/admin/scripts", failing, nil); status != http.StatusOK {
+		t.Fatalf("Creating failing script returned status %d", status)
+	}
+	// Scripts for other models do not run
+	other := map[string]string{"name": "other", "deviceModel": "TK103", "source": "other = 1"}
+	if status := env.do(t, http.MethodPost, "/api/admin/scripts", other, nil); status != http.StatusOK {
+		t.Fatalf("Creating other script returned status %d", status)
+	}
+
+	var scripts []*model.Script
+	if status := env.do(t, http.MethodGet, "/api/admin/scripts/list", nil, &scripts); status != http.StatusOK || len(scripts) != 3 {
+		t.Fatalf("Listing scripts returned status %d with %d scripts", status, len(scripts))
+	}
+
+	conn := env.dialDevice(t)
+	exchange(t, conn, gt06LoginFrame)
+	exchange(t, conn, gt06LocationFrame)
+
+	positions := env.positions(t, device.ID)
+	if len(positions) != 1 {
+		t.Fatalf("Got %d positions, want 1", len(positions))
+	}
+	status := positions[0].Status
+	if status["fuel"] != 20.0 || status["moving"] != true {
+		t.Errorf("Status = %v, want fuel 20 and moving true", status)
+	}
+	if _, ok := status["x"]; ok {
+		t.Errorf("Failing script wrote x: %v", status)
+	}
+	if _, ok := status["other"]; ok {
+		t.Errorf("Script for another model ran: %v", status)
+	}
+
+	disabled := false
+	update := map[string]interface{}{
+		"name":        "fuel",
+		"deviceModel": "GT06N",
+		"source":      "fuel = 1",
+		"enabled":     &disabled,
+	}
+	var updated model.Script
+	if code := env.do(t, http.MethodPut, "/api/admin/scripts/update?id="+created.ID, update, &updated); code != http.StatusOK {
+		t.Fatalf("Updating script returned status %d", code)
+	}
+	if updated.Enabled || updated.Source != "fuel = 1" {
+		t.Errorf("Updated script = %+v", updated)
+	}
+
+	if code := env.do(t, http.MethodDelete, "/api/admin/scripts/delete?id="+created.ID, nil, nil); code != http.StatusNoContent {
+		t.Errorf("Deleting script returned status %d", code)
+	}
+	if code := env.do(t, http.MethodGet, "/api/admin/scripts/get?id="+created.ID, nil, nil); code != http.StatusNotFound {
+		t.Errorf("Deleted script returned status %d, want %d", code, http.StatusNotFound)
+	}
+}
+
+func TestScriptAdminRequiresScripting(t *testing.T) {
+	env := newTestEnv(t)
+
+	if status := env.do(t, http.MethodGet, "/api/admin/scripts/list", nil, nil); status != http.StatusNotFound {
+		t.Errorf("Script API without scripting returned status %d, want %d", status, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,100 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"tracking/internal/app"
+	"tracking/internal/core/model"
+	"tracking/internal/core/service"
+	"tracking/internal/seed"
+)
+
+func TestSeedDemoData(t *testing.T) {
+	routes, err := seed.LoadRoutes()
+	if err != nil || len(routes) == 0 {
+		t.Fatalf("LoadRoutes() = %d routes, %v", len(routes), err)
+	}
+	for _, route := range routes {
+		if route.Length() < 1000 {
+			t.Errorf("Route %s is %.0f m long", route.Name, route.Length())
+		}
+	}
+
+	end := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	opts := seed.Options{
+		Organizations:          2,
+		UsersPerOrganization:   2,
+		DevicesPerOrganization: 3,
+		Days:                   2,
+		TripsPerDay:            2,
+		Interval:               time.Minute,
+		End:                    end,
+		Seed:                   7,
+	}
+	repos := app.NewInMemoryRepositories()
+	summary, err := seed.Run(repos, opts)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if summary.Organizations != 2 || summary.Users != 4 || summary.Devices != 6 || summary.Positions == 0 {
+		t.Fatalf("Summary = %+v", summary)
+	}
+
+	if _, err := service.NewUserService(repos.Users).AuthenticateUser("demo2.user2@example.com", seed.DemoPassword); err != nil {
+		t.Errorf("Seeded user cannot sign in: %v", err)
+	}
+
+	devices, _ := repos.Devices.FindAll()
+	total := 0
+	for _, device := range devices {
+		if device.OrganizationID == "" || device.Model == "" || device.PositionID == "" {
+			t.Errorf("Device = %+v", device)
+		}
+		positions, _ := repos.Positions.FindByDeviceID(device.ID)
+		total += len(positions)
+		for _, position := range positions {
+			if position.Timestamp.After(end) || position.Timestamp.Before(end.AddDate(0, 0, -opts.Days)) {
+				t.Fatalf("Position at %v outside the seeded days", position.Timestamp)
+			}
+			if !nearRoute(routes, position) {
+				t.Fatalf("Position %f,%f is off every route", position.Latitude, position.Longitude)
+			}
+		}
+	}
+	if total != summary.Positions {
+		t.Errorf("Stored %d positions, summary says %d", total, summary.Positions)
+	}
+
+	// The same seed drives the same tracks
+	again, _ := seed.Run(app.NewInMemoryRepositories(), opts)
+	if again.Positions != summary.Positions {
+		t.Errorf("Second run stored %d positions, want %d", again.Positions, summary.Positions)
+	}
+}
+
+// nearRoute reports whether a position lies on the bounding box of a route
+func nearRoute(routes []*seed.Route, position *model.Position) bool {
+	for _, route := range routes {
+		minLat, maxLat := route.Points[0].Lat, route.Points[0].Lat
+		minLon, maxLon := route.Points[0].Lon, route.Points[0].Lon
+		for _, p := range route.Points {
+			if p.Lat < minLat {
+				minLat = p.Lat
+			}
+			if p.Lat > maxLat {
+				maxLat = p.Lat
+			}
+			if p.Lon < minLon {
+				minLon = p.Lon
+			}
+			if p.Lon > maxLon {
+				maxLon = p.Lon
+			}
+		}
+		if position.Latitude >= minLat && position.Latitude <= maxLat && position.Longitude >= minLon && position.Longitude <= maxLon {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,112 @@
+package test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"tracking/internal/core/model"
+	"tracking/internal/protocol/gt06"
+)
+
+func TestDeviceSessions(t *testing.T) {
+	env := newTestEnv(t)
+	tracker := env.registerDevice(t, "0353413532881372", "gt06")
+	logger := env.registerDevice(t, "4634616396", "calamp")
+
+	sessions := func() map[string]*model.DeviceSession {
+		t.Helper()
+		var list []*model.DeviceSession
+		if status := env.do(t, http.MethodGet, "/api/devices/sessions", nil, &list); status != http.StatusOK {
+			t.Fatalf("Listing sessions returned status %d", status)
+		}
+		byDevice := make(map[string]*model.DeviceSession)
+		for _, session := range list {
+			byDevice[session.DeviceID] = session
+		}
+		return byDevice
+	}
+	status := func(device *model.Device) string {
+		t.Helper()
+		var got model.Device
+		if code := env.do(t, http.MethodGet, "/api/devices/get?id="+device.ID, nil, &got); code != http.StatusOK {
+			t.Fatalf("Getting device returned status %d", code)
+		}
+		return got.Status
+	}
+
+	if got := status(tracker); got != model.DeviceOffline {
+		t.Errorf("Status before connecting = %s, want offline", got)
+	}
+
+	conn := env.dialDevice(t)
+	exchange(t, conn, gt06LoginFrame)
+	session := sessions()[tracker.ID]
+	if session == nil {
+		t.Fatal("No session for the connected device")
+	}
+	if session.Protocol != "gt06" || session.Transport != "tcp" || session.RemoteAddr != conn.LocalAddr().String() {
+		t.Errorf("Session %+v, want gt06 over tcp from %s", session, conn.LocalAddr())
+	}
+	if !session.ConnectedAt.Equal(testStart) {
+		t.Errorf("Connected at %v, want %v", session.ConnectedAt, testStart)
+	}
+	if got := status(tracker); got != model.DeviceOnline {
+		t.Errorf("Status while connected = %s, want online", got)
+	}
+
+	// Every packet moves the last seen time, not the connect time
+	env.clock.Advance(time.Minute)
+	exchange(t, conn, gt06Heartbeat(gt06.TerminalGPSTracking, 0x10))
+	if session := sessions()[tracker.ID]; !session.LastSeen.Equal(testStart.Add(time.Minute)) || !session.ConnectedAt.Equal(testStart) {
+		t.Errorf("Session after heartbeat %+v, want last seen a minute after connecting", session)
+	}
+
+	// Datagram devices stay online for a while after reporting
+	udp := env.dialUDP(t)
+	if _, err := udp.Write(calampReport(0x100, testStart)); err != nil {
+		t.Fatalf("Failed to send report: %v", err)
+	}
+	udp.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := udp.Read(make([]byte, 64)); err != nil {
+		t.Fatalf("No ACK for report: %v", err)
+	}
+	if session := sessions()[logger.ID]; session == nil || session.Transport != "udp" {
+		t.Fatalf("Session %+v, want one over udp", session)
+	}
+
+	var devices []*model.Device
+	env.do(t, http.MethodGet, "/api/devices/list?status=online", nil, &devices)
+	if len(devices) != 2 {
+		t.Errorf("Listed %d online devices, want 2", len(devices))
+	}
+
+	env.clock.Advance(11 * time.Minute)
+	if _, ok := sessions()[logger.ID]; ok {
+		t.Error("UDP session outlived the online timeout")
+	}
+	if got := status(logger); got != model.DeviceOffline {
+		t.Errorf("Status after the timeout = %s, want offline", got)
+	}
+
+	// Closing the connection ends the session
+	conn.Close()
+	deadline := time.Now().Add(2 * time.Second)
+	for sessions()[tracker.ID] != nil {
+		if time.Now().After(deadline) {
+			t.Fatal("Session still open after the connection closed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := status(tracker); got != model.DeviceOffline {
+		t.Errorf("Status after disconnecting = %s, want offline", got)
+	}
+
+	// Sessions of other users' devices are not listed
+	other := env.memberToken(t, "other-user", "")
+	var list []*model.DeviceSession
+	env.doAs(t, other, "", http.MethodGet, "/api/devices/sessions", nil, &list)
+	if len(list) != 0 {
+		t.Errorf("Another user saw %d sessions", len(list))
+	}
+}
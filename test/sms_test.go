@@ -0,0 +1,103 @@
+package test
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"tracking/internal/config"
+)
+
+const smsAuthToken = "sms-gateway-token"
+
+// postSMS delivers an inbound message the way Twilio does, signed with token
+func postSMS(t *testing.T, env *testEnv, token, from, body string) (int, string) {
+	t.Helper()
+
+	target := env.baseURL + "/api/sms/inbound"
+	form := url.Values{"From": {from}, "To": {"+15550009999"}, "Body": {body}, "MessageSid": {"SM0001"}}
+	names := make([]string, 0, len(form))
+	for name := range form {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	mac := hmac.New(sha1.New, []byte(token))
+	mac.Write([]byte(target))
+	for _, name := range names {
+		mac.Write([]byte(name + form.Get(name)))
+	}
+
+	req, err := http.NewRequest(http.MethodPost, target, strings.NewReader(form.Encode()))
+	if err != nil {
+		t.Fatalf("Failed to build request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("X-Twilio-Signature", base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("SMS webhook failed: %v", err)
+	}
+	defer resp.Body.Close()
+	reply, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(reply)
+}
+
+func TestSMSFallback(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) { cfg.SMSAuthToken = smsAuthToken })
+	device := env.registerDevice(t, "0353413532881372", "gt06")
+
+	if status := env.do(t, http.MethodPut, "/api/devices/phone?id="+device.ID,
+		map[string]string{"phone": "+1 (555) 010-0199"}, nil); status != http.StatusOK {
+		t.Fatalf("Setting the phone returned status %d", status)
+	}
+
+	text := "Lat:N22.571285,Lon:E114.025630,Course:90.00,Speed:35.00km/h,DateTime:2024-01-15 09:58:00"
+	if status, _ := postSMS(t, env, "wrong-token", "+15550100199", text); status != http.StatusForbidden {
+		t.Errorf("Unsigned SMS returned status %d, want %d", status, http.StatusForbidden)
+	}
+	if status, reply := postSMS(t, env, smsAuthToken, "+15550100199", text); status != http.StatusOK || !strings.Contains(reply, "<Response>") {
+		t.Fatalf("SMS returned status %d with %q", status, reply)
+	}
+	// Command replies and strangers are acknowledged without a position
+	for _, from := range []string{"+15550100199", "+15550100000"} {
+		if status, _ := postSMS(t, env, smsAuthToken, from, "APN set OK"); status != http.StatusOK {
+			t.Errorf("SMS from %s returned status %d", from, status)
+		}
+	}
+	if status, _ := postSMS(t, env, smsAuthToken, "+15550100000", text); status != http.StatusOK {
+		t.Errorf("SMS from an unknown number returned status %d", status)
+	}
+
+	positions, _ := env.positionRepo.FindByDeviceID(device.ID)
+	if len(positions) != 1 {
+		t.Fatalf("Got %d positions, want 1", len(positions))
+	}
+	position := positions[0]
+	if position.Status["source"] != "sms" || position.Protocol != "sms" ||
+		position.Latitude != 22.571285 || position.Speed != 35 || position.Course != 90 {
+		t.Errorf("Position = %+v", position)
+	}
+	if want := time.Date(2024, 1, 15, 9, 58, 0, 0, time.UTC); !position.Timestamp.Equal(want) {
+		t.Errorf("Timestamp = %v, want %v", position.Timestamp, want)
+	}
+
+	updated, _ := env.deviceRepo.FindByID(device.ID)
+	if updated.PositionID != position.ID {
+		t.Errorf("Device position = %s, want %s", updated.PositionID, position.ID)
+	}
+}
+
+func TestSMSWebhookDisabled(t *testing.T) {
+	env := newTestEnv(t)
+
+	if status, _ := postSMS(t, env, "", "+15550100199", "Lat:N22.5,Lon:E114.0"); status != http.StatusNotFound {
+		t.Errorf("SMS webhook without a token returned status %d, want %d", status, http.StatusNotFound)
+	}
+}
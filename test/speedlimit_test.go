@@ -0,0 +1,183 @@
+package test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"tracking/internal/config"
+	"tracking/internal/core/model"
+	"tracking/internal/core/speedlimit"
+)
+
+// Two roads cross at the position of the H02 fixtures: Main Street runs
+// east-west with a 50 km/h limit and a side street north-south at 30 km/h
+const overpassRoads = `{"elements": [
+	{"type": "way", "id": 1001, "tags": {"highway": "primary", "name": "Main Street", "maxspeed": "50"},
+	 "geometry": [{"lat": 22.62919, "lon": 114.1425}, {"lat": 22.62919, "lon": 114.1445}]},
+	{"type": "way", "id": 1002, "tags": {"highway": "residential", "maxspeed": "30"},
+	 "geometry": [{"lat": 22.6282, "lon": 114.14369}, {"lat": 22.6302, "lon": 114.14369}]}
+]}`
+
+// newOverpassServer serves overpassRoads near the fixtures and nothing
+// elsewhere, counting the queries it answers
+func newOverpassServer(t *testing.T) (*httptest.Server, *int32) {
+	t.Helper()
+
+	var queries int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&queries, 1)
+		query := r.FormValue("data")
+		if !strings.Contains(query, `way["highway"`) {
+			http.Error(w, "unexpected query", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if strings.Contains(query, "(22.619000,") {
+			fmt.Fprint(w, overpassRoads)
+			return
+		}
+		fmt.Fprint(w, `{"elements": []}`)
+	}))
+	t.Cleanup(server.Close)
+	return server, &queries
+}
+
+// h02SpeedFrame reports a position at the given time, speed in knots and course
+func h02SpeedFrame(at, lat string, knots, course int) []byte {
+	return []byte(fmt.Sprintf("*HQ,4210051415,V1,%s,A,%s,N,11408.6214,E,%d,%d,151022,FFFFFBFF#", at, lat, knots, course))
+}
+
+func positionAt(positions []*model.Position, timestamp time.Time) *model.Position {
+	for _, position := range positions {
+		if position.Timestamp.Equal(timestamp) {
+			return position
+		}
+	}
+	return nil
+}
+
+func TestOverspeedAgainstRoadLimit(t *testing.T) {
+	overpass, queries := newOverpassServer(t)
+	env := newTestEnv(t, func(cfg *config.Config) { cfg.SpeedLimitURL = overpass.URL })
+	device := env.registerDevice(t, "4210051415", "h02")
+
+	// The device limit only applies where the road limit is unknown
+	request := map[string]float64{"speedLimit": 80}
+	if status := env.do(t, http.MethodPut, "/api/devices/speed-limit?id="+device.ID, request, nil); status != http.StatusOK {
+		t.Fatalf("Setting the speed limit returned status %d", status)
+	}
+
+	var mutex sync.Mutex
+	var events []*model.Event
+	env.app.Hooks.OnEvent(func(e *model.Event) {
+		if e.Type == model.EventOverspeed {
+			mutex.Lock()
+			events = append(events, e)
+			mutex.Unlock()
+		}
+	})
+
+	conn := env.dialDevice(t)
+	frames := [][]byte{
+		h02SpeedFrame("120000", "2237.7514", 20, 90), // 37 km/h east on Main Street
+		h02SpeedFrame("120010", "2237.7514", 20, 0),  // 37 km/h north on the side street
+		h02SpeedFrame("120020", "2237.7514", 40, 90), // 74 km/h on Main Street
+		h02SpeedFrame("120030", "2237.7514", 45, 90), // Still over the limit
+		h02SpeedFrame("120040", "2242.0000", 40, 90), // 74 km/h off the mapped roads
+	}
+	for _, frame := range frames {
+		if response := exchange(t, conn, frame); string(response) != "*HQ,OK#" {
+			t.Fatalf("Unexpected H02 response %q", response)
+		}
+	}
+
+	positions := env.positions(t, device.ID)
+	at := func(hhmmss string) *model.Position {
+		timestamp, _ := time.Parse("150405", hhmmss)
+		position := positionAt(positions, time.Date(2022, 10, 15, timestamp.Hour(), timestamp.Minute(), timestamp.Second(), 0, time.UTC))
+		if position == nil {
+			t.Fatalf("No position at %s", hhmmss)
+		}
+		return position
+	}
+
+	tests := []struct {
+		time      string
+		limit     float64
+		source    string
+		road      interface{}
+		overspeed bool
+	}{
+		{"120000", 50, speedlimit.SourceRoad, "1001", false},
+		{"120010", 30, speedlimit.SourceRoad, "1002", true},
+		{"120020", 50, speedlimit.SourceRoad, "1001", true},
+		{"120030", 50, speedlimit.SourceRoad, "1001", true},
+		{"120040", 80, speedlimit.SourceDevice, nil, false},
+	}
+	for _, tt := range tests {
+		status := at(tt.time).Status
+		if status[speedlimit.AttributeSpeedLimit] != tt.limit || status[speedlimit.AttributeSpeedLimitSource] != tt.source ||
+			status[speedlimit.AttributeRoadID] != tt.road || status[speedlimit.AttributeOverspeed] != tt.overspeed {
+			t.Errorf("Position at %s status = %v, want limit %v from %s road %v overspeed %v",
+				tt.time, status, tt.limit, tt.source, tt.road, tt.overspeed)
+		}
+	}
+
+	// The event is raised once, on the side street, and not again while
+	// the device stays over the limit in force
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(events) != 1 {
+		t.Fatalf("Got %d overspeed events, want 1: %+v", len(events), events)
+	}
+	if event := events[0]; event.PositionID != at("120010").ID || event.Attributes[speedlimit.AttributeSpeedLimit] != 30.0 ||
+		event.Attributes[speedlimit.AttributeRoadID] != "1002" {
+		t.Errorf("Event = %+v", event)
+	}
+
+	// Each tile is queried once however many positions fall in it
+	if n := atomic.LoadInt32(queries); n != 2 {
+		t.Errorf("Overpass was queried %d times, want 2", n)
+	}
+}
+
+func TestOverspeedAgainstDeviceLimit(t *testing.T) {
+	env := newTestEnv(t)
+	device := env.registerDevice(t, "4210051415", "h02")
+	if status := env.do(t, http.MethodPut, "/api/devices/speed-limit?id="+device.ID, map[string]float64{"speedLimit": -5}, nil); status != http.StatusBadRequest {
+		t.Errorf("Negative speed limit returned status %d, want 400", status)
+	}
+	if status := env.do(t, http.MethodPut, "/api/devices/speed-limit?id="+device.ID, map[string]float64{"speedLimit": 60}, nil); status != http.StatusOK {
+		t.Fatalf("Setting the speed limit returned status %d", status)
+	}
+
+	events := make(chan *model.Event, 4)
+	env.app.Hooks.OnEvent(func(e *model.Event) {
+		if e.Type == model.EventOverspeed {
+			events <- e
+		}
+	})
+
+	conn := env.dialDevice(t)
+	for _, frame := range [][]byte{
+		h02SpeedFrame("120000", "2237.7514", 40, 90), // 74 km/h
+		h02SpeedFrame("120010", "2237.7514", 20, 90), // 37 km/h
+		h02SpeedFrame("120020", "2237.7514", 40, 90), // Over again
+	} {
+		exchange(t, conn, frame)
+	}
+
+	if len(events) != 2 {
+		t.Fatalf("Got %d overspeed events, want 2", len(events))
+	}
+	if event := <-events; event.Attributes[speedlimit.AttributeSpeedLimitSource] != speedlimit.SourceDevice ||
+		event.Attributes[speedlimit.AttributeSpeedLimit] != 60.0 {
+		t.Errorf("Event = %+v", event)
+	}
+}
@@ -0,0 +1,76 @@
+package test
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"tracking/internal/core/metrics"
+)
+
+func getStatus(t *testing.T, env *testEnv) (int, metrics.Status) {
+	t.Helper()
+
+	resp, err := http.Get(env.baseURL + "/status")
+	if err != nil {
+		t.Fatalf("Status request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var status metrics.Status
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		t.Fatalf("Invalid status response: %v", err)
+	}
+	return resp.StatusCode, status
+}
+
+func TestPublicStatus(t *testing.T) {
+	env := newTestEnv(t)
+	device := env.registerDevice(t, "4210051415", "h02")
+	conn := env.dialDevice(t)
+	exchange(t, conn, h02SpeedFrame("120000", "2237.7514", 10, 90))
+	exchange(t, conn, h02SpeedFrame("120010", "2237.7514", 10, 90))
+	env.positions(t, device.ID)
+
+	env.clock.Advance(90 * time.Second)
+	code, status := getStatus(t, env)
+	if code != http.StatusOK || status.Status != "ok" {
+		t.Fatalf("Status = %d %q, want 200 ok", code, status.Status)
+	}
+	if status.UptimeSeconds != 90 || !status.StartedAt.Equal(testStart) {
+		t.Errorf("Uptime = %ds since %v, want 90s since %v", status.UptimeSeconds, status.StartedAt, testStart)
+	}
+	if status.Ingest.LastMinute != 0 || status.Ingest.LastFiveMinutes != 2 || status.Ingest.TotalSinceStartup != 2 {
+		t.Errorf("Ingest = %+v, want 2 positions 90s ago", status.Ingest)
+	}
+	if status.API.Requests == 0 || status.API.P99 < status.API.P50 {
+		t.Errorf("API = %+v, want the requests so far", status.API)
+	}
+	if status.Listeners["tcp"] != "up" || status.Listeners["http"] != "up" {
+		t.Errorf("Listeners = %v, want tcp and http up", status.Listeners)
+	}
+
+	// Nothing in the response identifies a device
+	resp, err := http.Get(env.baseURL + "/status")
+	if err != nil {
+		t.Fatalf("Status request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	var raw json.RawMessage
+	json.NewDecoder(resp.Body).Decode(&raw)
+	if body := string(raw); strings.Contains(body, device.ID) || strings.Contains(body, device.UniqueID) {
+		t.Errorf("Status exposes the device: %s", body)
+	}
+
+	// A stopped device listener degrades the status
+	env.app.TCPServer.Stop()
+	deadline := time.Now().Add(time.Second)
+	for env.app.TCPServer.Listening() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if code, status := getStatus(t, env); code != http.StatusServiceUnavailable || status.Listeners["tcp"] != "down" {
+		t.Errorf("Status after stopping TCP = %d %+v, want 503 with tcp down", code, status)
+	}
+}
@@ -0,0 +1,117 @@
+package test
+
+import (
+	"net/http"
+	"testing"
+
+	"tracking/internal/core/model"
+)
+
+// sync fetches what changed since the cursor
+func (e *testEnv) sync(t *testing.T, query string) *model.SyncResult {
+	t.Helper()
+
+	var result model.SyncResult
+	if status := e.do(t, http.MethodGet, "/api/sync"+query, nil, &result); status != http.StatusOK {
+		t.Fatalf("Sync returned status %d", status)
+	}
+	return &result
+}
+
+func TestSync(t *testing.T) {
+	env := newTestEnv(t)
+	device := env.registerDevice(t, "0353413532881372", "gt06")
+	stranger := model.NewDevice("Someone else's", "0353413532889999")
+	stranger.SetOwnership("other-user", "")
+	if err := env.deviceRepo.Create(stranger); err != nil {
+		t.Fatalf("Failed to create device: %v", err)
+	}
+
+	snapshot := env.sync(t, "")
+	if len(snapshot.Devices) != 1 || snapshot.Devices[0].ID != device.ID || len(snapshot.Positions) != 0 {
+		t.Fatalf("Snapshot = %+v, want only the user's device", snapshot)
+	}
+	if empty := env.sync(t, "?since="+snapshot.Cursor); empty.Cursor != snapshot.Cursor ||
+		len(empty.Devices)+len(empty.Positions)+len(empty.Events)+len(empty.Tombstones) != 0 {
+		t.Errorf("Sync without changes = %+v", empty)
+	}
+
+	conn := env.dialDevice(t)
+	exchange(t, conn, gt06LoginFrame)
+	exchange(t, conn, gt06LocationFrame)
+	env.app.Hooks.Event(model.NewEvent(model.EventDeviceOffline, device.ID, testStart))
+	env.app.Hooks.Event(model.NewEvent(model.EventDeviceOffline, stranger.ID, testStart))
+	stranger.Name = "Renamed"
+	if err := env.deviceRepo.Update(stranger); err != nil {
+		t.Fatalf("Failed to update device: %v", err)
+	}
+
+	changes := env.sync(t, "?since="+snapshot.Cursor)
+	if len(changes.Devices) != 1 || changes.Devices[0].ID != device.ID || changes.Devices[0].PositionID == "" {
+		t.Errorf("Changed devices = %+v, want the device once in its current state", changes.Devices)
+	}
+	if len(changes.Positions) != 1 || changes.Positions[0].DeviceID != device.ID {
+		t.Errorf("Changed positions = %+v", changes.Positions)
+	}
+	offline := 0
+	for _, event := range changes.Events {
+		if event.DeviceID != device.ID {
+			t.Errorf("Synced event %+v of another user's device", event)
+		}
+		if event.Type == model.EventDeviceOffline {
+			offline++
+		}
+	}
+	if offline != 1 {
+		t.Errorf("Synced %d offline events, want 1", offline)
+	}
+	if changes.HasMore {
+		t.Error("Sync reports more changes")
+	}
+
+	// Deleted devices come back as tombstones
+	if err := env.deviceRepo.Delete(device.ID); err != nil {
+		t.Fatalf("Failed to delete device: %v", err)
+	}
+	if err := env.deviceRepo.Delete(stranger.ID); err != nil {
+		t.Fatalf("Failed to delete device: %v", err)
+	}
+	deleted := env.sync(t, "?since="+changes.Cursor)
+	if len(deleted.Tombstones) != 1 || deleted.Tombstones[0].ID != device.ID || deleted.Tombstones[0].Kind != model.ChangeDevice {
+		t.Errorf("Tombstones = %+v, want the user's device", deleted.Tombstones)
+	}
+	if len(deleted.Devices) != 0 {
+		t.Errorf("Deleted devices synced as %+v", deleted.Devices)
+	}
+}
+
+func TestSyncPaging(t *testing.T) {
+	env := newTestEnv(t)
+	start := env.sync(t, "")
+	for _, uniqueID := range []string{"0353413532881372", "0353413532881373", "0353413532881374"} {
+		env.registerDevice(t, uniqueID, "gt06")
+	}
+
+	seen := 0
+	cursor := start.Cursor
+	for pages := 0; ; pages++ {
+		if pages == 3 {
+			t.Fatal("Sync did not run out of changes")
+		}
+		page := env.sync(t, "?limit=2&since="+cursor)
+		seen += len(page.Devices)
+		cursor = page.Cursor
+		if !page.HasMore {
+			break
+		}
+	}
+	if seen != 3 {
+		t.Errorf("Paged through %d devices, want 3", seen)
+	}
+
+	for _, query := range []string{"?since=bogus", "?since=-1", "?limit=0&since=" + cursor} {
+		if status := env.do(t, http.MethodGet, "/api/sync"+query, nil, nil); status != http.StatusBadRequest {
+			t.Errorf("Sync%s returned status %d, want %d", query, status, http.StatusBadRequest)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package test
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"tracking/internal/config"
+	"tracking/internal/core/model"
+)
+
+var tilePNG = []byte("\x89PNG\r\n\x1a\ntile")
+
+// newTileServer serves a PNG for every tile down to zoom 3, counting the
+// tiles it serves and refusing requests without the key
+func newTileServer(t *testing.T, key string) (*httptest.Server, *int32) {
+	t.Helper()
+
+	var fetches int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("apikey") != key {
+			http.Error(w, "invalid key", http.StatusUnauthorized)
+			return
+		}
+		if !strings.HasPrefix(r.URL.Path, "/0/") && !strings.HasPrefix(r.URL.Path, "/3/") {
+			http.NotFound(w, r)
+			return
+		}
+		atomic.AddInt32(&fetches, 1)
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(tilePNG)
+	}))
+	t.Cleanup(server.Close)
+	return server, &fetches
+}
+
+// getTile fetches a tile in the organization, or in none when orgID is
+// empty, and returns the status, the
+// fetches left and the image
+func (e *testEnv) getTile(t *testing.T, orgID, query string) (int, string, []byte) {
+	t.Helper()
+
+	req, _ := http.NewRequest(http.MethodGet, e.baseURL+"/api/tiles?"+query, nil)
+	req.Header.Set("Authorization", "Bearer "+e.token)
+	if orgID != "" {
+		req.Header.Set("X-Organization-ID", orgID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Fetching tile %s failed: %v", query, err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, resp.Header.Get("X-Tile-Remaining"), body
+}
+
+func TestTileProxy(t *testing.T) {
+	provider, fetches := newTileServer(t, "secret-key")
+	dir := t.TempDir()
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.TileURL = provider.URL + "/{z}/{x}/{y}.png?apikey={key}"
+		cfg.TileKey = "secret-key"
+		cfg.TileCacheDir = dir
+		cfg.TileCacheTTL = 5 * time.Minute
+		cfg.TileDailyQuota = 2
+	})
+	fleet := model.NewOrganization("Fleet", "")
+	depot := model.NewOrganization("Depot", "")
+	for _, org := range []*model.Organization{fleet, depot} {
+		if err := env.app.Repositories.Organizations.Create(org); err != nil {
+			t.Fatalf("Failed to create organization: %v", err)
+		}
+	}
+
+	status, remaining, body := env.getTile(t, fleet.ID, "z=3&x=1&y=2")
+	if status != http.StatusOK || !bytes.Equal(body, tilePNG) {
+		t.Fatalf("Tile returned status %d with %q", status, body)
+	}
+	if remaining != "1" {
+		t.Errorf("X-Tile-Remaining = %q, want 1", remaining)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "3", "1", "2.tile")); err != nil {
+		t.Errorf("Tile not cached on disk: %v", err)
+	}
+
+	// Cached tiles are free, whichever organization asks
+	for _, orgID := range []string{fleet.ID, depot.ID} {
+		if status, _, body := env.getTile(t, orgID, "z=3&x=1&y=2"); status != http.StatusOK || !bytes.Equal(body, tilePNG) {
+			t.Errorf("Cached tile returned status %d with %q", status, body)
+		}
+	}
+	if n := atomic.LoadInt32(fetches); n != 1 {
+		t.Errorf("Provider served %d tiles, want 1", n)
+	}
+
+	// Each organization has its own quota
+	if status, _, _ := env.getTile(t, fleet.ID, "z=3&x=2&y=2"); status != http.StatusOK {
+		t.Fatalf("Second tile returned status %d", status)
+	}
+	if status, remaining, _ := env.getTile(t, fleet.ID, "z=3&x=3&y=3"); status != http.StatusTooManyRequests || remaining != "0" {
+		t.Errorf("Tile over the quota returned status %d with %q left, want 429", status, remaining)
+	}
+	if status, _, _ := env.getTile(t, depot.ID, "z=3&x=3&y=3"); status != http.StatusOK {
+		t.Errorf("Tile in another organization returned status %d", status)
+	}
+
+	// Expired tiles are fetched again
+	env.clock.Advance(10 * time.Minute)
+	before := atomic.LoadInt32(fetches)
+	if status, _, _ := env.getTile(t, depot.ID, "z=3&x=1&y=2"); status != http.StatusOK {
+		t.Fatalf("Expired tile returned status %d", status)
+	}
+	if n := atomic.LoadInt32(fetches); n != before+1 {
+		t.Errorf("Provider served %d tiles after expiry, want %d", n, before+1)
+	}
+
+	// Outside any organization fetches count against the user
+	for query, want := range map[string]int{
+		"z=3&x=8&y=0":  http.StatusBadRequest,
+		"z=23&x=0&y=0": http.StatusBadRequest,
+		"z=3&x=a&y=0":  http.StatusBadRequest,
+		"z=4&x=0&y=0":  http.StatusNotFound,
+	} {
+		if status, _, _ := env.getTile(t, "", query); status != want {
+			t.Errorf("Tile %s returned status %d, want %d", query, status, want)
+		}
+	}
+}
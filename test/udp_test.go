@@ -0,0 +1,97 @@
+package test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+	"tracking/internal/core/model"
+)
+
+// calampReport builds a CalAmp event report from ESN 4634616396, sent as an
+// acknowledged request, fixed at the given time in Dallas
+func calampReport(sequence uint16, fixTime time.Time) []byte {
+	buf := bytes.NewBuffer([]byte{0x83, 0x05, 0x46, 0x34, 0x61, 0x63, 0x96, 0x01, 0x01})
+	buf.Write([]byte{0x01, 0x02}) // Acknowledged event report
+	binary.Write(buf, binary.BigEndian, sequence)
+	binary.Write(buf, binary.BigEndian, uint32(fixTime.Unix()))
+	binary.Write(buf, binary.BigEndian, uint32(fixTime.Unix()))
+	binary.Write(buf, binary.BigEndian, int32(327766670))
+	binary.Write(buf, binary.BigEndian, int32(-967969870))
+	binary.Write(buf, binary.BigEndian, int32(13450))
+	binary.Write(buf, binary.BigEndian, uint32(2500))
+	binary.Write(buf, binary.BigEndian, uint16(135))
+	buf.Write([]byte{9, 0x02, 0x01, 0x36, 0xFF, 0xB9, 0x0F, 12, 0x01, 0x00, 1, 20, 0, 0})
+	return buf.Bytes()
+}
+
+// dialUDP opens a socket to the datagram listener
+func (e *testEnv) dialUDP(t *testing.T) net.Conn {
+	t.Helper()
+
+	conn, err := net.Dial("udp", e.app.UDPServer.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to open UDP socket: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestCalAmpOverUDP(t *testing.T) {
+	env := newTestEnv(t)
+	device := env.registerDevice(t, "4634616396", "calamp")
+	conn := env.dialUDP(t)
+
+	// Logged reports arrive oldest last; the device keeps the newest fix
+	newest := time.Date(2024, 1, 15, 9, 58, 20, 0, time.UTC)
+	for i, fixTime := range []time.Time{newest, newest.Add(-time.Minute)} {
+		if _, err := conn.Write(calampReport(uint16(0x100+i), fixTime)); err != nil {
+			t.Fatalf("Failed to send report: %v", err)
+		}
+
+		// The ACK names the report type and sequence
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		response := make([]byte, 64)
+		n, err := conn.Read(response)
+		if err != nil {
+			t.Fatalf("No ACK for report %d: %v", i, err)
+		}
+		if ack := response[:n]; n < 10 || !bytes.Equal(ack[n-10:n-5], []byte{0x02, 0x01, 0x01, byte(i), 0x02}) {
+			t.Errorf("ACK = % x", ack)
+		}
+	}
+
+	positions := env.positions(t, device.ID)
+	if len(positions) != 2 {
+		t.Fatalf("Got %d positions, want 2", len(positions))
+	}
+	var position *model.Position
+	for _, p := range positions {
+		if p.Timestamp.Equal(newest) {
+			position = p
+		}
+	}
+	if position == nil || position.Protocol != "calamp" || !almostEqual(position.Latitude, 32.776667, 0.000001) ||
+		!almostEqual(position.Speed, 90, 0.001) || position.Status["ignition"] != true {
+		t.Errorf("Positions = %+v", positions)
+	}
+
+	stored, _ := env.deviceRepo.FindByID(device.ID)
+	if stored == nil || stored.PositionID != position.ID {
+		t.Errorf("Device points at %v, want the newest position", stored)
+	}
+}
+
+func TestCalAmpUnknownDeviceIgnored(t *testing.T) {
+	env := newTestEnv(t)
+	conn := env.dialUDP(t)
+
+	if _, err := conn.Write(calampReport(1, testStart)); err != nil {
+		t.Fatalf("Failed to send report: %v", err)
+	}
+	conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	if n, err := conn.Read(make([]byte, 64)); err == nil {
+		t.Fatalf("Report from an unknown device was acknowledged with %d bytes", n)
+	}
+}
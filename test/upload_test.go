@@ -0,0 +1,114 @@
+package test
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"tracking/internal/protocol/gt06"
+)
+
+// gt06LocationAt is gt06LocationFrame reported at the given second
+func gt06LocationAt(second byte) []byte {
+	frame := append([]byte(nil), gt06LocationFrame...)
+	frame[21] = second/10<<4 | second%10
+	crc := gt06.CalculateChecksum(frame[2:22])
+	frame[22], frame[23] = byte(crc>>8), byte(crc)
+	return frame
+}
+
+// readLocationReplies reads until the server has answered want GT06
+// location frames, or stops sending, and returns how many it answered
+func readLocationReplies(t *testing.T, conn net.Conn, want int) int {
+	t.Helper()
+
+	reply := []byte{0x78, 0x78, 0x05, gt06LocationFrame[3]}
+	var received []byte
+	buffer := make([]byte, 1024)
+	for bytes.Count(received, reply) < want {
+		conn.SetReadDeadline(time.Now().Add(300 * time.Millisecond))
+		n, err := conn.Read(buffer)
+		if err != nil {
+			break
+		}
+		received = append(received, buffer[:n]...)
+	}
+	return bytes.Count(received, reply)
+}
+
+func TestGT06BufferedUpload(t *testing.T) {
+	env := newTestEnv(t)
+	device := env.registerDevice(t, "0353413532881372", "gt06")
+	conn := env.dialDevice(t)
+
+	// Positions buffered out of coverage follow the login in one write
+	upload := append([]byte(nil), gt06LoginFrame...)
+	for _, second := range []byte{10, 20, 30} {
+		upload = append(upload, gt06LocationAt(second)...)
+	}
+	if _, err := conn.Write(upload); err != nil {
+		t.Fatalf("Failed to send frames: %v", err)
+	}
+	if replies := readLocationReplies(t, conn, 3); replies != 3 {
+		t.Fatalf("Got %d replies, want one for each position", replies)
+	}
+
+	positions := env.positions(t, device.ID)
+	if len(positions) != 3 {
+		t.Fatalf("Got %d positions, want 3", len(positions))
+	}
+	for _, second := range []int{10, 20, 30} {
+		if positionAt(positions, time.Date(2023, 2, 14, 12, 15, second, 0, time.UTC)) == nil {
+			t.Errorf("No position stored at second %d", second)
+		}
+	}
+}
+
+func TestGT06BufferedUploadAckedUpToFailure(t *testing.T) {
+	env, flaky := newFlakyTestEnv(t)
+	device := env.registerDevice(t, "0353413532881372", "gt06")
+	conn := env.dialDevice(t)
+	exchange(t, conn, gt06LoginFrame)
+
+	flaky.failAfter(1, 1)
+	upload := append(append(gt06LocationAt(10), gt06LocationAt(20)...), gt06LocationAt(30)...)
+	if _, err := conn.Write(upload); err != nil {
+		t.Fatalf("Failed to send frames: %v", err)
+	}
+	if replies := readLocationReplies(t, conn, 3); replies != 1 {
+		t.Fatalf("Got %d replies, want only the stored frame answered", replies)
+	}
+	if positions := env.positions(t, device.ID); len(positions) != 1 {
+		t.Fatalf("Got %d positions, want 1", len(positions))
+	}
+
+	// The device resends what was not answered
+	if _, err := conn.Write(upload[len(gt06LocationFrame):]); err != nil {
+		t.Fatalf("Failed to send frames: %v", err)
+	}
+	if replies := readLocationReplies(t, conn, 2); replies != 2 {
+		t.Fatalf("Got %d replies to the resent frames, want 2", replies)
+	}
+	if positions := env.positions(t, device.ID); len(positions) != 3 {
+		t.Fatalf("Got %d positions, want 3", len(positions))
+	}
+}
+
+func TestH02BufferedUpload(t *testing.T) {
+	env := newTestEnv(t)
+	device := env.registerDevice(t, "4210051415", "h02")
+	conn := env.dialDevice(t)
+
+	upload := bytes.Join([][]byte{
+		h02SpeedFrame("121513", "2237.7514", 10, 90),
+		h02SpeedFrame("121613", "2237.8514", 10, 90),
+		h02SpeedFrame("121713", "2237.9514", 10, 90),
+	}, []byte("\r\n"))
+	if response := exchange(t, conn, upload); string(response) != "*HQ,OK#*HQ,OK#*HQ,OK#" {
+		t.Fatalf("Unexpected H02 response %q", response)
+	}
+	if positions := env.positions(t, device.ID); len(positions) != 3 {
+		t.Fatalf("Got %d positions, want 3", len(positions))
+	}
+}
@@ -0,0 +1,91 @@
+package test
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"tracking/internal/core/hook"
+	"tracking/internal/core/model"
+	"tracking/internal/core/watchdog"
+)
+
+func TestWatchdogReportsLostPositions(t *testing.T) {
+	env, flaky := newFlakyTestEnv(t)
+	lossy := env.registerDevice(t, "123456789012345", "h02")
+	healthy := env.registerDevice(t, "4210051415", "h02")
+
+	var mutex sync.Mutex
+	var events []*model.Event
+	env.app.Hooks.OnEvent(func(e *model.Event) {
+		if e.Type == model.EventIngestDiscrepancy {
+			mutex.Lock()
+			events = append(events, e)
+			mutex.Unlock()
+		}
+	})
+
+	// The failed write is lost even though the resent frame is stored
+	conn := env.dialDevice(t)
+	flaky.failNext(1)
+	expectNoResponse(t, conn, h02Frame)
+	if response := exchange(t, conn, h02Frame); string(response) != "*HQ,OK#" {
+		t.Fatalf("Unexpected H02 response %q", response)
+	}
+	other := env.dialDevice(t)
+	if response := exchange(t, other, h02SpeedFrame("120000", "2237.7514", 10, 90)); string(response) != "*HQ,OK#" {
+		t.Fatalf("Unexpected H02 response %q", response)
+	}
+	env.positions(t, lossy.ID)
+
+	// Positions of the current minute may still be in flight
+	if report := env.app.Watchdog.Check(); len(report.Discrepancies) != 0 || len(events) != 0 {
+		t.Fatalf("Report = %+v, want nothing before the minute settles", report)
+	}
+
+	env.clock.Advance(2 * time.Minute)
+	report := env.app.Watchdog.Check()
+	if report.Received[hook.SourceTCP] != 3 || report.Stored != 2 {
+		t.Errorf("Report = %+v, want 3 received and 2 stored", report)
+	}
+	if len(report.Discrepancies) != 1 {
+		t.Fatalf("Discrepancies = %+v, want one", report.Discrepancies)
+	}
+	if d := report.Discrepancies[0]; d.DeviceID != lossy.ID || d.Missing != 1 || d.Stored != 1 {
+		t.Errorf("Discrepancy = %+v, want one of two positions of %s missing", d, lossy.ID)
+	}
+
+	mutex.Lock()
+	if len(events) != 1 || events[0].DeviceID != lossy.ID || events[0].Attributes["missing"] != int64(1) {
+		t.Errorf("Events = %+v, want one ingestDiscrepancy for %s", events, lossy.ID)
+	}
+	mutex.Unlock()
+
+	// The same loss is not raised twice
+	env.app.Watchdog.Check()
+	mutex.Lock()
+	if len(events) != 1 {
+		t.Errorf("Got %d events after a second check, want 1", len(events))
+	}
+	mutex.Unlock()
+
+	var served watchdog.Report
+	if status := env.do(t, http.MethodGet, "/api/admin/watchdog", nil, &served); status != http.StatusOK {
+		t.Fatalf("Watchdog report returned status %d", status)
+	}
+	if len(served.Discrepancies) != 1 || served.Discrepancies[0].DeviceID != lossy.ID {
+		t.Errorf("Served report = %+v, want %s missing a position", served, lossy.ID)
+	}
+	for _, d := range served.Discrepancies {
+		if d.DeviceID == healthy.ID {
+			t.Errorf("Healthy device reported: %+v", d)
+		}
+	}
+
+	// The loss ages out of the window
+	env.clock.Advance(watchdog.DefaultWindow)
+	if report := env.app.Watchdog.Check(); len(report.Discrepancies) != 0 || report.Stored != 0 {
+		t.Errorf("Report = %+v, want an empty window", report)
+	}
+}
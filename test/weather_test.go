@@ -0,0 +1,99 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"tracking/internal/config"
+	"tracking/internal/core/model"
+	"tracking/internal/core/weather"
+)
+
+// newOpenMeteoServer answers hourly queries with rain at 18.5 °C, counting
+// the queries it answers
+func newOpenMeteoServer(t *testing.T) (*httptest.Server, *int32) {
+	t.Helper()
+
+	var queries int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&queries, 1)
+		hour := r.URL.Query().Get("start_hour")
+		if hour == "" || r.URL.Query().Get("latitude") == "" {
+			http.Error(w, "missing parameters", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"hourly": {"time": [%q], "temperature_2m": [18.5], "precipitation": [2.4],
+			"wind_speed_10m": [21.0], "weather_code": [63]}}`, hour)
+	}))
+	t.Cleanup(server.Close)
+	return server, &queries
+}
+
+func TestWeatherEnrichment(t *testing.T) {
+	openMeteo, queries := newOpenMeteoServer(t)
+	env := newTestEnv(t, func(cfg *config.Config) { cfg.WeatherURL = openMeteo.URL })
+	device := env.registerDevice(t, "4210051415", "h02")
+	if status := env.do(t, http.MethodPut, "/api/devices/speed-limit?id="+device.ID, map[string]float64{"speedLimit": 60}, nil); status != http.StatusOK {
+		t.Fatalf("Setting the speed limit returned status %d", status)
+	}
+
+	events := make(chan *model.Event, 4)
+	env.app.Hooks.OnEvent(func(e *model.Event) {
+		if e.Type == model.EventOverspeed {
+			events <- e
+		}
+	})
+
+	conn := env.dialDevice(t)
+	frames := [][]byte{
+		// SOS alarm, enriched when decoded
+		[]byte("*HQ,4210051415,V1,121000,A,2237.7514,N,11408.6214,E,0,0,151022,FFFBFFFF#"),
+		h02SpeedFrame("121500", "2237.7514", 40, 90), // Overspeed in the same cell and hour
+		h02SpeedFrame("130000", "2237.7514", 20, 90),
+		h02SpeedFrame("131500", "2237.7514", 40, 90), // Overspeed an hour later
+	}
+	for _, frame := range frames {
+		exchange(t, conn, frame)
+	}
+
+	positions := env.positions(t, device.ID)
+	var alarm *model.Position
+	for _, position := range positions {
+		if position.Status["alarm"] == "sos" {
+			alarm = position
+		}
+	}
+	if alarm == nil {
+		t.Fatal("No SOS position stored")
+	}
+	var conditions weather.Conditions
+	raw, _ := json.Marshal(alarm.Status[weather.AttributeWeather])
+	if err := json.Unmarshal(raw, &conditions); err != nil || conditions.Temperature != 18.5 || conditions.Summary != "rain" {
+		t.Errorf("Alarm position weather = %s, want rain at 18.5", raw)
+	}
+	for _, position := range positions {
+		if _, ok := position.Status[weather.AttributeWeather]; ok && position != alarm {
+			t.Errorf("Position without an alarm was enriched: %v", position.Status)
+		}
+	}
+
+	if len(events) != 2 {
+		t.Fatalf("Got %d overspeed events, want 2", len(events))
+	}
+	for i := 0; i < 2; i++ {
+		event := <-events
+		if conditions, ok := event.Attributes[weather.AttributeWeather].(*weather.Conditions); !ok || conditions.Code != 63 {
+			t.Errorf("Event %d weather = %v", i, event.Attributes[weather.AttributeWeather])
+		}
+	}
+
+	// The alarm and the first overspeed share a cell and hour
+	if n := atomic.LoadInt32(queries); n != 2 {
+		t.Errorf("Open-Meteo was queried %d times, want 2", n)
+	}
+}
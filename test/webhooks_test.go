@@ -0,0 +1,128 @@
+package test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"tracking/internal/core/model"
+	"tracking/internal/core/webhook"
+)
+
+func TestUserWebhooks(t *testing.T) {
+	const secret = "alarm-secret"
+	alarms := make(chan *model.Event, 10)
+	everything := make(chan *model.Event, 10)
+	var alarmCalls atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var event model.Event
+		if err := json.Unmarshal(body, &event); err != nil {
+			t.Errorf("Failed to decode webhook body: %v", err)
+		}
+		switch r.URL.Path {
+		case "/alarms":
+			// The first delivery fails and is retried
+			if alarmCalls.Add(1) == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			if r.Header.Get(webhook.SignatureHeader) != webhook.Sign([]byte(secret), body) {
+				t.Errorf("Bad signature %q", r.Header.Get(webhook.SignatureHeader))
+			}
+			alarms <- &event
+		case "/all":
+			if r.Header.Get(webhook.SignatureHeader) != "" {
+				t.Errorf("Signature %q without a secret", r.Header.Get(webhook.SignatureHeader))
+			}
+			everything <- &event
+		}
+	}))
+	t.Cleanup(receiver.Close)
+
+	env := newTestEnv(t)
+	truck := env.registerDevice(t, "4210051415", "h02")
+
+	for _, invalid := range []model.Webhook{
+		{URL: "ftp://example.com/hook"},
+		{URL: "/relative"},
+		{URL: receiver.URL, EventTypes: []string{"sunrise"}},
+	} {
+		if status := env.do(t, http.MethodPost, "/api/webhooks", invalid, nil); status != http.StatusBadRequest {
+			t.Errorf("Creating %+v returned status %d, want 400", invalid, status)
+		}
+	}
+
+	var alarmHook, allHook model.Webhook
+	if status := env.do(t, http.MethodPost, "/api/webhooks", model.Webhook{
+		URL: receiver.URL + "/alarms", Secret: secret, EventTypes: []string{model.EventAlarm},
+	}, &alarmHook); status != http.StatusOK {
+		t.Fatalf("Creating the alarm webhook returned status %d", status)
+	}
+	if status := env.do(t, http.MethodPost, "/api/webhooks", model.Webhook{URL: receiver.URL + "/all"}, &allHook); status != http.StatusOK {
+		t.Fatalf("Creating the catch-all webhook returned status %d", status)
+	}
+
+	var listed []*model.Webhook
+	if status := env.do(t, http.MethodGet, "/api/webhooks", nil, &listed); status != http.StatusOK {
+		t.Fatalf("Listing webhooks returned status %d", status)
+	}
+	if len(listed) != 2 || listed[0].ID != alarmHook.ID || listed[1].ID != allHook.ID {
+		t.Errorf("Webhooks = %+v", listed)
+	}
+
+	conn := env.dialDevice(t)
+	exchange(t, conn, []byte("*HQ,4210051415,V1,120000,A,2237.7514,N,11408.6214,E,0,0,151022,FFFBFFFF#"))
+
+	select {
+	case event := <-alarms:
+		if event.Type != model.EventAlarm || event.DeviceID != truck.ID || event.Attributes["alarm"] != "sos" {
+			t.Errorf("Alarm webhook got %+v", event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("No alarm webhook")
+	}
+	// The catch-all webhook hears of the connection too
+	seen := map[string]bool{}
+	for len(seen) < 2 {
+		select {
+		case event := <-everything:
+			seen[event.Type] = true
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Catch-all webhook got %v, want deviceOnline and alarm", seen)
+		}
+	}
+	if !seen[model.EventDeviceOnline] || !seen[model.EventAlarm] {
+		t.Errorf("Catch-all webhook got %v", seen)
+	}
+
+	// Webhooks of other users are out of reach
+	other := env.memberToken(t, "other-user", "")
+	if status := env.doAs(t, other, "", http.MethodPut, "/api/webhooks?id="+alarmHook.ID, alarmHook, nil); status != http.StatusNotFound {
+		t.Errorf("Updating another user's webhook returned status %d, want 404", status)
+	}
+	if status := env.doAs(t, other, "", http.MethodPost, "/api/webhooks/delete?id="+alarmHook.ID, nil, nil); status != http.StatusNotFound {
+		t.Errorf("Deleting another user's webhook returned status %d, want 404", status)
+	}
+
+	alarmHook.EventTypes = []string{model.EventAlarm, model.EventLowBattery}
+	var updated model.Webhook
+	if status := env.do(t, http.MethodPut, "/api/webhooks?id="+alarmHook.ID, alarmHook, &updated); status != http.StatusOK {
+		t.Fatalf("Updating the alarm webhook returned status %d", status)
+	}
+	if len(updated.EventTypes) != 2 || updated.UserID != testUserID || !updated.CreatedAt.Equal(alarmHook.CreatedAt) {
+		t.Errorf("Updated webhook = %+v", updated)
+	}
+	if status := env.do(t, http.MethodPost, "/api/webhooks/delete?id="+allHook.ID, nil, nil); status != http.StatusOK {
+		t.Fatalf("Deleting the catch-all webhook returned status %d", status)
+	}
+	listed = nil
+	env.do(t, http.MethodGet, "/api/webhooks", nil, &listed)
+	if len(listed) != 1 || listed[0].ID != alarmHook.ID {
+		t.Errorf("Webhooks after the delete = %+v", listed)
+	}
+}
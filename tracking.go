@@ -0,0 +1,335 @@
+// Package tracking embeds the GPS tracking server in another Go program.
+//
+// A Server bundles the TCP device listener, the HTTP API and their storage:
+//
+//	server, err := tracking.New(
+//		tracking.WithTCPPort(5023),
+//		tracking.WithHTTPAddr("0.0.0.0", "8000"),
+//		tracking.OnPosition(func(p *tracking.Position) { log.Println(p.DeviceID) }),
+//	)
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	if err := server.Start(); err != nil {
+//		log.Fatal(err)
+//	}
+//	defer server.Stop(context.Background())
+package tracking
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+
+	"tracking/internal/app"
+	"tracking/internal/config"
+	"tracking/internal/core/hook"
+	"tracking/internal/core/model"
+	"tracking/internal/core/util"
+	"tracking/internal/protocol/gt06"
+	"tracking/internal/protocol/registry"
+)
+
+type (
+	// Position is a decoded fix reported by a device
+	Position = model.Position
+	// Device is a tracker registered with the server
+	Device = model.Device
+	// Event is a notable occurrence such as a device going online
+	Event = model.Event
+	// Clock supplies the current time
+	Clock = util.Clock
+	// Stage is a point of the ingest pipeline where position hooks run
+	Stage = hook.Stage
+	// PositionHook enriches or vets a position; see RegisterPositionHook
+	PositionHook = hook.PositionHook
+	// Command is a remote-control action sent to a connected device
+	Command = gt06.Command
+	// Protocol describes an additional device protocol; see RegisterProtocol
+	Protocol = registry.Protocol
+	// ProtocolDecoder decodes the frames of a Protocol for one server
+	ProtocolDecoder = registry.Decoder
+)
+
+// Pipeline stages for position hooks
+const (
+	// StageDecoded runs before storage; hooks may modify the position and
+	// an error rejects it
+	StageDecoded = hook.StageDecoded
+	// StageStored runs after storage; errors are only logged
+	StageStored = hook.StageStored
+)
+
+// Event types raised by the server
+const (
+	EventDeviceOnline      = model.EventDeviceOnline
+	EventDeviceOffline     = model.EventDeviceOffline
+	EventDeviceCreated     = model.EventDeviceCreated
+	EventDeviceDeleted     = model.EventDeviceDeleted
+	EventDeviceTransferred = model.EventDeviceTransferred
+	EventCommandResult     = model.EventCommandResult
+	EventOverspeed         = model.EventOverspeed
+	EventGeofenceEnter     = model.EventGeofenceEnter
+	EventGeofenceExit      = model.EventGeofenceExit
+	EventAlarm             = model.EventAlarm
+	EventLowBattery        = model.EventLowBattery
+)
+
+// Commands accepted by SendCommand
+const (
+	CommandEngineStop   = gt06.CommandEngineStop
+	CommandEngineResume = gt06.CommandEngineResume
+	CommandLocate       = gt06.CommandLocate
+	CommandReboot       = gt06.CommandReboot
+)
+
+type options struct {
+	config           *config.Config
+	clock            Clock
+	inMemory         bool
+	debug            bool
+	positionHandlers []func(*Position)
+	eventHandlers    []func(*Event)
+	positionHooks    []stagedHook
+}
+
+type stagedHook struct {
+	stage Stage
+	hook  PositionHook
+}
+
+// Option configures a Server
+type Option func(*options)
+
+// WithHTTPAddr sets the address the HTTP API listens on; port "0" picks a free port
+func WithHTTPAddr(host, port string) Option {
+	return func(o *options) {
+		o.config.Host = host
+		o.config.Port = port
+	}
+}
+
+// WithTCPPort sets the port devices connect to; 0 picks a free port
+func WithTCPPort(port int) Option {
+	return func(o *options) {
+		o.config.TCPPort = port
+	}
+}
+
+// WithUDPPort sets the port datagram devices report to; 0 picks a free port
+// and a negative port disables the UDP listener
+func WithUDPPort(port int) Option {
+	return func(o *options) {
+		o.config.UDPPort = port
+	}
+}
+
+// WithTCPTimeouts closes device connections silent for idle and bounds each
+// write to a device by write; zero disables either
+func WithTCPTimeouts(idle, write time.Duration) Option {
+	return func(o *options) {
+		o.config.TCPIdleTimeout = idle
+		o.config.TCPWriteTimeout = write
+	}
+}
+
+// WithTCPLimits caps the device connections open at once and, per remote
+// IP, the connections and packets accepted per minute; zero disables each
+func WithTCPLimits(maxConnections, connectionsPerMinute, packetsPerMinute int) Option {
+	return func(o *options) {
+		o.config.TCPMaxConnections = maxConnections
+		o.config.TCPConnectionsPerMinute = connectionsPerMinute
+		o.config.TCPPacketsPerMinute = packetsPerMinute
+	}
+}
+
+// WithIngestWorkers stores TCP positions on a pool of workers fed from a
+// queue of queueSize frames, each storing up to batchSize positions at once
+func WithIngestWorkers(workers, queueSize, batchSize int) Option {
+	return func(o *options) {
+		o.config.IngestWorkers = workers
+		o.config.IngestQueueSize = queueSize
+		o.config.IngestBatchSize = batchSize
+	}
+}
+
+// WithPluginDir loads the Go plugins (*.so) in dir, which add protocols by
+// calling RegisterProtocol from their init functions
+func WithPluginDir(dir string) Option {
+	return func(o *options) {
+		o.config.PluginDir = dir
+	}
+}
+
+// RegisterProtocol adds a protocol to servers created afterwards. Frames are
+// offered to it after the built-in text protocols and before NMEA and
+// Teltonika. It panics when the name is taken.
+func RegisterProtocol(protocol *Protocol) {
+	registry.Register(protocol)
+}
+
+// WithInMemoryStorage keeps all data in memory instead of MongoDB
+func WithInMemoryStorage() Option {
+	return func(o *options) {
+		o.inMemory = true
+	}
+}
+
+// WithClock replaces the wall clock
+func WithClock(clock Clock) Option {
+	return func(o *options) {
+		o.clock = clock
+	}
+}
+
+// WithDebug enables protocol debug logging
+func WithDebug(enable bool) Option {
+	return func(o *options) {
+		o.debug = enable
+	}
+}
+
+// OnPosition registers a handler called after each position is stored
+func OnPosition(handler func(*Position)) Option {
+	return func(o *options) {
+		o.positionHandlers = append(o.positionHandlers, handler)
+	}
+}
+
+// OnEvent registers a handler called for each event the server raises
+func OnEvent(handler func(*Event)) Option {
+	return func(o *options) {
+		o.eventHandlers = append(o.eventHandlers, handler)
+	}
+}
+
+// WithPositionHook registers a position hook run at the given stage
+func WithPositionHook(stage Stage, positionHook PositionHook) Option {
+	return func(o *options) {
+		o.positionHooks = append(o.positionHooks, stagedHook{stage, positionHook})
+	}
+}
+
+// Server is an embeddable tracking server
+type Server struct {
+	app *app.App
+}
+
+// New builds a Server. Settings not given as options are read from the
+// environment, as for the standalone binary.
+func New(opts ...Option) (*Server, error) {
+	o := &options{
+		config: config.LoadConfig(),
+		clock:  util.SystemClock,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	appOpts := []app.Option{app.WithClock(o.clock)}
+	if o.inMemory {
+		appOpts = append(appOpts, app.WithRepositories(app.NewInMemoryRepositories()))
+	}
+
+	a, err := app.New(o.config, appOpts...)
+	if err != nil {
+		return nil, err
+	}
+	a.TCPServer.EnableDebug(o.debug)
+	if a.UDPServer != nil {
+		a.UDPServer.EnableDebug(o.debug)
+	}
+
+	s := &Server{app: a}
+	for _, handler := range o.positionHandlers {
+		s.OnPosition(handler)
+	}
+	for _, handler := range o.eventHandlers {
+		s.OnEvent(handler)
+	}
+	for _, h := range o.positionHooks {
+		s.RegisterPositionHook(h.stage, h.hook)
+	}
+	return s, nil
+}
+
+// OnPosition registers a handler called after each position is stored
+func (s *Server) OnPosition(handler func(*Position)) {
+	s.app.Hooks.OnPosition(handler)
+}
+
+// OnEvent registers a handler called for each event the server raises
+func (s *Server) OnEvent(handler func(*Event)) {
+	s.app.Hooks.OnEvent(handler)
+}
+
+// RegisterPositionHook adds a hook run for every position, from TCP and
+// HTTP alike, at the given pipeline stage
+func (s *Server) RegisterPositionHook(stage Stage, positionHook PositionHook) {
+	s.app.Hooks.RegisterPositionHook(stage, positionHook)
+}
+
+// Start opens the TCP, UDP and HTTP listeners
+func (s *Server) Start() error {
+	return s.app.Start()
+}
+
+// Stop closes the listeners and waits for in-flight HTTP requests
+func (s *Server) Stop(ctx context.Context) error {
+	return s.app.Shutdown(ctx)
+}
+
+// Handler returns the HTTP API, for mounting inside an existing server
+func (s *Server) Handler() http.Handler {
+	return s.app.Handler
+}
+
+// HTTPAddr returns the HTTP listener address, or nil before Start
+func (s *Server) HTTPAddr() net.Addr {
+	return s.app.HTTPAddr()
+}
+
+// TCPAddr returns the device listener address, or nil before Start
+func (s *Server) TCPAddr() net.Addr {
+	return s.app.TCPServer.Addr()
+}
+
+// UDPAddr returns the datagram listener address, or nil before Start or
+// when the listener is disabled
+func (s *Server) UDPAddr() net.Addr {
+	if s.app.UDPServer == nil {
+		return nil
+	}
+	return s.app.UDPServer.Addr()
+}
+
+// RegisterDevice adds a device so it is accepted when it connects
+func (s *Server) RegisterDevice(device *Device) error {
+	return s.app.Repositories.Devices.Create(device)
+}
+
+// SendCommand delivers a command to a connected GT06 or H02 device; its
+// reply arrives as an EventCommandResult event
+func (s *Server) SendCommand(deviceID string, command Command) error {
+	return s.app.TCPServer.SendCommand(deviceID, command)
+}
+
+// SetReportInterval changes how often a connected GT06 or H02 device
+// reports
+func (s *Server) SetReportInterval(deviceID string, interval time.Duration) error {
+	return s.app.TCPServer.SetReportInterval(deviceID, interval)
+}
+
+// SetCornerReporting makes a connected GT06 device report as its heading
+// turns by the angle in degrees; zero turns corner reports off
+func (s *Server) SetCornerReporting(deviceID string, angle int) error {
+	return s.app.TCPServer.SetCornerReporting(deviceID, angle)
+}
+
+// NewDevice creates a device record with fresh API credentials
+func NewDevice(name, uniqueID, protocol string) *Device {
+	device := model.NewDevice(name, uniqueID)
+	device.Protocol = protocol
+	return device
+}